@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/signal"
 	"syscall"
@@ -11,19 +12,31 @@ import (
 
 	"github.com/docshare/api/internal/config"
 	"github.com/docshare/api/internal/database"
+	"github.com/docshare/api/internal/grpcapi"
 	"github.com/docshare/api/internal/handlers"
 	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
 	"github.com/docshare/api/internal/services"
 	"github.com/docshare/api/internal/storage"
 	"github.com/docshare/api/pkg/logger"
 	"github.com/docshare/api/pkg/previewtoken"
 	"github.com/docshare/api/pkg/utils"
+	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"gorm.io/gorm"
 )
 
+// bufferedBodyLimit is the size up to which a body is read into memory
+// before the handler runs; larger ones are streamed. How large a body each
+// route accepts is up to the BODY_LIMIT_* settings.
+const bufferedBodyLimit = 8 * 1024 * 1024
+
+// cleanupInterval is how often expired rows are swept.
+const cleanupInterval = 10 * time.Minute
+
 func main() {
 	logger.Init()
 
@@ -36,14 +49,34 @@ func main() {
 	if err != nil {
 		log.Fatalf("database connection failed: %v", err)
 	}
+	database.MonitorPool(db, time.Minute)
+
+	jobRunner := services.NewJobRunner(db, cfg.Jobs)
+	for kind, cleanup := range map[string]func(*gorm.DB) error{
+		"cleanup.device_codes":   handlers.CleanupExpiredDeviceCodes,
+		"cleanup.transfers":      handlers.CleanupExpiredTransfers,
+		"cleanup.mfa_challenges": handlers.CleanupExpiredMFAChallenges,
+		"cleanup.locks":          services.CleanupExpiredLocks,
+		"cleanup.outbox":         services.CleanupDispatchedEvents,
+		"cleanup.captcha_passes": services.CleanupExpiredCaptchaPasses,
+		"cleanup.idempotency":    services.CleanupExpiredIdempotencyKeys,
+		"cleanup.preview_tokens": services.CleanupExpiredPreviewTokenUses,
+		"cleanup.request_nonces": services.CleanupExpiredRequestNonces,
+	} {
+		jobRunner.Every(kind, cleanupInterval, func(ctx context.Context, _ *models.Job) error {
+			return cleanup(db.WithContext(ctx))
+		})
+	}
+	jobRunner.Every("cleanup.jobs", cleanupInterval, func(ctx context.Context, _ *models.Job) error {
+		return jobRunner.CleanupCompleted(ctx)
+	})
 
+	// Consumed MFA token IDs are held in this process's memory, so they
+	// are swept here rather than by a job that may run on another instance.
 	go func() {
-		ticker := time.NewTicker(10 * time.Minute)
+		ticker := time.NewTicker(cleanupInterval)
 		defer ticker.Stop()
 		for range ticker.C {
-			handlers.CleanupExpiredDeviceCodes(db)
-			handlers.CleanupExpiredTransfers(db)
-			handlers.CleanupExpiredMFAChallenges(db)
 			utils.CleanupExpiredJTIs()
 		}
 	}()
@@ -55,64 +88,297 @@ func main() {
 	if err := storageClient.EnsureBucket(context.Background()); err != nil {
 		log.Fatalf("failed ensuring s3 bucket: %v", err)
 	}
+	var regionRouter *storage.RegionRouter
+	if len(cfg.Regions.Replicas) > 0 {
+		replicas := make([]storage.Region, 0, len(cfg.Regions.Replicas))
+		for _, replicaCfg := range cfg.Regions.Replicas {
+			replicaClient, err := storage.NewS3Client(replicaCfg)
+			if err != nil {
+				log.Fatalf("s3 replica %s initialization failed: %v", replicaCfg.Region, err)
+			}
+			replicas = append(replicas, storage.Region{Name: replicaCfg.Region, Client: replicaClient})
+		}
+		regionRouter = storage.NewRegionRouter(storage.Region{Name: cfg.S3.Region, Client: storageClient}, replicas, cfg.Regions.ReplicationLag)
+		go regionRouter.Run(context.Background(), cfg.Regions.ProbeInterval)
+	}
 
+	eventBus, err := services.NewEventBus(cfg.EventBus, db, database.DSN(cfg.DB))
+	if err != nil {
+		log.Fatalf("invalid event bus configuration: %v", err)
+	}
+
+	settingsService, err := services.NewSettingsService(db, cfg)
+	if err != nil {
+		log.Fatalf("invalid IP policy: %v", err)
+	}
+	settingsService.UseEventBus(eventBus)
+	signingKeys := services.NewSigningKeys(db)
+	if err := signingKeys.Load(context.Background()); err != nil {
+		log.Fatalf("failed loading signing keys: %v", err)
+	}
+	signingKeys.UseEventBus(eventBus)
+	signingKeys.Refresh(services.DefaultSigningKeyRefreshInterval)
+	captchaService, err := services.NewCaptchaService(db, cfg.Captcha)
+	if err != nil {
+		log.Fatalf("invalid CAPTCHA configuration: %v", err)
+	}
 	accessService := services.NewAccessService(db)
+	accessService.DisableSuspendedUserShares = !cfg.Accounts.SuspendedUserSharesActive
+	accessService.Settings = settingsService
+	gotenbergPool := services.NewGotenbergPool(cfg.Gotenberg)
 	previewService := services.NewPreviewService(db, storageClient, cfg.Gotenberg)
-	previewQueueService := services.NewPreviewQueueService(db, previewService, cfg.Preview)
+	previewService.Settings = settingsService
+	previewService.Pool = gotenbergPool
+	previewQueueService := services.NewPreviewQueueService(db, previewService, jobRunner, cfg.Preview)
+	textPreviewService := services.NewTextPreviewService(storageClient, cfg.Preview)
 	exportService := services.NewExportService(storageClient, cfg.Gotenberg)
+	exportService.Pool = gotenbergPool
 	auditService := services.NewAuditService(db, storageClient)
-	auditService.StartExporter(cfg.Audit.ExportInterval)
-
-	authHandler := handlers.NewAuthHandler(db, auditService)
+	auditService.ScheduleExport(jobRunner, cfg.Audit.ExportInterval)
+	auditSinks, err := services.NewAuditSinks(cfg.Audit)
+	if err != nil {
+		log.Fatalf("invalid audit sink configuration: %v", err)
+	}
+	auditService.ScheduleSinks(jobRunner, auditSinks, cfg.Audit.SinkInterval)
+	auditRetention := services.NewAuditRetention(db, services.S3MirrorBucket{S3Client: storageClient}, cfg.Audit)
+	auditRetention.Schedule(jobRunner)
+	storageReconciler := services.NewStorageReconciler(db, storageClient, jobRunner)
+	integrityChecker := services.NewIntegrityChecker(db, jobRunner)
+	integrityChecker.Schedule()
+	services.NewPublicSharePolicyEnforcer(db, settingsService).Schedule(jobRunner)
+	uploadPolicy := services.NewUploadPolicy(cfg.Uploads)
+	importer := services.NewImporter(db, storageClient, jobRunner, uploadPolicy, cfg.Import)
+	integrations := services.NewIntegrations(db, cfg.Integrations, cfg.JWT.Secret, importer)
+	scanner := services.NewScanner(cfg.Scan)
+	transferRelay := services.NewTransferRelay(db, services.S3MirrorBucket{S3Client: storageClient}, jobRunner, scanner, auditService, cfg.Scan)
+	jobRunner.Every("cleanup.transfer_objects", cleanupInterval, func(ctx context.Context, _ *models.Job) error {
+		return transferRelay.PurgeFinished(ctx)
+	})
+	resumableUploads := services.NewResumableUploads(db, services.S3MirrorBucket{S3Client: storageClient})
+	jobRunner.Every("cleanup.resumable_uploads", cleanupInterval, func(ctx context.Context, _ *models.Job) error {
+		return resumableUploads.Purge(ctx)
+	})
+	classifier := services.NewClassifier(db, jobRunner, scanner, services.S3MirrorBucket{S3Client: storageClient})
+	lockService := services.NewLockService(db)
+	changeFeed := services.NewChangeFeed(db, accessService)
+	changeFeed.UseEventBus(eventBus)
+	folderRollups := services.NewFolderRollups(db, jobRunner)
+	groupQuotas := services.NewGroupQuotas(db)
+	languageDetector := services.NewLanguageDetector(db, jobRunner, services.S3MirrorBucket{S3Client: storageClient})
+	outboxDispatcher := services.NewOutboxDispatcher(db, auditService, changeFeed, folderRollups, groupQuotas, languageDetector)
+	var storageMirror *services.StorageMirror
+	if cfg.Mirror.Enabled() {
+		mirrorClient, err := storage.NewS3Client(cfg.Mirror.Target)
+		if err != nil {
+			log.Fatalf("mirror s3 initialization failed: %v", err)
+		}
+		if err := mirrorClient.EnsureBucket(context.Background()); err != nil {
+			log.Fatalf("failed ensuring mirror bucket: %v", err)
+		}
+		storageMirror = services.NewStorageMirror(db, services.S3MirrorBucket{S3Client: storageClient}, services.S3MirrorBucket{S3Client: mirrorClient}, jobRunner, cfg.Mirror.Deletes)
+		outboxDispatcher.Subscribe(storageMirror)
+	}
+	var coldStorage *services.ColdStorage
+	if cfg.Archive.Enabled() {
+		archiveClient, err := storage.NewS3Client(cfg.Archive.Target)
+		if err != nil {
+			log.Fatalf("archive s3 initialization failed: %v", err)
+		}
+		if err := archiveClient.EnsureBucket(context.Background()); err != nil {
+			log.Fatalf("failed ensuring archive bucket: %v", err)
+		}
+		coldStorage = services.NewColdStorage(db, services.S3MirrorBucket{S3Client: storageClient}, services.S3ArchiveBucket{S3MirrorBucket: services.S3MirrorBucket{S3Client: archiveClient}}, jobRunner, cfg.Archive.RestoreDelay)
+	}
+	outboxDispatcher.Start(cfg.Outbox.PollInterval)
+	if cfg.Manifest.SigningKey == "" {
+		log.Println("warning: MANIFEST_SIGNING_KEY not set, deriving manifest signing key from JWT_SECRET")
+	}
+	manifestService, err := services.NewManifestService(db, storageClient, cfg.Manifest, cfg.JWT.Secret)
+	if err != nil {
+		log.Fatalf("failed loading manifest signing key: %v", err)
+	}
+	legalExports := services.NewLegalExports(db, services.S3MirrorBucket{S3Client: storageClient}, jobRunner, manifestService)
+	mailer, err := services.NewMailer(cfg.SMTP)
+	if err != nil {
+		log.Fatalf("invalid SMTP configuration: %v", err)
+	}
+	dueDates := services.NewDueDates(db, accessService, mailer, cfg.DueDates, cfg.Server.FrontendURL)
+	dueDates.Schedule(jobRunner)
+	jobRunner.Start()
+
+	fileAnalytics := services.NewFileAnalyticsService(db, cfg.JWT.Secret, cfg.Server.FrontendURL)
+	downloadLimiter := services.NewDownloadLimiter(db, cfg.Downloads)
+	sessionService := services.NewSessionService(db, cfg.Sessions, mailer)
+
+	authHandler := handlers.NewAuthHandler(db, auditService, sessionService)
+	authHandler.Settings = settingsService
+	termsService := services.NewTermsService(db, settingsService)
+	authHandler.Terms = termsService
+	authHandler.Avatars = services.NewAvatarService(db, services.S3MirrorBucket{S3Client: storageClient})
 	usersHandler := handlers.NewUsersHandler(db, auditService)
+	usersHandler.Settings = settingsService
 	groupsHandler := handlers.NewGroupsHandler(db, auditService)
-	filesHandler := handlers.NewFilesHandler(db, storageClient, accessService, previewService, previewQueueService, exportService, auditService, int64(cfg.Server.MaxUploadMB)*1024*1024)
-	sharesHandler := handlers.NewSharesHandler(db, accessService, auditService)
+	groupsHandler.Quotas = groupQuotas
+	organizationsHandler := handlers.NewOrganizationsHandler(db, auditService)
+	organizationsHandler.Settings = settingsService
+	filesHandler := handlers.NewFilesHandler(db, storageClient, accessService, previewService, previewQueueService, textPreviewService, exportService, auditService, lockService, manifestService, uploadPolicy, fileAnalytics, downloadLimiter, int64(cfg.Server.MaxUploadMB)*1024*1024)
+	filesHandler.Settings = settingsService
+	filesHandler.PreviewTokens = services.NewPreviewTokens(db, settingsService)
+	filesHandler.Captcha = captchaService
+	filesHandler.Uploads = resumableUploads
+	filesHandler.Classifier = classifier
+	filesHandler.GroupQuotas = groupQuotas
+	filesHandler.Archiver = coldStorage
+	filesHandler.Regions = regionRouter
+	filesHandler.ArchiveContents = services.NewArchiveContents(cfg.Preview)
+	filesHandler.Extractor = services.NewArchiveExtractor(db, services.S3MirrorBucket{S3Client: storageClient}, jobRunner, uploadPolicy, cfg.Preview)
+	filesHandler.ArchiveBuilder = services.NewArchiveBuilder(db, services.S3MirrorBucket{S3Client: storageClient}, jobRunner, accessService, cfg.Preview)
+	filesHandler.DueDates = dueDates
+	filesHandler.Pastes = services.NewPastes(db, services.S3MirrorBucket{S3Client: storageClient}, cfg.Pastes)
+	filesHandler.FrontendURL = cfg.Server.FrontendURL
+	renditionService := services.NewRenditionService(services.S3MirrorBucket{S3Client: storageClient}, cfg.Gotenberg)
+	renditionService.Pool = gotenbergPool
+	if rasterizer := services.NewPopplerRasterizer(); rasterizer != nil {
+		renditionService.Rasterizer = rasterizer
+	} else {
+		logger.Info("page_rendering_disabled", map[string]interface{}{
+			"reason": "pdfinfo or pdftoppm not found",
+		})
+	}
+	filesHandler.Renditions = renditionService
+	sharesHandler := handlers.NewSharesHandler(db, accessService, auditService, mailer, cfg)
+	sharesHandler.Captcha = captchaService
+	if sharesHandler.QRLogo, err = services.LoadQRLogo(cfg.Branding.QRLogo); err != nil {
+		log.Fatalf("failed loading QR logo: %v", err)
+	}
+	vaults := services.NewVaults(db)
+	filesHandler.Vaults = vaults
+	sharesHandler.Vaults = vaults
+	vaultsHandler := handlers.NewVaultsHandler(db, vaults, accessService, auditService)
 	activitiesHandler := handlers.NewActivitiesHandler(db)
+	notifyHandler := handlers.NewNotifyHandler(changeFeed)
 	auditHandler := handlers.NewAuditHandler(db)
+	auditHandler.Retention = auditRetention
 	apiTokenHandler := handlers.NewAPITokenHandler(db, auditService)
-	deviceAuthHandler := handlers.NewDeviceAuthHandler(db, auditService, cfg)
-	transfersHandler := handlers.NewTransfersHandler(db, 300)
-	ssoHandler := handlers.NewSSOHandler(db, cfg)
-
+	hmacKeys := services.NewHMACKeys(db)
+	hmacKeyHandler := handlers.NewHMACKeyHandler(db, hmacKeys, auditService)
+	deviceAuthHandler := handlers.NewDeviceAuthHandler(db, auditService, cfg, sessionService)
+	transfersHandler := handlers.NewTransfersHandler(db, uploadPolicy, 300)
+	transfersHandler.Relay = transferRelay
+	transfersHandler.Access = accessService
+	transfersHandler.Links = services.NewTransferLinks(db, cfg.JWT.Secret, cfg.Server.FrontendURL)
+	transfersHandler.Audit = auditService
+	propertiesHandler := handlers.NewPropertiesHandler(db, filesHandler.Properties, auditService)
+	reviewsHandler := handlers.NewReviewsHandler(db, filesHandler.Reviews)
+	templatesHandler := handlers.NewTemplatesHandler(db, accessService, services.NewFolderTemplates(db, services.S3MirrorBucket{S3Client: storageClient}), auditService)
+	ssoHandler := handlers.NewSSOHandler(db, cfg, auditService, sessionService)
+	ssoHandler.Providers.UseEventBus(eventBus)
+	versionHandler := handlers.NewVersionHandler(cfg, settingsService, ssoHandler.Providers, integrations)
+	versionHandler.PageRendering = renditionService.Rasterizer != nil
+	eventBus.Start()
+	devicesHandler := handlers.NewDevicesHandler(db, auditService)
+	jobsHandler := handlers.NewJobsHandler(db, jobRunner, auditService)
+	conversionsHandler := handlers.NewConversionsHandler(gotenbergPool)
+	databaseHandler := handlers.NewDatabaseHandler(db)
+	storageHandler := handlers.NewStorageHandler(db, storageReconciler, auditService)
+	storageHandler.Mirror = storageMirror
+	storageHandler.Regions = regionRouter
+	storageHandler.Rollups = folderRollups
+	integrityHandler := handlers.NewIntegrityHandler(db, integrityChecker, auditService)
+	importsHandler := handlers.NewImportsHandler(db, importer, auditService)
+	integrationsHandler := handlers.NewIntegrationsHandler(db, cfg, integrations, importer, auditService)
+	settingsHandler := handlers.NewSettingsHandler(settingsService, auditService)
+	signingKeysHandler := handlers.NewSigningKeysHandler(signingKeys, auditService)
+	classificationRulesHandler := handlers.NewClassificationRulesHandler(db, classifier, auditService)
+	termsHandler := handlers.NewTermsHandler(db, termsService, auditService)
+	effectiveAccessHandler := handlers.NewEffectiveAccessHandler(db, services.NewEffectiveAccess(db, accessService))
+	legalExportsHandler := handlers.NewLegalExportsHandler(db, legalExports, auditService)
+	moderationHandler := handlers.NewModerationHandler(db, accessService, services.NewModerationService(db), auditService)
+	moderationHandler.Captcha = captchaService
+	idempotent := middleware.Idempotency(services.NewIdempotencyService(db, cfg.Idempotency.KeyTTL))
+
+	passkeyPolicy, err := services.NewAuthenticatorPolicy(cfg.WebAuthn)
+	if err != nil {
+		log.Fatalf("invalid passkey policy: %v", err)
+	}
 	waConfig := &webauthn.Config{
-		RPDisplayName: cfg.WebAuthn.RPDisplayName,
-		RPID:          cfg.WebAuthn.RPID,
-		RPOrigins:     cfg.WebAuthn.RPOrigins,
+		RPDisplayName:         cfg.WebAuthn.RPDisplayName,
+		RPID:                  cfg.WebAuthn.RPID,
+		RPOrigins:             cfg.WebAuthn.RPOrigins,
+		AttestationPreference: protocol.ConveyancePreference(passkeyPolicy.Attestation),
 	}
 	wa, err := webauthn.New(waConfig)
 	if err != nil {
 		log.Fatalf("webauthn initialization failed: %v", err)
 	}
 
-	mfaHandler := handlers.NewMFAHandler(db, auditService)
-	webAuthnHandler := handlers.NewWebAuthnHandler(db, wa, auditService)
+	mfaHandler := handlers.NewMFAHandler(db, auditService, cfg.MFA, sessionService)
+	webAuthnHandler := handlers.NewWebAuthnHandler(db, wa, auditService, passkeyPolicy, cfg.MFA, sessionService)
 
+	mfaPolicy, err := services.NewMFAPolicy(db, cfg.MFA)
+	if err != nil {
+		log.Fatalf("invalid MFA policy: %v", err)
+	}
 	authMiddleware := middleware.NewAuthMiddleware(db)
+	authMiddleware.MFAPolicy = mfaPolicy
+	authMiddleware.Sessions = sessionService
+	authMiddleware.Terms = termsService
+	authMiddleware.HMACKeys = hmacKeys
+
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
+	// Bodies over BodyLimit are streamed to the handler instead of being
+	// read into memory, which lets uploads go straight to storage; multipart
+	// pre-parsing would spool them to disk first, so it is off.
+	fiberConfig := fiber.Config{
+		BodyLimit:                    bufferedBodyLimit,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+		ErrorHandler:                 utils.ErrorHandler,
+	}
+	middleware.ConfigureTrustedProxies(&fiberConfig, cfg.Server.ProxyHeader, cfg.Server.TrustedProxies)
 
-	app := fiber.New(fiber.Config{BodyLimit: cfg.Server.MaxUploadMB * 1024 * 1024})
+	app := fiber.New(fiberConfig)
+	app.Use(middleware.RequestID())
+	app.Use(middleware.APIVersioning(cfg.API.LegacySunset))
+	app.Use(middleware.ReplicaReads())
+	app.Use(middleware.ForwardedFor(cfg.Server.ProxyHeader, trustedProxies))
 	app.Use(recover.New(recover.Config{EnableStackTrace: true}))
-	app.Use(middleware.CORS(cfg.Server.FrontendURL))
+	app.Use(middleware.CORS(cfg.CORS))
+	app.Use(middleware.Tenant(db, cfg.Tenancy))
 	app.Use(middleware.RequestLogger())
 	app.Use(middleware.SecurityLogger())
-	// Fiber's BodyLimit is global; cap non-upload routes to a smaller size
-	// so raising MAX_UPLOAD_MB for the legacy multipart upload doesn't also
-	// let auth/JSON endpoints accept gigabyte payloads.
-	app.Use(middleware.SmallBodyLimitForNonUploadRoutes(8 * 1024 * 1024))
+	// Streamed bodies aren't held to BodyLimit, so cap each route here and
+	// the upload routes at the upload size setting.
+	app.Use(middleware.BodyLimit(cfg.BodyLimits, settingsService.MaxUploadBytes))
 
 	app.Get("/health", func(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok"})
 	})
 
 	api := app.Group("/api")
-	api.Get("/version", handlers.GetVersion)
+	adminIP := middleware.IPPolicy(settingsService, services.IPScopeAdmin)
+	api.Get("/version", versionHandler.Get)
 
 	authRoutes := api.Group("/auth")
 	authRoutes.Post("/register", authHandler.Register)
 	authRoutes.Post("/login", authHandler.Login)
 	authRoutes.Get("/me", authMiddleware.RequireAuth, authHandler.Me)
 	authRoutes.Put("/me", authMiddleware.RequireAuth, authHandler.UpdateMe)
+	authRoutes.Put("/me/avatar", authMiddleware.RequireAuth, authHandler.UploadAvatar)
+	authRoutes.Delete("/me/avatar", authMiddleware.RequireAuth, authHandler.DeleteAvatar)
+	authRoutes.Get("/terms", authMiddleware.RequireAuth, termsHandler.Mine)
+	authRoutes.Post("/terms/:id/accept", authMiddleware.RequireAuth, termsHandler.Accept)
 	authRoutes.Put("/password", authMiddleware.RequireAuth, authHandler.ChangePassword)
+	authRoutes.Get("/devices", authMiddleware.RequireAuth, devicesHandler.List)
+	authRoutes.Delete("/devices/:id", authMiddleware.RequireAuth, devicesHandler.Revoke)
+	authRoutes.Get("/me/keys", authMiddleware.RequireAuth, vaultsHandler.ListKeys)
+	authRoutes.Post("/me/keys", authMiddleware.RequireAuth, vaultsHandler.RegisterKey)
+	authRoutes.Delete("/me/keys/:id", authMiddleware.RequireAuth, vaultsHandler.DeleteKey)
+	authRoutes.Post("/me/calendar-feed", authMiddleware.RequireAuth, filesHandler.IssueCalendarFeed)
+	authRoutes.Delete("/me/calendar-feed", authMiddleware.RequireAuth, filesHandler.RevokeCalendarFeed)
 
 	ssoRoutes := api.Group("/auth/sso")
 	ssoRoutes.Get("/providers", ssoHandler.ListProviders)
@@ -122,44 +388,233 @@ func main() {
 	ssoRoutes.Get("/saml/metadata", ssoHandler.HandleSAMLMetadata)
 	ssoRoutes.Post("/saml/acs", ssoHandler.HandleSAMLACS)
 
-	linkedAccountsRoutes := api.Group("/auth/linked-accounts", authMiddleware.RequireAuth)
+	linkedAccountsRoutes := api.Group("/auth/linked-accounts", authMiddleware.RequireAuth, idempotent)
 	linkedAccountsRoutes.Get("/", ssoHandler.GetLinkedAccounts)
 	linkedAccountsRoutes.Delete("/:id", ssoHandler.UnlinkAccount)
 	linkedAccountsRoutes.Post("/link", ssoHandler.LinkAccount)
 
-	api.Get("/users/search", authMiddleware.RequireAuth, usersHandler.Search)
-
-	userRoutes := api.Group("/users", authMiddleware.RequireAuth, middleware.AdminOnly)
-	userRoutes.Get("/", usersHandler.List)
-	userRoutes.Get("/:id", usersHandler.Get)
-	userRoutes.Put("/:id", usersHandler.Update)
-	userRoutes.Delete("/:id", usersHandler.Delete)
+	ssoProviderRoutes := api.Group("/sso-providers", adminIP, authMiddleware.RequireAuth, middleware.AdminOnly, idempotent)
+	ssoProviderRoutes.Get("/", ssoHandler.ListConfiguredProviders)
+	ssoProviderRoutes.Post("/", ssoHandler.CreateProvider)
+	ssoProviderRoutes.Get("/:id", ssoHandler.GetConfiguredProvider)
+	ssoProviderRoutes.Put("/:id", ssoHandler.UpdateProvider)
+	ssoProviderRoutes.Delete("/:id", ssoHandler.DeleteProvider)
 
-	groupRoutes := api.Group("/groups", authMiddleware.RequireAuth)
+	api.Get("/users/search", authMiddleware.RequireAuth, usersHandler.Search)
+	api.Get("/properties", authMiddleware.RequireAuth, propertiesHandler.List)
+	api.Get("/users/:id/keys", authMiddleware.RequireAuth, vaultsHandler.UserKeys)
+
+	// Admin routes admit every administrative role; each route then
+	// requires the permission it needs.
+	canReadUsers := middleware.RequirePermission(services.PermissionUsersRead)
+	canManageUsers := middleware.RequirePermission(services.PermissionUsersManage)
+	canReadAudit := middleware.RequirePermission(services.PermissionAuditRead)
+	canManageStorage := middleware.RequirePermission(services.PermissionStorageManage)
+	canManageJobs := middleware.RequirePermission(services.PermissionJobsManage)
+	canModerate := middleware.RequirePermission(services.PermissionModeration)
+	canManageSettings := middleware.RequirePermission(services.PermissionSettings)
+
+	userRoutes := api.Group("/users", adminIP, authMiddleware.RequireAuth, middleware.AdminAccess, idempotent)
+	userRoutes.Get("/", canReadUsers, usersHandler.List)
+	userRoutes.Get("/:id", canReadUsers, usersHandler.Get)
+	userRoutes.Put("/:id", canManageUsers, usersHandler.Update)
+	userRoutes.Delete("/:id", canManageUsers, usersHandler.Delete)
+	userRoutes.Post("/:id/suspend", canManageUsers, usersHandler.Suspend)
+	userRoutes.Post("/:id/reactivate", canManageUsers, usersHandler.Reactivate)
+
+	api.Get("/organizations/current", authMiddleware.RequireAuth, organizationsHandler.Current)
+
+	orgRoutes := api.Group("/organizations", adminIP, authMiddleware.RequireAuth, middleware.AdminOnly, middleware.PlatformAdminOnly, idempotent)
+	orgRoutes.Get("/", organizationsHandler.List)
+	orgRoutes.Post("/", organizationsHandler.Create)
+	orgRoutes.Get("/:id", organizationsHandler.Get)
+	orgRoutes.Put("/:id", organizationsHandler.Update)
+	orgRoutes.Delete("/:id", organizationsHandler.Delete)
+
+	jobRoutes := api.Group("/jobs", adminIP, authMiddleware.RequireAuth, middleware.AdminAccess, middleware.PlatformAdminOnly, canManageJobs, idempotent)
+	jobRoutes.Get("/", jobsHandler.List)
+	jobRoutes.Get("/:id", jobsHandler.Get)
+	jobRoutes.Post("/:id/retry", jobsHandler.Retry)
+
+	adminRoutes := api.Group("/admin", adminIP, authMiddleware.RequireAuth, middleware.AdminAccess, middleware.PlatformAdminOnly, idempotent)
+	adminRoutes.Get("/settings", canManageSettings, settingsHandler.List)
+	adminRoutes.Put("/settings", canManageSettings, settingsHandler.Update)
+	adminRoutes.Get("/signing-keys", canManageSettings, signingKeysHandler.List)
+	adminRoutes.Post("/signing-keys", canManageSettings, signingKeysHandler.Create)
+	adminRoutes.Post("/signing-keys/:kid/retire", canManageSettings, signingKeysHandler.Retire)
+	adminRoutes.Get("/terms", canManageSettings, termsHandler.List)
+	adminRoutes.Post("/terms", canManageSettings, termsHandler.Publish)
+	adminRoutes.Post("/terms/:id/retire", canManageSettings, termsHandler.Retire)
+	adminRoutes.Get("/terms/:id/acceptances", canManageSettings, termsHandler.Acceptances)
+	adminRoutes.Get("/classification-rules", canManageSettings, classificationRulesHandler.List)
+	adminRoutes.Post("/classification-rules", canManageSettings, classificationRulesHandler.Create)
+	adminRoutes.Post("/classification-rules/simulate", canManageSettings, classificationRulesHandler.Simulate)
+	adminRoutes.Put("/classification-rules/:id", canManageSettings, classificationRulesHandler.Update)
+	adminRoutes.Delete("/classification-rules/:id", canManageSettings, classificationRulesHandler.Delete)
+	adminRoutes.Post("/properties", canManageSettings, propertiesHandler.Create)
+	adminRoutes.Put("/properties/:id", canManageSettings, propertiesHandler.Update)
+	adminRoutes.Delete("/properties/:id", canManageSettings, propertiesHandler.Delete)
+	adminRoutes.Get("/legal-exports", canManageSettings, legalExportsHandler.List)
+	adminRoutes.Post("/legal-exports", canManageSettings, legalExportsHandler.Start)
+	adminRoutes.Get("/legal-exports/:id", canManageSettings, legalExportsHandler.Get)
+	adminRoutes.Delete("/legal-exports/:id", canManageSettings, legalExportsHandler.Delete)
+	adminRoutes.Post("/legal-exports/:id/link", canManageSettings, legalExportsHandler.Link)
+	api.Get("/legal-exports/download/:token", adminIP, legalExportsHandler.Download)
+	adminRoutes.Get("/reports", canModerate, moderationHandler.ListReports)
+	adminRoutes.Get("/reports/:id", canModerate, moderationHandler.GetReport)
+	adminRoutes.Put("/reports/:id", canModerate, moderationHandler.UpdateReport)
+	adminRoutes.Post("/reports/:id/actions", canModerate, moderationHandler.ActOnReport)
+	adminRoutes.Delete("/files/:id/quarantine", canModerate, moderationHandler.ReleaseFile)
+	adminRoutes.Get("/share-controls", canManageSettings, sharesHandler.ListShareControls)
+	adminRoutes.Put("/files/:id/share-control", canManageSettings, sharesHandler.PutShareControl)
+	adminRoutes.Delete("/files/:id/share-control", canManageSettings, sharesHandler.DeleteShareControl)
+	adminRoutes.Get("/conversions", canManageStorage, conversionsHandler.Stats)
+	adminRoutes.Get("/database", canManageStorage, databaseHandler.Stats)
+	adminRoutes.Post("/storage/reconcile", canManageStorage, storageHandler.StartReconcile)
+	adminRoutes.Get("/storage/reconcile", canManageStorage, storageHandler.ListReconciles)
+	adminRoutes.Get("/storage/reconcile/:id", canManageStorage, storageHandler.GetReconcile)
+	adminRoutes.Post("/integrity-checks", canManageStorage, integrityHandler.Start)
+	adminRoutes.Get("/integrity-checks", canManageStorage, integrityHandler.List)
+	adminRoutes.Get("/integrity-checks/:id", canManageStorage, integrityHandler.Get)
+	adminRoutes.Get("/storage/mirror", canManageStorage, storageHandler.MirrorStatus)
+	adminRoutes.Get("/storage/regions", canManageStorage, storageHandler.RegionStatus)
+	adminRoutes.Post("/storage/mirror/backfill", canManageStorage, storageHandler.StartMirrorBackfill)
+	adminRoutes.Post("/storage/rollups/rebuild", canManageStorage, storageHandler.StartRollupRebuild)
+	adminRoutes.Post("/imports", canManageStorage, importsHandler.Start)
+	adminRoutes.Get("/imports", canManageStorage, importsHandler.List)
+	adminRoutes.Get("/imports/:id", canManageStorage, importsHandler.Get)
+	adminRoutes.Post("/imports/:id/cancel", canManageStorage, importsHandler.Cancel)
+	adminRoutes.Post("/imports/:id/resume", canManageStorage, importsHandler.Resume)
+	adminRoutes.Get("/audit-log", canReadAudit, auditHandler.ListAll)
+	adminRoutes.Get("/audit-log/retention", canReadAudit, auditHandler.RetentionStatus)
+	adminRoutes.Get("/effective-access", canReadAudit, effectiveAccessHandler.Organization)
+
+	// Google redirects the browser here without a token, so the callback is
+	// registered ahead of the authenticated group.
+	api.Get("/integrations/import/google/callback", integrationsHandler.GoogleCallback)
+	integrationRoutes := api.Group("/integrations/import", authMiddleware.RequireAuth, idempotent)
+	integrationRoutes.Get("/connections", integrationsHandler.Connections)
+	integrationRoutes.Delete("/connections/:id", integrationsHandler.Disconnect)
+	integrationRoutes.Get("/connections/:id/browse", integrationsHandler.Browse)
+	integrationRoutes.Post("/google/connect", integrationsHandler.ConnectGoogle)
+	integrationRoutes.Post("/webdav/connect", integrationsHandler.ConnectWebDAV)
+	integrationRoutes.Post("/", integrationsHandler.Start)
+	integrationRoutes.Get("/", integrationsHandler.List)
+	integrationRoutes.Get("/:id", integrationsHandler.Get)
+	integrationRoutes.Post("/:id/cancel", integrationsHandler.Cancel)
+	integrationRoutes.Post("/:id/resume", integrationsHandler.Resume)
+
+	groupRoutes := api.Group("/groups", authMiddleware.RequireAuth, idempotent)
 	groupRoutes.Post("/", groupsHandler.Create)
 	groupRoutes.Get("/", groupsHandler.List)
 	groupRoutes.Get("/:id", groupsHandler.Get)
 	groupRoutes.Put("/:id", groupsHandler.Update)
 	groupRoutes.Delete("/:id", groupsHandler.Delete)
 	groupRoutes.Post("/:id/members", groupsHandler.AddMember)
+	groupRoutes.Post("/:id/members/import", groupsHandler.ImportMembers)
 	groupRoutes.Delete("/:id/members/:userId", groupsHandler.RemoveMember)
 	groupRoutes.Put("/:id/members/:userId", groupsHandler.UpdateMemberRole)
+	groupRoutes.Put("/:id/download-limit", adminIP, middleware.AdminOnly, groupsHandler.SetDownloadLimit)
+	groupRoutes.Put("/:id/quota", adminIP, middleware.AdminOnly, groupsHandler.SetQuota)
+	groupRoutes.Get("/:id/usage", groupsHandler.Usage)
 
 	api.Get("/files/:id/proxy", filesHandler.ProxyPreview)
+	// Calendar apps fetch the feed without a session; its token stands in
+	// for one.
+	api.Get("/calendar/:token", filesHandler.CalendarFeed)
+
+	api.Use("/public", middleware.IPPolicy(settingsService, services.IPScopePublic))
+	api.Get("/public/manifest-key", filesHandler.ManifestKey)
+
+	// Reports are cheap to send and land in front of an admin, so cap them
+	// per address.
+	reportLimiter := limiter.New(limiter.Config{
+		Max:        10,
+		Expiration: time.Hour,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return utils.Error(c, fiber.StatusTooManyRequests, "too many reports, please try again later")
+		},
+	})
+
+	// File passwords can be guessed from any address a file is shared to,
+	// so cap tries per address and file.
+	filePasswordLimiter := limiter.New(limiter.Config{
+		Max:        10,
+		Expiration: 15 * time.Minute,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return c.IP() + "|" + c.Params("id")
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return utils.Error(c, fiber.StatusTooManyRequests, "too many attempts, please try again later")
+		},
+	})
 
 	publicFileRoutes := api.Group("/public/files", authMiddleware.OptionalAuth)
 	publicFileRoutes.Get("/:id", filesHandler.PublicGet)
 	publicFileRoutes.Get("/:id/download", filesHandler.PublicDownload)
 	publicFileRoutes.Get("/:id/children", filesHandler.PublicChildren)
-
-	fileRoutes := api.Group("/files", authMiddleware.RequireAuth)
+	publicFileRoutes.Get("/:id/preview-html", filesHandler.PublicPreviewHTML)
+	publicFileRoutes.Get("/:id/pages", filesHandler.Pages)
+	publicFileRoutes.Get("/:id/pages/:page", filesHandler.Page)
+	publicFileRoutes.Get("/:id/pages/:page/tiles/:row/:col", filesHandler.Tile)
+	publicFileRoutes.Get("/:id/meta", sharesHandler.PublicMeta)
+	publicFileRoutes.Post("/:id/report", reportLimiter, moderationHandler.Report)
+	publicFileRoutes.Post("/:id/password/unlock", filePasswordLimiter, filesHandler.UnlockPassword)
+
+	publicLinkRoutes := api.Group("/public/links", authMiddleware.OptionalAuth)
+	publicLinkRoutes.Get("/:slug", filesHandler.PublicLinkGet)
+	publicLinkRoutes.Get("/:slug/path/*", filesHandler.PublicLinkGet)
+	publicLinkRoutes.Get("/:slug/children/*", filesHandler.PublicLinkChildren)
+	publicLinkRoutes.Get("/:slug/download/*", filesHandler.PublicLinkDownload)
+
+	// Each receive link allows a few PIN guesses before it locks; this caps
+	// how fast one address can work through links.
+	transferLinkLimiter := limiter.New(limiter.Config{
+		Max:        10,
+		Expiration: 15 * time.Minute,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return utils.Error(c, fiber.StatusTooManyRequests, "too many attempts, please try again later")
+		},
+	})
+	publicTransferRoutes := api.Group("/public/transfers")
+	publicTransferRoutes.Post("/:code/connect", transferLinkLimiter, transfersHandler.AnonymousConnect)
+	publicTransferRoutes.Get("/:code", transfersHandler.AnonymousGet)
+	publicTransferRoutes.Get("/:code/download", transfersHandler.AnonymousDownload)
+	publicTransferRoutes.Post("/:code/complete", transfersHandler.AnonymousComplete)
+
+	api.Get("/public/avatars/:userID/:version/:size", authHandler.Avatar)
+
+	// TUS clients retry by resuming from Upload-Offset, so the resumable
+	// upload routes skip the idempotency middleware.
+	api.Options("/tus", handlers.TusResumable, filesHandler.TusOptions)
+	tusRoutes := api.Group("/tus", handlers.TusResumable, authMiddleware.RequireAuth)
+	tusRoutes.Post("/", filesHandler.TusCreate)
+	tusRoutes.Head("/:id", filesHandler.TusHead)
+	tusRoutes.Patch("/:id", filesHandler.TusPatch)
+	tusRoutes.Delete("/:id", filesHandler.TusDelete)
+
+	fileRoutes := api.Group("/files", authMiddleware.RequireAuth, idempotent)
 	fileRoutes.Post("/upload", filesHandler.Upload)
 	fileRoutes.Post("/upload/presign", filesHandler.PresignUpload)
 	fileRoutes.Post("/upload/finalize", filesHandler.FinalizeUpload)
+	fileRoutes.Get("/uploads/:id/progress", filesHandler.UploadProgress)
+	fileRoutes.Get("/extractions/:id", filesHandler.Extraction)
+	fileRoutes.Post("/archive", filesHandler.CreateArchive)
+	fileRoutes.Get("/archives/:id", filesHandler.ArchiveBuild)
 	fileRoutes.Post("/directory", filesHandler.CreateDirectory)
 	fileRoutes.Post("/create-doc", filesHandler.CreateDoc)
 	fileRoutes.Get("/", filesHandler.ListRoot)
 	fileRoutes.Get("/search", filesHandler.Search)
+	fileRoutes.Get("/upcoming", filesHandler.Upcoming)
+	fileRoutes.Get("/duplicates", filesHandler.Duplicates)
+	fileRoutes.Post("/duplicates/resolve", filesHandler.ResolveDuplicates)
+	fileRoutes.Get("/notify", notifyHandler.Notify)
 	fileRoutes.Get("/:id/children", filesHandler.ListChildren)
 	fileRoutes.Get("/:id/content", filesHandler.GetContent)
 	fileRoutes.Put("/:id/content", filesHandler.SaveContent)
@@ -169,38 +624,111 @@ func main() {
 	fileRoutes.Get("/:id/download-url", filesHandler.DownloadURL)
 	fileRoutes.Get("/:id/export", filesHandler.Export)
 	fileRoutes.Get("/:id/preview", filesHandler.PreviewURL)
+	fileRoutes.Get("/:id/pages", filesHandler.Pages)
+	fileRoutes.Get("/:id/pages/:page", filesHandler.Page)
+	fileRoutes.Get("/:id/pages/:page/tiles/:row/:col", filesHandler.Tile)
 	fileRoutes.Get("/:id/convert-preview", filesHandler.ConvertPreview)
 	fileRoutes.Get("/:id/preview-status", filesHandler.PreviewStatus)
+	fileRoutes.Get("/:id/preview-html", filesHandler.PreviewHTML)
+	fileRoutes.Get("/:id/archive-contents", filesHandler.ListArchive)
+	fileRoutes.Get("/:id/archive-contents/entry", filesHandler.ArchiveEntry)
+	fileRoutes.Post("/:id/extract", filesHandler.Extract)
 	fileRoutes.Post("/:id/retry-preview", filesHandler.RetryPreview)
+	fileRoutes.Get("/:id/vault", vaultsHandler.Get)
+	fileRoutes.Post("/:id/vault/keys", vaultsHandler.AddKey)
 	fileRoutes.Get("/:id/path", filesHandler.Path)
+	fileRoutes.Get("/:id/manifest", filesHandler.Manifest)
+	fileRoutes.Get("/:id/diff", filesHandler.Diff)
+	fileRoutes.Get("/:id/analytics", filesHandler.GetAnalytics)
+	fileRoutes.Get("/:id/timeline", filesHandler.Timeline)
+	fileRoutes.Get("/:id/lock", filesHandler.GetLock)
+	fileRoutes.Post("/:id/lock", filesHandler.Lock)
+	fileRoutes.Delete("/:id/lock", filesHandler.Unlock)
+	fileRoutes.Post("/:id/mute", filesHandler.Mute)
+	fileRoutes.Delete("/:id/mute", filesHandler.Unmute)
+	fileRoutes.Get("/:id/properties", filesHandler.GetProperties)
+	fileRoutes.Put("/:id/properties", filesHandler.SetProperties)
+	fileRoutes.Get("/:id/reviews", filesHandler.ListReviews)
+	fileRoutes.Post("/:id/reviews", filesHandler.RequestReview)
+	fileRoutes.Get("/:id/due-date", filesHandler.GetDueDate)
+	fileRoutes.Put("/:id/due-date", filesHandler.SetDueDate)
+	fileRoutes.Delete("/:id/due-date", filesHandler.ClearDueDate)
+	fileRoutes.Put("/:id/password", filesHandler.SetPassword)
+	fileRoutes.Delete("/:id/password", filesHandler.RemovePassword)
+	fileRoutes.Post("/:id/password/unlock", filePasswordLimiter, filesHandler.UnlockPassword)
+	fileRoutes.Post("/:id/archive", filesHandler.Archive)
+	fileRoutes.Post("/:id/archive/restore", filesHandler.RestoreArchive)
 	fileRoutes.Post("/:id/share", sharesHandler.ShareFile)
 	fileRoutes.Get("/:id/shares", sharesHandler.ListFileShares)
+	fileRoutes.Get("/:id/effective-access", effectiveAccessHandler.File)
+	fileRoutes.Put("/:id/shares/batch", sharesHandler.BatchUpdateShares)
+	fileRoutes.Delete("/:id/shares", sharesHandler.DeleteShares)
+	fileRoutes.Post("/:id/quick-share", sharesHandler.QuickShare)
+	fileRoutes.Get("/:id/quick-share/qr", sharesHandler.QuickShareQR)
+	fileRoutes.Get("/:id/share-defaults", sharesHandler.GetShareDefaults)
+	fileRoutes.Put("/:id/share-defaults", sharesHandler.PutShareDefaults)
+	fileRoutes.Delete("/:id/share-defaults", sharesHandler.DeleteShareDefaults)
 	fileRoutes.Get("/:id", filesHandler.Get)
 	fileRoutes.Put("/:id", filesHandler.Update)
 	fileRoutes.Delete("/:id", filesHandler.Delete)
 
-	shareRoutes := api.Group("/shares", authMiddleware.RequireAuth)
+	pasteRoutes := api.Group("/pastes", authMiddleware.RequireAuth, idempotent)
+	pasteRoutes.Post("/", filesHandler.CreatePaste)
+	pasteRoutes.Get("/", filesHandler.ListPastes)
+
+	shareRoutes := api.Group("/shares", authMiddleware.RequireAuth, idempotent)
+	shareRoutes.Get("/outgoing", sharesHandler.ListOutgoing)
+	shareRoutes.Get("/approvals", sharesHandler.ListShareApprovals)
+	shareRoutes.Post("/approvals/:id/approve", sharesHandler.ApproveShare)
+	shareRoutes.Post("/approvals/:id/reject", sharesHandler.RejectShare)
+	shareRoutes.Get("/:id/qr", sharesHandler.ShareQR)
 	shareRoutes.Delete("/:id", sharesHandler.DeleteShare)
 	shareRoutes.Put("/:id", sharesHandler.UpdateShare)
 
 	api.Get("/shared", authMiddleware.RequireAuth, sharesHandler.ListSharedWithMe)
+	api.Get("/invitations/:token", sharesHandler.GetInvitation)
 
-	activityRoutes := api.Group("/activities", authMiddleware.RequireAuth)
+	activityRoutes := api.Group("/activities", authMiddleware.RequireAuth, idempotent)
 	activityRoutes.Get("/", activitiesHandler.List)
 	activityRoutes.Get("/unread-count", activitiesHandler.UnreadCount)
 	activityRoutes.Put("/read-all", activitiesHandler.MarkAllRead)
+	activityRoutes.Get("/mutes", activitiesHandler.ListMutes)
+	activityRoutes.Get("/preferences", activitiesHandler.GetPreferences)
+	activityRoutes.Put("/preferences", activitiesHandler.UpdatePreferences)
 	activityRoutes.Put("/:id/read", activitiesHandler.MarkRead)
 
-	tokenRoutes := api.Group("/auth/tokens", authMiddleware.RequireAuth)
+	tokenRoutes := api.Group("/auth/tokens", authMiddleware.RequireAuth, idempotent)
 	tokenRoutes.Post("/", apiTokenHandler.Create)
 	tokenRoutes.Get("/", apiTokenHandler.List)
 	tokenRoutes.Delete("/:id", apiTokenHandler.Revoke)
 
+	hmacKeyRoutes := api.Group("/auth/hmac-keys", authMiddleware.RequireAuth, idempotent)
+	hmacKeyRoutes.Post("/", hmacKeyHandler.Create)
+	hmacKeyRoutes.Get("/", hmacKeyHandler.List)
+	hmacKeyRoutes.Delete("/:id", hmacKeyHandler.Revoke)
+
+	// Caps token polling per address on top of the per-code slow_down, so a
+	// client cycling through device codes cannot hammer the endpoint.
+	devicePollLimiter := limiter.New(limiter.Config{
+		Max:        30,
+		Expiration: time.Minute,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error":             "slow_down",
+				"error_description": "polling too frequently",
+			})
+		},
+	})
+
 	deviceRoutes := api.Group("/auth/device")
 	deviceRoutes.Post("/code", deviceAuthHandler.RequestCode)
-	deviceRoutes.Post("/token", deviceAuthHandler.PollToken)
+	deviceRoutes.Post("/token", devicePollLimiter, deviceAuthHandler.PollToken)
 	deviceRoutes.Get("/verify", authMiddleware.RequireAuth, deviceAuthHandler.Verify)
 	deviceRoutes.Post("/approve", authMiddleware.RequireAuth, deviceAuthHandler.Approve)
+	deviceRoutes.Post("/deny", authMiddleware.RequireAuth, deviceAuthHandler.Deny)
 
 	mfaRoutes := api.Group("/auth/mfa")
 	mfaRoutes.Get("/status", authMiddleware.RequireAuth, mfaHandler.Status)
@@ -208,6 +736,8 @@ func main() {
 	mfaRoutes.Post("/totp/verify-setup", authMiddleware.RequireAuth, mfaHandler.TOTPVerifySetup)
 	mfaRoutes.Post("/totp/disable", authMiddleware.RequireAuth, mfaHandler.TOTPDisable)
 	mfaRoutes.Post("/recovery/regenerate", authMiddleware.RequireAuth, mfaHandler.RegenerateRecovery)
+	mfaRoutes.Get("/recovery/status", authMiddleware.RequireAuth, mfaHandler.RecoveryStatus)
+	mfaRoutes.Get("/recovery/download", authMiddleware.RequireAuth, mfaHandler.DownloadRecovery)
 
 	passkeyRoutes := api.Group("/auth/passkey")
 	passkeyRoutes.Post("/register/begin", authMiddleware.RequireAuth, webAuthnHandler.RegisterBegin)
@@ -238,30 +768,46 @@ func main() {
 	passkeyLoginRoutes.Post("/begin", webAuthnHandler.LoginBegin)
 	passkeyLoginRoutes.Post("/finish", webAuthnHandler.LoginFinish)
 
-	passkeysRoutes := api.Group("/auth/passkeys", authMiddleware.RequireAuth)
+	passkeysRoutes := api.Group("/auth/passkeys", authMiddleware.RequireAuth, idempotent)
 	passkeysRoutes.Get("/", webAuthnHandler.List)
 	passkeysRoutes.Put("/:id", webAuthnHandler.Rename)
 	passkeysRoutes.Delete("/:id", webAuthnHandler.Delete)
 
-	auditRoutes := api.Group("/audit-log", authMiddleware.RequireAuth)
+	auditRoutes := api.Group("/audit-log", authMiddleware.RequireAuth, idempotent)
+	auditRoutes.Get("/", auditHandler.ListMyLog)
 	auditRoutes.Get("/export", auditHandler.ExportMyLog)
 
-	transferRoutes := api.Group("/transfers", authMiddleware.RequireAuth)
+	transferRoutes := api.Group("/transfers", authMiddleware.RequireAuth, idempotent)
 	transferRoutes.Post("/", transfersHandler.Create)
 	transferRoutes.Get("/", transfersHandler.List)
 	transferRoutes.Get("/:code", transfersHandler.Get)
+	transferRoutes.Get("/:code/status", transfersHandler.Status)
 	transferRoutes.Post("/:code/connect", transfersHandler.Connect)
 	transferRoutes.Post("/:code/upload", transfersHandler.Upload)
 	transferRoutes.Get("/:code/download", transfersHandler.Download)
 	transferRoutes.Post("/:code/complete", transfersHandler.Complete)
 	transferRoutes.Delete("/:code", transfersHandler.Cancel)
 
+	templateRoutes := api.Group("/templates", authMiddleware.RequireAuth, idempotent)
+	templateRoutes.Get("/", templatesHandler.List)
+	templateRoutes.Post("/", templatesHandler.Create)
+	templateRoutes.Get("/:id", templatesHandler.Get)
+	templateRoutes.Patch("/:id", templatesHandler.Update)
+	templateRoutes.Delete("/:id", templatesHandler.Delete)
+	templateRoutes.Post("/:id/instantiate", templatesHandler.Instantiate)
+
+	reviewRoutes := api.Group("/reviews", authMiddleware.RequireAuth, idempotent)
+	reviewRoutes.Get("/", reviewsHandler.List)
+	reviewRoutes.Post("/:id/approve", reviewsHandler.Approve)
+	reviewRoutes.Post("/:id/reject", reviewsHandler.Reject)
+	reviewRoutes.Post("/:id/cancel", reviewsHandler.Cancel)
+
 	listenAddr := fmt.Sprintf(":%s", cfg.Server.Port)
 
 	logger.Info("server_starting", map[string]interface{}{
-		"port":       cfg.Server.Port,
-		"address":    listenAddr,
-		"body_limit": fmt.Sprintf("%dMB", cfg.Server.MaxUploadMB),
+		"port":         cfg.Server.Port,
+		"address":      listenAddr,
+		"upload_limit": fmt.Sprintf("%dMB", cfg.Server.MaxUploadMB),
 	})
 
 	errCh := make(chan error, 1)
@@ -269,6 +815,26 @@ func main() {
 		errCh <- app.Listen(listenAddr)
 	}()
 
+	if cfg.GRPC.Addr != "" {
+		grpcServer, err := grpcapi.NewServer(db, accessService, auditService).GRPCServer(cfg.GRPC)
+		if err != nil {
+			log.Fatalf("failed setting up gRPC server: %v", err)
+		}
+		listener, err := net.Listen("tcp", cfg.GRPC.Addr)
+		if err != nil {
+			log.Fatalf("failed listening for gRPC: %v", err)
+		}
+		logger.Info("grpc_server_starting", map[string]interface{}{
+			"address": cfg.GRPC.Addr,
+			"tls":     cfg.GRPC.CertFile != "",
+			"mtls":    cfg.GRPC.ClientCA != "",
+		})
+		go func() {
+			errCh <- grpcServer.Serve(listener)
+		}()
+		defer grpcServer.GracefulStop()
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
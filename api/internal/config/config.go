@@ -24,12 +24,322 @@ type Config struct {
 	SAML      SAMLConfig
 	LDAP      LDAPConfig
 	WebAuthn  WebAuthnConfig
+	MFA       MFAConfig
+	Sessions  SessionsConfig
+	SMTP      SMTPConfig
+	Branding  BrandingConfig
+	Manifest  ManifestConfig
+	Outbox    OutboxConfig
+	Jobs      JobsConfig
+	CORS      CORSConfig
+	Accounts  AccountsConfig
+	Uploads   UploadPolicyConfig
+	Downloads DownloadLimitsConfig
+	Tenancy   TenancyConfig
+	IPPolicy  IPPolicyConfig
+	Captcha   CaptchaConfig
+	// BodyLimits caps request bodies by the kind of route they are sent to.
+	BodyLimits BodyLimitsConfig
+	// Idempotency sets how long responses to requests sent with an
+	// Idempotency-Key are kept for replay.
+	Idempotency IdempotencyConfig
+	Import      ImportConfig
+	Mirror      MirrorConfig
+	Archive     ArchiveConfig
+	Regions     RegionsConfig
+	// Integrations lets users import their own files from other services.
+	Integrations IntegrationsConfig
+	Scan         ScanConfig
+	DueDates     DueDatesConfig
+	Pastes       PastesConfig
+	EventBus     EventBusConfig
+	API          APIConfig
+	GRPC         GRPCConfig
+}
+
+// GRPCConfig serves the internal gRPC API on Addr; it is off when Addr is
+// empty. With CertFile and KeyFile the listener uses TLS, and with ClientCA
+// as well a client certificate signed by it authenticates the caller.
+// Clients without one send an admin's API token instead.
+type GRPCConfig struct {
+	Addr     string
+	CertFile string
+	KeyFile  string
+	ClientCA string
+}
+
+// APIConfig covers the unversioned /api paths kept for clients written
+// before /api/v1. LegacySunset, when set, is announced in a Sunset header
+// as the date they may stop working.
+type APIConfig struct {
+	LegacySunset time.Time
+}
+
+// EventBusConfig picks how API instances tell each other about changes to
+// state they cache. Driver is "postgres" for LISTEN/NOTIFY on the primary,
+// "redis" for pub/sub on RedisAddr, or "none" for a single instance.
+type EventBusConfig struct {
+	Driver        string
+	Channel       string
+	RedisAddr     string
+	RedisPassword string
+}
+
+type IdempotencyConfig struct {
+	KeyTTL time.Duration
+}
+
+// ImportConfig limits admin imports of existing files. Directory imports
+// must read from under one of AllowedRoots, and are off when it is empty.
+// Bucket imports read with Source, which falls back to the main S3 settings
+// when IMPORT_S3_ENDPOINT is unset; the bucket is given per import.
+type ImportConfig struct {
+	AllowedRoots []string
+	Source       S3Config
+}
+
+// MirrorConfig copies every stored object to a second bucket, normally at
+// another provider, for an offsite copy. It is off unless Target has an
+// endpoint and a bucket. Deletes are only mirrored when Deletes is set, so
+// by default the mirror also keeps what users delete.
+type MirrorConfig struct {
+	Target  S3Config
+	Deletes bool
+}
+
+// Enabled reports whether a mirror target is configured.
+func (c MirrorConfig) Enabled() bool {
+	return c.Target.Endpoint != "" && c.Target.Bucket != ""
+}
+
+// ArchiveConfig names the cold storage bucket users can archive folders
+// to. It is off unless Target has an endpoint and a bucket. Objects are
+// written with Target.StorageClass, e.g. GLACIER or DEEP_ARCHIVE; restores
+// of such objects are requested from the provider first. RestoreDelay is
+// how long a restore is expected to take, so the copy back is attempted
+// once it has passed.
+type ArchiveConfig struct {
+	Target       S3Config
+	RestoreDelay time.Duration
+}
+
+// Enabled reports whether an archive bucket is configured.
+func (c ArchiveConfig) Enabled() bool {
+	return c.Target.Endpoint != "" && c.Target.Bucket != ""
+}
+
+// RegionsConfig lists copies of the main bucket in other regions, kept in
+// sync by the provider's bucket replication, that downloads can be served
+// from. Every copy is probed each ProbeInterval and downloads go to the
+// nearest healthy one. Files changed within ReplicationLag are always read
+// from the main bucket, as their replicas may not have caught up.
+type RegionsConfig struct {
+	Replicas       []S3Config
+	ProbeInterval  time.Duration
+	ReplicationLag time.Duration
+}
+
+// IntegrationsConfig sets up the per-user import of files from Google Drive
+// and WebDAV servers such as Nextcloud. Google Drive needs an OAuth client
+// allowed the drive.readonly scope. WebDAV servers on loopback or private
+// addresses are refused unless WebDAVAllowPrivate is set, so users cannot
+// point the API at internal services.
+type IntegrationsConfig struct {
+	GoogleDrive        OAuthProviderConfig
+	WebDAVAllowPrivate bool
+}
+
+// ScanConfig points at a clamd daemon that checks relayed transfers before
+// the receiver may download them. ClamAVAddress is host:port or
+// unix:///path/to/clamd.sock; scanning is off when it is empty. Transfers of
+// at most TransferBypassBytes skip the scan, which trades coverage for
+// latency on small files.
+type ScanConfig struct {
+	ClamAVAddress       string
+	Timeout             time.Duration
+	TransferBypassBytes int64
+}
+
+// CaptchaConfig puts a CAPTCHA in front of anonymous downloads of public
+// shares. Provider is hcaptcha, recaptcha or turnstile; empty disables it.
+// An address that solves one is trusted for that share for PassTTL.
+type CaptchaConfig struct {
+	Provider  string
+	SiteKey   string
+	SecretKey string
+	PassTTL   time.Duration
+	// VerifyURL overrides the provider's siteverify endpoint.
+	VerifyURL string
+}
+
+// IPPolicyConfig holds the default IP rules for the admin API and the public
+// share endpoints. Admins can replace them at runtime through the settings
+// API.
+type IPPolicyConfig struct {
+	Admin  IPRules
+	Public IPRules
+}
+
+// IPRules admit or refuse clients by IP address or CIDR range. Deny wins;
+// a non-empty Allow admits only the addresses it matches.
+type IPRules struct {
+	Allow []string
+	Deny  []string
+}
+
+// TenancyConfig turns on multi-tenant hosting. Each request is resolved to
+// an organization by the Header value or, failing that, by the subdomain
+// of BaseDomain it was sent to. Requests that match neither belong to the
+// default tenant.
+type TenancyConfig struct {
+	Enabled    bool
+	BaseDomain string
+	Header     string
+}
+
+// UploadPolicyConfig restricts which files may be uploaded or sent through
+// transfers. Types accept wildcards such as "image/*"; extensions are
+// matched case-insensitively with or without the leading dot. Empty allow
+// lists permit everything not explicitly blocked.
+type UploadPolicyConfig struct {
+	AllowedTypes      []string
+	BlockedTypes      []string
+	AllowedExtensions []string
+	BlockedExtensions []string
+}
+
+// DownloadLimitsConfig caps how fast files stream out of the server, in
+// KB/s. Zero disables a cap. Downloads through presigned URLs go straight to
+// object storage and are not limited.
+type DownloadLimitsConfig struct {
+	GlobalKBps int64
+	UserKBps   int64
+	ShareKBps  int64
+}
+
+// BodyLimitsConfig caps request bodies, in bytes. JSONBytes covers
+// ordinary API requests, DocumentBytes the editor saves, avatars and member
+// imports that send a whole document at once, and TransferChunkBytes each
+// chunk sent to the transfer relay. Uploads are held to the upload size
+// setting instead.
+type BodyLimitsConfig struct {
+	JSONBytes          int64
+	DocumentBytes      int64
+	TransferChunkBytes int64
+}
+
+// AccountsConfig controls what happens to a user's content while an admin
+// has their account suspended.
+type AccountsConfig struct {
+	SuspendedUserSharesActive bool
+}
+
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           int
+}
+
+// OutboxConfig controls the dispatcher that delivers mutation events from
+// the outbox table to subscribers.
+type OutboxConfig struct {
+	PollInterval time.Duration
+}
+
+// JobsConfig controls the background job runner. Lease is how long a
+// claimed job is hidden from other workers; a job still running when it runs
+// out is cancelled and becomes claimable again.
+type JobsConfig struct {
+	Workers      int
+	PollInterval time.Duration
+	Lease        time.Duration
+	MaxAttempts  int
+}
+
+// ManifestConfig holds the key used to sign folder manifests. SigningKey is
+// a base64-encoded 32-byte Ed25519 seed; when empty a key is derived from
+// the JWT secret so development setups work without extra configuration.
+type ManifestConfig struct {
+	SigningKey string
+	KeyID      string
 }
 
 type WebAuthnConfig struct {
 	RPDisplayName string
 	RPID          string
 	RPOrigins     []string
+
+	// Attestation is the conveyance preference requested on registration:
+	// none, indirect or direct. With direct, passkeys without a
+	// certificate-backed attestation statement are refused.
+	Attestation string
+	// AAGUIDAllowlist, when non-empty, limits passkeys to these authenticator
+	// models; AAGUIDDenylist blocks models outright.
+	AAGUIDAllowlist []string
+	AAGUIDDenylist  []string
+}
+
+// MFAConfig controls who must use MFA and recovery codes. Required is none,
+// admins or all; users it applies to have GracePeriod from their first
+// request under the policy to enroll. Users are warned once they are down to
+// RecoveryMinCodes and must generate a new set when fewer remain. Freshly
+// generated codes can be downloaded once within RecoveryDownloadTTL.
+type MFAConfig struct {
+	Required    string
+	GracePeriod time.Duration
+
+	RecoveryCodeCount   int
+	RecoveryMinCodes    int
+	RecoveryDownloadTTL time.Duration
+}
+
+// SessionsConfig controls the device inventory. The location of a sign-in
+// is read from headers a CDN or reverse proxy sets, such as CF-IPCountry;
+// without them sessions carry no location. NewDeviceEmail also emails users
+// when they sign in from a new device or country, if SMTP is configured.
+type SessionsConfig struct {
+	CountryHeader  string
+	CityHeader     string
+	NewDeviceEmail bool
+}
+
+// DueDatesConfig sets the reminders sent ahead of file due dates.
+// ReminderHours are the default lead times, used when a due date is set
+// without its own. Email also sends each reminder by email, if SMTP is
+// configured.
+type DueDatesConfig struct {
+	ReminderHours []int
+	Email         bool
+}
+
+// PastesConfig bounds text pastes. MaxBytes is the largest paste, and
+// PerHour how many pastes one user can make in an hour, 0 meaning no limit.
+type PastesConfig struct {
+	MaxBytes int64
+	PerHour  int
+}
+
+// BrandingConfig is how the deployment presents itself on public share
+// pages and link previews. Organizations can override LogoURL and Color.
+// QRLogo is a local PNG or JPEG file drawn in the middle of share link QR
+// codes.
+type BrandingConfig struct {
+	Name    string
+	LogoURL string
+	Color   string
+	QRLogo  string
+}
+
+// SMTPConfig is the server used to send email. Email is disabled while Host
+// is empty.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
 }
 
 type DBConfig struct {
@@ -39,6 +349,19 @@ type DBConfig struct {
 	Password string
 	Name     string
 	SSLMode  string
+	// ReplicaDSNs are read replicas that GET requests may read from. Each
+	// is a full PostgreSQL connection string.
+	ReplicaDSNs []string
+
+	// The pool limits apply to the primary and to each replica. Zero
+	// leaves a limit off.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// SlowQueryThreshold is how long a query runs before it is logged as
+	// slow; zero turns the log off.
+	SlowQueryThreshold time.Duration
 }
 
 type S3Config struct {
@@ -49,6 +372,9 @@ type S3Config struct {
 	SecretKey      string
 	Bucket         string
 	UseSSL         bool
+	// StorageClass, when set, is the storage class new objects are
+	// written with.
+	StorageClass string
 }
 
 type JWTConfig struct {
@@ -61,26 +387,88 @@ type ServerConfig struct {
 	FrontendURL string
 	BackendURL  string
 	MaxUploadMB int
+	// TrustedProxies lists the IPs or CIDR ranges of load balancers and
+	// reverse proxies in front of the API. ProxyHeader is only honoured
+	// for requests whose peer address is in this list.
+	TrustedProxies []string
+	ProxyHeader    string
 }
 
 type GotenbergConfig struct {
 	URL string
+	// Workers caps the conversions sent to Gotenberg at once per API
+	// instance; further conversions wait up to QueueTimeout for a worker.
+	Workers      int
+	Timeout      time.Duration
+	QueueTimeout time.Duration
+	// BreakerThreshold consecutive failures open the circuit breaker for
+	// BreakerCooldown, during which conversions fail fast.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
 }
 
 type AuditConfig struct {
 	ExportInterval time.Duration
+	// SinkInterval is how often new audit rows are pushed to the SIEM sinks
+	// below. Each sink is enabled by setting its address or URL.
+	SinkInterval time.Duration
+	Syslog       AuditSyslogConfig
+	Webhook      AuditWebhookConfig
+	Splunk       AuditSplunkConfig
+	// Retention is how long audit rows are kept in the database; zero
+	// keeps them forever. With RetentionRequireExport, rows are only
+	// purged once the NDJSON export holding them is confirmed in storage.
+	Retention              time.Duration
+	RetentionRequireExport bool
+}
+
+// AuditSyslogConfig sends RFC 5424 messages over TLS. CAFile, when set,
+// replaces the system roots used to verify the collector.
+type AuditSyslogConfig struct {
+	Addr   string
+	CAFile string
+}
+
+// AuditWebhookConfig POSTs batches of audit rows to URL, signed with an
+// HMAC-SHA256 of the body keyed by Secret.
+type AuditWebhookConfig struct {
+	URL    string
+	Secret string
+}
+
+// AuditSplunkConfig sends audit rows to a Splunk HTTP Event Collector.
+type AuditSplunkConfig struct {
+	URL   string
+	Token string
+	Index string
 }
 
 type PreviewConfig struct {
-	QueueBufferSize int
-	MaxAttempts     int
-	RetryDelays     []time.Duration
-	// StaleRecoveryInterval is the cadence at which RecoverStaleJobs runs
-	// to re-enqueue jobs that didn't make it onto the in-memory channel
-	// (channel-full on burst uploads, worker crash mid-processing, jobs
-	// left pending across an API restart). Zero disables the loop — set
-	// in tests; production should leave the default.
+	MaxAttempts int
+	RetryDelays []time.Duration
+	// StaleRecoveryInterval is the cadence of the job that re-enqueues
+	// preview jobs left without a runner job, e.g. ones created before the
+	// job runner existed. Zero disables it.
 	StaleRecoveryInterval time.Duration
+	// TextMaxBytes caps how much of a file the HTML text preview reads;
+	// longer files are rendered truncated.
+	TextMaxBytes int64
+	// TextCacheEntries is how many rendered text previews are kept in
+	// memory.
+	TextCacheEntries int
+	// ArchiveMaxEntries caps how many entries an archive listing returns.
+	ArchiveMaxEntries int
+	// ArchiveEntryMaxBytes is the largest archive entry that can be
+	// extracted on its own.
+	ArchiveEntryMaxBytes int64
+	// ArchiveExtractMaxFiles and ArchiveExtractMaxBytes cap what unpacking
+	// a whole archive into a folder may create.
+	ArchiveExtractMaxFiles int
+	ArchiveExtractMaxBytes int64
+	// ArchiveCreateMaxFiles and ArchiveCreateMaxBytes cap what one archive
+	// built from a selection of files may hold.
+	ArchiveCreateMaxFiles int
+	ArchiveCreateMaxBytes int64
 }
 
 type SSOConfig struct {
@@ -147,6 +535,14 @@ func Load() *Config {
 			Password: getEnv("DB_PASSWORD", "docshare_secret"),
 			Name:     getEnv("DB_NAME", "docshare"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+
+			ReplicaDSNs: getEnvAsList("DB_REPLICA_DSNS", nil),
+
+			MaxOpenConns:       getEnvAsInt("DB_MAX_OPEN_CONNS", 25),
+			MaxIdleConns:       getEnvAsInt("DB_MAX_IDLE_CONNS", 10),
+			ConnMaxLifetime:    getEnvAsDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+			ConnMaxIdleTime:    getEnvAsDuration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+			SlowQueryThreshold: getEnvAsDuration("DB_SLOW_QUERY_THRESHOLD", 500*time.Millisecond),
 		},
 		S3: S3Config{
 			Region:         getEnv("S3_REGION", "us-east-1"),
@@ -162,22 +558,70 @@ func Load() *Config {
 			ExpirationHours: getEnvAsInt("JWT_EXPIRATION_HOURS", 24),
 		},
 		Server: ServerConfig{
-			Port:        getEnv("SERVER_PORT", "8080"),
-			FrontendURL: getEnv("WEB_URL", "http://localhost:3001"),
-			BackendURL:  getEnv("API_URL", "http://localhost:8080/api"),
-			MaxUploadMB: maxUploadMB(),
+			Port:           getEnv("SERVER_PORT", "8080"),
+			FrontendURL:    getEnv("WEB_URL", "http://localhost:3001"),
+			BackendURL:     getEnv("API_URL", "http://localhost:8080/api"),
+			MaxUploadMB:    maxUploadMB(),
+			TrustedProxies: getEnvAsList("TRUSTED_PROXIES", nil),
+			ProxyHeader:    getEnv("PROXY_HEADER", "X-Forwarded-For"),
 		},
 		Gotenberg: GotenbergConfig{
-			URL: getEnv("GOTENBERG_URL", "http://localhost:3000"),
+			URL:              getEnv("GOTENBERG_URL", "http://localhost:3000"),
+			Workers:          getEnvAsInt("GOTENBERG_WORKERS", 4),
+			Timeout:          getEnvAsDuration("GOTENBERG_TIMEOUT", 2*time.Minute),
+			QueueTimeout:     getEnvAsDuration("GOTENBERG_QUEUE_TIMEOUT", 30*time.Second),
+			BreakerThreshold: getEnvAsInt("GOTENBERG_BREAKER_THRESHOLD", 5),
+			BreakerCooldown:  getEnvAsDuration("GOTENBERG_BREAKER_COOLDOWN", 30*time.Second),
 		},
 		Audit: AuditConfig{
 			ExportInterval: getEnvAsDuration("AUDIT_EXPORT_INTERVAL", 1*time.Hour),
+			SinkInterval:   getEnvAsDuration("AUDIT_SINK_INTERVAL", 10*time.Second),
+			Syslog: AuditSyslogConfig{
+				Addr:   getEnv("AUDIT_SYSLOG_ADDR", ""),
+				CAFile: getEnv("AUDIT_SYSLOG_CA_FILE", ""),
+			},
+			Webhook: AuditWebhookConfig{
+				URL:    getEnv("AUDIT_WEBHOOK_URL", ""),
+				Secret: getEnv("AUDIT_WEBHOOK_SECRET", ""),
+			},
+			Splunk: AuditSplunkConfig{
+				URL:   getEnv("AUDIT_SPLUNK_HEC_URL", ""),
+				Token: getEnv("AUDIT_SPLUNK_HEC_TOKEN", ""),
+				Index: getEnv("AUDIT_SPLUNK_INDEX", ""),
+			},
+			Retention:              getEnvAsDuration("AUDIT_RETENTION", 0),
+			RetentionRequireExport: getEnvAsBool("AUDIT_RETENTION_REQUIRE_EXPORT", true),
+		},
+		EventBus: EventBusConfig{
+			Driver:        getEnv("EVENT_BUS_DRIVER", "postgres"),
+			Channel:       getEnv("EVENT_BUS_CHANNEL", "docshare_events"),
+			RedisAddr:     getEnv("EVENT_BUS_REDIS_ADDR", ""),
+			RedisPassword: getEnv("EVENT_BUS_REDIS_PASSWORD", ""),
+		},
+		API: APIConfig{
+			LegacySunset: getEnvAsDate("API_LEGACY_SUNSET"),
+		},
+		Outbox: OutboxConfig{
+			PollInterval: getEnvAsDuration("OUTBOX_POLL_INTERVAL", 1*time.Second),
+		},
+		Jobs: JobsConfig{
+			Workers:      getEnvAsInt("JOB_WORKERS", 4),
+			PollInterval: getEnvAsDuration("JOB_POLL_INTERVAL", 1*time.Second),
+			Lease:        getEnvAsDuration("JOB_LEASE", 10*time.Minute),
+			MaxAttempts:  getEnvAsInt("JOB_MAX_ATTEMPTS", 5),
 		},
 		Preview: PreviewConfig{
-			QueueBufferSize:       getEnvAsInt("PREVIEW_QUEUE_BUFFER_SIZE", 100),
-			MaxAttempts:           getEnvAsInt("PREVIEW_JOB_MAX_ATTEMPTS", 3),
-			RetryDelays:           []time.Duration{30 * time.Second, 2 * time.Minute, 10 * time.Minute},
-			StaleRecoveryInterval: getEnvAsDuration("PREVIEW_STALE_RECOVERY_INTERVAL", 60*time.Second),
+			MaxAttempts:            getEnvAsInt("PREVIEW_JOB_MAX_ATTEMPTS", 3),
+			RetryDelays:            []time.Duration{30 * time.Second, 2 * time.Minute, 10 * time.Minute},
+			StaleRecoveryInterval:  getEnvAsDuration("PREVIEW_STALE_RECOVERY_INTERVAL", 60*time.Second),
+			TextMaxBytes:           int64(getEnvAsInt("PREVIEW_TEXT_MAX_KB", 512)) * 1024,
+			TextCacheEntries:       getEnvAsInt("PREVIEW_TEXT_CACHE_ENTRIES", 256),
+			ArchiveMaxEntries:      getEnvAsInt("PREVIEW_ARCHIVE_MAX_ENTRIES", 10000),
+			ArchiveEntryMaxBytes:   int64(getEnvAsInt("PREVIEW_ARCHIVE_ENTRY_MAX_MB", 100)) * 1024 * 1024,
+			ArchiveExtractMaxFiles: getEnvAsInt("PREVIEW_ARCHIVE_EXTRACT_MAX_FILES", 5000),
+			ArchiveExtractMaxBytes: int64(getEnvAsInt("PREVIEW_ARCHIVE_EXTRACT_MAX_MB", 2048)) * 1024 * 1024,
+			ArchiveCreateMaxFiles:  getEnvAsInt("PREVIEW_ARCHIVE_CREATE_MAX_FILES", 5000),
+			ArchiveCreateMaxBytes:  int64(getEnvAsInt("PREVIEW_ARCHIVE_CREATE_MAX_MB", 2048)) * 1024 * 1024,
 		},
 		SSO: SSOConfig{
 			AutoRegister: getEnvAsBool("SSO_AUTO_REGISTER", true),
@@ -244,6 +688,147 @@ func Load() *Config {
 		cfg.SAML.SPACSURL = backendURL + "/auth/sso/saml/acs"
 	}
 
+	cfg.Manifest = ManifestConfig{
+		SigningKey: getEnv("MANIFEST_SIGNING_KEY", ""),
+		KeyID:      getEnv("MANIFEST_KEY_ID", ""),
+	}
+
+	cfg.Tenancy = TenancyConfig{
+		Enabled:    getEnvAsBool("TENANCY_ENABLED", false),
+		BaseDomain: strings.ToLower(strings.TrimPrefix(getEnv("TENANT_BASE_DOMAIN", ""), ".")),
+		Header:     getEnv("TENANT_HEADER", "X-Organization"),
+	}
+
+	corsHeaders := []string{"Origin", "Content-Type", "Accept", "Authorization", "If-None-Match", "X-Captcha-Token", "Idempotency-Key", "API-Version",
+		"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata", "Upload-Checksum"}
+	if cfg.Tenancy.Enabled && cfg.Tenancy.Header != "" {
+		corsHeaders = append(corsHeaders, cfg.Tenancy.Header)
+	}
+	corsExposedHeaders := []string{"ETag", "X-Request-ID", "Idempotent-Replayed", "API-Version", "Deprecation", "Sunset", "Link",
+		"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Tus-Checksum-Algorithm", "Upload-Offset", "Upload-Length", "Upload-Expires", "X-File-ID"}
+	cfg.CORS = CORSConfig{
+		AllowedOrigins:   getEnvAsList("CORS_ALLOWED_ORIGINS", defaultCORSOrigins(cfg.Server.FrontendURL)),
+		AllowedHeaders:   getEnvAsList("CORS_ALLOWED_HEADERS", corsHeaders),
+		ExposedHeaders:   getEnvAsList("CORS_EXPOSED_HEADERS", corsExposedHeaders),
+		AllowCredentials: getEnvAsBool("CORS_ALLOW_CREDENTIALS", false),
+		MaxAge:           getEnvAsInt("CORS_MAX_AGE", 0),
+	}
+
+	cfg.Accounts = AccountsConfig{
+		SuspendedUserSharesActive: getEnvAsBool("SUSPENDED_USER_SHARES_ACTIVE", true),
+	}
+
+	cfg.Uploads = UploadPolicyConfig{
+		AllowedTypes:      getEnvAsList("UPLOAD_ALLOWED_TYPES", nil),
+		BlockedTypes:      getEnvAsList("UPLOAD_BLOCKED_TYPES", nil),
+		AllowedExtensions: getEnvAsList("UPLOAD_ALLOWED_EXTENSIONS", nil),
+		BlockedExtensions: getEnvAsList("UPLOAD_BLOCKED_EXTENSIONS", nil),
+	}
+
+	cfg.Downloads = DownloadLimitsConfig{
+		GlobalKBps: int64(getEnvAsInt("DOWNLOAD_LIMIT_GLOBAL_KBPS", 0)),
+		UserKBps:   int64(getEnvAsInt("DOWNLOAD_LIMIT_USER_KBPS", 0)),
+		ShareKBps:  int64(getEnvAsInt("DOWNLOAD_LIMIT_SHARE_KBPS", 0)),
+	}
+
+	cfg.BodyLimits = BodyLimitsConfig{
+		JSONBytes:          int64(getEnvAsInt("BODY_LIMIT_JSON_KB", 1024)) * 1024,
+		DocumentBytes:      int64(getEnvAsInt("BODY_LIMIT_DOCUMENT_MB", 8)) * 1024 * 1024,
+		TransferChunkBytes: int64(getEnvAsInt("BODY_LIMIT_TRANSFER_CHUNK_MB", 32)) * 1024 * 1024,
+	}
+
+	cfg.IPPolicy = IPPolicyConfig{
+		Admin: IPRules{
+			Allow: getEnvAsList("IP_POLICY_ADMIN_ALLOW", nil),
+			Deny:  getEnvAsList("IP_POLICY_ADMIN_DENY", nil),
+		},
+		Public: IPRules{
+			Allow: getEnvAsList("IP_POLICY_PUBLIC_ALLOW", nil),
+			Deny:  getEnvAsList("IP_POLICY_PUBLIC_DENY", nil),
+		},
+	}
+
+	cfg.Captcha = CaptchaConfig{
+		Provider:  strings.ToLower(getEnv("CAPTCHA_PROVIDER", "")),
+		SiteKey:   getEnv("CAPTCHA_SITE_KEY", ""),
+		SecretKey: getEnv("CAPTCHA_SECRET_KEY", ""),
+		PassTTL:   getEnvAsDuration("CAPTCHA_PASS_TTL", 24*time.Hour),
+		VerifyURL: getEnv("CAPTCHA_VERIFY_URL", ""),
+	}
+
+	cfg.Idempotency = IdempotencyConfig{
+		KeyTTL: getEnvAsDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+	}
+
+	cfg.Import = ImportConfig{
+		AllowedRoots: getEnvAsList("IMPORT_ALLOWED_ROOTS", nil),
+		Source:       cfg.S3,
+	}
+	if endpoint := getEnv("IMPORT_S3_ENDPOINT", ""); endpoint != "" {
+		cfg.Import.Source = S3Config{
+			Endpoint:  endpoint,
+			Region:    getEnv("IMPORT_S3_REGION", "us-east-1"),
+			AccessKey: getEnv("IMPORT_S3_ACCESS_KEY", ""),
+			SecretKey: getEnv("IMPORT_S3_SECRET_KEY", ""),
+			UseSSL:    getEnvAsBool("IMPORT_S3_USE_SSL", true),
+		}
+	}
+
+	cfg.Integrations = IntegrationsConfig{
+		GoogleDrive: OAuthProviderConfig{
+			Enabled:      getEnvAsBool("IMPORT_GOOGLE_DRIVE_ENABLED", false),
+			ClientID:     getEnv("IMPORT_GOOGLE_DRIVE_CLIENT_ID", ""),
+			ClientSecret: getEnv("IMPORT_GOOGLE_DRIVE_CLIENT_SECRET", ""),
+			RedirectURL:  getEnv("IMPORT_GOOGLE_DRIVE_REDIRECT_URL", backendURL+"/integrations/import/google/callback"),
+			Scopes:       getEnv("IMPORT_GOOGLE_DRIVE_SCOPES", "https://www.googleapis.com/auth/drive.readonly"),
+		},
+		WebDAVAllowPrivate: getEnvAsBool("IMPORT_WEBDAV_ALLOW_PRIVATE", false),
+	}
+
+	cfg.Scan = ScanConfig{
+		ClamAVAddress:       getEnv("SCAN_CLAMAV_ADDRESS", ""),
+		Timeout:             getEnvAsDuration("SCAN_TIMEOUT", 2*time.Minute),
+		TransferBypassBytes: int64(getEnvAsInt("SCAN_TRANSFER_BYPASS_KB", 0)) * 1024,
+	}
+
+	cfg.Mirror = MirrorConfig{
+		Target: S3Config{
+			Endpoint:  getEnv("MIRROR_S3_ENDPOINT", ""),
+			Region:    getEnv("MIRROR_S3_REGION", "us-east-1"),
+			AccessKey: getEnv("MIRROR_S3_ACCESS_KEY", ""),
+			SecretKey: getEnv("MIRROR_S3_SECRET_KEY", ""),
+			Bucket:    getEnv("MIRROR_S3_BUCKET", ""),
+			UseSSL:    getEnvAsBool("MIRROR_S3_USE_SSL", true),
+		},
+		Deletes: getEnvAsBool("MIRROR_DELETES", false),
+	}
+
+	cfg.Archive = ArchiveConfig{
+		Target: S3Config{
+			Endpoint:     getEnv("ARCHIVE_S3_ENDPOINT", ""),
+			Region:       getEnv("ARCHIVE_S3_REGION", "us-east-1"),
+			AccessKey:    getEnv("ARCHIVE_S3_ACCESS_KEY", ""),
+			SecretKey:    getEnv("ARCHIVE_S3_SECRET_KEY", ""),
+			Bucket:       getEnv("ARCHIVE_S3_BUCKET", ""),
+			UseSSL:       getEnvAsBool("ARCHIVE_S3_USE_SSL", true),
+			StorageClass: getEnv("ARCHIVE_S3_STORAGE_CLASS", ""),
+		},
+		RestoreDelay: getEnvAsDuration("ARCHIVE_RESTORE_DELAY", 0),
+	}
+
+	cfg.Regions = RegionsConfig{
+		Replicas:       s3Replicas(cfg.S3, getEnvAsList("S3_REPLICAS", nil)),
+		ProbeInterval:  getEnvAsDuration("S3_REPLICA_PROBE_INTERVAL", 30*time.Second),
+		ReplicationLag: getEnvAsDuration("S3_REPLICA_LAG", 15*time.Minute),
+	}
+
+	cfg.GRPC = GRPCConfig{
+		Addr:     getEnv("GRPC_ADDR", ""),
+		CertFile: getEnv("GRPC_TLS_CERT_FILE", ""),
+		KeyFile:  getEnv("GRPC_TLS_KEY_FILE", ""),
+		ClientCA: getEnv("GRPC_CLIENT_CA_FILE", ""),
+	}
+
 	rpID := getEnv("WEBAUTHN_RP_ID", "")
 	if rpID == "" {
 		if parsed, err := url.Parse(cfg.Server.FrontendURL); err == nil {
@@ -255,9 +840,51 @@ func Load() *Config {
 		rpOrigins = append(rpOrigins, strings.Split(extra, ",")...)
 	}
 	cfg.WebAuthn = WebAuthnConfig{
-		RPDisplayName: getEnv("WEBAUTHN_RP_DISPLAY_NAME", "DocShare"),
-		RPID:          rpID,
-		RPOrigins:     rpOrigins,
+		RPDisplayName:   getEnv("WEBAUTHN_RP_DISPLAY_NAME", "DocShare"),
+		RPID:            rpID,
+		RPOrigins:       rpOrigins,
+		Attestation:     strings.ToLower(getEnv("WEBAUTHN_ATTESTATION", "none")),
+		AAGUIDAllowlist: getEnvAsList("WEBAUTHN_AAGUID_ALLOWLIST", nil),
+		AAGUIDDenylist:  getEnvAsList("WEBAUTHN_AAGUID_DENYLIST", nil),
+	}
+
+	cfg.MFA = MFAConfig{
+		Required:            strings.ToLower(getEnv("MFA_REQUIRED", "none")),
+		GracePeriod:         getEnvAsDuration("MFA_GRACE_PERIOD", 7*24*time.Hour),
+		RecoveryCodeCount:   getEnvAsInt("MFA_RECOVERY_CODE_COUNT", 10),
+		RecoveryMinCodes:    getEnvAsInt("MFA_RECOVERY_MIN_CODES", 3),
+		RecoveryDownloadTTL: getEnvAsDuration("MFA_RECOVERY_DOWNLOAD_TTL", 10*time.Minute),
+	}
+
+	cfg.Sessions = SessionsConfig{
+		CountryHeader:  getEnv("GEOIP_COUNTRY_HEADER", ""),
+		CityHeader:     getEnv("GEOIP_CITY_HEADER", ""),
+		NewDeviceEmail: getEnvAsBool("SESSION_NEW_DEVICE_EMAIL", true),
+	}
+
+	cfg.DueDates = DueDatesConfig{
+		ReminderHours: reminderHours(getEnvAsList("DUE_DATE_REMINDER_HOURS", []string{"168", "24"})),
+		Email:         getEnvAsBool("DUE_DATE_REMINDER_EMAIL", true),
+	}
+
+	cfg.Pastes = PastesConfig{
+		MaxBytes: int64(getEnvAsInt("PASTE_MAX_BYTES", 1024*1024)),
+		PerHour:  getEnvAsInt("PASTE_RATE_LIMIT", 60),
+	}
+
+	cfg.SMTP = SMTPConfig{
+		Host:     getEnv("SMTP_HOST", ""),
+		Port:     getEnvAsInt("SMTP_PORT", 587),
+		Username: getEnv("SMTP_USERNAME", ""),
+		Password: getEnv("SMTP_PASSWORD", ""),
+		From:     getEnv("SMTP_FROM", "DocShare <no-reply@localhost>"),
+	}
+
+	cfg.Branding = BrandingConfig{
+		Name:    getEnv("BRAND_NAME", "DocShare"),
+		LogoURL: getEnv("BRAND_LOGO_URL", ""),
+		Color:   getEnv("BRAND_COLOR", ""),
+		QRLogo:  getEnv("BRAND_QR_LOGO", ""),
 	}
 
 	return cfg
@@ -290,11 +917,90 @@ func getEnvAsDuration(key string, fallback time.Duration) time.Duration {
 	return fallback
 }
 
+// getEnvAsDate parses a date such as 2027-06-30, or an RFC 3339 time. An
+// unset or invalid variable yields the zero time.
+func getEnvAsDate(key string) time.Time {
+	value := os.Getenv(key)
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed
+		}
+	}
+	return time.Time{}
+}
+
+// getEnvAsList splits a comma-separated variable, dropping empty items. An
+// unset variable yields fallback; a set-but-empty one yields an empty list.
+func getEnvAsList(key string, fallback []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// s3Replicas parses S3_REPLICAS entries of the form region=endpoint/bucket
+// into bucket settings that share the main bucket's credentials and SSL
+// setting. Entries missing any part are skipped.
+func s3Replicas(main S3Config, entries []string) []S3Config {
+	var replicas []S3Config
+	for _, entry := range entries {
+		region, location, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		endpoint, bucket, ok := strings.Cut(strings.TrimSpace(location), "/")
+		region, endpoint, bucket = strings.TrimSpace(region), strings.TrimSpace(endpoint), strings.Trim(strings.TrimSpace(bucket), "/")
+		if !ok || region == "" || endpoint == "" || bucket == "" {
+			continue
+		}
+		replicas = append(replicas, S3Config{
+			Endpoint:  endpoint,
+			Region:    region,
+			AccessKey: main.AccessKey,
+			SecretKey: main.SecretKey,
+			Bucket:    bucket,
+			UseSSL:    main.UseSSL,
+		})
+	}
+	return replicas
+}
+
+// reminderHours parses DUE_DATE_REMINDER_HOURS. Entries that are not
+// whole hours between 0 and a year are skipped.
+func reminderHours(entries []string) []int {
+	hours := []int{}
+	for _, entry := range entries {
+		h, err := strconv.Atoi(entry)
+		if err != nil || h < 0 || h > 365*24 {
+			continue
+		}
+		hours = append(hours, h)
+	}
+	return hours
+}
+
+// defaultCORSOrigins allows the frontend URL, plus its 127.0.0.1 twin when
+// it points at localhost so local development works from either address.
+func defaultCORSOrigins(frontendURL string) []string {
+	origins := []string{frontendURL}
+	if strings.Contains(frontendURL, "localhost") {
+		origins = append(origins, strings.Replace(frontendURL, "localhost", "127.0.0.1", 1))
+	}
+	return origins
+}
+
 // maxUploadMB resolves MAX_UPLOAD_MB and refuses zero/negative values so an
 // operator can't silently disable the upload-size guard by misconfiguring
 // the env var (handlers check `MaxUploadBytes > 0` as the enforcement gate).
 func maxUploadMB() int {
-	const fallback = 100
+	const fallback = 5120
 	v := getEnvAsInt("MAX_UPLOAD_MB", fallback)
 	if v <= 0 {
 		return fallback
@@ -169,19 +169,30 @@ func TestLoad(t *testing.T) {
 	})
 
 	t.Run("preview config reads from env", func(t *testing.T) {
-		t.Setenv("PREVIEW_QUEUE_BUFFER_SIZE", "50")
 		t.Setenv("PREVIEW_JOB_MAX_ATTEMPTS", "5")
 
 		cfg := Load()
 
-		if cfg.Preview.QueueBufferSize != 50 {
-			t.Errorf("expected Preview.QueueBufferSize 50, got %d", cfg.Preview.QueueBufferSize)
-		}
 		if cfg.Preview.MaxAttempts != 5 {
 			t.Errorf("expected Preview.MaxAttempts 5, got %d", cfg.Preview.MaxAttempts)
 		}
 	})
 
+	t.Run("job runner config reads from env", func(t *testing.T) {
+		t.Setenv("JOB_WORKERS", "8")
+		t.Setenv("JOB_LEASE", "2m")
+		unsetEnv(t, "JOB_MAX_ATTEMPTS")
+
+		cfg := Load()
+
+		if cfg.Jobs.Workers != 8 || cfg.Jobs.Lease != 2*time.Minute {
+			t.Errorf("expected 8 workers with a 2m lease, got %+v", cfg.Jobs)
+		}
+		if cfg.Jobs.MaxAttempts != 5 {
+			t.Errorf("expected Jobs.MaxAttempts to default to 5, got %d", cfg.Jobs.MaxAttempts)
+		}
+	})
+
 	t.Run("S3 UseSSL defaults to true", func(t *testing.T) {
 		unsetEnv(t, "S3_USE_SSL")
 		cfg := Load()
@@ -306,6 +317,84 @@ func TestGetEnvAsDuration(t *testing.T) {
 	})
 }
 
+func TestGetEnvAsList(t *testing.T) {
+	t.Run("splits and trims items", func(t *testing.T) {
+		t.Setenv("TEST_LIST", " a , b,,c ")
+		got := getEnvAsList("TEST_LIST", nil)
+		if len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+			t.Errorf("expected [a b c], got %v", got)
+		}
+	})
+
+	t.Run("returns empty list when set but empty", func(t *testing.T) {
+		t.Setenv("TEST_LIST_EMPTY", "")
+		if got := getEnvAsList("TEST_LIST_EMPTY", []string{"fallback"}); len(got) != 0 {
+			t.Errorf("expected empty list, got %v", got)
+		}
+	})
+
+	t.Run("returns fallback when not set", func(t *testing.T) {
+		unsetEnv(t, "TEST_LIST_MISSING")
+		if got := getEnvAsList("TEST_LIST_MISSING", []string{"x"}); len(got) != 1 || got[0] != "x" {
+			t.Errorf("expected [x], got %v", got)
+		}
+	})
+}
+
+func TestLoad_CORSAndProxies(t *testing.T) {
+	t.Run("defaults allow the frontend and its loopback twin", func(t *testing.T) {
+		t.Setenv("WEB_URL", "http://localhost:3001")
+		unsetEnv(t, "CORS_ALLOWED_ORIGINS")
+		unsetEnv(t, "TRUSTED_PROXIES")
+		cfg := Load()
+		if len(cfg.CORS.AllowedOrigins) != 2 || cfg.CORS.AllowedOrigins[1] != "http://127.0.0.1:3001" {
+			t.Errorf("unexpected default origins: %v", cfg.CORS.AllowedOrigins)
+		}
+		if cfg.CORS.AllowCredentials {
+			t.Error("expected credentials to be disabled by default")
+		}
+		if len(cfg.Server.TrustedProxies) != 0 || cfg.Server.ProxyHeader != "X-Forwarded-For" {
+			t.Errorf("unexpected proxy defaults: %v %q", cfg.Server.TrustedProxies, cfg.Server.ProxyHeader)
+		}
+	})
+
+	t.Run("reads overrides", func(t *testing.T) {
+		t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com,https://b.example.com")
+		t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+		t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.5")
+		t.Setenv("PROXY_HEADER", "X-Real-IP")
+		cfg := Load()
+		if len(cfg.CORS.AllowedOrigins) != 2 || !cfg.CORS.AllowCredentials {
+			t.Errorf("unexpected CORS config: %+v", cfg.CORS)
+		}
+		if len(cfg.Server.TrustedProxies) != 2 || cfg.Server.TrustedProxies[1] != "192.168.1.5" || cfg.Server.ProxyHeader != "X-Real-IP" {
+			t.Errorf("unexpected proxy config: %v %q", cfg.Server.TrustedProxies, cfg.Server.ProxyHeader)
+		}
+	})
+}
+
+func TestLoad_BodyLimits(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		unsetEnv(t, "BODY_LIMIT_JSON_KB")
+		unsetEnv(t, "BODY_LIMIT_DOCUMENT_MB")
+		unsetEnv(t, "BODY_LIMIT_TRANSFER_CHUNK_MB")
+		limits := Load().BodyLimits
+		if limits.JSONBytes != 1<<20 || limits.DocumentBytes != 8<<20 || limits.TransferChunkBytes != 32<<20 {
+			t.Errorf("unexpected default body limits: %+v", limits)
+		}
+	})
+
+	t.Run("reads overrides", func(t *testing.T) {
+		t.Setenv("BODY_LIMIT_JSON_KB", "64")
+		t.Setenv("BODY_LIMIT_DOCUMENT_MB", "2")
+		t.Setenv("BODY_LIMIT_TRANSFER_CHUNK_MB", "100")
+		limits := Load().BodyLimits
+		if limits.JSONBytes != 64<<10 || limits.DocumentBytes != 2<<20 || limits.TransferChunkBytes != 100<<20 {
+			t.Errorf("unexpected body limits: %+v", limits)
+		}
+	})
+}
+
 func TestOAuthProviderConfig_ClientConfig(t *testing.T) {
 	cfg := OAuthProviderConfig{
 		ClientID:     "my-client-id",
@@ -329,3 +418,54 @@ func TestOAuthProviderConfig_ClientConfig(t *testing.T) {
 	}
 }
 
+
+func TestS3Replicas(t *testing.T) {
+	main := S3Config{AccessKey: "key", SecretKey: "secret", UseSSL: true}
+	got := s3Replicas(main, []string{
+		"eu-west-1=s3.eu-west-1.amazonaws.com/docshare-eu",
+		"no-bucket=s3.example.com",
+		"=s3.example.com/bucket",
+		"ap-southeast-2 = s3.ap-southeast-2.amazonaws.com/docshare-ap/",
+	})
+	if len(got) != 2 {
+		t.Fatalf("expected two replicas, got %+v", got)
+	}
+	if got[0].Region != "eu-west-1" || got[0].Endpoint != "s3.eu-west-1.amazonaws.com" || got[0].Bucket != "docshare-eu" || got[0].AccessKey != "key" || !got[0].UseSSL {
+		t.Errorf("unexpected replica %+v", got[0])
+	}
+	if got[1].Region != "ap-southeast-2" || got[1].Bucket != "docshare-ap" {
+		t.Errorf("unexpected replica %+v", got[1])
+	}
+}
+
+func TestLoad_DueDates(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		unsetEnv(t, "DUE_DATE_REMINDER_HOURS")
+		got := Load().DueDates
+		if len(got.ReminderHours) != 2 || got.ReminderHours[0] != 168 || got.ReminderHours[1] != 24 || !got.Email {
+			t.Errorf("unexpected defaults: %+v", got)
+		}
+	})
+
+	t.Run("skips invalid hours", func(t *testing.T) {
+		t.Setenv("DUE_DATE_REMINDER_HOURS", "48, soon, -1, 0, 99999")
+		got := Load().DueDates.ReminderHours
+		if len(got) != 2 || got[0] != 48 || got[1] != 0 {
+			t.Errorf("unexpected reminder hours: %v", got)
+		}
+	})
+}
+
+func TestLoad_Pastes(t *testing.T) {
+	unsetEnv(t, "PASTE_MAX_BYTES")
+	unsetEnv(t, "PASTE_RATE_LIMIT")
+	if got := Load().Pastes; got.MaxBytes != 1024*1024 || got.PerHour != 60 {
+		t.Errorf("unexpected defaults: %+v", got)
+	}
+
+	t.Setenv("PASTE_MAX_BYTES", "4096")
+	t.Setenv("PASTE_RATE_LIMIT", "0")
+	if got := Load().Pastes; got.MaxBytes != 4096 || got.PerHour != 0 {
+		t.Errorf("unexpected pastes config: %+v", got)
+	}
+}
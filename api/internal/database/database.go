@@ -5,13 +5,16 @@ import (
 
 	"github.com/docshare/api/internal/config"
 	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
 	"github.com/docshare/api/pkg/utils"
+	"github.com/google/uuid"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-func Connect(cfg config.DBConfig) (*gorm.DB, error) {
-	dsn := fmt.Sprintf(
+// DSN is the connection string of the primary.
+func DSN(cfg config.DBConfig) string {
+	return fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		cfg.Host,
 		cfg.Port,
@@ -20,11 +23,29 @@ func Connect(cfg config.DBConfig) (*gorm.DB, error) {
 		cfg.Name,
 		cfg.SSLMode,
 	)
+}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
+func Connect(cfg config.DBConfig) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(DSN(cfg)), &gorm.Config{
+		TranslateError: true,
+		Logger:         newQueryLogger(cfg.SlowQueryThreshold),
+	})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
 	if err != nil {
 		return nil, err
 	}
+	configurePool(sqlDB, cfg)
+
+	replicas := make([]gorm.Dialector, 0, len(cfg.ReplicaDSNs))
+	for _, replicaDSN := range cfg.ReplicaDSNs {
+		replicas = append(replicas, postgres.Open(replicaDSN))
+	}
+	if err := UseReplicas(db, cfg, replicas...); err != nil {
+		return nil, fmt.Errorf("failed registering read replicas: %w", err)
+	}
 
 	if err := migrate(db); err != nil {
 		return nil, err
@@ -39,29 +60,89 @@ func Connect(cfg config.DBConfig) (*gorm.DB, error) {
 
 func migrate(db *gorm.DB) error {
 	if err := db.AutoMigrate(
+		&models.Organization{},
 		&models.User{},
 		&models.Group{},
 		&models.GroupMembership{},
 		&models.File{},
 		&models.Share{},
+		&models.ShareInvitation{},
+		&models.FolderShareDefaults{},
+		&models.ShareControl{},
+		&models.ShareApproval{},
 		&models.AuditLog{},
 		&models.AuditExportCursor{},
+		&models.AuditExportObject{},
+		&models.AuditRetentionRun{},
 		&models.Activity{},
+		&models.ActivityMute{},
+		&models.NotificationPreference{},
 		&models.APIToken{},
+		&models.HMACKey{},
+		&models.RequestNonce{},
 		&models.DeviceCode{},
 		&models.Transfer{},
+		&models.TransferChunk{},
+		&models.Upload{},
+		&models.UploadChunk{},
+		&models.ClassificationRule{},
+		&models.LegalExport{},
+		&models.TermsVersion{},
+		&models.TermsAcceptance{},
 		&models.PreviewJob{},
 		&models.SSOProvider{},
 		&models.LinkedAccount{},
 		&models.MFAConfig{},
 		&models.WebAuthnCredential{},
+		&models.Session{},
+		&models.FileAccessStat{},
 		&models.MFAChallenge{},
+		&models.FileLock{},
+		&models.OutboxEvent{},
+		&models.Job{},
+		&models.StorageReconciliation{},
+		&models.IntegrityCheck{},
+		&models.ImportJob{},
+		&models.FolderTemplate{},
+		&models.FolderTemplateEntry{},
+		&models.PropertyDefinition{},
+		&models.FileProperty{},
+		&models.FileReview{},
+		&models.FileReviewer{},
+		&models.FileDueDate{},
+		&models.CalendarFeed{},
+		&models.Paste{},
+		&models.ArchiveExtraction{},
+		&models.ArchiveBuild{},
+		&models.IntegrationConnection{},
+		&models.Setting{},
+		&models.AbuseReport{},
+		&models.CaptchaPass{},
+		&models.IdempotencyKey{},
+		&models.PreviewTokenUse{},
+		&models.SigningKey{},
+		&models.UserKey{},
+		&models.VaultKey{},
 	); err != nil {
 		return err
 	}
 
-	// Drop the old constraint if it exists, then create the updated one that
-	// also allows public shares (both user and group NULL when share_type is public).
+	// SSO provider names used to be unique across the deployment; they are
+	// now unique per organization (idx_sso_providers_org_name).
+	if err := db.Exec(`DROP INDEX IF EXISTS idx_sso_providers_name`).Error; err != nil {
+		return err
+	}
+
+	// Idempotency keys used to be unique per user; they are now unique per
+	// user and route (idx_idempotency_keys_user_key_route).
+	if err := db.Exec(`DROP INDEX IF EXISTS idx_idempotency_keys_user_key`).Error; err != nil {
+		return err
+	}
+
+	// Drop the old constraints if they exist, then create the updated one
+	// that also allows public shares (both user and group NULL when
+	// share_type is public) and pending invitations (an email instead of a
+	// user or group).
 	dropOld := `
 DO $$
 BEGIN
@@ -72,6 +153,13 @@ BEGIN
   ) THEN
     ALTER TABLE shares DROP CONSTRAINT share_target_check;
   END IF;
+  IF EXISTS (
+    SELECT 1
+    FROM pg_constraint
+    WHERE conname = 'share_target_check_v2'
+  ) THEN
+    ALTER TABLE shares DROP CONSTRAINT share_target_check_v2;
+  END IF;
 END $$;`
 
 	if err := db.Exec(dropOld).Error; err != nil {
@@ -84,18 +172,20 @@ BEGIN
   IF NOT EXISTS (
     SELECT 1
     FROM pg_constraint
-    WHERE conname = 'share_target_check_v2'
+    WHERE conname = 'share_target_check_v3'
   ) THEN
     ALTER TABLE shares
-    ADD CONSTRAINT share_target_check_v2
+    ADD CONSTRAINT share_target_check_v3
     CHECK (
       (share_type = 'private' AND (
-        (shared_with_user_id IS NOT NULL AND shared_with_group_id IS NULL)
+        (shared_with_user_id IS NOT NULL AND shared_with_group_id IS NULL AND shared_with_email IS NULL)
         OR
-        (shared_with_user_id IS NULL AND shared_with_group_id IS NOT NULL)
+        (shared_with_user_id IS NULL AND shared_with_group_id IS NOT NULL AND shared_with_email IS NULL)
+        OR
+        (shared_with_user_id IS NULL AND shared_with_group_id IS NULL AND shared_with_email IS NOT NULL)
       ))
       OR
-      (share_type IN ('public_anyone', 'public_logged_in') AND shared_with_user_id IS NULL AND shared_with_group_id IS NULL)
+      (share_type IN ('public_anyone', 'public_logged_in') AND shared_with_user_id IS NULL AND shared_with_group_id IS NULL AND shared_with_email IS NULL)
     );
   END IF;
 END $$;`
@@ -104,6 +194,12 @@ END $$;`
 		return err
 	}
 
+	// Public shares made before links had slugs get one, so every public
+	// link can be opened under /public/links.
+	if err := backfillShareSlugs(db); err != nil {
+		return err
+	}
+
 	// Reconcile any pre-existing duplicate storage_path rows BEFORE adding
 	// the unique index — otherwise CREATE UNIQUE INDEX fails and the API
 	// won't start on environments that ran finalize concurrently before
@@ -196,6 +292,29 @@ WHERE storage_path <> '' AND deleted_at IS NULL;`
 	return db.Exec(storagePathUnique).Error
 }
 
+// backfillShareSlugs gives public shares without a slug one from
+// services.NewShareSlug, so old links are as hard to guess as new ones.
+func backfillShareSlugs(db *gorm.DB) error {
+	var ids []uuid.UUID
+	if err := db.Unscoped().Model(&models.Share{}).
+		Where("slug IS NULL AND share_type <> ?", models.ShareTypePrivate).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		slug, err := services.NewShareSlug()
+		if err != nil {
+			return err
+		}
+		if err := db.Unscoped().Model(&models.Share{}).
+			Where("id = ? AND slug IS NULL", id).
+			UpdateColumn("slug", slug).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func seedAdminUser(db *gorm.DB) error {
 	var count int64
 	if err := db.Model(&models.User{}).Count(&count).Error; err != nil {
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestBackfillShareSlugs(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.File{}, &models.Share{}); err != nil {
+		t.Fatalf("failed migrating: %v", err)
+	}
+	owner := models.User{Email: "owner@test.com", PasswordHash: "x", FirstName: "Share", LastName: "Owner", Role: models.UserRoleUser}
+	db.Create(&owner)
+	file := models.File{Name: "plan.pdf", OwnerID: owner.ID, StoragePath: "plan.pdf"}
+	db.Create(&file)
+	kept := "existing-slug"
+	shares := []models.Share{
+		{FileID: file.ID, SharedByID: owner.ID, ShareType: models.ShareTypePublicAnyone, Permission: models.SharePermissionView},
+		{FileID: file.ID, SharedByID: owner.ID, ShareType: models.ShareTypePublicLoggedIn, Permission: models.SharePermissionView},
+		{FileID: file.ID, SharedByID: owner.ID, ShareType: models.ShareTypePublicAnyone, Permission: models.SharePermissionView, Slug: &kept},
+		{FileID: file.ID, SharedByID: owner.ID, SharedWithUserID: &owner.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView},
+	}
+	for i := range shares {
+		if err := db.Create(&shares[i]).Error; err != nil {
+			t.Fatalf("failed creating share: %v", err)
+		}
+	}
+	db.Model(&models.Share{}).Where("id IN ?", []any{shares[0].ID, shares[1].ID, shares[3].ID}).Update("slug", nil)
+
+	if err := backfillShareSlugs(db); err != nil {
+		t.Fatalf("backfill failed: %v", err)
+	}
+	slugs := map[string]bool{}
+	for i, want := range []bool{true, true, true, false} {
+		var share models.Share
+		db.First(&share, "id = ?", shares[i].ID)
+		if (share.Slug != nil) != want {
+			t.Fatalf("share %d: expected a slug %v, got %v", i, want, share.Slug)
+		}
+		if share.Slug != nil {
+			slugs[*share.Slug] = true
+		}
+	}
+	if !slugs[kept] || len(slugs) != 3 {
+		t.Fatalf("expected the existing slug kept and two new ones, got %v", slugs)
+	}
+	for slug := range slugs {
+		if slug != kept && len(slug) != 20 {
+			t.Fatalf("expected a 20 character slug, got %q", slug)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// poolLimits is the part of *sql.DB that sizes a connection pool.
+type poolLimits interface {
+	SetMaxOpenConns(int)
+	SetMaxIdleConns(int)
+	SetConnMaxLifetime(time.Duration)
+	SetConnMaxIdleTime(time.Duration)
+}
+
+func configurePool(pool poolLimits, cfg config.DBConfig) {
+	if cfg.MaxOpenConns > 0 {
+		pool.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		pool.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		pool.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	}
+	if cfg.ConnMaxIdleTime > 0 {
+		pool.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	}
+}
+
+// PoolStats describes the primary's connection pool. Saturation is the
+// share of MaxOpen connections in use; Waits counts the times a query had
+// to wait for a free connection, the first sign the pool is too small.
+// Counters cover the time since the instance started.
+type PoolStats struct {
+	MaxOpen              int     `json:"maxOpen"`
+	Open                 int     `json:"open"`
+	InUse                int     `json:"inUse"`
+	Idle                 int     `json:"idle"`
+	Saturation           float64 `json:"saturation"`
+	Waits                int64   `json:"waits"`
+	WaitMs               int64   `json:"waitMs"`
+	ClosedIdle           int64   `json:"closedIdle"`
+	ClosedIdleTime       int64   `json:"closedIdleTime"`
+	ClosedLifetime       int64   `json:"closedLifetime"`
+	SlowQueries          int64   `json:"slowQueries"`
+	SlowQueryThresholdMs int64   `json:"slowQueryThresholdMs"`
+}
+
+// Stats reports on db's connection pool.
+func Stats(db *gorm.DB) (PoolStats, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return PoolStats{}, err
+	}
+	stats := poolStats(sqlDB.Stats())
+	if ql, ok := db.Logger.(*queryLogger); ok {
+		stats.SlowQueries = ql.slow.Load()
+		stats.SlowQueryThresholdMs = ql.threshold.Milliseconds()
+	}
+	return stats, nil
+}
+
+func poolStats(s sql.DBStats) PoolStats {
+	stats := PoolStats{
+		MaxOpen:        s.MaxOpenConnections,
+		Open:           s.OpenConnections,
+		InUse:          s.InUse,
+		Idle:           s.Idle,
+		Waits:          s.WaitCount,
+		WaitMs:         s.WaitDuration.Milliseconds(),
+		ClosedIdle:     s.MaxIdleClosed,
+		ClosedIdleTime: s.MaxIdleTimeClosed,
+		ClosedLifetime: s.MaxLifetimeClosed,
+	}
+	if s.MaxOpenConnections > 0 {
+		stats.Saturation = float64(s.InUse) / float64(s.MaxOpenConnections)
+	}
+	return stats
+}
+
+// MonitorPool checks the primary's pool every interval and logs a warning
+// when queries waited for a connection since the last check, so operators
+// hear about an exhausted pool before requests start timing out.
+func MonitorPool(db *gorm.DB, interval time.Duration) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		logger.Error("db_pool_monitor_failed", err, nil)
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		last := sqlDB.Stats()
+		for range ticker.C {
+			current := sqlDB.Stats()
+			if waits := current.WaitCount - last.WaitCount; waits > 0 {
+				stats := poolStats(current)
+				logger.Warn("db_pool_saturated", map[string]interface{}{
+					"waits":      waits,
+					"wait_ms":    (current.WaitDuration - last.WaitDuration).Milliseconds(),
+					"in_use":     stats.InUse,
+					"max_open":   stats.MaxOpen,
+					"saturation": stats.Saturation,
+					"interval":   interval.String(),
+				})
+			}
+			last = current
+		}
+	}()
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestStats(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "pool.db")), &gorm.Config{
+		Logger: newQueryLogger(time.Nanosecond),
+	})
+	if err != nil {
+		t.Fatalf("failed opening database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed reaching pool: %v", err)
+	}
+	configurePool(sqlDB, config.DBConfig{MaxOpenConns: 4, MaxIdleConns: 2})
+
+	if err := db.AutoMigrate(&routedNote{}); err != nil {
+		t.Fatalf("failed migrating: %v", err)
+	}
+	var notes []routedNote
+	if err := db.Where("body = ?", "secret").Find(&notes).Error; err != nil {
+		t.Fatalf("failed querying: %v", err)
+	}
+
+	stats, err := Stats(db)
+	if err != nil {
+		t.Fatalf("failed reading stats: %v", err)
+	}
+	if stats.MaxOpen != 4 {
+		t.Fatalf("expected the configured pool size, got %d", stats.MaxOpen)
+	}
+	if stats.SlowQueries == 0 || stats.SlowQueryThresholdMs != 0 {
+		t.Fatalf("expected every query to count as slow, got %+v", stats)
+	}
+
+	if query, vars := newQueryLogger(0).ParamsFilter(context.Background(), "SELECT * FROM notes WHERE body = ?", "secret"); vars != nil || query != "SELECT * FROM notes WHERE body = ?" {
+		t.Fatalf("expected values to be dropped from logged SQL, got %q %v", query, vars)
+	}
+}
+
+func TestPoolStatsSaturation(t *testing.T) {
+	stats := poolStats(sql.DBStats{MaxOpenConnections: 10, InUse: 8})
+	if stats.Saturation != 0.8 {
+		t.Fatalf("expected 80%% saturation, got %v", stats.Saturation)
+	}
+	if poolStats(sql.DBStats{InUse: 3}).Saturation != 0 {
+		t.Fatal("expected an unlimited pool to report no saturation")
+	}
+}
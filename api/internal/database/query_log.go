@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	gormlogger "gorm.io/gorm/logger"
+	gormutils "gorm.io/gorm/utils"
+)
+
+// queryLogger reports queries slower than threshold through the structured
+// logger, tagged with the request that ran them when the query was given
+// the request's context. Other messages, such as failed queries, go to
+// GORM's usual logger. SQL is logged with placeholders rather than values
+// so nothing sensitive ends up in the log.
+type queryLogger struct {
+	gormlogger.Interface
+	threshold time.Duration
+	slow      *atomic.Int64
+}
+
+func newQueryLogger(threshold time.Duration) *queryLogger {
+	return &queryLogger{
+		Interface: gormlogger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), gormlogger.Config{
+			LogLevel:             gormlogger.Warn,
+			Colorful:             true,
+			ParameterizedQueries: true,
+		}),
+		threshold: threshold,
+		slow:      &atomic.Int64{},
+	}
+}
+
+func (l *queryLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	return &queryLogger{Interface: l.Interface.LogMode(level), threshold: l.threshold, slow: l.slow}
+}
+
+// ParamsFilter drops the query's values, keeping its placeholders.
+func (l *queryLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
+
+func (l *queryLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	l.Interface.Trace(ctx, begin, fc, err)
+	elapsed := time.Since(begin)
+	if l.threshold <= 0 || elapsed < l.threshold {
+		return
+	}
+	l.slow.Add(1)
+
+	sql, rows := fc()
+	details := map[string]interface{}{
+		"duration_ms":  elapsed.Milliseconds(),
+		"threshold_ms": l.threshold.Milliseconds(),
+		"rows":         rows,
+		"sql":          sql,
+		"caller":       gormutils.FileWithLineNum(),
+	}
+	if request, ok := utils.RequestInfoFromContext(ctx); ok {
+		details["request_id"] = request.ID
+		details["route"] = request.Method + " " + request.Path
+	}
+	logger.Warn("slow_query", details)
+}
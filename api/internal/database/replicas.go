@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"github.com/docshare/api/internal/config"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+type readRoutingKey struct{}
+
+// readRouting is the replica state of one request: reads may go to a
+// replica until the request writes, after which they stay on the primary
+// so the request sees its own changes.
+type readRouting struct {
+	wrote atomic.Bool
+}
+
+// WithReplicaReads marks ctx as belonging to a read-only request, letting
+// queries run with it read from a replica. Queries without such a context
+// always read from the primary.
+func WithReplicaReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readRoutingKey{}, &readRouting{})
+}
+
+// ReadsFromReplica reports whether queries run with ctx may currently read
+// from a replica.
+func ReadsFromReplica(ctx context.Context) bool {
+	routing, ok := ctx.Value(readRoutingKey{}).(*readRouting)
+	return ok && !routing.wrote.Load()
+}
+
+// UseReplicas routes reads to replicas, picked at random per query. Only
+// queries run with a context from WithReplicaReads use them, and only until
+// that context has been used for a write; everything else, including all
+// writes and transactions, stays on the primary. The replicas' pools are
+// sized like the primary's.
+func UseReplicas(db *gorm.DB, cfg config.DBConfig, replicas ...gorm.Dialector) error {
+	if len(replicas) == 0 {
+		return nil
+	}
+	resolver := dbresolver.Register(dbresolver.Config{
+		Replicas: replicas,
+		Policy:   dbresolver.RandomPolicy{},
+	})
+	if err := db.Use(resolver); err != nil {
+		return err
+	}
+	if err := resolver.Call(func(pool gorm.ConnPool) error {
+		if limits, ok := pool.(poolLimits); ok {
+			configurePool(limits, cfg)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// The resolver's own callbacks run before all others; callbacks placed
+	// before all others later are put ahead of them, so routeRead sees each
+	// read first.
+	cb := db.Callback()
+	for _, register := range []func(string, func(*gorm.DB)) error{
+		cb.Query().Before("*").Register,
+		cb.Row().Before("*").Register,
+		cb.Raw().Before("*").Register,
+	} {
+		if err := register("docshare:read_routing", routeRead); err != nil {
+			return err
+		}
+	}
+	for _, register := range []func(string, func(*gorm.DB)) error{
+		cb.Create().After("*").Register,
+		cb.Update().After("*").Register,
+		cb.Delete().After("*").Register,
+		cb.Raw().After("*").Register,
+	} {
+		if err := register("docshare:read_routing_write", noteWrite); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// routeRead pins a read to the primary unless its context allows a replica.
+func routeRead(db *gorm.DB) {
+	if !ReadsFromReplica(db.Statement.Context) {
+		dbresolver.Write.ModifyStatement(db.Statement)
+	}
+}
+
+// noteWrite keeps the rest of the request on the primary once it writes.
+func noteWrite(db *gorm.DB) {
+	routing, ok := db.Statement.Context.Value(readRoutingKey{}).(*readRouting)
+	if !ok {
+		return
+	}
+	if sql := strings.TrimSpace(db.Statement.SQL.String()); len(sql) >= 6 && strings.EqualFold(sql[:6], "select") {
+		return
+	}
+	routing.wrote.Store(true)
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+type routedNote struct {
+	ID   uint
+	Body string
+}
+
+func TestUseReplicas(t *testing.T) {
+	dir := t.TempDir()
+	replicaDSN := filepath.Join(dir, "replica.db")
+	replica, err := gorm.Open(sqlite.Open(replicaDSN), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening replica: %v", err)
+	}
+	if err := replica.AutoMigrate(&routedNote{}); err != nil {
+		t.Fatalf("failed migrating replica: %v", err)
+	}
+	if err := replica.Create(&routedNote{Body: "replica"}).Error; err != nil {
+		t.Fatalf("failed seeding replica: %v", err)
+	}
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "primary.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening primary: %v", err)
+	}
+	if err := db.AutoMigrate(&routedNote{}); err != nil {
+		t.Fatalf("failed migrating primary: %v", err)
+	}
+	if err := UseReplicas(db, config.DBConfig{}, sqlite.Open(replicaDSN)); err != nil {
+		t.Fatalf("failed registering replica: %v", err)
+	}
+	if err := db.Create(&routedNote{Body: "primary"}).Error; err != nil {
+		t.Fatalf("failed seeding primary: %v", err)
+	}
+
+	readFrom := func(ctx context.Context) string {
+		var note routedNote
+		if err := db.WithContext(ctx).Order("id").First(&note).Error; err != nil {
+			t.Fatalf("failed reading: %v", err)
+		}
+		return note.Body
+	}
+
+	if got := readFrom(context.Background()); got != "primary" {
+		t.Fatalf("expected reads without a routing context on the primary, got %s", got)
+	}
+
+	ctx := WithReplicaReads(context.Background())
+	if got := readFrom(ctx); got != "replica" {
+		t.Fatalf("expected a read-only request to read from the replica, got %s", got)
+	}
+
+	if err := db.WithContext(ctx).Model(&routedNote{}).Where("body = ?", "primary").Update("body", "edited").Error; err != nil {
+		t.Fatalf("failed writing: %v", err)
+	}
+	if got := readFrom(ctx); got != "edited" {
+		t.Fatalf("expected reads after a write to stay on the primary, got %s", got)
+	}
+	if ReadsFromReplica(ctx) {
+		t.Fatal("expected the request to be pinned to the primary")
+	}
+}
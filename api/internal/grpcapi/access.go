@@ -0,0 +1,37 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/docshare/api/internal/models"
+	pb "github.com/docshare/api/pkg/pb/docshare/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var permissions = map[pb.Permission]models.SharePermission{
+	pb.Permission_PERMISSION_VIEW:     models.SharePermissionView,
+	pb.Permission_PERMISSION_DOWNLOAD: models.SharePermissionDownload,
+	pb.Permission_PERMISSION_EDIT:     models.SharePermissionEdit,
+}
+
+type accessService struct {
+	pb.UnimplementedAccessServiceServer
+	server *Server
+}
+
+func (a *accessService) CheckAccess(ctx context.Context, req *pb.CheckAccessRequest) (*pb.CheckAccessResponse, error) {
+	userID, err := parseID("user_id", req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	fileID, err := parseID("file_id", req.GetFileId())
+	if err != nil {
+		return nil, err
+	}
+	permission, ok := permissions[req.GetPermission()]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "permission must be view, download or edit")
+	}
+	return &pb.CheckAccessResponse{Allowed: a.server.Access.HasAccess(ctx, userID, fileID, permission)}, nil
+}
@@ -0,0 +1,103 @@
+package grpcapi
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/docshare/api/internal/services"
+	pb "github.com/docshare/api/pkg/pb/docshare/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ingestBatchSize is how many streamed events are written per insert.
+const ingestBatchSize = 100
+
+type auditService struct {
+	pb.UnimplementedAuditServiceServer
+	server *Server
+}
+
+// IngestEvents writes events as they arrive in batches. Events in a batch
+// that failed are not stored, and the error reports how many earlier ones
+// were, so the client can resend the rest.
+func (a *auditService) IngestEvents(stream grpc.ClientStreamingServer[pb.AuditEvent, pb.IngestEventsResponse]) error {
+	ctx := stream.Context()
+	caller := CallerFrom(ctx)
+	var accepted int64
+	batch := make([]services.AuditEntry, 0, ingestBatchSize)
+	flush := func() error {
+		if err := a.server.Audit.LogBatch(ctx, batch); err != nil {
+			return status.Errorf(codes.Internal, "failed storing audit events after %d were accepted", accepted)
+		}
+		accepted += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		event, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			if err := flush(); err != nil {
+				return err
+			}
+			return stream.SendAndClose(&pb.IngestEventsResponse{Accepted: accepted})
+		}
+		if err != nil {
+			return err
+		}
+		entry, err := auditEntry(event, caller)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, entry)
+		if len(batch) == ingestBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// auditEntry turns an event into an audit row. The calling service and
+// the time the event occurred are kept in the details, over any the event
+// sent under the same keys.
+func auditEntry(event *pb.AuditEvent, caller *Caller) (services.AuditEntry, error) {
+	if event.GetAction() == "" {
+		return services.AuditEntry{}, status.Error(codes.InvalidArgument, "action is required")
+	}
+	details := map[string]interface{}{}
+	for key, value := range event.GetDetails() {
+		details[key] = value
+	}
+	// Written after the caller's details so a service cannot pass its
+	// events off as another's.
+	details["source"] = caller.Service
+	if event.GetOccurredAt() != nil {
+		details["occurred_at"] = event.GetOccurredAt().AsTime().UTC().Format(time.RFC3339Nano)
+	}
+	entry := services.AuditEntry{
+		Action:       event.GetAction(),
+		ResourceType: event.GetResourceType(),
+		Details:      details,
+		IPAddress:    event.GetIpAddress(),
+		RequestID:    event.GetRequestId(),
+	}
+	if event.GetUserId() != "" {
+		id, err := parseID("user_id", event.GetUserId())
+		if err != nil {
+			return entry, err
+		}
+		entry.UserID = &id
+	}
+	if event.GetResourceId() != "" {
+		id, err := parseID("resource_id", event.GetResourceId())
+		if err != nil {
+			return entry, err
+		}
+		entry.ResourceID = &id
+	}
+	return entry, nil
+}
@@ -0,0 +1,120 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const apiTokenPrefix = "dsh_"
+
+// Caller is who a gRPC request was authenticated as. Service names the
+// client: the common name of its certificate, or the name of its token.
+// User is set for token callers.
+type Caller struct {
+	Service string
+	User    *models.User
+}
+
+type callerKey struct{}
+
+// CallerFrom returns the caller the interceptors authenticated.
+func CallerFrom(ctx context.Context) *Caller {
+	caller, _ := ctx.Value(callerKey{}).(*Caller)
+	return caller
+}
+
+func (s *Server) unaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	caller, err := s.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(context.WithValue(ctx, callerKey{}, caller), req)
+}
+
+func (s *Server) streamAuth(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	caller, err := s.authenticate(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &callerStream{ServerStream: stream, ctx: context.WithValue(stream.Context(), callerKey{}, caller)})
+}
+
+type callerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (c *callerStream) Context() context.Context {
+	return c.ctx
+}
+
+// authenticate accepts a verified client certificate first and otherwise
+// an API token belonging to an active platform admin, sent as
+// "authorization: Bearer dsh_..." metadata like on the HTTP API. The
+// services answer across tenants, so an organization's admins are refused.
+func (s *Server) authenticate(ctx context.Context, method string) (*Caller, error) {
+	if name, ok := verifiedClient(ctx); ok {
+		return &Caller{Service: name}, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing client certificate or authorization metadata")
+	}
+	raw := strings.TrimSpace(strings.TrimPrefix(values[0], "Bearer"))
+	if !strings.HasPrefix(raw, apiTokenPrefix) {
+		return nil, status.Error(codes.Unauthenticated, "an API token is required")
+	}
+
+	hash := sha256.Sum256([]byte(raw))
+	var token models.APIToken
+	if err := s.DB.WithContext(ctx).Preload("User").First(&token, "token_hash = ?", hex.EncodeToString(hash[:])).Error; err != nil {
+		logger.Warn("grpc_api_token_not_found", map[string]interface{}{"method": method})
+		return nil, status.Error(codes.Unauthenticated, "invalid API token")
+	}
+	if token.ExpiresAt != nil && token.ExpiresAt.Before(time.Now()) {
+		return nil, status.Error(codes.Unauthenticated, "API token has expired")
+	}
+	if token.User.IsSuspended() || token.User.Role != models.UserRoleAdmin || token.User.OrganizationID != nil {
+		logger.Warn("grpc_api_token_refused", map[string]interface{}{
+			"method":   method,
+			"token_id": token.ID.String(),
+			"user_id":  token.UserID.String(),
+		})
+		return nil, status.Error(codes.PermissionDenied, "the API token must belong to an active platform admin")
+	}
+	s.DB.Model(&token).Update("last_used_at", time.Now())
+	return &Caller{Service: token.Name, User: &token.User}, nil
+}
+
+// verifiedClient returns the common name of the client certificate when
+// the TLS handshake verified one against the client CA.
+func verifiedClient(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || !verified(info.State) {
+		return "", false
+	}
+	return info.State.VerifiedChains[0][0].Subject.CommonName, true
+}
+
+func verified(state tls.ConnectionState) bool {
+	return len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0
+}
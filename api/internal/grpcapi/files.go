@@ -0,0 +1,125 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/docshare/api/internal/models"
+	pb "github.com/docshare/api/pkg/pb/docshare/v1"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// listFilesPageSize is how many rows ListFiles reads at a time while it
+// streams.
+const listFilesPageSize = 500
+
+type fileService struct {
+	pb.UnimplementedFileServiceServer
+	server *Server
+}
+
+func (f *fileService) GetFile(ctx context.Context, req *pb.GetFileRequest) (*pb.File, error) {
+	id, err := parseID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	var file models.File
+	if err := f.server.DB.WithContext(ctx).First(&file, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, status.Error(codes.NotFound, "file not found")
+		}
+		return nil, status.Error(codes.Internal, "failed loading file")
+	}
+	return fileMessage(&file), nil
+}
+
+func (f *fileService) ListFiles(req *pb.ListFilesRequest, stream grpc.ServerStreamingServer[pb.File]) error {
+	ctx := stream.Context()
+	query := f.server.DB.WithContext(ctx).Model(&models.File{})
+	if req.GetParentId() != "" {
+		parentID, err := parseID("parent_id", req.GetParentId())
+		if err != nil {
+			return err
+		}
+		query = query.Where("parent_id = ?", parentID)
+	}
+
+	afterAt, afterID := req.GetUpdatedAfter(), uuid.Nil
+	if req.GetAfterId() != "" {
+		id, err := parseID("after_id", req.GetAfterId())
+		if err != nil {
+			return err
+		}
+		afterID = id
+	}
+
+	sent := int32(0)
+	for {
+		page := query.Session(&gorm.Session{}).Order("updated_at ASC, id ASC").Limit(listFilesPageSize)
+		if afterAt != nil {
+			at := afterAt.AsTime().UTC()
+			page = page.Where("updated_at > ? OR (updated_at = ? AND id > ?)", at, at, afterID)
+		}
+		var files []models.File
+		if err := page.Find(&files).Error; err != nil {
+			return status.Error(codes.Internal, "failed listing files")
+		}
+		for i := range files {
+			if req.GetLimit() > 0 && sent >= req.GetLimit() {
+				return nil
+			}
+			if err := stream.Send(fileMessage(&files[i])); err != nil {
+				return err
+			}
+			sent++
+		}
+		if len(files) < listFilesPageSize {
+			return nil
+		}
+		last := files[len(files)-1]
+		afterAt, afterID = timestamppb.New(last.UpdatedAt), last.ID
+	}
+}
+
+func fileMessage(file *models.File) *pb.File {
+	msg := &pb.File{
+		Id:          file.ID.String(),
+		Name:        file.Name,
+		MimeType:    file.MimeType,
+		Size:        file.Size,
+		IsDirectory: file.IsDirectory,
+		OwnerId:     file.OwnerID.String(),
+		Tags:        file.Tags,
+		Quarantined: file.QuarantinedAt != nil,
+		Archived:    file.ArchivedAt != nil,
+		Language:    file.Language,
+		CreatedAt:   timestamppb.New(file.CreatedAt),
+		UpdatedAt:   timestamppb.New(file.UpdatedAt),
+	}
+	if file.ParentID != nil {
+		msg.ParentId = file.ParentID.String()
+	}
+	if file.OrganizationID != nil {
+		msg.OrganizationId = file.OrganizationID.String()
+	}
+	if file.Checksum != nil {
+		msg.Checksum = *file.Checksum
+	}
+	if file.VaultID != nil {
+		msg.VaultId = file.VaultID.String()
+	}
+	return msg
+}
+
+func parseID(field, value string) (uuid.UUID, error) {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, status.Errorf(codes.InvalidArgument, "%s must be a UUID", field)
+	}
+	return id, nil
+}
@@ -0,0 +1,80 @@
+// Package grpcapi serves the internal gRPC API defined in
+// proto/docshare/v1 for services running next to DocShare.
+package grpcapi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/services"
+	pb "github.com/docshare/api/pkg/pb/docshare/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"gorm.io/gorm"
+)
+
+// Server implements the gRPC services on top of the same services the
+// HTTP handlers use.
+type Server struct {
+	DB     *gorm.DB
+	Access *services.AccessService
+	Audit  *services.AuditService
+}
+
+func NewServer(db *gorm.DB, access *services.AccessService, audit *services.AuditService) *Server {
+	return &Server{DB: db, Access: access, Audit: audit}
+}
+
+// GRPCServer builds a grpc.Server with every service registered behind the
+// authentication interceptors, listening with TLS when cfg asks for it.
+func (s *Server) GRPCServer(cfg config.GRPCConfig) (*grpc.Server, error) {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(s.unaryAuth),
+		grpc.ChainStreamInterceptor(s.streamAuth),
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		tlsConfig, err := serverTLS(cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	} else if cfg.ClientCA != "" {
+		return nil, fmt.Errorf("GRPC_CLIENT_CA_FILE needs GRPC_TLS_CERT_FILE and GRPC_TLS_KEY_FILE")
+	}
+
+	server := grpc.NewServer(opts...)
+	s.Register(server)
+	return server, nil
+}
+
+// Register adds the services to server, for callers that set up their own
+// grpc.Server; they must install the interceptors from GRPCServer too.
+func (s *Server) Register(server grpc.ServiceRegistrar) {
+	pb.RegisterFileServiceServer(server, &fileService{server: s})
+	pb.RegisterAccessServiceServer(server, &accessService{server: s})
+	pb.RegisterAuditServiceServer(server, &auditService{server: s})
+}
+
+func serverTLS(cfg config.GRPCConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("GRPC_TLS_CERT_FILE: %w", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if cfg.ClientCA != "" {
+		pem, err := os.ReadFile(cfg.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("GRPC_CLIENT_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("GRPC_CLIENT_CA_FILE: no certificates found")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,231 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	pb "github.com/docshare/api/pkg/pb/docshare/v1"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+func setupGRPCTest(t *testing.T) (*gorm.DB, *grpc.ClientConn) {
+	t.Helper()
+	logger.Init()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(
+		&models.User{},
+		&models.Group{},
+		&models.GroupMembership{},
+		&models.File{},
+		&models.Share{},
+		&models.APIToken{},
+		&models.AuditLog{},
+		&models.Activity{},
+	); err != nil {
+		t.Fatalf("failed migrating: %v", err)
+	}
+
+	server, err := NewServer(db, services.NewAccessService(db), &services.AuditService{DB: db}).GRPCServer(config.GRPCConfig{})
+	if err != nil {
+		t.Fatalf("failed building server: %v", err)
+	}
+	listener := bufconn.Listen(1024 * 1024)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed dialing: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return db, conn
+}
+
+func createUser(t *testing.T, db *gorm.DB, email string, role models.UserRole) models.User {
+	t.Helper()
+	user := models.User{Email: email, PasswordHash: "x", FirstName: "Test", LastName: "User", Role: role}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed creating user: %v", err)
+	}
+	return user
+}
+
+func createToken(t *testing.T, db *gorm.DB, user models.User, name string) context.Context {
+	t.Helper()
+	raw := "dsh_" + uuid.NewString()
+	hash := sha256.Sum256([]byte(raw))
+	token := models.APIToken{UserID: user.ID, Name: name, TokenHash: hex.EncodeToString(hash[:]), Prefix: raw[:8]}
+	if err := db.Create(&token).Error; err != nil {
+		t.Fatalf("failed creating token: %v", err)
+	}
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+raw)
+}
+
+func TestGRPCAuthentication(t *testing.T) {
+	db, conn := setupGRPCTest(t)
+	files := pb.NewFileServiceClient(conn)
+	user := createUser(t, db, "user@example.com", models.UserRoleUser)
+	req := &pb.GetFileRequest{Id: uuid.NewString()}
+
+	if _, err := files.GetFile(context.Background(), req); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected unauthenticated without credentials, got %v", err)
+	}
+	if _, err := files.GetFile(createToken(t, db, user, "indexer"), req); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected a non-admin token to be refused, got %v", err)
+	}
+	admin := createUser(t, db, "admin@example.com", models.UserRoleAdmin)
+	if _, err := files.GetFile(createToken(t, db, admin, "indexer"), req); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected an admin token to get through, got %v", err)
+	}
+}
+
+func TestGRPCOrganizationAdmin(t *testing.T) {
+	db, conn := setupGRPCTest(t)
+	if err := db.AutoMigrate(&models.Organization{}); err != nil {
+		t.Fatalf("failed migrating: %v", err)
+	}
+	orgA := models.Organization{Name: "Acme", Slug: "acme"}
+	orgB := models.Organization{Name: "Globex", Slug: "globex"}
+	db.Create(&orgA)
+	db.Create(&orgB)
+	admin := createUser(t, db, "admin@acme.test", models.UserRoleAdmin)
+	db.Model(&admin).Update("organization_id", orgA.ID)
+	owner := createUser(t, db, "owner@globex.test", models.UserRoleUser)
+	file := models.File{Name: "plan.pdf", OwnerID: owner.ID, OrganizationID: &orgB.ID}
+	db.Create(&file)
+
+	// Files are served across tenants, so an organization's admin gets no
+	// further than authentication.
+	_, err := pb.NewFileServiceClient(conn).GetFile(createToken(t, db, admin, "indexer"), &pb.GetFileRequest{Id: file.ID.String()})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected an organization admin's token to be refused, got %v", err)
+	}
+}
+
+func TestGRPCServices(t *testing.T) {
+	db, conn := setupGRPCTest(t)
+	admin := createUser(t, db, "admin@example.com", models.UserRoleAdmin)
+	ctx := createToken(t, db, admin, "indexer")
+	owner := createUser(t, db, "owner@example.com", models.UserRoleUser)
+	other := createUser(t, db, "other@example.com", models.UserRoleUser)
+
+	folder := models.File{Name: "Reports", MimeType: "inode/directory", IsDirectory: true, OwnerID: owner.ID}
+	db.Create(&folder)
+	for i, name := range []string{"a.pdf", "b.pdf", "c.pdf"} {
+		file := models.File{Name: name, MimeType: "application/pdf", Size: int64(i + 1), ParentID: &folder.ID, OwnerID: owner.ID, Language: "de"}
+		db.Create(&file)
+	}
+	db.Create(&models.Share{FileID: folder.ID, SharedByID: owner.ID, SharedWithUserID: &other.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView})
+
+	t.Run("files", func(t *testing.T) {
+		client := pb.NewFileServiceClient(conn)
+		got, err := client.GetFile(ctx, &pb.GetFileRequest{Id: folder.ID.String()})
+		if err != nil || got.GetName() != "Reports" || !got.GetIsDirectory() || got.GetOwnerId() != owner.ID.String() {
+			t.Fatalf("unexpected file %v: %v", got, err)
+		}
+
+		list := func(req *pb.ListFilesRequest) []*pb.File {
+			stream, err := client.ListFiles(ctx, req)
+			if err != nil {
+				t.Fatalf("list failed: %v", err)
+			}
+			var out []*pb.File
+			for {
+				file, err := stream.Recv()
+				if err == io.EOF {
+					return out
+				}
+				if err != nil {
+					t.Fatalf("receive failed: %v", err)
+				}
+				out = append(out, file)
+			}
+		}
+		first := list(&pb.ListFilesRequest{ParentId: folder.ID.String(), Limit: 2})
+		if len(first) != 2 || first[0].GetLanguage() != "de" {
+			t.Fatalf("expected the limit to apply to German files, got %v", first)
+		}
+		last := first[len(first)-1]
+		rest := list(&pb.ListFilesRequest{ParentId: folder.ID.String(), UpdatedAfter: last.GetUpdatedAt(), AfterId: last.GetId()})
+		if len(rest) != 1 || rest[0].GetId() == first[0].GetId() || rest[0].GetId() == last.GetId() {
+			t.Fatalf("expected the listing to resume after the last file, got %v", rest)
+		}
+		if all := list(&pb.ListFilesRequest{}); len(all) != 4 {
+			t.Fatalf("expected every file, got %d", len(all))
+		}
+	})
+
+	t.Run("access", func(t *testing.T) {
+		client := pb.NewAccessServiceClient(conn)
+		check := func(userID uuid.UUID, permission pb.Permission) bool {
+			resp, err := client.CheckAccess(ctx, &pb.CheckAccessRequest{UserId: userID.String(), FileId: folder.ID.String(), Permission: permission})
+			if err != nil {
+				t.Fatalf("check failed: %v", err)
+			}
+			return resp.GetAllowed()
+		}
+		if !check(other.ID, pb.Permission_PERMISSION_VIEW) || check(other.ID, pb.Permission_PERMISSION_EDIT) || !check(owner.ID, pb.Permission_PERMISSION_EDIT) {
+			t.Fatal("access checks do not follow the share")
+		}
+		if _, err := client.CheckAccess(ctx, &pb.CheckAccessRequest{UserId: other.ID.String(), FileId: folder.ID.String()}); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("expected a missing permission to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("audit ingestion", func(t *testing.T) {
+		stream, err := pb.NewAuditServiceClient(conn).IngestEvents(ctx)
+		if err != nil {
+			t.Fatalf("ingest failed: %v", err)
+		}
+		occurred := time.Now().Add(-time.Minute)
+		for i := 0; i < ingestBatchSize+5; i++ {
+			if err := stream.Send(&pb.AuditEvent{
+				Action:       "indexer.reindex",
+				ResourceType: "file",
+				ResourceId:   folder.ID.String(),
+				Details:      map[string]string{"pages": "12", "source": "billing"},
+				OccurredAt:   timestamppb.New(occurred),
+			}); err != nil {
+				t.Fatalf("send failed: %v", err)
+			}
+		}
+		resp, err := stream.CloseAndRecv()
+		if err != nil || resp.GetAccepted() != ingestBatchSize+5 {
+			t.Fatalf("unexpected response %v: %v", resp, err)
+		}
+
+		var logs []models.AuditLog
+		db.Where("action = ?", "indexer.reindex").Find(&logs)
+		if len(logs) != ingestBatchSize+5 || logs[0].Details["source"] != "indexer" || logs[0].Details["pages"] != "12" || logs[0].Details["occurred_at"] == nil {
+			t.Fatalf("unexpected audit rows: %d %v", len(logs), logs[0].Details)
+		}
+	})
+}
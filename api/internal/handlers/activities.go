@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"time"
+
 	"github.com/docshare/api/internal/middleware"
 	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
 	"github.com/docshare/api/pkg/utils"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ActivitiesHandler struct {
@@ -19,12 +24,31 @@ func NewActivitiesHandler(db *gorm.DB) *ActivitiesHandler {
 func (h *ActivitiesHandler) List(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
+	db := h.DB.WithContext(c.UserContext())
+
 	p := utils.ParsePagination(c)
+	order := utils.ParseTimeOrder(c)
+
+	if utils.WantsCursor(c) {
+		activities, nextCursor, err := findCreatedAtKeyset(c,
+			db.Preload("Actor").Where("user_id = ?", currentUser.ID),
+			order, p.Limit,
+			func(a models.Activity) (time.Time, uuid.UUID) { return a.CreatedAt, a.ID },
+		)
+		if err == utils.ErrInvalidCursor {
+			return utils.Fail(c, errInvalidCursor)
+		}
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed listing activities")
+		}
+		localizeActivities(activities, requestLocale(c, currentUser))
+		return utils.CursorPaginated(c, activities, p.Limit, nextCursor)
+	}
 
-	query := h.DB.Model(&models.Activity{}).Where("user_id = ?", currentUser.ID)
+	query := db.Model(&models.Activity{}).Where("user_id = ?", currentUser.ID)
 
 	var total int64
 	if err := query.Count(&total).Error; err != nil {
@@ -33,19 +57,26 @@ func (h *ActivitiesHandler) List(c *fiber.Ctx) error {
 
 	var activities []models.Activity
 	if err := utils.ApplyPagination(
-		h.DB.Preload("Actor").Where("user_id = ?", currentUser.ID).Order("created_at DESC"),
+		db.Preload("Actor").Where("user_id = ?", currentUser.ID).Order("created_at "+order),
 		p,
 	).Find(&activities).Error; err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed listing activities")
 	}
+	localizeActivities(activities, requestLocale(c, currentUser))
 
 	return utils.Paginated(c, activities, p.Page, p.Limit, total)
 }
 
+func localizeActivities(activities []models.Activity, locale string) {
+	for i := range activities {
+		services.LocalizeActivity(&activities[i], locale)
+	}
+}
+
 func (h *ActivitiesHandler) UnreadCount(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var count int64
@@ -61,7 +92,7 @@ func (h *ActivitiesHandler) UnreadCount(c *fiber.Ctx) error {
 func (h *ActivitiesHandler) MarkRead(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	activityID, err := parseUUID(c.Params("id"))
@@ -86,7 +117,7 @@ func (h *ActivitiesHandler) MarkRead(c *fiber.Ctx) error {
 func (h *ActivitiesHandler) MarkAllRead(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	if err := h.DB.Model(&models.Activity{}).
@@ -97,3 +128,109 @@ func (h *ActivitiesHandler) MarkAllRead(c *fiber.Ctx) error {
 
 	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "all marked as read"})
 }
+
+// ListMutes returns the files the current user has muted.
+func (h *ActivitiesHandler) ListMutes(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	db := h.DB.WithContext(c.UserContext())
+	p := utils.ParsePagination(c)
+
+	query := db.Model(&models.ActivityMute{}).Where("user_id = ?", currentUser.ID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting muted files")
+	}
+
+	var mutes []models.ActivityMute
+	if err := utils.ApplyPagination(
+		db.Preload("File").Where("user_id = ?", currentUser.ID).Order("created_at DESC"),
+		p,
+	).Find(&mutes).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing muted files")
+	}
+
+	return utils.Paginated(c, mutes, p.Page, p.Limit, total)
+}
+
+type notificationPreference struct {
+	Action  string `json:"action"`
+	Enabled bool   `json:"enabled"`
+}
+
+// GetPreferences lists every action that can be turned off, with whether
+// the current user has it on.
+func (h *ActivitiesHandler) GetPreferences(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	prefs, err := h.loadPreferences(c, currentUser.ID)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading notification preferences")
+	}
+	return utils.Success(c, fiber.StatusOK, prefs)
+}
+
+type updatePreferencesRequest struct {
+	Preferences map[string]bool `json:"preferences"`
+}
+
+// UpdatePreferences turns actions on or off. Actions left out of the
+// request keep their setting.
+func (h *ActivitiesHandler) UpdatePreferences(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	var req updatePreferencesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	if len(req.Preferences) == 0 {
+		return utils.Error(c, fiber.StatusBadRequest, "preferences are required")
+	}
+	rows := make([]models.NotificationPreference, 0, len(req.Preferences))
+	for action, enabled := range req.Preferences {
+		if !services.IsNotificationAction(action) {
+			return utils.Error(c, fiber.StatusBadRequest, "unknown notification action: "+action)
+		}
+		rows = append(rows, models.NotificationPreference{UserID: currentUser.ID, Action: action, Enabled: enabled})
+	}
+
+	if err := h.DB.WithContext(c.UserContext()).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "action"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled", "updated_at"}),
+	}).Create(&rows).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed saving notification preferences")
+	}
+
+	prefs, err := h.loadPreferences(c, currentUser.ID)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading notification preferences")
+	}
+	return utils.Success(c, fiber.StatusOK, prefs)
+}
+
+func (h *ActivitiesHandler) loadPreferences(c *fiber.Ctx, userID uuid.UUID) ([]notificationPreference, error) {
+	var stored []models.NotificationPreference
+	if err := h.DB.WithContext(c.UserContext()).Where("user_id = ?", userID).Find(&stored).Error; err != nil {
+		return nil, err
+	}
+	enabled := make(map[string]bool, len(stored))
+	for _, p := range stored {
+		enabled[p.Action] = p.Enabled
+	}
+
+	prefs := make([]notificationPreference, len(services.NotificationActions))
+	for i, action := range services.NotificationActions {
+		on, ok := enabled[action]
+		prefs[i] = notificationPreference{Action: action, Enabled: !ok || on}
+	}
+	return prefs, nil
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestActivitiesLocalization(t *testing.T) {
+	env := setupTestEnv(t)
+	user, token := createTestUser(t, env.db, "activities-i18n-user@test.com", "password123", models.UserRoleUser)
+	actor, _ := createTestUser(t, env.db, "activities-i18n-actor@test.com", "password123", models.UserRoleUser)
+
+	keyed := models.Activity{
+		UserID:        user.ID,
+		ActorID:       actor.ID,
+		Action:        "share.create",
+		ResourceType:  "file",
+		ResourceName:  "plan.pdf",
+		Message:       `Old Name shared "plan.pdf" with you`,
+		MessageKey:    "activity.share.with_you",
+		MessageParams: map[string]string{"actor": "Old Name", "name": "plan.pdf"},
+	}
+	if err := env.db.Create(&keyed).Error; err != nil {
+		t.Fatalf("failed creating activity: %v", err)
+	}
+
+	firstMessage := func(t *testing.T, path string, headers map[string]string) (string, string) {
+		t.Helper()
+		resp := performRequest(t, env.app, http.MethodGet, path, nil, headers)
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		// Updating the locale below records its own account activity
+		// asynchronously, so look for the share rather than counting.
+		for _, item := range body["data"].([]any) {
+			if activity := item.(map[string]any); activity["id"] == keyed.ID.String() {
+				return activity["message"].(string), resp.Header.Get("Content-Language")
+			}
+		}
+		t.Fatalf("expected the share activity in %v", body["data"])
+		return "", ""
+	}
+
+	t.Run("defaults to English with the actor's current name", func(t *testing.T) {
+		msg, lang := firstMessage(t, "/api/activities/", authHeaders(token))
+		if msg != `Test User shared "plan.pdf" with you` || lang != "en" {
+			t.Fatalf("got %q (%s)", msg, lang)
+		}
+	})
+
+	t.Run("follows Accept-Language", func(t *testing.T) {
+		headers := authHeaders(token)
+		headers["Accept-Language"] = "es-MX,es;q=0.9"
+		msg, lang := firstMessage(t, "/api/activities/", headers)
+		if msg != "Test User compartió «plan.pdf» contigo" || lang != "es" {
+			t.Fatalf("got %q (%s)", msg, lang)
+		}
+	})
+
+	t.Run("saved preference beats Accept-Language", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/auth/me", map[string]any{"locale": "fr-FR"}, authHeaders(token))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if body["data"].(map[string]any)["locale"] != "fr" {
+			t.Fatalf("expected locale fr, got %v", body["data"].(map[string]any)["locale"])
+		}
+
+		headers := authHeaders(token)
+		headers["Accept-Language"] = "es"
+		msg, _ := firstMessage(t, "/api/activities/", headers)
+		if msg != "Test User a partagé « plan.pdf » avec vous" {
+			t.Fatalf("got %q", msg)
+		}
+	})
+
+	t.Run("lang query overrides the preference", func(t *testing.T) {
+		msg, lang := firstMessage(t, "/api/activities/?lang=de", authHeaders(token))
+		if msg != "Test User hat „plan.pdf“ mit Ihnen geteilt" || lang != "de" {
+			t.Fatalf("got %q (%s)", msg, lang)
+		}
+	})
+
+	t.Run("cursor pages are localized too", func(t *testing.T) {
+		msg, _ := firstMessage(t, "/api/activities/?lang=de&cursor=", authHeaders(token))
+		if msg != "Test User hat „plan.pdf“ mit Ihnen geteilt" {
+			t.Fatalf("got %q", msg)
+		}
+	})
+
+	t.Run("rejects unsupported locale preference", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/auth/me", map[string]any{"locale": "tlh"}, authHeaders(token))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestActivityMutesAndPreferences(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "mute-owner@test.com", "password123", models.UserRoleUser)
+	_, otherToken := createTestUser(t, env.db, "mute-other@test.com", "password123", models.UserRoleUser)
+
+	folder := models.File{Name: "Team", IsDirectory: true, OwnerID: owner.ID}
+	if err := env.db.Create(&folder).Error; err != nil {
+		t.Fatalf("failed creating folder: %v", err)
+	}
+	mutePath := "/api/files/" + folder.ID.String() + "/mute"
+
+	t.Run("mute requires access to the file", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodPost, mutePath, nil, authHeaders(otherToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("mute is idempotent and listed", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			resp := performRequest(t, env.app, http.MethodPost, mutePath, nil, authHeaders(ownerToken))
+			assertStatus(t, resp, http.StatusOK)
+		}
+		var count int64
+		env.db.Model(&models.ActivityMute{}).Where("user_id = ?", owner.ID).Count(&count)
+		if count != 1 {
+			t.Fatalf("expected 1 mute, got %d", count)
+		}
+
+		resp := performRequest(t, env.app, http.MethodGet, "/api/activities/mutes", nil, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		mutes := body["data"].([]any)
+		if len(mutes) != 1 || mutes[0].(map[string]any)["fileID"] != folder.ID.String() {
+			t.Fatalf("expected the muted folder to be listed, got %v", mutes)
+		}
+	})
+
+	t.Run("unmute removes the mute", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodDelete, mutePath, nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performRequest(t, env.app, http.MethodDelete, mutePath, nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusNotFound)
+
+		resp = performRequest(t, env.app, http.MethodPost, mutePath, nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+	})
+
+	t.Run("preferences default to on and can be turned off", func(t *testing.T) {
+		enabled := func(body map[string]any, action string) bool {
+			for _, p := range body["data"].([]any) {
+				pref := p.(map[string]any)
+				if pref["action"] == action {
+					return pref["enabled"].(bool)
+				}
+			}
+			t.Fatalf("action %s missing from preferences", action)
+			return false
+		}
+
+		resp := performRequest(t, env.app, http.MethodGet, "/api/activities/preferences", nil, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if !enabled(body, "file.download") {
+			t.Fatal("expected file.download to default to on")
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPut, "/api/activities/preferences",
+			map[string]any{"preferences": map[string]bool{"file.download": false}}, authHeaders(ownerToken))
+		body = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if enabled(body, "file.download") || !enabled(body, "file.upload") {
+			t.Fatalf("expected only file.download off, got %v", body["data"])
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPut, "/api/activities/preferences",
+			map[string]any{"preferences": map[string]bool{"file.download": true}}, authHeaders(ownerToken))
+		body = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if !enabled(body, "file.download") {
+			t.Fatal("expected file.download back on")
+		}
+	})
+
+	t.Run("preferences reject unknown actions", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/activities/preferences",
+			map[string]any{"preferences": map[string]bool{"auth.new_device": false}}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestAdminSubRoles(t *testing.T) {
+	env := setupTestEnv(t)
+	admin, adminToken := createTestUser(t, env.db, "rbac-admin@test.com", "password123", models.UserRoleAdmin)
+	_, auditorToken := createTestUser(t, env.db, "rbac-auditor@test.com", "password123", models.UserRoleAuditor)
+	_, managerToken := createTestUser(t, env.db, "rbac-manager@test.com", "password123", models.UserRoleUserManager)
+	_, operatorToken := createTestUser(t, env.db, "rbac-operator@test.com", "password123", models.UserRoleStorageOperator)
+	_, supportToken := createTestUser(t, env.db, "rbac-support@test.com", "password123", models.UserRoleSupport)
+	member, memberToken := createTestUser(t, env.db, "rbac-member@test.com", "password123", models.UserRoleUser)
+	env.db.Create(&models.AuditLog{UserID: &member.ID, Action: "file.upload", ResourceType: "file", IPAddress: "127.0.0.1"})
+
+	cases := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		want   int
+	}{
+		{"auditor reads the audit log", auditorToken, http.MethodGet, "/api/admin/audit-log", http.StatusOK},
+		{"auditor reads the audit retention", auditorToken, http.MethodGet, "/api/admin/audit-log/retention", http.StatusOK},
+		{"auditor lists users", auditorToken, http.MethodGet, "/api/users", http.StatusOK},
+		{"auditor cannot delete users", auditorToken, http.MethodDelete, "/api/users/" + member.ID.String(), http.StatusForbidden},
+		{"auditor cannot read settings", auditorToken, http.MethodGet, "/api/admin/settings", http.StatusForbidden},
+		{"auditor cannot reconcile storage", auditorToken, http.MethodGet, "/api/admin/storage/reconcile", http.StatusForbidden},
+		{"user manager cannot read the audit log", managerToken, http.MethodGet, "/api/admin/audit-log", http.StatusForbidden},
+		{"storage operator lists jobs", operatorToken, http.MethodGet, "/api/jobs", http.StatusOK},
+		{"storage operator lists reconciles", operatorToken, http.MethodGet, "/api/admin/storage/reconcile", http.StatusOK},
+		{"storage operator cannot list users", operatorToken, http.MethodGet, "/api/users", http.StatusForbidden},
+		{"support lists reports", supportToken, http.MethodGet, "/api/admin/reports", http.StatusOK},
+		{"support cannot suspend", supportToken, http.MethodPost, "/api/users/" + member.ID.String() + "/suspend", http.StatusForbidden},
+		{"members stay out", memberToken, http.MethodGet, "/api/admin/audit-log", http.StatusForbidden},
+		{"members cannot read the audit retention", memberToken, http.MethodGet, "/api/admin/audit-log/retention", http.StatusForbidden},
+		{"admins read the audit log", adminToken, http.MethodGet, "/api/admin/audit-log?action=file.upload", http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assertStatus(t, performRequest(t, env.app, tc.method, tc.path, nil, authHeaders(tc.token)), tc.want)
+		})
+	}
+
+	t.Run("tells clients what the role allows", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/auth/me", nil, authHeaders(auditorToken))
+		assertStatus(t, resp, http.StatusOK)
+		permissions := decodeJSONMap(t, resp)["data"].(map[string]any)["adminPermissions"].([]any)
+		if len(permissions) != 2 || permissions[0] != "audit.read" {
+			t.Fatalf("unexpected permissions %v", permissions)
+		}
+	})
+
+	t.Run("filters the audit log", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/admin/audit-log?userID="+member.ID.String(), nil, authHeaders(auditorToken))
+		assertStatus(t, resp, http.StatusOK)
+		logs := decodeJSONMap(t, resp)["data"].([]any)
+		if len(logs) != 1 || logs[0].(map[string]any)["action"] != "file.upload" {
+			t.Fatalf("expected the member's entry, got %v", logs)
+		}
+		assertStatus(t, performRequest(t, env.app, http.MethodGet, "/api/admin/audit-log?userID=nope", nil, authHeaders(auditorToken)), http.StatusBadRequest)
+	})
+
+	t.Run("user managers cannot touch roles or admins", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/users/"+member.ID.String(), map[string]any{"role": "admin"}, authHeaders(managerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+		if code := decodeJSONMap(t, resp)["code"]; code != "role_change_forbidden" {
+			t.Fatalf("expected role_change_forbidden, got %v", code)
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/users/"+admin.ID.String()+"/suspend", nil, authHeaders(managerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+		if code := decodeJSONMap(t, resp)["code"]; code != "administrative_account" {
+			t.Fatalf("expected administrative_account, got %v", code)
+		}
+		resp = performJSONRequest(t, env.app, http.MethodPut, "/api/users/"+admin.ID.String(), map[string]any{"firstName": "Mallory"}, authHeaders(managerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+		if code := decodeJSONMap(t, resp)["code"]; code != "administrative_account" {
+			t.Fatalf("expected administrative_account, got %v", code)
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/users/"+member.ID.String()+"/suspend", nil, authHeaders(managerToken))
+		assertStatus(t, resp, http.StatusOK)
+	})
+
+	t.Run("admins grant sub-roles", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/users/"+member.ID.String(), map[string]any{"role": "auditor"}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		if role := decodeJSONMap(t, resp)["data"].(map[string]any)["role"]; role != "auditor" {
+			t.Fatalf("expected auditor, got %v", role)
+		}
+		resp = performJSONRequest(t, env.app, http.MethodPut, "/api/users/"+member.ID.String(), map[string]any{"role": "superuser"}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+}
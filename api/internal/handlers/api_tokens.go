@@ -29,6 +29,27 @@ type createTokenRequest struct {
 	ExpiresIn *string `json:"expiresIn"` // "30d", "90d", "365d", "never"
 }
 
+// parseCredentialExpiry turns an expiresIn of "30d", "90d", "365d" or
+// "never" into an expiry time, nil when the credential never expires.
+func parseCredentialExpiry(expiresIn *string) (*time.Time, bool) {
+	if expiresIn == nil || *expiresIn == "never" {
+		return nil, true
+	}
+	var dur time.Duration
+	switch *expiresIn {
+	case "30d":
+		dur = 30 * 24 * time.Hour
+	case "90d":
+		dur = 90 * 24 * time.Hour
+	case "365d":
+		dur = 365 * 24 * time.Hour
+	default:
+		return nil, false
+	}
+	t := time.Now().Add(dur)
+	return &t, true
+}
+
 type createTokenResponse struct {
 	Token    string          `json:"token"`
 	APIToken models.APIToken `json:"apiToken"`
@@ -37,12 +58,12 @@ type createTokenResponse struct {
 func (h *APITokenHandler) Create(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var req createTokenRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	if req.Name == "" {
@@ -71,21 +92,9 @@ func (h *APITokenHandler) Create(c *fiber.Ctx) error {
 	hash := sha256.Sum256([]byte(rawToken))
 	tokenHash := hex.EncodeToString(hash[:])
 
-	var expiresAt *time.Time
-	if req.ExpiresIn != nil && *req.ExpiresIn != "never" {
-		var dur time.Duration
-		switch *req.ExpiresIn {
-		case "30d":
-			dur = 30 * 24 * time.Hour
-		case "90d":
-			dur = 90 * 24 * time.Hour
-		case "365d":
-			dur = 365 * 24 * time.Hour
-		default:
-			return utils.Error(c, fiber.StatusBadRequest, "expiresIn must be 30d, 90d, 365d, or never")
-		}
-		t := time.Now().Add(dur)
-		expiresAt = &t
+	expiresAt, ok := parseCredentialExpiry(req.ExpiresIn)
+	if !ok {
+		return utils.Error(c, fiber.StatusBadRequest, "expiresIn must be 30d, 90d, 365d, or never")
 	}
 
 	apiToken := models.APIToken{
@@ -129,7 +138,7 @@ func (h *APITokenHandler) Create(c *fiber.Ctx) error {
 func (h *APITokenHandler) List(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	p := utils.ParsePagination(c)
@@ -152,7 +161,7 @@ func (h *APITokenHandler) List(c *fiber.Ctx) error {
 func (h *APITokenHandler) Revoke(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	tokenID, err := parseUUID(c.Params("id"))
@@ -8,23 +8,121 @@ import (
 
 	"github.com/docshare/api/internal/middleware"
 	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
 	"github.com/docshare/api/pkg/utils"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type AuditHandler struct {
 	DB *gorm.DB
+	// Retention reports on how long audit rows are kept; nil reports
+	// retention as off.
+	Retention *services.AuditRetention
 }
 
 func NewAuditHandler(db *gorm.DB) *AuditHandler {
 	return &AuditHandler{DB: db}
 }
 
+// ListMyLog returns the current user's audit trail, newest first by
+// default, along with anonymous downloads of files they own. Supports
+// offset pagination or, with ?cursor=, keyset pagination.
+func (h *AuditHandler) ListMyLog(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	query := ownAuditLog(h.DB.WithContext(c.UserContext()).Model(&models.AuditLog{}), currentUser.ID)
+	if action := strings.TrimSpace(c.Query("action")); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	return h.list(c, query)
+}
+
+// ListAll is the audit trail of every user, for admins and auditors. It
+// filters by ?userID=, ?action=, ?resourceType= and ?resourceID=, and
+// paginates like ListMyLog.
+func (h *AuditHandler) ListAll(c *fiber.Ctx) error {
+	query := h.DB.WithContext(c.UserContext()).Model(&models.AuditLog{})
+	for param, column := range map[string]string{"userID": "user_id", "resourceID": "resource_id"} {
+		if raw := strings.TrimSpace(c.Query(param)); raw != "" {
+			id, err := parseUUID(raw)
+			if err != nil {
+				return utils.Error(c, fiber.StatusBadRequest, "invalid "+param)
+			}
+			query = query.Where(column+" = ?", id)
+		}
+	}
+	if action := strings.TrimSpace(c.Query("action")); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if resourceType := strings.TrimSpace(c.Query("resourceType")); resourceType != "" {
+		query = query.Where("resource_type = ?", resourceType)
+	}
+	return h.list(c, query)
+}
+
+// RetentionStatus reports the audit retention settings, how many rows are
+// past it and the outcome of the latest purge.
+func (h *AuditHandler) RetentionStatus(c *fiber.Ctx) error {
+	if h.Retention == nil {
+		return utils.Success(c, fiber.StatusOK, services.AuditRetentionStatus{})
+	}
+	status, err := h.Retention.Status(c.UserContext())
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading audit retention status")
+	}
+	return utils.Success(c, fiber.StatusOK, status)
+}
+
+// ownAuditLog limits query to the entries of userID and the anonymous
+// downloads of their files, which have no user of their own.
+func ownAuditLog(query *gorm.DB, userID uuid.UUID) *gorm.DB {
+	return query.Where(
+		"user_id = ? OR (user_id IS NULL AND action = ? AND resource_id IN (?))",
+		userID, services.AuditActionPublicDownload,
+		query.Session(&gorm.Session{NewDB: true}).Model(&models.File{}).Select("id").Where("owner_id = ?", userID),
+	)
+}
+
+func (h *AuditHandler) list(c *fiber.Ctx, query *gorm.DB) error {
+	p := utils.ParsePagination(c)
+	order := utils.ParseTimeOrder(c)
+	query = query.Session(&gorm.Session{})
+
+	if utils.WantsCursor(c) {
+		logs, nextCursor, err := findCreatedAtKeyset(c, query, order, p.Limit,
+			func(l models.AuditLog) (time.Time, uuid.UUID) { return l.CreatedAt, l.ID },
+		)
+		if err == utils.ErrInvalidCursor {
+			return utils.Fail(c, errInvalidCursor)
+		}
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed loading audit logs")
+		}
+		return utils.CursorPaginated(c, logs, p.Limit, nextCursor)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting audit logs")
+	}
+
+	var logs []models.AuditLog
+	if err := utils.ApplyPagination(query.Order("created_at "+order), p).Find(&logs).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading audit logs")
+	}
+
+	return utils.Paginated(c, logs, p.Page, p.Limit, total)
+}
+
 func (h *AuditHandler) ExportMyLog(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	format := strings.ToLower(strings.TrimSpace(c.Query("format", "csv")))
@@ -33,7 +131,7 @@ func (h *AuditHandler) ExportMyLog(c *fiber.Ctx) error {
 	}
 
 	var logs []models.AuditLog
-	if err := h.DB.Where("user_id = ?", currentUser.ID).
+	if err := ownAuditLog(h.DB, currentUser.ID).
 		Order("created_at DESC").
 		Limit(10000).
 		Find(&logs).Error; err != nil {
@@ -4,6 +4,7 @@ import (
 	"net/mail"
 	"strings"
 
+	"github.com/docshare/api/internal/i18n"
 	"github.com/docshare/api/internal/middleware"
 	"github.com/docshare/api/internal/models"
 	"github.com/docshare/api/internal/services"
@@ -14,12 +15,22 @@ import (
 )
 
 type AuthHandler struct {
-	DB    *gorm.DB
-	Audit *services.AuditService
+	DB       *gorm.DB
+	Audit    *services.AuditService
+	Sessions *services.SessionService
+	// Settings, when set, decides whether self-service registration is
+	// open, invite-only or closed.
+	Settings *services.SettingsService
+	// Avatars stores uploaded profile pictures; without it only an
+	// avatarURL set through UpdateMe is available.
+	Avatars *services.AvatarService
+	// Terms, when set, lets Me report the terms the user has yet to
+	// accept.
+	Terms *services.TermsService
 }
 
-func NewAuthHandler(db *gorm.DB, audit *services.AuditService) *AuthHandler {
-	return &AuthHandler{DB: db, Audit: audit}
+func NewAuthHandler(db *gorm.DB, audit *services.AuditService, sessions *services.SessionService) *AuthHandler {
+	return &AuthHandler{DB: db, Audit: audit, Sessions: sessions}
 }
 
 type registerRequest struct {
@@ -27,12 +38,24 @@ type registerRequest struct {
 	Password  string `json:"password"`
 	FirstName string `json:"firstName"`
 	LastName  string `json:"lastName"`
+	// InvitationToken is the token from a share invitation email. It proves
+	// the user can read mail sent to Email, so the shares waiting for that
+	// address are handed to the new account.
+	InvitationToken string `json:"invitationToken"`
 }
 
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
+	mode := services.RegistrationOpen
+	if h.Settings != nil {
+		mode = h.Settings.RegistrationMode(c.Context())
+	}
+	if mode == services.RegistrationClosed {
+		return utils.Fail(c, errRegistrationClosed)
+	}
+
 	var req registerRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
@@ -51,7 +74,7 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 
 	var existing models.User
 	if err := h.DB.First(&existing, "email = ?", req.Email).Error; err == nil {
-		return utils.Error(c, fiber.StatusConflict, "email already registered")
+		return utils.Fail(c, errEmailRegistered)
 	} else if err != gorm.ErrRecordNotFound {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed checking existing user")
 	}
@@ -62,21 +85,45 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	}
 
 	user := models.User{
-		Email:        req.Email,
-		PasswordHash: passwordHash,
-		FirstName:    req.FirstName,
-		LastName:     req.LastName,
-		Role:         models.UserRoleUser,
+		Email:          req.Email,
+		PasswordHash:   passwordHash,
+		FirstName:      req.FirstName,
+		LastName:       req.LastName,
+		Role:           models.UserRoleUser,
+		OrganizationID: middleware.GetOrganizationID(c),
+	}
+
+	invited := false
+	if req.InvitationToken != "" {
+		invitation, err := services.LookupShareInvitation(c.Context(), h.DB, req.InvitationToken)
+		invited = err == nil && strings.EqualFold(invitation.Email, user.Email) &&
+			services.SameOrganization(invitation.OrganizationID, user.OrganizationID)
+	}
+	if mode == services.RegistrationInviteOnly && !invited {
+		return utils.Fail(c, errRegistrationInviteOnly)
 	}
+	user.IsEmailVerified = invited
 
-	if err := h.DB.Create(&user).Error; err != nil {
+	claimed := 0
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if !invited {
+			return nil
+		}
+		var err error
+		claimed, err = services.ClaimShareInvitations(tx, &user, c.IP())
+		return err
+	}); err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed creating user")
 	}
 
 	logger.Info("user_registered", map[string]interface{}{
-		"user_id": user.ID.String(),
-		"email":   user.Email,
-		"role":    string(user.Role),
+		"user_id":        user.ID.String(),
+		"email":          user.Email,
+		"role":           string(user.Role),
+		"shares_claimed": claimed,
 	})
 
 	h.Audit.LogAsync(services.AuditEntry{
@@ -91,7 +138,7 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		RequestID: getRequestID(c),
 	})
 
-	token, err := utils.GenerateToken(&user)
+	token, err := issueToken(c, h.Sessions, &user, "register")
 	if err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed generating token")
 	}
@@ -107,7 +154,7 @@ type loginRequest struct {
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	var req loginRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
 
@@ -116,12 +163,12 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	}
 
 	var user models.User
-	if err := h.DB.First(&user, "email = ?", req.Email).Error; err != nil {
+	if err := h.DB.Scopes(services.OrganizationScope("users", middleware.GetOrganizationID(c))).First(&user, "email = ?", req.Email).Error; err != nil {
 		logger.Warn("login_failed_user_not_found", map[string]interface{}{
 			"email": req.Email,
 			"ip":    c.IP(),
 		})
-		return utils.Error(c, fiber.StatusUnauthorized, "invalid credentials")
+		return utils.Fail(c, errInvalidCredentials)
 	}
 
 	if !utils.CheckPassword(req.Password, user.PasswordHash) {
@@ -130,7 +177,10 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 			"email":   req.Email,
 			"ip":      c.IP(),
 		})
-		return utils.Error(c, fiber.StatusUnauthorized, "invalid credentials")
+		return utils.Fail(c, errInvalidCredentials)
+	}
+	if user.IsSuspended() {
+		return utils.Fail(c, middleware.ErrAccountSuspended)
 	}
 
 	logger.Info("user_login", map[string]interface{}{
@@ -177,7 +227,7 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		RequestID: getRequestID(c),
 	})
 
-	token, err := utils.GenerateToken(&user)
+	token, err := issueToken(c, h.Sessions, &user, "password")
 	if err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed generating token")
 	}
@@ -185,12 +235,44 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	return utils.Success(c, fiber.StatusOK, fiber.Map{"token": token, "user": user})
 }
 
+// meResponse is the current user with the MFA policy that applies to them,
+// so clients can prompt for enrollment before the grace period runs out.
+type meResponse struct {
+	*models.User
+	MFAPolicy *services.MFAPolicyStatus `json:"mfaPolicy,omitempty"`
+	// AdminPermissions tells clients which admin pages to offer.
+	AdminPermissions []services.AdminPermission `json:"adminPermissions,omitempty"`
+	// PendingTerms lists the terms versions in force the user has not
+	// accepted, without their body.
+	PendingTerms []models.TermsVersion `json:"pendingTerms"`
+	// TermsEnforced tells clients whether the rest of the API is closed
+	// until PendingTerms are accepted.
+	TermsEnforced bool `json:"termsEnforced"`
+}
+
 func (h *AuthHandler) Me(c *fiber.Ctx) error {
 	user := middleware.GetCurrentUser(c)
 	if user == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
+	}
+	resp := meResponse{
+		User:             user,
+		MFAPolicy:        middleware.GetMFAPolicyStatus(c),
+		AdminPermissions: services.AdminPermissions(user.Role),
+		PendingTerms:     []models.TermsVersion{},
+	}
+	if h.Terms != nil {
+		pending, err := h.Terms.Pending(c.Context(), user.ID)
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed loading pending terms")
+		}
+		for i := range pending {
+			pending[i].Body = ""
+		}
+		resp.PendingTerms = pending
+		resp.TermsEnforced = h.Terms.Enforced(c.Context())
 	}
-	return utils.Success(c, fiber.StatusOK, user)
+	return utils.Success(c, fiber.StatusOK, resp)
 }
 
 type updateMeRequest struct {
@@ -198,17 +280,20 @@ type updateMeRequest struct {
 	LastName  *string `json:"lastName"`
 	AvatarURL *string `json:"avatarURL"`
 	Theme     *string `json:"theme"`
+	Locale    *string `json:"locale"`
+	// HideFromSearch keeps the user out of other users' search results.
+	HideFromSearch *bool `json:"hideFromSearch"`
 }
 
 func (h *AuthHandler) UpdateMe(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var req updateMeRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	updates := map[string]interface{}{}
@@ -233,6 +318,7 @@ func (h *AuthHandler) UpdateMe(c *fiber.Ctx) error {
 		} else {
 			updates["avatar_url"] = trimmed
 		}
+		updates["avatar_version"] = ""
 	}
 	if req.Theme != nil {
 		value := strings.TrimSpace(*req.Theme)
@@ -241,6 +327,21 @@ func (h *AuthHandler) UpdateMe(c *fiber.Ctx) error {
 		}
 		updates["theme"] = value
 	}
+	if req.Locale != nil {
+		if strings.TrimSpace(*req.Locale) == "" {
+			updates["locale"] = ""
+		} else {
+			locale, ok := i18n.Supported(*req.Locale)
+			if !ok {
+				return utils.Error(c, fiber.StatusBadRequest, "locale must be one of "+strings.Join(i18n.Locales(), ", "))
+			}
+			updates["locale"] = locale
+		}
+	}
+
+	if req.HideFromSearch != nil {
+		updates["hide_from_search"] = *req.HideFromSearch
+	}
 
 	if len(updates) == 0 {
 		return utils.Error(c, fiber.StatusBadRequest, "no valid fields to update")
@@ -249,6 +350,10 @@ func (h *AuthHandler) UpdateMe(c *fiber.Ctx) error {
 	if err := h.DB.Model(&models.User{}).Where("id = ?", currentUser.ID).Updates(updates).Error; err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed updating user")
 	}
+	// A URL set by hand replaces an uploaded avatar.
+	if _, ok := updates["avatar_version"]; ok && currentUser.AvatarVersion != "" && h.Avatars != nil {
+		h.Avatars.Discard(c.UserContext(), currentUser.ID, currentUser.AvatarVersion)
+	}
 
 	var updated models.User
 	if err := h.DB.First(&updated, "id = ?", currentUser.ID).Error; err != nil {
@@ -275,12 +380,12 @@ type changePasswordRequest struct {
 func (h *AuthHandler) ChangePassword(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var req changePasswordRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	if len(req.NewPassword) < 8 {
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strconv"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// avatarCacheControl lets browsers and proxies keep an avatar image for
+// good: a new picture is served under a new URL.
+const avatarCacheControl = "public, max-age=31536000, immutable"
+
+var errAvatarsUnavailable = utils.NewError(fiber.StatusServiceUnavailable, "avatars_unavailable", "avatar uploads are not available")
+
+// avatarSource returns the uploaded image: the "file" part of a multipart
+// form, or else the raw request body.
+func avatarSource(c *fiber.Ctx) (io.Reader, error) {
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	if boundary == "" {
+		return requestBodyStream(c), nil
+	}
+	form := multipart.NewReader(requestBodyStream(c), boundary)
+	for {
+		part, err := form.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+	}
+}
+
+// UploadAvatar replaces the current user's profile picture.
+func (h *AuthHandler) UploadAvatar(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	if h.Avatars == nil {
+		return utils.Fail(c, errAvatarsUnavailable)
+	}
+
+	source, err := avatarSource(c)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, "file is required")
+	}
+	user := *currentUser
+	if err := h.Avatars.Set(c.UserContext(), &user, source); err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "avatar_upload_failed", "failed saving avatar")))
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "user.avatar_update",
+		ResourceType: "user",
+		ResourceID:   &currentUser.ID,
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusOK, user)
+}
+
+// DeleteAvatar removes the current user's profile picture.
+func (h *AuthHandler) DeleteAvatar(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	if h.Avatars == nil {
+		return utils.Fail(c, errAvatarsUnavailable)
+	}
+
+	user := *currentUser
+	if err := h.Avatars.Remove(c.UserContext(), &user); err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed removing avatar")
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "user.avatar_delete",
+		ResourceType: "user",
+		ResourceID:   &currentUser.ID,
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusOK, user)
+}
+
+// Avatar serves an avatar image. The URL names the version, so the response
+// never changes and may be cached publicly.
+func (h *AuthHandler) Avatar(c *fiber.Ctx) error {
+	if h.Avatars == nil {
+		return utils.Fail(c, errAvatarsUnavailable)
+	}
+	userID, err := uuid.Parse(c.Params("userID"))
+	if err != nil {
+		return utils.Fail(c, errAvatarNotFound)
+	}
+	size, err := strconv.Atoi(c.Params("size"))
+	if err != nil {
+		return utils.Fail(c, errAvatarNotFound)
+	}
+	version := c.Params("version")
+	etag := fmt.Sprintf(`"%s-%d"`, version, size)
+
+	if utils.NotModified(c, etag) {
+		c.Set(fiber.HeaderCacheControl, avatarCacheControl)
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	// Errors must not be cached like the image would be.
+	c.Response().Header.Del(fiber.HeaderETag)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	image, err := h.Avatars.Open(c.UserContext(), userID, version, size)
+	if err != nil {
+		if errors.Is(err, services.ErrAvatarNotFound) {
+			return utils.Fail(c, errAvatarNotFound)
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading avatar")
+	}
+	defer image.Close()
+
+	data, err := io.ReadAll(image)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading avatar")
+	}
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, avatarCacheControl)
+	c.Set(fiber.HeaderContentType, "image/jpeg")
+	return c.Send(data)
+}
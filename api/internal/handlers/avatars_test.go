@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestAvatars(t *testing.T) {
+	env := setupTestEnv(t)
+	_, token := createTestUser(t, env.db, "avatar-owner@test.com", "password123", models.UserRoleUser)
+	_, searcherToken := createTestUser(t, env.db, "avatar-searcher@test.com", "password123", models.UserRoleUser)
+
+	picture := func(width, height int, fill color.Color) []byte {
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for x := 0; x < width; x++ {
+			for y := 0; y < height; y++ {
+				img.Set(x, y, fill)
+			}
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	upload := func(data []byte) *http.Response {
+		headers := authHeaders(token)
+		headers["Content-Type"] = "image/png"
+		return performRequest(t, env.app, http.MethodPut, "/api/auth/me/avatar", bytes.NewReader(data), headers)
+	}
+
+	resp := upload(picture(300, 200, color.RGBA{R: 200, A: 255}))
+	assertStatus(t, resp, http.StatusOK)
+	avatarURL, _ := decodeJSONMap(t, resp)["data"].(map[string]any)["avatarURL"].(string)
+	if !strings.HasPrefix(avatarURL, "/api/public/avatars/") || !strings.HasSuffix(avatarURL, "/128") {
+		t.Fatalf("unexpected avatar URL %q", avatarURL)
+	}
+
+	resp = performRequest(t, env.app, http.MethodGet, avatarURL, nil, nil)
+	assertStatus(t, resp, http.StatusOK)
+	if got := resp.Header.Get("Cache-Control"); !strings.Contains(got, "public") || !strings.Contains(got, "immutable") {
+		t.Fatalf("expected a publicly cacheable avatar, got %q", got)
+	}
+	img, err := jpeg.Decode(resp.Body)
+	if err != nil {
+		t.Fatalf("expected a JPEG avatar: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 128 || bounds.Dy() != 128 {
+		t.Fatalf("expected a 128x128 avatar, got %v", bounds)
+	}
+	etag := resp.Header.Get("ETag")
+	assertStatus(t, performRequest(t, env.app, http.MethodGet, avatarURL, nil, map[string]string{"If-None-Match": etag}), http.StatusNotModified)
+
+	small := strings.TrimSuffix(avatarURL, "128") + "32"
+	assertStatus(t, performRequest(t, env.app, http.MethodGet, small, nil, nil), http.StatusOK)
+	assertStatus(t, performRequest(t, env.app, http.MethodGet, strings.TrimSuffix(avatarURL, "128")+"100", nil, nil), http.StatusNotFound)
+
+	resp = performRequest(t, env.app, http.MethodGet, "/api/users/search?search=avatar-owner", nil, authHeaders(searcherToken))
+	assertStatus(t, resp, http.StatusOK)
+	found := decodeJSONMap(t, resp)["data"].([]any)
+	if len(found) != 1 || found[0].(map[string]any)["avatarURL"] != avatarURL {
+		t.Fatalf("expected search results to carry the avatar URL, got %v", found)
+	}
+
+	resp = upload(picture(64, 64, color.RGBA{B: 200, A: 255}))
+	assertStatus(t, resp, http.StatusOK)
+	replaced := decodeJSONMap(t, resp)["data"].(map[string]any)["avatarURL"].(string)
+	if replaced == avatarURL {
+		t.Fatal("expected a new picture to get a new URL")
+	}
+	assertStatus(t, performRequest(t, env.app, http.MethodGet, avatarURL, nil, nil), http.StatusNotFound)
+
+	resp = upload([]byte("not an image at all"))
+	assertStatus(t, resp, http.StatusUnsupportedMediaType)
+	if code := decodeJSONMap(t, resp)["code"]; code != "avatar_invalid" {
+		t.Fatalf("expected avatar_invalid, got %v", code)
+	}
+
+	resp = performRequest(t, env.app, http.MethodDelete, "/api/auth/me/avatar", nil, authHeaders(token))
+	assertStatus(t, resp, http.StatusOK)
+	if _, ok := decodeJSONMap(t, resp)["data"].(map[string]any)["avatarURL"]; ok {
+		t.Fatal("expected the avatar URL to be cleared")
+	}
+	assertStatus(t, performRequest(t, env.app, http.MethodGet, replaced, nil, nil), http.StatusNotFound)
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ClassificationRulesHandler lets platform admins manage the rules checked
+// against every upload, and try them out before saving.
+type ClassificationRulesHandler struct {
+	DB         *gorm.DB
+	Classifier *services.Classifier
+	Audit      *services.AuditService
+}
+
+func NewClassificationRulesHandler(db *gorm.DB, classifier *services.Classifier, audit *services.AuditService) *ClassificationRulesHandler {
+	return &ClassificationRulesHandler{DB: db, Classifier: classifier, Audit: audit}
+}
+
+// classificationRuleRequest is the body of the rule endpoints. Omitted
+// fields are left unchanged on update.
+type classificationRuleRequest struct {
+	Name           *string      `json:"name"`
+	Description    *string      `json:"description"`
+	Priority       *int         `json:"priority"`
+	Enabled        *bool        `json:"enabled"`
+	Extensions     *[]string    `json:"extensions"`
+	MimeTypes      *[]string    `json:"mimeTypes"`
+	NamePattern    *string      `json:"namePattern"`
+	GroupIDs       *[]uuid.UUID `json:"groupIDs"`
+	Tags           *[]string    `json:"tags"`
+	FolderID       *string      `json:"folderID"`
+	RetentionClass *string      `json:"retentionClass"`
+	Scan           *bool        `json:"scan"`
+	Block          *bool        `json:"block"`
+}
+
+// apply copies the fields present in req onto rule. An empty folderID
+// clears the rule's folder.
+func (req *classificationRuleRequest) apply(rule *models.ClassificationRule) error {
+	if req.Name != nil {
+		rule.Name = *req.Name
+	}
+	if req.Description != nil {
+		rule.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Priority != nil {
+		rule.Priority = *req.Priority
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if req.Extensions != nil {
+		rule.Extensions = *req.Extensions
+	}
+	if req.MimeTypes != nil {
+		rule.MimeTypes = *req.MimeTypes
+	}
+	if req.NamePattern != nil {
+		rule.NamePattern = *req.NamePattern
+	}
+	if req.GroupIDs != nil {
+		rule.GroupIDs = *req.GroupIDs
+	}
+	if req.Tags != nil {
+		rule.Tags = *req.Tags
+	}
+	if req.FolderID != nil {
+		rule.FolderID = nil
+		if *req.FolderID != "" {
+			id, err := uuid.Parse(*req.FolderID)
+			if err != nil {
+				return errors.New("invalid folderID")
+			}
+			rule.FolderID = &id
+		}
+	}
+	if req.RetentionClass != nil {
+		rule.RetentionClass = *req.RetentionClass
+	}
+	if req.Scan != nil {
+		rule.Scan = *req.Scan
+	}
+	if req.Block != nil {
+		rule.Block = *req.Block
+	}
+	return nil
+}
+
+// List returns every rule in the order uploads are checked against them.
+func (h *ClassificationRulesHandler) List(c *fiber.Ctx) error {
+	rules, err := h.Classifier.Rules(c.Context())
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing classification rules")
+	}
+	return utils.Success(c, fiber.StatusOK, rules)
+}
+
+func (h *ClassificationRulesHandler) Create(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	var req classificationRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	rule := models.ClassificationRule{Priority: 100, Enabled: true, CreatedByID: currentUser.ID}
+	if apiErr := h.prepare(c, &req, &rule); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	if err := h.DB.Create(&rule).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed creating classification rule")
+	}
+	h.audit(c, currentUser, "admin.classification_rule_create", &rule)
+	return utils.Success(c, fiber.StatusCreated, rule)
+}
+
+func (h *ClassificationRulesHandler) Update(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	rule, apiErr := h.loadRule(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	var req classificationRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	if apiErr := h.prepare(c, &req, rule); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	if err := h.DB.Save(rule).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed updating classification rule")
+	}
+	h.audit(c, currentUser, "admin.classification_rule_update", rule)
+	return utils.Success(c, fiber.StatusOK, rule)
+}
+
+func (h *ClassificationRulesHandler) Delete(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	rule, apiErr := h.loadRule(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if err := h.DB.Delete(rule).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed deleting classification rule")
+	}
+	h.audit(c, currentUser, "admin.classification_rule_delete", rule)
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "classification rule deleted"})
+}
+
+// Simulate reports what the rules would do to an upload without changing
+// anything. With a draft rule in the body, only that rule is checked, so
+// admins can try a rule out before saving it; otherwise every enabled rule
+// is.
+func (h *ClassificationRulesHandler) Simulate(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	var req struct {
+		FileName   string                     `json:"fileName"`
+		MimeType   string                     `json:"mimeType"`
+		UploaderID *uuid.UUID                 `json:"uploaderID"`
+		ParentID   *uuid.UUID                 `json:"parentID"`
+		Rule       *classificationRuleRequest `json:"rule"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	req.FileName = strings.TrimSpace(req.FileName)
+	if req.FileName == "" {
+		return utils.Error(c, fiber.StatusBadRequest, "fileName is required")
+	}
+
+	uploader := currentUser
+	if req.UploaderID != nil {
+		var user models.User
+		if err := h.DB.Limit(1).Find(&user, "id = ?", *req.UploaderID).Error; err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed loading uploader")
+		}
+		if user.ID == uuid.Nil {
+			return utils.Fail(c, errUserNotFound)
+		}
+		uploader = &user
+	}
+	in := services.ClassificationInput{
+		FileName:       req.FileName,
+		MimeType:       req.MimeType,
+		UploaderID:     uploader.ID,
+		OrganizationID: uploader.OrganizationID,
+		ParentID:       req.ParentID,
+	}
+
+	var (
+		result *services.Classification
+		err    error
+	)
+	if req.Rule != nil {
+		draft := models.ClassificationRule{Priority: 100, Enabled: true}
+		if apiErr := h.prepare(c, req.Rule, &draft); apiErr != nil {
+			return utils.Fail(c, apiErr)
+		}
+		result, err = h.Classifier.Evaluate(c.Context(), in, []models.ClassificationRule{draft})
+	} else {
+		result, err = h.Classifier.Classify(c.Context(), in)
+	}
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed evaluating classification rules")
+	}
+	return utils.Success(c, fiber.StatusOK, result)
+}
+
+// prepare applies req to rule and validates the result.
+func (h *ClassificationRulesHandler) prepare(c *fiber.Ctx, req *classificationRuleRequest, rule *models.ClassificationRule) *utils.APIError {
+	if err := req.apply(rule); err != nil {
+		return errInvalidClassificationRule.WithMessage(err.Error())
+	}
+	if err := h.Classifier.Validate(c.Context(), rule); err != nil {
+		if errors.Is(err, services.ErrClassificationRuleInvalid) {
+			return errInvalidClassificationRule.WithMessage(err.Error())
+		}
+		return utils.NewError(fiber.StatusInternalServerError, "classification_rule_check_failed", "failed checking classification rule")
+	}
+	return nil
+}
+
+func (h *ClassificationRulesHandler) loadRule(c *fiber.Ctx) (*models.ClassificationRule, *utils.APIError) {
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return nil, errInvalidClassificationRuleID
+	}
+	var rule models.ClassificationRule
+	if err := h.DB.First(&rule, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errClassificationRuleNotFound
+		}
+		return nil, utils.NewError(fiber.StatusInternalServerError, "classification_rule_load_failed", "failed loading classification rule")
+	}
+	return &rule, nil
+}
+
+func (h *ClassificationRulesHandler) audit(c *fiber.Ctx, user *models.User, action string, rule *models.ClassificationRule) {
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &user.ID,
+		Action:       action,
+		ResourceType: "classification_rule",
+		ResourceID:   &rule.ID,
+		Details: map[string]interface{}{
+			"name":    rule.Name,
+			"enabled": rule.Enabled,
+			"block":   rule.Block,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+}
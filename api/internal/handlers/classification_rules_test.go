@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestClassificationRules(t *testing.T) {
+	env := setupTestEnv(t)
+	admin, adminToken := createTestUser(t, env.db, "rules-admin@test.com", "password123", models.UserRoleAdmin)
+	uploader, token := createTestUser(t, env.db, "rules-user@test.com", "password123", models.UserRoleUser)
+	_, userToken := createTestUser(t, env.db, "rules-other@test.com", "password123", models.UserRoleUser)
+	archive := models.File{Name: "Archive", IsDirectory: true, OwnerID: admin.ID}
+	env.db.Create(&archive)
+
+	expectCode := func(t *testing.T, resp *http.Response, status int, code string) {
+		t.Helper()
+		body := decodeJSONMap(t, resp)
+		if resp.StatusCode != status || body["code"] != code {
+			t.Fatalf("expected %d %s, got %d %v", status, code, resp.StatusCode, body)
+		}
+	}
+	create := func(t *testing.T, rule map[string]any) string {
+		t.Helper()
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/classification-rules", rule, authHeaders(adminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusCreated)
+		return body["data"].(map[string]any)["id"].(string)
+	}
+	upload := func(t *testing.T, name, content string) *http.Response {
+		t.Helper()
+		b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+		headers := authHeaders(token)
+		headers["Tus-Resumable"] = "1.0.0"
+		headers["Upload-Length"] = strconv.Itoa(len(content))
+		headers["Upload-Metadata"] = "filename " + b64(name)
+		resp := performRequest(t, env.app, http.MethodPost, "/api/tus/", nil, headers)
+		assertStatus(t, resp, http.StatusCreated)
+		location := resp.Header.Get("Location")
+
+		headers = authHeaders(token)
+		headers["Tus-Resumable"] = "1.0.0"
+		headers["Content-Type"] = "application/offset+octet-stream"
+		headers["Upload-Offset"] = "0"
+		return performRequest(t, env.app, http.MethodPatch, location, strings.NewReader(content), headers)
+	}
+
+	t.Run("only admins manage rules", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/admin/classification-rules", nil, authHeaders(userToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("refuses invalid rules", func(t *testing.T) {
+		for _, rule := range []map[string]any{
+			{"name": "No condition", "tags": []string{"a"}},
+			{"name": "No action", "extensions": []string{"pdf"}},
+			{"name": "Bad folder", "extensions": []string{"pdf"}, "folderID": "nope"},
+			{"name": "No scanner", "extensions": []string{"pdf"}, "scan": true},
+		} {
+			resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/classification-rules", rule, authHeaders(adminToken))
+			expectCode(t, resp, http.StatusBadRequest, "invalid_classification_rule")
+		}
+	})
+
+	t.Run("creates, updates and deletes rules", func(t *testing.T) {
+		id := create(t, map[string]any{"name": "Draft", "extensions": []string{"tmp"}, "tags": []string{"scratch"}})
+
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/admin/classification-rules/"+id, map[string]any{"enabled": false, "priority": 5}, authHeaders(adminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		data := body["data"].(map[string]any)
+		if data["enabled"] != false || data["priority"] != float64(5) || data["name"] != "Draft" {
+			t.Fatalf("unexpected updated rule %v", data)
+		}
+
+		resp = performRequest(t, env.app, http.MethodDelete, "/api/admin/classification-rules/"+id, nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		resp = performJSONRequest(t, env.app, http.MethodPut, "/api/admin/classification-rules/"+id, map[string]any{"enabled": true}, authHeaders(adminToken))
+		expectCode(t, resp, http.StatusNotFound, "classification_rule_not_found")
+
+		var audits int64
+		deadline := time.Now().Add(2 * time.Second)
+		for audits < 3 && time.Now().Before(deadline) {
+			env.db.Model(&models.AuditLog{}).Where("action LIKE ? AND user_id = ?", "admin.classification_rule_%", admin.ID).Count(&audits)
+			time.Sleep(20 * time.Millisecond)
+		}
+		if audits != 3 {
+			t.Fatalf("expected create, update and delete to be audited, got %d", audits)
+		}
+	})
+
+	t.Run("simulates without side effects", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/classification-rules/simulate", map[string]any{
+			"fileName": "Budget.XLSX",
+			"rule":     map[string]any{"name": "Sheets", "extensions": []string{"xlsx"}, "tags": []string{"finance"}, "retentionClass": "seven-years"},
+		}, authHeaders(adminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		data := body["data"].(map[string]any)
+		hits := data["hits"].([]any)
+		if len(hits) != 1 || data["retentionClass"] != "seven-years" || data["tags"].([]any)[0] != "finance" {
+			t.Fatalf("unexpected simulation %v", data)
+		}
+
+		var rules int64
+		env.db.Model(&models.ClassificationRule{}).Where("name = ?", "Sheets").Count(&rules)
+		if rules != 0 {
+			t.Fatal("expected the draft rule not to be saved")
+		}
+	})
+
+	t.Run("classifies uploads", func(t *testing.T) {
+		create(t, map[string]any{"name": "Reports", "namePattern": "report-*", "tags": []string{"report"}, "retentionClass": "one-year", "folderID": archive.ID.String()})
+
+		resp := upload(t, "report-q1.txt", "quarterly numbers")
+		assertStatus(t, resp, http.StatusNoContent)
+		var file models.File
+		if err := env.db.First(&file, "id = ?", resp.Header.Get("X-File-ID")).Error; err != nil {
+			t.Fatalf("failed loading file: %v", err)
+		}
+		if len(file.Tags) != 1 || file.Tags[0] != "report" || file.RetentionClass != "one-year" || file.ParentID == nil || *file.ParentID != archive.ID {
+			t.Fatalf("expected the file to be tagged and moved, got %+v", file)
+		}
+		var hits int64
+		env.db.Model(&models.OutboxEvent{}).Where("event_type = ? AND resource_id = ?", "file.classified", file.ID).Count(&hits)
+		if hits != 1 {
+			t.Fatalf("expected the rule hit to be audited, got %d", hits)
+		}
+	})
+
+	t.Run("blocks uploads", func(t *testing.T) {
+		create(t, map[string]any{"name": "No scripts", "extensions": []string{"sh", "ps1"}, "block": true})
+		before := len(env.uploads.objects)
+
+		resp := upload(t, "install.SH", "echo hi")
+		expectCode(t, resp, http.StatusForbidden, "upload_blocked")
+		var files int64
+		env.db.Model(&models.File{}).Where("name = ?", "install.SH").Count(&files)
+		if files != 0 || len(env.uploads.objects) != before {
+			t.Fatalf("expected nothing to be stored, got %d files and %d objects", files, len(env.uploads.objects)-before)
+		}
+
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			var count int64
+			env.db.Model(&models.AuditLog{}).Where("action = ? AND user_id = ?", "file.upload_blocked", uploader.ID).Count(&count)
+			if count == 1 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected one file.upload_blocked entry, got %d", count)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	})
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ConversionsHandler reports on the Gotenberg worker pool so operators can
+// watch queue depth, latency and the circuit breaker.
+type ConversionsHandler struct {
+	Pool *services.GotenbergPool
+}
+
+func NewConversionsHandler(pool *services.GotenbergPool) *ConversionsHandler {
+	return &ConversionsHandler{Pool: pool}
+}
+
+func (h *ConversionsHandler) Stats(c *fiber.Ctx) error {
+	return utils.Success(c, fiber.StatusOK, h.Pool.Stats())
+}
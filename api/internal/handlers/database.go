@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"github.com/docshare/api/internal/database"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// DatabaseHandler reports on the database connection pool so operators can
+// spot connection exhaustion and slow queries.
+type DatabaseHandler struct {
+	DB *gorm.DB
+}
+
+func NewDatabaseHandler(db *gorm.DB) *DatabaseHandler {
+	return &DatabaseHandler{DB: db}
+}
+
+func (h *DatabaseHandler) Stats(c *fiber.Ctx) error {
+	stats, err := database.Stats(h.DB)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed reading database stats")
+	}
+	return utils.Success(c, fiber.StatusOK, stats)
+}
@@ -3,6 +3,8 @@ package handlers
 import (
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
 	"math/big"
 	"strings"
@@ -23,21 +25,42 @@ const (
 	devicePollInterval = 5
 	userCodeAlphabet   = "BCDFGHJKLMNPQRSTVWXZ"
 	userCodeLength     = 8
+
+	// deviceApprovalLifetime bounds how long an approved code can wait for
+	// the device to pick up its token.
+	deviceApprovalLifetime = 2 * time.Minute
+	// deviceSlowDownStep is added to the polling interval of a client that
+	// polls too often (RFC 8628 Section 3.5).
+	deviceSlowDownStep = 5
 )
 
 type DeviceAuthHandler struct {
 	DB          *gorm.DB
 	Audit       *services.AuditService
 	FrontendURL string
+	Sessions    *services.SessionService
 }
 
-func NewDeviceAuthHandler(db *gorm.DB, audit *services.AuditService, cfg *config.Config) *DeviceAuthHandler {
-	return &DeviceAuthHandler{DB: db, Audit: audit, FrontendURL: cfg.Server.FrontendURL}
+func NewDeviceAuthHandler(db *gorm.DB, audit *services.AuditService, cfg *config.Config, sessions *services.SessionService) *DeviceAuthHandler {
+	return &DeviceAuthHandler{DB: db, Audit: audit, FrontendURL: cfg.Server.FrontendURL, Sessions: sessions}
 }
 
 // RequestCode implements the Device Authorization Endpoint (RFC 8628 Section 3.1-3.2).
 // The golang.org/x/oauth2 client POSTs form-encoded data and expects standard OAuth2 JSON.
+// Clients may bind the code to themselves PKCE-style by sending an S256
+// code_challenge; the token is then only issued against the matching
+// code_verifier.
 func (h *DeviceAuthHandler) RequestCode(c *fiber.Ctx) error {
+	challenge := c.FormValue("code_challenge")
+	if challenge != "" {
+		if method := c.FormValue("code_challenge_method"); method != "S256" {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_request", "code_challenge_method must be S256")
+		}
+		if len(challenge) < 43 || len(challenge) > 128 {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_request", "invalid code_challenge")
+		}
+	}
+
 	rawDeviceCode, err := generateRandomHex(32)
 	if err != nil {
 		return oauthError(c, fiber.StatusInternalServerError, "server_error", "failed to generate device code")
@@ -59,6 +82,12 @@ func (h *DeviceAuthHandler) RequestCode(c *fiber.Ctx) error {
 		ExpiresAt:      expiresAt,
 		Interval:       devicePollInterval,
 		Status:         models.DeviceCodePending,
+
+		ClientID:         truncate(c.FormValue("client_id"), 100),
+		ClientName:       truncate(c.FormValue("client_name"), 100),
+		RequestIP:        c.IP(),
+		RequestUserAgent: truncate(c.Get(fiber.HeaderUserAgent), 255),
+		CodeChallenge:    challenge,
 	}
 
 	if err := h.DB.Create(&dc).Error; err != nil {
@@ -105,8 +134,25 @@ func (h *DeviceAuthHandler) PollToken(c *fiber.Ctx) error {
 		return oauthError(c, fiber.StatusBadRequest, "expired_token", "the device code has expired")
 	}
 
+	// Only the client the code was issued to may redeem it.
+	if dc.ClientID != "" && c.FormValue("client_id") != dc.ClientID {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "client_id does not match the device code")
+	}
+	if dc.CodeChallenge != "" && !verifyCodeChallenge(dc.CodeChallenge, c.FormValue("code_verifier")) {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "code_verifier does not match the device code")
+	}
+
 	switch dc.Status {
 	case models.DeviceCodePending:
+		now := time.Now()
+		if dc.LastPolledAt != nil && now.Sub(*dc.LastPolledAt) < time.Duration(dc.Interval)*time.Second {
+			h.DB.Model(&dc).Updates(map[string]interface{}{
+				"interval":       dc.Interval + deviceSlowDownStep,
+				"last_polled_at": now,
+			})
+			return oauthError(c, fiber.StatusBadRequest, "slow_down", "polling too frequently")
+		}
+		h.DB.Model(&dc).Update("last_polled_at", now)
 		return oauthError(c, fiber.StatusBadRequest, "authorization_pending", "the user has not yet approved")
 
 	case models.DeviceCodeDenied:
@@ -116,21 +162,37 @@ func (h *DeviceAuthHandler) PollToken(c *fiber.Ctx) error {
 		if dc.UserID == nil {
 			return oauthError(c, fiber.StatusInternalServerError, "server_error", "approved but no user attached")
 		}
+		if dc.ApprovedAt != nil && time.Since(*dc.ApprovedAt) > deviceApprovalLifetime {
+			h.DB.Model(&dc).Update("status", models.DeviceCodeExpired)
+			return oauthError(c, fiber.StatusBadRequest, "expired_token", "the approval has expired")
+		}
 
 		var user models.User
 		if err := h.DB.First(&user, "id = ?", *dc.UserID).Error; err != nil {
 			return oauthError(c, fiber.StatusInternalServerError, "server_error", "user not found")
 		}
+		if user.IsSuspended() {
+			return oauthError(c, fiber.StatusBadRequest, "access_denied", middleware.ErrAccountSuspended.Message)
+		}
 
-		token, err := utils.GenerateToken(&user)
+		// Claim the approval before issuing, so polls that arrive together
+		// get one token between them.
+		claim := h.DB.Unscoped().Where("id = ? AND status = ?", dc.ID, models.DeviceCodeApproved).Delete(&models.DeviceCode{})
+		if claim.Error != nil {
+			return oauthError(c, fiber.StatusInternalServerError, "server_error", "failed to redeem device code")
+		}
+		if claim.RowsAffected != 1 {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "the device code has already been used")
+		}
+
+		token, err := issueToken(c, h.Sessions, &user, "device_flow")
 		if err != nil {
 			return oauthError(c, fiber.StatusInternalServerError, "server_error", "failed to generate token")
 		}
 
-		h.DB.Unscoped().Delete(&dc)
-
 		logger.Info("device_flow_token_issued", map[string]interface{}{
-			"user_id": user.ID.String(),
+			"user_id":   user.ID.String(),
+			"client_id": dc.ClientID,
 		})
 
 		h.Audit.LogAsync(services.AuditEntry{
@@ -138,8 +200,16 @@ func (h *DeviceAuthHandler) PollToken(c *fiber.Ctx) error {
 			Action:       "auth.device_flow_login",
 			ResourceType: "user",
 			ResourceID:   dc.UserID,
-			IPAddress:    c.IP(),
-			RequestID:    getRequestID(c),
+			Details: map[string]interface{}{
+				"device_code_id": dc.ID.String(),
+				"client_id":      dc.ClientID,
+				"client_name":    dc.ClientName,
+				"request_ip":     dc.RequestIP,
+				"user_agent":     truncate(c.Get(fiber.HeaderUserAgent), 255),
+				"pkce":           dc.CodeChallenge != "",
+			},
+			IPAddress: c.IP(),
+			RequestID: getRequestID(c),
 		})
 
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -158,14 +228,14 @@ func (h *DeviceAuthHandler) PollToken(c *fiber.Ctx) error {
 func (h *DeviceAuthHandler) Approve(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var req struct {
 		UserCode string `json:"userCode"`
 	}
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	code := normalizeUserCode(req.UserCode)
@@ -184,8 +254,9 @@ func (h *DeviceAuthHandler) Approve(c *fiber.Ctx) error {
 	}
 
 	if err := h.DB.Model(&dc).Updates(map[string]interface{}{
-		"status":  models.DeviceCodeApproved,
-		"user_id": currentUser.ID,
+		"status":      models.DeviceCodeApproved,
+		"user_id":     currentUser.ID,
+		"approved_at": time.Now(),
 	}).Error; err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed to approve device code")
 	}
@@ -201,7 +272,10 @@ func (h *DeviceAuthHandler) Approve(c *fiber.Ctx) error {
 		ResourceType: "device_code",
 		ResourceID:   &dc.ID,
 		Details: map[string]interface{}{
-			"user_code": code,
+			"user_code":   code,
+			"client_id":   dc.ClientID,
+			"client_name": dc.ClientName,
+			"request_ip":  dc.RequestIP,
 		},
 		IPAddress: c.IP(),
 		RequestID: getRequestID(c),
@@ -210,11 +284,60 @@ func (h *DeviceAuthHandler) Approve(c *fiber.Ctx) error {
 	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "device authorized"})
 }
 
-// Verify looks up a user_code and returns its status. Called by the frontend to pre-fill the code.
+// Deny lets the user reject a device code they do not recognise from the
+// verification screen. The device is told access_denied on its next poll.
+func (h *DeviceAuthHandler) Deny(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	var req struct {
+		UserCode string `json:"userCode"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+
+	code := normalizeUserCode(req.UserCode)
+	if code == "" {
+		return utils.Error(c, fiber.StatusBadRequest, "userCode is required")
+	}
+
+	var dc models.DeviceCode
+	if err := h.DB.First(&dc, "user_code = ? AND status = ?", code, models.DeviceCodePending).Error; err != nil {
+		return utils.Error(c, fiber.StatusNotFound, "no pending device code found for this code")
+	}
+
+	if err := h.DB.Model(&dc).Update("status", models.DeviceCodeDenied).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed to deny device code")
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "auth.device_flow_deny",
+		ResourceType: "device_code",
+		ResourceID:   &dc.ID,
+		Details: map[string]interface{}{
+			"user_code":   code,
+			"client_id":   dc.ClientID,
+			"client_name": dc.ClientName,
+			"request_ip":  dc.RequestIP,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "device request denied"})
+}
+
+// Verify looks up a user_code and returns its status along with what is known
+// about the requesting device, so the user can check it is theirs before
+// approving. Called by the frontend to pre-fill the code.
 func (h *DeviceAuthHandler) Verify(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	code := normalizeUserCode(c.Query("code"))
@@ -230,17 +353,24 @@ func (h *DeviceAuthHandler) Verify(c *fiber.Ctx) error {
 	expired := time.Now().After(dc.ExpiresAt)
 
 	return utils.Success(c, fiber.StatusOK, fiber.Map{
-		"userCode":  formatUserCode(dc.UserCode),
-		"status":    dc.Status,
-		"expired":   expired,
-		"expiresAt": dc.ExpiresAt,
+		"userCode":      formatUserCode(dc.UserCode),
+		"status":        dc.Status,
+		"expired":       expired,
+		"expiresAt":     dc.ExpiresAt,
+		"requestedAt":   dc.CreatedAt,
+		"clientID":      dc.ClientID,
+		"clientName":    dc.ClientName,
+		"requestIP":     dc.RequestIP,
+		"userAgent":     dc.RequestUserAgent,
+		"sameNetwork":   dc.RequestIP == c.IP(),
+		"boundToClient": dc.CodeChallenge != "",
 	})
 }
 
 // CleanupExpiredDeviceCodes removes device codes that have been expired for over an hour.
-func CleanupExpiredDeviceCodes(db *gorm.DB) {
+func CleanupExpiredDeviceCodes(db *gorm.DB) error {
 	cutoff := time.Now().Add(-1 * time.Hour)
-	db.Unscoped().Where("expires_at < ?", cutoff).Delete(&models.DeviceCode{})
+	return db.Unscoped().Where("expires_at < ?", cutoff).Delete(&models.DeviceCode{}).Error
 }
 
 func oauthError(c *fiber.Ctx, status int, errorCode string, description string) error {
@@ -270,6 +400,17 @@ func generateUserCode() (string, error) {
 	return string(code), nil
 }
 
+// verifyCodeChallenge checks an RFC 7636 S256 code_verifier against the
+// challenge the client sent with its code request.
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if verifier == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
 func formatUserCode(code string) string {
 	if len(code) == userCodeLength {
 		return code[:4] + "-" + code[4:]
@@ -1,12 +1,17 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"net/http"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/docshare/api/internal/models"
+	"gorm.io/gorm"
 )
 
 func TestDeviceAuthEndpoints_Enhanced(t *testing.T) {
@@ -165,3 +170,126 @@ func TestDeviceAuthHelpers(t *testing.T) {
 		}
 	})
 }
+
+func TestDeviceAuthHardening(t *testing.T) {
+	env := setupTestEnv(t)
+	_, token := createTestUser(t, env.db, "device-hardening@test.com", "password123", models.UserRoleUser)
+
+	formHeaders := map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+	requestCode := func(t *testing.T, form url.Values) (string, string) {
+		t.Helper()
+		resp := performRequest(t, env.app, http.MethodPost, "/api/auth/device/code", strings.NewReader(form.Encode()), formHeaders)
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		return body["device_code"].(string), body["user_code"].(string)
+	}
+	poll := func(t *testing.T, form url.Values) (int, map[string]any) {
+		t.Helper()
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:device_code")
+		resp := performRequest(t, env.app, http.MethodPost, "/api/auth/device/token", strings.NewReader(form.Encode()), formHeaders)
+		return resp.StatusCode, decodeJSONMap(t, resp)
+	}
+	approve := func(t *testing.T, userCode string) {
+		t.Helper()
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/auth/device/approve", map[string]any{"userCode": userCode}, authHeaders(token))
+		assertStatus(t, resp, http.StatusOK)
+	}
+
+	t.Run("code bound to a verifier", func(t *testing.T) {
+		verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		sum := sha256.Sum256([]byte(verifier))
+		deviceCode, userCode := requestCode(t, url.Values{
+			"client_id":             {"docshare-cli"},
+			"client_name":           {"docshare CLI on build-box"},
+			"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+			"code_challenge_method": {"S256"},
+		})
+
+		resp := performRequest(t, env.app, http.MethodGet, "/api/auth/device/verify?code="+url.QueryEscape(userCode), nil, authHeaders(token))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		data := body["data"].(map[string]any)
+		if data["clientName"] != "docshare CLI on build-box" || data["requestIP"] == "" || data["boundToClient"] != true {
+			t.Fatalf("expected requesting client details, got %v", data)
+		}
+
+		approve(t, userCode)
+
+		if status, body := poll(t, url.Values{"device_code": {deviceCode}, "client_id": {"docshare-cli"}}); status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+			t.Fatalf("expected invalid_grant without verifier, got %d %v", status, body)
+		}
+		if status, body := poll(t, url.Values{"device_code": {deviceCode}, "client_id": {"other"}, "code_verifier": {verifier}}); status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+			t.Fatalf("expected invalid_grant for another client, got %d %v", status, body)
+		}
+		if status, body := poll(t, url.Values{"device_code": {deviceCode}, "client_id": {"docshare-cli"}, "code_verifier": {verifier}}); status != http.StatusOK || body["access_token"] == nil {
+			t.Fatalf("expected token with the verifier, got %d %v", status, body)
+		}
+	})
+
+	t.Run("one approval gives one token", func(t *testing.T) {
+		deviceCode, userCode := requestCode(t, url.Values{})
+		approve(t, userCode)
+
+		// Another poll redeems the code right after this one has loaded
+		// it, as happens when two arrive together.
+		redeemed := false
+		callbacks := env.db.Callback().Query()
+		if err := callbacks.After("gorm:query").Register("test:redeem_elsewhere", func(db *gorm.DB) {
+			if db.Statement.Table != "device_codes" || redeemed {
+				return
+			}
+			redeemed = true
+			db.Session(&gorm.Session{NewDB: true}).Unscoped().Where("status = ?", models.DeviceCodeApproved).Delete(&models.DeviceCode{})
+		}); err != nil {
+			t.Fatalf("failed registering callback: %v", err)
+		}
+		defer func() { _ = callbacks.Remove("test:redeem_elsewhere") }()
+
+		if status, body := poll(t, url.Values{"device_code": {deviceCode}}); status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+			t.Fatalf("expected invalid_grant for a code redeemed meanwhile, got %d %v", status, body)
+		}
+	})
+
+	t.Run("rejects plain challenges", func(t *testing.T) {
+		form := url.Values{"code_challenge": {strings.Repeat("a", 43)}, "code_challenge_method": {"plain"}}
+		resp := performRequest(t, env.app, http.MethodPost, "/api/auth/device/code", strings.NewReader(form.Encode()), formHeaders)
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+
+	t.Run("slow_down when polling too fast", func(t *testing.T) {
+		deviceCode, _ := requestCode(t, url.Values{})
+		if _, body := poll(t, url.Values{"device_code": {deviceCode}}); body["error"] != "authorization_pending" {
+			t.Fatalf("expected authorization_pending, got %v", body)
+		}
+		if _, body := poll(t, url.Values{"device_code": {deviceCode}}); body["error"] != "slow_down" {
+			t.Fatalf("expected slow_down, got %v", body)
+		}
+		hash := sha256.Sum256([]byte(deviceCode))
+		var dc models.DeviceCode
+		env.db.First(&dc, "device_code_hash = ?", hex.EncodeToString(hash[:]))
+		if dc.Interval != devicePollInterval+deviceSlowDownStep {
+			t.Fatalf("expected interval to grow, got %d", dc.Interval)
+		}
+	})
+
+	t.Run("approval expires", func(t *testing.T) {
+		deviceCode, userCode := requestCode(t, url.Values{})
+		approve(t, userCode)
+		env.db.Model(&models.DeviceCode{}).Where("user_code = ?", normalizeUserCode(userCode)).
+			Update("approved_at", time.Now().Add(-deviceApprovalLifetime-time.Minute))
+
+		if _, body := poll(t, url.Values{"device_code": {deviceCode}}); body["error"] != "expired_token" {
+			t.Fatalf("expected expired_token, got %v", body)
+		}
+	})
+
+	t.Run("denied from the verification screen", func(t *testing.T) {
+		deviceCode, userCode := requestCode(t, url.Values{})
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/auth/device/deny", map[string]any{"userCode": userCode}, authHeaders(token))
+		assertStatus(t, resp, http.StatusOK)
+
+		if _, body := poll(t, url.Values{"device_code": {deviceCode}}); body["error"] != "access_denied" {
+			t.Fatalf("expected access_denied, got %v", body)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// issueToken signs a JWT for user bound to a new session for the device
+// making the request. Without a session service the token is unbound.
+func issueToken(c *fiber.Ctx, sessions *services.SessionService, user *models.User, method string) (string, error) {
+	if sessions == nil {
+		return utils.GenerateToken(user)
+	}
+	client := sessions.ClientInfo(c.Get(fiber.HeaderUserAgent), c.IP(), func(key string) string { return c.Get(key) })
+	session, err := sessions.Start(c.UserContext(), user, client, method)
+	if err != nil {
+		logger.Error("session_start_failed", err, map[string]interface{}{
+			"user_id": user.ID.String(),
+		})
+		return "", err
+	}
+	return utils.GenerateSessionToken(user, session.ID)
+}
+
+type DevicesHandler struct {
+	DB    *gorm.DB
+	Audit *services.AuditService
+}
+
+func NewDevicesHandler(db *gorm.DB, audit *services.AuditService) *DevicesHandler {
+	return &DevicesHandler{DB: db, Audit: audit}
+}
+
+type deviceResponse struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// List returns the devices the user is signed in on, most recently used
+// first. Sessions that expired or were signed out are left out.
+func (h *DevicesHandler) List(c *fiber.Ctx) error {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	query := h.DB.Where("user_id = ? AND revoked_at IS NULL", user.ID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now())
+	if user.SessionsRevokedAt != nil {
+		query = query.Where("created_at >= ? OR api_token_id IS NOT NULL", *user.SessionsRevokedAt)
+	}
+	var sessions []models.Session
+	if err := query.Order("last_seen_at DESC").Find(&sessions).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading devices")
+	}
+
+	current := middleware.GetSession(c)
+	devices := make([]deviceResponse, 0, len(sessions))
+	for _, s := range sessions {
+		devices = append(devices, deviceResponse{Session: s, Current: current != nil && current.ID == s.ID})
+	}
+	return utils.Success(c, fiber.StatusOK, devices)
+}
+
+// Revoke signs a device out. Its token stops working on the next request;
+// for an API token that means the token itself is revoked.
+func (h *DevicesHandler) Revoke(c *fiber.Ctx) error {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	sessionID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, "invalid device id")
+	}
+
+	var session models.Session
+	if err := h.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, user.ID).First(&session).Error; err != nil {
+		return utils.Fail(c, errDeviceNotFound)
+	}
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&session).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if session.APITokenID != nil {
+			// Hard delete, as when the token is revoked directly.
+			if err := tx.Unscoped().Where("id = ? AND user_id = ?", *session.APITokenID, user.ID).Delete(&models.APIToken{}).Error; err != nil {
+				return err
+			}
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &user.ID,
+			Action:       "auth.device_revoke",
+			ResourceType: "session",
+			ResourceID:   &session.ID,
+			Details: map[string]interface{}{
+				"device": session.DeviceName,
+				"method": session.Method,
+			},
+			IPAddress: c.IP(),
+			RequestID: getRequestID(c),
+		})
+	}); err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed revoking device")
+	}
+
+	logger.Info("device_revoked", map[string]interface{}{
+		"user_id":    user.ID.String(),
+		"session_id": session.ID.String(),
+	})
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "device signed out"})
+}
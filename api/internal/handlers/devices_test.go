@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+)
+
+const (
+	firefoxLinux = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+	safariIPhone = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1"
+)
+
+func TestDevicesHandler(t *testing.T) {
+	env := setupTestEnv(t)
+	const email = "devices@test.com"
+	user, _ := createTestUser(t, env.db, email, "password123", models.UserRoleUser)
+
+	login := func(t *testing.T, userAgent, country string) map[string]string {
+		t.Helper()
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/auth/login", map[string]interface{}{
+			"email": email, "password": "password123",
+		}, map[string]string{"User-Agent": userAgent, "CF-IPCountry": country})
+		assertStatus(t, resp, http.StatusOK)
+		return authHeaders(decodeJSONMap(t, resp)["data"].(map[string]interface{})["token"].(string))
+	}
+	newDeviceEvents := func() []models.OutboxEvent {
+		var events []models.OutboxEvent
+		env.db.Where("event_type = ? AND actor_id = ?", "auth.new_device", user.ID).Order("created_at").Find(&events)
+		return events
+	}
+
+	laptop := login(t, firefoxLinux, "DE")
+	if events := newDeviceEvents(); len(events) != 0 {
+		t.Fatalf("expected no alert for the first sign-in, got %d", len(events))
+	}
+
+	phone := login(t, safariIPhone, "DE")
+	events := newDeviceEvents()
+	if len(events) != 1 || events[0].Payload["device"] != "Safari on iOS" || events[0].Payload["new_country"] != false {
+		t.Fatalf("expected a new device alert, got %+v", events)
+	}
+	mail := testMailer.sentTo(email)
+	if len(mail) != 1 || !strings.Contains(mail[0].Body, "Safari on iOS") {
+		t.Fatalf("expected a new device email, got %+v", mail)
+	}
+
+	login(t, firefoxLinux, "FR")
+	events = newDeviceEvents()
+	if len(events) != 2 || events[1].Payload["new_country"] != true || events[1].Payload["new_device"] != false {
+		t.Fatalf("expected a new country alert, got %+v", events)
+	}
+
+	t.Run("list", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/auth/devices", nil, phone)
+		assertStatus(t, resp, http.StatusOK)
+		devices := decodeJSONMap(t, resp)["data"].([]interface{})
+		if len(devices) != 3 {
+			t.Fatalf("expected 3 devices, got %d", len(devices))
+		}
+		current := 0
+		for _, d := range devices {
+			device := d.(map[string]interface{})
+			if device["current"] == true {
+				current++
+				if device["deviceName"] != "Safari on iOS" || device["country"] != "DE" || device["method"] != "password" {
+					t.Fatalf("unexpected current device %v", device)
+				}
+			}
+			if _, ok := device["userID"]; ok {
+				t.Fatal("expected the user ID to be left out")
+			}
+		}
+		if current != 1 {
+			t.Fatalf("expected exactly one current device, got %d", current)
+		}
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		var session models.Session
+		if err := env.db.Where("user_id = ? AND device_name = ?", user.ID, "Safari on iOS").First(&session).Error; err != nil {
+			t.Fatalf("loading session: %v", err)
+		}
+
+		resp := performRequest(t, env.app, http.MethodDelete, "/api/auth/devices/"+session.ID.String(), nil, laptop)
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/auth/me", nil, phone)
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusUnauthorized)
+		if body["code"] != "session_revoked" {
+			t.Fatalf("expected session_revoked, got %v", body["code"])
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/auth/me", nil, laptop)
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performRequest(t, env.app, http.MethodDelete, "/api/auth/devices/"+session.ID.String(), nil, laptop)
+		assertStatus(t, resp, http.StatusNotFound)
+	})
+
+	t.Run("cannot revoke another user's device", func(t *testing.T) {
+		_, otherToken := createTestUser(t, env.db, "devices-other@test.com", "password123", models.UserRoleUser)
+		var session models.Session
+		env.db.Where("user_id = ? AND revoked_at IS NULL", user.ID).First(&session)
+
+		resp := performRequest(t, env.app, http.MethodDelete, "/api/auth/devices/"+session.ID.String(), nil, authHeaders(otherToken))
+		assertStatus(t, resp, http.StatusNotFound)
+	})
+}
+
+func TestDescribeUserAgent(t *testing.T) {
+	tests := map[string]string{
+		"":               "Unknown device",
+		firefoxLinux:     "Firefox on Linux",
+		safariIPhone:     "Safari on iOS",
+		"curl/8.5.0":     "curl",
+		"docshare-cli/1": "DocShare CLI",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36": "Chrome on macOS",
+	}
+	for ua, want := range tests {
+		if got := services.DescribeUserAgent(ua); got != want {
+			t.Errorf("DescribeUserAgent(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
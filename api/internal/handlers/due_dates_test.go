@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestDueDates(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "due-owner@test.com", "password123", models.UserRoleUser)
+	viewer, viewerToken := createTestUser(t, env.db, "due-viewer@test.com", "password123", models.UserRoleUser)
+	_, strangerToken := createTestUser(t, env.db, "due-stranger@test.com", "password123", models.UserRoleUser)
+
+	contract := models.File{Name: "contract.pdf", MimeType: "application/pdf", OwnerID: owner.ID, StoragePath: "contract.pdf"}
+	folder := models.File{Name: "Audit 2026", IsDirectory: true, OwnerID: owner.ID}
+	env.db.Create(&contract)
+	env.db.Create(&folder)
+	env.db.Create(&models.Share{FileID: contract.ID, SharedByID: owner.ID, SharedWithUserID: &viewer.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView})
+	duePath := "/api/files/" + contract.ID.String() + "/due-date"
+	dueAt := time.Now().UTC().Add(5 * 24 * time.Hour).Truncate(time.Second)
+
+	t.Run("editors set due dates", func(t *testing.T) {
+		body := map[string]any{"dueAt": dueAt.Format(time.RFC3339), "reminderHours": []int{24, 1}, "note": "Countersign"}
+		resp := performJSONRequest(t, env.app, http.MethodPut, duePath, body, authHeaders(viewerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+
+		resp = performJSONRequest(t, env.app, http.MethodPut, duePath, map[string]any{"dueAt": "2020-01-01T00:00:00Z"}, authHeaders(ownerToken))
+		decoded := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusBadRequest)
+		if decoded["code"] != "invalid_due_date" {
+			t.Fatalf("expected invalid_due_date, got %v", decoded["code"])
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPut, duePath, body, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		resp = performJSONRequest(t, env.app, http.MethodPut, "/api/files/"+folder.ID.String()+"/due-date", map[string]any{"dueAt": time.Now().Add(60 * 24 * time.Hour).Format(time.RFC3339)}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performRequest(t, env.app, http.MethodGet, duePath, nil, authHeaders(viewerToken))
+		decoded = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		due := decoded["data"].(map[string]any)
+		if due["note"] != "Countersign" || len(due["reminderHours"].([]any)) != 2 || due["overdue"] != false {
+			t.Fatalf("unexpected due date %v", due)
+		}
+	})
+
+	t.Run("upcoming", func(t *testing.T) {
+		past := models.File{Name: "old.pdf", MimeType: "application/pdf", OwnerID: owner.ID, StoragePath: "old.pdf"}
+		env.db.Create(&past)
+		env.db.Create(&models.FileDueDate{FileID: past.ID, DueAt: time.Now().Add(-48 * time.Hour), SetByID: owner.ID})
+
+		names := func(query, token string) string {
+			t.Helper()
+			resp := performRequest(t, env.app, http.MethodGet, "/api/files/upcoming"+query, nil, authHeaders(token))
+			assertStatus(t, resp, http.StatusOK)
+			var out []string
+			for _, d := range decodeJSONMap(t, resp)["data"].([]any) {
+				out = append(out, d.(map[string]any)["file"].(map[string]any)["name"].(string))
+			}
+			return strings.Join(out, ",")
+		}
+		for query, want := range map[string]string{
+			"":                       "old.pdf,contract.pdf",
+			"?overdue=false":         "contract.pdf",
+			"?days=90":               "old.pdf,contract.pdf,Audit 2026",
+			"?days=90&overdue=false": "contract.pdf,Audit 2026",
+		} {
+			if got := names(query, ownerToken); got != want {
+				t.Errorf("owner %q: expected %s, got %s", query, want, got)
+			}
+		}
+		if got := names("?days=90", viewerToken); got != "contract.pdf" {
+			t.Errorf("expected the viewer to see only the shared file, got %s", got)
+		}
+		if got := names("", strangerToken); got != "" {
+			t.Errorf("expected nothing for a stranger, got %s", got)
+		}
+
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/upcoming?days=0", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+
+	t.Run("calendar feed", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodPost, "/api/auth/me/calendar-feed", nil, authHeaders(viewerToken))
+		decoded := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusCreated)
+		path := decoded["data"].(map[string]any)["path"].(string)
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api"+path, nil, nil)
+		assertStatus(t, resp, http.StatusOK)
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+			t.Fatalf("expected text/calendar, got %q", ct)
+		}
+		ics, _ := io.ReadAll(resp.Body)
+		if !strings.Contains(string(ics), "SUMMARY:Due: contract.pdf\r\n") || !strings.Contains(string(ics), "DESCRIPTION:Countersign\r\n") {
+			t.Fatalf("expected the contract in the feed, got\n%s", ics)
+		}
+		if strings.Contains(string(ics), "Audit 2026") {
+			t.Fatalf("expected only due dates the viewer can see, got\n%s", ics)
+		}
+
+		resp = performRequest(t, env.app, http.MethodDelete, "/api/auth/me/calendar-feed", nil, authHeaders(viewerToken))
+		assertStatus(t, resp, http.StatusOK)
+		resp = performRequest(t, env.app, http.MethodGet, "/api"+path, nil, nil)
+		assertStatus(t, resp, http.StatusNotFound)
+	})
+
+	t.Run("clearing", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodDelete, duePath, nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		resp = performRequest(t, env.app, http.MethodGet, duePath, nil, authHeaders(ownerToken))
+		decoded := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusNotFound)
+		if decoded["code"] != "due_date_not_found" {
+			t.Fatalf("expected due_date_not_found, got %v", decoded["code"])
+		}
+
+		var n int64
+		env.db.Model(&models.OutboxEvent{}).Where("event_type IN ? AND resource_id = ?", []string{"file.due_date_set", "file.due_date_clear"}, contract.ID).Count(&n)
+		if n != 2 {
+			t.Fatalf("expected set and clear events, got %d", n)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var errInvalidPermissionFilter = utils.NewError(fiber.StatusBadRequest, "invalid_permission", "permission must be view, download or edit")
+
+// EffectiveAccessHandler answers who can reach what: for one file or
+// folder and everything below it, and across a whole organization.
+type EffectiveAccessHandler struct {
+	DB      *gorm.DB
+	Reports *services.EffectiveAccess
+}
+
+func NewEffectiveAccessHandler(db *gorm.DB, reports *services.EffectiveAccess) *EffectiveAccessHandler {
+	return &EffectiveAccessHandler{DB: db, Reports: reports}
+}
+
+// File reports everyone who can reach a file or folder the caller owns.
+// Users whose admin role can read the audit log may report on any file in
+// their organization.
+func (h *EffectiveAccessHandler) File(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+
+	var file models.File
+	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Fail(c, errFileNotFound)
+		}
+		return utils.Fail(c, errLoadingFile)
+	}
+	if file.OwnerID != currentUser.ID && !(services.HasAdminPermission(currentUser, services.PermissionAuditRead) &&
+		services.SameOrganization(file.OrganizationID, currentUser.OrganizationID)) {
+		return utils.Fail(c, errInsufficientPermissions)
+	}
+
+	report, err := h.Reports.Report(c.Context(), &file)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed resolving access")
+	}
+	return utils.Success(c, fiber.StatusOK, report)
+}
+
+// Organization lists the active shares on an organization's files, the
+// default tenant's unless organizationID is given. Filters: userID (what
+// reaches that user, including through groups and public links), groupID,
+// type=public and permission (at least view, download or edit).
+func (h *EffectiveAccessHandler) Organization(c *fiber.Ctx) error {
+	var orgID *uuid.UUID
+	if raw := c.Query("organizationID"); raw != "" {
+		id, err := parseUUID(raw)
+		if err != nil {
+			return utils.Fail(c, errInvalidOrganizationID)
+		}
+		var count int64
+		if err := h.DB.Model(&models.Organization{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed loading organization")
+		}
+		if count == 0 {
+			return utils.Fail(c, errOrganizationNotFound)
+		}
+		orgID = &id
+	}
+
+	var filter services.GrantFilter
+	if raw := c.Query("userID"); raw != "" {
+		id, err := parseUUID(raw)
+		if err != nil {
+			return utils.Fail(c, errInvalidUserID)
+		}
+		filter.UserID = &id
+	}
+	if raw := c.Query("groupID"); raw != "" {
+		id, err := parseUUID(raw)
+		if err != nil {
+			return utils.Fail(c, errInvalidGroupID)
+		}
+		filter.GroupID = &id
+	}
+	switch c.Query("type") {
+	case "":
+	case "public":
+		filter.PublicOnly = true
+	default:
+		return utils.Fail(c, errInvalidShareFilter.WithMessage("type must be public"))
+	}
+	if raw := c.Query("permission"); raw != "" {
+		if !isValidSharePermission(raw) {
+			return utils.Fail(c, errInvalidPermissionFilter)
+		}
+		filter.MinPermission = models.SharePermission(strings.ToLower(strings.TrimSpace(raw)))
+	}
+
+	p := utils.ParsePagination(c)
+	grants, total, err := h.Reports.OrganizationGrants(c.Context(), orgID, filter, p.Offset, p.Limit)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed resolving access")
+	}
+	return utils.Paginated(c, grants, p.Page, p.Limit, total)
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestEffectiveAccess(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "access-owner@test.com", "password123", models.UserRoleUser)
+	alice, aliceToken := createTestUser(t, env.db, "access-alice@test.com", "password123", models.UserRoleUser)
+	_, auditorToken := createTestUser(t, env.db, "access-auditor@test.com", "password123", models.UserRoleAuditor)
+
+	folder := models.File{Name: "Reports", IsDirectory: true, OwnerID: owner.ID}
+	env.db.Create(&folder)
+	env.db.Create(&models.Share{FileID: folder.ID, SharedByID: owner.ID, SharedWithUserID: &alice.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView})
+
+	t.Run("owners and auditors see who can reach a folder", func(t *testing.T) {
+		for _, token := range []string{ownerToken, auditorToken} {
+			resp := performJSONRequest(t, env.app, http.MethodGet, "/api/files/"+folder.ID.String()+"/effective-access", nil, authHeaders(token))
+			assertStatus(t, resp, http.StatusOK)
+			principals := decodeJSONMap(t, resp)["data"].(map[string]any)["principals"].([]any)
+			if len(principals) != 2 {
+				t.Fatalf("expected the owner and alice, got %v", principals)
+			}
+		}
+	})
+
+	t.Run("recipients cannot", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodGet, "/api/files/"+folder.ID.String()+"/effective-access", nil, authHeaders(aliceToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("admins list grants across the organization", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodGet, "/api/admin/effective-access?userID="+alice.ID.String(), nil, authHeaders(auditorToken))
+		assertStatus(t, resp, http.StatusOK)
+		data := decodeJSONMap(t, resp)["data"].([]any)
+		if len(data) != 1 || data[0].(map[string]any)["userEmail"] != alice.Email {
+			t.Fatalf("expected alice's share, got %v", data)
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodGet, "/api/admin/effective-access?permission=owner", nil, authHeaders(auditorToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+		resp = performJSONRequest(t, env.app, http.MethodGet, "/api/admin/effective-access", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+}
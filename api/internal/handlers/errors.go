@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Errors reported by more than one handler. Their codes are part of the API
+// contract: clients branch on them, so rename messages freely but never a
+// code. Handlers that need a status-only error can still call utils.Error,
+// which falls back to the generic code for the status.
+var (
+	errUnauthorized            = utils.NewError(fiber.StatusUnauthorized, "unauthorized", "unauthorized")
+	errInvalidCredentials      = utils.NewError(fiber.StatusUnauthorized, "invalid_credentials", "invalid credentials")
+	errInvalidMFAToken         = utils.NewError(fiber.StatusUnauthorized, "invalid_mfa_token", "invalid or expired MFA token")
+	errMFATokenUsed            = utils.NewError(fiber.StatusUnauthorized, "mfa_token_used", "MFA token already used")
+	errInvalidTOTPCode         = utils.NewError(fiber.StatusBadRequest, "invalid_totp_code", "invalid TOTP code")
+	errEmailRegistered         = utils.NewError(fiber.StatusConflict, "email_already_registered", "email already registered")
+	errInvalidBody             = utils.NewError(fiber.StatusBadRequest, "invalid_request_body", "invalid request body")
+	errInvalidCursor           = utils.NewError(fiber.StatusBadRequest, "invalid_cursor", "invalid cursor")
+	errInvalidNotifyTimeout    = utils.NewError(fiber.StatusBadRequest, "invalid_timeout", "timeout must be a duration between 1s and 90s")
+	errAccessDenied            = utils.NewError(fiber.StatusForbidden, "access_denied", "access denied")
+	errInsufficientPermissions = utils.NewError(fiber.StatusForbidden, "insufficient_permissions", "insufficient permissions")
+
+	errInvalidFileID      = utils.NewError(fiber.StatusBadRequest, "invalid_file_id", "invalid file id")
+	errFileNotFound       = utils.NewError(fiber.StatusNotFound, "file_not_found", "file not found")
+	errLoadingFile        = utils.NewError(fiber.StatusInternalServerError, "file_load_failed", "failed loading file")
+	errDirectoryNotFound  = utils.NewError(fiber.StatusNotFound, "directory_not_found", "directory not found")
+	errInvalidParentID    = utils.NewError(fiber.StatusBadRequest, "invalid_parent_id", "invalid parentID")
+	errParentNotFound     = utils.NewError(fiber.StatusNotFound, "parent_not_found", "parent folder not found")
+	errParentNotDirectory = utils.NewError(fiber.StatusBadRequest, "parent_not_directory", "parentID must be a directory")
+	errNotDirectory       = utils.NewError(fiber.StatusBadRequest, "not_a_directory", "file is not a directory")
+	errUploadTooLarge     = utils.NewError(fiber.StatusRequestEntityTooLarge, "upload_too_large", "file exceeds maximum upload size")
+	errUploadFinalized    = utils.NewError(fiber.StatusConflict, "upload_already_finalized", "upload already finalized")
+	errInvalidMultipart   = utils.NewError(fiber.StatusBadRequest, "invalid_multipart", "malformed multipart body")
+	errFileTypeNotAllowed = utils.NewError(fiber.StatusUnsupportedMediaType, "file_type_not_allowed", "file type is not allowed")
+	errQuotaExceeded      = utils.NewError(fiber.StatusInsufficientStorage, "storage_quota_exceeded", "organization storage quota exceeded")
+	errContentTooLarge    = utils.NewError(fiber.StatusRequestEntityTooLarge, "content_too_large", "content exceeds editor maximum")
+	errFileLocked         = utils.NewError(fiber.StatusLocked, "file_locked", "file is locked by another user")
+	errLockNotHeld        = utils.NewError(fiber.StatusForbidden, "lock_not_held", "lock is held by another user")
+	errVaultContent       = utils.NewError(fiber.StatusConflict, "vault_content", services.ErrVaultContent.Error())
+	errUploadBlocked      = utils.NewError(fiber.StatusForbidden, "upload_blocked", services.ErrUploadBlocked.Error())
+
+	errInvalidShareID = utils.NewError(fiber.StatusBadRequest, "invalid_share_id", "invalid share id")
+	errShareNotFound  = utils.NewError(fiber.StatusNotFound, "share_not_found", "share not found")
+
+	errViewOnlyPermission = utils.NewError(fiber.StatusBadRequest, "view_only_permission", "view-only shares must have view permission")
+	errViewOnly           = utils.NewError(fiber.StatusForbidden, "view_only", "this file is shared view-only; open its pages instead")
+
+	errInvitationNotFound = utils.NewError(fiber.StatusNotFound, "invitation_not_found", "invitation not found or expired")
+
+	errInvalidUserID     = utils.NewError(fiber.StatusBadRequest, "invalid_user_id", "invalid user id")
+	errUserNotFound      = utils.NewError(fiber.StatusNotFound, "user_not_found", "user not found")
+	errInvalidGroupID    = utils.NewError(fiber.StatusBadRequest, "invalid_group_id", "invalid group id")
+	errGroupNotFound     = utils.NewError(fiber.StatusNotFound, "group_not_found", "group not found")
+	errGroupAccessDenied = utils.NewError(fiber.StatusForbidden, "group_access_denied", "group access denied")
+	errMemberNotFound    = utils.NewError(fiber.StatusNotFound, "member_not_found", "member not found")
+	errPasskeyNotFound   = utils.NewError(fiber.StatusNotFound, "passkey_not_found", "passkey not found")
+	errPasskeyNotAllowed = utils.NewError(fiber.StatusForbidden, "passkey_not_allowed", "this passkey is not allowed by the passkey policy")
+
+	errRoleChangeForbidden   = utils.NewError(fiber.StatusForbidden, "role_change_forbidden", "only admins can change roles")
+	errAdministrativeAccount = utils.NewError(fiber.StatusForbidden, "administrative_account", "only admins can change accounts with an administrative role")
+
+	errDeviceNotFound       = utils.NewError(fiber.StatusNotFound, "device_not_found", "device not found")
+	errRecoveryDownloadGone = utils.NewError(fiber.StatusGone, "recovery_download_unavailable", "recovery codes can only be downloaded once, right after they are generated")
+
+	errTransferNotFound = utils.NewError(fiber.StatusNotFound, "transfer_not_found", "transfer not found")
+	errLoadingTransfer  = utils.NewError(fiber.StatusInternalServerError, "transfer_load_failed", "failed loading transfer")
+	errTransferExpired  = utils.NewError(fiber.StatusGone, "transfer_expired", "transfer has expired")
+	errTransferScanning = utils.NewError(fiber.StatusConflict, "transfer_scanning", "transfer is still being scanned")
+	errTransferBlocked  = utils.NewError(fiber.StatusGone, "transfer_blocked", "transfer was blocked because it contains malware")
+	errTransferFailed   = utils.NewError(fiber.StatusGone, "transfer_failed", "transfer failed its integrity check")
+
+	errInvalidOrganizationID = utils.NewError(fiber.StatusBadRequest, "invalid_organization_id", "invalid organization id")
+	errOrganizationNotFound  = utils.NewError(fiber.StatusNotFound, "organization_not_found", "organization not found")
+	errOrganizationSlugTaken = utils.NewError(fiber.StatusConflict, "organization_slug_taken", "organization slug already in use")
+	errOrganizationNotEmpty  = utils.NewError(fiber.StatusConflict, "organization_not_empty", "organization still has users")
+
+	errInvalidSSOProviderID = utils.NewError(fiber.StatusBadRequest, "invalid_sso_provider_id", "invalid SSO provider id")
+	errSSOProviderNotFound  = utils.NewError(fiber.StatusNotFound, "sso_provider_not_found", "SSO provider not found")
+	errSSOProviderExists    = utils.NewError(fiber.StatusConflict, "sso_provider_exists", "a provider of this type is already configured")
+
+	errInvalidJobID = utils.NewError(fiber.StatusBadRequest, "invalid_job_id", "invalid job id")
+	errJobNotFound  = utils.NewError(fiber.StatusNotFound, "job_not_found", "job not found")
+
+	errInvalidReconciliationID = utils.NewError(fiber.StatusBadRequest, "invalid_reconciliation_id", "invalid reconciliation id")
+	errReconciliationNotFound  = utils.NewError(fiber.StatusNotFound, "reconciliation_not_found", "storage reconciliation not found")
+
+	errInvalidIntegrityCheckID = utils.NewError(fiber.StatusBadRequest, "invalid_integrity_check_id", "invalid integrity check id")
+	errIntegrityCheckNotFound  = utils.NewError(fiber.StatusNotFound, "integrity_check_not_found", "integrity check not found")
+
+	errInvalidClassificationRuleID = utils.NewError(fiber.StatusBadRequest, "invalid_classification_rule_id", "invalid classification rule id")
+	errClassificationRuleNotFound  = utils.NewError(fiber.StatusNotFound, "classification_rule_not_found", "classification rule not found")
+	errInvalidClassificationRule   = utils.NewError(fiber.StatusBadRequest, "invalid_classification_rule", services.ErrClassificationRuleInvalid.Error())
+
+	errInvalidLegalExportID = utils.NewError(fiber.StatusBadRequest, "invalid_legal_export_id", "invalid legal export id")
+	errLegalExportNotFound  = utils.NewError(fiber.StatusNotFound, "legal_export_not_found", "legal export not found")
+	errInvalidLegalExport   = utils.NewError(fiber.StatusBadRequest, "invalid_legal_export", services.ErrLegalExportInvalid.Error())
+
+	errInvalidTermsID = utils.NewError(fiber.StatusBadRequest, "invalid_terms_id", "invalid terms id")
+	errInvalidTerms   = utils.NewError(fiber.StatusBadRequest, "invalid_terms", services.ErrTermsInvalid.Error())
+
+	errInvalidImportID = utils.NewError(fiber.StatusBadRequest, "invalid_import_id", "invalid import id")
+	errImportNotFound  = utils.NewError(fiber.StatusNotFound, "import_not_found", "import not found")
+
+	errInvalidSetting         = utils.NewError(fiber.StatusBadRequest, "invalid_setting", "invalid setting")
+	errIPPolicyLockout        = utils.NewError(fiber.StatusConflict, "ip_policy_lockout", "the admin IP policy would block your own address")
+	errPublicSharingOff       = utils.NewError(fiber.StatusForbidden, "public_sharing_disabled", "public sharing is turned off")
+	errRegistrationClosed     = utils.NewError(fiber.StatusForbidden, "registration_closed", "registration is closed")
+	errRegistrationInviteOnly = utils.NewError(fiber.StatusForbidden, "registration_invite_only", "registration requires an invitation")
+
+	errCaptchaUnavailable = utils.NewError(fiber.StatusBadGateway, "captcha_unavailable", "failed verifying the CAPTCHA")
+	errInvalidReportID    = utils.NewError(fiber.StatusBadRequest, "invalid_report_id", "invalid report id")
+	errReportNotFound     = utils.NewError(fiber.StatusNotFound, "report_not_found", "report not found")
+	errAvatarNotFound     = utils.NewError(fiber.StatusNotFound, "avatar_not_found", "avatar not found")
+	errUserSearchDisabled = utils.NewError(fiber.StatusForbidden, "user_search_disabled", "user search is disabled")
+)
+
+// serviceErrors maps sentinel errors from the services package to the API
+// error every handler reports them as.
+var serviceErrors = []struct {
+	target error
+	apiErr *utils.APIError
+}{
+	{services.ErrFileLocked, errFileLocked},
+	{services.ErrLockNotHeld, errLockNotHeld},
+	{services.ErrFileTypeNotAllowed, errFileTypeNotAllowed},
+	{services.ErrStorageQuotaExceeded, errQuotaExceeded},
+	{services.ErrArchiveNothingToArchive, utils.NewError(fiber.StatusConflict, "nothing_to_archive", services.ErrArchiveNothingToArchive.Error())},
+	{services.ErrFileNotArchived, utils.NewError(fiber.StatusConflict, "file_not_archived", services.ErrFileNotArchived.Error())},
+	{services.ErrGroupQuotaExceeded, utils.NewError(fiber.StatusInsufficientStorage, "group_quota_exceeded", services.ErrGroupQuotaExceeded.Error())},
+	{services.ErrPublicSharingDisabled, utils.NewError(fiber.StatusForbidden, "public_sharing_disabled", services.ErrPublicSharingDisabled.Error())},
+	{services.ErrPublicShareExpiryTooLong, utils.NewError(fiber.StatusBadRequest, "public_share_expiry_too_long", services.ErrPublicShareExpiryTooLong.Error())},
+	{services.ErrPublicSharePasswordRequired, utils.NewError(fiber.StatusForbidden, "public_share_password_required", services.ErrPublicSharePasswordRequired.Error())},
+	{services.ErrShareApprovalNotFound, utils.NewError(fiber.StatusNotFound, "share_approval_not_found", services.ErrShareApprovalNotFound.Error())},
+	{services.ErrShareApprovalDecided, utils.NewError(fiber.StatusConflict, "share_approval_decided", services.ErrShareApprovalDecided.Error())},
+	{services.ErrNotShareApprover, utils.NewError(fiber.StatusForbidden, "not_share_approver", services.ErrNotShareApprover.Error())},
+	{services.ErrOwnShareApproval, utils.NewError(fiber.StatusForbidden, "own_share_approval", services.ErrOwnShareApproval.Error())},
+	{services.ErrShareControlNotFound, utils.NewError(fiber.StatusNotFound, "share_control_not_found", services.ErrShareControlNotFound.Error())},
+	{services.ErrApprovedShareConflict, utils.NewError(fiber.StatusConflict, "public_share_exists", services.ErrApprovedShareConflict.Error())},
+	{services.ErrArchiveUnsupported, utils.NewError(fiber.StatusUnsupportedMediaType, "archive_not_supported", services.ErrArchiveUnsupported.Error())},
+	{services.ErrArchiveInvalid, utils.NewError(fiber.StatusUnprocessableEntity, "invalid_archive", services.ErrArchiveInvalid.Error())},
+	{services.ErrArchiveEntryNotFound, utils.NewError(fiber.StatusNotFound, "archive_entry_not_found", services.ErrArchiveEntryNotFound.Error())},
+	{services.ErrArchiveEntryDirectory, utils.NewError(fiber.StatusBadRequest, "archive_entry_is_directory", services.ErrArchiveEntryDirectory.Error())},
+	{services.ErrArchiveEntryTooLarge, utils.NewError(fiber.StatusRequestEntityTooLarge, "archive_entry_too_large", services.ErrArchiveEntryTooLarge.Error())},
+	{services.ErrArchiveBuildNotFound, utils.NewError(fiber.StatusNotFound, "archive_build_not_found", services.ErrArchiveBuildNotFound.Error())},
+	{services.ErrExtractionNotFound, utils.NewError(fiber.StatusNotFound, "extraction_not_found", services.ErrExtractionNotFound.Error())},
+	{services.ErrTextPreviewUnsupported, utils.NewError(fiber.StatusUnsupportedMediaType, "preview_not_supported", "file has no text preview")},
+	{services.ErrManifestTooLarge, utils.NewError(fiber.StatusUnprocessableEntity, "manifest_too_large", services.ErrManifestTooLarge.Error())},
+	{services.ErrChecksumUnavailable, utils.NewError(fiber.StatusServiceUnavailable, "checksum_unavailable", "failed computing file checksums")},
+	{services.ErrFormatNotSupported, utils.NewError(fiber.StatusBadRequest, "export_format_not_supported", "format not supported for this file type")},
+	{services.ErrJobNotFound, errJobNotFound},
+	{services.ErrJobNotFailed, utils.NewError(fiber.StatusConflict, "job_not_failed", services.ErrJobNotFailed.Error())},
+	{services.ErrJobAlreadyQueued, utils.NewError(fiber.StatusConflict, "job_already_queued", services.ErrJobAlreadyQueued.Error())},
+	{services.ErrReconcileNotFound, errReconciliationNotFound},
+	{services.ErrReconcileRunning, utils.NewError(fiber.StatusConflict, "reconciliation_in_progress", services.ErrReconcileRunning.Error())},
+	{services.ErrIntegrityCheckNotFound, errIntegrityCheckNotFound},
+	{services.ErrIntegrityCheckRunning, utils.NewError(fiber.StatusConflict, "integrity_check_in_progress", services.ErrIntegrityCheckRunning.Error())},
+	{services.ErrLegalExportNotFound, errLegalExportNotFound},
+	{services.ErrLegalExportNotReady, utils.NewError(fiber.StatusConflict, "legal_export_not_ready", services.ErrLegalExportNotReady.Error())},
+	{services.ErrLegalExportLinkInvalid, utils.NewError(fiber.StatusNotFound, "legal_export_link_invalid", services.ErrLegalExportLinkInvalid.Error())},
+	{services.ErrTermsNotFound, utils.NewError(fiber.StatusNotFound, "terms_not_found", services.ErrTermsNotFound.Error())},
+	{services.ErrTermsExists, utils.NewError(fiber.StatusConflict, "terms_version_exists", services.ErrTermsExists.Error())},
+	{services.ErrTermsRetired, utils.NewError(fiber.StatusConflict, "terms_retired", services.ErrTermsRetired.Error())},
+	{services.ErrTermsNotCurrent, utils.NewError(fiber.StatusConflict, "terms_not_current", services.ErrTermsNotCurrent.Error())},
+	{services.ErrImportNotFound, errImportNotFound},
+	{services.ErrImportNotResumable, utils.NewError(fiber.StatusConflict, "import_not_resumable", services.ErrImportNotResumable.Error())},
+	{services.ErrImportFinished, utils.NewError(fiber.StatusConflict, "import_finished", services.ErrImportFinished.Error())},
+	{services.ErrImportPathNotAllowed, utils.NewError(fiber.StatusForbidden, "import_path_not_allowed", services.ErrImportPathNotAllowed.Error())},
+	{services.ErrImportSourceMissing, utils.NewError(fiber.StatusBadRequest, "import_source_not_found", services.ErrImportSourceMissing.Error())},
+	{services.ErrIntegrationNotEnabled, utils.NewError(fiber.StatusConflict, "integration_not_enabled", services.ErrIntegrationNotEnabled.Error())},
+	{services.ErrIntegrationNotFound, utils.NewError(fiber.StatusNotFound, "integration_not_found", services.ErrIntegrationNotFound.Error())},
+	{services.ErrIntegrationState, utils.NewError(fiber.StatusBadRequest, "integration_state_invalid", services.ErrIntegrationState.Error())},
+	{services.ErrIntegrationAuth, utils.NewError(fiber.StatusBadGateway, "integration_auth_failed", services.ErrIntegrationAuth.Error())},
+	{services.ErrIntegrationInUse, utils.NewError(fiber.StatusConflict, "integration_in_use", services.ErrIntegrationInUse.Error())},
+	{services.ErrRemoteAddressNotAllowed, utils.NewError(fiber.StatusBadRequest, "remote_address_not_allowed", services.ErrRemoteAddressNotAllowed.Error())},
+	{services.ErrRemoteUnavailable, utils.NewError(fiber.StatusBadGateway, "remote_unavailable", services.ErrRemoteUnavailable.Error())},
+	{services.ErrTransferChunkInvalid, utils.NewError(fiber.StatusBadRequest, "transfer_chunk_invalid", services.ErrTransferChunkInvalid.Error())},
+	{services.ErrTransferIncomplete, utils.NewError(fiber.StatusConflict, "transfer_incomplete", services.ErrTransferIncomplete.Error())},
+	{services.ErrTransferNotReady, utils.NewError(fiber.StatusConflict, "transfer_not_ready", services.ErrTransferNotReady.Error())},
+	{services.ErrTransferLinkInvalid, utils.NewError(fiber.StatusNotFound, "transfer_link_invalid", services.ErrTransferLinkInvalid.Error())},
+	{services.ErrTransferLinkUsed, utils.NewError(fiber.StatusConflict, "transfer_link_used", services.ErrTransferLinkUsed.Error())},
+	{services.ErrTransferPINInvalid, utils.NewError(fiber.StatusForbidden, "transfer_pin_invalid", services.ErrTransferPINInvalid.Error())},
+	{services.ErrTransferLinkLocked, utils.NewError(fiber.StatusGone, "transfer_link_locked", services.ErrTransferLinkLocked.Error())},
+	{services.ErrTransferChecksumMismatch, utils.NewError(fiber.StatusUnprocessableEntity, "transfer_checksum_mismatch", services.ErrTransferChecksumMismatch.Error())},
+	{services.ErrCaptchaRequired, utils.NewError(fiber.StatusForbidden, "captcha_required", services.ErrCaptchaRequired.Error())},
+	{services.ErrCaptchaFailed, utils.NewError(fiber.StatusForbidden, "captcha_failed", services.ErrCaptchaFailed.Error())},
+	{services.ErrReportNotFound, errReportNotFound},
+	{services.ErrReportClosed, utils.NewError(fiber.StatusConflict, "report_closed", services.ErrReportClosed.Error())},
+	{services.ErrReportActioned, utils.NewError(fiber.StatusConflict, "report_actioned", services.ErrReportActioned.Error())},
+	{services.ErrReportFileDeleted, utils.NewError(fiber.StatusConflict, "report_file_deleted", services.ErrReportFileDeleted.Error())},
+	{services.ErrInvalidReportState, utils.NewError(fiber.StatusBadRequest, "invalid_report_status", services.ErrInvalidReportState.Error())},
+	{services.ErrInvalidModerationAction, utils.NewError(fiber.StatusBadRequest, "invalid_moderation_action", services.ErrInvalidModerationAction.Error())},
+	{services.ErrCannotSuspendSelf, utils.NewError(fiber.StatusBadRequest, "cannot_suspend_self", services.ErrCannotSuspendSelf.Error())},
+	{services.ErrFileNotQuarantined, utils.NewError(fiber.StatusConflict, "file_not_quarantined", services.ErrFileNotQuarantined.Error())},
+	{services.ErrGotenbergUnavailable, utils.NewError(fiber.StatusServiceUnavailable, "converter_unavailable", "document conversion is unavailable, retry later")},
+	{services.ErrRasterizerMissing, utils.NewError(fiber.StatusServiceUnavailable, "page_rendering_unavailable", services.ErrRasterizerMissing.Error())},
+	{services.ErrPageNotFound, utils.NewError(fiber.StatusNotFound, "page_not_found", "page not found")},
+	{services.ErrTileNotFound, utils.NewError(fiber.StatusNotFound, "tile_not_found", "tile not found")},
+	{services.ErrPandocMissing, utils.NewError(fiber.StatusServiceUnavailable, "export_converter_unavailable", "this format requires pandoc, which is not installed on the server")},
+	{services.ErrAvatarInvalid, utils.NewError(fiber.StatusUnsupportedMediaType, "avatar_invalid", services.ErrAvatarInvalid.Error())},
+	{services.ErrAvatarTooLarge, utils.NewError(fiber.StatusRequestEntityTooLarge, "avatar_too_large", services.ErrAvatarTooLarge.Error())},
+	{services.ErrAvatarNotFound, errAvatarNotFound},
+	{services.ErrPreviewTokenScope, utils.NewError(fiber.StatusForbidden, "preview_token_scope", services.ErrPreviewTokenScope.Error())},
+	{services.ErrPreviewTokenUsed, utils.NewError(fiber.StatusUnauthorized, "preview_token_used", services.ErrPreviewTokenUsed.Error())},
+	{services.ErrSigningKeyNotFound, utils.NewError(fiber.StatusNotFound, "signing_key_not_found", services.ErrSigningKeyNotFound.Error())},
+	{services.ErrSigningKeyRetired, utils.NewError(fiber.StatusConflict, "signing_key_retired", services.ErrSigningKeyRetired.Error())},
+	{services.ErrSigningKeyLastActive, utils.NewError(fiber.StatusConflict, "signing_key_last_active", services.ErrSigningKeyLastActive.Error())},
+	{services.ErrPublicLinkNotFound, utils.NewError(fiber.StatusNotFound, "public_link_not_found", services.ErrPublicLinkNotFound.Error())},
+	{services.ErrPublicPathNotFound, utils.NewError(fiber.StatusNotFound, "public_path_not_found", services.ErrPublicPathNotFound.Error())},
+	{services.ErrInvalidPublicPath, errInvalidPublicPath},
+	{services.ErrUserKeyInvalid, utils.NewError(fiber.StatusBadRequest, "invalid_public_key", services.ErrUserKeyInvalid.Error())},
+	{services.ErrUserKeyNotFound, utils.NewError(fiber.StatusNotFound, "key_not_found", services.ErrUserKeyNotFound.Error())},
+	{services.ErrVaultNotFound, utils.NewError(fiber.StatusNotFound, "vault_not_found", services.ErrVaultNotFound.Error())},
+	{services.ErrVaultKeyInvalid, utils.NewError(fiber.StatusBadRequest, "invalid_wrapped_key", services.ErrVaultKeyInvalid.Error())},
+	{services.ErrVaultKeysRequired, utils.NewError(fiber.StatusBadRequest, "vault_keys_required", services.ErrVaultKeysRequired.Error())},
+	{services.ErrVaultKeyNotOwned, utils.NewError(fiber.StatusBadRequest, "vault_key_not_owned", services.ErrVaultKeyNotOwned.Error())},
+	{services.ErrVaultNested, utils.NewError(fiber.StatusBadRequest, "vault_nested", services.ErrVaultNested.Error())},
+	{services.ErrVaultContent, errVaultContent},
+	{services.ErrVaultMove, utils.NewError(fiber.StatusBadRequest, "vault_move", services.ErrVaultMove.Error())},
+	{services.ErrVaultShareRootOnly, utils.NewError(fiber.StatusBadRequest, "vault_share_root_only", services.ErrVaultShareRootOnly.Error())},
+	{services.ErrVaultShareType, utils.NewError(fiber.StatusBadRequest, "vault_share_unsupported", services.ErrVaultShareType.Error())},
+	{services.ErrFilePasswordRequired, utils.NewError(fiber.StatusForbidden, "file_password_required", services.ErrFilePasswordRequired.Error())},
+	{services.ErrFilePasswordIncorrect, utils.NewError(fiber.StatusForbidden, "file_password_incorrect", services.ErrFilePasswordIncorrect.Error())},
+	{services.ErrFilePasswordInvalid, utils.NewError(fiber.StatusBadRequest, "invalid_file_password", services.ErrFilePasswordInvalid.Error())},
+	{services.ErrFilePasswordNotSet, utils.NewError(fiber.StatusBadRequest, "file_password_not_set", services.ErrFilePasswordNotSet.Error())},
+	{services.ErrUploadNotFound, utils.NewError(fiber.StatusNotFound, "upload_not_found", services.ErrUploadNotFound.Error())},
+	{services.ErrUploadExpired, utils.NewError(fiber.StatusGone, "upload_expired", services.ErrUploadExpired.Error())},
+	{services.ErrUploadOffsetMismatch, utils.NewError(fiber.StatusConflict, "upload_offset_mismatch", services.ErrUploadOffsetMismatch.Error())},
+	{services.ErrUploadLengthExceeded, utils.NewError(fiber.StatusRequestEntityTooLarge, "upload_length_exceeded", services.ErrUploadLengthExceeded.Error())},
+	{services.ErrUploadChecksumAlgorithm, utils.NewError(fiber.StatusBadRequest, "checksum_algorithm_unsupported", "unsupported or malformed Upload-Checksum")},
+	{services.ErrUploadChecksumMismatch, utils.NewError(statusChecksumMismatch, "checksum_mismatch", services.ErrUploadChecksumMismatch.Error())},
+	{services.ErrTemplateNotFound, utils.NewError(fiber.StatusNotFound, "template_not_found", services.ErrTemplateNotFound.Error())},
+	{services.ErrTemplateInvalid, utils.NewError(fiber.StatusBadRequest, "invalid_template", services.ErrTemplateInvalid.Error())},
+	{services.ErrTemplateTooLarge, utils.NewError(fiber.StatusUnprocessableEntity, "template_too_large", services.ErrTemplateTooLarge.Error())},
+	{services.ErrTemplateVariables, utils.NewError(fiber.StatusBadRequest, "template_variables_missing", services.ErrTemplateVariables.Error())},
+	{services.ErrPropertyDefinitionNotFound, utils.NewError(fiber.StatusNotFound, "property_not_found", services.ErrPropertyDefinitionNotFound.Error())},
+	{services.ErrPropertyDefinitionInvalid, utils.NewError(fiber.StatusBadRequest, "invalid_property", services.ErrPropertyDefinitionInvalid.Error())},
+	{services.ErrPropertyValueInvalid, utils.NewError(fiber.StatusBadRequest, "invalid_property_value", services.ErrPropertyValueInvalid.Error())},
+	{services.ErrReviewNotFound, utils.NewError(fiber.StatusNotFound, "review_not_found", services.ErrReviewNotFound.Error())},
+	{services.ErrReviewInvalid, utils.NewError(fiber.StatusBadRequest, "invalid_review", services.ErrReviewInvalid.Error())},
+	{services.ErrReviewInProgress, utils.NewError(fiber.StatusConflict, "review_in_progress", services.ErrReviewInProgress.Error())},
+	{services.ErrReviewClosed, utils.NewError(fiber.StatusConflict, "review_closed", services.ErrReviewClosed.Error())},
+	{services.ErrReviewDecided, utils.NewError(fiber.StatusConflict, "review_decided", services.ErrReviewDecided.Error())},
+	{services.ErrNotReviewer, utils.NewError(fiber.StatusForbidden, "not_reviewer", services.ErrNotReviewer.Error())},
+	{services.ErrOwnReview, utils.NewError(fiber.StatusForbidden, "own_review", services.ErrOwnReview.Error())},
+	{services.ErrReviewCancelDenied, utils.NewError(fiber.StatusForbidden, "review_cancel_denied", services.ErrReviewCancelDenied.Error())},
+	{services.ErrDueDateNotFound, utils.NewError(fiber.StatusNotFound, "due_date_not_found", services.ErrDueDateNotFound.Error())},
+	{services.ErrDueDateInvalid, utils.NewError(fiber.StatusBadRequest, "invalid_due_date", services.ErrDueDateInvalid.Error())},
+	{services.ErrCalendarFeedInvalid, utils.NewError(fiber.StatusNotFound, "calendar_feed_not_found", services.ErrCalendarFeedInvalid.Error())},
+	{services.ErrPasteInvalid, utils.NewError(fiber.StatusBadRequest, "invalid_paste", services.ErrPasteInvalid.Error())},
+	{services.ErrPasteTooLarge, utils.NewError(fiber.StatusRequestEntityTooLarge, "paste_too_large", services.ErrPasteTooLarge.Error())},
+	{services.ErrPasteRateLimited, utils.NewError(fiber.StatusTooManyRequests, "paste_rate_limited", services.ErrPasteRateLimited.Error())},
+	{services.ErrQRCodeInvalid, utils.NewError(fiber.StatusBadRequest, "invalid_qr", services.ErrQRCodeInvalid.Error())},
+	{middleware.ErrBodySignatureMismatch, middleware.ErrBodySignatureMismatch},
+	{services.ErrUploadBlocked, errUploadBlocked},
+}
+
+// serviceError resolves err to the API error it should be reported as, or
+// returns fallback when err is not a known service error.
+func serviceError(err error, fallback *utils.APIError) *utils.APIError {
+	for _, m := range serviceErrors {
+		if errors.Is(err, m.target) {
+			return m.apiErr
+		}
+	}
+	return fallback
+}
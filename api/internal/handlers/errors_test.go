@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestErrorEnvelopeCarriesCodeAndRequestID(t *testing.T) {
+	env := setupTestEnv(t)
+	_, token := createTestUser(t, env.db, "codes@test.com", "password123", models.UserRoleUser)
+
+	t.Run("typed error", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/"+uuid.NewString(), nil, authHeaders(token))
+		assertStatus(t, resp, http.StatusNotFound)
+		requestID := resp.Header.Get("X-Request-ID")
+		body := decodeJSONMap(t, resp)
+		assertEnvelopeError(t, body, "file not found")
+		if body["code"] != "file_not_found" {
+			t.Fatalf("expected code file_not_found, got %v", body["code"])
+		}
+		if requestID == "" || body["requestID"] != requestID {
+			t.Fatalf("expected requestID %q in body, got %v", requestID, body["requestID"])
+		}
+	})
+
+	t.Run("inbound request ID is echoed", func(t *testing.T) {
+		headers := authHeaders(token)
+		headers["X-Request-ID"] = "trace-abc123"
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/not-a-uuid", nil, headers)
+		assertStatus(t, resp, http.StatusBadRequest)
+		body := decodeJSONMap(t, resp)
+		if body["code"] != "invalid_file_id" || body["requestID"] != "trace-abc123" {
+			t.Fatalf("unexpected envelope %+v", body)
+		}
+	})
+
+	t.Run("middleware errors", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files", nil, authHeaders("garbage"))
+		assertStatus(t, resp, http.StatusUnauthorized)
+		body := decodeJSONMap(t, resp)
+		if body["code"] != "invalid_token" || body["requestID"] == nil {
+			t.Fatalf("unexpected envelope %+v", body)
+		}
+	})
+
+	t.Run("unknown route", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/does-not-exist", nil, nil)
+		assertStatus(t, resp, http.StatusNotFound)
+		body := decodeJSONMap(t, resp)
+		if body["code"] != "not_found" || body["requestID"] == nil {
+			t.Fatalf("unexpected envelope %+v", body)
+		}
+	})
+}
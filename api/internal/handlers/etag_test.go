@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestFilesHandler_ETags(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "etag-owner@test.com", "password123", models.UserRoleUser)
+	other, _ := createTestUser(t, env.db, "etag-other@test.com", "password123", models.UserRoleUser)
+
+	folder := models.File{Name: "Folder", MimeType: "inode/directory", IsDirectory: true, OwnerID: owner.ID}
+	if err := env.db.Create(&folder).Error; err != nil {
+		t.Fatalf("failed creating folder: %v", err)
+	}
+	child := models.File{Name: "a.txt", MimeType: "text/plain", Size: 1, OwnerID: owner.ID, ParentID: &folder.ID, StoragePath: "a"}
+	if err := env.db.Create(&child).Error; err != nil {
+		t.Fatalf("failed creating child: %v", err)
+	}
+
+	conditional := func(path, etag string, headers map[string]string) *http.Response {
+		h := map[string]string{}
+		for k, v := range headers {
+			h[k] = v
+		}
+		if etag != "" {
+			h["If-None-Match"] = etag
+		}
+		return performRequest(t, env.app, http.MethodGet, path, nil, h)
+	}
+
+	t.Run("GET /api/files/:id returns 304 for matching ETag", func(t *testing.T) {
+		resp := conditional("/api/files/"+child.ID.String(), "", authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		etag := resp.Header.Get("ETag")
+		if etag == "" {
+			t.Fatal("expected ETag header")
+		}
+
+		resp = conditional("/api/files/"+child.ID.String(), etag, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusNotModified)
+
+		if err := env.db.Model(&child).Update("name", "b.txt").Error; err != nil {
+			t.Fatalf("failed renaming: %v", err)
+		}
+		resp = conditional("/api/files/"+child.ID.String(), etag, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+	})
+
+	t.Run("GET /api/files/:id/children tracks listing changes", func(t *testing.T) {
+		path := "/api/files/" + folder.ID.String() + "/children"
+		resp := conditional(path, "", authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		etag := resp.Header.Get("ETag")
+
+		resp = conditional(path, etag, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusNotModified)
+
+		resp = conditional(path+"?sort=size", etag, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+
+		if err := env.db.Create(&models.Share{FileID: child.ID, SharedByID: owner.ID, SharedWithUserID: &other.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView}).Error; err != nil {
+			t.Fatalf("failed creating share: %v", err)
+		}
+		resp = conditional(path, etag, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		etag = resp.Header.Get("ETag")
+
+		if err := env.db.Delete(&child).Error; err != nil {
+			t.Fatalf("failed deleting child: %v", err)
+		}
+		resp = conditional(path, etag, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+	})
+
+	t.Run("GET /api/public/files/:id honours If-None-Match", func(t *testing.T) {
+		if err := env.db.Create(&models.Share{FileID: folder.ID, SharedByID: owner.ID, ShareType: models.ShareTypePublicAnyone, Permission: models.SharePermissionView}).Error; err != nil {
+			t.Fatalf("failed creating public share: %v", err)
+		}
+		resp := conditional("/api/public/files/"+folder.ID.String(), "", nil)
+		assertStatus(t, resp, http.StatusOK)
+		etag := resp.Header.Get("ETag")
+
+		resp = conditional("/api/public/files/"+folder.ID.String(), etag, nil)
+		assertStatus(t, resp, http.StatusNotModified)
+	})
+
+	t.Run("GET /api/files/:id access check precedes ETag", func(t *testing.T) {
+		resp := conditional("/api/files/"+folder.ID.String(), "*", nil)
+		assertStatus(t, resp, http.StatusUnauthorized)
+	})
+}
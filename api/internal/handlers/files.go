@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"mime"
+	"mime/multipart"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -45,13 +48,131 @@ type FilesHandler struct {
 	Access         *services.AccessService
 	PreviewService *services.PreviewService
 	PreviewQueue   *services.PreviewQueueService
+	TextPreview    *services.TextPreviewService
 	ExportService  *services.ExportService
 	Audit          *services.AuditService
+	Locks          *services.LockService
+	Manifests      *services.ManifestService
+	UploadPolicy   *services.UploadPolicy
+	Analytics      *services.FileAnalyticsService
+	Downloads      *services.DownloadLimiter
 	MaxUploadBytes int64
+	// Settings, when set, lets admins change the upload limit at runtime;
+	// MaxUploadBytes is used otherwise.
+	Settings *services.SettingsService
+	// Captcha, when set, gates anonymous downloads of public shares.
+	Captcha *services.CaptchaService
+	// Renditions, when set, serves scaled images and leading PDF pages
+	// from ProxyPreview.
+	Renditions *services.RenditionService
+	// PreviewTokens issues the tokens PreviewURL hands out and
+	// ProxyPreview redeems.
+	PreviewTokens *services.PreviewTokens
+	// Vaults stores the wrapped key of new encrypted folders; without it
+	// they cannot be created.
+	Vaults *services.Vaults
+	// Passwords checks per-file passwords on download and preview.
+	Passwords *services.FilePasswords
+	// Uploads holds resumable uploads sent over /tus; without it they are
+	// refused.
+	Uploads *services.ResumableUploads
+	// Classifier applies the admin's classification rules to new uploads;
+	// without it uploads are stored as they are.
+	Classifier *services.Classifier
+	// GroupQuotas, when set, holds uploads to the storage quotas of the
+	// groups they count against.
+	GroupQuotas *services.GroupQuotas
+	// Archiver moves files to cold storage and back; without it archiving
+	// is refused.
+	Archiver *services.ColdStorage
+	// Regions, when set, serves downloads from the nearest healthy replica
+	// of the bucket.
+	Regions *storage.RegionRouter
+	// ArchiveContents lists ZIP and TAR archives and extracts single
+	// entries from them.
+	ArchiveContents *services.ArchiveContents
+	// Extractor unpacks whole archives into folders; without it extraction
+	// is refused.
+	Extractor *services.ArchiveExtractor
+	// ArchiveBuilder packs a selection of files into a new ZIP file.
+	ArchiveBuilder *services.ArchiveBuilder
+	// Properties holds the custom property values of files.
+	Properties *services.Properties
+	// Reviews runs the review workflow on files.
+	Reviews *services.Reviews
+	// DueDates keeps the due dates of files and reminds people of them.
+	DueDates *services.DueDates
+	// Pastes makes files from pasted text. FrontendURL is where the
+	// public links to them point.
+	Pastes      *services.Pastes
+	FrontendURL string
 }
 
-func NewFilesHandler(db *gorm.DB, storageClient *storage.S3Client, access *services.AccessService, preview *services.PreviewService, previewQueue *services.PreviewQueueService, export *services.ExportService, audit *services.AuditService, maxUploadBytes int64) *FilesHandler {
-	return &FilesHandler{DB: db, Storage: storageClient, Access: access, PreviewService: preview, PreviewQueue: previewQueue, ExportService: export, Audit: audit, MaxUploadBytes: maxUploadBytes}
+func NewFilesHandler(db *gorm.DB, storageClient *storage.S3Client, access *services.AccessService, preview *services.PreviewService, previewQueue *services.PreviewQueueService, textPreview *services.TextPreviewService, export *services.ExportService, audit *services.AuditService, locks *services.LockService, manifests *services.ManifestService, uploadPolicy *services.UploadPolicy, analytics *services.FileAnalyticsService, downloads *services.DownloadLimiter, maxUploadBytes int64) *FilesHandler {
+	return &FilesHandler{DB: db, Storage: storageClient, Access: access, PreviewService: preview, PreviewQueue: previewQueue, TextPreview: textPreview, ExportService: export, Audit: audit, Locks: locks, Manifests: manifests, UploadPolicy: uploadPolicy, Analytics: analytics, Downloads: downloads, MaxUploadBytes: maxUploadBytes, Passwords: services.NewFilePasswords(db), Properties: services.NewProperties(db), Reviews: services.NewReviews(db)}
+}
+
+// maxUploadBytes is the largest upload currently accepted, 0 meaning no
+// limit.
+func (h *FilesHandler) maxUploadBytes(ctx context.Context) int64 {
+	if h.Settings != nil {
+		return h.Settings.MaxUploadBytes(ctx)
+	}
+	return h.MaxUploadBytes
+}
+
+// rejectUpload logs a policy rejection and writes the 415 response.
+func (h *FilesHandler) rejectUpload(c *fiber.Ctx, userID uuid.UUID, filename string, err error) error {
+	return utils.Fail(c, uploadRejection(userID, filename, err))
+}
+
+// uploadRejection logs a policy rejection and returns the 415 error.
+func uploadRejection(userID uuid.UUID, filename string, err error) *utils.APIError {
+	logger.WarnWithUser(userID.String(), "upload_type_rejected", map[string]interface{}{
+		"file_name": filename,
+		"reason":    err.Error(),
+	})
+	return errFileTypeNotAllowed.WithMessage(err.Error())
+}
+
+// checkQuota returns the error to report when storing size more bytes would
+// take the organization over its storage quota, or nil.
+func (h *FilesHandler) checkQuota(c *fiber.Ctx, orgID *uuid.UUID, size int64) *utils.APIError {
+	if size <= 0 {
+		return nil
+	}
+	if err := services.CheckStorageQuota(c.Context(), h.DB, orgID, size); err != nil {
+		return serviceError(err, utils.NewError(fiber.StatusInternalServerError, "quota_check_failed", "failed checking storage quota"))
+	}
+	return nil
+}
+
+// checkGroupQuota returns the error to report when ownerID storing size
+// more bytes under parentID would take a group over its quota, or nil.
+func (h *FilesHandler) checkGroupQuota(c *fiber.Ctx, ownerID uuid.UUID, parentID *uuid.UUID, size int64) *utils.APIError {
+	if h.GroupQuotas == nil || size <= 0 {
+		return nil
+	}
+	if err := h.GroupQuotas.Check(c.Context(), ownerID, parentID, size); err != nil {
+		return serviceError(err, utils.NewError(fiber.StatusInternalServerError, "quota_check_failed", "failed checking storage quota"))
+	}
+	return nil
+}
+
+// sniffObject returns the detected type of a stored object from its first
+// bytes.
+func (h *FilesHandler) sniffObject(ctx context.Context, objectName string) (string, error) {
+	obj, err := h.Storage.Download(ctx, objectName)
+	if err != nil {
+		return "", err
+	}
+	defer obj.Close()
+	head := make([]byte, services.SniffLength)
+	n, err := io.ReadFull(obj, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	return services.DetectContentType(head[:n]), nil
 }
 
 // maybeEnqueueImageThumbnail fires the preview pipeline for image uploads so
@@ -60,7 +181,7 @@ func NewFilesHandler(db *gorm.DB, storageClient *storage.S3Client, access *servi
 // itself. PreviewQueue.Enqueue already deduplicates by file_id, so racing
 // callers (e.g. multi-tab uploads) won't double-up.
 func (h *FilesHandler) maybeEnqueueImageThumbnail(file *models.File, requestedBy *uuid.UUID) {
-	if file == nil || file.IsDirectory {
+	if file == nil || file.IsDirectory || file.VaultID != nil {
 		return
 	}
 	if h.PreviewQueue == nil {
@@ -105,104 +226,140 @@ func resolveMimeType(filename, declared string) string {
 	return contentType
 }
 
+// Upload stores a file sent as multipart/form-data. The body is streamed
+// straight to object storage part by part, so the file is never held in
+// memory or spooled to disk. Form fields may come before or after the file;
+// parentID is checked before the file is stored when it comes first.
 func (h *FilesHandler) Upload(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
-	fileHeader, err := c.FormFile("file")
-	if err != nil {
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	if boundary == "" {
 		return utils.Error(c, fiber.StatusBadRequest, "file is required")
 	}
+	if apiErr := h.checkQuota(c, currentUser.OrganizationID, 1); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
 
 	var parentID *uuid.UUID
-	parentIDRaw := strings.TrimSpace(c.FormValue("parentID"))
-	if parentIDRaw != "" {
-		parsed, parseErr := parseUUID(parentIDRaw)
-		if parseErr != nil {
-			return utils.Error(c, fiber.StatusBadRequest, "invalid parentID")
+	var upload *streamedUpload
+	// fail removes an already stored file when a later part of the form
+	// turns out to be invalid.
+	fail := func(apiErr *utils.APIError) error {
+		if upload != nil {
+			_ = h.Storage.Delete(c.Context(), upload.ObjectName)
 		}
-		parentID = &parsed
+		if middleware.SignedBodyRejected(c) {
+			apiErr = middleware.ErrBodySignatureMismatch
+		}
+		return utils.Fail(c, apiErr)
+	}
 
-		var parent models.File
-		if err := h.DB.First(&parent, "id = ?", parsed).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				return utils.Error(c, fiber.StatusNotFound, "parent folder not found")
-			}
-			return utils.Error(c, fiber.StatusInternalServerError, "failed validating parent folder")
+	form := multipart.NewReader(requestBodyStream(c), boundary)
+	for {
+		part, err := form.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
 		}
-		if !parent.IsDirectory {
-			return utils.Error(c, fiber.StatusBadRequest, "parentID must be a directory")
+		if err != nil {
+			return fail(errInvalidMultipart)
 		}
-		if !h.Access.HasAccess(c.Context(), currentUser.ID, parent.ID, models.SharePermissionEdit) {
-			logger.WarnWithUser(currentUser.ID.String(), "permission_denied", map[string]interface{}{
-				"action":              "file_upload",
-				"target_id":           parent.ID.String(),
-				"required_permission": "edit",
-			})
-			return utils.Error(c, fiber.StatusForbidden, "no permission to upload to parent directory")
+
+		switch part.FormName() {
+		case "parentID":
+			raw, err := readFormValue(part)
+			if err != nil {
+				return fail(errInvalidMultipart)
+			}
+			var apiErr *utils.APIError
+			if parentID, apiErr = h.uploadParent(c, currentUser, raw); apiErr != nil {
+				return fail(apiErr)
+			}
+		case "file":
+			if upload != nil {
+				return fail(errInvalidMultipart.WithMessage("only one file can be uploaded per request"))
+			}
+			var apiErr *utils.APIError
+			if upload, apiErr = h.streamUpload(c, currentUser, part); apiErr != nil {
+				return fail(apiErr)
+			}
 		}
+		part.Close()
 	}
-
-	stream, err := fileHeader.Open()
-	if err != nil {
-		return utils.Error(c, fiber.StatusInternalServerError, "failed opening uploaded file")
+	if upload == nil {
+		return utils.Error(c, fiber.StatusBadRequest, "file is required")
 	}
-	defer stream.Close()
-
-	filename := filepath.Base(strings.TrimSpace(fileHeader.Filename))
-	if filename == "" {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid filename")
+	if err := middleware.VerifySignedBody(c); err != nil {
+		return fail(middleware.ErrBodySignatureMismatch)
 	}
-
-	contentType := resolveMimeType(filename, fileHeader.Header.Get("Content-Type"))
-
-	objectName := fmt.Sprintf("%s/%s/%s", currentUser.ID.String(), uuid.New().String(), filename)
-	if err := h.Storage.Upload(c.Context(), objectName, stream, fileHeader.Size, contentType); err != nil {
-		return utils.Error(c, fiber.StatusInternalServerError, "failed uploading file")
+	if apiErr := h.checkQuota(c, currentUser.OrganizationID, upload.Size); apiErr != nil {
+		return fail(apiErr)
 	}
 
 	entry := models.File{
-		Name:        filename,
-		MimeType:    contentType,
-		Size:        fileHeader.Size,
-		IsDirectory: false,
-		ParentID:    parentID,
-		OwnerID:     currentUser.ID,
-		StoragePath: objectName,
-	}
-
-	if err := h.DB.Create(&entry).Error; err != nil {
-		_ = h.Storage.Delete(c.Context(), objectName)
-		return utils.Error(c, fiber.StatusInternalServerError, "failed creating file record")
+		Name:             upload.Filename,
+		MimeType:         upload.ContentType,
+		DeclaredMimeType: upload.DeclaredType,
+		DetectedMimeType: upload.DetectedType,
+		Size:             upload.Size,
+		IsDirectory:      false,
+		ParentID:         parentID,
+		OwnerID:          currentUser.ID,
+		OrganizationID:   currentUser.OrganizationID,
+		StoragePath:      upload.ObjectName,
+		Checksum:         &upload.Checksum,
+	}
+	classification, apiErr := h.classifyUpload(c, currentUser, &entry)
+	if apiErr != nil {
+		return fail(apiErr)
+	}
+	parentID = entry.ParentID
+	if apiErr := h.checkGroupQuota(c, currentUser.ID, parentID, upload.Size); apiErr != nil {
+		return fail(apiErr)
 	}
 
-	logger.InfoWithUser(currentUser.ID.String(), "file_uploaded", map[string]interface{}{
-		"file_id":      entry.ID.String(),
-		"file_name":    filename,
-		"file_size":    fileHeader.Size,
-		"mime_type":    contentType,
-		"storage_path": objectName,
-		"parent_id":    parentID,
-	})
-
 	auditDetails := map[string]interface{}{
-		"file_name": filename,
-		"file_size": fileHeader.Size,
-		"mime_type": contentType,
+		"file_name":          upload.Filename,
+		"file_size":          upload.Size,
+		"mime_type":          upload.ContentType,
+		"detected_mime_type": upload.DetectedType,
 	}
 	if parentID != nil {
 		auditDetails["parent_id"] = parentID.String()
 	}
-	h.Audit.LogAsync(services.AuditEntry{
-		UserID:       &currentUser.ID,
-		Action:       "file.upload",
-		ResourceType: "file",
-		ResourceID:   &entry.ID,
-		Details:      auditDetails,
-		IPAddress:    c.IP(),
-		RequestID:    getRequestID(c),
+	if key := middleware.GetIdempotencyKey(c); key != "" {
+		auditDetails["idempotency_key"] = key
+	}
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		if err := services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "file.upload",
+			ResourceType: "file",
+			ResourceID:   &entry.ID,
+			Details:      auditDetails,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		}); err != nil {
+			return err
+		}
+		return h.recordClassification(c, tx, currentUser, &entry, classification)
+	}); err != nil {
+		return fail(utils.NewError(fiber.StatusInternalServerError, "internal_error", "failed creating file record"))
+	}
+
+	logger.InfoWithUser(currentUser.ID.String(), "file_uploaded", map[string]interface{}{
+		"file_id":      entry.ID.String(),
+		"file_name":    upload.Filename,
+		"file_size":    upload.Size,
+		"mime_type":    upload.ContentType,
+		"storage_path": upload.ObjectName,
+		"parent_id":    parentID,
 	})
 
 	h.maybeEnqueueImageThumbnail(&entry, &currentUser.ID)
@@ -226,12 +383,12 @@ type presignUploadResponse struct {
 func (h *FilesHandler) PresignUpload(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var req presignUploadRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	filename := filepath.Base(strings.TrimSpace(req.Name))
@@ -242,28 +399,36 @@ func (h *FilesHandler) PresignUpload(c *fiber.Ctx) error {
 	if req.Size <= 0 {
 		return utils.Error(c, fiber.StatusBadRequest, "size must be positive")
 	}
-	if h.MaxUploadBytes > 0 && req.Size > h.MaxUploadBytes {
-		return utils.Error(c, fiber.StatusRequestEntityTooLarge, fmt.Sprintf("file exceeds maximum upload size of %d bytes", h.MaxUploadBytes))
+	if maxUpload := h.maxUploadBytes(c.Context()); maxUpload > 0 && req.Size > maxUpload {
+		return utils.Fail(c, errUploadTooLarge.WithMessage(fmt.Sprintf("file exceeds maximum upload size of %d bytes", maxUpload)))
 	}
 	if req.Size > s3SinglePutMaxBytes {
-		return utils.Error(c, fiber.StatusRequestEntityTooLarge, fmt.Sprintf("file exceeds 5 GiB single-PUT limit for pre-signed uploads (got %d bytes)", req.Size))
+		return utils.Fail(c, errUploadTooLarge.WithMessage(fmt.Sprintf("file exceeds 5 GiB single-PUT limit for pre-signed uploads (got %d bytes)", req.Size)))
+	}
+	// The content is only seen at finalize; reject what the name and
+	// declared type already rule out before handing out a URL.
+	if err := h.UploadPolicy.Check(filename, resolveMimeType(filename, req.MimeType), ""); err != nil {
+		return h.rejectUpload(c, currentUser.ID, filename, err)
+	}
+	if apiErr := h.checkQuota(c, currentUser.OrganizationID, req.Size); apiErr != nil {
+		return utils.Fail(c, apiErr)
 	}
 
 	var parentID *uuid.UUID
 	if req.ParentID != nil && strings.TrimSpace(*req.ParentID) != "" {
 		parsed, parseErr := parseUUID(strings.TrimSpace(*req.ParentID))
 		if parseErr != nil {
-			return utils.Error(c, fiber.StatusBadRequest, "invalid parentID")
+			return utils.Fail(c, errInvalidParentID)
 		}
 		var parent models.File
 		if err := h.DB.First(&parent, "id = ?", parsed).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return utils.Error(c, fiber.StatusNotFound, "parent folder not found")
+				return utils.Fail(c, errParentNotFound)
 			}
 			return utils.Error(c, fiber.StatusInternalServerError, "failed validating parent folder")
 		}
 		if !parent.IsDirectory {
-			return utils.Error(c, fiber.StatusBadRequest, "parentID must be a directory")
+			return utils.Fail(c, errParentNotDirectory)
 		}
 		if !h.Access.HasAccess(c.Context(), currentUser.ID, parent.ID, models.SharePermissionEdit) {
 			logger.WarnWithUser(currentUser.ID.String(), "permission_denied", map[string]interface{}{
@@ -275,6 +440,9 @@ func (h *FilesHandler) PresignUpload(c *fiber.Ctx) error {
 		}
 		parentID = &parent.ID
 	}
+	if apiErr := h.checkGroupQuota(c, currentUser.ID, parentID, req.Size); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
 
 	// Issue the URL against the staging prefix; finalize will copy the object
 	// out of staging so this URL no longer addresses live content. Sign
@@ -315,12 +483,12 @@ type finalizeUploadRequest struct {
 func (h *FilesHandler) FinalizeUpload(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var req finalizeUploadRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	rawKey := strings.TrimSpace(req.Key)
@@ -353,17 +521,17 @@ func (h *FilesHandler) FinalizeUpload(c *fiber.Ctx) error {
 	if req.ParentID != nil && strings.TrimSpace(*req.ParentID) != "" {
 		parsed, parseErr := parseUUID(strings.TrimSpace(*req.ParentID))
 		if parseErr != nil {
-			return utils.Error(c, fiber.StatusBadRequest, "invalid parentID")
+			return utils.Fail(c, errInvalidParentID)
 		}
 		var parent models.File
 		if err := h.DB.First(&parent, "id = ?", parsed).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return utils.Error(c, fiber.StatusNotFound, "parent folder not found")
+				return utils.Fail(c, errParentNotFound)
 			}
 			return utils.Error(c, fiber.StatusInternalServerError, "failed validating parent folder")
 		}
 		if !parent.IsDirectory {
-			return utils.Error(c, fiber.StatusBadRequest, "parentID must be a directory")
+			return utils.Fail(c, errParentNotDirectory)
 		}
 		if !h.Access.HasAccess(c.Context(), currentUser.ID, parent.ID, models.SharePermissionEdit) {
 			logger.WarnWithUser(currentUser.ID.String(), "permission_denied", map[string]interface{}{
@@ -385,7 +553,7 @@ func (h *FilesHandler) FinalizeUpload(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed checking file existence")
 	}
 	if existing > 0 {
-		return utils.Error(c, fiber.StatusConflict, "upload already finalized")
+		return utils.Fail(c, errUploadFinalized)
 	}
 
 	info, statErr := h.Storage.StatObject(c.Context(), stagingKey)
@@ -401,21 +569,51 @@ func (h *FilesHandler) FinalizeUpload(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed verifying uploaded object")
 	}
 
-	if h.MaxUploadBytes > 0 && info.Size > h.MaxUploadBytes {
+	if maxUpload := h.maxUploadBytes(c.Context()); maxUpload > 0 && info.Size > maxUpload {
 		_ = h.Storage.Delete(c.Context(), stagingKey)
-		return utils.Error(c, fiber.StatusRequestEntityTooLarge, fmt.Sprintf("file exceeds maximum upload size of %d bytes", h.MaxUploadBytes))
+		return utils.Fail(c, errUploadTooLarge.WithMessage(fmt.Sprintf("file exceeds maximum upload size of %d bytes", maxUpload)))
 	}
 
 	contentType := resolveMimeType(filename, req.MimeType)
 
+	detectedType, sniffErr := h.sniffObject(c.Context(), stagingKey)
+	if sniffErr != nil {
+		logger.Error("s3_sniff_failed", sniffErr, map[string]interface{}{
+			"object_name": stagingKey,
+			"user_id":     currentUser.ID.String(),
+		})
+		return utils.Error(c, fiber.StatusInternalServerError, "failed inspecting uploaded object")
+	}
+	if err := h.UploadPolicy.Check(filename, contentType, detectedType); err != nil {
+		_ = h.Storage.Delete(c.Context(), stagingKey)
+		return h.rejectUpload(c, currentUser.ID, filename, err)
+	}
+	if apiErr := h.checkQuota(c, currentUser.OrganizationID, info.Size); apiErr != nil {
+		_ = h.Storage.Delete(c.Context(), stagingKey)
+		return utils.Fail(c, apiErr)
+	}
+
 	entry := models.File{
-		Name:        filename,
-		MimeType:    contentType,
-		Size:        info.Size,
-		IsDirectory: false,
-		ParentID:    parentID,
-		OwnerID:     currentUser.ID,
-		StoragePath: finalKey,
+		Name:             filename,
+		MimeType:         contentType,
+		DeclaredMimeType: req.MimeType,
+		DetectedMimeType: detectedType,
+		Size:             info.Size,
+		IsDirectory:      false,
+		ParentID:         parentID,
+		OwnerID:          currentUser.ID,
+		OrganizationID:   currentUser.OrganizationID,
+		StoragePath:      finalKey,
+	}
+	classification, apiErr := h.classifyUpload(c, currentUser, &entry)
+	if apiErr != nil {
+		_ = h.Storage.Delete(c.Context(), stagingKey)
+		return utils.Fail(c, apiErr)
+	}
+	parentID = entry.ParentID
+	if apiErr := h.checkGroupQuota(c, currentUser.ID, parentID, info.Size); apiErr != nil {
+		_ = h.Storage.Delete(c.Context(), stagingKey)
+		return utils.Fail(c, apiErr)
 	}
 
 	// Claim → copy → commit. Inserting the row first inside a transaction
@@ -428,15 +626,39 @@ func (h *FilesHandler) FinalizeUpload(c *fiber.Ctx) error {
 	// stats. The MatchETag pinned on the copy further guarantees that the
 	// bytes we land at finalKey are the ones we stat'd, even if the staging
 	// key is overwritten between stat and copy.
+	auditDetails := map[string]interface{}{
+		"file_name":          filename,
+		"file_size":          info.Size,
+		"mime_type":          contentType,
+		"detected_mime_type": detectedType,
+		"upload_mode":        "presigned",
+	}
+	if parentID != nil {
+		auditDetails["parent_id"] = parentID.String()
+	}
 	txErr := h.DB.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(&entry).Error; err != nil {
 			return err
 		}
+		if err := services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "file.upload",
+			ResourceType: "file",
+			ResourceID:   &entry.ID,
+			Details:      auditDetails,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		}); err != nil {
+			return err
+		}
+		if err := h.recordClassification(c, tx, currentUser, &entry, classification); err != nil {
+			return err
+		}
 		return h.Storage.CopyObject(c.Context(), finalKey, stagingKey, info.ETag)
 	})
 	if txErr != nil {
 		if errors.Is(txErr, gorm.ErrDuplicatedKey) {
-			return utils.Error(c, fiber.StatusConflict, "upload already finalized")
+			return utils.Fail(c, errUploadFinalized)
 		}
 		// Either the copy failed or another DB error fired. The transaction
 		// rolled back the row, but the copy may have partially written to
@@ -468,25 +690,6 @@ func (h *FilesHandler) FinalizeUpload(c *fiber.Ctx) error {
 		"upload_mode":  "presigned",
 	})
 
-	auditDetails := map[string]interface{}{
-		"file_name":   filename,
-		"file_size":   info.Size,
-		"mime_type":   contentType,
-		"upload_mode": "presigned",
-	}
-	if parentID != nil {
-		auditDetails["parent_id"] = parentID.String()
-	}
-	h.Audit.LogAsync(services.AuditEntry{
-		UserID:       &currentUser.ID,
-		Action:       "file.upload",
-		ResourceType: "file",
-		ResourceID:   &entry.ID,
-		Details:      auditDetails,
-		IPAddress:    c.IP(),
-		RequestID:    getRequestID(c),
-	})
-
 	h.maybeEnqueueImageThumbnail(&entry, &currentUser.ID)
 
 	return utils.Success(c, fiber.StatusCreated, entry)
@@ -496,17 +699,21 @@ func (h *FilesHandler) FinalizeUpload(c *fiber.Ctx) error {
 type createDirectoryRequest struct {
 	Name     string  `json:"name"`
 	ParentID *string `json:"parentID"`
+	// Vault makes the folder end-to-end encrypted. VaultKeys holds the new
+	// folder key, generated by the client, wrapped for the creator's keys.
+	Vault     bool                  `json:"vault"`
+	VaultKeys []services.WrappedKey `json:"vaultKeys"`
 }
 
 func (h *FilesHandler) CreateDirectory(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var req createDirectoryRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	name := strings.TrimSpace(req.Name)
@@ -514,74 +721,116 @@ func (h *FilesHandler) CreateDirectory(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusBadRequest, "name is required")
 	}
 
-	var parentID *uuid.UUID
+	var parentID, parentVaultID *uuid.UUID
 	if req.ParentID != nil && strings.TrimSpace(*req.ParentID) != "" {
 		parsed, err := parseUUID(*req.ParentID)
 		if err != nil {
-			return utils.Error(c, fiber.StatusBadRequest, "invalid parentID")
+			return utils.Fail(c, errInvalidParentID)
 		}
 		parentID = &parsed
 
 		var parent models.File
 		if err := h.DB.First(&parent, "id = ?", parsed).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
-				return utils.Error(c, fiber.StatusNotFound, "parent folder not found")
+				return utils.Fail(c, errParentNotFound)
 			}
 			return utils.Error(c, fiber.StatusInternalServerError, "failed loading parent")
 		}
 		if !parent.IsDirectory {
-			return utils.Error(c, fiber.StatusBadRequest, "parentID must be a directory")
+			return utils.Fail(c, errParentNotDirectory)
 		}
 		if !h.Access.HasAccess(c.Context(), currentUser.ID, parent.ID, models.SharePermissionEdit) {
 			return utils.Error(c, fiber.StatusForbidden, "no permission to create in parent directory")
 		}
+		parentVaultID = parent.VaultID
 	}
-
-	dir := models.File{
-		Name:        name,
-		MimeType:    "inode/directory",
-		Size:        0,
-		IsDirectory: true,
-		ParentID:    parentID,
-		OwnerID:     currentUser.ID,
-		StoragePath: "",
+	if req.Vault {
+		if h.Vaults == nil {
+			return utils.Error(c, fiber.StatusNotImplemented, "encrypted folders are not available")
+		}
+		if parentVaultID != nil {
+			return utils.Fail(c, serviceError(services.ErrVaultNested, nil))
+		}
 	}
 
-	if err := h.DB.Create(&dir).Error; err != nil {
-		return utils.Error(c, fiber.StatusInternalServerError, "failed creating directory")
+	dir := models.File{
+		Name:           name,
+		MimeType:       "inode/directory",
+		Size:           0,
+		IsDirectory:    true,
+		ParentID:       parentID,
+		OwnerID:        currentUser.ID,
+		OrganizationID: currentUser.OrganizationID,
+		StoragePath:    "",
+	}
+	details := map[string]interface{}{
+		"folder_name": name,
+	}
+	if req.Vault {
+		dir.ID = uuid.New()
+		dir.VaultID = &dir.ID
+		details["vault"] = true
+	}
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&dir).Error; err != nil {
+			return err
+		}
+		if req.Vault {
+			if err := h.Vaults.StoreWrappedKeys(tx, dir.ID, currentUser.ID, currentUser.ID, req.VaultKeys); err != nil {
+				return err
+			}
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "folder.create",
+			ResourceType: "file",
+			ResourceID:   &dir.ID,
+			Details:      details,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		})
+	}); err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "internal_error", "failed creating directory")))
 	}
 
-	h.Audit.LogAsync(services.AuditEntry{
-		UserID:       &currentUser.ID,
-		Action:       "folder.create",
-		ResourceType: "file",
-		ResourceID:   &dir.ID,
-		Details: map[string]interface{}{
-			"folder_name": name,
-		},
-		IPAddress: c.IP(),
-		RequestID: getRequestID(c),
-	})
-
 	return utils.Success(c, fiber.StatusCreated, dir)
 }
 
 func (h *FilesHandler) ListRoot(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
+	// Listings read from a replica when one is configured.
+	db := h.DB.WithContext(c.UserContext())
+
 	p := utils.ParsePagination(c)
 	sort := utils.ParseFileSort(c)
 
+	if utils.WantsCursor(c) {
+		query := db.Preload("Owner").
+			Where("parent_id IS NULL").
+			Where("owner_id = ? OR id IN (?)", currentUser.ID, h.sharedWithSubquery(currentUser.ID))
+		files, nextCursor, err := findFilesKeyset(c, query, sort, p.Limit)
+		if err == utils.ErrInvalidCursor {
+			return utils.Fail(c, errInvalidCursor)
+		}
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed listing files")
+		}
+		h.annotateListing(c.Context(), files)
+		return utils.CursorPaginated(c, files, p.Limit, nextCursor)
+	}
+
 	var owned []models.File
-	if err := h.DB.Preload("Owner").Where("owner_id = ? AND parent_id IS NULL", currentUser.ID).Find(&owned).Error; err != nil {
+	if err := db.Preload("Owner").Where("owner_id = ? AND parent_id IS NULL", currentUser.ID).Find(&owned).Error; err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed listing owned files")
 	}
 
 	var shared []models.File
-	if err := h.DB.
+	if err := db.
 		Preload("Owner").
 		Table("files").
 		Distinct("files.*").
@@ -624,31 +873,7 @@ func (h *FilesHandler) ListRoot(c *fiber.Ctx) error {
 		combined = combined[start:end]
 	}
 
-	if len(combined) > 0 {
-		fileIDs := make([]uuid.UUID, len(combined))
-		for i, f := range combined {
-			fileIDs[i] = f.ID
-		}
-
-		var results []struct {
-			FileID uuid.UUID
-			Count  int64
-		}
-		h.DB.Model(&models.Share{}).
-			Select("file_id, count(*) as count").
-			Where("file_id IN ?", fileIDs).
-			Group("file_id").
-			Scan(&results)
-
-		counts := make(map[uuid.UUID]int64)
-		for _, r := range results {
-			counts[r.FileID] = r.Count
-		}
-
-		for i := range combined {
-			combined[i].SharedWith = counts[combined[i].ID]
-		}
-	}
+	h.annotateListing(c.Context(), combined)
 
 	return utils.Paginated(c, combined, p.Page, p.Limit, total)
 }
@@ -656,24 +881,24 @@ func (h *FilesHandler) ListRoot(c *fiber.Ctx) error {
 func (h *FilesHandler) Get(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	var file models.File
 	if err := h.DB.Preload("Owner").First(&file, "id = ?", fileID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "file not found")
+			return utils.Fail(c, errFileNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+		return utils.Fail(c, errLoadingFile)
 	}
 
 	if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionView) {
-		return utils.Error(c, fiber.StatusForbidden, "access denied")
+		return utils.Fail(c, errAccessDenied)
 	}
 
 	// Populate the transient permission flags so the file viewer can hide
@@ -683,24 +908,34 @@ func (h *FilesHandler) Get(c *fiber.Ctx) error {
 	file.CanEdit = isOwner || h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionEdit)
 	file.CanDownload = file.CanEdit || h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionDownload)
 
+	lock, err := h.Locks.ActiveLock(c.Context(), file.ID)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading file lock")
+	}
+	file.Lock = lock
+
+	if utils.NotModified(c, fileETag(file, strconv.FormatBool(file.CanEdit), strconv.FormatBool(file.CanDownload))) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
 	return utils.Success(c, fiber.StatusOK, file)
 }
 
 func (h *FilesHandler) ListChildren(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	var parent models.File
 	if err := h.DB.First(&parent, "id = ?", fileID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "directory not found")
+			return utils.Fail(c, errDirectoryNotFound)
 		}
 		return utils.Error(c, fiber.StatusInternalServerError, "failed loading directory")
 	}
@@ -709,10 +944,31 @@ func (h *FilesHandler) ListChildren(c *fiber.Ctx) error {
 	}
 
 	if !h.Access.HasAccess(c.Context(), currentUser.ID, parent.ID, models.SharePermissionView) {
-		return utils.Error(c, fiber.StatusForbidden, "access denied")
+		return utils.Fail(c, errAccessDenied)
+	}
+
+	etag, err := h.childrenETag(c, parent)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading children")
+	}
+	if utils.NotModified(c, etag) {
+		return c.SendStatus(fiber.StatusNotModified)
 	}
 
 	p := utils.ParsePagination(c)
+	sort := utils.ParseFileSort(c)
+
+	if utils.WantsCursor(c) {
+		children, nextCursor, err := findFilesKeyset(c, h.DB.Preload("Owner").Where("parent_id = ?", parent.ID), sort, p.Limit)
+		if err == utils.ErrInvalidCursor {
+			return utils.Fail(c, errInvalidCursor)
+		}
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed loading children")
+		}
+		h.annotateListing(c.Context(), children)
+		return utils.CursorPaginated(c, children, p.Limit, nextCursor)
+	}
 
 	var total int64
 	if err := h.DB.Model(&models.File{}).Where("parent_id = ?", parent.ID).Count(&total).Error; err != nil {
@@ -720,36 +976,12 @@ func (h *FilesHandler) ListChildren(c *fiber.Ctx) error {
 	}
 
 	var children []models.File
-	query := h.DB.Preload("Owner").Where("parent_id = ?", parent.ID).Order(utils.ParseFileSort(c).SQLClause())
+	query := h.DB.Preload("Owner").Where("parent_id = ?", parent.ID).Order(sort.SQLClause())
 	if err := utils.ApplyPagination(query, p).Find(&children).Error; err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed loading children")
 	}
 
-	if len(children) > 0 {
-		fileIDs := make([]uuid.UUID, len(children))
-		for i, f := range children {
-			fileIDs[i] = f.ID
-		}
-
-		var results []struct {
-			FileID uuid.UUID
-			Count  int64
-		}
-		h.DB.Model(&models.Share{}).
-			Select("file_id, count(*) as count").
-			Where("file_id IN ?", fileIDs).
-			Group("file_id").
-			Scan(&results)
-
-		counts := make(map[uuid.UUID]int64)
-		for _, r := range results {
-			counts[r.FileID] = r.Count
-		}
-
-		for i := range children {
-			children[i].SharedWith = counts[children[i].ID]
-		}
-	}
+	h.annotateListing(c.Context(), children)
 
 	return utils.Paginated(c, children, p.Page, p.Limit, total)
 }
@@ -757,20 +989,20 @@ func (h *FilesHandler) ListChildren(c *fiber.Ctx) error {
 func (h *FilesHandler) Download(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	var file models.File
 	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "file not found")
+			return utils.Fail(c, errFileNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+		return utils.Fail(c, errLoadingFile)
 	}
 	if file.IsDirectory {
 		return utils.Error(c, fiber.StatusBadRequest, "cannot download a directory")
@@ -783,10 +1015,20 @@ func (h *FilesHandler) Download(c *fiber.Ctx) error {
 			"file_name":           file.Name,
 			"required_permission": "download",
 		})
-		return utils.Error(c, fiber.StatusForbidden, "access denied")
+		return utils.Fail(c, errAccessDenied)
+	}
+	if apiErr := h.checkFilePassword(c, &file, currentUser); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if apiErr := checkArchived(&file); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	key, apiErr := h.watermark(c, &file, file.StoragePath, file.MimeType, currentUser)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
 	}
 
-	obj, err := h.Storage.Download(c.Context(), file.StoragePath)
+	obj, err := h.readRegion(c, &file, key).Download(c.Context(), key)
 	if err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed downloading file")
 	}
@@ -827,78 +1069,117 @@ func (h *FilesHandler) Download(c *fiber.Ctx) error {
 
 	c.Set("Content-Type", contentType)
 	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Name))
-	return c.SendStream(obj, int(stat.Size))
+	return c.SendStream(h.limitDownload(c, obj, &file, currentUser), int(stat.Size))
 }
 
 func (h *FilesHandler) PreviewURL(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	if !h.Access.HasAccess(c.Context(), currentUser.ID, fileID, models.SharePermissionView) {
-		return utils.Error(c, fiber.StatusForbidden, "access denied")
+		return utils.Fail(c, errAccessDenied)
+	}
+	var file models.File
+	if err := h.DB.Select("id", "owner_id", "mime_type", "vault_id", "password_hash").First(&file, "id = ?", fileID).Error; err != nil {
+		return utils.Fail(c, errLoadingFile)
+	}
+	if file.VaultID != nil {
+		return utils.Fail(c, errVaultContent)
+	}
+	if apiErr := h.checkFilePassword(c, &file, currentUser); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if !(c.Query("variant") == "thumb" && rasterThumbnail(&file)) && h.viewOnly(c, &file, currentUser) {
+		return utils.Fail(c, errViewOnly)
 	}
-
-	token := previewtoken.Generate(fileID.String(), currentUser.ID.String())
 
 	// The variant param is propagated into the returned path so the client
 	// builds one URL: ?variant=thumb selects the small JPEG thumbnail (for
 	// grid view); absent/any other value selects the renderable form (for
-	// the viewer: original for images, PDF render for Office docs).
+	// the viewer: original for images, PDF render for Office docs). A
+	// thumbnail token opens only the thumbnail; a full one opens both.
 	path := "/files/" + fileID.String() + "/proxy"
+	scope := previewtoken.ScopeFull
 	if c.Query("variant") == "thumb" {
 		path += "?variant=thumb"
+		scope = previewtoken.ScopeThumb
 	}
+	issued := h.PreviewTokens.Issue(c.Context(), fileID, currentUser.ID, scope)
 
 	return utils.Success(c, fiber.StatusOK, fiber.Map{
-		"path":  path,
-		"token": token,
+		"path":      path,
+		"token":     issued.Token,
+		"scope":     issued.Scope,
+		"expiresAt": issued.ExpiresAt,
+		"ttl":       issued.TTLSeconds,
+		"maxUses":   issued.MaxUses,
 	})
 }
 
 func (h *FilesHandler) ProxyPreview(c *fiber.Ctx) error {
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	var currentUser *models.User
 	previewToken := c.Query("token")
 
 	if previewToken != "" {
-		tokenFileID, tokenUserID, err := previewtoken.GetMetadata(previewToken)
-		if err == nil && tokenFileID == fileID.String() {
-			var user models.User
-			if dbErr := h.DB.First(&user, "id = ?", tokenUserID).Error; dbErr == nil {
-				currentUser = &user
-			}
+		scope := previewtoken.ScopeFull
+		if c.Query("variant") == "thumb" {
+			scope = previewtoken.ScopeThumb
+		}
+		tokenUserID, err := h.PreviewTokens.Redeem(c.Context(), previewToken, fileID, scope)
+		if err != nil {
+			return utils.Fail(c, serviceError(err, errUnauthorized))
+		}
+		var user models.User
+		if dbErr := h.DB.First(&user, "id = ?", tokenUserID).Error; dbErr == nil {
+			currentUser = &user
 		}
 	} else {
 		currentUser = middleware.GetCurrentUser(c)
 	}
 
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var file models.File
 	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "file not found")
+			return utils.Fail(c, errFileNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+		return utils.Fail(c, errLoadingFile)
 	}
 	if file.IsDirectory {
 		return utils.Error(c, fiber.StatusBadRequest, "cannot preview a directory")
 	}
 	if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionView) {
-		return utils.Error(c, fiber.StatusForbidden, "access denied")
+		return utils.Fail(c, errAccessDenied)
+	}
+	if file.VaultID != nil {
+		return utils.Fail(c, errVaultContent)
+	}
+	// Preview tokens are only issued once the password has been given.
+	if previewToken == "" {
+		if apiErr := h.checkFilePassword(c, &file, currentUser); apiErr != nil {
+			return utils.Fail(c, apiErr)
+		}
+	}
+	// View-only viewers get image thumbnails here and everything else as
+	// pages.
+	smallThumb := c.Query("variant") == "thumb" && rasterThumbnail(&file)
+	if !smallThumb && h.viewOnly(c, &file, currentUser) {
+		return utils.Fail(c, errViewOnly)
 	}
 
 	// Path selection:
@@ -926,6 +1207,33 @@ func (h *FilesHandler) ProxyPreview(c *fiber.Ctx) error {
 		storagePath = *file.ThumbnailPath
 		servingThumbnail = true
 	}
+	if !servingThumbnail {
+		if apiErr := checkArchived(&file); apiErr != nil {
+			return utils.Fail(c, apiErr)
+		}
+	}
+	storagePath, renditionType, apiErr := h.partialPreview(c, &file, storagePath, servingThumbnail)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	// Full previews of PDFs, and the PDFs rendered from Office documents,
+	// carry the watermark too, even when asked for as a thumbnail; image
+	// thumbnails are too small to matter.
+	if !smallThumb {
+		served := renditionType
+		if served == "" && servingThumbnail {
+			served = "application/pdf"
+		} else if served == "" {
+			served = file.MimeType
+		}
+		stamped, apiErr := h.watermark(c, &file, storagePath, served, currentUser)
+		if apiErr != nil {
+			return utils.Fail(c, apiErr)
+		}
+		if stamped != storagePath {
+			storagePath, renditionType = stamped, "application/pdf"
+		}
+	}
 
 	obj, err := h.Storage.Download(c.Context(), storagePath)
 	if err != nil {
@@ -944,7 +1252,9 @@ func (h *FilesHandler) ProxyPreview(c *fiber.Ctx) error {
 	// original, prefer DB MimeType, since pre-signed PUT uploads land in
 	// S3 as application/octet-stream.
 	var contentType string
-	if servingThumbnail {
+	if renditionType != "" {
+		contentType = renditionType
+	} else if servingThumbnail {
 		contentType = stat.ContentType
 		if contentType == "" {
 			if isImage {
@@ -960,34 +1270,49 @@ func (h *FilesHandler) ProxyPreview(c *fiber.Ctx) error {
 		}
 	}
 
+	// Thumbnails are fetched by file listings, not by someone opening the
+	// file, so only full previews count as views.
+	if variant != "thumb" {
+		h.recordAccess(c, &file, currentUser, models.FileAccessView)
+	}
+
 	c.Set("Content-Type", contentType)
 	c.Set("Content-Disposition", "inline")
-	return c.SendStream(obj, int(stat.Size))
+	return sendObject(c, obj, stat.Size)
 }
 
 func (h *FilesHandler) DownloadURL(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	var file models.File
 	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "file not found")
+			return utils.Fail(c, errFileNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+		return utils.Fail(c, errLoadingFile)
 	}
 	if file.IsDirectory {
 		return utils.Error(c, fiber.StatusBadRequest, "cannot download a directory")
 	}
 	if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionDownload) {
-		return utils.Error(c, fiber.StatusForbidden, "access denied")
+		return utils.Fail(c, errAccessDenied)
+	}
+	if apiErr := h.checkFilePassword(c, &file, currentUser); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if apiErr := checkArchived(&file); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if c.QueryBool("direct") {
+		return h.directDownloadURL(c, &file, currentUser)
 	}
 
 	return utils.Success(c, fiber.StatusOK, fiber.Map{
@@ -998,24 +1323,27 @@ func (h *FilesHandler) DownloadURL(c *fiber.Ctx) error {
 func (h *FilesHandler) ConvertPreview(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	var file models.File
 	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "file not found")
+			return utils.Fail(c, errFileNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+		return utils.Fail(c, errLoadingFile)
 	}
 
 	if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionView) {
-		return utils.Error(c, fiber.StatusForbidden, "access denied")
+		return utils.Fail(c, errAccessDenied)
+	}
+	if file.VaultID != nil {
+		return utils.Fail(c, errVaultContent)
 	}
 
 	job, err := h.PreviewQueue.Enqueue(file.ID, &currentUser.ID)
@@ -1031,24 +1359,24 @@ func (h *FilesHandler) ConvertPreview(c *fiber.Ctx) error {
 func (h *FilesHandler) PreviewStatus(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	var file models.File
 	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "file not found")
+			return utils.Fail(c, errFileNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+		return utils.Fail(c, errLoadingFile)
 	}
 
 	if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionView) {
-		return utils.Error(c, fiber.StatusForbidden, "access denied")
+		return utils.Fail(c, errAccessDenied)
 	}
 
 	job, err := h.PreviewQueue.GetJobByFileID(fileID)
@@ -1072,24 +1400,27 @@ func (h *FilesHandler) PreviewStatus(c *fiber.Ctx) error {
 func (h *FilesHandler) RetryPreview(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	var file models.File
 	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "file not found")
+			return utils.Fail(c, errFileNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+		return utils.Fail(c, errLoadingFile)
 	}
 
 	if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionView) {
-		return utils.Error(c, fiber.StatusForbidden, "access denied")
+		return utils.Fail(c, errAccessDenied)
+	}
+	if file.VaultID != nil {
+		return utils.Fail(c, errVaultContent)
 	}
 
 	job, err := h.PreviewQueue.Retry(fileID, &currentUser.ID)
@@ -1135,20 +1466,33 @@ func (h *FilesHandler) jobToResponse(job *models.PreviewJob, file *models.File)
 func (h *FilesHandler) Search(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	db := h.DB.WithContext(c.UserContext())
+
+	filters, err := utils.ParseFileSearchFilters(c)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
 	}
 
+	// A name query is optional when structured filters narrow the search,
+	// but a one-character query is still too broad to be useful.
 	q := strings.TrimSpace(c.Query("q"))
-	if len(q) < 2 {
+	if len(q) < 2 && (q != "" || !filters.HasConstraints()) {
 		return utils.Error(c, fiber.StatusBadRequest, "search query must be at least 2 characters")
 	}
 
 	p := utils.ParsePagination(c)
-	searchValue := "%" + strings.ToLower(q) + "%"
+	sort := utils.ParseFileSort(c)
 	directoryIDRaw := strings.TrimSpace(c.Query("directoryID"))
 
-	var files []models.File
-	var total int64
+	// Vault contents are encrypted by the client, so their names and bytes
+	// mean nothing to the server and are left out of search.
+	query := db.Model(&models.File{}).Scopes(services.OrganizationScope("files", currentUser.OrganizationID)).Where("vault_id IS NULL")
+	if q != "" {
+		query = query.Where("LOWER(name) LIKE ?", "%"+strings.ToLower(q)+"%")
+	}
 
 	if directoryIDRaw != "" {
 		dirID, err := parseUUID(directoryIDRaw)
@@ -1159,7 +1503,7 @@ func (h *FilesHandler) Search(c *fiber.Ctx) error {
 		var dir models.File
 		if err := h.DB.First(&dir, "id = ?", dirID).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
-				return utils.Error(c, fiber.StatusNotFound, "directory not found")
+				return utils.Fail(c, errDirectoryNotFound)
 			}
 			return utils.Error(c, fiber.StatusInternalServerError, "failed loading directory")
 		}
@@ -1167,11 +1511,11 @@ func (h *FilesHandler) Search(c *fiber.Ctx) error {
 			return utils.Error(c, fiber.StatusBadRequest, "specified ID is not a directory")
 		}
 		if !h.Access.HasAccess(c.Context(), currentUser.ID, dir.ID, models.SharePermissionView) {
-			return utils.Error(c, fiber.StatusForbidden, "access denied")
+			return utils.Fail(c, errAccessDenied)
 		}
 
 		var descendantIDs []struct{ ID uuid.UUID }
-		if err := h.DB.Raw(`
+		if err := db.Raw(`
 			WITH RECURSIVE descendants AS (
 				SELECT id FROM files WHERE id = ? AND deleted_at IS NULL
 				UNION ALL
@@ -1185,6 +1529,9 @@ func (h *FilesHandler) Search(c *fiber.Ctx) error {
 		}
 
 		if len(descendantIDs) == 0 {
+			if utils.WantsCursor(c) {
+				return utils.CursorPaginated(c, []models.File{}, p.Limit, "")
+			}
 			return utils.Paginated(c, []models.File{}, p.Page, p.Limit, 0)
 		}
 
@@ -1192,34 +1539,46 @@ func (h *FilesHandler) Search(c *fiber.Ctx) error {
 		for i, d := range descendantIDs {
 			ids[i] = d.ID
 		}
-
-		countQuery := h.DB.Model(&models.File{}).Where("id IN ? AND LOWER(name) LIKE ?", ids, searchValue)
-		if err := countQuery.Count(&total).Error; err != nil {
-			return utils.Error(c, fiber.StatusInternalServerError, "search failed")
+		query = query.Where("id IN ?", ids)
+	} else {
+		switch filters.Scope {
+		case utils.SearchScopeShared:
+			query = query.Where("id IN (?)", h.sharedWithSubquery(currentUser.ID)).Where("owner_id != ?", currentUser.ID)
+		case utils.SearchScopeAll:
+			query = query.Where("owner_id = ? OR id IN (?)", currentUser.ID, h.sharedWithSubquery(currentUser.ID))
+		default:
+			query = query.Where("owner_id = ?", currentUser.ID)
 		}
+	}
 
-		if err := h.DB.Preload("Owner").
-			Where("id IN ? AND LOWER(name) LIKE ?", ids, searchValue).
-			Order(utils.ParseFileSort(c).SQLClause()).
-			Offset(p.Offset).
-			Limit(p.Limit).
-			Find(&files).Error; err != nil {
-			return utils.Error(c, fiber.StatusInternalServerError, "search failed")
+	query = filters.Apply(query).Session(&gorm.Session{})
+
+	if utils.WantsCursor(c) {
+		files, nextCursor, err := findFilesKeyset(c, query.Preload("Owner"), sort, p.Limit)
+		if err == utils.ErrInvalidCursor {
+			return utils.Fail(c, errInvalidCursor)
 		}
-	} else {
-		countQuery := h.DB.Model(&models.File{}).Where("owner_id = ? AND LOWER(name) LIKE ?", currentUser.ID, searchValue)
-		if err := countQuery.Count(&total).Error; err != nil {
+		if err != nil {
 			return utils.Error(c, fiber.StatusInternalServerError, "search failed")
 		}
 
-		if err := h.DB.Preload("Owner").
-			Where("owner_id = ? AND LOWER(name) LIKE ?", currentUser.ID, searchValue).
-			Order(utils.ParseFileSort(c).SQLClause()).
-			Offset(p.Offset).
-			Limit(p.Limit).
-			Find(&files).Error; err != nil {
-			return utils.Error(c, fiber.StatusInternalServerError, "search failed")
-		}
+		h.enrichParentNames(files)
+
+		return utils.CursorPaginated(c, files, p.Limit, nextCursor)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "search failed")
+	}
+
+	var files []models.File
+	if err := query.Preload("Owner").
+		Order(sort.SQLClause()).
+		Offset(p.Offset).
+		Limit(p.Limit).
+		Find(&files).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "search failed")
 	}
 
 	h.enrichParentNames(files)
@@ -1227,6 +1586,142 @@ func (h *FilesHandler) Search(c *fiber.Ctx) error {
 	return utils.Paginated(c, files, p.Page, p.Limit, total)
 }
 
+// sharedWithSubquery selects the IDs of files shared directly with userID,
+// either personally or through one of their groups. Descendants of shared
+// folders are not included.
+func (h *FilesHandler) sharedWithSubquery(userID uuid.UUID) *gorm.DB {
+	return h.DB.
+		Table("shares").
+		Select("shares.file_id").
+		Joins("LEFT JOIN group_memberships gm ON gm.group_id = shares.shared_with_group_id").
+		Where("shares.deleted_at IS NULL").
+		Where("shares.expires_at IS NULL OR shares.expires_at > NOW()").
+		Where("shares.shared_with_user_id = ? OR gm.user_id = ?", userID, userID)
+}
+
+// findFilesKeyset loads one cursor page of query in sort's keyset order.
+// The returned cursor is empty once the last page has been reached.
+func findFilesKeyset(c *fiber.Ctx, query *gorm.DB, sort utils.FileSort, limit int) ([]models.File, string, error) {
+	cur, err := utils.DecodeCursor(c.Query("cursor"))
+	if err != nil {
+		return nil, "", err
+	}
+	query, err = sort.ApplyCursor(query, cur)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var files []models.File
+	if err := query.Order(sort.KeysetClause()).Limit(limit + 1).Find(&files).Error; err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(files) > limit {
+		files = files[:limit]
+		nextCursor = sort.CursorFor(files[len(files)-1])
+	}
+	return files, nextCursor, nil
+}
+
+// annotateListing fills the transient SharedWith count and active Lock on
+// each file in a listing.
+func (h *FilesHandler) annotateListing(ctx context.Context, files []models.File) {
+	if len(files) == 0 {
+		return
+	}
+	h.Locks.AttachLocks(ctx, files)
+
+	fileIDs := make([]uuid.UUID, len(files))
+	for i, f := range files {
+		fileIDs[i] = f.ID
+	}
+
+	var results []struct {
+		FileID uuid.UUID
+		Count  int64
+	}
+	h.DB.Model(&models.Share{}).
+		Select("file_id, count(*) as count").
+		Where("file_id IN ?", fileIDs).
+		Group("file_id").
+		Scan(&results)
+
+	counts := make(map[uuid.UUID]int64)
+	for _, r := range results {
+		counts[r.FileID] = r.Count
+	}
+
+	for i := range files {
+		files[i].SharedWith = counts[files[i].ID]
+	}
+}
+
+// fileETag identifies the metadata representation of a single file. extra
+// carries per-viewer fields (such as permission flags) that change the body
+// without touching the row.
+func fileETag(file models.File, extra ...string) string {
+	parts := []string{file.ID.String(), file.UpdatedAt.UTC().Format(time.RFC3339Nano)}
+	if file.Owner.ID != uuid.Nil {
+		parts = append(parts, file.Owner.UpdatedAt.UTC().Format(time.RFC3339Nano))
+	}
+	if file.Lock != nil {
+		parts = append(parts, file.Lock.ID.String(), file.Lock.ExpiresAt.UTC().Format(time.RFC3339Nano))
+	}
+	return utils.WeakETag(append(parts, extra...)...)
+}
+
+// childrenETag identifies a folder listing without loading it. The count
+// catches deletions, the newest updated_at catches creates, renames and
+// moves, and the share and lock figures keep SharedWith and Lock honest.
+// The query string is included because page, sort and cursor all change
+// the body.
+func (h *FilesHandler) childrenETag(c *fiber.Ctx, parent models.File) (string, error) {
+	var childCount, shareCount int64
+	var newestChild models.File
+	var newestShare models.Share
+
+	children := h.DB.Model(&models.File{}).Where("parent_id = ?", parent.ID)
+	if err := children.Count(&childCount).Error; err != nil {
+		return "", err
+	}
+	if err := h.DB.Select("updated_at").Where("parent_id = ?", parent.ID).
+		Order("updated_at DESC").Limit(1).Find(&newestChild).Error; err != nil {
+		return "", err
+	}
+
+	childIDs := h.DB.Model(&models.File{}).Select("id").Where("parent_id = ?", parent.ID)
+	if err := h.DB.Model(&models.Share{}).Where("file_id IN (?)", childIDs).Count(&shareCount).Error; err != nil {
+		return "", err
+	}
+	if err := h.DB.Select("updated_at").Where("file_id IN (?)", childIDs).
+		Order("updated_at DESC").Limit(1).Find(&newestShare).Error; err != nil {
+		return "", err
+	}
+
+	var lockCount int64
+	var newestLock models.FileLock
+	activeLocks := h.DB.Model(&models.FileLock{}).Where("file_id IN (?) AND expires_at > ?", childIDs, time.Now())
+	if err := activeLocks.Count(&lockCount).Error; err != nil {
+		return "", err
+	}
+	if err := h.DB.Select("updated_at").Where("file_id IN (?)", childIDs).
+		Order("updated_at DESC").Limit(1).Find(&newestLock).Error; err != nil {
+		return "", err
+	}
+
+	return utils.WeakETag(
+		parent.ID.String(),
+		strconv.FormatInt(childCount, 10),
+		newestChild.UpdatedAt.UTC().Format(time.RFC3339Nano),
+		strconv.FormatInt(shareCount, 10),
+		newestShare.UpdatedAt.UTC().Format(time.RFC3339Nano),
+		strconv.FormatInt(lockCount, 10),
+		newestLock.UpdatedAt.UTC().Format(time.RFC3339Nano),
+		string(c.Request().URI().QueryString()),
+	), nil
+}
+
 func (h *FilesHandler) enrichParentNames(files []models.File) {
 	parentIDs := make([]uuid.UUID, 0)
 	for _, f := range files {
@@ -1263,30 +1758,33 @@ type updateFileRequest struct {
 func (h *FilesHandler) Update(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	var file models.File
 	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "file not found")
+			return utils.Fail(c, errFileNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+		return utils.Fail(c, errLoadingFile)
 	}
 
 	canEdit := file.OwnerID == currentUser.ID || h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionEdit)
 	if !canEdit {
-		return utils.Error(c, fiber.StatusForbidden, "access denied")
+		return utils.Fail(c, errAccessDenied)
+	}
+	if blocked, resp := h.rejectIfLocked(c, file.ID, currentUser.ID); blocked {
+		return resp
 	}
 
 	var req updateFileRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	updates := map[string]interface{}{}
@@ -1301,11 +1799,14 @@ func (h *FilesHandler) Update(c *fiber.Ctx) error {
 	if req.ParentID != nil {
 		trimmed := strings.TrimSpace(*req.ParentID)
 		if trimmed == "" {
+			if err := services.CheckVaultMove(&file, nil); err != nil {
+				return utils.Fail(c, serviceError(err, nil))
+			}
 			updates["parent_id"] = nil
 		} else {
 			newParentID, parseErr := parseUUID(trimmed)
 			if parseErr != nil {
-				return utils.Error(c, fiber.StatusBadRequest, "invalid parentID")
+				return utils.Fail(c, errInvalidParentID)
 			}
 			if newParentID == file.ID {
 				return utils.Error(c, fiber.StatusBadRequest, "file cannot be parent of itself")
@@ -1324,6 +1825,9 @@ func (h *FilesHandler) Update(c *fiber.Ctx) error {
 			if !h.Access.HasAccess(c.Context(), currentUser.ID, newParent.ID, models.SharePermissionEdit) {
 				return utils.Error(c, fiber.StatusForbidden, "no permission for target directory")
 			}
+			if err := services.CheckVaultMove(&file, newParent.VaultID); err != nil {
+				return utils.Fail(c, serviceError(err, nil))
+			}
 			if file.IsDirectory {
 				isChild, checkErr := h.isDescendant(file.ID, newParent.ID)
 				if checkErr != nil {
@@ -1342,40 +1846,46 @@ func (h *FilesHandler) Update(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusBadRequest, "no valid fields to update")
 	}
 
-	if err := h.DB.Model(&models.File{}).Where("id = ?", file.ID).Updates(updates).Error; err != nil {
-		return utils.Error(c, fiber.StatusInternalServerError, "failed updating file")
+	details := map[string]interface{}{"changes": updates}
+	// A move changes the old parent's folder totals as well as the new one's.
+	if _, moved := updates["parent_id"]; moved && file.ParentID != nil {
+		details["previous_parent_id"] = file.ParentID.String()
 	}
 
 	var updated models.File
-	if err := h.DB.First(&updated, "id = ?", file.ID).Error; err != nil {
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading updated file")
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.File{}).Where("id = ?", file.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&updated, "id = ?", file.ID).Error; err != nil {
+			return err
+		}
+		details["file_name"] = updated.Name
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "file.update",
+			ResourceType: "file",
+			ResourceID:   &file.ID,
+			Details:      details,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		})
+	}); err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed updating file")
 	}
 
-	h.Audit.LogAsync(services.AuditEntry{
-		UserID:       &currentUser.ID,
-		Action:       "file.update",
-		ResourceType: "file",
-		ResourceID:   &file.ID,
-		Details: map[string]interface{}{
-			"file_name": updated.Name,
-			"changes":   updates,
-		},
-		IPAddress: c.IP(),
-		RequestID: getRequestID(c),
-	})
-
 	return utils.Success(c, fiber.StatusOK, updated)
 }
 
 func (h *FilesHandler) Delete(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	if !h.Access.HasAccess(c.Context(), currentUser.ID, fileID, models.SharePermissionEdit) {
@@ -1384,66 +1894,81 @@ func (h *FilesHandler) Delete(c *fiber.Ctx) error {
 			"target_id":           fileID.String(),
 			"required_permission": "edit",
 		})
-		return utils.Error(c, fiber.StatusForbidden, "access denied")
+		return utils.Fail(c, errAccessDenied)
 	}
 
 	var file models.File
 	if err := h.DB.Select("id", "name", "is_directory").First(&file, "id = ?", fileID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "file not found")
+			return utils.Fail(c, errFileNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+		return utils.Fail(c, errLoadingFile)
 	}
-
-	var shareRecipientIDs []string
-	var shares []models.Share
-	h.DB.Where("file_id = ?", fileID).Where("expires_at IS NULL OR expires_at > NOW()").Find(&shares)
-	seen := map[uuid.UUID]bool{currentUser.ID: true}
-	for _, share := range shares {
-		if share.SharedWithUserID != nil && !seen[*share.SharedWithUserID] {
-			seen[*share.SharedWithUserID] = true
-			shareRecipientIDs = append(shareRecipientIDs, share.SharedWithUserID.String())
-		}
+	if blocked, resp := h.rejectIfLocked(c, file.ID, currentUser.ID); blocked {
+		return resp
 	}
 
-	if err := h.deleteRecursive(c.Context(), fileID); err != nil {
+	shareRecipientIDs := h.shareRecipients(fileID, currentUser.ID)
+
+	var removed []models.File
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := h.deleteRecursive(c.Context(), tx, fileID, &removed); err != nil {
+			return err
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "file.delete",
+			ResourceType: "file",
+			ResourceID:   &fileID,
+			Details: map[string]interface{}{
+				"file_name":       file.Name,
+				"is_directory":    file.IsDirectory,
+				"notify_user_ids": shareRecipientIDs,
+			},
+			IPAddress: c.IP(),
+			RequestID: getRequestID(c),
+		})
+	}); err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed deleting file")
 	}
+	h.removeObjects(c.Context(), removed)
 
 	logger.InfoWithUser(currentUser.ID.String(), "file_deleted", map[string]interface{}{
 		"file_id": fileID.String(),
 	})
 
-	h.Audit.LogAsync(services.AuditEntry{
-		UserID:       &currentUser.ID,
-		Action:       "file.delete",
-		ResourceType: "file",
-		ResourceID:   &fileID,
-		Details: map[string]interface{}{
-			"file_name":       file.Name,
-			"is_directory":    file.IsDirectory,
-			"notify_user_ids": shareRecipientIDs,
-		},
-		IPAddress: c.IP(),
-		RequestID: getRequestID(c),
-	})
-
 	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "file deleted"})
 }
 
+// shareRecipients lists the users a file is directly shared with, other
+// than actorID, for the notify_user_ids of a file.delete event.
+func (h *FilesHandler) shareRecipients(fileID, actorID uuid.UUID) []string {
+	var recipients []string
+	var shares []models.Share
+	h.DB.Where("file_id = ?", fileID).Where("expires_at IS NULL OR expires_at > NOW()").Find(&shares)
+	seen := map[uuid.UUID]bool{actorID: true}
+	for _, share := range shares {
+		if share.SharedWithUserID != nil && !seen[*share.SharedWithUserID] {
+			seen[*share.SharedWithUserID] = true
+			recipients = append(recipients, share.SharedWithUserID.String())
+		}
+	}
+	return recipients
+}
+
 func (h *FilesHandler) Path(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	if !h.Access.HasAccess(c.Context(), currentUser.ID, fileID, models.SharePermissionView) {
-		return utils.Error(c, fiber.StatusForbidden, "access denied")
+		return utils.Fail(c, errAccessDenied)
 	}
 
 	path := make([]models.File, 0)
@@ -1471,42 +1996,77 @@ func (h *FilesHandler) Path(c *fiber.Ctx) error {
 	return utils.Success(c, fiber.StatusOK, path)
 }
 
-func (h *FilesHandler) deleteRecursive(ctx context.Context, fileID uuid.UUID) error {
+// deleteRecursive deletes the rows for fileID and everything under it,
+// adding each file that had an object to removed. It leaves storage alone:
+// the caller passes removed to removeObjects once the transaction commits,
+// so a rollback never leaves rows pointing at deleted objects.
+func (h *FilesHandler) deleteRecursive(ctx context.Context, db *gorm.DB, fileID uuid.UUID, removed *[]models.File) error {
 	var file models.File
-	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
+	if err := db.First(&file, "id = ?", fileID).Error; err != nil {
 		return err
 	}
 
 	if file.IsDirectory {
 		var children []models.File
-		if err := h.DB.Where("parent_id = ?", file.ID).Find(&children).Error; err != nil {
+		if err := db.Where("parent_id = ?", file.ID).Find(&children).Error; err != nil {
 			return err
 		}
 		for _, child := range children {
-			if err := h.deleteRecursive(ctx, child.ID); err != nil {
+			if err := h.deleteRecursive(ctx, db, child.ID, removed); err != nil {
 				return err
 			}
 		}
 	} else if file.StoragePath != "" {
-		if err := h.Storage.Delete(ctx, file.StoragePath); err != nil {
+		*removed = append(*removed, file)
+	}
+
+	if err := db.Where("file_id = ?", file.ID).Delete(&models.Share{}).Error; err != nil {
+		return err
+	}
+	if file.IsDirectory {
+		if err := db.Unscoped().Where("folder_id = ?", file.ID).Delete(&models.FolderShareDefaults{}).Error; err != nil {
 			return err
 		}
+	}
+
+	return db.Delete(&models.File{}, "id = ?", file.ID).Error
+}
+
+// removeObjects deletes the stored objects of files whose rows are gone.
+// Failures are logged rather than returned: the delete has committed, and
+// storage reconciliation sweeps up any object left behind.
+func (h *FilesHandler) removeObjects(ctx context.Context, files []models.File) {
+	for i := range files {
+		file := &files[i]
+		if err := h.Storage.Delete(ctx, file.StoragePath); err != nil {
+			logger.Error("file_object_delete_failed", err, map[string]interface{}{
+				"file_id": file.ID.String(),
+				"key":     file.StoragePath,
+			})
+		}
+		if h.Archiver != nil {
+			if err := h.Archiver.Forget(ctx, file); err != nil {
+				logger.Error("file_archive_delete_failed", err, map[string]interface{}{
+					"file_id": file.ID.String(),
+				})
+			}
+		}
 		if file.ThumbnailPath != nil && *file.ThumbnailPath != "" {
 			_ = h.Storage.Delete(ctx, *file.ThumbnailPath)
 		}
+		if h.Renditions != nil {
+			h.Renditions.Purge(ctx, file.ID)
+		}
 	}
-
-	if err := h.DB.Where("file_id = ?", file.ID).Delete(&models.Share{}).Error; err != nil {
-		return err
-	}
-
-	return h.DB.Delete(&models.File{}, "id = ?", file.ID).Error
 }
 
 func (h *FilesHandler) PublicGet(c *fiber.Ctx) error {
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
+	}
+	if !h.Access.InOrganization(c.Context(), fileID, middleware.GetOrganizationID(c)) {
+		return utils.Fail(c, errFileNotFound)
 	}
 
 	currentUser := middleware.GetCurrentUser(c)
@@ -1517,17 +2077,21 @@ func (h *FilesHandler) PublicGet(c *fiber.Ctx) error {
 			var file models.File
 			if err := h.DB.Preload("Owner").First(&file, "id = ?", fileID).Error; err != nil {
 				if err == gorm.ErrRecordNotFound {
-					return utils.Error(c, fiber.StatusNotFound, "file not found")
+					return utils.Fail(c, errFileNotFound)
 				}
-				return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+				return utils.Fail(c, errLoadingFile)
 			}
+			if utils.NotModified(c, fileETag(file)) {
+				return c.SendStatus(fiber.StatusNotModified)
+			}
+			h.recordAccess(c, &file, currentUser, models.FileAccessView)
 			return utils.Success(c, fiber.StatusOK, file)
 		}
 	}
 
 	shareType := h.Access.GetPublicShareType(c.Context(), fileID)
 	if shareType == nil {
-		return utils.Error(c, fiber.StatusNotFound, "file not found")
+		return utils.Fail(c, errFileNotFound)
 	}
 
 	if *shareType == models.ShareTypePublicLoggedIn && !isLoggedIn {
@@ -1537,18 +2101,26 @@ func (h *FilesHandler) PublicGet(c *fiber.Ctx) error {
 	var file models.File
 	if err := h.DB.Preload("Owner").First(&file, "id = ?", fileID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "file not found")
+			return utils.Fail(c, errFileNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+		return utils.Fail(c, errLoadingFile)
+	}
+
+	if utils.NotModified(c, fileETag(file)) {
+		return c.SendStatus(fiber.StatusNotModified)
 	}
 
+	h.recordAccess(c, &file, currentUser, models.FileAccessView)
 	return utils.Success(c, fiber.StatusOK, file)
 }
 
 func (h *FilesHandler) PublicDownload(c *fiber.Ctx) error {
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
+	}
+	if !h.Access.InOrganization(c.Context(), fileID, middleware.GetOrganizationID(c)) {
+		return utils.Fail(c, errFileNotFound)
 	}
 
 	currentUser := middleware.GetCurrentUser(c)
@@ -1562,7 +2134,7 @@ func (h *FilesHandler) PublicDownload(c *fiber.Ctx) error {
 	if !h.Access.HasPublicAccess(c.Context(), fileID, models.SharePermissionDownload, false) {
 		requireLogin = true
 		if !h.Access.HasPublicAccess(c.Context(), fileID, models.SharePermissionDownload, true) {
-			return utils.Error(c, fiber.StatusNotFound, "file not found")
+			return utils.Fail(c, errFileNotFound)
 		}
 	}
 
@@ -1570,13 +2142,24 @@ func (h *FilesHandler) PublicDownload(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusUnauthorized, "login required to access this file")
 	}
 
+	if !isLoggedIn && h.Captcha != nil {
+		if share := h.Access.GetPublicShare(c.Context(), fileID); share != nil {
+			if err := h.Captcha.Check(c.Context(), share.ID, c.IP(), captchaToken(c)); err != nil {
+				return failCaptcha(c, err)
+			}
+		}
+	}
+
 	return h.downloadFile(c, fileID)
 }
 
 func (h *FilesHandler) PublicChildren(c *fiber.Ctx) error {
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
+	}
+	if !h.Access.InOrganization(c.Context(), fileID, middleware.GetOrganizationID(c)) {
+		return utils.Fail(c, errDirectoryNotFound)
 	}
 
 	currentUser := middleware.GetCurrentUser(c)
@@ -1586,7 +2169,7 @@ func (h *FilesHandler) PublicChildren(c *fiber.Ctx) error {
 	hasPrivateAccess := isLoggedIn && h.Access.HasAccess(c.Context(), currentUser.ID, fileID, models.SharePermissionView)
 
 	if shareType == nil && !hasPrivateAccess {
-		return utils.Error(c, fiber.StatusNotFound, "directory not found")
+		return utils.Fail(c, errDirectoryNotFound)
 	}
 
 	if shareType != nil && *shareType == models.ShareTypePublicLoggedIn && !isLoggedIn && !hasPrivateAccess {
@@ -1596,7 +2179,7 @@ func (h *FilesHandler) PublicChildren(c *fiber.Ctx) error {
 	var parent models.File
 	if err := h.DB.First(&parent, "id = ?", fileID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "directory not found")
+			return utils.Fail(c, errDirectoryNotFound)
 		}
 		return utils.Error(c, fiber.StatusInternalServerError, "failed loading directory")
 	}
@@ -1604,7 +2187,32 @@ func (h *FilesHandler) PublicChildren(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusBadRequest, "file is not a directory")
 	}
 
+	return h.publicChildrenPage(c, parent)
+}
+
+// publicChildrenPage lists the children of a publicly reachable directory.
+func (h *FilesHandler) publicChildrenPage(c *fiber.Ctx, parent models.File) error {
+	etag, err := h.childrenETag(c, parent)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading children")
+	}
+	if utils.NotModified(c, etag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
 	p := utils.ParsePagination(c)
+	sort := utils.ParseFileSort(c)
+
+	if utils.WantsCursor(c) {
+		children, nextCursor, err := findFilesKeyset(c, h.DB.Preload("Owner").Where("parent_id = ?", parent.ID), sort, p.Limit)
+		if err == utils.ErrInvalidCursor {
+			return utils.Fail(c, errInvalidCursor)
+		}
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed loading children")
+		}
+		return utils.CursorPaginated(c, children, p.Limit, nextCursor)
+	}
 
 	var total int64
 	if err := h.DB.Model(&models.File{}).Where("parent_id = ?", parent.ID).Count(&total).Error; err != nil {
@@ -1612,7 +2220,7 @@ func (h *FilesHandler) PublicChildren(c *fiber.Ctx) error {
 	}
 
 	var children []models.File
-	query := h.DB.Preload("Owner").Where("parent_id = ?", parent.ID).Order(utils.ParseFileSort(c).SQLClause())
+	query := h.DB.Preload("Owner").Where("parent_id = ?", parent.ID).Order(sort.SQLClause())
 	if err := utils.ApplyPagination(query, p).Find(&children).Error; err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed loading children")
 	}
@@ -1624,15 +2232,25 @@ func (h *FilesHandler) downloadFile(c *fiber.Ctx, fileID uuid.UUID) error {
 	var file models.File
 	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "file not found")
+			return utils.Fail(c, errFileNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+		return utils.Fail(c, errLoadingFile)
 	}
 	if file.IsDirectory {
 		return utils.Error(c, fiber.StatusBadRequest, "cannot download a directory")
 	}
+	if apiErr := h.checkFilePassword(c, &file, middleware.GetCurrentUser(c)); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if apiErr := checkArchived(&file); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	key, apiErr := h.watermark(c, &file, file.StoragePath, file.MimeType, middleware.GetCurrentUser(c))
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
 
-	obj, err := h.Storage.Download(c.Context(), file.StoragePath)
+	obj, err := h.readRegion(c, &file, key).Download(c.Context(), key)
 	if err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed downloading file")
 	}
@@ -1651,9 +2269,29 @@ func (h *FilesHandler) downloadFile(c *fiber.Ctx, fileID uuid.UUID) error {
 		contentType = stat.ContentType
 	}
 
+	h.recordAccess(c, &file, middleware.GetCurrentUser(c), models.FileAccessDownload)
+	h.auditPublicDownload(c, &file, middleware.GetCurrentUser(c))
+
 	c.Set("Content-Type", contentType)
 	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Name))
-	return c.SendStream(obj, int(stat.Size))
+	return c.SendStream(h.limitDownload(c, obj, &file, middleware.GetCurrentUser(c)), int(stat.Size))
+}
+
+// limitDownload applies the download bandwidth caps to obj. Owners are only
+// held to their own and the global cap, since they are not downloading
+// through a share.
+func (h *FilesHandler) limitDownload(c *fiber.Ctx, obj io.ReadCloser, file *models.File, user *models.User) io.ReadCloser {
+	if h.Downloads == nil {
+		return obj
+	}
+	download := services.Download{IPAddress: c.IP()}
+	if user != nil {
+		download.UserID = &user.ID
+	}
+	if user == nil || user.ID != file.OwnerID {
+		download.ShareID = h.accessShareID(c, file.ID, user)
+	}
+	return h.Downloads.Limit(c.Context(), obj, download)
 }
 
 func (h *FilesHandler) isDescendant(ancestorID, candidateChildID uuid.UUID) (bool, error) {
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAnalyticsDays = 30
+	maxAnalyticsDays     = 365
+)
+
+// recordAccess counts a view or download of file for its owner's analytics.
+// The owner's own access is not counted, and neither are range requests past
+// the first byte, which are a player or resumed download fetching more of
+// something already counted.
+func (h *FilesHandler) recordAccess(c *fiber.Ctx, file *models.File, user *models.User, kind models.FileAccessKind) {
+	if h.Analytics == nil {
+		return
+	}
+	if user != nil && user.ID == file.OwnerID {
+		return
+	}
+	if continuesDownload(c) {
+		return
+	}
+
+	access := services.FileAccess{
+		FileID:    file.ID,
+		ShareID:   h.accessShareID(c, file.ID, user),
+		Kind:      kind,
+		IPAddress: c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		Referrer:  c.Get(fiber.HeaderReferer),
+	}
+	if user != nil {
+		access.UserID = &user.ID
+	}
+	h.Analytics.Record(c.Context(), access)
+}
+
+// continuesDownload reports whether c is a range request past the first
+// byte.
+func continuesDownload(c *fiber.Ctx) bool {
+	r := c.Get(fiber.HeaderRange)
+	return r != "" && !strings.HasPrefix(r, "bytes=0-")
+}
+
+// auditPublicDownload records a download through a public link in the
+// audit log. Anonymous downloads are recorded with no user and the
+// visitor's user agent, and appear in the file owner's audit log.
+func (h *FilesHandler) auditPublicDownload(c *fiber.Ctx, file *models.File, user *models.User) {
+	if continuesDownload(c) {
+		return
+	}
+	entry := services.AuditEntry{
+		Action:       "file.download",
+		ResourceType: "file",
+		ResourceID:   &file.ID,
+		Details: map[string]interface{}{
+			"file_name": file.Name,
+			"file_size": file.Size,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	}
+	if user != nil {
+		entry.UserID = &user.ID
+	} else {
+		entry.Action = services.AuditActionPublicDownload
+		entry.Details["user_agent"] = truncate(c.Get(fiber.HeaderUserAgent), 255)
+	}
+	if shareID := h.accessShareID(c, file.ID, user); shareID != nil {
+		entry.Details["share_id"] = shareID.String()
+	}
+	h.Audit.LogAsync(entry)
+}
+
+// accessShareID picks the share that let user reach fileID: the public link
+// when there is one, otherwise a share made directly with user. It returns
+// nil when neither applies, e.g. access through a group or a parent folder.
+func (h *FilesHandler) accessShareID(c *fiber.Ctx, fileID uuid.UUID, user *models.User) *uuid.UUID {
+	if share := h.Access.GetPublicShare(c.Context(), fileID); share != nil {
+		return &share.ID
+	}
+	if user == nil {
+		return nil
+	}
+	var share models.Share
+	if err := h.DB.Select("id").
+		Where("file_id = ? AND shared_with_user_id = ?", fileID, user.ID).
+		First(&share).Error; err != nil {
+		return nil
+	}
+	return &share.ID
+}
+
+// GetAnalytics summarizes who has viewed and downloaded a file the caller owns.
+func (h *FilesHandler) GetAnalytics(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+
+	var file models.File
+	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Fail(c, errFileNotFound)
+		}
+		return utils.Fail(c, errLoadingFile)
+	}
+	if file.OwnerID != currentUser.ID {
+		return utils.Fail(c, errInsufficientPermissions)
+	}
+
+	days := c.QueryInt("days", defaultAnalyticsDays)
+	if days < 1 || days > maxAnalyticsDays {
+		return utils.Error(c, fiber.StatusBadRequest, "days must be between 1 and 365")
+	}
+
+	summary, err := h.Analytics.Summarize(c.Context(), file.ID, days)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading analytics")
+	}
+	return utils.Success(c, fiber.StatusOK, summary)
+}
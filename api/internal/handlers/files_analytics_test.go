@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/google/uuid"
+)
+
+func TestFileAnalytics(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "analytics-owner@test.com", "password123", models.UserRoleUser)
+	_, viewerToken := createTestUser(t, env.db, "analytics-viewer@test.com", "password123", models.UserRoleUser)
+
+	file := models.File{Name: "deck.pdf", MimeType: "application/pdf", Size: 1024, OwnerID: owner.ID, StoragePath: "owner/deck.pdf"}
+	if err := env.db.Create(&file).Error; err != nil {
+		t.Fatalf("failed creating file fixture: %v", err)
+	}
+	resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+file.ID.String()+"/share", map[string]any{
+		"shareType": "public_anyone", "permission": "download",
+	}, authHeaders(ownerToken))
+	assertStatus(t, resp, http.StatusCreated)
+	shareID := decodeJSONMap(t, resp)["data"].(map[string]interface{})["id"]
+
+	publicPath := "/api/public/files/" + file.ID.String()
+	view := func(t *testing.T, headers map[string]string) {
+		t.Helper()
+		resp := performRequest(t, env.app, http.MethodGet, publicPath, nil, headers)
+		assertStatus(t, resp, http.StatusOK)
+	}
+	view(t, map[string]string{"User-Agent": "Slackbot", "Referer": "https://app.slack.com/client"})
+	view(t, map[string]string{"User-Agent": "Slackbot", "Referer": "https://app.slack.com/client"})
+	view(t, map[string]string{"User-Agent": "Firefox", "Referer": "http://localhost:3001/shared/" + file.ID.String()})
+	view(t, authHeaders(viewerToken))
+	view(t, authHeaders(ownerToken))
+	view(t, map[string]string{"User-Agent": "Firefox", "Range": "bytes=100-"})
+
+	analyticsPath := "/api/files/" + file.ID.String() + "/analytics"
+	resp = performRequest(t, env.app, http.MethodGet, analyticsPath+"?days=7", nil, authHeaders(ownerToken))
+	assertStatus(t, resp, http.StatusOK)
+	data := decodeJSONMap(t, resp)["data"].(map[string]interface{})
+
+	if data["views"] != float64(4) || data["downloads"] != float64(0) || data["uniqueVisitors"] != float64(3) {
+		t.Fatalf("expected 4 views from 3 visitors, excluding the owner and range requests, got %v", data)
+	}
+	if daily := data["daily"].([]interface{}); len(daily) != 7 {
+		t.Fatalf("expected one entry per day, got %v", daily)
+	}
+	referrers := data["topReferrers"].([]interface{})
+	if len(referrers) != 1 || referrers[0].(map[string]interface{})["host"] != "app.slack.com" {
+		t.Fatalf("expected slack as the only referrer, got %v", referrers)
+	}
+	shares := data["shares"].([]interface{})
+	if len(shares) != 1 || shares[0].(map[string]interface{})["shareID"] != shareID {
+		t.Fatalf("expected the views attributed to the public share, got %v", shares)
+	}
+
+	t.Run("only the owner", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, analyticsPath, nil, authHeaders(viewerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("days out of range", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, analyticsPath+"?days=400", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+}
+
+func TestAnonymousDownloadAudit(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "anon-owner@test.com", "password123", models.UserRoleUser)
+	_, otherToken := createTestUser(t, env.db, "anon-other@test.com", "password123", models.UserRoleUser)
+
+	file := models.File{Name: "report.pdf", MimeType: "application/pdf", Size: 2048, OwnerID: owner.ID, StoragePath: "owner/report.pdf"}
+	if err := env.db.Create(&file).Error; err != nil {
+		t.Fatalf("failed creating file fixture: %v", err)
+	}
+	shareID := uuid.New()
+	download := models.AuditLog{
+		Action:       services.AuditActionPublicDownload,
+		ResourceType: "file",
+		ResourceID:   &file.ID,
+		Details:      map[string]interface{}{"file_name": file.Name, "user_agent": "curl/8.5.0", "share_id": shareID.String()},
+		IPAddress:    "203.0.113.7",
+		CreatedAt:    time.Now().UTC(),
+	}
+	if err := env.db.Create(&download).Error; err != nil {
+		t.Fatalf("failed creating audit log: %v", err)
+	}
+
+	t.Run("appears in the owner's audit log", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/audit-log", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		logs := decodeJSONMap(t, resp)["data"].([]interface{})
+		if len(logs) != 1 || logs[0].(map[string]interface{})["action"] != services.AuditActionPublicDownload {
+			t.Fatalf("expected the anonymous download, got %v", logs)
+		}
+	})
+
+	t.Run("appears in the owner's export", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/audit-log/export?format=csv", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		body, _ := io.ReadAll(resp.Body)
+		if !strings.Contains(string(body), services.AuditActionPublicDownload) || !strings.Contains(string(body), "203.0.113.7") {
+			t.Fatalf("expected the anonymous download in the export, got %s", body)
+		}
+	})
+
+	t.Run("not in anyone else's audit log", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/audit-log", nil, authHeaders(otherToken))
+		assertStatus(t, resp, http.StatusOK)
+		if logs := decodeJSONMap(t, resp)["data"].([]interface{}); len(logs) != 0 {
+			t.Fatalf("expected no entries, got %v", logs)
+		}
+	})
+
+	t.Run("appears in analytics", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/"+file.ID.String()+"/analytics", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		downloads := decodeJSONMap(t, resp)["data"].(map[string]interface{})["anonymousDownloads"].([]interface{})
+		if len(downloads) != 1 {
+			t.Fatalf("expected one anonymous download, got %v", downloads)
+		}
+		got := downloads[0].(map[string]interface{})
+		if got["ipAddress"] != "203.0.113.7" || got["userAgent"] != "curl/8.5.0" || got["shareID"] != shareID.String() {
+			t.Fatalf("unexpected anonymous download %v", got)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	errArchiveNotEnabled = utils.NewError(fiber.StatusConflict, "archive_not_enabled", "no cold storage is configured")
+	errFileArchived      = utils.NewError(fiber.StatusConflict, "file_archived", "file is in cold storage; request a restore first")
+)
+
+// Archive moves a file, or everything in a folder, to cold storage. Only
+// the owner may archive. The move happens in the background.
+func (h *FilesHandler) Archive(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	if h.Archiver == nil {
+		return utils.Fail(c, errArchiveNotEnabled)
+	}
+	file, apiErr := h.loadFile(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if file.OwnerID != currentUser.ID {
+		return utils.Fail(c, errInsufficientPermissions)
+	}
+	if blocked, resp := h.rejectIfLocked(c, file.ID, currentUser.ID); blocked {
+		return resp
+	}
+
+	count, err := h.Archiver.Archive(c.Context(), file)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "archive_failed", "failed archiving file")))
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "file.archive",
+		ResourceType: "file",
+		ResourceID:   &file.ID,
+		Details: map[string]interface{}{
+			"file_name":    file.Name,
+			"is_directory": file.IsDirectory,
+			"files":        count,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+	return utils.Success(c, fiber.StatusAccepted, fiber.Map{"files": count})
+}
+
+// RestoreArchive asks for an archived file, or the archived files in a
+// folder, back. Anyone who may download them can ask. The response holds
+// when they are expected to be readable again.
+func (h *FilesHandler) RestoreArchive(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	if h.Archiver == nil {
+		return utils.Fail(c, errArchiveNotEnabled)
+	}
+	file, apiErr := h.loadFile(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionDownload) {
+		return utils.Fail(c, errAccessDenied)
+	}
+
+	restore, err := h.Archiver.Restore(c.Context(), file)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "archive_restore_failed", "failed requesting restore")))
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "file.archive_restore",
+		ResourceType: "file",
+		ResourceID:   &file.ID,
+		Details: map[string]interface{}{
+			"file_name": file.Name,
+			"files":     restore.Files,
+			"eta":       restore.ETA.Format(time.RFC3339),
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+	return utils.Success(c, fiber.StatusAccepted, restore)
+}
+
+// checkArchived returns file_archived when the file's bytes are in cold
+// storage, saying when they are due back if a restore was requested.
+func checkArchived(file *models.File) *utils.APIError {
+	if file.ArchivedAt == nil {
+		return nil
+	}
+	if file.RestoreETA != nil {
+		return errFileArchived.WithMessage(fmt.Sprintf("file is in cold storage; a restore is expected to finish by %s", file.RestoreETA.UTC().Format(time.RFC3339)))
+	}
+	return errFileArchived
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var errInvalidArchiveRequest = utils.NewError(fiber.StatusBadRequest, "invalid_archive_request", services.ErrArchiveBuildInvalid.Error())
+
+type createArchiveRequest struct {
+	FileIDs        []string `json:"fileIDs"`
+	TargetFolderID *string  `json:"targetFolderID"`
+	Name           string   `json:"name"`
+}
+
+// CreateArchive queues packing the selected files and folders into a ZIP
+// stored as a new file, in targetFolderID or the caller's root. It needs
+// download permission on every selected item and edit permission on the
+// target folder.
+func (h *FilesHandler) CreateArchive(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	var req createArchiveRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	if len(req.FileIDs) > services.MaxArchiveSources {
+		return utils.Fail(c, errInvalidArchiveRequest.WithMessage(fmt.Sprintf("at most %d files and folders can be selected", services.MaxArchiveSources)))
+	}
+
+	sourceIDs := make([]uuid.UUID, 0, len(req.FileIDs))
+	for _, raw := range req.FileIDs {
+		id, err := parseUUID(raw)
+		if err != nil {
+			return utils.Fail(c, errInvalidFileID)
+		}
+		var file models.File
+		if err := h.DB.First(&file, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return utils.Fail(c, errFileNotFound)
+			}
+			return utils.Fail(c, errLoadingFile)
+		}
+		if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionDownload) {
+			return utils.Fail(c, errAccessDenied)
+		}
+		if h.viewOnly(c, &file, currentUser) {
+			return utils.Fail(c, errViewOnly)
+		}
+		if file.VaultID != nil {
+			return utils.Fail(c, errVaultContent)
+		}
+		sourceIDs = append(sourceIDs, file.ID)
+	}
+	target, apiErr := loadTargetFolder(c, h.DB, h.Access, currentUser, req.TargetFolderID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	var targetID *uuid.UUID
+	if target != nil {
+		targetID = &target.ID
+	}
+
+	build, err := h.ArchiveBuilder.Start(c.Context(), currentUser.ID, services.ArchiveBuildRequest{
+		SourceIDs:      sourceIDs,
+		TargetFolderID: targetID,
+		Name:           req.Name,
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrArchiveBuildInvalid) {
+			return utils.Fail(c, errInvalidArchiveRequest.WithMessage(err.Error()))
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed queueing archive")
+	}
+
+	details := map[string]interface{}{
+		"build_id":     build.ID.String(),
+		"name":         build.Name,
+		"source_count": len(build.SourceIDs),
+	}
+	if targetID != nil {
+		details["target_folder_id"] = targetID.String()
+	}
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "file.archive_create",
+		ResourceType: "file",
+		ResourceID:   targetID,
+		Details:      details,
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+	return utils.Success(c, fiber.StatusAccepted, build)
+}
+
+// ArchiveBuild reports the progress of an archive build to whoever started
+// it.
+func (h *FilesHandler) ArchiveBuild(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, serviceError(services.ErrArchiveBuildNotFound, nil))
+	}
+	build, err := h.ArchiveBuilder.Get(c.Context(), id)
+	if err == nil && build.RequestedByID != currentUser.ID {
+		err = services.ErrArchiveBuildNotFound
+	}
+	if err != nil {
+		if apiErr := serviceError(err, nil); apiErr != nil {
+			return utils.Fail(c, apiErr)
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading archive build")
+	}
+	return utils.Success(c, fiber.StatusOK, build)
+}
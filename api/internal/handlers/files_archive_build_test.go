@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestCreateArchive(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "bundle-owner@test.com", "password123", models.UserRoleUser)
+	_, outsiderToken := createTestUser(t, env.db, "bundle-outsider@test.com", "password123", models.UserRoleUser)
+
+	readme := models.File{Name: "README.md", MimeType: "text/markdown", Size: 7, OwnerID: owner.ID, StoragePath: "bundle/readme"}
+	env.db.Create(&readme)
+	env.uploads.objects[readme.StoragePath] = []byte("# hello")
+
+	t.Run("builds the archive in the background", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/archive", map[string]any{"fileIDs": []string{readme.ID.String()}}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusAccepted)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		if data["name"] != "README.md.zip" || data["status"] != string(models.ArchiveBuildPending) {
+			t.Fatalf("unexpected build %v", data)
+		}
+		id := data["id"].(string)
+
+		if ran, err := env.jobs.RunNext(context.Background()); !ran || err != nil {
+			t.Fatalf("expected the build job to run, got %v, %v", ran, err)
+		}
+		resp = performRequest(t, env.app, http.MethodGet, "/api/files/archives/"+id, nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		data = decodeJSONMap(t, resp)["data"].(map[string]any)
+		if data["status"] != string(models.ArchiveBuildCompleted) || data["fileID"] == nil {
+			t.Fatalf("unexpected build %v", data)
+		}
+		var archive models.File
+		if err := env.db.First(&archive, "id = ?", data["fileID"]).Error; err != nil || archive.ParentID != nil || archive.MimeType != "application/zip" {
+			t.Fatalf("expected the archive in the owner's root, got %+v, %v", archive, err)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/files/archives/"+id, nil, authHeaders(outsiderToken))
+		assertStatus(t, resp, http.StatusNotFound)
+	})
+
+	t.Run("needs download permission on every item", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/archive", map[string]any{"fileIDs": []string{readme.ID.String()}}, authHeaders(outsiderToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("rejects an empty selection", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/archive", map[string]any{"fileIDs": []string{}}, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusBadRequest)
+		if body["code"] != "invalid_archive_request" {
+			t.Fatalf("expected invalid_archive_request, got %v", body["code"])
+		}
+	})
+}
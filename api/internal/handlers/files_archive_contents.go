@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var errArchivePathRequired = utils.NewError(fiber.StatusBadRequest, "archive_path_required", "path is required")
+
+// ListArchive lists the files inside a ZIP or TAR archive without
+// downloading it.
+func (h *FilesHandler) ListArchive(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	file, apiErr := h.loadArchive(c, currentUser, models.SharePermissionView)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if utils.NotModified(c, fileETag(*file, "archive-contents")) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	obj, err := h.readRegion(c, file, file.StoragePath).Download(c.Context(), file.StoragePath)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed reading archive")
+	}
+	defer obj.Close()
+
+	listing, err := h.ArchiveContents.List(obj, file)
+	if err != nil {
+		return h.failArchive(c, file, err)
+	}
+	return utils.Success(c, fiber.StatusOK, listing)
+}
+
+// ArchiveEntry sends one file out of an archive, named by ?path= as it
+// appears in the listing. It needs download permission on the archive.
+func (h *FilesHandler) ArchiveEntry(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	entryPath := c.Query("path")
+	if entryPath == "" {
+		return utils.Fail(c, errArchivePathRequired)
+	}
+	file, apiErr := h.loadArchive(c, currentUser, models.SharePermissionDownload)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	obj, err := h.readRegion(c, file, file.StoragePath).Download(c.Context(), file.StoragePath)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed reading archive")
+	}
+	entry, body, err := h.ArchiveContents.Open(obj, file, entryPath)
+	if err != nil {
+		obj.Close()
+		return h.failArchive(c, file, err)
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "file.archive_extract",
+		ResourceType: "file",
+		ResourceID:   &file.ID,
+		Details: map[string]interface{}{
+			"file_name":  file.Name,
+			"entry_path": entry.Path,
+			"entry_size": entry.Size,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+
+	name := path.Base(strings.TrimSuffix(entry.Path, "/"))
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Set("Content-Type", contentType)
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	return c.SendStream(h.limitDownload(c, &archiveEntryBody{ReadCloser: body, obj: obj}, file, currentUser), int(entry.Size))
+}
+
+type extractArchiveRequest struct {
+	TargetFolderID *string `json:"targetFolderID"`
+}
+
+// Extract queues unpacking a whole archive into a folder. Without a
+// targetFolderID a new folder named after the archive is made next to it,
+// or in the caller's root when they cannot add to the archive's folder.
+// It needs download permission on the archive and edit permission on the
+// target folder.
+func (h *FilesHandler) Extract(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	var req extractArchiveRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return utils.Fail(c, errInvalidBody)
+		}
+	}
+	file, apiErr := h.loadArchive(c, currentUser, models.SharePermissionDownload)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	target, apiErr := loadTargetFolder(c, h.DB, h.Access, currentUser, req.TargetFolderID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if target == nil {
+		parentID := file.ParentID
+		if parentID != nil && !h.Access.HasAccess(c.Context(), currentUser.ID, *parentID, models.SharePermissionEdit) {
+			parentID = nil
+		}
+		folder, err := h.Extractor.CreateFolder(c.Context(), file, parentID, currentUser)
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed creating target folder")
+		}
+		target = folder
+	}
+
+	extraction, err := h.Extractor.Start(c.Context(), file, target, currentUser.ID)
+	if err != nil {
+		return h.failArchive(c, file, err)
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "file.extract",
+		ResourceType: "file",
+		ResourceID:   &file.ID,
+		Details: map[string]interface{}{
+			"file_name":        file.Name,
+			"extraction_id":    extraction.ID.String(),
+			"target_folder_id": target.ID.String(),
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+	return utils.Success(c, fiber.StatusAccepted, extraction)
+}
+
+// Extraction reports the progress of an extraction to whoever started it.
+func (h *FilesHandler) Extraction(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, serviceError(services.ErrExtractionNotFound, nil))
+	}
+	extraction, err := h.Extractor.Get(c.Context(), id)
+	if err == nil && extraction.RequestedByID != currentUser.ID {
+		err = services.ErrExtractionNotFound
+	}
+	if err != nil {
+		if apiErr := serviceError(err, nil); apiErr != nil {
+			return utils.Fail(c, apiErr)
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading extraction")
+	}
+	return utils.Success(c, fiber.StatusOK, extraction)
+}
+
+// loadArchive loads the archive named in the route and checks that
+// currentUser may read its contents with permission.
+func (h *FilesHandler) loadArchive(c *fiber.Ctx, currentUser *models.User, permission models.SharePermission) (*models.File, *utils.APIError) {
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return nil, errInvalidFileID
+	}
+	var file models.File
+	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errFileNotFound
+		}
+		return nil, errLoadingFile
+	}
+	if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, permission) {
+		return nil, errAccessDenied
+	}
+	if h.viewOnly(c, &file, currentUser) {
+		return nil, errViewOnly
+	}
+	if file.VaultID != nil {
+		return nil, errVaultContent
+	}
+	if services.ArchiveFormatOf(&file) == "" {
+		return nil, serviceError(services.ErrArchiveUnsupported, nil)
+	}
+	if apiErr := h.checkFilePassword(c, &file, currentUser); apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr := checkArchived(&file); apiErr != nil {
+		return nil, apiErr
+	}
+	return &file, nil
+}
+
+func (h *FilesHandler) failArchive(c *fiber.Ctx, file *models.File, err error) error {
+	if apiErr := serviceError(err, nil); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	logger.Error("archive_read_failed", err, map[string]interface{}{
+		"file_id": file.ID.String(),
+	})
+	return utils.Error(c, fiber.StatusInternalServerError, "failed reading archive")
+}
+
+// archiveEntryBody closes the stored archive along with the entry read
+// from it.
+type archiveEntryBody struct {
+	io.ReadCloser
+	obj io.Closer
+}
+
+func (b *archiveEntryBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.obj.Close()
+	return err
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestArchiveContentsEndpoints(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "archive-owner@test.com", "password123", models.UserRoleUser)
+	viewer, viewerToken := createTestUser(t, env.db, "archive-viewer@test.com", "password123", models.UserRoleUser)
+	_, outsiderToken := createTestUser(t, env.db, "archive-outsider@test.com", "password123", models.UserRoleUser)
+
+	newFile := func(name, mimeType string) models.File {
+		file := models.File{Name: name, MimeType: mimeType, Size: 10, OwnerID: owner.ID, StoragePath: name}
+		if err := env.db.Create(&file).Error; err != nil {
+			t.Fatalf("failed creating file: %v", err)
+		}
+		return file
+	}
+	bundle := newFile("bundle.zip", "application/zip")
+	notes := newFile("notes.txt", "text/plain")
+	env.db.Create(&models.Share{FileID: bundle.ID, SharedByID: owner.ID, SharedWithUserID: &viewer.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView})
+
+	expectCode := func(resp *http.Response, status int, code string) {
+		t.Helper()
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, status)
+		if body["code"] != code {
+			t.Fatalf("expected code %s, got %v", code, body["code"])
+		}
+	}
+
+	t.Run("requires authentication", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/"+bundle.ID.String()+"/archive-contents", nil, nil)
+		assertStatus(t, resp, http.StatusUnauthorized)
+	})
+
+	t.Run("denies users without access", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/"+bundle.ID.String()+"/archive-contents", nil, authHeaders(outsiderToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("rejects files that are not archives", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/"+notes.ID.String()+"/archive-contents", nil, authHeaders(ownerToken))
+		expectCode(resp, http.StatusUnsupportedMediaType, "archive_not_supported")
+	})
+
+	t.Run("extraction needs a path and download permission", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/"+bundle.ID.String()+"/archive-contents/entry", nil, authHeaders(ownerToken))
+		expectCode(resp, http.StatusBadRequest, "archive_path_required")
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/files/"+bundle.ID.String()+"/archive-contents/entry?path=a.txt", nil, authHeaders(viewerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+}
+
+func TestExtractArchive(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "extract-owner@test.com", "password123", models.UserRoleUser)
+	viewer, viewerToken := createTestUser(t, env.db, "extract-viewer@test.com", "password123", models.UserRoleUser)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range map[string]string{"photos/cat.txt": "meow", "readme.md": "# hi", "../../escape.txt": "no"} {
+		w, _ := zw.Create(name)
+		io.WriteString(w, body)
+	}
+	zw.Close()
+
+	projects := models.File{Name: "Projects", MimeType: "inode/directory", IsDirectory: true, OwnerID: owner.ID}
+	env.db.Create(&projects)
+	bundle := models.File{Name: "bundle.zip", MimeType: "application/zip", Size: int64(buf.Len()), OwnerID: owner.ID, ParentID: &projects.ID, StoragePath: "archives/bundle.zip"}
+	env.db.Create(&bundle)
+	env.uploads.objects[bundle.StoragePath] = buf.Bytes()
+	env.db.Create(&models.Share{FileID: bundle.ID, SharedByID: owner.ID, SharedWithUserID: &viewer.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionDownload})
+
+	t.Run("unpacks into a new folder in the background", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodPost, "/api/files/"+bundle.ID.String()+"/extract", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusAccepted)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		if data["status"] != string(models.ArchiveExtractionPending) {
+			t.Fatalf("expected a pending extraction, got %v", data)
+		}
+		id := data["id"].(string)
+
+		var target models.File
+		env.db.First(&target, "id = ?", data["targetFolderID"])
+		if target.Name != "bundle" || target.ParentID == nil || *target.ParentID != projects.ID {
+			t.Fatalf("expected a bundle folder next to the archive, got %+v", target)
+		}
+
+		if ran, err := env.jobs.RunNext(context.Background()); !ran || err != nil {
+			t.Fatalf("expected the extract job to run, got %v, %v", ran, err)
+		}
+		resp = performRequest(t, env.app, http.MethodGet, "/api/files/extractions/"+id, nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		data = decodeJSONMap(t, resp)["data"].(map[string]any)
+		if data["status"] != string(models.ArchiveExtractionCompleted) || data["filesExtracted"] != float64(2) || data["filesFailed"] != float64(1) {
+			t.Fatalf("unexpected extraction %v", data)
+		}
+
+		var cat models.File
+		if err := env.db.Where("name = ? AND owner_id = ?", "cat.txt", owner.ID).First(&cat).Error; err != nil {
+			t.Fatalf("expected cat.txt extracted: %v", err)
+		}
+		if string(env.uploads.objects[cat.StoragePath]) != "meow" {
+			t.Fatalf("unexpected contents stored for cat.txt")
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/files/extractions/"+id, nil, authHeaders(viewerToken))
+		assertStatus(t, resp, http.StatusNotFound)
+	})
+
+	t.Run("needs edit permission on the target", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+bundle.ID.String()+"/extract", map[string]any{"targetFolderID": projects.ID.String()}, authHeaders(viewerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+bundle.ID.String()+"/extract", map[string]any{"targetFolderID": bundle.ID.String()}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestFilesArchive(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "archive-owner@test.com", "password123", models.UserRoleUser)
+	viewer, viewerToken := createTestUser(t, env.db, "archive-viewer@test.com", "password123", models.UserRoleUser)
+
+	file := models.File{Name: "2019.csv", MimeType: "text/csv", OwnerID: owner.ID, StoragePath: owner.ID.String() + "/2019.csv", Size: 5}
+	if err := env.db.Create(&file).Error; err != nil {
+		t.Fatalf("failed creating file: %v", err)
+	}
+	env.uploads.objects[file.StoragePath] = []byte("hello")
+	env.db.Create(&models.Share{FileID: file.ID, SharedByID: owner.ID, SharedWithUserID: &viewer.ID, Permission: models.SharePermissionDownload})
+
+	base := "/api/files/" + file.ID.String()
+	expectCode := func(t *testing.T, resp *http.Response, status int, code string) map[string]any {
+		t.Helper()
+		body := decodeJSONMap(t, resp)
+		if resp.StatusCode != status || body["code"] != code {
+			t.Fatalf("expected %d %s, got %d %v", status, code, resp.StatusCode, body)
+		}
+		return body
+	}
+	drain := func() {
+		t.Helper()
+		for {
+			ran, err := env.jobs.RunNext(context.Background())
+			if err != nil {
+				t.Fatalf("job failed: %v", err)
+			}
+			if !ran {
+				return
+			}
+		}
+	}
+	reload := func() models.File {
+		var out models.File
+		env.db.First(&out, "id = ?", file.ID)
+		return out
+	}
+
+	t.Run("only the owner archives", func(t *testing.T) {
+		expectCode(t, performRequest(t, env.app, http.MethodPost, base+"/archive", nil, authHeaders(viewerToken)), http.StatusForbidden, "insufficient_permissions")
+		expectCode(t, performRequest(t, env.app, http.MethodPost, base+"/archive/restore", nil, authHeaders(viewerToken)), http.StatusConflict, "file_not_archived")
+	})
+
+	t.Run("archiving closes the content", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodPost, base+"/archive", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusAccepted)
+		if data := decodeJSONMap(t, resp)["data"].(map[string]any); data["files"] != float64(1) {
+			t.Fatalf("expected one file queued, got %v", data)
+		}
+		drain()
+		if reload().ArchivedAt == nil {
+			t.Fatal("expected the file to be archived")
+		}
+		if _, ok := env.uploads.objects[file.StoragePath]; ok {
+			t.Fatal("expected the bytes to leave primary storage")
+		}
+		expectCode(t, performRequest(t, env.app, http.MethodGet, base+"/download", nil, authHeaders(viewerToken)), http.StatusConflict, "file_archived")
+		expectCode(t, performRequest(t, env.app, http.MethodPost, base+"/archive", nil, authHeaders(ownerToken)), http.StatusConflict, "nothing_to_archive")
+	})
+
+	t.Run("anyone who can download asks for a restore", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodPost, base+"/archive/restore", nil, authHeaders(viewerToken))
+		assertStatus(t, resp, http.StatusAccepted)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		eta, _ := data["eta"].(string)
+		if data["files"] != float64(1) || eta == "" {
+			t.Fatalf("expected a restore with an ETA, got %v", data)
+		}
+		if reload().RestoreETA == nil {
+			t.Fatal("expected the ETA to be recorded")
+		}
+		body := expectCode(t, performRequest(t, env.app, http.MethodGet, base+"/download", nil, authHeaders(viewerToken)), http.StatusConflict, "file_archived")
+		if msg, _ := body["error"].(string); !strings.Contains(msg, "restore is expected") {
+			t.Fatalf("expected the ETA in the error, got %v", body)
+		}
+
+		drain()
+		if got := reload(); got.ArchivedAt != nil || got.RestoreETA != nil {
+			t.Fatalf("expected the file to be restored, got %+v", got)
+		}
+		if string(env.uploads.objects[file.StoragePath]) != "hello" {
+			t.Fatal("expected the bytes back in primary storage")
+		}
+	})
+}
@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -29,16 +31,16 @@ import (
 // escaping can dwarf the raw content — pathological inputs of all
 // quotes/backslashes inflate ~2×, and all control characters
 // (`\u00XX`) inflate ~6×. The cap stays at 1 MiB so even a 6× escape
-// ratio fits under the SmallBodyLimitForNonUploadRoutes middleware (8
-// MiB), and a defensive raw-body check in SaveContent rejects requests
-// that somehow get through with too-large wire size.
+// ratio fits under the default document body limit (8 MiB,
+// BODY_LIMIT_DOCUMENT_MB), and a defensive raw-body check in SaveContent
+// rejects requests that somehow get through with too-large wire size.
 const editableContentMaxBytes = 1 * 1024 * 1024
 
 // editableBinaryMaxBytes is the analogous cap for the binary editor path
 // (spreadsheet workbooks). A Univer session decoding a multi-hundred-MB
-// XLSX would crash the tab. The cap is kept below
-// SmallBodyLimitForNonUploadRoutes (8 MiB) so the PUT body limit
-// middleware doesn't 413 us before we reach this handler.
+// XLSX would crash the tab. The cap matches the default document body
+// limit (8 MiB, BODY_LIMIT_DOCUMENT_MB) so the body limit middleware
+// doesn't 413 us before we reach this handler.
 const editableBinaryMaxBytes = 8 * 1024 * 1024
 
 // normalizeMime strips parameters (charset, boundary, etc.) and lowercases
@@ -94,39 +96,57 @@ func isCreatableDocMime(mimeType string) bool {
 	return isEditableTextMime(mimeType) || isEditableSpreadsheetBinaryMime(mimeType)
 }
 
+// contentChecksum returns the hex SHA-256 recorded in files.checksum.
+func contentChecksum(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
 // GetContent streams the raw bytes of an editable text file as JSON so the
 // browser editor can populate without going through the preview-token /
 // blob-URL dance the read-only viewer uses.
 func (h *FilesHandler) GetContent(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	var file models.File
 	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return utils.Error(c, fiber.StatusNotFound, "file not found")
+			return utils.Fail(c, errFileNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+		return utils.Fail(c, errLoadingFile)
 	}
 	if file.IsDirectory {
 		return utils.Error(c, fiber.StatusBadRequest, "cannot read directory content")
 	}
+	if file.VaultID != nil {
+		return utils.Fail(c, errVaultContent)
+	}
+	if apiErr := h.checkFilePassword(c, &file, currentUser); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if apiErr := checkArchived(&file); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
 	if !isEditableTextMime(file.MimeType) {
 		return utils.Error(c, fiber.StatusUnsupportedMediaType, "file type is not editable as text")
 	}
 	if file.Size > editableContentMaxBytes {
-		return utils.Error(c, fiber.StatusRequestEntityTooLarge, fmt.Sprintf("file exceeds editor maximum of %d bytes", editableContentMaxBytes))
+		return utils.Fail(c, errContentTooLarge.WithMessage(fmt.Sprintf("file exceeds editor maximum of %d bytes", editableContentMaxBytes)))
 	}
 
 	if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionView) {
-		return utils.Error(c, fiber.StatusForbidden, "access denied")
+		return utils.Fail(c, errAccessDenied)
+	}
+	if h.viewOnly(c, &file, currentUser) {
+		return utils.Fail(c, errViewOnly)
 	}
 
 	obj, err := h.Storage.Download(c.Context(), file.StoragePath)
@@ -140,7 +160,7 @@ func (h *FilesHandler) GetContent(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed reading file content")
 	}
 	if int64(len(body)) > editableContentMaxBytes {
-		return utils.Error(c, fiber.StatusRequestEntityTooLarge, "file exceeds editor maximum")
+		return utils.Fail(c, errContentTooLarge)
 	}
 
 	isOwner := file.OwnerID == currentUser.ID
@@ -171,24 +191,27 @@ type saveContentRequest struct {
 func (h *FilesHandler) SaveContent(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	var file models.File
 	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return utils.Error(c, fiber.StatusNotFound, "file not found")
+			return utils.Fail(c, errFileNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+		return utils.Fail(c, errLoadingFile)
 	}
 	if file.IsDirectory {
 		return utils.Error(c, fiber.StatusBadRequest, "cannot save content to a directory")
 	}
+	if file.VaultID != nil {
+		return utils.Fail(c, errVaultContent)
+	}
 	if !isEditableTextMime(file.MimeType) {
 		return utils.Error(c, fiber.StatusUnsupportedMediaType, "file type is not editable as text")
 	}
@@ -202,32 +225,62 @@ func (h *FilesHandler) SaveContent(c *fiber.Ctx) error {
 		})
 		return utils.Error(c, fiber.StatusForbidden, "no permission to edit this file")
 	}
+	if blocked, resp := h.rejectIfLocked(c, file.ID, currentUser.ID); blocked {
+		return resp
+	}
 
-	// Defensive raw-wire-size check. The SmallBodyLimitForNonUploadRoutes
-	// middleware (8 MiB) is the primary guard, but reject obviously-too-
+	// Defensive raw-wire-size check. The document body limit (8 MiB by
+	// default) is the primary guard, but reject obviously-too-
 	// large bodies here with a clear message before parsing JSON. JSON
 	// escape inflation means a < 1 MiB raw doc rarely exceeds even 2 MiB
 	// wire, so cap the wire body at 6× the decoded cap.
 	if int64(len(c.Body())) > editableContentMaxBytes*6 {
-		return utils.Error(c, fiber.StatusRequestEntityTooLarge, "request body too large for editor save")
+		return utils.Fail(c, errContentTooLarge.WithMessage("request body too large for editor save"))
 	}
 
 	var req saveContentRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	body := []byte(req.Content)
 	if int64(len(body)) > editableContentMaxBytes {
-		return utils.Error(c, fiber.StatusRequestEntityTooLarge, fmt.Sprintf("content exceeds editor maximum of %d bytes", editableContentMaxBytes))
+		return utils.Fail(c, errContentTooLarge.WithMessage(fmt.Sprintf("content exceeds editor maximum of %d bytes", editableContentMaxBytes)))
+	}
+
+	if apiErr := checkArchived(&file); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if apiErr := h.checkQuota(c, file.OrganizationID, int64(len(body))-file.Size); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if apiErr := h.checkGroupQuota(c, file.OwnerID, file.ParentID, int64(len(body))-file.Size); apiErr != nil {
+		return utils.Fail(c, apiErr)
 	}
 
 	if err := h.Storage.Upload(c.Context(), file.StoragePath, bytes.NewReader(body), int64(len(body)), file.MimeType); err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed saving file content")
 	}
 
-	updates := map[string]interface{}{"size": int64(len(body))}
-	if err := h.DB.Model(&models.File{}).Where("id = ?", file.ID).Updates(updates).Error; err != nil {
+	updates := map[string]interface{}{"size": int64(len(body)), "checksum": contentChecksum(body)}
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.File{}).Where("id = ?", file.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "file.edit",
+			ResourceType: "file",
+			ResourceID:   &file.ID,
+			Details: map[string]interface{}{
+				"file_name": file.Name,
+				"file_size": int64(len(body)),
+				"mime_type": file.MimeType,
+			},
+			IPAddress: c.IP(),
+			RequestID: getRequestID(c),
+		})
+	}); err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed updating file metadata")
 	}
 
@@ -243,20 +296,6 @@ func (h *FilesHandler) SaveContent(c *fiber.Ctx) error {
 		"mime_type": updated.MimeType,
 	})
 
-	h.Audit.LogAsync(services.AuditEntry{
-		UserID:       &currentUser.ID,
-		Action:       "file.edit",
-		ResourceType: "file",
-		ResourceID:   &updated.ID,
-		Details: map[string]interface{}{
-			"file_name": updated.Name,
-			"file_size": updated.Size,
-			"mime_type": updated.MimeType,
-		},
-		IPAddress: c.IP(),
-		RequestID: getRequestID(c),
-	})
-
 	return utils.Success(c, fiber.StatusOK, updated)
 }
 
@@ -272,12 +311,12 @@ type createDocRequest struct {
 func (h *FilesHandler) CreateDoc(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var req createDocRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	filename := filepath.Base(strings.TrimSpace(req.Name))
@@ -294,21 +333,24 @@ func (h *FilesHandler) CreateDoc(c *fiber.Ctx) error {
 	if req.ParentID != nil && strings.TrimSpace(*req.ParentID) != "" {
 		parsed, parseErr := parseUUID(strings.TrimSpace(*req.ParentID))
 		if parseErr != nil {
-			return utils.Error(c, fiber.StatusBadRequest, "invalid parentID")
+			return utils.Fail(c, errInvalidParentID)
 		}
 		var parent models.File
 		if err := h.DB.First(&parent, "id = ?", parsed).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return utils.Error(c, fiber.StatusNotFound, "parent folder not found")
+				return utils.Fail(c, errParentNotFound)
 			}
 			return utils.Error(c, fiber.StatusInternalServerError, "failed validating parent folder")
 		}
 		if !parent.IsDirectory {
-			return utils.Error(c, fiber.StatusBadRequest, "parentID must be a directory")
+			return utils.Fail(c, errParentNotDirectory)
 		}
 		if !h.Access.HasAccess(c.Context(), currentUser.ID, parent.ID, models.SharePermissionEdit) {
 			return utils.Error(c, fiber.StatusForbidden, "no permission to create in parent directory")
 		}
+		if parent.VaultID != nil {
+			return utils.Fail(c, errVaultContent)
+		}
 		parentID = &parent.ID
 	}
 
@@ -318,16 +360,36 @@ func (h *FilesHandler) CreateDoc(c *fiber.Ctx) error {
 	}
 
 	entry := models.File{
-		Name:        filename,
-		MimeType:    contentType,
-		Size:        0,
-		IsDirectory: false,
-		ParentID:    parentID,
-		OwnerID:     currentUser.ID,
-		StoragePath: objectName,
-	}
-
-	if err := h.DB.Create(&entry).Error; err != nil {
+		Name:           filename,
+		MimeType:       contentType,
+		Size:           0,
+		IsDirectory:    false,
+		ParentID:       parentID,
+		OwnerID:        currentUser.ID,
+		OrganizationID: currentUser.OrganizationID,
+		StoragePath:    objectName,
+	}
+	emptyChecksum := contentChecksum(nil)
+	entry.Checksum = &emptyChecksum
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "file.create",
+			ResourceType: "file",
+			ResourceID:   &entry.ID,
+			Details: map[string]interface{}{
+				"file_name": filename,
+				"mime_type": contentType,
+				"source":    "editor_new",
+			},
+			IPAddress: c.IP(),
+			RequestID: getRequestID(c),
+		})
+	}); err != nil {
 		_ = h.Storage.Delete(c.Context(), objectName)
 		return utils.Error(c, fiber.StatusInternalServerError, "failed creating file record")
 	}
@@ -341,20 +403,6 @@ func (h *FilesHandler) CreateDoc(c *fiber.Ctx) error {
 		"source":       "editor_new",
 	})
 
-	h.Audit.LogAsync(services.AuditEntry{
-		UserID:       &currentUser.ID,
-		Action:       "file.create",
-		ResourceType: "file",
-		ResourceID:   &entry.ID,
-		Details: map[string]interface{}{
-			"file_name": filename,
-			"mime_type": contentType,
-			"source":    "editor_new",
-		},
-		IPAddress: c.IP(),
-		RequestID: getRequestID(c),
-	})
-
 	return utils.Success(c, fiber.StatusCreated, entry)
 }
 
@@ -366,29 +414,38 @@ func (h *FilesHandler) CreateDoc(c *fiber.Ctx) error {
 func (h *FilesHandler) GetBinary(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	var file models.File
 	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return utils.Error(c, fiber.StatusNotFound, "file not found")
+			return utils.Fail(c, errFileNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+		return utils.Fail(c, errLoadingFile)
 	}
 	if file.IsDirectory {
 		return utils.Error(c, fiber.StatusBadRequest, "cannot read directory content")
 	}
+	if file.VaultID != nil {
+		return utils.Fail(c, errVaultContent)
+	}
+	if apiErr := h.checkFilePassword(c, &file, currentUser); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if apiErr := checkArchived(&file); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
 	if !isEditableSpreadsheetBinaryMime(file.MimeType) {
 		return utils.Error(c, fiber.StatusUnsupportedMediaType, "file type is not editable as a binary workbook")
 	}
 	if file.Size > editableBinaryMaxBytes {
-		return utils.Error(c, fiber.StatusRequestEntityTooLarge, fmt.Sprintf("file exceeds editor maximum of %d bytes", editableBinaryMaxBytes))
+		return utils.Fail(c, errContentTooLarge.WithMessage(fmt.Sprintf("file exceeds editor maximum of %d bytes", editableBinaryMaxBytes)))
 	}
 
 	// /binary streams the original workbook bytes to the browser, which
@@ -405,7 +462,7 @@ func (h *FilesHandler) GetBinary(c *fiber.Ctx) error {
 			"target_id":           file.ID.String(),
 			"required_permission": "download",
 		})
-		return utils.Error(c, fiber.StatusForbidden, "access denied")
+		return utils.Fail(c, errAccessDenied)
 	}
 
 	// Surface edit-permission to the spreadsheet editor in a custom
@@ -448,24 +505,27 @@ func (h *FilesHandler) GetBinary(c *fiber.Ctx) error {
 func (h *FilesHandler) SaveBinary(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	var file models.File
 	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return utils.Error(c, fiber.StatusNotFound, "file not found")
+			return utils.Fail(c, errFileNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+		return utils.Fail(c, errLoadingFile)
 	}
 	if file.IsDirectory {
 		return utils.Error(c, fiber.StatusBadRequest, "cannot save content to a directory")
 	}
+	if file.VaultID != nil {
+		return utils.Fail(c, errVaultContent)
+	}
 	if !isEditableSpreadsheetBinaryMime(file.MimeType) {
 		return utils.Error(c, fiber.StatusUnsupportedMediaType, "file type is not editable as a binary workbook")
 	}
@@ -479,10 +539,22 @@ func (h *FilesHandler) SaveBinary(c *fiber.Ctx) error {
 		})
 		return utils.Error(c, fiber.StatusForbidden, "no permission to edit this file")
 	}
+	if blocked, resp := h.rejectIfLocked(c, file.ID, currentUser.ID); blocked {
+		return resp
+	}
 
 	body := c.Body()
 	if int64(len(body)) > editableBinaryMaxBytes {
-		return utils.Error(c, fiber.StatusRequestEntityTooLarge, fmt.Sprintf("content exceeds editor maximum of %d bytes", editableBinaryMaxBytes))
+		return utils.Fail(c, errContentTooLarge.WithMessage(fmt.Sprintf("content exceeds editor maximum of %d bytes", editableBinaryMaxBytes)))
+	}
+	if apiErr := checkArchived(&file); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if apiErr := h.checkQuota(c, file.OrganizationID, int64(len(body))-file.Size); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if apiErr := h.checkGroupQuota(c, file.OwnerID, file.ParentID, int64(len(body))-file.Size); apiErr != nil {
+		return utils.Fail(c, apiErr)
 	}
 
 	// Snapshot the preview-job IDs that exist before we touch anything.
@@ -541,10 +613,29 @@ func (h *FilesHandler) SaveBinary(c *fiber.Ctx) error {
 	// in-flight worker that started before this final bump.
 	postUpdates := map[string]interface{}{
 		"size":           int64(len(body)),
+		"checksum":       contentChecksum(body),
 		"updated_at":     time.Now().UTC(),
 		"thumbnail_path": nil,
 	}
-	if err := h.DB.Model(&models.File{}).Where("id = ?", file.ID).Updates(postUpdates).Error; err != nil {
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.File{}).Where("id = ?", file.ID).Updates(postUpdates).Error; err != nil {
+			return err
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "file.edit",
+			ResourceType: "file",
+			ResourceID:   &file.ID,
+			Details: map[string]interface{}{
+				"file_name": file.Name,
+				"file_size": int64(len(body)),
+				"mime_type": file.MimeType,
+				"mode":      "binary",
+			},
+			IPAddress: c.IP(),
+			RequestID: getRequestID(c),
+		})
+	}); err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed updating file metadata")
 	}
 	if priorThumb != "" {
@@ -589,20 +680,5 @@ func (h *FilesHandler) SaveBinary(c *fiber.Ctx) error {
 		"mode":      "binary",
 	})
 
-	h.Audit.LogAsync(services.AuditEntry{
-		UserID:       &currentUser.ID,
-		Action:       "file.edit",
-		ResourceType: "file",
-		ResourceID:   &updated.ID,
-		Details: map[string]interface{}{
-			"file_name": updated.Name,
-			"file_size": updated.Size,
-			"mime_type": updated.MimeType,
-			"mode":      "binary",
-		},
-		IPAddress: c.IP(),
-		RequestID: getRequestID(c),
-	})
-
 	return utils.Success(c, fiber.StatusOK, updated)
 }
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultUpcomingDays = 30
+	maxUpcomingDays     = 365
+	// calendarFeedHistory is how far back a calendar feed keeps past due
+	// dates, and calendarFeedMax how many it lists at most.
+	calendarFeedHistory = 90 * 24 * time.Hour
+	calendarFeedMax     = 1000
+)
+
+type dueDateRequest struct {
+	DueAt         time.Time `json:"dueAt"`
+	ReminderHours []int     `json:"reminderHours"`
+	Note          string    `json:"note"`
+}
+
+// GetDueDate returns a file's due date to anyone who can view it.
+func (h *FilesHandler) GetDueDate(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	file, apiErr := h.loadFile(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionView) {
+		return utils.Fail(c, errAccessDenied)
+	}
+
+	due, err := h.DueDates.Get(c.Context(), file.ID)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "due_date_failed", "failed loading due date")))
+	}
+	return utils.Success(c, fiber.StatusOK, due)
+}
+
+// SetDueDate sets or replaces a file's due date. It needs edit permission.
+func (h *FilesHandler) SetDueDate(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	var req dueDateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	if req.DueAt.IsZero() {
+		return utils.Error(c, fiber.StatusBadRequest, "dueAt is required")
+	}
+	file, apiErr := h.loadFile(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionEdit) {
+		return utils.Fail(c, errAccessDenied)
+	}
+
+	due, err := h.DueDates.Set(c.Context(), file, req.DueAt, req.ReminderHours, req.Note, services.AuditEntry{
+		UserID:    &currentUser.ID,
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrDueDateInvalid) {
+			return utils.Fail(c, serviceError(err, nil).WithMessage(err.Error()))
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed setting due date")
+	}
+	return utils.Success(c, fiber.StatusOK, due)
+}
+
+// ClearDueDate removes a file's due date. It needs edit permission.
+func (h *FilesHandler) ClearDueDate(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	file, apiErr := h.loadFile(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionEdit) {
+		return utils.Fail(c, errAccessDenied)
+	}
+
+	if err := h.DueDates.Clear(c.Context(), file, services.AuditEntry{
+		UserID:    &currentUser.ID,
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	}); err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "due_date_failed", "failed clearing due date")))
+	}
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "due date cleared"})
+}
+
+// Upcoming lists the due dates of files the current user owns or that are
+// shared with them, soonest first: those due within the next days, and
+// with overdue=true (the default) those already past.
+func (h *FilesHandler) Upcoming(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	days := c.QueryInt("days", defaultUpcomingDays)
+	if days < 1 || days > maxUpcomingDays {
+		return utils.Error(c, fiber.StatusBadRequest, "days must be between 1 and 365")
+	}
+
+	now := time.Now().UTC()
+	query := h.visibleDueDates(c, currentUser.ID).Where("file_due_dates.due_at <= ?", now.AddDate(0, 0, days))
+	if !c.QueryBool("overdue", true) {
+		query = query.Where("file_due_dates.due_at >= ?", now)
+	}
+
+	p := utils.ParsePagination(c)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting due dates")
+	}
+	var dues []models.FileDueDate
+	if err := utils.ApplyPagination(query.Preload("File").Order("file_due_dates.due_at ASC"), p).Find(&dues).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing due dates")
+	}
+	for i := range dues {
+		dues[i].Overdue = dues[i].DueAt.Before(now)
+	}
+	return utils.Paginated(c, dues, p.Page, p.Limit, total)
+}
+
+// visibleDueDates selects the due dates of live files userID owns or that
+// are shared with them directly or through a group.
+func (h *FilesHandler) visibleDueDates(c *fiber.Ctx, userID uuid.UUID) *gorm.DB {
+	return h.DB.WithContext(c.UserContext()).Model(&models.FileDueDate{}).
+		Joins("JOIN files ON files.id = file_due_dates.file_id AND files.deleted_at IS NULL").
+		Where("files.quarantined_at IS NULL").
+		Where("files.owner_id = ? OR files.id IN (?)", userID, h.sharedWithSubquery(userID))
+}
+
+// IssueCalendarFeed gives the current user a new calendar feed address,
+// replacing the old one. The path is relative to the API and carries its
+// own credentials, so it can be given to a calendar app as is.
+func (h *FilesHandler) IssueCalendarFeed(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	token, err := h.DueDates.IssueFeed(c.Context(), services.AuditEntry{
+		UserID:    &currentUser.ID,
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed issuing calendar feed")
+	}
+	return utils.Success(c, fiber.StatusCreated, fiber.Map{
+		"path":  "/calendar/" + token + ".ics",
+		"token": token,
+	})
+}
+
+// RevokeCalendarFeed turns the current user's calendar feed off.
+func (h *FilesHandler) RevokeCalendarFeed(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	if err := h.DueDates.RevokeFeed(c.Context(), services.AuditEntry{
+		UserID:    &currentUser.ID,
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	}); err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "calendar_feed_failed", "failed revoking calendar feed")))
+	}
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "calendar feed revoked"})
+}
+
+// CalendarFeed serves a user's due dates as iCalendar to whoever holds the
+// feed's token: the ones to come and those of the last 90 days.
+func (h *FilesHandler) CalendarFeed(c *fiber.Ctx) error {
+	token := strings.TrimSuffix(strings.TrimSpace(c.Params("token")), ".ics")
+	user, err := h.DueDates.FeedUser(c.Context(), token)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "calendar_feed_failed", "failed loading calendar feed")))
+	}
+
+	var dues []models.FileDueDate
+	if err := h.visibleDueDates(c, user.ID).
+		Where("file_due_dates.due_at >= ?", time.Now().UTC().Add(-calendarFeedHistory)).
+		Preload("File").Order("file_due_dates.due_at ASC").Limit(calendarFeedMax).
+		Find(&dues).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading calendar feed")
+	}
+	c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	return c.Send(h.DueDates.Calendar(dues))
+}
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxDuplicateResolveKeeps bounds how many groups one resolve call may
+// settle.
+const maxDuplicateResolveKeeps = 100
+
+// Reasons a duplicate was left in place by ResolveDuplicates.
+const (
+	duplicateSkipLocked = "locked"
+	duplicateSkipFailed = "delete_failed"
+)
+
+var (
+	errDuplicateKeepRequired = utils.NewError(fiber.StatusBadRequest, "keep_required", "name at least one file to keep")
+	errDuplicateKeepTooMany  = utils.NewError(fiber.StatusBadRequest, "too_many_files", "at most 100 files can be kept at once")
+)
+
+// duplicateFile is one copy in a duplicate group. Path is the folder the
+// copy sits in, from the owner's root, so copies with the same name can be
+// told apart.
+type duplicateFile struct {
+	models.File
+	Path string `json:"path"`
+}
+
+type duplicateGroup struct {
+	Checksum    string          `json:"checksum"`
+	Size        int64           `json:"size"`
+	Count       int64           `json:"count"`
+	WastedBytes int64           `json:"wastedBytes"`
+	Files       []duplicateFile `json:"files"`
+}
+
+type duplicateRow struct {
+	Checksum    string
+	Size        int64
+	Count       int64
+	WastedBytes int64
+}
+
+// duplicateCandidates are the files the duplicate report looks at: the
+// user's own non-empty, hashed files. Quarantined files are left out since
+// their owner cannot act on them.
+func (h *FilesHandler) duplicateCandidates(userID uuid.UUID) *gorm.DB {
+	return h.DB.Model(&models.File{}).
+		Where("owner_id = ? AND is_directory = ? AND size > 0 AND quarantined_at IS NULL", userID, false)
+}
+
+// Duplicates groups the caller's files by content checksum and lists the
+// groups with more than one copy, most wasted bytes first. Only files the
+// caller owns are considered, since those are what counts against their
+// quota.
+func (h *FilesHandler) Duplicates(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	p := utils.ParsePagination(c)
+
+	grouped := h.duplicateCandidates(currentUser.ID).
+		Where("checksum IS NOT NULL").
+		Select("checksum, size, COUNT(*) AS count, (COUNT(*) - 1) * size AS wasted_bytes").
+		Group("checksum, size").
+		Having("COUNT(*) > 1")
+
+	var summary struct {
+		GroupCount  int64
+		FileCount   int64
+		WastedBytes int64
+	}
+	if err := h.DB.Table("(?) AS duplicates", grouped).
+		Select("COUNT(*) AS group_count, COALESCE(SUM(count), 0) AS file_count, COALESCE(SUM(wasted_bytes), 0) AS wasted_bytes").
+		Scan(&summary).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed finding duplicates")
+	}
+	var unhashed int64
+	if err := h.duplicateCandidates(currentUser.ID).Where("checksum IS NULL").Count(&unhashed).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed finding duplicates")
+	}
+
+	var rows []duplicateRow
+	if err := grouped.Order("wasted_bytes DESC, checksum").Offset(p.Offset).Limit(p.Limit).Scan(&rows).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed finding duplicates")
+	}
+
+	groups := make([]duplicateGroup, len(rows))
+	index := make(map[string]int, len(rows))
+	checksums := make([]string, len(rows))
+	for i, row := range rows {
+		groups[i] = duplicateGroup{Checksum: row.Checksum, Size: row.Size, Count: row.Count, WastedBytes: row.WastedBytes, Files: []duplicateFile{}}
+		index[row.Checksum] = i
+		checksums[i] = row.Checksum
+	}
+	if len(rows) > 0 {
+		var files []models.File
+		if err := h.duplicateCandidates(currentUser.ID).
+			Where("checksum IN ?", checksums).
+			Order("created_at, id").
+			Find(&files).Error; err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed loading duplicates")
+		}
+		h.annotateListing(c.Context(), files)
+		paths := h.folderPaths(files)
+		for _, file := range files {
+			i, ok := index[*file.Checksum]
+			if !ok || file.Size != groups[i].Size {
+				continue
+			}
+			path := "/"
+			if file.ParentID != nil {
+				path = paths[*file.ParentID]
+			}
+			groups[i].Files = append(groups[i].Files, duplicateFile{File: file, Path: path})
+		}
+	}
+
+	totalPages := int((summary.GroupCount + int64(p.Limit) - 1) / int64(p.Limit))
+	return utils.Success(c, fiber.StatusOK, fiber.Map{
+		"summary": fiber.Map{
+			"groups":        summary.GroupCount,
+			"files":         summary.FileCount,
+			"wastedBytes":   summary.WastedBytes,
+			"unhashedFiles": unhashed,
+		},
+		"groups": groups,
+		"pagination": fiber.Map{
+			"page":       p.Page,
+			"limit":      p.Limit,
+			"total":      summary.GroupCount,
+			"totalPages": totalPages,
+		},
+	})
+}
+
+// folderPaths resolves the path of every folder the files sit in, loading
+// one level of ancestors per query. A parent loop ends the walk.
+func (h *FilesHandler) folderPaths(files []models.File) map[uuid.UUID]string {
+	folders := map[uuid.UUID]models.File{}
+	var pending []uuid.UUID
+	for _, file := range files {
+		if file.ParentID != nil {
+			pending = append(pending, *file.ParentID)
+		}
+	}
+	for len(pending) > 0 {
+		var loaded []models.File
+		if err := h.DB.Select("id", "name", "parent_id").Where("id IN ?", pending).Find(&loaded).Error; err != nil {
+			break
+		}
+		pending = nil
+		for _, folder := range loaded {
+			folders[folder.ID] = folder
+		}
+		for _, folder := range loaded {
+			if folder.ParentID == nil {
+				continue
+			}
+			if _, ok := folders[*folder.ParentID]; !ok {
+				pending = append(pending, *folder.ParentID)
+			}
+		}
+	}
+
+	paths := make(map[uuid.UUID]string, len(folders))
+	for id := range folders {
+		var names []string
+		seen := map[uuid.UUID]bool{}
+		for current, ok := folders[id]; ok && !seen[current.ID]; {
+			seen[current.ID] = true
+			names = append(names, current.Name)
+			if current.ParentID == nil {
+				break
+			}
+			current, ok = folders[*current.ParentID]
+		}
+		for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+			names[i], names[j] = names[j], names[i]
+		}
+		paths[id] = "/" + strings.Join(names, "/")
+	}
+	return paths
+}
+
+type resolveDuplicatesRequest struct {
+	Keep []string `json:"keep"`
+}
+
+type duplicateSkip struct {
+	ID     uuid.UUID `json:"id"`
+	Reason string    `json:"reason"`
+}
+
+type duplicateResolution struct {
+	Keep    string          `json:"keep"`
+	Deleted []uuid.UUID     `json:"deleted"`
+	Skipped []duplicateSkip `json:"skipped,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// ResolveDuplicates keeps each named file and deletes the caller's other
+// copies of it: their files with the same checksum and size. Files named in
+// keep are never deleted, so several copies of one content can be kept.
+// Copies locked by someone else are skipped. Each delete is its own
+// file.delete event, as if the caller had deleted the copy themselves.
+func (h *FilesHandler) ResolveDuplicates(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	var req resolveDuplicatesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	if len(req.Keep) == 0 {
+		return utils.Fail(c, errDuplicateKeepRequired)
+	}
+	if len(req.Keep) > maxDuplicateResolveKeeps {
+		return utils.Fail(c, errDuplicateKeepTooMany)
+	}
+
+	kept := map[uuid.UUID]bool{}
+	keepIDs := make([]uuid.UUID, len(req.Keep))
+	for i, raw := range req.Keep {
+		if id, err := uuid.Parse(raw); err == nil {
+			keepIDs[i] = id
+			kept[id] = true
+		}
+	}
+	keepList := make([]uuid.UUID, 0, len(kept))
+	for id := range kept {
+		keepList = append(keepList, id)
+	}
+
+	results := make([]duplicateResolution, len(req.Keep))
+	var deleted int
+	var freed int64
+	for i, raw := range req.Keep {
+		results[i] = duplicateResolution{Keep: raw, Deleted: []uuid.UUID{}}
+		if keepIDs[i] == uuid.Nil {
+			results[i].Error = "invalid file ID"
+			continue
+		}
+		var keep models.File
+		if err := h.duplicateCandidates(currentUser.ID).Where("checksum IS NOT NULL").
+			First(&keep, "id = ?", keepIDs[i]).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+			}
+			results[i].Error = "not one of your files with a checksum"
+			continue
+		}
+
+		var copies []models.File
+		if err := h.duplicateCandidates(currentUser.ID).
+			Where("checksum = ? AND size = ? AND id NOT IN ?", *keep.Checksum, keep.Size, keepList).
+			Find(&copies).Error; err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed loading duplicates")
+		}
+		for _, dup := range copies {
+			_, err := h.Locks.CheckWritable(c.Context(), dup.ID, currentUser.ID)
+			if errors.Is(err, services.ErrFileLocked) {
+				results[i].Skipped = append(results[i].Skipped, duplicateSkip{ID: dup.ID, Reason: duplicateSkipLocked})
+				continue
+			}
+			if err == nil {
+				err = h.deleteDuplicate(c, currentUser.ID, dup, keep.ID)
+			}
+			if err != nil {
+				logger.Error("duplicate_delete_failed", err, map[string]interface{}{
+					"file_id": dup.ID.String(),
+				})
+				results[i].Skipped = append(results[i].Skipped, duplicateSkip{ID: dup.ID, Reason: duplicateSkipFailed})
+				continue
+			}
+			results[i].Deleted = append(results[i].Deleted, dup.ID)
+			deleted++
+			freed += dup.Size
+		}
+	}
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{
+		"deleted":    deleted,
+		"freedBytes": freed,
+		"results":    results,
+	})
+}
+
+func (h *FilesHandler) deleteDuplicate(c *fiber.Ctx, userID uuid.UUID, dup models.File, keptID uuid.UUID) error {
+	recipients := h.shareRecipients(dup.ID, userID)
+	var removed []models.File
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := h.deleteRecursive(c.Context(), tx, dup.ID, &removed); err != nil {
+			return err
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &userID,
+			Action:       "file.delete",
+			ResourceType: "file",
+			ResourceID:   &dup.ID,
+			Details: map[string]interface{}{
+				"file_name":       dup.Name,
+				"is_directory":    false,
+				"notify_user_ids": recipients,
+				"reason":          "duplicate",
+				"kept_file_id":    keptID.String(),
+			},
+			IPAddress: c.IP(),
+			RequestID: getRequestID(c),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	h.removeObjects(c.Context(), removed)
+	return nil
+}
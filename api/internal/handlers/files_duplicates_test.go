@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestFileDuplicates(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "dupes-owner@test.com", "password123", models.UserRoleUser)
+	other, _ := createTestUser(t, env.db, "dupes-other@test.com", "password123", models.UserRoleUser)
+
+	folder := models.File{Name: "Backups", MimeType: "inode/directory", IsDirectory: true, OwnerID: owner.ID}
+	if err := env.db.Create(&folder).Error; err != nil {
+		t.Fatalf("failed creating folder: %v", err)
+	}
+	create := func(name string, size int64, checksum string, ownerID uuid.UUID, parent *uuid.UUID) models.File {
+		t.Helper()
+		f := models.File{Name: name, MimeType: "application/pdf", Size: size, OwnerID: ownerID, ParentID: parent}
+		if checksum != "" {
+			f.Checksum = &checksum
+		}
+		if err := env.db.Create(&f).Error; err != nil {
+			t.Fatalf("failed creating file: %v", err)
+		}
+		return f
+	}
+	report := create("report.pdf", 1000, "aaa", owner.ID, nil)
+	reportCopy := create("report.pdf", 1000, "aaa", owner.ID, &folder.ID)
+	reportOld := create("report (1).pdf", 1000, "aaa", owner.ID, &folder.ID)
+	create("photo.jpg", 300, "bbb", owner.ID, nil)
+	photoCopy := create("photo copy.jpg", 300, "bbb", owner.ID, nil)
+	create("unique.pdf", 50, "ccc", owner.ID, nil)
+	create("unhashed.pdf", 1000, "", owner.ID, nil)
+	create("report.pdf", 1000, "aaa", other.ID, nil)
+
+	t.Run("groups copies by checksum", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/duplicates", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+
+		summary := data["summary"].(map[string]any)
+		if summary["groups"] != float64(2) || summary["files"] != float64(5) || summary["wastedBytes"] != float64(2300) || summary["unhashedFiles"] != float64(1) {
+			t.Fatalf("unexpected summary %v", summary)
+		}
+		groups := data["groups"].([]any)
+		first := groups[0].(map[string]any)
+		if first["checksum"] != "aaa" || first["wastedBytes"] != float64(2000) {
+			t.Fatalf("expected the most wasteful group first, got %v", first)
+		}
+		files := first["files"].([]any)
+		if len(files) != 3 {
+			t.Fatalf("expected only the owner's three copies, got %d", len(files))
+		}
+		if path := files[1].(map[string]any)["path"]; path != "/Backups" {
+			t.Fatalf("expected the copy's folder path, got %v", path)
+		}
+	})
+
+	t.Run("keeps one and deletes the rest", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/duplicates/resolve", map[string]any{
+			"keep": []string{reportCopy.ID.String(), "not-an-id"},
+		}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		if data["deleted"] != float64(2) || data["freedBytes"] != float64(2000) {
+			t.Fatalf("unexpected result %v", data)
+		}
+		if errMsg := data["results"].([]any)[1].(map[string]any)["error"]; errMsg == nil {
+			t.Fatal("expected the invalid ID to be reported")
+		}
+
+		var left []uuid.UUID
+		env.db.Model(&models.File{}).Where("checksum = ?", "aaa").Pluck("id", &left)
+		if len(left) != 2 {
+			t.Fatalf("expected the kept copy and the other user's file, got %v", left)
+		}
+		for _, id := range left {
+			if id == report.ID || id == reportOld.ID {
+				t.Fatalf("expected %s to be deleted", id)
+			}
+		}
+		var events int64
+		env.db.Model(&models.OutboxEvent{}).Where("event_type = ? AND resource_id = ?", "file.delete", report.ID).Count(&events)
+		if events != 1 {
+			t.Fatalf("expected a file.delete event for each copy, got %d", events)
+		}
+	})
+
+	t.Run("leaves other users' files alone", func(t *testing.T) {
+		_, otherToken := createTestUser(t, env.db, "dupes-third@test.com", "password123", models.UserRoleUser)
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/duplicates/resolve", map[string]any{
+			"keep": []string{photoCopy.ID.String()},
+		}, authHeaders(otherToken))
+		assertStatus(t, resp, http.StatusOK)
+		if deleted := decodeJSONMap(t, resp)["data"].(map[string]any)["deleted"]; deleted != float64(0) {
+			t.Fatalf("expected nothing deleted, got %v", deleted)
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/files/duplicates/resolve", map[string]any{"keep": []string{}}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+}
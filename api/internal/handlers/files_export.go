@@ -3,6 +3,8 @@ package handlers
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/docshare/api/internal/middleware"
 	"github.com/docshare/api/internal/models"
@@ -20,7 +22,7 @@ import (
 func (h *FilesHandler) Export(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	if h.ExportService == nil {
@@ -29,7 +31,7 @@ func (h *FilesHandler) Export(c *fiber.Ctx) error {
 
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	format, ok := services.ParseFormat(c.Query("format"))
@@ -40,13 +42,22 @@ func (h *FilesHandler) Export(c *fiber.Ctx) error {
 	var file models.File
 	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return utils.Error(c, fiber.StatusNotFound, "file not found")
+			return utils.Fail(c, errFileNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+		return utils.Fail(c, errLoadingFile)
 	}
 	if file.IsDirectory {
 		return utils.Error(c, fiber.StatusBadRequest, "cannot export a directory")
 	}
+	if file.VaultID != nil {
+		return utils.Fail(c, errVaultContent)
+	}
+	if apiErr := h.checkFilePassword(c, &file, currentUser); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if apiErr := checkArchived(&file); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
 	if !services.IsExportableSource(file.MimeType) {
 		return utils.Error(c, fiber.StatusUnsupportedMediaType, "file type cannot be exported")
 	}
@@ -58,23 +69,24 @@ func (h *FilesHandler) Export(c *fiber.Ctx) error {
 			"file_name":           file.Name,
 			"required_permission": "download",
 		})
-		return utils.Error(c, fiber.StatusForbidden, "access denied")
+		return utils.Fail(c, errAccessDenied)
 	}
 
 	result, err := h.ExportService.Export(c.Context(), &file, format)
 	if err != nil {
-		switch {
-		case errors.Is(err, services.ErrFormatNotSupported):
-			return utils.Error(c, fiber.StatusBadRequest, "format not supported for this file type")
-		case errors.Is(err, services.ErrPandocMissing):
-			return utils.Error(c, fiber.StatusServiceUnavailable, "this format requires pandoc, which is not installed on the server")
-		default:
+		apiErr := serviceError(err, nil)
+		if apiErr == nil {
 			logger.Error("file_export_failed", err, map[string]interface{}{
 				"file_id": file.ID.String(),
 				"format":  string(format),
 			})
 			return utils.Error(c, fiber.StatusInternalServerError, "export failed")
 		}
+		if errors.Is(err, services.ErrGotenbergUnavailable) {
+			retryAfter := time.Until(h.ExportService.Pool.RetryAt())
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(max(1, int(retryAfter.Round(time.Second).Seconds()))))
+		}
+		return utils.Fail(c, apiErr)
 	}
 
 	logger.InfoWithUser(currentUser.ID.String(), "file_exported", map[string]interface{}{
@@ -215,6 +215,14 @@ func TestFilesEndpoints(t *testing.T) {
 		if data["url"] != "/api/files/"+file.ID.String()+"/download" {
 			t.Fatalf("unexpected download URL %v", data["url"])
 		}
+
+		// Without replicas a direct download falls back to the API.
+		resp = performRequest(t, env.app, http.MethodGet, "/api/files/"+file.ID.String()+"/download-url?direct=true", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		data = decodeJSONMap(t, resp)["data"].(map[string]any)
+		if data["url"] != "/api/files/"+file.ID.String()+"/download" || data["direct"] != false {
+			t.Fatalf("expected the proxied download URL, got %v", data)
+		}
 	})
 
 	t.Run("DELETE /api/files/:id delete directory", func(t *testing.T) {
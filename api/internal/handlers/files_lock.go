@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type lockFileRequest struct {
+	TTLSeconds int    `json:"ttlSeconds"`
+	Reason     string `json:"reason"`
+}
+
+// GetLock returns the active lock on a file, or null when it is unlocked.
+func (h *FilesHandler) GetLock(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+
+	if !h.Access.HasAccess(c.Context(), currentUser.ID, fileID, models.SharePermissionView) {
+		return utils.Fail(c, errAccessDenied)
+	}
+
+	lock, err := h.Locks.ActiveLock(c.Context(), fileID)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading lock")
+	}
+
+	return utils.Success(c, fiber.StatusOK, lock)
+}
+
+// Lock takes or refreshes an advisory lock. Holders call it again before the
+// TTL runs out to keep the lock alive.
+func (h *FilesHandler) Lock(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+
+	var file models.File
+	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Fail(c, errFileNotFound)
+		}
+		return utils.Fail(c, errLoadingFile)
+	}
+	if file.IsDirectory {
+		return utils.Error(c, fiber.StatusBadRequest, "cannot lock a directory")
+	}
+
+	canEdit := file.OwnerID == currentUser.ID || h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionEdit)
+	if !canEdit {
+		return utils.Fail(c, errAccessDenied)
+	}
+
+	var req lockFileRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return utils.Fail(c, errInvalidBody)
+		}
+	}
+	if req.TTLSeconds < 0 {
+		return utils.Error(c, fiber.StatusBadRequest, "ttlSeconds must be positive")
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if len(reason) > 255 {
+		return utils.Error(c, fiber.StatusBadRequest, "reason must be at most 255 characters")
+	}
+
+	lock, err := h.Locks.Acquire(c.Context(), file.ID, currentUser.ID, time.Duration(req.TTLSeconds)*time.Second, reason)
+	if errors.Is(err, services.ErrFileLocked) {
+		return utils.Fail(c, errFileLocked.WithMessage(lockedMessage(lock)))
+	}
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed locking file")
+	}
+
+	logger.InfoWithUser(currentUser.ID.String(), "file_locked", map[string]interface{}{
+		"file_id":    file.ID.String(),
+		"expires_at": lock.ExpiresAt,
+	})
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "file.lock",
+		ResourceType: "file",
+		ResourceID:   &file.ID,
+		Details: map[string]interface{}{
+			"file_name":  file.Name,
+			"expires_at": lock.ExpiresAt,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusOK, lock)
+}
+
+// Unlock releases a lock. The file owner and the organization's admins may
+// break a lock held by someone else.
+func (h *FilesHandler) Unlock(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+
+	var file models.File
+	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Fail(c, errFileNotFound)
+		}
+		return utils.Fail(c, errLoadingFile)
+	}
+
+	// The owner, and admins of the file's organization who may manage its
+	// storage, can break a stale lock without a share on the file. Anyone
+	// else needs edit access and can only release their own lock.
+	force := file.OwnerID == currentUser.ID ||
+		(services.HasAdminPermission(currentUser, services.PermissionStorageManage) &&
+			services.SameOrganization(file.OrganizationID, currentUser.OrganizationID))
+	if !force && !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionEdit) {
+		return utils.Fail(c, errAccessDenied)
+	}
+
+	if err := h.Locks.Release(c.Context(), file.ID, currentUser.ID, force); err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "file_unlock_failed", "failed unlocking file")))
+	}
+
+	logger.InfoWithUser(currentUser.ID.String(), "file_unlocked", map[string]interface{}{
+		"file_id": file.ID.String(),
+	})
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "file.unlock",
+		ResourceType: "file",
+		ResourceID:   &file.ID,
+		Details: map[string]interface{}{
+			"file_name": file.Name,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "file unlocked"})
+}
+
+// rejectIfLocked writes a 423 response when someone other than userID holds
+// an active lock on fileID. When blocked is true the caller must return resp
+// straight away.
+func (h *FilesHandler) rejectIfLocked(c *fiber.Ctx, fileID, userID uuid.UUID) (blocked bool, resp error) {
+	lock, err := h.Locks.CheckWritable(c.Context(), fileID, userID)
+	if errors.Is(err, services.ErrFileLocked) {
+		return true, utils.Fail(c, errFileLocked.WithMessage(lockedMessage(lock)))
+	}
+	if err != nil {
+		return true, utils.Error(c, fiber.StatusInternalServerError, "failed checking file lock")
+	}
+	return false, nil
+}
+
+func lockedMessage(lock *models.FileLock) string {
+	if lock == nil || lock.LockedBy.Email == "" {
+		return "file is locked by another user"
+	}
+	return "file is locked by " + lock.LockedBy.Email + " until " + lock.ExpiresAt.UTC().Format(time.RFC3339)
+}
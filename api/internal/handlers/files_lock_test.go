@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+)
+
+func TestFilesHandler_Locks(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "lock-owner@test.com", "password123", models.UserRoleUser)
+	editor, editorToken := createTestUser(t, env.db, "lock-editor@test.com", "password123", models.UserRoleUser)
+	_, viewerToken := createTestUser(t, env.db, "lock-viewer@test.com", "password123", models.UserRoleUser)
+
+	file := models.File{Name: "notes.txt", MimeType: "text/plain", Size: 1, OwnerID: owner.ID, StoragePath: "notes"}
+	if err := env.db.Create(&file).Error; err != nil {
+		t.Fatalf("failed creating file: %v", err)
+	}
+	if err := env.db.Create(&models.Share{FileID: file.ID, SharedByID: owner.ID, SharedWithUserID: &editor.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionEdit}).Error; err != nil {
+		t.Fatalf("failed creating share: %v", err)
+	}
+	lockPath := "/api/files/" + file.ID.String() + "/lock"
+
+	t.Run("POST /api/files/:id/lock requires edit permission", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, lockPath, map[string]any{}, authHeaders(viewerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("POST /api/files/:id/lock acquires lock", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, lockPath, map[string]any{
+			"ttlSeconds": 600,
+			"reason":     "editing",
+		}, authHeaders(editorToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		data := body["data"].(map[string]any)
+		if data["lockedByID"] != editor.ID.String() || data["reason"] != "editing" {
+			t.Fatalf("unexpected lock payload %v", data)
+		}
+	})
+
+	t.Run("POST /api/files/:id/lock conflicts for other user", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, lockPath, map[string]any{}, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusLocked)
+		if msg, _ := body["error"].(string); msg == "" {
+			t.Fatalf("expected lock holder in error message")
+		}
+	})
+
+	t.Run("GET /api/files/:id includes lock info", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/"+file.ID.String(), nil, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		lock, ok := body["data"].(map[string]any)["lock"].(map[string]any)
+		if !ok || lock["lockedByID"] != editor.ID.String() {
+			t.Fatalf("expected lock in file response, got %v", body["data"])
+		}
+	})
+
+	t.Run("PUT /api/files/:id blocked while locked by someone else", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/files/"+file.ID.String(), map[string]any{"name": "renamed.txt"}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusLocked)
+	})
+
+	t.Run("PUT /api/files/:id allowed for lock holder", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/files/"+file.ID.String(), map[string]any{"name": "renamed.txt"}, authHeaders(editorToken))
+		assertStatus(t, resp, http.StatusOK)
+	})
+
+	t.Run("PUT /api/files/:id/content blocked while locked", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/files/"+file.ID.String()+"/content", map[string]any{"content": "x"}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusLocked)
+	})
+
+	t.Run("DELETE /api/files/:id/lock owner can break lock", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodDelete, lockPath, nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performRequest(t, env.app, http.MethodGet, lockPath, nil, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if body["data"] != nil {
+			t.Fatalf("expected no active lock, got %v", body["data"])
+		}
+	})
+
+	t.Run("DELETE /api/files/:id/lock non-holder editor cannot release", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, lockPath, map[string]any{}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performRequest(t, env.app, http.MethodDelete, lockPath, nil, authHeaders(editorToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusForbidden)
+		assertEnvelopeError(t, body, "lock is held by another user")
+	})
+
+	t.Run("DELETE /api/files/:id/lock admins break locks in their organization", func(t *testing.T) {
+		org := models.Organization{Name: "Initech", Slug: "initech"}
+		if err := env.db.Create(&org).Error; err != nil {
+			t.Fatalf("failed creating organization: %v", err)
+		}
+		outsider, outsiderToken := createTestUser(t, env.db, "lock-outsider@test.com", "password123", models.UserRoleAdmin)
+		env.db.Model(&outsider).Update("organization_id", org.ID)
+		headers := authHeaders(outsiderToken)
+		headers["X-Organization"] = org.Slug
+		resp := performRequest(t, env.app, http.MethodDelete, lockPath, nil, headers)
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusForbidden)
+		if body["code"] != "access_denied" {
+			t.Fatalf("expected access_denied, got %v", body)
+		}
+
+		// No share on the file is needed.
+		_, adminToken := createTestUser(t, env.db, "lock-admin@test.com", "password123", models.UserRoleAdmin)
+		resp = performRequest(t, env.app, http.MethodDelete, lockPath, nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, lockPath, map[string]any{}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+	})
+
+	t.Run("expired locks are ignored and cleaned up", func(t *testing.T) {
+		if err := env.db.Model(&models.FileLock{}).Where("file_id = ?", file.ID).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+			t.Fatalf("failed expiring lock: %v", err)
+		}
+
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/files/"+file.ID.String(), map[string]any{"name": "again.txt"}, authHeaders(editorToken))
+		assertStatus(t, resp, http.StatusOK)
+
+		services.CleanupExpiredLocks(env.db)
+		var count int64
+		env.db.Unscoped().Model(&models.FileLock{}).Count(&count)
+		if count != 0 {
+			t.Fatalf("expected expired lock to be removed, %d remain", count)
+		}
+	})
+}
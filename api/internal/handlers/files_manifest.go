@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Manifest returns a signed listing of every file below a folder with its
+// size and SHA-256 digest, so recipients of a downloaded copy can verify it
+// against the server's published key.
+func (h *FilesHandler) Manifest(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+
+	var folder models.File
+	if err := h.DB.First(&folder, "id = ?", fileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Fail(c, errFileNotFound)
+		}
+		return utils.Fail(c, errLoadingFile)
+	}
+
+	if !h.Access.HasAccess(c.Context(), currentUser.ID, folder.ID, models.SharePermissionDownload) {
+		return utils.Fail(c, errAccessDenied)
+	}
+	if !folder.IsDirectory {
+		return utils.Error(c, fiber.StatusBadRequest, "manifests are only available for folders")
+	}
+
+	signed, err := h.Manifests.Build(c.Context(), folder, currentUser.ID)
+	if err != nil {
+		return h.manifestError(c, folder, err)
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "file.manifest",
+		ResourceType: "file",
+		ResourceID:   &folder.ID,
+		Details: map[string]interface{}{
+			"file_name":  folder.Name,
+			"file_count": signed.Manifest.FileCount,
+			"total_size": signed.Manifest.TotalSize,
+			"key_id":     signed.KeyID,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusOK, signed)
+}
+
+// Diff compares the folder in :id with the folder named by ?against= and
+// reports what was added, removed or changed in :id relative to it.
+func (h *FilesHandler) Diff(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+	againstRaw := c.Query("against")
+	if againstRaw == "" {
+		return utils.Error(c, fiber.StatusBadRequest, "against is required")
+	}
+	againstID, err := parseUUID(againstRaw)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, "invalid against id")
+	}
+
+	var folders [2]models.File
+	for i, id := range []uuid.UUID{fileID, againstID} {
+		if err := h.DB.First(&folders[i], "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return utils.Fail(c, errFileNotFound)
+			}
+			return utils.Fail(c, errLoadingFile)
+		}
+		if !h.Access.HasAccess(c.Context(), currentUser.ID, id, models.SharePermissionDownload) {
+			return utils.Fail(c, errAccessDenied)
+		}
+		if !folders[i].IsDirectory {
+			return utils.Error(c, fiber.StatusBadRequest, "diff is only available for folders")
+		}
+	}
+	target, base := folders[0], folders[1]
+
+	var entries [2][]services.ManifestEntry
+	for i, folder := range []models.File{base, target} {
+		entries[i], err = h.Manifests.Entries(c.Context(), folder.ID)
+		if err != nil {
+			return h.manifestError(c, folder, err)
+		}
+	}
+	diff := services.DiffEntries(entries[0], entries[1])
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{
+		"folder":    fiber.Map{"id": target.ID, "name": target.Name},
+		"against":   fiber.Map{"id": base.ID, "name": base.Name},
+		"identical": diff.Identical(),
+		"added":     diff.Added,
+		"removed":   diff.Removed,
+		"changed":   diff.Changed,
+		"unchanged": diff.Unchanged,
+	})
+}
+
+// manifestError maps tree-walk failures shared by Manifest and Diff.
+func (h *FilesHandler) manifestError(c *fiber.Ctx, folder models.File, err error) error {
+	if errors.Is(err, services.ErrManifestTooLarge) {
+		return utils.Fail(c, serviceError(err, nil))
+	}
+	logger.Error("manifest_build_failed", err, map[string]interface{}{
+		"file_id": folder.ID.String(),
+	})
+	return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "manifest_build_failed", "failed building manifest")))
+}
+
+// ManifestKey publishes the public half of the manifest signing key.
+func (h *FilesHandler) ManifestKey(c *fiber.Ctx) error {
+	return utils.Success(c, fiber.StatusOK, fiber.Map{
+		"algorithm": services.ManifestSignatureAlgorithm,
+		"keyID":     h.Manifests.KeyID(),
+		"publicKey": base64.StdEncoding.EncodeToString(h.Manifests.PublicKey()),
+	})
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestFilesHandler_Manifest(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "manifest-owner@test.com", "password123", models.UserRoleUser)
+	viewer, viewerToken := createTestUser(t, env.db, "manifest-viewer@test.com", "password123", models.UserRoleUser)
+	_, strangerToken := createTestUser(t, env.db, "manifest-stranger@test.com", "password123", models.UserRoleUser)
+
+	folder := models.File{Name: "evidence", MimeType: "inode/directory", IsDirectory: true, OwnerID: owner.ID}
+	if err := env.db.Create(&folder).Error; err != nil {
+		t.Fatalf("failed creating folder: %v", err)
+	}
+	checksum := contentChecksum([]byte("exhibit"))
+	file := models.File{Name: "exhibit-a.txt", MimeType: "text/plain", Size: 7, ParentID: &folder.ID, OwnerID: owner.ID, StoragePath: "exhibit", Checksum: &checksum}
+	if err := env.db.Create(&file).Error; err != nil {
+		t.Fatalf("failed creating file: %v", err)
+	}
+	if err := env.db.Create(&models.Share{FileID: folder.ID, SharedByID: owner.ID, SharedWithUserID: &viewer.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView}).Error; err != nil {
+		t.Fatalf("failed creating share: %v", err)
+	}
+	manifestPath := "/api/files/" + folder.ID.String() + "/manifest"
+
+	t.Run("GET /api/files/:id/manifest returns signed manifest", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, manifestPath, nil, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		data := body["data"].(map[string]any)
+		entries := data["manifest"].(map[string]any)["entries"].([]any)
+		if len(entries) != 1 {
+			t.Fatalf("expected one entry, got %v", entries)
+		}
+		entry := entries[0].(map[string]any)
+		if entry["path"] != "exhibit-a.txt" || entry["sha256"] != checksum {
+			t.Fatalf("unexpected entry: %v", entry)
+		}
+
+		keyResp := performRequest(t, env.app, http.MethodGet, "/api/public/manifest-key", nil, nil)
+		keyBody := decodeJSONMap(t, keyResp)
+		assertStatus(t, keyResp, http.StatusOK)
+		key := keyBody["data"].(map[string]any)
+		if key["keyID"] != data["keyID"] || key["algorithm"] != "ed25519" {
+			t.Fatalf("expected key metadata to match manifest, got %v vs %v", key, data["keyID"])
+		}
+		pub, _ := base64.StdEncoding.DecodeString(key["publicKey"].(string))
+		payload, _ := base64.StdEncoding.DecodeString(data["payload"].(string))
+		sig, _ := base64.StdEncoding.DecodeString(data["signature"].(string))
+		if !ed25519.Verify(ed25519.PublicKey(pub), payload, sig) {
+			t.Fatal("expected signature to verify against the published key")
+		}
+	})
+
+	t.Run("GET /api/files/:id/manifest requires download permission", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, manifestPath, nil, authHeaders(viewerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+
+		resp = performRequest(t, env.app, http.MethodGet, manifestPath, nil, authHeaders(strangerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("GET /api/files/:id/manifest rejects files", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/"+file.ID.String()+"/manifest", nil, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusBadRequest)
+		assertEnvelopeError(t, body, "manifests are only available for folders")
+	})
+}
+
+func TestFilesHandler_Diff(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "diff-owner@test.com", "password123", models.UserRoleUser)
+	_, strangerToken := createTestUser(t, env.db, "diff-stranger@test.com", "password123", models.UserRoleUser)
+
+	mkdir := func(name string) models.File {
+		dir := models.File{Name: name, MimeType: "inode/directory", IsDirectory: true, OwnerID: owner.ID}
+		if err := env.db.Create(&dir).Error; err != nil {
+			t.Fatalf("failed creating folder: %v", err)
+		}
+		return dir
+	}
+	put := func(parent models.File, name, content string) models.File {
+		checksum := contentChecksum([]byte(content))
+		f := models.File{Name: name, MimeType: "text/plain", Size: int64(len(content)), ParentID: &parent.ID, OwnerID: owner.ID, StoragePath: name, Checksum: &checksum}
+		if err := env.db.Create(&f).Error; err != nil {
+			t.Fatalf("failed creating file: %v", err)
+		}
+		return f
+	}
+
+	v1, v2 := mkdir("v1"), mkdir("v2")
+	put(v1, "app.bin", "one")
+	put(v1, "LICENSE", "mit")
+	put(v1, "removed.txt", "gone")
+	put(v2, "app.bin", "two!")
+	put(v2, "LICENSE", "mit")
+	readme := put(v2, "README.md", "hi")
+
+	t.Run("GET /api/files/:id/diff reports added, removed and changed", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/"+v2.ID.String()+"/diff?against="+v1.ID.String(), nil, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		data := body["data"].(map[string]any)
+		paths := func(key string) []string {
+			var out []string
+			for _, item := range data[key].([]any) {
+				out = append(out, item.(map[string]any)["path"].(string))
+			}
+			return out
+		}
+		if got := paths("added"); len(got) != 1 || got[0] != "README.md" {
+			t.Fatalf("unexpected added: %v", got)
+		}
+		if got := paths("removed"); len(got) != 1 || got[0] != "removed.txt" {
+			t.Fatalf("unexpected removed: %v", got)
+		}
+		if got := paths("changed"); len(got) != 1 || got[0] != "app.bin" {
+			t.Fatalf("unexpected changed: %v", got)
+		}
+		if data["unchanged"].(float64) != 1 || data["identical"] != false {
+			t.Fatalf("unexpected summary: %v", data)
+		}
+	})
+
+	t.Run("GET /api/files/:id/diff identical folders", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/"+v1.ID.String()+"/diff?against="+v1.ID.String(), nil, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if body["data"].(map[string]any)["identical"] != true {
+			t.Fatalf("expected identical, got %v", body["data"])
+		}
+	})
+
+	t.Run("GET /api/files/:id/diff validates input", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/"+v2.ID.String()+"/diff", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/files/"+v2.ID.String()+"/diff?against="+readme.ID.String(), nil, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusBadRequest)
+		assertEnvelopeError(t, body, "diff is only available for folders")
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/files/"+v2.ID.String()+"/diff?against="+v1.ID.String(), nil, authHeaders(strangerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errFileNotMuted = utils.NewError(fiber.StatusNotFound, "file_not_muted", "file is not muted")
+
+// Mute stops activity about a file, or about anything in a folder, from
+// reaching the current user's feed. Muting twice is harmless.
+func (h *FilesHandler) Mute(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+
+	db := h.DB.WithContext(c.UserContext())
+	var file models.File
+	if err := db.First(&file, "id = ?", fileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Fail(c, errFileNotFound)
+		}
+		return utils.Fail(c, errLoadingFile)
+	}
+	if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionView) {
+		return utils.Fail(c, errAccessDenied)
+	}
+
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.ActivityMute{UserID: currentUser.ID, FileID: file.ID}).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed muting file")
+	}
+	var mute models.ActivityMute
+	if err := db.First(&mute, "user_id = ? AND file_id = ?", currentUser.ID, file.ID).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed muting file")
+	}
+
+	return utils.Success(c, fiber.StatusOK, mute)
+}
+
+// Unmute lets activity about a file reach the current user's feed again.
+func (h *FilesHandler) Unmute(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+
+	result := h.DB.WithContext(c.UserContext()).Unscoped().
+		Where("user_id = ? AND file_id = ?", currentUser.ID, fileID).
+		Delete(&models.ActivityMute{})
+	if result.Error != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed unmuting file")
+	}
+	if result.RowsAffected == 0 {
+		return utils.Fail(c, errFileNotMuted)
+	}
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "file unmuted"})
+}
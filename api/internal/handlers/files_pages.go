@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+var errPagesUnsupported = utils.NewError(fiber.StatusUnsupportedMediaType, "pages_unsupported", "this file cannot be shown as pages")
+
+// Pages returns how many pages a file has as page images. PDFs, Office
+// documents with a rendered preview and images (as a single page) can be
+// shown this way; it is the only way to see a file shared view-only.
+func (h *FilesHandler) Pages(c *fiber.Ctx) error {
+	file, source, apiErr := h.pageSource(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	doc, err := h.Renditions.TiledDocument(c.Context(), file, source)
+	if err != nil {
+		return utils.Fail(c, h.pagesError(file, err))
+	}
+	h.recordAccess(c, file, middleware.GetCurrentUser(c), models.FileAccessView)
+	return utils.Success(c, fiber.StatusOK, doc)
+}
+
+// Page renders one page and returns the grid of tiles it is cut into.
+func (h *FilesHandler) Page(c *fiber.Ctx) error {
+	file, source, apiErr := h.pageSource(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	page, err := c.ParamsInt("page")
+	if err != nil {
+		return utils.Fail(c, serviceError(services.ErrPageNotFound, nil))
+	}
+	layout, err := h.Renditions.TiledPage(c.Context(), file, source, page)
+	if err != nil {
+		return utils.Fail(c, h.pagesError(file, err))
+	}
+	return utils.Success(c, fiber.StatusOK, layout)
+}
+
+// Tile serves one PNG tile of a page, counted from the top left.
+func (h *FilesHandler) Tile(c *fiber.Ctx) error {
+	file, source, apiErr := h.pageSource(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	page, errPage := c.ParamsInt("page")
+	row, errRow := c.ParamsInt("row")
+	col, errCol := c.ParamsInt("col")
+	if errPage != nil || errRow != nil || errCol != nil {
+		return utils.Fail(c, serviceError(services.ErrTileNotFound, nil))
+	}
+	key, err := h.Renditions.Tile(c.Context(), file, source, page, row, col)
+	if err != nil {
+		return utils.Fail(c, h.pagesError(file, err))
+	}
+
+	obj, err := h.Storage.Download(c.Context(), key)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed downloading tile")
+	}
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return utils.Error(c, fiber.StatusInternalServerError, "failed reading object metadata")
+	}
+	c.Set(fiber.HeaderContentType, "image/png")
+	c.Set(fiber.HeaderCacheControl, "private, max-age=3600")
+	return c.SendStream(obj, int(stat.Size))
+}
+
+// pageSource loads the file named by :id, checks the caller may view it,
+// signed in or through a public link, and picks what its pages are
+// rendered from: the file itself for PDFs and images, the rendered preview
+// for Office documents. PDFs are stamped first when a share asks for a
+// watermark.
+func (h *FilesHandler) pageSource(c *fiber.Ctx) (*models.File, services.PageSource, *utils.APIError) {
+	currentUser := middleware.GetCurrentUser(c)
+	file, apiErr := h.loadFile(c)
+	if apiErr != nil {
+		return nil, services.PageSource{}, apiErr
+	}
+	if currentUser == nil {
+		// Anonymous visitors come in through the public routes, and only
+		// a public link lets them see the pages.
+		if !h.Access.InOrganization(c.Context(), file.ID, middleware.GetOrganizationID(c)) {
+			return nil, services.PageSource{}, errFileNotFound
+		}
+		shareType := h.Access.GetPublicShareType(c.Context(), file.ID)
+		if shareType == nil {
+			return nil, services.PageSource{}, errFileNotFound
+		}
+		if *shareType == models.ShareTypePublicLoggedIn {
+			return nil, services.PageSource{}, errUnauthorized
+		}
+	} else if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionView) {
+		return nil, services.PageSource{}, errAccessDenied
+	}
+	if file.IsDirectory {
+		return nil, services.PageSource{}, errPagesUnsupported
+	}
+	if file.VaultID != nil {
+		return nil, services.PageSource{}, errVaultContent
+	}
+	if apiErr := h.checkFilePassword(c, file, currentUser); apiErr != nil {
+		return nil, services.PageSource{}, apiErr
+	}
+	if apiErr := checkArchived(file); apiErr != nil {
+		return nil, services.PageSource{}, apiErr
+	}
+
+	var source services.PageSource
+	switch {
+	case file.MimeType == "application/pdf":
+		source.Key = file.StoragePath
+	case services.IsThumbnailableImage(file.MimeType):
+		source = services.PageSource{Key: file.StoragePath, Image: true}
+	case file.ThumbnailPath != nil && *file.ThumbnailPath != "" && !strings.HasPrefix(file.MimeType, "image/"):
+		source.Key = *file.ThumbnailPath
+	default:
+		return nil, services.PageSource{}, errPagesUnsupported
+	}
+	if h.Renditions == nil {
+		return nil, services.PageSource{}, serviceError(services.ErrRasterizerMissing, nil)
+	}
+	if source.Image {
+		return file, source, nil
+	}
+	key, apiErr := h.watermark(c, file, source.Key, "application/pdf", currentUser)
+	if apiErr != nil {
+		return nil, services.PageSource{}, apiErr
+	}
+	source.Key = key
+	return file, source, nil
+}
+
+func (h *FilesHandler) pagesError(file *models.File, err error) *utils.APIError {
+	if apiErr := serviceError(err, nil); apiErr != nil {
+		return apiErr
+	}
+	logger.Error("page_render_failed", err, map[string]interface{}{
+		"file_id": file.ID.String(),
+	})
+	return utils.NewError(fiber.StatusInternalServerError, "internal_error", "failed rendering pages")
+}
+
+// viewOnly reports whether user, nil for anonymous visitors, may only see
+// file as page images, which keeps the routes that send its bytes closed to
+// them.
+func (h *FilesHandler) viewOnly(c *fiber.Ctx, file *models.File, user *models.User) bool {
+	if user == nil {
+		return h.Access.ViewOnly(c.Context(), file.ID, nil)
+	}
+	return user.ID != file.OwnerID && h.Access.ViewOnly(c.Context(), file.ID, &user.ID)
+}
+
+// rasterThumbnail reports whether file's thumbnail is a small JPEG. Only
+// images get those; an Office document's thumbnail is its whole PDF
+// rendering, which is the document itself.
+func rasterThumbnail(file *models.File) bool {
+	return services.IsThumbnailableImage(file.MimeType)
+}
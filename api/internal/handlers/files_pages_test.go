@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/previewtoken"
+)
+
+func TestViewOnlyShares(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "vo-owner@test.com", "password123", models.UserRoleUser)
+	viewer, viewerToken := createTestUser(t, env.db, "vo-viewer@test.com", "password123", models.UserRoleUser)
+
+	thumb := "thumbs/plan.jpg"
+	file := models.File{Name: "plan.pdf", MimeType: "application/pdf", OwnerID: owner.ID, StoragePath: "plan.pdf", ThumbnailPath: &thumb, Size: 10}
+	notes := models.File{Name: "notes.md", MimeType: "text/markdown", OwnerID: owner.ID, StoragePath: "notes.md", Size: 10}
+	photoThumb, rendering := "thumbs/site.jpg", "previews/budget.pdf"
+	photo := models.File{Name: "site.png", MimeType: "image/png", OwnerID: owner.ID, StoragePath: "site.png", ThumbnailPath: &photoThumb, Size: 10}
+	budget := models.File{Name: "budget.docx", MimeType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document", OwnerID: owner.ID, StoragePath: "budget.docx", ThumbnailPath: &rendering, Size: 10}
+	for _, f := range []*models.File{&file, &notes, &photo, &budget} {
+		if err := env.db.Create(f).Error; err != nil {
+			t.Fatalf("failed creating file: %v", err)
+		}
+	}
+	expectCode := func(t *testing.T, resp *http.Response, status int, code string) {
+		t.Helper()
+		body := decodeJSONMap(t, resp)
+		if resp.StatusCode != status || body["code"] != code {
+			t.Fatalf("expected %d %s, got %d %v", status, code, resp.StatusCode, body)
+		}
+	}
+
+	t.Run("only view shares can be view-only", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+file.ID.String()+"/share", map[string]any{
+			"userID": viewer.ID, "permission": "download", "viewOnly": true,
+		}, authHeaders(ownerToken))
+		expectCode(t, resp, http.StatusBadRequest, "view_only_permission")
+	})
+
+	for _, f := range []models.File{file, notes, photo, budget} {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+f.ID.String()+"/share", map[string]any{
+			"userID": viewer.ID, "permission": "view", "viewOnly": true,
+		}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusCreated)
+		if data := decodeJSONMap(t, resp)["data"].(map[string]any); data["viewOnly"] != true {
+			t.Fatalf("expected a view-only share, got %v", data)
+		}
+	}
+
+	t.Run("the file's bytes stay closed", func(t *testing.T) {
+		base := "/api/files/" + file.ID.String()
+		expectCode(t, performRequest(t, env.app, http.MethodGet, base+"/preview", nil, authHeaders(viewerToken)), http.StatusForbidden, "view_only")
+		// A full preview token, say one handed out before the share was
+		// made view-only, no longer opens the file either.
+		issued := services.NewPreviewTokens(env.db, nil).Issue(context.Background(), file.ID, viewer.ID, previewtoken.ScopeFull)
+		expectCode(t, performRequest(t, env.app, http.MethodGet, base+"/proxy?token="+issued.Token, nil, nil), http.StatusForbidden, "view_only")
+		expectCode(t, performRequest(t, env.app, http.MethodGet, "/api/files/"+notes.ID.String()+"/content", nil, authHeaders(viewerToken)), http.StatusForbidden, "view_only")
+		expectCode(t, performRequest(t, env.app, http.MethodGet, base+"/download", nil, authHeaders(viewerToken)), http.StatusForbidden, "access_denied")
+	})
+
+	t.Run("an Office document's thumbnail is the whole rendering", func(t *testing.T) {
+		base := "/api/files/" + budget.ID.String()
+		expectCode(t, performRequest(t, env.app, http.MethodGet, base+"/preview?variant=thumb", nil, authHeaders(viewerToken)), http.StatusForbidden, "view_only")
+		issued := services.NewPreviewTokens(env.db, nil).Issue(context.Background(), budget.ID, viewer.ID, previewtoken.ScopeThumb)
+		expectCode(t, performRequest(t, env.app, http.MethodGet, base+"/proxy?variant=thumb&pages=1-2&token="+issued.Token, nil, nil), http.StatusForbidden, "view_only")
+	})
+
+	t.Run("thumbnails and pages stay open", func(t *testing.T) {
+		base := "/api/files/" + file.ID.String()
+		assertStatus(t, performRequest(t, env.app, http.MethodGet, "/api/files/"+photo.ID.String()+"/preview?variant=thumb", nil, authHeaders(viewerToken)), http.StatusOK)
+		// The test server has no rasterizer.
+		expectCode(t, performRequest(t, env.app, http.MethodGet, base+"/pages", nil, authHeaders(viewerToken)), http.StatusServiceUnavailable, "page_rendering_unavailable")
+		expectCode(t, performRequest(t, env.app, http.MethodGet, "/api/files/"+notes.ID.String()+"/pages", nil, authHeaders(viewerToken)), http.StatusUnsupportedMediaType, "pages_unsupported")
+	})
+
+	t.Run("public links can be view-only too", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+notes.ID.String()+"/share", map[string]any{
+			"shareType": "public_anyone", "permission": "view", "viewOnly": true,
+		}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusCreated)
+		expectCode(t, performRequest(t, env.app, http.MethodGet, "/api/public/files/"+notes.ID.String()+"/preview-html", nil, nil), http.StatusForbidden, "view_only")
+		expectCode(t, performRequest(t, env.app, http.MethodGet, "/api/public/files/"+notes.ID.String()+"/pages", nil, nil), http.StatusUnsupportedMediaType, "pages_unsupported")
+		expectCode(t, performRequest(t, env.app, http.MethodGet, "/api/public/files/"+file.ID.String()+"/pages", nil, nil), http.StatusNotFound, "file_not_found")
+	})
+
+	t.Run("the owner is not restricted", func(t *testing.T) {
+		assertStatus(t, performRequest(t, env.app, http.MethodGet, "/api/files/"+file.ID.String()+"/preview", nil, authHeaders(ownerToken)), http.StatusOK)
+	})
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	errInvalidPreviewWidth = utils.NewError(fiber.StatusBadRequest, "invalid_width", "width must be a positive number of pixels")
+	errInvalidPreviewPages = utils.NewError(fiber.StatusBadRequest, "invalid_pages", fmt.Sprintf("pages must be between 1 and %d", services.MaxRenditionPages))
+)
+
+// partialPreview swaps the object ProxyPreview is about to serve for a
+// reduced rendition when the request asks for one: width scales an image
+// down, pages cuts a PDF to its first pages. Parameters that do not apply
+// to the object are ignored. When the rendition cannot be made the object
+// itself is served, except while the converter is unavailable. It returns
+// the key to serve and, for renditions, their content type.
+func (h *FilesHandler) partialPreview(c *fiber.Ctx, file *models.File, storagePath string, servingThumbnail bool) (string, string, *utils.APIError) {
+	rawWidth, rawPages := c.Query("width"), c.Query("pages")
+	if h.Renditions == nil || (rawWidth == "" && rawPages == "") {
+		return storagePath, "", nil
+	}
+
+	switch {
+	case rawWidth != "" && !servingThumbnail && services.IsThumbnailableImage(file.MimeType):
+		width, err := strconv.Atoi(rawWidth)
+		if err != nil || width < 1 {
+			return "", "", errInvalidPreviewWidth
+		}
+		key, contentType, err := h.Renditions.Image(c.Context(), file, storagePath, width)
+		if err != nil {
+			logger.Error("preview_rendition_failed", err, map[string]interface{}{
+				"file_id": file.ID.String(),
+				"width":   width,
+			})
+			return storagePath, "", nil
+		}
+		return key, contentType, nil
+
+	case rawPages != "" && ((servingThumbnail && !strings.HasPrefix(file.MimeType, "image/")) || (!servingThumbnail && file.MimeType == "application/pdf")):
+		pages, err := strconv.Atoi(rawPages)
+		if err != nil || pages < 1 || pages > services.MaxRenditionPages {
+			return "", "", errInvalidPreviewPages
+		}
+		key, err := h.Renditions.Pages(c.Context(), file, storagePath, pages)
+		if errors.Is(err, services.ErrGotenbergUnavailable) {
+			return "", "", serviceError(err, nil)
+		}
+		if err != nil {
+			logger.Error("preview_rendition_failed", err, map[string]interface{}{
+				"file_id": file.ID.String(),
+				"pages":   pages,
+			})
+			return storagePath, "", nil
+		}
+		return key, "application/pdf", nil
+	}
+	return storagePath, "", nil
+}
+
+// byteRange reads a Range header against an object of size bytes and
+// returns the inclusive byte span to send. ranged is false when the whole
+// object should be sent, which covers headers that are missing, malformed,
+// in another unit or asking for several ranges. satisfiable is false when
+// the range starts past the end of the object.
+func byteRange(header string, size int64) (start, end int64, ranged, satisfiable bool) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !ok || strings.Contains(spec, ",") || size == 0 {
+		return 0, 0, false, true
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, false, true
+	}
+
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix < 0 {
+			return 0, 0, false, true
+		}
+		if suffix == 0 {
+			return 0, 0, true, false
+		}
+		return max(size-suffix, 0), size - 1, true, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, true
+	}
+	end = size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false, true
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return 0, 0, true, false
+	}
+	return start, end, true, true
+}
+
+// sendObject streams obj, honouring a single byte range in the request.
+// Stored objects seek with a new ranged request, so only the bytes asked
+// for are fetched.
+func sendObject(c *fiber.Ctx, obj io.ReadSeekCloser, size int64) error {
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	start, end, ranged, satisfiable := byteRange(c.Get(fiber.HeaderRange), size)
+	if !satisfiable {
+		obj.Close()
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+		return utils.Error(c, fiber.StatusRequestedRangeNotSatisfiable, "requested range not satisfiable")
+	}
+	if !ranged {
+		return c.SendStream(obj, int(size))
+	}
+	if _, err := obj.Seek(start, io.SeekStart); err != nil {
+		obj.Close()
+		return utils.Error(c, fiber.StatusInternalServerError, "failed reading file")
+	}
+	length := end - start + 1
+	c.Status(fiber.StatusPartialContent)
+	c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	return c.SendStream(struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(obj, length), obj}, int(length))
+}
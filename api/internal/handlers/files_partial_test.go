@@ -0,0 +1,33 @@
+package handlers
+
+import "testing"
+
+func TestByteRange(t *testing.T) {
+	tests := []struct {
+		header      string
+		start, end  int64
+		ranged      bool
+		satisfiable bool
+	}{
+		{"", 0, 0, false, true},
+		{"bytes=0-99", 0, 99, true, true},
+		{"bytes=100-", 100, 999, true, true},
+		{"bytes=900-5000", 900, 999, true, true},
+		{"bytes=-200", 800, 999, true, true},
+		{"bytes=-5000", 0, 999, true, true},
+		{"bytes=1000-", 0, 0, true, false},
+		{"bytes=-0", 0, 0, true, false},
+		{"bytes=0-1,5-9", 0, 0, false, true},
+		{"bytes=9-1", 0, 0, false, true},
+		{"items=0-1", 0, 0, false, true},
+		{"bytes=x-1", 0, 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			start, end, ranged, satisfiable := byteRange(tt.header, 1000)
+			if start != tt.start || end != tt.end || ranged != tt.ranged || satisfiable != tt.satisfiable {
+				t.Fatalf("byteRange(%q) = %d, %d, %v, %v", tt.header, start, end, ranged, satisfiable)
+			}
+		})
+	}
+}
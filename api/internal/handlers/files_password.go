@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// fileGrantHeader carries the grant from POST /files/:id/password/unlock. Links
+// that cannot set headers pass it as ?grant= instead.
+const fileGrantHeader = "X-File-Grant"
+
+type filePasswordRequest struct {
+	Password string `json:"password"`
+}
+
+// SetPassword protects a file with a password of its own. Only the owner
+// may set or remove it.
+func (h *FilesHandler) SetPassword(c *fiber.Ctx) error {
+	return h.changePassword(c, true)
+}
+
+// RemovePassword lifts a file's password protection.
+func (h *FilesHandler) RemovePassword(c *fiber.Ctx) error {
+	return h.changePassword(c, false)
+}
+
+func (h *FilesHandler) changePassword(c *fiber.Ctx, set bool) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	file, apiErr := h.loadFile(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if file.OwnerID != currentUser.ID {
+		return utils.Fail(c, errInsufficientPermissions)
+	}
+	if file.IsDirectory {
+		return utils.Error(c, fiber.StatusBadRequest, "folders cannot be password protected")
+	}
+
+	password := ""
+	action := "file.password_remove"
+	if set {
+		var req filePasswordRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.Fail(c, errInvalidBody)
+		}
+		if req.Password == "" {
+			return utils.Fail(c, serviceError(services.ErrFilePasswordInvalid, nil))
+		}
+		password = req.Password
+		action = "file.password_set"
+	}
+	if err := h.Passwords.Set(c.Context(), file, password); err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "internal_error", "failed updating file password")))
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       action,
+		ResourceType: "file",
+		ResourceID:   &file.ID,
+		Details:      map[string]interface{}{"file_name": file.Name},
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+	return utils.Success(c, fiber.StatusOK, file)
+}
+
+// UnlockPassword exchanges a file's password for a grant that opens its content
+// for a few minutes. It serves both users with access to the file and
+// visitors of a public share, who get a grant not tied to any account.
+// Wrong passwords are audited so owners can spot guessing.
+func (h *FilesHandler) UnlockPassword(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+	if !h.Access.InOrganization(c.Context(), fileID, middleware.GetOrganizationID(c)) {
+		return utils.Fail(c, errFileNotFound)
+	}
+	allowed := currentUser != nil && h.Access.HasAccess(c.Context(), currentUser.ID, fileID, models.SharePermissionView)
+	if !allowed && !h.Access.HasPublicAccess(c.Context(), fileID, models.SharePermissionView, currentUser != nil) {
+		return utils.Fail(c, errFileNotFound)
+	}
+
+	var req filePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	file, apiErr := h.loadFile(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	var holderID *uuid.UUID
+	entry := services.AuditEntry{
+		Action:       "file.password_unlock",
+		ResourceType: "file",
+		ResourceID:   &file.ID,
+		Details:      map[string]interface{}{"file_name": file.Name},
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	}
+	if currentUser != nil {
+		holderID = &currentUser.ID
+		entry.UserID = &currentUser.ID
+	} else {
+		entry.Details["user_agent"] = c.Get(fiber.HeaderUserAgent)
+	}
+
+	grant, err := h.Passwords.Unlock(file, holderID, req.Password)
+	if err != nil {
+		if errors.Is(err, services.ErrFilePasswordIncorrect) {
+			entry.Action = "file.password_unlock_failed"
+			h.Audit.LogAsync(entry)
+		}
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "internal_error", "failed unlocking file")))
+	}
+	h.Audit.LogAsync(entry)
+	return utils.Success(c, fiber.StatusOK, grant)
+}
+
+// checkFilePassword returns file_password_required unless file has no
+// password, user owns it, or the request carries a grant for it.
+func (h *FilesHandler) checkFilePassword(c *fiber.Ctx, file *models.File, user *models.User) *utils.APIError {
+	grant := c.Get(fileGrantHeader)
+	if grant == "" {
+		grant = c.Query("grant")
+	}
+	if err := h.Passwords.Check(file, user, grant); err != nil {
+		return serviceError(err, nil)
+	}
+	return nil
+}
+
+// loadFile loads the file named by :id.
+func (h *FilesHandler) loadFile(c *fiber.Ctx) (*models.File, *utils.APIError) {
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return nil, errInvalidFileID
+	}
+	var file models.File
+	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errFileNotFound
+		}
+		return nil, errLoadingFile
+	}
+	return &file, nil
+}
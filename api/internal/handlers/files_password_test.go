@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestFilePassword(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "password-owner@test.com", "password123", models.UserRoleUser)
+	viewer, viewerToken := createTestUser(t, env.db, "password-viewer@test.com", "password123", models.UserRoleUser)
+	other, otherToken := createTestUser(t, env.db, "password-other@test.com", "password123", models.UserRoleUser)
+
+	file := models.File{Name: "payroll.pdf", MimeType: "application/pdf", OwnerID: owner.ID, StoragePath: "payroll.pdf", Size: 10}
+	if err := env.db.Create(&file).Error; err != nil {
+		t.Fatalf("failed creating file: %v", err)
+	}
+	share := models.Share{FileID: file.ID, SharedByID: owner.ID, SharedWithUserID: &viewer.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionDownload}
+	if err := env.db.Create(&share).Error; err != nil {
+		t.Fatalf("failed creating share: %v", err)
+	}
+	base := "/api/files/" + file.ID.String()
+
+	expectCode := func(t *testing.T, resp *http.Response, status int, code string) {
+		t.Helper()
+		body := decodeJSONMap(t, resp)
+		if resp.StatusCode != status || body["code"] != code {
+			t.Fatalf("expected %d %s, got %d %v", status, code, resp.StatusCode, body)
+		}
+	}
+
+	t.Run("only the owner sets it", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, base+"/password", map[string]any{"password": "hunter22"}, authHeaders(viewerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+		resp = performJSONRequest(t, env.app, http.MethodPut, base+"/password", map[string]any{"password": "abc"}, authHeaders(ownerToken))
+		expectCode(t, resp, http.StatusBadRequest, "invalid_file_password")
+
+		resp = performJSONRequest(t, env.app, http.MethodPut, base+"/password", map[string]any{"password": "hunter22"}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		if data := decodeJSONMap(t, resp)["data"].(map[string]any); data["passwordProtected"] != true {
+			t.Fatalf("expected passwordProtected, got %v", data)
+		}
+	})
+
+	t.Run("owner is not asked", func(t *testing.T) {
+		assertStatus(t, performRequest(t, env.app, http.MethodGet, base+"/download-url", nil, authHeaders(ownerToken)), http.StatusOK)
+	})
+
+	t.Run("shares need the password", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, base+"/download-url", nil, authHeaders(viewerToken))
+		expectCode(t, resp, http.StatusForbidden, "file_password_required")
+		resp = performRequest(t, env.app, http.MethodGet, base+"/preview", nil, authHeaders(viewerToken))
+		expectCode(t, resp, http.StatusForbidden, "file_password_required")
+	})
+
+	t.Run("wrong password is audited", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, base+"/password/unlock", map[string]any{"password": "nope"}, authHeaders(viewerToken))
+		expectCode(t, resp, http.StatusForbidden, "file_password_incorrect")
+
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			var count int64
+			env.db.Model(&models.AuditLog{}).Where("action = ? AND user_id = ?", "file.password_unlock_failed", viewer.ID).Count(&count)
+			if count == 1 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected one file.password_unlock_failed entry, got %d", count)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	})
+
+	t.Run("grant opens the file for its holder", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, base+"/password/unlock", map[string]any{"password": "hunter22"}, authHeaders(viewerToken))
+		assertStatus(t, resp, http.StatusOK)
+		grant := decodeJSONMap(t, resp)["data"].(map[string]any)["grant"].(string)
+		// Audited apart from releasing an edit lock, which the timeline
+		// shows as file.unlock.
+		for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+			var unlocks, lockReleases int64
+			env.db.Model(&models.AuditLog{}).Where("action = ? AND user_id = ?", "file.password_unlock", viewer.ID).Count(&unlocks)
+			env.db.Model(&models.AuditLog{}).Where("action = ?", "file.unlock").Count(&lockReleases)
+			if unlocks == 1 && lockReleases == 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected one file.password_unlock entry and no file.unlock, got %d and %d", unlocks, lockReleases)
+			}
+		}
+
+		headers := authHeaders(viewerToken)
+		headers[fileGrantHeader] = grant
+		assertStatus(t, performRequest(t, env.app, http.MethodGet, base+"/download-url", nil, headers), http.StatusOK)
+		assertStatus(t, performRequest(t, env.app, http.MethodGet, base+"/preview?grant="+grant, nil, authHeaders(viewerToken)), http.StatusOK)
+
+		// Someone else can't use it, even with their own access.
+		env.db.Create(&models.Share{FileID: file.ID, SharedByID: owner.ID, SharedWithUserID: &other.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionDownload})
+		otherHeaders := authHeaders(otherToken)
+		otherHeaders[fileGrantHeader] = grant
+		expectCode(t, performRequest(t, env.app, http.MethodGet, base+"/download-url", nil, otherHeaders), http.StatusForbidden, "file_password_required")
+	})
+
+	t.Run("strangers cannot unlock", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/public/files/"+file.ID.String()+"/password/unlock", map[string]any{"password": "hunter22"}, nil)
+		assertStatus(t, resp, http.StatusNotFound)
+	})
+
+	t.Run("removing it lifts the check", func(t *testing.T) {
+		assertStatus(t, performRequest(t, env.app, http.MethodDelete, base+"/password", nil, authHeaders(ownerToken)), http.StatusOK)
+		assertStatus(t, performRequest(t, env.app, http.MethodGet, base+"/download-url", nil, authHeaders(viewerToken)), http.StatusOK)
+	})
+}
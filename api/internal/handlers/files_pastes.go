@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var errPasteNeedsApproval = utils.NewError(fiber.StatusConflict, "paste_needs_approval", "public links in this folder need approval; paste with public set to false and share it with quick share")
+
+type pasteRequest struct {
+	Content  string `json:"content"`
+	Name     string `json:"name"`
+	Language string `json:"language"`
+	ParentID string `json:"parentID"`
+	// Public, true unless set, also makes a quick-share link to the paste.
+	Public     *bool                  `json:"public"`
+	Permission models.SharePermission `json:"permission"`
+	ExpiresIn  string                 `json:"expiresIn"`
+}
+
+type pasteResponse struct {
+	Paste     models.Paste  `json:"paste"`
+	Share     *models.Share `json:"share,omitempty"`
+	URL       string        `json:"url,omitempty"`
+	ExpiresAt *time.Time    `json:"expiresAt,omitempty"`
+}
+
+// CreatePaste stores pasted text as a file, in the user's Pastes folder
+// unless parentID names another, and by default makes a quick-share link to
+// it. The language, or the name's extension, picks the highlighting of the
+// text preview. Pastes count against storage quotas like uploads and are
+// limited per user and hour.
+func (h *FilesHandler) CreatePaste(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	var req pasteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	public := req.Public == nil || *req.Public
+
+	now := time.Now().UTC()
+	content := []byte(req.Content)
+	if err := h.Pastes.Allow(c.Context(), currentUser.ID, now); err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "paste_failed", "failed checking paste limit")))
+	}
+	if err := h.Pastes.Check(content); err != nil {
+		return utils.Fail(c, serviceError(err, nil).WithMessage(err.Error()))
+	}
+	if maxUpload := h.maxUploadBytes(c.Context()); maxUpload > 0 && int64(len(content)) > maxUpload {
+		return utils.Fail(c, errUploadTooLarge.WithMessage(fmt.Sprintf("file exceeds maximum upload size of %d bytes", maxUpload)))
+	}
+	name, language, err := services.PasteName(req.Name, req.Language, now)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, nil).WithMessage(err.Error()))
+	}
+	contentType := resolveMimeType(name, "")
+	if contentType == "application/octet-stream" {
+		contentType = "text/plain"
+	}
+	detectedType := services.DetectContentType(content)
+	if err := h.UploadPolicy.Check(name, contentType, detectedType); err != nil {
+		return h.rejectUpload(c, currentUser.ID, name, err)
+	}
+	if apiErr := h.checkQuota(c, currentUser.OrganizationID, int64(len(content))); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if public && !h.Access.PublicSharingEnabled(c.Context()) {
+		return utils.Fail(c, errPublicSharingOff)
+	}
+
+	// Pastes are stored as plaintext, so unlike uploads they may not go
+	// into a vault.
+	parent, apiErr := loadTargetFolder(c, h.DB, h.Access, currentUser, &req.ParentID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	var parentID *uuid.UUID
+	if parent != nil {
+		parentID = &parent.ID
+	} else {
+		folder, err := h.Pastes.Folder(c.Context(), currentUser, services.AuditEntry{
+			UserID:    &currentUser.ID,
+			IPAddress: c.IP(),
+			RequestID: getRequestID(c),
+		})
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed creating pastes folder")
+		}
+		parentID = &folder.ID
+	}
+	if public {
+		control, err := services.EffectiveShareControl(c.Context(), h.DB, *parentID)
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed loading share control")
+		}
+		if services.ShareNeedsApproval(control, &models.Share{ShareType: models.ShareTypePublicAnyone}) {
+			return utils.Fail(c, errPasteNeedsApproval)
+		}
+	}
+
+	checksum := contentChecksum(content)
+	entry := models.File{
+		Name:             name,
+		MimeType:         contentType,
+		DetectedMimeType: detectedType,
+		Size:             int64(len(content)),
+		ParentID:         parentID,
+		OwnerID:          currentUser.ID,
+		OrganizationID:   currentUser.OrganizationID,
+		StoragePath:      fmt.Sprintf("%s/%s/%s", currentUser.ID.String(), uuid.New().String(), name),
+		Checksum:         &checksum,
+	}
+	classification, apiErr := h.classifyUpload(c, currentUser, &entry)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if apiErr := h.checkGroupQuota(c, currentUser.ID, entry.ParentID, entry.Size); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if err := h.Pastes.Put(c.Context(), entry.StoragePath, content, contentType); err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed storing paste")
+	}
+
+	resp := pasteResponse{Paste: models.Paste{OwnerID: currentUser.ID, Language: language}}
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		resp.Paste.FileID = entry.ID
+		if err := tx.Create(&resp.Paste).Error; err != nil {
+			return err
+		}
+		if err := services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "file.upload",
+			ResourceType: "file",
+			ResourceID:   &entry.ID,
+			Details: map[string]interface{}{
+				"file_name":          entry.Name,
+				"file_size":          entry.Size,
+				"mime_type":          contentType,
+				"detected_mime_type": detectedType,
+				"parent_id":          parentID.String(),
+				"paste":              true,
+			},
+			IPAddress: c.IP(),
+			RequestID: getRequestID(c),
+		}); err != nil {
+			return err
+		}
+		if err := h.recordClassification(c, tx, currentUser, &entry, classification); err != nil {
+			return err
+		}
+		if !public {
+			return nil
+		}
+
+		share, apiErr := buildQuickShare(c, tx, h.Access, currentUser.ID, &entry, quickShareRequest{Permission: req.Permission, ExpiresIn: req.ExpiresIn}, now)
+		if apiErr != nil {
+			return apiErr
+		}
+		if err := tx.Create(&share).Error; err != nil {
+			return err
+		}
+		resp.Share = &share
+		resp.URL = publicShareURL(h.FrontendURL, share)
+		resp.ExpiresAt = share.ExpiresAt
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "share.create",
+			ResourceType: "share",
+			ResourceID:   &entry.ID,
+			Details: map[string]interface{}{
+				"file_name":   entry.Name,
+				"permission":  string(share.Permission),
+				"share_type":  string(share.ShareType),
+				"share_id":    share.ID.String(),
+				"expires_at":  share.ExpiresAt.Format(time.RFC3339),
+				"quick_share": true,
+				"paste":       true,
+			},
+			IPAddress: c.IP(),
+			RequestID: getRequestID(c),
+		})
+	}); err != nil {
+		_ = h.Pastes.Store.Delete(c.Context(), entry.StoragePath)
+		var apiErr *utils.APIError
+		if errors.As(err, &apiErr) {
+			return utils.Fail(c, apiErr)
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed creating paste")
+	}
+	resp.Paste.File = &entry
+
+	logger.InfoWithUser(currentUser.ID.String(), "paste_created", map[string]interface{}{
+		"file_id":   entry.ID.String(),
+		"file_size": entry.Size,
+		"language":  language,
+		"public":    public,
+	})
+	return utils.Success(c, fiber.StatusCreated, resp)
+}
+
+// ListPastes lists the current user's pastes that still exist, newest
+// first.
+func (h *FilesHandler) ListPastes(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	query := h.DB.WithContext(c.UserContext()).Model(&models.Paste{}).
+		Joins("JOIN files ON files.id = pastes.file_id AND files.deleted_at IS NULL").
+		Where("pastes.owner_id = ?", currentUser.ID)
+
+	p := utils.ParsePagination(c)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting pastes")
+	}
+	var pastes []models.Paste
+	if err := utils.ApplyPagination(query.Preload("File").Order("pastes.created_at DESC"), p).Find(&pastes).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing pastes")
+	}
+	return utils.Paginated(c, pastes, p.Page, p.Limit, total)
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// PreviewHTML returns a sanitized HTML rendering of a Markdown, source or
+// plain-text file. The fragment is safe to inject into the page as-is.
+func (h *FilesHandler) PreviewHTML(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+
+	var file models.File
+	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Fail(c, errFileNotFound)
+		}
+		return utils.Fail(c, errLoadingFile)
+	}
+
+	if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionView) {
+		return utils.Fail(c, errAccessDenied)
+	}
+	if h.viewOnly(c, &file, currentUser) {
+		return utils.Fail(c, errViewOnly)
+	}
+
+	return h.sendPreviewHTML(c, &file)
+}
+
+// PublicPreviewHTML is PreviewHTML for public share viewers. Access follows
+// PublicGet: a view share for signed-in users, otherwise a public share on
+// the file or one of its ancestors.
+func (h *FilesHandler) PublicPreviewHTML(c *fiber.Ctx) error {
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+	if !h.Access.InOrganization(c.Context(), fileID, middleware.GetOrganizationID(c)) {
+		return utils.Fail(c, errFileNotFound)
+	}
+
+	currentUser := middleware.GetCurrentUser(c)
+	allowed := currentUser != nil && h.Access.HasAccess(c.Context(), currentUser.ID, fileID, models.SharePermissionView)
+	if !allowed {
+		shareType := h.Access.GetPublicShareType(c.Context(), fileID)
+		if shareType == nil {
+			return utils.Fail(c, errFileNotFound)
+		}
+		if *shareType == models.ShareTypePublicLoggedIn && currentUser == nil {
+			return utils.Error(c, fiber.StatusUnauthorized, "login required to access this file")
+		}
+	}
+
+	var file models.File
+	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Fail(c, errFileNotFound)
+		}
+		return utils.Fail(c, errLoadingFile)
+	}
+	if h.viewOnly(c, &file, currentUser) {
+		return utils.Fail(c, errViewOnly)
+	}
+
+	h.recordAccess(c, &file, currentUser, models.FileAccessView)
+	return h.sendPreviewHTML(c, &file)
+}
+
+func (h *FilesHandler) sendPreviewHTML(c *fiber.Ctx, file *models.File) error {
+	if file.VaultID != nil {
+		return utils.Fail(c, errVaultContent)
+	}
+	if apiErr := h.checkFilePassword(c, file, middleware.GetCurrentUser(c)); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if apiErr := checkArchived(file); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if kind, _ := services.TextPreviewKind(file); kind == "" {
+		return utils.Fail(c, serviceError(services.ErrTextPreviewUnsupported, nil))
+	}
+	if utils.NotModified(c, fileETag(*file, "preview-html")) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	preview, err := h.TextPreview.Render(c.Context(), file)
+	if err != nil {
+		if errors.Is(err, services.ErrTextPreviewUnsupported) {
+			return utils.Fail(c, serviceError(err, nil))
+		}
+		logger.Error("text_preview_failed", err, map[string]interface{}{
+			"file_id": file.ID.String(),
+		})
+		return utils.Error(c, fiber.StatusInternalServerError, "failed rendering preview")
+	}
+	return utils.Success(c, fiber.StatusOK, preview)
+}
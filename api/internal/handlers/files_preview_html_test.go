@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+// The test env has no object storage, so these cover everything up to the
+// read; rendering itself is tested in services and pkg/textrender.
+func TestPreviewHTML(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "preview-html-owner@test.com", "password123", models.UserRoleUser)
+	_, outsiderToken := createTestUser(t, env.db, "preview-html-outsider@test.com", "password123", models.UserRoleUser)
+
+	newFile := func(name, mimeType string) models.File {
+		file := models.File{Name: name, MimeType: mimeType, Size: 10, OwnerID: owner.ID, StoragePath: name}
+		if err := env.db.Create(&file).Error; err != nil {
+			t.Fatalf("failed creating file: %v", err)
+		}
+		return file
+	}
+	readme := newFile("README.md", "text/markdown")
+	image := newFile("photo.png", "image/png")
+
+	t.Run("requires authentication", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/"+readme.ID.String()+"/preview-html", nil, nil)
+		assertStatus(t, resp, http.StatusUnauthorized)
+	})
+
+	t.Run("denies users without access", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/"+readme.ID.String()+"/preview-html", nil, authHeaders(outsiderToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("rejects files without a text preview", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/"+image.ID.String()+"/preview-html", nil, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusUnsupportedMediaType)
+		if body["code"] != "preview_not_supported" {
+			t.Fatalf("expected code preview_not_supported, got %v", body["code"])
+		}
+	})
+
+	t.Run("honours If-None-Match", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/"+readme.ID.String()+"/preview-html", nil, map[string]string{
+			"Authorization": "Bearer " + ownerToken,
+			"If-None-Match": "*",
+		})
+		assertStatus(t, resp, http.StatusNotModified)
+		if resp.Header.Get("ETag") == "" {
+			t.Fatal("expected an ETag")
+		}
+	})
+
+	t.Run("public endpoint hides unshared files", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/public/files/"+readme.ID.String()+"/preview-html", nil, nil)
+		assertStatus(t, resp, http.StatusNotFound)
+	})
+
+	t.Run("public endpoint serves publicly shared files", func(t *testing.T) {
+		share := models.Share{
+			FileID:     image.ID,
+			SharedByID: owner.ID,
+			ShareType:  models.ShareTypePublicAnyone,
+			Permission: models.SharePermissionView,
+		}
+		if err := env.db.Create(&share).Error; err != nil {
+			t.Fatalf("failed creating share: %v", err)
+		}
+
+		resp := performRequest(t, env.app, http.MethodGet, "/api/public/files/"+image.ID.String()+"/preview-html", nil, nil)
+		assertStatus(t, resp, http.StatusUnsupportedMediaType)
+	})
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetProperties returns a file's custom property values by key.
+func (h *FilesHandler) GetProperties(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	file, apiErr := h.loadFile(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionView) {
+		return utils.Fail(c, errAccessDenied)
+	}
+
+	values, err := h.Properties.ForFile(c.Context(), file.ID)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading properties")
+	}
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"properties": values})
+}
+
+// SetProperties replaces a file's custom property values. It needs edit
+// permission; properties left out of the body, or given as null, are
+// unset.
+func (h *FilesHandler) SetProperties(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	var req struct {
+		Properties map[string]interface{} `json:"properties"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	file, apiErr := h.loadFile(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionEdit) {
+		return utils.Fail(c, errAccessDenied)
+	}
+	if blocked, resp := h.rejectIfLocked(c, file.ID, currentUser.ID); blocked {
+		return resp
+	}
+
+	values, err := h.Properties.Set(c.Context(), file, req.Properties, services.AuditEntry{
+		UserID:    &currentUser.ID,
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrPropertyValueInvalid) {
+			return utils.Fail(c, serviceError(err, nil).WithMessage(err.Error()))
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed updating properties")
+	}
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"properties": values})
+}
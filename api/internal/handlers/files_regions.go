@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/internal/storage"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// directDownloadTTL is how long a direct download URL stays valid.
+const directDownloadTTL = 5 * time.Minute
+
+// readRegion returns the client to read key from. Only a file's own bytes
+// are replicated; derived objects such as watermarked copies are read from
+// the primary bucket.
+func (h *FilesHandler) readRegion(c *fiber.Ctx, file *models.File, key string) *storage.S3Client {
+	if h.Regions == nil || key != file.StoragePath {
+		return h.Storage
+	}
+	return h.Regions.Pick(preferredRegion(c), file.UpdatedAt).Client
+}
+
+// preferredRegion is the region a client asked to be served from, with
+// ?region= or the X-DocShare-Region header. Unknown or unhealthy regions
+// are ignored by the router.
+func preferredRegion(c *fiber.Ctx) string {
+	if region := strings.TrimSpace(c.Query("region")); region != "" {
+		return region
+	}
+	return strings.TrimSpace(c.Get("X-DocShare-Region"))
+}
+
+// directDownloadURL answers DownloadURL?direct=true with a presigned URL
+// against the nearest healthy region, so the bytes skip the API. Without
+// replicas, or for downloads that are watermarked or throttled and so must
+// pass through the API, the usual download path is returned instead.
+func (h *FilesHandler) directDownloadURL(c *fiber.Ctx, file *models.File, user *models.User) error {
+	if h.Regions == nil || !h.canDownloadDirect(c, file, user) {
+		return utils.Success(c, fiber.StatusOK, fiber.Map{
+			"url":    "/api/files/" + file.ID.String() + "/download",
+			"direct": false,
+		})
+	}
+
+	region := h.Regions.Pick(preferredRegion(c), file.UpdatedAt)
+	disposition := fmt.Sprintf("attachment; filename=%q", file.Name)
+	url, err := region.Client.PresignedGetURLWithResponse(c.Context(), file.StoragePath, directDownloadTTL, file.MimeType, disposition)
+	if err != nil {
+		logger.Error("s3_presign_get_failed", err, map[string]interface{}{
+			"file_id": file.ID.String(),
+			"region":  region.Name,
+		})
+		return utils.Error(c, fiber.StatusInternalServerError, "failed generating download URL")
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &user.ID,
+		Action:       "file.download",
+		ResourceType: "file",
+		ResourceID:   &file.ID,
+		Details: map[string]interface{}{
+			"file_name": file.Name,
+			"file_size": file.Size,
+			"direct":    true,
+			"region":    region.Name,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+	return utils.Success(c, fiber.StatusOK, fiber.Map{
+		"url":       url,
+		"direct":    true,
+		"region":    region.Name,
+		"expiresAt": time.Now().Add(directDownloadTTL),
+	})
+}
+
+// canDownloadDirect reports whether user's download of file may bypass the
+// API: it is not watermarked and no bandwidth cap applies.
+func (h *FilesHandler) canDownloadDirect(c *fiber.Ctx, file *models.File, user *models.User) bool {
+	if user.ID == file.OwnerID {
+		return !h.Downloads.Limited(c.Context(), services.Download{UserID: &user.ID, IPAddress: c.IP()})
+	}
+	if file.MimeType == "application/pdf" && h.Access.WatermarkRequired(c.Context(), file.ID, &user.ID) {
+		return false
+	}
+	return !h.Downloads.Limited(c.Context(), services.Download{
+		UserID:    &user.ID,
+		IPAddress: c.IP(),
+		ShareID:   h.accessShareID(c, file.ID, user),
+	})
+}
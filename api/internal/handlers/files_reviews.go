@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type reviewRequest struct {
+	UserIDs  []uuid.UUID `json:"userIDs"`
+	GroupIDs []uuid.UUID `json:"groupIDs"`
+	Message  string      `json:"message"`
+}
+
+// RequestReview sends a file for review by users and groups. It needs edit
+// permission, and the file must not be in review already.
+func (h *FilesHandler) RequestReview(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	var req reviewRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	file, apiErr := h.loadFile(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionEdit) {
+		return utils.Fail(c, errAccessDenied)
+	}
+
+	review, err := h.Reviews.Request(c.Context(), file, req.UserIDs, req.GroupIDs, req.Message, services.AuditEntry{
+		UserID:    &currentUser.ID,
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrReviewInvalid) {
+			return utils.Fail(c, serviceError(err, nil).WithMessage(err.Error()))
+		}
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "review_request_failed", "failed requesting review")))
+	}
+	return utils.Success(c, fiber.StatusCreated, review)
+}
+
+// ListReviews returns a file's reviews, newest first, to anyone who can
+// view it.
+func (h *FilesHandler) ListReviews(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	file, apiErr := h.loadFile(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionView) {
+		return utils.Fail(c, errAccessDenied)
+	}
+
+	var reviews []models.FileReview
+	if err := h.DB.WithContext(c.UserContext()).
+		Preload("Reviewers.User").Preload("Reviewers.Group").Preload("RequestedBy").
+		Where("file_id = ?", file.ID).Order("created_at DESC").
+		Find(&reviews).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing reviews")
+	}
+	return utils.Success(c, fiber.StatusOK, reviews)
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestFilesHandler_SearchFilters(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "search-owner@test.com", "password123", models.UserRoleUser)
+	other, otherToken := createTestUser(t, env.db, "search-other@test.com", "password123", models.UserRoleUser)
+
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	seed := []models.File{
+		{Name: "report-q1.pdf", MimeType: "application/pdf", Size: 2048, OwnerID: owner.ID, StoragePath: "a"},
+		{Name: "report-q2.docx", MimeType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document", Size: 4096, OwnerID: owner.ID, StoragePath: "b"},
+		{Name: "holiday.png", MimeType: "image/png", Size: 500000, OwnerID: owner.ID, StoragePath: "c"},
+		{Name: "clip.mp4", MimeType: "video/mp4", Size: 9000000, OwnerID: owner.ID, StoragePath: "d"},
+		{Name: "report-shared.pdf", MimeType: "application/pdf", Size: 1024, OwnerID: other.ID, StoragePath: "e"},
+	}
+	for i := range seed {
+		if err := env.db.Create(&seed[i]).Error; err != nil {
+			t.Fatalf("failed seeding file: %v", err)
+		}
+	}
+	if err := env.db.Model(&seed[2]).UpdateColumn("updated_at", old).Error; err != nil {
+		t.Fatalf("failed backdating file: %v", err)
+	}
+	if err := env.db.Create(&models.Share{
+		FileID:           seed[4].ID,
+		SharedByID:       other.ID,
+		SharedWithUserID: &owner.ID,
+		ShareType:        models.ShareTypePrivate,
+		Permission:       models.SharePermissionView,
+	}).Error; err != nil {
+		t.Fatalf("failed creating share: %v", err)
+	}
+
+	search := func(t *testing.T, token string, params url.Values) map[string]any {
+		t.Helper()
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/search?"+params.Encode(), nil, authHeaders(token))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		return body
+	}
+	names := func(body map[string]any) map[string]bool {
+		out := map[string]bool{}
+		for _, item := range body["data"].([]any) {
+			out[item.(map[string]any)["name"].(string)] = true
+		}
+		return out
+	}
+
+	t.Run("GET /api/files/search filters by category without query", func(t *testing.T) {
+		got := names(search(t, ownerToken, url.Values{"category": {"documents"}}))
+		if len(got) != 2 || !got["report-q1.pdf"] || !got["report-q2.docx"] {
+			t.Fatalf("expected the two owned documents, got %v", got)
+		}
+	})
+
+	t.Run("GET /api/files/search filters by mime family", func(t *testing.T) {
+		got := names(search(t, ownerToken, url.Values{"type": {"image/*,video/*"}}))
+		if len(got) != 2 || !got["holiday.png"] || !got["clip.mp4"] {
+			t.Fatalf("expected image and video, got %v", got)
+		}
+	})
+
+	t.Run("GET /api/files/search filters by size range", func(t *testing.T) {
+		got := names(search(t, ownerToken, url.Values{"q": {"report"}, "minSize": {"3000"}, "maxSize": {"5000"}}))
+		if len(got) != 1 || !got["report-q2.docx"] {
+			t.Fatalf("expected only report-q2.docx, got %v", got)
+		}
+	})
+
+	t.Run("GET /api/files/search filters by modified date", func(t *testing.T) {
+		before := time.Now().Add(-7 * 24 * time.Hour).Format("2006-01-02")
+		got := names(search(t, ownerToken, url.Values{"modifiedBefore": {before}}))
+		if len(got) != 1 || !got["holiday.png"] {
+			t.Fatalf("expected only the backdated file, got %v", got)
+		}
+	})
+
+	t.Run("GET /api/files/search shared scope", func(t *testing.T) {
+		got := names(search(t, ownerToken, url.Values{"q": {"report"}, "scope": {"shared"}}))
+		if len(got) != 1 || !got["report-shared.pdf"] {
+			t.Fatalf("expected only the shared report, got %v", got)
+		}
+	})
+
+	t.Run("GET /api/files/search all scope with owner filter", func(t *testing.T) {
+		got := names(search(t, ownerToken, url.Values{"q": {"report"}, "scope": {"all"}, "ownerID": {other.ID.String()}}))
+		if len(got) != 1 || !got["report-shared.pdf"] {
+			t.Fatalf("expected only the other user's report, got %v", got)
+		}
+	})
+
+	t.Run("GET /api/files/search shared scope hides unshared files", func(t *testing.T) {
+		got := names(search(t, otherToken, url.Values{"q": {"report"}, "scope": {"shared"}}))
+		if len(got) != 0 {
+			t.Fatalf("expected no shared results, got %v", got)
+		}
+	})
+
+	t.Run("GET /api/files/search filters by language", func(t *testing.T) {
+		env.db.Model(&seed[0]).UpdateColumn("language", "de")
+		env.db.Model(&seed[1]).UpdateColumn("language", "fr")
+		got := names(search(t, ownerToken, url.Values{"language": {"de,es"}}))
+		if len(got) != 1 || !got["report-q1.pdf"] {
+			t.Fatalf("expected only the German report, got %v", got)
+		}
+	})
+
+	t.Run("GET /api/files/search invalid filter", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/search?category=spreadsheets", nil, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusBadRequest)
+		assertEnvelopeError(t, body, "invalid category")
+	})
+
+	for _, sortKey := range []string{"name", "size", "modified"} {
+		t.Run("GET /api/files/search keyset pagination walks all results sorted by "+sortKey, func(t *testing.T) {
+			seen := map[string]bool{}
+			cursor := ""
+			for page := 0; page < 10; page++ {
+				body := search(t, ownerToken, url.Values{"scope": {"all"}, "minSize": {"0"}, "sort": {sortKey}, "limit": {"2"}, "cursor": {cursor}})
+				var lastSize float64 = -1
+				for _, item := range body["data"].([]any) {
+					f := item.(map[string]any)
+					if sortKey == "size" {
+						size := f["size"].(float64)
+						if size < lastSize {
+							t.Fatalf("expected ascending size order, got %v after %v", size, lastSize)
+						}
+						lastSize = size
+					}
+					name := f["name"].(string)
+					if seen[name] {
+						t.Fatalf("file %s returned twice", name)
+					}
+					seen[name] = true
+				}
+				pagination := body["pagination"].(map[string]any)
+				cursor, _ = pagination["nextCursor"].(string)
+				if cursor == "" {
+					break
+				}
+			}
+			if len(seen) != len(seed) {
+				t.Fatalf("expected %d files across pages, got %d", len(seed), len(seen))
+			}
+		})
+	}
+
+	t.Run("GET /api/files/search rejects malformed cursor", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/search?q=report&cursor=not-a-cursor", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+}
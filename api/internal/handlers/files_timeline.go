@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Timeline entry kinds. file.update splits into rename and move by what
+// changed; an update doing both is reported as updated.
+const (
+	timelineCreated       = "created"
+	timelineEdited        = "edited"
+	timelineRenamed       = "renamed"
+	timelineMoved         = "moved"
+	timelineUpdated       = "updated"
+	timelineDownloaded    = "downloaded"
+	timelineShared        = "shared"
+	timelineShareUpdated  = "share_updated"
+	timelineShareAccepted = "share_accepted"
+	timelineUnshared      = "unshared"
+	timelineLocked        = "locked"
+	timelineUnlocked      = "unlocked"
+	timelineDeleted       = "deleted"
+)
+
+var timelineKinds = map[string]string{
+	"file.upload":             timelineCreated,
+	"file.create":             timelineCreated,
+	"folder.create":           timelineCreated,
+	"file.edit":               timelineEdited,
+	"file.update":             timelineUpdated,
+	"file.download":           timelineDownloaded,
+	"file.public_download":    timelineDownloaded,
+	"file.export":             timelineDownloaded,
+	"share.create":            timelineShared,
+	"share.update":            timelineShareUpdated,
+	"share.invitation_accept": timelineShareAccepted,
+	"share.delete":            timelineUnshared,
+	"file.lock":               timelineLocked,
+	"file.unlock":             timelineUnlocked,
+	"file.delete":             timelineDeleted,
+}
+
+// timelineDownloadActions are only shown to the owner unless the caller
+// did the downloading themselves.
+var timelineDownloadActions = []string{"file.download", "file.public_download", "file.export"}
+
+// timelineDetailKeys are the audit details safe to show anyone who can see
+// the file; addresses, invited emails and request bookkeeping stay in the
+// audit log.
+var timelineDetailKeys = map[string]bool{
+	"file_name":            true,
+	"folder_name":          true,
+	"file_size":            true,
+	"mime_type":            true,
+	"mode":                 true,
+	"format":               true,
+	"changes":              true,
+	"share_id":             true,
+	"share_type":           true,
+	"permission":           true,
+	"shared_with_user_id":  true,
+	"shared_with_group_id": true,
+	"group_name":           true,
+	"new_permission":       true,
+	"new_expires_at":       true,
+	"expiry_cleared":       true,
+	"expires_at":           true,
+	"quick_share":          true,
+}
+
+type timelineActor struct {
+	ID        uuid.UUID `json:"id"`
+	FirstName string    `json:"firstName"`
+	LastName  string    `json:"lastName"`
+	AvatarURL *string   `json:"avatarURL,omitempty"`
+}
+
+type timelineEntry struct {
+	ID        uuid.UUID              `json:"id"`
+	Kind      string                 `json:"kind"`
+	Action    string                 `json:"action"`
+	Actor     *timelineActor         `json:"actor,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	CreatedAt time.Time              `json:"createdAt"`
+}
+
+// Timeline lists what happened to one file, newest first by default:
+// creation, edits, renames and moves, shares and downloads. Anyone who can
+// view the file sees it, but only the owner sees other people's downloads.
+func (h *FilesHandler) Timeline(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+	var file models.File
+	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utils.Fail(c, errFileNotFound)
+		}
+		return utils.Fail(c, errLoadingFile)
+	}
+	isOwner := file.OwnerID == currentUser.ID
+	if !isOwner && !h.Access.HasAccess(c.Context(), currentUser.ID, file.ID, models.SharePermissionView) {
+		return utils.Fail(c, errAccessDenied)
+	}
+
+	actions := make([]string, 0, len(timelineKinds))
+	for action := range timelineKinds {
+		actions = append(actions, action)
+	}
+	query := h.DB.Model(&models.AuditLog{}).
+		Where("resource_id = ? AND resource_type IN ?", file.ID, []string{"file", "share"}).
+		Where("action IN ?", actions)
+	if !isOwner {
+		query = query.Where("action NOT IN ? OR user_id = ?", timelineDownloadActions, currentUser.ID)
+	}
+	query = query.Session(&gorm.Session{})
+
+	p := utils.ParsePagination(c)
+	order := utils.ParseTimeOrder(c)
+
+	if utils.WantsCursor(c) {
+		logs, nextCursor, err := findCreatedAtKeyset(c, query, order, p.Limit,
+			func(l models.AuditLog) (time.Time, uuid.UUID) { return l.CreatedAt, l.ID },
+		)
+		if err == utils.ErrInvalidCursor {
+			return utils.Fail(c, errInvalidCursor)
+		}
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed loading timeline")
+		}
+		entries, err := h.timelineEntries(logs)
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed loading timeline")
+		}
+		return utils.CursorPaginated(c, entries, p.Limit, nextCursor)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting timeline")
+	}
+	var logs []models.AuditLog
+	if err := utils.ApplyPagination(query.Order("created_at "+order).Order("id "+order), p).Find(&logs).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading timeline")
+	}
+	entries, err := h.timelineEntries(logs)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading timeline")
+	}
+	return utils.Paginated(c, entries, p.Page, p.Limit, total)
+}
+
+func (h *FilesHandler) timelineEntries(logs []models.AuditLog) ([]timelineEntry, error) {
+	var userIDs []uuid.UUID
+	for _, l := range logs {
+		if l.UserID != nil {
+			userIDs = append(userIDs, *l.UserID)
+		}
+	}
+	actors := map[uuid.UUID]*timelineActor{}
+	if len(userIDs) > 0 {
+		var users []models.User
+		if err := h.DB.Select("id", "first_name", "last_name", "avatar_url").
+			Where("id IN ?", uniqueUUIDs(userIDs)).Find(&users).Error; err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			actors[u.ID] = &timelineActor{ID: u.ID, FirstName: u.FirstName, LastName: u.LastName, AvatarURL: u.AvatarURL}
+		}
+	}
+
+	entries := make([]timelineEntry, len(logs))
+	for i, l := range logs {
+		entry := timelineEntry{
+			ID:        l.ID,
+			Kind:      timelineKind(l),
+			Action:    l.Action,
+			CreatedAt: l.CreatedAt,
+		}
+		if l.UserID != nil {
+			entry.Actor = actors[*l.UserID]
+		}
+		for key, value := range l.Details {
+			if timelineDetailKeys[key] {
+				if entry.Details == nil {
+					entry.Details = map[string]interface{}{}
+				}
+				entry.Details[key] = value
+			}
+		}
+		entries[i] = entry
+	}
+	return entries, nil
+}
+
+func timelineKind(l models.AuditLog) string {
+	if l.Action != "file.update" {
+		return timelineKinds[l.Action]
+	}
+	changes, _ := l.Details["changes"].(map[string]interface{})
+	_, renamed := changes["name"]
+	_, moved := changes["parent_id"]
+	switch {
+	case renamed && !moved:
+		return timelineRenamed
+	case moved && !renamed:
+		return timelineMoved
+	default:
+		return timelineUpdated
+	}
+}
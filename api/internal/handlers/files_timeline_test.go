@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestFileTimeline(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "timeline-owner@test.com", "password123", models.UserRoleUser)
+	viewer, viewerToken := createTestUser(t, env.db, "timeline-viewer@test.com", "password123", models.UserRoleUser)
+	other, _ := createTestUser(t, env.db, "timeline-other@test.com", "password123", models.UserRoleUser)
+	_, strangerToken := createTestUser(t, env.db, "timeline-stranger@test.com", "password123", models.UserRoleUser)
+
+	file := models.File{Name: "plan.docx", MimeType: "application/msword", OwnerID: owner.ID, StoragePath: "plan.docx"}
+	env.db.Create(&file)
+	env.db.Create(&models.Share{FileID: file.ID, SharedByID: owner.ID, SharedWithUserID: &viewer.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView})
+
+	start := time.Now().Add(-time.Hour).UTC()
+	step := 0
+	record := func(userID *uuid.UUID, action, resourceType string, details map[string]interface{}) {
+		step++
+		log := models.AuditLog{UserID: userID, Action: action, ResourceType: resourceType, ResourceID: &file.ID, Details: details, IPAddress: "10.0.0.1", CreatedAt: start.Add(time.Duration(step) * time.Minute)}
+		if err := env.db.Create(&log).Error; err != nil {
+			t.Fatalf("failed creating audit log: %v", err)
+		}
+	}
+	record(&owner.ID, "file.upload", "file", map[string]interface{}{"file_name": "draft.docx", "idempotency_key": "k1"})
+	record(&owner.ID, "file.update", "file", map[string]interface{}{"file_name": "plan.docx", "changes": map[string]interface{}{"name": "plan.docx"}})
+	record(&owner.ID, "share.create", "share", map[string]interface{}{"file_name": "plan.docx", "invited_email": "someone@example.com"})
+	record(&viewer.ID, "file.download", "file", map[string]interface{}{"file_name": "plan.docx"})
+	record(&other.ID, "file.download", "file", map[string]interface{}{"file_name": "plan.docx"})
+	record(nil, "file.download", "file", map[string]interface{}{"file_name": "plan.docx"})
+	record(&owner.ID, "preview.ready", "file", nil)
+
+	path := "/api/files/" + file.ID.String() + "/timeline"
+	kinds := func(data []any) []string {
+		out := make([]string, len(data))
+		for i, e := range data {
+			out[i] = e.(map[string]any)["kind"].(string)
+		}
+		return out
+	}
+
+	t.Run("owner sees every download", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodGet, path+"?order=asc", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		data := decodeJSONMap(t, resp)["data"].([]any)
+		got := kinds(data)
+		want := []string{"created", "renamed", "shared", "downloaded", "downloaded", "downloaded"}
+		if len(got) != len(want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("expected %v, got %v", want, got)
+			}
+		}
+
+		first := data[0].(map[string]any)
+		if actor := first["actor"].(map[string]any); actor["id"] != owner.ID.String() {
+			t.Fatalf("expected the owner as actor, got %v", actor)
+		}
+		if _, leaked := first["details"].(map[string]any)["idempotency_key"]; leaked {
+			t.Fatalf("expected bookkeeping details dropped, got %v", first["details"])
+		}
+		if _, leaked := data[2].(map[string]any)["details"].(map[string]any)["invited_email"]; leaked {
+			t.Fatalf("expected invited emails dropped, got %v", data[2])
+		}
+	})
+
+	t.Run("viewers only see their own downloads", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodGet, path, nil, authHeaders(viewerToken))
+		assertStatus(t, resp, http.StatusOK)
+		data := decodeJSONMap(t, resp)["data"].([]any)
+		if len(data) != 4 {
+			t.Fatalf("expected four entries, got %v", kinds(data))
+		}
+		newest := data[0].(map[string]any)
+		if newest["kind"] != "downloaded" || newest["actor"].(map[string]any)["id"] != viewer.ID.String() {
+			t.Fatalf("expected the viewer's own download first, got %v", newest)
+		}
+	})
+
+	t.Run("cursor pages", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodGet, path+"?cursor=&limit=4", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		body := decodeJSONMap(t, resp)
+		if len(body["data"].([]any)) != 4 {
+			t.Fatalf("expected a page of four, got %v", body["data"])
+		}
+		next, _ := body["pagination"].(map[string]any)["nextCursor"].(string)
+		resp = performJSONRequest(t, env.app, http.MethodGet, path+"?limit=4&cursor="+next, nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		if data := decodeJSONMap(t, resp)["data"].([]any); len(data) != 2 {
+			t.Fatalf("expected the remaining two, got %v", kinds(data))
+		}
+	})
+
+	t.Run("requires view access", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodGet, path, nil, authHeaders(strangerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+}
@@ -0,0 +1,453 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,checksum,termination,expiration"
+	// statusChecksumMismatch is the status the TUS checksum extension
+	// answers a body that does not match its Upload-Checksum with.
+	statusChecksumMismatch = 460
+	// fileIDHeader carries the ID of the file a finished upload became.
+	fileIDHeader = "X-File-ID"
+)
+
+// The stages UploadProgress reports an upload in. Uploads are not
+// malware-scanned, so unlike transfers they have no scanning stage.
+const (
+	uploadStageReceiving         = "receiving"
+	uploadStageChecksumming      = "checksumming"
+	uploadStagePreviewQueued     = "preview_queued"
+	uploadStageGeneratingPreview = "generating_preview"
+	uploadStageReady             = "ready"
+)
+
+var (
+	errTusVersion           = utils.NewError(fiber.StatusPreconditionFailed, "tus_version_unsupported", "Tus-Resumable must be "+tusVersion)
+	errTusUnavailable       = utils.NewError(fiber.StatusServiceUnavailable, "resumable_uploads_unavailable", "resumable uploads are not enabled")
+	errTusContentType       = utils.NewError(fiber.StatusUnsupportedMediaType, "invalid_content_type", "Content-Type must be application/offset+octet-stream")
+	errInvalidUploadLength  = utils.NewError(fiber.StatusBadRequest, "invalid_upload_length", "Upload-Length must be a non-negative integer; deferred lengths are not supported")
+	errInvalidUploadOffset  = utils.NewError(fiber.StatusBadRequest, "invalid_upload_offset", "Upload-Offset must be a non-negative integer")
+	errInvalidUploadMeta    = utils.NewError(fiber.StatusBadRequest, "invalid_upload_metadata", "Upload-Metadata must be comma-separated keys with base64 values")
+	errUploadAssemblyFailed = utils.NewError(fiber.StatusInternalServerError, "internal_error", "failed assembling upload")
+)
+
+// TusResumable checks the Tus-Resumable header every TUS request but
+// OPTIONS must carry, and sets it on the response.
+func TusResumable(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", tusVersion)
+	if c.Method() != fiber.MethodOptions && c.Get("Tus-Resumable") != tusVersion {
+		c.Set("Tus-Version", tusVersion)
+		return utils.Fail(c, errTusVersion)
+	}
+	return c.Next()
+}
+
+// TusOptions describes what the TUS endpoint supports.
+func (h *FilesHandler) TusOptions(c *fiber.Ctx) error {
+	c.Set("Tus-Version", tusVersion)
+	c.Set("Tus-Extension", tusExtensions)
+	c.Set("Tus-Checksum-Algorithm", strings.Join(services.UploadChecksumAlgorithms, ","))
+	if maxUpload := h.maxUploadBytes(c.Context()); maxUpload > 0 {
+		c.Set("Tus-Max-Size", strconv.FormatInt(maxUpload, 10))
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// TusCreate starts a resumable upload. The file name, its type and the
+// folder to upload into come from Upload-Metadata, and are checked the
+// way a multipart upload's are before any byte is accepted.
+func (h *FilesHandler) TusCreate(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	if h.Uploads == nil {
+		return utils.Fail(c, errTusUnavailable)
+	}
+
+	length, err := strconv.ParseInt(c.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return utils.Fail(c, errInvalidUploadLength)
+	}
+	meta, err := parseUploadMetadata(c.Get("Upload-Metadata"))
+	if err != nil {
+		return utils.Fail(c, errInvalidUploadMeta)
+	}
+	filename := filepath.Base(strings.TrimSpace(metaValue(meta, "filename", "name")))
+	if filename == "" || filename == "." || filename == string(filepath.Separator) {
+		return utils.Fail(c, utils.NewError(fiber.StatusBadRequest, "bad_request", "invalid filename"))
+	}
+	declared := metaValue(meta, "filetype", "type")
+
+	if maxUpload := h.maxUploadBytes(c.Context()); maxUpload > 0 && length > maxUpload {
+		return utils.Fail(c, errUploadTooLarge.WithMessage(fmt.Sprintf("file exceeds maximum upload size of %d bytes", maxUpload)))
+	}
+	if err := h.UploadPolicy.Check(filename, resolveMimeType(filename, declared), ""); err != nil {
+		return h.rejectUpload(c, currentUser.ID, filename, err)
+	}
+	if apiErr := h.checkQuota(c, currentUser.OrganizationID, length); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	parentID, apiErr := h.uploadParent(c, currentUser, strings.TrimSpace(meta["parentID"]))
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if apiErr := h.checkGroupQuota(c, currentUser.ID, parentID, length); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	upload := models.Upload{
+		OwnerID:        currentUser.ID,
+		OrganizationID: currentUser.OrganizationID,
+		ParentID:       parentID,
+		FileName:       filename,
+		MimeType:       declared,
+		Length:         length,
+	}
+	if err := h.Uploads.Create(c.Context(), &upload); err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed creating upload")
+	}
+	logger.InfoWithUser(currentUser.ID.String(), "upload_created", map[string]interface{}{
+		"upload_id": upload.ID.String(),
+		"file_name": filename,
+		"length":    length,
+		"parent_id": parentID,
+	})
+
+	location := strings.TrimSuffix(strings.SplitN(c.OriginalURL(), "?", 2)[0], "/") + "/" + upload.ID.String()
+	c.Set(fiber.HeaderLocation, location)
+	c.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	// An empty file is complete as soon as it is announced.
+	if length == 0 {
+		file, apiErr := h.finishUpload(c, currentUser, &upload)
+		if apiErr != nil {
+			return utils.Fail(c, apiErr)
+		}
+		c.Set(fileIDHeader, file.ID.String())
+	}
+	return c.SendStatus(fiber.StatusCreated)
+}
+
+// TusHead reports how many bytes of an upload have been received.
+func (h *FilesHandler) TusHead(c *fiber.Ctx) error {
+	currentUser, upload, apiErr := h.loadUpload(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	// Every byte arrived but the file was not made, say because storage
+	// failed while joining the chunks: try again rather than have the
+	// client think it is done.
+	if upload.Status == models.UploadStatusReceiving && upload.Offset == upload.Length {
+		if _, apiErr := h.finishUpload(c, currentUser, upload); apiErr != nil {
+			return utils.Fail(c, apiErr)
+		}
+	}
+	h.setUploadHeaders(c, upload)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// TusPatch appends the request body to an upload at Upload-Offset. The
+// request that brings the last byte also turns the upload into a file.
+func (h *FilesHandler) TusPatch(c *fiber.Ctx) error {
+	if c.Get(fiber.HeaderContentType) != "application/offset+octet-stream" {
+		return utils.Fail(c, errTusContentType)
+	}
+	offset, err := strconv.ParseInt(c.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return utils.Fail(c, errInvalidUploadOffset)
+	}
+	var checksum *services.UploadChecksum
+	if header := c.Get("Upload-Checksum"); header != "" {
+		if checksum, err = services.ParseUploadChecksum(header); err != nil {
+			return utils.Fail(c, serviceError(err, errInvalidBody))
+		}
+	}
+	currentUser, upload, apiErr := h.loadUpload(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	if _, err := h.Uploads.Append(c.Context(), upload, offset, requestBodyStream(c), checksum); err != nil {
+		if apiErr := serviceError(err, nil); apiErr != nil {
+			c.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+			return utils.Fail(c, apiErr)
+		}
+		logger.Error("upload_append_failed", err, map[string]interface{}{
+			"upload_id": upload.ID.String(),
+			"offset":    offset,
+		})
+		return utils.Error(c, fiber.StatusInternalServerError, "failed storing upload data")
+	}
+	if upload.Offset == upload.Length {
+		if _, apiErr := h.finishUpload(c, currentUser, upload); apiErr != nil {
+			return utils.Fail(c, apiErr)
+		}
+	}
+	h.setUploadHeaders(c, upload)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// TusDelete abandons an upload and throws away what it received. A file it
+// already became is kept.
+func (h *FilesHandler) TusDelete(c *fiber.Ctx) error {
+	_, upload, apiErr := h.loadUpload(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if err := h.Uploads.Discard(c.Context(), upload); err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed deleting upload")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// UploadProgress reports how far a resumable upload has got: the bytes
+// received, which blocks of the file they cover, and what the server is
+// doing with the file once the last byte is in. Unlike HEAD it never
+// finishes the upload, so a client can poll it while its last PATCH is
+// still being processed.
+func (h *FilesHandler) UploadProgress(c *fiber.Ctx) error {
+	_, upload, apiErr := h.loadUpload(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	blocks, err := h.Uploads.Blocks(c.Context(), upload)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading upload progress")
+	}
+
+	response := fiber.Map{
+		"id":            upload.ID,
+		"fileName":      upload.FileName,
+		"length":        upload.Length,
+		"receivedBytes": upload.Offset,
+		"blockSize":     blocks.BlockSize,
+		"bitmap":        blocks.Bitmap,
+		"chunks":        blocks.Chunks,
+		"fileID":        upload.FileID,
+	}
+	switch {
+	case upload.FileID != nil:
+		// Joining and checksumming are done by the time the file exists;
+		// what is left is its preview.
+		response["state"] = uploadStageReady
+		if h.PreviewQueue != nil {
+			job, err := h.PreviewQueue.GetJobByFileID(*upload.FileID)
+			if err != nil {
+				return utils.Error(c, fiber.StatusInternalServerError, "failed loading upload progress")
+			}
+			if job != nil {
+				switch job.Status {
+				case models.PreviewJobStatusPending:
+					response["state"] = uploadStagePreviewQueued
+				case models.PreviewJobStatusProcessing:
+					response["state"] = uploadStageGeneratingPreview
+				}
+				response["previewJob"] = h.jobToResponse(job, nil)
+			}
+		}
+	case upload.Offset == upload.Length:
+		// Every byte is in and the request that brought the last one is
+		// joining the chunks and computing the file's checksum.
+		response["state"] = uploadStageChecksumming
+		response["expiresAt"] = upload.ExpiresAt
+	default:
+		response["state"] = uploadStageReceiving
+		response["expiresAt"] = upload.ExpiresAt
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return utils.Success(c, fiber.StatusOK, response)
+}
+
+// loadUpload loads the caller's upload named by :id.
+func (h *FilesHandler) loadUpload(c *fiber.Ctx) (*models.User, *models.Upload, *utils.APIError) {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return nil, nil, errUnauthorized
+	}
+	if h.Uploads == nil {
+		return nil, nil, errTusUnavailable
+	}
+	notFound := serviceError(services.ErrUploadNotFound, nil)
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return nil, nil, notFound
+	}
+	upload, err := h.Uploads.Get(c.Context(), id, currentUser.ID)
+	if err != nil {
+		return nil, nil, serviceError(err, errLoadingFile.WithMessage("failed loading upload"))
+	}
+	return currentUser, upload, nil
+}
+
+func (h *FilesHandler) setUploadHeaders(c *fiber.Ctx, upload *models.Upload) {
+	c.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.FileID != nil {
+		c.Set(fileIDHeader, upload.FileID.String())
+	} else {
+		c.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// finishUpload joins a fully received upload into a file, applying the
+// upload policy to its content and the storage quota to its size. An
+// upload that fails either is thrown away.
+func (h *FilesHandler) finishUpload(c *fiber.Ctx, user *models.User, upload *models.Upload) (*models.File, *utils.APIError) {
+	ctx := c.Context()
+	objectName := fmt.Sprintf("%s/%s/%s", user.ID.String(), uuid.New().String(), upload.FileName)
+	assembled, err := h.Uploads.Assemble(ctx, upload, objectName)
+	if err != nil {
+		logger.Error("upload_assembly_failed", err, map[string]interface{}{
+			"upload_id": upload.ID.String(),
+		})
+		return nil, errUploadAssemblyFailed
+	}
+	reject := func(apiErr *utils.APIError) (*models.File, *utils.APIError) {
+		_ = h.Uploads.Store.Delete(ctx, objectName)
+		if err := h.Uploads.Discard(ctx, upload); err != nil {
+			logger.Error("upload_discard_failed", err, map[string]interface{}{
+				"upload_id": upload.ID.String(),
+			})
+		}
+		return nil, apiErr
+	}
+
+	contentType := resolveMimeType(upload.FileName, upload.MimeType)
+	if err := h.UploadPolicy.Check(upload.FileName, contentType, assembled.DetectedType); err != nil {
+		return reject(uploadRejection(user.ID, upload.FileName, err))
+	}
+	if apiErr := h.checkQuota(c, user.OrganizationID, assembled.Size); apiErr != nil {
+		return reject(apiErr)
+	}
+	// The folder may have gone, or the user lost edit access to it, while
+	// the bytes were on their way.
+	if upload.ParentID != nil {
+		if _, apiErr := h.uploadParent(c, user, upload.ParentID.String()); apiErr != nil {
+			return reject(apiErr)
+		}
+	}
+
+	entry := models.File{
+		Name:             upload.FileName,
+		MimeType:         contentType,
+		DeclaredMimeType: upload.MimeType,
+		DetectedMimeType: assembled.DetectedType,
+		Size:             assembled.Size,
+		ParentID:         upload.ParentID,
+		OwnerID:          user.ID,
+		OrganizationID:   user.OrganizationID,
+		StoragePath:      objectName,
+		Checksum:         &assembled.Checksum,
+	}
+	classification, apiErr := h.classifyUpload(c, user, &entry)
+	if apiErr != nil {
+		return reject(apiErr)
+	}
+	if apiErr := h.checkGroupQuota(c, user.ID, entry.ParentID, entry.Size); apiErr != nil {
+		return reject(apiErr)
+	}
+	auditDetails := map[string]interface{}{
+		"file_name":          entry.Name,
+		"file_size":          entry.Size,
+		"mime_type":          contentType,
+		"detected_mime_type": assembled.DetectedType,
+		"upload_mode":        "tus",
+		"upload_id":          upload.ID.String(),
+	}
+	if entry.ParentID != nil {
+		auditDetails["parent_id"] = entry.ParentID.String()
+	}
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		if err := services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &user.ID,
+			Action:       "file.upload",
+			ResourceType: "file",
+			ResourceID:   &entry.ID,
+			Details:      auditDetails,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		}); err != nil {
+			return err
+		}
+		if err := h.recordClassification(c, tx, user, &entry, classification); err != nil {
+			return err
+		}
+		return h.Uploads.Finish(tx, upload, entry.ID)
+	}); err != nil {
+		_ = h.Uploads.Store.Delete(ctx, objectName)
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, errUploadFinalized
+		}
+		return nil, utils.NewError(fiber.StatusInternalServerError, "internal_error", "failed creating file record")
+	}
+	if err := h.Uploads.Release(ctx, upload); err != nil {
+		// Purge picks the chunks up later.
+		logger.Error("upload_release_failed", err, map[string]interface{}{
+			"upload_id": upload.ID.String(),
+		})
+	}
+
+	logger.InfoWithUser(user.ID.String(), "file_uploaded", map[string]interface{}{
+		"file_id":      entry.ID.String(),
+		"file_name":    entry.Name,
+		"file_size":    entry.Size,
+		"mime_type":    contentType,
+		"storage_path": objectName,
+		"parent_id":    entry.ParentID,
+		"upload_mode":  "tus",
+	})
+	h.maybeEnqueueImageThumbnail(&entry, &user.ID)
+	return &entry, nil
+}
+
+// parseUploadMetadata decodes Upload-Metadata: comma-separated pairs of a
+// key and a base64 value, which may be left out.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	meta := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, err
+		}
+		meta[key] = string(value)
+	}
+	return meta, nil
+}
+
+// metaValue returns the first of keys set in meta. Clients differ on what
+// they call the file name and type.
+func metaValue(meta map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := meta[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
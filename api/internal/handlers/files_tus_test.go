@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestTusUploads(t *testing.T) {
+	env := setupTestEnv(t)
+	_, token := createTestUser(t, env.db, "tus-owner@test.com", "password123", models.UserRoleUser)
+	_, otherToken := createTestUser(t, env.db, "tus-other@test.com", "password123", models.UserRoleUser)
+
+	tusHeaders := func(token string, extra map[string]string) map[string]string {
+		headers := authHeaders(token)
+		headers["Tus-Resumable"] = "1.0.0"
+		for key, value := range extra {
+			headers[key] = value
+		}
+		return headers
+	}
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	create := func(t *testing.T, length string) string {
+		t.Helper()
+		resp := performRequest(t, env.app, http.MethodPost, "/api/tus/", nil, tusHeaders(token, map[string]string{
+			"Upload-Length":   length,
+			"Upload-Metadata": "filename " + b64("report.txt") + ",filetype " + b64("text/plain"),
+		}))
+		assertStatus(t, resp, http.StatusCreated)
+		location := resp.Header.Get("Location")
+		if !strings.HasPrefix(location, "/api/tus/") || resp.Header.Get("Upload-Expires") == "" {
+			t.Fatalf("unexpected creation headers: %v", resp.Header)
+		}
+		return location
+	}
+	patch := func(t *testing.T, location, offset, body string, extra map[string]string) *http.Response {
+		t.Helper()
+		headers := tusHeaders(token, map[string]string{
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": offset,
+		})
+		for key, value := range extra {
+			headers[key] = value
+		}
+		return performRequest(t, env.app, http.MethodPatch, location, strings.NewReader(body), headers)
+	}
+
+	t.Run("options advertises the protocol", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodOptions, "/api/tus", nil, nil)
+		assertStatus(t, resp, http.StatusNoContent)
+		if resp.Header.Get("Tus-Version") != "1.0.0" || !strings.Contains(resp.Header.Get("Tus-Extension"), "checksum") {
+			t.Fatalf("unexpected options headers: %v", resp.Header)
+		}
+	})
+
+	t.Run("requires Tus-Resumable", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodPost, "/api/tus/", nil, authHeaders(token))
+		assertStatus(t, resp, http.StatusPreconditionFailed)
+	})
+
+	t.Run("uploads a file in parts", func(t *testing.T) {
+		location := create(t, "11")
+
+		resp := patch(t, location, "0", "hello", nil)
+		assertStatus(t, resp, http.StatusNoContent)
+		if resp.Header.Get("Upload-Offset") != "5" {
+			t.Fatalf("expected offset 5, got %q", resp.Header.Get("Upload-Offset"))
+		}
+
+		progress := func(t *testing.T) map[string]any {
+			t.Helper()
+			resp := performRequest(t, env.app, http.MethodGet, "/api/files/uploads/"+strings.TrimPrefix(location, "/api/tus/")+"/progress", nil, authHeaders(token))
+			assertStatus(t, resp, http.StatusOK)
+			return decodeJSONMap(t, resp)["data"].(map[string]any)
+		}
+		if data := progress(t); data["receivedBytes"] != float64(5) || data["state"] != "receiving" || data["bitmap"] != "0" || data["chunks"] != float64(1) {
+			t.Fatalf("unexpected progress %v", data)
+		}
+
+		resp = patch(t, location, "3", " world", nil)
+		if body := decodeJSONMap(t, resp); resp.StatusCode != http.StatusConflict || body["code"] != "upload_offset_mismatch" {
+			t.Fatalf("expected 409 upload_offset_mismatch, got %d %v", resp.StatusCode, body)
+		}
+
+		wrong := sha1.Sum([]byte("not it"))
+		resp = patch(t, location, "5", " world", map[string]string{"Upload-Checksum": "sha1 " + base64.StdEncoding.EncodeToString(wrong[:])})
+		assertStatus(t, resp, statusChecksumMismatch)
+
+		resp = performRequest(t, env.app, http.MethodHead, location, nil, tusHeaders(token, nil))
+		assertStatus(t, resp, http.StatusOK)
+		if resp.Header.Get("Upload-Offset") != "5" || resp.Header.Get("Upload-Length") != "11" {
+			t.Fatalf("unexpected head headers: %v", resp.Header)
+		}
+		assertStatus(t, performRequest(t, env.app, http.MethodHead, location, nil, tusHeaders(otherToken, nil)), http.StatusNotFound)
+
+		right := sha1.Sum([]byte(" world"))
+		resp = patch(t, location, "5", " world", map[string]string{"Upload-Checksum": "sha1 " + base64.StdEncoding.EncodeToString(right[:])})
+		assertStatus(t, resp, http.StatusNoContent)
+		fileID := resp.Header.Get("X-File-ID")
+		if fileID == "" {
+			t.Fatal("expected the finished upload to name its file")
+		}
+
+		var file models.File
+		if err := env.db.First(&file, "id = ?", fileID).Error; err != nil {
+			t.Fatalf("failed loading file: %v", err)
+		}
+		sum := sha256.Sum256([]byte("hello world"))
+		if file.Name != "report.txt" || file.Size != 11 || file.Checksum == nil || *file.Checksum != hex.EncodeToString(sum[:]) {
+			t.Fatalf("unexpected file %+v", file)
+		}
+		if string(env.uploads.objects[file.StoragePath]) != "hello world" {
+			t.Fatalf("expected the joined bytes to be stored, got %q", env.uploads.objects[file.StoragePath])
+		}
+		var audits int64
+		env.db.Model(&models.OutboxEvent{}).Where("event_type = ? AND resource_id = ?", "file.upload", file.ID).Count(&audits)
+		if audits != 1 {
+			t.Fatalf("expected one upload audit entry, got %d", audits)
+		}
+
+		if data := progress(t); data["state"] != "ready" || data["fileID"] != fileID || data["bitmap"] != "1" {
+			t.Fatalf("unexpected progress %v", data)
+		}
+
+		resp = performRequest(t, env.app, http.MethodHead, location, nil, tusHeaders(token, nil))
+		if resp.Header.Get("X-File-ID") != fileID {
+			t.Fatalf("expected head to name the file, got %v", resp.Header)
+		}
+	})
+
+	t.Run("progress follows the file into its preview", func(t *testing.T) {
+		image := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+		resp := performRequest(t, env.app, http.MethodPost, "/api/tus/", nil, tusHeaders(token, map[string]string{
+			"Upload-Length":   strconv.Itoa(len(image)),
+			"Upload-Metadata": "filename " + b64("photo.png") + ",filetype " + b64("image/png"),
+		}))
+		assertStatus(t, resp, http.StatusCreated)
+		id := strings.TrimPrefix(resp.Header.Get("Location"), "/api/tus/")
+		assertStatus(t, patch(t, "/api/tus/"+id, "0", image, nil), http.StatusNoContent)
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/files/uploads/"+id+"/progress", nil, authHeaders(token))
+		assertStatus(t, resp, http.StatusOK)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		if data["state"] != "preview_queued" || data["previewJob"] == nil {
+			t.Fatalf("expected a queued preview, got %v", data)
+		}
+		assertStatus(t, performRequest(t, env.app, http.MethodGet, "/api/files/uploads/"+id+"/progress", nil, authHeaders(otherToken)), http.StatusNotFound)
+	})
+
+	t.Run("an empty file is done on creation", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodPost, "/api/tus/", nil, tusHeaders(token, map[string]string{
+			"Upload-Length":   "0",
+			"Upload-Metadata": "filename " + b64("empty.txt"),
+		}))
+		assertStatus(t, resp, http.StatusCreated)
+		if resp.Header.Get("X-File-ID") == "" {
+			t.Fatal("expected an empty upload to become a file straight away")
+		}
+	})
+
+	t.Run("terminates an upload", func(t *testing.T) {
+		location := create(t, "20")
+		assertStatus(t, patch(t, location, "0", "partial", nil), http.StatusNoContent)
+		assertStatus(t, performRequest(t, env.app, http.MethodDelete, location, nil, tusHeaders(token, nil)), http.StatusNoContent)
+		assertStatus(t, performRequest(t, env.app, http.MethodHead, location, nil, tusHeaders(token, nil)), http.StatusNotFound)
+		for key := range env.uploads.objects {
+			if strings.HasPrefix(key, "resumable/") {
+				t.Fatalf("expected the received bytes to be deleted, found %s", key)
+			}
+		}
+	})
+}
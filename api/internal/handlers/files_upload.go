@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxFormValueBytes bounds the non-file fields of an upload form, which
+// are only ever short identifiers.
+const maxFormValueBytes = 1024
+
+// streamedUpload is a file stored by streamUpload.
+type streamedUpload struct {
+	Filename     string
+	ObjectName   string
+	ContentType  string
+	DeclaredType string
+	DetectedType string
+	Size         int64
+	Checksum     string
+}
+
+// requestBodyStream returns the request body without buffering it when the
+// server streams request bodies, and the already read body otherwise.
+func requestBodyStream(c *fiber.Ctx) io.Reader {
+	if stream := middleware.BodyStream(c); stream != nil {
+		return stream
+	}
+	return bytes.NewReader(c.Body())
+}
+
+func readFormValue(part *multipart.Part) (string, error) {
+	value, err := io.ReadAll(io.LimitReader(part, maxFormValueBytes+1))
+	if err != nil {
+		return "", err
+	}
+	if len(value) > maxFormValueBytes {
+		return "", errors.New("form value too long")
+	}
+	return strings.TrimSpace(string(value)), nil
+}
+
+// uploadParent resolves the parentID form field to a folder user may upload
+// into. An empty value means the root.
+func (h *FilesHandler) uploadParent(c *fiber.Ctx, user *models.User, raw string) (*uuid.UUID, *utils.APIError) {
+	return resolveUploadParent(c, h.DB, h.Access, user, raw)
+}
+
+// resolveUploadParent checks that raw names a folder user can edit, for
+// anything that adds a file to it.
+func resolveUploadParent(c *fiber.Ctx, db *gorm.DB, access *services.AccessService, user *models.User, raw string) (*uuid.UUID, *utils.APIError) {
+	if raw == "" {
+		return nil, nil
+	}
+	parsed, err := parseUUID(raw)
+	if err != nil {
+		return nil, errInvalidParentID
+	}
+
+	var parent models.File
+	if err := db.First(&parent, "id = ?", parsed).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errParentNotFound
+		}
+		return nil, utils.NewError(fiber.StatusInternalServerError, "internal_error", "failed validating parent folder")
+	}
+	if !parent.IsDirectory {
+		return nil, errParentNotDirectory
+	}
+	if !access.HasAccess(c.Context(), user.ID, parent.ID, models.SharePermissionEdit) {
+		logger.WarnWithUser(user.ID.String(), "permission_denied", map[string]interface{}{
+			"action":              "file_upload",
+			"target_id":           parent.ID.String(),
+			"required_permission": "edit",
+		})
+		return nil, utils.NewError(fiber.StatusForbidden, "forbidden", "no permission to upload to parent directory")
+	}
+	return &parsed, nil
+}
+
+// classifyUpload checks a new file against the classification rules and
+// applies their tags, retention class and folder to entry. It returns the
+// 403 to report when a rule blocks the upload; the caller removes whatever
+// it stored. Without a classifier it does nothing.
+func (h *FilesHandler) classifyUpload(c *fiber.Ctx, user *models.User, entry *models.File) (*services.Classification, *utils.APIError) {
+	if h.Classifier == nil {
+		return nil, nil
+	}
+	result, err := h.Classifier.Classify(c.Context(), services.ClassificationInput{
+		FileName:       entry.Name,
+		MimeType:       entry.MimeType,
+		DetectedType:   entry.DetectedMimeType,
+		UploaderID:     user.ID,
+		OrganizationID: user.OrganizationID,
+		ParentID:       entry.ParentID,
+	})
+	if err != nil {
+		return nil, utils.NewError(fiber.StatusInternalServerError, "classification_failed", "failed checking classification rules")
+	}
+	if blocked := result.BlockedBy; blocked != nil {
+		logger.WarnWithUser(user.ID.String(), "upload_blocked", map[string]interface{}{
+			"file_name": entry.Name,
+			"rule_id":   blocked.RuleID.String(),
+		})
+		h.Audit.LogAsync(services.AuditEntry{
+			UserID:       &user.ID,
+			Action:       "file.upload_blocked",
+			ResourceType: "classification_rule",
+			ResourceID:   &blocked.RuleID,
+			Details: map[string]interface{}{
+				"file_name": entry.Name,
+				"file_size": entry.Size,
+				"mime_type": entry.MimeType,
+				"rule_name": blocked.RuleName,
+			},
+			IPAddress: c.IP(),
+			RequestID: getRequestID(c),
+		})
+		return nil, errUploadBlocked.WithMessage(fmt.Sprintf("upload blocked by the %q rule", blocked.RuleName))
+	}
+	result.ApplyTo(entry)
+	return result, nil
+}
+
+// recordClassification audits the rules that matched entry within tx.
+func (h *FilesHandler) recordClassification(c *fiber.Ctx, tx *gorm.DB, user *models.User, entry *models.File, result *services.Classification) error {
+	if result == nil {
+		return nil
+	}
+	return h.Classifier.Record(tx, entry, result, services.AuditEntry{
+		UserID:    &user.ID,
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+}
+
+// streamUpload copies the file part of an upload form to object storage.
+// The upload policy is applied to the first bytes before anything is
+// stored, and the size limit while copying, since the part's length is not
+// known up front.
+func (h *FilesHandler) streamUpload(c *fiber.Ctx, user *models.User, part *multipart.Part) (*streamedUpload, *utils.APIError) {
+	filename := filepath.Base(strings.TrimSpace(part.FileName()))
+	if filename == "" || filename == "." || filename == string(filepath.Separator) {
+		return nil, utils.NewError(fiber.StatusBadRequest, "bad_request", "invalid filename")
+	}
+
+	upload := &streamedUpload{
+		Filename:     filename,
+		DeclaredType: part.Header.Get("Content-Type"),
+	}
+	upload.ContentType = resolveMimeType(filename, upload.DeclaredType)
+
+	maxUpload := h.maxUploadBytes(c.Context())
+	body := &cappedReader{r: part, max: maxUpload}
+	head := make([]byte, services.SniffLength)
+	n, _ := io.ReadFull(body, head)
+	if body.err != nil {
+		return nil, errInvalidMultipart
+	}
+	head = head[:n]
+	upload.DetectedType = services.DetectContentType(head)
+	if err := h.UploadPolicy.Check(filename, upload.ContentType, upload.DetectedType); err != nil {
+		return nil, uploadRejection(user.ID, filename, err)
+	}
+
+	upload.ObjectName = fmt.Sprintf("%s/%s/%s", user.ID.String(), uuid.New().String(), filename)
+	hasher := sha256.New()
+	stream := io.TeeReader(io.MultiReader(bytes.NewReader(head), body), hasher)
+	size, err := h.Storage.UploadStream(c.Context(), upload.ObjectName, stream, upload.ContentType)
+	if body.exceeded {
+		return nil, errUploadTooLarge.WithMessage(fmt.Sprintf("file exceeds maximum upload size of %d bytes", maxUpload))
+	}
+	if body.err != nil {
+		return nil, errInvalidMultipart
+	}
+	if err != nil {
+		return nil, utils.NewError(fiber.StatusInternalServerError, "internal_error", "failed uploading file")
+	}
+	upload.Size = size
+	upload.Checksum = hex.EncodeToString(hasher.Sum(nil))
+	return upload, nil
+}
+
+var errUploadCapExceeded = errors.New("upload exceeds maximum size")
+
+// cappedReader fails once more than max bytes have been read from r, which
+// makes the storage client abort the upload. A max of zero disables the cap.
+// It keeps the error r failed with, if any, so a truncated or malformed body
+// can be told apart from a storage failure.
+type cappedReader struct {
+	r        io.Reader
+	max      int64
+	read     int64
+	exceeded bool
+	err      error
+}
+
+func (cr *cappedReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) && cr.err == nil {
+		cr.err = err
+	}
+	cr.read += int64(n)
+	if cr.max > 0 && cr.read > cr.max {
+		cr.exceeded = true
+		return n, errUploadCapExceeded
+	}
+	return n, err
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestUpload_MalformedMultipart(t *testing.T) {
+	env := setupTestEnv(t)
+	_, token := createTestUser(t, env.db, "upload-malformed@test.com", "password123", models.UserRoleUser)
+
+	body := strings.NewReader("--xyz\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\ntruncated")
+	resp := performRequest(t, env.app, http.MethodPost, "/api/files/upload", body, map[string]string{
+		"Authorization": "Bearer " + token,
+		"Content-Type":  "multipart/form-data; boundary=xyz",
+	})
+	assertStatus(t, resp, http.StatusBadRequest)
+	assertEnvelopeError(t, decodeJSONMap(t, resp), "malformed multipart body")
+
+	var count int64
+	env.db.Model(&models.File{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected no file record, got %d", count)
+	}
+}
+
+func TestCappedReader(t *testing.T) {
+	t.Run("within the cap", func(t *testing.T) {
+		r := &cappedReader{r: bytes.NewReader(make([]byte, 100)), max: 100}
+		n, err := io.Copy(io.Discard, r)
+		if err != nil || n != 100 || r.exceeded {
+			t.Fatalf("expected all 100 bytes, got n=%d err=%v exceeded=%v", n, err, r.exceeded)
+		}
+	})
+
+	t.Run("past the cap", func(t *testing.T) {
+		r := &cappedReader{r: bytes.NewReader(make([]byte, 101)), max: 100}
+		_, err := io.Copy(io.Discard, r)
+		if !errors.Is(err, errUploadCapExceeded) || !r.exceeded {
+			t.Fatalf("expected the read to fail past the cap, got err=%v exceeded=%v", err, r.exceeded)
+		}
+	})
+
+	t.Run("no cap", func(t *testing.T) {
+		r := &cappedReader{r: bytes.NewReader(make([]byte, 4096))}
+		if n, err := io.Copy(io.Discard, r); err != nil || n != 4096 {
+			t.Fatalf("expected an uncapped read, got n=%d err=%v", n, err)
+		}
+	})
+}
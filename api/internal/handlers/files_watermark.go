@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+var errWatermarkUnavailable = utils.NewError(fiber.StatusServiceUnavailable, "watermark_unavailable", "this file is only served watermarked, and the watermark cannot be applied right now")
+
+// watermark swaps the object at key, about to be served as contentType,
+// for a copy stamped for the viewer when a share that reaches them asks
+// for it. Only PDFs are stamped. user is nil for anonymous visitors. The
+// original is never served in place of a copy that could not be made.
+func (h *FilesHandler) watermark(c *fiber.Ctx, file *models.File, key, contentType string, user *models.User) (string, *utils.APIError) {
+	if contentType != "application/pdf" || (user != nil && user.ID == file.OwnerID) {
+		return key, nil
+	}
+	var userID *uuid.UUID
+	if user != nil {
+		userID = &user.ID
+	}
+	if !h.Access.WatermarkRequired(c.Context(), file.ID, userID) {
+		return key, nil
+	}
+	if h.Renditions == nil {
+		return "", errWatermarkUnavailable
+	}
+
+	mark := services.Watermark{IPAddress: c.IP(), At: time.Now()}
+	if user != nil {
+		mark.Viewer = user.Email
+	}
+	stamped, err := h.Renditions.Watermarked(c.Context(), file, key, mark)
+	if err != nil {
+		logger.Error("watermark_failed", err, map[string]interface{}{
+			"file_id": file.ID.String(),
+		})
+		return "", errWatermarkUnavailable
+	}
+	return stamped, nil
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestWatermarkedShares(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "wm-owner@test.com", "password123", models.UserRoleUser)
+	viewer, viewerToken := createTestUser(t, env.db, "wm-viewer@test.com", "password123", models.UserRoleUser)
+
+	file := models.File{Name: "term-sheet.pdf", MimeType: "application/pdf", OwnerID: owner.ID, StoragePath: "term-sheet.pdf", Size: 10}
+	if err := env.db.Create(&file).Error; err != nil {
+		t.Fatalf("failed creating file: %v", err)
+	}
+
+	resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+file.ID.String()+"/share", map[string]any{
+		"userID":     viewer.ID,
+		"permission": "download",
+		"watermark":  true,
+	}, authHeaders(ownerToken))
+	assertStatus(t, resp, http.StatusCreated)
+	share := decodeJSONMap(t, resp)["data"].(map[string]any)
+	if share["watermark"] != true {
+		t.Fatalf("expected the share to watermark, got %v", share)
+	}
+
+	// Without a converter the stamped copy cannot be made, and the
+	// original must not be served in its place.
+	resp = performRequest(t, env.app, http.MethodGet, "/api/files/"+file.ID.String()+"/download", nil, authHeaders(viewerToken))
+	if body := decodeJSONMap(t, resp); resp.StatusCode != http.StatusServiceUnavailable || body["code"] != "watermark_unavailable" {
+		t.Fatalf("expected 503 watermark_unavailable, got %d %v", resp.StatusCode, body)
+	}
+
+	resp = performJSONRequest(t, env.app, http.MethodPut, "/api/shares/"+share["id"].(string), map[string]any{
+		"permission": "download",
+		"watermark":  false,
+	}, authHeaders(ownerToken))
+	assertStatus(t, resp, http.StatusOK)
+	var stored models.Share
+	if err := env.db.First(&stored, "id = ?", share["id"]).Error; err != nil || stored.Watermark {
+		t.Fatalf("expected the watermark to be turned off, got %+v, %v", stored, err)
+	}
+}
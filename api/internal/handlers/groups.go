@@ -16,6 +16,8 @@ import (
 type GroupsHandler struct {
 	DB    *gorm.DB
 	Audit *services.AuditService
+	// Quotas reports group storage usage; without it Usage is unavailable.
+	Quotas *services.GroupQuotas
 }
 
 func NewGroupsHandler(db *gorm.DB, audit *services.AuditService) *GroupsHandler {
@@ -30,12 +32,12 @@ type createGroupRequest struct {
 func (h *GroupsHandler) Create(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var req createGroupRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	req.Name = strings.TrimSpace(req.Name)
@@ -44,9 +46,10 @@ func (h *GroupsHandler) Create(c *fiber.Ctx) error {
 	}
 
 	group := models.Group{
-		Name:        req.Name,
-		Description: req.Description,
-		CreatedByID: currentUser.ID,
+		Name:           req.Name,
+		Description:    req.Description,
+		CreatedByID:    currentUser.ID,
+		OrganizationID: currentUser.OrganizationID,
 	}
 
 	err := h.DB.Transaction(func(tx *gorm.DB) error {
@@ -88,7 +91,7 @@ func (h *GroupsHandler) Create(c *fiber.Ctx) error {
 func (h *GroupsHandler) List(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	p := utils.ParsePagination(c)
@@ -97,7 +100,8 @@ func (h *GroupsHandler) List(c *fiber.Ctx) error {
 		Model(&models.Group{}).
 		Preload("Memberships").
 		Joins("JOIN group_memberships ON group_memberships.group_id = groups.id").
-		Where("group_memberships.user_id = ?", currentUser.ID)
+		Where("group_memberships.user_id = ?", currentUser.ID).
+		Scopes(services.OrganizationScope("groups", currentUser.OrganizationID))
 
 	var total int64
 	if err := baseQuery.Count(&total).Error; err != nil {
@@ -115,17 +119,17 @@ func (h *GroupsHandler) List(c *fiber.Ctx) error {
 func (h *GroupsHandler) Get(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	groupID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid group id")
+		return utils.Fail(c, errInvalidGroupID)
 	}
 
 	if _, err := h.getMembership(groupID, currentUser.ID); err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusForbidden, "group access denied")
+			return utils.Fail(c, errGroupAccessDenied)
 		}
 		return utils.Error(c, fiber.StatusInternalServerError, "failed validating membership")
 	}
@@ -133,7 +137,7 @@ func (h *GroupsHandler) Get(c *fiber.Ctx) error {
 	var group models.Group
 	if err := h.DB.Preload("Memberships.User").First(&group, "id = ?", groupID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "group not found")
+			return utils.Fail(c, errGroupNotFound)
 		}
 		return utils.Error(c, fiber.StatusInternalServerError, "failed loading group")
 	}
@@ -149,28 +153,28 @@ type updateGroupRequest struct {
 func (h *GroupsHandler) Update(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	groupID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid group id")
+		return utils.Fail(c, errInvalidGroupID)
 	}
 
 	membership, err := h.getMembership(groupID, currentUser.ID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusForbidden, "group access denied")
+			return utils.Fail(c, errGroupAccessDenied)
 		}
 		return utils.Error(c, fiber.StatusInternalServerError, "failed validating membership")
 	}
 	if membership.Role != models.GroupRoleOwner && membership.Role != models.GroupRoleAdmin {
-		return utils.Error(c, fiber.StatusForbidden, "insufficient permissions")
+		return utils.Fail(c, errInsufficientPermissions)
 	}
 
 	var req updateGroupRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	updates := map[string]interface{}{}
@@ -199,7 +203,7 @@ func (h *GroupsHandler) Update(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed updating group")
 	}
 	if result.RowsAffected == 0 {
-		return utils.Error(c, fiber.StatusNotFound, "group not found")
+		return utils.Fail(c, errGroupNotFound)
 	}
 
 	var updated models.Group
@@ -213,18 +217,18 @@ func (h *GroupsHandler) Update(c *fiber.Ctx) error {
 func (h *GroupsHandler) Delete(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	groupID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid group id")
+		return utils.Fail(c, errInvalidGroupID)
 	}
 
 	membership, err := h.getMembership(groupID, currentUser.ID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusForbidden, "group access denied")
+			return utils.Fail(c, errGroupAccessDenied)
 		}
 		return utils.Error(c, fiber.StatusInternalServerError, "failed validating membership")
 	}
@@ -271,28 +275,28 @@ type addMemberRequest struct {
 func (h *GroupsHandler) AddMember(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	groupID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid group id")
+		return utils.Fail(c, errInvalidGroupID)
 	}
 
 	actorMembership, err := h.getMembership(groupID, currentUser.ID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusForbidden, "group access denied")
+			return utils.Fail(c, errGroupAccessDenied)
 		}
 		return utils.Error(c, fiber.StatusInternalServerError, "failed validating membership")
 	}
 	if actorMembership.Role != models.GroupRoleOwner && actorMembership.Role != models.GroupRoleAdmin {
-		return utils.Error(c, fiber.StatusForbidden, "insufficient permissions")
+		return utils.Fail(c, errInsufficientPermissions)
 	}
 
 	var req addMemberRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	if req.UserID == uuid.Nil {
@@ -306,9 +310,9 @@ func (h *GroupsHandler) AddMember(c *fiber.Ctx) error {
 	}
 
 	var user models.User
-	if err := h.DB.First(&user, "id = ?", req.UserID).Error; err != nil {
+	if err := h.DB.Scopes(services.OrganizationScope("users", currentUser.OrganizationID)).First(&user, "id = ?", req.UserID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "user not found")
+			return utils.Fail(c, errUserNotFound)
 		}
 		return utils.Error(c, fiber.StatusInternalServerError, "failed loading user")
 	}
@@ -346,22 +350,22 @@ func (h *GroupsHandler) AddMember(c *fiber.Ctx) error {
 func (h *GroupsHandler) RemoveMember(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	groupID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid group id")
+		return utils.Fail(c, errInvalidGroupID)
 	}
 	userID, err := parseUUID(c.Params("userId"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid user id")
+		return utils.Fail(c, errInvalidUserID)
 	}
 
 	actorMembership, err := h.getMembership(groupID, currentUser.ID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusForbidden, "group access denied")
+			return utils.Fail(c, errGroupAccessDenied)
 		}
 		return utils.Error(c, fiber.StatusInternalServerError, "failed validating membership")
 	}
@@ -369,7 +373,7 @@ func (h *GroupsHandler) RemoveMember(c *fiber.Ctx) error {
 	targetMembership, err := h.getMembership(groupID, userID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "member not found")
+			return utils.Fail(c, errMemberNotFound)
 		}
 		return utils.Error(c, fiber.StatusInternalServerError, "failed loading target membership")
 	}
@@ -378,7 +382,7 @@ func (h *GroupsHandler) RemoveMember(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusForbidden, "cannot remove group owner")
 	}
 	if actorMembership.Role != models.GroupRoleOwner && actorMembership.Role != models.GroupRoleAdmin {
-		return utils.Error(c, fiber.StatusForbidden, "insufficient permissions")
+		return utils.Fail(c, errInsufficientPermissions)
 	}
 	if actorMembership.Role == models.GroupRoleAdmin && targetMembership.Role == models.GroupRoleAdmin {
 		return utils.Error(c, fiber.StatusForbidden, "admins cannot remove other admins")
@@ -414,33 +418,33 @@ type updateMemberRoleRequest struct {
 func (h *GroupsHandler) UpdateMemberRole(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	groupID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid group id")
+		return utils.Fail(c, errInvalidGroupID)
 	}
 	userID, err := parseUUID(c.Params("userId"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid user id")
+		return utils.Fail(c, errInvalidUserID)
 	}
 
 	actorMembership, err := h.getMembership(groupID, currentUser.ID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusForbidden, "group access denied")
+			return utils.Fail(c, errGroupAccessDenied)
 		}
 		return utils.Error(c, fiber.StatusInternalServerError, "failed validating membership")
 	}
 	if actorMembership.Role != models.GroupRoleOwner && actorMembership.Role != models.GroupRoleAdmin {
-		return utils.Error(c, fiber.StatusForbidden, "insufficient permissions")
+		return utils.Fail(c, errInsufficientPermissions)
 	}
 
 	targetMembership, err := h.getMembership(groupID, userID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "member not found")
+			return utils.Fail(c, errMemberNotFound)
 		}
 		return utils.Error(c, fiber.StatusInternalServerError, "failed loading target membership")
 	}
@@ -450,7 +454,7 @@ func (h *GroupsHandler) UpdateMemberRole(c *fiber.Ctx) error {
 
 	var req updateMemberRoleRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	if req.Role != models.GroupRoleAdmin && req.Role != models.GroupRoleMember {
@@ -476,3 +480,169 @@ func (h *GroupsHandler) getMembership(groupID, userID uuid.UUID) (*models.GroupM
 	}
 	return &membership, nil
 }
+
+type downloadLimitRequest struct {
+	// KBps is the per-user download cap for members in KB/s. Null removes
+	// the override and zero lifts the cap entirely.
+	KBps *int64 `json:"kbps"`
+}
+
+// SetDownloadLimit lets an admin give a group's members a different
+// download bandwidth cap than the server default, e.g. for premium users.
+func (h *GroupsHandler) SetDownloadLimit(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	groupID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidGroupID)
+	}
+
+	var req downloadLimitRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	if req.KBps != nil && *req.KBps < 0 {
+		return utils.Error(c, fiber.StatusBadRequest, "kbps must not be negative")
+	}
+
+	var group models.Group
+	if err := h.DB.Scopes(services.OrganizationScope("groups", currentUser.OrganizationID)).
+		First(&group, "id = ?", groupID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utils.Fail(c, errGroupNotFound)
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading group")
+	}
+
+	if err := h.DB.Model(&group).Update("download_rate_kbps", req.KBps).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed updating group")
+	}
+	group.DownloadRateKBps = req.KBps
+
+	details := map[string]interface{}{"group_name": group.Name, "kbps": nil}
+	if req.KBps != nil {
+		details["kbps"] = *req.KBps
+	}
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "admin.group_download_limit",
+		ResourceType: "group",
+		ResourceID:   &groupID,
+		Details:      details,
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusOK, group)
+}
+
+type groupQuotaRequest struct {
+	// Bytes caps the group drive. Null removes the quota.
+	Bytes *int64 `json:"bytes"`
+	// IncludeMembers also counts the files members own.
+	IncludeMembers bool `json:"includeMembers"`
+}
+
+// SetQuota lets an admin cap how much a group's drive, and optionally its
+// members, may store.
+func (h *GroupsHandler) SetQuota(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	groupID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidGroupID)
+	}
+
+	var req groupQuotaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	if req.Bytes != nil && *req.Bytes <= 0 {
+		return utils.Error(c, fiber.StatusBadRequest, "bytes must be positive")
+	}
+
+	var group models.Group
+	if err := h.DB.Scopes(services.OrganizationScope("groups", currentUser.OrganizationID)).
+		First(&group, "id = ?", groupID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utils.Fail(c, errGroupNotFound)
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading group")
+	}
+
+	// A new quota starts the warnings over.
+	if err := h.DB.Model(&group).Updates(map[string]interface{}{
+		"storage_quota_bytes":    req.Bytes,
+		"quota_includes_members": req.IncludeMembers,
+		"quota_warned_percent":   0,
+	}).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed updating group")
+	}
+	group.StorageQuotaBytes = req.Bytes
+	group.QuotaIncludesMembers = req.IncludeMembers
+	group.QuotaWarnedPercent = 0
+	if h.Quotas != nil {
+		if err := h.Quotas.Evaluate(c.Context(), &group); err != nil {
+			logger.Error("group_quota_evaluate_failed", err, map[string]interface{}{
+				"group_id": groupID.String(),
+			})
+		}
+	}
+
+	details := map[string]interface{}{"group_name": group.Name, "bytes": nil, "include_members": req.IncludeMembers}
+	if req.Bytes != nil {
+		details["bytes"] = *req.Bytes
+	}
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "admin.group_quota",
+		ResourceType: "group",
+		ResourceID:   &groupID,
+		Details:      details,
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusOK, group)
+}
+
+// Usage reports how much of its quota a group uses. Members and admins can
+// see it.
+func (h *GroupsHandler) Usage(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	groupID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidGroupID)
+	}
+
+	if currentUser.Role != models.UserRoleAdmin {
+		if _, err := h.getMembership(groupID, currentUser.ID); err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return utils.Fail(c, errGroupAccessDenied)
+			}
+			return utils.Error(c, fiber.StatusInternalServerError, "failed validating membership")
+		}
+	}
+	if h.Quotas == nil {
+		return utils.Error(c, fiber.StatusServiceUnavailable, "group usage is not available")
+	}
+
+	usage, err := h.Quotas.Usage(c.Context(), groupID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utils.Fail(c, errGroupNotFound)
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed computing group usage")
+	}
+	return utils.Success(c, fiber.StatusOK, usage)
+}
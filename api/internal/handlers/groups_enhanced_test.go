@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"encoding/base64"
 	"net/http"
 	"testing"
 
@@ -214,3 +215,119 @@ func TestGroupsEndpoints_AdminScenarios(t *testing.T) {
 		assertEnvelopeError(t, body, "admins cannot remove other admins")
 	})
 }
+
+func TestGroupsEndpoints_DownloadLimit(t *testing.T) {
+	env := setupTestEnv(t)
+	_, ownerToken := createTestUser(t, env.db, "groups-limit-owner@test.com", "password123", models.UserRoleUser)
+	_, siteAdminToken := createTestUser(t, env.db, "groups-limit-admin@test.com", "password123", models.UserRoleAdmin)
+
+	resp := performJSONRequest(t, env.app, http.MethodPost, "/api/groups/", map[string]any{
+		"name": "Premium",
+	}, authHeaders(ownerToken))
+	assertStatus(t, resp, http.StatusCreated)
+	limitPath := "/api/groups/" + decodeJSONMap(t, resp)["data"].(map[string]any)["id"].(string) + "/download-limit"
+
+	t.Run("group owner cannot set it", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, limitPath, map[string]any{"kbps": 0}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("negative", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, limitPath, map[string]any{"kbps": -1}, authHeaders(siteAdminToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+
+	t.Run("set and clear", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, limitPath, map[string]any{"kbps": 0}, authHeaders(siteAdminToken))
+		assertStatus(t, resp, http.StatusOK)
+		if got := decodeJSONMap(t, resp)["data"].(map[string]any)["downloadRateKBps"]; got != float64(0) {
+			t.Fatalf("expected an unlimited override, got %v", got)
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPut, limitPath, map[string]any{"kbps": nil}, authHeaders(siteAdminToken))
+		assertStatus(t, resp, http.StatusOK)
+		var group models.Group
+		if err := env.db.First(&group, "name = ?", "Premium").Error; err != nil || group.DownloadRateKBps != nil {
+			t.Fatalf("expected the override to be cleared, got %v (%v)", group.DownloadRateKBps, err)
+		}
+	})
+
+	t.Run("unknown group", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/groups/"+uuid.NewString()+"/download-limit", map[string]any{"kbps": 10}, authHeaders(siteAdminToken))
+		assertStatus(t, resp, http.StatusNotFound)
+	})
+}
+
+func TestGroupsEndpoints_Quota(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "groups-quota-owner@test.com", "password123", models.UserRoleUser)
+	_, outsiderToken := createTestUser(t, env.db, "groups-quota-outsider@test.com", "password123", models.UserRoleUser)
+	_, siteAdminToken := createTestUser(t, env.db, "groups-quota-admin@test.com", "password123", models.UserRoleAdmin)
+
+	resp := performJSONRequest(t, env.app, http.MethodPost, "/api/groups/", map[string]any{
+		"name": "Studio",
+	}, authHeaders(ownerToken))
+	assertStatus(t, resp, http.StatusCreated)
+	groupID := decodeJSONMap(t, resp)["data"].(map[string]any)["id"].(string)
+	groupUUID := uuid.MustParse(groupID)
+
+	drive := models.File{Name: "Studio", MimeType: "inode/directory", IsDirectory: true, OwnerID: owner.ID}
+	env.db.Create(&drive)
+	env.db.Create(&models.File{Name: "brief.pdf", MimeType: "application/pdf", Size: 600, OwnerID: owner.ID, ParentID: &drive.ID, StoragePath: "studio/brief.pdf"})
+	env.db.Create(&models.Share{FileID: drive.ID, SharedByID: owner.ID, SharedWithGroupID: &groupUUID, Permission: models.SharePermissionEdit})
+
+	expectCode := func(t *testing.T, resp *http.Response, status int, code string) {
+		t.Helper()
+		body := decodeJSONMap(t, resp)
+		if resp.StatusCode != status || body["code"] != code {
+			t.Fatalf("expected %d %s, got %d %v", status, code, resp.StatusCode, body)
+		}
+	}
+	tusCreate := func(length string) *http.Response {
+		headers := authHeaders(ownerToken)
+		headers["Tus-Resumable"] = "1.0.0"
+		headers["Upload-Length"] = length
+		headers["Upload-Metadata"] = "filename " + base64.StdEncoding.EncodeToString([]byte("mock.png")) +
+			",parentID " + base64.StdEncoding.EncodeToString([]byte(drive.ID.String()))
+		return performRequest(t, env.app, http.MethodPost, "/api/tus/", nil, headers)
+	}
+
+	t.Run("only admins set it", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/groups/"+groupID+"/quota", map[string]any{"bytes": 1000}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+		resp = performJSONRequest(t, env.app, http.MethodPut, "/api/groups/"+groupID+"/quota", map[string]any{"bytes": 0}, authHeaders(siteAdminToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+
+	t.Run("uploads into the drive are held to it", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/groups/"+groupID+"/quota", map[string]any{"bytes": 1000}, authHeaders(siteAdminToken))
+		assertStatus(t, resp, http.StatusOK)
+		if got := decodeJSONMap(t, resp)["data"].(map[string]any)["storageQuotaBytes"]; got != float64(1000) {
+			t.Fatalf("expected the quota to be set, got %v", got)
+		}
+
+		expectCode(t, tusCreate("401"), http.StatusInsufficientStorage, "group_quota_exceeded")
+		assertStatus(t, tusCreate("400"), http.StatusCreated)
+	})
+
+	t.Run("members see usage", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/groups/"+groupID+"/usage", nil, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		usage := body["data"].(map[string]any)
+		if usage["usedBytes"] != float64(600) || usage["driveBytes"] != float64(600) || usage["percent"] != float64(60) {
+			t.Fatalf("unexpected usage %v", usage)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/groups/"+groupID+"/usage", nil, authHeaders(outsiderToken))
+		assertStatus(t, resp, http.StatusForbidden)
+		resp = performRequest(t, env.app, http.MethodGet, "/api/groups/"+groupID+"/usage", nil, authHeaders(siteAdminToken))
+		assertStatus(t, resp, http.StatusOK)
+	})
+
+	t.Run("clearing it lifts the limit", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/groups/"+groupID+"/quota", map[string]any{"bytes": nil}, authHeaders(siteAdminToken))
+		assertStatus(t, resp, http.StatusOK)
+		assertStatus(t, tusCreate("5000"), http.StatusCreated)
+	})
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxGroupImportRows bounds how many members one import may name.
+const maxGroupImportRows = 1000
+
+// Outcomes of one import row.
+const (
+	importRowAdded         = "added"
+	importRowAlreadyMember = "already_member"
+	importRowUserNotFound  = "user_not_found"
+	importRowInvalid       = "invalid"
+)
+
+var (
+	errImportEmpty    = utils.NewError(fiber.StatusBadRequest, "import_empty", "the import names no members")
+	errImportTooLarge = utils.NewError(fiber.StatusBadRequest, "import_too_large", "at most 1000 members can be imported at once")
+	errImportCSV      = utils.NewError(fiber.StatusBadRequest, "invalid_csv", "body is not valid CSV")
+)
+
+type importMemberRow struct {
+	Email string                     `json:"email"`
+	Role  models.GroupMembershipRole `json:"role"`
+}
+
+type importMembersRequest struct {
+	Members []importMemberRow `json:"members"`
+}
+
+// importMemberResult reports what happened to one row. Row counts from 1,
+// after any CSV header.
+type importMemberResult struct {
+	Row    int                        `json:"row"`
+	Email  string                     `json:"email"`
+	Role   models.GroupMembershipRole `json:"role,omitempty"`
+	Status string                     `json:"status"`
+	UserID *uuid.UUID                 `json:"userID,omitempty"`
+	Error  string                     `json:"error,omitempty"`
+}
+
+// parseMemberCSV reads email,role rows. A first row starting with "email"
+// is taken as a header; a missing role means member. The byte order mark
+// spreadsheet programs put in front of exported CSV is ignored.
+func parseMemberCSV(body []byte) ([]importMemberRow, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	var rows []importMemberRow
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if first && strings.EqualFold(strings.TrimSpace(record[0]), "email") {
+			continue
+		}
+		row := importMemberRow{Email: record[0]}
+		if len(record) > 1 {
+			row.Role = models.GroupMembershipRole(strings.TrimSpace(record[1]))
+		}
+		rows = append(rows, row)
+	}
+}
+
+// ImportMembers adds many users to a group at once from a CSV body
+// (text/csv, email,role per line) or a JSON body ({"members": [...]}). Each
+// row is reported on its own; rows that cannot be added do not stop the
+// others. The whole import is one audit entry.
+func (h *GroupsHandler) ImportMembers(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	groupID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidGroupID)
+	}
+
+	actorMembership, err := h.getMembership(groupID, currentUser.ID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utils.Fail(c, errGroupAccessDenied)
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed validating membership")
+	}
+	if actorMembership.Role != models.GroupRoleOwner && actorMembership.Role != models.GroupRoleAdmin {
+		return utils.Fail(c, errInsufficientPermissions)
+	}
+
+	var rows []importMemberRow
+	if strings.HasPrefix(strings.ToLower(c.Get(fiber.HeaderContentType)), "text/csv") {
+		if rows, err = parseMemberCSV(c.Body()); err != nil {
+			return utils.Fail(c, errImportCSV.WithMessage("body is not valid CSV: "+err.Error()))
+		}
+	} else {
+		var req importMembersRequest
+		if err := json.Unmarshal(c.Body(), &req); err != nil {
+			return utils.Fail(c, errInvalidBody)
+		}
+		rows = req.Members
+	}
+	if len(rows) == 0 {
+		return utils.Fail(c, errImportEmpty)
+	}
+	if len(rows) > maxGroupImportRows {
+		return utils.Fail(c, errImportTooLarge)
+	}
+
+	results := make([]importMemberResult, len(rows))
+	var emails []string
+	for i, row := range rows {
+		email := strings.ToLower(strings.TrimSpace(row.Email))
+		role := row.Role
+		if role == "" {
+			role = models.GroupRoleMember
+		}
+		results[i] = importMemberResult{Row: i + 1, Email: email, Role: role}
+		switch {
+		case email == "":
+			results[i].Status, results[i].Error = importRowInvalid, "email is required"
+		case role != models.GroupRoleOwner && role != models.GroupRoleAdmin && role != models.GroupRoleMember:
+			results[i].Status, results[i].Error = importRowInvalid, "invalid role"
+		case actorMembership.Role == models.GroupRoleAdmin && role != models.GroupRoleMember:
+			results[i].Status, results[i].Error = importRowInvalid, "admins can only add members with member role"
+		default:
+			emails = append(emails, email)
+		}
+	}
+
+	users := map[string]models.User{}
+	members := map[uuid.UUID]bool{}
+	if len(emails) > 0 {
+		var found []models.User
+		if err := h.DB.Scopes(services.OrganizationScope("users", currentUser.OrganizationID)).
+			Where("LOWER(email) IN ?", emails).Find(&found).Error; err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed loading users")
+		}
+		for _, user := range found {
+			users[strings.ToLower(user.Email)] = user
+		}
+		var existing []uuid.UUID
+		if err := h.DB.Model(&models.GroupMembership{}).Where("group_id = ?", groupID).Pluck("user_id", &existing).Error; err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed loading members")
+		}
+		for _, id := range existing {
+			members[id] = true
+		}
+	}
+
+	var memberships []models.GroupMembership
+	for i := range results {
+		result := &results[i]
+		if result.Status != "" {
+			continue
+		}
+		user, ok := users[result.Email]
+		if !ok {
+			result.Status = importRowUserNotFound
+			continue
+		}
+		result.UserID = &user.ID
+		if members[user.ID] {
+			result.Status = importRowAlreadyMember
+			continue
+		}
+		members[user.ID] = true
+		result.Status = importRowAdded
+		memberships = append(memberships, models.GroupMembership{UserID: user.ID, GroupID: groupID, Role: result.Role})
+	}
+	if len(memberships) > 0 {
+		if err := h.DB.CreateInBatches(&memberships, 200).Error; err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed adding members")
+		}
+	}
+
+	summary := map[string]int{}
+	for _, result := range results {
+		summary[result.Status]++
+	}
+
+	var grp models.Group
+	h.DB.Select("name").First(&grp, "id = ?", groupID)
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "group.members_import",
+		ResourceType: "group",
+		ResourceID:   &groupID,
+		Details: map[string]interface{}{
+			"group_name":     grp.Name,
+			"rows":           len(results),
+			"added":          summary[importRowAdded],
+			"already_member": summary[importRowAlreadyMember],
+			"user_not_found": summary[importRowUserNotFound],
+			"invalid":        summary[importRowInvalid],
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{
+		"summary": fiber.Map{
+			"added":         summary[importRowAdded],
+			"alreadyMember": summary[importRowAlreadyMember],
+			"userNotFound":  summary[importRowUserNotFound],
+			"invalid":       summary[importRowInvalid],
+		},
+		"results": results,
+	})
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestGroupMemberImport(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "import-owner@test.com", "password123", models.UserRoleUser)
+	existing, _ := createTestUser(t, env.db, "import-existing@test.com", "password123", models.UserRoleUser)
+	createTestUser(t, env.db, "import-one@test.com", "password123", models.UserRoleUser)
+	createTestUser(t, env.db, "import-two@test.com", "password123", models.UserRoleUser)
+	groupAdmin, groupAdminToken := createTestUser(t, env.db, "import-admin@test.com", "password123", models.UserRoleUser)
+
+	resp := performJSONRequest(t, env.app, http.MethodPost, "/api/groups/", map[string]any{"name": "Imports"}, authHeaders(ownerToken))
+	assertStatus(t, resp, http.StatusCreated)
+	groupID := uuid.MustParse(decodeJSONMap(t, resp)["data"].(map[string]any)["id"].(string))
+	for _, m := range []models.GroupMembership{
+		{GroupID: groupID, UserID: existing.ID, Role: models.GroupRoleMember},
+		{GroupID: groupID, UserID: groupAdmin.ID, Role: models.GroupRoleAdmin},
+	} {
+		if err := env.db.Create(&m).Error; err != nil {
+			t.Fatalf("failed adding member: %v", err)
+		}
+	}
+	path := "/api/groups/" + groupID.String() + "/members/import"
+
+	statuses := func(t *testing.T, resp *http.Response) []string {
+		t.Helper()
+		assertStatus(t, resp, http.StatusOK)
+		var out []string
+		for _, row := range decodeJSONMap(t, resp)["data"].(map[string]any)["results"].([]any) {
+			out = append(out, row.(map[string]any)["status"].(string))
+		}
+		return out
+	}
+
+	t.Run("imports CSV and reports every row", func(t *testing.T) {
+		csv := "email,role\nImport-One@test.com,admin\nimport-existing@test.com,member\nnobody@test.com\nimport-two@test.com,boss\n"
+		headers := authHeaders(ownerToken)
+		headers["Content-Type"] = "text/csv"
+		got := statuses(t, performRequest(t, env.app, http.MethodPost, path, strings.NewReader(csv), headers))
+		want := []string{"added", "already_member", "user_not_found", "invalid"}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+
+		var membership models.GroupMembership
+		if err := env.db.Joins("JOIN users ON users.id = group_memberships.user_id").
+			First(&membership, "group_memberships.group_id = ? AND users.email = ?", groupID, "import-one@test.com").Error; err != nil {
+			t.Fatalf("expected the imported member: %v", err)
+		}
+		if membership.Role != models.GroupRoleAdmin {
+			t.Fatalf("expected the admin role from the CSV, got %s", membership.Role)
+		}
+
+		var logged models.AuditLog
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if env.db.Where("action = ? AND user_id = ?", "group.members_import", owner.ID).Limit(1).Find(&logged); logged.ID != uuid.Nil {
+				break
+			}
+		}
+		if logged.Details["added"] != float64(1) || logged.Details["user_not_found"] != float64(1) {
+			t.Fatalf("expected one summarized audit entry, got %+v", logged.Details)
+		}
+	})
+
+	t.Run("imports JSON within the group admin's rights", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, path, map[string]any{"members": []map[string]any{
+			{"email": "import-two@test.com", "role": "owner"},
+			{"email": "import-two@test.com"},
+			{"email": "import-two@test.com"},
+		}}, authHeaders(groupAdminToken))
+		want := []string{"invalid", "added", "already_member"}
+		if got := statuses(t, resp); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("requires a group manager", func(t *testing.T) {
+		_, outsiderToken := createTestUser(t, env.db, "import-outsider@test.com", "password123", models.UserRoleUser)
+		resp := performJSONRequest(t, env.app, http.MethodPost, path, map[string]any{"members": []map[string]any{{"email": "import-two@test.com"}}}, authHeaders(outsiderToken))
+		assertStatus(t, resp, http.StatusForbidden)
+		resp = performJSONRequest(t, env.app, http.MethodPost, path, map[string]any{"members": []map[string]any{}}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+}
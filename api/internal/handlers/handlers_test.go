@@ -3,6 +3,9 @@ package handlers
 import (
 	"net/http"
 	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
 )
 
 func TestHealthEndpoint(t *testing.T) {
@@ -35,3 +38,63 @@ func TestVersionEndpoint(t *testing.T) {
 		t.Fatalf("expected apiVersion v1, got %v", data["apiVersion"])
 	}
 }
+
+func TestCapabilities(t *testing.T) {
+	env := setupTestEnv(t)
+	_, adminToken := createTestUser(t, env.db, "capabilities-admin@test.com", "password123", models.UserRoleAdmin)
+
+	capabilitiesOf := func() map[string]any {
+		t.Helper()
+		resp := performRequest(t, env.app, http.MethodGet, "/api/version", nil, nil)
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		return body["data"].(map[string]any)["capabilities"].(map[string]any)
+	}
+
+	caps := capabilitiesOf()
+	uploads := caps["uploads"].(map[string]any)
+	if uploads["maxBytes"] != float64(100*1024*1024) || uploads["presigned"] != true {
+		t.Fatalf("expected the configured upload limit, got %v", uploads)
+	}
+	previews := caps["previews"].(map[string]any)
+	if office := previews["officeExtensions"].([]any); len(office) != 0 {
+		t.Fatalf("expected no office previews without a converter, got %v", office)
+	}
+	if caps["registration"] != "open" || caps["publicSharing"] != true {
+		t.Fatalf("expected the default settings, got %v", caps)
+	}
+
+	putSettings(t, env, adminToken, map[string]any{
+		services.SettingPublicSharing:    false,
+		services.SettingUploadMaxSizeMB:  5,
+		services.SettingRegistrationMode: services.RegistrationClosed,
+	})
+	caps = capabilitiesOf()
+	if caps["registration"] != "closed" || caps["publicSharing"] != false || caps["uploads"].(map[string]any)["maxBytes"] != float64(5*1024*1024) {
+		t.Fatalf("expected capabilities to follow the settings, got %v", caps)
+	}
+}
+
+func TestVersionedRoutes(t *testing.T) {
+	env := setupTestEnv(t)
+	_, token := createTestUser(t, env.db, "versioned@test.com", "password123", models.UserRoleUser)
+
+	resp := performRequest(t, env.app, http.MethodGet, "/api/v1/auth/me", nil, authHeaders(token))
+	assertStatus(t, resp, http.StatusOK)
+	if resp.Header.Get("Deprecation") != "" {
+		t.Fatal("expected versioned paths not to be deprecated")
+	}
+
+	resp = performRequest(t, env.app, http.MethodGet, "/api/auth/me", nil, authHeaders(token))
+	assertStatus(t, resp, http.StatusOK)
+	if resp.Header.Get("Deprecation") == "" || resp.Header.Get("Link") != `</api/v1/auth/me>; rel="successor-version"` {
+		t.Fatalf("expected legacy paths to point at their successor, got %v", resp.Header)
+	}
+
+	resp = performRequest(t, env.app, http.MethodGet, "/api/v1/version", nil, nil)
+	body := decodeJSONMap(t, resp)
+	assertStatus(t, resp, http.StatusOK)
+	if versions, _ := body["data"].(map[string]any)["supportedVersions"].([]any); len(versions) != 1 || versions[0] != "v1" {
+		t.Fatalf("expected v1 to be listed as supported, got %v", body["data"])
+	}
+}
@@ -1,10 +1,18 @@
 package handlers
 
 import (
+	"errors"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/docshare/api/internal/i18n"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 func parseUUID(value string) (uuid.UUID, error) {
@@ -30,8 +38,89 @@ func isValidShareType(value string) bool {
 }
 
 func getRequestID(c *fiber.Ctx) string {
-	if rid, ok := c.Locals("requestID").(string); ok {
-		return rid
+	return utils.RequestID(c)
+}
+
+// truncate shortens client-supplied text to fit its column without splitting
+// a UTF-8 sequence.
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	for max > 0 && !utf8.RuneStart(value[max]) {
+		max--
+	}
+	return value[:max]
+}
+
+// requestLocale picks the locale for user-facing messages: the lang query
+// parameter, then the user's saved preference, then Accept-Language. The
+// choice is echoed in Content-Language.
+func requestLocale(c *fiber.Ctx, user *models.User) string {
+	preferred := []string{c.Query("lang")}
+	if user != nil {
+		preferred = append(preferred, user.Locale)
+	}
+	locale := i18n.Negotiate(c.Get(fiber.HeaderAcceptLanguage), preferred...)
+	c.Set(fiber.HeaderContentLanguage, locale)
+	return locale
+}
+
+// findCreatedAtKeyset loads one cursor page of query ordered by created_at
+// and id in the given direction. key extracts the sort key from a row so the
+// next cursor can be built from the last item on the page.
+func findCreatedAtKeyset[T any](c *fiber.Ctx, query *gorm.DB, direction string, limit int, key func(T) (time.Time, uuid.UUID)) ([]T, string, error) {
+	cur, err := utils.DecodeCursor(c.Query("cursor"))
+	if err != nil {
+		return nil, "", err
+	}
+	query, err = utils.ApplyTimeCursor(query, "created_at", direction, cur)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var rows []T
+	if err := query.Order("created_at " + direction).
+		Order("id " + direction).
+		Limit(limit + 1).
+		Find(&rows).Error; err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(rows) > limit {
+		rows = rows[:limit]
+		at, id := key(rows[len(rows)-1])
+		nextCursor = utils.TimeCursor(at, id)
+	}
+	return rows, nextCursor, nil
+}
+
+// loadTargetFolder loads the folder named by rawID that currentUser wants
+// to add files to, or returns nil when rawID is empty.
+func loadTargetFolder(c *fiber.Ctx, db *gorm.DB, access *services.AccessService, currentUser *models.User, rawID *string) (*models.File, *utils.APIError) {
+	if rawID == nil || strings.TrimSpace(*rawID) == "" {
+		return nil, nil
+	}
+	targetID, err := parseUUID(strings.TrimSpace(*rawID))
+	if err != nil {
+		return nil, errInvalidParentID
+	}
+	var folder models.File
+	if err := db.First(&folder, "id = ?", targetID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errParentNotFound
+		}
+		return nil, errLoadingFile
+	}
+	if !folder.IsDirectory {
+		return nil, errParentNotDirectory
+	}
+	if !access.HasAccess(c.Context(), currentUser.ID, folder.ID, models.SharePermissionEdit) {
+		return nil, errAccessDenied
+	}
+	if folder.VaultID != nil {
+		return nil, errVaultContent
 	}
-	return ""
+	return &folder, nil
 }
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// HMACKeyHandler manages request signing keys, the alternative to API
+// tokens for integrations that should not hold a bearer credential.
+type HMACKeyHandler struct {
+	DB    *gorm.DB
+	Keys  *services.HMACKeys
+	Audit *services.AuditService
+}
+
+func NewHMACKeyHandler(db *gorm.DB, keys *services.HMACKeys, audit *services.AuditService) *HMACKeyHandler {
+	return &HMACKeyHandler{DB: db, Keys: keys, Audit: audit}
+}
+
+type createHMACKeyResponse struct {
+	Secret string         `json:"secret"`
+	Key    models.HMACKey `json:"key"`
+}
+
+func (h *HMACKeyHandler) Create(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	var req createTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	if req.Name == "" {
+		return utils.Error(c, fiber.StatusBadRequest, "name is required")
+	}
+	if len(req.Name) > 255 {
+		return utils.Error(c, fiber.StatusBadRequest, "name must be 255 characters or less")
+	}
+	expiresAt, ok := parseCredentialExpiry(req.ExpiresIn)
+	if !ok {
+		return utils.Error(c, fiber.StatusBadRequest, "expiresIn must be 30d, 90d, 365d, or never")
+	}
+
+	key, secret, err := h.Keys.Create(c.Context(), currentUser.ID, req.Name, expiresAt)
+	if err != nil {
+		if errors.Is(err, services.ErrHMACKeyLimit) {
+			return utils.Error(c, fiber.StatusBadRequest, err.Error())
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed to create signing key")
+	}
+
+	logger.Info("hmac_key_created", map[string]interface{}{
+		"user_id": currentUser.ID.String(),
+		"key_id":  key.KeyID,
+		"name":    key.Name,
+	})
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "hmac_key.create",
+		ResourceType: "hmac_key",
+		ResourceID:   &key.ID,
+		Details: map[string]interface{}{
+			"name":   key.Name,
+			"key_id": key.KeyID,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+
+	// The secret is returned once; only its encrypted form is kept.
+	return utils.Success(c, fiber.StatusCreated, createHMACKeyResponse{Secret: secret, Key: *key})
+}
+
+func (h *HMACKeyHandler) List(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	p := utils.ParsePagination(c)
+	baseQuery := h.DB.Model(&models.HMACKey{}).Where("user_id = ?", currentUser.ID)
+
+	var total int64
+	if err := baseQuery.Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed to count signing keys")
+	}
+	var keys []models.HMACKey
+	if err := utils.ApplyPagination(baseQuery.Order("created_at DESC"), p).Find(&keys).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed to list signing keys")
+	}
+	return utils.Paginated(c, keys, p.Page, p.Limit, total)
+}
+
+func (h *HMACKeyHandler) Revoke(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, "invalid signing key ID")
+	}
+	key, err := h.Keys.Revoke(c.Context(), currentUser.ID, id)
+	if err != nil {
+		if errors.Is(err, services.ErrHMACKeyNotFound) {
+			return utils.Error(c, fiber.StatusNotFound, "signing key not found")
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed to revoke signing key")
+	}
+
+	logger.Info("hmac_key_revoked", map[string]interface{}{
+		"user_id": currentUser.ID.String(),
+		"key_id":  key.KeyID,
+		"name":    key.Name,
+	})
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "hmac_key.revoke",
+		ResourceType: "hmac_key",
+		ResourceID:   &key.ID,
+		Details: map[string]interface{}{
+			"name":   key.Name,
+			"key_id": key.KeyID,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "signing key revoked"})
+}
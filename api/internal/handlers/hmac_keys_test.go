@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/google/uuid"
+)
+
+func signedHeaders(keyID, secret, method, uri string, body []byte) map[string]string {
+	sum := sha256.Sum256(body)
+	req := services.SignedRequest{
+		KeyID:         keyID,
+		Timestamp:     strconv.FormatInt(time.Now().Unix(), 10),
+		Nonce:         uuid.NewString(),
+		Method:        method,
+		URI:           uri,
+		ContentSHA256: hex.EncodeToString(sum[:]),
+	}
+	return map[string]string{
+		"Authorization":              fmt.Sprintf("%s KeyId=%s, Timestamp=%s, Nonce=%s, Signature=%s", services.HMACScheme, req.KeyID, req.Timestamp, req.Nonce, services.SignRequest(secret, req)),
+		services.ContentSHA256Header: req.ContentSHA256,
+	}
+}
+
+func TestHMACKeys(t *testing.T) {
+	env := setupTestEnv(t)
+	user, token := createTestUser(t, env.db, "hmac@test.com", "password123", models.UserRoleUser)
+
+	resp := performJSONRequest(t, env.app, http.MethodPost, "/api/auth/hmac-keys", map[string]any{"name": "billing sync", "expiresIn": "90d"}, authHeaders(token))
+	assertStatus(t, resp, http.StatusCreated)
+	data := decodeJSONMap(t, resp)["data"].(map[string]any)
+	secret := data["secret"].(string)
+	key := data["key"].(map[string]any)
+	keyID := key["keyID"].(string)
+	if _, leaked := key["secret"]; leaked || key["expiresAt"] == nil {
+		t.Fatalf("unexpected key %v", key)
+	}
+
+	t.Run("signed requests authenticate as the key's owner", func(t *testing.T) {
+		headers := signedHeaders(keyID, secret, http.MethodGet, "/api/auth/me", nil)
+		resp := performRequest(t, env.app, http.MethodGet, "/api/auth/me", nil, headers)
+		assertStatus(t, resp, http.StatusOK)
+		if got := decodeJSONMap(t, resp)["data"].(map[string]any)["id"]; got != user.ID.String() {
+			t.Fatalf("expected %s, got %v", user.ID, got)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/auth/me", nil, headers)
+		assertStatus(t, resp, http.StatusUnauthorized)
+		if code := decodeJSONMap(t, resp)["code"]; code != "signature_replayed" {
+			t.Fatalf("expected signature_replayed, got %v", code)
+		}
+	})
+
+	t.Run("versioned paths are signed as sent", func(t *testing.T) {
+		headers := signedHeaders(keyID, secret, http.MethodGet, "/api/v1/auth/me?fields=id", nil)
+		resp := performRequest(t, env.app, http.MethodGet, "/api/v1/auth/me?fields=id", nil, headers)
+		assertStatus(t, resp, http.StatusOK)
+
+		// The rewritten path is not what the client signed.
+		headers = signedHeaders(keyID, secret, http.MethodGet, "/api/auth/me", nil)
+		resp = performRequest(t, env.app, http.MethodGet, "/api/v1/auth/me", nil, headers)
+		assertStatus(t, resp, http.StatusUnauthorized)
+	})
+
+	t.Run("the signature covers the path and body", func(t *testing.T) {
+		headers := signedHeaders(keyID, secret, http.MethodGet, "/api/auth/me", nil)
+		resp := performRequest(t, env.app, http.MethodGet, "/api/auth/tokens", nil, headers)
+		assertStatus(t, resp, http.StatusUnauthorized)
+
+		body := []byte(`{"name":"second"}`)
+		headers = signedHeaders(keyID, secret, http.MethodPost, "/api/auth/hmac-keys", body)
+		headers["Content-Type"] = "application/json"
+		resp = performRequest(t, env.app, http.MethodPost, "/api/auth/hmac-keys", bytes.NewReader([]byte(`{"name":"forged"}`)), headers)
+		assertStatus(t, resp, http.StatusUnauthorized)
+
+		headers = signedHeaders(keyID, secret, http.MethodPost, "/api/auth/hmac-keys", body)
+		headers["Content-Type"] = "application/json"
+		resp = performRequest(t, env.app, http.MethodPost, "/api/auth/hmac-keys", bytes.NewReader(body), headers)
+		assertStatus(t, resp, http.StatusCreated)
+	})
+
+	t.Run("uploads are checked against the signed hash", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodPost, "/api/tus/", nil, map[string]string{
+			"Authorization":   "Bearer " + token,
+			"Tus-Resumable":   "1.0.0",
+			"Upload-Length":   "5",
+			"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("notes.txt")),
+		})
+		assertStatus(t, resp, http.StatusCreated)
+		location := resp.Header.Get("Location")
+
+		patch := func(signed, sent string) *http.Response {
+			headers := signedHeaders(keyID, secret, http.MethodPatch, location, []byte(signed))
+			headers["Tus-Resumable"] = "1.0.0"
+			headers["Content-Type"] = "application/offset+octet-stream"
+			headers["Upload-Offset"] = "0"
+			return performRequest(t, env.app, http.MethodPatch, location, strings.NewReader(sent), headers)
+		}
+		assertStatus(t, patch("hello", "jello"), http.StatusUnauthorized)
+		resp = patch("hello", "hello")
+		assertStatus(t, resp, http.StatusNoContent)
+		if resp.Header.Get("X-File-ID") == "" {
+			t.Fatal("expected the signed upload to become a file")
+		}
+	})
+
+	t.Run("revoked keys stop working", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodDelete, "/api/auth/hmac-keys/"+key["id"].(string), nil, authHeaders(token))
+		assertStatus(t, resp, http.StatusOK)
+		resp = performRequest(t, env.app, http.MethodGet, "/api/auth/me", nil, signedHeaders(keyID, secret, http.MethodGet, "/api/auth/me", nil))
+		assertStatus(t, resp, http.StatusUnauthorized)
+		if code := decodeJSONMap(t, resp)["code"]; code != "invalid_signature" {
+			t.Fatalf("expected invalid_signature, got %v", code)
+		}
+	})
+}
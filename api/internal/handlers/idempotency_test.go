@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	env := setupTestEnv(t)
+	sender, token := createTestUser(t, env.db, "idem-sender@test.com", "password123", models.UserRoleUser)
+	_, otherToken := createTestUser(t, env.db, "idem-other@test.com", "password123", models.UserRoleUser)
+
+	createTransfer := func(token, key string) *http.Response {
+		headers := authHeaders(token)
+		if key != "" {
+			headers["Idempotency-Key"] = key
+		}
+		return performJSONRequest(t, env.app, http.MethodPost, "/api/transfers", map[string]any{
+			"fileName": "report.pdf",
+			"fileSize": 1024,
+		}, headers)
+	}
+	transferCode := func(resp *http.Response) string {
+		t.Helper()
+		assertStatus(t, resp, http.StatusCreated)
+		return decodeJSONMap(t, resp)["data"].(map[string]any)["code"].(string)
+	}
+	countTransfers := func() int64 {
+		var count int64
+		env.db.Model(&models.Transfer{}).Where("sender_id = ?", sender.ID).Count(&count)
+		return count
+	}
+
+	t.Run("a retried request is replayed", func(t *testing.T) {
+		first := createTransfer(token, "retry-1")
+		code := transferCode(first)
+
+		again := createTransfer(token, "retry-1")
+		if again.Header.Get("Idempotent-Replayed") != "true" {
+			t.Fatalf("expected the replay header, got %v", again.Header)
+		}
+		if replayed := transferCode(again); replayed != code {
+			t.Fatalf("expected the original code %s, got %s", code, replayed)
+		}
+		if n := countTransfers(); n != 1 {
+			t.Fatalf("expected one transfer, got %d", n)
+		}
+	})
+
+	t.Run("keys are per user", func(t *testing.T) {
+		resp := createTransfer(otherToken, "retry-1")
+		if resp.Header.Get("Idempotent-Replayed") != "" {
+			t.Fatal("expected another user's key to be independent")
+		}
+		transferCode(resp)
+	})
+
+	t.Run("requests without a key always run", func(t *testing.T) {
+		before := countTransfers()
+		transferCode(createTransfer(token, ""))
+		transferCode(createTransfer(token, ""))
+		if n := countTransfers(); n != before+2 {
+			t.Fatalf("expected two more transfers, got %d", n-before)
+		}
+	})
+
+	t.Run("failed requests are not stored", func(t *testing.T) {
+		headers := authHeaders(token)
+		headers["Idempotency-Key"] = "retry-2"
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/transfers", map[string]any{"fileName": "report.pdf"}, headers)
+		assertStatus(t, resp, http.StatusBadRequest)
+
+		transferCode(createTransfer(token, "retry-2"))
+	})
+
+	t.Run("shares record the key and are created once", func(t *testing.T) {
+		folder := performJSONRequest(t, env.app, http.MethodPost, "/api/files/directory", map[string]any{"name": "Idem"}, authHeaders(token))
+		assertStatus(t, folder, http.StatusCreated)
+		folderID := decodeJSONMap(t, folder)["data"].(map[string]any)["id"].(string)
+		other, _ := createTestUser(t, env.db, "idem-recipient@test.com", "password123", models.UserRoleUser)
+
+		headers := authHeaders(token)
+		headers["Idempotency-Key"] = "share-1"
+		for i := 0; i < 2; i++ {
+			resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+folderID+"/share", map[string]any{
+				"userID":     other.ID.String(),
+				"permission": "view",
+			}, headers)
+			assertStatus(t, resp, http.StatusCreated)
+		}
+
+		var events []models.OutboxEvent
+		env.db.Where("event_type = ?", "share.create").Find(&events)
+		if len(events) != 1 || events[0].Payload["idempotency_key"] != "share-1" {
+			t.Fatalf("expected one share.create carrying the key, got %+v", events)
+		}
+	})
+
+	t.Run("reusing a key with a different payload is refused", func(t *testing.T) {
+		headers := authHeaders(token)
+		headers["Idempotency-Key"] = "retry-1"
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/transfers", map[string]any{
+			"fileName": "other.pdf",
+			"fileSize": 1024,
+		}, headers)
+		assertStatus(t, resp, http.StatusUnprocessableEntity)
+		if code := decodeJSONMap(t, resp)["code"]; code != "idempotency_key_reused" {
+			t.Fatalf("expected idempotency_key_reused, got %v", code)
+		}
+	})
+
+	t.Run("keys are per route", func(t *testing.T) {
+		headers := authHeaders(token)
+		headers["Idempotency-Key"] = "retry-1"
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/directory", map[string]any{"name": "Per route"}, headers)
+		assertStatus(t, resp, http.StatusCreated)
+		if resp.Header.Get("Idempotent-Replayed") != "" {
+			t.Fatal("expected the key to be independent on another route")
+		}
+	})
+
+	t.Run("updates are replayed", func(t *testing.T) {
+		group := performJSONRequest(t, env.app, http.MethodPost, "/api/groups", map[string]any{"name": "Idem group"}, authHeaders(token))
+		assertStatus(t, group, http.StatusCreated)
+		groupID := decodeJSONMap(t, group)["data"].(map[string]any)["id"].(string)
+
+		headers := authHeaders(token)
+		headers["Idempotency-Key"] = "rename-1"
+		first := performJSONRequest(t, env.app, http.MethodPut, "/api/groups/"+groupID, map[string]any{"name": "Renamed"}, headers)
+		assertStatus(t, first, http.StatusOK)
+		again := performJSONRequest(t, env.app, http.MethodPut, "/api/groups/"+groupID, map[string]any{"name": "Renamed"}, headers)
+		assertStatus(t, again, http.StatusOK)
+		if again.Header.Get("Idempotent-Replayed") != "true" {
+			t.Fatalf("expected the update to be replayed, got %v", again.Header)
+		}
+	})
+
+	t.Run("a malformed key is rejected", func(t *testing.T) {
+		resp := createTransfer(token, "bad\tkey")
+		assertStatus(t, resp, http.StatusBadRequest)
+		if code := decodeJSONMap(t, resp)["code"]; code != "invalid_idempotency_key" {
+			t.Fatalf("expected invalid_idempotency_key, got %v", code)
+		}
+	})
+}
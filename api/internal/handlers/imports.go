@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var errImportOwnerNotFound = utils.NewError(fiber.StatusBadRequest, "import_owner_not_found", "import owner not found")
+
+// ImportsHandler lets platform admins bring existing buckets and
+// directories into DocShare.
+type ImportsHandler struct {
+	DB       *gorm.DB
+	Importer *services.Importer
+	Audit    *services.AuditService
+}
+
+func NewImportsHandler(db *gorm.DB, importer *services.Importer, audit *services.AuditService) *ImportsHandler {
+	return &ImportsHandler{DB: db, Importer: importer, Audit: audit}
+}
+
+type startImportRequest struct {
+	Source struct {
+		Type   string `json:"type"`
+		Bucket string `json:"bucket"`
+		Prefix string `json:"prefix"`
+		Path   string `json:"path"`
+	} `json:"source"`
+	TargetFolder string `json:"targetFolder"`
+	DefaultOwner string `json:"defaultOwner"`
+	Rules        []struct {
+		Prefix string `json:"prefix"`
+		Owner  string `json:"owner"`
+	} `json:"rules"`
+}
+
+// Start queues an import. Owners are given by email and resolved here so
+// a typo fails the request rather than the run.
+func (h *ImportsHandler) Start(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	var req startImportRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+
+	importReq := services.ImportRequest{TargetFolder: req.TargetFolder}
+	switch models.ImportSourceType(req.Source.Type) {
+	case models.ImportSourceS3:
+		importReq.SourceType = models.ImportSourceS3
+		importReq.Source = strings.TrimSpace(req.Source.Bucket)
+		importReq.Prefix = req.Source.Prefix
+		if importReq.Source == "" {
+			return utils.Error(c, fiber.StatusBadRequest, "source.bucket is required")
+		}
+	case models.ImportSourceFilesystem:
+		importReq.SourceType = models.ImportSourceFilesystem
+		importReq.Source = strings.TrimSpace(req.Source.Path)
+		if importReq.Source == "" {
+			return utils.Error(c, fiber.StatusBadRequest, "source.path is required")
+		}
+	default:
+		return utils.Error(c, fiber.StatusBadRequest, "source.type must be s3 or filesystem")
+	}
+	if strings.ContainsAny(req.TargetFolder, "/\\") {
+		return utils.Error(c, fiber.StatusBadRequest, "targetFolder must be a single folder name")
+	}
+
+	owners := map[string]uuid.UUID{}
+	resolve := func(email string) (uuid.UUID, error) {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if id, ok := owners[email]; ok {
+			return id, nil
+		}
+		var user models.User
+		if err := h.DB.Select("id").First(&user, "LOWER(email) = ?", email).Error; err != nil {
+			return uuid.Nil, err
+		}
+		owners[email] = user.ID
+		return user.ID, nil
+	}
+	ownerError := func(err error) error {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Fail(c, errImportOwnerNotFound)
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed resolving import owners")
+	}
+
+	if strings.TrimSpace(req.DefaultOwner) == "" {
+		importReq.DefaultOwnerID = currentUser.ID
+	} else {
+		id, err := resolve(req.DefaultOwner)
+		if err != nil {
+			return ownerError(err)
+		}
+		importReq.DefaultOwnerID = id
+	}
+	for _, rule := range req.Rules {
+		if strings.Trim(rule.Prefix, "/") == "" {
+			return utils.Error(c, fiber.StatusBadRequest, "each rule needs a prefix")
+		}
+		id, err := resolve(rule.Owner)
+		if err != nil {
+			return ownerError(err)
+		}
+		importReq.OwnerRules = append(importReq.OwnerRules, models.ImportOwnerRule{Prefix: rule.Prefix, OwnerID: id})
+	}
+
+	job, err := h.Importer.Start(c.Context(), currentUser.ID, importReq)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "import_failed", "failed starting import")))
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "admin.import_start",
+		ResourceType: "import",
+		ResourceID:   &job.ID,
+		Details: map[string]interface{}{
+			"source_type":   string(job.SourceType),
+			"source":        job.Source,
+			"prefix":        job.Prefix,
+			"target_folder": job.TargetFolder,
+			"owner_rules":   len(job.OwnerRules),
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusAccepted, job)
+}
+
+// List returns imports, newest first, without their failure lists.
+func (h *ImportsHandler) List(c *fiber.Ctx) error {
+	p := utils.ParsePagination(c)
+	query := h.DB.Model(&models.ImportJob{}).Session(&gorm.Session{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting imports")
+	}
+	var imports []models.ImportJob
+	if err := utils.ApplyPagination(query.Omit("failures").Order("created_at DESC, id DESC"), p).Find(&imports).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing imports")
+	}
+	return utils.Paginated(c, imports, p.Page, p.Limit, total)
+}
+
+func (h *ImportsHandler) Get(c *fiber.Ctx) error {
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidImportID)
+	}
+	job, err := h.Importer.Get(c.Context(), id)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "import_load_failed", "failed loading import")))
+	}
+	return utils.Success(c, fiber.StatusOK, job)
+}
+
+// Cancel stops a pending or running import. It can be resumed later.
+func (h *ImportsHandler) Cancel(c *fiber.Ctx) error {
+	return h.transition(c, "admin.import_cancel", h.Importer.Cancel)
+}
+
+// Resume queues a failed or cancelled import again from where it stopped.
+func (h *ImportsHandler) Resume(c *fiber.Ctx) error {
+	return h.transition(c, "admin.import_resume", h.Importer.Resume)
+}
+
+func (h *ImportsHandler) transition(c *fiber.Ctx, action string, apply func(ctx context.Context, id uuid.UUID) (*models.ImportJob, error)) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidImportID)
+	}
+	job, err := apply(c.Context(), id)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "import_update_failed", "failed updating import")))
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       action,
+		ResourceType: "import",
+		ResourceID:   &job.ID,
+		Details:      map[string]interface{}{"cursor": job.Cursor},
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+	return utils.Success(c, fiber.StatusOK, job)
+}
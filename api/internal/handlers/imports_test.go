@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestImportEndpoints(t *testing.T) {
+	env := setupTestEnv(t)
+	admin, adminToken := createTestUser(t, env.db, "import-admin@test.com", "password123", models.UserRoleAdmin)
+	owner, userToken := createTestUser(t, env.db, "import-owner@test.com", "password123", models.UserRoleUser)
+
+	start := func(payload map[string]any, token string) *http.Response {
+		return performJSONRequest(t, env.app, http.MethodPost, "/api/admin/imports", payload, authHeaders(token))
+	}
+	bucket := map[string]any{"type": "s3", "bucket": "legacy", "prefix": "/shared/"}
+
+	t.Run("admin only", func(t *testing.T) {
+		assertStatus(t, start(map[string]any{"source": bucket}, userToken), http.StatusForbidden)
+	})
+
+	t.Run("validates the request", func(t *testing.T) {
+		assertStatus(t, start(map[string]any{"source": map[string]any{"type": "ftp"}}, adminToken), http.StatusBadRequest)
+		assertStatus(t, start(map[string]any{"source": map[string]any{"type": "s3"}}, adminToken), http.StatusBadRequest)
+
+		resp := start(map[string]any{"source": bucket, "defaultOwner": "nobody@test.com"}, adminToken)
+		assertStatus(t, resp, http.StatusBadRequest)
+		if code := decodeJSONMap(t, resp)["code"]; code != "import_owner_not_found" {
+			t.Fatalf("expected import_owner_not_found, got %v", code)
+		}
+
+		resp = start(map[string]any{"source": map[string]any{"type": "filesystem", "path": t.TempDir()}}, adminToken)
+		assertStatus(t, resp, http.StatusForbidden)
+		if code := decodeJSONMap(t, resp)["code"]; code != "import_path_not_allowed" {
+			t.Fatalf("expected import_path_not_allowed, got %v", code)
+		}
+	})
+
+	var importID string
+	t.Run("queues an import", func(t *testing.T) {
+		resp := start(map[string]any{
+			"source": bucket,
+			"rules":  []map[string]any{{"prefix": "finance", "owner": "IMPORT-OWNER@test.com"}},
+		}, adminToken)
+		assertStatus(t, resp, http.StatusAccepted)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		if data["status"] != "pending" || data["prefix"] != "shared/" || data["targetFolder"] != "Imported" || data["defaultOwnerID"] != admin.ID.String() {
+			t.Fatalf("unexpected import %v", data)
+		}
+		rules := data["ownerRules"].([]any)
+		if len(rules) != 1 || rules[0].(map[string]any)["ownerID"] != owner.ID.String() {
+			t.Fatalf("unexpected rules %v", rules)
+		}
+		importID = data["id"].(string)
+
+		var jobs int64
+		env.db.Model(&models.Job{}).Where("kind = ?", "import.run").Count(&jobs)
+		if jobs != 1 {
+			t.Fatalf("expected the import queued, got %d jobs", jobs)
+		}
+	})
+
+	t.Run("cancel and resume", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/imports/"+importID+"/resume", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusConflict)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/admin/imports/"+importID+"/cancel", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		if status := decodeJSONMap(t, resp)["data"].(map[string]any)["status"]; status != "cancelled" {
+			t.Fatalf("expected cancelled, got %v", status)
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/admin/imports/"+importID+"/resume", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+	})
+
+	t.Run("lists and loads imports", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodGet, "/api/admin/imports?status=pending", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		if data := decodeJSONMap(t, resp)["data"].([]any); len(data) != 1 {
+			t.Fatalf("expected one import, got %v", data)
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodGet, "/api/admin/imports/"+importID, nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performJSONRequest(t, env.app, http.MethodGet, "/api/admin/imports/"+models.File{}.ID.String(), nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusNotFound)
+	})
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	errInvalidConnectionID = utils.NewError(fiber.StatusBadRequest, "invalid_connection_id", "invalid connection id")
+	errImportInProgress    = utils.NewError(fiber.StatusConflict, "import_in_progress", "you already have an import in progress")
+)
+
+// IntegrationsHandler is the import wizard: users connect Google Drive or a
+// WebDAV server such as Nextcloud, pick a folder and copy it into their own
+// files. Each user has at most one import running at a time.
+type IntegrationsHandler struct {
+	DB           *gorm.DB
+	Cfg          *config.Config
+	Integrations *services.Integrations
+	Importer     *services.Importer
+	Audit        *services.AuditService
+}
+
+func NewIntegrationsHandler(db *gorm.DB, cfg *config.Config, integrations *services.Integrations, importer *services.Importer, audit *services.AuditService) *IntegrationsHandler {
+	return &IntegrationsHandler{DB: db, Cfg: cfg, Integrations: integrations, Importer: importer, Audit: audit}
+}
+
+// Connections lists the caller's connections and which providers can be
+// connected.
+func (h *IntegrationsHandler) Connections(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	conns, err := h.Integrations.Connections(c.Context(), currentUser.ID)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing connections")
+	}
+	return utils.Success(c, fiber.StatusOK, fiber.Map{
+		"connections": conns,
+		"providers": fiber.Map{
+			string(models.IntegrationGoogleDrive): h.Integrations.GoogleDriveEnabled(),
+			string(models.IntegrationWebDAV):      true,
+		},
+	})
+}
+
+// ConnectGoogle returns the Google consent URL the browser should open.
+func (h *IntegrationsHandler) ConnectGoogle(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	authURL, err := h.Integrations.GoogleAuthURL(currentUser.ID)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "integration_connect_failed", "failed starting authorization")))
+	}
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"url": authURL})
+}
+
+// GoogleCallback is where Google sends the browser back. It is not behind
+// authentication; the signed state says whose connection this is. The
+// browser is redirected to the frontend either way.
+func (h *IntegrationsHandler) GoogleCallback(c *fiber.Ctx) error {
+	target := strings.TrimRight(h.Cfg.Server.FrontendURL, "/") + "/settings/integrations"
+	if denied := c.Query("error"); denied != "" {
+		return c.Redirect(target + "?error=" + url.QueryEscape(denied))
+	}
+
+	conn, err := h.Integrations.ConnectGoogleDrive(c.Context(), c.Query("state"), c.Query("code"))
+	if err != nil {
+		logger.Warn("integration_connect_failed", map[string]interface{}{
+			"provider": string(models.IntegrationGoogleDrive),
+			"error":    err.Error(),
+		})
+		apiErr := serviceError(err, utils.NewError(fiber.StatusInternalServerError, "integration_connect_failed", "failed connecting Google Drive"))
+		return c.Redirect(target + "?error=" + url.QueryEscape(apiErr.Code))
+	}
+
+	h.logConnection(c, conn.UserID, "integration.connect", conn)
+	return c.Redirect(target + "?connected=" + string(conn.Provider))
+}
+
+type connectWebDAVRequest struct {
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// ConnectWebDAV checks and stores WebDAV credentials. Nextcloud users
+// should give an app password.
+func (h *IntegrationsHandler) ConnectWebDAV(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	var req connectWebDAVRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	if strings.TrimSpace(req.URL) == "" || req.Username == "" || req.Password == "" {
+		return utils.Error(c, fiber.StatusBadRequest, "url, username and password are required")
+	}
+
+	conn, err := h.Integrations.ConnectWebDAV(c.Context(), currentUser.ID, req.URL, req.Username, req.Password)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "integration_connect_failed", "failed connecting WebDAV server")))
+	}
+	h.logConnection(c, currentUser.ID, "integration.connect", conn)
+	return utils.Success(c, fiber.StatusCreated, conn)
+}
+
+func (h *IntegrationsHandler) Disconnect(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidConnectionID)
+	}
+	conn, err := h.Integrations.Disconnect(c.Context(), currentUser.ID, id)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "integration_disconnect_failed", "failed removing connection")))
+	}
+	h.logConnection(c, currentUser.ID, "integration.disconnect", conn)
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "connection removed"})
+}
+
+func (h *IntegrationsHandler) logConnection(c *fiber.Ctx, userID uuid.UUID, action string, conn *models.IntegrationConnection) {
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &userID,
+		Action:       action,
+		ResourceType: "integration",
+		ResourceID:   &conn.ID,
+		Details: map[string]interface{}{
+			"provider": string(conn.Provider),
+			"account":  conn.Account,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+}
+
+// Browse lists a folder of a connection: ?folder= takes an entry's id, and
+// is the root when empty.
+func (h *IntegrationsHandler) Browse(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidConnectionID)
+	}
+	conn, err := h.Integrations.Connection(c.Context(), currentUser.ID, id)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "integration_load_failed", "failed loading connection")))
+	}
+	entries, err := h.Integrations.Browse(c.Context(), conn, c.Query("folder"))
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "integration_browse_failed", "failed listing remote folder")))
+	}
+	return utils.Success(c, fiber.StatusOK, entries)
+}
+
+type startRemoteImportRequest struct {
+	ConnectionID string `json:"connectionID"`
+	Folder       string `json:"folder"`
+	TargetFolder string `json:"targetFolder"`
+	Conflict     string `json:"conflict"`
+}
+
+// Start queues a copy of a remote folder into the caller's files.
+func (h *IntegrationsHandler) Start(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	var req startRemoteImportRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	connID, err := parseUUID(req.ConnectionID)
+	if err != nil {
+		return utils.Fail(c, errInvalidConnectionID)
+	}
+	if strings.ContainsAny(req.TargetFolder, "/\\") {
+		return utils.Error(c, fiber.StatusBadRequest, "targetFolder must be a single folder name")
+	}
+	conflict := models.ImportConflict(req.Conflict)
+	if conflict != "" && conflict != models.ImportConflictSkip && conflict != models.ImportConflictRename {
+		return utils.Error(c, fiber.StatusBadRequest, "conflict must be skip or rename")
+	}
+
+	conn, err := h.Integrations.Connection(c.Context(), currentUser.ID, connID)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "integration_load_failed", "failed loading connection")))
+	}
+	var active int64
+	if err := h.DB.Model(&models.ImportJob{}).
+		Where("requested_by_id = ? AND connection_id IS NOT NULL AND status IN ?", currentUser.ID, []models.ImportStatus{models.ImportStatusPending, models.ImportStatusRunning}).
+		Count(&active).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed checking imports")
+	}
+	if active > 0 {
+		return utils.Fail(c, errImportInProgress)
+	}
+
+	sourceType := models.ImportSourceWebDAV
+	if conn.Provider == models.IntegrationGoogleDrive {
+		sourceType = models.ImportSourceGoogleDrive
+	}
+	job, err := h.Importer.Start(c.Context(), currentUser.ID, services.ImportRequest{
+		SourceType:     sourceType,
+		Source:         req.Folder,
+		TargetFolder:   req.TargetFolder,
+		DefaultOwnerID: currentUser.ID,
+		ConnectionID:   &conn.ID,
+		Conflict:       conflict,
+	})
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "import_failed", "failed starting import")))
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "integration.import_start",
+		ResourceType: "import",
+		ResourceID:   &job.ID,
+		Details: map[string]interface{}{
+			"provider":      string(conn.Provider),
+			"account":       conn.Account,
+			"folder":        job.Source,
+			"target_folder": job.TargetFolder,
+			"conflict":      string(job.Conflict),
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+	return utils.Success(c, fiber.StatusAccepted, job)
+}
+
+// List returns the caller's remote imports, newest first.
+func (h *IntegrationsHandler) List(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	p := utils.ParsePagination(c)
+	query := h.DB.Model(&models.ImportJob{}).
+		Where("requested_by_id = ? AND connection_id IS NOT NULL", currentUser.ID).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting imports")
+	}
+	var imports []models.ImportJob
+	if err := utils.ApplyPagination(query.Omit("failures").Order("created_at DESC, id DESC"), p).Find(&imports).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing imports")
+	}
+	return utils.Paginated(c, imports, p.Page, p.Limit, total)
+}
+
+func (h *IntegrationsHandler) Get(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	job, apiErr := h.ownImport(c, currentUser.ID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	return utils.Success(c, fiber.StatusOK, job)
+}
+
+func (h *IntegrationsHandler) Cancel(c *fiber.Ctx) error {
+	return h.transition(c, h.Importer.Cancel)
+}
+
+func (h *IntegrationsHandler) Resume(c *fiber.Ctx) error {
+	return h.transition(c, h.Importer.Resume)
+}
+
+func (h *IntegrationsHandler) transition(c *fiber.Ctx, apply func(ctx context.Context, id uuid.UUID) (*models.ImportJob, error)) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	job, apiErr := h.ownImport(c, currentUser.ID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	job, err := apply(c.Context(), job.ID)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "import_update_failed", "failed updating import")))
+	}
+	return utils.Success(c, fiber.StatusOK, job)
+}
+
+// ownImport loads the remote import named in the path if userID started
+// it. Any other import is reported as not found.
+func (h *IntegrationsHandler) ownImport(c *fiber.Ctx, userID uuid.UUID) (*models.ImportJob, *utils.APIError) {
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return nil, errInvalidImportID
+	}
+	job, err := h.Importer.Get(c.Context(), id)
+	if err != nil {
+		return nil, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "import_load_failed", "failed loading import"))
+	}
+	if job.RequestedByID != userID || job.ConnectionID == nil {
+		return nil, errImportNotFound
+	}
+	return job, nil
+}
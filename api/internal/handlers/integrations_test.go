@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"golang.org/x/net/webdav"
+)
+
+func newTestWebDAVServer(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "Documents"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "Documents", "notes.txt"), []byte("notes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dav := &webdav.Handler{FileSystem: webdav.Dir(root), LockSystem: webdav.NewMemLS()}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "dana" || p != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		dav.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestIntegrationsRequirePublicAddresses(t *testing.T) {
+	env := setupTestEnv(t)
+	_, token := createTestUser(t, env.db, "integrations-guard@test.com", "password123", models.UserRoleUser)
+
+	resp := performJSONRequest(t, env.app, http.MethodPost, "/api/integrations/import/webdav/connect", map[string]any{
+		"url": newTestWebDAVServer(t), "username": "dana", "password": "secret",
+	}, authHeaders(token))
+	assertStatus(t, resp, http.StatusBadRequest)
+	if code := decodeJSONMap(t, resp)["code"]; code != "remote_address_not_allowed" {
+		t.Fatalf("expected remote_address_not_allowed, got %v", code)
+	}
+
+	resp = performJSONRequest(t, env.app, http.MethodPost, "/api/integrations/import/google/connect", nil, authHeaders(token))
+	assertStatus(t, resp, http.StatusConflict)
+
+	resp = performRequest(t, env.app, http.MethodGet, "/api/integrations/import/google/callback?state=forged&code=x", nil, nil)
+	assertStatus(t, resp, http.StatusFound)
+	if location := resp.Header.Get("Location"); !strings.Contains(location, "/settings/integrations?error=integration_not_enabled") {
+		t.Fatalf("expected a redirect back with the error, got %s", location)
+	}
+}
+
+func TestIntegrationImportEndpoints(t *testing.T) {
+	env := setupTestEnvWithConfig(t, func(cfg *config.Config) {
+		cfg.Integrations.WebDAVAllowPrivate = true
+	})
+	_, token := createTestUser(t, env.db, "integrations-user@test.com", "password123", models.UserRoleUser)
+	_, otherToken := createTestUser(t, env.db, "integrations-other@test.com", "password123", models.UserRoleUser)
+	serverURL := newTestWebDAVServer(t)
+
+	var connID string
+	t.Run("connects a WebDAV server", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/integrations/import/webdav/connect", map[string]any{
+			"url": serverURL, "username": "dana", "password": "wrong",
+		}, authHeaders(token))
+		assertStatus(t, resp, http.StatusBadGateway)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/integrations/import/webdav/connect", map[string]any{
+			"url": serverURL, "username": "dana", "password": "secret",
+		}, authHeaders(token))
+		assertStatus(t, resp, http.StatusCreated)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		if data["provider"] != "webdav" || data["secret"] != nil {
+			t.Fatalf("unexpected connection %v", data)
+		}
+		connID = data["id"].(string)
+
+		resp = performJSONRequest(t, env.app, http.MethodGet, "/api/integrations/import/connections", nil, authHeaders(token))
+		assertStatus(t, resp, http.StatusOK)
+		data = decodeJSONMap(t, resp)["data"].(map[string]any)
+		if conns := data["connections"].([]any); len(conns) != 1 {
+			t.Fatalf("expected one connection, got %v", conns)
+		}
+	})
+
+	t.Run("browses only your own connections", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodGet, "/api/integrations/import/connections/"+connID+"/browse?folder=Documents", nil, authHeaders(token))
+		assertStatus(t, resp, http.StatusOK)
+		entries := decodeJSONMap(t, resp)["data"].([]any)
+		if len(entries) != 1 || entries[0].(map[string]any)["id"] != "Documents/notes.txt" {
+			t.Fatalf("unexpected listing %v", entries)
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodGet, "/api/integrations/import/connections/"+connID+"/browse", nil, authHeaders(otherToken))
+		assertStatus(t, resp, http.StatusNotFound)
+	})
+
+	var importID string
+	t.Run("queues one import at a time", func(t *testing.T) {
+		payload := map[string]any{"connectionID": connID, "folder": "Documents", "conflict": "rename"}
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/integrations/import", payload, authHeaders(token))
+		assertStatus(t, resp, http.StatusAccepted)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		if data["sourceType"] != "webdav" || data["source"] != "Documents" || data["conflict"] != "rename" || data["status"] != "pending" {
+			t.Fatalf("unexpected import %v", data)
+		}
+		importID = data["id"].(string)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/integrations/import", payload, authHeaders(token))
+		assertStatus(t, resp, http.StatusConflict)
+		if code := decodeJSONMap(t, resp)["code"]; code != "import_in_progress" {
+			t.Fatalf("expected import_in_progress, got %v", code)
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/integrations/import", map[string]any{"connectionID": connID, "conflict": "overwrite"}, authHeaders(token))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+
+	t.Run("tracks your own imports", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodGet, "/api/integrations/import/"+importID, nil, authHeaders(otherToken))
+		assertStatus(t, resp, http.StatusNotFound)
+
+		resp = performJSONRequest(t, env.app, http.MethodGet, "/api/integrations/import", nil, authHeaders(otherToken))
+		assertStatus(t, resp, http.StatusOK)
+		if data := decodeJSONMap(t, resp)["data"].([]any); len(data) != 0 {
+			t.Fatalf("expected no imports for another user, got %v", data)
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodDelete, "/api/integrations/import/connections/"+connID, nil, authHeaders(token))
+		assertStatus(t, resp, http.StatusConflict)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/integrations/import/"+importID+"/cancel", nil, authHeaders(token))
+		assertStatus(t, resp, http.StatusOK)
+		if status := decodeJSONMap(t, resp)["data"].(map[string]any)["status"]; status != "cancelled" {
+			t.Fatalf("expected cancelled, got %v", status)
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodDelete, "/api/integrations/import/connections/"+connID, nil, authHeaders(token))
+		assertStatus(t, resp, http.StatusOK)
+	})
+}
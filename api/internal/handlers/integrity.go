@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// IntegrityHandler lets platform admins look for, and clean up, shares,
+// memberships and activities left pointing at deleted records.
+type IntegrityHandler struct {
+	DB      *gorm.DB
+	Checker *services.IntegrityChecker
+	Audit   *services.AuditService
+}
+
+func NewIntegrityHandler(db *gorm.DB, checker *services.IntegrityChecker, audit *services.AuditService) *IntegrityHandler {
+	return &IntegrityHandler{DB: db, Checker: checker, Audit: audit}
+}
+
+type startIntegrityCheckRequest struct {
+	Repair bool `json:"repair"`
+}
+
+// Start queues a check. It only reports unless repair is set. Only one
+// runs at a time.
+func (h *IntegrityHandler) Start(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	var req startIntegrityCheckRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return utils.Fail(c, errInvalidBody)
+		}
+	}
+
+	check, err := h.Checker.Start(c.Context(), currentUser.ID, req.Repair)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "integrity_check_failed", "failed starting integrity check")))
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "admin.integrity_check",
+		ResourceType: "integrity_check",
+		ResourceID:   &check.ID,
+		Details: map[string]interface{}{
+			"repair": check.Repair,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusAccepted, check)
+}
+
+// List returns past checks, scheduled ones included, newest first and
+// without their findings.
+func (h *IntegrityHandler) List(c *fiber.Ctx) error {
+	p := utils.ParsePagination(c)
+	query := h.DB.Model(&models.IntegrityCheck{}).Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting integrity checks")
+	}
+	var checks []models.IntegrityCheck
+	if err := utils.ApplyPagination(query.Omit("findings").Order("created_at DESC, id DESC"), p).Find(&checks).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing integrity checks")
+	}
+	return utils.Paginated(c, checks, p.Page, p.Limit, total)
+}
+
+func (h *IntegrityHandler) Get(c *fiber.Ctx) error {
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidIntegrityCheckID)
+	}
+	check, err := h.Checker.Get(c.Context(), id)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "integrity_check_load_failed", "failed loading integrity check")))
+	}
+	return utils.Success(c, fiber.StatusOK, check)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestIntegrityCheckEndpoints(t *testing.T) {
+	env := setupTestEnv(t)
+	_, adminToken := createTestUser(t, env.db, "integrity-admin@test.com", "password123", models.UserRoleAdmin)
+	_, userToken := createTestUser(t, env.db, "integrity-user@test.com", "password123", models.UserRoleUser)
+
+	t.Run("admin only", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/integrity-checks", nil, authHeaders(userToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	var checkID string
+	t.Run("reports without repairing by default", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/integrity-checks", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusAccepted)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		if data["status"] != "pending" || data["repair"] != false {
+			t.Fatalf("unexpected check %v", data)
+		}
+		checkID = data["id"].(string)
+	})
+
+	t.Run("one check at a time", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/integrity-checks", map[string]any{"repair": true}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusConflict)
+		if code := decodeJSONMap(t, resp)["code"]; code != "integrity_check_in_progress" {
+			t.Fatalf("expected integrity_check_in_progress, got %v", code)
+		}
+	})
+
+	t.Run("lists and loads checks", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodGet, "/api/admin/integrity-checks", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		if data := decodeJSONMap(t, resp)["data"].([]any); len(data) != 1 {
+			t.Fatalf("expected one check, got %v", data)
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodGet, "/api/admin/integrity-checks/"+checkID, nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performJSONRequest(t, env.app, http.MethodGet, "/api/admin/integrity-checks/"+models.File{}.ID.String(), nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusNotFound)
+	})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// JobsHandler lets platform admins inspect the background job queue and
+// retry jobs that ran out of attempts.
+type JobsHandler struct {
+	DB    *gorm.DB
+	Jobs  *services.JobRunner
+	Audit *services.AuditService
+}
+
+func NewJobsHandler(db *gorm.DB, jobs *services.JobRunner, audit *services.AuditService) *JobsHandler {
+	return &JobsHandler{DB: db, Jobs: jobs, Audit: audit}
+}
+
+// List returns jobs, newest first, optionally filtered by status and kind.
+// ?status=failed is the dead-letter list.
+func (h *JobsHandler) List(c *fiber.Ctx) error {
+	p := utils.ParsePagination(c)
+
+	query := h.DB.Model(&models.Job{})
+	if status := models.JobStatus(strings.TrimSpace(c.Query("status"))); status != "" {
+		switch status {
+		case models.JobStatusPending, models.JobStatusRunning, models.JobStatusCompleted, models.JobStatusFailed:
+		default:
+			return utils.Error(c, fiber.StatusBadRequest, "status must be pending, running, completed or failed")
+		}
+		query = query.Where("status = ?", status)
+	}
+	if kind := strings.TrimSpace(c.Query("kind")); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting jobs")
+	}
+
+	var jobs []models.Job
+	if err := utils.ApplyPagination(query.Order("created_at DESC, id DESC"), p).Find(&jobs).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing jobs")
+	}
+
+	return utils.Paginated(c, jobs, p.Page, p.Limit, total)
+}
+
+func (h *JobsHandler) Get(c *fiber.Ctx) error {
+	jobID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidJobID)
+	}
+
+	var job models.Job
+	if err := h.DB.First(&job, "id = ?", jobID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Fail(c, errJobNotFound)
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading job")
+	}
+
+	return utils.Success(c, fiber.StatusOK, job)
+}
+
+// Retry requeues a failed job with a fresh set of attempts.
+func (h *JobsHandler) Retry(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	jobID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidJobID)
+	}
+
+	job, err := h.Jobs.Retry(c.Context(), jobID)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "job_retry_failed", "failed retrying job")))
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "admin.job_retry",
+		ResourceType: "job",
+		ResourceID:   &job.ID,
+		Details: map[string]interface{}{
+			"kind":       job.Kind,
+			"last_error": job.LastError,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusOK, job)
+}
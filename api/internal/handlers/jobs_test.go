@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestJobsEndpoints(t *testing.T) {
+	env := setupTestEnv(t)
+	_, adminToken := createTestUser(t, env.db, "jobs-admin@test.com", "password123", models.UserRoleAdmin)
+	_, userToken := createTestUser(t, env.db, "jobs-user@test.com", "password123", models.UserRoleUser)
+
+	now := time.Now().UTC()
+	failed := models.Job{Kind: "audit.export", Status: models.JobStatusFailed, Attempts: 5, MaxAttempts: 5, RunAt: now, FinishedAt: &now, LastError: "bucket unreachable"}
+	completed := models.Job{Kind: "cleanup.locks", Status: models.JobStatusCompleted, Attempts: 1, MaxAttempts: 5, RunAt: now, FinishedAt: &now}
+	for _, job := range []*models.Job{&failed, &completed} {
+		if err := env.db.Create(job).Error; err != nil {
+			t.Fatalf("failed creating job fixture: %v", err)
+		}
+	}
+
+	t.Run("admin only", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/jobs/", nil, authHeaders(userToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("lists the dead letters", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/jobs/?status=failed", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		data := decodeJSONMap(t, resp)["data"].([]interface{})
+		if len(data) != 1 || data[0].(map[string]interface{})["id"] != failed.ID.String() {
+			t.Fatalf("expected only the failed job, got %v", data)
+		}
+	})
+
+	t.Run("rejects an unknown status", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/jobs/?status=dead", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+
+	t.Run("retries a failed job", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodPost, "/api/jobs/"+failed.ID.String()+"/retry", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		data := decodeJSONMap(t, resp)["data"].(map[string]interface{})
+		if data["status"] != string(models.JobStatusPending) || data["attempts"] != float64(0) {
+			t.Fatalf("expected the job requeued with fresh attempts, got %v", data)
+		}
+	})
+
+	t.Run("only failed jobs can be retried", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodPost, "/api/jobs/"+completed.ID.String()+"/retry", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusConflict)
+	})
+
+	t.Run("unknown job", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/jobs/00000000-0000-0000-0000-000000000000", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusNotFound)
+	})
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+// walkCursorPages follows nextCursor until exhausted and returns the IDs of
+// every item seen, failing on duplicates.
+func walkCursorPages(t *testing.T, env *testEnv, path string, params url.Values, token string) []string {
+	t.Helper()
+
+	var ids []string
+	seen := map[string]bool{}
+	params.Set("cursor", "")
+	for page := 0; page < 50; page++ {
+		resp := performRequest(t, env.app, http.MethodGet, path+"?"+params.Encode(), nil, authHeaders(token))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+
+		for _, item := range body["data"].([]any) {
+			id := item.(map[string]any)["id"].(string)
+			if seen[id] {
+				t.Fatalf("item %s returned twice", id)
+			}
+			seen[id] = true
+			ids = append(ids, id)
+		}
+
+		pagination := body["pagination"].(map[string]any)
+		next, _ := pagination["nextCursor"].(string)
+		if next == "" {
+			if pagination["hasMore"] != false {
+				t.Fatalf("expected hasMore=false on last page")
+			}
+			return ids
+		}
+		params.Set("cursor", next)
+	}
+	t.Fatalf("cursor pagination did not terminate")
+	return nil
+}
+
+func TestKeysetPagination(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "keyset-owner@test.com", "password123", models.UserRoleUser)
+	other, _ := createTestUser(t, env.db, "keyset-other@test.com", "password123", models.UserRoleUser)
+
+	folder := models.File{Name: "Folder", MimeType: "inode/directory", IsDirectory: true, OwnerID: owner.ID}
+	if err := env.db.Create(&folder).Error; err != nil {
+		t.Fatalf("failed creating folder: %v", err)
+	}
+	for i := 0; i < 7; i++ {
+		child := models.File{Name: fmt.Sprintf("child-%d.txt", i), MimeType: "text/plain", Size: int64(i % 3), OwnerID: owner.ID, ParentID: &folder.ID, StoragePath: "x"}
+		if err := env.db.Create(&child).Error; err != nil {
+			t.Fatalf("failed creating child: %v", err)
+		}
+	}
+	sharedRoot := models.File{Name: "shared-root.txt", MimeType: "text/plain", OwnerID: other.ID, StoragePath: "y"}
+	if err := env.db.Create(&sharedRoot).Error; err != nil {
+		t.Fatalf("failed creating shared root: %v", err)
+	}
+	if err := env.db.Create(&models.Share{FileID: sharedRoot.ID, SharedByID: other.ID, SharedWithUserID: &owner.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView}).Error; err != nil {
+		t.Fatalf("failed creating share: %v", err)
+	}
+
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		if err := env.db.Create(&models.Activity{UserID: owner.ID, ActorID: other.ID, Action: "file.shared", ResourceType: "file", ResourceName: "x", Message: "m", BaseModel: models.BaseModel{CreatedAt: base}}).Error; err != nil {
+			t.Fatalf("failed creating activity: %v", err)
+		}
+		if err := env.db.Create(&models.AuditLog{UserID: &owner.ID, Action: "file.upload", ResourceType: "file", IPAddress: "127.0.0.1", CreatedAt: base}).Error; err != nil {
+			t.Fatalf("failed creating audit log: %v", err)
+		}
+	}
+
+	t.Run("GET /api/files/:id/children cursor walks every child", func(t *testing.T) {
+		for _, sortKey := range []string{"name", "size", "modified"} {
+			ids := walkCursorPages(t, env, "/api/files/"+folder.ID.String()+"/children", url.Values{"limit": {"3"}, "sort": {sortKey}, "order": {"desc"}}, ownerToken)
+			if len(ids) != 7 {
+				t.Fatalf("sort=%s: expected 7 children, got %d", sortKey, len(ids))
+			}
+		}
+	})
+
+	t.Run("GET /api/files/ cursor includes owned and shared roots", func(t *testing.T) {
+		ids := walkCursorPages(t, env, "/api/files/", url.Values{"limit": {"1"}}, ownerToken)
+		if len(ids) != 2 {
+			t.Fatalf("expected folder and shared root, got %d items", len(ids))
+		}
+	})
+
+	t.Run("GET /api/shared cursor", func(t *testing.T) {
+		ids := walkCursorPages(t, env, "/api/shared", url.Values{"limit": {"1"}}, ownerToken)
+		if len(ids) != 1 || ids[0] != sharedRoot.ID.String() {
+			t.Fatalf("expected only the shared root, got %v", ids)
+		}
+	})
+
+	t.Run("GET /api/activities cursor with identical timestamps", func(t *testing.T) {
+		ids := walkCursorPages(t, env, "/api/activities", url.Values{"limit": {"2"}}, ownerToken)
+		if len(ids) != 5 {
+			t.Fatalf("expected 5 activities, got %d", len(ids))
+		}
+	})
+
+	t.Run("GET /api/audit-log cursor ascending", func(t *testing.T) {
+		ids := walkCursorPages(t, env, "/api/audit-log", url.Values{"limit": {"2"}, "order": {"asc"}}, ownerToken)
+		if len(ids) != 5 {
+			t.Fatalf("expected 5 audit entries, got %d", len(ids))
+		}
+	})
+
+	t.Run("GET /api/audit-log offset pagination", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/audit-log?limit=2", nil, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if total := body["pagination"].(map[string]any)["total"].(float64); total != 5 {
+			t.Fatalf("expected total=5, got %v", total)
+		}
+	})
+
+	t.Run("GET /api/activities rejects malformed cursor", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/activities?cursor=bogus", nil, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusBadRequest)
+		assertEnvelopeError(t, body, "invalid cursor")
+	})
+}
+
+func TestUnpaginatedListing(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "unpaginated-owner@test.com", "password123", models.UserRoleUser)
+
+	folder := models.File{Name: "Big", MimeType: "inode/directory", IsDirectory: true, OwnerID: owner.ID}
+	if err := env.db.Create(&folder).Error; err != nil {
+		t.Fatalf("failed creating folder: %v", err)
+	}
+	for i := 0; i < 25; i++ {
+		child := models.File{Name: fmt.Sprintf("child-%02d.txt", i), MimeType: "text/plain", OwnerID: owner.ID, ParentID: &folder.ID, StoragePath: "x"}
+		if err := env.db.Create(&child).Error; err != nil {
+			t.Fatalf("failed creating child: %v", err)
+		}
+	}
+	// Unversioned paths are deprecated in their own right.
+	path := "/api/v1/files/" + folder.ID.String() + "/children"
+
+	resp := performRequest(t, env.app, http.MethodGet, path+"?limit=0&page=2", nil, authHeaders(ownerToken))
+	body := decodeJSONMap(t, resp)
+	assertStatus(t, resp, http.StatusOK)
+	if n := len(body["data"].([]any)); n != 25 {
+		t.Fatalf("expected every child with limit=0, got %d", n)
+	}
+	pagination := body["pagination"].(map[string]any)
+	if pagination["page"] != float64(1) || pagination["totalPages"] != float64(1) || pagination["total"] != float64(25) {
+		t.Fatalf("expected a single page, got %v", pagination)
+	}
+	if resp.Header.Get("Deprecation") == "" {
+		t.Fatal("expected limit=0 to be marked deprecated")
+	}
+
+	resp = performRequest(t, env.app, http.MethodGet, path, nil, authHeaders(ownerToken))
+	body = decodeJSONMap(t, resp)
+	if n := len(body["data"].([]any)); n != 20 {
+		t.Fatalf("expected the default page size without limit, got %d", n)
+	}
+	if resp.Header.Get("Deprecation") != "" {
+		t.Fatal("expected paginated requests not to be marked deprecated")
+	}
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LegalExportsHandler lets platform admins package a user's or a folder's
+// content for eDiscovery and fetch the result through one-time links.
+type LegalExportsHandler struct {
+	DB      *gorm.DB
+	Exports *services.LegalExports
+	Audit   *services.AuditService
+}
+
+func NewLegalExportsHandler(db *gorm.DB, exports *services.LegalExports, audit *services.AuditService) *LegalExportsHandler {
+	return &LegalExportsHandler{DB: db, Exports: exports, Audit: audit}
+}
+
+type startLegalExportRequest struct {
+	UserID   *uuid.UUID `json:"userID"`
+	FolderID *uuid.UUID `json:"folderID"`
+	Reason   string     `json:"reason"`
+}
+
+// Start queues an export. The archive is built in the background; poll Get
+// for progress.
+func (h *LegalExportsHandler) Start(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	var req startLegalExportRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	export, err := h.Exports.Start(c.Context(), currentUser.ID, services.LegalExportRequest{
+		SubjectUserID: req.UserID,
+		FolderID:      req.FolderID,
+		Reason:        req.Reason,
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrLegalExportInvalid) {
+			return utils.Fail(c, errInvalidLegalExport.WithMessage(err.Error()))
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed starting legal export")
+	}
+
+	h.audit(c, currentUser.ID, "admin.legal_export_start", export)
+	return utils.Success(c, fiber.StatusAccepted, export)
+}
+
+// List returns exports, newest first.
+func (h *LegalExportsHandler) List(c *fiber.Ctx) error {
+	p := utils.ParsePagination(c)
+	query := h.DB.Model(&models.LegalExport{}).Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting legal exports")
+	}
+	var exports []models.LegalExport
+	if err := utils.ApplyPagination(query.Order("created_at DESC, id DESC"), p).Find(&exports).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing legal exports")
+	}
+	return utils.Paginated(c, exports, p.Page, p.Limit, total)
+}
+
+func (h *LegalExportsHandler) Get(c *fiber.Ctx) error {
+	export, apiErr := h.loadExport(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	return utils.Success(c, fiber.StatusOK, export)
+}
+
+// Delete removes a finished or failed export and its archive.
+func (h *LegalExportsHandler) Delete(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	export, apiErr := h.loadExport(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if err := h.Exports.Delete(c.Context(), export); err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "legal_export_delete_failed", "failed deleting legal export")))
+	}
+	h.audit(c, currentUser.ID, "admin.legal_export_delete", export)
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "legal export deleted"})
+}
+
+// Link issues a one-time download link for a completed export. The path is
+// relative to the API and needs no credentials, so it can be handed to a
+// browser or a download tool as is.
+func (h *LegalExportsHandler) Link(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	export, apiErr := h.loadExport(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	token, expires, err := h.Exports.IssueLink(c.Context(), export)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "legal_export_link_failed", "failed issuing download link")))
+	}
+
+	h.audit(c, currentUser.ID, "admin.legal_export_link", export)
+	return utils.Success(c, fiber.StatusOK, fiber.Map{
+		"path":      "/legal-exports/download/" + token,
+		"token":     token,
+		"expiresAt": expires,
+	})
+}
+
+// Download streams the archive behind a one-time link. The link is spent
+// before the first byte is sent.
+func (h *LegalExportsHandler) Download(c *fiber.Ctx) error {
+	export, err := h.Exports.Redeem(c.Context(), strings.TrimSpace(c.Params("token")))
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "legal_export_download_failed", "failed redeeming download link")))
+	}
+	obj, err := h.Exports.Open(c.Context(), export)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "legal_export_download_failed", "failed opening legal export")))
+	}
+
+	h.audit(c, export.RequestedByID, "admin.legal_export_download", export)
+	c.Set("Content-Type", "application/zip")
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "legal-export-"+export.ID.String()+".zip"))
+	return c.SendStream(obj, int(export.Size))
+}
+
+func (h *LegalExportsHandler) loadExport(c *fiber.Ctx) (*models.LegalExport, *utils.APIError) {
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return nil, errInvalidLegalExportID
+	}
+	export, err := h.Exports.Get(c.Context(), id)
+	if err != nil {
+		return nil, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "legal_export_load_failed", "failed loading legal export"))
+	}
+	return export, nil
+}
+
+func (h *LegalExportsHandler) audit(c *fiber.Ctx, userID uuid.UUID, action string, export *models.LegalExport) {
+	details := map[string]interface{}{
+		"reason": export.Reason,
+		"status": export.Status,
+	}
+	if export.SubjectUserID != nil {
+		details["subject_user_id"] = export.SubjectUserID.String()
+	}
+	if export.FolderID != nil {
+		details["folder_id"] = export.FolderID.String()
+	}
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &userID,
+		Action:       action,
+		ResourceType: "legal_export",
+		ResourceID:   &export.ID,
+		Details:      details,
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestLegalExports(t *testing.T) {
+	env := setupTestEnv(t)
+	admin, adminToken := createTestUser(t, env.db, "legal-admin@test.com", "password123", models.UserRoleAdmin)
+	custodian, userToken := createTestUser(t, env.db, "legal-custodian@test.com", "password123", models.UserRoleUser)
+	file := models.File{Name: "contract.txt", OwnerID: custodian.ID, Size: 6, StoragePath: "legal/contract.txt"}
+	env.db.Create(&file)
+	env.uploads.objects[file.StoragePath] = []byte("signed")
+
+	expectCode := func(t *testing.T, resp *http.Response, status int, code string) {
+		t.Helper()
+		body := decodeJSONMap(t, resp)
+		if resp.StatusCode != status || body["code"] != code {
+			t.Fatalf("expected %d %s, got %d %v", status, code, resp.StatusCode, body)
+		}
+	}
+	start := func(t *testing.T) string {
+		t.Helper()
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/legal-exports", map[string]any{
+			"userID": custodian.ID.String(),
+			"reason": "Matter 7",
+		}, authHeaders(adminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusAccepted)
+		return body["data"].(map[string]any)["id"].(string)
+	}
+
+	t.Run("only admins export", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/legal-exports", map[string]any{"userID": custodian.ID.String(), "reason": "x"}, authHeaders(userToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("refuses a request without a reason", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/legal-exports", map[string]any{"userID": custodian.ID.String()}, authHeaders(adminToken))
+		expectCode(t, resp, http.StatusBadRequest, "invalid_legal_export")
+	})
+
+	t.Run("builds and downloads an export once", func(t *testing.T) {
+		id := start(t)
+		resp := performRequest(t, env.app, http.MethodPost, "/api/admin/legal-exports/"+id+"/link", nil, authHeaders(adminToken))
+		expectCode(t, resp, http.StatusConflict, "legal_export_not_ready")
+
+		if ran, err := env.jobs.RunNext(context.Background()); !ran || err != nil {
+			t.Fatalf("expected the export job to run, got %v, %v", ran, err)
+		}
+		resp = performRequest(t, env.app, http.MethodGet, "/api/admin/legal-exports/"+id, nil, authHeaders(adminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		data := body["data"].(map[string]any)
+		if data["status"] != "completed" || data["filesDone"] != float64(1) || data["bytesDone"] != float64(6) {
+			t.Fatalf("unexpected export %v", data)
+		}
+
+		resp = performRequest(t, env.app, http.MethodPost, "/api/admin/legal-exports/"+id+"/link", nil, authHeaders(adminToken))
+		body = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		path := body["data"].(map[string]any)["path"].(string)
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/"+path[1:], nil, nil)
+		assertStatus(t, resp, http.StatusOK)
+		content, _ := io.ReadAll(resp.Body)
+		archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			t.Fatalf("expected a zip archive: %v", err)
+		}
+		if _, err := archive.Open("files/contract.txt"); err != nil {
+			t.Fatalf("expected the custodian's file in the archive: %v", err)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/"+path[1:], nil, nil)
+		expectCode(t, resp, http.StatusNotFound, "legal_export_link_invalid")
+
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			var count int64
+			env.db.Model(&models.AuditLog{}).Where("action LIKE ? AND user_id = ?", "admin.legal_export_%", admin.ID).Count(&count)
+			if count == 3 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected start, link and download to be audited, got %d", count)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	})
+
+	t.Run("lists and deletes exports", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/admin/legal-exports", nil, authHeaders(adminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		exports := body["data"].([]any)
+		if len(exports) != 1 {
+			t.Fatalf("expected one export, got %v", exports)
+		}
+		id := exports[0].(map[string]any)["id"].(string)
+
+		resp = performRequest(t, env.app, http.MethodDelete, "/api/admin/legal-exports/"+id, nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		resp = performRequest(t, env.app, http.MethodGet, "/api/admin/legal-exports/"+id, nil, authHeaders(adminToken))
+		expectCode(t, resp, http.StatusNotFound, "legal_export_not_found")
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"time"
 
+	"github.com/docshare/api/internal/config"
 	"github.com/docshare/api/internal/middleware"
 	"github.com/docshare/api/internal/models"
 	"github.com/docshare/api/internal/services"
@@ -17,18 +18,20 @@ import (
 )
 
 type MFAHandler struct {
-	DB    *gorm.DB
-	Audit *services.AuditService
+	DB       *gorm.DB
+	Audit    *services.AuditService
+	Config   config.MFAConfig
+	Sessions *services.SessionService
 }
 
-func NewMFAHandler(db *gorm.DB, audit *services.AuditService) *MFAHandler {
-	return &MFAHandler{DB: db, Audit: audit}
+func NewMFAHandler(db *gorm.DB, audit *services.AuditService, cfg config.MFAConfig, sessions *services.SessionService) *MFAHandler {
+	return &MFAHandler{DB: db, Audit: audit, Config: cfg, Sessions: sessions}
 }
 
 func (h *MFAHandler) Status(c *fiber.Ctx) error {
 	user := middleware.GetCurrentUser(c)
 	if user == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var mfaCfg models.MFAConfig
@@ -47,24 +50,27 @@ func (h *MFAHandler) Status(c *fiber.Ctx) error {
 	}
 
 	recoveryCount := 0
+	regenerationRequired := false
 	if hasMFA {
 		recoveryCount = mfaCfg.RecoveryCount
+		regenerationRequired = recoveryRegenerationRequired(&mfaCfg, h.Config)
 	}
 
 	return utils.Success(c, fiber.StatusOK, fiber.Map{
-		"mfaEnabled":               mfaEnabled,
-		"totpEnabled":              totpEnabled,
-		"totpVerifiedAt":           totpVerifiedAt,
-		"webauthnEnabled":          webauthnEnabled,
-		"webauthnCredentialsCount": credCount,
-		"recoveryCodesRemaining":   recoveryCount,
+		"mfaEnabled":                   mfaEnabled,
+		"totpEnabled":                  totpEnabled,
+		"totpVerifiedAt":               totpVerifiedAt,
+		"webauthnEnabled":              webauthnEnabled,
+		"webauthnCredentialsCount":     credCount,
+		"recoveryCodesRemaining":       recoveryCount,
+		"recoveryRegenerationRequired": regenerationRequired,
 	})
 }
 
 func (h *MFAHandler) TOTPSetup(c *fiber.Ctx) error {
 	user := middleware.GetCurrentUser(c)
 	if user == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var existing models.MFAConfig
@@ -116,12 +122,12 @@ type verifyTOTPSetupRequest struct {
 func (h *MFAHandler) TOTPVerifySetup(c *fiber.Ctx) error {
 	user := middleware.GetCurrentUser(c)
 	if user == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var req verifyTOTPSetupRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	if req.Code == "" {
@@ -139,25 +145,14 @@ func (h *MFAHandler) TOTPVerifySetup(c *fiber.Ctx) error {
 
 	totpSecret := utils.DecryptOrPlaintext(mfaCfg.TOTPSecret)
 	if !totp.Validate(req.Code, totpSecret) {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid TOTP code")
+		return utils.Fail(c, errInvalidTOTPCode)
 	}
 
-	codes, hashedCodes, err := generateRecoveryCodes(10)
-	if err != nil {
-		return utils.Error(c, fiber.StatusInternalServerError, "failed to generate recovery codes")
-	}
-
-	codesJSON, err := json.Marshal(hashedCodes)
-	if err != nil {
-		return utils.Error(c, fiber.StatusInternalServerError, "failed to serialize recovery codes")
-	}
-	now := time.Now()
-	if err := h.DB.Model(&mfaCfg).Updates(map[string]interface{}{
+	codes, downloadExpiresAt, err := issueRecoveryCodes(h.DB, &mfaCfg, h.Config, map[string]interface{}{
 		"totp_enabled":     true,
-		"totp_verified_at": now,
-		"recovery_codes":   string(codesJSON),
-		"recovery_count":   len(codes),
-	}).Error; err != nil {
+		"totp_verified_at": time.Now(),
+	})
+	if err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed to enable TOTP")
 	}
 
@@ -174,9 +169,7 @@ func (h *MFAHandler) TOTPVerifySetup(c *fiber.Ctx) error {
 		RequestID:    getRequestID(c),
 	})
 
-	return utils.Success(c, fiber.StatusOK, fiber.Map{
-		"recoveryCodes": codes,
-	})
+	return utils.Success(c, fiber.StatusOK, recoveryCodesResponse(c, codes, downloadExpiresAt))
 }
 
 type disableTOTPRequest struct {
@@ -187,12 +180,12 @@ type disableTOTPRequest struct {
 func (h *MFAHandler) TOTPDisable(c *fiber.Ctx) error {
 	user := middleware.GetCurrentUser(c)
 	if user == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var req disableTOTPRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	var dbUser models.User
@@ -214,7 +207,7 @@ func (h *MFAHandler) TOTPDisable(c *fiber.Ctx) error {
 		}
 		totpSecret := utils.DecryptOrPlaintext(mfaCfg.TOTPSecret)
 		if !totp.Validate(req.TOTPCode, totpSecret) {
-			return utils.Error(c, fiber.StatusBadRequest, "invalid TOTP code")
+			return utils.Fail(c, errInvalidTOTPCode)
 		}
 	} else {
 		if req.Password == "" {
@@ -268,7 +261,7 @@ type verifyMFATOTPRequest struct {
 func (h *MFAHandler) VerifyTOTP(c *fiber.Ctx) error {
 	var req verifyMFATOTPRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	if req.MFAToken == "" || req.Code == "" {
@@ -277,11 +270,11 @@ func (h *MFAHandler) VerifyTOTP(c *fiber.Ctx) error {
 
 	claims, err := utils.ValidateMFAToken(req.MFAToken)
 	if err != nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "invalid or expired MFA token")
+		return utils.Fail(c, errInvalidMFAToken)
 	}
 
 	if !utils.IsJTIValid(claims.JTI) {
-		return utils.Error(c, fiber.StatusUnauthorized, "MFA token already used")
+		return utils.Fail(c, errMFATokenUsed)
 	}
 
 	var user models.User
@@ -301,7 +294,10 @@ func (h *MFAHandler) VerifyTOTP(c *fiber.Ctx) error {
 
 	utils.ConsumeJTI(claims.JTI)
 
-	token, err := utils.GenerateToken(&user)
+	if user.IsSuspended() {
+		return utils.Fail(c, middleware.ErrAccountSuspended)
+	}
+	token, err := issueToken(c, h.Sessions, &user, "totp")
 	if err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed generating token")
 	}
@@ -333,7 +329,7 @@ type verifyRecoveryRequest struct {
 func (h *MFAHandler) VerifyRecovery(c *fiber.Ctx) error {
 	var req verifyRecoveryRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	if req.MFAToken == "" || req.Code == "" {
@@ -342,11 +338,11 @@ func (h *MFAHandler) VerifyRecovery(c *fiber.Ctx) error {
 
 	claims, err := utils.ValidateMFAToken(req.MFAToken)
 	if err != nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "invalid or expired MFA token")
+		return utils.Fail(c, errInvalidMFAToken)
 	}
 
 	if !utils.IsJTIValid(claims.JTI) {
-		return utils.Error(c, fiber.StatusUnauthorized, "MFA token already used")
+		return utils.Fail(c, errMFATokenUsed)
 	}
 
 	var user models.User
@@ -390,7 +386,10 @@ func (h *MFAHandler) VerifyRecovery(c *fiber.Ctx) error {
 
 	utils.ConsumeJTI(claims.JTI)
 
-	token, err := utils.GenerateToken(&user)
+	if user.IsSuspended() {
+		return utils.Fail(c, middleware.ErrAccountSuspended)
+	}
+	token, err := issueToken(c, h.Sessions, &user, "recovery_code")
 	if err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed generating token")
 	}
@@ -400,6 +399,9 @@ func (h *MFAHandler) VerifyRecovery(c *fiber.Ctx) error {
 		"remaining_codes": len(storedCodes),
 	})
 
+	// recovery_low turns the audit event into a warning in the user's
+	// activity feed.
+	mfaCfg.RecoveryCount = len(storedCodes)
 	h.Audit.LogAsync(services.AuditEntry{
 		UserID:       &user.ID,
 		Action:       "user.mfa_recovery",
@@ -407,12 +409,18 @@ func (h *MFAHandler) VerifyRecovery(c *fiber.Ctx) error {
 		ResourceID:   &user.ID,
 		Details: map[string]interface{}{
 			"remaining_codes": len(storedCodes),
+			"recovery_low":    len(storedCodes) <= h.Config.RecoveryMinCodes,
 		},
 		IPAddress: c.IP(),
 		RequestID: getRequestID(c),
 	})
 
-	return utils.Success(c, fiber.StatusOK, fiber.Map{"token": token, "user": user})
+	return utils.Success(c, fiber.StatusOK, fiber.Map{
+		"token":                        token,
+		"user":                         user,
+		"recoveryCodesRemaining":       len(storedCodes),
+		"recoveryRegenerationRequired": recoveryRegenerationRequired(&mfaCfg, h.Config),
+	})
 }
 
 type regenerateRecoveryRequest struct {
@@ -423,12 +431,12 @@ type regenerateRecoveryRequest struct {
 func (h *MFAHandler) RegenerateRecovery(c *fiber.Ctx) error {
 	user := middleware.GetCurrentUser(c)
 	if user == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var req regenerateRecoveryRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	var dbUser models.User
@@ -450,7 +458,7 @@ func (h *MFAHandler) RegenerateRecovery(c *fiber.Ctx) error {
 		}
 		totpSecret := utils.DecryptOrPlaintext(mfaCfg.TOTPSecret)
 		if !totp.Validate(req.TOTPCode, totpSecret) {
-			return utils.Error(c, fiber.StatusBadRequest, "invalid TOTP code")
+			return utils.Fail(c, errInvalidTOTPCode)
 		}
 	} else {
 		if req.Password == "" {
@@ -461,22 +469,11 @@ func (h *MFAHandler) RegenerateRecovery(c *fiber.Ctx) error {
 		}
 	}
 
-	codes, hashedCodes, err := generateRecoveryCodes(10)
+	codes, downloadExpiresAt, err := issueRecoveryCodes(h.DB, &mfaCfg, h.Config, nil)
 	if err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed to generate recovery codes")
 	}
 
-	codesJSON, err := json.Marshal(hashedCodes)
-	if err != nil {
-		return utils.Error(c, fiber.StatusInternalServerError, "failed to serialize recovery codes")
-	}
-	if err := h.DB.Model(&mfaCfg).Updates(map[string]interface{}{
-		"recovery_codes": string(codesJSON),
-		"recovery_count": len(codes),
-	}).Error; err != nil {
-		return utils.Error(c, fiber.StatusInternalServerError, "failed to update recovery codes")
-	}
-
 	logger.Info("mfa_recovery_regenerated", map[string]interface{}{
 		"user_id": user.ID.String(),
 	})
@@ -490,9 +487,7 @@ func (h *MFAHandler) RegenerateRecovery(c *fiber.Ctx) error {
 		RequestID:    getRequestID(c),
 	})
 
-	return utils.Success(c, fiber.StatusOK, fiber.Map{
-		"recoveryCodes": codes,
-	})
+	return utils.Success(c, fiber.StatusOK, recoveryCodesResponse(c, codes, downloadExpiresAt))
 }
 
 func generateRecoveryCodes(count int) (plaintextCodes []string, hashedCodes []string, err error) {
@@ -538,6 +533,6 @@ func UserHasMFA(db *gorm.DB, userID interface{}) (bool, []string) {
 	return true, methods
 }
 
-func CleanupExpiredMFAChallenges(db *gorm.DB) {
-	db.Where("expires_at < ?", time.Now()).Delete(&models.MFAChallenge{})
+func CleanupExpiredMFAChallenges(db *gorm.DB) error {
+	return db.Where("expires_at < ?", time.Now()).Delete(&models.MFAChallenge{}).Error
 }
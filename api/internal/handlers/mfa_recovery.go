@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// issueRecoveryCodes replaces the user's recovery codes with a new set,
+// applying extra in the same update, and keeps an encrypted copy that can be
+// downloaded once until the returned time.
+func issueRecoveryCodes(db *gorm.DB, mfaCfg *models.MFAConfig, cfg config.MFAConfig, extra map[string]interface{}) ([]string, time.Time, error) {
+	count := cfg.RecoveryCodeCount
+	if count <= 0 {
+		count = 10
+	}
+	codes, hashedCodes, err := generateRecoveryCodes(count)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	codesJSON, err := json.Marshal(hashedCodes)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	download, err := utils.EncryptAESGCM(strings.Join(codes, "\n"))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(cfg.RecoveryDownloadTTL)
+	updates := map[string]interface{}{
+		"recovery_codes":               string(codesJSON),
+		"recovery_count":               len(codes),
+		"recovery_issued":              len(codes),
+		"recovery_issued_at":           now,
+		"recovery_download":            download,
+		"recovery_download_expires_at": expiresAt,
+	}
+	for k, v := range extra {
+		updates[k] = v
+	}
+	if err := db.Model(mfaCfg).Updates(updates).Error; err != nil {
+		return nil, time.Time{}, err
+	}
+	return codes, expiresAt, nil
+}
+
+// recoveryCodesResponse returns a freshly issued set. The codes are never
+// shown again, so the response must not be cached anywhere on the way.
+func recoveryCodesResponse(c *fiber.Ctx, codes []string, downloadExpiresAt time.Time) fiber.Map {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return fiber.Map{
+		"recoveryCodes":             codes,
+		"recoveryDownloadExpiresAt": downloadExpiresAt,
+	}
+}
+
+// recoveryRegenerationRequired reports whether the user has spent enough
+// codes that they must generate a new set before carrying on.
+func recoveryRegenerationRequired(mfaCfg *models.MFAConfig, cfg config.MFAConfig) bool {
+	return mfaCfg.RecoveryIssued > 0 && mfaCfg.RecoveryCount < cfg.RecoveryMinCodes
+}
+
+func (h *MFAHandler) RecoveryStatus(c *fiber.Ctx) error {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	var mfaCfg models.MFAConfig
+	if err := h.DB.First(&mfaCfg, "user_id = ?", user.ID).Error; err != nil {
+		mfaCfg = models.MFAConfig{}
+	}
+
+	now := time.Now()
+	downloadAvailable := mfaCfg.RecoveryDownload != "" &&
+		mfaCfg.RecoveryDownloadExpiresAt != nil && now.Before(*mfaCfg.RecoveryDownloadExpiresAt)
+	var downloadExpiresAt *time.Time
+	if downloadAvailable {
+		downloadExpiresAt = mfaCfg.RecoveryDownloadExpiresAt
+	}
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{
+		"remaining":            mfaCfg.RecoveryCount,
+		"issued":               mfaCfg.RecoveryIssued,
+		"issuedAt":             mfaCfg.RecoveryIssuedAt,
+		"minimum":              h.Config.RecoveryMinCodes,
+		"low":                  mfaCfg.RecoveryIssued > 0 && mfaCfg.RecoveryCount <= h.Config.RecoveryMinCodes,
+		"regenerationRequired": recoveryRegenerationRequired(&mfaCfg, h.Config),
+		"downloadAvailable":    downloadAvailable,
+		"downloadExpiresAt":    downloadExpiresAt,
+	})
+}
+
+// DownloadRecovery hands out the most recently generated codes as a text or
+// PDF file. The stored copy is wiped by the first download, so a stolen
+// session cannot fetch the codes again later.
+func (h *MFAHandler) DownloadRecovery(c *fiber.Ctx) error {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	format := strings.ToLower(c.Query("format", "txt"))
+	if format != "txt" && format != "pdf" {
+		return utils.Error(c, fiber.StatusBadRequest, "format must be txt or pdf")
+	}
+
+	var mfaCfg models.MFAConfig
+	if err := h.DB.First(&mfaCfg, "user_id = ?", user.ID).Error; err != nil {
+		return utils.Fail(c, errRecoveryDownloadGone)
+	}
+	if mfaCfg.RecoveryDownload == "" || mfaCfg.RecoveryDownloadExpiresAt == nil || time.Now().After(*mfaCfg.RecoveryDownloadExpiresAt) {
+		return utils.Fail(c, errRecoveryDownloadGone)
+	}
+
+	// Claim the copy with a conditional update so two concurrent requests
+	// cannot both download it.
+	result := h.DB.Model(&models.MFAConfig{}).
+		Where("id = ? AND recovery_download = ?", mfaCfg.ID, mfaCfg.RecoveryDownload).
+		Updates(map[string]interface{}{
+			"recovery_download":            "",
+			"recovery_download_expires_at": nil,
+		})
+	if result.Error != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed to load recovery codes")
+	}
+	if result.RowsAffected != 1 {
+		return utils.Fail(c, errRecoveryDownloadGone)
+	}
+
+	plaintext, err := utils.DecryptAESGCM(mfaCfg.RecoveryDownload)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed to load recovery codes")
+	}
+	issuedAt := time.Now()
+	if mfaCfg.RecoveryIssuedAt != nil {
+		issuedAt = *mfaCfg.RecoveryIssuedAt
+	}
+	lines := recoveryCodesSheet(user.Email, issuedAt, strings.Split(plaintext, "\n"))
+
+	logger.Info("mfa_recovery_downloaded", map[string]interface{}{
+		"user_id": user.ID.String(),
+		"format":  format,
+	})
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &user.ID,
+		Action:       "mfa.recovery_downloaded",
+		ResourceType: "user",
+		ResourceID:   &user.ID,
+		Details: map[string]interface{}{
+			"format": format,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", "docshare-recovery-codes."+format))
+	if format == "pdf" {
+		c.Set(fiber.HeaderContentType, "application/pdf")
+		return c.Send(recoveryCodesPDF(lines))
+	}
+	c.Set(fiber.HeaderContentType, "text/plain; charset=utf-8")
+	return c.SendString(strings.Join(lines, "\n") + "\n")
+}
+
+func recoveryCodesSheet(email string, issuedAt time.Time, codes []string) []string {
+	lines := []string{
+		"DocShare recovery codes",
+		"",
+		"Account:   " + email,
+		"Generated: " + issuedAt.UTC().Format("2006-01-02 15:04 MST"),
+		"",
+		"Each code signs you in once if you lose access to your",
+		"authenticator app or passkeys. Keep them somewhere safe.",
+		"",
+	}
+	for i, code := range codes {
+		lines = append(lines, fmt.Sprintf("%3d.  %s", i+1, code))
+	}
+	return lines
+}
+
+// recoveryCodesPDF renders lines as a single-page PDF in Courier. The sheet
+// is short and plain enough that writing the objects by hand beats pulling
+// in a PDF library.
+func recoveryCodesPDF(lines []string) []byte {
+	var content bytes.Buffer
+	content.WriteString("BT\n/F1 12 Tf\n16 TL\n72 760 Td\n")
+	for _, line := range lines {
+		fmt.Fprintf(&content, "(%s) '\n", pdfEscape(line))
+	}
+	content.WriteString("ET\n")
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+// pdfEscape makes s safe inside a PDF string literal. The standard fonts only
+// cover Latin-1, so anything outside printable ASCII becomes "?".
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
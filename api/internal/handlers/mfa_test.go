@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -263,6 +266,182 @@ func TestMFAHandler_RegenerateRecovery(t *testing.T) {
 	}
 }
 
+func TestMFAHandler_RecoveryStatusAndDownload(t *testing.T) {
+	env := setupTestEnv(t)
+	user, token := createTestUser(t, env.db, "recovery-download@test.com", "password123", models.UserRoleUser)
+
+	setupResp := performJSONRequest(t, env.app, http.MethodPost, "/api/auth/mfa/totp/setup", map[string]interface{}{}, authHeaders(token))
+	secret := decodeJSONMap(t, setupResp)["data"].(map[string]interface{})["secret"].(string)
+	code, _ := totp.GenerateCode(secret, time.Now())
+	resp := performJSONRequest(t, env.app, http.MethodPost, "/api/auth/mfa/totp/verify-setup", map[string]interface{}{
+		"code": code,
+	}, authHeaders(token))
+	assertStatus(t, resp, http.StatusOK)
+	if got := resp.Header.Get("Cache-Control"); got != "no-store" {
+		t.Fatalf("expected recovery codes to be served with no-store, got %q", got)
+	}
+	codes := decodeJSONMap(t, resp)["data"].(map[string]interface{})["recoveryCodes"].([]interface{})
+
+	status := func(t *testing.T) map[string]interface{} {
+		t.Helper()
+		resp := performRequest(t, env.app, http.MethodGet, "/api/auth/mfa/recovery/status", nil, authHeaders(token))
+		assertStatus(t, resp, http.StatusOK)
+		return decodeJSONMap(t, resp)["data"].(map[string]interface{})
+	}
+
+	t.Run("status after setup", func(t *testing.T) {
+		data := status(t)
+		if data["remaining"].(float64) != 10 || data["issued"].(float64) != 10 {
+			t.Fatalf("expected 10 of 10 codes, got %v", data)
+		}
+		if data["low"].(bool) || data["regenerationRequired"].(bool) {
+			t.Fatalf("a fresh set must not be low, got %v", data)
+		}
+		if !data["downloadAvailable"].(bool) {
+			t.Fatal("expected the new set to be downloadable")
+		}
+	})
+
+	t.Run("download is one-time", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/auth/mfa/recovery/download", nil, authHeaders(token))
+		assertStatus(t, resp, http.StatusOK)
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+			t.Fatalf("expected text/plain, got %q", ct)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		for _, c := range codes {
+			if !strings.Contains(string(body), c.(string)) {
+				t.Fatalf("expected download to list %s", c)
+			}
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/auth/mfa/recovery/download", nil, authHeaders(token))
+		assertStatus(t, resp, http.StatusGone)
+		if status(t)["downloadAvailable"].(bool) {
+			t.Fatal("expected the download to be gone")
+		}
+	})
+
+	t.Run("pdf after regenerating", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/auth/mfa/recovery/regenerate", map[string]interface{}{
+			"password": "password123",
+		}, authHeaders(token))
+		assertStatus(t, resp, http.StatusOK)
+		codes = decodeJSONMap(t, resp)["data"].(map[string]interface{})["recoveryCodes"].([]interface{})
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/auth/mfa/recovery/download?format=pdf", nil, authHeaders(token))
+		assertStatus(t, resp, http.StatusOK)
+		body, _ := io.ReadAll(resp.Body)
+		if !bytes.HasPrefix(body, []byte("%PDF-")) || !bytes.Contains(body, []byte(codes[0].(string))) {
+			t.Fatal("expected a PDF listing the codes")
+		}
+	})
+
+	t.Run("regeneration required below the minimum", func(t *testing.T) {
+		var mfaCfg models.MFAConfig
+		if err := env.db.First(&mfaCfg, "user_id = ?", user.ID).Error; err != nil {
+			t.Fatalf("load mfa config: %v", err)
+		}
+		var hashed []string
+		_ = json.Unmarshal([]byte(mfaCfg.RecoveryCodes), &hashed)
+		trimmed, _ := json.Marshal(hashed[:3])
+		env.db.Model(&mfaCfg).Updates(map[string]interface{}{"recovery_codes": string(trimmed), "recovery_count": 3})
+
+		mfaToken, _ := utils.GenerateMFAToken(user.ID, user.Email)
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/auth/mfa/verify/recovery", map[string]interface{}{
+			"mfaToken": mfaToken,
+			"code":     codes[0].(string),
+		}, nil)
+		assertStatus(t, resp, http.StatusOK)
+		data := decodeJSONMap(t, resp)["data"].(map[string]interface{})
+		if data["recoveryCodesRemaining"].(float64) != 2 || data["recoveryRegenerationRequired"] != true {
+			t.Fatalf("expected regeneration to be required with 2 codes left, got %v", data)
+		}
+
+		if got := status(t); !got["low"].(bool) || !got["regenerationRequired"].(bool) {
+			t.Fatalf("expected status to require regeneration, got %v", got)
+		}
+	})
+}
+
 func init() {
 	_ = json.Marshal
 }
+
+func TestMFAPolicyEnforcement(t *testing.T) {
+	env := setupTestEnv(t)
+	_, adminToken := createTestUser(t, env.db, "mfa-policy-admin@test.com", "password123", models.UserRoleAdmin)
+
+	resp := performJSONRequest(t, env.app, http.MethodPost, "/api/organizations/", map[string]interface{}{
+		"name": "Strict",
+		"slug": "strict",
+		"admin": map[string]interface{}{
+			"email": "strict-admin@test.com", "password": "password123", "firstName": "S", "lastName": "Admin",
+		},
+	}, authHeaders(adminToken))
+	assertStatus(t, resp, http.StatusCreated)
+	orgID := decodeJSONMap(t, resp)["data"].(map[string]interface{})["id"].(string)
+
+	resp = performJSONRequest(t, env.app, http.MethodPut, "/api/organizations/"+orgID, map[string]interface{}{
+		"mfaRequirement": "sometimes",
+	}, authHeaders(adminToken))
+	assertStatus(t, resp, http.StatusBadRequest)
+
+	resp = performJSONRequest(t, env.app, http.MethodPut, "/api/organizations/"+orgID, map[string]interface{}{
+		"mfaRequirement": "all",
+	}, authHeaders(adminToken))
+	assertStatus(t, resp, http.StatusOK)
+
+	strict := map[string]string{"X-Organization": "strict"}
+	resp = performJSONRequest(t, env.app, http.MethodPost, "/api/auth/login", map[string]interface{}{
+		"email": "strict-admin@test.com", "password": "password123",
+	}, strict)
+	assertStatus(t, resp, http.StatusOK)
+	headers := authHeaders(decodeJSONMap(t, resp)["data"].(map[string]interface{})["token"].(string))
+	headers["X-Organization"] = "strict"
+
+	mfaPolicy := func(t *testing.T) map[string]interface{} {
+		t.Helper()
+		resp := performRequest(t, env.app, http.MethodGet, "/api/auth/me", nil, headers)
+		assertStatus(t, resp, http.StatusOK)
+		data := decodeJSONMap(t, resp)["data"].(map[string]interface{})
+		if data["email"] != "strict-admin@test.com" {
+			t.Fatalf("expected the user in /auth/me, got %v", data)
+		}
+		return data["mfaPolicy"].(map[string]interface{})
+	}
+
+	t.Run("grace period", func(t *testing.T) {
+		policy := mfaPolicy(t)
+		if policy["required"] != true || policy["restricted"] != false || policy["graceEndsAt"] == nil {
+			t.Fatalf("expected a running grace period, got %v", policy)
+		}
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/", nil, headers)
+		assertStatus(t, resp, http.StatusOK)
+	})
+
+	t.Run("restricted to enrollment once it ends", func(t *testing.T) {
+		env.db.Model(&models.User{}).Where("email = ?", "strict-admin@test.com").
+			Update("mfa_grace_started_at", time.Now().Add(-48*time.Hour))
+
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/", nil, headers)
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusForbidden)
+		if body["code"] != "mfa_enrollment_required" {
+			t.Fatalf("expected mfa_enrollment_required, got %v", body["code"])
+		}
+		if policy := mfaPolicy(t); policy["restricted"] != true {
+			t.Fatalf("expected /auth/me to report the restriction, got %v", policy)
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/auth/mfa/totp/setup", map[string]interface{}{}, headers)
+		assertStatus(t, resp, http.StatusOK)
+		secret := decodeJSONMap(t, resp)["data"].(map[string]interface{})["secret"].(string)
+		code, _ := totp.GenerateCode(secret, time.Now())
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/auth/mfa/totp/verify-setup", map[string]interface{}{"code": code}, headers)
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/files/", nil, headers)
+		assertStatus(t, resp, http.StatusOK)
+	})
+}
@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ModerationHandler takes abuse reports against public shares and lets
+// platform admins work through them.
+type ModerationHandler struct {
+	DB         *gorm.DB
+	Access     *services.AccessService
+	Moderation *services.ModerationService
+	Audit      *services.AuditService
+	// Captcha, when set, must be solved by anonymous reporters.
+	Captcha *services.CaptchaService
+}
+
+func NewModerationHandler(db *gorm.DB, access *services.AccessService, moderation *services.ModerationService, audit *services.AuditService) *ModerationHandler {
+	return &ModerationHandler{DB: db, Access: access, Moderation: moderation, Audit: audit}
+}
+
+// maxReportDetailsLength bounds the free text a reporter can attach.
+const maxReportDetailsLength = 2000
+
+type reportAbuseRequest struct {
+	Reason       models.AbuseReason `json:"reason"`
+	Details      string             `json:"details"`
+	Email        string             `json:"email"`
+	CaptchaToken string             `json:"captchaToken"`
+}
+
+// Report flags a publicly shared file for the moderation queue. A reporter
+// with an open report against the file gets that report back instead of a
+// new one.
+func (h *ModerationHandler) Report(c *fiber.Ctx) error {
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+	if !h.Access.InOrganization(c.Context(), fileID, middleware.GetOrganizationID(c)) {
+		return utils.Fail(c, errFileNotFound)
+	}
+	share := h.Access.GetPublicShare(c.Context(), fileID)
+	if share == nil {
+		return utils.Fail(c, errFileNotFound)
+	}
+
+	var req reportAbuseRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	switch req.Reason {
+	case models.AbuseReasonSpam, models.AbuseReasonMalware, models.AbuseReasonPhishing,
+		models.AbuseReasonCopyright, models.AbuseReasonIllegal, models.AbuseReasonOther:
+	default:
+		return utils.Error(c, fiber.StatusBadRequest, "reason must be spam, malware, phishing, copyright, illegal or other")
+	}
+	req.Details = strings.TrimSpace(req.Details)
+	if utf8.RuneCountInString(req.Details) > maxReportDetailsLength {
+		return utils.Error(c, fiber.StatusBadRequest, "details must be 2000 characters or fewer")
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email != "" {
+		if _, err := mail.ParseAddress(req.Email); err != nil {
+			return utils.Error(c, fiber.StatusBadRequest, "invalid email address")
+		}
+	}
+
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		token := req.CaptchaToken
+		if token == "" {
+			token = captchaToken(c)
+		}
+		if err := h.Captcha.Verify(c.Context(), token, c.IP()); err != nil {
+			return failCaptcha(c, err)
+		}
+	}
+
+	existing := h.DB.Where("file_id = ? AND status = ?", fileID, models.AbuseReportStatusOpen)
+	if currentUser != nil {
+		existing = existing.Where("reporter_id = ?", currentUser.ID)
+	} else {
+		existing = existing.Where("reporter_id IS NULL AND reporter_ip = ?", c.IP())
+	}
+	var report models.AbuseReport
+	if err := existing.First(&report).Error; err == nil {
+		return utils.Success(c, fiber.StatusOK, fiber.Map{"id": report.ID, "status": report.Status})
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed saving report")
+	}
+
+	report = models.AbuseReport{
+		FileID:        fileID,
+		ShareID:       &share.ID,
+		ReporterEmail: req.Email,
+		ReporterIP:    c.IP(),
+		Reason:        req.Reason,
+		Details:       req.Details,
+		Status:        models.AbuseReportStatusOpen,
+	}
+	if currentUser != nil {
+		report.ReporterID = &currentUser.ID
+		if report.ReporterEmail == "" {
+			report.ReporterEmail = currentUser.Email
+		}
+	}
+	if err := h.DB.Create(&report).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed saving report")
+	}
+
+	entry := services.AuditEntry{
+		Action:       "file.abuse_report",
+		ResourceType: "file",
+		ResourceID:   &fileID,
+		Details: map[string]interface{}{
+			"report_id": report.ID.String(),
+			"share_id":  share.ID.String(),
+			"reason":    string(req.Reason),
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	}
+	if currentUser != nil {
+		entry.UserID = &currentUser.ID
+	}
+	h.Audit.LogAsync(entry)
+
+	return utils.Success(c, fiber.StatusCreated, fiber.Map{"id": report.ID, "status": report.Status})
+}
+
+// ListReports returns abuse reports, newest first, optionally filtered by
+// status, reason and file.
+func (h *ModerationHandler) ListReports(c *fiber.Ctx) error {
+	p := utils.ParsePagination(c)
+
+	query := h.DB.Model(&models.AbuseReport{})
+	if status := models.AbuseReportStatus(strings.TrimSpace(c.Query("status"))); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if reason := strings.TrimSpace(c.Query("reason")); reason != "" {
+		query = query.Where("reason = ?", reason)
+	}
+	if fileIDStr := strings.TrimSpace(c.Query("fileID")); fileIDStr != "" {
+		fileID, err := parseUUID(fileIDStr)
+		if err != nil {
+			return utils.Fail(c, errInvalidFileID)
+		}
+		query = query.Where("file_id = ?", fileID)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting reports")
+	}
+
+	var reports []models.AbuseReport
+	if err := utils.ApplyPagination(query.Preload("File").Preload("Reporter").Order("created_at DESC, id DESC"), p).Find(&reports).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing reports")
+	}
+
+	return utils.Paginated(c, reports, p.Page, p.Limit, total)
+}
+
+func (h *ModerationHandler) GetReport(c *fiber.Ctx) error {
+	reportID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidReportID)
+	}
+
+	var report models.AbuseReport
+	if err := h.DB.Preload("File.Owner").Preload("Share").Preload("Reporter").First(&report, "id = ?", reportID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Fail(c, errReportNotFound)
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading report")
+	}
+
+	return utils.Success(c, fiber.StatusOK, report)
+}
+
+// maxResolutionLength bounds the note a moderator leaves on a report.
+const maxResolutionLength = 1000
+
+type triageReportRequest struct {
+	Status     models.AbuseReportStatus `json:"status"`
+	Resolution string                   `json:"resolution"`
+}
+
+// UpdateReport triages a report: picks it up for review, puts it back in
+// the queue, or dismisses it.
+func (h *ModerationHandler) UpdateReport(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	reportID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidReportID)
+	}
+
+	var req triageReportRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	req.Resolution = strings.TrimSpace(req.Resolution)
+	if utf8.RuneCountInString(req.Resolution) > maxResolutionLength {
+		return utils.Error(c, fiber.StatusBadRequest, "resolution must be 1000 characters or fewer")
+	}
+
+	report, err := h.Moderation.Triage(c.Context(), reportID, req.Status, currentUser.ID, req.Resolution)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "report_update_failed", "failed updating report")))
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "admin.report_update",
+		ResourceType: "abuse_report",
+		ResourceID:   &report.ID,
+		Details:      moderationDetails(report, map[string]interface{}{"status": string(report.Status)}),
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusOK, report)
+}
+
+type reportActionRequest struct {
+	Action     models.ModerationAction `json:"action"`
+	Resolution string                  `json:"resolution"`
+}
+
+// ActOnReport disables the reported share, quarantines the file or
+// suspends its owner, and closes the report as actioned.
+func (h *ModerationHandler) ActOnReport(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	reportID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidReportID)
+	}
+
+	var req reportActionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	req.Resolution = strings.TrimSpace(req.Resolution)
+	if utf8.RuneCountInString(req.Resolution) > maxResolutionLength {
+		return utils.Error(c, fiber.StatusBadRequest, "resolution must be 1000 characters or fewer")
+	}
+
+	report, err := h.Moderation.Act(c.Context(), reportID, req.Action, currentUser.ID, req.Resolution)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "report_action_failed", "failed acting on report")))
+	}
+
+	logger.InfoWithUser(currentUser.ID.String(), "moderation_action", map[string]interface{}{
+		"report_id": report.ID.String(),
+		"action":    string(req.Action),
+		"file_id":   report.FileID.String(),
+	})
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "admin.report_action",
+		ResourceType: "abuse_report",
+		ResourceID:   &report.ID,
+		Details:      moderationDetails(report, map[string]interface{}{"action": string(req.Action)}),
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusOK, report)
+}
+
+// ReleaseFile lifts the quarantine on a file.
+func (h *ModerationHandler) ReleaseFile(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+
+	file, err := h.Moderation.ReleaseFile(c.Context(), fileID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.Fail(c, errFileNotFound)
+	}
+	if err != nil {
+		return utils.Fail(c, serviceError(err, errLoadingFile))
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "admin.file_release",
+		ResourceType: "file",
+		ResourceID:   &file.ID,
+		Details: map[string]interface{}{
+			"file_id":   file.ID.String(),
+			"file_name": file.Name,
+			"owner_id":  file.OwnerID.String(),
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusOK, file)
+}
+
+// moderationDetails describes a report for the audit log, with the IDs
+// the activity feed uses to notify the owner and reporter.
+func moderationDetails(report *models.AbuseReport, extra map[string]interface{}) map[string]interface{} {
+	details := map[string]interface{}{
+		"report_id":  report.ID.String(),
+		"file_id":    report.FileID.String(),
+		"file_name":  report.File.Name,
+		"owner_id":   report.File.OwnerID.String(),
+		"reason":     string(report.Reason),
+		"resolution": report.Resolution,
+	}
+	if report.ShareID != nil {
+		details["share_id"] = report.ShareID.String()
+	}
+	if report.ReporterID != nil {
+		details["reporter_id"] = report.ReporterID.String()
+	}
+	for k, v := range extra {
+		details[k] = v
+	}
+	return details
+}
+
+// captchaToken reads a CAPTCHA solution from the X-Captcha-Token header or,
+// for plain links where no header can be set, the captchaToken query
+// parameter.
+func captchaToken(c *fiber.Ctx) string {
+	if token := c.Get("X-Captcha-Token"); token != "" {
+		return token
+	}
+	return c.Query("captchaToken")
+}
+
+// failCaptcha reports a CAPTCHA check that didn't pass. Anything other than
+// a missing or wrong solution means the provider couldn't be reached.
+func failCaptcha(c *fiber.Ctx, err error) error {
+	apiErr := serviceError(err, errCaptchaUnavailable)
+	if apiErr == errCaptchaUnavailable {
+		logger.Error("captcha_verify_failed", err, map[string]interface{}{
+			"ip":         c.IP(),
+			"request_id": getRequestID(c),
+		})
+	}
+	return utils.Fail(c, apiErr)
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+)
+
+func setupCaptchaTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	verifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("secret") == "captcha-secret" && r.FormValue("response") == "solved" {
+			_, _ = w.Write([]byte(`{"success":true}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success":false,"error-codes":["invalid-input-response"]}`))
+	}))
+	t.Cleanup(verifier.Close)
+
+	return setupTestEnvWithConfig(t, func(cfg *config.Config) {
+		cfg.Captcha = config.CaptchaConfig{
+			Provider:  "turnstile",
+			SiteKey:   "captcha-site",
+			SecretKey: "captcha-secret",
+			VerifyURL: verifier.URL,
+		}
+	})
+}
+
+func createPublicDirectory(t *testing.T, env *testEnv, owner *models.User, name string) models.File {
+	t.Helper()
+	dir := models.File{Name: name, MimeType: "inode/directory", IsDirectory: true, OwnerID: owner.ID}
+	if err := env.db.Create(&dir).Error; err != nil {
+		t.Fatalf("failed creating directory: %v", err)
+	}
+	share := models.Share{FileID: dir.ID, SharedByID: owner.ID, ShareType: models.ShareTypePublicAnyone, Permission: models.SharePermissionDownload}
+	if err := env.db.Create(&share).Error; err != nil {
+		t.Fatalf("failed creating share: %v", err)
+	}
+	return dir
+}
+
+func TestPublicDownloadCaptcha(t *testing.T) {
+	env := setupCaptchaTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "captcha-owner@test.com", "password123", models.UserRoleUser)
+	// Directories can't be downloaded, so getting past the CAPTCHA shows as
+	// a 400 without needing object storage.
+	dir := createPublicDirectory(t, env, owner, "captcha-dir")
+	path := "/api/public/files/" + dir.ID.String()
+
+	resp := performRequest(t, env.app, http.MethodGet, path+"/meta", nil, nil)
+	body := decodeJSONMap(t, resp)
+	assertStatus(t, resp, http.StatusOK)
+	captcha, _ := body["data"].(map[string]any)["captcha"].(map[string]any)
+	if captcha["provider"] != "turnstile" || captcha["siteKey"] != "captcha-site" {
+		t.Fatalf("expected the widget advertised, got %v", body["data"])
+	}
+
+	resp = performRequest(t, env.app, http.MethodGet, path+"/download", nil, nil)
+	body = decodeJSONMap(t, resp)
+	assertStatus(t, resp, http.StatusForbidden)
+	if body["code"] != "captcha_required" {
+		t.Fatalf("expected captcha_required, got %v", body)
+	}
+
+	resp = performRequest(t, env.app, http.MethodGet, path+"/download", nil, map[string]string{"X-Captcha-Token": "guessed"})
+	body = decodeJSONMap(t, resp)
+	assertStatus(t, resp, http.StatusForbidden)
+	if body["code"] != "captcha_failed" {
+		t.Fatalf("expected captcha_failed, got %v", body)
+	}
+
+	resp = performRequest(t, env.app, http.MethodGet, path+"/download?captchaToken=solved", nil, nil)
+	assertStatus(t, resp, http.StatusBadRequest)
+
+	resp = performRequest(t, env.app, http.MethodGet, path+"/download", nil, nil)
+	assertStatus(t, resp, http.StatusBadRequest)
+	resp = performRequest(t, env.app, http.MethodGet, path+"/meta", nil, nil)
+	body = decodeJSONMap(t, resp)
+	if _, ok := body["data"].(map[string]any)["captcha"]; ok {
+		t.Fatalf("expected no CAPTCHA once the address has passed, got %v", body["data"])
+	}
+
+	other := createPublicDirectory(t, env, owner, "captcha-other")
+	resp = performRequest(t, env.app, http.MethodGet, "/api/public/files/"+other.ID.String()+"/download", nil, nil)
+	assertStatus(t, resp, http.StatusForbidden)
+
+	resp = performRequest(t, env.app, http.MethodGet, "/api/public/files/"+other.ID.String()+"/download", nil, authHeaders(ownerToken))
+	assertStatus(t, resp, http.StatusBadRequest)
+}
+
+func TestAbuseReports(t *testing.T) {
+	env := setupCaptchaTestEnv(t)
+	owner, _ := createTestUser(t, env.db, "reported-owner@test.com", "password123", models.UserRoleUser)
+	reporter, reporterToken := createTestUser(t, env.db, "reporter@test.com", "password123", models.UserRoleUser)
+	_, adminToken := createTestUser(t, env.db, "moderator@test.com", "password123", models.UserRoleAdmin)
+	dir := createPublicDirectory(t, env, owner, "reported-dir")
+	path := "/api/public/files/" + dir.ID.String() + "/report"
+
+	t.Run("validates the report", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, path, map[string]any{"reason": "boring"}, authHeaders(reporterToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, path, map[string]any{"reason": "spam", "email": "not-an-email"}, authHeaders(reporterToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+
+		private := models.File{Name: "private.txt", MimeType: "text/plain", OwnerID: owner.ID, StoragePath: "private.txt"}
+		env.db.Create(&private)
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/public/files/"+private.ID.String()+"/report", map[string]any{"reason": "spam"}, authHeaders(reporterToken))
+		assertStatus(t, resp, http.StatusNotFound)
+	})
+
+	t.Run("anonymous reporters solve a CAPTCHA", func(t *testing.T) {
+		report := map[string]any{"reason": "phishing", "details": "asks for bank details", "email": "visitor@example.com"}
+		resp := performJSONRequest(t, env.app, http.MethodPost, path, report, nil)
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusForbidden)
+		if body["code"] != "captcha_required" {
+			t.Fatalf("expected captcha_required, got %v", body)
+		}
+
+		report["captchaToken"] = "solved"
+		resp = performJSONRequest(t, env.app, http.MethodPost, path, report, nil)
+		assertStatus(t, resp, http.StatusCreated)
+	})
+
+	t.Run("signed-in reporters are deduplicated", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, path, map[string]any{"reason": "malware"}, authHeaders(reporterToken))
+		first := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusCreated)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, path, map[string]any{"reason": "malware"}, authHeaders(reporterToken))
+		second := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if first["data"].(map[string]any)["id"] != second["data"].(map[string]any)["id"] {
+			t.Fatalf("expected the open report returned, got %v and %v", first, second)
+		}
+
+		var report models.AbuseReport
+		env.db.First(&report, "reporter_id = ?", reporter.ID)
+		if report.ReporterEmail != reporter.Email || report.ShareID == nil {
+			t.Fatalf("expected the reporter and share recorded, got %+v", report)
+		}
+	})
+
+	t.Run("admins see the queue", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/admin/reports", nil, authHeaders(reporterToken))
+		assertStatus(t, resp, http.StatusForbidden)
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/admin/reports?status=open", nil, authHeaders(adminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		reports := body["data"].([]any)
+		if len(reports) != 2 {
+			t.Fatalf("expected 2 open reports, got %v", reports)
+		}
+		if reports[1].(map[string]any)["reason"] != "phishing" {
+			t.Fatalf("expected newest first, got %v", reports)
+		}
+	})
+}
+
+func TestModerationQueue(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "moderated-owner@test.com", "password123", models.UserRoleUser)
+	_, userToken := createTestUser(t, env.db, "bystander@test.com", "password123", models.UserRoleUser)
+	_, adminToken := createTestUser(t, env.db, "queue-admin@test.com", "password123", models.UserRoleAdmin)
+	dir := createPublicDirectory(t, env, owner, "moderated-dir")
+
+	var share models.Share
+	env.db.First(&share, "file_id = ?", dir.ID)
+	newReport := func() string {
+		report := models.AbuseReport{FileID: dir.ID, ShareID: &share.ID, ReporterIP: "203.0.113.9", Reason: models.AbuseReasonMalware, Status: models.AbuseReportStatusOpen}
+		if err := env.db.Create(&report).Error; err != nil {
+			t.Fatalf("failed creating report: %v", err)
+		}
+		return "/api/admin/reports/" + report.ID.String()
+	}
+	assertCode := func(t *testing.T, resp *http.Response, status int, code string) {
+		t.Helper()
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, status)
+		if body["code"] != code {
+			t.Fatalf("expected %s, got %v", code, body)
+		}
+	}
+
+	t.Run("admins only", func(t *testing.T) {
+		path := newReport()
+		resp := performRequest(t, env.app, http.MethodGet, path, nil, authHeaders(userToken))
+		assertStatus(t, resp, http.StatusForbidden)
+		resp = performJSONRequest(t, env.app, http.MethodPost, path+"/actions", map[string]any{"action": "suspend_owner"}, authHeaders(userToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("triage", func(t *testing.T) {
+		path := newReport()
+		resp := performRequest(t, env.app, http.MethodGet, path, nil, authHeaders(adminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		file, _ := body["data"].(map[string]any)["file"].(map[string]any)
+		if owner, _ := file["owner"].(map[string]any); owner["email"] != "moderated-owner@test.com" {
+			t.Fatalf("expected the file owner included, got %v", body["data"])
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPut, path, map[string]any{"status": "actioned"}, authHeaders(adminToken))
+		assertCode(t, resp, http.StatusBadRequest, "invalid_report_status")
+
+		resp = performJSONRequest(t, env.app, http.MethodPut, path, map[string]any{"status": "dismissed", "resolution": "not malware"}, authHeaders(adminToken))
+		body = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if body["data"].(map[string]any)["status"] != "dismissed" {
+			t.Fatalf("expected the report dismissed, got %v", body["data"])
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, path+"/actions", map[string]any{"action": "quarantine_file"}, authHeaders(adminToken))
+		assertCode(t, resp, http.StatusConflict, "report_closed")
+	})
+
+	t.Run("actions", func(t *testing.T) {
+		path := newReport()
+		resp := performJSONRequest(t, env.app, http.MethodPost, path+"/actions", map[string]any{"action": "delete"}, authHeaders(adminToken))
+		assertCode(t, resp, http.StatusBadRequest, "invalid_moderation_action")
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, path+"/actions", map[string]any{"action": "disable_share"}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		resp = performRequest(t, env.app, http.MethodGet, "/api/public/files/"+dir.ID.String()+"/meta", nil, nil)
+		assertStatus(t, resp, http.StatusNotFound)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, path+"/actions", map[string]any{"action": "quarantine_file"}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		resp = performRequest(t, env.app, http.MethodGet, "/api/files/"+dir.ID.String(), nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+
+		resp = performRequest(t, env.app, http.MethodDelete, "/api/admin/files/"+dir.ID.String()+"/quarantine", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		resp = performRequest(t, env.app, http.MethodGet, "/api/files/"+dir.ID.String(), nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		resp = performRequest(t, env.app, http.MethodDelete, "/api/admin/files/"+dir.ID.String()+"/quarantine", nil, authHeaders(adminToken))
+		assertCode(t, resp, http.StatusConflict, "file_not_quarantined")
+	})
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultNotifyTimeout = 30 * time.Second
+	maxNotifyTimeout     = 90 * time.Second
+)
+
+type NotifyHandler struct {
+	Feed *services.ChangeFeed
+}
+
+func NewNotifyHandler(feed *services.ChangeFeed) *NotifyHandler {
+	return &NotifyHandler{Feed: feed}
+}
+
+type notifyResponse struct {
+	Changes []services.FileChange `json:"changes"`
+	Cursor  string                `json:"cursor"`
+}
+
+// Notify long-polls for file changes affecting the caller. Without a since
+// cursor it answers at once with a cursor for "now"; with one it blocks
+// until there are changes after it or the timeout passes, and answers with
+// the changes (possibly none) and the cursor to pass next time.
+func (h *NotifyHandler) Notify(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	timeout, ok := parseNotifyTimeout(c.Query("timeout"))
+	if !ok {
+		return utils.Fail(c, errInvalidNotifyTimeout)
+	}
+
+	since := c.Query("since")
+	if since == "" {
+		head, err := h.Feed.Head(c.Context())
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed reading changes")
+		}
+		return utils.Success(c, fiber.StatusOK, notifyResponse{
+			Changes: []services.FileChange{},
+			Cursor:  utils.TimeCursor(head.At, head.ID),
+		})
+	}
+
+	cur, err := utils.DecodeCursor(since)
+	if err != nil {
+		return utils.Fail(c, errInvalidCursor)
+	}
+	at, err := time.Parse(time.RFC3339Nano, cur.Value)
+	if err != nil {
+		return utils.Fail(c, errInvalidCursor)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), timeout)
+	defer cancel()
+	changes, next, err := h.Feed.Wait(ctx, currentUser.ID, services.ChangePosition{At: at, ID: cur.ID})
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed reading changes")
+	}
+
+	return utils.Success(c, fiber.StatusOK, notifyResponse{
+		Changes: changes,
+		Cursor:  utils.TimeCursor(next.At, next.ID),
+	})
+}
+
+// parseNotifyTimeout accepts a Go duration ("30s") or a number of seconds,
+// up to maxNotifyTimeout.
+func parseNotifyTimeout(raw string) (time.Duration, bool) {
+	if raw == "" {
+		return defaultNotifyTimeout, true
+	}
+	timeout, err := time.ParseDuration(raw)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(raw)
+		if convErr != nil {
+			return 0, false
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+	if timeout <= 0 || timeout > maxNotifyTimeout {
+		return 0, false
+	}
+	return timeout, true
+}
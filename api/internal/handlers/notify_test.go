@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestNotifyLongPoll(t *testing.T) {
+	env := setupTestEnv(t)
+	_, ownerToken := createTestUser(t, env.db, "notify-owner@test.com", "password123", models.UserRoleUser)
+	_, otherToken := createTestUser(t, env.db, "notify-other@test.com", "password123", models.UserRoleUser)
+
+	// The feed only reads events that have had time to commit, so the
+	// folder events are backdated rather than waited for.
+	createFolder := func(t *testing.T, name string, age time.Duration) string {
+		t.Helper()
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/directory", map[string]any{"name": name}, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusCreated)
+		id := body["data"].(map[string]any)["id"].(string)
+		env.db.Model(&models.OutboxEvent{}).Where("resource_id = ?", id).Update("created_at", time.Now().UTC().Add(-age))
+		return id
+	}
+	notify := func(t *testing.T, token, query string) map[string]any {
+		t.Helper()
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/notify?"+query, nil, authHeaders(token))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		return body["data"].(map[string]any)
+	}
+
+	createFolder(t, "Before", time.Hour)
+	head := notify(t, ownerToken, "")
+	if len(head["changes"].([]any)) != 0 || head["cursor"] == "" {
+		t.Fatalf("expected a cursor and no changes without since, got %v", head)
+	}
+	cursor := url.QueryEscape(head["cursor"].(string))
+
+	folderID := createFolder(t, "After", time.Minute)
+	got := notify(t, ownerToken, "since="+cursor)
+	changes := got["changes"].([]any)
+	if len(changes) != 1 {
+		t.Fatalf("expected the new folder, got %v", got)
+	}
+	change := changes[0].(map[string]any)
+	if change["eventType"] != "folder.create" || change["fileID"] != folderID {
+		t.Fatalf("unexpected change: %v", change)
+	}
+	if got["cursor"] == head["cursor"] {
+		t.Fatal("expected the cursor to move past the change")
+	}
+
+	started := time.Now()
+	got = notify(t, otherToken, "since="+cursor+"&timeout=1s")
+	if len(got["changes"].([]any)) != 0 {
+		t.Fatalf("expected another user's folder to stay hidden, got %v", got)
+	}
+	if elapsed := time.Since(started); elapsed < time.Second {
+		t.Fatalf("expected the request to block until the timeout, returned after %s", elapsed)
+	}
+
+	for _, query := range []string{"since=" + cursor + "&timeout=5m", "since=" + cursor + "&timeout=soon", "since=garbage"} {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/notify?"+query, nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"errors"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OrganizationsHandler manages tenants. Everything but Current is reserved
+// for admins of the default tenant.
+type OrganizationsHandler struct {
+	DB    *gorm.DB
+	Audit *services.AuditService
+	// Settings, when set, supplies the quota of organizations created
+	// without one.
+	Settings *services.SettingsService
+}
+
+func NewOrganizationsHandler(db *gorm.DB, audit *services.AuditService) *OrganizationsHandler {
+	return &OrganizationsHandler{DB: db, Audit: audit}
+}
+
+type organizationAdminRequest struct {
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+type createOrganizationRequest struct {
+	Name              string                    `json:"name"`
+	Slug              string                    `json:"slug"`
+	StorageQuotaBytes *int64                    `json:"storageQuotaBytes"`
+	Admin             *organizationAdminRequest `json:"admin"`
+}
+
+type updateOrganizationRequest struct {
+	Name              *string `json:"name"`
+	StorageQuotaBytes *int64  `json:"storageQuotaBytes"`
+	ClearStorageQuota bool    `json:"clearStorageQuota"`
+	// MFARequirement overrides the server's MFA policy; "" restores it.
+	MFARequirement *models.MFARequirement `json:"mfaRequirement"`
+	// BrandLogoURL and BrandColor restyle public share pages; "" restores
+	// the server's branding.
+	BrandLogoURL *string `json:"brandLogoURL"`
+	BrandColor   *string `json:"brandColor"`
+}
+
+var brandColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+func (h *OrganizationsHandler) List(c *fiber.Ctx) error {
+	p := utils.ParsePagination(c)
+
+	var total int64
+	if err := h.DB.Model(&models.Organization{}).Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting organizations")
+	}
+
+	var orgs []models.Organization
+	if err := h.DB.Order("name ASC").Offset(p.Offset).Limit(p.Limit).Find(&orgs).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing organizations")
+	}
+
+	return utils.Paginated(c, orgs, p.Page, p.Limit, total)
+}
+
+func (h *OrganizationsHandler) Create(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	var req createOrganizationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	req.Slug = strings.ToLower(strings.TrimSpace(req.Slug))
+	if req.Name == "" {
+		return utils.Error(c, fiber.StatusBadRequest, "name is required")
+	}
+	if !services.ValidOrganizationSlug(req.Slug) {
+		return utils.Error(c, fiber.StatusBadRequest, "slug must be a lowercase DNS label")
+	}
+	if req.StorageQuotaBytes != nil && *req.StorageQuotaBytes < 0 {
+		return utils.Error(c, fiber.StatusBadRequest, "storageQuotaBytes must not be negative")
+	}
+
+	var admin *models.User
+	if req.Admin != nil {
+		email := strings.ToLower(strings.TrimSpace(req.Admin.Email))
+		if _, err := mail.ParseAddress(email); err != nil {
+			return utils.Error(c, fiber.StatusBadRequest, "invalid admin email")
+		}
+		if len(req.Admin.Password) < 8 {
+			return utils.Error(c, fiber.StatusBadRequest, "admin password must be at least 8 characters")
+		}
+		firstName := strings.TrimSpace(req.Admin.FirstName)
+		lastName := strings.TrimSpace(req.Admin.LastName)
+		if firstName == "" || lastName == "" {
+			return utils.Error(c, fiber.StatusBadRequest, "admin firstName and lastName are required")
+		}
+		passwordHash, err := utils.HashPassword(req.Admin.Password)
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed to hash password")
+		}
+		admin = &models.User{
+			Email:        email,
+			PasswordHash: passwordHash,
+			FirstName:    firstName,
+			LastName:     lastName,
+			Role:         models.UserRoleAdmin,
+		}
+	}
+
+	org := models.Organization{
+		Name:              req.Name,
+		Slug:              req.Slug,
+		StorageQuotaBytes: req.StorageQuotaBytes,
+	}
+	if org.StorageQuotaBytes == nil && h.Settings != nil {
+		org.StorageQuotaBytes = h.Settings.DefaultOrganizationQuota(c.Context())
+	}
+
+	var apiErr *utils.APIError
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Organization{}).Where("slug = ?", org.Slug).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			apiErr = errOrganizationSlugTaken
+			return errOrganizationSlugTaken
+		}
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+
+		details := map[string]interface{}{
+			"name": org.Name,
+			"slug": org.Slug,
+		}
+		if admin != nil {
+			if err := tx.Model(&models.User{}).Where("email = ?", admin.Email).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				apiErr = errEmailRegistered
+				return errEmailRegistered
+			}
+			admin.OrganizationID = &org.ID
+			if err := tx.Create(admin).Error; err != nil {
+				return err
+			}
+			details["admin_email"] = admin.Email
+		}
+
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "organization.create",
+			ResourceType: "organization",
+			ResourceID:   &org.ID,
+			Details:      details,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		})
+	})
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed creating organization")
+	}
+
+	return utils.Success(c, fiber.StatusCreated, org)
+}
+
+func (h *OrganizationsHandler) Get(c *fiber.Ctx) error {
+	orgID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidOrganizationID)
+	}
+
+	org, apiErr := h.loadOrganization(c, orgID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	return utils.Success(c, fiber.StatusOK, org)
+}
+
+// Current returns the caller's organization with its storage usage. Data is
+// null for users of the default tenant.
+func (h *OrganizationsHandler) Current(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	if currentUser.OrganizationID == nil {
+		return utils.Success(c, fiber.StatusOK, nil)
+	}
+
+	org, apiErr := h.loadOrganization(c, *currentUser.OrganizationID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	return utils.Success(c, fiber.StatusOK, org)
+}
+
+func (h *OrganizationsHandler) Update(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	orgID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidOrganizationID)
+	}
+
+	var req updateOrganizationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return utils.Error(c, fiber.StatusBadRequest, "name cannot be empty")
+		}
+		updates["name"] = name
+	}
+	if req.ClearStorageQuota {
+		updates["storage_quota_bytes"] = nil
+	} else if req.StorageQuotaBytes != nil {
+		if *req.StorageQuotaBytes < 0 {
+			return utils.Error(c, fiber.StatusBadRequest, "storageQuotaBytes must not be negative")
+		}
+		updates["storage_quota_bytes"] = *req.StorageQuotaBytes
+	}
+	if req.MFARequirement != nil {
+		if *req.MFARequirement != "" && !req.MFARequirement.Valid() {
+			return utils.Error(c, fiber.StatusBadRequest, "mfaRequirement must be none, admins or all")
+		}
+		updates["mfa_requirement"] = string(*req.MFARequirement)
+	}
+	if req.BrandLogoURL != nil {
+		logo := strings.TrimSpace(*req.BrandLogoURL)
+		if logo != "" {
+			u, err := url.Parse(logo)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || len(logo) > 500 {
+				return utils.Error(c, fiber.StatusBadRequest, "brandLogoURL must be an http or https URL")
+			}
+		}
+		updates["brand_logo_url"] = logo
+	}
+	if req.BrandColor != nil {
+		color := strings.TrimSpace(*req.BrandColor)
+		if color != "" && !brandColorPattern.MatchString(color) {
+			return utils.Error(c, fiber.StatusBadRequest, "brandColor must be a hex color such as #1a73e8")
+		}
+		updates["brand_color"] = strings.ToLower(color)
+	}
+	if len(updates) == 0 {
+		return utils.Error(c, fiber.StatusBadRequest, "no updates provided")
+	}
+
+	if _, apiErr := h.loadOrganization(c, orgID); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Organization{}).Where("id = ?", orgID).Updates(updates).Error; err != nil {
+			return err
+		}
+		details := map[string]interface{}{}
+		for k, v := range updates {
+			details[k] = v
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "organization.update",
+			ResourceType: "organization",
+			ResourceID:   &orgID,
+			Details:      details,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		})
+	}); err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed updating organization")
+	}
+
+	org, apiErr := h.loadOrganization(c, orgID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	return utils.Success(c, fiber.StatusOK, org)
+}
+
+// Delete removes an organization that no longer has users. Its members have
+// to be deleted first so their files are cleaned up through the usual path.
+func (h *OrganizationsHandler) Delete(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	orgID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidOrganizationID)
+	}
+
+	org, apiErr := h.loadOrganization(c, orgID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	var members int64
+	if err := h.DB.Model(&models.User{}).Where("organization_id = ?", orgID).Count(&members).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting organization users")
+	}
+	if members > 0 {
+		return utils.Fail(c, errOrganizationNotEmpty)
+	}
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", orgID).Delete(&models.Group{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("organization_id = ?", orgID).Delete(&models.SSOProvider{}).Error; err != nil {
+			return err
+		}
+		// Hard delete so the slug can be reused.
+		if err := tx.Unscoped().Delete(&models.Organization{}, "id = ?", orgID).Error; err != nil {
+			return err
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "organization.delete",
+			ResourceType: "organization",
+			ResourceID:   &orgID,
+			Details: map[string]interface{}{
+				"name": org.Name,
+				"slug": org.Slug,
+			},
+			IPAddress: c.IP(),
+			RequestID: getRequestID(c),
+		})
+	}); err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed deleting organization")
+	}
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "organization deleted"})
+}
+
+// loadOrganization loads an organization together with its storage usage.
+func (h *OrganizationsHandler) loadOrganization(c *fiber.Ctx, orgID uuid.UUID) (*models.Organization, *utils.APIError) {
+	var org models.Organization
+	if err := h.DB.First(&org, "id = ?", orgID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errOrganizationNotFound
+		}
+		return nil, utils.NewError(fiber.StatusInternalServerError, "organization_load_failed", "failed loading organization")
+	}
+
+	used, err := services.OrganizationStorageUsed(c.Context(), h.DB, &org.ID)
+	if err != nil {
+		return nil, utils.NewError(fiber.StatusInternalServerError, "organization_load_failed", "failed loading organization usage")
+	}
+	org.StorageUsedBytes = used
+	return &org, nil
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestOrganizations(t *testing.T) {
+	env := setupTestEnv(t)
+	_, platformToken := createTestUser(t, env.db, "org-platform@test.com", "password123", models.UserRoleAdmin)
+	defaultUser, defaultToken := createTestUser(t, env.db, "org-default@test.com", "password123", models.UserRoleUser)
+
+	acme := map[string]string{"X-Organization": "acme"}
+	withTenant := func(token string, tenant map[string]string) map[string]string {
+		headers := authHeaders(token)
+		for k, v := range tenant {
+			headers[k] = v
+		}
+		return headers
+	}
+
+	var orgID string
+	t.Run("platform admin creates an organization with its admin", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/organizations/", map[string]any{
+			"name":              "Acme",
+			"slug":              "Acme",
+			"storageQuotaBytes": 1024,
+			"admin": map[string]any{
+				"email":     "org-acme-admin@test.com",
+				"password":  "password123",
+				"firstName": "Ada",
+				"lastName":  "Admin",
+			},
+		}, authHeaders(platformToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusCreated)
+		data := body["data"].(map[string]any)
+		if data["slug"] != "acme" {
+			t.Fatalf("expected slug acme, got %v", data["slug"])
+		}
+		orgID = data["id"].(string)
+	})
+
+	t.Run("rejects duplicate and invalid slugs", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/organizations/", map[string]any{"name": "Acme 2", "slug": "acme"}, authHeaders(platformToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusConflict)
+		if body["code"] != "organization_slug_taken" {
+			t.Fatalf("expected organization_slug_taken, got %v", body["code"])
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/organizations/", map[string]any{"name": "Bad", "slug": "-bad-"}, authHeaders(platformToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+
+	var acmeAdminToken string
+	t.Run("organization admin logs in on its own tenant only", func(t *testing.T) {
+		creds := map[string]any{"email": "org-acme-admin@test.com", "password": "password123"}
+
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/auth/login", creds, nil)
+		assertStatus(t, resp, http.StatusUnauthorized)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/auth/login", creds, acme)
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		acmeAdminToken = body["data"].(map[string]any)["token"].(string)
+	})
+
+	t.Run("organization admins cannot manage organizations", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/organizations/", nil, withTenant(acmeAdminToken, acme))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("tokens are refused on another tenant", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/auth/me", nil, authHeaders(acmeAdminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusForbidden)
+		if body["code"] != "organization_mismatch" {
+			t.Fatalf("expected organization_mismatch, got %v", body["code"])
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/auth/me", nil, withTenant(defaultToken, acme))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("unknown tenant is not found", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/auth/login", map[string]any{"email": "x@test.com", "password": "password123"}, map[string]string{"X-Organization": "nope"})
+		assertStatus(t, resp, http.StatusNotFound)
+	})
+
+	var memberToken string
+	var memberID string
+	t.Run("registration lands in the request tenant", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/auth/register", map[string]any{
+			"email":     "org-acme-member@test.com",
+			"password":  "password123",
+			"firstName": "Mem",
+			"lastName":  "Ber",
+		}, acme)
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusCreated)
+		data := body["data"].(map[string]any)
+		memberToken = data["token"].(string)
+		user := data["user"].(map[string]any)
+		memberID = user["id"].(string)
+		if user["organizationID"] != orgID {
+			t.Fatalf("expected organizationID %s, got %v", orgID, user["organizationID"])
+		}
+	})
+
+	t.Run("user listing is scoped to the tenant", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/users/", nil, withTenant(acmeAdminToken, acme))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if n := len(body["data"].([]any)); n != 2 {
+			t.Fatalf("expected 2 acme users, got %d", n)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/users/"+defaultUser.ID.String(), nil, withTenant(acmeAdminToken, acme))
+		assertStatus(t, resp, http.StatusNotFound)
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/users/search?search=org-", nil, withTenant(memberToken, acme))
+		body = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		for _, item := range body["data"].([]any) {
+			if item.(map[string]any)["email"] == defaultUser.Email {
+				t.Fatal("search returned a user of another tenant")
+			}
+		}
+	})
+
+	t.Run("shares cannot cross tenants", func(t *testing.T) {
+		doc := models.File{Name: "acme.txt", MimeType: "text/plain", Size: 10, OwnerID: uuid.MustParse(memberID), StoragePath: "acme.txt", OrganizationID: ptrUUID(uuid.MustParse(orgID))}
+		if err := env.db.Create(&doc).Error; err != nil {
+			t.Fatalf("failed creating file: %v", err)
+		}
+
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+doc.ID.String()+"/share", map[string]any{
+			"userID":     defaultUser.ID.String(),
+			"permission": "view",
+		}, withTenant(memberToken, acme))
+		assertStatus(t, resp, http.StatusNotFound)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+doc.ID.String()+"/share", map[string]any{
+			"shareType":  "public_anyone",
+			"permission": "view",
+		}, withTenant(memberToken, acme))
+		assertStatus(t, resp, http.StatusCreated)
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/public/files/"+doc.ID.String(), nil, acme)
+		assertStatus(t, resp, http.StatusOK)
+		resp = performRequest(t, env.app, http.MethodGet, "/api/public/files/"+doc.ID.String(), nil, nil)
+		assertStatus(t, resp, http.StatusNotFound)
+	})
+
+	t.Run("storage quota is enforced", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/upload/presign", map[string]any{
+			"name": "big.bin",
+			"size": 2048,
+		}, withTenant(memberToken, acme))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusInsufficientStorage)
+		if body["code"] != "storage_quota_exceeded" {
+			t.Fatalf("expected storage_quota_exceeded, got %v", body["code"])
+		}
+	})
+
+	t.Run("current organization reports usage", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/organizations/current", nil, withTenant(memberToken, acme))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if used := body["data"].(map[string]any)["storageUsedBytes"]; used != float64(10) {
+			t.Fatalf("expected 10 bytes used, got %v", used)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/organizations/current", nil, authHeaders(defaultToken))
+		body = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if body["data"] != nil {
+			t.Fatalf("expected null for the default tenant, got %v", body["data"])
+		}
+	})
+
+	t.Run("branding is validated and reported", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/organizations/"+orgID, map[string]any{
+			"brandColor": "blue",
+		}, authHeaders(platformToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+
+		resp = performJSONRequest(t, env.app, http.MethodPut, "/api/organizations/"+orgID, map[string]any{
+			"brandLogoURL": "javascript:alert(1)",
+		}, authHeaders(platformToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+
+		resp = performJSONRequest(t, env.app, http.MethodPut, "/api/organizations/"+orgID, map[string]any{
+			"brandColor": "#1A73E8", "brandLogoURL": "https://acme.example/logo.png",
+		}, authHeaders(platformToken))
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/organizations/current", nil, withTenant(memberToken, acme))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if color := body["data"].(map[string]any)["brandColor"]; color != "#1a73e8" {
+			t.Fatalf("expected the brand color, got %v", color)
+		}
+	})
+
+	t.Run("organizations with users cannot be deleted", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodDelete, "/api/organizations/"+orgID, nil, authHeaders(platformToken))
+		assertStatus(t, resp, http.StatusConflict)
+	})
+}
+
+func ptrUUID(id uuid.UUID) *uuid.UUID {
+	return &id
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestMutationsWriteOutboxEvents(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "outbox-owner@test.com", "password123", models.UserRoleUser)
+	other, _ := createTestUser(t, env.db, "outbox-other@test.com", "password123", models.UserRoleUser)
+
+	eventsFor := func(t *testing.T, eventType string) []models.OutboxEvent {
+		t.Helper()
+		var events []models.OutboxEvent
+		if err := env.db.Where("event_type = ?", eventType).Find(&events).Error; err != nil {
+			t.Fatalf("failed loading outbox: %v", err)
+		}
+		return events
+	}
+
+	var folderID string
+	t.Run("POST /api/files/directory records folder.create", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/directory", map[string]any{"name": "Outbox"}, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusCreated)
+		folderID = body["data"].(map[string]any)["id"].(string)
+
+		events := eventsFor(t, "folder.create")
+		if len(events) != 1 || events[0].ResourceID == nil || events[0].ResourceID.String() != folderID {
+			t.Fatalf("expected one folder.create event for the folder, got %+v", events)
+		}
+		if events[0].ActorID == nil || *events[0].ActorID != owner.ID || events[0].DispatchedAt != nil {
+			t.Fatalf("expected pending event attributed to owner, got %+v", events[0])
+		}
+	})
+
+	t.Run("POST /api/files/:id/share records share.create", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+folderID+"/share", map[string]any{
+			"userID":     other.ID.String(),
+			"permission": "view",
+		}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusCreated)
+		if events := eventsFor(t, "share.create"); len(events) != 1 || events[0].Payload["share_id"] == nil {
+			t.Fatalf("expected share.create event with share id, got %+v", events)
+		}
+	})
+
+	t.Run("PUT /api/files/:id records file.update", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/files/"+folderID, map[string]any{"name": "Renamed"}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		events := eventsFor(t, "file.update")
+		if len(events) != 1 || events[0].Payload["file_name"] != "Renamed" {
+			t.Fatalf("expected file.update event with new name, got %+v", events)
+		}
+	})
+}
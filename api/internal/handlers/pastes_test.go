@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/google/uuid"
+)
+
+func TestPastes(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "paste-owner@test.com", "password123", models.UserRoleUser)
+	other, otherToken := createTestUser(t, env.db, "paste-other@test.com", "password123", models.UserRoleUser)
+
+	var pasteFile map[string]any
+	t.Run("public paste", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/pastes", map[string]any{
+			"content":  "package main\n\nfunc main() {}\n",
+			"language": "go",
+		}, authHeaders(ownerToken))
+		decoded := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusCreated)
+		data := decoded["data"].(map[string]any)
+		paste := data["paste"].(map[string]any)
+		pasteFile = paste["file"].(map[string]any)
+		if paste["language"] != "go" || !strings.HasPrefix(pasteFile["name"].(string), "paste-") || !strings.HasSuffix(pasteFile["name"].(string), ".go") {
+			t.Fatalf("unexpected paste %v", paste)
+		}
+		if data["url"] != "http://localhost:3001/shared/"+pasteFile["id"].(string) {
+			t.Fatalf("expected a public link, got %v", data["url"])
+		}
+		share := data["share"].(map[string]any)
+		if share["shareType"] != "public_anyone" || share["quickShare"] != true || data["expiresAt"] == nil {
+			t.Fatalf("unexpected share %v", share)
+		}
+
+		var stored models.File
+		env.db.First(&stored, "id = ?", pasteFile["id"])
+		var folder models.File
+		env.db.First(&folder, "id = ?", stored.ParentID)
+		if folder.Name != "Pastes" || folder.ParentID != nil || stored.Size != 29 || stored.Checksum == nil {
+			t.Fatalf("expected the paste in the Pastes folder, got %+v in %+v", stored, folder)
+		}
+		if got := string(env.uploads.objects[stored.StoragePath]); got != "package main\n\nfunc main() {}\n" {
+			t.Fatalf("expected the content stored, got %q", got)
+		}
+	})
+
+	t.Run("private paste into a folder", func(t *testing.T) {
+		logs := models.File{Name: "Logs", IsDirectory: true, OwnerID: owner.ID}
+		env.db.Create(&logs)
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/pastes", map[string]any{
+			"content":  "error: disk full\n",
+			"name":     "build.log",
+			"parentID": logs.ID.String(),
+			"public":   false,
+		}, authHeaders(ownerToken))
+		decoded := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusCreated)
+		data := decoded["data"].(map[string]any)
+		file := data["paste"].(map[string]any)["file"].(map[string]any)
+		if file["name"] != "build.log" || file["parentID"] != logs.ID.String() || !strings.HasPrefix(file["mimeType"].(string), "text/") {
+			t.Fatalf("unexpected file %v", file)
+		}
+		if _, ok := data["url"]; ok {
+			t.Fatalf("expected no link for a private paste, got %v", data["url"])
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/pastes", map[string]any{
+			"content":  "x",
+			"parentID": logs.ID.String(),
+		}, authHeaders(otherToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("not into a vault", func(t *testing.T) {
+		vaultID := uuid.New()
+		folder := models.File{BaseModel: models.BaseModel{ID: vaultID}, Name: "Secrets", IsDirectory: true, OwnerID: owner.ID, VaultID: &vaultID}
+		env.db.Create(&folder)
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/pastes", map[string]any{
+			"content":  "token=hunter2\n",
+			"parentID": folder.ID.String(),
+		}, authHeaders(ownerToken))
+		decoded := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusConflict)
+		if decoded["code"] != "vault_content" {
+			t.Fatalf("expected vault_content, got %v", decoded["code"])
+		}
+		var stored int64
+		env.db.Model(&models.File{}).Where("parent_id = ?", folder.ID).Count(&stored)
+		if stored != 0 {
+			t.Fatalf("expected nothing stored in the vault, got %d files", stored)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, tc := range []struct {
+			body   map[string]any
+			status int
+			code   string
+		}{
+			{map[string]any{"content": ""}, http.StatusBadRequest, "invalid_paste"},
+			{map[string]any{"content": "a\x00b"}, http.StatusBadRequest, "invalid_paste"},
+			{map[string]any{"content": "a", "language": "cobol"}, http.StatusBadRequest, "invalid_paste"},
+			{map[string]any{"content": strings.Repeat("a", 64*1024+1)}, http.StatusRequestEntityTooLarge, "paste_too_large"},
+			{map[string]any{"content": "a", "expiresIn": "soon"}, http.StatusBadRequest, "invalid_expires_in"},
+		} {
+			resp := performJSONRequest(t, env.app, http.MethodPost, "/api/pastes", tc.body, authHeaders(otherToken))
+			decoded := decodeJSONMap(t, resp)
+			if resp.StatusCode != tc.status || decoded["code"] != tc.code {
+				t.Errorf("%v: expected %d %s, got %d %v", tc.body["language"], tc.status, tc.code, resp.StatusCode, decoded["code"])
+			}
+		}
+		// A link that could not be made leaves no paste behind.
+		var pastes int64
+		env.db.Model(&models.File{}).Where("owner_id = ? AND is_directory = ?", other.ID, false).Count(&pastes)
+		if pastes != 0 {
+			t.Fatalf("expected no pastes stored, got %d", pastes)
+		}
+	})
+
+	t.Run("listing", func(t *testing.T) {
+		env.db.Delete(&models.File{}, "id = ?", pasteFile["id"])
+		resp := performRequest(t, env.app, http.MethodGet, "/api/pastes", nil, authHeaders(ownerToken))
+		decoded := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		list := decoded["data"].([]any)
+		if len(list) != 1 || list[0].(map[string]any)["file"].(map[string]any)["name"] != "build.log" {
+			t.Fatalf("expected only the remaining paste, got %v", list)
+		}
+	})
+
+	t.Run("hourly limit", func(t *testing.T) {
+		// Two pastes so far; the test limit is five an hour.
+		for i := 0; i < 3; i++ {
+			resp := performJSONRequest(t, env.app, http.MethodPost, "/api/pastes", map[string]any{"content": "x", "public": false}, authHeaders(ownerToken))
+			assertStatus(t, resp, http.StatusCreated)
+		}
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/pastes", map[string]any{"content": "x", "public": false}, authHeaders(ownerToken))
+		decoded := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusTooManyRequests)
+		if decoded["code"] != "paste_rate_limited" {
+			t.Fatalf("expected paste_rate_limited, got %v", decoded["code"])
+		}
+	})
+}
+
+func TestPastes_PublicSharingOff(t *testing.T) {
+	env := setupTestEnvWithConfig(t, func(cfg *config.Config) {
+		cfg.Pastes.PerHour = 0
+	})
+	_, token := createTestUser(t, env.db, "paste-off@test.com", "password123", models.UserRoleUser)
+	_, adminToken := createTestUser(t, env.db, "paste-admin@test.com", "password123", models.UserRoleAdmin)
+	putSettings(t, env, adminToken, map[string]any{services.SettingPublicSharing: false})
+
+	resp := performJSONRequest(t, env.app, http.MethodPost, "/api/pastes", map[string]any{"content": "x"}, authHeaders(token))
+	decoded := decodeJSONMap(t, resp)
+	assertStatus(t, resp, http.StatusForbidden)
+	if decoded["code"] != "public_sharing_disabled" {
+		t.Fatalf("expected public_sharing_disabled, got %v", decoded["code"])
+	}
+	resp = performJSONRequest(t, env.app, http.MethodPost, "/api/pastes", map[string]any{"content": "x", "public": false}, authHeaders(token))
+	assertStatus(t, resp, http.StatusCreated)
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
 )
 
 func TestPreviewEndpoints(t *testing.T) {
@@ -188,3 +189,83 @@ func TestPreviewEndpoints(t *testing.T) {
 		assertEnvelopeError(t, body, "unauthorized")
 	})
 }
+
+func TestPreviewTokenPolicy(t *testing.T) {
+	env := setupTestEnv(t)
+	_, adminToken := createTestUser(t, env.db, "token-admin@test.com", "password123", models.UserRoleAdmin)
+	owner, ownerToken := createTestUser(t, env.db, "token-owner@test.com", "password123", models.UserRoleUser)
+
+	// Redeeming a token for a directory stops at "cannot preview a
+	// directory", after the token was accepted and before storage is read.
+	folder := models.File{Name: "Gallery", MimeType: "inode/directory", IsDirectory: true, OwnerID: owner.ID}
+	if err := env.db.Create(&folder).Error; err != nil {
+		t.Fatalf("failed creating folder: %v", err)
+	}
+	issue := func(t *testing.T, query string) map[string]any {
+		t.Helper()
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/"+folder.ID.String()+"/preview"+query, nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		return decodeJSONMap(t, resp)["data"].(map[string]any)
+	}
+	proxy := func(t *testing.T, token, query string) *http.Response {
+		t.Helper()
+		return performRequest(t, env.app, http.MethodGet, "/api/files/"+folder.ID.String()+"/proxy?token="+token+query, nil, nil)
+	}
+
+	t.Run("reports the token's terms", func(t *testing.T) {
+		data := issue(t, "")
+		if data["scope"] != "full" || data["ttl"] != float64(900) || data["maxUses"] != float64(0) || data["expiresAt"] == nil {
+			t.Fatalf("unexpected token terms %v", data)
+		}
+		for i := 0; i < 3; i++ {
+			assertStatus(t, proxy(t, data["token"].(string), ""), http.StatusBadRequest)
+		}
+	})
+
+	t.Run("scopes thumbnail tokens", func(t *testing.T) {
+		data := issue(t, "?variant=thumb")
+		if data["scope"] != "thumb" {
+			t.Fatalf("expected a thumbnail token, got %v", data["scope"])
+		}
+		resp := proxy(t, data["token"].(string), "")
+		assertStatus(t, resp, http.StatusForbidden)
+		if code := decodeJSONMap(t, resp)["code"]; code != "preview_token_scope" {
+			t.Fatalf("expected preview_token_scope, got %v", code)
+		}
+		full := issue(t, "")["token"].(string)
+		assertStatus(t, proxy(t, full, "&variant=thumb"), http.StatusBadRequest)
+	})
+
+	t.Run("limits uses", func(t *testing.T) {
+		putSettings(t, env, adminToken, map[string]any{
+			services.SettingPreviewTokenPolicy:  services.PreviewTokenLimited,
+			services.SettingPreviewTokenMaxUses: 2,
+			services.SettingPreviewTokenTTL:     60,
+		})
+		t.Cleanup(func() {
+			putSettings(t, env, adminToken, map[string]any{
+				services.SettingPreviewTokenPolicy:  nil,
+				services.SettingPreviewTokenMaxUses: nil,
+				services.SettingPreviewTokenTTL:     nil,
+			})
+		})
+
+		data := issue(t, "")
+		if data["maxUses"] != float64(2) || data["ttl"] != float64(60) {
+			t.Fatalf("expected the limited policy, got %v", data)
+		}
+		token := data["token"].(string)
+		assertStatus(t, proxy(t, token, ""), http.StatusBadRequest)
+		assertStatus(t, proxy(t, token, "&variant=thumb"), http.StatusBadRequest)
+		resp := proxy(t, token, "")
+		assertStatus(t, resp, http.StatusUnauthorized)
+		if code := decodeJSONMap(t, resp)["code"]; code != "preview_token_used" {
+			t.Fatalf("expected preview_token_used, got %v", code)
+		}
+
+		putSettings(t, env, adminToken, map[string]any{services.SettingPreviewTokenPolicy: services.PreviewTokenSingleUse})
+		single := issue(t, "")["token"].(string)
+		assertStatus(t, proxy(t, single, ""), http.StatusBadRequest)
+		assertStatus(t, proxy(t, single, ""), http.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var errInvalidPropertyID = utils.NewError(fiber.StatusBadRequest, "invalid_property_id", "invalid property id")
+
+// PropertiesHandler lets platform admins define the custom properties
+// files can be given, and everyone list them.
+type PropertiesHandler struct {
+	DB         *gorm.DB
+	Properties *services.Properties
+	Audit      *services.AuditService
+}
+
+func NewPropertiesHandler(db *gorm.DB, properties *services.Properties, audit *services.AuditService) *PropertiesHandler {
+	return &PropertiesHandler{DB: db, Properties: properties, Audit: audit}
+}
+
+// propertyRequest is the body of the definition endpoints. Omitted fields
+// are left unchanged on update; key is only read on create.
+type propertyRequest struct {
+	Key         string               `json:"key"`
+	Label       *string              `json:"label"`
+	Description *string              `json:"description"`
+	Type        *models.PropertyType `json:"type"`
+	Position    *int                 `json:"position"`
+	Options     *[]string            `json:"options"`
+	Pattern     *string              `json:"pattern"`
+	Min         *float64             `json:"min"`
+	Max         *float64             `json:"max"`
+}
+
+func (req *propertyRequest) apply(def *models.PropertyDefinition) {
+	if req.Label != nil {
+		def.Label = *req.Label
+	}
+	if req.Description != nil {
+		def.Description = *req.Description
+	}
+	if req.Type != nil {
+		def.Type = *req.Type
+	}
+	if req.Position != nil {
+		def.Position = *req.Position
+	}
+	if req.Options != nil {
+		def.Options = *req.Options
+	}
+	if req.Pattern != nil {
+		def.Pattern = *req.Pattern
+	}
+	if req.Min != nil {
+		def.Min = req.Min
+	}
+	if req.Max != nil {
+		def.Max = req.Max
+	}
+}
+
+// List returns every property definition in display order.
+func (h *PropertiesHandler) List(c *fiber.Ctx) error {
+	defs, err := h.Properties.Definitions(c.Context())
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing properties")
+	}
+	return utils.Success(c, fiber.StatusOK, defs)
+}
+
+func (h *PropertiesHandler) Create(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	var req propertyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	def := models.PropertyDefinition{Key: req.Key, CreatedByID: currentUser.ID}
+	req.apply(&def)
+	if apiErr := h.validate(c, &def, ""); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	if err := h.DB.Create(&def).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed creating property")
+	}
+	h.audit(c, currentUser, "admin.property_create", &def)
+	return utils.Success(c, fiber.StatusCreated, def)
+}
+
+func (h *PropertiesHandler) Update(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	def, apiErr := h.load(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	var req propertyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	previousType := def.Type
+	req.apply(def)
+	if apiErr := h.validate(c, def, previousType); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	if err := h.DB.Save(def).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed updating property")
+	}
+	h.audit(c, currentUser, "admin.property_update", def)
+	return utils.Success(c, fiber.StatusOK, def)
+}
+
+// Delete removes a property and every file's value for it.
+func (h *PropertiesHandler) Delete(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	def, apiErr := h.load(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if err := h.Properties.DeleteDefinition(c.Context(), def); err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed deleting property")
+	}
+	h.audit(c, currentUser, "admin.property_delete", def)
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "property deleted"})
+}
+
+func (h *PropertiesHandler) validate(c *fiber.Ctx, def *models.PropertyDefinition, previousType models.PropertyType) *utils.APIError {
+	if err := h.Properties.Validate(c.Context(), def, previousType); err != nil {
+		if errors.Is(err, services.ErrPropertyDefinitionInvalid) {
+			return serviceError(err, nil).WithMessage(err.Error())
+		}
+		return utils.NewError(fiber.StatusInternalServerError, "property_check_failed", "failed checking property")
+	}
+	return nil
+}
+
+func (h *PropertiesHandler) load(c *fiber.Ctx) (*models.PropertyDefinition, *utils.APIError) {
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return nil, errInvalidPropertyID
+	}
+	def, err := h.Properties.Definition(c.Context(), id)
+	if err != nil {
+		return nil, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "property_load_failed", "failed loading property"))
+	}
+	return def, nil
+}
+
+func (h *PropertiesHandler) audit(c *fiber.Ctx, user *models.User, action string, def *models.PropertyDefinition) {
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &user.ID,
+		Action:       action,
+		ResourceType: "property",
+		ResourceID:   &def.ID,
+		Details: map[string]interface{}{
+			"key":   def.Key,
+			"label": def.Label,
+			"type":  string(def.Type),
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestProperties(t *testing.T) {
+	env := setupTestEnv(t)
+	_, adminToken := createTestUser(t, env.db, "props-admin@test.com", "password123", models.UserRoleAdmin)
+	owner, ownerToken := createTestUser(t, env.db, "props-owner@test.com", "password123", models.UserRoleUser)
+	_, otherToken := createTestUser(t, env.db, "props-other@test.com", "password123", models.UserRoleUser)
+
+	msa := models.File{Name: "msa.pdf", MimeType: "application/pdf", OwnerID: owner.ID}
+	nda := models.File{Name: "nda.pdf", MimeType: "application/pdf", OwnerID: owner.ID}
+	env.db.Create(&msa)
+	env.db.Create(&nda)
+
+	t.Run("only admins define properties", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/properties", map[string]any{"key": "client", "label": "Client", "type": "text"}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/admin/properties", map[string]any{"key": "stage", "label": "Stage", "type": "select"}, authHeaders(adminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusBadRequest)
+		if body["code"] != "invalid_property" {
+			t.Fatalf("expected invalid_property, got %v", body["code"])
+		}
+
+		for _, def := range []map[string]any{
+			{"key": "client", "label": "Client", "type": "text", "position": 1},
+			{"key": "budget", "label": "Budget", "type": "number", "min": 0},
+			{"key": "review_date", "label": "Review date", "type": "date"},
+		} {
+			resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/properties", def, authHeaders(adminToken))
+			assertStatus(t, resp, http.StatusCreated)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/properties", nil, authHeaders(otherToken))
+		assertStatus(t, resp, http.StatusOK)
+		if list := decodeJSONMap(t, resp)["data"].([]any); len(list) != 3 || list[2].(map[string]any)["key"] != "client" {
+			t.Fatalf("expected three properties, by position, got %v", list)
+		}
+	})
+
+	t.Run("files are given values", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/files/"+msa.ID.String()+"/properties", map[string]any{"properties": map[string]any{"client": "Acme"}}, authHeaders(otherToken))
+		assertStatus(t, resp, http.StatusForbidden)
+
+		resp = performJSONRequest(t, env.app, http.MethodPut, "/api/files/"+msa.ID.String()+"/properties", map[string]any{"properties": map[string]any{"budget": -5}}, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusBadRequest)
+		if body["code"] != "invalid_property_value" {
+			t.Fatalf("expected invalid_property_value, got %v", body["code"])
+		}
+
+		for file, values := range map[*models.File]map[string]any{
+			&msa: {"client": "Acme", "budget": 25000, "review_date": "2024-06-30"},
+			&nda: {"client": "Globex", "budget": 500, "review_date": "2025-01-15"},
+		} {
+			resp := performJSONRequest(t, env.app, http.MethodPut, "/api/files/"+file.ID.String()+"/properties", map[string]any{"properties": values}, authHeaders(ownerToken))
+			assertStatus(t, resp, http.StatusOK)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/files/"+msa.ID.String()+"/properties", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		props := decodeJSONMap(t, resp)["data"].(map[string]any)["properties"].(map[string]any)
+		if props["client"] != "Acme" || props["budget"] != float64(25000) || props["review_date"] != "2024-06-30" {
+			t.Fatalf("unexpected properties %v", props)
+		}
+	})
+
+	t.Run("search filters by property", func(t *testing.T) {
+		for query, want := range map[string]string{
+			"property.client=acme":                            "msa.pdf",
+			"property.budget.min=1000":                        "msa.pdf",
+			"property.review_date.min=2025-01-01":             "nda.pdf",
+			"property.client=Globex&property.budget.max=1000": "nda.pdf",
+		} {
+			resp := performRequest(t, env.app, http.MethodGet, "/api/files/search?"+query, nil, authHeaders(ownerToken))
+			assertStatus(t, resp, http.StatusOK)
+			files := decodeJSONMap(t, resp)["data"].([]any)
+			if len(files) != 1 || files[0].(map[string]any)["name"] != want {
+				t.Errorf("%s: expected only %s, got %v", query, want, files)
+			}
+		}
+	})
+}
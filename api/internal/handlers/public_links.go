@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/url"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	errLoginRequired     = utils.NewError(fiber.StatusUnauthorized, "unauthorized", "login required to access this file")
+	errInvalidPublicPath = utils.NewError(fiber.StatusBadRequest, "invalid_public_path", services.ErrInvalidPublicPath.Error())
+)
+
+// PublicLinkGet returns the file at the path under a public link. The
+// /public/links/:slug routes open a public share by its slug and reach the
+// files under a shared folder by their path relative to it, e.g.
+// /public/links/3f9c.../path/reports/q1.pdf. Unlike /public/files/:id they
+// never resolve anything outside the shared subtree, so a link cannot be
+// used to probe for other file IDs.
+func (h *FilesHandler) PublicLinkGet(c *fiber.Ctx) error {
+	_, file, err := h.resolvePublicLink(c)
+	if err != nil {
+		return utils.Fail(c, err)
+	}
+	if err := h.DB.Preload("Owner").First(file, "id = ?", file.ID).Error; err != nil {
+		return utils.Fail(c, errLoadingFile)
+	}
+	if utils.NotModified(c, fileETag(*file)) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	h.recordAccess(c, file, middleware.GetCurrentUser(c), models.FileAccessView)
+	return utils.Success(c, fiber.StatusOK, file)
+}
+
+// PublicLinkChildren lists the folder at the path under a public link.
+func (h *FilesHandler) PublicLinkChildren(c *fiber.Ctx) error {
+	_, file, err := h.resolvePublicLink(c)
+	if err != nil {
+		return utils.Fail(c, err)
+	}
+	if !file.IsDirectory {
+		return utils.Error(c, fiber.StatusBadRequest, "file is not a directory")
+	}
+	return h.publicChildrenPage(c, *file)
+}
+
+// PublicLinkDownload downloads the file at the path under a public link,
+// if the link allows downloads.
+func (h *FilesHandler) PublicLinkDownload(c *fiber.Ctx) error {
+	share, file, err := h.resolvePublicLink(c)
+	if err != nil {
+		return utils.Fail(c, err)
+	}
+	if share.Permission == models.SharePermissionView {
+		return utils.Fail(c, errInsufficientPermissions)
+	}
+	if middleware.GetCurrentUser(c) == nil && h.Captcha != nil {
+		if err := h.Captcha.Check(c.Context(), share.ID, c.IP(), captchaToken(c)); err != nil {
+			return failCaptcha(c, err)
+		}
+	}
+	return h.downloadFile(c, file.ID)
+}
+
+// resolvePublicLink finds the share named by :slug and the file at the
+// path in the wildcard, requiring a signed-in caller for public_logged_in
+// shares. Its errors are ready to pass to utils.Fail.
+func (h *FilesHandler) resolvePublicLink(c *fiber.Ctx) (*models.Share, *models.File, error) {
+	share, err := h.Access.ResolvePublicLink(c.Context(), c.Params("slug"), middleware.GetOrganizationID(c))
+	if err != nil {
+		return nil, nil, serviceError(err, errLoadingFile)
+	}
+	if share.ShareType == models.ShareTypePublicLoggedIn && middleware.GetCurrentUser(c) == nil {
+		return nil, nil, errLoginRequired
+	}
+	relPath, err := url.PathUnescape(c.Params("*"))
+	if err != nil {
+		return nil, nil, errInvalidPublicPath
+	}
+	file, err := h.Access.ResolvePublicPath(c.Context(), share, relPath)
+	if err != nil {
+		return nil, nil, serviceError(err, errLoadingFile)
+	}
+	return share, file, nil
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestPublicLinks(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "links-owner@test.com", "password123", models.UserRoleUser)
+	viewer, _ := createTestUser(t, env.db, "links-viewer@test.com", "password123", models.UserRoleUser)
+
+	create := func(name string, parent *models.File, dir bool) models.File {
+		t.Helper()
+		file := models.File{Name: name, MimeType: "text/plain", IsDirectory: dir, OwnerID: owner.ID, StoragePath: name}
+		if dir {
+			file.MimeType = "inode/directory"
+			file.StoragePath = ""
+		}
+		if parent != nil {
+			file.ParentID = &parent.ID
+		}
+		if err := env.db.Create(&file).Error; err != nil {
+			t.Fatalf("failed creating %s: %v", name, err)
+		}
+		return file
+	}
+	shared := create("Shared", nil, true)
+	reports := create("reports", &shared, true)
+	q1 := create("q1 notes.txt", &reports, false)
+	create("secret.txt", nil, false)
+
+	resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+shared.ID.String()+"/share", map[string]any{
+		"shareType": "public_anyone", "permission": "view",
+	}, authHeaders(ownerToken))
+	assertStatus(t, resp, http.StatusCreated)
+	slug, _ := decodeJSONMap(t, resp)["data"].(map[string]any)["slug"].(string)
+	if slug == "" {
+		t.Fatal("expected a public share to get a slug")
+	}
+	base := "/api/public/links/" + slug
+
+	get := func(t *testing.T, path string, status int) map[string]any {
+		t.Helper()
+		resp := performRequest(t, env.app, http.MethodGet, path, nil, nil)
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, status)
+		return body
+	}
+
+	t.Run("root", func(t *testing.T) {
+		body := get(t, base, http.StatusOK)
+		if body["data"].(map[string]any)["id"] != shared.ID.String() {
+			t.Fatalf("expected the shared folder, got %v", body["data"])
+		}
+	})
+
+	t.Run("nested path", func(t *testing.T) {
+		body := get(t, base+"/path/reports/q1%20notes.txt", http.StatusOK)
+		if body["data"].(map[string]any)["id"] != q1.ID.String() {
+			t.Fatalf("expected q1 notes.txt, got %v", body["data"])
+		}
+	})
+
+	t.Run("children", func(t *testing.T) {
+		body := get(t, base+"/children/reports", http.StatusOK)
+		if children := body["data"].([]any); len(children) != 1 || children[0].(map[string]any)["id"] != q1.ID.String() {
+			t.Fatalf("expected q1 notes.txt as the only child, got %v", children)
+		}
+		get(t, base+"/children/reports/q1%20notes.txt", http.StatusBadRequest)
+	})
+
+	t.Run("stays inside the shared folder", func(t *testing.T) {
+		if body := get(t, base+"/path/secret.txt", http.StatusNotFound); body["code"] != "public_path_not_found" {
+			t.Fatalf("expected public_path_not_found, got %v", body["code"])
+		}
+		if body := get(t, base+"/path/reports/%2E%2E/%2E%2E/secret.txt", http.StatusBadRequest); body["code"] != "invalid_public_path" {
+			t.Fatalf("expected invalid_public_path, got %v", body["code"])
+		}
+	})
+
+	t.Run("download needs download permission", func(t *testing.T) {
+		get(t, base+"/download/reports/q1%20notes.txt", http.StatusForbidden)
+	})
+
+	t.Run("unknown slug", func(t *testing.T) {
+		if body := get(t, "/api/public/links/nope/path/reports", http.StatusNotFound); body["code"] != "public_link_not_found" {
+			t.Fatalf("expected public_link_not_found, got %v", body["code"])
+		}
+	})
+
+	t.Run("expired link", func(t *testing.T) {
+		expired := time.Now().Add(-time.Hour)
+		if err := env.db.Model(&models.Share{}).Where("slug = ?", slug).Update("expires_at", expired).Error; err != nil {
+			t.Fatalf("failed expiring share: %v", err)
+		}
+		get(t, base, http.StatusNotFound)
+	})
+
+	t.Run("private shares have no slug", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+shared.ID.String()+"/share", map[string]any{
+			"userID": viewer.ID.String(), "permission": "view",
+		}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusCreated)
+		if slug, ok := decodeJSONMap(t, resp)["data"].(map[string]any)["slug"]; ok {
+			t.Fatalf("expected no slug, got %v", slug)
+		}
+	})
+}
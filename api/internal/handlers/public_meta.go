@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type publicBranding struct {
+	Name    string `json:"name"`
+	LogoURL string `json:"logoURL,omitempty"`
+	Color   string `json:"color,omitempty"`
+}
+
+type publicFileSummary struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	IsDirectory bool      `json:"isDirectory"`
+	MimeType    string    `json:"mimeType,omitempty"`
+	Size        int64     `json:"size"`
+}
+
+// openGraph holds the og: properties a landing page should render for link
+// unfurling in chat tools.
+type openGraph struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	SiteName    string `json:"siteName"`
+	Image       string `json:"image,omitempty"`
+	Type        string `json:"type"`
+}
+
+// publicCaptcha tells the landing page which widget to render before the
+// visitor can download.
+type publicCaptcha struct {
+	Provider string `json:"provider"`
+	SiteKey  string `json:"siteKey"`
+}
+
+type publicShareMeta struct {
+	ShareType     models.ShareType       `json:"shareType"`
+	LoginRequired bool                   `json:"loginRequired"`
+	File          *publicFileSummary     `json:"file,omitempty"`
+	OwnerName     string                 `json:"ownerName,omitempty"`
+	Message       string                 `json:"message,omitempty"`
+	Permission    models.SharePermission `json:"permission,omitempty"`
+	ExpiresAt     *time.Time             `json:"expiresAt,omitempty"`
+	Branding      publicBranding         `json:"branding"`
+	OpenGraph     openGraph              `json:"openGraph"`
+	Captcha       *publicCaptcha         `json:"captcha,omitempty"`
+}
+
+// PublicMeta describes a publicly shared file for its landing page and for
+// link previews. Shares limited to signed-in users only reveal the branding
+// to anonymous callers, since chat tools unfurl links without credentials.
+func (h *SharesHandler) PublicMeta(c *fiber.Ctx) error {
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+	if !h.Access.InOrganization(c.Context(), fileID, middleware.GetOrganizationID(c)) {
+		return utils.Fail(c, errFileNotFound)
+	}
+
+	share := h.Access.GetPublicShare(c.Context(), fileID)
+	if share == nil {
+		return utils.Fail(c, errFileNotFound)
+	}
+
+	branding := h.publicBranding(middleware.GetOrganization(c))
+	meta := publicShareMeta{
+		ShareType:     share.ShareType,
+		LoginRequired: share.ShareType == models.ShareTypePublicLoggedIn && middleware.GetCurrentUser(c) == nil,
+		ExpiresAt:     share.ExpiresAt,
+		Branding:      branding,
+		OpenGraph: openGraph{
+			Title:       branding.Name,
+			Description: "Sign in to view this shared file.",
+			URL:         strings.TrimRight(h.FrontendURL, "/") + "/shared/" + fileID.String(),
+			SiteName:    branding.Name,
+			Image:       branding.LogoURL,
+			Type:        "website",
+		},
+	}
+	if meta.LoginRequired {
+		return utils.Success(c, fiber.StatusOK, meta)
+	}
+
+	var file models.File
+	if err := h.DB.Preload("Owner").First(&file, "id = ?", fileID).Error; err != nil {
+		return utils.Fail(c, errFileNotFound)
+	}
+
+	meta.File = &publicFileSummary{
+		ID:          file.ID,
+		Name:        file.Name,
+		IsDirectory: file.IsDirectory,
+		MimeType:    file.MimeType,
+		Size:        file.Size,
+	}
+	meta.OwnerName = file.Owner.DisplayName()
+	meta.Message = share.Message
+	meta.Permission = share.Permission
+	if middleware.GetCurrentUser(c) == nil && h.Captcha.Required(c.Context(), share.ID, c.IP()) {
+		meta.Captcha = &publicCaptcha{Provider: h.Captcha.Provider, SiteKey: h.Captcha.SiteKey}
+	}
+
+	meta.OpenGraph.Title = file.Name
+	kind := "a file"
+	if file.IsDirectory {
+		kind = "a folder"
+	}
+	switch {
+	case share.Message != "":
+		meta.OpenGraph.Description = share.Message
+	case meta.OwnerName != "":
+		meta.OpenGraph.Description = fmt.Sprintf("%s shared %s on %s", meta.OwnerName, kind, branding.Name)
+	default:
+		meta.OpenGraph.Description = fmt.Sprintf("Shared %s on %s", kind, branding.Name)
+	}
+
+	return utils.Success(c, fiber.StatusOK, meta)
+}
+
+// publicBranding is the server's branding with org's overrides applied.
+func (h *SharesHandler) publicBranding(org *models.Organization) publicBranding {
+	branding := publicBranding{Name: h.Branding.Name, LogoURL: h.Branding.LogoURL, Color: h.Branding.Color}
+	if branding.Name == "" {
+		branding.Name = "DocShare"
+	}
+	if org == nil {
+		return branding
+	}
+	branding.Name = org.Name
+	if org.BrandLogoURL != "" {
+		branding.LogoURL = org.BrandLogoURL
+	}
+	if org.BrandColor != "" {
+		branding.Color = org.BrandColor
+	}
+	return branding
+}
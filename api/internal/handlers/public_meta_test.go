@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestPublicShareMeta(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "meta-owner@test.com", "password123", models.UserRoleUser)
+	_, viewerToken := createTestUser(t, env.db, "meta-viewer@test.com", "password123", models.UserRoleUser)
+
+	newFile := func(t *testing.T, name string) models.File {
+		t.Helper()
+		file := models.File{Name: name, MimeType: "application/pdf", Size: 2048, OwnerID: owner.ID, StoragePath: "owner/" + name}
+		if err := env.db.Create(&file).Error; err != nil {
+			t.Fatalf("failed creating file fixture: %v", err)
+		}
+		return file
+	}
+	share := func(t *testing.T, file models.File, shareType, message string) {
+		t.Helper()
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+file.ID.String()+"/share", map[string]any{
+			"shareType": shareType, "permission": "download", "message": message,
+		}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusCreated)
+	}
+	meta := func(t *testing.T, file models.File, headers map[string]string) map[string]interface{} {
+		t.Helper()
+		resp := performRequest(t, env.app, http.MethodGet, "/api/public/files/"+file.ID.String()+"/meta", nil, headers)
+		assertStatus(t, resp, http.StatusOK)
+		return decodeJSONMap(t, resp)["data"].(map[string]interface{})
+	}
+
+	t.Run("public share", func(t *testing.T) {
+		file := newFile(t, "report.pdf")
+		share(t, file, "public_anyone", "Numbers for Q3")
+
+		data := meta(t, file, nil)
+		if data["loginRequired"] != false || data["ownerName"] != "Test User" || data["message"] != "Numbers for Q3" {
+			t.Fatalf("unexpected meta %v", data)
+		}
+		if data["file"].(map[string]interface{})["name"] != "report.pdf" {
+			t.Fatalf("expected the file summary, got %v", data["file"])
+		}
+		og := data["openGraph"].(map[string]interface{})
+		if og["title"] != "report.pdf" || og["description"] != "Numbers for Q3" || og["url"] != "http://localhost:3001/shared/"+file.ID.String() {
+			t.Fatalf("unexpected open graph fields %v", og)
+		}
+		if data["branding"].(map[string]interface{})["name"] != "DocShare" {
+			t.Fatalf("expected the default branding, got %v", data["branding"])
+		}
+	})
+
+	t.Run("logged-in share hides details from anonymous callers", func(t *testing.T) {
+		file := newFile(t, "internal.pdf")
+		share(t, file, "public_logged_in", "")
+
+		data := meta(t, file, nil)
+		if data["loginRequired"] != true || data["file"] != nil || data["ownerName"] != nil {
+			t.Fatalf("expected only branding for anonymous callers, got %v", data)
+		}
+
+		data = meta(t, file, authHeaders(viewerToken))
+		if data["loginRequired"] != false || data["file"].(map[string]interface{})["name"] != "internal.pdf" {
+			t.Fatalf("expected details for a signed-in caller, got %v", data)
+		}
+	})
+
+	t.Run("private file", func(t *testing.T) {
+		file := newFile(t, "private.pdf")
+		resp := performRequest(t, env.app, http.MethodGet, "/api/public/files/"+file.ID.String()+"/meta", nil, nil)
+		assertStatus(t, resp, http.StatusNotFound)
+	})
+
+	t.Run("message too long", func(t *testing.T) {
+		file := newFile(t, "long.pdf")
+		long := make([]byte, maxShareMessageLength+1)
+		for i := range long {
+			long[i] = 'a'
+		}
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+file.ID.String()+"/share", map[string]any{
+			"shareType": "public_anyone", "permission": "view", "message": string(long),
+		}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+}
+
+func TestPublicBranding(t *testing.T) {
+	h := &SharesHandler{}
+	h.Branding.Name = "Acme Docs"
+	h.Branding.Color = "#000000"
+
+	if got := h.publicBranding(nil); got.Name != "Acme Docs" || got.Color != "#000000" {
+		t.Fatalf("unexpected server branding %+v", got)
+	}
+	org := &models.Organization{Name: "Globex", BrandColor: "#1a73e8", BrandLogoURL: "https://globex.example/logo.png"}
+	if got := h.publicBranding(org); got.Name != "Globex" || got.Color != "#1a73e8" || got.LogoURL != org.BrandLogoURL {
+		t.Fatalf("expected the organization's branding, got %+v", got)
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var errInvalidReviewID = utils.NewError(fiber.StatusBadRequest, "invalid_review_id", "invalid review id")
+
+// ReviewsHandler lists reviews across files and takes reviewers'
+// decisions. Reviews are requested per file, through FilesHandler.
+type ReviewsHandler struct {
+	DB      *gorm.DB
+	Reviews *services.Reviews
+}
+
+func NewReviewsHandler(db *gorm.DB, reviews *services.Reviews) *ReviewsHandler {
+	return &ReviewsHandler{DB: db, Reviews: reviews}
+}
+
+// List returns the reviews the current user is asked for, directly or
+// through a group, or with role=requester the ones they requested. status
+// narrows the list.
+func (h *ReviewsHandler) List(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	db := h.DB.WithContext(c.UserContext())
+	query := db.Model(&models.FileReview{})
+	switch c.Query("role", "reviewer") {
+	case "reviewer":
+		query = query.Where("id IN (?)", db.Model(&models.FileReviewer{}).Select("review_id").
+			Where("user_id = ? OR group_id IN (?)", currentUser.ID,
+				db.Model(&models.GroupMembership{}).Select("group_id").Where("user_id = ?", currentUser.ID)))
+	case "requester":
+		query = query.Where("requested_by_id = ?", currentUser.ID)
+	default:
+		return utils.Error(c, fiber.StatusBadRequest, "role must be reviewer or requester")
+	}
+	if status := c.Query("status"); status != "" {
+		switch models.ReviewStatus(status) {
+		case models.ReviewStatusInReview, models.ReviewStatusApproved, models.ReviewStatusRejected, models.ReviewStatusCancelled:
+			query = query.Where("status = ?", status)
+		default:
+			return utils.Error(c, fiber.StatusBadRequest, "invalid status")
+		}
+	}
+
+	p := utils.ParsePagination(c)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting reviews")
+	}
+	var reviews []models.FileReview
+	if err := utils.ApplyPagination(query.Preload("File").Preload("RequestedBy").Preload("Reviewers").Order("created_at DESC"), p).
+		Find(&reviews).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing reviews")
+	}
+	return utils.Paginated(c, reviews, p.Page, p.Limit, total)
+}
+
+type reviewDecisionRequest struct {
+	Comment string `json:"comment"`
+}
+
+func (h *ReviewsHandler) Approve(c *fiber.Ctx) error {
+	return h.decide(c, models.ReviewDecisionApproved)
+}
+
+func (h *ReviewsHandler) Reject(c *fiber.Ctx) error {
+	return h.decide(c, models.ReviewDecisionRejected)
+}
+
+// Cancel withdraws an open review and puts the file back in draft.
+func (h *ReviewsHandler) Cancel(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidReviewID)
+	}
+
+	review, err := h.Reviews.Cancel(c.Context(), id, services.AuditEntry{
+		UserID:    &currentUser.ID,
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "review_cancel_failed", "failed withdrawing review")))
+	}
+	return utils.Success(c, fiber.StatusOK, review)
+}
+
+func (h *ReviewsHandler) decide(c *fiber.Ctx, decision models.ReviewDecision) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidReviewID)
+	}
+	var req reviewDecisionRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return utils.Fail(c, errInvalidBody)
+		}
+	}
+
+	review, err := h.Reviews.Decide(c.Context(), id, decision, req.Comment, services.AuditEntry{
+		UserID:    &currentUser.ID,
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrReviewInvalid) {
+			return utils.Fail(c, serviceError(err, nil).WithMessage(err.Error()))
+		}
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "review_decision_failed", "failed recording decision")))
+	}
+	return utils.Success(c, fiber.StatusOK, review)
+}
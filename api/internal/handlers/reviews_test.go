@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestReviews(t *testing.T) {
+	env := setupTestEnv(t)
+	author, authorToken := createTestUser(t, env.db, "reviews-author@test.com", "password123", models.UserRoleUser)
+	reviewer, reviewerToken := createTestUser(t, env.db, "reviews-reviewer@test.com", "password123", models.UserRoleUser)
+	member, memberToken := createTestUser(t, env.db, "reviews-member@test.com", "password123", models.UserRoleUser)
+
+	group := models.Group{Name: "Legal", CreatedByID: member.ID}
+	env.db.Create(&group)
+	env.db.Create(&models.GroupMembership{GroupID: group.ID, UserID: member.ID, Role: models.GroupRoleOwner})
+
+	contract := models.File{Name: "contract.pdf", MimeType: "application/pdf", OwnerID: author.ID, StoragePath: "contract.pdf"}
+	notes := models.File{Name: "notes.pdf", MimeType: "application/pdf", OwnerID: author.ID, StoragePath: "notes.pdf"}
+	env.db.Create(&contract)
+	env.db.Create(&notes)
+	reviewsPath := "/api/files/" + contract.ID.String() + "/reviews"
+	body := map[string]any{"userIDs": []string{reviewer.ID.String()}, "groupIDs": []string{group.ID.String()}, "message": "Ready to sign?"}
+
+	var reviewID string
+	t.Run("editors send files for review", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, reviewsPath, body, authHeaders(reviewerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, reviewsPath, map[string]any{"userIDs": []string{author.ID.String()}}, authHeaders(authorToken))
+		decoded := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusBadRequest)
+		if decoded["code"] != "invalid_review" {
+			t.Fatalf("expected invalid_review, got %v", decoded["code"])
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, reviewsPath, body, authHeaders(authorToken))
+		decoded = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusCreated)
+		review := decoded["data"].(map[string]any)
+		if review["status"] != "in_review" || len(review["reviewers"].([]any)) != 2 {
+			t.Fatalf("unexpected review %v", review)
+		}
+		reviewID = review["id"].(string)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, reviewsPath, body, authHeaders(authorToken))
+		decoded = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusConflict)
+		if decoded["code"] != "review_in_progress" {
+			t.Fatalf("expected review_in_progress, got %v", decoded["code"])
+		}
+
+		var n int64
+		env.db.Model(&models.OutboxEvent{}).Where("event_type = ? AND resource_id = ?", "file.review_request", contract.ID).Count(&n)
+		if n != 1 {
+			t.Fatalf("expected one file.review_request event, got %d", n)
+		}
+	})
+
+	t.Run("reviewers see what waits for them", func(t *testing.T) {
+		for _, token := range []string{reviewerToken, memberToken} {
+			resp := performRequest(t, env.app, http.MethodGet, "/api/reviews?status=in_review", nil, authHeaders(token))
+			assertStatus(t, resp, http.StatusOK)
+			if list := decodeJSONMap(t, resp)["data"].([]any); len(list) != 1 || list[0].(map[string]any)["id"] != reviewID {
+				t.Fatalf("expected the review listed, got %v", list)
+			}
+		}
+		resp := performRequest(t, env.app, http.MethodGet, "/api/reviews", nil, authHeaders(authorToken))
+		assertStatus(t, resp, http.StatusOK)
+		if list := decodeJSONMap(t, resp)["data"].([]any); len(list) != 0 {
+			t.Fatalf("expected nothing for the author to review, got %v", list)
+		}
+		resp = performRequest(t, env.app, http.MethodGet, "/api/reviews?role=requester", nil, authHeaders(authorToken))
+		assertStatus(t, resp, http.StatusOK)
+		if list := decodeJSONMap(t, resp)["data"].([]any); len(list) != 1 {
+			t.Fatalf("expected the author's request listed, got %v", list)
+		}
+	})
+
+	t.Run("reviewers decide", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/reviews/"+reviewID+"/approve", nil, authHeaders(authorToken))
+		decoded := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusForbidden)
+		if decoded["code"] != "own_review" {
+			t.Fatalf("expected own_review, got %v", decoded["code"])
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/reviews/"+reviewID+"/approve", map[string]any{"comment": "Fine by me"}, authHeaders(reviewerToken))
+		assertStatus(t, resp, http.StatusOK)
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/reviews/"+reviewID+"/approve", nil, authHeaders(memberToken))
+		decoded = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if decoded["data"].(map[string]any)["status"] != "approved" {
+			t.Fatalf("expected the review approved, got %v", decoded["data"])
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/files/"+contract.ID.String(), nil, authHeaders(authorToken))
+		assertStatus(t, resp, http.StatusOK)
+		if status := decodeJSONMap(t, resp)["data"].(map[string]any)["reviewStatus"]; status != "approved" {
+			t.Fatalf("expected the file approved, got %v", status)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, reviewsPath, nil, authHeaders(authorToken))
+		assertStatus(t, resp, http.StatusOK)
+		reviewers := decodeJSONMap(t, resp)["data"].([]any)[0].(map[string]any)["reviewers"].([]any)
+		for _, rv := range reviewers {
+			if rv.(map[string]any)["decision"] != "approved" {
+				t.Fatalf("expected every reviewer to have approved, got %v", reviewers)
+			}
+		}
+	})
+
+	t.Run("search filters by review status", func(t *testing.T) {
+		for query, want := range map[string]string{
+			"reviewStatus=approved":        "contract.pdf",
+			"reviewStatus=draft":           "notes.pdf",
+			"reviewStatus=in_review,draft": "notes.pdf",
+		} {
+			resp := performRequest(t, env.app, http.MethodGet, "/api/files/search?"+query, nil, authHeaders(authorToken))
+			assertStatus(t, resp, http.StatusOK)
+			files := decodeJSONMap(t, resp)["data"].([]any)
+			if len(files) != 1 || files[0].(map[string]any)["name"] != want {
+				t.Errorf("%s: expected only %s, got %v", query, want, files)
+			}
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// SettingsHandler lets platform admins read and change the runtime
+// settings.
+type SettingsHandler struct {
+	Settings *services.SettingsService
+	Audit    *services.AuditService
+}
+
+func NewSettingsHandler(settings *services.SettingsService, audit *services.AuditService) *SettingsHandler {
+	return &SettingsHandler{Settings: settings, Audit: audit}
+}
+
+func (h *SettingsHandler) List(c *fiber.Ctx) error {
+	return utils.Success(c, fiber.StatusOK, h.Settings.List(c.Context()))
+}
+
+// Update takes an object of setting keys to new values; null resets a
+// setting to its default. The request is applied in full or not at all.
+func (h *SettingsHandler) Update(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	var req map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &req); err != nil || len(req) == 0 {
+		return utils.Fail(c, errInvalidBody)
+	}
+
+	// Refuse to lock the caller out of the API they are using to make the
+	// change; a mistyped range would otherwise need database access to undo.
+	if allowed, _ := h.Settings.IPPolicyWith(c.Context(), services.IPScopeAdmin, req).Allows(c.IP()); !allowed {
+		return utils.Fail(c, errIPPolicyLockout)
+	}
+
+	changes, err := h.Settings.Update(c.Context(), req, currentUser.ID)
+	if err != nil {
+		var settingErr *services.SettingError
+		if errors.As(err, &settingErr) {
+			return utils.Fail(c, errInvalidSetting.WithMessage(settingErr.Error()))
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed updating settings")
+	}
+
+	if len(changes) > 0 {
+		h.Audit.LogAsync(services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "admin.settings_update",
+			ResourceType: "settings",
+			Details: map[string]interface{}{
+				"changes": changes,
+			},
+			IPAddress: c.IP(),
+			RequestID: getRequestID(c),
+		})
+	}
+
+	return utils.Success(c, fiber.StatusOK, h.Settings.List(c.Context()))
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/google/uuid"
+)
+
+func putSettings(t *testing.T, env *testEnv, token string, changes map[string]any) map[string]any {
+	t.Helper()
+	resp := performJSONRequest(t, env.app, http.MethodPut, "/api/admin/settings", changes, authHeaders(token))
+	body := decodeJSONMap(t, resp)
+	assertStatus(t, resp, http.StatusOK)
+	return body
+}
+
+func settingValue(t *testing.T, body map[string]any, key string) map[string]any {
+	t.Helper()
+	for _, item := range body["data"].([]any) {
+		setting := item.(map[string]any)
+		if setting["key"] == key {
+			return setting
+		}
+	}
+	t.Fatalf("setting %s not listed in %v", key, body["data"])
+	return nil
+}
+
+func TestSettingsEndpoints(t *testing.T) {
+	env := setupTestEnv(t)
+	_, adminToken := createTestUser(t, env.db, "settings-admin@test.com", "password123", models.UserRoleAdmin)
+	_, userToken := createTestUser(t, env.db, "settings-user@test.com", "password123", models.UserRoleUser)
+
+	t.Run("admin only", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/admin/settings", nil, authHeaders(userToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("lists defaults", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/admin/settings", nil, authHeaders(adminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		upload := settingValue(t, body, services.SettingUploadMaxSizeMB)
+		if upload["value"] != float64(100) || upload["overridden"] != false || upload["type"] != "int" {
+			t.Fatalf("expected the environment default, got %v", upload)
+		}
+	})
+
+	t.Run("rejects invalid values without applying any change", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/admin/settings", map[string]any{
+			services.SettingPublicSharing:    false,
+			services.SettingRegistrationMode: "sometimes",
+		}, authHeaders(adminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusBadRequest)
+		if body["code"] != "invalid_setting" {
+			t.Fatalf("expected invalid_setting, got %v", body)
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPut, "/api/admin/settings", map[string]any{"theme.color": "blue"}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+
+		resp = performJSONRequest(t, env.app, http.MethodPut, "/api/admin/settings", map[string]any{services.SettingPreviewCacheTTL: "1h"}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+
+		var count int64
+		env.db.Model(&models.Setting{}).Count(&count)
+		if count != 0 {
+			t.Fatalf("expected nothing stored, got %d rows", count)
+		}
+	})
+
+	t.Run("registration mode", func(t *testing.T) {
+		putSettings(t, env, adminToken, map[string]any{services.SettingRegistrationMode: services.RegistrationClosed})
+		register := map[string]any{"email": "newcomer@test.com", "password": "password123", "firstName": "New", "lastName": "Comer"}
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/auth/register", register, nil)
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusForbidden)
+		if body["code"] != "registration_closed" {
+			t.Fatalf("expected registration_closed, got %v", body)
+		}
+
+		putSettings(t, env, adminToken, map[string]any{services.SettingRegistrationMode: services.RegistrationInviteOnly})
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/auth/register", register, nil)
+		body = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusForbidden)
+		if body["code"] != "registration_invite_only" {
+			t.Fatalf("expected registration_invite_only, got %v", body)
+		}
+
+		body = putSettings(t, env, adminToken, map[string]any{services.SettingRegistrationMode: nil})
+		if mode := settingValue(t, body, services.SettingRegistrationMode); mode["value"] != services.RegistrationOpen || mode["overridden"] != false {
+			t.Fatalf("expected null to reset the mode, got %v", mode)
+		}
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/auth/register", register, nil)
+		assertStatus(t, resp, http.StatusCreated)
+	})
+
+	t.Run("public sharing toggle", func(t *testing.T) {
+		owner, ownerToken := createTestUser(t, env.db, "settings-owner@test.com", "password123", models.UserRoleUser)
+		file := models.File{Name: "report.txt", MimeType: "text/plain", Size: 10, OwnerID: owner.ID, StoragePath: "report.txt"}
+		env.db.Create(&file)
+		env.db.Create(&models.Share{FileID: file.ID, SharedByID: owner.ID, ShareType: models.ShareTypePublicAnyone, Permission: models.SharePermissionView})
+
+		putSettings(t, env, adminToken, map[string]any{services.SettingPublicSharing: false})
+		resp := performRequest(t, env.app, http.MethodGet, "/api/public/files/"+file.ID.String(), nil, nil)
+		if resp.StatusCode == http.StatusOK {
+			t.Fatal("expected existing public links to stop working")
+		}
+		publicLoggedIn := models.ShareTypePublicLoggedIn
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+file.ID.String()+"/share", map[string]any{
+			"shareType":  publicLoggedIn,
+			"permission": "view",
+		}, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusForbidden)
+		if body["code"] != "public_sharing_disabled" {
+			t.Fatalf("expected public_sharing_disabled, got %v", body)
+		}
+
+		putSettings(t, env, adminToken, map[string]any{services.SettingPublicSharing: true})
+		resp = performRequest(t, env.app, http.MethodGet, "/api/public/files/"+file.ID.String(), nil, nil)
+		assertStatus(t, resp, http.StatusOK)
+	})
+
+	t.Run("public share policy", func(t *testing.T) {
+		owner, ownerToken := createTestUser(t, env.db, "policy-owner@test.com", "password123", models.UserRoleUser)
+		file := models.File{Name: "policy.txt", MimeType: "text/plain", Size: 10, OwnerID: owner.ID, StoragePath: "policy.txt"}
+		env.db.Create(&file)
+		putSettings(t, env, adminToken, map[string]any{
+			services.SettingPublicMaxExpiryDays:   30,
+			services.SettingPublicRequirePassword: true,
+		})
+		defer putSettings(t, env, adminToken, map[string]any{
+			services.SettingPublicMaxExpiryDays:   nil,
+			services.SettingPublicRequirePassword: nil,
+		})
+		share := func(body map[string]any) *http.Response {
+			return performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+file.ID.String()+"/share", body, authHeaders(ownerToken))
+		}
+		expectCode := func(resp *http.Response, status int, code string) {
+			t.Helper()
+			body := decodeJSONMap(t, resp)
+			assertStatus(t, resp, status)
+			if body["code"] != code {
+				t.Fatalf("expected %s, got %v", code, body)
+			}
+		}
+
+		resp := share(map[string]any{"shareType": "public_anyone", "permission": "view"})
+		expectCode(resp, http.StatusForbidden, "public_share_password_required")
+
+		env.db.Model(&file).Update("password_protected", true)
+		late := time.Now().AddDate(0, 0, 60)
+		resp = share(map[string]any{"shareType": "public_anyone", "permission": "view", "expiresAt": late})
+		expectCode(resp, http.StatusBadRequest, "public_share_expiry_too_long")
+
+		resp = share(map[string]any{"shareType": "public_anyone", "permission": "view"})
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusCreated)
+		created := body["data"].(map[string]any)
+		expiresAt, err := time.Parse(time.RFC3339, created["expiresAt"].(string))
+		if err != nil || expiresAt.After(time.Now().AddDate(0, 0, 30)) || expiresAt.Before(time.Now().AddDate(0, 0, 29)) {
+			t.Fatalf("expected the link to get the longest allowed expiry, got %v", created["expiresAt"])
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPut, "/api/shares/"+created["id"].(string), map[string]any{
+			"permission": "view",
+			"expiresAt":  late,
+		}, authHeaders(ownerToken))
+		expectCode(resp, http.StatusBadRequest, "public_share_expiry_too_long")
+	})
+
+	t.Run("upload size limit", func(t *testing.T) {
+		putSettings(t, env, adminToken, map[string]any{services.SettingUploadMaxSizeMB: 1})
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/upload/presign", map[string]any{
+			"name": "big.bin",
+			"size": 2 * 1024 * 1024,
+		}, authHeaders(userToken))
+		assertStatus(t, resp, http.StatusRequestEntityTooLarge)
+		putSettings(t, env, adminToken, map[string]any{services.SettingUploadMaxSizeMB: nil})
+	})
+
+	t.Run("default organization quota", func(t *testing.T) {
+		body := putSettings(t, env, adminToken, map[string]any{services.SettingDefaultOrgQuotaBytes: 1 << 30})
+		quota := settingValue(t, body, services.SettingDefaultOrgQuotaBytes)
+		if quota["overridden"] != true || quota["updatedByID"] == nil {
+			t.Fatalf("expected the override recorded, got %v", quota)
+		}
+
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/organizations/", map[string]any{"name": "Quota Co", "slug": "quota-co"}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusCreated)
+		var org models.Organization
+		env.db.First(&org, "slug = ?", "quota-co")
+		if org.StorageQuotaBytes == nil || *org.StorageQuotaBytes != 1<<30 {
+			t.Fatalf("expected the default quota applied, got %v", org.StorageQuotaBytes)
+		}
+	})
+	t.Run("ip policies", func(t *testing.T) {
+		// Test requests arrive from 0.0.0.0.
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/admin/settings", map[string]any{
+			services.SettingAdminIPAllow: []string{"10.0.0.0/8"},
+		}, authHeaders(adminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusConflict)
+		if body["code"] != "ip_policy_lockout" {
+			t.Fatalf("expected ip_policy_lockout, got %v", body)
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPut, "/api/admin/settings", map[string]any{
+			services.SettingPublicIPDeny: []string{"10.0.0.0/33"},
+		}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+
+		putSettings(t, env, adminToken, map[string]any{services.SettingPublicIPDeny: []string{"0.0.0.0/8"}})
+		resp = performRequest(t, env.app, http.MethodGet, "/api/public/files/"+uuid.NewString(), nil, nil)
+		body = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusForbidden)
+		if body["code"] != "ip_blocked" {
+			t.Fatalf("expected ip_blocked, got %v", body)
+		}
+
+		body = putSettings(t, env, adminToken, map[string]any{
+			services.SettingPublicIPDeny: nil,
+			services.SettingAdminIPAllow: []string{"0.0.0.0", "10.0.0.0/8"},
+		})
+		if allow := settingValue(t, body, services.SettingAdminIPAllow); allow["type"] != "list" || len(allow["value"].([]any)) != 2 {
+			t.Fatalf("expected the allow list stored, got %v", allow)
+		}
+		resp = performRequest(t, env.app, http.MethodGet, "/api/public/files/"+uuid.NewString(), nil, nil)
+		assertStatus(t, resp, http.StatusNotFound)
+		putSettings(t, env, adminToken, map[string]any{services.SettingAdminIPAllow: nil})
+	})
+}
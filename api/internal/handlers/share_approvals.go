@@ -0,0 +1,500 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var errInvalidShareApprovalID = utils.NewError(fiber.StatusBadRequest, "invalid_share_approval_id", "invalid share approval id")
+
+// requestShareApproval holds a new share back under control: it records
+// what was asked for and tells the approver group, and the share itself is
+// only created once one of them approves it.
+func (h *SharesHandler) requestShareApproval(c *fiber.Ctx, requester *models.User, file *models.File, control *models.ShareControl, share *models.Share, vaultKeys []services.WrappedKey) error {
+	var approval *models.ShareApproval
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		approval, err = services.RequestShareApproval(tx, control, share, vaultKeys)
+		if err != nil {
+			return err
+		}
+		details := proposalDetails(approval.Proposal, file.Name)
+		details["approval_id"] = approval.ID.String()
+		details["approver_group_id"] = control.ApproverGroupID.String()
+		details["controlled_folder_id"] = control.FolderID.String()
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &requester.ID,
+			Action:       "share.approval_request",
+			ResourceType: "share_approval",
+			ResourceID:   &file.ID,
+			Details:      details,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		})
+	}); err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed requesting share approval")
+	}
+
+	logger.InfoWithUser(requester.ID.String(), "share_approval_requested", map[string]interface{}{
+		"file_id":     file.ID.String(),
+		"approval_id": approval.ID.String(),
+		"share_type":  string(share.ShareType),
+	})
+	return utils.Success(c, fiber.StatusAccepted, fiber.Map{"approval": approval})
+}
+
+// proposalDetails describes a proposed share the way share.create audit
+// rows describe a created one.
+func proposalDetails(p models.ShareProposal, fileName string) map[string]interface{} {
+	details := map[string]interface{}{
+		"file_name":  fileName,
+		"permission": string(p.Permission),
+		"share_type": string(p.ShareType),
+	}
+	if p.SharedWithUserID != nil {
+		details["shared_with_user_id"] = p.SharedWithUserID.String()
+	}
+	if p.SharedWithGroupID != nil {
+		details["shared_with_group_id"] = p.SharedWithGroupID.String()
+	}
+	if p.SharedWithEmail != nil {
+		details["invited_email"] = *p.SharedWithEmail
+	}
+	if p.ExpiresAt != nil {
+		details["expires_at"] = p.ExpiresAt.Format(time.RFC3339)
+	}
+	if p.Watermark {
+		details["watermark"] = true
+	}
+	if p.ViewOnly {
+		details["view_only"] = true
+	}
+	if p.QuickShare {
+		details["quick_share"] = true
+	}
+	return details
+}
+
+// ListShareApprovals lists the approvals the current user can decide on,
+// or with role=requester the ones they asked for. status narrows the list.
+func (h *SharesHandler) ListShareApprovals(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	db := h.DB.WithContext(c.UserContext())
+	query := db.Model(&models.ShareApproval{})
+	switch c.Query("role", "approver") {
+	case "approver":
+		query = query.Where("approver_group_id IN (?)",
+			db.Model(&models.GroupMembership{}).Select("group_id").Where("user_id = ?", currentUser.ID))
+	case "requester":
+		query = query.Where("requested_by_id = ?", currentUser.ID)
+	default:
+		return utils.Error(c, fiber.StatusBadRequest, "role must be approver or requester")
+	}
+	if status := c.Query("status"); status != "" {
+		switch models.ShareApprovalStatus(status) {
+		case models.ShareApprovalPending, models.ShareApprovalApproved, models.ShareApprovalRejected:
+			query = query.Where("status = ?", status)
+		default:
+			return utils.Error(c, fiber.StatusBadRequest, "invalid status")
+		}
+	}
+
+	p := utils.ParsePagination(c)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting share approvals")
+	}
+	var approvals []models.ShareApproval
+	if err := utils.ApplyPagination(query.Preload("File").Preload("RequestedBy").Order("created_at DESC"), p).
+		Find(&approvals).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing share approvals")
+	}
+	return utils.Paginated(c, approvals, p.Page, p.Limit, total)
+}
+
+type shareDecisionRequest struct {
+	Reason string `json:"reason"`
+}
+
+type shareApprovalResponse struct {
+	Approval   *models.ShareApproval `json:"approval"`
+	Share      *models.Share         `json:"share,omitempty"`
+	Invitation *invitationResponse   `json:"invitation,omitempty"`
+}
+
+// ApproveShare creates the share an approval holds, as if the requester
+// had just made it. Public sharing, the public share policy and link
+// clashes are checked again now, since any may have changed while the
+// share waited.
+func (h *SharesHandler) ApproveShare(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	approval, file, apiErr := h.loadApprovalForDecision(c, currentUser.ID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	var requester models.User
+	if err := h.DB.First(&requester, "id = ?", approval.RequestedByID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Fail(c, errUserNotFound)
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading requester")
+	}
+
+	now := time.Now().UTC()
+	share := approval.Share()
+	if share.IsPublic() {
+		if !h.Access.PublicSharingEnabled(c.Context()) {
+			return utils.Fail(c, errPublicSharingOff)
+		}
+		if err := h.Access.PublicSharePolicy(c.Context()).Apply(&share, file, now); err != nil {
+			return utils.Fail(c, serviceError(err, errInvalidBody))
+		}
+		slug, err := services.NewShareSlug()
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed creating share")
+		}
+		share.Slug = &slug
+	}
+
+	var invitationToken string
+	var invitation *models.ShareInvitation
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := services.DecideShareApproval(tx, approval, models.ShareApprovalApproved, currentUser.ID, "", now); err != nil {
+			return err
+		}
+		if share.IsPublic() {
+			if err := h.clearPublicLinkFor(c, tx, &share, file, &requester); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&share).Error; err != nil {
+			return err
+		}
+		if file.VaultID != nil && share.SharedWithUserID != nil {
+			keys := make([]services.WrappedKey, len(approval.Proposal.VaultKeys))
+			for i, key := range approval.Proposal.VaultKeys {
+				keys[i] = services.WrappedKey{KeyID: key.KeyID, WrappedKey: key.WrappedKey}
+			}
+			if err := h.Vaults.StoreWrappedKeys(tx, *file.VaultID, *share.SharedWithUserID, requester.ID, keys); err != nil {
+				return err
+			}
+		}
+		if share.IsPending() {
+			var err error
+			invitationToken, invitation, err = services.CreateShareInvitation(tx, &share, requester.OrganizationID)
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(approval).UpdateColumn("share_id", share.ID).Error; err != nil {
+			return err
+		}
+		approval.ShareID = &share.ID
+
+		details := proposalDetails(approval.Proposal, file.Name)
+		details["approval_id"] = approval.ID.String()
+		details["share_id"] = share.ID.String()
+		details["requested_by_id"] = requester.ID.String()
+		if err := services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "share.approval_approve",
+			ResourceType: "share_approval",
+			ResourceID:   &file.ID,
+			Details:      details,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		}); err != nil {
+			return err
+		}
+
+		created := proposalDetails(approval.Proposal, file.Name)
+		created["share_id"] = share.ID.String()
+		created["approval_id"] = approval.ID.String()
+		created["approved_by_id"] = currentUser.ID.String()
+		if share.SharedWithGroupID != nil {
+			var grp models.Group
+			if err := tx.Select("name").First(&grp, "id = ?", *share.SharedWithGroupID).Error; err == nil {
+				created["group_name"] = grp.Name
+			}
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &requester.ID,
+			Action:       "share.create",
+			ResourceType: "share",
+			ResourceID:   &file.ID,
+			Details:      created,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		})
+	}); err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "internal_error", "failed approving share")))
+	}
+
+	logger.InfoWithUser(currentUser.ID.String(), "share_approval_approved", map[string]interface{}{
+		"approval_id":  approval.ID.String(),
+		"file_id":      file.ID.String(),
+		"share_id":     share.ID.String(),
+		"requested_by": requester.ID.String(),
+	})
+
+	resp := shareApprovalResponse{Approval: approval, Share: &share}
+	if invitation != nil {
+		pending := h.inviteByEmail(&requester, file, share, invitation, invitationToken)
+		resp.Invitation = &pending.Invitation
+	}
+	return utils.Success(c, fiber.StatusOK, resp)
+}
+
+// clearPublicLinkFor makes room for an approved public share. An approved
+// quick share replaces the file's earlier quick-share links, as asking for
+// one again would; any other public link of the same type is a clash.
+func (h *SharesHandler) clearPublicLinkFor(c *fiber.Ctx, tx *gorm.DB, share *models.Share, file *models.File, requester *models.User) error {
+	var existing []models.Share
+	if err := tx.Where("file_id = ? AND share_type = ?", file.ID, share.ShareType).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now().UTC()).
+		Find(&existing).Error; err != nil {
+		return err
+	}
+	for _, s := range existing {
+		if !share.QuickShare || !s.QuickShare {
+			return services.ErrApprovedShareConflict
+		}
+	}
+	for _, old := range existing {
+		if err := tx.Delete(&models.Share{}, "id = ?", old.ID).Error; err != nil {
+			return err
+		}
+		details := shareDeleteDetails(old, file.Name)
+		details["quick_share"] = true
+		if err := services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &requester.ID,
+			Action:       "share.delete",
+			ResourceType: "share",
+			ResourceID:   &file.ID,
+			Details:      details,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RejectShare turns a held share down. The requester is told, with the
+// reason when one is given.
+func (h *SharesHandler) RejectShare(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	var req shareDecisionRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return utils.Fail(c, errInvalidBody)
+		}
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if utf8.RuneCountInString(reason) > maxShareMessageLength {
+		return utils.Error(c, fiber.StatusBadRequest, "reason must be at most 1000 characters")
+	}
+
+	approval, file, apiErr := h.loadApprovalForDecision(c, currentUser.ID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := services.DecideShareApproval(tx, approval, models.ShareApprovalRejected, currentUser.ID, reason, time.Now().UTC()); err != nil {
+			return err
+		}
+		details := proposalDetails(approval.Proposal, file.Name)
+		details["approval_id"] = approval.ID.String()
+		details["requested_by_id"] = approval.RequestedByID.String()
+		if reason != "" {
+			details["reason"] = reason
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "share.approval_reject",
+			ResourceType: "share_approval",
+			ResourceID:   &file.ID,
+			Details:      details,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		})
+	}); err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "internal_error", "failed rejecting share")))
+	}
+
+	return utils.Success(c, fiber.StatusOK, shareApprovalResponse{Approval: approval})
+}
+
+func (h *SharesHandler) loadApprovalForDecision(c *fiber.Ctx, deciderID uuid.UUID) (*models.ShareApproval, *models.File, *utils.APIError) {
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return nil, nil, errInvalidShareApprovalID
+	}
+	approval, err := services.LoadShareApprovalForDecision(c.UserContext(), h.DB, id, deciderID)
+	if err != nil {
+		return nil, nil, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "internal_error", "failed loading share approval"))
+	}
+	var file models.File
+	if err := h.DB.First(&file, "id = ?", approval.FileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errFileNotFound
+		}
+		return nil, nil, errLoadingFile
+	}
+	return approval, &file, nil
+}
+
+type shareControlRequest struct {
+	ApproverGroupID uuid.UUID `json:"approverGroupID"`
+	PublicOnly      bool      `json:"publicOnly"`
+}
+
+// ListShareControls lists the share-controlled folders.
+func (h *SharesHandler) ListShareControls(c *fiber.Ctx) error {
+	db := h.DB.WithContext(c.UserContext())
+	p := utils.ParsePagination(c)
+
+	var total int64
+	if err := db.Model(&models.ShareControl{}).Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting share controls")
+	}
+	var controls []models.ShareControl
+	if err := utils.ApplyPagination(db.Preload("Folder").Preload("ApproverGroup").Order("created_at DESC"), p).
+		Find(&controls).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing share controls")
+	}
+	return utils.Paginated(c, controls, p.Page, p.Limit, total)
+}
+
+// PutShareControl makes a folder share-controlled, or changes its approver
+// group. Shares that already exist are left alone.
+func (h *SharesHandler) PutShareControl(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	folderID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+	var folder models.File
+	if err := h.DB.First(&folder, "id = ?", folderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Fail(c, errFileNotFound)
+		}
+		return utils.Fail(c, errLoadingFile)
+	}
+	if !folder.IsDirectory {
+		return utils.Fail(c, errNotDirectory)
+	}
+
+	var req shareControlRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	if req.ApproverGroupID == uuid.Nil {
+		return utils.Error(c, fiber.StatusBadRequest, "approverGroupID is required")
+	}
+	var group models.Group
+	if err := h.DB.First(&group, "id = ?", req.ApproverGroupID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Fail(c, errGroupNotFound)
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading group")
+	}
+
+	var control models.ShareControl
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("folder_id = ?", folder.ID).First(&control).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		control.FolderID = folder.ID
+		control.ApproverGroupID = group.ID
+		control.PublicOnly = req.PublicOnly
+		control.CreatedByID = currentUser.ID
+		if err := tx.Save(&control).Error; err != nil {
+			return err
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "admin.share_control_update",
+			ResourceType: "file",
+			ResourceID:   &folder.ID,
+			Details: map[string]interface{}{
+				"file_name":         folder.Name,
+				"approver_group_id": group.ID.String(),
+				"group_name":        group.Name,
+				"public_only":       req.PublicOnly,
+			},
+			IPAddress: c.IP(),
+			RequestID: getRequestID(c),
+		})
+	}); err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed saving share control")
+	}
+
+	return utils.Success(c, fiber.StatusOK, control)
+}
+
+// DeleteShareControl lifts a folder's share control. Approvals still
+// pending under it can still be decided.
+func (h *SharesHandler) DeleteShareControl(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	folderID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("folder_id = ?", folderID).Delete(&models.ShareControl{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return services.ErrShareControlNotFound
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "admin.share_control_delete",
+			ResourceType: "file",
+			ResourceID:   &folderID,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		})
+	}); err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "internal_error", "failed removing share control")))
+	}
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "share control removed"})
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestShareApprovals(t *testing.T) {
+	env := setupTestEnv(t)
+	_, adminToken := createTestUser(t, env.db, "approvals-admin@test.com", "password123", models.UserRoleAdmin)
+	owner, ownerToken := createTestUser(t, env.db, "approvals-owner@test.com", "password123", models.UserRoleUser)
+	approver, approverToken := createTestUser(t, env.db, "approvals-approver@test.com", "password123", models.UserRoleUser)
+	recipient, _ := createTestUser(t, env.db, "approvals-recipient@test.com", "password123", models.UserRoleUser)
+
+	group := models.Group{Name: "Compliance", CreatedByID: approver.ID}
+	env.db.Create(&group)
+	env.db.Create(&models.GroupMembership{GroupID: group.ID, UserID: approver.ID, Role: models.GroupRoleOwner})
+	env.db.Create(&models.GroupMembership{GroupID: group.ID, UserID: owner.ID, Role: models.GroupRoleMember})
+
+	newFile := func(name string, parent *models.File, dir bool) models.File {
+		file := models.File{Name: name, MimeType: "text/plain", OwnerID: owner.ID, IsDirectory: dir, StoragePath: name}
+		if parent != nil {
+			file.ParentID = &parent.ID
+		}
+		if err := env.db.Create(&file).Error; err != nil {
+			t.Fatalf("failed creating file: %v", err)
+		}
+		return file
+	}
+	regulated := newFile("Regulated", nil, true)
+	doc := newFile("trial.txt", &regulated, false)
+	open := newFile("open.txt", nil, false)
+	controlPath := "/api/admin/files/" + regulated.ID.String() + "/share-control"
+
+	shareCount := func(fileID string) int64 {
+		var n int64
+		env.db.Model(&models.Share{}).Where("file_id = ?", fileID).Count(&n)
+		return n
+	}
+	requestShare := func(file models.File) string {
+		t.Helper()
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+file.ID.String()+"/share",
+			map[string]any{"userID": recipient.ID.String(), "permission": "view"}, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusAccepted)
+		approval := body["data"].(map[string]any)["approval"].(map[string]any)
+		if approval["status"] != "pending" {
+			t.Fatalf("expected a pending approval, got %v", approval["status"])
+		}
+		return approval["id"].(string)
+	}
+
+	t.Run("only admins mark folders and only folders can be marked", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, controlPath, map[string]any{"approverGroupID": group.ID.String()}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+
+		resp = performJSONRequest(t, env.app, http.MethodPut, "/api/admin/files/"+doc.ID.String()+"/share-control",
+			map[string]any{"approverGroupID": group.ID.String()}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+
+		resp = performJSONRequest(t, env.app, http.MethodPut, controlPath, map[string]any{"approverGroupID": group.ID.String()}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/admin/share-controls", nil, authHeaders(adminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if n := len(body["data"].([]any)); n != 1 {
+			t.Fatalf("expected 1 share control, got %d", n)
+		}
+	})
+
+	t.Run("shares outside the subtree take effect at once", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+open.ID.String()+"/share",
+			map[string]any{"userID": recipient.ID.String(), "permission": "view"}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusCreated)
+	})
+
+	t.Run("approving creates the share and notifies the requester", func(t *testing.T) {
+		id := requestShare(doc)
+		if n := shareCount(doc.ID.String()); n != 0 {
+			t.Fatalf("expected no share before approval, got %d", n)
+		}
+
+		resp := performRequest(t, env.app, http.MethodGet, "/api/shares/approvals?status=pending", nil, authHeaders(approverToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if n := len(body["data"].([]any)); n != 1 {
+			t.Fatalf("expected 1 pending approval for the approver, got %d", n)
+		}
+
+		resp = performRequest(t, env.app, http.MethodPost, "/api/shares/approvals/"+id+"/approve", nil, authHeaders(ownerToken))
+		body = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusForbidden)
+		if body["code"] != "own_share_approval" {
+			t.Fatalf("expected own_share_approval, got %v", body["code"])
+		}
+
+		resp = performRequest(t, env.app, http.MethodPost, "/api/shares/approvals/"+id+"/approve", nil, authHeaders(approverToken))
+		body = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		share := body["data"].(map[string]any)["share"].(map[string]any)
+		if share["sharedByID"] != owner.ID.String() {
+			t.Fatalf("expected the share to be the requester's, got %v", share["sharedByID"])
+		}
+		if n := shareCount(doc.ID.String()); n != 1 {
+			t.Fatalf("expected the share after approval, got %d", n)
+		}
+
+		resp = performRequest(t, env.app, http.MethodPost, "/api/shares/approvals/"+id+"/reject", nil, authHeaders(approverToken))
+		assertStatus(t, resp, http.StatusConflict)
+
+		for _, action := range []string{"share.approval_request", "share.approval_approve", "share.create"} {
+			var n int64
+			env.db.Model(&models.OutboxEvent{}).Where("event_type = ? AND resource_id = ?", action, doc.ID).Count(&n)
+			if n != 1 {
+				t.Fatalf("expected one %s event, got %d", action, n)
+			}
+		}
+	})
+
+	t.Run("rejecting keeps the share from being created", func(t *testing.T) {
+		before := shareCount(doc.ID.String())
+		id := requestShare(doc)
+
+		_, outsiderToken := createTestUser(t, env.db, "approvals-outsider@test.com", "password123", models.UserRoleUser)
+		resp := performRequest(t, env.app, http.MethodPost, "/api/shares/approvals/"+id+"/reject", nil, authHeaders(outsiderToken))
+		assertStatus(t, resp, http.StatusForbidden)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/shares/approvals/"+id+"/reject",
+			map[string]any{"reason": "not for external parties"}, authHeaders(approverToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		approval := body["data"].(map[string]any)["approval"].(map[string]any)
+		if approval["status"] != "rejected" || approval["reason"] != "not for external parties" {
+			t.Fatalf("unexpected approval %v", approval)
+		}
+		if n := shareCount(doc.ID.String()); n != before {
+			t.Fatalf("expected no new share after rejection, got %d", n-before)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/shares/approvals?role=requester&status=rejected", nil, authHeaders(ownerToken))
+		body = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if n := len(body["data"].([]any)); n != 1 {
+			t.Fatalf("expected the requester to see the rejection, got %d", n)
+		}
+	})
+
+	t.Run("public-only controls hold back public shares alone", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, controlPath,
+			map[string]any{"approverGroupID": group.ID.String(), "publicOnly": true}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+
+		other := newFile("memo.txt", &regulated, false)
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+other.ID.String()+"/share",
+			map[string]any{"userID": recipient.ID.String(), "permission": "view"}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusCreated)
+
+		resp = performRequest(t, env.app, http.MethodPost, "/api/files/"+other.ID.String()+"/quick-share", nil, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusAccepted)
+		id := body["data"].(map[string]any)["approval"].(map[string]any)["id"].(string)
+
+		resp = performRequest(t, env.app, http.MethodPost, "/api/shares/approvals/"+id+"/approve", nil, authHeaders(approverToken))
+		body = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		share := body["data"].(map[string]any)["share"].(map[string]any)
+		if share["shareType"] != "public_anyone" || share["slug"] == nil {
+			t.Fatalf("expected an approved public link, got %v", share)
+		}
+	})
+
+	t.Run("lifting the control lets shares through", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodDelete, controlPath, nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		resp = performRequest(t, env.app, http.MethodDelete, controlPath, nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusNotFound)
+
+		resp = performRequest(t, env.app, http.MethodPost, "/api/files/"+doc.ID.String()+"/quick-share", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusCreated)
+	})
+}
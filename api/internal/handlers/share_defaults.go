@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type shareDefaultsRequest struct {
+	Permission  models.SharePermission `json:"permission"`
+	ExpiryDays  *int                   `json:"expiryDays"`
+	AllowPublic *bool                  `json:"allowPublic"`
+}
+
+// GetShareDefaults returns the share defaults in effect for a file or
+// folder, which may be inherited from an ancestor folder. Data is null when
+// no folder on the path has defaults.
+func (h *SharesHandler) GetShareDefaults(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+
+	if !h.Access.HasAccess(c.Context(), currentUser.ID, fileID, models.SharePermissionView) {
+		return utils.Fail(c, errInsufficientPermissions)
+	}
+
+	defaults, err := services.EffectiveShareDefaults(c.Context(), h.DB, fileID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Fail(c, errFileNotFound)
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading share defaults")
+	}
+
+	return utils.Success(c, fiber.StatusOK, defaults)
+}
+
+// PutShareDefaults sets the share defaults of a folder the caller owns. They
+// apply to shares created afterwards; existing shares are left as they are.
+func (h *SharesHandler) PutShareDefaults(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	folder, apiErr := h.loadOwnedFolder(c, currentUser.ID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	var req shareDefaultsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+
+	if !isValidSharePermission(string(req.Permission)) {
+		return utils.Error(c, fiber.StatusBadRequest, "invalid permission")
+	}
+	if req.ExpiryDays != nil && (*req.ExpiryDays < 1 || *req.ExpiryDays > services.MaxShareDefaultExpiryDays) {
+		return utils.Error(c, fiber.StatusBadRequest, "expiryDays must be between 1 and 3650")
+	}
+	allowPublic := true
+	if req.AllowPublic != nil {
+		allowPublic = *req.AllowPublic
+	}
+
+	var defaults models.FolderShareDefaults
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("folder_id = ?", folder.ID).First(&defaults).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		defaults.FolderID = folder.ID
+		defaults.Permission = req.Permission
+		defaults.ExpiryDays = req.ExpiryDays
+		defaults.AllowPublic = allowPublic
+		if err := tx.Save(&defaults).Error; err != nil {
+			return err
+		}
+
+		details := map[string]interface{}{
+			"file_name":    folder.Name,
+			"permission":   string(req.Permission),
+			"allow_public": allowPublic,
+		}
+		if req.ExpiryDays != nil {
+			details["expiry_days"] = *req.ExpiryDays
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "share_defaults.update",
+			ResourceType: "file",
+			ResourceID:   &folder.ID,
+			Details:      details,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		})
+	}); err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed saving share defaults")
+	}
+
+	return utils.Success(c, fiber.StatusOK, defaults)
+}
+
+// DeleteShareDefaults removes a folder's own defaults, so it falls back to
+// whatever its ancestors define.
+func (h *SharesHandler) DeleteShareDefaults(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	folder, apiErr := h.loadOwnedFolder(c, currentUser.ID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("folder_id = ?", folder.ID).Delete(&models.FolderShareDefaults{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "share_defaults.delete",
+			ResourceType: "file",
+			ResourceID:   &folder.ID,
+			Details:      map[string]interface{}{"file_name": folder.Name},
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		})
+	}); err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed deleting share defaults")
+	}
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "share defaults removed"})
+}
+
+// loadOwnedFolder loads the :id folder and checks the caller owns it, since
+// only owners may create shares and so only they may shape new ones.
+func (h *SharesHandler) loadOwnedFolder(c *fiber.Ctx, userID uuid.UUID) (*models.File, *utils.APIError) {
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return nil, errInvalidFileID
+	}
+
+	var file models.File
+	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errFileNotFound
+		}
+		return nil, errLoadingFile
+	}
+	if file.OwnerID != userID {
+		return nil, errInsufficientPermissions
+	}
+	if !file.IsDirectory {
+		return nil, errNotDirectory.WithMessage("share defaults can only be set on folders")
+	}
+	return &file, nil
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestShareDefaults(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "share-defaults-owner@test.com", "password123", models.UserRoleUser)
+	recipient, recipientToken := createTestUser(t, env.db, "share-defaults-recipient@test.com", "password123", models.UserRoleUser)
+
+	newFile := func(name string, parent *models.File, dir bool) models.File {
+		file := models.File{Name: name, MimeType: "text/plain", OwnerID: owner.ID, IsDirectory: dir, StoragePath: name}
+		if parent != nil {
+			file.ParentID = &parent.ID
+		}
+		if err := env.db.Create(&file).Error; err != nil {
+			t.Fatalf("failed creating file: %v", err)
+		}
+		return file
+	}
+	folder := newFile("Contracts", nil, true)
+	sub := newFile("2026", &folder, true)
+	doc := newFile("nda.txt", &sub, false)
+
+	defaultsPath := func(f models.File) string { return "/api/files/" + f.ID.String() + "/share-defaults" }
+
+	t.Run("only folders accept defaults", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, defaultsPath(doc), map[string]any{"permission": "view"}, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusBadRequest)
+		if body["code"] != "not_a_directory" {
+			t.Fatalf("expected code not_a_directory, got %v", body["code"])
+		}
+	})
+
+	t.Run("only the owner can set defaults", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, defaultsPath(folder), map[string]any{"permission": "view"}, authHeaders(recipientToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("validates the request", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, defaultsPath(folder), map[string]any{"permission": "own"}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+		resp = performJSONRequest(t, env.app, http.MethodPut, defaultsPath(folder), map[string]any{"permission": "view", "expiryDays": 0}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+
+	t.Run("sets and reports inherited defaults", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, defaultsPath(folder), map[string]any{
+			"permission":  "download",
+			"expiryDays":  14,
+			"allowPublic": false,
+		}, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		data := body["data"].(map[string]any)
+		if data["permission"] != "download" || data["allowPublic"] != false || data["expiryDays"] != float64(14) {
+			t.Fatalf("unexpected defaults %v", data)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, defaultsPath(doc), nil, authHeaders(ownerToken))
+		body = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		data = body["data"].(map[string]any)
+		if data["folderID"] != folder.ID.String() || data["inherited"] != true {
+			t.Fatalf("expected defaults inherited from folder, got %v", data)
+		}
+	})
+
+	t.Run("new shares of child files pick up defaults", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+doc.ID.String()+"/share", map[string]any{
+			"userID": recipient.ID.String(),
+		}, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusCreated)
+		data := body["data"].(map[string]any)
+		if data["permission"] != "download" {
+			t.Fatalf("expected default permission, got %v", data["permission"])
+		}
+		expiresAt, err := time.Parse(time.RFC3339, data["expiresAt"].(string))
+		if err != nil {
+			t.Fatalf("expected default expiry, got %v", data["expiresAt"])
+		}
+		if d := time.Until(expiresAt); d < 13*24*time.Hour || d > 15*24*time.Hour {
+			t.Fatalf("expected expiry about 14 days out, got %s", d)
+		}
+	})
+
+	t.Run("public shares are refused when disallowed", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+doc.ID.String()+"/share", map[string]any{
+			"shareType":  "public_anyone",
+			"permission": "view",
+		}, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusForbidden)
+		if body["code"] != "public_sharing_disabled" {
+			t.Fatalf("expected code public_sharing_disabled, got %v", body["code"])
+		}
+	})
+
+	t.Run("subfolder defaults override their parent", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, defaultsPath(sub), map[string]any{"permission": "view"}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+doc.ID.String()+"/share", map[string]any{
+			"shareType": "public_anyone",
+		}, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusCreated)
+		data := body["data"].(map[string]any)
+		if data["permission"] != "view" || data["expiresAt"] != nil {
+			t.Fatalf("expected subfolder defaults, got %v", data)
+		}
+	})
+
+	t.Run("delete falls back to the parent", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodDelete, defaultsPath(sub), nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performRequest(t, env.app, http.MethodGet, defaultsPath(sub), nil, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if body["data"].(map[string]any)["folderID"] != folder.ID.String() {
+			t.Fatalf("expected parent defaults, got %v", body["data"])
+		}
+	})
+
+	t.Run("files without defaults keep requiring a permission", func(t *testing.T) {
+		other := newFile("other.txt", nil, false)
+		resp := performRequest(t, env.app, http.MethodGet, defaultsPath(other), nil, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if body["data"] != nil {
+			t.Fatalf("expected null defaults, got %v", body["data"])
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+other.ID.String()+"/share", map[string]any{
+			"userID": recipient.ID.String(),
+		}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+}
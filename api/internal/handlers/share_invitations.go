@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+type invitationResponse struct {
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	EmailSent bool      `json:"emailSent"`
+	// URL is only returned when the server cannot email the invitation, so
+	// that the sharer can pass it on themselves.
+	URL string `json:"url,omitempty"`
+}
+
+type pendingShareResponse struct {
+	models.Share
+	Invitation invitationResponse `json:"invitation"`
+}
+
+// inviteByEmail sends the invitation for a pending share, or hands the link
+// back when no mail server is configured.
+func (h *SharesHandler) inviteByEmail(inviter *models.User, file *models.File, share models.Share, invitation *models.ShareInvitation, token string) pendingShareResponse {
+	link := strings.TrimRight(h.FrontendURL, "/") + "/invite/" + token
+	resp := pendingShareResponse{
+		Share: share,
+		Invitation: invitationResponse{
+			Email:     invitation.Email,
+			ExpiresAt: invitation.ExpiresAt,
+		},
+	}
+	if h.Mailer == nil {
+		resp.Invitation.URL = link
+		return resp
+	}
+
+	inviterName := inviter.DisplayName()
+	if inviterName == "" {
+		inviterName = inviter.Email
+	}
+	note := ""
+	if share.Message != "" {
+		note = "\n" + share.Message + "\n"
+	}
+	body := fmt.Sprintf(`%s shared "%s" with you on %s.
+%s
+Create your account with this address to open it:
+
+%s
+
+The invitation expires on %s.
+`, inviterName, file.Name, h.Branding.Name, note, link, invitation.ExpiresAt.UTC().Format("2 January 2006"))
+
+	resp.Invitation.EmailSent = true
+	go func() {
+		if err := h.Mailer.Send(invitation.Email, inviterName+" shared a file with you", body); err != nil {
+			logger.Error("share_invitation_email_failed", err, map[string]interface{}{
+				"invitation_id": invitation.ID.String(),
+			})
+		}
+	}()
+	return resp
+}
+
+// GetInvitation describes a pending invitation so the sign-up page can show
+// what was shared and prefill the invited address. The token is the only
+// credential, so no authentication is needed.
+func (h *SharesHandler) GetInvitation(c *fiber.Ctx) error {
+	invitation, err := services.LookupShareInvitation(c.Context(), h.DB, c.Params("token"))
+	if errors.Is(err, services.ErrInvitationNotFound) {
+		return utils.Fail(c, errInvitationNotFound)
+	}
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading invitation")
+	}
+
+	var share models.Share
+	if err := h.DB.Preload("File").Preload("SharedBy").
+		First(&share, "id = ? AND shared_with_email IS NOT NULL", invitation.ShareID).Error; err != nil {
+		return utils.Fail(c, errInvitationNotFound)
+	}
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{
+		"email":       invitation.Email,
+		"fileName":    share.File.Name,
+		"isDirectory": share.File.IsDirectory,
+		"permission":  share.Permission,
+		"invitedBy":   share.SharedBy.DisplayName(),
+		"expiresAt":   invitation.ExpiresAt,
+	})
+}
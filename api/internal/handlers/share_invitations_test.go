@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestShareInvitations(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "invite-owner@test.com", "password123", models.UserRoleUser)
+	existing, _ := createTestUser(t, env.db, "invite-existing@test.com", "password123", models.UserRoleUser)
+
+	file := models.File{
+		Name:        "invited.txt",
+		MimeType:    "text/plain",
+		Size:        12,
+		OwnerID:     owner.ID,
+		StoragePath: "owner/invited.txt",
+	}
+	if err := env.db.Create(&file).Error; err != nil {
+		t.Fatalf("failed creating file fixture: %v", err)
+	}
+	sharePath := "/api/files/" + file.ID.String() + "/share"
+
+	invite := func(t *testing.T, email string) map[string]interface{} {
+		t.Helper()
+		resp := performJSONRequest(t, env.app, http.MethodPost, sharePath, map[string]any{
+			"email": email, "permission": "view",
+		}, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusCreated)
+		return body["data"].(map[string]interface{})
+	}
+	tokenFromMail := func(t *testing.T, email string) string {
+		t.Helper()
+		mail := testMailer.sentTo(email)
+		if len(mail) == 0 {
+			t.Fatalf("expected an invitation email to %s", email)
+		}
+		_, token, ok := strings.Cut(mail[len(mail)-1].Body, "/invite/")
+		if !ok {
+			t.Fatalf("expected an invitation link in %q", mail[len(mail)-1].Body)
+		}
+		return strings.Fields(token)[0]
+	}
+
+	t.Run("existing account gets an ordinary share", func(t *testing.T) {
+		data := invite(t, "Invite-Existing@Test.com")
+		if data["sharedWithUserID"] != existing.ID.String() || data["invitation"] != nil {
+			t.Fatalf("expected a share with the existing user, got %v", data)
+		}
+	})
+
+	t.Run("invalid email", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, sharePath, map[string]any{
+			"email": "not-an-address", "permission": "view",
+		}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+
+	t.Run("register with the invitation claims the share", func(t *testing.T) {
+		data := invite(t, "newcomer@test.com")
+		invitation := data["invitation"].(map[string]interface{})
+		if data["sharedWithEmail"] != "newcomer@test.com" || invitation["emailSent"] != true || invitation["url"] != nil {
+			t.Fatalf("expected a pending share with an emailed invitation, got %v", data)
+		}
+		token := tokenFromMail(t, "newcomer@test.com")
+
+		resp := performRequest(t, env.app, http.MethodGet, "/api/invitations/"+token, nil, nil)
+		assertStatus(t, resp, http.StatusOK)
+		info := decodeJSONMap(t, resp)["data"].(map[string]interface{})
+		if info["email"] != "newcomer@test.com" || info["fileName"] != "invited.txt" {
+			t.Fatalf("unexpected invitation %v", info)
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/auth/register", map[string]any{
+			"email": "newcomer@test.com", "password": "password123", "firstName": "New", "lastName": "Comer",
+			"invitationToken": token,
+		}, nil)
+		assertStatus(t, resp, http.StatusCreated)
+		headers := authHeaders(decodeJSONMap(t, resp)["data"].(map[string]interface{})["token"].(string))
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/shared", nil, headers)
+		assertStatus(t, resp, http.StatusOK)
+		if files := decodeJSONMap(t, resp)["data"].([]interface{}); len(files) != 1 {
+			t.Fatalf("expected the invited file to be shared with the new account, got %v", files)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/invitations/"+token, nil, nil)
+		assertStatus(t, resp, http.StatusNotFound)
+
+		var event models.OutboxEvent
+		if err := env.db.Where("event_type = ?", "share.invitation_accept").First(&event).Error; err != nil {
+			t.Fatalf("expected an invitation accept event: %v", err)
+		}
+	})
+
+	t.Run("register without the token does not claim", func(t *testing.T) {
+		invite(t, "squatter@test.com")
+
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/auth/register", map[string]any{
+			"email": "squatter@test.com", "password": "password123", "firstName": "S", "lastName": "Q",
+		}, nil)
+		assertStatus(t, resp, http.StatusCreated)
+		headers := authHeaders(decodeJSONMap(t, resp)["data"].(map[string]interface{})["token"].(string))
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/shared", nil, headers)
+		assertStatus(t, resp, http.StatusOK)
+		if files := decodeJSONMap(t, resp)["data"].([]interface{}); len(files) != 0 {
+			t.Fatalf("expected nothing shared without the invitation token, got %v", files)
+		}
+	})
+
+	t.Run("revoking the share withdraws the invitation", func(t *testing.T) {
+		data := invite(t, "withdrawn@test.com")
+		token := tokenFromMail(t, "withdrawn@test.com")
+
+		resp := performRequest(t, env.app, http.MethodDelete, "/api/shares/"+data["id"].(string), nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/invitations/"+token, nil, nil)
+		assertStatus(t, resp, http.StatusNotFound)
+	})
+
+	t.Run("link is returned without a mail server", func(t *testing.T) {
+		h := &SharesHandler{FrontendURL: "https://docs.example.com/"}
+		invitation := &models.ShareInvitation{Email: "x@test.com", ExpiresAt: time.Now().Add(time.Hour)}
+		resp := h.inviteByEmail(owner, &file, models.Share{}, invitation, "dsi_abc")
+		if resp.Invitation.EmailSent || resp.Invitation.URL != "https://docs.example.com/invite/dsi_abc" {
+			t.Fatalf("unexpected invitation %+v", resp.Invitation)
+		}
+	})
+}
@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"image"
+	"net/mail"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/docshare/api/internal/config"
 	"github.com/docshare/api/internal/middleware"
 	"github.com/docshare/api/internal/models"
 	"github.com/docshare/api/internal/services"
@@ -15,53 +19,74 @@ import (
 )
 
 type SharesHandler struct {
-	DB     *gorm.DB
-	Access *services.AccessService
-	Audit  *services.AuditService
+	DB          *gorm.DB
+	Access      *services.AccessService
+	Audit       *services.AuditService
+	Mailer      services.Mailer
+	FrontendURL string
+	Branding    config.BrandingConfig
+	// Captcha, when set, is advertised to anonymous visitors in PublicMeta.
+	Captcha *services.CaptchaService
+	Vaults  *services.Vaults
+	// QRLogo, when set, is drawn in the middle of share link QR codes.
+	QRLogo image.Image
 }
 
-func NewSharesHandler(db *gorm.DB, access *services.AccessService, audit *services.AuditService) *SharesHandler {
-	return &SharesHandler{DB: db, Access: access, Audit: audit}
+func NewSharesHandler(db *gorm.DB, access *services.AccessService, audit *services.AuditService, mailer services.Mailer, cfg *config.Config) *SharesHandler {
+	return &SharesHandler{
+		DB:          db,
+		Access:      access,
+		Audit:       audit,
+		Mailer:      mailer,
+		FrontendURL: cfg.Server.FrontendURL,
+		Branding:    cfg.Branding,
+	}
 }
 
+// maxShareMessageLength bounds the note a sharer can attach to a share.
+const maxShareMessageLength = 1000
+
 type createShareRequest struct {
 	UserID     *uuid.UUID             `json:"userID"`
 	GroupID    *uuid.UUID             `json:"groupID"`
+	Email      *string                `json:"email"`
 	ShareType  *models.ShareType      `json:"shareType"`
 	Permission models.SharePermission `json:"permission"`
 	ExpiresAt  *time.Time             `json:"expiresAt"`
+	Message    string                 `json:"message"`
+	Watermark  bool                   `json:"watermark"`
+	ViewOnly   bool                   `json:"viewOnly"`
+	// VaultKeys carries the folder key wrapped for the recipient's keys
+	// when sharing an encrypted folder.
+	VaultKeys []services.WrappedKey `json:"vaultKeys"`
 }
 
 func (h *SharesHandler) ShareFile(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	var file models.File
 	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "file not found")
+			return utils.Fail(c, errFileNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading file")
+		return utils.Fail(c, errLoadingFile)
 	}
 
 	if file.OwnerID != currentUser.ID {
-		return utils.Error(c, fiber.StatusForbidden, "insufficient permissions")
+		return utils.Fail(c, errInsufficientPermissions)
 	}
 
 	var req createShareRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
-	}
-
-	if !isValidSharePermission(string(req.Permission)) {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid permission")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	shareType := models.ShareTypePrivate
@@ -72,9 +97,66 @@ func (h *SharesHandler) ShareFile(c *fiber.Ctx) error {
 		shareType = *req.ShareType
 	}
 
+	share := models.Share{
+		FileID:            file.ID,
+		SharedByID:        currentUser.ID,
+		SharedWithUserID:  req.UserID,
+		SharedWithGroupID: req.GroupID,
+		ShareType:         shareType,
+		Permission:        req.Permission,
+		ExpiresAt:         req.ExpiresAt,
+		Message:           strings.TrimSpace(req.Message),
+		Watermark:         req.Watermark,
+		ViewOnly:          req.ViewOnly,
+	}
+	if utf8.RuneCountInString(share.Message) > maxShareMessageLength {
+		return utils.Error(c, fiber.StatusBadRequest, "message must be at most 1000 characters")
+	}
+
+	defaults, err := services.EffectiveShareDefaults(c.Context(), h.DB, file.ID)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading share defaults")
+	}
+	if err := services.ApplyShareDefaults(defaults, &share, time.Now()); err != nil {
+		return utils.Fail(c, serviceError(err, errInvalidBody))
+	}
+
+	if !isValidSharePermission(string(share.Permission)) {
+		return utils.Error(c, fiber.StatusBadRequest, "invalid permission")
+	}
+	if share.ViewOnly && share.Permission != models.SharePermissionView {
+		return utils.Fail(c, errViewOnlyPermission)
+	}
+
 	if shareType == models.ShareTypePrivate {
-		if (req.UserID == nil && req.GroupID == nil) || (req.UserID != nil && req.GroupID != nil) {
-			return utils.Error(c, fiber.StatusBadRequest, "exactly one of userID or groupID is required for private shares")
+		targets := 0
+		for _, set := range []bool{req.UserID != nil, req.GroupID != nil, req.Email != nil} {
+			if set {
+				targets++
+			}
+		}
+		if targets != 1 {
+			return utils.Error(c, fiber.StatusBadRequest, "exactly one of userID, groupID or email is required for private shares")
+		}
+
+		if req.Email != nil {
+			email := strings.ToLower(strings.TrimSpace(*req.Email))
+			if _, err := mail.ParseAddress(email); err != nil {
+				return utils.Error(c, fiber.StatusBadRequest, "invalid email")
+			}
+			// Someone who already has an account gets an ordinary share.
+			var existing models.User
+			err := h.DB.Scopes(services.OrganizationScope("users", currentUser.OrganizationID)).
+				Select("id").First(&existing, "LOWER(email) = ?", email).Error
+			switch {
+			case err == nil:
+				req.UserID = &existing.ID
+				share.SharedWithUserID = &existing.ID
+			case err == gorm.ErrRecordNotFound:
+				share.SharedWithEmail = &email
+			default:
+				return utils.Error(c, fiber.StatusInternalServerError, "failed loading target user")
+			}
 		}
 
 		if req.UserID != nil {
@@ -82,7 +164,7 @@ func (h *SharesHandler) ShareFile(c *fiber.Ctx) error {
 				return utils.Error(c, fiber.StatusBadRequest, "cannot share with yourself")
 			}
 			var targetUser models.User
-			if err := h.DB.First(&targetUser, "id = ?", *req.UserID).Error; err != nil {
+			if err := h.DB.Scopes(services.OrganizationScope("users", currentUser.OrganizationID)).First(&targetUser, "id = ?", *req.UserID).Error; err != nil {
 				if err == gorm.ErrRecordNotFound {
 					return utils.Error(c, fiber.StatusNotFound, "target user not found")
 				}
@@ -91,7 +173,7 @@ func (h *SharesHandler) ShareFile(c *fiber.Ctx) error {
 		}
 		if req.GroupID != nil {
 			var group models.Group
-			if err := h.DB.First(&group, "id = ?", *req.GroupID).Error; err != nil {
+			if err := h.DB.Scopes(services.OrganizationScope("groups", currentUser.OrganizationID)).First(&group, "id = ?", *req.GroupID).Error; err != nil {
 				if err == gorm.ErrRecordNotFound {
 					return utils.Error(c, fiber.StatusNotFound, "target group not found")
 				}
@@ -99,8 +181,14 @@ func (h *SharesHandler) ShareFile(c *fiber.Ctx) error {
 			}
 		}
 	} else {
-		if req.UserID != nil || req.GroupID != nil {
-			return utils.Error(c, fiber.StatusBadRequest, "userID and groupID must not be set for public shares")
+		if req.UserID != nil || req.GroupID != nil || req.Email != nil {
+			return utils.Error(c, fiber.StatusBadRequest, "userID, groupID and email must not be set for public shares")
+		}
+		if !h.Access.PublicSharingEnabled(c.Context()) {
+			return utils.Fail(c, errPublicSharingOff)
+		}
+		if err := h.Access.PublicSharePolicy(c.Context()).Apply(&share, &file, time.Now()); err != nil {
+			return utils.Fail(c, serviceError(err, errInvalidBody))
 		}
 
 		var existingCount int64
@@ -111,89 +199,157 @@ func (h *SharesHandler) ShareFile(c *fiber.Ctx) error {
 		if existingCount > 0 {
 			return utils.Error(c, fiber.StatusConflict, "a public share of this type already exists for this file")
 		}
+
+		slug, err := services.NewShareSlug()
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed creating share")
+		}
+		share.Slug = &slug
 	}
 
-	share := models.Share{
-		FileID:            file.ID,
-		SharedByID:        currentUser.ID,
-		SharedWithUserID:  req.UserID,
-		SharedWithGroupID: req.GroupID,
-		ShareType:         shareType,
-		Permission:        req.Permission,
-		ExpiresAt:         req.ExpiresAt,
+	// Recipients of an encrypted folder need its key, which can only be
+	// wrapped for a user who has registered a public key.
+	if file.VaultID != nil {
+		if *file.VaultID != file.ID {
+			return utils.Fail(c, serviceError(services.ErrVaultShareRootOnly, nil))
+		}
+		if shareType != models.ShareTypePrivate || req.UserID == nil {
+			return utils.Fail(c, serviceError(services.ErrVaultShareType, nil))
+		}
 	}
 
-	if err := h.DB.Create(&share).Error; err != nil {
-		return utils.Error(c, fiber.StatusInternalServerError, "failed creating share")
+	control, err := services.EffectiveShareControl(c.Context(), h.DB, file.ID)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading share control")
+	}
+	if services.ShareNeedsApproval(control, &share) {
+		return h.requestShareApproval(c, currentUser, &file, control, &share, req.VaultKeys)
 	}
 
-	details := map[string]interface{}{
-		"file_id":    file.ID.String(),
+	auditDetails := map[string]interface{}{
 		"file_name":  file.Name,
-		"permission": string(req.Permission),
+		"permission": string(share.Permission),
 		"share_type": string(shareType),
-		"share_id":   share.ID.String(),
+	}
+	if share.Watermark {
+		auditDetails["watermark"] = true
+	}
+	if share.ViewOnly {
+		auditDetails["view_only"] = true
 	}
 	if req.UserID != nil {
-		details["shared_with_user_id"] = req.UserID.String()
+		auditDetails["shared_with_user_id"] = req.UserID.String()
 	}
-	if req.GroupID != nil {
-		details["shared_with_group_id"] = req.GroupID.String()
+	if share.SharedWithEmail != nil {
+		auditDetails["invited_email"] = *share.SharedWithEmail
 	}
-	if req.ExpiresAt != nil {
-		details["expires_at"] = req.ExpiresAt
+	if req.GroupID != nil {
+		auditDetails["shared_with_group_id"] = req.GroupID.String()
+		var grp models.Group
+		if err := h.DB.Select("name").First(&grp, "id = ?", *req.GroupID).Error; err == nil {
+			auditDetails["group_name"] = grp.Name
+		}
 	}
 
-	logger.InfoWithUser(currentUser.ID.String(), "file_shared", details)
+	var invitationToken string
+	var invitation *models.ShareInvitation
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&share).Error; err != nil {
+			return err
+		}
+		if file.VaultID != nil {
+			if err := h.Vaults.StoreWrappedKeys(tx, *file.VaultID, *req.UserID, currentUser.ID, req.VaultKeys); err != nil {
+				return err
+			}
+			auditDetails["vault_keys"] = len(req.VaultKeys)
+		}
+		if share.IsPending() {
+			var err error
+			invitationToken, invitation, err = services.CreateShareInvitation(tx, &share, currentUser.OrganizationID)
+			if err != nil {
+				return err
+			}
+		}
+		auditDetails["share_id"] = share.ID.String()
+		if key := middleware.GetIdempotencyKey(c); key != "" {
+			auditDetails["idempotency_key"] = key
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "share.create",
+			ResourceType: "share",
+			ResourceID:   &file.ID,
+			Details:      auditDetails,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		})
+	}); err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "internal_error", "failed creating share")))
+	}
 
-	auditDetails := map[string]interface{}{
+	details := map[string]interface{}{
+		"file_id":    file.ID.String(),
 		"file_name":  file.Name,
-		"permission": string(req.Permission),
+		"permission": string(share.Permission),
 		"share_type": string(shareType),
 		"share_id":   share.ID.String(),
 	}
 	if req.UserID != nil {
-		auditDetails["shared_with_user_id"] = req.UserID.String()
+		details["shared_with_user_id"] = req.UserID.String()
 	}
 	if req.GroupID != nil {
-		auditDetails["shared_with_group_id"] = req.GroupID.String()
-		var grp models.Group
-		if err := h.DB.Select("name").First(&grp, "id = ?", *req.GroupID).Error; err == nil {
-			auditDetails["group_name"] = grp.Name
-		}
+		details["shared_with_group_id"] = req.GroupID.String()
+	}
+	if share.ExpiresAt != nil {
+		details["expires_at"] = share.ExpiresAt
+	}
+	if invitation != nil {
+		details["invitation_id"] = invitation.ID.String()
+	}
+
+	logger.InfoWithUser(currentUser.ID.String(), "file_shared", details)
+
+	if invitation == nil {
+		return utils.Success(c, fiber.StatusCreated, share)
 	}
-	h.Audit.LogAsync(services.AuditEntry{
-		UserID:       &currentUser.ID,
-		Action:       "share.create",
-		ResourceType: "share",
-		ResourceID:   &file.ID,
-		Details:      auditDetails,
-		IPAddress:    c.IP(),
-		RequestID:    getRequestID(c),
-	})
-
-	return utils.Success(c, fiber.StatusCreated, share)
+	return utils.Success(c, fiber.StatusCreated, h.inviteByEmail(currentUser, &file, share, invitation, invitationToken))
 }
 
 func (h *SharesHandler) ListFileShares(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	fileID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid file id")
+		return utils.Fail(c, errInvalidFileID)
 	}
 
 	if !h.Access.HasAccess(c.Context(), currentUser.ID, fileID, models.SharePermissionView) {
-		return utils.Error(c, fiber.StatusForbidden, "insufficient permissions")
+		return utils.Fail(c, errInsufficientPermissions)
 	}
 
 	p := utils.ParsePagination(c)
+	order := utils.ParseTimeOrder(c)
 
 	baseQuery := h.DB.Model(&models.Share{}).Where("file_id = ?", fileID)
 
+	if utils.WantsCursor(c) {
+		shares, nextCursor, err := findCreatedAtKeyset(c,
+			baseQuery.Preload("SharedWithUser").Preload("SharedWithGroup").Preload("SharedBy"),
+			order, p.Limit,
+			func(s models.Share) (time.Time, uuid.UUID) { return s.CreatedAt, s.ID },
+		)
+		if err == utils.ErrInvalidCursor {
+			return utils.Fail(c, errInvalidCursor)
+		}
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed loading shares")
+		}
+		return utils.CursorPaginated(c, shares, p.Limit, nextCursor)
+	}
+
 	var total int64
 	if err := baseQuery.Count(&total).Error; err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed counting shares")
@@ -201,7 +357,7 @@ func (h *SharesHandler) ListFileShares(c *fiber.Ctx) error {
 
 	var shares []models.Share
 	if err := utils.ApplyPagination(
-		baseQuery.Preload("SharedWithUser").Preload("SharedWithGroup").Preload("SharedBy"),
+		baseQuery.Preload("SharedWithUser").Preload("SharedWithGroup").Preload("SharedBy").Order("created_at "+order),
 		p,
 	).Find(&shares).Error; err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed loading shares")
@@ -213,87 +369,106 @@ func (h *SharesHandler) ListFileShares(c *fiber.Ctx) error {
 func (h *SharesHandler) DeleteShare(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	shareID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid share id")
+		return utils.Fail(c, errInvalidShareID)
 	}
 
 	var share models.Share
 	if err := h.DB.First(&share, "id = ?", shareID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "share not found")
+			return utils.Fail(c, errShareNotFound)
 		}
 		return utils.Error(c, fiber.StatusInternalServerError, "failed loading share")
 	}
 
 	if share.SharedByID != currentUser.ID && !h.Access.HasAccess(c.Context(), currentUser.ID, share.FileID, models.SharePermissionEdit) {
-		return utils.Error(c, fiber.StatusForbidden, "insufficient permissions")
+		return utils.Fail(c, errInsufficientPermissions)
 	}
 
 	var file models.File
 	h.DB.Select("id", "name").First(&file, "id = ?", share.FileID)
 
-	if err := h.DB.Delete(&models.Share{}, "id = ?", share.ID).Error; err != nil {
+	deleteDetails := shareDeleteDetails(share, file.Name)
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.Share{}, "id = ?", share.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("share_id = ? AND accepted_at IS NULL", share.ID).Delete(&models.ShareInvitation{}).Error; err != nil {
+			return err
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "share.delete",
+			ResourceType: "share",
+			ResourceID:   &share.FileID,
+			Details:      deleteDetails,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		})
+	}); err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed deleting share")
 	}
 
-	deleteDetails := map[string]interface{}{
-		"file_name": file.Name,
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "share revoked"})
+}
+
+// shareDeleteDetails describes a revoked share for its share.delete event,
+// naming who lost access so the change feed can tell them.
+func shareDeleteDetails(share models.Share, fileName string) map[string]interface{} {
+	details := map[string]interface{}{
+		"file_name": fileName,
 		"share_id":  share.ID.String(),
 	}
 	if share.SharedWithUserID != nil {
-		deleteDetails["shared_with_user_id"] = share.SharedWithUserID.String()
+		details["shared_with_user_id"] = share.SharedWithUserID.String()
 	}
 	if share.SharedWithGroupID != nil {
-		deleteDetails["shared_with_group_id"] = share.SharedWithGroupID.String()
-	}
-	h.Audit.LogAsync(services.AuditEntry{
-		UserID:       &currentUser.ID,
-		Action:       "share.delete",
-		ResourceType: "share",
-		ResourceID:   &share.FileID,
-		Details:      deleteDetails,
-		IPAddress:    c.IP(),
-		RequestID:    getRequestID(c),
-	})
-
-	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "share revoked"})
+		details["shared_with_group_id"] = share.SharedWithGroupID.String()
+	}
+	if share.SharedWithEmail != nil {
+		details["invited_email"] = *share.SharedWithEmail
+	}
+	return details
 }
 
 type updateShareRequest struct {
 	Permission models.SharePermission `json:"permission"`
 	ExpiresAt  *time.Time             `json:"expiresAt"`
+	Message    *string                `json:"message"`
+	Watermark  *bool                  `json:"watermark"`
+	ViewOnly   *bool                  `json:"viewOnly"`
 }
 
 func (h *SharesHandler) UpdateShare(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	shareID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid share id")
+		return utils.Fail(c, errInvalidShareID)
 	}
 
 	var share models.Share
 	if err := h.DB.First(&share, "id = ?", shareID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "share not found")
+			return utils.Fail(c, errShareNotFound)
 		}
 		return utils.Error(c, fiber.StatusInternalServerError, "failed loading share")
 	}
 
 	if share.SharedByID != currentUser.ID && !h.Access.HasAccess(c.Context(), currentUser.ID, share.FileID, models.SharePermissionEdit) {
-		return utils.Error(c, fiber.StatusForbidden, "insufficient permissions")
+		return utils.Fail(c, errInsufficientPermissions)
 	}
 
 	var req updateShareRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	if !isValidSharePermission(string(req.Permission)) {
@@ -304,10 +479,56 @@ func (h *SharesHandler) UpdateShare(c *fiber.Ctx) error {
 		"permission": req.Permission,
 	}
 	if req.ExpiresAt != nil {
+		if share.IsPublic() {
+			if err := h.Access.PublicSharePolicy(c.Context()).CheckExpiry(share.CreatedAt, req.ExpiresAt); err != nil {
+				return utils.Fail(c, serviceError(err, errInvalidBody))
+			}
+		}
 		updates["expires_at"] = *req.ExpiresAt
 	}
+	if req.Message != nil {
+		message := strings.TrimSpace(*req.Message)
+		if utf8.RuneCountInString(message) > maxShareMessageLength {
+			return utils.Error(c, fiber.StatusBadRequest, "message must be at most 1000 characters")
+		}
+		updates["message"] = message
+	}
+	if req.Watermark != nil {
+		updates["watermark"] = *req.Watermark
+	}
+	viewOnly := share.ViewOnly
+	if req.ViewOnly != nil {
+		viewOnly = *req.ViewOnly
+		updates["view_only"] = viewOnly
+	}
+	if viewOnly && req.Permission != models.SharePermissionView {
+		return utils.Fail(c, errViewOnlyPermission)
+	}
 
-	if err := h.DB.Model(&models.Share{}).Where("id = ?", share.ID).Updates(updates).Error; err != nil {
+	details := map[string]interface{}{
+		"share_id":       share.ID.String(),
+		"new_permission": string(req.Permission),
+	}
+	if req.Watermark != nil {
+		details["watermark"] = *req.Watermark
+	}
+	if req.ViewOnly != nil {
+		details["view_only"] = *req.ViewOnly
+	}
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Share{}).Where("id = ?", share.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "share.update",
+			ResourceType: "share",
+			ResourceID:   &share.FileID,
+			Details:      details,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		})
+	}); err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed updating share")
 	}
 
@@ -315,31 +536,18 @@ func (h *SharesHandler) UpdateShare(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed reloading share")
 	}
 
-	h.Audit.LogAsync(services.AuditEntry{
-		UserID:       &currentUser.ID,
-		Action:       "share.update",
-		ResourceType: "share",
-		ResourceID:   &share.FileID,
-		Details: map[string]interface{}{
-			"share_id":       share.ID.String(),
-			"new_permission": string(req.Permission),
-		},
-		IPAddress: c.IP(),
-		RequestID: getRequestID(c),
-	})
-
 	return utils.Success(c, fiber.StatusOK, share)
 }
 
 func (h *SharesHandler) ListSharedWithMe(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	p := utils.ParsePagination(c)
 
-	baseQuery := h.DB.Model(&models.File{})
+	baseQuery := h.DB.Model(&models.File{}).Scopes(services.OrganizationScope("files", currentUser.OrganizationID))
 
 	search := strings.TrimSpace(c.Query("search"))
 	if search != "" {
@@ -349,6 +557,7 @@ func (h *SharesHandler) ListSharedWithMe(c *fiber.Ctx) error {
 
 	sharedFilesSubquery := h.DB.
 		Table("shares").
+		Scopes(h.Access.ActiveSharers("shares")).
 		Select("file_id").
 		Joins("LEFT JOIN group_memberships gm ON gm.group_id = shares.shared_with_group_id").
 		Where("shares.expires_at IS NULL OR shares.expires_at > NOW()").
@@ -356,6 +565,20 @@ func (h *SharesHandler) ListSharedWithMe(c *fiber.Ctx) error {
 		Where("files.owner_id != ?", currentUser.ID)
 
 	baseQuery = baseQuery.Where("id IN (?)", sharedFilesSubquery).Where("owner_id != ?", currentUser.ID)
+	order := utils.ParseTimeOrder(c)
+
+	if utils.WantsCursor(c) {
+		files, nextCursor, err := findCreatedAtKeyset(c, baseQuery, order, p.Limit,
+			func(f models.File) (time.Time, uuid.UUID) { return f.CreatedAt, f.ID },
+		)
+		if err == utils.ErrInvalidCursor {
+			return utils.Fail(c, errInvalidCursor)
+		}
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed loading shared files")
+		}
+		return utils.CursorPaginated(c, files, p.Limit, nextCursor)
+	}
 
 	var total int64
 	if err := baseQuery.Count(&total).Error; err != nil {
@@ -363,7 +586,7 @@ func (h *SharesHandler) ListSharedWithMe(c *fiber.Ctx) error {
 	}
 
 	var files []models.File
-	if err := utils.ApplyPagination(baseQuery.Order("created_at DESC"), p).Find(&files).Error; err != nil {
+	if err := utils.ApplyPagination(baseQuery.Order("created_at "+order), p).Find(&files).Error; err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed loading shared files")
 	}
 
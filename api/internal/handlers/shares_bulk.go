@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxBatchShares bounds how many shares one batch update may name.
+const maxBatchShares = 500
+
+var (
+	errNoShareChanges      = utils.NewError(fiber.StatusBadRequest, "no_share_changes", "set permission, expiresAt or clearExpiry")
+	errTooManyShares       = utils.NewError(fiber.StatusBadRequest, "too_many_shares", "at most 500 shares can be updated at once")
+	errShareFilterRequired = utils.NewError(fiber.StatusBadRequest, "share_filter_required", "set at least one of type, expired or groupID")
+	errInvalidShareFilter  = utils.NewError(fiber.StatusBadRequest, "invalid_share_filter", "type must be public, private, public_anyone or public_logged_in")
+)
+
+type batchUpdateSharesRequest struct {
+	ShareIDs    []uuid.UUID             `json:"shareIDs"`
+	Permission  *models.SharePermission `json:"permission"`
+	ExpiresAt   *time.Time              `json:"expiresAt"`
+	ClearExpiry bool                    `json:"clearExpiry"`
+}
+
+// loadManagedFile loads the file named in the route and checks the caller
+// may manage all of its shares: they own it or can edit it.
+func (h *SharesHandler) loadManagedFile(c *fiber.Ctx, userID uuid.UUID) (*models.File, *utils.APIError) {
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return nil, errInvalidFileID
+	}
+	var file models.File
+	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errFileNotFound
+		}
+		return nil, errLoadingFile
+	}
+	if file.OwnerID != userID && !h.Access.HasAccess(c.Context(), userID, file.ID, models.SharePermissionEdit) {
+		return nil, errInsufficientPermissions
+	}
+	return &file, nil
+}
+
+// BatchUpdateShares changes the permission and/or expiry of several shares
+// of one file at once. Every named share must belong to the file; the
+// update is all or nothing, with a share.update event per share.
+func (h *SharesHandler) BatchUpdateShares(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	file, apiErr := h.loadManagedFile(c, currentUser.ID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	var req batchUpdateSharesRequest
+	if err := c.BodyParser(&req); err != nil || len(req.ShareIDs) == 0 {
+		return utils.Fail(c, errInvalidBody)
+	}
+	if len(req.ShareIDs) > maxBatchShares {
+		return utils.Fail(c, errTooManyShares)
+	}
+	if req.ExpiresAt != nil && req.ClearExpiry {
+		return utils.Error(c, fiber.StatusBadRequest, "expiresAt and clearExpiry cannot both be set")
+	}
+
+	updates := map[string]interface{}{}
+	if req.Permission != nil {
+		if !isValidSharePermission(string(*req.Permission)) {
+			return utils.Error(c, fiber.StatusBadRequest, "invalid permission")
+		}
+		updates["permission"] = *req.Permission
+	}
+	if req.ExpiresAt != nil {
+		updates["expires_at"] = *req.ExpiresAt
+	}
+	if req.ClearExpiry {
+		updates["expires_at"] = nil
+	}
+	if len(updates) == 0 {
+		return utils.Fail(c, errNoShareChanges)
+	}
+
+	ids := uniqueUUIDs(req.ShareIDs)
+	var shares []models.Share
+	if err := h.DB.Where("id IN ? AND file_id = ?", ids, file.ID).Find(&shares).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading shares")
+	}
+	if len(shares) != len(ids) {
+		return utils.Fail(c, errShareNotFound)
+	}
+
+	details := func(share models.Share) map[string]interface{} {
+		d := map[string]interface{}{
+			"file_name": file.Name,
+			"share_id":  share.ID.String(),
+			"batch":     true,
+		}
+		if req.Permission != nil {
+			d["new_permission"] = string(*req.Permission)
+		}
+		if req.ExpiresAt != nil {
+			d["new_expires_at"] = req.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+		if req.ClearExpiry {
+			d["expiry_cleared"] = true
+		}
+		return d
+	}
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Share{}).Where("id IN ?", ids).Updates(updates).Error; err != nil {
+			return err
+		}
+		for _, share := range shares {
+			if err := services.RecordEvent(tx, services.AuditEntry{
+				UserID:       &currentUser.ID,
+				Action:       "share.update",
+				ResourceType: "share",
+				ResourceID:   &share.FileID,
+				Details:      details(share),
+				IPAddress:    c.IP(),
+				RequestID:    getRequestID(c),
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed updating shares")
+	}
+
+	if err := h.DB.Where("id IN ?", ids).Order("created_at ASC").Find(&shares).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed reloading shares")
+	}
+	return utils.Success(c, fiber.StatusOK, shares)
+}
+
+// DeleteShares revokes the shares of one file matching every given filter:
+// type (public covers both public types), expired=true, and groupID. At
+// least one filter is required so a bare request can't wipe every share.
+func (h *SharesHandler) DeleteShares(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	file, apiErr := h.loadManagedFile(c, currentUser.ID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	query := h.DB.Where("file_id = ?", file.ID)
+	filtered := false
+	switch shareType := c.Query("type"); shareType {
+	case "":
+	case "public":
+		query = query.Where("share_type IN ?", []models.ShareType{models.ShareTypePublicAnyone, models.ShareTypePublicLoggedIn})
+		filtered = true
+	default:
+		if !isValidShareType(shareType) {
+			return utils.Fail(c, errInvalidShareFilter)
+		}
+		query = query.Where("share_type = ?", shareType)
+		filtered = true
+	}
+	if raw := c.Query("expired"); raw != "" {
+		expired, err := strconv.ParseBool(raw)
+		if err != nil {
+			return utils.Error(c, fiber.StatusBadRequest, "expired must be true or false")
+		}
+		now := time.Now().UTC()
+		if expired {
+			query = query.Where("expires_at IS NOT NULL AND expires_at <= ?", now)
+		} else {
+			query = query.Where("expires_at IS NULL OR expires_at > ?", now)
+		}
+		filtered = true
+	}
+	if raw := c.Query("groupID"); raw != "" {
+		groupID, err := parseUUID(raw)
+		if err != nil {
+			return utils.Fail(c, errInvalidGroupID)
+		}
+		query = query.Where("shared_with_group_id = ?", groupID)
+		filtered = true
+	}
+	if !filtered {
+		return utils.Fail(c, errShareFilterRequired)
+	}
+
+	var shares []models.Share
+	if err := query.Find(&shares).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading shares")
+	}
+
+	ids := make([]uuid.UUID, len(shares))
+	for i, share := range shares {
+		ids[i] = share.ID
+	}
+	if len(shares) > 0 {
+		if err := h.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(&models.Share{}, "id IN ?", ids).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("share_id IN ? AND accepted_at IS NULL", ids).Delete(&models.ShareInvitation{}).Error; err != nil {
+				return err
+			}
+			for _, share := range shares {
+				details := shareDeleteDetails(share, file.Name)
+				details["batch"] = true
+				if err := services.RecordEvent(tx, services.AuditEntry{
+					UserID:       &currentUser.ID,
+					Action:       "share.delete",
+					ResourceType: "share",
+					ResourceID:   &share.FileID,
+					Details:      details,
+					IPAddress:    c.IP(),
+					RequestID:    getRequestID(c),
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed deleting shares")
+		}
+	}
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"deleted": len(ids), "shareIDs": ids})
+}
+
+func uniqueUUIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	out := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
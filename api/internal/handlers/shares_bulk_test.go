@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestBulkShareManagement(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "bulk-owner@test.com", "password123", models.UserRoleUser)
+	alice, aliceToken := createTestUser(t, env.db, "bulk-alice@test.com", "password123", models.UserRoleUser)
+	bob, _ := createTestUser(t, env.db, "bulk-bob@test.com", "password123", models.UserRoleUser)
+
+	folder := models.File{Name: "Board", IsDirectory: true, OwnerID: owner.ID}
+	other := models.File{Name: "other.txt", MimeType: "text/plain", OwnerID: owner.ID, StoragePath: "other.txt"}
+	env.db.Create(&folder)
+	env.db.Create(&other)
+	group := models.Group{Name: "Board members", CreatedByID: owner.ID}
+	env.db.Create(&group)
+
+	past := time.Now().Add(-time.Hour)
+	share := func(fileID uuid.UUID, s models.Share) models.Share {
+		s.FileID = fileID
+		s.SharedByID = owner.ID
+		if s.ShareType == "" {
+			s.ShareType = models.ShareTypePrivate
+		}
+		if s.Permission == "" {
+			s.Permission = models.SharePermissionView
+		}
+		if err := env.db.Create(&s).Error; err != nil {
+			t.Fatalf("failed creating share: %v", err)
+		}
+		return s
+	}
+	aliceShare := share(folder.ID, models.Share{SharedWithUserID: &alice.ID})
+	bobShare := share(folder.ID, models.Share{SharedWithUserID: &bob.ID, ExpiresAt: &past})
+	groupShare := share(folder.ID, models.Share{SharedWithGroupID: &group.ID})
+	publicShare := share(folder.ID, models.Share{ShareType: models.ShareTypePublicAnyone})
+	otherShare := share(other.ID, models.Share{SharedWithUserID: &alice.ID})
+
+	base := "/api/files/" + folder.ID.String() + "/shares"
+	countEvents := func(action string) int64 {
+		var n int64
+		env.db.Model(&models.OutboxEvent{}).Where("event_type = ? AND resource_id = ?", action, folder.ID).Count(&n)
+		return n
+	}
+
+	t.Run("batch update changes permission and expiry", func(t *testing.T) {
+		expires := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+		resp := performJSONRequest(t, env.app, http.MethodPut, base+"/batch", map[string]any{
+			"shareIDs":   []string{aliceShare.ID.String(), bobShare.ID.String()},
+			"permission": "download",
+			"expiresAt":  expires.Format(time.RFC3339),
+		}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		if data := decodeJSONMap(t, resp)["data"].([]any); len(data) != 2 {
+			t.Fatalf("expected both shares back, got %v", data)
+		}
+
+		var updated []models.Share
+		env.db.Find(&updated, "id IN ?", []uuid.UUID{aliceShare.ID, bobShare.ID})
+		for _, s := range updated {
+			if s.Permission != models.SharePermissionDownload || s.ExpiresAt == nil || !s.ExpiresAt.Equal(expires) {
+				t.Fatalf("expected the share updated, got %+v", s)
+			}
+		}
+		if n := countEvents("share.update"); n != 2 {
+			t.Fatalf("expected a share.update per share, got %d", n)
+		}
+	})
+
+	t.Run("batch update clears expiry", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, base+"/batch", map[string]any{
+			"shareIDs":    []string{aliceShare.ID.String()},
+			"clearExpiry": true,
+		}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		var reloaded models.Share
+		env.db.First(&reloaded, "id = ?", aliceShare.ID)
+		if reloaded.ExpiresAt != nil || reloaded.Permission != models.SharePermissionDownload {
+			t.Fatalf("expected only the expiry cleared, got %+v", reloaded)
+		}
+	})
+
+	t.Run("batch update is all or nothing", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, base+"/batch", map[string]any{
+			"shareIDs":   []string{groupShare.ID.String(), otherShare.ID.String()},
+			"permission": "edit",
+		}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusNotFound)
+		var reloaded models.Share
+		env.db.First(&reloaded, "id = ?", groupShare.ID)
+		if reloaded.Permission != models.SharePermissionView {
+			t.Fatalf("expected no change, got %s", reloaded.Permission)
+		}
+	})
+
+	t.Run("batch update needs a change", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, base+"/batch", map[string]any{
+			"shareIDs": []string{groupShare.ID.String()},
+		}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+		if code := decodeJSONMap(t, resp)["code"]; code != "no_share_changes" {
+			t.Fatalf("expected no_share_changes, got %v", code)
+		}
+	})
+
+	t.Run("recipients cannot manage shares", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodDelete, base+"?type=public", nil, authHeaders(aliceToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("delete requires a filter", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodDelete, base, nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+		if code := decodeJSONMap(t, resp)["code"]; code != "share_filter_required" {
+			t.Fatalf("expected share_filter_required, got %v", code)
+		}
+	})
+
+	t.Run("delete public shares", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodDelete, base+"?type=public", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		if data["deleted"] != float64(1) || data["shareIDs"].([]any)[0] != publicShare.ID.String() {
+			t.Fatalf("expected the public share deleted, got %v", data)
+		}
+	})
+
+	t.Run("delete by group", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodDelete, base+"?groupID="+group.ID.String(), nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		if data := decodeJSONMap(t, resp)["data"].(map[string]any); data["deleted"] != float64(1) {
+			t.Fatalf("expected the group share deleted, got %v", data)
+		}
+	})
+
+	t.Run("delete expired shares", func(t *testing.T) {
+		env.db.Model(&models.Share{}).Where("id = ?", bobShare.ID).Update("expires_at", past)
+		resp := performJSONRequest(t, env.app, http.MethodDelete, base+"?expired=true", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		if data := decodeJSONMap(t, resp)["data"].(map[string]any); data["deleted"] != float64(1) {
+			t.Fatalf("expected the expired share deleted, got %v", data)
+		}
+
+		var remaining []models.Share
+		env.db.Find(&remaining, "file_id = ?", folder.ID)
+		if len(remaining) != 1 || remaining[0].ID != aliceShare.ID {
+			t.Fatalf("expected only alice's share left, got %+v", remaining)
+		}
+		if n := countEvents("share.delete"); n != 3 {
+			t.Fatalf("expected a share.delete per share, got %d", n)
+		}
+	})
+}
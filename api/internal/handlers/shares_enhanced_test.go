@@ -151,7 +151,7 @@ func TestSharesEndpoints_Enhanced(t *testing.T) {
 		}, authHeaders(ownerToken))
 		body := decodeJSONMap(t, resp)
 		assertStatus(t, resp, http.StatusBadRequest)
-		assertEnvelopeError(t, body, "userID and groupID must not be set for public shares")
+		assertEnvelopeError(t, body, "userID, groupID and email must not be set for public shares")
 	})
 
 	t.Run("POST /api/files/:id/share private without userID or groupID", func(t *testing.T) {
@@ -172,7 +172,7 @@ func TestSharesEndpoints_Enhanced(t *testing.T) {
 		}, authHeaders(ownerToken))
 		body := decodeJSONMap(t, resp)
 		assertStatus(t, resp, http.StatusBadRequest)
-		assertEnvelopeError(t, body, "exactly one of userID or groupID is required for private shares")
+		assertEnvelopeError(t, body, "exactly one of userID, groupID or email is required for private shares")
 	})
 
 	t.Run("PUT /api/shares/:id non-owner forbidden", func(t *testing.T) {
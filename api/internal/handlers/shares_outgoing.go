@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var errInvalidExpiringWithin = utils.NewError(fiber.StatusBadRequest, "invalid_expiring_within", "expiringWithin must be a positive duration (72h) or number of days")
+
+// outgoingShare is a share as the sharer sees it, with where the shared
+// item sits and, for a folder, how much its recipients reach through it.
+type outgoingShare struct {
+	models.Share
+	// FolderPath is the path of the folder holding the shared item, "/"
+	// for the root.
+	FolderPath string `json:"folderPath"`
+	// InheritedItems counts the files and folders inside a shared folder,
+	// all of which the recipients can open through this share.
+	InheritedItems *int64 `json:"inheritedItems,omitempty"`
+}
+
+// ListOutgoing lists the shares the caller has handed out: those they
+// created and those on files they own. Filters: userID, groupID, type
+// (public covers both public types) and expiringWithin, which keeps
+// active shares that expire within a duration or a number of days.
+func (h *SharesHandler) ListOutgoing(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	ownFiles := h.DB.Model(&models.File{}).Select("id").Where("owner_id = ?", currentUser.ID)
+	baseQuery := h.DB.Model(&models.Share{}).Where("shared_by_id = ? OR file_id IN (?)", currentUser.ID, ownFiles)
+
+	if raw := c.Query("userID"); raw != "" {
+		userID, err := parseUUID(raw)
+		if err != nil {
+			return utils.Fail(c, errInvalidUserID)
+		}
+		baseQuery = baseQuery.Where("shared_with_user_id = ?", userID)
+	}
+	if raw := c.Query("groupID"); raw != "" {
+		groupID, err := parseUUID(raw)
+		if err != nil {
+			return utils.Fail(c, errInvalidGroupID)
+		}
+		baseQuery = baseQuery.Where("shared_with_group_id = ?", groupID)
+	}
+	switch shareType := c.Query("type"); shareType {
+	case "":
+	case "public":
+		baseQuery = baseQuery.Where("share_type IN ?", []models.ShareType{models.ShareTypePublicAnyone, models.ShareTypePublicLoggedIn})
+	default:
+		if !isValidShareType(shareType) {
+			return utils.Fail(c, errInvalidShareFilter)
+		}
+		baseQuery = baseQuery.Where("share_type = ?", shareType)
+	}
+	if raw := c.Query("expiringWithin"); raw != "" {
+		within, ok := parseExpiringWithin(raw)
+		if !ok {
+			return utils.Fail(c, errInvalidExpiringWithin)
+		}
+		now := time.Now().UTC()
+		baseQuery = baseQuery.Where("expires_at > ? AND expires_at <= ?", now, now.Add(within))
+	}
+
+	p := utils.ParsePagination(c)
+	order := utils.ParseTimeOrder(c)
+	preloaded := func(q *gorm.DB) *gorm.DB {
+		return q.Preload("File").Preload("SharedWithUser").Preload("SharedWithGroup")
+	}
+
+	if utils.WantsCursor(c) {
+		shares, nextCursor, err := findCreatedAtKeyset(c, preloaded(baseQuery), order, p.Limit,
+			func(s models.Share) (time.Time, uuid.UUID) { return s.CreatedAt, s.ID },
+		)
+		if err == utils.ErrInvalidCursor {
+			return utils.Fail(c, errInvalidCursor)
+		}
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed loading shares")
+		}
+		out, err := h.outgoingShares(shares)
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed loading shares")
+		}
+		return utils.CursorPaginated(c, out, p.Limit, nextCursor)
+	}
+
+	var total int64
+	if err := baseQuery.Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting shares")
+	}
+	var shares []models.Share
+	if err := utils.ApplyPagination(preloaded(baseQuery).Order("created_at "+order), p).Find(&shares).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading shares")
+	}
+	out, err := h.outgoingShares(shares)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading shares")
+	}
+	return utils.Paginated(c, out, p.Page, p.Limit, total)
+}
+
+// outgoingShares adds the folder context to one page of shares. Folder
+// names are cached across the page, since shares tend to cluster.
+func (h *SharesHandler) outgoingShares(shares []models.Share) ([]outgoingShare, error) {
+	folders := map[uuid.UUID]models.File{}
+	folderPath := func(parentID *uuid.UUID) (string, error) {
+		var names []string
+		for id := parentID; id != nil; {
+			folder, ok := folders[*id]
+			if !ok {
+				if err := h.DB.Select("id", "name", "parent_id").First(&folder, "id = ?", *id).Error; err != nil {
+					if err == gorm.ErrRecordNotFound {
+						break
+					}
+					return "", err
+				}
+				folders[*id] = folder
+			}
+			names = append(names, folder.Name)
+			id = folder.ParentID
+		}
+		for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+			names[i], names[j] = names[j], names[i]
+		}
+		return "/" + strings.Join(names, "/"), nil
+	}
+
+	out := make([]outgoingShare, len(shares))
+	for i, share := range shares {
+		path, err := folderPath(share.File.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = outgoingShare{Share: share, FolderPath: path}
+		if share.File.IsDirectory {
+			var count int64
+			if err := h.DB.Raw(`
+				WITH RECURSIVE descendants AS (
+					SELECT id FROM files WHERE parent_id = ? AND deleted_at IS NULL
+					UNION ALL
+					SELECT f.id FROM files f
+					INNER JOIN descendants d ON f.parent_id = d.id
+					WHERE f.deleted_at IS NULL
+				)
+				SELECT COUNT(*) FROM descendants
+			`, share.FileID).Scan(&count).Error; err != nil {
+				return nil, err
+			}
+			out[i].InheritedItems = &count
+		}
+	}
+	return out, nil
+}
+
+// parseExpiringWithin accepts a Go duration ("72h") or a number of days.
+func parseExpiringWithin(raw string) (time.Duration, bool) {
+	within, err := time.ParseDuration(raw)
+	if err != nil {
+		days, convErr := strconv.Atoi(raw)
+		if convErr != nil {
+			return 0, false
+		}
+		within = time.Duration(days) * 24 * time.Hour
+	}
+	return within, within > 0
+}
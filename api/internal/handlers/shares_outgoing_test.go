@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestListOutgoingShares(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "outgoing-owner@test.com", "password123", models.UserRoleUser)
+	alice, aliceToken := createTestUser(t, env.db, "outgoing-alice@test.com", "password123", models.UserRoleUser)
+	bob, _ := createTestUser(t, env.db, "outgoing-bob@test.com", "password123", models.UserRoleUser)
+
+	projects := models.File{Name: "Projects", IsDirectory: true, OwnerID: owner.ID}
+	env.db.Create(&projects)
+	board := models.File{Name: "Board", IsDirectory: true, OwnerID: owner.ID, ParentID: &projects.ID}
+	env.db.Create(&board)
+	minutes := models.File{Name: "minutes.txt", MimeType: "text/plain", OwnerID: owner.ID, ParentID: &board.ID, StoragePath: "minutes.txt"}
+	agenda := models.File{Name: "agenda.txt", MimeType: "text/plain", OwnerID: owner.ID, ParentID: &board.ID, StoragePath: "agenda.txt"}
+	env.db.Create(&minutes)
+	env.db.Create(&agenda)
+	aliceFile := models.File{Name: "alice.txt", MimeType: "text/plain", OwnerID: alice.ID, StoragePath: "alice.txt"}
+	env.db.Create(&aliceFile)
+	group := models.Group{Name: "Board members", CreatedByID: owner.ID}
+	env.db.Create(&group)
+
+	soon := time.Now().Add(24 * time.Hour)
+	later := time.Now().Add(30 * 24 * time.Hour)
+	shares := []models.Share{
+		{FileID: board.ID, SharedByID: owner.ID, SharedWithUserID: &alice.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionEdit, ExpiresAt: &soon},
+		{FileID: minutes.ID, SharedByID: owner.ID, SharedWithGroupID: &group.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView, ExpiresAt: &later},
+		{FileID: agenda.ID, SharedByID: owner.ID, ShareType: models.ShareTypePublicAnyone, Permission: models.SharePermissionView},
+		// Alice re-shares the folder she can edit: it shows up for both.
+		{FileID: board.ID, SharedByID: alice.ID, SharedWithUserID: &bob.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView},
+		{FileID: aliceFile.ID, SharedByID: alice.ID, SharedWithUserID: &owner.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView},
+	}
+	for i := range shares {
+		if err := env.db.Create(&shares[i]).Error; err != nil {
+			t.Fatalf("failed creating share: %v", err)
+		}
+	}
+
+	list := func(token, query string) []any {
+		t.Helper()
+		resp := performJSONRequest(t, env.app, http.MethodGet, "/api/shares/outgoing"+query, nil, authHeaders(token))
+		assertStatus(t, resp, http.StatusOK)
+		return decodeJSONMap(t, resp)["data"].([]any)
+	}
+
+	t.Run("lists shares made and shares on owned files", func(t *testing.T) {
+		data := list(ownerToken, "")
+		if len(data) != 4 {
+			t.Fatalf("expected four shares, got %d", len(data))
+		}
+		if got := list(aliceToken, ""); len(got) != 2 {
+			t.Fatalf("expected alice's two shares, got %d", len(got))
+		}
+	})
+
+	t.Run("carries folder context", func(t *testing.T) {
+		data := list(ownerToken, "?userID="+alice.ID.String())
+		if len(data) != 1 {
+			t.Fatalf("expected the share with alice, got %d", len(data))
+		}
+		share := data[0].(map[string]any)
+		if share["folderPath"] != "/Projects" || share["inheritedItems"] != float64(2) {
+			t.Fatalf("expected the folder path and its two items, got %v, %v", share["folderPath"], share["inheritedItems"])
+		}
+
+		data = list(ownerToken, "?groupID="+group.ID.String())
+		if len(data) != 1 || data[0].(map[string]any)["folderPath"] != "/Projects/Board" || data[0].(map[string]any)["inheritedItems"] != nil {
+			t.Fatalf("expected the group share on a file, got %v", data)
+		}
+	})
+
+	t.Run("filters by type and expiry", func(t *testing.T) {
+		if data := list(ownerToken, "?type=public"); len(data) != 1 {
+			t.Fatalf("expected the public share, got %d", len(data))
+		}
+		if data := list(ownerToken, "?type=private"); len(data) != 3 {
+			t.Fatalf("expected three private shares, got %d", len(data))
+		}
+		if data := list(ownerToken, "?expiringWithin=7"); len(data) != 1 {
+			t.Fatalf("expected the share expiring tomorrow, got %d", len(data))
+		}
+		if data := list(ownerToken, "?expiringWithin=1000h"); len(data) != 2 {
+			t.Fatalf("expected both expiring shares, got %d", len(data))
+		}
+	})
+
+	t.Run("rejects bad filters", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodGet, "/api/shares/outgoing?expiringWithin=soon", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+		if code := decodeJSONMap(t, resp)["code"]; code != "invalid_expiring_within" {
+			t.Fatalf("expected invalid_expiring_within, got %v", code)
+		}
+	})
+}
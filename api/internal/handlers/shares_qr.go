@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var (
+	errShareNotPublic = utils.NewError(fiber.StatusBadRequest, "share_not_public", "only public links have a QR code")
+	errShareExpired   = utils.NewError(fiber.StatusGone, "share_expired", "this share has expired")
+)
+
+// ShareQR renders a QR code of a public share's link, for whoever made the
+// share or can edit the file. format is png (the default) or svg, size the
+// width in pixels, and logo=false leaves out the server's QR logo.
+func (h *SharesHandler) ShareQR(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	shareID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidShareID)
+	}
+	var share models.Share
+	if err := h.DB.First(&share, "id = ?", shareID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utils.Fail(c, errShareNotFound)
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading share")
+	}
+	if share.SharedByID != currentUser.ID && !h.Access.HasAccess(c.Context(), currentUser.ID, share.FileID, models.SharePermissionEdit) {
+		return utils.Fail(c, errInsufficientPermissions)
+	}
+	if !share.IsPublic() {
+		return utils.Fail(c, errShareNotPublic)
+	}
+	if share.ExpiresAt != nil && !share.ExpiresAt.After(time.Now()) {
+		return utils.Fail(c, errShareExpired)
+	}
+	return h.sendShareQR(c, share)
+}
+
+// QuickShareQR renders a QR code of a file's quick-share link, taking the
+// same options as ShareQR. Only the owner can ask for it, as for the link.
+func (h *SharesHandler) QuickShareQR(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+	var file models.File
+	if err := h.DB.Select("id", "owner_id").First(&file, "id = ?", fileID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utils.Fail(c, errFileNotFound)
+		}
+		return utils.Fail(c, errLoadingFile)
+	}
+	if file.OwnerID != currentUser.ID {
+		return utils.Fail(c, errInsufficientPermissions)
+	}
+
+	var share models.Share
+	if err := h.DB.Where("file_id = ? AND share_type = ? AND quick_share = ?", file.ID, models.ShareTypePublicAnyone, true).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now().UTC()).
+		Order("created_at DESC").
+		First(&share).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utils.Fail(c, errNoQuickShare)
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading share")
+	}
+	return h.sendShareQR(c, share)
+}
+
+func (h *SharesHandler) sendShareQR(c *fiber.Ctx, share models.Share) error {
+	if !h.Access.PublicSharingEnabled(c.Context()) {
+		return utils.Fail(c, errPublicSharingOff)
+	}
+	opts := services.QROptions{
+		Format: c.Query("format", "png"),
+		Size:   c.QueryInt("size", services.DefaultQRSize),
+	}
+	if c.QueryBool("logo", true) {
+		opts.Logo = h.QRLogo
+	}
+	data, contentType, err := services.RenderQRCode(publicShareURL(h.FrontendURL, share), opts)
+	if err != nil {
+		if errors.Is(err, services.ErrQRCodeInvalid) {
+			return utils.Fail(c, serviceError(err, nil).WithMessage(err.Error()))
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed rendering QR code")
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderCacheControl, "private, max-age=3600")
+	return c.Send(data)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestShareQR(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "qr-owner@test.com", "password123", models.UserRoleUser)
+	viewer, viewerToken := createTestUser(t, env.db, "qr-viewer@test.com", "password123", models.UserRoleUser)
+
+	file := models.File{Name: "poster.pdf", MimeType: "application/pdf", OwnerID: owner.ID, StoragePath: "poster.pdf"}
+	env.db.Create(&file)
+	public := models.Share{FileID: file.ID, SharedByID: owner.ID, ShareType: models.ShareTypePublicAnyone, Permission: models.SharePermissionView}
+	private := models.Share{FileID: file.ID, SharedByID: owner.ID, SharedWithUserID: &viewer.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView}
+	expiredAt := time.Now().Add(-time.Hour)
+	expired := models.Share{FileID: file.ID, SharedByID: owner.ID, ShareType: models.ShareTypePublicLoggedIn, Permission: models.SharePermissionView, ExpiresAt: &expiredAt}
+	env.db.Create(&public)
+	env.db.Create(&private)
+	env.db.Create(&expired)
+	qrPath := func(share models.Share) string { return "/api/shares/" + share.ID.String() + "/qr" }
+
+	t.Run("png", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, qrPath(public)+"?size=200", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		if ct := resp.Header.Get("Content-Type"); ct != "image/png" {
+			t.Fatalf("expected image/png, got %q", ct)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || cfg.Width != 200 {
+			t.Fatalf("expected a 200px PNG, got %v, %v", cfg, err)
+		}
+		if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+			t.Fatalf("failed decoding PNG: %v", err)
+		}
+	})
+
+	t.Run("svg", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, qrPath(public)+"?format=svg", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		data, _ := io.ReadAll(resp.Body)
+		if resp.Header.Get("Content-Type") != "image/svg+xml" || !strings.Contains(string(data), "<svg") {
+			t.Fatalf("expected an SVG, got %q", data)
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		for _, tc := range []struct {
+			path, token, code string
+			status            int
+		}{
+			{qrPath(public), viewerToken, "insufficient_permissions", http.StatusForbidden},
+			{qrPath(private), ownerToken, "share_not_public", http.StatusBadRequest},
+			{qrPath(expired), ownerToken, "share_expired", http.StatusGone},
+			{qrPath(public) + "?size=10", ownerToken, "invalid_qr", http.StatusBadRequest},
+			{qrPath(public) + "?format=gif", ownerToken, "invalid_qr", http.StatusBadRequest},
+		} {
+			resp := performRequest(t, env.app, http.MethodGet, tc.path, nil, authHeaders(tc.token))
+			decoded := decodeJSONMap(t, resp)
+			if resp.StatusCode != tc.status || decoded["code"] != tc.code {
+				t.Errorf("%s: expected %d %s, got %d %v", tc.path, tc.status, tc.code, resp.StatusCode, decoded["code"])
+			}
+		}
+	})
+
+	t.Run("quick-share", func(t *testing.T) {
+		path := "/api/files/" + file.ID.String() + "/quick-share/qr"
+		resp := performRequest(t, env.app, http.MethodGet, path, nil, authHeaders(ownerToken))
+		decoded := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusNotFound)
+		if decoded["code"] != "quick_share_not_found" {
+			t.Fatalf("expected quick_share_not_found, got %v", decoded["code"])
+		}
+
+		other := models.File{Name: "flyer.pdf", MimeType: "application/pdf", OwnerID: owner.ID, StoragePath: "flyer.pdf"}
+		env.db.Create(&other)
+		path = "/api/files/" + other.ID.String() + "/quick-share"
+		resp = performJSONRequest(t, env.app, http.MethodPost, path, nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusCreated)
+
+		resp = performRequest(t, env.app, http.MethodGet, path+"/qr", nil, authHeaders(viewerToken))
+		assertStatus(t, resp, http.StatusForbidden)
+		resp = performRequest(t, env.app, http.MethodGet, path+"/qr?format=svg", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		if resp.Header.Get("Content-Type") != "image/svg+xml" {
+			t.Fatalf("expected an SVG, got %q", resp.Header.Get("Content-Type"))
+		}
+	})
+}
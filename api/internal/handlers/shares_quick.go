@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// quickShareExpiry is how long a quick-share link lives when neither the
+// request nor the folder's share defaults say otherwise.
+const quickShareExpiry = 7 * 24 * time.Hour
+
+var (
+	errInvalidExpiresIn  = utils.NewError(fiber.StatusBadRequest, "invalid_expires_in", "expiresIn must be a positive duration such as 72h or a number of days")
+	errPublicShareExists = utils.NewError(fiber.StatusConflict, "public_share_exists", "this file already has a public link that was not made by quick-share")
+	errNoQuickShare      = utils.NewError(fiber.StatusNotFound, "quick_share_not_found", "this file has no active quick-share link")
+)
+
+type quickShareRequest struct {
+	Permission models.SharePermission `json:"permission"`
+	ExpiresIn  string                 `json:"expiresIn"`
+	// Replace revokes the file's current quick-share link and issues a new
+	// one; without it the current link is returned as is.
+	Replace bool `json:"replace"`
+}
+
+type quickShareResponse struct {
+	Share     models.Share `json:"share"`
+	URL       string       `json:"url"`
+	ExpiresAt *time.Time   `json:"expiresAt"`
+	Created   bool         `json:"created"`
+	Replaced  []uuid.UUID  `json:"replaced,omitempty"`
+}
+
+// QuickShare makes a public link to a file in one call: a public_anyone
+// share with download permission expiring in seven days unless the body or
+// the folder's share defaults say otherwise. Calling it again returns the
+// existing link, or swaps it for a new one when replace is set.
+func (h *SharesHandler) QuickShare(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+	var file models.File
+	if err := h.DB.First(&file, "id = ?", fileID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utils.Fail(c, errFileNotFound)
+		}
+		return utils.Fail(c, errLoadingFile)
+	}
+	if file.OwnerID != currentUser.ID {
+		return utils.Fail(c, errInsufficientPermissions)
+	}
+	if file.VaultID != nil {
+		return utils.Fail(c, serviceError(services.ErrVaultShareType, nil))
+	}
+
+	var req quickShareRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return utils.Fail(c, errInvalidBody)
+		}
+	}
+	if !h.Access.PublicSharingEnabled(c.Context()) {
+		return utils.Fail(c, errPublicSharingOff)
+	}
+
+	now := time.Now().UTC()
+	share, apiErr := buildQuickShare(c, h.DB, h.Access, currentUser.ID, &file, req, now)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	var existing []models.Share
+	if err := h.DB.Where("file_id = ? AND share_type = ?", file.ID, models.ShareTypePublicAnyone).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Order("created_at DESC").
+		Find(&existing).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading shares")
+	}
+	for _, s := range existing {
+		if !s.QuickShare {
+			return utils.Fail(c, errPublicShareExists)
+		}
+	}
+	if len(existing) > 0 && !req.Replace {
+		return utils.Success(c, fiber.StatusOK, h.quickShareResponse(existing[0], false, nil))
+	}
+
+	control, err := services.EffectiveShareControl(c.Context(), h.DB, file.ID)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading share control")
+	}
+	if services.ShareNeedsApproval(control, &share) {
+		return h.requestShareApproval(c, currentUser, &file, control, &share, nil)
+	}
+
+	replaced := make([]uuid.UUID, len(existing))
+	for i, s := range existing {
+		replaced[i] = s.ID
+	}
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if len(replaced) > 0 {
+			if err := tx.Delete(&models.Share{}, "id IN ?", replaced).Error; err != nil {
+				return err
+			}
+			for _, old := range existing {
+				details := shareDeleteDetails(old, file.Name)
+				details["quick_share"] = true
+				if err := services.RecordEvent(tx, services.AuditEntry{
+					UserID:       &currentUser.ID,
+					Action:       "share.delete",
+					ResourceType: "share",
+					ResourceID:   &file.ID,
+					Details:      details,
+					IPAddress:    c.IP(),
+					RequestID:    getRequestID(c),
+				}); err != nil {
+					return err
+				}
+			}
+		}
+		if err := tx.Create(&share).Error; err != nil {
+			return err
+		}
+		details := map[string]interface{}{
+			"file_name":   file.Name,
+			"permission":  string(share.Permission),
+			"share_type":  string(share.ShareType),
+			"share_id":    share.ID.String(),
+			"expires_at":  share.ExpiresAt.Format(time.RFC3339),
+			"quick_share": true,
+		}
+		if key := middleware.GetIdempotencyKey(c); key != "" {
+			details["idempotency_key"] = key
+		}
+		return services.RecordEvent(tx, services.AuditEntry{
+			UserID:       &currentUser.ID,
+			Action:       "share.create",
+			ResourceType: "share",
+			ResourceID:   &file.ID,
+			Details:      details,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		})
+	}); err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed creating share")
+	}
+
+	logger.InfoWithUser(currentUser.ID.String(), "file_quick_shared", map[string]interface{}{
+		"file_id":    file.ID.String(),
+		"share_id":   share.ID.String(),
+		"permission": string(share.Permission),
+		"expires_at": share.ExpiresAt,
+		"replaced":   len(replaced),
+	})
+	return utils.Success(c, fiber.StatusCreated, h.quickShareResponse(share, true, replaced))
+}
+
+// buildQuickShare makes, without saving it, the link quick share issues for
+// file: the request's permission and expiry over the folder's share
+// defaults over download permission for seven days, all held to the public
+// share policy.
+func buildQuickShare(c *fiber.Ctx, db *gorm.DB, access *services.AccessService, userID uuid.UUID, file *models.File, req quickShareRequest, now time.Time) (models.Share, *utils.APIError) {
+	share := models.Share{
+		FileID:     file.ID,
+		SharedByID: userID,
+		ShareType:  models.ShareTypePublicAnyone,
+		Permission: req.Permission,
+		QuickShare: true,
+	}
+	if req.ExpiresIn != "" {
+		within, ok := parseExpiringWithin(req.ExpiresIn)
+		if !ok {
+			return models.Share{}, errInvalidExpiresIn
+		}
+		expiresAt := now.Add(within)
+		share.ExpiresAt = &expiresAt
+	}
+
+	defaults, err := services.EffectiveShareDefaults(c.Context(), db, file.ID)
+	if err != nil {
+		return models.Share{}, utils.NewError(fiber.StatusInternalServerError, utils.CodeForStatus(fiber.StatusInternalServerError), "failed loading share defaults")
+	}
+	if err := services.ApplyShareDefaults(defaults, &share, now); err != nil {
+		return models.Share{}, serviceError(err, errInvalidBody)
+	}
+	if share.Permission == "" {
+		share.Permission = models.SharePermissionDownload
+	}
+	policy := access.PublicSharePolicy(c.Context())
+	if share.ExpiresAt == nil {
+		expiresAt := now.Add(quickShareExpiry)
+		if limit := policy.ExpiryLimit(now); limit != nil && limit.Before(expiresAt) {
+			expiresAt = *limit
+		}
+		share.ExpiresAt = &expiresAt
+	}
+	if err := policy.Apply(&share, file, now); err != nil {
+		return models.Share{}, serviceError(err, errInvalidBody)
+	}
+	if !isValidSharePermission(string(share.Permission)) {
+		return models.Share{}, utils.NewError(fiber.StatusBadRequest, utils.CodeForStatus(fiber.StatusBadRequest), "invalid permission")
+	}
+	slug, err := services.NewShareSlug()
+	if err != nil {
+		return models.Share{}, utils.NewError(fiber.StatusInternalServerError, utils.CodeForStatus(fiber.StatusInternalServerError), "failed creating share")
+	}
+	share.Slug = &slug
+	return share, nil
+}
+
+func (h *SharesHandler) quickShareResponse(share models.Share, created bool, replaced []uuid.UUID) quickShareResponse {
+	return quickShareResponse{
+		Share:     share,
+		URL:       publicShareURL(h.FrontendURL, share),
+		ExpiresAt: share.ExpiresAt,
+		Created:   created,
+		Replaced:  replaced,
+	}
+}
+
+// publicShareURL is the address of a public share's page on the frontend.
+func publicShareURL(frontendURL string, share models.Share) string {
+	return strings.TrimRight(frontendURL, "/") + "/shared/" + share.FileID.String()
+}
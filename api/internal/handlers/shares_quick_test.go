@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestQuickShare(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "quick-owner@test.com", "password123", models.UserRoleUser)
+	_, otherToken := createTestUser(t, env.db, "quick-other@test.com", "password123", models.UserRoleUser)
+
+	file := models.File{Name: "deck.pdf", MimeType: "application/pdf", OwnerID: owner.ID, StoragePath: "deck.pdf"}
+	env.db.Create(&file)
+	path := "/api/files/" + file.ID.String() + "/quick-share"
+
+	var firstID string
+	t.Run("creates a week-long download link", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, path, nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusCreated)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		if data["url"] != "http://localhost:3001/shared/"+file.ID.String() || data["created"] != true {
+			t.Fatalf("unexpected response %v", data)
+		}
+		share := data["share"].(map[string]any)
+		firstID = share["id"].(string)
+		if share["permission"] != "download" || share["shareType"] != "public_anyone" || share["quickShare"] != true {
+			t.Fatalf("unexpected share %v", share)
+		}
+		expiresAt, err := time.Parse(time.RFC3339, data["expiresAt"].(string))
+		if err != nil || time.Until(expiresAt) < 6*24*time.Hour || time.Until(expiresAt) > 7*24*time.Hour {
+			t.Fatalf("expected a seven day expiry, got %v", data["expiresAt"])
+		}
+	})
+
+	t.Run("returns the existing link", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, path, map[string]any{}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		if data["created"] != false || data["share"].(map[string]any)["id"] != firstID {
+			t.Fatalf("expected the first link back, got %v", data)
+		}
+	})
+
+	t.Run("replace revokes the previous link", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, path, map[string]any{
+			"replace":    true,
+			"expiresIn":  "2",
+			"permission": "view",
+		}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusCreated)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		if replaced := data["replaced"].([]any); len(replaced) != 1 || replaced[0] != firstID {
+			t.Fatalf("expected the first link replaced, got %v", data["replaced"])
+		}
+		if data["share"].(map[string]any)["permission"] != "view" {
+			t.Fatalf("expected a view link, got %v", data["share"])
+		}
+
+		var shares []models.Share
+		env.db.Find(&shares, "file_id = ?", file.ID)
+		if len(shares) != 1 || shares[0].ID.String() == firstID {
+			t.Fatalf("expected only the new link left, got %+v", shares)
+		}
+		if until := time.Until(*shares[0].ExpiresAt); until < 47*time.Hour || until > 48*time.Hour {
+			t.Fatalf("expected a two day expiry, got %v", until)
+		}
+		var deleted int64
+		env.db.Model(&models.OutboxEvent{}).Where("event_type = ? AND resource_id = ?", "share.delete", file.ID).Count(&deleted)
+		if deleted != 1 {
+			t.Fatalf("expected the revocation recorded, got %d", deleted)
+		}
+	})
+
+	t.Run("rejects a bad expiry", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, path, map[string]any{"expiresIn": "soon"}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+		if code := decodeJSONMap(t, resp)["code"]; code != "invalid_expires_in" {
+			t.Fatalf("expected invalid_expires_in, got %v", code)
+		}
+	})
+
+	t.Run("leaves hand-made public links alone", func(t *testing.T) {
+		other := models.File{Name: "notes.txt", MimeType: "text/plain", OwnerID: owner.ID, StoragePath: "notes.txt"}
+		env.db.Create(&other)
+		env.db.Create(&models.Share{FileID: other.ID, SharedByID: owner.ID, ShareType: models.ShareTypePublicAnyone, Permission: models.SharePermissionView})
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+other.ID.String()+"/quick-share", map[string]any{"replace": true}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusConflict)
+		if code := decodeJSONMap(t, resp)["code"]; code != "public_share_exists" {
+			t.Fatalf("expected public_share_exists, got %v", code)
+		}
+	})
+
+	t.Run("only the owner can quick-share", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, path, nil, authHeaders(otherToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+}
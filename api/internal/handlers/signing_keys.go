@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// SigningKeysHandler lets platform admins rotate the keys that sign
+// session, MFA and preview tokens.
+type SigningKeysHandler struct {
+	Keys  *services.SigningKeys
+	Audit *services.AuditService
+}
+
+func NewSigningKeysHandler(keys *services.SigningKeys, audit *services.AuditService) *SigningKeysHandler {
+	return &SigningKeysHandler{Keys: keys, Audit: audit}
+}
+
+func (h *SigningKeysHandler) List(c *fiber.Ctx) error {
+	keys, err := h.Keys.List(c.Context())
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing signing keys")
+	}
+	return utils.Success(c, fiber.StatusOK, keys)
+}
+
+// Create adds a key, which signs every token issued from then on.
+func (h *SigningKeysHandler) Create(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	key, err := h.Keys.Create(c.Context(), currentUser.ID)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed creating signing key")
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "admin.signing_key_create",
+		ResourceType: "signing_key",
+		Details:      map[string]interface{}{"kid": key.KID},
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusCreated, key)
+}
+
+// Retire stops a key from validating tokens; those it signed stop working.
+func (h *SigningKeysHandler) Retire(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	key, err := h.Keys.Retire(c.Context(), c.Params("kid"))
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "signing_key_retire_failed", "failed retiring signing key")))
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "admin.signing_key_retire",
+		ResourceType: "signing_key",
+		Details:      map[string]interface{}{"kid": key.KID},
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusOK, key)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/keyring"
+	"github.com/docshare/api/pkg/previewtoken"
+)
+
+func TestSigningKeyRotation(t *testing.T) {
+	env := setupTestEnv(t)
+	t.Cleanup(func() { keyring.SetStoredKeys(nil, false) })
+	_, oldToken := createTestUser(t, env.db, "keys-admin@test.com", "password123", models.UserRoleAdmin)
+	oldPreview := previewtoken.Generate("file", "user")
+
+	resp := performRequest(t, env.app, http.MethodPost, "/api/admin/signing-keys/env/retire", nil, authHeaders(oldToken))
+	body := decodeJSONMap(t, resp)
+	assertStatus(t, resp, http.StatusConflict)
+	if body["code"] != "signing_key_last_active" {
+		t.Fatalf("expected signing_key_last_active, got %v", body)
+	}
+
+	resp = performRequest(t, env.app, http.MethodPost, "/api/admin/signing-keys", nil, authHeaders(oldToken))
+	body = decodeJSONMap(t, resp)
+	assertStatus(t, resp, http.StatusCreated)
+	kid := body["data"].(map[string]any)["kid"].(string)
+	if keyring.Current().ID != kid {
+		t.Fatalf("expected the new key to sign, got %q", keyring.Current().ID)
+	}
+
+	_, newToken := createTestUser(t, env.db, "keys-admin2@test.com", "password123", models.UserRoleAdmin)
+	resp = performRequest(t, env.app, http.MethodGet, "/api/admin/signing-keys", nil, authHeaders(oldToken))
+	body = decodeJSONMap(t, resp)
+	assertStatus(t, resp, http.StatusOK)
+	keys := body["data"].([]any)
+	if len(keys) != 2 || keys[1].(map[string]any)["current"] != true || keys[0].(map[string]any)["current"] != false {
+		t.Fatalf("expected the environment key and the new current one, got %v", keys)
+	}
+	if _, ok := keys[1].(map[string]any)["secret"]; ok {
+		t.Fatal("expected secrets to stay out of the listing")
+	}
+
+	resp = performRequest(t, env.app, http.MethodPost, "/api/admin/signing-keys/env/retire", nil, authHeaders(newToken))
+	assertStatus(t, resp, http.StatusOK)
+	resp = performRequest(t, env.app, http.MethodGet, "/api/admin/signing-keys", nil, authHeaders(oldToken))
+	assertStatus(t, resp, http.StatusUnauthorized)
+	if _, err := previewtoken.Validate(oldPreview); err == nil {
+		t.Fatal("expected preview tokens from the retired key to be refused")
+	}
+
+	resp = performRequest(t, env.app, http.MethodPost, "/api/admin/signing-keys/env/retire", nil, authHeaders(newToken))
+	assertStatus(t, resp, http.StatusConflict)
+	resp = performRequest(t, env.app, http.MethodPost, "/api/admin/signing-keys/"+kid+"/retire", nil, authHeaders(newToken))
+	body = decodeJSONMap(t, resp)
+	assertStatus(t, resp, http.StatusConflict)
+	if body["code"] != "signing_key_last_active" {
+		t.Fatalf("expected signing_key_last_active, got %v", body)
+	}
+	resp = performRequest(t, env.app, http.MethodPost, "/api/admin/signing-keys/nope/retire", nil, authHeaders(newToken))
+	assertStatus(t, resp, http.StatusNotFound)
+}
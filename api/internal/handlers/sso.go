@@ -4,11 +4,13 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"net/url"
 	"strings"
 
 	"github.com/docshare/api/internal/config"
 	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
 	"github.com/docshare/api/internal/services"
 	"github.com/docshare/api/pkg/logger"
 	"github.com/docshare/api/pkg/utils"
@@ -18,25 +20,31 @@ import (
 )
 
 type SSOHandler struct {
-	DB           *gorm.DB
-	Cfg          *config.Config
-	SSOService   *services.SSOService
-	OAuthService *services.OAuthProviderService
-	SAMLService  *services.SAMLService
-	LDAPService  *services.LDAPService
+	DB         *gorm.DB
+	Cfg        *config.Config
+	SSOService *services.SSOService
+	Providers  *services.SSOProviderRegistry
+	Audit      *services.AuditService
+	Sessions   *services.SessionService
 }
 
-func NewSSOHandler(db *gorm.DB, cfg *config.Config) *SSOHandler {
+func NewSSOHandler(db *gorm.DB, cfg *config.Config, audit *services.AuditService, sessions *services.SessionService) *SSOHandler {
 	return &SSOHandler{
-		DB:           db,
-		Cfg:          cfg,
-		SSOService:   services.NewSSOService(db, cfg),
-		OAuthService: services.NewOAuthProviderService(cfg),
-		SAMLService:  services.NewSAMLService(cfg),
-		LDAPService:  services.NewLDAPService(cfg),
+		DB:         db,
+		Cfg:        cfg,
+		SSOService: services.NewSSOService(db, cfg),
+		Providers:  services.NewSSOProviderRegistry(db, cfg),
+		Audit:      audit,
+		Sessions:   sessions,
 	}
 }
 
+// tenant returns the login services of the organization the request is
+// addressed to.
+func (h *SSOHandler) tenant(c *fiber.Ctx) (*services.SSOTenant, error) {
+	return h.Providers.For(c.Context(), middleware.GetOrganizationID(c))
+}
+
 type LoginRedirectRequest struct {
 	Provider string `json:"provider"`
 	Redirect string `json:"redirect"`
@@ -45,7 +53,12 @@ type LoginRedirectRequest struct {
 func (h *SSOHandler) GetLoginRedirect(c *fiber.Ctx) error {
 	provider := c.Params("provider")
 
-	authCodeURL, err := h.getAuthorizationURL(c.Context(), provider)
+	tenant, err := h.tenant(c)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading SSO providers")
+	}
+
+	authCodeURL, err := h.getAuthorizationURL(c.Context(), tenant.OAuth, provider)
 	if err != nil {
 		return utils.Error(c, fiber.StatusBadRequest, err.Error())
 	}
@@ -55,18 +68,18 @@ func (h *SSOHandler) GetLoginRedirect(c *fiber.Ctx) error {
 	})
 }
 
-func (h *SSOHandler) getAuthorizationURL(ctx context.Context, provider string) (string, error) {
-	_, providerName, err := h.OAuthService.GetOAuthConfig(provider)
+func (h *SSOHandler) getAuthorizationURL(ctx context.Context, oauth *services.OAuthProviderService, provider string) (string, error) {
+	_, providerName, err := oauth.GetOAuthConfig(provider)
 	if err != nil {
 		return "", err
 	}
 
-	state, err := h.OAuthService.GenerateState(providerName)
+	state, err := oauth.GenerateState(providerName)
 	if err != nil {
 		return "", err
 	}
 
-	return h.OAuthService.AuthCodeURL(ctx, providerName, state)
+	return oauth.AuthCodeURL(ctx, providerName, state)
 }
 
 func decodeOAuthState(encoded string) (*services.OAuthState, error) {
@@ -100,15 +113,23 @@ func (h *SSOHandler) HandleOAuthCallback(c *fiber.Ctx) error {
 		return c.Redirect(frontendURL + "/login?error=" + url.QueryEscape("authorization code is required"))
 	}
 
-	profile, err := h.processOAuthCallback(c.Context(), provider, code, state)
+	tenant, err := h.tenant(c)
+	if err != nil {
+		return c.Redirect(frontendURL + "/login?error=" + url.QueryEscape("failed loading SSO providers"))
+	}
+
+	profile, err := h.processOAuthCallback(c.Context(), tenant.OAuth, provider, code, state)
 	if err != nil {
 		return c.Redirect(frontendURL + "/login?error=" + url.QueryEscape(err.Error()))
 	}
 
-	user, err := h.SSOService.FindOrCreateUser(c.Context(), profile)
+	user, err := h.provisionUser(c, tenant, profile)
 	if err != nil {
 		return c.Redirect(frontendURL + "/login?error=" + url.QueryEscape(err.Error()))
 	}
+	if user.IsSuspended() {
+		return c.Redirect(frontendURL + "/login?error=" + url.QueryEscape(middleware.ErrAccountSuspended.Message))
+	}
 
 	hasMFA, methods := UserHasMFA(h.DB, user.ID)
 	if hasMFA {
@@ -120,7 +141,7 @@ func (h *SSOHandler) HandleOAuthCallback(c *fiber.Ctx) error {
 		return c.Redirect(frontendURL + "/auth/callback?mfa_required=true&mfa_token=" + url.QueryEscape(mfaToken) + "&methods=" + url.QueryEscape(string(methodsJSON)))
 	}
 
-	token, err := utils.GenerateToken(user)
+	token, err := issueToken(c, h.Sessions, user, "sso")
 	if err != nil {
 		return c.Redirect(frontendURL + "/login?error=" + url.QueryEscape("failed to generate token"))
 	}
@@ -134,8 +155,37 @@ func (h *SSOHandler) HandleOAuthCallback(c *fiber.Ctx) error {
 	return c.Redirect(frontendURL + "/auth/callback?token=" + token)
 }
 
-func (h *SSOHandler) processOAuthCallback(ctx context.Context, provider, code, state string) (*services.SSOProfile, error) {
-	token, err := h.OAuthService.ExchangeCode(ctx, provider, code)
+// provisionUser signs the profile in to the request's organization and
+// applies the provider's claim mappings to the resulting user.
+func (h *SSOHandler) provisionUser(c *fiber.Ctx, tenant *services.SSOTenant, profile *services.SSOProfile) (*models.User, error) {
+	user, err := h.SSOService.FindOrCreateUser(c.Context(), profile, middleware.GetOrganizationID(c))
+	if err != nil {
+		return nil, err
+	}
+
+	// The identity provider vouches for the address, so shares waiting for
+	// it can be handed over.
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := services.ClaimShareInvitations(tx, user, c.IP())
+		return err
+	}); err != nil {
+		logger.Error("sso_claim_invitations_failed", err, map[string]interface{}{
+			"user_id": user.ID.String(),
+		})
+	}
+
+	if err := h.SSOService.SyncClaimMappings(c.Context(), user, profile, tenant.ClaimMappings[profile.Provider]); err != nil {
+		logger.Error("sso_claim_mapping_failed", err, map[string]interface{}{
+			"user_id":  user.ID.String(),
+			"provider": string(profile.Provider),
+		})
+		return nil, errors.New("failed applying group mappings")
+	}
+	return user, nil
+}
+
+func (h *SSOHandler) processOAuthCallback(ctx context.Context, oauth *services.OAuthProviderService, provider, code, state string) (*services.SSOProfile, error) {
+	token, err := oauth.ExchangeCode(ctx, provider, code)
 	if err != nil {
 		return nil, err
 	}
@@ -145,7 +195,7 @@ func (h *SSOHandler) processOAuthCallback(ctx context.Context, provider, code, s
 		return nil, err
 	}
 
-	profile, err := h.OAuthService.GetUserInfoWithState(ctx, provider, token, decodedState)
+	profile, err := oauth.GetUserInfoWithState(ctx, provider, token, decodedState)
 	if err != nil {
 		return nil, err
 	}
@@ -154,7 +204,12 @@ func (h *SSOHandler) processOAuthCallback(ctx context.Context, provider, code, s
 }
 
 func (h *SSOHandler) HandleSAMLMetadata(c *fiber.Ctx) error {
-	metadata := h.SAMLService.GetMetadata()
+	tenant, err := h.tenant(c)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading SSO providers")
+	}
+
+	metadata := tenant.SAML.GetMetadata()
 	if metadata == nil {
 		return utils.Error(c, fiber.StatusNotFound, "SAML not configured")
 	}
@@ -174,15 +229,23 @@ func (h *SSOHandler) HandleSAMLACS(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusBadRequest, "invalid SAML response")
 	}
 
-	profile, err := h.SAMLService.HandleACS(c.Context(), string(decoded))
+	tenant, err := h.tenant(c)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading SSO providers")
+	}
+
+	profile, err := tenant.SAML.HandleACS(c.Context(), string(decoded))
 	if err != nil {
 		return utils.Error(c, fiber.StatusUnauthorized, err.Error())
 	}
 
-	user, err := h.SSOService.FindOrCreateUser(c.Context(), profile)
+	user, err := h.provisionUser(c, tenant, profile)
 	if err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
 	}
+	if user.IsSuspended() {
+		return utils.Fail(c, middleware.ErrAccountSuspended)
+	}
 
 	frontendURL := h.Cfg.Server.FrontendURL
 
@@ -196,7 +259,7 @@ func (h *SSOHandler) HandleSAMLACS(c *fiber.Ctx) error {
 		return c.Redirect(frontendURL + "/auth/callback?mfa_required=true&mfa_token=" + url.QueryEscape(mfaToken) + "&methods=" + url.QueryEscape(string(methodsJSON)))
 	}
 
-	token, err := utils.GenerateToken(user)
+	token, err := issueToken(c, h.Sessions, user, "sso")
 	if err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed to generate token")
 	}
@@ -217,26 +280,34 @@ type LDAPLoginRequest struct {
 func (h *SSOHandler) HandleLDAPLogin(c *fiber.Ctx) error {
 	var req LDAPLoginRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	if req.Username == "" || req.Password == "" {
 		return utils.Error(c, fiber.StatusBadRequest, "username and password are required")
 	}
 
-	profile, err := h.LDAPService.Authenticate(c.Context(), req.Username, req.Password)
+	tenant, err := h.tenant(c)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading SSO providers")
+	}
+
+	profile, err := tenant.LDAP.Authenticate(c.Context(), req.Username, req.Password)
 	if err != nil {
 		logger.Warn("ldap_login_failed", map[string]interface{}{
 			"username": req.Username,
 			"error":    err.Error(),
 		})
-		return utils.Error(c, fiber.StatusUnauthorized, "invalid credentials")
+		return utils.Fail(c, errInvalidCredentials)
 	}
 
-	user, err := h.SSOService.FindOrCreateUser(c.Context(), profile)
+	user, err := h.provisionUser(c, tenant, profile)
 	if err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
 	}
+	if user.IsSuspended() {
+		return utils.Fail(c, middleware.ErrAccountSuspended)
+	}
 
 	hasMFA, methods := UserHasMFA(h.DB, user.ID)
 	if hasMFA {
@@ -251,7 +322,7 @@ func (h *SSOHandler) HandleLDAPLogin(c *fiber.Ctx) error {
 		})
 	}
 
-	token, err := utils.GenerateToken(user)
+	token, err := issueToken(c, h.Sessions, user, "sso")
 	if err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed to generate token")
 	}
@@ -268,56 +339,20 @@ func (h *SSOHandler) HandleLDAPLogin(c *fiber.Ctx) error {
 	})
 }
 
+// ListProviders lists the sign-in options of the request's organization.
 func (h *SSOHandler) ListProviders(c *fiber.Ctx) error {
-	providers := []fiber.Map{}
-
-	if h.Cfg.SSO.Google.Enabled {
-		providers = append(providers, fiber.Map{
-			"name":        "google",
-			"displayName": "Google",
-			"type":        "oauth",
-		})
-	}
-
-	if h.Cfg.SSO.GitHub.Enabled {
-		providers = append(providers, fiber.Map{
-			"name":        "github",
-			"displayName": "GitHub",
-			"type":        "oauth",
-		})
-	}
-
-	if h.Cfg.SSO.OIDC.Enabled {
-		providers = append(providers, fiber.Map{
-			"name":        "oidc",
-			"displayName": "OpenID Connect",
-			"type":        "oidc",
-		})
-	}
-
-	if h.SAMLService.IsEnabled() {
-		providers = append(providers, fiber.Map{
-			"name":        "saml",
-			"displayName": "Enterprise SSO (SAML)",
-			"type":        "saml",
-		})
-	}
-
-	if h.LDAPService.IsEnabled() {
-		providers = append(providers, fiber.Map{
-			"name":        "ldap",
-			"displayName": "Corporate Directory (LDAP)",
-			"type":        "ldap",
-		})
+	tenant, err := h.tenant(c)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading SSO providers")
 	}
 
-	return utils.Success(c, fiber.StatusOK, providers)
+	return utils.Success(c, fiber.StatusOK, tenant.Providers)
 }
 
 func (h *SSOHandler) GetLinkedAccounts(c *fiber.Ctx) error {
 	user := middleware.GetCurrentUser(c)
 	if user == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	accounts, err := h.SSOService.GetLinkedAccounts(c.Context(), user.ID)
@@ -331,7 +366,7 @@ func (h *SSOHandler) GetLinkedAccounts(c *fiber.Ctx) error {
 func (h *SSOHandler) UnlinkAccount(c *fiber.Ctx) error {
 	user := middleware.GetCurrentUser(c)
 	if user == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	accountID := c.Params("id")
@@ -364,12 +399,12 @@ type LinkAccountRequest struct {
 func (h *SSOHandler) LinkAccount(c *fiber.Ctx) error {
 	user := middleware.GetCurrentUser(c)
 	if user == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var req LinkAccountRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	var profile *services.SSOProfile
@@ -377,7 +412,11 @@ func (h *SSOHandler) LinkAccount(c *fiber.Ctx) error {
 
 	switch strings.ToLower(req.Provider) {
 	case "google", "github", "oidc":
-		profile, err = h.processOAuthCallback(c.Context(), req.Provider, req.Code, req.State)
+		tenant, tenantErr := h.tenant(c)
+		if tenantErr != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed loading SSO providers")
+		}
+		profile, err = h.processOAuthCallback(c.Context(), tenant.OAuth, req.Provider, req.Code, req.State)
 	case "saml":
 		return utils.Error(c, fiber.StatusBadRequest, "SAML linking not supported yet")
 	case "ldap":
@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ssoProviderRequest is the body of the provider admin endpoints. Omitted
+// fields are left unchanged on update; an empty secret clears it.
+type ssoProviderRequest struct {
+	Type             models.SSOProviderType    `json:"type"`
+	DisplayName      *string                   `json:"displayName"`
+	Enabled          *bool                     `json:"enabled"`
+	Priority         *int                      `json:"priority"`
+	ClientID         *string                   `json:"clientID"`
+	ClientSecret     *string                   `json:"clientSecret"`
+	RedirectURL      *string                   `json:"redirectURL"`
+	Scopes           *string                   `json:"scopes"`
+	IssuerURL        *string                   `json:"issuerURL"`
+	MetadataURL      *string                   `json:"metadataURL"`
+	EntityID         *string                   `json:"entityID"`
+	LDAPURL          *string                   `json:"ldapURL"`
+	LDAPBindDN       *string                   `json:"ldapBindDN"`
+	LDAPBindPassword *string                   `json:"ldapBindPassword"`
+	LDAPSearchBase   *string                   `json:"ldapSearchBase"`
+	LDAPUserFilter   *string                   `json:"ldapUserFilter"`
+	LDAPEmailField   *string                   `json:"ldapEmailField"`
+	LDAPNameFields   *string                   `json:"ldapNameFields"`
+	AttributeMapping *string                   `json:"attributeMapping"`
+	ClaimMappings    *[]models.SSOClaimMapping `json:"claimMappings"`
+}
+
+// ssoProviderResponse reports whether secrets are set without revealing
+// them.
+type ssoProviderResponse struct {
+	models.SSOProvider
+	HasClientSecret     bool `json:"hasClientSecret"`
+	HasLDAPBindPassword bool `json:"hasLdapBindPassword"`
+}
+
+func newSSOProviderResponse(p models.SSOProvider) ssoProviderResponse {
+	return ssoProviderResponse{
+		SSOProvider:         p,
+		HasClientSecret:     p.ClientSecret != "",
+		HasLDAPBindPassword: p.LDAPBindPassword != "",
+	}
+}
+
+// ListConfiguredProviders lists the providers stored for the admin's
+// organization, including disabled ones. Providers configured only through
+// the environment are not included.
+func (h *SSOHandler) ListConfiguredProviders(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	var providers []models.SSOProvider
+	if err := h.DB.Scopes(services.OrganizationScope("sso_providers", currentUser.OrganizationID)).
+		Order("priority ASC, name ASC").
+		Find(&providers).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing SSO providers")
+	}
+
+	out := make([]ssoProviderResponse, 0, len(providers))
+	for _, p := range providers {
+		out = append(out, newSSOProviderResponse(p))
+	}
+	return utils.Success(c, fiber.StatusOK, out)
+}
+
+func (h *SSOHandler) GetConfiguredProvider(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	provider, apiErr := h.loadProvider(c, currentUser.OrganizationID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	return utils.Success(c, fiber.StatusOK, newSSOProviderResponse(*provider))
+}
+
+// CreateProvider stores a provider for the admin's organization. It takes
+// effect immediately and replaces any environment-configured provider of the
+// same type; each organization has at most one provider per type.
+func (h *SSOHandler) CreateProvider(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	var req ssoProviderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+
+	displayName := services.SSOProviderDisplayName(req.Type)
+	if displayName == "" {
+		return utils.Error(c, fiber.StatusBadRequest, "type must be one of google, github, oidc, saml, ldap")
+	}
+
+	provider := models.SSOProvider{
+		Name:           string(req.Type),
+		DisplayName:    displayName,
+		Type:           req.Type,
+		Enabled:        true,
+		Priority:       100,
+		OrganizationID: currentUser.OrganizationID,
+	}
+	if err := applySSOProviderRequest(&provider, &req); err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	if err := validateSSOProvider(&provider); err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	if err := h.checkMappedGroups(currentUser.OrganizationID, provider.ClaimMappings); err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.SSOProvider{}).
+			Scopes(services.OrganizationScope("sso_providers", currentUser.OrganizationID)).
+			Where("name = ?", provider.Name).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errSSOProviderExists
+		}
+		if err := tx.Create(&provider).Error; err != nil {
+			return err
+		}
+		return services.RecordEvent(tx, h.providerAuditEntry(c, currentUser, "sso_provider.create", &provider))
+	})
+	if errors.Is(err, errSSOProviderExists) {
+		return utils.Fail(c, errSSOProviderExists)
+	}
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed creating SSO provider")
+	}
+
+	h.Providers.Invalidate(currentUser.OrganizationID)
+	return utils.Success(c, fiber.StatusCreated, newSSOProviderResponse(provider))
+}
+
+func (h *SSOHandler) UpdateProvider(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	provider, apiErr := h.loadProvider(c, currentUser.OrganizationID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	var req ssoProviderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	if req.Type != "" && req.Type != provider.Type {
+		return utils.Error(c, fiber.StatusBadRequest, "type cannot be changed")
+	}
+	if err := applySSOProviderRequest(provider, &req); err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	if err := validateSSOProvider(provider); err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	if err := h.checkMappedGroups(currentUser.OrganizationID, provider.ClaimMappings); err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(provider).Error; err != nil {
+			return err
+		}
+		return services.RecordEvent(tx, h.providerAuditEntry(c, currentUser, "sso_provider.update", provider))
+	}); err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed updating SSO provider")
+	}
+
+	h.Providers.Invalidate(currentUser.OrganizationID)
+	return utils.Success(c, fiber.StatusOK, newSSOProviderResponse(*provider))
+}
+
+// DeleteProvider removes a stored provider, so the organization falls back to
+// the environment configuration for its type.
+func (h *SSOHandler) DeleteProvider(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	provider, apiErr := h.loadProvider(c, currentUser.OrganizationID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// Hard delete so the type can be configured again.
+		if err := tx.Unscoped().Delete(&models.SSOProvider{}, "id = ?", provider.ID).Error; err != nil {
+			return err
+		}
+		return services.RecordEvent(tx, h.providerAuditEntry(c, currentUser, "sso_provider.delete", provider))
+	}); err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed deleting SSO provider")
+	}
+
+	h.Providers.Invalidate(currentUser.OrganizationID)
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "SSO provider deleted"})
+}
+
+func (h *SSOHandler) loadProvider(c *fiber.Ctx, orgID *uuid.UUID) (*models.SSOProvider, *utils.APIError) {
+	providerID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return nil, errInvalidSSOProviderID
+	}
+
+	var provider models.SSOProvider
+	if err := h.DB.Scopes(services.OrganizationScope("sso_providers", orgID)).First(&provider, "id = ?", providerID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errSSOProviderNotFound
+		}
+		return nil, utils.NewError(fiber.StatusInternalServerError, "sso_provider_load_failed", "failed loading SSO provider")
+	}
+	return &provider, nil
+}
+
+// checkMappedGroups makes sure claim mappings only grant groups of the
+// admin's own organization.
+func (h *SSOHandler) checkMappedGroups(orgID *uuid.UUID, mappings []models.SSOClaimMapping) error {
+	groupIDs := []uuid.UUID{}
+	for _, m := range mappings {
+		if m.GroupID != nil {
+			groupIDs = append(groupIDs, *m.GroupID)
+		}
+	}
+	if len(groupIDs) == 0 {
+		return nil
+	}
+
+	var found []uuid.UUID
+	if err := h.DB.Model(&models.Group{}).
+		Scopes(services.OrganizationScope("groups", orgID)).
+		Where("id IN ?", groupIDs).
+		Pluck("id", &found).Error; err != nil {
+		return errors.New("failed checking mapped groups")
+	}
+	known := map[uuid.UUID]bool{}
+	for _, id := range found {
+		known[id] = true
+	}
+	for _, id := range groupIDs {
+		if !known[id] {
+			return errors.New("claimMappings refers to unknown group " + id.String())
+		}
+	}
+	return nil
+}
+
+func (h *SSOHandler) providerAuditEntry(c *fiber.Ctx, user *models.User, action string, provider *models.SSOProvider) services.AuditEntry {
+	return services.AuditEntry{
+		UserID:       &user.ID,
+		Action:       action,
+		ResourceType: "sso_provider",
+		ResourceID:   &provider.ID,
+		Details: map[string]interface{}{
+			"type":    string(provider.Type),
+			"enabled": provider.Enabled,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	}
+}
+
+// applySSOProviderRequest copies the fields present in req onto provider,
+// encrypting secrets.
+func applySSOProviderRequest(provider *models.SSOProvider, req *ssoProviderRequest) error {
+	set := func(dst *string, src *string) {
+		if src != nil {
+			*dst = strings.TrimSpace(*src)
+		}
+	}
+	setSecret := func(dst *string, src *string) error {
+		if src == nil {
+			return nil
+		}
+		if *src == "" {
+			*dst = ""
+			return nil
+		}
+		encrypted, err := utils.EncryptAESGCM(*src)
+		if err != nil {
+			return errors.New("failed encrypting secret")
+		}
+		*dst = encrypted
+		return nil
+	}
+
+	set(&provider.DisplayName, req.DisplayName)
+	if req.Enabled != nil {
+		provider.Enabled = *req.Enabled
+	}
+	if req.Priority != nil {
+		provider.Priority = *req.Priority
+	}
+	set(&provider.ClientID, req.ClientID)
+	set(&provider.RedirectURL, req.RedirectURL)
+	set(&provider.Scopes, req.Scopes)
+	set(&provider.IssuerURL, req.IssuerURL)
+	set(&provider.MetadataURL, req.MetadataURL)
+	set(&provider.EntityID, req.EntityID)
+	set(&provider.LDAPURL, req.LDAPURL)
+	set(&provider.LDAPBindDN, req.LDAPBindDN)
+	set(&provider.LDAPSearchBase, req.LDAPSearchBase)
+	set(&provider.LDAPUserFilter, req.LDAPUserFilter)
+	set(&provider.LDAPEmailField, req.LDAPEmailField)
+	set(&provider.LDAPNameFields, req.LDAPNameFields)
+	set(&provider.AttributeMapping, req.AttributeMapping)
+	if req.ClaimMappings != nil {
+		provider.ClaimMappings = *req.ClaimMappings
+	}
+
+	if err := setSecret(&provider.ClientSecret, req.ClientSecret); err != nil {
+		return err
+	}
+	return setSecret(&provider.LDAPBindPassword, req.LDAPBindPassword)
+}
+
+// validateSSOProvider checks a provider has what its type needs to sign
+// anyone in.
+func validateSSOProvider(p *models.SSOProvider) error {
+	if p.DisplayName == "" {
+		return errors.New("displayName cannot be empty")
+	}
+	for field, value := range map[string]string{
+		"redirectURL": p.RedirectURL,
+		"issuerURL":   p.IssuerURL,
+		"metadataURL": p.MetadataURL,
+	} {
+		if value == "" {
+			continue
+		}
+		if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New(field + " must be an http(s) URL")
+		}
+	}
+
+	switch p.Type {
+	case models.SSOProviderTypeGoogle, models.SSOProviderTypeGitHub, models.SSOProviderTypeOIDC:
+		if p.ClientID == "" || p.ClientSecret == "" {
+			return errors.New("clientID and clientSecret are required")
+		}
+		if p.Type == models.SSOProviderTypeOIDC && p.IssuerURL == "" {
+			return errors.New("issuerURL is required for OIDC providers")
+		}
+	case models.SSOProviderTypeSAML:
+		if p.MetadataURL == "" || p.EntityID == "" {
+			return errors.New("metadataURL and entityID are required for SAML providers")
+		}
+	case models.SSOProviderTypeLDAP:
+		lower := strings.ToLower(p.LDAPURL)
+		if !strings.HasPrefix(lower, "ldap://") && !strings.HasPrefix(lower, "ldaps://") {
+			return errors.New("ldapURL must start with ldap:// or ldaps://")
+		}
+		if p.LDAPSearchBase == "" {
+			return errors.New("ldapSearchBase is required for LDAP providers")
+		}
+		if strings.Count(p.LDAPUserFilter, "%s") != 1 {
+			return errors.New("ldapUserFilter must contain exactly one %s")
+		}
+	}
+
+	for i, m := range p.ClaimMappings {
+		if strings.TrimSpace(m.Claim) == "" || strings.TrimSpace(m.Value) == "" {
+			return fmt.Errorf("claimMappings[%d]: claim and value are required", i)
+		}
+		if (m.GroupID == nil) == (m.Role == "") {
+			return fmt.Errorf("claimMappings[%d]: set exactly one of groupID and role", i)
+		}
+		if m.Role != "" && !m.Role.Valid() {
+			return fmt.Errorf("claimMappings[%d]: role must be user, admin or an admin sub-role", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestSSOProviderAdmin(t *testing.T) {
+	env := setupTestEnv(t)
+	_, adminToken := createTestUser(t, env.db, "sso-admin@test.com", "password123", models.UserRoleAdmin)
+	_, userToken := createTestUser(t, env.db, "sso-admin-user@test.com", "password123", models.UserRoleUser)
+
+	t.Run("requires admin", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/sso-providers/", nil, authHeaders(userToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("validates required settings", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/sso-providers/", map[string]any{"type": "kerberos"}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/sso-providers/", map[string]any{
+			"type":     "oidc",
+			"clientID": "id",
+		}, authHeaders(adminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusBadRequest)
+		assertEnvelopeError(t, body, "clientID and clientSecret are required")
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/sso-providers/", map[string]any{
+			"type":           "ldap",
+			"ldapURL":        "ldap://dir.example.com",
+			"ldapSearchBase": "dc=example,dc=com",
+			"ldapUserFilter": "(uid=*)",
+		}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/sso-providers/", map[string]any{
+			"type":         "github",
+			"clientID":     "id",
+			"clientSecret": "secret",
+			"claimMappings": []map[string]any{
+				{"claim": "groups", "value": "eng", "groupID": uuid.NewString()},
+			},
+		}, authHeaders(adminToken))
+		body = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusBadRequest)
+		if msg, _ := body["error"].(string); !strings.Contains(msg, "unknown group") {
+			t.Fatalf("expected unknown group error, got %v", body["error"])
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/sso-providers/", map[string]any{
+			"type":          "github",
+			"clientID":      "id",
+			"clientSecret":  "secret",
+			"claimMappings": []map[string]any{{"claim": "groups", "value": "eng", "role": "owner"}},
+		}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+
+	var providerID string
+	t.Run("created provider is live without a restart", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/sso-providers/", map[string]any{
+			"type":         "google",
+			"displayName":  "Company Google",
+			"clientID":     "db-client-id",
+			"clientSecret": "db-client-secret",
+		}, authHeaders(adminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusCreated)
+		data := body["data"].(map[string]any)
+		providerID = data["id"].(string)
+		if data["hasClientSecret"] != true {
+			t.Fatalf("expected hasClientSecret, got %v", data["hasClientSecret"])
+		}
+		if _, leaked := data["clientSecret"]; leaked {
+			t.Fatal("client secret must not be returned")
+		}
+
+		var stored models.SSOProvider
+		if err := env.db.First(&stored, "id = ?", providerID).Error; err != nil {
+			t.Fatalf("load provider: %v", err)
+		}
+		if stored.ClientSecret == "" || stored.ClientSecret == "db-client-secret" {
+			t.Fatalf("expected the secret to be stored encrypted, got %q", stored.ClientSecret)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/auth/sso/providers", nil, nil)
+		body = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		providers := body["data"].([]any)
+		if len(providers) != 1 || providers[0].(map[string]any)["displayName"] != "Company Google" {
+			t.Fatalf("expected the stored provider to be listed, got %v", providers)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/auth/sso/oauth/google", nil, nil)
+		body = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		authURL, err := url.Parse(body["data"].(map[string]any)["url"].(string))
+		if err != nil {
+			t.Fatalf("invalid auth URL: %v", err)
+		}
+		if got := authURL.Query().Get("client_id"); got != "db-client-id" {
+			t.Fatalf("expected client_id db-client-id, got %q", got)
+		}
+	})
+
+	t.Run("one provider per type", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/sso-providers/", map[string]any{
+			"type":         "google",
+			"clientID":     "other",
+			"clientSecret": "other",
+		}, authHeaders(adminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusConflict)
+		if body["code"] != "sso_provider_exists" {
+			t.Fatalf("expected sso_provider_exists, got %v", body["code"])
+		}
+	})
+
+	t.Run("update keeps the secret unless given", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/sso-providers/"+providerID, map[string]any{
+			"enabled": false,
+		}, authHeaders(adminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if body["data"].(map[string]any)["hasClientSecret"] != true {
+			t.Fatal("expected the secret to be kept")
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/auth/sso/providers", nil, nil)
+		body = decodeJSONMap(t, resp)
+		if n := len(body["data"].([]any)); n != 0 {
+			t.Fatalf("expected disabled provider to be hidden, got %d", n)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodDelete, "/api/sso-providers/"+providerID, nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/sso-providers/"+providerID, nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusNotFound)
+
+		var count int64
+		env.db.Model(&models.OutboxEvent{}).Where("event_type LIKE ?", "sso_provider.%").Count(&count)
+		if count != 3 {
+			t.Fatalf("expected 3 recorded events, got %d", count)
+		}
+	})
+
+	t.Run("organization admins only see their own providers", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/sso-providers/", map[string]any{
+			"type":         "github",
+			"clientID":     "default-github",
+			"clientSecret": "secret",
+		}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusCreated)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/organizations/", map[string]any{
+			"name": "Beta",
+			"slug": "beta",
+			"admin": map[string]any{
+				"email": "sso-beta-admin@test.com", "password": "password123", "firstName": "B", "lastName": "Admin",
+			},
+		}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusCreated)
+
+		beta := map[string]string{"X-Organization": "beta"}
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/auth/login", map[string]any{"email": "sso-beta-admin@test.com", "password": "password123"}, beta)
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		headers := authHeaders(body["data"].(map[string]any)["token"].(string))
+		headers["X-Organization"] = "beta"
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/sso-providers/", nil, headers)
+		body = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if n := len(body["data"].([]any)); n != 0 {
+			t.Fatalf("expected no providers for beta, got %d", n)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/auth/sso/providers", nil, beta)
+		body = decodeJSONMap(t, resp)
+		for _, p := range body["data"].([]any) {
+			if strings.EqualFold(p.(map[string]any)["name"].(string), "github") {
+				t.Fatal("beta must not see the default tenant's stored provider")
+			}
+		}
+	})
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/internal/storage"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var (
+	errNothingToClean   = utils.NewError(fiber.StatusBadRequest, "nothing_to_clean", "set deleteOrphans or removeMissing, or run as a dry run")
+	errMirrorNotEnabled = utils.NewError(fiber.StatusConflict, "mirror_not_enabled", "no storage mirror is configured")
+)
+
+// StorageHandler lets platform admins reconcile the bucket with the files
+// table and watch the offsite mirror.
+type StorageHandler struct {
+	DB         *gorm.DB
+	Reconciler *services.StorageReconciler
+	Audit      *services.AuditService
+	// Mirror is nil unless MIRROR_S3_ENDPOINT and MIRROR_S3_BUCKET are set.
+	Mirror  *services.StorageMirror
+	Rollups *services.FolderRollups
+	// Regions is nil unless S3_REPLICAS lists replicas of the bucket.
+	Regions *storage.RegionRouter
+}
+
+func NewStorageHandler(db *gorm.DB, reconciler *services.StorageReconciler, audit *services.AuditService) *StorageHandler {
+	return &StorageHandler{DB: db, Reconciler: reconciler, Audit: audit}
+}
+
+type startReconcileRequest struct {
+	// DryRun defaults to true so cleaning up is always asked for
+	// explicitly.
+	DryRun        *bool  `json:"dryRun"`
+	DeleteOrphans bool   `json:"deleteOrphans"`
+	RemoveMissing bool   `json:"removeMissing"`
+	MinAge        string `json:"minAge"`
+}
+
+// StartReconcile queues a reconciliation run. Only one runs at a time.
+func (h *StorageHandler) StartReconcile(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	var req startReconcileRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return utils.Fail(c, errInvalidBody)
+		}
+	}
+	opts := services.ReconcileOptions{
+		DryRun:        req.DryRun == nil || *req.DryRun,
+		DeleteOrphans: req.DeleteOrphans,
+		RemoveMissing: req.RemoveMissing,
+	}
+	if !opts.DryRun && !opts.DeleteOrphans && !opts.RemoveMissing {
+		return utils.Fail(c, errNothingToClean)
+	}
+	if req.MinAge != "" {
+		minAge, err := time.ParseDuration(req.MinAge)
+		if err != nil || minAge < time.Hour {
+			return utils.Error(c, fiber.StatusBadRequest, "minAge must be a duration of at least 1h")
+		}
+		opts.MinAge = minAge
+	}
+
+	rec, err := h.Reconciler.Start(c.Context(), currentUser.ID, opts)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "reconciliation_failed", "failed starting storage reconciliation")))
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "admin.storage_reconcile",
+		ResourceType: "storage_reconciliation",
+		ResourceID:   &rec.ID,
+		Details: map[string]interface{}{
+			"dry_run":         rec.DryRun,
+			"delete_orphans":  rec.DeleteOrphans,
+			"remove_missing":  rec.RemoveMissing,
+			"min_age_seconds": rec.MinAgeSeconds,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusAccepted, rec)
+}
+
+// ListReconciles returns past runs, newest first, without their findings.
+func (h *StorageHandler) ListReconciles(c *fiber.Ctx) error {
+	p := utils.ParsePagination(c)
+	query := h.DB.Model(&models.StorageReconciliation{}).Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting reconciliations")
+	}
+	var runs []models.StorageReconciliation
+	if err := utils.ApplyPagination(query.Omit("orphans", "missing").Order("created_at DESC, id DESC"), p).Find(&runs).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing reconciliations")
+	}
+	return utils.Paginated(c, runs, p.Page, p.Limit, total)
+}
+
+func (h *StorageHandler) GetReconcile(c *fiber.Ctx) error {
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidReconciliationID)
+	}
+	rec, err := h.Reconciler.Get(c.Context(), id)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "reconciliation_load_failed", "failed loading storage reconciliation")))
+	}
+	return utils.Success(c, fiber.StatusOK, rec)
+}
+
+// MirrorStatus reports the mirror's backlog and lag.
+func (h *StorageHandler) MirrorStatus(c *fiber.Ctx) error {
+	if h.Mirror == nil {
+		return utils.Success(c, fiber.StatusOK, services.MirrorStatus{})
+	}
+	status, err := h.Mirror.Status(c.Context())
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading mirror status")
+	}
+	return utils.Success(c, fiber.StatusOK, status)
+}
+
+// RegionStatus reports the last health probe of each copy of the bucket
+// downloads can be served from.
+func (h *StorageHandler) RegionStatus(c *fiber.Ctx) error {
+	if h.Regions == nil {
+		return utils.Success(c, fiber.StatusOK, fiber.Map{"enabled": false, "regions": []storage.RegionStatus{}})
+	}
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"enabled": true, "regions": h.Regions.Status()})
+}
+
+// StartMirrorBackfill queues a comparison of the two buckets that mirrors
+// whatever differs. A backfill already waiting is returned instead.
+func (h *StorageHandler) StartMirrorBackfill(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	if h.Mirror == nil {
+		return utils.Fail(c, errMirrorNotEnabled)
+	}
+
+	job, err := h.Mirror.StartBackfill(c.Context())
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed queueing mirror backfill")
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "admin.storage_mirror_backfill",
+		ResourceType: "job",
+		ResourceID:   &job.ID,
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+	return utils.Success(c, fiber.StatusAccepted, job)
+}
+
+// StartRollupRebuild queues a recount of every folder's size and item
+// count, for folders changed without an event or after an outage of the
+// outbox. A rebuild already waiting is returned instead.
+func (h *StorageHandler) StartRollupRebuild(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	job, err := h.Rollups.StartRebuild(c.Context())
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed queueing folder rollup rebuild")
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "admin.folder_rollup_rebuild",
+		ResourceType: "job",
+		ResourceID:   &job.ID,
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+	return utils.Success(c, fiber.StatusAccepted, job)
+}
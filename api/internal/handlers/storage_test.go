@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+)
+
+func TestStorageReconcileEndpoints(t *testing.T) {
+	env := setupTestEnv(t)
+	_, adminToken := createTestUser(t, env.db, "storage-admin@test.com", "password123", models.UserRoleAdmin)
+	_, userToken := createTestUser(t, env.db, "storage-user@test.com", "password123", models.UserRoleUser)
+
+	t.Run("admin only", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/storage/reconcile", nil, authHeaders(userToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("cleaning must be asked for", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/storage/reconcile", map[string]any{"dryRun": false}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+		if code := decodeJSONMap(t, resp)["code"]; code != "nothing_to_clean" {
+			t.Fatalf("expected nothing_to_clean, got %v", code)
+		}
+	})
+
+	var runID string
+	t.Run("starts a dry run by default", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/storage/reconcile", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusAccepted)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		if data["status"] != "pending" || data["dryRun"] != true || data["minAgeSeconds"] != float64(86400) {
+			t.Fatalf("unexpected run %v", data)
+		}
+		runID = data["id"].(string)
+
+		var jobs int64
+		env.db.Model(&models.Job{}).Where("kind = ?", "storage.reconcile").Count(&jobs)
+		if jobs != 1 {
+			t.Fatalf("expected the run queued, got %d jobs", jobs)
+		}
+	})
+
+	t.Run("one run at a time", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/storage/reconcile", map[string]any{"deleteOrphans": true, "dryRun": false}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusConflict)
+		if code := decodeJSONMap(t, resp)["code"]; code != "reconciliation_in_progress" {
+			t.Fatalf("expected reconciliation_in_progress, got %v", code)
+		}
+	})
+
+	t.Run("lists and loads runs", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodGet, "/api/admin/storage/reconcile", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		if data := decodeJSONMap(t, resp)["data"].([]any); len(data) != 1 {
+			t.Fatalf("expected one run, got %v", data)
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodGet, "/api/admin/storage/reconcile/"+runID, nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performJSONRequest(t, env.app, http.MethodGet, "/api/admin/storage/reconcile/"+models.File{}.ID.String(), nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusNotFound)
+	})
+}
+
+func TestStorageRegionsEndpoint(t *testing.T) {
+	env := setupTestEnv(t)
+	_, adminToken := createTestUser(t, env.db, "regions@test.com", "password123", models.UserRoleAdmin)
+
+	resp := performJSONRequest(t, env.app, http.MethodGet, "/api/admin/storage/regions", nil, authHeaders(adminToken))
+	assertStatus(t, resp, http.StatusOK)
+	data := decodeJSONMap(t, resp)["data"].(map[string]any)
+	if data["enabled"] != false || len(data["regions"].([]any)) != 0 {
+		t.Fatalf("expected no regions without replicas, got %v", data)
+	}
+}
+
+func TestStorageMirrorEndpoints(t *testing.T) {
+	t.Run("reports a missing mirror", func(t *testing.T) {
+		env := setupTestEnv(t)
+		_, adminToken := createTestUser(t, env.db, "mirror-off@test.com", "password123", models.UserRoleAdmin)
+
+		resp := performJSONRequest(t, env.app, http.MethodGet, "/api/admin/storage/mirror", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		if enabled := decodeJSONMap(t, resp)["data"].(map[string]any)["enabled"]; enabled != false {
+			t.Fatalf("expected the mirror disabled, got %v", enabled)
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/admin/storage/mirror/backfill", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusConflict)
+		if code := decodeJSONMap(t, resp)["code"]; code != "mirror_not_enabled" {
+			t.Fatalf("expected mirror_not_enabled, got %v", code)
+		}
+	})
+
+	t.Run("queues backfills and reports lag", func(t *testing.T) {
+		env := setupTestEnvWithConfig(t, func(cfg *config.Config) {
+			cfg.Mirror.Target = config.S3Config{Endpoint: "offsite.example.com", Bucket: "docshare-mirror"}
+		})
+		_, adminToken := createTestUser(t, env.db, "mirror-on@test.com", "password123", models.UserRoleAdmin)
+		_, userToken := createTestUser(t, env.db, "mirror-user@test.com", "password123", models.UserRoleUser)
+
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/storage/mirror/backfill", nil, authHeaders(userToken))
+		assertStatus(t, resp, http.StatusForbidden)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/admin/storage/mirror/backfill", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusAccepted)
+		first := decodeJSONMap(t, resp)["data"].(map[string]any)["id"]
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/admin/storage/mirror/backfill", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusAccepted)
+		if again := decodeJSONMap(t, resp)["data"].(map[string]any)["id"]; again != first {
+			t.Fatalf("expected the waiting backfill returned, got %v and %v", first, again)
+		}
+
+		key := "mirror:owner/a.txt"
+		queued := time.Now().Add(-time.Minute)
+		job := models.Job{Kind: "mirror.object", Status: models.JobStatusPending, UniqueKey: &key, MaxAttempts: 5, RunAt: queued}
+		job.CreatedAt = queued
+		env.db.Create(&job)
+
+		resp = performJSONRequest(t, env.app, http.MethodGet, "/api/admin/storage/mirror", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		if data["enabled"] != true || data["pending"] != float64(1) || data["lagSeconds"].(float64) < 60 {
+			t.Fatalf("unexpected status %v", data)
+		}
+		if backfill := data["backfill"].(map[string]any); backfill["id"] != first {
+			t.Fatalf("expected the backfill reported, got %v", backfill)
+		}
+	})
+}
+
+func TestFolderRollupRebuild(t *testing.T) {
+	env := setupTestEnv(t)
+	admin, adminToken := createTestUser(t, env.db, "rollup-admin@test.com", "password123", models.UserRoleAdmin)
+
+	folder := models.File{Name: "reports", MimeType: "inode/directory", IsDirectory: true, OwnerID: admin.ID}
+	env.db.Create(&folder)
+	env.db.Create(&models.File{Name: "q1.pdf", MimeType: "application/pdf", Size: 1200, OwnerID: admin.ID, ParentID: &folder.ID, StoragePath: "q1.pdf"})
+
+	resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/storage/rollups/rebuild", nil, authHeaders(adminToken))
+	assertStatus(t, resp, http.StatusAccepted)
+	if ran, err := env.jobs.RunNext(context.Background()); !ran || err != nil {
+		t.Fatalf("expected the rebuild to run, got %v %v", ran, err)
+	}
+
+	resp = performRequest(t, env.app, http.MethodGet, "/api/files/"+folder.ID.String(), nil, authHeaders(adminToken))
+	assertStatus(t, resp, http.StatusOK)
+	data := decodeJSONMap(t, resp)["data"].(map[string]any)
+	if data["totalSize"] != float64(1200) || data["itemCount"] != float64(1) {
+		t.Fatalf("expected the folder's totals, got %v / %v", data["totalSize"], data["itemCount"])
+	}
+}
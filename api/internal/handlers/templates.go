@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var errInvalidTemplateID = utils.NewError(fiber.StatusBadRequest, "invalid_template_id", "invalid template id")
+
+// TemplatesHandler lets users save folder structures as templates and
+// create new folders from them.
+type TemplatesHandler struct {
+	DB        *gorm.DB
+	Access    *services.AccessService
+	Templates *services.FolderTemplates
+	Audit     *services.AuditService
+}
+
+func NewTemplatesHandler(db *gorm.DB, access *services.AccessService, templates *services.FolderTemplates, audit *services.AuditService) *TemplatesHandler {
+	return &TemplatesHandler{DB: db, Access: access, Templates: templates, Audit: audit}
+}
+
+// List returns the caller's templates and those shared in their
+// organization, without entries.
+func (h *TemplatesHandler) List(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	templates, err := h.Templates.Visible(c.Context(), currentUser)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing templates")
+	}
+	return utils.Success(c, fiber.StatusOK, templates)
+}
+
+type createTemplateRequest struct {
+	FolderID      string `json:"folderID"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	Shared        bool   `json:"shared"`
+	IncludeFiles  bool   `json:"includeFiles"`
+	IncludeShares bool   `json:"includeShares"`
+}
+
+// Create saves a folder as a template. Copying its files in as seed files
+// needs download permission on the folder; the structure alone needs view.
+func (h *TemplatesHandler) Create(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	var req createTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	folderID, err := parseUUID(req.FolderID)
+	if err != nil {
+		return utils.Fail(c, errInvalidFileID)
+	}
+	var folder models.File
+	if err := h.DB.First(&folder, "id = ?", folderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.Fail(c, errFileNotFound)
+		}
+		return utils.Fail(c, errLoadingFile)
+	}
+	if !folder.IsDirectory {
+		return utils.Fail(c, errNotDirectory)
+	}
+	permission := models.SharePermissionView
+	if req.IncludeFiles {
+		permission = models.SharePermissionDownload
+	}
+	if !h.Access.HasAccess(c.Context(), currentUser.ID, folder.ID, permission) {
+		return utils.Fail(c, errAccessDenied)
+	}
+	if req.IncludeFiles && folder.OwnerID != currentUser.ID && h.Access.ViewOnly(c.Context(), folder.ID, &currentUser.ID) {
+		return utils.Fail(c, errViewOnly)
+	}
+	if folder.VaultID != nil {
+		return utils.Fail(c, errVaultContent)
+	}
+
+	tmpl, err := h.Templates.Save(c.Context(), currentUser, &folder, services.SaveTemplateRequest{
+		Name:          req.Name,
+		Description:   req.Description,
+		Shared:        req.Shared,
+		IncludeFiles:  req.IncludeFiles,
+		IncludeShares: req.IncludeShares,
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrTemplateInvalid) {
+			return utils.Fail(c, serviceError(err, nil).WithMessage(err.Error()))
+		}
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "template_save_failed", "failed saving template")))
+	}
+
+	h.audit(c, currentUser, "template.create", tmpl, map[string]interface{}{
+		"template_name": tmpl.Name,
+		"folder_id":     folder.ID.String(),
+		"folders":       tmpl.Folders,
+		"files":         tmpl.Files,
+		"shared":        tmpl.Shared,
+	})
+	return utils.Success(c, fiber.StatusCreated, tmpl)
+}
+
+// Get returns a template with its folders and seed files.
+func (h *TemplatesHandler) Get(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	tmpl, apiErr := h.load(c, currentUser)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	return utils.Success(c, fiber.StatusOK, tmpl)
+}
+
+// Update renames a template or changes whether it is shared. Only its
+// owner or an admin can.
+func (h *TemplatesHandler) Update(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	var req struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Shared      *bool   `json:"shared"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	tmpl, apiErr := h.loadOwned(c, currentUser)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if err := h.Templates.Update(c.Context(), tmpl, req.Name, req.Description, req.Shared); err != nil {
+		if errors.Is(err, services.ErrTemplateInvalid) {
+			return utils.Fail(c, serviceError(err, nil).WithMessage(err.Error()))
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed updating template")
+	}
+
+	h.audit(c, currentUser, "template.update", tmpl, map[string]interface{}{
+		"template_name": tmpl.Name,
+		"shared":        tmpl.Shared,
+	})
+	return utils.Success(c, fiber.StatusOK, tmpl)
+}
+
+// Delete removes a template and its seed files. Folders already made from
+// it are kept. Only its owner or an admin can.
+func (h *TemplatesHandler) Delete(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	tmpl, apiErr := h.loadOwned(c, currentUser)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if err := h.Templates.Delete(c.Context(), tmpl); err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed deleting template")
+	}
+
+	h.audit(c, currentUser, "template.delete", tmpl, map[string]interface{}{"template_name": tmpl.Name})
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "template deleted"})
+}
+
+type instantiateTemplateRequest struct {
+	ParentID  *string           `json:"parentID"`
+	Variables map[string]string `json:"variables"`
+}
+
+// Instantiate creates a new folder from a template under parentID, which
+// needs edit permission, or in the caller's root. Every template variable
+// must be given a value.
+func (h *TemplatesHandler) Instantiate(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	var req instantiateTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	tmpl, apiErr := h.load(c, currentUser)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	parent, apiErr := loadTargetFolder(c, h.DB, h.Access, currentUser, req.ParentID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	var parentID *uuid.UUID
+	if parent != nil {
+		parentID = &parent.ID
+	}
+
+	entry := services.AuditEntry{UserID: &currentUser.ID, IPAddress: c.IP(), RequestID: getRequestID(c)}
+	result, err := h.Templates.Instantiate(c.Context(), currentUser, tmpl, parentID, req.Variables, entry)
+	if err != nil {
+		if errors.Is(err, services.ErrTemplateInvalid) || errors.Is(err, services.ErrTemplateVariables) {
+			return utils.Fail(c, serviceError(err, nil).WithMessage(err.Error()))
+		}
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "template_instantiate_failed", "failed creating folder from template")))
+	}
+
+	h.audit(c, currentUser, "template.instantiate", tmpl, map[string]interface{}{
+		"template_name": tmpl.Name,
+		"folder_id":     result.Folder.ID.String(),
+		"folder_name":   result.Folder.Name,
+		"folders":       result.Folders,
+		"files":         result.Files,
+		"shares":        result.Shares,
+	})
+	return utils.Success(c, fiber.StatusCreated, result)
+}
+
+func (h *TemplatesHandler) load(c *fiber.Ctx, currentUser *models.User) (*models.FolderTemplate, *utils.APIError) {
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return nil, errInvalidTemplateID
+	}
+	tmpl, err := h.Templates.Get(c.Context(), currentUser, id)
+	if err != nil {
+		return nil, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "template_load_failed", "failed loading template"))
+	}
+	return tmpl, nil
+}
+
+// loadOwned loads a template the caller may change: their own, or any
+// visible one for an admin.
+func (h *TemplatesHandler) loadOwned(c *fiber.Ctx, currentUser *models.User) (*models.FolderTemplate, *utils.APIError) {
+	tmpl, apiErr := h.load(c, currentUser)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if tmpl.OwnerID != currentUser.ID && currentUser.Role != models.UserRoleAdmin {
+		return nil, errAccessDenied
+	}
+	return tmpl, nil
+}
+
+func (h *TemplatesHandler) audit(c *fiber.Ctx, currentUser *models.User, action string, tmpl *models.FolderTemplate, details map[string]interface{}) {
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       action,
+		ResourceType: "template",
+		ResourceID:   &tmpl.ID,
+		Details:      details,
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestTemplates(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "tmpl-owner@test.com", "password123", models.UserRoleUser)
+	_, otherToken := createTestUser(t, env.db, "tmpl-other@test.com", "password123", models.UserRoleUser)
+
+	folder := models.File{Name: "Case {{number}}", IsDirectory: true, MimeType: "inode/directory", OwnerID: owner.ID}
+	env.db.Create(&folder)
+	env.db.Create(&models.File{Name: "Evidence", IsDirectory: true, MimeType: "inode/directory", OwnerID: owner.ID, ParentID: &folder.ID})
+	intake := models.File{Name: "intake.txt", MimeType: "text/plain", Size: 4, OwnerID: owner.ID, ParentID: &folder.ID, StoragePath: "tmpl/intake"}
+	env.db.Create(&intake)
+	env.uploads.objects[intake.StoragePath] = []byte("form")
+
+	resp := performJSONRequest(t, env.app, http.MethodPost, "/api/templates", map[string]any{"folderID": folder.ID.String(), "name": "Case file", "includeFiles": true}, authHeaders(ownerToken))
+	assertStatus(t, resp, http.StatusCreated)
+	data := decodeJSONMap(t, resp)["data"].(map[string]any)
+	if data["folders"] != float64(2) || data["files"] != float64(1) {
+		t.Fatalf("unexpected template %v", data)
+	}
+	id := data["id"].(string)
+
+	t.Run("instantiate creates the folder", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/templates/"+id+"/instantiate", map[string]any{}, authHeaders(ownerToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusBadRequest)
+		if body["code"] != "template_variables_missing" {
+			t.Fatalf("expected template_variables_missing, got %v", body["code"])
+		}
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/templates/"+id+"/instantiate", map[string]any{"variables": map[string]string{"number": "42"}}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusCreated)
+		result := decodeJSONMap(t, resp)["data"].(map[string]any)
+		created := result["folder"].(map[string]any)
+		if created["name"] != "Case 42" || result["folders"] != float64(2) || result["files"] != float64(1) {
+			t.Fatalf("unexpected result %v", result)
+		}
+		var copied models.File
+		if err := env.db.Where("parent_id = ? AND name = ?", created["id"], "intake.txt").First(&copied).Error; err != nil {
+			t.Fatalf("expected the seed file created: %v", err)
+		}
+		if string(env.uploads.objects[copied.StoragePath]) != "form" {
+			t.Fatalf("expected the seed content copied, got %q", env.uploads.objects[copied.StoragePath])
+		}
+	})
+
+	t.Run("private templates are hidden from others", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/templates/"+id, nil, authHeaders(otherToken))
+		assertStatus(t, resp, http.StatusNotFound)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/templates", map[string]any{"folderID": folder.ID.String()}, authHeaders(otherToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("shared templates can be used but not changed by others", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPatch, "/api/templates/"+id, map[string]any{"shared": true}, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/templates", nil, authHeaders(otherToken))
+		assertStatus(t, resp, http.StatusOK)
+		if list := decodeJSONMap(t, resp)["data"].([]any); len(list) != 1 {
+			t.Fatalf("expected the shared template listed, got %v", list)
+		}
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/templates/"+id+"/instantiate", map[string]any{"variables": map[string]string{"number": "7"}}, authHeaders(otherToken))
+		assertStatus(t, resp, http.StatusCreated)
+
+		resp = performRequest(t, env.app, http.MethodDelete, "/api/templates/"+id, nil, authHeaders(otherToken))
+		assertStatus(t, resp, http.StatusForbidden)
+		resp = performRequest(t, env.app, http.MethodDelete, "/api/templates/"+id, nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+	})
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// TermsHandler lets platform admins publish the terms users must accept,
+// and users see and accept them.
+type TermsHandler struct {
+	DB    *gorm.DB
+	Terms *services.TermsService
+	Audit *services.AuditService
+}
+
+func NewTermsHandler(db *gorm.DB, terms *services.TermsService, audit *services.AuditService) *TermsHandler {
+	return &TermsHandler{DB: db, Terms: terms, Audit: audit}
+}
+
+// List returns every published version, newest first.
+func (h *TermsHandler) List(c *fiber.Ctx) error {
+	versions, err := h.Terms.List(c.Context())
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing terms")
+	}
+	return utils.Success(c, fiber.StatusOK, versions)
+}
+
+// Publish puts a new version of a document in force.
+func (h *TermsHandler) Publish(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	var req struct {
+		Kind    string `json:"kind"`
+		Version string `json:"version"`
+		Title   string `json:"title"`
+		Body    string `json:"body"`
+		URL     string `json:"url"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	version, err := h.Terms.Publish(c.Context(), currentUser.ID, services.PublishTermsRequest{
+		Kind:    req.Kind,
+		Version: req.Version,
+		Title:   req.Title,
+		Body:    req.Body,
+		URL:     req.URL,
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrTermsInvalid) {
+			return utils.Fail(c, errInvalidTerms.WithMessage(err.Error()))
+		}
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "terms_publish_failed", "failed publishing terms")))
+	}
+
+	h.audit(c, currentUser, "admin.terms_publish", version)
+	return utils.Success(c, fiber.StatusCreated, version)
+}
+
+// Retire takes a version out of force.
+func (h *TermsHandler) Retire(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidTermsID)
+	}
+	version, err := h.Terms.Retire(c.Context(), id)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "terms_retire_failed", "failed retiring terms")))
+	}
+
+	h.audit(c, currentUser, "admin.terms_retire", version)
+	return utils.Success(c, fiber.StatusOK, version)
+}
+
+// Acceptances lists who accepted a version, and when and from where,
+// newest first.
+func (h *TermsHandler) Acceptances(c *fiber.Ctx) error {
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidTermsID)
+	}
+	if _, err := h.Terms.Get(c.Context(), id); err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "terms_load_failed", "failed loading terms")))
+	}
+
+	p := utils.ParsePagination(c)
+	query := h.DB.Model(&models.TermsAcceptance{}).Where("terms_version_id = ?", id).Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed counting acceptances")
+	}
+	var acceptances []models.TermsAcceptance
+	if err := utils.ApplyPagination(query.Order("accepted_at DESC, id DESC"), p).Find(&acceptances).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed listing acceptances")
+	}
+	return utils.Paginated(c, acceptances, p.Page, p.Limit, total)
+}
+
+// Mine returns the versions in force and whether the current user has
+// accepted each.
+func (h *TermsHandler) Mine(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	terms, err := h.Terms.ForUser(c.Context(), currentUser.ID)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading terms")
+	}
+	return utils.Success(c, fiber.StatusOK, terms)
+}
+
+// Accept records the current user's acceptance of a version in force.
+func (h *TermsHandler) Accept(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	id, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidTermsID)
+	}
+	acceptance, err := h.Terms.Accept(c.Context(), currentUser.ID, id, c.IP(), c.Get(fiber.HeaderUserAgent))
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "terms_accept_failed", "failed recording acceptance")))
+	}
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "auth.terms_accept",
+		ResourceType: "terms_version",
+		ResourceID:   &acceptance.TermsVersionID,
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+	return utils.Success(c, fiber.StatusOK, acceptance)
+}
+
+func (h *TermsHandler) audit(c *fiber.Ctx, user *models.User, action string, version *models.TermsVersion) {
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &user.ID,
+		Action:       action,
+		ResourceType: "terms_version",
+		ResourceID:   &version.ID,
+		Details: map[string]interface{}{
+			"kind":    version.Kind,
+			"version": version.Version,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+)
+
+func TestTerms(t *testing.T) {
+	env := setupTestEnv(t)
+	_, adminToken := createTestUser(t, env.db, "terms-admin@test.com", "password123", models.UserRoleAdmin)
+	user, userToken := createTestUser(t, env.db, "terms-user@test.com", "password123", models.UserRoleUser)
+
+	expectCode := func(t *testing.T, resp *http.Response, status int, code string) {
+		t.Helper()
+		body := decodeJSONMap(t, resp)
+		if resp.StatusCode != status || body["code"] != code {
+			t.Fatalf("expected %d %s, got %d %v", status, code, resp.StatusCode, body)
+		}
+	}
+	pending := func(t *testing.T, token string) []any {
+		t.Helper()
+		resp := performRequest(t, env.app, http.MethodGet, "/api/auth/me", nil, authHeaders(token))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		return body["data"].(map[string]any)["pendingTerms"].([]any)
+	}
+	accept := func(t *testing.T, token, id string) {
+		t.Helper()
+		resp := performRequest(t, env.app, http.MethodPost, "/api/auth/terms/"+id+"/accept", nil, authHeaders(token))
+		assertStatus(t, resp, http.StatusOK)
+	}
+
+	t.Run("only admins publish", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/terms", map[string]any{"kind": "terms", "version": "1", "title": "Terms", "body": "x"}, authHeaders(userToken))
+		assertStatus(t, resp, http.StatusForbidden)
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/admin/terms", map[string]any{"kind": "terms", "version": "1"}, authHeaders(adminToken))
+		expectCode(t, resp, http.StatusBadRequest, "invalid_terms")
+	})
+
+	if got := pending(t, userToken); len(got) != 0 {
+		t.Fatalf("expected nothing pending before any terms are published, got %v", got)
+	}
+
+	resp := performJSONRequest(t, env.app, http.MethodPost, "/api/admin/terms", map[string]any{
+		"kind":    "terms",
+		"version": "2024-01",
+		"title":   "Terms of Service",
+		"body":    "The full text.",
+	}, authHeaders(adminToken))
+	body := decodeJSONMap(t, resp)
+	assertStatus(t, resp, http.StatusCreated)
+	termsID := body["data"].(map[string]any)["id"].(string)
+
+	t.Run("me reports pending terms", func(t *testing.T) {
+		got := pending(t, userToken)
+		if len(got) != 1 {
+			t.Fatalf("expected one pending version, got %v", got)
+		}
+		version := got[0].(map[string]any)
+		if version["id"] != termsID || version["body"] != nil {
+			t.Fatalf("expected the version without its body, got %v", version)
+		}
+		// Without enforcement the rest of the API stays open.
+		assertStatus(t, performRequest(t, env.app, http.MethodGet, "/api/files", nil, authHeaders(userToken)), http.StatusOK)
+	})
+
+	t.Run("enforcement holds back access until acceptance", func(t *testing.T) {
+		accept(t, adminToken, termsID)
+		putSettings(t, env, adminToken, map[string]any{services.SettingTermsEnforce: true})
+		t.Cleanup(func() { putSettings(t, env, adminToken, map[string]any{services.SettingTermsEnforce: nil}) })
+
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files", nil, authHeaders(userToken))
+		expectCode(t, resp, http.StatusForbidden, "terms_acceptance_required")
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/auth/terms", nil, authHeaders(userToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		terms := body["data"].([]any)
+		if len(terms) != 1 || terms[0].(map[string]any)["body"] != "The full text." || terms[0].(map[string]any)["acceptedAt"] != nil {
+			t.Fatalf("unexpected terms %v", terms)
+		}
+
+		headers := authHeaders(userToken)
+		headers["User-Agent"] = "terms-test"
+		resp = performRequest(t, env.app, http.MethodPost, "/api/auth/terms/"+termsID+"/accept", nil, headers)
+		assertStatus(t, resp, http.StatusOK)
+		assertStatus(t, performRequest(t, env.app, http.MethodGet, "/api/files", nil, authHeaders(userToken)), http.StatusOK)
+
+		var acceptance models.TermsAcceptance
+		if err := env.db.First(&acceptance, "user_id = ?", user.ID).Error; err != nil {
+			t.Fatalf("expected the acceptance to be stored: %v", err)
+		}
+		if acceptance.IPAddress == "" || acceptance.UserAgent != "terms-test" {
+			t.Fatalf("expected the IP and user agent to be recorded, got %+v", acceptance)
+		}
+
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			var count int64
+			env.db.Model(&models.AuditLog{}).Where("action = ? AND user_id = ?", "auth.terms_accept", user.ID).Count(&count)
+			if count == 1 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected one auth.terms_accept entry, got %d", count)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	})
+
+	t.Run("admins see acceptances and retire versions", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/admin/terms/"+termsID+"/acceptances", nil, authHeaders(adminToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		if acceptances := body["data"].([]any); len(acceptances) != 2 {
+			t.Fatalf("expected two acceptances, got %v", acceptances)
+		}
+
+		resp = performRequest(t, env.app, http.MethodPost, "/api/admin/terms/"+termsID+"/retire", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		resp = performRequest(t, env.app, http.MethodPost, "/api/auth/terms/"+termsID+"/accept", nil, authHeaders(userToken))
+		expectCode(t, resp, http.StatusConflict, "terms_not_current")
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/admin/terms", nil, authHeaders(adminToken))
+		body = decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusOK)
+		versions := body["data"].([]any)
+		if len(versions) != 1 || versions[0].(map[string]any)["current"] != false || versions[0].(map[string]any)["acceptances"] != float64(2) {
+			t.Fatalf("unexpected versions %v", versions)
+		}
+	})
+}
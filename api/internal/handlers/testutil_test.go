@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"database/sql/driver"
 	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -15,24 +17,174 @@ import (
 	"github.com/docshare/api/internal/middleware"
 	"github.com/docshare/api/internal/models"
 	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/internal/storage"
 	"github.com/docshare/api/pkg/logger"
 	"github.com/docshare/api/pkg/utils"
 	gosqlite "github.com/glebarez/go-sqlite"
 	"github.com/glebarez/sqlite"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"gorm.io/gorm"
 )
 
+// testDeniedAAGUID is on the test environment's passkey deny list.
+const testDeniedAAGUID = "531126d6-e717-415c-9320-3d9aa6981239"
+
+// recordingMailer keeps the email sent during tests instead of delivering
+// it. It is shared by every test environment, so look messages up by
+// recipient.
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []sentMail
+}
+
+type sentMail struct {
+	To, Subject, Body string
+}
+
+var testMailer = &recordingMailer{}
+
+func (m *recordingMailer) Send(to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, sentMail{To: to, Subject: subject, Body: body})
+	return nil
+}
+
+// sentTo returns the mail sent to the address, waiting briefly for mail
+// sent in the background.
+func (m *recordingMailer) sentTo(to string) []sentMail {
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		m.mu.Lock()
+		var out []sentMail
+		for _, mail := range m.sent {
+			if mail.To == to {
+				out = append(out, mail)
+			}
+		}
+		m.mu.Unlock()
+		if len(out) > 0 || time.Now().After(deadline) {
+			return out
+		}
+	}
+}
+
+// memoryObjectStore keeps objects in memory for handlers that need a
+// store.
+type memoryObjectStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newMemoryObjectStore() *memoryObjectStore {
+	return &memoryObjectStore{objects: map[string][]byte{}}
+}
+
+func (s *memoryObjectStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, storage.ErrObjectNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memoryObjectStore) Upload(_ context.Context, key string, reader io.Reader, _ int64, _ string) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = data
+	return nil
+}
+
+func (s *memoryObjectStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *memoryObjectStore) Stat(_ context.Context, key string) (storage.ObjectInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[key]
+	if !ok {
+		return storage.ObjectInfo{}, storage.ErrObjectNotFound
+	}
+	return storage.ObjectInfo{Key: key, Size: int64(len(data))}, nil
+}
+
+func (s *memoryObjectStore) ListObjects(_ context.Context, prefix, _ string, fn func(storage.ObjectInfo) error) error {
+	s.mu.Lock()
+	var infos []storage.ObjectInfo
+	for key, data := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			infos = append(infos, storage.ObjectInfo{Key: key, Size: int64(len(data))})
+		}
+	}
+	s.mu.Unlock()
+	for _, info := range infos {
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryObjectStore) OpenArchive(_ context.Context, key string) (services.ArchiveObject, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, storage.ErrObjectNotFound
+	}
+	return memoryArchiveObject{bytes.NewReader(data)}, nil
+}
+
+type memoryArchiveObject struct {
+	*bytes.Reader
+}
+
+func (memoryArchiveObject) Close() error {
+	return nil
+}
+
+// memoryArchiveBucket is a cold storage bucket whose objects can always
+// be read.
+type memoryArchiveBucket struct {
+	*memoryObjectStore
+}
+
+func (memoryArchiveBucket) RequestRestore(context.Context, string) error {
+	return nil
+}
+
 type testEnv struct {
 	app *fiber.App
 	db  *gorm.DB
+	// jobs is not started; tests run queued jobs with RunNext.
+	jobs *services.JobRunner
+	// uploads holds the bytes of resumable uploads and the files they
+	// become.
+	uploads *memoryObjectStore
 }
 
 var testSetupOnce sync.Once
 
 func setupTestEnv(t *testing.T) *testEnv {
 	t.Helper()
+	return setupTestEnvWithConfig(t, nil)
+}
+
+// setupTestEnvWithConfig is setupTestEnv with a chance to adjust the
+// configuration before the services are built.
+func setupTestEnvWithConfig(t *testing.T, configure func(*config.Config)) *testEnv {
+	t.Helper()
 
 	testSetupOnce.Do(func() {
 		gosqlite.MustRegisterScalarFunction("NOW", 0, func(ctx *gosqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
@@ -59,23 +211,69 @@ func setupTestEnv(t *testing.T) *testEnv {
 	})
 
 	err = db.AutoMigrate(
+		&models.Organization{},
 		&models.User{},
 		&models.Group{},
 		&models.GroupMembership{},
 		&models.File{},
 		&models.Share{},
+		&models.ShareInvitation{},
+		&models.FolderShareDefaults{},
+		&models.ShareControl{},
+		&models.ShareApproval{},
 		&models.Activity{},
+		&models.ActivityMute{},
+		&models.NotificationPreference{},
 		&models.APIToken{},
+		&models.HMACKey{},
+		&models.RequestNonce{},
 		&models.DeviceCode{},
 		&models.AuditLog{},
 		&models.AuditExportCursor{},
+		&models.AuditExportObject{},
+		&models.AuditRetentionRun{},
 		&models.Transfer{},
+		&models.TransferChunk{},
+		&models.Upload{},
+		&models.UploadChunk{},
+		&models.ClassificationRule{},
+		&models.LegalExport{},
+		&models.TermsVersion{},
+		&models.TermsAcceptance{},
 		&models.SSOProvider{},
 		&models.LinkedAccount{},
 		&models.PreviewJob{},
 		&models.MFAConfig{},
 		&models.WebAuthnCredential{},
+		&models.Session{},
+		&models.FileAccessStat{},
 		&models.MFAChallenge{},
+		&models.FileLock{},
+		&models.OutboxEvent{},
+		&models.Job{},
+		&models.StorageReconciliation{},
+		&models.IntegrityCheck{},
+		&models.ImportJob{},
+		&models.FolderTemplate{},
+		&models.FolderTemplateEntry{},
+		&models.PropertyDefinition{},
+		&models.FileProperty{},
+		&models.FileReview{},
+		&models.FileReviewer{},
+		&models.FileDueDate{},
+		&models.CalendarFeed{},
+		&models.Paste{},
+		&models.ArchiveExtraction{},
+		&models.ArchiveBuild{},
+		&models.IntegrationConnection{},
+		&models.Setting{},
+		&models.AbuseReport{},
+		&models.CaptchaPass{},
+		&models.IdempotencyKey{},
+		&models.PreviewTokenUse{},
+		&models.SigningKey{},
+		&models.UserKey{},
+		&models.VaultKey{},
 	)
 	if err != nil {
 		t.Fatalf("failed automigrating models: %v", err)
@@ -83,151 +281,538 @@ func setupTestEnv(t *testing.T) *testEnv {
 
 	accessService := services.NewAccessService(db)
 	previewService := services.NewPreviewService(db, nil, config.GotenbergConfig{})
-	previewQueueService := services.NewPreviewQueueService(db, previewService, config.PreviewConfig{
-		QueueBufferSize: 10,
-		MaxAttempts:     3,
-		RetryDelays:     []time.Duration{30 * time.Second, 2 * time.Minute, 10 * time.Minute},
+	jobRunner := services.NewJobRunner(db, config.JobsConfig{})
+	previewQueueService := services.NewPreviewQueueService(db, previewService, jobRunner, config.PreviewConfig{
+		MaxAttempts: 3,
+		RetryDelays: []time.Duration{30 * time.Second, 2 * time.Minute, 10 * time.Minute},
 	})
 	auditService := services.NewAuditService(db, nil)
+	lockService := services.NewLockService(db)
+	manifestService, err := services.NewManifestService(db, nil, config.ManifestConfig{}, "test-manifest-secret")
+	if err != nil {
+		t.Fatalf("failed creating manifest service: %v", err)
+	}
 
 	cfg := &config.Config{
 		Server: config.ServerConfig{
 			FrontendURL: "http://localhost:3001",
+			MaxUploadMB: 100,
+		},
+		CORS: config.CORSConfig{
+			AllowedOrigins: []string{"http://localhost:3001"},
+		},
+		BodyLimits: config.BodyLimitsConfig{
+			JSONBytes:          1024 * 1024,
+			DocumentBytes:      8 * 1024 * 1024,
+			TransferChunkBytes: 32 * 1024 * 1024,
 		},
 		SSO: config.SSOConfig{
 			AutoRegister: true,
 			DefaultRole:  "user",
 		},
+		Uploads: config.UploadPolicyConfig{
+			BlockedTypes:      []string{"application/x-msdownload"},
+			BlockedExtensions: []string{".exe"},
+		},
+		Tenancy: config.TenancyConfig{
+			Enabled:    true,
+			BaseDomain: "docshare.test",
+			Header:     "X-Organization",
+		},
+		WebAuthn: config.WebAuthnConfig{
+			RPDisplayName:  "DocShare",
+			RPID:           "localhost",
+			RPOrigins:      []string{"http://localhost:3001"},
+			AAGUIDDenylist: []string{testDeniedAAGUID},
+		},
+		Sessions: config.SessionsConfig{
+			CountryHeader:  "CF-IPCountry",
+			NewDeviceEmail: true,
+		},
+		MFA: config.MFAConfig{
+			GracePeriod:         24 * time.Hour,
+			RecoveryCodeCount:   10,
+			RecoveryMinCodes:    3,
+			RecoveryDownloadTTL: 10 * time.Minute,
+		},
+		Pastes: config.PastesConfig{
+			MaxBytes: 64 * 1024,
+			PerHour:  5,
+		},
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+	uploadPolicy := services.NewUploadPolicy(cfg.Uploads)
+	settingsService, err := services.NewSettingsService(db, cfg)
+	if err != nil {
+		t.Fatalf("failed creating settings service: %v", err)
+	}
+	accessService.Settings = settingsService
+	previewService.Settings = settingsService
+	captchaService, err := services.NewCaptchaService(db, cfg.Captcha)
+	if err != nil {
+		t.Fatalf("failed creating captcha service: %v", err)
 	}
 
-	authHandler := NewAuthHandler(db, auditService)
+	sessionService := services.NewSessionService(db, cfg.Sessions, testMailer)
+	authHandler := NewAuthHandler(db, auditService, sessionService)
+	authHandler.Settings = settingsService
+	termsService := services.NewTermsService(db, settingsService)
+	authHandler.Terms = termsService
+	authHandler.Avatars = services.NewAvatarService(db, newMemoryObjectStore())
 	usersHandler := NewUsersHandler(db, auditService)
+	usersHandler.Settings = settingsService
+	groupQuotas := services.NewGroupQuotas(db)
 	groupsHandler := NewGroupsHandler(db, auditService)
-	filesHandler := NewFilesHandler(db, nil, accessService, previewService, previewQueueService, nil, auditService, 100*1024*1024)
-	sharesHandler := NewSharesHandler(db, accessService, auditService)
+	groupsHandler.Quotas = groupQuotas
+	organizationsHandler := NewOrganizationsHandler(db, auditService)
+	organizationsHandler.Settings = settingsService
+	filesHandler := NewFilesHandler(db, nil, accessService, previewService, previewQueueService, services.NewTextPreviewService(nil, config.PreviewConfig{TextMaxBytes: 64 * 1024}), nil, auditService, lockService, manifestService, uploadPolicy, services.NewFileAnalyticsService(db, "test-secret", cfg.Server.FrontendURL), services.NewDownloadLimiter(db, cfg.Downloads), 100*1024*1024)
+	filesHandler.Settings = settingsService
+	filesHandler.PreviewTokens = services.NewPreviewTokens(db, settingsService)
+	filesHandler.Captcha = captchaService
+	uploadStore := newMemoryObjectStore()
+	filesHandler.Uploads = services.NewResumableUploads(db, uploadStore)
+	filesHandler.Pastes = services.NewPastes(db, uploadStore, cfg.Pastes)
+	filesHandler.FrontendURL = cfg.Server.FrontendURL
+	classifier := services.NewClassifier(db, jobRunner, services.NewScanner(cfg.Scan), uploadStore)
+	filesHandler.Classifier = classifier
+	filesHandler.GroupQuotas = groupQuotas
+	filesHandler.Archiver = services.NewColdStorage(db, uploadStore, memoryArchiveBucket{newMemoryObjectStore()}, jobRunner, 0)
+	filesHandler.ArchiveContents = services.NewArchiveContents(config.PreviewConfig{ArchiveMaxEntries: 100, ArchiveEntryMaxBytes: 1024 * 1024})
+	filesHandler.Extractor = services.NewArchiveExtractor(db, uploadStore, jobRunner, uploadPolicy, config.PreviewConfig{ArchiveExtractMaxFiles: 100, ArchiveExtractMaxBytes: 1024 * 1024})
+	filesHandler.ArchiveBuilder = services.NewArchiveBuilder(db, uploadStore, jobRunner, accessService, config.PreviewConfig{ArchiveCreateMaxFiles: 100, ArchiveCreateMaxBytes: 1024 * 1024})
+	filesHandler.DueDates = services.NewDueDates(db, accessService, testMailer, config.DueDatesConfig{ReminderHours: []int{168, 24}, Email: true}, "http://localhost:3000")
+	sharesHandler := NewSharesHandler(db, accessService, auditService, testMailer, cfg)
+	sharesHandler.Captcha = captchaService
+	vaults := services.NewVaults(db)
+	filesHandler.Vaults = vaults
+	sharesHandler.Vaults = vaults
+	vaultsHandler := NewVaultsHandler(db, vaults, accessService, auditService)
 	activitiesHandler := NewActivitiesHandler(db)
+	notifyHandler := NewNotifyHandler(services.NewChangeFeed(db, accessService))
 	auditHandler := NewAuditHandler(db)
+	auditHandler.Retention = services.NewAuditRetention(db, nil, cfg.Audit)
 	apiTokenHandler := NewAPITokenHandler(db, auditService)
-	deviceAuthHandler := NewDeviceAuthHandler(db, auditService, cfg)
-	transfersHandler := NewTransfersHandler(db, 300)
+	hmacKeys := services.NewHMACKeys(db)
+	hmacKeyHandler := NewHMACKeyHandler(db, hmacKeys, auditService)
+	deviceAuthHandler := NewDeviceAuthHandler(db, auditService, cfg, sessionService)
+	transfersHandler := NewTransfersHandler(db, uploadPolicy, 300)
+	transfersHandler.Relay = services.NewTransferRelay(db, newMemoryObjectStore(), jobRunner, services.NewScanner(cfg.Scan), auditService, cfg.Scan)
+	transfersHandler.Access = accessService
+	transfersHandler.Links = services.NewTransferLinks(db, cfg.JWT.Secret, cfg.Server.FrontendURL)
+	transfersHandler.Audit = auditService
+	propertiesHandler := NewPropertiesHandler(db, filesHandler.Properties, auditService)
+	reviewsHandler := NewReviewsHandler(db, filesHandler.Reviews)
+	templatesHandler := NewTemplatesHandler(db, accessService, services.NewFolderTemplates(db, uploadStore), auditService)
 	authMiddleware := middleware.NewAuthMiddleware(db)
+	authMiddleware.MFAPolicy, err = services.NewMFAPolicy(db, cfg.MFA)
+	if err != nil {
+		t.Fatalf("failed building MFA policy: %v", err)
+	}
+	authMiddleware.Sessions = sessionService
+	authMiddleware.Terms = termsService
+	authMiddleware.HMACKeys = hmacKeys
+
+	ssoHandler := NewSSOHandler(db, cfg, auditService, sessionService)
+	devicesHandler := NewDevicesHandler(db, auditService)
+	mfaHandler := NewMFAHandler(db, auditService, cfg.MFA, sessionService)
+	jobsHandler := NewJobsHandler(db, jobRunner, auditService)
+	conversionsHandler := NewConversionsHandler(services.NewGotenbergPool(config.GotenbergConfig{Workers: 1}))
+	databaseHandler := NewDatabaseHandler(db)
+	storageHandler := NewStorageHandler(db, services.NewStorageReconciler(db, nil, jobRunner), auditService)
+	storageHandler.Rollups = services.NewFolderRollups(db, jobRunner)
+	integrityHandler := NewIntegrityHandler(db, services.NewIntegrityChecker(db, jobRunner), auditService)
+	if cfg.Mirror.Enabled() {
+		storageHandler.Mirror = services.NewStorageMirror(db, nil, nil, jobRunner, cfg.Mirror.Deletes)
+	}
+	importer := services.NewImporter(db, nil, jobRunner, uploadPolicy, config.ImportConfig{})
+	importsHandler := NewImportsHandler(db, importer, auditService)
+	integrations := services.NewIntegrations(db, cfg.Integrations, "test-secret", importer)
+	integrationsHandler := NewIntegrationsHandler(db, cfg, integrations, importer, auditService)
+	versionHandler := NewVersionHandler(cfg, settingsService, ssoHandler.Providers, integrations)
+	settingsHandler := NewSettingsHandler(settingsService, auditService)
+	signingKeysHandler := NewSigningKeysHandler(services.NewSigningKeys(db), auditService)
+	classificationRulesHandler := NewClassificationRulesHandler(db, classifier, auditService)
+	termsHandler := NewTermsHandler(db, termsService, auditService)
+	effectiveAccessHandler := NewEffectiveAccessHandler(db, services.NewEffectiveAccess(db, accessService))
+	legalExportsHandler := NewLegalExportsHandler(db, services.NewLegalExports(db, uploadStore, jobRunner, manifestService), auditService)
+	moderationHandler := NewModerationHandler(db, accessService, services.NewModerationService(db), auditService)
+	moderationHandler.Captcha = captchaService
+	idempotent := middleware.Idempotency(services.NewIdempotencyService(db, 0))
+
+	passkeyPolicy, err := services.NewAuthenticatorPolicy(cfg.WebAuthn)
+	if err != nil {
+		t.Fatalf("failed building passkey policy: %v", err)
+	}
+	wa, err := webauthn.New(&webauthn.Config{
+		RPDisplayName: cfg.WebAuthn.RPDisplayName,
+		RPID:          cfg.WebAuthn.RPID,
+		RPOrigins:     cfg.WebAuthn.RPOrigins,
+	})
+	if err != nil {
+		t.Fatalf("failed initializing webauthn: %v", err)
+	}
+	webAuthnHandler := NewWebAuthnHandler(db, wa, auditService, passkeyPolicy, cfg.MFA, sessionService)
 
-	ssoHandler := NewSSOHandler(db, cfg)
-	mfaHandler := NewMFAHandler(db, auditService)
-
-	app := fiber.New(fiber.Config{BodyLimit: 100 * 1024 * 1024})
+	app := fiber.New(fiber.Config{
+		BodyLimit:                    8 * 1024 * 1024,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+		ErrorHandler:                 utils.ErrorHandler,
+	})
+	app.Use(middleware.RequestID())
+	app.Use(middleware.APIVersioning(cfg.API.LegacySunset))
+	app.Use(middleware.ReplicaReads())
 	app.Use(recover.New(recover.Config{EnableStackTrace: true}))
-	app.Use(middleware.CORS(cfg.Server.FrontendURL))
+	app.Use(middleware.CORS(cfg.CORS))
+	app.Use(middleware.Tenant(db, cfg.Tenancy))
 	app.Use(middleware.RequestLogger())
 	app.Use(middleware.SecurityLogger())
-	app.Use(middleware.SmallBodyLimitForNonUploadRoutes(8 * 1024 * 1024))
+	app.Use(middleware.BodyLimit(cfg.BodyLimits, settingsService.MaxUploadBytes))
 
 	app.Get("/health", func(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok"})
 	})
 
 	api := app.Group("/api")
-	api.Get("/version", GetVersion)
+	adminIP := middleware.IPPolicy(settingsService, services.IPScopeAdmin)
+	api.Get("/version", versionHandler.Get)
 
 	authRoutes := api.Group("/auth")
 	authRoutes.Post("/register", authHandler.Register)
 	authRoutes.Post("/login", authHandler.Login)
 	authRoutes.Get("/me", authMiddleware.RequireAuth, authHandler.Me)
 	authRoutes.Put("/me", authMiddleware.RequireAuth, authHandler.UpdateMe)
+	authRoutes.Put("/me/avatar", authMiddleware.RequireAuth, authHandler.UploadAvatar)
+	authRoutes.Delete("/me/avatar", authMiddleware.RequireAuth, authHandler.DeleteAvatar)
+	authRoutes.Get("/terms", authMiddleware.RequireAuth, termsHandler.Mine)
+	authRoutes.Post("/terms/:id/accept", authMiddleware.RequireAuth, termsHandler.Accept)
 	authRoutes.Put("/password", authMiddleware.RequireAuth, authHandler.ChangePassword)
+	authRoutes.Get("/devices", authMiddleware.RequireAuth, devicesHandler.List)
+	authRoutes.Delete("/devices/:id", authMiddleware.RequireAuth, devicesHandler.Revoke)
+	authRoutes.Get("/me/keys", authMiddleware.RequireAuth, vaultsHandler.ListKeys)
+	authRoutes.Post("/me/keys", authMiddleware.RequireAuth, vaultsHandler.RegisterKey)
+	authRoutes.Delete("/me/keys/:id", authMiddleware.RequireAuth, vaultsHandler.DeleteKey)
+	authRoutes.Post("/me/calendar-feed", authMiddleware.RequireAuth, filesHandler.IssueCalendarFeed)
+	authRoutes.Delete("/me/calendar-feed", authMiddleware.RequireAuth, filesHandler.RevokeCalendarFeed)
 
 	api.Get("/users/search", authMiddleware.RequireAuth, usersHandler.Search)
-
-	userRoutes := api.Group("/users", authMiddleware.RequireAuth, middleware.AdminOnly)
-	userRoutes.Get("/", usersHandler.List)
-	userRoutes.Get("/:id", usersHandler.Get)
-	userRoutes.Put("/:id", usersHandler.Update)
-	userRoutes.Delete("/:id", usersHandler.Delete)
-
-	groupRoutes := api.Group("/groups", authMiddleware.RequireAuth)
+	api.Get("/properties", authMiddleware.RequireAuth, propertiesHandler.List)
+	api.Get("/users/:id/keys", authMiddleware.RequireAuth, vaultsHandler.UserKeys)
+
+	// Admin routes admit every administrative role; each route then
+	// requires the permission it needs.
+	canReadUsers := middleware.RequirePermission(services.PermissionUsersRead)
+	canManageUsers := middleware.RequirePermission(services.PermissionUsersManage)
+	canReadAudit := middleware.RequirePermission(services.PermissionAuditRead)
+	canManageStorage := middleware.RequirePermission(services.PermissionStorageManage)
+	canManageJobs := middleware.RequirePermission(services.PermissionJobsManage)
+	canModerate := middleware.RequirePermission(services.PermissionModeration)
+	canManageSettings := middleware.RequirePermission(services.PermissionSettings)
+
+	userRoutes := api.Group("/users", adminIP, authMiddleware.RequireAuth, middleware.AdminAccess, idempotent)
+	userRoutes.Get("/", canReadUsers, usersHandler.List)
+	userRoutes.Get("/:id", canReadUsers, usersHandler.Get)
+	userRoutes.Put("/:id", canManageUsers, usersHandler.Update)
+	userRoutes.Delete("/:id", canManageUsers, usersHandler.Delete)
+	userRoutes.Post("/:id/suspend", canManageUsers, usersHandler.Suspend)
+	userRoutes.Post("/:id/reactivate", canManageUsers, usersHandler.Reactivate)
+
+	api.Get("/organizations/current", authMiddleware.RequireAuth, organizationsHandler.Current)
+
+	orgRoutes := api.Group("/organizations", adminIP, authMiddleware.RequireAuth, middleware.AdminOnly, middleware.PlatformAdminOnly, idempotent)
+	orgRoutes.Get("/", organizationsHandler.List)
+	orgRoutes.Post("/", organizationsHandler.Create)
+	orgRoutes.Get("/:id", organizationsHandler.Get)
+	orgRoutes.Put("/:id", organizationsHandler.Update)
+	orgRoutes.Delete("/:id", organizationsHandler.Delete)
+
+	jobRoutes := api.Group("/jobs", adminIP, authMiddleware.RequireAuth, middleware.AdminAccess, middleware.PlatformAdminOnly, canManageJobs, idempotent)
+	jobRoutes.Get("/", jobsHandler.List)
+	jobRoutes.Get("/:id", jobsHandler.Get)
+	jobRoutes.Post("/:id/retry", jobsHandler.Retry)
+
+	adminRoutes := api.Group("/admin", adminIP, authMiddleware.RequireAuth, middleware.AdminAccess, middleware.PlatformAdminOnly, idempotent)
+	adminRoutes.Get("/settings", canManageSettings, settingsHandler.List)
+	adminRoutes.Put("/settings", canManageSettings, settingsHandler.Update)
+	adminRoutes.Get("/signing-keys", canManageSettings, signingKeysHandler.List)
+	adminRoutes.Post("/signing-keys", canManageSettings, signingKeysHandler.Create)
+	adminRoutes.Post("/signing-keys/:kid/retire", canManageSettings, signingKeysHandler.Retire)
+	adminRoutes.Get("/terms", canManageSettings, termsHandler.List)
+	adminRoutes.Post("/terms", canManageSettings, termsHandler.Publish)
+	adminRoutes.Post("/terms/:id/retire", canManageSettings, termsHandler.Retire)
+	adminRoutes.Get("/terms/:id/acceptances", canManageSettings, termsHandler.Acceptances)
+	adminRoutes.Get("/classification-rules", canManageSettings, classificationRulesHandler.List)
+	adminRoutes.Post("/classification-rules", canManageSettings, classificationRulesHandler.Create)
+	adminRoutes.Post("/classification-rules/simulate", canManageSettings, classificationRulesHandler.Simulate)
+	adminRoutes.Put("/classification-rules/:id", canManageSettings, classificationRulesHandler.Update)
+	adminRoutes.Delete("/classification-rules/:id", canManageSettings, classificationRulesHandler.Delete)
+	adminRoutes.Post("/properties", canManageSettings, propertiesHandler.Create)
+	adminRoutes.Put("/properties/:id", canManageSettings, propertiesHandler.Update)
+	adminRoutes.Delete("/properties/:id", canManageSettings, propertiesHandler.Delete)
+	adminRoutes.Get("/legal-exports", canManageSettings, legalExportsHandler.List)
+	adminRoutes.Post("/legal-exports", canManageSettings, legalExportsHandler.Start)
+	adminRoutes.Get("/legal-exports/:id", canManageSettings, legalExportsHandler.Get)
+	adminRoutes.Delete("/legal-exports/:id", canManageSettings, legalExportsHandler.Delete)
+	adminRoutes.Post("/legal-exports/:id/link", canManageSettings, legalExportsHandler.Link)
+	api.Get("/legal-exports/download/:token", adminIP, legalExportsHandler.Download)
+	adminRoutes.Get("/reports", canModerate, moderationHandler.ListReports)
+	adminRoutes.Get("/reports/:id", canModerate, moderationHandler.GetReport)
+	adminRoutes.Put("/reports/:id", canModerate, moderationHandler.UpdateReport)
+	adminRoutes.Post("/reports/:id/actions", canModerate, moderationHandler.ActOnReport)
+	adminRoutes.Delete("/files/:id/quarantine", canModerate, moderationHandler.ReleaseFile)
+	adminRoutes.Get("/share-controls", canManageSettings, sharesHandler.ListShareControls)
+	adminRoutes.Put("/files/:id/share-control", canManageSettings, sharesHandler.PutShareControl)
+	adminRoutes.Delete("/files/:id/share-control", canManageSettings, sharesHandler.DeleteShareControl)
+	adminRoutes.Get("/conversions", canManageStorage, conversionsHandler.Stats)
+	adminRoutes.Get("/database", canManageStorage, databaseHandler.Stats)
+	adminRoutes.Post("/storage/reconcile", canManageStorage, storageHandler.StartReconcile)
+	adminRoutes.Get("/storage/reconcile", canManageStorage, storageHandler.ListReconciles)
+	adminRoutes.Get("/storage/reconcile/:id", canManageStorage, storageHandler.GetReconcile)
+	adminRoutes.Post("/integrity-checks", canManageStorage, integrityHandler.Start)
+	adminRoutes.Get("/integrity-checks", canManageStorage, integrityHandler.List)
+	adminRoutes.Get("/integrity-checks/:id", canManageStorage, integrityHandler.Get)
+	adminRoutes.Get("/storage/mirror", canManageStorage, storageHandler.MirrorStatus)
+	adminRoutes.Get("/storage/regions", canManageStorage, storageHandler.RegionStatus)
+	adminRoutes.Post("/storage/mirror/backfill", canManageStorage, storageHandler.StartMirrorBackfill)
+	adminRoutes.Post("/storage/rollups/rebuild", canManageStorage, storageHandler.StartRollupRebuild)
+	adminRoutes.Post("/imports", canManageStorage, importsHandler.Start)
+	adminRoutes.Get("/imports", canManageStorage, importsHandler.List)
+	adminRoutes.Get("/imports/:id", canManageStorage, importsHandler.Get)
+	adminRoutes.Post("/imports/:id/cancel", canManageStorage, importsHandler.Cancel)
+	adminRoutes.Post("/imports/:id/resume", canManageStorage, importsHandler.Resume)
+	adminRoutes.Get("/audit-log", canReadAudit, auditHandler.ListAll)
+	adminRoutes.Get("/audit-log/retention", canReadAudit, auditHandler.RetentionStatus)
+	adminRoutes.Get("/effective-access", canReadAudit, effectiveAccessHandler.Organization)
+
+	api.Get("/integrations/import/google/callback", integrationsHandler.GoogleCallback)
+	integrationRoutes := api.Group("/integrations/import", authMiddleware.RequireAuth, idempotent)
+	integrationRoutes.Get("/connections", integrationsHandler.Connections)
+	integrationRoutes.Delete("/connections/:id", integrationsHandler.Disconnect)
+	integrationRoutes.Get("/connections/:id/browse", integrationsHandler.Browse)
+	integrationRoutes.Post("/google/connect", integrationsHandler.ConnectGoogle)
+	integrationRoutes.Post("/webdav/connect", integrationsHandler.ConnectWebDAV)
+	integrationRoutes.Post("/", integrationsHandler.Start)
+	integrationRoutes.Get("/", integrationsHandler.List)
+	integrationRoutes.Get("/:id", integrationsHandler.Get)
+	integrationRoutes.Post("/:id/cancel", integrationsHandler.Cancel)
+	integrationRoutes.Post("/:id/resume", integrationsHandler.Resume)
+
+	groupRoutes := api.Group("/groups", authMiddleware.RequireAuth, idempotent)
 	groupRoutes.Post("/", groupsHandler.Create)
 	groupRoutes.Get("/", groupsHandler.List)
 	groupRoutes.Get("/:id", groupsHandler.Get)
 	groupRoutes.Put("/:id", groupsHandler.Update)
 	groupRoutes.Delete("/:id", groupsHandler.Delete)
 	groupRoutes.Post("/:id/members", groupsHandler.AddMember)
+	groupRoutes.Post("/:id/members/import", groupsHandler.ImportMembers)
 	groupRoutes.Delete("/:id/members/:userId", groupsHandler.RemoveMember)
 	groupRoutes.Put("/:id/members/:userId", groupsHandler.UpdateMemberRole)
+	groupRoutes.Put("/:id/download-limit", adminIP, middleware.AdminOnly, groupsHandler.SetDownloadLimit)
+	groupRoutes.Put("/:id/quota", adminIP, middleware.AdminOnly, groupsHandler.SetQuota)
+	groupRoutes.Get("/:id/usage", groupsHandler.Usage)
 
 	api.Get("/files/:id/proxy", filesHandler.ProxyPreview)
+	// Calendar apps fetch the feed without a session; its token stands in
+	// for one.
+	api.Get("/calendar/:token", filesHandler.CalendarFeed)
+
+	api.Use("/public", middleware.IPPolicy(settingsService, services.IPScopePublic))
+	api.Get("/public/manifest-key", filesHandler.ManifestKey)
 
 	publicFileRoutes := api.Group("/public/files", authMiddleware.OptionalAuth)
 	publicFileRoutes.Get("/:id", filesHandler.PublicGet)
 	publicFileRoutes.Get("/:id/download", filesHandler.PublicDownload)
 	publicFileRoutes.Get("/:id/children", filesHandler.PublicChildren)
-
-	fileRoutes := api.Group("/files", authMiddleware.RequireAuth)
+	publicFileRoutes.Get("/:id/preview-html", filesHandler.PublicPreviewHTML)
+	publicFileRoutes.Get("/:id/pages", filesHandler.Pages)
+	publicFileRoutes.Get("/:id/pages/:page", filesHandler.Page)
+	publicFileRoutes.Get("/:id/pages/:page/tiles/:row/:col", filesHandler.Tile)
+	publicFileRoutes.Get("/:id/meta", sharesHandler.PublicMeta)
+	publicFileRoutes.Post("/:id/report", moderationHandler.Report)
+	publicFileRoutes.Post("/:id/password/unlock", filesHandler.UnlockPassword)
+
+	publicLinkRoutes := api.Group("/public/links", authMiddleware.OptionalAuth)
+	publicLinkRoutes.Get("/:slug", filesHandler.PublicLinkGet)
+	publicLinkRoutes.Get("/:slug/path/*", filesHandler.PublicLinkGet)
+	publicLinkRoutes.Get("/:slug/children/*", filesHandler.PublicLinkChildren)
+	publicLinkRoutes.Get("/:slug/download/*", filesHandler.PublicLinkDownload)
+
+	publicTransferRoutes := api.Group("/public/transfers")
+	publicTransferRoutes.Post("/:code/connect", transfersHandler.AnonymousConnect)
+	publicTransferRoutes.Get("/:code", transfersHandler.AnonymousGet)
+	publicTransferRoutes.Get("/:code/download", transfersHandler.AnonymousDownload)
+	publicTransferRoutes.Post("/:code/complete", transfersHandler.AnonymousComplete)
+
+	api.Get("/public/avatars/:userID/:version/:size", authHandler.Avatar)
+
+	api.Options("/tus", TusResumable, filesHandler.TusOptions)
+	tusRoutes := api.Group("/tus", TusResumable, authMiddleware.RequireAuth)
+	tusRoutes.Post("/", filesHandler.TusCreate)
+	tusRoutes.Head("/:id", filesHandler.TusHead)
+	tusRoutes.Patch("/:id", filesHandler.TusPatch)
+	tusRoutes.Delete("/:id", filesHandler.TusDelete)
+
+	fileRoutes := api.Group("/files", authMiddleware.RequireAuth, idempotent)
 	fileRoutes.Post("/upload", filesHandler.Upload)
 	fileRoutes.Post("/upload/presign", filesHandler.PresignUpload)
 	fileRoutes.Post("/upload/finalize", filesHandler.FinalizeUpload)
+	fileRoutes.Get("/uploads/:id/progress", filesHandler.UploadProgress)
+	fileRoutes.Get("/extractions/:id", filesHandler.Extraction)
+	fileRoutes.Post("/archive", filesHandler.CreateArchive)
+	fileRoutes.Get("/archives/:id", filesHandler.ArchiveBuild)
 	fileRoutes.Post("/directory", filesHandler.CreateDirectory)
 	fileRoutes.Get("/", filesHandler.ListRoot)
 	fileRoutes.Get("/search", filesHandler.Search)
+	fileRoutes.Get("/upcoming", filesHandler.Upcoming)
+	fileRoutes.Get("/duplicates", filesHandler.Duplicates)
+	fileRoutes.Post("/duplicates/resolve", filesHandler.ResolveDuplicates)
+	fileRoutes.Get("/notify", notifyHandler.Notify)
 	fileRoutes.Get("/:id/children", filesHandler.ListChildren)
+	fileRoutes.Get("/:id/content", filesHandler.GetContent)
+	fileRoutes.Put("/:id/content", filesHandler.SaveContent)
+	fileRoutes.Put("/:id/binary", filesHandler.SaveBinary)
 	fileRoutes.Get("/:id/download", filesHandler.Download)
 	fileRoutes.Get("/:id/download-url", filesHandler.DownloadURL)
 	fileRoutes.Get("/:id/preview", filesHandler.PreviewURL)
+	fileRoutes.Get("/:id/pages", filesHandler.Pages)
+	fileRoutes.Get("/:id/pages/:page", filesHandler.Page)
+	fileRoutes.Get("/:id/pages/:page/tiles/:row/:col", filesHandler.Tile)
 	fileRoutes.Get("/:id/convert-preview", filesHandler.ConvertPreview)
 	fileRoutes.Get("/:id/preview-status", filesHandler.PreviewStatus)
+	fileRoutes.Get("/:id/preview-html", filesHandler.PreviewHTML)
+	fileRoutes.Get("/:id/archive-contents", filesHandler.ListArchive)
+	fileRoutes.Get("/:id/archive-contents/entry", filesHandler.ArchiveEntry)
+	fileRoutes.Post("/:id/extract", filesHandler.Extract)
 	fileRoutes.Get("/:id/retry-preview", filesHandler.RetryPreview)
+	fileRoutes.Get("/:id/vault", vaultsHandler.Get)
+	fileRoutes.Post("/:id/vault/keys", vaultsHandler.AddKey)
 	fileRoutes.Get("/:id/path", filesHandler.Path)
+	fileRoutes.Get("/:id/manifest", filesHandler.Manifest)
+	fileRoutes.Get("/:id/diff", filesHandler.Diff)
+	fileRoutes.Get("/:id/analytics", filesHandler.GetAnalytics)
+	fileRoutes.Get("/:id/timeline", filesHandler.Timeline)
+	fileRoutes.Get("/:id/lock", filesHandler.GetLock)
+	fileRoutes.Post("/:id/lock", filesHandler.Lock)
+	fileRoutes.Delete("/:id/lock", filesHandler.Unlock)
+	fileRoutes.Post("/:id/mute", filesHandler.Mute)
+	fileRoutes.Delete("/:id/mute", filesHandler.Unmute)
+	fileRoutes.Get("/:id/properties", filesHandler.GetProperties)
+	fileRoutes.Put("/:id/properties", filesHandler.SetProperties)
+	fileRoutes.Get("/:id/reviews", filesHandler.ListReviews)
+	fileRoutes.Post("/:id/reviews", filesHandler.RequestReview)
+	fileRoutes.Get("/:id/due-date", filesHandler.GetDueDate)
+	fileRoutes.Put("/:id/due-date", filesHandler.SetDueDate)
+	fileRoutes.Delete("/:id/due-date", filesHandler.ClearDueDate)
+	fileRoutes.Put("/:id/password", filesHandler.SetPassword)
+	fileRoutes.Delete("/:id/password", filesHandler.RemovePassword)
+	fileRoutes.Post("/:id/password/unlock", filesHandler.UnlockPassword)
+	fileRoutes.Post("/:id/archive", filesHandler.Archive)
+	fileRoutes.Post("/:id/archive/restore", filesHandler.RestoreArchive)
 	fileRoutes.Post("/:id/share", sharesHandler.ShareFile)
 	fileRoutes.Get("/:id/shares", sharesHandler.ListFileShares)
+	fileRoutes.Get("/:id/effective-access", effectiveAccessHandler.File)
+	fileRoutes.Put("/:id/shares/batch", sharesHandler.BatchUpdateShares)
+	fileRoutes.Delete("/:id/shares", sharesHandler.DeleteShares)
+	fileRoutes.Post("/:id/quick-share", sharesHandler.QuickShare)
+	fileRoutes.Get("/:id/quick-share/qr", sharesHandler.QuickShareQR)
+	fileRoutes.Get("/:id/share-defaults", sharesHandler.GetShareDefaults)
+	fileRoutes.Put("/:id/share-defaults", sharesHandler.PutShareDefaults)
+	fileRoutes.Delete("/:id/share-defaults", sharesHandler.DeleteShareDefaults)
 	fileRoutes.Get("/:id", filesHandler.Get)
 	fileRoutes.Put("/:id", filesHandler.Update)
 	fileRoutes.Delete("/:id", filesHandler.Delete)
 
-	shareRoutes := api.Group("/shares", authMiddleware.RequireAuth)
+	pasteRoutes := api.Group("/pastes", authMiddleware.RequireAuth, idempotent)
+	pasteRoutes.Post("/", filesHandler.CreatePaste)
+	pasteRoutes.Get("/", filesHandler.ListPastes)
+
+	shareRoutes := api.Group("/shares", authMiddleware.RequireAuth, idempotent)
+	shareRoutes.Get("/outgoing", sharesHandler.ListOutgoing)
+	shareRoutes.Get("/approvals", sharesHandler.ListShareApprovals)
+	shareRoutes.Post("/approvals/:id/approve", sharesHandler.ApproveShare)
+	shareRoutes.Post("/approvals/:id/reject", sharesHandler.RejectShare)
+	shareRoutes.Get("/:id/qr", sharesHandler.ShareQR)
 	shareRoutes.Delete("/:id", sharesHandler.DeleteShare)
 	shareRoutes.Put("/:id", sharesHandler.UpdateShare)
 
 	api.Get("/shared", authMiddleware.RequireAuth, sharesHandler.ListSharedWithMe)
+	api.Get("/invitations/:token", sharesHandler.GetInvitation)
 
-	activityRoutes := api.Group("/activities", authMiddleware.RequireAuth)
+	activityRoutes := api.Group("/activities", authMiddleware.RequireAuth, idempotent)
 	activityRoutes.Get("/", activitiesHandler.List)
 	activityRoutes.Get("/unread-count", activitiesHandler.UnreadCount)
 	activityRoutes.Put("/read-all", activitiesHandler.MarkAllRead)
+	activityRoutes.Get("/mutes", activitiesHandler.ListMutes)
+	activityRoutes.Get("/preferences", activitiesHandler.GetPreferences)
+	activityRoutes.Put("/preferences", activitiesHandler.UpdatePreferences)
 	activityRoutes.Put("/:id/read", activitiesHandler.MarkRead)
 
-	tokenRoutes := api.Group("/auth/tokens", authMiddleware.RequireAuth)
+	tokenRoutes := api.Group("/auth/tokens", authMiddleware.RequireAuth, idempotent)
 	tokenRoutes.Post("/", apiTokenHandler.Create)
 	tokenRoutes.Get("/", apiTokenHandler.List)
 	tokenRoutes.Delete("/:id", apiTokenHandler.Revoke)
 
+	hmacKeyRoutes := api.Group("/auth/hmac-keys", authMiddleware.RequireAuth, idempotent)
+	hmacKeyRoutes.Post("/", hmacKeyHandler.Create)
+	hmacKeyRoutes.Get("/", hmacKeyHandler.List)
+	hmacKeyRoutes.Delete("/:id", hmacKeyHandler.Revoke)
+
 	deviceRoutes := api.Group("/auth/device")
 	deviceRoutes.Post("/code", deviceAuthHandler.RequestCode)
 	deviceRoutes.Post("/token", deviceAuthHandler.PollToken)
 	deviceRoutes.Get("/verify", authMiddleware.RequireAuth, deviceAuthHandler.Verify)
 	deviceRoutes.Post("/approve", authMiddleware.RequireAuth, deviceAuthHandler.Approve)
+	deviceRoutes.Post("/deny", authMiddleware.RequireAuth, deviceAuthHandler.Deny)
 
-	auditRoutes := api.Group("/audit-log", authMiddleware.RequireAuth)
+	auditRoutes := api.Group("/audit-log", authMiddleware.RequireAuth, idempotent)
+	auditRoutes.Get("/", auditHandler.ListMyLog)
 	auditRoutes.Get("/export", auditHandler.ExportMyLog)
 
-	transferRoutes := api.Group("/transfers", authMiddleware.RequireAuth)
+	transferRoutes := api.Group("/transfers", authMiddleware.RequireAuth, idempotent)
 	transferRoutes.Post("/", transfersHandler.Create)
 	transferRoutes.Get("/", transfersHandler.List)
 	transferRoutes.Get("/:code", transfersHandler.Get)
+	transferRoutes.Get("/:code/status", transfersHandler.Status)
 	transferRoutes.Post("/:code/connect", transfersHandler.Connect)
 	transferRoutes.Post("/:code/upload", transfersHandler.Upload)
 	transferRoutes.Get("/:code/download", transfersHandler.Download)
 	transferRoutes.Post("/:code/complete", transfersHandler.Complete)
 	transferRoutes.Delete("/:code", transfersHandler.Cancel)
 
+	templateRoutes := api.Group("/templates", authMiddleware.RequireAuth, idempotent)
+	templateRoutes.Get("/", templatesHandler.List)
+	templateRoutes.Post("/", templatesHandler.Create)
+	templateRoutes.Get("/:id", templatesHandler.Get)
+	templateRoutes.Patch("/:id", templatesHandler.Update)
+	templateRoutes.Delete("/:id", templatesHandler.Delete)
+	templateRoutes.Post("/:id/instantiate", templatesHandler.Instantiate)
+
+	reviewRoutes := api.Group("/reviews", authMiddleware.RequireAuth, idempotent)
+	reviewRoutes.Get("/", reviewsHandler.List)
+	reviewRoutes.Post("/:id/approve", reviewsHandler.Approve)
+	reviewRoutes.Post("/:id/reject", reviewsHandler.Reject)
+	reviewRoutes.Post("/:id/cancel", reviewsHandler.Cancel)
+
 	ssoRoutes := api.Group("/auth/sso")
 	ssoRoutes.Get("/providers", ssoHandler.ListProviders)
 	ssoRoutes.Get("/oauth/:provider", ssoHandler.GetLoginRedirect)
 	ssoRoutes.Get("/oauth/:provider/callback", ssoHandler.HandleOAuthCallback)
 	ssoRoutes.Post("/ldap/login", ssoHandler.HandleLDAPLogin)
 
-	ssoProtectedRoutes := api.Group("/auth/sso", authMiddleware.RequireAuth)
+	ssoProtectedRoutes := api.Group("/auth/sso", authMiddleware.RequireAuth, idempotent)
 	ssoProtectedRoutes.Get("/linked-accounts", ssoHandler.GetLinkedAccounts)
 	ssoProtectedRoutes.Delete("/linked-accounts/:id", ssoHandler.UnlinkAccount)
 
+	ssoProviderRoutes := api.Group("/sso-providers", adminIP, authMiddleware.RequireAuth, middleware.AdminOnly, idempotent)
+	ssoProviderRoutes.Get("/", ssoHandler.ListConfiguredProviders)
+	ssoProviderRoutes.Post("/", ssoHandler.CreateProvider)
+	ssoProviderRoutes.Get("/:id", ssoHandler.GetConfiguredProvider)
+	ssoProviderRoutes.Put("/:id", ssoHandler.UpdateProvider)
+	ssoProviderRoutes.Delete("/:id", ssoHandler.DeleteProvider)
+
 	mfaRoutes := api.Group("/auth/mfa")
 	mfaRoutes.Get("/status", authMiddleware.RequireAuth, mfaHandler.Status)
 	mfaRoutes.Post("/totp/setup", authMiddleware.RequireAuth, mfaHandler.TOTPSetup)
@@ -236,8 +821,21 @@ func setupTestEnv(t *testing.T) *testEnv {
 	mfaRoutes.Post("/verify/totp", mfaHandler.VerifyTOTP)
 	mfaRoutes.Post("/verify/recovery", mfaHandler.VerifyRecovery)
 	mfaRoutes.Post("/recovery/regenerate", authMiddleware.RequireAuth, mfaHandler.RegenerateRecovery)
+	mfaRoutes.Get("/recovery/status", authMiddleware.RequireAuth, mfaHandler.RecoveryStatus)
+	mfaRoutes.Get("/recovery/download", authMiddleware.RequireAuth, mfaHandler.DownloadRecovery)
+
+	passkeyRoutes := api.Group("/auth/passkey")
+	passkeyRoutes.Post("/register/begin", authMiddleware.RequireAuth, webAuthnHandler.RegisterBegin)
+	passkeyRoutes.Post("/register/finish", authMiddleware.RequireAuth, webAuthnHandler.RegisterFinish)
+	passkeyRoutes.Post("/login/begin", webAuthnHandler.LoginBegin)
+	passkeyRoutes.Post("/login/finish", webAuthnHandler.LoginFinish)
+
+	passkeysRoutes := api.Group("/auth/passkeys", authMiddleware.RequireAuth, idempotent)
+	passkeysRoutes.Get("/", webAuthnHandler.List)
+	passkeysRoutes.Put("/:id", webAuthnHandler.Rename)
+	passkeysRoutes.Delete("/:id", webAuthnHandler.Delete)
 
-	return &testEnv{app: app, db: db}
+	return &testEnv{app: app, db: db, jobs: jobRunner, uploads: uploadStore}
 }
 
 func createTestUser(t *testing.T, db *gorm.DB, email, password string, role models.UserRole) (*models.User, string) {
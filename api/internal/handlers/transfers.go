@@ -3,12 +3,15 @@ package handlers
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/docshare/api/internal/middleware"
 	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
 	"github.com/docshare/api/pkg/logger"
 	"github.com/docshare/api/pkg/utils"
 	"github.com/gofiber/fiber/v2"
@@ -17,11 +20,20 @@ import (
 
 type TransfersHandler struct {
 	DB             *gorm.DB
+	UploadPolicy   *services.UploadPolicy
 	DefaultTimeout int
+	// Relay stores uploaded chunks for the receiver and scans them; without
+	// it uploads are acknowledged but not kept.
+	Relay *services.TransferRelay
+	// Access checks the folder a recipient saves a transfer into.
+	Access *services.AccessService
+	// Links lets senders offer a transfer to someone without an account.
+	Links *services.TransferLinks
+	Audit *services.AuditService
 }
 
-func NewTransfersHandler(db *gorm.DB, defaultTimeout int) *TransfersHandler {
-	return &TransfersHandler{DB: db, DefaultTimeout: defaultTimeout}
+func NewTransfersHandler(db *gorm.DB, uploadPolicy *services.UploadPolicy, defaultTimeout int) *TransfersHandler {
+	return &TransfersHandler{DB: db, UploadPolicy: uploadPolicy, DefaultTimeout: defaultTimeout}
 }
 
 func generateTransferCode(length int) (string, error) {
@@ -35,18 +47,22 @@ func generateTransferCode(length int) (string, error) {
 type createTransferRequest struct {
 	FileName string `json:"fileName"`
 	FileSize int64  `json:"fileSize"`
+	MimeType string `json:"mimeType,omitempty"`
 	Timeout  *int   `json:"timeout,omitempty"`
+	// AllowAnonymous returns a receive link and PIN that work without an
+	// account.
+	AllowAnonymous bool `json:"allowAnonymous,omitempty"`
 }
 
 func (h *TransfersHandler) Create(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var req createTransferRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	if req.FileName == "" {
@@ -55,6 +71,18 @@ func (h *TransfersHandler) Create(c *fiber.Ctx) error {
 	if req.FileSize <= 0 {
 		return utils.Error(c, fiber.StatusBadRequest, "fileSize must be positive")
 	}
+	mimeType := resolveMimeType(req.FileName, req.MimeType)
+	if err := h.UploadPolicy.Check(req.FileName, mimeType, ""); err != nil {
+		logger.WarnWithUser(currentUser.ID.String(), "upload_type_rejected", map[string]interface{}{
+			"file_name": req.FileName,
+			"reason":    err.Error(),
+		})
+		return utils.Fail(c, errFileTypeNotAllowed.WithMessage(err.Error()))
+	}
+
+	if req.AllowAnonymous && h.Links == nil {
+		return utils.Error(c, fiber.StatusBadRequest, "anonymous transfers are not available")
+	}
 
 	code, err := generateTransferCode(6)
 	if err != nil {
@@ -71,6 +99,7 @@ func (h *TransfersHandler) Create(c *fiber.Ctx) error {
 		SenderID:  currentUser.ID,
 		FileName:  req.FileName,
 		FileSize:  req.FileSize,
+		MimeType:  mimeType,
 		Status:    models.TransferStatusPending,
 		Timeout:   timeout,
 		ExpiresAt: time.Now().Add(time.Duration(timeout) * time.Second),
@@ -81,24 +110,36 @@ func (h *TransfersHandler) Create(c *fiber.Ctx) error {
 	}
 
 	logger.InfoWithUser(currentUser.ID.String(), "transfer_created", map[string]interface{}{
-		"transfer_id": transfer.ID.String(),
-		"code":        code,
-		"file_name":   req.FileName,
-		"file_size":   req.FileSize,
+		"transfer_id":     transfer.ID.String(),
+		"code":            code,
+		"file_name":       req.FileName,
+		"file_size":       req.FileSize,
+		"idempotency_key": middleware.GetIdempotencyKey(c),
+		"anonymous":       req.AllowAnonymous,
 	})
 
-	return utils.Success(c, fiber.StatusCreated, fiber.Map{
+	response := fiber.Map{
 		"code":      code,
 		"fileName":  transfer.FileName,
 		"fileSize":  transfer.FileSize,
 		"expiresAt": transfer.ExpiresAt,
-	})
+	}
+	if req.AllowAnonymous {
+		receiveURL, pin, err := h.Links.Issue(c.UserContext(), &transfer)
+		if err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed creating receive link")
+		}
+		response["receiveURL"] = receiveURL
+		response["pin"] = pin
+	}
+
+	return utils.Success(c, fiber.StatusCreated, response)
 }
 
 func (h *TransfersHandler) Get(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	code := c.Params("code")
@@ -109,13 +150,13 @@ func (h *TransfersHandler) Get(c *fiber.Ctx) error {
 	var transfer models.Transfer
 	if err := h.DB.Preload("Sender").First(&transfer, "code = ?", code).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "transfer not found")
+			return utils.Fail(c, errTransferNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading transfer")
+		return utils.Fail(c, errLoadingTransfer)
 	}
 
 	if transfer.Status == models.TransferStatusExpired {
-		return utils.Error(c, fiber.StatusGone, "transfer has expired")
+		return utils.Fail(c, errTransferExpired)
 	}
 	if transfer.Status == models.TransferStatusCancelled {
 		return utils.Error(c, fiber.StatusGone, "transfer was cancelled")
@@ -123,6 +164,12 @@ func (h *TransfersHandler) Get(c *fiber.Ctx) error {
 	if transfer.Status == models.TransferStatusCompleted {
 		return utils.Error(c, fiber.StatusGone, "transfer already completed")
 	}
+	if transfer.Status == models.TransferStatusBlocked {
+		return utils.Fail(c, errTransferBlocked)
+	}
+	if transfer.Status == models.TransferStatusFailed {
+		return utils.Fail(c, errTransferFailed)
+	}
 
 	senderPolling := transfer.SenderID == currentUser.ID
 	receiverPolling := transfer.RecipientID != nil && *transfer.RecipientID == currentUser.ID
@@ -138,6 +185,7 @@ func (h *TransfersHandler) Get(c *fiber.Ctx) error {
 			"fileName":    transfer.FileName,
 			"fileSize":    transfer.FileSize,
 			"recipientID": transfer.RecipientID,
+			"recipientIP": transfer.RecipientIP,
 		})
 	}
 
@@ -153,7 +201,7 @@ func (h *TransfersHandler) Get(c *fiber.Ctx) error {
 func (h *TransfersHandler) Connect(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	code := c.Params("code")
@@ -161,17 +209,22 @@ func (h *TransfersHandler) Connect(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusBadRequest, "code is required")
 	}
 
+	// Transfer codes only pair accounts of the same tenant; codes from
+	// other organizations look like codes that do not exist.
 	var transfer models.Transfer
-	if err := h.DB.First(&transfer, "code = ?", code).Error; err != nil {
+	if err := h.DB.
+		Joins("JOIN users ON users.id = transfers.sender_id").
+		Scopes(services.OrganizationScope("users", currentUser.OrganizationID)).
+		First(&transfer, "transfers.code = ?", code).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "transfer not found")
+			return utils.Fail(c, errTransferNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading transfer")
+		return utils.Fail(c, errLoadingTransfer)
 	}
 
 	if time.Now().After(transfer.ExpiresAt) {
 		h.DB.Model(&transfer).Update("status", models.TransferStatusExpired)
-		return utils.Error(c, fiber.StatusGone, "transfer has expired")
+		return utils.Fail(c, errTransferExpired)
 	}
 
 	if transfer.Status != models.TransferStatusPending {
@@ -205,7 +258,7 @@ func (h *TransfersHandler) Connect(c *fiber.Ctx) error {
 func (h *TransfersHandler) Upload(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	code := c.Params("code")
@@ -216,9 +269,9 @@ func (h *TransfersHandler) Upload(c *fiber.Ctx) error {
 	var transfer models.Transfer
 	if err := h.DB.First(&transfer, "code = ?", code).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "transfer not found")
+			return utils.Fail(c, errTransferNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading transfer")
+		return utils.Fail(c, errLoadingTransfer)
 	}
 
 	if transfer.SenderID != currentUser.ID {
@@ -237,6 +290,42 @@ func (h *TransfersHandler) Upload(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusBadRequest, "Content-Length required")
 	}
 
+	// Only the first chunk starts with the file's magic bytes.
+	if chunkIndex == "" || chunkIndex == "0" {
+		detected := services.DetectContentType(c.Body())
+		if err := h.UploadPolicy.Check(transfer.FileName, transfer.MimeType, detected); err != nil {
+			h.DB.Model(&transfer).Update("status", models.TransferStatusCancelled)
+			logger.WarnWithUser(currentUser.ID.String(), "upload_type_rejected", map[string]interface{}{
+				"transfer_id": transfer.ID.String(),
+				"file_name":   transfer.FileName,
+				"reason":      err.Error(),
+			})
+			return utils.Fail(c, errFileTypeNotAllowed.WithMessage(err.Error()))
+		}
+		if err := h.DB.Model(&transfer).Update("detected_mime_type", detected).Error; err != nil {
+			return utils.Error(c, fiber.StatusInternalServerError, "failed updating transfer")
+		}
+	}
+
+	if h.Relay != nil {
+		// A body sent without chunk headers is the whole file.
+		index, total := 0, 1
+		var err error
+		if chunkIndex != "" {
+			if index, err = strconv.Atoi(chunkIndex); err != nil {
+				return utils.Error(c, fiber.StatusBadRequest, "X-Chunk-Index must be a number")
+			}
+		}
+		if chunkTotal != "" {
+			if total, err = strconv.Atoi(chunkTotal); err != nil {
+				return utils.Error(c, fiber.StatusBadRequest, "X-Chunk-Total must be a number")
+			}
+		}
+		if err := h.Relay.StoreChunk(c.UserContext(), &transfer, index, total, c.Body()); err != nil {
+			return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "transfer_upload_failed", "failed storing chunk")))
+		}
+	}
+
 	logger.InfoWithUser(currentUser.ID.String(), "transfer_chunk_received", map[string]interface{}{
 		"transfer_id": transfer.ID.String(),
 		"code":        code,
@@ -251,7 +340,7 @@ func (h *TransfersHandler) Upload(c *fiber.Ctx) error {
 func (h *TransfersHandler) Download(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	code := c.Params("code")
@@ -262,37 +351,115 @@ func (h *TransfersHandler) Download(c *fiber.Ctx) error {
 	var transfer models.Transfer
 	if err := h.DB.First(&transfer, "code = ?", code).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "transfer not found")
+			return utils.Fail(c, errTransferNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading transfer")
+		return utils.Fail(c, errLoadingTransfer)
 	}
 
 	if transfer.RecipientID == nil || *transfer.RecipientID != currentUser.ID {
 		return utils.Error(c, fiber.StatusForbidden, "not the recipient")
 	}
 
-	if transfer.Status != models.TransferStatusActive {
-		return utils.Error(c, fiber.StatusBadRequest, "transfer not active")
-	}
-
 	logger.InfoWithUser(currentUser.ID.String(), "transfer_download_started", map[string]interface{}{
 		"transfer_id": transfer.ID.String(),
 		"code":        code,
 		"file_name":   transfer.FileName,
 	})
 
+	return h.send(c, &transfer)
+}
+
+// send streams a transfer's file to its recipient once the relay has
+// released it.
+func (h *TransfersHandler) send(c *fiber.Ctx, transfer *models.Transfer) error {
+	if h.Relay != nil {
+		switch transfer.Status {
+		case models.TransferStatusReady:
+		case models.TransferStatusScanning:
+			return utils.Fail(c, errTransferScanning)
+		case models.TransferStatusBlocked:
+			return utils.Fail(c, errTransferBlocked)
+		case models.TransferStatusFailed:
+			return utils.Fail(c, errTransferFailed)
+		case models.TransferStatusActive:
+			return utils.Error(c, fiber.StatusConflict, "sender has not finished uploading")
+		default:
+			return utils.Error(c, fiber.StatusBadRequest, "transfer not active")
+		}
+	} else if transfer.Status != models.TransferStatusActive {
+		return utils.Error(c, fiber.StatusBadRequest, "transfer not active")
+	}
+
 	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", transfer.FileName))
 	c.Set("Content-Length", fmt.Sprintf("%d", transfer.FileSize))
 	c.Set("X-Filename", transfer.FileName)
 	c.Set("X-FileSize", fmt.Sprintf("%d", transfer.FileSize))
 
-	return c.Status(fiber.StatusOK).SendString("")
+	if h.Relay == nil {
+		return c.Status(fiber.StatusOK).SendString("")
+	}
+	data, err := h.Relay.Open(c.UserContext(), transfer)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed reading transfer")
+	}
+	return c.Status(fiber.StatusOK).SendStream(data, int(transfer.FileSize))
+}
+
+type completeTransferRequest struct {
+	// Checksum is the hex SHA-256 of the whole file.
+	Checksum string `json:"checksum"`
+	// Save has the recipient keep the file in their own files, in
+	// ParentID or their root, instead of downloading it.
+	Save     bool   `json:"save"`
+	ParentID string `json:"parentID"`
+}
+
+// Status reports which chunks of an upload the relay holds, so a sender
+// that dropped can send only the missing ones.
+func (h *TransfersHandler) Status(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	code := c.Params("code")
+	var transfer models.Transfer
+	if err := h.DB.First(&transfer, "code = ?", code).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utils.Fail(c, errTransferNotFound)
+		}
+		return utils.Fail(c, errLoadingTransfer)
+	}
+
+	if transfer.SenderID != currentUser.ID && (transfer.RecipientID == nil || *transfer.RecipientID != currentUser.ID) {
+		return utils.Error(c, fiber.StatusForbidden, "not authorized for this transfer")
+	}
+
+	progress := services.TransferProgress{ChunkTotal: transfer.ChunkTotal, Missing: []services.ChunkRange{}}
+	if h.Relay != nil {
+		var err error
+		if progress, err = h.Relay.Progress(c.UserContext(), &transfer); err != nil {
+			return utils.Fail(c, errLoadingTransfer)
+		}
+	}
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{
+		"status":         string(transfer.Status),
+		"code":           transfer.Code,
+		"fileSize":       transfer.FileSize,
+		"chunkTotal":     progress.ChunkTotal,
+		"receivedChunks": progress.ReceivedChunks,
+		"receivedBytes":  progress.ReceivedBytes,
+		"missing":        progress.Missing,
+		"checksum":       transfer.Checksum,
+		"expiresAt":      transfer.ExpiresAt,
+	})
 }
 
 func (h *TransfersHandler) Complete(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	code := c.Params("code")
@@ -303,18 +470,51 @@ func (h *TransfersHandler) Complete(c *fiber.Ctx) error {
 	var transfer models.Transfer
 	if err := h.DB.First(&transfer, "code = ?", code).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "transfer not found")
+			return utils.Fail(c, errTransferNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading transfer")
+		return utils.Fail(c, errLoadingTransfer)
 	}
 
 	if transfer.SenderID != currentUser.ID && (transfer.RecipientID == nil || *transfer.RecipientID != currentUser.ID) {
 		return utils.Error(c, fiber.StatusForbidden, "not authorized")
 	}
 
+	var req completeTransferRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return utils.Fail(c, errInvalidBody)
+		}
+	}
+
+	if req.Save {
+		return h.save(c, currentUser, &transfer, req.ParentID)
+	}
+
+	// The sender finishing an upload hands the file to the relay; the
+	// transfer is completed when the receiver has it.
+	if h.Relay != nil && transfer.SenderID == currentUser.ID && transfer.Status == models.TransferStatusActive && transfer.ChunkTotal > 0 {
+		if req.Checksum == "" {
+			return utils.Error(c, fiber.StatusBadRequest, "checksum is required")
+		}
+		if err := h.Relay.Seal(c.UserContext(), &transfer, req.Checksum); err != nil {
+			apiErr := serviceError(err, utils.NewError(fiber.StatusInternalServerError, "transfer_seal_failed", "failed finishing upload"))
+			if errors.Is(err, services.ErrTransferIncomplete) {
+				apiErr = apiErr.WithMessage(err.Error())
+			}
+			return utils.Fail(c, apiErr)
+		}
+		logger.InfoWithUser(currentUser.ID.String(), "transfer_uploaded", map[string]interface{}{
+			"transfer_id": transfer.ID.String(),
+			"code":        code,
+			"status":      string(transfer.Status),
+		})
+		return utils.Success(c, fiber.StatusOK, fiber.Map{"status": string(transfer.Status)})
+	}
+
 	if err := h.DB.Model(&transfer).Update("status", models.TransferStatusCompleted).Error; err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed completing transfer")
 	}
+	h.discard(c, &transfer)
 
 	logger.InfoWithUser(currentUser.ID.String(), "transfer_completed", map[string]interface{}{
 		"transfer_id": transfer.ID.String(),
@@ -327,7 +527,7 @@ func (h *TransfersHandler) Complete(c *fiber.Ctx) error {
 func (h *TransfersHandler) Cancel(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	code := c.Params("code")
@@ -338,9 +538,9 @@ func (h *TransfersHandler) Cancel(c *fiber.Ctx) error {
 	var transfer models.Transfer
 	if err := h.DB.First(&transfer, "code = ?", code).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "transfer not found")
+			return utils.Fail(c, errTransferNotFound)
 		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed loading transfer")
+		return utils.Fail(c, errLoadingTransfer)
 	}
 
 	if transfer.SenderID != currentUser.ID {
@@ -354,6 +554,7 @@ func (h *TransfersHandler) Cancel(c *fiber.Ctx) error {
 	if err := h.DB.Model(&transfer).Update("status", models.TransferStatusCancelled).Error; err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed cancelling transfer")
 	}
+	h.discard(c, &transfer)
 
 	logger.InfoWithUser(currentUser.ID.String(), "transfer_cancelled", map[string]interface{}{
 		"transfer_id": transfer.ID.String(),
@@ -366,11 +567,11 @@ func (h *TransfersHandler) Cancel(c *fiber.Ctx) error {
 func (h *TransfersHandler) List(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
 	if currentUser == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var transfers []models.Transfer
-	if err := h.DB.Where("sender_id = ? AND status IN ?", currentUser.ID, []string{"pending", "active"}).Find(&transfers).Error; err != nil {
+	if err := h.DB.Where("sender_id = ? AND status IN ?", currentUser.ID, openTransferStatuses).Find(&transfers).Error; err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed listing transfers")
 	}
 
@@ -396,14 +597,84 @@ func (h *TransfersHandler) List(c *fiber.Ctx) error {
 	return utils.Success(c, fiber.StatusOK, items)
 }
 
+// save completes a transfer by landing the file in the recipient's own
+// files, so it never has to pass through their machine.
+func (h *TransfersHandler) save(c *fiber.Ctx, currentUser *models.User, transfer *models.Transfer, rawParentID string) error {
+	if transfer.RecipientID == nil || *transfer.RecipientID != currentUser.ID {
+		return utils.Error(c, fiber.StatusForbidden, "only the recipient can save a transfer")
+	}
+	if h.Relay == nil {
+		return utils.Fail(c, serviceError(services.ErrTransferNotReady, nil))
+	}
+	switch transfer.Status {
+	case models.TransferStatusScanning:
+		return utils.Fail(c, errTransferScanning)
+	case models.TransferStatusBlocked:
+		return utils.Fail(c, errTransferBlocked)
+	case models.TransferStatusFailed:
+		return utils.Fail(c, errTransferFailed)
+	}
+	parentID, apiErr := resolveUploadParent(c, h.DB, h.Access, currentUser, rawParentID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	// The relay holds plaintext, which has no place in a vault.
+	if parentID != nil {
+		var inVault int64
+		if err := h.DB.Model(&models.File{}).Where("id = ? AND vault_id IS NOT NULL", *parentID).Count(&inVault).Error; err != nil {
+			return utils.Fail(c, errLoadingFile)
+		}
+		if inVault > 0 {
+			return utils.Fail(c, errVaultContent)
+		}
+	}
+
+	file, err := h.Relay.Save(c.UserContext(), transfer, currentUser, parentID, services.AuditEntry{
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "transfer_save_failed", "failed saving transfer")))
+	}
+
+	logger.InfoWithUser(currentUser.ID.String(), "transfer_saved", map[string]interface{}{
+		"transfer_id": transfer.ID.String(),
+		"code":        transfer.Code,
+		"file_id":     file.ID.String(),
+	})
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"status": string(transfer.Status), "file": file})
+}
+
+// discard drops the relayed bytes of a transfer that can no longer be
+// downloaded. Failures are left for the relay's periodic purge.
+func (h *TransfersHandler) discard(c *fiber.Ctx, transfer *models.Transfer) {
+	if h.Relay == nil {
+		return
+	}
+	if err := h.Relay.Discard(c.UserContext(), transfer); err != nil {
+		logger.Error("transfer_discard_failed", err, map[string]interface{}{
+			"transfer_id": transfer.ID.String(),
+		})
+	}
+}
+
+// openTransferStatuses are the statuses a transfer expires from.
+var openTransferStatuses = []models.TransferStatus{
+	models.TransferStatusPending,
+	models.TransferStatusActive,
+	models.TransferStatusScanning,
+	models.TransferStatusReady,
+}
+
 func (h *TransfersHandler) CleanupExpired() {
 	h.DB.Model(&models.Transfer{}).
-		Where("status IN ? AND expires_at < ?", []string{"pending", "active"}, time.Now()).
+		Where("status IN ? AND expires_at < ?", openTransferStatuses, time.Now()).
 		Update("status", models.TransferStatusExpired)
 }
 
-func CleanupExpiredTransfers(db *gorm.DB) {
-	db.Model(&models.Transfer{}).
-		Where("status IN ? AND expires_at < ?", []string{"pending", "active"}, time.Now()).
-		Update("status", models.TransferStatusExpired)
+func CleanupExpiredTransfers(db *gorm.DB) error {
+	return db.Model(&models.Transfer{}).
+		Where("status IN ? AND expires_at < ?", openTransferStatuses, time.Now()).
+		Update("status", models.TransferStatusExpired).Error
 }
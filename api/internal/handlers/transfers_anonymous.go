@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// The handlers below serve recipients without an account, who arrive with
+// a receive link and PIN from the sender. Redeeming the link returns a
+// receive token that the other endpoints take in the X-Transfer-Token
+// header or the token query parameter.
+
+type redeemTransferLinkRequest struct {
+	Signature string `json:"signature"`
+	PIN       string `json:"pin"`
+}
+
+// loadAnonymousTransfer loads the transfer in the route, hiding transfers
+// that were not offered anonymously.
+func (h *TransfersHandler) loadAnonymousTransfer(c *fiber.Ctx) (*models.Transfer, *utils.APIError) {
+	if h.Links == nil {
+		return nil, errTransferNotFound
+	}
+	var transfer models.Transfer
+	if err := h.DB.First(&transfer, "code = ?", c.Params("code")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errTransferNotFound
+		}
+		return nil, errLoadingTransfer
+	}
+	if !transfer.AllowAnonymous {
+		return nil, errTransferNotFound
+	}
+	if transfer.Status == models.TransferStatusExpired || time.Now().After(transfer.ExpiresAt) {
+		return nil, errTransferExpired
+	}
+	return &transfer, nil
+}
+
+// authorizeAnonymous loads the transfer and checks the caller's receive
+// token.
+func (h *TransfersHandler) authorizeAnonymous(c *fiber.Ctx) (*models.Transfer, *utils.APIError) {
+	transfer, apiErr := h.loadAnonymousTransfer(c)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	token := c.Get("X-Transfer-Token")
+	if token == "" {
+		token = c.Query("token")
+	}
+	if !h.Links.Authorize(transfer, token) {
+		return nil, utils.NewError(fiber.StatusForbidden, "transfer_token_invalid", "invalid receive token")
+	}
+	return transfer, nil
+}
+
+// auditAnonymous records what an anonymous recipient did in the sender's
+// audit log, with the recipient's address.
+func (h *TransfersHandler) auditAnonymous(c *fiber.Ctx, action string, transfer *models.Transfer, details map[string]interface{}) {
+	if h.Audit == nil {
+		return
+	}
+	details["code"] = transfer.Code
+	details["file_name"] = transfer.FileName
+	details["recipient_ip"] = c.IP()
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &transfer.SenderID,
+		Action:       action,
+		ResourceType: "transfer",
+		ResourceID:   &transfer.ID,
+		Details:      details,
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+}
+
+// AnonymousConnect redeems a receive link and PIN for the first caller.
+func (h *TransfersHandler) AnonymousConnect(c *fiber.Ctx) error {
+	transfer, apiErr := h.loadAnonymousTransfer(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	var req redeemTransferLinkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	if req.Signature == "" || req.PIN == "" {
+		return utils.Error(c, fiber.StatusBadRequest, "signature and pin are required")
+	}
+
+	token, err := h.Links.Redeem(c.UserContext(), transfer, req.Signature, req.PIN, c.IP())
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTransferPINInvalid):
+			h.auditAnonymous(c, "transfer.anonymous_pin_failed", transfer, map[string]interface{}{"attempts": transfer.PINAttempts})
+		case errors.Is(err, services.ErrTransferLinkLocked):
+			h.auditAnonymous(c, "transfer.anonymous_locked", transfer, map[string]interface{}{"attempts": transfer.PINAttempts})
+		}
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "transfer_connect_failed", "failed connecting to transfer")))
+	}
+
+	h.auditAnonymous(c, "transfer.anonymous_connect", transfer, map[string]interface{}{})
+	logger.Info("transfer_connected", map[string]interface{}{
+		"transfer_id":  transfer.ID.String(),
+		"code":         transfer.Code,
+		"recipient_ip": transfer.RecipientIP,
+	})
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{
+		"status":   "connected",
+		"fileName": transfer.FileName,
+		"fileSize": transfer.FileSize,
+		"token":    token,
+	})
+}
+
+// AnonymousGet lets an anonymous recipient poll until the file is ready.
+func (h *TransfersHandler) AnonymousGet(c *fiber.Ctx) error {
+	transfer, apiErr := h.authorizeAnonymous(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	switch transfer.Status {
+	case models.TransferStatusCancelled:
+		return utils.Error(c, fiber.StatusGone, "transfer was cancelled")
+	case models.TransferStatusCompleted:
+		return utils.Error(c, fiber.StatusGone, "transfer already completed")
+	case models.TransferStatusBlocked:
+		return utils.Fail(c, errTransferBlocked)
+	case models.TransferStatusFailed:
+		return utils.Fail(c, errTransferFailed)
+	}
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{
+		"status":    string(transfer.Status),
+		"code":      transfer.Code,
+		"fileName":  transfer.FileName,
+		"fileSize":  transfer.FileSize,
+		"expiresAt": transfer.ExpiresAt,
+	})
+}
+
+func (h *TransfersHandler) AnonymousDownload(c *fiber.Ctx) error {
+	transfer, apiErr := h.authorizeAnonymous(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+
+	h.auditAnonymous(c, "transfer.anonymous_download", transfer, map[string]interface{}{"file_size": transfer.FileSize})
+	return h.send(c, transfer)
+}
+
+// AnonymousComplete is called by an anonymous recipient once they have the
+// file, which retires the link and drops the relayed bytes.
+func (h *TransfersHandler) AnonymousComplete(c *fiber.Ctx) error {
+	transfer, apiErr := h.authorizeAnonymous(c)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if transfer.Status == models.TransferStatusCancelled {
+		return utils.Error(c, fiber.StatusGone, "transfer was cancelled")
+	}
+
+	if err := h.DB.Model(transfer).Update("status", models.TransferStatusCompleted).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed completing transfer")
+	}
+	h.discard(c, transfer)
+	h.auditAnonymous(c, "transfer.anonymous_receive", transfer, map[string]interface{}{})
+
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"status": "completed"})
+}
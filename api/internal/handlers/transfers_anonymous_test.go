@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestAnonymousTransferReceive(t *testing.T) {
+	env := setupTestEnv(t)
+	sender, senderToken := createTestUser(t, env.db, "transfer-anon-sender@test.com", "password123", models.UserRoleUser)
+
+	// offer creates an anonymous transfer and returns its code, link
+	// signature and PIN.
+	offer := func(t *testing.T, size int) (string, string, string) {
+		t.Helper()
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/transfers", map[string]any{"fileName": "brief.txt", "fileSize": size, "allowAnonymous": true}, authHeaders(senderToken))
+		assertStatus(t, resp, http.StatusCreated)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		link, err := url.Parse(data["receiveURL"].(string))
+		if err != nil || !strings.HasSuffix(link.Path, "/receive/"+data["code"].(string)) {
+			t.Fatalf("unexpected receive link %v", data["receiveURL"])
+		}
+		if pin := data["pin"].(string); len(pin) != 6 {
+			t.Fatalf("expected a six digit PIN, got %q", pin)
+		}
+		return data["code"].(string), link.Query().Get("sig"), data["pin"].(string)
+	}
+	connect := func(code, sig, pin string) *http.Response {
+		return performJSONRequest(t, env.app, http.MethodPost, "/api/public/transfers/"+code+"/connect", map[string]any{"signature": sig, "pin": pin}, nil)
+	}
+	wrongPIN := func(pin string) string {
+		if pin == "000000" {
+			return "000001"
+		}
+		return "000000"
+	}
+
+	t.Run("receives through the link and PIN", func(t *testing.T) {
+		code, sig, pin := offer(t, 5)
+
+		assertStatus(t, connect(code, sig+"x", pin), http.StatusNotFound)
+		resp := connect(code, sig, wrongPIN(pin))
+		assertStatus(t, resp, http.StatusForbidden)
+		if code := decodeJSONMap(t, resp)["code"]; code != "transfer_pin_invalid" {
+			t.Fatalf("expected transfer_pin_invalid, got %v", code)
+		}
+
+		resp = connect(code, sig, pin)
+		assertStatus(t, resp, http.StatusOK)
+		token := decodeJSONMap(t, resp)["data"].(map[string]any)["token"].(string)
+		assertStatus(t, connect(code, sig, pin), http.StatusConflict)
+
+		assertStatus(t, performRequest(t, env.app, http.MethodGet, "/api/public/transfers/"+code, nil, nil), http.StatusForbidden)
+		resp = performRequest(t, env.app, http.MethodGet, "/api/public/transfers/"+code, nil, map[string]string{"X-Transfer-Token": token})
+		assertStatus(t, resp, http.StatusOK)
+		if status := decodeJSONMap(t, resp)["data"].(map[string]any)["status"]; status != "active" {
+			t.Fatalf("expected active, got %v", status)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/transfers/"+code, nil, authHeaders(senderToken))
+		assertStatus(t, resp, http.StatusOK)
+		if data := decodeJSONMap(t, resp)["data"].(map[string]any); data["status"] != "receiver_connected" || data["recipientIP"] == "" {
+			t.Fatalf("expected the sender to see the recipient's address, got %v", data)
+		}
+
+		headers := authHeaders(senderToken)
+		headers["Content-Length"] = "5"
+		assertStatus(t, performRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/upload", strings.NewReader("brief"), headers), http.StatusOK)
+		assertStatus(t, performJSONRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/complete", map[string]any{"checksum": sha256Hex("brief")}, authHeaders(senderToken)), http.StatusOK)
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/public/transfers/"+code+"/download?token="+token, nil, nil)
+		assertStatus(t, resp, http.StatusOK)
+		if body, _ := io.ReadAll(resp.Body); string(body) != "brief" {
+			t.Fatalf("unexpected download %q", body)
+		}
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/public/transfers/"+code+"/complete", nil, map[string]string{"X-Transfer-Token": token})
+		assertStatus(t, resp, http.StatusOK)
+
+		var logged models.AuditLog
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if env.db.Where("action = ? AND user_id = ?", "transfer.anonymous_download", sender.ID).Limit(1).Find(&logged); logged.ID != uuid.Nil {
+				break
+			}
+		}
+		if logged.Details["code"] != code || logged.IPAddress == "" {
+			t.Fatalf("expected the download to be audited with the recipient's address, got %+v", logged)
+		}
+	})
+
+	t.Run("cancels the transfer after too many wrong PINs", func(t *testing.T) {
+		code, sig, pin := offer(t, 5)
+		for i := 0; i < 4; i++ {
+			assertStatus(t, connect(code, sig, wrongPIN(pin)), http.StatusForbidden)
+		}
+		resp := connect(code, sig, wrongPIN(pin))
+		assertStatus(t, resp, http.StatusGone)
+		if code := decodeJSONMap(t, resp)["code"]; code != "transfer_link_locked" {
+			t.Fatalf("expected transfer_link_locked, got %v", code)
+		}
+		assertStatus(t, connect(code, sig, pin), http.StatusConflict)
+
+		var transfer models.Transfer
+		env.db.First(&transfer, "code = ?", code)
+		if transfer.Status != models.TransferStatusCancelled {
+			t.Fatalf("expected a cancelled transfer, got %s", transfer.Status)
+		}
+	})
+
+	t.Run("keeps transfers without a link private", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/transfers", map[string]any{"fileName": "private.txt", "fileSize": 3}, authHeaders(senderToken))
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		if _, ok := data["receiveURL"]; ok {
+			t.Fatalf("expected no receive link, got %v", data)
+		}
+		assertStatus(t, connect(data["code"].(string), "sig", "123456"), http.StatusNotFound)
+	})
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+)
+
+// newTestClamd answers clamd INSTREAM scans, flagging streams that contain
+// "EICAR".
+func newTestClamd(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				if _, err := io.CopyN(io.Discard, conn, int64(len("zINSTREAM\x00"))); err != nil {
+					return
+				}
+				var content bytes.Buffer
+				var size [4]byte
+				for {
+					if _, err := io.ReadFull(conn, size[:]); err != nil {
+						return
+					}
+					n := binary.BigEndian.Uint32(size[:])
+					if n == 0 {
+						break
+					}
+					if _, err := io.CopyN(&content, conn, int64(n)); err != nil {
+						return
+					}
+				}
+				reply := "stream: OK\x00"
+				if strings.Contains(content.String(), "EICAR") {
+					reply = "stream: Eicar-Test-Signature FOUND\x00"
+				}
+				conn.Write([]byte(reply))
+			}(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestTransferScanning(t *testing.T) {
+	env := setupTestEnvWithConfig(t, func(cfg *config.Config) {
+		cfg.Scan = config.ScanConfig{ClamAVAddress: newTestClamd(t), Timeout: 5 * time.Second, TransferBypassBytes: 8}
+	})
+	sender, senderToken := createTestUser(t, env.db, "transfer-scan-sender@test.com", "password123", models.UserRoleUser)
+	_, recipientToken := createTestUser(t, env.db, "transfer-scan-recipient@test.com", "password123", models.UserRoleUser)
+
+	// send relays content to the recipient in chunks and completes the
+	// upload, returning the transfer code and the complete response.
+	send := func(t *testing.T, name string, chunks ...string) (string, map[string]any) {
+		t.Helper()
+		size := 0
+		for _, chunk := range chunks {
+			size += len(chunk)
+		}
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/transfers", map[string]any{"fileName": name, "fileSize": size}, authHeaders(senderToken))
+		assertStatus(t, resp, http.StatusCreated)
+		code := decodeJSONMap(t, resp)["data"].(map[string]any)["code"].(string)
+		assertStatus(t, performJSONRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/connect", nil, authHeaders(recipientToken)), http.StatusOK)
+
+		for i, chunk := range chunks {
+			headers := authHeaders(senderToken)
+			headers["Content-Length"] = strconv.Itoa(len(chunk))
+			headers["X-Chunk-Index"] = strconv.Itoa(i)
+			headers["X-Chunk-Total"] = strconv.Itoa(len(chunks))
+			assertStatus(t, performRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/upload", strings.NewReader(chunk), headers), http.StatusOK)
+		}
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/complete", map[string]any{"checksum": sha256Hex(strings.Join(chunks, ""))}, authHeaders(senderToken))
+		assertStatus(t, resp, http.StatusOK)
+		return code, decodeJSONMap(t, resp)["data"].(map[string]any)
+	}
+	runJobs := func(t *testing.T) {
+		t.Helper()
+		for {
+			ran, err := env.jobs.RunNext(context.Background())
+			if err != nil {
+				t.Fatalf("job failed: %v", err)
+			}
+			if !ran {
+				return
+			}
+		}
+	}
+
+	t.Run("holds the download until the scan passes", func(t *testing.T) {
+		code, data := send(t, "clean-report.txt", "quarterly ", "numbers")
+		if data["status"] != "scanning" {
+			t.Fatalf("expected scanning, got %v", data["status"])
+		}
+
+		resp := performRequest(t, env.app, http.MethodGet, "/api/transfers/"+code+"/download", nil, authHeaders(recipientToken))
+		assertStatus(t, resp, http.StatusConflict)
+		if code := decodeJSONMap(t, resp)["code"]; code != "transfer_scanning" {
+			t.Fatalf("expected transfer_scanning, got %v", code)
+		}
+
+		runJobs(t)
+		resp = performRequest(t, env.app, http.MethodGet, "/api/transfers/"+code, nil, authHeaders(recipientToken))
+		assertStatus(t, resp, http.StatusOK)
+		if status := decodeJSONMap(t, resp)["data"].(map[string]any)["status"]; status != "ready" {
+			t.Fatalf("expected ready, got %v", status)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/transfers/"+code+"/download", nil, authHeaders(recipientToken))
+		assertStatus(t, resp, http.StatusOK)
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != "quarterly numbers" {
+			t.Fatalf("unexpected download %q", body)
+		}
+		assertStatus(t, performJSONRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/complete", nil, authHeaders(recipientToken)), http.StatusOK)
+	})
+
+	t.Run("blocks infected transfers and audits them", func(t *testing.T) {
+		code, _ := send(t, "invoice.txt", "X5O!P%@AP EICAR-STANDARD-ANTIVIRUS-TEST-FILE")
+		runJobs(t)
+
+		resp := performRequest(t, env.app, http.MethodGet, "/api/transfers/"+code+"/download", nil, authHeaders(recipientToken))
+		assertStatus(t, resp, http.StatusGone)
+		if code := decodeJSONMap(t, resp)["code"]; code != "transfer_blocked" {
+			t.Fatalf("expected transfer_blocked, got %v", code)
+		}
+		resp = performRequest(t, env.app, http.MethodGet, "/api/transfers/"+code, nil, authHeaders(senderToken))
+		assertStatus(t, resp, http.StatusGone)
+
+		var logged models.AuditLog
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if env.db.Where("action = ? AND user_id = ?", "transfer.blocked", sender.ID).Limit(1).Find(&logged); logged.ID != uuid.Nil {
+				break
+			}
+		}
+		if logged.Details["signature"] != "Eicar-Test-Signature" {
+			t.Fatalf("expected an audit entry with the signature, got %+v", logged)
+		}
+	})
+
+	t.Run("skips the scan for small files", func(t *testing.T) {
+		code, data := send(t, "tiny.txt", "hi")
+		if data["status"] != "ready" {
+			t.Fatalf("expected ready, got %v", data["status"])
+		}
+		resp := performRequest(t, env.app, http.MethodGet, "/api/transfers/"+code+"/download", nil, authHeaders(recipientToken))
+		assertStatus(t, resp, http.StatusOK)
+	})
+
+	t.Run("refuses to finish a partial upload", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/transfers", map[string]any{"fileName": "partial.txt", "fileSize": 100}, authHeaders(senderToken))
+		code := decodeJSONMap(t, resp)["data"].(map[string]any)["code"].(string)
+		performJSONRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/connect", nil, authHeaders(recipientToken))
+		headers := authHeaders(senderToken)
+		headers["Content-Length"] = "5"
+		headers["X-Chunk-Index"] = "0"
+		headers["X-Chunk-Total"] = "2"
+		assertStatus(t, performRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/upload", strings.NewReader("first"), headers), http.StatusOK)
+
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/complete", map[string]any{"checksum": sha256Hex("first")}, authHeaders(senderToken))
+		assertStatus(t, resp, http.StatusConflict)
+		if code := decodeJSONMap(t, resp)["code"]; code != "transfer_incomplete" {
+			t.Fatalf("expected transfer_incomplete, got %v", code)
+		}
+		resp = performRequest(t, env.app, http.MethodGet, "/api/transfers/"+code+"/download", nil, authHeaders(recipientToken))
+		assertStatus(t, resp, http.StatusConflict)
+	})
+}
+
+func TestTransferResume(t *testing.T) {
+	env := setupTestEnv(t)
+	_, senderToken := createTestUser(t, env.db, "transfer-resume-sender@test.com", "password123", models.UserRoleUser)
+	_, recipientToken := createTestUser(t, env.db, "transfer-resume-recipient@test.com", "password123", models.UserRoleUser)
+	_, outsiderToken := createTestUser(t, env.db, "transfer-resume-outsider@test.com", "password123", models.UserRoleUser)
+
+	start := func(t *testing.T, size int) string {
+		t.Helper()
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/transfers", map[string]any{"fileName": "resume.txt", "fileSize": size}, authHeaders(senderToken))
+		code := decodeJSONMap(t, resp)["data"].(map[string]any)["code"].(string)
+		assertStatus(t, performJSONRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/connect", nil, authHeaders(recipientToken)), http.StatusOK)
+		return code
+	}
+	upload := func(t *testing.T, code string, index, total int, chunk string) {
+		t.Helper()
+		headers := authHeaders(senderToken)
+		headers["Content-Length"] = strconv.Itoa(len(chunk))
+		headers["X-Chunk-Index"] = strconv.Itoa(index)
+		headers["X-Chunk-Total"] = strconv.Itoa(total)
+		assertStatus(t, performRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/upload", strings.NewReader(chunk), headers), http.StatusOK)
+	}
+	complete := func(t *testing.T, code, checksum string) *http.Response {
+		t.Helper()
+		return performJSONRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/complete", map[string]any{"checksum": checksum}, authHeaders(senderToken))
+	}
+
+	t.Run("reports missing chunks so the sender can resume", func(t *testing.T) {
+		code := start(t, 8)
+		upload(t, code, 0, 4, "aa")
+		upload(t, code, 3, 4, "dd")
+
+		resp := performRequest(t, env.app, http.MethodGet, "/api/transfers/"+code+"/status", nil, authHeaders(outsiderToken))
+		assertStatus(t, resp, http.StatusForbidden)
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/transfers/"+code+"/status", nil, authHeaders(senderToken))
+		assertStatus(t, resp, http.StatusOK)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		missing := data["missing"].([]any)
+		if data["chunkTotal"] != float64(4) || data["receivedBytes"] != float64(4) || len(missing) != 1 {
+			t.Fatalf("unexpected status %v", data)
+		}
+		if r := missing[0].(map[string]any); r["start"] != float64(1) || r["end"] != float64(2) {
+			t.Fatalf("expected chunks 1-2 missing, got %v", r)
+		}
+
+		assertStatus(t, complete(t, code, ""), http.StatusBadRequest)
+		assertStatus(t, complete(t, code, sha256Hex("aabbccdd")), http.StatusConflict)
+
+		upload(t, code, 1, 4, "bb")
+		upload(t, code, 2, 4, "cc")
+		resp = complete(t, code, sha256Hex("aabbccdd"))
+		assertStatus(t, resp, http.StatusOK)
+		if status := decodeJSONMap(t, resp)["data"].(map[string]any)["status"]; status != "ready" {
+			t.Fatalf("expected ready, got %v", status)
+		}
+		resp = performRequest(t, env.app, http.MethodGet, "/api/transfers/"+code+"/download", nil, authHeaders(recipientToken))
+		assertStatus(t, resp, http.StatusOK)
+		if body, _ := io.ReadAll(resp.Body); string(body) != "aabbccdd" {
+			t.Fatalf("unexpected download %q", body)
+		}
+	})
+
+	t.Run("fails a transfer whose checksum does not match", func(t *testing.T) {
+		code := start(t, 4)
+		upload(t, code, 0, 1, "data")
+		resp := complete(t, code, sha256Hex("something else"))
+		assertStatus(t, resp, http.StatusUnprocessableEntity)
+		if code := decodeJSONMap(t, resp)["code"]; code != "transfer_checksum_mismatch" {
+			t.Fatalf("expected transfer_checksum_mismatch, got %v", code)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/transfers/"+code+"/download", nil, authHeaders(recipientToken))
+		assertStatus(t, resp, http.StatusGone)
+		if code := decodeJSONMap(t, resp)["code"]; code != "transfer_failed" {
+			t.Fatalf("expected transfer_failed, got %v", code)
+		}
+	})
+}
+
+func TestTransferSave(t *testing.T) {
+	env := setupTestEnv(t)
+	_, senderToken := createTestUser(t, env.db, "transfer-save-sender@test.com", "password123", models.UserRoleUser)
+	recipient, recipientToken := createTestUser(t, env.db, "transfer-save-recipient@test.com", "password123", models.UserRoleUser)
+	outsider, _ := createTestUser(t, env.db, "transfer-save-outsider@test.com", "password123", models.UserRoleUser)
+
+	folder := models.File{Name: "Inbox", MimeType: "inode/directory", IsDirectory: true, OwnerID: recipient.ID}
+	env.db.Create(&folder)
+	foreign := models.File{Name: "Elsewhere", MimeType: "inode/directory", IsDirectory: true, OwnerID: outsider.ID}
+	env.db.Create(&foreign)
+
+	headers := authHeaders(senderToken)
+	resp := performJSONRequest(t, env.app, http.MethodPost, "/api/transfers", map[string]any{"fileName": "minutes.txt", "fileSize": 7}, headers)
+	code := decodeJSONMap(t, resp)["data"].(map[string]any)["code"].(string)
+	assertStatus(t, performJSONRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/connect", nil, authHeaders(recipientToken)), http.StatusOK)
+
+	save := func(token, parentID string) *http.Response {
+		return performJSONRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/complete", map[string]any{"save": true, "parentID": parentID}, authHeaders(token))
+	}
+	resp = save(recipientToken, folder.ID.String())
+	assertStatus(t, resp, http.StatusConflict)
+	if code := decodeJSONMap(t, resp)["code"]; code != "transfer_not_ready" {
+		t.Fatalf("expected transfer_not_ready, got %v", code)
+	}
+
+	headers["Content-Length"] = "7"
+	assertStatus(t, performRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/upload", strings.NewReader("minutes"), headers), http.StatusOK)
+	resp = performJSONRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/complete", map[string]any{"checksum": sha256Hex("minutes")}, authHeaders(senderToken))
+	assertStatus(t, resp, http.StatusOK)
+
+	assertStatus(t, save(senderToken, ""), http.StatusForbidden)
+	assertStatus(t, save(recipientToken, foreign.ID.String()), http.StatusForbidden)
+
+	resp = save(recipientToken, folder.ID.String())
+	assertStatus(t, resp, http.StatusOK)
+	data := decodeJSONMap(t, resp)["data"].(map[string]any)
+	file := data["file"].(map[string]any)
+	if data["status"] != "completed" || file["name"] != "minutes.txt" || file["parentID"] != folder.ID.String() {
+		t.Fatalf("unexpected save response %v", data)
+	}
+
+	resp = performRequest(t, env.app, http.MethodGet, "/api/transfers/"+code+"/download", nil, authHeaders(recipientToken))
+	assertStatus(t, resp, http.StatusBadRequest)
+}
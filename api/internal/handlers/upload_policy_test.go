@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+// testutil_test.go blocks the .exe extension and application/x-msdownload.
+
+func TestUploadPolicy(t *testing.T) {
+	env := setupTestEnv(t)
+	_, senderToken := createTestUser(t, env.db, "upload-policy-sender@test.com", "password123", models.UserRoleUser)
+	_, recipientToken := createTestUser(t, env.db, "upload-policy-recipient@test.com", "password123", models.UserRoleUser)
+
+	t.Run("multipart upload rejects disguised executable", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="file"; filename="report.pdf"`)
+		header.Set("Content-Type", "application/pdf")
+		part, _ := writer.CreatePart(header)
+		_, _ = io.WriteString(part, "MZ\x90\x00\x03\x00\x00\x00")
+		writer.Close()
+
+		resp := performRequest(t, env.app, http.MethodPost, "/api/files/upload", body, map[string]string{
+			"Authorization": "Bearer " + senderToken,
+			"Content-Type":  writer.FormDataContentType(),
+		})
+		decoded := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusUnsupportedMediaType)
+		if decoded["code"] != "file_type_not_allowed" {
+			t.Fatalf("expected code file_type_not_allowed, got %v", decoded["code"])
+		}
+		if msg, _ := decoded["error"].(string); !strings.Contains(msg, "application/x-msdownload") {
+			t.Fatalf("expected message to name the detected type, got %q", msg)
+		}
+
+		var count int64
+		env.db.Model(&models.File{}).Where("name = ?", "report.pdf").Count(&count)
+		if count != 0 {
+			t.Fatalf("expected no file row, got %d", count)
+		}
+	})
+
+	t.Run("presign rejects blocked extension", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/upload/presign", map[string]any{
+			"name": "setup.EXE",
+			"size": 1024,
+		}, authHeaders(senderToken))
+		body := decodeJSONMap(t, resp)
+		assertStatus(t, resp, http.StatusUnsupportedMediaType)
+		assertEnvelopeError(t, body, `file type is not allowed: extension ".exe" is blocked`)
+	})
+
+	t.Run("transfer create rejects blocked extension", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/transfers", map[string]any{
+			"fileName": "setup.exe",
+			"fileSize": 100,
+		}, authHeaders(senderToken))
+		assertStatus(t, resp, http.StatusUnsupportedMediaType)
+	})
+
+	t.Run("transfer first chunk is sniffed", func(t *testing.T) {
+		createResp := performJSONRequest(t, env.app, http.MethodPost, "/api/transfers", map[string]any{
+			"fileName": "notes.txt",
+			"fileSize": 100,
+		}, authHeaders(senderToken))
+		code := decodeJSONMap(t, createResp)["data"].(map[string]any)["code"].(string)
+		connectResp := performRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/connect", nil, authHeaders(recipientToken))
+		assertStatus(t, connectResp, http.StatusOK)
+
+		resp := performRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/upload", strings.NewReader("MZ\x90\x00"), map[string]string{
+			"Authorization":  "Bearer " + senderToken,
+			"X-Chunk-Index":  "0",
+			"Content-Length": "4",
+		})
+		assertStatus(t, resp, http.StatusUnsupportedMediaType)
+
+		var transfer models.Transfer
+		if err := env.db.First(&transfer, "code = ?", code).Error; err != nil {
+			t.Fatalf("loading transfer: %v", err)
+		}
+		if transfer.Status != models.TransferStatusCancelled {
+			t.Fatalf("expected cancelled transfer, got %s", transfer.Status)
+		}
+	})
+
+	t.Run("transfer records detected type", func(t *testing.T) {
+		createResp := performJSONRequest(t, env.app, http.MethodPost, "/api/transfers", map[string]any{
+			"fileName": "image.png",
+			"fileSize": 100,
+		}, authHeaders(senderToken))
+		code := decodeJSONMap(t, createResp)["data"].(map[string]any)["code"].(string)
+		performRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/connect", nil, authHeaders(recipientToken))
+
+		chunk := "\x89PNG\r\n\x1a\n"
+		resp := performRequest(t, env.app, http.MethodPost, "/api/transfers/"+code+"/upload", strings.NewReader(chunk), map[string]string{
+			"Authorization":  "Bearer " + senderToken,
+			"Content-Length": "8",
+		})
+		assertStatus(t, resp, http.StatusOK)
+
+		var transfer models.Transfer
+		env.db.First(&transfer, "code = ?", code)
+		if transfer.MimeType != "image/png" || transfer.DetectedMimeType != "image/png" {
+			t.Fatalf("expected image/png declared and detected, got %q / %q", transfer.MimeType, transfer.DetectedMimeType)
+		}
+	})
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"strings"
+	"time"
 
 	"github.com/docshare/api/internal/middleware"
 	"github.com/docshare/api/internal/models"
@@ -9,23 +11,40 @@ import (
 	"github.com/docshare/api/pkg/logger"
 	"github.com/docshare/api/pkg/utils"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type UsersHandler struct {
 	DB    *gorm.DB
 	Audit *services.AuditService
+	// Settings, when set, decides whom Search finds for non-admins.
+	Settings *services.SettingsService
 }
 
 func NewUsersHandler(db *gorm.DB, audit *services.AuditService) *UsersHandler {
 	return &UsersHandler{DB: db, Audit: audit}
 }
 
+// List, like every admin user endpoint, only sees the admin's own
+// organization.
 func (h *UsersHandler) List(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
 	p := utils.ParsePagination(c)
 	search := strings.TrimSpace(c.Query("search"))
 
-	query := h.DB.Model(&models.User{})
+	query := h.DB.Model(&models.User{}).Scopes(services.OrganizationScope("users", currentUser.OrganizationID))
+	switch status := models.UserStatus(c.Query("status")); status {
+	case "":
+	case models.UserStatusActive, models.UserStatusSuspended:
+		query = query.Where("status = ?", status)
+	default:
+		return utils.Error(c, fiber.StatusBadRequest, "invalid status")
+	}
 	if search != "" {
 		searchValue := "%" + strings.ToLower(search) + "%"
 		query = query.Where(
@@ -49,8 +68,33 @@ func (h *UsersHandler) List(c *fiber.Ctx) error {
 	return utils.Paginated(c, users, p.Page, p.Limit, total)
 }
 
+// userSearchResult is what search tells other users about a user.
+type userSearchResult struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"firstName"`
+	LastName  string    `json:"lastName"`
+	AvatarURL *string   `json:"avatarURL,omitempty"`
+}
+
+// Search finds users to share with. Users who can read the user directory
+// see every account of their organization in full; everyone else gets the
+// fields in userSearchResult, only for users who have not opted out of
+// search and within the configured search visibility.
 func (h *UsersHandler) Search(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	override := services.HasAdminPermission(currentUser, services.PermissionUsersRead)
+	visibility := services.UserSearchEveryone
+	if h.Settings != nil {
+		visibility = h.Settings.UserSearchVisibility(c.Context())
+	}
+	if visibility == services.UserSearchDisabled && !override {
+		return utils.Fail(c, errUserSearchDisabled)
+	}
+
 	search := strings.TrimSpace(c.Query("search"))
 	limit := c.QueryInt("limit", 5)
 
@@ -58,14 +102,23 @@ func (h *UsersHandler) Search(c *fiber.Ctx) error {
 		limit = 50
 	}
 
-	if search != "" && currentUser != nil {
+	if search != "" {
 		logger.InfoWithUser(currentUser.ID.String(), "user_search", map[string]interface{}{
 			"query": search,
 			"limit": limit,
 		})
 	}
 
-	query := h.DB.Model(&models.User{})
+	query := h.DB.Model(&models.User{}).
+		Scopes(services.OrganizationScope("users", currentUser.OrganizationID)).
+		Where("status <> ?", models.UserStatusSuspended)
+	if !override {
+		query = query.Where("hide_from_search = ?", false)
+		if visibility == services.UserSearchGroups {
+			myGroups := h.DB.Model(&models.GroupMembership{}).Select("group_id").Where("user_id = ?", currentUser.ID)
+			query = query.Where("id IN (?)", h.DB.Model(&models.GroupMembership{}).Select("user_id").Where("group_id IN (?)", myGroups))
+		}
+	}
 	if search != "" {
 		searchValue := "%" + strings.ToLower(search) + "%"
 		query = query.Where(
@@ -80,22 +133,37 @@ func (h *UsersHandler) Search(c *fiber.Ctx) error {
 	if err := query.Order("created_at DESC").Limit(limit).Find(&users).Error; err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed searching users")
 	}
+	if override {
+		return utils.Success(c, fiber.StatusOK, users)
+	}
 
-	return utils.Success(c, fiber.StatusOK, users)
+	results := make([]userSearchResult, len(users))
+	for i, user := range users {
+		results[i] = userSearchResult{
+			ID:        user.ID,
+			Email:     user.Email,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			AvatarURL: user.AvatarURL,
+		}
+	}
+	return utils.Success(c, fiber.StatusOK, results)
 }
 
 func (h *UsersHandler) Get(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
 	userID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid user id")
+		return utils.Fail(c, errInvalidUserID)
 	}
 
-	var user models.User
-	if err := h.DB.First(&user, "id = ?", userID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return utils.Error(c, fiber.StatusNotFound, "user not found")
-		}
-		return utils.Error(c, fiber.StatusInternalServerError, "failed fetching user")
+	user, apiErr := h.loadUser(userID, currentUser.OrganizationID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
 	}
 
 	return utils.Success(c, fiber.StatusOK, user)
@@ -109,14 +177,19 @@ type updateUserRequest struct {
 }
 
 func (h *UsersHandler) Update(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
 	userID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid user id")
+		return utils.Fail(c, errInvalidUserID)
 	}
 
 	var req updateUserRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	updates := map[string]interface{}{}
@@ -143,22 +216,31 @@ func (h *UsersHandler) Update(c *fiber.Ctx) error {
 		}
 	}
 	if req.Role != nil {
-		if *req.Role != models.UserRoleAdmin && *req.Role != models.UserRoleUser {
+		if !req.Role.Valid() {
 			return utils.Error(c, fiber.StatusBadRequest, "invalid role")
 		}
+		if !services.HasAdminPermission(currentUser, services.PermissionRolesManage) {
+			return utils.Fail(c, errRoleChangeForbidden)
+		}
 		updates["role"] = *req.Role
 	}
 
 	if len(updates) == 0 {
 		return utils.Error(c, fiber.StatusBadRequest, "no valid fields to update")
 	}
+	if apiErr := h.guardAdministrative(currentUser, userID); apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
 
-	result := h.DB.Model(&models.User{}).Where("id = ?", userID).Updates(updates)
+	result := h.DB.Model(&models.User{}).
+		Scopes(services.OrganizationScope("users", currentUser.OrganizationID)).
+		Where("id = ?", userID).
+		Updates(updates)
 	if result.Error != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed updating user")
 	}
 	if result.RowsAffected == 0 {
-		return utils.Error(c, fiber.StatusNotFound, "user not found")
+		return utils.Fail(c, errUserNotFound)
 	}
 
 	var user models.User
@@ -166,52 +248,233 @@ func (h *UsersHandler) Update(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed fetching updated user")
 	}
 
-	currentUser := middleware.GetCurrentUser(c)
-	if currentUser != nil {
-		h.Audit.LogAsync(services.AuditEntry{
-			UserID:       &currentUser.ID,
-			Action:       "admin.user_update",
-			ResourceType: "user",
-			ResourceID:   &userID,
-			Details: map[string]interface{}{
-				"target_user_id": userID.String(),
-			},
-			IPAddress: c.IP(),
-			RequestID: getRequestID(c),
-		})
-	}
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "admin.user_update",
+		ResourceType: "user",
+		ResourceID:   &userID,
+		Details: map[string]interface{}{
+			"target_user_id": userID.String(),
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
 
 	return utils.Success(c, fiber.StatusOK, user)
 }
 
 func (h *UsersHandler) Delete(c *fiber.Ctx) error {
 	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
 	userID, err := parseUUID(c.Params("id"))
 	if err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid user id")
+		return utils.Fail(c, errInvalidUserID)
 	}
 
-	result := h.DB.Delete(&models.User{}, "id = ?", userID)
-	if result.Error != nil {
-		return utils.Error(c, fiber.StatusInternalServerError, "failed deleting user")
+	if apiErr := h.guardAdministrative(currentUser, userID); apiErr != nil {
+		return utils.Fail(c, apiErr)
 	}
-	if result.RowsAffected == 0 {
-		return utils.Error(c, fiber.StatusNotFound, "user not found")
-	}
-
-	if currentUser != nil {
-		h.Audit.LogAsync(services.AuditEntry{
-			UserID:       &currentUser.ID,
-			Action:       "admin.user_delete",
-			ResourceType: "user",
-			ResourceID:   &userID,
-			Details: map[string]interface{}{
-				"deleted_user_id": userID.String(),
-			},
-			IPAddress: c.IP(),
-			RequestID: getRequestID(c),
-		})
+
+	// The user's memberships, the shares made to them and their activity
+	// feed go with them; files they own and shares they made stay until
+	// someone takes the files over.
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Scopes(services.OrganizationScope("users", currentUser.OrganizationID)).Delete(&models.User{}, "id = ?", userID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errUserNotFound
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.GroupMembership{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("shared_with_user_id = ?", userID).Delete(&models.Share{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.Activity{}).Error
+	})
+	if err != nil {
+		if errors.Is(err, errUserNotFound) {
+			return utils.Fail(c, errUserNotFound)
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed deleting user")
 	}
 
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "admin.user_delete",
+		ResourceType: "user",
+		ResourceID:   &userID,
+		Details: map[string]interface{}{
+			"deleted_user_id": userID.String(),
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+
 	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "user deleted"})
 }
+
+type suspendUserRequest struct {
+	Reason string `json:"reason"`
+}
+
+// Suspend blocks a user from signing in and revokes their existing
+// sessions. Their files and shares are left in place; whether those shares
+// keep working for others is decided by SUSPENDED_USER_SHARES_ACTIVE.
+func (h *UsersHandler) Suspend(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	userID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidUserID)
+	}
+	if userID == currentUser.ID {
+		return utils.Error(c, fiber.StatusBadRequest, "cannot suspend your own account")
+	}
+
+	var req suspendUserRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return utils.Fail(c, errInvalidBody)
+		}
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if len(reason) > 500 {
+		return utils.Error(c, fiber.StatusBadRequest, "reason must be at most 500 characters")
+	}
+
+	user, apiErr := h.loadUser(userID, currentUser.OrganizationID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if user.Role.IsAdministrative() && !services.HasAdminPermission(currentUser, services.PermissionRolesManage) {
+		return utils.Fail(c, errAdministrativeAccount)
+	}
+	if user.IsSuspended() {
+		return utils.Error(c, fiber.StatusConflict, "user is already suspended")
+	}
+
+	now := time.Now().UTC()
+	if err := h.DB.Model(&user).Updates(map[string]interface{}{
+		"status":              models.UserStatusSuspended,
+		"suspended_at":        now,
+		"suspension_reason":   reason,
+		"sessions_revoked_at": now,
+	}).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed updating user")
+	}
+
+	logger.InfoWithUser(currentUser.ID.String(), "user_suspended", map[string]interface{}{
+		"target_user_id": userID.String(),
+	})
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "admin.user_suspend",
+		ResourceType: "user",
+		ResourceID:   &userID,
+		Details: map[string]interface{}{
+			"target_user_id": userID.String(),
+			"email":          user.Email,
+			"reason":         reason,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusOK, user)
+}
+
+// Reactivate lifts a suspension. Sessions revoked by the suspension stay
+// revoked; the user has to sign in again.
+func (h *UsersHandler) Reactivate(c *fiber.Ctx) error {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+
+	userID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidUserID)
+	}
+
+	user, apiErr := h.loadUser(userID, currentUser.OrganizationID)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	if user.Role.IsAdministrative() && !services.HasAdminPermission(currentUser, services.PermissionRolesManage) {
+		return utils.Fail(c, errAdministrativeAccount)
+	}
+	if !user.IsSuspended() {
+		return utils.Error(c, fiber.StatusConflict, "user is not suspended")
+	}
+
+	if err := h.DB.Model(&user).Updates(map[string]interface{}{
+		"status":            models.UserStatusActive,
+		"suspended_at":      nil,
+		"suspension_reason": "",
+	}).Error; err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed updating user")
+	}
+
+	logger.InfoWithUser(currentUser.ID.String(), "user_reactivated", map[string]interface{}{
+		"target_user_id": userID.String(),
+	})
+
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &currentUser.ID,
+		Action:       "admin.user_reactivate",
+		ResourceType: "user",
+		ResourceID:   &userID,
+		Details: map[string]interface{}{
+			"target_user_id": userID.String(),
+			"email":          user.Email,
+		},
+		IPAddress: c.IP(),
+		RequestID: getRequestID(c),
+	})
+
+	return utils.Success(c, fiber.StatusOK, user)
+}
+
+// loadUser loads a user of the given organization; users of other tenants
+// are reported as not found.
+func (h *UsersHandler) loadUser(userID uuid.UUID, orgID *uuid.UUID) (models.User, *utils.APIError) {
+	var user models.User
+	if err := h.DB.Scopes(services.OrganizationScope("users", orgID)).First(&user, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return user, errUserNotFound
+		}
+		return user, utils.NewError(fiber.StatusInternalServerError, "user_load_failed", "failed fetching user")
+	}
+	return user, nil
+}
+
+// guardAdministrative stops admins who cannot manage roles from changing
+// accounts that hold an administrative role, so a user manager cannot lock
+// out the admins above them. Missing users are left for the caller to
+// report.
+func (h *UsersHandler) guardAdministrative(currentUser *models.User, userID uuid.UUID) *utils.APIError {
+	if services.HasAdminPermission(currentUser, services.PermissionRolesManage) {
+		return nil
+	}
+	user, apiErr := h.loadUser(userID, currentUser.OrganizationID)
+	if apiErr != nil {
+		if apiErr == errUserNotFound {
+			return nil
+		}
+		return apiErr
+	}
+	if user.Role.IsAdministrative() {
+		return errAdministrativeAccount
+	}
+	return nil
+}
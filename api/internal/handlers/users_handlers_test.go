@@ -73,8 +73,22 @@ func TestUsersEndpoints(t *testing.T) {
 
 	t.Run("DELETE /api/users/:id admin delete user", func(t *testing.T) {
 		victim, _ := createTestUser(t, env.db, "users-delete-victim@test.com", "password123", models.UserRoleUser)
+		group := models.Group{Name: "Victims", CreatedByID: admin.ID}
+		env.db.Create(&group)
+		env.db.Create(&models.GroupMembership{UserID: victim.ID, GroupID: group.ID})
+		file := models.File{Name: "shared.txt", MimeType: "text/plain", OwnerID: admin.ID}
+		env.db.Create(&file)
+		env.db.Create(&models.Share{FileID: file.ID, SharedByID: admin.ID, SharedWithUserID: &victim.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView})
+
 		resp := performRequest(t, env.app, http.MethodDelete, fmt.Sprintf("/api/users/%s", victim.ID), nil, authHeaders(adminToken))
 		assertStatus(t, resp, http.StatusOK)
+
+		var memberships, shares int64
+		env.db.Model(&models.GroupMembership{}).Where("user_id = ?", victim.ID).Count(&memberships)
+		env.db.Model(&models.Share{}).Where("shared_with_user_id = ?", victim.ID).Count(&shares)
+		if memberships != 0 || shares != 0 {
+			t.Fatalf("expected the user's memberships and shares removed, got %d and %d", memberships, shares)
+		}
 	})
 
 	t.Run("DELETE /api/users/:id not found", func(t *testing.T) {
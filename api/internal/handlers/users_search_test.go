@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+)
+
+func TestUserSearchPrivacy(t *testing.T) {
+	env := setupTestEnv(t)
+	_, adminToken := createTestUser(t, env.db, "privacy-admin@test.com", "password123", models.UserRoleAdmin)
+	_, auditorToken := createTestUser(t, env.db, "privacy-auditor@test.com", "password123", models.UserRoleAuditor)
+	searcher, searcherToken := createTestUser(t, env.db, "privacy-searcher@test.com", "password123", models.UserRoleUser)
+	teammate, _ := createTestUser(t, env.db, "privacy-teammate@test.com", "password123", models.UserRoleUser)
+	_, strangerToken := createTestUser(t, env.db, "privacy-stranger@test.com", "password123", models.UserRoleUser)
+
+	group := models.Group{Name: "Privacy", CreatedByID: searcher.ID}
+	if err := env.db.Create(&group).Error; err != nil {
+		t.Fatalf("failed creating group: %v", err)
+	}
+	for _, member := range []*models.User{searcher, teammate} {
+		if err := env.db.Create(&models.GroupMembership{GroupID: group.ID, UserID: member.ID, Role: models.GroupRoleMember}).Error; err != nil {
+			t.Fatalf("failed adding member: %v", err)
+		}
+	}
+
+	search := func(token string) (*http.Response, []map[string]any) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/users/search?search=privacy-&limit=50", nil, authHeaders(token))
+		if resp.StatusCode != http.StatusOK {
+			return resp, nil
+		}
+		var found []map[string]any
+		for _, item := range decodeJSONMap(t, resp)["data"].([]any) {
+			found = append(found, item.(map[string]any))
+		}
+		return resp, found
+	}
+	emails := func(found []map[string]any) []string {
+		var out []string
+		for _, user := range found {
+			out = append(out, user["email"].(string))
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	t.Run("returns only the public fields to users", func(t *testing.T) {
+		_, found := search(searcherToken)
+		if len(found) != 5 {
+			t.Fatalf("expected every user, got %v", emails(found))
+		}
+		for _, field := range []string{"role", "status", "isEmailVerified", "createdAt"} {
+			if _, ok := found[0][field]; ok {
+				t.Fatalf("expected %s to be left out, got %v", field, found[0])
+			}
+		}
+		_, found = search(adminToken)
+		if _, ok := found[0]["role"]; !ok {
+			t.Fatalf("expected admins to get full users, got %v", found[0])
+		}
+	})
+
+	t.Run("honours the opt-out", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/auth/me", map[string]any{"hideFromSearch": true}, authHeaders(strangerToken))
+		assertStatus(t, resp, http.StatusOK)
+		t.Cleanup(func() {
+			env.db.Model(&models.User{}).Where("email = ?", "privacy-stranger@test.com").Update("hide_from_search", false)
+		})
+
+		_, found := search(searcherToken)
+		for _, email := range emails(found) {
+			if email == "privacy-stranger@test.com" {
+				t.Fatal("expected the opted out user to be hidden")
+			}
+		}
+		_, found = search(auditorToken)
+		if len(found) != 5 {
+			t.Fatalf("expected the directory readers to still find everyone, got %v", emails(found))
+		}
+	})
+
+	t.Run("limits results to shared groups", func(t *testing.T) {
+		putSettings(t, env, adminToken, map[string]any{services.SettingUserSearchVisibility: services.UserSearchGroups})
+		t.Cleanup(func() { putSettings(t, env, adminToken, map[string]any{services.SettingUserSearchVisibility: nil}) })
+
+		_, found := search(searcherToken)
+		if got := emails(found); len(got) != 2 || got[0] != "privacy-searcher@test.com" || got[1] != "privacy-teammate@test.com" {
+			t.Fatalf("expected only the group's members, got %v", got)
+		}
+		if _, found = search(strangerToken); len(found) != 0 {
+			t.Fatalf("expected a user without groups to find nobody, got %v", emails(found))
+		}
+	})
+
+	t.Run("can be disabled", func(t *testing.T) {
+		putSettings(t, env, adminToken, map[string]any{services.SettingUserSearchVisibility: services.UserSearchDisabled})
+		t.Cleanup(func() { putSettings(t, env, adminToken, map[string]any{services.SettingUserSearchVisibility: nil}) })
+
+		resp, _ := search(searcherToken)
+		assertStatus(t, resp, http.StatusForbidden)
+		if code := decodeJSONMap(t, resp)["code"]; code != "user_search_disabled" {
+			t.Fatalf("expected user_search_disabled, got %v", code)
+		}
+		if resp, _ = search(adminToken); resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected admins to keep searching, got %d", resp.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestUsersSuspension(t *testing.T) {
+	env := setupTestEnv(t)
+	admin, adminToken := createTestUser(t, env.db, "suspend-admin@test.com", "password123", models.UserRoleAdmin)
+	member, memberToken := createTestUser(t, env.db, "suspend-member@test.com", "password123", models.UserRoleUser)
+	_, otherToken := createTestUser(t, env.db, "suspend-other@test.com", "password123", models.UserRoleUser)
+
+	suspendPath := fmt.Sprintf("/api/users/%s/suspend", member.ID)
+	reactivatePath := fmt.Sprintf("/api/users/%s/reactivate", member.ID)
+	login := func() *http.Response {
+		return performJSONRequest(t, env.app, http.MethodPost, "/api/auth/login", map[string]any{
+			"email":    member.Email,
+			"password": "password123",
+		}, nil)
+	}
+
+	t.Run("non-admin cannot suspend", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodPost, suspendPath, nil, authHeaders(otherToken))
+		assertStatus(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("admin cannot suspend themselves", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodPost, fmt.Sprintf("/api/users/%s/suspend", admin.ID), nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusBadRequest)
+	})
+
+	t.Run("suspend blocks sessions and login", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, suspendPath, map[string]any{"reason": "policy review"}, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		data := decodeJSONMap(t, resp)["data"].(map[string]any)
+		if data["status"] != "suspended" || data["suspensionReason"] != "policy review" {
+			t.Fatalf("unexpected suspended user %+v", data)
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/auth/me", nil, authHeaders(memberToken))
+		assertStatus(t, resp, http.StatusForbidden)
+		if body := decodeJSONMap(t, resp); body["code"] != "account_suspended" {
+			t.Fatalf("expected account_suspended, got %+v", body)
+		}
+
+		resp = login()
+		assertStatus(t, resp, http.StatusForbidden)
+		if body := decodeJSONMap(t, resp); body["code"] != "account_suspended" {
+			t.Fatalf("expected account_suspended on login, got %+v", body)
+		}
+
+		resp = performRequest(t, env.app, http.MethodPost, suspendPath, nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusConflict)
+	})
+
+	t.Run("suspended users are listed and hidden from search", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/users/?status=suspended", nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		if data := decodeJSONMap(t, resp)["data"].([]any); len(data) != 1 {
+			t.Fatalf("expected one suspended user, got %d", len(data))
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/users/search?search=suspend-member", nil, authHeaders(otherToken))
+		assertStatus(t, resp, http.StatusOK)
+		if data := decodeJSONMap(t, resp)["data"].([]any); len(data) != 0 {
+			t.Fatalf("expected suspended user to be hidden from search, got %v", data)
+		}
+	})
+
+	t.Run("reactivate restores login but not old sessions", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodPost, reactivatePath, nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusOK)
+		if data := decodeJSONMap(t, resp)["data"].(map[string]any); data["status"] != "active" {
+			t.Fatalf("expected active status, got %v", data["status"])
+		}
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/auth/me", nil, authHeaders(memberToken))
+		assertStatus(t, resp, http.StatusUnauthorized)
+		if body := decodeJSONMap(t, resp); body["code"] != "session_revoked" {
+			t.Fatalf("expected session_revoked, got %+v", body)
+		}
+
+		// JWT issue times have one-second resolution; move the revocation
+		// into the past so a token minted now is unambiguously newer.
+		env.db.Model(&models.User{}).Where("id = ?", member.ID).Update("sessions_revoked_at", time.Now().Add(-2*time.Second))
+		resp = login()
+		assertStatus(t, resp, http.StatusOK)
+		token := decodeJSONMap(t, resp)["data"].(map[string]any)["token"].(string)
+		resp = performRequest(t, env.app, http.MethodGet, "/api/auth/me", nil, authHeaders(token))
+		assertStatus(t, resp, http.StatusOK)
+
+		resp = performRequest(t, env.app, http.MethodPost, reactivatePath, nil, authHeaders(adminToken))
+		assertStatus(t, resp, http.StatusConflict)
+	})
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// VaultsHandler serves the keys behind end-to-end encrypted folders: the
+// public keys users register and the folder keys wrapped for them.
+type VaultsHandler struct {
+	DB     *gorm.DB
+	Vaults *services.Vaults
+	Access *services.AccessService
+	Audit  *services.AuditService
+}
+
+func NewVaultsHandler(db *gorm.DB, vaults *services.Vaults, access *services.AccessService, audit *services.AuditService) *VaultsHandler {
+	return &VaultsHandler{DB: db, Vaults: vaults, Access: access, Audit: audit}
+}
+
+type registerKeyRequest struct {
+	Name      string `json:"name"`
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"publicKey"`
+}
+
+// ListKeys returns the current user's public keys.
+func (h *VaultsHandler) ListKeys(c *fiber.Ctx) error {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	keys, err := h.Vaults.Keys(c.Context(), user.ID)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading keys")
+	}
+	return utils.Success(c, fiber.StatusOK, keys)
+}
+
+// RegisterKey adds a public key for the current user.
+func (h *VaultsHandler) RegisterKey(c *fiber.Ctx) error {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	var req registerKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return utils.Error(c, fiber.StatusBadRequest, "name must be 1 to 100 characters")
+	}
+
+	key, err := h.Vaults.RegisterKey(c.Context(), user.ID, name, req.Algorithm, req.PublicKey)
+	if err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "internal_error", "failed registering key")))
+	}
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &user.ID,
+		Action:       "user.key_register",
+		ResourceType: "user",
+		ResourceID:   &user.ID,
+		Details:      map[string]interface{}{"key_id": key.ID.String(), "name": key.Name, "fingerprint": key.Fingerprint},
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+	return utils.Success(c, fiber.StatusCreated, key)
+}
+
+// DeleteKey removes one of the current user's keys.
+func (h *VaultsHandler) DeleteKey(c *fiber.Ctx) error {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	keyID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, "invalid key id")
+	}
+	if err := h.Vaults.DeleteKey(c.Context(), user.ID, keyID); err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "internal_error", "failed deleting key")))
+	}
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &user.ID,
+		Action:       "user.key_delete",
+		ResourceType: "user",
+		ResourceID:   &user.ID,
+		Details:      map[string]interface{}{"key_id": keyID.String()},
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+	return utils.Success(c, fiber.StatusOK, fiber.Map{"message": "key deleted"})
+}
+
+// UserKeys returns another user's public keys, so that a vault can be
+// shared with them.
+func (h *VaultsHandler) UserKeys(c *fiber.Ctx) error {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	targetID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return utils.Fail(c, errInvalidUserID)
+	}
+	var target models.User
+	if err := h.DB.Scopes(services.OrganizationScope("users", user.OrganizationID)).Select("id").First(&target, "id = ?", targetID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utils.Fail(c, errUserNotFound)
+		}
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading user")
+	}
+	keys, err := h.Vaults.Keys(c.Context(), target.ID)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading keys")
+	}
+	return utils.Success(c, fiber.StatusOK, keys)
+}
+
+type vaultResponse struct {
+	VaultID uuid.UUID         `json:"vaultID"`
+	Keys    []models.VaultKey `json:"keys"`
+}
+
+// Get returns the vault a file is in and its key wrapped for each of the
+// current user's keys.
+func (h *VaultsHandler) Get(c *fiber.Ctx) error {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	vaultID, apiErr := h.vaultOf(c, user)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	keys, err := h.Vaults.WrappedKeys(c.Context(), vaultID, user.ID)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading keys")
+	}
+	return utils.Success(c, fiber.StatusOK, vaultResponse{VaultID: vaultID, Keys: keys})
+}
+
+// AddKey stores the vault's key wrapped for another of the current user's
+// keys, e.g. one registered on a new device.
+func (h *VaultsHandler) AddKey(c *fiber.Ctx) error {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		return utils.Fail(c, errUnauthorized)
+	}
+	vaultID, apiErr := h.vaultOf(c, user)
+	if apiErr != nil {
+		return utils.Fail(c, apiErr)
+	}
+	var req services.WrappedKey
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Fail(c, errInvalidBody)
+	}
+	if err := h.Vaults.StoreWrappedKeys(h.DB.WithContext(c.Context()), vaultID, user.ID, user.ID, []services.WrappedKey{req}); err != nil {
+		return utils.Fail(c, serviceError(err, utils.NewError(fiber.StatusInternalServerError, "internal_error", "failed storing key")))
+	}
+	h.Audit.LogAsync(services.AuditEntry{
+		UserID:       &user.ID,
+		Action:       "vault.key_add",
+		ResourceType: "file",
+		ResourceID:   &vaultID,
+		Details:      map[string]interface{}{"key_id": req.KeyID.String()},
+		IPAddress:    c.IP(),
+		RequestID:    getRequestID(c),
+	})
+	keys, err := h.Vaults.WrappedKeys(c.Context(), vaultID, user.ID)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed loading keys")
+	}
+	return utils.Success(c, fiber.StatusOK, vaultResponse{VaultID: vaultID, Keys: keys})
+}
+
+// vaultOf returns the vault of the file in :id, which user must be able to
+// view.
+func (h *VaultsHandler) vaultOf(c *fiber.Ctx, user *models.User) (uuid.UUID, *utils.APIError) {
+	fileID, err := parseUUID(c.Params("id"))
+	if err != nil {
+		return uuid.Nil, errInvalidFileID
+	}
+	if !h.Access.HasAccess(c.Context(), user.ID, fileID, models.SharePermissionView) {
+		return uuid.Nil, errFileNotFound
+	}
+	var file models.File
+	if err := h.DB.Select("id", "vault_id").First(&file, "id = ?", fileID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return uuid.Nil, errFileNotFound
+		}
+		return uuid.Nil, errLoadingFile
+	}
+	if file.VaultID == nil {
+		return uuid.Nil, serviceError(services.ErrVaultNotFound, nil)
+	}
+	return *file.VaultID, nil
+}
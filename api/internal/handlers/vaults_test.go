@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestVaults(t *testing.T) {
+	env := setupTestEnv(t)
+	owner, ownerToken := createTestUser(t, env.db, "vault-owner@test.com", "password123", models.UserRoleUser)
+	friend, friendToken := createTestUser(t, env.db, "vault-friend@test.com", "password123", models.UserRoleUser)
+
+	registerKey := func(token string, seed byte) string {
+		t.Helper()
+		public := make([]byte, 32)
+		public[0] = seed
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/auth/me/keys", map[string]any{
+			"name": "laptop", "publicKey": base64.StdEncoding.EncodeToString(public),
+		}, authHeaders(token))
+		assertStatus(t, resp, http.StatusCreated)
+		return decodeJSONMap(t, resp)["data"].(map[string]any)["id"].(string)
+	}
+	wrapped := base64.StdEncoding.EncodeToString([]byte("wrapped-folder-key"))
+	ownerKey := registerKey(ownerToken, 1)
+	friendKey := registerKey(friendToken, 2)
+
+	resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/directory", map[string]any{
+		"name": "Secrets", "vault": true,
+	}, authHeaders(ownerToken))
+	if body := decodeJSONMap(t, resp); resp.StatusCode != http.StatusBadRequest || body["code"] != "vault_keys_required" {
+		t.Fatalf("expected vault_keys_required, got %d %v", resp.StatusCode, body)
+	}
+
+	resp = performJSONRequest(t, env.app, http.MethodPost, "/api/files/directory", map[string]any{
+		"name": "Secrets", "vault": true,
+		"vaultKeys": []map[string]any{{"keyID": ownerKey, "wrappedKey": wrapped}},
+	}, authHeaders(ownerToken))
+	assertStatus(t, resp, http.StatusCreated)
+	vault := decodeJSONMap(t, resp)["data"].(map[string]any)
+	vaultID := vault["id"].(string)
+	if vault["vaultID"] != vaultID {
+		t.Fatalf("expected the folder to be its own vault, got %v", vault["vaultID"])
+	}
+
+	var secret models.File
+	if err := env.db.Where("id = ?", vaultID).First(&secret).Error; err != nil {
+		t.Fatalf("failed loading vault: %v", err)
+	}
+	file := models.File{Name: "notes.txt.enc", MimeType: "application/octet-stream", OwnerID: owner.ID, ParentID: &secret.ID, StoragePath: "notes"}
+	if err := env.db.Create(&file).Error; err != nil {
+		t.Fatalf("failed creating file: %v", err)
+	}
+	if file.VaultID == nil || *file.VaultID != secret.ID {
+		t.Fatalf("expected a file created in the vault to inherit it, got %v", file.VaultID)
+	}
+
+	t.Run("wrapped keys", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/"+file.ID.String()+"/vault", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		keys := decodeJSONMap(t, resp)["data"].(map[string]any)["keys"].([]any)
+		if len(keys) != 1 || keys[0].(map[string]any)["wrappedKey"] != wrapped {
+			t.Fatalf("expected the owner's wrapped key, got %v", keys)
+		}
+	})
+
+	t.Run("server refuses to read vault content", func(t *testing.T) {
+		resp := performRequest(t, env.app, http.MethodGet, "/api/files/"+file.ID.String()+"/preview", nil, authHeaders(ownerToken))
+		if body := decodeJSONMap(t, resp); resp.StatusCode != http.StatusConflict || body["code"] != "vault_content" {
+			t.Fatalf("expected vault_content, got %d %v", resp.StatusCode, body)
+		}
+		resp = performRequest(t, env.app, http.MethodGet, "/api/files/search?q=notes", nil, authHeaders(ownerToken))
+		assertStatus(t, resp, http.StatusOK)
+		if results := decodeJSONMap(t, resp)["data"].([]any); len(results) != 0 {
+			t.Fatalf("expected search to skip vault files, got %v", results)
+		}
+	})
+
+	t.Run("contents stay in the vault", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPut, "/api/files/"+file.ID.String(), map[string]any{"parentID": ""}, authHeaders(ownerToken))
+		if body := decodeJSONMap(t, resp); resp.StatusCode != http.StatusBadRequest || body["code"] != "vault_move" {
+			t.Fatalf("expected vault_move, got %d %v", resp.StatusCode, body)
+		}
+		resp = performJSONRequest(t, env.app, http.MethodPost, "/api/files/directory", map[string]any{
+			"name": "Inner", "parentID": vaultID, "vault": true,
+			"vaultKeys": []map[string]any{{"keyID": ownerKey, "wrappedKey": wrapped}},
+		}, authHeaders(ownerToken))
+		if body := decodeJSONMap(t, resp); resp.StatusCode != http.StatusBadRequest || body["code"] != "vault_nested" {
+			t.Fatalf("expected vault_nested, got %d %v", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("sharing", func(t *testing.T) {
+		resp := performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+vaultID+"/share", map[string]any{
+			"shareType": "public_anyone", "permission": "view",
+		}, authHeaders(ownerToken))
+		if body := decodeJSONMap(t, resp); resp.StatusCode != http.StatusBadRequest || body["code"] != "vault_share_unsupported" {
+			t.Fatalf("expected vault_share_unsupported, got %d %v", resp.StatusCode, body)
+		}
+
+		share := func(keyID string) *http.Response {
+			return performJSONRequest(t, env.app, http.MethodPost, "/api/files/"+vaultID+"/share", map[string]any{
+				"userID": friend.ID.String(), "permission": "view",
+				"vaultKeys": []map[string]any{{"keyID": keyID, "wrappedKey": wrapped}},
+			}, authHeaders(ownerToken))
+		}
+		resp = share(ownerKey)
+		if body := decodeJSONMap(t, resp); resp.StatusCode != http.StatusBadRequest || body["code"] != "vault_key_not_owned" {
+			t.Fatalf("expected vault_key_not_owned, got %d %v", resp.StatusCode, body)
+		}
+		assertStatus(t, share(friendKey), http.StatusCreated)
+
+		resp = performRequest(t, env.app, http.MethodGet, "/api/files/"+vaultID+"/vault", nil, authHeaders(friendToken))
+		assertStatus(t, resp, http.StatusOK)
+		keys := decodeJSONMap(t, resp)["data"].(map[string]any)["keys"].([]any)
+		if len(keys) != 1 || keys[0].(map[string]any)["keyID"] != friendKey {
+			t.Fatalf("expected the folder key wrapped for the recipient, got %v", keys)
+		}
+	})
+}
@@ -1,6 +1,11 @@
 package handlers
 
 import (
+	"strings"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/middleware"
+	"github.com/docshare/api/internal/services"
 	"github.com/docshare/api/pkg/utils"
 	"github.com/gofiber/fiber/v2"
 )
@@ -10,16 +15,113 @@ import (
 //	go build -ldflags "-X github.com/docshare/api/internal/handlers.Version=1.2.3"
 var Version = "dev"
 
-const apiVersion = "v1"
+// VersionHandler reports the server version along with what this
+// deployment has enabled, so clients can hide features instead of calling
+// endpoints that will refuse them.
+type VersionHandler struct {
+	Cfg          *config.Config
+	Settings     *services.SettingsService
+	Providers    *services.SSOProviderRegistry
+	Integrations *services.Integrations
+	// PageRendering reports whether PDFs can be rendered as page images.
+	PageRendering bool
+}
+
+func NewVersionHandler(cfg *config.Config, settings *services.SettingsService, providers *services.SSOProviderRegistry, integrations *services.Integrations) *VersionHandler {
+	return &VersionHandler{Cfg: cfg, Settings: settings, Providers: providers, Integrations: integrations}
+}
 
 type versionResponse struct {
 	Version    string `json:"version"`
 	APIVersion string `json:"apiVersion"`
+	// SupportedVersions lists the versions a client may name in the path
+	// (/api/v1/...) or in the API-Version header.
+	SupportedVersions []string     `json:"supportedVersions"`
+	Capabilities      capabilities `json:"capabilities"`
+}
+
+type capabilities struct {
+	// Registration is the registration.mode setting.
+	Registration  string                     `json:"registration"`
+	SSOProviders  []services.SSOProviderInfo `json:"ssoProviders"`
+	PublicSharing bool                       `json:"publicSharing"`
+	Transfers     bool                       `json:"transfers"`
+	Uploads       uploadCapabilities         `json:"uploads"`
+	Previews      previewCapabilities        `json:"previews"`
+	Imports       importCapabilities         `json:"imports"`
+}
+
+type uploadCapabilities struct {
+	MaxBytes int64 `json:"maxBytes"`
+	// MaxBodyBytes caps request bodies of ordinary JSON endpoints.
+	MaxBodyBytes int64 `json:"maxBodyBytes"`
+	// MaxTransferChunkBytes caps each chunk sent to the transfer relay.
+	MaxTransferChunkBytes int64 `json:"maxTransferChunkBytes"`
+	// Presigned uploads go straight to storage through
+	// /files/upload/presign and /files/upload/finalize.
+	Presigned bool `json:"presigned"`
+	// Chunked uploads can be resumed after a dropped connection, using the
+	// TUS protocol at /tus.
+	Chunked bool `json:"chunked"`
+}
+
+type previewCapabilities struct {
+	// ImageTypes get a generated thumbnail.
+	ImageTypes []string `json:"imageTypes"`
+	// OfficeExtensions are converted to PDF; empty when no converter is
+	// configured.
+	OfficeExtensions []string `json:"officeExtensions"`
+	// Text covers plain text, Markdown and source code.
+	Text bool `json:"text"`
+	// Pages is whether PDFs and Office documents can be shown as page
+	// images, the only preview of files shared view-only. Images always
+	// can.
+	Pages bool `json:"pages"`
 }
 
-func GetVersion(c *fiber.Ctx) error {
+type importCapabilities struct {
+	GoogleDrive bool `json:"googleDrive"`
+	WebDAV      bool `json:"webdav"`
+}
+
+func (h *VersionHandler) Get(c *fiber.Ctx) error {
+	ctx := c.Context()
+
+	providers := []services.SSOProviderInfo{}
+	if tenant, err := h.Providers.For(ctx, middleware.GetOrganizationID(c)); err == nil && tenant.Providers != nil {
+		providers = tenant.Providers
+	}
+	office := []string{}
+	if strings.TrimSpace(h.Cfg.Gotenberg.URL) != "" {
+		office = services.OfficePreviewExtensions
+	}
+
 	return utils.Success(c, fiber.StatusOK, versionResponse{
-		Version:    Version,
-		APIVersion: apiVersion,
+		Version:           Version,
+		APIVersion:        middleware.CurrentAPIVersion,
+		SupportedVersions: middleware.SupportedAPIVersions,
+		Capabilities: capabilities{
+			Registration:  h.Settings.RegistrationMode(ctx),
+			SSOProviders:  providers,
+			PublicSharing: h.Settings.PublicSharingEnabled(ctx),
+			Transfers:     true,
+			Uploads: uploadCapabilities{
+				MaxBytes:              h.Settings.MaxUploadBytes(ctx),
+				MaxBodyBytes:          h.Cfg.BodyLimits.JSONBytes,
+				MaxTransferChunkBytes: h.Cfg.BodyLimits.TransferChunkBytes,
+				Presigned:             true,
+				Chunked:               true,
+			},
+			Previews: previewCapabilities{
+				ImageTypes:       services.ThumbnailableImageTypes,
+				OfficeExtensions: office,
+				Text:             true,
+				Pages:            h.PageRendering,
+			},
+			Imports: importCapabilities{
+				GoogleDrive: h.Integrations.GoogleDriveEnabled(),
+				WebDAV:      true,
+			},
+		},
 	})
 }
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/docshare/api/internal/config"
 	"github.com/docshare/api/internal/middleware"
 	"github.com/docshare/api/internal/models"
 	"github.com/docshare/api/internal/services"
@@ -21,10 +22,13 @@ type WebAuthnHandler struct {
 	DB       *gorm.DB
 	WebAuthn *webauthn.WebAuthn
 	Audit    *services.AuditService
+	Policy   *services.AuthenticatorPolicy
+	Recovery config.MFAConfig
+	Sessions *services.SessionService
 }
 
-func NewWebAuthnHandler(db *gorm.DB, wa *webauthn.WebAuthn, audit *services.AuditService) *WebAuthnHandler {
-	return &WebAuthnHandler{DB: db, WebAuthn: wa, Audit: audit}
+func NewWebAuthnHandler(db *gorm.DB, wa *webauthn.WebAuthn, audit *services.AuditService, policy *services.AuthenticatorPolicy, recovery config.MFAConfig, sessions *services.SessionService) *WebAuthnHandler {
+	return &WebAuthnHandler{DB: db, WebAuthn: wa, Audit: audit, Policy: policy, Recovery: recovery, Sessions: sessions}
 }
 
 type webAuthnUser struct {
@@ -95,7 +99,7 @@ func (h *WebAuthnHandler) loadWebAuthnUser(userID uuid.UUID) (*webAuthnUser, err
 func (h *WebAuthnHandler) RegisterBegin(c *fiber.Ctx) error {
 	user := middleware.GetCurrentUser(c)
 	if user == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	waUser, err := h.loadWebAuthnUser(user.ID)
@@ -138,12 +142,12 @@ type registerFinishRequest struct {
 func (h *WebAuthnHandler) RegisterFinish(c *fiber.Ctx) error {
 	user := middleware.GetCurrentUser(c)
 	if user == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var req registerFinishRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	if req.Name == "" {
@@ -177,6 +181,29 @@ func (h *WebAuthnHandler) RegisterFinish(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusBadRequest, "failed to verify credential")
 	}
 
+	attestation := parsedResponse.Response.AttestationObject
+	attested := services.AttestationCertified(attestation.Format, attestation.AttStatement)
+	if err := h.Policy.CheckRegistration(credential.Authenticator.AAGUID, attested); err != nil {
+		details := map[string]interface{}{
+			"attestation_format": attestation.Format,
+			"reason":             err.Error(),
+		}
+		if info := services.LookupAuthenticator(credential.Authenticator.AAGUID); info != nil {
+			details["aaguid"] = info.AAGUID
+			details["authenticator"] = info.Name
+		}
+		h.Audit.LogAsync(services.AuditEntry{
+			UserID:       &user.ID,
+			Action:       "mfa.passkey_rejected",
+			ResourceType: "user",
+			ResourceID:   &user.ID,
+			Details:      details,
+			IPAddress:    c.IP(),
+			RequestID:    getRequestID(c),
+		})
+		return utils.Fail(c, errPasskeyNotAllowed.WithMessage(err.Error()))
+	}
+
 	var transportsJSON []byte
 	if len(credential.Transport) > 0 {
 		ts := make([]string, len(credential.Transport))
@@ -197,6 +224,7 @@ func (h *WebAuthnHandler) RegisterFinish(c *fiber.Ctx) error {
 		Transports:      string(transportsJSON),
 		BackupEligible:  credential.Flags.BackupEligible,
 		BackupState:     credential.Flags.BackupState,
+		Attested:        attested,
 	}
 	if err := h.DB.Create(&dbCred).Error; err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed to save credential")
@@ -215,14 +243,10 @@ func (h *WebAuthnHandler) RegisterFinish(c *fiber.Ctx) error {
 	}
 
 	if mfaCfg.RecoveryCount == 0 {
-		codes, hashedCodes, err := generateRecoveryCodes(10)
-		if err == nil {
-			codesJSON, _ := json.Marshal(hashedCodes)
-			h.DB.Model(&mfaCfg).Updates(map[string]interface{}{
-				"recovery_codes": string(codesJSON),
-				"recovery_count": len(codes),
-			})
-			response["recoveryCodes"] = codes
+		if codes, downloadExpiresAt, err := issueRecoveryCodes(h.DB, &mfaCfg, h.Recovery, nil); err == nil {
+			for k, v := range recoveryCodesResponse(c, codes, downloadExpiresAt) {
+				response[k] = v
+			}
 		}
 	}
 
@@ -254,12 +278,12 @@ type verifyWebAuthnBeginRequest struct {
 func (h *WebAuthnHandler) VerifyBegin(c *fiber.Ctx) error {
 	var req verifyWebAuthnBeginRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	claims, err := utils.ValidateMFAToken(req.MFAToken)
 	if err != nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "invalid or expired MFA token")
+		return utils.Fail(c, errInvalidMFAToken)
 	}
 
 	waUser, err := h.loadWebAuthnUser(claims.UserID)
@@ -298,16 +322,16 @@ type verifyWebAuthnFinishRequest struct {
 func (h *WebAuthnHandler) VerifyFinish(c *fiber.Ctx) error {
 	var req verifyWebAuthnFinishRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	claims, err := utils.ValidateMFAToken(req.MFAToken)
 	if err != nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "invalid or expired MFA token")
+		return utils.Fail(c, errInvalidMFAToken)
 	}
 
 	if !utils.IsJTIValid(claims.JTI) {
-		return utils.Error(c, fiber.StatusUnauthorized, "MFA token already used")
+		return utils.Fail(c, errMFATokenUsed)
 	}
 
 	waUser, err := h.loadWebAuthnUser(claims.UserID)
@@ -336,6 +360,9 @@ func (h *WebAuthnHandler) VerifyFinish(c *fiber.Ctx) error {
 	if err != nil {
 		return utils.Error(c, fiber.StatusUnauthorized, "passkey verification failed")
 	}
+	if err := h.Policy.AllowsAuthenticator(credential.Authenticator.AAGUID); err != nil {
+		return utils.Fail(c, errPasskeyNotAllowed)
+	}
 
 	h.DB.Where("id = ?", challenge.ID).Delete(&models.MFAChallenge{})
 
@@ -349,7 +376,10 @@ func (h *WebAuthnHandler) VerifyFinish(c *fiber.Ctx) error {
 
 	utils.ConsumeJTI(claims.JTI)
 
-	token, err := utils.GenerateToken(&waUser.user)
+	if waUser.user.IsSuspended() {
+		return utils.Fail(c, middleware.ErrAccountSuspended)
+	}
+	token, err := issueToken(c, h.Sessions, &waUser.user, "passkey_mfa")
 	if err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed generating token")
 	}
@@ -407,7 +437,7 @@ type loginFinishRequest struct {
 func (h *WebAuthnHandler) LoginFinish(c *fiber.Ctx) error {
 	var req loginFinishRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	challengeID, err := parseUUID(req.ChallengeID)
@@ -453,6 +483,9 @@ func (h *WebAuthnHandler) LoginFinish(c *fiber.Ctx) error {
 	if err != nil {
 		return utils.Error(c, fiber.StatusUnauthorized, "passkey verification failed")
 	}
+	if err := h.Policy.AllowsAuthenticator(credential.Authenticator.AAGUID); err != nil {
+		return utils.Fail(c, errPasskeyNotAllowed)
+	}
 
 	h.DB.Where("id = ?", challenge.ID).Delete(&models.MFAChallenge{})
 
@@ -464,7 +497,10 @@ func (h *WebAuthnHandler) LoginFinish(c *fiber.Ctx) error {
 			"last_used_at": now,
 		})
 
-	token, err := utils.GenerateToken(&waUser.user)
+	if waUser.user.IsSuspended() {
+		return utils.Fail(c, middleware.ErrAccountSuspended)
+	}
+	token, err := issueToken(c, h.Sessions, &waUser.user, "passkey")
 	if err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, "failed generating token")
 	}
@@ -488,13 +524,31 @@ func (h *WebAuthnHandler) LoginFinish(c *fiber.Ctx) error {
 func (h *WebAuthnHandler) List(c *fiber.Ctx) error {
 	user := middleware.GetCurrentUser(c)
 	if user == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	var creds []models.WebAuthnCredential
 	h.DB.Where("user_id = ?", user.ID).Order("created_at DESC").Find(&creds)
 
-	return utils.Success(c, fiber.StatusOK, creds)
+	out := make([]passkeyResponse, 0, len(creds))
+	for _, cred := range creds {
+		out = append(out, passkeyResponse{
+			WebAuthnCredential: cred,
+			AttestationFormat:  cred.AttestationType,
+			Authenticator:      services.LookupAuthenticator(cred.AAGUID),
+			PolicyCompliant:    h.Policy.Compliant(cred.AAGUID, cred.Attested),
+		})
+	}
+	return utils.Success(c, fiber.StatusOK, out)
+}
+
+// passkeyResponse adds what is known about the authenticator behind a
+// passkey, and whether the current policy would still accept it.
+type passkeyResponse struct {
+	models.WebAuthnCredential
+	AttestationFormat string                      `json:"attestationFormat"`
+	Authenticator     *services.AuthenticatorInfo `json:"authenticator"`
+	PolicyCompliant   bool                        `json:"policyCompliant"`
 }
 
 type renamePasskeyRequest struct {
@@ -504,7 +558,7 @@ type renamePasskeyRequest struct {
 func (h *WebAuthnHandler) Rename(c *fiber.Ctx) error {
 	user := middleware.GetCurrentUser(c)
 	if user == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	credID, err := parseUUID(c.Params("id"))
@@ -514,7 +568,7 @@ func (h *WebAuthnHandler) Rename(c *fiber.Ctx) error {
 
 	var req renamePasskeyRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+		return utils.Fail(c, errInvalidBody)
 	}
 
 	if req.Name == "" {
@@ -525,7 +579,7 @@ func (h *WebAuthnHandler) Rename(c *fiber.Ctx) error {
 		Where("id = ? AND user_id = ?", credID, user.ID).
 		Update("name", req.Name)
 	if result.RowsAffected == 0 {
-		return utils.Error(c, fiber.StatusNotFound, "passkey not found")
+		return utils.Fail(c, errPasskeyNotFound)
 	}
 
 	var cred models.WebAuthnCredential
@@ -537,7 +591,7 @@ func (h *WebAuthnHandler) Rename(c *fiber.Ctx) error {
 func (h *WebAuthnHandler) Delete(c *fiber.Ctx) error {
 	user := middleware.GetCurrentUser(c)
 	if user == nil {
-		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		return utils.Fail(c, errUnauthorized)
 	}
 
 	credID, err := parseUUID(c.Params("id"))
@@ -547,7 +601,7 @@ func (h *WebAuthnHandler) Delete(c *fiber.Ctx) error {
 
 	var cred models.WebAuthnCredential
 	if err := h.DB.First(&cred, "id = ? AND user_id = ?", credID, user.ID).Error; err != nil {
-		return utils.Error(c, fiber.StatusNotFound, "passkey not found")
+		return utils.Fail(c, errPasskeyNotFound)
 	}
 
 	if err := h.DB.Unscoped().Delete(&cred).Error; err != nil {
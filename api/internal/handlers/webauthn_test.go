@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestPasskeyList(t *testing.T) {
+	env := setupTestEnv(t)
+	user, token := createTestUser(t, env.db, "passkeys@test.com", "password123", models.UserRoleUser)
+
+	aaguid := func(s string) []byte {
+		b, _ := uuid.MustParse(s).MarshalBinary()
+		return b
+	}
+	for _, cred := range []models.WebAuthnCredential{
+		{UserID: user.ID, CredentialID: []byte("cred-yubikey"), PublicKey: []byte("pk"), Name: "Desk key", AttestationType: "packed", Attested: true, AAGUID: aaguid("cb69481e-8ff7-4039-93ec-0a2729a154a8")},
+		{UserID: user.ID, CredentialID: []byte("cred-denied"), PublicKey: []byte("pk"), Name: "Password manager", AttestationType: "none", AAGUID: aaguid(testDeniedAAGUID)},
+	} {
+		if err := env.db.Create(&cred).Error; err != nil {
+			t.Fatalf("create credential: %v", err)
+		}
+	}
+
+	resp := performRequest(t, env.app, http.MethodGet, "/api/auth/passkeys/", nil, authHeaders(token))
+	body := decodeJSONMap(t, resp)
+	assertStatus(t, resp, http.StatusOK)
+
+	byName := map[string]map[string]any{}
+	for _, item := range body["data"].([]any) {
+		p := item.(map[string]any)
+		byName[p["name"].(string)] = p
+	}
+
+	key := byName["Desk key"]
+	authenticator, _ := key["authenticator"].(map[string]any)
+	if authenticator["name"] != "YubiKey 5 Series" || authenticator["kind"] != "security-key" {
+		t.Fatalf("expected YubiKey metadata, got %v", key["authenticator"])
+	}
+	if key["attested"] != true || key["attestationFormat"] != "packed" || key["policyCompliant"] != true {
+		t.Fatalf("unexpected attestation details: %v", key)
+	}
+	if byName["Password manager"]["policyCompliant"] != false {
+		t.Fatalf("expected the denied authenticator to be flagged, got %v", byName["Password manager"])
+	}
+}
@@ -0,0 +1,146 @@
+// Package i18n holds the server-side translation catalog for user-facing
+// strings such as activity messages. Catalogs live in locales/<tag>.json
+// and are embedded at build time.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale is used when no requested locale is supported, and is the
+// fallback for keys missing from another catalog.
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+var catalogs = mustLoadCatalogs()
+
+func mustLoadCatalogs() map[string]map[string]string {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	out := make(map[string]map[string]string, len(entries))
+	for _, entry := range entries {
+		raw, err := localeFiles.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(raw, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: parsing %s: %v", entry.Name(), err))
+		}
+		out[strings.TrimSuffix(entry.Name(), ".json")] = messages
+	}
+	if _, ok := out[DefaultLocale]; !ok {
+		panic("i18n: missing default catalog")
+	}
+	return out
+}
+
+// Locales lists the supported locale tags in sorted order.
+func Locales() []string {
+	out := make([]string, 0, len(catalogs))
+	for tag := range catalogs {
+		out = append(out, tag)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Supported resolves tag (e.g. "de", "de-AT", "DE_at") to a supported
+// locale, reporting false when there is none.
+func Supported(tag string) (string, bool) {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if tag == "" {
+		return "", false
+	}
+	if _, ok := catalogs[tag]; ok {
+		return tag, true
+	}
+	if base, _, found := strings.Cut(tag, "-"); found {
+		if _, ok := catalogs[base]; ok {
+			return base, true
+		}
+	}
+	return "", false
+}
+
+// Negotiate picks the locale for a request. Explicit preferences are tried
+// in order, then the Accept-Language header; DefaultLocale wins otherwise.
+func Negotiate(acceptLanguage string, preferred ...string) string {
+	for _, tag := range preferred {
+		if locale, ok := Supported(tag); ok {
+			return locale
+		}
+	}
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		if locale, ok := Supported(tag); ok {
+			return locale
+		}
+	}
+	return DefaultLocale
+}
+
+// parseAcceptLanguage returns the tags of an Accept-Language header ordered
+// by descending quality.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	out := make([]string, len(tags))
+	for i, t := range tags {
+		out[i] = t.tag
+	}
+	return out
+}
+
+// T renders key in locale, substituting {name} placeholders from params.
+// Missing keys fall back to DefaultLocale, then to the key itself.
+func T(locale, key string, params map[string]string) string {
+	msg, ok := catalogs[locale][key]
+	if !ok {
+		if msg, ok = catalogs[DefaultLocale][key]; !ok {
+			return key
+		}
+	}
+	if len(params) == 0 || !strings.Contains(msg, "{") {
+		return msg
+	}
+	pairs := make([]string, 0, len(params)*2)
+	for k, v := range params {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(msg)
+}
+
+// Has reports whether key exists in the default catalog.
+func Has(key string) bool {
+	_, ok := catalogs[DefaultLocale][key]
+	return ok
+}
@@ -0,0 +1,81 @@
+package i18n
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+)
+
+func TestCatalogsCoverDefaultKeys(t *testing.T) {
+	placeholder := regexp.MustCompile(`\{[a-z_]+\}`)
+	for _, locale := range Locales() {
+		for key, english := range catalogs[DefaultLocale] {
+			msg, ok := catalogs[locale][key]
+			if !ok {
+				t.Errorf("%s: missing key %q", locale, key)
+				continue
+			}
+			want := placeholder.FindAllString(english, -1)
+			got := placeholder.FindAllString(msg, -1)
+			sort.Strings(want)
+			sort.Strings(got)
+			if len(want) != len(got) {
+				t.Errorf("%s: %q placeholders %v, want %v", locale, key, got, want)
+				continue
+			}
+			for i := range want {
+				if want[i] != got[i] {
+					t.Errorf("%s: %q placeholders %v, want %v", locale, key, got, want)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestSupported(t *testing.T) {
+	cases := map[string]string{"de": "de", "de-AT": "de", "FR_ca": "fr", "en": "en", "xx": "", "": ""}
+	for in, want := range cases {
+		got, ok := Supported(in)
+		if got != want || ok != (want != "") {
+			t.Errorf("Supported(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	cases := []struct {
+		accept    string
+		preferred []string
+		want      string
+	}{
+		{"", nil, "en"},
+		{"fr-CH, fr;q=0.9, en;q=0.8", nil, "fr"},
+		{"xx, es;q=0.2, de;q=0.7", nil, "de"},
+		{"de", []string{"", "es"}, "es"},
+		{"de", []string{"xx"}, "de"},
+		{"*;q=0.5", nil, "en"},
+	}
+	for _, tc := range cases {
+		if got := Negotiate(tc.accept, tc.preferred...); got != tc.want {
+			t.Errorf("Negotiate(%q, %v) = %q, want %q", tc.accept, tc.preferred, got, tc.want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	params := map[string]string{"actor": "Ada", "name": "plan.pdf"}
+	if got := T("de", "activity.share.with_you", params); got != "Ada hat „plan.pdf“ mit Ihnen geteilt" {
+		t.Errorf("unexpected German message %q", got)
+	}
+	if got := T("xx", "activity.share.with_you", params); got != `Ada shared "plan.pdf" with you` {
+		t.Errorf("expected English fallback, got %q", got)
+	}
+	if got := T("en", "no.such.key", nil); got != "no.such.key" {
+		t.Errorf("expected key fallback, got %q", got)
+	}
+	// Parameter values are not re-scanned for placeholders.
+	if got := T("en", "activity.self.file.upload", map[string]string{"name": "{actor}"}); got != `You uploaded "{actor}"` {
+		t.Errorf("unexpected substitution %q", got)
+	}
+}
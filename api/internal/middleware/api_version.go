@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// APIVersionHeader names, on a request, the API version the client was
+// written against and, on a response, the version that served it.
+const APIVersionHeader = "API-Version"
+
+// CurrentAPIVersion is the newest version of the API.
+const CurrentAPIVersion = "v1"
+
+// SupportedAPIVersions lists every version the server still serves.
+var SupportedAPIVersions = []string{"v1"}
+
+// legacyDeprecatedAt is when /api/v1 was introduced and the unversioned
+// paths were deprecated in its favour.
+var legacyDeprecatedAt = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+
+// originalURIKey holds the request URI of a versioned request as the
+// client sent it, before APIVersioning rewrote the path.
+const originalURIKey = "originalRequestURI"
+
+var errUnsupportedAPIVersion = utils.NewError(fiber.StatusBadRequest, "unsupported_api_version", "unsupported API version")
+
+// APIVersioning serves /api/v1 paths with the routes registered under
+// /api. Requests to the unversioned paths are still served, as v1, but
+// their responses carry Deprecation, Sunset and Link headers pointing at
+// the versioned path, unless the request named a version in the
+// API-Version header. /api/version, which clients use to find out what the
+// server supports, is never deprecated. It must run before anything that
+// looks at the path to pick a route.
+func APIVersioning(sunset time.Time) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		path := c.Path()
+		if !strings.HasPrefix(path, "/api/") {
+			return c.Next()
+		}
+
+		if version, rest, ok := versionedPath(path); ok {
+			if !supportedAPIVersion(version) {
+				return utils.Fail(c, errUnsupportedAPIVersion)
+			}
+			// version points into the path buffer, which the rewrite
+			// reuses.
+			c.Set(APIVersionHeader, version)
+			c.Locals(originalURIKey, string(c.Request().RequestURI()))
+			c.Path("/api" + rest)
+			return c.Next()
+		}
+
+		if requested := c.Get(APIVersionHeader); requested != "" {
+			if !supportedAPIVersion(requested) {
+				return utils.Fail(c, errUnsupportedAPIVersion)
+			}
+			c.Set(APIVersionHeader, requested)
+			return c.Next()
+		}
+
+		c.Set(APIVersionHeader, CurrentAPIVersion)
+		if path != "/api/version" {
+			c.Set("Deprecation", "@"+strconv.FormatInt(legacyDeprecatedAt.Unix(), 10))
+			if !sunset.IsZero() {
+				c.Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+			c.Set(fiber.HeaderLink, "</api/"+CurrentAPIVersion+path[len("/api"):]+`>; rel="successor-version"`)
+		}
+		return c.Next()
+	}
+}
+
+// versionedPath splits /api/v<n>/rest into v<n> and /rest.
+func versionedPath(path string) (string, string, bool) {
+	segment, rest, _ := strings.Cut(path[len("/api/"):], "/")
+	if len(segment) < 2 || segment[0] != 'v' {
+		return "", "", false
+	}
+	if _, err := strconv.Atoi(segment[1:]); err != nil {
+		return "", "", false
+	}
+	if rest != "" {
+		rest = "/" + rest
+	}
+	return segment, rest, true
+}
+
+func supportedAPIVersion(version string) bool {
+	for _, v := range SupportedAPIVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// OriginalRequestURI returns the request URI as the client sent it, with
+// any /api/v1 prefix that APIVersioning rewrote away.
+func OriginalRequestURI(c *fiber.Ctx) string {
+	if uri, ok := c.Locals(originalURIKey).(string); ok {
+		return uri
+	}
+	return string(c.Request().RequestURI())
+}
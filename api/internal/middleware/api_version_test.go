@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAPIVersioning(t *testing.T) {
+	sunset := time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC)
+	app := fiber.New()
+	app.Use(APIVersioning(sunset))
+	api := app.Group("/api")
+	api.Get("/files/:id", func(c *fiber.Ctx) error {
+		return c.SendString(c.Params("id"))
+	})
+	api.Get("/version", func(c *fiber.Ctx) error {
+		return c.SendString("version")
+	})
+
+	cases := []struct {
+		name       string
+		path       string
+		version    string
+		wantStatus int
+		wantBody   string
+		deprecated bool
+	}{
+		{"versioned path", "/api/v1/files/abc", "", http.StatusOK, "abc", false},
+		{"legacy path", "/api/files/abc", "", http.StatusOK, "abc", true},
+		{"legacy path naming a version", "/api/files/abc", "v1", http.StatusOK, "abc", false},
+		{"version endpoint", "/api/version", "", http.StatusOK, "version", false},
+		{"unknown version in the path", "/api/v9/files/abc", "", http.StatusBadRequest, "", false},
+		{"unknown version in the header", "/api/files/abc", "v9", http.StatusBadRequest, "", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.version != "" {
+				req.Header.Set(APIVersionHeader, tc.version)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d", tc.wantStatus, resp.StatusCode)
+			}
+			if body, _ := io.ReadAll(resp.Body); tc.wantBody != "" && string(body) != tc.wantBody {
+				t.Fatalf("expected body %q, got %q", tc.wantBody, body)
+			}
+			if got := resp.Header.Get("Deprecation") != ""; got != tc.deprecated {
+				t.Fatalf("expected deprecated=%v, got headers %v", tc.deprecated, resp.Header)
+			}
+			if tc.deprecated {
+				if resp.Header.Get("Sunset") != "Wed, 30 Jun 2027 00:00:00 GMT" {
+					t.Fatalf("unexpected Sunset %q", resp.Header.Get("Sunset"))
+				}
+				if resp.Header.Get("Link") != `</api/v1/files/abc>; rel="successor-version"` {
+					t.Fatalf("unexpected Link %q", resp.Header.Get("Link"))
+				}
+			}
+			if tc.wantStatus == http.StatusOK && resp.Header.Get(APIVersionHeader) != "v1" {
+				t.Fatalf("expected the response to name v1, got %q", resp.Header.Get(APIVersionHeader))
+			}
+		})
+	}
+}
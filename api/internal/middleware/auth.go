@@ -7,37 +7,73 @@ import (
 	"time"
 
 	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
 	"github.com/docshare/api/pkg/logger"
 	"github.com/docshare/api/pkg/utils"
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
 	"gorm.io/gorm"
 )
 
 const currentUserKey = "currentUser"
 const apiTokenPrefix = "dsh_"
 
+var (
+	errInvalidToken    = utils.NewError(fiber.StatusUnauthorized, "invalid_token", "invalid or expired token")
+	errInvalidAPIToken = utils.NewError(fiber.StatusUnauthorized, "invalid_api_token", "invalid API token")
+	errAPITokenExpired = utils.NewError(fiber.StatusUnauthorized, "api_token_expired", "API token has expired")
+	errAdminRequired   = utils.NewError(fiber.StatusForbidden, "admin_required", "admin access required")
+	errSessionRevoked  = utils.NewError(fiber.StatusUnauthorized, "session_revoked", "session has been revoked")
+
+	// ErrAccountSuspended is reported by every authentication path, including
+	// the login handlers, when the user has been suspended by an admin.
+	ErrAccountSuspended = utils.NewError(fiber.StatusForbidden, "account_suspended", "account is suspended")
+
+	// ErrMFAEnrollmentRequired is reported once a user the MFA policy
+	// applies to is past their grace period without having enrolled.
+	ErrMFAEnrollmentRequired = utils.NewError(fiber.StatusForbidden, "mfa_enrollment_required", "multi-factor authentication must be set up to continue")
+
+	// ErrTermsAcceptanceRequired is reported while terms.enforce is on and
+	// the user has not accepted every terms version in force.
+	ErrTermsAcceptanceRequired = utils.NewError(fiber.StatusForbidden, "terms_acceptance_required", "the current terms must be accepted to continue")
+)
+
+const (
+	mfaPolicyKey = "mfaPolicy"
+	sessionKey   = "session"
+)
+
+// mfaEnrollmentPaths are the endpoints users restricted by the MFA policy
+// can still reach: enough to see their account, enroll and manage passkeys.
+var mfaEnrollmentPaths = []string{
+	"/api/auth/me",
+	"/api/auth/mfa/",
+	"/api/auth/passkey/register/",
+	"/api/auth/passkeys",
+}
+
+// termsAcceptancePaths are the endpoints users with pending terms can
+// still reach when acceptance is enforced. They include the MFA enrollment
+// endpoints so a user both policies restrict can satisfy them in turn.
+var termsAcceptancePaths = append([]string{"/api/auth/terms"}, mfaEnrollmentPaths...)
+
 type AuthMiddleware struct {
 	DB *gorm.DB
+	// MFAPolicy, when set, is enforced on every authenticated request.
+	MFAPolicy *services.MFAPolicy
+	// Terms, when set, holds back users who have not accepted the terms in
+	// force while the terms.enforce setting is on.
+	Terms *services.TermsService
+	// Sessions, when set, checks JWTs against their session and tracks the
+	// devices API tokens are used from.
+	Sessions *services.SessionService
+	// HMACKeys, when set, admits requests signed with an HMAC key.
+	HMACKeys *services.HMACKeys
 }
 
 func NewAuthMiddleware(db *gorm.DB) *AuthMiddleware {
 	return &AuthMiddleware{DB: db}
 }
 
-func CORS(frontendURL string) fiber.Handler {
-	origins := frontendURL
-	if strings.Contains(frontendURL, "localhost") {
-		loopback := strings.Replace(frontendURL, "localhost", "127.0.0.1", 1)
-		origins = frontendURL + "," + loopback
-	}
-	return cors.New(cors.Config{
-		AllowOrigins: origins,
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
-		AllowMethods: "GET,POST,PUT,PATCH,DELETE,OPTIONS",
-	})
-}
-
 func (a *AuthMiddleware) RequireAuth(c *fiber.Ctx) error {
 	authHeader := c.Get("Authorization")
 	if authHeader == "" {
@@ -48,6 +84,10 @@ func (a *AuthMiddleware) RequireAuth(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusUnauthorized, "missing authorization header")
 	}
 
+	if strings.HasPrefix(authHeader, services.HMACScheme+" ") {
+		return a.authenticateSignature(c, authHeader)
+	}
+
 	tokenString := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer"))
 	if tokenString == authHeader || tokenString == "" {
 		logger.Warn("auth_invalid_format", map[string]interface{}{
@@ -73,7 +113,7 @@ func (a *AuthMiddleware) authenticateJWT(c *fiber.Ctx, tokenString string) error
 			"path":  c.Path(),
 			"error": err.Error(),
 		})
-		return utils.Error(c, fiber.StatusUnauthorized, "invalid or expired token")
+		return utils.Fail(c, errInvalidToken)
 	}
 
 	var user models.User
@@ -85,11 +125,128 @@ func (a *AuthMiddleware) authenticateJWT(c *fiber.Ctx, tokenString string) error
 		})
 		return utils.Error(c, fiber.StatusUnauthorized, "user not found")
 	}
+	if user.IsSuspended() {
+		return rejectSuspended(c, &user)
+	}
+	if sessionRevoked(&user, claims) {
+		return utils.Fail(c, errSessionRevoked)
+	}
+	if claims.SessionID != "" && a.Sessions != nil {
+		session, err := a.Sessions.Lookup(c.UserContext(), claims.SessionID)
+		if err != nil || session.UserID != user.ID || session.RevokedAt != nil {
+			return utils.Fail(c, errSessionRevoked)
+		}
+		a.Sessions.Touch(c.UserContext(), session, a.clientInfo(c))
+		c.Locals(sessionKey, session)
+	}
+	if !inRequestTenant(c, &user) {
+		return utils.Fail(c, ErrOrganizationMismatch)
+	}
+	restricted, err := a.checkMFAPolicy(c, &user)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed checking MFA policy")
+	}
+	if restricted {
+		return rejectMFAUnenrolled(c, &user)
+	}
+	pending, err := a.termsPending(c, &user)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed checking terms acceptance")
+	}
+	if pending {
+		return utils.Fail(c, ErrTermsAcceptanceRequired)
+	}
 
 	c.Locals(currentUserKey, &user)
 	return c.Next()
 }
 
+// checkMFAPolicy evaluates the MFA policy for user and stores the outcome
+// for GetMFAPolicyStatus. It reports whether the request has to be refused
+// because the user is restricted to MFA enrollment.
+func (a *AuthMiddleware) checkMFAPolicy(c *fiber.Ctx, user *models.User) (bool, error) {
+	if a.MFAPolicy == nil {
+		return false, nil
+	}
+	status, err := a.MFAPolicy.Evaluate(c.UserContext(), user, GetOrganization(c))
+	if err != nil {
+		return false, err
+	}
+	c.Locals(mfaPolicyKey, status)
+	if !status.Restricted {
+		return false, nil
+	}
+	for _, prefix := range mfaEnrollmentPaths {
+		if strings.HasPrefix(c.Path(), prefix) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// termsPending reports whether the request has to be refused because
+// acceptance is enforced and user has terms to accept.
+func (a *AuthMiddleware) termsPending(c *fiber.Ctx, user *models.User) (bool, error) {
+	if a.Terms == nil || !a.Terms.Enforced(c.UserContext()) {
+		return false, nil
+	}
+	for _, prefix := range termsAcceptancePaths {
+		if strings.HasPrefix(c.Path(), prefix) {
+			return false, nil
+		}
+	}
+	pending, err := a.Terms.Pending(c.UserContext(), user.ID)
+	if err != nil {
+		return false, err
+	}
+	return len(pending) > 0, nil
+}
+
+func rejectMFAUnenrolled(c *fiber.Ctx, user *models.User) error {
+	logger.Warn("auth_mfa_enrollment_required", map[string]interface{}{
+		"ip":      c.IP(),
+		"path":    c.Path(),
+		"user_id": user.ID.String(),
+	})
+	return utils.Fail(c, ErrMFAEnrollmentRequired)
+}
+
+func (a *AuthMiddleware) clientInfo(c *fiber.Ctx) services.ClientInfo {
+	return a.Sessions.ClientInfo(c.Get(fiber.HeaderUserAgent), c.IP(), func(key string) string { return c.Get(key) })
+}
+
+// GetSession returns the session the request was authenticated with, or
+// nil when sessions are not tracked or the token predates them.
+func GetSession(c *fiber.Ctx) *models.Session {
+	session, _ := c.Locals(sessionKey).(*models.Session)
+	return session
+}
+
+// GetMFAPolicyStatus returns the MFA policy outcome RequireAuth computed for
+// the current user, or nil when no policy is configured.
+func GetMFAPolicyStatus(c *fiber.Ctx) *services.MFAPolicyStatus {
+	status, _ := c.Locals(mfaPolicyKey).(*services.MFAPolicyStatus)
+	return status
+}
+
+// sessionRevoked reports whether claims were issued before the user's
+// sessions were last revoked.
+func sessionRevoked(user *models.User, claims *utils.Claims) bool {
+	if user.SessionsRevokedAt == nil {
+		return false
+	}
+	return claims.IssuedAt == nil || claims.IssuedAt.Time.Before(*user.SessionsRevokedAt)
+}
+
+func rejectSuspended(c *fiber.Ctx, user *models.User) error {
+	logger.Warn("auth_account_suspended", map[string]interface{}{
+		"ip":      c.IP(),
+		"path":    c.Path(),
+		"user_id": user.ID.String(),
+	})
+	return utils.Fail(c, ErrAccountSuspended)
+}
+
 func (a *AuthMiddleware) authenticateAPIToken(c *fiber.Ctx, rawToken string) error {
 	hash := sha256.Sum256([]byte(rawToken))
 	tokenHash := hex.EncodeToString(hash[:])
@@ -100,7 +257,7 @@ func (a *AuthMiddleware) authenticateAPIToken(c *fiber.Ctx, rawToken string) err
 			"ip":   c.IP(),
 			"path": c.Path(),
 		})
-		return utils.Error(c, fiber.StatusUnauthorized, "invalid API token")
+		return utils.Fail(c, errInvalidAPIToken)
 	}
 
 	if apiToken.ExpiresAt != nil && apiToken.ExpiresAt.Before(time.Now()) {
@@ -109,16 +266,46 @@ func (a *AuthMiddleware) authenticateAPIToken(c *fiber.Ctx, rawToken string) err
 			"path":     c.Path(),
 			"token_id": apiToken.ID.String(),
 		})
-		return utils.Error(c, fiber.StatusUnauthorized, "API token has expired")
+		return utils.Fail(c, errAPITokenExpired)
 	}
 
 	var user models.User
 	if err := a.DB.First(&user, "id = ?", apiToken.UserID).Error; err != nil {
 		return utils.Error(c, fiber.StatusUnauthorized, "user not found")
 	}
+	if user.IsSuspended() {
+		return rejectSuspended(c, &user)
+	}
+	if !inRequestTenant(c, &user) {
+		return utils.Fail(c, ErrOrganizationMismatch)
+	}
+	restricted, err := a.checkMFAPolicy(c, &user)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed checking MFA policy")
+	}
+	if restricted {
+		return rejectMFAUnenrolled(c, &user)
+	}
+	pending, err := a.termsPending(c, &user)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed checking terms acceptance")
+	}
+	if pending {
+		return utils.Fail(c, ErrTermsAcceptanceRequired)
+	}
 
 	now := time.Now()
 	a.DB.Model(&apiToken).Update("last_used_at", now)
+	if a.Sessions != nil {
+		session, err := a.Sessions.ForAPIToken(c.UserContext(), &apiToken, &user, a.clientInfo(c))
+		if err != nil {
+			logger.Error("api_token_session_failed", err, map[string]interface{}{
+				"token_id": apiToken.ID.String(),
+			})
+		} else {
+			c.Locals(sessionKey, session)
+		}
+	}
 
 	c.Locals(currentUserKey, &user)
 	return c.Next()
@@ -148,7 +335,7 @@ func (a *AuthMiddleware) OptionalAuth(c *fiber.Ctx) error {
 		}
 
 		var user models.User
-		if err := a.DB.First(&user, "id = ?", apiToken.UserID).Error; err != nil {
+		if err := a.DB.First(&user, "id = ?", apiToken.UserID).Error; err != nil || user.IsSuspended() || !inRequestTenant(c, &user) {
 			return c.Next()
 		}
 
@@ -164,7 +351,7 @@ func (a *AuthMiddleware) OptionalAuth(c *fiber.Ctx) error {
 	}
 
 	var user models.User
-	if err := a.DB.First(&user, "id = ?", claims.UserID).Error; err != nil {
+	if err := a.DB.First(&user, "id = ?", claims.UserID).Error; err != nil || user.IsSuspended() || sessionRevoked(&user, claims) || !inRequestTenant(c, &user) {
 		return c.Next()
 	}
 
@@ -185,11 +372,38 @@ func AdminOnly(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
 	}
 	if user.Role != models.UserRoleAdmin {
-		return utils.Error(c, fiber.StatusForbidden, "admin access required")
+		return utils.Fail(c, errAdminRequired)
+	}
+	return c.Next()
+}
+
+// AdminAccess admits admins and the administrative sub-roles. Routes
+// behind it narrow access further with RequirePermission.
+func AdminAccess(c *fiber.Ctx) error {
+	user := GetCurrentUser(c)
+	if user == nil {
+		return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+	}
+	if !user.Role.IsAdministrative() {
+		return utils.Fail(c, errAdminRequired)
 	}
 	return c.Next()
 }
 
+// RequirePermission admits users whose role holds permission.
+func RequirePermission(permission services.AdminPermission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := GetCurrentUser(c)
+		if user == nil {
+			return utils.Error(c, fiber.StatusUnauthorized, "unauthorized")
+		}
+		if !services.HasAdminPermission(user, permission) {
+			return utils.Fail(c, errAdminRequired.WithMessage("your admin role does not allow this"))
+		}
+		return c.Next()
+	}
+}
+
 func GetCurrentUser(c *fiber.Ctx) *models.User {
 	value := c.Locals(currentUserKey)
 	if value == nil {
@@ -396,10 +396,3 @@ func TestGetCurrentUser(t *testing.T) {
 
 	_ = uuid.Nil
 }
-
-func TestCORS(t *testing.T) {
-	handler := CORS("http://localhost:3001")
-	if handler == nil {
-		t.Fatal("expected non-nil CORS handler")
-	}
-}
@@ -1,28 +1,48 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
 	"strings"
 
+	"github.com/docshare/api/internal/config"
 	"github.com/docshare/api/pkg/utils"
 	"github.com/gofiber/fiber/v2"
 )
 
-// SmallBodyLimitForNonUploadRoutes returns a middleware that rejects requests
-// whose declared Content-Length exceeds maxBytes, *unless* the request is
-// hitting one of the upload endpoints that legitimately accepts large bodies
-// (the legacy multipart `/api/files/upload` and the chunked
-// `/api/transfers/:code/upload`).
+// multipartOverhead is the allowance on top of the upload size setting for
+// the multipart framing and form fields around an uploaded file.
+const multipartOverhead = 1024 * 1024
+
+type bodyClass int
+
+const (
+	bodyJSON bodyClass = iota
+	bodyDocument
+	bodyTransferChunk
+	bodyUpload
+)
+
+// BodyLimit returns a middleware that rejects requests whose declared
+// Content-Length exceeds the limit for the route they hit, with a 413 whose
+// code says which limit it was. Uploads are held to maxUploadBytes when it
+// is positive; it is a function so admins can change the limit at runtime.
 //
-// We keep Fiber's global `BodyLimit` large enough to accept the legacy
-// multipart upload (governed by MAX_UPLOAD_MB), but the rest of the API
-// — auth, JSON CRUD, presign/finalize — shouldn't accept gigabyte JSON
-// payloads. This middleware narrows the DoS surface without per-route
-// fasthttp tuning, which Fiber doesn't expose. It only blocks honest
-// (Content-Length-declaring) clients; chunked-encoded requests still hit
-// the global cap.
-func SmallBodyLimitForNonUploadRoutes(maxBytes int) fiber.Handler {
+// The server streams request bodies larger than Fiber's `BodyLimit`
+// rather than rejecting them, so the upload handlers can copy them straight
+// to storage. That makes this middleware the only size gate for every
+// route. Chunked-encoded requests are refused outside the upload routes;
+// the multipart upload enforces the upload limit itself while streaming,
+// and a TUS append can't go past the length the upload announced.
+func BodyLimit(limits config.BodyLimitsConfig, maxUploadBytes func(context.Context) int64) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		if isLargeBodyRoute(c.Path()) {
+		class := routeBodyClass(c.Path())
+		if class == bodyUpload {
+			length := int64(c.Request().Header.ContentLength())
+			if limit := maxUploadBytes(c.Context()); limit > 0 && length > limit+multipartOverhead {
+				return utils.Fail(c, utils.NewError(fiber.StatusRequestEntityTooLarge, "upload_too_large",
+					fmt.Sprintf("file exceeds maximum upload size of %d bytes", limit)))
+			}
 			return c.Next()
 		}
 		// GET / HEAD / OPTIONS legitimately omit Content-Length (fasthttp
@@ -35,34 +55,68 @@ func SmallBodyLimitForNonUploadRoutes(maxBytes int) fiber.Handler {
 		default:
 			return c.Next()
 		}
-		length := c.Request().Header.ContentLength()
+		length := int64(c.Request().Header.ContentLength())
 		// A negative Content-Length means chunked transfer encoding (or no
-		// declared length). For non-upload body-bearing routes we expect
-		// JSON with a known length; refusing chunked here closes the bypass
-		// where an attacker could otherwise stream up to the global cap.
+		// declared length). These routes read the whole body into memory,
+		// so they expect a known length; refusing chunked here closes the
+		// bypass where an attacker could otherwise stream past the cap.
 		if length < 0 {
-			return utils.Error(c, fiber.StatusLengthRequired, "content-length required")
+			return utils.Fail(c, utils.NewError(fiber.StatusLengthRequired, "length_required", "Content-Length required"))
 		}
-		if length > maxBytes {
-			return utils.Error(c, fiber.StatusRequestEntityTooLarge, "request body too large")
+		switch class {
+		case bodyTransferChunk:
+			if length > limits.TransferChunkBytes {
+				return utils.Fail(c, utils.NewError(fiber.StatusRequestEntityTooLarge, "transfer_chunk_too_large",
+					fmt.Sprintf("transfer chunks may be at most %d bytes; send the file in more chunks", limits.TransferChunkBytes)))
+			}
+		case bodyDocument:
+			if length > limits.DocumentBytes {
+				return utils.Fail(c, bodyTooLarge(limits.DocumentBytes))
+			}
+		default:
+			if length > limits.JSONBytes {
+				return utils.Fail(c, bodyTooLarge(limits.JSONBytes))
+			}
 		}
 		return c.Next()
 	}
 }
 
-func isLargeBodyRoute(path string) bool {
-	// Exact match — must NOT match /api/files/upload/presign or
-	// /api/files/upload/finalize (those are small JSON requests).
+func bodyTooLarge(limit int64) *utils.APIError {
+	return utils.NewError(fiber.StatusRequestEntityTooLarge, "body_too_large",
+		fmt.Sprintf("request body exceeds the %d byte limit for this endpoint", limit))
+}
+
+// routeBodyClass tells which limit applies to path. Matches are exact on
+// the number of segments: a naive prefix+suffix check would also put
+// /api/transfers/a/b/upload (non-existent, 404s after route resolution) in
+// the larger class, letting it past the JSON cap on the way there.
+func routeBodyClass(path string) bodyClass {
+	// Must NOT match /api/files/upload/presign or /api/files/upload/finalize
+	// (those are small JSON requests).
 	if path == "/api/files/upload" {
-		return true
+		return bodyUpload
+	}
+	if path == "/api/auth/me/avatar" || path == "/api/pastes" {
+		return bodyDocument
 	}
-	// Transfer chunk uploads: must match exactly /api/transfers/{code}/upload
-	// where {code} contains no slashes. A naive prefix+suffix check would
-	// also exempt /api/transfers/a/b/upload (non-existent, 404s after route
-	// resolution, but bypasses the small-body cap on the way there).
 	parts := strings.Split(path, "/")
-	if len(parts) == 5 && parts[0] == "" && parts[1] == "api" && parts[2] == "transfers" && parts[3] != "" && parts[4] == "upload" {
-		return true
+	if len(parts) < 4 || parts[0] != "" || parts[1] != "api" || parts[3] == "" {
+		return bodyJSON
+	}
+	switch {
+	// TUS appends: /api/tus/{id}.
+	case len(parts) == 4 && parts[2] == "tus":
+		return bodyUpload
+	// /api/transfers/{code}/upload
+	case len(parts) == 5 && parts[2] == "transfers" && parts[4] == "upload":
+		return bodyTransferChunk
+	// /api/files/{id}/content and /api/files/{id}/binary
+	case len(parts) == 5 && parts[2] == "files" && (parts[4] == "content" || parts[4] == "binary"):
+		return bodyDocument
+	// /api/groups/{id}/members/import
+	case len(parts) == 6 && parts[2] == "groups" && parts[4] == "members" && parts[5] == "import":
+		return bodyDocument
 	}
-	return false
+	return bodyJSON
 }
@@ -2,23 +2,32 @@ package middleware
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/docshare/api/internal/config"
 	"github.com/gofiber/fiber/v2"
 )
 
-func TestSmallBodyLimitForNonUploadRoutes(t *testing.T) {
+func TestBodyLimit(t *testing.T) {
 	app := fiber.New()
-	app.Use(SmallBodyLimitForNonUploadRoutes(1024))
+	limits := config.BodyLimitsConfig{JSONBytes: 1024, DocumentBytes: 8 * 1024, TransferChunkBytes: 64 * 1024}
+	app.Use(BodyLimit(limits, func(context.Context) int64 { return 2 * 1024 * 1024 }))
 	app.Post("/api/auth/login", func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) })
 	app.Post("/api/files/upload", func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) })
 	app.Post("/api/files/upload/presign", func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) })
 	app.Post("/api/transfers/abc123/upload", func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) })
 	app.Post("/api/transfers/a/b/upload", func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) })
+	app.Patch("/api/tus/some-id", func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) })
 	app.Delete("/api/files/some-id", func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) })
+	app.Put("/api/files/some-id/content", func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) })
+	app.Put("/api/auth/me/avatar", func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) })
+	app.Post("/api/groups/some-id/members/import", func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) })
+	app.Post("/api/pastes", func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) })
 
 	cases := []struct {
 		name       string
@@ -26,14 +35,23 @@ func TestSmallBodyLimitForNonUploadRoutes(t *testing.T) {
 		path       string
 		bodySize   int
 		wantStatus int
+		wantCode   string
 	}{
-		{"small body to JSON route passes", http.MethodPost, "/api/auth/login", 256, http.StatusOK},
-		{"oversize body to JSON route is rejected", http.MethodPost, "/api/auth/login", 4096, http.StatusRequestEntityTooLarge},
-		{"oversize body to presign is rejected", http.MethodPost, "/api/files/upload/presign", 4096, http.StatusRequestEntityTooLarge},
-		{"oversize body to legacy multipart upload is allowed", http.MethodPost, "/api/files/upload", 4096, http.StatusOK},
-		{"oversize body to transfer chunk upload is allowed", http.MethodPost, "/api/transfers/abc123/upload", 4096, http.StatusOK},
-		{"oversize body to non-canonical transfer path is rejected", http.MethodPost, "/api/transfers/a/b/upload", 4096, http.StatusRequestEntityTooLarge},
-		{"oversize DELETE body is rejected", http.MethodDelete, "/api/files/some-id", 4096, http.StatusRequestEntityTooLarge},
+		{"small body to JSON route passes", http.MethodPost, "/api/auth/login", 256, http.StatusOK, ""},
+		{"oversize body to JSON route is rejected", http.MethodPost, "/api/auth/login", 4096, http.StatusRequestEntityTooLarge, "body_too_large"},
+		{"oversize body to presign is rejected", http.MethodPost, "/api/files/upload/presign", 4096, http.StatusRequestEntityTooLarge, "body_too_large"},
+		{"oversize body to multipart upload is allowed", http.MethodPost, "/api/files/upload", 4096, http.StatusOK, ""},
+		{"oversize body to transfer chunk upload is allowed", http.MethodPost, "/api/transfers/abc123/upload", 4096, http.StatusOK, ""},
+		{"body past the upload limit is rejected", http.MethodPost, "/api/files/upload", 3*1024*1024 + 1, http.StatusRequestEntityTooLarge, "upload_too_large"},
+		{"chunk past the transfer chunk limit is rejected", http.MethodPost, "/api/transfers/abc123/upload", 64*1024 + 1, http.StatusRequestEntityTooLarge, "transfer_chunk_too_large"},
+		{"oversize body to non-canonical transfer path is rejected", http.MethodPost, "/api/transfers/a/b/upload", 4096, http.StatusRequestEntityTooLarge, "body_too_large"},
+		{"oversize body to TUS append is allowed", http.MethodPatch, "/api/tus/some-id", 4096, http.StatusOK, ""},
+		{"oversize DELETE body is rejected", http.MethodDelete, "/api/files/some-id", 4096, http.StatusRequestEntityTooLarge, "body_too_large"},
+		{"editor save within the document limit passes", http.MethodPut, "/api/files/some-id/content", 4096, http.StatusOK, ""},
+		{"editor save past the document limit is rejected", http.MethodPut, "/api/files/some-id/content", 8*1024 + 1, http.StatusRequestEntityTooLarge, "body_too_large"},
+		{"avatar within the document limit passes", http.MethodPut, "/api/auth/me/avatar", 4096, http.StatusOK, ""},
+		{"member import within the document limit passes", http.MethodPost, "/api/groups/some-id/members/import", 4096, http.StatusOK, ""},
+		{"paste within the document limit passes", http.MethodPost, "/api/pastes", 4096, http.StatusOK, ""},
 	}
 	// Chunked-encoding rejection (when Content-Length is absent and
 	// fasthttp reports ContentLength() == -1) is exercised in production
@@ -53,6 +71,14 @@ func TestSmallBodyLimitForNonUploadRoutes(t *testing.T) {
 			if resp.StatusCode != tc.wantStatus {
 				t.Fatalf("expected status %d, got %d", tc.wantStatus, resp.StatusCode)
 			}
+			if tc.wantCode != "" {
+				var body struct {
+					Code string `json:"code"`
+				}
+				if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Code != tc.wantCode {
+					t.Fatalf("expected code %q, got %q (%v)", tc.wantCode, body.Code, err)
+				}
+			}
 		})
 	}
 }
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+func CORS(cfg config.CORSConfig) fiber.Handler {
+	origins := strings.Join(cfg.AllowedOrigins, ",")
+	allowCredentials := cfg.AllowCredentials
+	// Browsers refuse credentialed responses for a wildcard origin and
+	// Fiber panics on the combination, so fall back to uncredentialed CORS
+	// rather than refusing to start.
+	if allowCredentials && (origins == "" || strings.Contains(origins, "*")) {
+		logger.Warn("cors_credentials_disabled", map[string]interface{}{
+			"reason": "credentials cannot be combined with a wildcard origin",
+		})
+		allowCredentials = false
+	}
+	return cors.New(cors.Config{
+		AllowOrigins:     origins,
+		AllowHeaders:     strings.Join(cfg.AllowedHeaders, ", "),
+		AllowMethods:     "GET,HEAD,POST,PUT,PATCH,DELETE,OPTIONS",
+		ExposeHeaders:    strings.Join(cfg.ExposedHeaders, ", "),
+		AllowCredentials: allowCredentials,
+		MaxAge:           cfg.MaxAge,
+	})
+}
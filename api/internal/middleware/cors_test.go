@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCORS(t *testing.T) {
+	handler := CORS(config.CORSConfig{AllowedOrigins: []string{"http://localhost:3001"}})
+	if handler == nil {
+		t.Fatal("expected non-nil CORS handler")
+	}
+}
+
+func TestCORS_Config(t *testing.T) {
+	newApp := func(t *testing.T, cfg config.CORSConfig) *fiber.App {
+		t.Helper()
+		app := fiber.New()
+		app.Use(CORS(cfg))
+		app.Get("/", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+		return app
+	}
+
+	t.Run("allows configured origins with credentials", func(t *testing.T) {
+		app := newApp(t, config.CORSConfig{
+			AllowedOrigins:   []string{"https://app.example.com"},
+			AllowedHeaders:   []string{"Authorization", "X-Custom"},
+			AllowCredentials: true,
+		})
+		req := httptest.NewRequest("OPTIONS", "/", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+			t.Errorf("expected origin to be allowed, got %q", got)
+		}
+		if resp.Header.Get("Access-Control-Allow-Credentials") != "true" {
+			t.Error("expected credentials to be allowed")
+		}
+		if got := resp.Header.Get("Access-Control-Allow-Headers"); !strings.Contains(got, "X-Custom") {
+			t.Errorf("unexpected allowed headers %q", got)
+		}
+	})
+
+	t.Run("rejects other origins", func(t *testing.T) {
+		app := newApp(t, config.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}})
+		req := httptest.NewRequest("OPTIONS", "/", nil)
+		req.Header.Set("Origin", "https://evil.example.com")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("expected no allowed origin, got %q", got)
+		}
+	})
+
+	t.Run("drops credentials for wildcard origins instead of panicking", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Fatalf("CORS panicked: %v", r)
+			}
+		}()
+		CORS(config.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+	})
+}
@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	errInvalidSignature  = utils.NewError(fiber.StatusUnauthorized, "invalid_signature", services.ErrSignatureInvalid.Error())
+	errSignedRequestsOff = utils.NewError(fiber.StatusUnauthorized, "invalid_signature", "signed requests are not accepted here")
+
+	// ErrBodySignatureMismatch is reported when a signed request's body
+	// does not hash to the X-Content-SHA256 it was signed with.
+	ErrBodySignatureMismatch = utils.NewError(fiber.StatusUnauthorized, "invalid_signature", "request body does not match "+services.ContentSHA256Header)
+)
+
+// signatureErrors maps the verification failures to their responses; any
+// other error is a server fault.
+var signatureErrors = []struct {
+	err error
+	api *utils.APIError
+}{
+	{services.ErrSignatureMalformed, utils.NewError(fiber.StatusUnauthorized, "malformed_signature", services.ErrSignatureMalformed.Error())},
+	{services.ErrSignatureInvalid, errInvalidSignature},
+	{services.ErrSignatureExpired, utils.NewError(fiber.StatusUnauthorized, "signature_expired", services.ErrSignatureExpired.Error())},
+	{services.ErrSignatureReplayed, utils.NewError(fiber.StatusUnauthorized, "signature_replayed", services.ErrSignatureReplayed.Error())},
+	{services.ErrHMACKeyExpired, utils.NewError(fiber.StatusUnauthorized, "signing_key_expired", services.ErrHMACKeyExpired.Error())},
+}
+
+const signedBodyKey = "signedBody"
+
+// authenticateSignature admits a request signed with an HMAC key. The
+// signature covers the body through its hash in X-Content-SHA256. Most
+// bodies are read and hashed here. A streamed upload is hashed as the
+// handler reads it through BodyStream instead: reading to the end fails if
+// the hash does not match, and handlers that stop early call
+// VerifySignedBody before keeping what they read.
+func (a *AuthMiddleware) authenticateSignature(c *fiber.Ctx, header string) error {
+	if a.HMACKeys == nil {
+		return utils.Fail(c, errSignedRequestsOff)
+	}
+	req, err := services.ParseSignatureHeader(header)
+	if err != nil {
+		return a.rejectSignature(c, err)
+	}
+	req.Method = c.Method()
+	req.URI = OriginalRequestURI(c)
+	req.ContentSHA256 = strings.ToLower(c.Get(services.ContentSHA256Header))
+	expected, err := hex.DecodeString(req.ContentSHA256)
+	if err != nil || len(expected) != sha256.Size {
+		return a.rejectSignature(c, services.ErrSignatureMalformed)
+	}
+
+	key, err := a.HMACKeys.Verify(c.UserContext(), req)
+	if err != nil {
+		return a.rejectSignature(c, err)
+	}
+
+	if c.Request().IsBodyStream() && routeBodyClass(c.Path()) == bodyUpload {
+		c.Locals(signedBodyKey, &verifiedBody{r: c.Context().RequestBodyStream(), h: sha256.New(), expected: expected})
+	} else {
+		sum := sha256.Sum256(c.Body())
+		if subtle.ConstantTimeCompare(sum[:], expected) != 1 {
+			return a.rejectSignature(c, ErrBodySignatureMismatch)
+		}
+	}
+
+	var user models.User
+	if err := a.DB.First(&user, "id = ?", key.UserID).Error; err != nil {
+		return utils.Error(c, fiber.StatusUnauthorized, "user not found")
+	}
+	if user.IsSuspended() {
+		return rejectSuspended(c, &user)
+	}
+	if !inRequestTenant(c, &user) {
+		return utils.Fail(c, ErrOrganizationMismatch)
+	}
+	restricted, err := a.checkMFAPolicy(c, &user)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed checking MFA policy")
+	}
+	if restricted {
+		return rejectMFAUnenrolled(c, &user)
+	}
+	pending, err := a.termsPending(c, &user)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, "failed checking terms acceptance")
+	}
+	if pending {
+		return utils.Fail(c, ErrTermsAcceptanceRequired)
+	}
+
+	c.Locals(currentUserKey, &user)
+	return c.Next()
+}
+
+func (a *AuthMiddleware) rejectSignature(c *fiber.Ctx, err error) error {
+	var apiErr *utils.APIError
+	if !errors.As(err, &apiErr) {
+		for _, candidate := range signatureErrors {
+			if errors.Is(err, candidate.err) {
+				apiErr = candidate.api
+				break
+			}
+		}
+	}
+	if apiErr == nil {
+		logger.Error("signature_verification_failed", err, map[string]interface{}{
+			"ip":   c.IP(),
+			"path": c.Path(),
+		})
+		return utils.Error(c, fiber.StatusInternalServerError, "failed verifying signature")
+	}
+	logger.Warn("signature_rejected", map[string]interface{}{
+		"ip":     c.IP(),
+		"path":   c.Path(),
+		"reason": apiErr.Code,
+	})
+	return utils.Fail(c, apiErr)
+}
+
+// BodyStream returns the reader a handler should stream the request body
+// from, or nil when the body was not streamed.
+func BodyStream(c *fiber.Ctx) io.Reader {
+	if body, ok := c.Locals(signedBodyKey).(*verifiedBody); ok {
+		return body
+	}
+	if stream := c.Context().RequestBodyStream(); stream != nil {
+		return stream
+	}
+	return nil
+}
+
+// VerifySignedBody reads what is left of a signed streamed body and
+// reports whether all of it matched the signed hash. It is a no-op for
+// other requests, whose bodies were checked up front or not signed.
+func VerifySignedBody(c *fiber.Ctx) error {
+	body, ok := c.Locals(signedBodyKey).(*verifiedBody)
+	if !ok {
+		return nil
+	}
+	_, err := io.Copy(io.Discard, body)
+	return err
+}
+
+// SignedBodyRejected reports whether a signed streamed body has already
+// been read to the end and found not to match its signed hash. Handlers
+// use it to report that, rather than whatever the failed read led to.
+func SignedBodyRejected(c *fiber.Ctx) bool {
+	body, ok := c.Locals(signedBodyKey).(*verifiedBody)
+	return ok && body.err == ErrBodySignatureMismatch
+}
+
+// verifiedBody hashes a streamed body as it is read and turns the final
+// EOF into an error when the hash is not the one that was signed.
+type verifiedBody struct {
+	r        io.Reader
+	h        hash.Hash
+	expected []byte
+	err      error
+}
+
+func (b *verifiedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	n, err := b.r.Read(p)
+	b.h.Write(p[:n])
+	if err == io.EOF && subtle.ConstantTimeCompare(b.h.Sum(nil), b.expected) != 1 {
+		err = ErrBodySignatureMismatch
+	}
+	if err != nil {
+		b.err = err
+	}
+	return n, err
+}
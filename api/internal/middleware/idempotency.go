@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayHeader is set on responses replayed from a stored key.
+	IdempotentReplayHeader = "Idempotent-Replayed"
+	// IdempotencyKeyLocal holds the validated key for handlers to audit.
+	IdempotencyKeyLocal = "idempotencyKey"
+
+	maxIdempotencyKeyLength = 255
+	// maxStoredResponse caps the response kept for replay. Larger answers
+	// are not kept, so a retry runs the request again.
+	maxStoredResponse = 1024 * 1024
+)
+
+var (
+	errInvalidIdempotencyKey = utils.NewError(fiber.StatusBadRequest, "invalid_idempotency_key", "Idempotency-Key must be 1-255 printable ASCII characters")
+	errIdempotencyInProgress = utils.NewError(fiber.StatusConflict, "idempotency_key_in_use", "a request with this Idempotency-Key is still in progress")
+	errIdempotencyKeyReused  = utils.NewError(fiber.StatusUnprocessableEntity, "idempotency_key_reused", "this Idempotency-Key was already used for a different request")
+)
+
+// Idempotency makes mutating requests safe to retry. A POST, PUT, PATCH or
+// DELETE carrying an Idempotency-Key header runs once per user, key and
+// route; repeats within the window get the first successful response
+// back, marked with Idempotent-Replayed, and reusing the key with a
+// different payload is refused. Failed requests are not stored, so the
+// client can retry them with the same key. Other requests pass through.
+// It must run after authentication.
+func Idempotency(svc *services.IdempotencyService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		default:
+			return c.Next()
+		}
+		key := c.Get(IdempotencyKeyHeader)
+		user := GetCurrentUser(c)
+		if key == "" || user == nil {
+			return c.Next()
+		}
+		if !validIdempotencyKey(key) {
+			return utils.Fail(c, errInvalidIdempotencyKey)
+		}
+
+		stored, replay, err := svc.Begin(c.Context(), services.IdempotencyRequest{
+			UserID: user.ID,
+			Key:    key,
+			Method: c.Method(),
+			Path:   c.Path(),
+			Hash:   requestFingerprint(c),
+		})
+		switch {
+		case errors.Is(err, services.ErrIdempotencyInProgress):
+			return utils.Fail(c, errIdempotencyInProgress)
+		case errors.Is(err, services.ErrIdempotencyKeyReused):
+			return utils.Fail(c, errIdempotencyKeyReused)
+		case err != nil:
+			return utils.Error(c, fiber.StatusInternalServerError, "failed checking idempotency key")
+		}
+		if replay {
+			logger.InfoWithUser(user.ID.String(), "idempotent_replay", map[string]interface{}{
+				"idempotency_key": key,
+				"path":            c.Path(),
+				"request_id":      utils.RequestID(c),
+			})
+			c.Set(IdempotentReplayHeader, "true")
+			c.Set(fiber.HeaderContentType, stored.ContentType)
+			return c.Status(stored.StatusCode).Send(stored.ResponseBody)
+		}
+
+		c.Locals(IdempotencyKeyLocal, key)
+		err = c.Next()
+
+		resp := c.Response()
+		status := resp.StatusCode()
+		if err != nil || status < 200 || status >= 300 || resp.IsBodyStream() || len(resp.Body()) > maxStoredResponse {
+			if releaseErr := svc.Release(c.Context(), stored); releaseErr != nil {
+				logger.Error("idempotency_release_failed", releaseErr, map[string]interface{}{"idempotency_key": key})
+			}
+			return err
+		}
+		body := append([]byte(nil), resp.Body()...)
+		if completeErr := svc.Complete(c.Context(), stored, status, string(resp.Header.ContentType()), body); completeErr != nil {
+			logger.Error("idempotency_store_failed", completeErr, map[string]interface{}{"idempotency_key": key})
+		}
+		return nil
+	}
+}
+
+// GetIdempotencyKey returns the Idempotency-Key the current request runs
+// under, or "".
+func GetIdempotencyKey(c *fiber.Ctx) string {
+	key, _ := c.Locals(IdempotencyKeyLocal).(string)
+	return key
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestFingerprint hashes the query string and body. A streamed body
+// (a large upload) can only be read once, by the handler, so its declared
+// length stands in for it. Multipart boundaries are random per attempt
+// and are left out.
+func requestFingerprint(c *fiber.Ctx) string {
+	h := sha256.New()
+	h.Write(c.Request().URI().QueryString())
+	h.Write([]byte{0})
+	if c.Request().IsBodyStream() {
+		fmt.Fprintf(h, "stream:%d", c.Request().Header.ContentLength())
+	} else {
+		body := c.Body()
+		if _, params, err := mime.ParseMediaType(c.Get(fiber.HeaderContentType)); err == nil && params["boundary"] != "" {
+			body = bytes.ReplaceAll(body, []byte(params["boundary"]), nil)
+		}
+		h.Write(body)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
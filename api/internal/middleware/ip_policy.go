@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+var errIPBlocked = utils.NewError(fiber.StatusForbidden, "ip_blocked", "access from this address is not allowed")
+
+// IPPolicy refuses requests whose client IP the scope's current rules don't
+// admit. It runs before authentication, so blocked addresses never reach a
+// login check. c.IP() is only the forwarded address when the request came
+// through a trusted proxy.
+func IPPolicy(settings *services.SettingsService, scope services.IPScope) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ip := c.IP()
+		allowed, reason := settings.IPPolicy(c.Context(), scope).Allows(ip)
+		if allowed {
+			return c.Next()
+		}
+		logger.Warn("ip_blocked", map[string]interface{}{
+			"scope":      string(scope),
+			"ip":         ip,
+			"method":     c.Method(),
+			"path":       c.Path(),
+			"reason":     reason,
+			"request_id": utils.RequestID(c),
+		})
+		return utils.Fail(c, errIPBlocked)
+	}
+}
@@ -4,14 +4,18 @@ import (
 	"time"
 
 	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
 	"github.com/gofiber/fiber/v2"
 )
 
 func RequestLogger() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		start := time.Now()
-		requestID := logger.GenerateRequestID()
-		c.Locals("requestID", requestID)
+		requestID := utils.RequestID(c)
+		if requestID == "" {
+			requestID = logger.GenerateRequestID()
+			c.Locals(utils.RequestIDKey, requestID)
+		}
 
 		err := c.Next()
 
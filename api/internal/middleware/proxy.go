@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TrustedProxies is the parsed form of the TRUSTED_PROXIES setting.
+type TrustedProxies struct {
+	prefixes []netip.Prefix
+}
+
+// ParseTrustedProxies accepts bare IPs and CIDR ranges.
+func ParseTrustedProxies(entries []string) (*TrustedProxies, error) {
+	t := &TrustedProxies{}
+	for _, entry := range entries {
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			t.prefixes = append(t.prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		t.prefixes = append(t.prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return t, nil
+}
+
+func (t *TrustedProxies) Contains(addr netip.Addr) bool {
+	if t == nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range t.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigureTrustedProxies makes c.IP() read header, but only for requests
+// arriving from one of proxies. With no proxies configured the header is
+// ignored and c.IP() is the socket peer.
+func ConfigureTrustedProxies(cfg *fiber.Config, header string, proxies []string) {
+	if len(proxies) == 0 || header == "" {
+		return
+	}
+	cfg.ProxyHeader = header
+	cfg.EnableTrustedProxyCheck = true
+	cfg.TrustedProxies = proxies
+	cfg.EnableIPValidation = true
+}
+
+// ForwardedFor rewrites the proxy header of requests from trusted peers to
+// the single address Fiber should report as the client IP. Fiber takes the
+// left-most entry of X-Forwarded-For, which the client controls; walking the
+// list from the right and skipping our own proxies yields the address the
+// outermost trusted proxy actually saw.
+func ForwardedFor(header string, trusted *TrustedProxies) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if header == "" || trusted == nil {
+			return c.Next()
+		}
+		raw := c.Get(header)
+		if raw == "" {
+			return c.Next()
+		}
+		peer, ok := netip.AddrFromSlice(c.Context().RemoteIP())
+		if !ok || !trusted.Contains(peer) {
+			return c.Next()
+		}
+		if client := resolveForwardedClient(raw, trusted); client != "" {
+			c.Request().Header.Set(header, client)
+		}
+		return c.Next()
+	}
+}
+
+func resolveForwardedClient(raw string, trusted *TrustedProxies) string {
+	hops := strings.Split(raw, ",")
+	var leftmost string
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// A malformed hop means everything to its left is untrusted
+			// input; stop at the last address we could vouch for.
+			break
+		}
+		leftmost = addr.Unmap().String()
+		if !trusted.Contains(addr) {
+			return leftmost
+		}
+	}
+	return leftmost
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.5", "::1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for addr, want := range map[string]bool{
+		"10.1.2.3":        true,
+		"192.168.1.5":     true,
+		"192.168.1.6":     false,
+		"::1":             true,
+		"::ffff:10.9.9.9": true,
+		"203.0.113.7":     false,
+		"2001:db8::1":     false,
+	} {
+		if got := trusted.Contains(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", addr, got, want)
+		}
+	}
+
+	if _, err := ParseTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Error("expected error for invalid entry")
+	}
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/99"}); err == nil {
+		t.Error("expected error for invalid CIDR")
+	}
+}
+
+func TestResolveForwardedClient(t *testing.T) {
+	trusted, _ := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	cases := map[string]string{
+		"203.0.113.7":                    "203.0.113.7",
+		"203.0.113.7, 10.0.0.2":          "203.0.113.7",
+		"1.1.1.1, 203.0.113.7, 10.0.0.2": "203.0.113.7",
+		"spoofed, 203.0.113.7":           "203.0.113.7",
+		"10.0.0.3, 10.0.0.2":             "10.0.0.3",
+		"garbage":                        "",
+	}
+	for header, want := range cases {
+		if got := resolveForwardedClient(header, trusted); got != want {
+			t.Errorf("resolveForwardedClient(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestForwardedFor(t *testing.T) {
+	newApp := func(proxies []string) *fiber.App {
+		cfg := fiber.Config{}
+		ConfigureTrustedProxies(&cfg, "X-Forwarded-For", proxies)
+		app := fiber.New(cfg)
+		trusted, err := ParseTrustedProxies(proxies)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		app.Use(ForwardedFor("X-Forwarded-For", trusted))
+		app.Get("/ip", func(c *fiber.Ctx) error { return c.SendString(c.IP()) })
+		return app
+	}
+	clientIP := func(t *testing.T, app *fiber.App, xff string) string {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/ip", nil)
+		req.Header.Set("X-Forwarded-For", xff)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	// app.Test connects from 0.0.0.0.
+	t.Run("trusted peer uses the right-most untrusted hop", func(t *testing.T) {
+		app := newApp([]string{"0.0.0.0/32", "10.0.0.0/8"})
+		if got := clientIP(t, app, "1.1.1.1, 203.0.113.7, 10.0.0.2"); got != "203.0.113.7" {
+			t.Errorf("expected 203.0.113.7, got %s", got)
+		}
+	})
+
+	t.Run("untrusted peer ignores the header", func(t *testing.T) {
+		app := newApp([]string{"10.0.0.0/8"})
+		if got := clientIP(t, app, "203.0.113.7"); got != "0.0.0.0" {
+			t.Errorf("expected peer address, got %s", got)
+		}
+	})
+
+	t.Run("no proxies configured ignores the header", func(t *testing.T) {
+		app := newApp(nil)
+		if got := clientIP(t, app, "203.0.113.7"); got != "0.0.0.0" {
+			t.Errorf("expected peer address, got %s", got)
+		}
+	})
+}
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"github.com/docshare/api/internal/database"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ReplicaReads lets GET and HEAD requests read from the database replicas.
+// Handlers opt in by running their queries with c.UserContext(); a request
+// that writes goes back to the primary for the rest of its reads. Other
+// methods always use the primary.
+func ReplicaReads() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+			c.SetUserContext(database.WithReplicaReads(c.UserContext()))
+		}
+		return c.Next()
+	}
+}
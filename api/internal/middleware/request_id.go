@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength matches the request_id columns in audit_logs and
+// outbox_events.
+const maxRequestIDLength = 36
+
+// RequestID assigns every request an ID, stores it in c.Locals and the
+// request's contexts and echoes it in the X-Request-ID response header. A well-formed X-Request-ID sent
+// by the client or an upstream proxy is kept so logs can be correlated
+// across hops; anything else is replaced with a fresh ID.
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requestID := c.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = logger.GenerateRequestID()
+		}
+		c.Locals(utils.RequestIDKey, requestID)
+		utils.SetRequestInfo(c, utils.RequestInfo{ID: requestID, Method: c.Method(), Path: strings.Clone(c.Path())})
+		c.Set(RequestIDHeader, requestID)
+		return c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
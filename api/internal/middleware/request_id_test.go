@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestRequestID(t *testing.T) {
+	app := fiber.New()
+	app.Use(RequestID())
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(utils.RequestID(c))
+	})
+
+	cases := []struct {
+		name     string
+		inbound  string
+		wantKept bool
+	}{
+		{"generated when absent", "", false},
+		{"kept when well formed", "edge-7f3a.42_b", true},
+		{"replaced when too long", strings.Repeat("a", 37), false},
+		{"replaced when it contains unsafe characters", "abc\"def", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.inbound != "" {
+				req.Header.Set(RequestIDHeader, tc.inbound)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			local, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("failed reading body: %v", err)
+			}
+			header := resp.Header.Get(RequestIDHeader)
+			if header != string(local) {
+				t.Fatalf("response header %q does not match request ID %q", header, local)
+			}
+			if tc.wantKept {
+				if header != tc.inbound {
+					t.Fatalf("expected inbound ID %q to be kept, got %q", tc.inbound, header)
+				}
+				return
+			}
+			if _, err := uuid.Parse(header); err != nil {
+				t.Fatalf("expected a generated UUID, got %q", header)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/services"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const organizationKey = "organization"
+
+var (
+	errOrganizationNotFound = utils.NewError(fiber.StatusNotFound, "organization_not_found", "organization not found")
+
+	// ErrOrganizationMismatch is reported when credentials are presented
+	// to a tenant other than the one the account belongs to.
+	ErrOrganizationMismatch = utils.NewError(fiber.StatusForbidden, "organization_mismatch", "account belongs to another organization")
+)
+
+// Tenant resolves the organization each request is addressed to and stores
+// it for GetOrganization. The tenancy header wins over the subdomain of
+// BaseDomain; requests carrying neither belong to the default tenant. When
+// tenancy is disabled every request belongs to the default tenant.
+func Tenant(db *gorm.DB, cfg config.TenancyConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !cfg.Enabled {
+			return c.Next()
+		}
+
+		slug := strings.ToLower(strings.TrimSpace(c.Get(cfg.Header)))
+		if slug == "" {
+			slug = subdomain(c.Hostname(), cfg.BaseDomain)
+		}
+		if slug == "" {
+			return c.Next()
+		}
+
+		var org models.Organization
+		if err := db.First(&org, "slug = ?", slug).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return utils.Fail(c, errOrganizationNotFound)
+			}
+			return utils.Error(c, fiber.StatusInternalServerError, "failed resolving organization")
+		}
+
+		c.Locals(organizationKey, &org)
+		return c.Next()
+	}
+}
+
+// subdomain returns the single label host adds in front of baseDomain, or
+// "" when host is baseDomain itself or lies outside it.
+func subdomain(host, baseDomain string) string {
+	if baseDomain == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	label, ok := strings.CutSuffix(host, "."+baseDomain)
+	if !ok || label == "" || strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
+
+// GetOrganization returns the tenant the request was resolved to, or nil
+// for the default tenant.
+func GetOrganization(c *fiber.Ctx) *models.Organization {
+	org, _ := c.Locals(organizationKey).(*models.Organization)
+	return org
+}
+
+// GetOrganizationID is GetOrganization reduced to the ID stored on users,
+// groups and files.
+func GetOrganizationID(c *fiber.Ctx) *uuid.UUID {
+	return models.OrganizationIDOf(GetOrganization(c))
+}
+
+// inRequestTenant reports whether user belongs to the tenant the request was
+// resolved to.
+func inRequestTenant(c *fiber.Ctx, user *models.User) bool {
+	return services.SameOrganization(GetOrganizationID(c), user.OrganizationID)
+}
+
+// PlatformAdminOnly admits admins of the default tenant, who manage the
+// organizations themselves. It must run after AdminOnly or AdminAccess.
+func PlatformAdminOnly(c *fiber.Ctx) error {
+	user := GetCurrentUser(c)
+	if user == nil || user.OrganizationID != nil {
+		return utils.Fail(c, errAdminRequired.WithMessage("platform admin access required"))
+	}
+	return c.Next()
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSubdomain(t *testing.T) {
+	cases := []struct {
+		host, base, want string
+	}{
+		{"acme.docshare.io", "docshare.io", "acme"},
+		{"ACME.docshare.io:8443", "docshare.io", "acme"},
+		{"acme.docshare.io.", "docshare.io", "acme"},
+		{"docshare.io", "docshare.io", ""},
+		{"a.b.docshare.io", "docshare.io", ""},
+		{"acme.example.com", "docshare.io", ""},
+		{"evildocshare.io", "docshare.io", ""},
+		{"acme.docshare.io", "", ""},
+	}
+	for _, tc := range cases {
+		if got := subdomain(tc.host, tc.base); got != tc.want {
+			t.Errorf("subdomain(%q, %q) = %q, want %q", tc.host, tc.base, got, tc.want)
+		}
+	}
+}
+
+func TestTenant(t *testing.T) {
+	db := setupMiddlewareTestDB(t)
+	if err := db.AutoMigrate(&models.Organization{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+	org := models.Organization{Name: "Acme", Slug: "acme"}
+	if err := db.Create(&org).Error; err != nil {
+		t.Fatalf("failed creating organization: %v", err)
+	}
+
+	newApp := func(cfg config.TenancyConfig) *fiber.App {
+		app := fiber.New()
+		app.Use(Tenant(db, cfg))
+		app.Get("/", func(c *fiber.Ctx) error {
+			if org := GetOrganization(c); org != nil {
+				return c.SendString(org.Slug)
+			}
+			return c.SendString("default")
+		})
+		return app
+	}
+	resolve := func(t *testing.T, app *fiber.App, host, header string) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = host
+		if header != "" {
+			req.Header.Set("X-Organization", header)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(raw)
+	}
+
+	enabled := newApp(config.TenancyConfig{Enabled: true, BaseDomain: "docshare.io", Header: "X-Organization"})
+
+	if status, body := resolve(t, enabled, "acme.docshare.io", ""); status != http.StatusOK || body != "acme" {
+		t.Errorf("subdomain: got %d %q", status, body)
+	}
+	if status, body := resolve(t, enabled, "docshare.io", "acme"); status != http.StatusOK || body != "acme" {
+		t.Errorf("header: got %d %q", status, body)
+	}
+	if status, body := resolve(t, enabled, "docshare.io", ""); status != http.StatusOK || body != "default" {
+		t.Errorf("base domain: got %d %q", status, body)
+	}
+	if status, _ := resolve(t, enabled, "unknown.docshare.io", ""); status != http.StatusNotFound {
+		t.Errorf("unknown tenant: expected 404, got %d", status)
+	}
+
+	disabled := newApp(config.TenancyConfig{Header: "X-Organization"})
+	if status, body := resolve(t, disabled, "acme.docshare.io", "acme"); status != http.StatusOK || body != "default" {
+		t.Errorf("disabled: got %d %q", status, body)
+	}
+}
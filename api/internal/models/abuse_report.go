@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AbuseReason is why a recipient flagged a publicly shared file.
+type AbuseReason string
+
+const (
+	AbuseReasonSpam      AbuseReason = "spam"
+	AbuseReasonMalware   AbuseReason = "malware"
+	AbuseReasonPhishing  AbuseReason = "phishing"
+	AbuseReasonCopyright AbuseReason = "copyright"
+	AbuseReasonIllegal   AbuseReason = "illegal"
+	AbuseReasonOther     AbuseReason = "other"
+)
+
+// AbuseReportStatus tracks a report through the moderation queue. Open and
+// reviewing reports are still in the queue; actioned and dismissed ones
+// are closed.
+type AbuseReportStatus string
+
+const (
+	AbuseReportStatusOpen      AbuseReportStatus = "open"
+	AbuseReportStatusReviewing AbuseReportStatus = "reviewing"
+	AbuseReportStatusActioned  AbuseReportStatus = "actioned"
+	AbuseReportStatusDismissed AbuseReportStatus = "dismissed"
+)
+
+// ModerationAction is what an admin did about a report.
+type ModerationAction string
+
+const (
+	ModerationActionDisableShare   ModerationAction = "disable_share"
+	ModerationActionQuarantineFile ModerationAction = "quarantine_file"
+	ModerationActionSuspendOwner   ModerationAction = "suspend_owner"
+)
+
+// AbuseReport is a flag raised against a publicly shared file. Reports can
+// come from anonymous visitors, so ReporterID is optional; ReporterEmail is
+// whatever contact address they chose to leave.
+type AbuseReport struct {
+	BaseModel
+	FileID        uuid.UUID         `json:"fileID" gorm:"type:uuid;not null;index"`
+	ShareID       *uuid.UUID        `json:"shareID,omitempty" gorm:"type:uuid;index"`
+	ReporterID    *uuid.UUID        `json:"reporterID,omitempty" gorm:"type:uuid;index"`
+	ReporterEmail string            `json:"reporterEmail,omitempty" gorm:"type:varchar(255)"`
+	ReporterIP    string            `json:"reporterIP" gorm:"type:varchar(45);not null;index"`
+	Reason        AbuseReason       `json:"reason" gorm:"type:varchar(20);not null"`
+	Details       string            `json:"details,omitempty" gorm:"type:varchar(2000)"`
+	Status        AbuseReportStatus `json:"status" gorm:"type:varchar(20);not null;default:open;index"`
+	// Action is the most recent action taken on the report; the audit log
+	// has the full history.
+	Action       ModerationAction `json:"action,omitempty" gorm:"type:varchar(20)"`
+	Resolution   string           `json:"resolution,omitempty" gorm:"type:varchar(1000)"`
+	ReviewedByID *uuid.UUID       `json:"reviewedByID,omitempty" gorm:"type:uuid"`
+	ReviewedAt   *time.Time       `json:"reviewedAt,omitempty"`
+	File         File             `json:"file,omitempty" gorm:"foreignKey:FileID;references:ID"`
+	Share        *Share           `json:"share,omitempty" gorm:"foreignKey:ShareID;references:ID"`
+	Reporter     *User            `json:"reporter,omitempty" gorm:"foreignKey:ReporterID;references:ID"`
+}
+
+// IsClosed reports whether the report has left the queue.
+func (r *AbuseReport) IsClosed() bool {
+	return r.Status == AbuseReportStatusActioned || r.Status == AbuseReportStatusDismissed
+}
+
+func (AbuseReport) TableName() string {
+	return "abuse_reports"
+}
@@ -2,16 +2,21 @@ package models
 
 import "github.com/google/uuid"
 
+// Activity is an entry in a user's activity feed. Message holds the
+// English rendering; MessageKey and MessageParams let readers re-render it
+// in their own locale.
 type Activity struct {
 	BaseModel
-	UserID       uuid.UUID  `json:"userID" gorm:"type:uuid;not null;index"`
-	ActorID      uuid.UUID  `json:"actorID" gorm:"type:uuid;not null"`
-	Action       string     `json:"action" gorm:"type:varchar(50);not null"`
-	ResourceType string     `json:"resourceType" gorm:"type:varchar(30);not null"`
-	ResourceID   *uuid.UUID `json:"resourceID,omitempty" gorm:"type:uuid"`
-	ResourceName string     `json:"resourceName" gorm:"type:varchar(255);not null"`
-	Message      string     `json:"message" gorm:"type:text;not null"`
-	IsRead       bool       `json:"isRead" gorm:"not null;default:false;index"`
+	UserID        uuid.UUID         `json:"userID" gorm:"type:uuid;not null;index"`
+	ActorID       uuid.UUID         `json:"actorID" gorm:"type:uuid;not null"`
+	Action        string            `json:"action" gorm:"type:varchar(50);not null"`
+	ResourceType  string            `json:"resourceType" gorm:"type:varchar(30);not null"`
+	ResourceID    *uuid.UUID        `json:"resourceID,omitempty" gorm:"type:uuid"`
+	ResourceName  string            `json:"resourceName" gorm:"type:varchar(255);not null"`
+	Message       string            `json:"message" gorm:"type:text;not null"`
+	MessageKey    string            `json:"messageKey,omitempty" gorm:"type:varchar(100)"`
+	MessageParams map[string]string `json:"messageParams,omitempty" gorm:"type:jsonb;serializer:json"`
+	IsRead        bool              `json:"isRead" gorm:"not null;default:false;index"`
 
 	Actor User `json:"actor,omitempty" gorm:"foreignKey:ActorID;references:ID"`
 }
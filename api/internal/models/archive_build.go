@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ArchiveBuildStatus is the state of an archive build.
+type ArchiveBuildStatus string
+
+const (
+	ArchiveBuildPending   ArchiveBuildStatus = "pending"
+	ArchiveBuildRunning   ArchiveBuildStatus = "running"
+	ArchiveBuildCompleted ArchiveBuildStatus = "completed"
+	ArchiveBuildFailed    ArchiveBuildStatus = "failed"
+)
+
+// ArchiveBuildSkip is a file left out of a built archive, and why.
+type ArchiveBuildSkip struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// ArchiveBuild packs the files and folders SourceIDs into a ZIP stored as
+// a new file named Name in TargetFolderID, or the requester's root when it
+// is nil. FileID is the archive once it has been stored.
+type ArchiveBuild struct {
+	BaseModel
+	RequestedByID  uuid.UUID          `json:"requestedByID" gorm:"type:uuid;not null;index"`
+	SourceIDs      []uuid.UUID        `json:"sourceIDs" gorm:"type:jsonb;serializer:json"`
+	TargetFolderID *uuid.UUID         `json:"targetFolderID,omitempty" gorm:"type:uuid"`
+	Name           string             `json:"name" gorm:"type:varchar(255);not null"`
+	Status         ArchiveBuildStatus `json:"status" gorm:"type:varchar(20);not null;default:pending;index"`
+	FileID         *uuid.UUID         `json:"fileID,omitempty" gorm:"type:uuid"`
+	FilesTotal     int64              `json:"filesTotal" gorm:"not null;default:0"`
+	FilesDone      int64              `json:"filesDone" gorm:"not null;default:0"`
+	BytesDone      int64              `json:"bytesDone" gorm:"not null;default:0"`
+	Size           int64              `json:"size" gorm:"not null;default:0"`
+	// Skipped lists the first hundred files left out of the archive.
+	Skipped    []ArchiveBuildSkip `json:"skipped,omitempty" gorm:"type:jsonb;serializer:json"`
+	LastError  string             `json:"lastError,omitempty" gorm:"type:text"`
+	StartedAt  *time.Time         `json:"startedAt,omitempty"`
+	FinishedAt *time.Time         `json:"finishedAt,omitempty"`
+}
+
+func (ArchiveBuild) TableName() string {
+	return "archive_builds"
+}
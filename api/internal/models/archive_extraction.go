@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ArchiveExtractionStatus is the state of an archive extraction.
+type ArchiveExtractionStatus string
+
+const (
+	ArchiveExtractionPending   ArchiveExtractionStatus = "pending"
+	ArchiveExtractionRunning   ArchiveExtractionStatus = "running"
+	ArchiveExtractionCompleted ArchiveExtractionStatus = "completed"
+	ArchiveExtractionFailed    ArchiveExtractionStatus = "failed"
+)
+
+// ArchiveExtractionFailure is one archive entry that could not be
+// unpacked.
+type ArchiveExtractionFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// ArchiveExtraction unpacks the ZIP or TAR archive FileID into the folder
+// TargetFolderID, as files owned by RequestedByID. EntriesDone counts the
+// archive entries handled so far, in stored order, so a retried run skips
+// past them. EntriesTotal is only known up front for ZIP archives.
+type ArchiveExtraction struct {
+	BaseModel
+	FileID         uuid.UUID               `json:"fileID" gorm:"type:uuid;not null;index"`
+	TargetFolderID uuid.UUID               `json:"targetFolderID" gorm:"type:uuid;not null;index"`
+	RequestedByID  uuid.UUID               `json:"requestedByID" gorm:"type:uuid;not null;index"`
+	Status         ArchiveExtractionStatus `json:"status" gorm:"type:varchar(20);not null;default:pending;index"`
+	EntriesTotal   *int64                  `json:"entriesTotal,omitempty"`
+	EntriesDone    int64                   `json:"entriesDone" gorm:"not null;default:0"`
+	FilesExtracted int64                   `json:"filesExtracted" gorm:"not null;default:0"`
+	FoldersCreated int64                   `json:"foldersCreated" gorm:"not null;default:0"`
+	BytesExtracted int64                   `json:"bytesExtracted" gorm:"not null;default:0"`
+	FilesSkipped   int64                   `json:"filesSkipped" gorm:"not null;default:0"`
+	FilesFailed    int64                   `json:"filesFailed" gorm:"not null;default:0"`
+	// Failures lists the first hundred entries that could not be unpacked.
+	Failures   []ArchiveExtractionFailure `json:"failures,omitempty" gorm:"type:jsonb;serializer:json"`
+	LastError  string                     `json:"lastError,omitempty" gorm:"type:text"`
+	StartedAt  *time.Time                 `json:"startedAt,omitempty"`
+	FinishedAt *time.Time                 `json:"finishedAt,omitempty"`
+}
+
+func (ArchiveExtraction) TableName() string {
+	return "archive_extractions"
+}
@@ -14,11 +14,14 @@ type AuditLog struct {
 	UserID       *uuid.UUID             `json:"userID,omitempty" gorm:"type:uuid;index"`
 	Action       string                 `json:"action" gorm:"type:varchar(50);not null;index"`
 	ResourceType string                 `json:"resourceType" gorm:"type:varchar(30);not null;index"`
-	ResourceID   *uuid.UUID             `json:"resourceID,omitempty" gorm:"type:uuid;index"`
+	ResourceID   *uuid.UUID             `json:"resourceID,omitempty" gorm:"type:uuid;index;index:idx_audit_logs_resource_created,priority:1"`
 	Details      map[string]interface{} `json:"details,omitempty" gorm:"type:jsonb;serializer:json"`
 	IPAddress    string                 `json:"ipAddress" gorm:"type:varchar(45);not null"`
 	RequestID    string                 `json:"requestID,omitempty" gorm:"type:varchar(36)"`
-	CreatedAt    time.Time              `json:"createdAt" gorm:"not null;index"`
+	// EventID links rows written from the outbox to their source event so
+	// a redelivered event does not produce a second audit entry.
+	EventID   *uuid.UUID `json:"eventID,omitempty" gorm:"type:uuid;uniqueIndex"`
+	CreatedAt time.Time  `json:"createdAt" gorm:"not null;index;index:idx_audit_logs_resource_created,priority:2"`
 }
 
 func (a *AuditLog) BeforeCreate(_ *gorm.DB) error {
@@ -35,10 +38,12 @@ func (AuditLog) TableName() string {
 	return "audit_logs"
 }
 
-// AuditExportCursor tracks the last successful export timestamp so
-// the periodic S3 export only ships new rows.
+// AuditExportCursor tracks the last successful export timestamp for one
+// audit sink so each sink only ships rows it has not delivered yet. Rows
+// written before sinks existed belong to the S3 export.
 type AuditExportCursor struct {
 	ID            uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	Sink          string    `json:"sink" gorm:"type:varchar(50);not null;default:s3;uniqueIndex"`
 	LastExportAt  time.Time `json:"lastExportAt" gorm:"not null"`
 	ExportedCount int64     `json:"exportedCount" gorm:"not null;default:0"`
 }
@@ -53,3 +58,51 @@ func (a *AuditExportCursor) BeforeCreate(_ *gorm.DB) error {
 func (AuditExportCursor) TableName() string {
 	return "audit_export_cursors"
 }
+
+// AuditExportObject records one NDJSON object written by the S3 export and
+// the range of rows it holds, so retention can check the export is still
+// there before purging those rows.
+type AuditExportObject struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	Key       string    `json:"key" gorm:"type:varchar(255);not null;uniqueIndex"`
+	FirstAt   time.Time `json:"firstAt" gorm:"not null;index"`
+	LastAt    time.Time `json:"lastAt" gorm:"not null"`
+	Count     int       `json:"count" gorm:"not null"`
+	Size      int64     `json:"size" gorm:"not null"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (o *AuditExportObject) BeforeCreate(_ *gorm.DB) error {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	return nil
+}
+
+func (AuditExportObject) TableName() string {
+	return "audit_export_objects"
+}
+
+// AuditRetentionRun is one pass of the audit retention job. PurgedThrough
+// is the newest row it was allowed to delete; BlockedReason says why it
+// stopped short of the retention cutoff.
+type AuditRetentionRun struct {
+	ID            uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	Cutoff        time.Time  `json:"cutoff" gorm:"not null"`
+	PurgedThrough *time.Time `json:"purgedThrough,omitempty"`
+	Purged        int64      `json:"purged" gorm:"not null;default:0"`
+	BlockedReason string     `json:"blockedReason,omitempty" gorm:"type:text"`
+	StartedAt     time.Time  `json:"startedAt" gorm:"not null;index"`
+	FinishedAt    *time.Time `json:"finishedAt,omitempty"`
+}
+
+func (r *AuditRetentionRun) BeforeCreate(_ *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+func (AuditRetentionRun) TableName() string {
+	return "audit_retention_runs"
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CaptchaPass records that an address solved a CAPTCHA for a public share,
+// so later downloads from it go straight through until ExpiresAt.
+type CaptchaPass struct {
+	BaseModel
+	ShareID   uuid.UUID `json:"shareID" gorm:"type:uuid;not null;uniqueIndex:idx_captcha_passes_share_ip,priority:1"`
+	IPAddress string    `json:"ipAddress" gorm:"type:varchar(45);not null;uniqueIndex:idx_captcha_passes_share_ip,priority:2"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"not null;index"`
+}
+
+func (CaptchaPass) TableName() string {
+	return "captcha_passes"
+}
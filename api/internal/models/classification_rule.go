@@ -0,0 +1,44 @@
+package models
+
+import "github.com/google/uuid"
+
+// ClassificationRule is an admin-defined rule checked against every new
+// upload. It matches when each of its non-empty conditions does: the file's
+// extension is one of Extensions, its declared or sniffed type one of
+// MimeTypes (wildcards such as "image/*" allowed), its name matches the
+// NamePattern glob, and the uploader belongs to one of GroupIDs. Rules are
+// checked in Priority order, lowest first, and every rule that matches
+// applies its actions.
+type ClassificationRule struct {
+	BaseModel
+	Name        string `json:"name" gorm:"type:varchar(255);not null"`
+	Description string `json:"description,omitempty" gorm:"type:text"`
+	Priority    int    `json:"priority" gorm:"not null;default:100;index"`
+	Enabled     bool   `json:"enabled" gorm:"not null;default:true"`
+
+	Extensions  []string    `json:"extensions,omitempty" gorm:"type:jsonb;serializer:json"`
+	MimeTypes   []string    `json:"mimeTypes,omitempty" gorm:"type:jsonb;serializer:json"`
+	NamePattern string      `json:"namePattern,omitempty" gorm:"type:varchar(255)"`
+	GroupIDs    []uuid.UUID `json:"groupIDs,omitempty" gorm:"type:jsonb;serializer:json"`
+
+	// Tags are added to the file's tags.
+	Tags []string `json:"tags,omitempty" gorm:"type:jsonb;serializer:json"`
+	// FolderID moves the file into that folder, whatever folder it was
+	// uploaded to. The first matching rule with a folder wins.
+	FolderID *uuid.UUID `json:"folderID,omitempty" gorm:"type:uuid"`
+	// RetentionClass is set on the file. The first matching rule with a
+	// class wins.
+	RetentionClass string `json:"retentionClass,omitempty" gorm:"type:varchar(64)"`
+	// Scan has the file checked for malware after it is stored, and
+	// quarantined if it is infected.
+	Scan bool `json:"scan" gorm:"not null;default:false"`
+	// Block refuses the upload. Rules after a blocking rule are not
+	// checked.
+	Block bool `json:"block" gorm:"not null;default:false"`
+
+	CreatedByID uuid.UUID `json:"createdByID" gorm:"type:uuid;not null"`
+}
+
+func (ClassificationRule) TableName() string {
+	return "classification_rules"
+}
@@ -24,4 +24,16 @@ type DeviceCode struct {
 	Status         DeviceCodeStatus `json:"status" gorm:"type:varchar(20);not null;default:'pending';index"`
 	UserID         *uuid.UUID       `json:"userID,omitempty" gorm:"type:uuid;index"`
 	User           *User            `json:"-" gorm:"foreignKey:UserID"`
+
+	// The requesting client, shown on the verification screen so the
+	// approver can tell whether the request came from their own device.
+	ClientID         string `json:"clientID" gorm:"type:varchar(100)"`
+	ClientName       string `json:"clientName" gorm:"type:varchar(100)"`
+	RequestIP        string `json:"requestIP" gorm:"type:varchar(64)"`
+	RequestUserAgent string `json:"requestUserAgent" gorm:"type:varchar(255)"`
+	// CodeChallenge is the S256 challenge the client committed to; only the
+	// holder of the matching verifier can redeem the code.
+	CodeChallenge string     `json:"-" gorm:"type:varchar(128)"`
+	ApprovedAt    *time.Time `json:"approvedAt,omitempty"`
+	LastPolledAt  *time.Time `json:"-"`
 }
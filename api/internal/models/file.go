@@ -1,6 +1,11 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
 
 type File struct {
 	BaseModel
@@ -12,6 +17,57 @@ type File struct {
 	OwnerID       uuid.UUID  `json:"ownerID" gorm:"type:uuid;not null;index"`
 	StoragePath   string     `json:"storagePath" gorm:"type:text;not null"`
 	ThumbnailPath *string    `json:"thumbnailPath,omitempty" gorm:"type:text"`
+	// Checksum is the hex SHA-256 of the stored bytes. It is recorded when
+	// the server sees the content (multipart upload, editor saves) and
+	// filled in lazily for presigned uploads the first time it is needed.
+	Checksum *string `json:"checksum,omitempty" gorm:"type:varchar(64);index"`
+	// DeclaredMimeType is the Content-Type the client sent and
+	// DetectedMimeType what the server sniffed from the first bytes.
+	// MimeType stays the effective type used for previews and downloads.
+	DeclaredMimeType string `json:"declaredMimeType,omitempty" gorm:"type:varchar(255)"`
+	DetectedMimeType string `json:"detectedMimeType,omitempty" gorm:"type:varchar(255)"`
+	// OrganizationID is copied from the owner when the file is created so
+	// tenant checks and quota sums need not join users.
+	OrganizationID *uuid.UUID `json:"organizationID,omitempty" gorm:"type:uuid;index"`
+	// QuarantinedAt is set when a moderator pulls the file after an abuse
+	// report. Nobody, the owner included, can open it or anything below it
+	// until an admin releases it.
+	QuarantinedAt *time.Time `json:"quarantinedAt,omitempty" gorm:"index"`
+	// TotalSize and ItemCount roll up a directory's subtree: the bytes of
+	// every file below it and how many files and folders that is. They are
+	// kept by services.FolderRollups and stay nil for files and for folders
+	// not counted yet.
+	TotalSize *int64 `json:"totalSize,omitempty"`
+	ItemCount *int64 `json:"itemCount,omitempty"`
+	// VaultID is set on an end-to-end encrypted folder, to its own ID, and
+	// on everything below it, to the folder's. The server only holds
+	// ciphertext for these files and never previews or indexes them.
+	VaultID *uuid.UUID `json:"vaultID,omitempty" gorm:"type:uuid;index"`
+	// PasswordHash is the bcrypt hash of a password that everyone but the
+	// owner must give before downloading or previewing the file, on top of
+	// whatever share lets them reach it. PasswordProtected tells clients
+	// to ask for it.
+	PasswordHash      string `json:"-" gorm:"type:varchar(255)"`
+	PasswordProtected bool   `json:"passwordProtected" gorm:"not null;default:false"`
+	// Tags and RetentionClass are set by classification rules when the
+	// file is uploaded.
+	Tags           []string `json:"tags,omitempty" gorm:"type:jsonb;serializer:json"`
+	RetentionClass string   `json:"retentionClass,omitempty" gorm:"type:varchar(64);index"`
+	// Language is the ISO 639-1 code of the language the file's text is
+	// written in, set by services.LanguageDetector after each upload or
+	// edit. It stays empty for files without text to read and for text
+	// whose language is unclear.
+	Language string `json:"language,omitempty" gorm:"type:varchar(8);index"`
+	// ReviewStatus is where the file stands in the review workflow. It
+	// stays empty, which reads as draft, until the file is first sent for
+	// review.
+	ReviewStatus ReviewStatus `json:"reviewStatus,omitempty" gorm:"type:varchar(20);index"`
+	// ArchivedAt is set while the file's bytes are in cold storage, where
+	// they cannot be read. RestoreRequestedAt and RestoreETA are set from
+	// when a restore is requested until it completes.
+	ArchivedAt         *time.Time `json:"archivedAt,omitempty" gorm:"index"`
+	RestoreRequestedAt *time.Time `json:"restoreRequestedAt,omitempty"`
+	RestoreETA         *time.Time `json:"restoreETA,omitempty"`
 
 	Parent     *File   `json:"parent,omitempty" gorm:"foreignKey:ParentID"`
 	Children   []File  `json:"children,omitempty" gorm:"foreignKey:ParentID"`
@@ -26,4 +82,24 @@ type File struct {
 	// would only 403 inside the editor's /binary fetch.
 	CanEdit     bool `json:"canEdit" gorm:"-"`
 	CanDownload bool `json:"canDownload" gorm:"-"`
+	// Lock is the active advisory lock, if any, attached by handlers.
+	Lock *FileLock `json:"lock,omitempty" gorm:"-"`
+}
+
+// BeforeCreate puts a new file in its parent's vault, whichever code path
+// creates it.
+func (f *File) BeforeCreate(tx *gorm.DB) error {
+	if err := f.BaseModel.BeforeCreate(tx); err != nil {
+		return err
+	}
+	if f.VaultID != nil || f.ParentID == nil {
+		return nil
+	}
+	var parent File
+	err := tx.Session(&gorm.Session{NewDB: true}).Select("vault_id").First(&parent, "id = ?", *f.ParentID).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+	f.VaultID = parent.VaultID
+	return nil
 }
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileAccessKind is what a recipient did with a shared file.
+type FileAccessKind string
+
+const (
+	FileAccessView     FileAccessKind = "view"
+	FileAccessDownload FileAccessKind = "download"
+)
+
+// FileAccessStat counts one visitor's views or downloads of a file on one
+// day, through one share and from one referring site. Keeping counts per
+// visitor and day rather than per request keeps the table small while still
+// answering how many people opened a file. ShareID is uuid.Nil for access
+// that did not go through a share, such as an owner's collaborator opening
+// a preview.
+type FileAccessStat struct {
+	BaseModel
+	FileID       uuid.UUID      `json:"fileID" gorm:"type:uuid;not null;uniqueIndex:idx_file_access_stats_key,priority:1"`
+	ShareID      uuid.UUID      `json:"shareID" gorm:"type:uuid;not null;uniqueIndex:idx_file_access_stats_key,priority:2"`
+	Day          string         `json:"day" gorm:"type:varchar(10);not null;uniqueIndex:idx_file_access_stats_key,priority:3"`
+	Kind         FileAccessKind `json:"kind" gorm:"type:varchar(10);not null;uniqueIndex:idx_file_access_stats_key,priority:4"`
+	VisitorHash  string         `json:"-" gorm:"type:varchar(32);not null;uniqueIndex:idx_file_access_stats_key,priority:5"`
+	ReferrerHost string         `json:"referrerHost" gorm:"type:varchar(255);not null;default:'';uniqueIndex:idx_file_access_stats_key,priority:6"`
+	Count        int64          `json:"count" gorm:"not null;default:0"`
+	LastAt       time.Time      `json:"lastAt" gorm:"not null"`
+}
+
+func (FileAccessStat) TableName() string {
+	return "file_access_stats"
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileDueDate is the date a file or folder is due for review or delivery.
+// Reminders go out ReminderHours before DueAt; NextReminderAt is when the
+// next one is sent, or nil once none are left.
+type FileDueDate struct {
+	BaseModel
+	FileID         uuid.UUID  `json:"fileID" gorm:"type:uuid;not null;uniqueIndex"`
+	DueAt          time.Time  `json:"dueAt" gorm:"not null;index"`
+	Note           string     `json:"note,omitempty" gorm:"type:varchar(500)"`
+	ReminderHours  []int      `json:"reminderHours" gorm:"type:jsonb;serializer:json"`
+	NextReminderAt *time.Time `json:"nextReminderAt,omitempty" gorm:"index"`
+	SetByID        uuid.UUID  `json:"setByID" gorm:"type:uuid;not null;index"`
+	Overdue        bool       `json:"overdue" gorm:"-"`
+
+	File  *File `json:"file,omitempty" gorm:"foreignKey:FileID;references:ID"`
+	SetBy *User `json:"setBy,omitempty" gorm:"foreignKey:SetByID;references:ID"`
+}
+
+func (FileDueDate) TableName() string {
+	return "file_due_dates"
+}
+
+// CalendarFeed is a user's secret calendar subscription. Only the SHA-256 of
+// its token is kept; issuing a new token replaces the old one.
+type CalendarFeed struct {
+	BaseModel
+	UserID     uuid.UUID  `json:"userID" gorm:"type:uuid;not null;uniqueIndex"`
+	TokenHash  string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+func (CalendarFeed) TableName() string {
+	return "calendar_feeds"
+}
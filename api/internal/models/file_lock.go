@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileLock is an advisory lock that stops other users from editing or
+// replacing a file's contents while the holder works on it. Expired locks
+// are ignored by readers and swept periodically; rows are hard-deleted so
+// the unique index on file_id stays usable.
+type FileLock struct {
+	BaseModel
+	FileID     uuid.UUID `json:"fileID" gorm:"type:uuid;not null;uniqueIndex"`
+	LockedByID uuid.UUID `json:"lockedByID" gorm:"type:uuid;not null;index"`
+	LockedBy   User      `json:"lockedBy,omitempty" gorm:"foreignKey:LockedByID;references:ID"`
+	Reason     string    `json:"reason,omitempty" gorm:"type:varchar(255)"`
+	ExpiresAt  time.Time `json:"expiresAt" gorm:"not null;index"`
+}
+
+func (FileLock) TableName() string {
+	return "file_locks"
+}
+
+// IsActive reports whether the lock is still in force.
+func (l *FileLock) IsActive() bool {
+	return l != nil && time.Now().Before(l.ExpiresAt)
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReviewStatus is where a file stands in the review workflow. Files carry
+// draft, in_review, approved or rejected; a FileReview is also cancelled
+// when it is withdrawn before being decided.
+type ReviewStatus string
+
+const (
+	ReviewStatusDraft     ReviewStatus = "draft"
+	ReviewStatusInReview  ReviewStatus = "in_review"
+	ReviewStatusApproved  ReviewStatus = "approved"
+	ReviewStatusRejected  ReviewStatus = "rejected"
+	ReviewStatusCancelled ReviewStatus = "cancelled"
+)
+
+// FileReview is one request for a file to be reviewed. It is approved once
+// every reviewer has approved it and rejected as soon as one rejects it.
+type FileReview struct {
+	BaseModel
+	FileID        uuid.UUID    `json:"fileID" gorm:"type:uuid;not null;index"`
+	RequestedByID uuid.UUID    `json:"requestedByID" gorm:"type:uuid;not null;index"`
+	Status        ReviewStatus `json:"status" gorm:"type:varchar(20);not null;index"`
+	Message       string       `json:"message,omitempty" gorm:"type:varchar(1000)"`
+	ClosedAt      *time.Time   `json:"closedAt,omitempty"`
+
+	Reviewers   []FileReviewer `json:"reviewers" gorm:"foreignKey:ReviewID"`
+	File        *File          `json:"file,omitempty" gorm:"foreignKey:FileID;references:ID"`
+	RequestedBy *User          `json:"requestedBy,omitempty" gorm:"foreignKey:RequestedByID;references:ID"`
+}
+
+func (FileReview) TableName() string {
+	return "file_reviews"
+}
+
+type ReviewDecision string
+
+const (
+	ReviewDecisionPending  ReviewDecision = "pending"
+	ReviewDecisionApproved ReviewDecision = "approved"
+	ReviewDecisionRejected ReviewDecision = "rejected"
+)
+
+// FileReviewer is a user, or a group any one member of which may decide
+// for it, asked to review a file.
+type FileReviewer struct {
+	BaseModel
+	ReviewID    uuid.UUID      `json:"reviewID" gorm:"type:uuid;not null;index"`
+	UserID      *uuid.UUID     `json:"userID,omitempty" gorm:"type:uuid;index"`
+	GroupID     *uuid.UUID     `json:"groupID,omitempty" gorm:"type:uuid;index"`
+	Decision    ReviewDecision `json:"decision" gorm:"type:varchar(20);not null"`
+	DecidedByID *uuid.UUID     `json:"decidedByID,omitempty" gorm:"type:uuid"`
+	DecidedAt   *time.Time     `json:"decidedAt,omitempty"`
+	Comment     string         `json:"comment,omitempty" gorm:"type:varchar(1000)"`
+
+	User  *User  `json:"user,omitempty" gorm:"foreignKey:UserID;references:ID"`
+	Group *Group `json:"group,omitempty" gorm:"foreignKey:GroupID;references:ID"`
+}
+
+func (FileReviewer) TableName() string {
+	return "file_reviewers"
+}
@@ -0,0 +1,19 @@
+package models
+
+import "github.com/google/uuid"
+
+// FolderShareDefaults holds the share settings applied to new shares of a
+// folder and of everything below it. The nearest folder with a row wins, so
+// a subfolder can override its parent's defaults.
+type FolderShareDefaults struct {
+	BaseModel
+	FolderID    uuid.UUID       `json:"folderID" gorm:"type:uuid;not null;uniqueIndex"`
+	Permission  SharePermission `json:"permission" gorm:"type:varchar(20);not null;default:'view'"`
+	ExpiryDays  *int            `json:"expiryDays,omitempty"`
+	AllowPublic bool            `json:"allowPublic" gorm:"not null"`
+	Inherited   bool            `json:"inherited" gorm:"-"`
+}
+
+func (FolderShareDefaults) TableName() string {
+	return "folder_share_defaults"
+}
@@ -0,0 +1,68 @@
+package models
+
+import "github.com/google/uuid"
+
+// FolderTemplate is a saved folder structure, with optional seed files and
+// default shares, that can be recreated under any folder. Entry names may
+// hold {{variables}} that are filled in each time the template is used.
+// Shared templates can be used by everyone in the owner's organization.
+type FolderTemplate struct {
+	BaseModel
+	Name           string     `json:"name" gorm:"type:varchar(255);not null"`
+	Description    string     `json:"description,omitempty" gorm:"type:text"`
+	OwnerID        uuid.UUID  `json:"ownerID" gorm:"type:uuid;not null;index"`
+	OrganizationID *uuid.UUID `json:"organizationID,omitempty" gorm:"type:uuid;index"`
+	Shared         bool       `json:"shared" gorm:"not null;default:false"`
+	// Variables are the names used in {{...}} placeholders, other than the
+	// built-in ones, which a caller must give values for.
+	Variables []string `json:"variables" gorm:"type:jsonb;serializer:json"`
+	Folders   int      `json:"folders" gorm:"not null;default:0"`
+	Files     int      `json:"files" gorm:"not null;default:0"`
+	SeedBytes int64    `json:"seedBytes" gorm:"not null;default:0"`
+
+	Entries []FolderTemplateEntry `json:"entries,omitempty" gorm:"foreignKey:TemplateID"`
+}
+
+func (FolderTemplate) TableName() string {
+	return "folder_templates"
+}
+
+// FolderTemplateEntry is one folder or seed file of a template. Path is
+// the names from the template's root folder down, joined with "/"; the
+// root's own path is its name. Seed file content is a copy held at
+// StoragePath, so later changes to the source do not reach the template.
+type FolderTemplateEntry struct {
+	BaseModel
+	TemplateID  uuid.UUID `json:"-" gorm:"type:uuid;not null;index"`
+	Position    int       `json:"-" gorm:"not null"`
+	Path        string    `json:"path" gorm:"type:text;not null"`
+	IsDirectory bool      `json:"isDirectory" gorm:"not null"`
+	MimeType    string    `json:"mimeType,omitempty" gorm:"type:varchar(255)"`
+	Size        int64     `json:"size,omitempty"`
+	Checksum    *string   `json:"-" gorm:"type:varchar(64)"`
+	StoragePath string    `json:"-" gorm:"type:text"`
+	// ShareDefaults are the folder's share defaults, given to the folder
+	// made from it.
+	ShareDefaults *FolderTemplateShareDefaults `json:"shareDefaults,omitempty" gorm:"type:jsonb;serializer:json"`
+	// Shares are private shares made again, by whoever uses the template,
+	// on the folder or file made from this entry.
+	Shares []FolderTemplateShare `json:"shares,omitempty" gorm:"type:jsonb;serializer:json"`
+}
+
+func (FolderTemplateEntry) TableName() string {
+	return "folder_template_entries"
+}
+
+type FolderTemplateShareDefaults struct {
+	Permission  SharePermission `json:"permission"`
+	ExpiryDays  *int            `json:"expiryDays,omitempty"`
+	AllowPublic bool            `json:"allowPublic"`
+}
+
+type FolderTemplateShare struct {
+	SharedWithUserID  *uuid.UUID      `json:"sharedWithUserID,omitempty"`
+	SharedWithGroupID *uuid.UUID      `json:"sharedWithGroupID,omitempty"`
+	Permission        SharePermission `json:"permission"`
+	Watermark         bool            `json:"watermark,omitempty"`
+	ViewOnly          bool            `json:"viewOnly,omitempty"`
+}
@@ -10,4 +10,19 @@ type Group struct {
 	CreatedBy   User              `json:"createdBy" gorm:"foreignKey:CreatedByID"`
 	Memberships []GroupMembership `json:"memberships,omitempty" gorm:"foreignKey:GroupID"`
 	Shares      []Share           `json:"-" gorm:"foreignKey:SharedWithGroupID"`
+
+	OrganizationID *uuid.UUID `json:"organizationID,omitempty" gorm:"type:uuid;index"`
+
+	// DownloadRateKBps replaces the server's per-user download cap for
+	// members. Nil keeps the default and zero means unlimited.
+	DownloadRateKBps *int64 `json:"downloadRateKBps,omitempty" gorm:"column:download_rate_kbps"`
+
+	// StorageQuotaBytes caps the group drive: the folders shared with the
+	// group and everything in them. With QuotaIncludesMembers the files
+	// members own count too. Nil means unlimited.
+	StorageQuotaBytes    *int64 `json:"storageQuotaBytes,omitempty"`
+	QuotaIncludesMembers bool   `json:"quotaIncludesMembers" gorm:"not null;default:false"`
+	// QuotaWarnedPercent is the highest usage threshold owners were last
+	// warned about, so each crossing is reported once.
+	QuotaWarnedPercent int `json:"-" gorm:"not null;default:0"`
 }
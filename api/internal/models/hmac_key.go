@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// HMACKey lets an integration sign requests instead of sending a bearer
+// token. KeyID is public and sent with every request; Secret is encrypted
+// at rest and shown to the user once, when the key is created.
+type HMACKey struct {
+	BaseModel
+	UserID     uuid.UUID  `json:"userID" gorm:"type:uuid;not null;index"`
+	Name       string     `json:"name" gorm:"type:varchar(255);not null"`
+	KeyID      string     `json:"keyID" gorm:"type:varchar(40);not null;uniqueIndex"`
+	Secret     string     `json:"-" gorm:"type:text;not null"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty" gorm:"index"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+func (HMACKey) TableName() string {
+	return "hmac_keys"
+}
+
+// RequestNonce remembers a nonce a signed request used, so the request
+// cannot be replayed while its timestamp is still accepted. ExpiresAt lets
+// the cleanup job drop it once the timestamp would be refused anyway.
+type RequestNonce struct {
+	BaseModel
+	KeyID     uuid.UUID `json:"keyID" gorm:"type:uuid;not null;uniqueIndex:idx_request_nonces_key_nonce,priority:1"`
+	Nonce     string    `json:"nonce" gorm:"type:varchar(64);not null;uniqueIndex:idx_request_nonces_key_nonce,priority:2"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"not null;index"`
+}
+
+func (RequestNonce) TableName() string {
+	return "request_nonces"
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdempotencyKey remembers the response to a request sent with an
+// Idempotency-Key header, so a client retrying after a lost response gets
+// the original answer instead of repeating the change. A key is scoped to
+// its user and route (method and path). RequestHash fingerprints the first
+// request so reusing the key for a different payload can be refused.
+// StatusCode is zero while the first request is still running.
+type IdempotencyKey struct {
+	BaseModel
+	UserID       uuid.UUID `json:"userID" gorm:"type:uuid;not null;uniqueIndex:idx_idempotency_keys_user_key_route,priority:1"`
+	Key          string    `json:"key" gorm:"type:varchar(255);not null;uniqueIndex:idx_idempotency_keys_user_key_route,priority:2"`
+	Method       string    `json:"method" gorm:"type:varchar(10);not null;uniqueIndex:idx_idempotency_keys_user_key_route,priority:3"`
+	Path         string    `json:"path" gorm:"type:varchar(255);not null;uniqueIndex:idx_idempotency_keys_user_key_route,priority:4"`
+	RequestHash  string    `json:"requestHash" gorm:"type:varchar(64);not null;default:''"`
+	StatusCode   int       `json:"statusCode" gorm:"not null;default:0"`
+	ContentType  string    `json:"contentType" gorm:"type:varchar(100)"`
+	ResponseBody []byte    `json:"-"`
+	ExpiresAt    time.Time `json:"expiresAt" gorm:"not null;index"`
+}
+
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
+
+// IsComplete reports whether the first request finished and its response
+// was stored.
+func (k *IdempotencyKey) IsComplete() bool {
+	return k.StatusCode != 0
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ImportSourceType is where an import reads files from.
+type ImportSourceType string
+
+const (
+	ImportSourceS3         ImportSourceType = "s3"
+	ImportSourceFilesystem ImportSourceType = "filesystem"
+	// The remote sources read through a user's IntegrationConnection.
+	ImportSourceGoogleDrive ImportSourceType = "google_drive"
+	ImportSourceWebDAV      ImportSourceType = "webdav"
+)
+
+// Remote reports whether the source is read through an integration
+// connection rather than configured by an admin.
+func (t ImportSourceType) Remote() bool {
+	return t == ImportSourceGoogleDrive || t == ImportSourceWebDAV
+}
+
+// ImportConflict decides what happens to a file whose name is already
+// taken in its destination folder.
+type ImportConflict string
+
+const (
+	ImportConflictSkip   ImportConflict = "skip"
+	ImportConflictRename ImportConflict = "rename"
+)
+
+// ImportStatus is the state of an import.
+type ImportStatus string
+
+const (
+	ImportStatusPending   ImportStatus = "pending"
+	ImportStatusRunning   ImportStatus = "running"
+	ImportStatusCompleted ImportStatus = "completed"
+	ImportStatusFailed    ImportStatus = "failed"
+	ImportStatusCancelled ImportStatus = "cancelled"
+)
+
+// ImportOwnerRule gives the files under Prefix (a path relative to the
+// import source) to OwnerID. The longest matching prefix wins.
+type ImportOwnerRule struct {
+	Prefix  string    `json:"prefix"`
+	OwnerID uuid.UUID `json:"ownerID"`
+}
+
+// ImportFailure is one file an import could not bring in.
+type ImportFailure struct {
+	Key   string `json:"key"`
+	Error string `json:"error"`
+}
+
+// ImportJob copies an existing bucket prefix, directory or remote folder
+// into DocShare, recreating its folders under TargetFolder in each owner's
+// root. Cursor is the last source path handled, so a resumed import carries
+// on from there.
+type ImportJob struct {
+	BaseModel
+	RequestedByID uuid.UUID        `json:"requestedByID" gorm:"type:uuid;not null;index"`
+	SourceType    ImportSourceType `json:"sourceType" gorm:"type:varchar(20);not null"`
+	Source        string           `json:"source" gorm:"type:text;not null"`
+	Prefix        string           `json:"prefix,omitempty" gorm:"type:text"`
+	// ConnectionID is the integration a remote import reads through.
+	ConnectionID   *uuid.UUID        `json:"connectionID,omitempty" gorm:"type:uuid;index"`
+	Conflict       ImportConflict    `json:"conflict" gorm:"type:varchar(20);not null;default:skip"`
+	TargetFolder   string            `json:"targetFolder" gorm:"type:varchar(255);not null"`
+	DefaultOwnerID uuid.UUID         `json:"defaultOwnerID" gorm:"type:uuid;not null"`
+	OwnerRules     []ImportOwnerRule `json:"ownerRules,omitempty" gorm:"type:jsonb;serializer:json"`
+	Status         ImportStatus      `json:"status" gorm:"type:varchar(20);not null;default:pending;index"`
+	Cursor         string            `json:"cursor,omitempty" gorm:"type:text"`
+	FilesImported  int64             `json:"filesImported" gorm:"not null;default:0"`
+	FoldersCreated int64             `json:"foldersCreated" gorm:"not null;default:0"`
+	BytesImported  int64             `json:"bytesImported" gorm:"not null;default:0"`
+	FilesSkipped   int64             `json:"filesSkipped" gorm:"not null;default:0"`
+	FilesFailed    int64             `json:"filesFailed" gorm:"not null;default:0"`
+	// Failures lists the first hundred files that could not be imported.
+	Failures   []ImportFailure `json:"failures,omitempty" gorm:"type:jsonb;serializer:json"`
+	LastError  string          `json:"lastError,omitempty" gorm:"type:text"`
+	StartedAt  *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+}
+
+func (ImportJob) TableName() string {
+	return "import_jobs"
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IntegrationProvider is a service users can import files from.
+type IntegrationProvider string
+
+const (
+	IntegrationGoogleDrive IntegrationProvider = "google_drive"
+	IntegrationWebDAV      IntegrationProvider = "webdav"
+)
+
+// IntegrationConnection is a user's authorization to read another
+// service. Secret is encrypted: the OAuth token as JSON for Google Drive,
+// the (app) password for WebDAV.
+type IntegrationConnection struct {
+	BaseModel
+	UserID     uuid.UUID           `json:"userID" gorm:"type:uuid;not null;index"`
+	Provider   IntegrationProvider `json:"provider" gorm:"type:varchar(20);not null"`
+	Account    string              `json:"account" gorm:"type:varchar(255)"`
+	BaseURL    string              `json:"baseURL,omitempty" gorm:"type:text"`
+	Username   string              `json:"username,omitempty" gorm:"type:varchar(255)"`
+	Secret     string              `json:"-" gorm:"type:text;not null"`
+	LastUsedAt *time.Time          `json:"lastUsedAt,omitempty"`
+}
+
+func (IntegrationConnection) TableName() string {
+	return "integration_connections"
+}
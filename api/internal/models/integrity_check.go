@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IntegrityFinding counts the rows one check found pointing at something
+// that no longer exists. Sample lists the first few of their ids.
+type IntegrityFinding struct {
+	Check    string      `json:"check"`
+	Count    int64       `json:"count"`
+	Repaired int64       `json:"repaired"`
+	Sample   []uuid.UUID `json:"sample,omitempty"`
+}
+
+// IntegrityCheck records one pass over shares, group memberships and
+// activities looking for rows whose file, user or group is gone. Scheduled
+// passes have no RequestedByID and only report.
+type IntegrityCheck struct {
+	BaseModel
+	RequestedByID *uuid.UUID           `json:"requestedByID,omitempty" gorm:"type:uuid;index"`
+	Status        ReconciliationStatus `json:"status" gorm:"type:varchar(20);not null;default:pending;index"`
+	Repair        bool                 `json:"repair" gorm:"not null;default:false"`
+	DanglingCount int64                `json:"danglingCount" gorm:"not null;default:0"`
+	RepairedCount int64                `json:"repairedCount" gorm:"not null;default:0"`
+	Findings      []IntegrityFinding   `json:"findings,omitempty" gorm:"type:jsonb;serializer:json"`
+	LastError     string               `json:"lastError,omitempty" gorm:"type:text"`
+	StartedAt     *time.Time           `json:"startedAt,omitempty"`
+	FinishedAt    *time.Time           `json:"finishedAt,omitempty"`
+}
+
+func (IntegrityCheck) TableName() string {
+	return "integrity_checks"
+}
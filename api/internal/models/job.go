@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+// JobStatus is the state of a background job.
+type JobStatus string
+
+const (
+	JobStatusPending   JobStatus = "pending"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusCompleted JobStatus = "completed"
+	// JobStatusFailed is terminal: the job used up its attempts and waits
+	// in the dead-letter list until an admin retries it.
+	JobStatusFailed JobStatus = "failed"
+)
+
+// Job is a unit of background work run by the job runner. A pending job is
+// claimed once RunAt has passed and is hidden from other workers until
+// LockedUntil. UniqueKey, when set, allows only one pending job with that
+// key, which is how periodic and per-resource jobs avoid piling up.
+type Job struct {
+	BaseModel
+	Kind        string                 `json:"kind" gorm:"type:varchar(100);not null;index"`
+	Payload     map[string]interface{} `json:"payload,omitempty" gorm:"type:jsonb;serializer:json"`
+	Status      JobStatus              `json:"status" gorm:"type:varchar(20);not null;default:pending;index:idx_jobs_status_run_at"`
+	UniqueKey   *string                `json:"uniqueKey,omitempty" gorm:"type:varchar(255);uniqueIndex:idx_jobs_unique_key,where:status = 'pending'"`
+	Attempts    int                    `json:"attempts" gorm:"not null;default:0"`
+	MaxAttempts int                    `json:"maxAttempts" gorm:"not null"`
+	RunAt       time.Time              `json:"runAt" gorm:"not null;index:idx_jobs_status_run_at"`
+	LockedBy    string                 `json:"lockedBy,omitempty" gorm:"type:varchar(100)"`
+	LockedUntil *time.Time             `json:"lockedUntil,omitempty"`
+	LastError   string                 `json:"lastError,omitempty" gorm:"type:text"`
+	StartedAt   *time.Time             `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time             `json:"finishedAt,omitempty" gorm:"index"`
+}
+
+func (Job) TableName() string {
+	return "jobs"
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LegalExportStatus is the state of a legal export.
+type LegalExportStatus string
+
+const (
+	LegalExportStatusPending   LegalExportStatus = "pending"
+	LegalExportStatusRunning   LegalExportStatus = "running"
+	LegalExportStatusCompleted LegalExportStatus = "completed"
+	LegalExportStatusFailed    LegalExportStatus = "failed"
+)
+
+// LegalExport is an admin-requested eDiscovery bundle: everything a user
+// owns, or everything below a folder, packaged with its metadata, shares
+// and audit trail into one zip with a signed manifest. Exactly one of
+// SubjectUserID and FolderID is set.
+type LegalExport struct {
+	BaseModel
+	RequestedByID uuid.UUID         `json:"requestedByID" gorm:"type:uuid;not null;index"`
+	SubjectUserID *uuid.UUID        `json:"subjectUserID,omitempty" gorm:"type:uuid;index"`
+	FolderID      *uuid.UUID        `json:"folderID,omitempty" gorm:"type:uuid;index"`
+	Reason        string            `json:"reason" gorm:"type:text;not null"`
+	Status        LegalExportStatus `json:"status" gorm:"type:varchar(20);not null;default:pending;index"`
+	// FilesTotal is known once the run has listed what it exports;
+	// FilesDone and BytesDone count what is in the archive so far.
+	FilesTotal int64 `json:"filesTotal" gorm:"not null;default:0"`
+	FilesDone  int64 `json:"filesDone" gorm:"not null;default:0"`
+	BytesDone  int64 `json:"bytesDone" gorm:"not null;default:0"`
+	// ObjectKey, Size and SHA256 describe the finished archive.
+	ObjectKey  string     `json:"-" gorm:"type:text"`
+	Size       int64      `json:"size" gorm:"not null;default:0"`
+	SHA256     string     `json:"sha256,omitempty" gorm:"type:varchar(64)"`
+	LastError  string     `json:"lastError,omitempty" gorm:"type:text"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// LinkTokenHash is the SHA-256 of the current one-time download link's
+	// token, cleared when the link is used.
+	LinkTokenHash  string     `json:"-" gorm:"type:varchar(64);index"`
+	LinkExpiresAt  *time.Time `json:"linkExpiresAt,omitempty"`
+	DownloadCount  int        `json:"downloadCount" gorm:"not null;default:0"`
+	LastDownloadAt *time.Time `json:"lastDownloadAt,omitempty"`
+}
+
+func (LegalExport) TableName() string {
+	return "legal_exports"
+}
@@ -6,6 +6,24 @@ import (
 	"github.com/google/uuid"
 )
 
+// MFARequirement says which users have to enroll in MFA.
+type MFARequirement string
+
+const (
+	MFARequirementNone   MFARequirement = "none"
+	MFARequirementAdmins MFARequirement = "admins"
+	MFARequirementAll    MFARequirement = "all"
+)
+
+// Valid reports whether r is one of the known requirements.
+func (r MFARequirement) Valid() bool {
+	switch r {
+	case MFARequirementNone, MFARequirementAdmins, MFARequirementAll:
+		return true
+	}
+	return false
+}
+
 type MFAConfig struct {
 	BaseModel
 	UserID         uuid.UUID  `json:"userID" gorm:"type:uuid;uniqueIndex;not null"`
@@ -14,5 +32,12 @@ type MFAConfig struct {
 	TOTPVerifiedAt *time.Time `json:"totpVerifiedAt,omitempty"`
 	RecoveryCodes  string     `json:"-" gorm:"type:text"`
 	RecoveryCount  int        `json:"recoveryCodesRemaining" gorm:"default:0"`
-	User           User       `json:"-" gorm:"foreignKey:UserID"`
+	// RecoveryIssued and RecoveryIssuedAt describe the current set of codes.
+	RecoveryIssued   int        `json:"-" gorm:"default:0"`
+	RecoveryIssuedAt *time.Time `json:"-"`
+	// RecoveryDownload holds the current set in plaintext, encrypted, until
+	// it has been downloaded once or RecoveryDownloadExpiresAt passes.
+	RecoveryDownload          string     `json:"-" gorm:"type:text"`
+	RecoveryDownloadExpiresAt *time.Time `json:"-"`
+	User                      User       `json:"-" gorm:"foreignKey:UserID"`
 }
@@ -0,0 +1,30 @@
+package models
+
+import "github.com/google/uuid"
+
+// ActivityMute silences activity about a file, or about anything inside a
+// folder, for one user.
+type ActivityMute struct {
+	BaseModel
+	UserID uuid.UUID `json:"userID" gorm:"type:uuid;not null;uniqueIndex:idx_activity_mutes_user_file,priority:1"`
+	FileID uuid.UUID `json:"fileID" gorm:"type:uuid;not null;uniqueIndex:idx_activity_mutes_user_file,priority:2;index"`
+
+	File *File `json:"file,omitempty" gorm:"foreignKey:FileID;references:ID"`
+}
+
+func (ActivityMute) TableName() string {
+	return "activity_mutes"
+}
+
+// NotificationPreference turns activity for one action on or off for a
+// user. Actions without a row are on.
+type NotificationPreference struct {
+	BaseModel
+	UserID  uuid.UUID `json:"userID" gorm:"type:uuid;not null;uniqueIndex:idx_notification_preferences_user_action,priority:1"`
+	Action  string    `json:"action" gorm:"type:varchar(50);not null;uniqueIndex:idx_notification_preferences_user_action,priority:2"`
+	Enabled bool      `json:"enabled" gorm:"not null"`
+}
+
+func (NotificationPreference) TableName() string {
+	return "notification_preferences"
+}
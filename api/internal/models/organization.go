@@ -0,0 +1,33 @@
+package models
+
+import "github.com/google/uuid"
+
+// Organization is a tenant of a multi-tenant deployment. Users, groups,
+// files and SSO providers whose OrganizationID is nil belong to the default
+// tenant, which is the only one a single-tenant deployment ever uses.
+type Organization struct {
+	BaseModel
+	Name              string `json:"name" gorm:"type:varchar(150);not null"`
+	Slug              string `json:"slug" gorm:"type:varchar(63);uniqueIndex;not null"`
+	StorageQuotaBytes *int64 `json:"storageQuotaBytes,omitempty"`
+	StorageUsedBytes  int64  `json:"storageUsedBytes" gorm:"-"`
+	// MFARequirement overrides the server-wide MFA policy for the
+	// organization's users; empty inherits it.
+	MFARequirement MFARequirement `json:"mfaRequirement,omitempty" gorm:"type:varchar(10)"`
+	// BrandLogoURL and BrandColor (#rrggbb) restyle the organization's
+	// public share pages; empty uses the server's branding.
+	BrandLogoURL string `json:"brandLogoURL,omitempty" gorm:"type:varchar(500)"`
+	BrandColor   string `json:"brandColor,omitempty" gorm:"type:varchar(7)"`
+}
+
+func (Organization) TableName() string {
+	return "organizations"
+}
+
+// OrganizationIDOf returns the ID of org, or nil for the default tenant.
+func OrganizationIDOf(org *Organization) *uuid.UUID {
+	if org == nil {
+		return nil
+	}
+	return &org.ID
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutboxEvent records a file or share mutation in the same transaction as
+// the mutation itself. The outbox dispatcher delivers each row to every
+// subscriber at least once and stamps DispatchedAt when all have accepted it.
+type OutboxEvent struct {
+	BaseModel
+	EventType     string                 `json:"eventType" gorm:"type:varchar(50);not null;index"`
+	ResourceType  string                 `json:"resourceType" gorm:"type:varchar(30);not null"`
+	ResourceID    *uuid.UUID             `json:"resourceID,omitempty" gorm:"type:uuid;index"`
+	ActorID       *uuid.UUID             `json:"actorID,omitempty" gorm:"type:uuid"`
+	Payload       map[string]interface{} `json:"payload,omitempty" gorm:"type:jsonb;serializer:json"`
+	IPAddress     string                 `json:"ipAddress" gorm:"type:varchar(45)"`
+	RequestID     string                 `json:"requestID,omitempty" gorm:"type:varchar(36)"`
+	Attempts      int                    `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt time.Time              `json:"nextAttemptAt" gorm:"not null;index"`
+	DispatchedAt  *time.Time             `json:"dispatchedAt,omitempty" gorm:"index"`
+	LastError     string                 `json:"lastError,omitempty" gorm:"type:text"`
+}
+
+func (OutboxEvent) TableName() string {
+	return "outbox_events"
+}
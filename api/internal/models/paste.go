@@ -0,0 +1,21 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// Paste marks a file made from pasted text. The text itself is the file's
+// content; Language is the highlighter language its name was given, or ""
+// for plain text.
+type Paste struct {
+	BaseModel
+	FileID   uuid.UUID `json:"fileID" gorm:"type:uuid;not null;uniqueIndex"`
+	OwnerID  uuid.UUID `json:"ownerID" gorm:"type:uuid;not null;index"`
+	Language string    `json:"language,omitempty" gorm:"type:varchar(32)"`
+
+	File *File `json:"file,omitempty" gorm:"foreignKey:FileID;references:ID"`
+}
+
+func (Paste) TableName() string {
+	return "pastes"
+}
@@ -15,6 +15,10 @@ const (
 	PreviewJobStatusProcessing PreviewJobStatus = "processing"
 	PreviewJobStatusCompleted  PreviewJobStatus = "completed"
 	PreviewJobStatusFailed     PreviewJobStatus = "failed"
+	// PreviewJobStatusUnavailable means the converter is down or
+	// saturated; the job is retried once it recovers, without using up
+	// an attempt.
+	PreviewJobStatusUnavailable PreviewJobStatus = "unavailable"
 )
 
 // PreviewJob tracks the asynchronous generation of document previews.
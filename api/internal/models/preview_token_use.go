@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// PreviewTokenUse counts the requests served by a preview token that may
+// only serve a limited number. Tokens are stateless otherwise; Nonce ties
+// the row to one token and ExpiresAt, copied from it, lets the cleanup job
+// drop the row once the token could not be used anyway.
+type PreviewTokenUse struct {
+	BaseModel
+	Nonce     string    `json:"nonce" gorm:"type:varchar(64);not null;uniqueIndex"`
+	Uses      int       `json:"uses" gorm:"not null;default:0"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"not null;index"`
+}
+
+func (PreviewTokenUse) TableName() string {
+	return "preview_token_uses"
+}
@@ -0,0 +1,57 @@
+package models
+
+import "github.com/google/uuid"
+
+type PropertyType string
+
+const (
+	PropertyTypeText    PropertyType = "text"
+	PropertyTypeNumber  PropertyType = "number"
+	PropertyTypeDate    PropertyType = "date"
+	PropertyTypeBoolean PropertyType = "boolean"
+	PropertyTypeSelect  PropertyType = "select"
+)
+
+// PropertyDefinition is an admin-defined custom metadata field, such as
+// "Contract Number" or "Review Date", that files can be given a value
+// for. Key names the property in the API and in search; it cannot change
+// once the definition exists.
+type PropertyDefinition struct {
+	BaseModel
+	Key         string       `json:"key" gorm:"type:varchar(64);not null;uniqueIndex"`
+	Label       string       `json:"label" gorm:"type:varchar(255);not null"`
+	Description string       `json:"description,omitempty" gorm:"type:text"`
+	Type        PropertyType `json:"type" gorm:"type:varchar(16);not null"`
+	Position    int          `json:"position" gorm:"not null;default:0"`
+
+	// Options are the allowed values of a select property.
+	Options []string `json:"options,omitempty" gorm:"type:jsonb;serializer:json"`
+	// Pattern is a regular expression a text value must match in full.
+	Pattern string `json:"pattern,omitempty" gorm:"type:varchar(255)"`
+	// Min and Max bound a number value, or the length of a text value.
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+
+	CreatedByID uuid.UUID `json:"createdByID" gorm:"type:uuid;not null"`
+}
+
+func (PropertyDefinition) TableName() string {
+	return "property_definitions"
+}
+
+// FileProperty is a file's value for one property. Value holds it in a
+// canonical text form: dates as YYYY-MM-DD, booleans as "true" or
+// "false". Number values are also kept in Number so they can be compared
+// as numbers.
+type FileProperty struct {
+	BaseModel
+	FileID       uuid.UUID `json:"fileID" gorm:"type:uuid;not null;uniqueIndex:idx_file_properties_key,priority:1"`
+	DefinitionID uuid.UUID `json:"definitionID" gorm:"type:uuid;not null;index"`
+	Key          string    `json:"key" gorm:"type:varchar(64);not null;uniqueIndex:idx_file_properties_key,priority:2"`
+	Value        string    `json:"value" gorm:"type:text;not null"`
+	Number       *float64  `json:"number,omitempty"`
+}
+
+func (FileProperty) TableName() string {
+	return "file_properties"
+}
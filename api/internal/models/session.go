@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is one signed-in device: a login that issued a JWT, or a client
+// using an API token. JWTs carry the session ID so a single device can be
+// signed out without touching the others.
+type Session struct {
+	BaseModel
+	UserID     uuid.UUID  `json:"-" gorm:"type:uuid;not null;index"`
+	APITokenID *uuid.UUID `json:"apiTokenID,omitempty" gorm:"type:uuid;index"`
+	Method     string     `json:"method" gorm:"type:varchar(30);not null"`
+	DeviceName string     `json:"deviceName" gorm:"type:varchar(100);not null"`
+	UserAgent  string     `json:"userAgent" gorm:"type:varchar(512)"`
+	IPAddress  string     `json:"ipAddress" gorm:"type:varchar(45)"`
+	Country    string     `json:"country,omitempty" gorm:"type:varchar(2)"`
+	City       string     `json:"city,omitempty" gorm:"type:varchar(100)"`
+	LastSeenAt time.Time  `json:"lastSeenAt" gorm:"not null"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt  *time.Time `json:"-" gorm:"index"`
+}
+
+func (Session) TableName() string {
+	return "sessions"
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Setting overrides one runtime-tunable option. Value holds the JSON
+// encoding of the override; options without a row use their default from
+// the environment. Rows are hard-deleted when an admin resets an option.
+type Setting struct {
+	Key         string     `json:"key" gorm:"type:varchar(100);primaryKey"`
+	Value       string     `json:"value" gorm:"type:text;not null"`
+	UpdatedByID *uuid.UUID `json:"updatedByID,omitempty" gorm:"type:uuid"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+func (Setting) TableName() string {
+	return "settings"
+}
@@ -28,19 +28,37 @@ type Share struct {
 	SharedByID        uuid.UUID       `json:"sharedByID" gorm:"type:uuid;not null;index"`
 	SharedWithUserID  *uuid.UUID      `json:"sharedWithUserID,omitempty" gorm:"type:uuid;index"`
 	SharedWithGroupID *uuid.UUID      `json:"sharedWithGroupID,omitempty" gorm:"type:uuid;index"`
+	SharedWithEmail   *string         `json:"sharedWithEmail,omitempty" gorm:"type:varchar(255);index"`
 	ShareType         ShareType       `json:"shareType" gorm:"type:varchar(20);not null;default:'private';index"`
 	Permission        SharePermission `json:"permission" gorm:"type:varchar(20);not null;default:'view'"`
 	ExpiresAt         *time.Time      `json:"expiresAt,omitempty"`
-	File              File            `json:"file,omitempty" gorm:"foreignKey:FileID;references:ID"`
-	SharedBy          User            `json:"sharedBy,omitempty" gorm:"foreignKey:SharedByID;references:ID"`
-	SharedWithUser    *User           `json:"sharedWithUser,omitempty" gorm:"foreignKey:SharedWithUserID;references:ID"`
-	SharedWithGroup   *Group          `json:"sharedWithGroup,omitempty" gorm:"foreignKey:SharedWithGroupID;references:ID"`
+	Message           string          `json:"message,omitempty" gorm:"type:varchar(1000)"`
+	QuickShare        bool            `json:"quickShare,omitempty" gorm:"not null;default:false"`
+	// Watermark stamps PDFs opened through the share with who opened
+	// them and when.
+	Watermark bool `json:"watermark,omitempty" gorm:"not null;default:false"`
+	// ViewOnly limits a view share to page images rendered on the
+	// server, so the file itself is never sent.
+	ViewOnly bool `json:"viewOnly,omitempty" gorm:"not null;default:false"`
+	// Slug names a public share in /public/links/:slug URLs. Private
+	// shares have none.
+	Slug            *string `json:"slug,omitempty" gorm:"type:varchar(32);uniqueIndex"`
+	File            File    `json:"file,omitempty" gorm:"foreignKey:FileID;references:ID"`
+	SharedBy        User    `json:"sharedBy,omitempty" gorm:"foreignKey:SharedByID;references:ID"`
+	SharedWithUser  *User   `json:"sharedWithUser,omitempty" gorm:"foreignKey:SharedWithUserID;references:ID"`
+	SharedWithGroup *Group  `json:"sharedWithGroup,omitempty" gorm:"foreignKey:SharedWithGroupID;references:ID"`
 }
 
 func (Share) TableName() string {
 	return "shares"
 }
 
+// IsPending returns true if this share is waiting for an invited email
+// address to sign up.
+func (s *Share) IsPending() bool {
+	return s.SharedWithEmail != nil && s.SharedWithUserID == nil
+}
+
 // IsPublic returns true if this share grants public access.
 func (s *Share) IsPublic() bool {
 	return s.ShareType == ShareTypePublicAnyone || s.ShareType == ShareTypePublicLoggedIn
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShareControl puts a folder and everything below it under share approval:
+// new shares from the subtree wait for a member of ApproverGroupID to
+// approve them. With PublicOnly set, only public shares wait. The nearest
+// controlled folder on a file's path applies.
+type ShareControl struct {
+	BaseModel
+	FolderID        uuid.UUID `json:"folderID" gorm:"type:uuid;not null;uniqueIndex"`
+	ApproverGroupID uuid.UUID `json:"approverGroupID" gorm:"type:uuid;not null;index"`
+	PublicOnly      bool      `json:"publicOnly" gorm:"not null;default:false"`
+	CreatedByID     uuid.UUID `json:"createdByID" gorm:"type:uuid;not null"`
+
+	Folder        *File  `json:"folder,omitempty" gorm:"foreignKey:FolderID;references:ID"`
+	ApproverGroup *Group `json:"approverGroup,omitempty" gorm:"foreignKey:ApproverGroupID;references:ID"`
+}
+
+func (ShareControl) TableName() string {
+	return "share_controls"
+}
+
+type ShareApprovalStatus string
+
+const (
+	ShareApprovalPending  ShareApprovalStatus = "pending"
+	ShareApprovalApproved ShareApprovalStatus = "approved"
+	ShareApprovalRejected ShareApprovalStatus = "rejected"
+)
+
+// ProposedVaultKey is a vault folder key wrapped for one of the recipient's
+// keys, held with a proposed share of an encrypted folder.
+type ProposedVaultKey struct {
+	KeyID      uuid.UUID `json:"keyID"`
+	WrappedKey string    `json:"wrappedKey"`
+}
+
+// ShareProposal is the share a user asked for, with folder defaults
+// already applied. It becomes a Share when approved.
+type ShareProposal struct {
+	SharedWithUserID  *uuid.UUID         `json:"sharedWithUserID,omitempty"`
+	SharedWithGroupID *uuid.UUID         `json:"sharedWithGroupID,omitempty"`
+	SharedWithEmail   *string            `json:"sharedWithEmail,omitempty"`
+	ShareType         ShareType          `json:"shareType"`
+	Permission        SharePermission    `json:"permission"`
+	ExpiresAt         *time.Time         `json:"expiresAt,omitempty"`
+	Message           string             `json:"message,omitempty"`
+	QuickShare        bool               `json:"quickShare,omitempty"`
+	Watermark         bool               `json:"watermark,omitempty"`
+	ViewOnly          bool               `json:"viewOnly,omitempty"`
+	VaultKeys         []ProposedVaultKey `json:"vaultKeys,omitempty"`
+}
+
+// ShareApproval is a share held back by a ShareControl until an approver
+// decides on it. ShareID is set once an approved share has been created.
+type ShareApproval struct {
+	BaseModel
+	FileID          uuid.UUID           `json:"fileID" gorm:"type:uuid;not null;index"`
+	ControlID       uuid.UUID           `json:"controlID" gorm:"type:uuid;not null;index"`
+	ApproverGroupID uuid.UUID           `json:"approverGroupID" gorm:"type:uuid;not null;index"`
+	RequestedByID   uuid.UUID           `json:"requestedByID" gorm:"type:uuid;not null;index"`
+	Status          ShareApprovalStatus `json:"status" gorm:"type:varchar(20);not null;default:pending;index"`
+	Proposal        ShareProposal       `json:"proposal" gorm:"type:jsonb;serializer:json;not null"`
+	DecidedByID     *uuid.UUID          `json:"decidedByID,omitempty" gorm:"type:uuid"`
+	DecidedAt       *time.Time          `json:"decidedAt,omitempty"`
+	Reason          string              `json:"reason,omitempty" gorm:"type:varchar(1000)"`
+	ShareID         *uuid.UUID          `json:"shareID,omitempty" gorm:"type:uuid"`
+
+	File        *File `json:"file,omitempty" gorm:"foreignKey:FileID;references:ID"`
+	RequestedBy *User `json:"requestedBy,omitempty" gorm:"foreignKey:RequestedByID;references:ID"`
+}
+
+func (ShareApproval) TableName() string {
+	return "share_approvals"
+}
+
+// Share builds the share an approval stands for.
+func (a *ShareApproval) Share() Share {
+	p := a.Proposal
+	return Share{
+		FileID:            a.FileID,
+		SharedByID:        a.RequestedByID,
+		SharedWithUserID:  p.SharedWithUserID,
+		SharedWithGroupID: p.SharedWithGroupID,
+		SharedWithEmail:   p.SharedWithEmail,
+		ShareType:         p.ShareType,
+		Permission:        p.Permission,
+		ExpiresAt:         p.ExpiresAt,
+		Message:           p.Message,
+		QuickShare:        p.QuickShare,
+		Watermark:         p.Watermark,
+		ViewOnly:          p.ViewOnly,
+	}
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShareInvitation carries a share addressed to an email address that has no
+// account yet. The share stays pending until someone with that address signs
+// up or signs in through SSO, at which point it is bound to their account.
+type ShareInvitation struct {
+	BaseModel
+	ShareID        uuid.UUID  `json:"shareID" gorm:"type:uuid;not null;index"`
+	Email          string     `json:"email" gorm:"type:varchar(255);not null;index"`
+	TokenHash      string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	InvitedByID    uuid.UUID  `json:"invitedByID" gorm:"type:uuid;not null"`
+	OrganizationID *uuid.UUID `json:"organizationID,omitempty" gorm:"type:uuid;index"`
+	ExpiresAt      time.Time  `json:"expiresAt" gorm:"not null"`
+	AcceptedAt     *time.Time `json:"acceptedAt,omitempty"`
+	AcceptedByID   *uuid.UUID `json:"acceptedByID,omitempty" gorm:"type:uuid"`
+}
+
+func (ShareInvitation) TableName() string {
+	return "share_invitations"
+}
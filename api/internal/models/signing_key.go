@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SigningKey is a token signing key added through the admin API. Secret
+// is encrypted at rest. A row with the KID "env" and no secret records
+// that the key from JWT_SECRET has been retired.
+type SigningKey struct {
+	BaseModel
+	KID         string     `json:"kid" gorm:"type:varchar(32);not null;uniqueIndex"`
+	Secret      string     `json:"-" gorm:"type:text;not null;default:''"`
+	CreatedByID *uuid.UUID `json:"createdByID,omitempty" gorm:"type:uuid"`
+	RetiredAt   *time.Time `json:"retiredAt,omitempty"`
+}
+
+func (SigningKey) TableName() string {
+	return "signing_keys"
+}
@@ -15,15 +15,17 @@ const (
 	SSOProviderTypeLDAP   SSOProviderType = "ldap"
 )
 
-// SSOProvider represents a configured SSO/Identity provider
+// SSOProvider is an identity provider configured at runtime by an admin. It
+// takes the place of the environment-configured provider of the same type
+// for its organization. Secrets are stored encrypted.
 type SSOProvider struct {
 	BaseModel
-	Name         string          `json:"name" gorm:"type:varchar(50);uniqueIndex;not null"`
+	Name         string          `json:"name" gorm:"type:varchar(50);uniqueIndex:idx_sso_providers_org_name;not null"`
 	DisplayName  string          `json:"displayName" gorm:"type:varchar(100);not null"`
 	Type         SSOProviderType `json:"type" gorm:"type:varchar(20);not null"`
 	Enabled      bool            `json:"enabled" gorm:"default:false"`
 	Priority     int             `json:"priority" gorm:"default:100"`
-	ClientID     string          `json:"-" gorm:"type:varchar(255)"`
+	ClientID     string          `json:"clientID" gorm:"type:varchar(255)"`
 	ClientSecret string          `json:"-" gorm:"type:text"`
 	RedirectURL  string          `json:"redirectURL" gorm:"type:varchar(500)"`
 	Scopes       string          `json:"scopes" gorm:"type:varchar(500)"`      // Comma-separated scopes
@@ -32,7 +34,7 @@ type SSOProvider struct {
 	EntityID     string          `json:"entityID" gorm:"type:varchar(500)"`    // For SAML SP
 	// LDAP specific
 	LDAPURL          string `json:"ldapURL" gorm:"type:varchar(500)"`
-	LDAPBindDN       string `json:"-" gorm:"type:varchar(255)"`
+	LDAPBindDN       string `json:"ldapBindDN" gorm:"type:varchar(255)"`
 	LDAPBindPassword string `json:"-" gorm:"type:text"`
 	LDAPSearchBase   string `json:"ldapSearchBase" gorm:"type:varchar(255)"`
 	LDAPUserFilter   string `json:"ldapUserFilter" gorm:"type:varchar(255)"`
@@ -40,12 +42,27 @@ type SSOProvider struct {
 	LDAPNameFields   string `json:"ldapNameFields" gorm:"type:varchar(255)"` // Comma-separated
 	// SAML attribute mapping (stored as JSON)
 	AttributeMapping string `json:"attributeMapping" gorm:"type:text"`
+	// ClaimMappings grant groups and roles from the identity the provider
+	// asserts; they are re-applied on every login.
+	ClaimMappings []SSOClaimMapping `json:"claimMappings" gorm:"type:jsonb;serializer:json"`
+	// OrganizationID scopes the provider to one tenant.
+	OrganizationID *uuid.UUID `json:"organizationID,omitempty" gorm:"type:uuid;uniqueIndex:idx_sso_providers_org_name"`
 }
 
 func (SSOProvider) TableName() string {
 	return "sso_providers"
 }
 
+// SSOClaimMapping matches users whose Claim (an OIDC claim, SAML attribute or
+// LDAP attribute such as memberOf) contains Value, and either makes them a
+// member of GroupID or gives them Role.
+type SSOClaimMapping struct {
+	Claim   string     `json:"claim"`
+	Value   string     `json:"value"`
+	GroupID *uuid.UUID `json:"groupID,omitempty"`
+	Role    UserRole   `json:"role,omitempty"`
+}
+
 // LinkedAccount links a local user to an external identity provider
 type LinkedAccount struct {
 	BaseModel
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReconciliationStatus is the state of a storage reconciliation run.
+type ReconciliationStatus string
+
+const (
+	ReconciliationStatusPending   ReconciliationStatus = "pending"
+	ReconciliationStatusRunning   ReconciliationStatus = "running"
+	ReconciliationStatusCompleted ReconciliationStatus = "completed"
+	ReconciliationStatusFailed    ReconciliationStatus = "failed"
+)
+
+// OrphanObject is a bucket object no file row refers to.
+type OrphanObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// MissingObject is a file row whose stored bytes are gone from the bucket.
+type MissingObject struct {
+	FileID      uuid.UUID `json:"fileID"`
+	Name        string    `json:"name"`
+	OwnerID     uuid.UUID `json:"ownerID"`
+	StoragePath string    `json:"storagePath"`
+}
+
+// StorageReconciliation records one admin-triggered comparison of the
+// bucket against the files table, and what it cleaned up. Orphans and
+// Missing list at most the first thousand findings; the counts cover all.
+type StorageReconciliation struct {
+	BaseModel
+	RequestedByID uuid.UUID            `json:"requestedByID" gorm:"type:uuid;not null;index"`
+	Status        ReconciliationStatus `json:"status" gorm:"type:varchar(20);not null;default:pending;index"`
+	DryRun        bool                 `json:"dryRun" gorm:"not null"`
+	DeleteOrphans bool                 `json:"deleteOrphans" gorm:"not null;default:false"`
+	RemoveMissing bool                 `json:"removeMissing" gorm:"not null;default:false"`
+	// MinAgeSeconds keeps objects younger than this out of the orphan
+	// list, since an upload writes its object before its file row.
+	MinAgeSeconds  int64           `json:"minAgeSeconds" gorm:"not null"`
+	ObjectsScanned int64           `json:"objectsScanned" gorm:"not null;default:0"`
+	FilesScanned   int64           `json:"filesScanned" gorm:"not null;default:0"`
+	OrphanCount    int64           `json:"orphanCount" gorm:"not null;default:0"`
+	OrphanBytes    int64           `json:"orphanBytes" gorm:"not null;default:0"`
+	MissingCount   int64           `json:"missingCount" gorm:"not null;default:0"`
+	OrphansDeleted int64           `json:"orphansDeleted" gorm:"not null;default:0"`
+	MissingRemoved int64           `json:"missingRemoved" gorm:"not null;default:0"`
+	Orphans        []OrphanObject  `json:"orphans,omitempty" gorm:"type:jsonb;serializer:json"`
+	Missing        []MissingObject `json:"missing,omitempty" gorm:"type:jsonb;serializer:json"`
+	LastError      string          `json:"lastError,omitempty" gorm:"type:text"`
+	StartedAt      *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt     *time.Time      `json:"finishedAt,omitempty"`
+}
+
+func (StorageReconciliation) TableName() string {
+	return "storage_reconciliations"
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TermsVersion is one published version of a document users must accept,
+// such as the terms of service or a privacy notice. Kind names the
+// document; the newest version of each kind that is not retired is the one
+// in force. Published versions are never edited.
+type TermsVersion struct {
+	BaseModel
+	Kind          string     `json:"kind" gorm:"type:varchar(50);not null;uniqueIndex:idx_terms_kind_version"`
+	Version       string     `json:"version" gorm:"type:varchar(50);not null;uniqueIndex:idx_terms_kind_version"`
+	Title         string     `json:"title" gorm:"type:varchar(255);not null"`
+	Body          string     `json:"body,omitempty" gorm:"type:text"`
+	URL           string     `json:"url,omitempty" gorm:"type:text"`
+	PublishedByID uuid.UUID  `json:"publishedByID" gorm:"type:uuid;not null"`
+	PublishedAt   time.Time  `json:"publishedAt" gorm:"not null;index"`
+	RetiredAt     *time.Time `json:"retiredAt,omitempty"`
+}
+
+func (TermsVersion) TableName() string {
+	return "terms_versions"
+}
+
+// TermsAcceptance records that a user accepted a terms version, and from
+// where.
+type TermsAcceptance struct {
+	BaseModel
+	UserID         uuid.UUID `json:"userID" gorm:"type:uuid;not null;uniqueIndex:idx_terms_acceptance"`
+	TermsVersionID uuid.UUID `json:"termsVersionID" gorm:"type:uuid;not null;uniqueIndex:idx_terms_acceptance;index"`
+	AcceptedAt     time.Time `json:"acceptedAt" gorm:"not null"`
+	IPAddress      string    `json:"ipAddress" gorm:"type:varchar(64)"`
+	UserAgent      string    `json:"userAgent,omitempty" gorm:"type:text"`
+}
+
+func (TermsAcceptance) TableName() string {
+	return "terms_acceptances"
+}
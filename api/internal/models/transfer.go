@@ -9,8 +9,16 @@ import (
 type TransferStatus string
 
 const (
-	TransferStatusPending   TransferStatus = "pending"
-	TransferStatusActive    TransferStatus = "active"
+	TransferStatusPending TransferStatus = "pending"
+	TransferStatusActive  TransferStatus = "active"
+	// TransferStatusScanning is a fully uploaded transfer waiting on the
+	// malware scan; TransferStatusReady can be downloaded.
+	TransferStatusScanning TransferStatus = "scanning"
+	TransferStatusReady    TransferStatus = "ready"
+	TransferStatusBlocked  TransferStatus = "blocked"
+	// TransferStatusFailed is an upload whose joined file did not match
+	// the checksum the sender gave.
+	TransferStatusFailed    TransferStatus = "failed"
 	TransferStatusCompleted TransferStatus = "completed"
 	TransferStatusCancelled TransferStatus = "cancelled"
 	TransferStatusExpired   TransferStatus = "expired"
@@ -18,18 +26,51 @@ const (
 
 type Transfer struct {
 	BaseModel
-	Code        string         `json:"code" gorm:"size:10;uniqueIndex"`
-	SenderID    uuid.UUID      `json:"senderID" gorm:"type:uuid;not null;index"`
-	Sender      User           `json:"sender,omitempty" gorm:"foreignKey:SenderID"`
-	RecipientID *uuid.UUID     `json:"recipientID,omitempty" gorm:"type:uuid;index"`
-	Recipient   *User          `json:"recipient,omitempty" gorm:"foreignKey:RecipientID"`
-	FileName    string         `json:"fileName" gorm:"size:255;not null"`
-	FileSize    int64          `json:"fileSize"`
-	Status      TransferStatus `json:"status" gorm:"size:20;not null;default:'pending'"`
-	Timeout     int            `json:"timeout"`
-	ExpiresAt   time.Time      `json:"expiresAt"`
+	Code             string         `json:"code" gorm:"size:10;uniqueIndex"`
+	SenderID         uuid.UUID      `json:"senderID" gorm:"type:uuid;not null;index"`
+	Sender           User           `json:"sender,omitempty" gorm:"foreignKey:SenderID"`
+	RecipientID      *uuid.UUID     `json:"recipientID,omitempty" gorm:"type:uuid;index"`
+	Recipient        *User          `json:"recipient,omitempty" gorm:"foreignKey:RecipientID"`
+	FileName         string         `json:"fileName" gorm:"size:255;not null"`
+	FileSize         int64          `json:"fileSize"`
+	MimeType         string         `json:"mimeType,omitempty" gorm:"size:255"`
+	DetectedMimeType string         `json:"detectedMimeType,omitempty" gorm:"size:255"`
+	Status           TransferStatus `json:"status" gorm:"size:20;not null;default:'pending'"`
+	Timeout          int            `json:"timeout"`
+	ExpiresAt        time.Time      `json:"expiresAt"`
+	// ChunkTotal is the number of chunks the sender announced, and Stored
+	// is set while any of them are held by the relay.
+	ChunkTotal int        `json:"chunkTotal,omitempty"`
+	Stored     bool       `json:"-"`
+	ScanResult string     `json:"scanResult,omitempty" gorm:"size:255"`
+	ScannedAt  *time.Time `json:"scannedAt,omitempty"`
+	// Checksum is the SHA-256 of the joined file, checked against the one
+	// the sender sends on completion.
+	Checksum string `json:"checksum,omitempty" gorm:"size:64"`
+	// AllowAnonymous lets someone without an account receive the transfer
+	// through a signed link and a PIN. The PIN and the receive token the
+	// link is exchanged for are kept only as hashes; RecipientIP is the
+	// address that redeemed the link.
+	AllowAnonymous   bool   `json:"allowAnonymous,omitempty"`
+	PINHash          string `json:"-" gorm:"size:64"`
+	PINAttempts      int    `json:"-"`
+	ReceiveTokenHash string `json:"-" gorm:"size:64"`
+	RecipientIP      string `json:"recipientIP,omitempty" gorm:"size:45"`
 }
 
 func (Transfer) TableName() string {
 	return "transfers"
 }
+
+// TransferChunk records a chunk the relay holds for a transfer, so an
+// interrupted upload can resume with only the chunks that are missing.
+type TransferChunk struct {
+	BaseModel
+	TransferID uuid.UUID `json:"transferID" gorm:"type:uuid;not null;uniqueIndex:idx_transfer_chunks_index,priority:1"`
+	ChunkIndex int       `json:"chunkIndex" gorm:"not null;uniqueIndex:idx_transfer_chunks_index,priority:2"`
+	Size       int64     `json:"size"`
+}
+
+func (TransferChunk) TableName() string {
+	return "transfer_chunks"
+}
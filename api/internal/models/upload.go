@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type UploadStatus string
+
+const (
+	UploadStatusReceiving UploadStatus = "receiving"
+	UploadStatusCompleted UploadStatus = "completed"
+)
+
+// Upload is a resumable upload sent with the TUS protocol. The client
+// announces Length up front and sends the bytes in any number of requests,
+// each continuing at Offset. Once every byte is there the chunks are
+// joined into a file, recorded in FileID.
+type Upload struct {
+	BaseModel
+	OwnerID        uuid.UUID  `json:"ownerID" gorm:"type:uuid;not null;index"`
+	OrganizationID *uuid.UUID `json:"organizationID,omitempty" gorm:"type:uuid;index"`
+	ParentID       *uuid.UUID `json:"parentID,omitempty" gorm:"type:uuid"`
+	FileName       string     `json:"fileName" gorm:"size:255;not null"`
+	// MimeType is the type the client declared in the upload metadata.
+	MimeType  string       `json:"mimeType,omitempty" gorm:"size:255"`
+	Length    int64        `json:"length"`
+	Offset    int64        `json:"offset" gorm:"column:upload_offset"`
+	Status    UploadStatus `json:"status" gorm:"size:20;not null;default:'receiving'"`
+	FileID    *uuid.UUID   `json:"fileID,omitempty" gorm:"type:uuid"`
+	ExpiresAt time.Time    `json:"expiresAt" gorm:"index"`
+}
+
+func (Upload) TableName() string {
+	return "uploads"
+}
+
+// UploadChunk records the bytes of an upload received in one request,
+// starting at Offset.
+type UploadChunk struct {
+	BaseModel
+	UploadID uuid.UUID `json:"uploadID" gorm:"type:uuid;not null;uniqueIndex:idx_upload_chunks_offset,priority:1"`
+	Offset   int64     `json:"offset" gorm:"column:chunk_offset;not null;uniqueIndex:idx_upload_chunks_offset,priority:2"`
+	Size     int64     `json:"size"`
+}
+
+func (UploadChunk) TableName() string {
+	return "upload_chunks"
+}
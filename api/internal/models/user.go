@@ -1,10 +1,44 @@
 package models
 
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
 type UserRole string
 
 const (
 	UserRoleAdmin UserRole = "admin"
 	UserRoleUser  UserRole = "user"
+	// The administrative sub-roles each grant part of what an admin can
+	// do; services.AdminPermissions lists which part.
+	UserRoleUserManager     UserRole = "user-manager"
+	UserRoleAuditor         UserRole = "auditor"
+	UserRoleStorageOperator UserRole = "storage-operator"
+	UserRoleSupport         UserRole = "support"
+)
+
+// Valid reports whether r is a known role.
+func (r UserRole) Valid() bool {
+	switch r {
+	case UserRoleAdmin, UserRoleUser, UserRoleUserManager, UserRoleAuditor, UserRoleStorageOperator, UserRoleSupport:
+		return true
+	}
+	return false
+}
+
+// IsAdministrative reports whether r opens any of the admin routes.
+func (r UserRole) IsAdministrative() bool {
+	return r.Valid() && r != UserRoleUser
+}
+
+type UserStatus string
+
+const (
+	UserStatusActive    UserStatus = "active"
+	UserStatusSuspended UserStatus = "suspended"
 )
 
 type User struct {
@@ -14,11 +48,20 @@ type User struct {
 	FirstName           string               `json:"firstName" gorm:"type:varchar(100);not null"`
 	LastName            string               `json:"lastName" gorm:"type:varchar(100);not null"`
 	Role                UserRole             `json:"role" gorm:"type:varchar(20);not null;default:'user'"`
+	Status              UserStatus           `json:"status" gorm:"type:varchar(20);not null;default:'active';index"`
+	SuspendedAt         *time.Time           `json:"suspendedAt,omitempty"`
+	SuspensionReason    string               `json:"suspensionReason,omitempty" gorm:"type:varchar(500)"`
+	SessionsRevokedAt   *time.Time           `json:"-"`
+	MFAGraceStartedAt   *time.Time           `json:"-"`
 	AvatarURL           *string              `json:"avatarURL,omitempty" gorm:"type:text"`
+	AvatarVersion       string               `json:"-" gorm:"type:varchar(32)"`
+	HideFromSearch      bool                 `json:"hideFromSearch" gorm:"not null;default:false"`
 	Theme               *string              `json:"theme,omitempty" gorm:"type:varchar(20);default:'system'"`
+	Locale              string               `json:"locale,omitempty" gorm:"type:varchar(10)"`
 	IsEmailVerified     bool                 `json:"isEmailVerified" gorm:"default:false"`
 	AuthProvider        *string              `json:"authProvider,omitempty" gorm:"type:varchar(20)"`
 	ExternalID          *string              `json:"-" gorm:"type:varchar(255)"`
+	OrganizationID      *uuid.UUID           `json:"organizationID,omitempty" gorm:"type:uuid;index"`
 	GroupMemberships    []GroupMembership    `json:"-" gorm:"foreignKey:UserID"`
 	Files               []File               `json:"-" gorm:"foreignKey:OwnerID"`
 	Shares              []Share              `json:"-" gorm:"foreignKey:SharedByID"`
@@ -26,3 +69,12 @@ type User struct {
 	MFAConfig           *MFAConfig           `json:"-" gorm:"foreignKey:UserID"`
 	WebAuthnCredentials []WebAuthnCredential `json:"-" gorm:"foreignKey:UserID"`
 }
+
+func (u *User) IsSuspended() bool {
+	return u.Status == UserStatusSuspended
+}
+
+// DisplayName returns the user's full name.
+func (u *User) DisplayName() string {
+	return strings.TrimSpace(u.FirstName + " " + u.LastName)
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// UserKeyAlgorithmX25519 is the only key type accepted for vault keys.
+const UserKeyAlgorithmX25519 = "x25519"
+
+// UserKey is a public key a user registered so that vault folder keys can
+// be wrapped for them. The private half never reaches the server.
+type UserKey struct {
+	BaseModel
+	UserID    uuid.UUID `json:"userID" gorm:"type:uuid;not null;index"`
+	Name      string    `json:"name" gorm:"type:varchar(100);not null"`
+	Algorithm string    `json:"algorithm" gorm:"type:varchar(20);not null"`
+	// PublicKey is the standard base64 encoding of the raw key.
+	PublicKey   string `json:"publicKey" gorm:"type:varchar(64);not null"`
+	Fingerprint string `json:"fingerprint" gorm:"type:varchar(64);not null;index"`
+}
+
+func (UserKey) TableName() string {
+	return "user_keys"
+}
+
+// VaultKey is the key of a vault folder wrapped for one of a user's keys.
+// The server cannot unwrap it; it only hands it back to that user.
+type VaultKey struct {
+	BaseModel
+	VaultID     uuid.UUID `json:"vaultID" gorm:"type:uuid;not null;uniqueIndex:idx_vault_keys_vault_key"`
+	UserID      uuid.UUID `json:"userID" gorm:"type:uuid;not null;index"`
+	KeyID       uuid.UUID `json:"keyID" gorm:"type:uuid;not null;uniqueIndex:idx_vault_keys_vault_key"`
+	WrappedKey  string    `json:"wrappedKey" gorm:"type:text;not null"`
+	CreatedByID uuid.UUID `json:"createdByID" gorm:"type:uuid;not null"`
+}
+
+func (VaultKey) TableName() string {
+	return "vault_keys"
+}
@@ -20,4 +20,8 @@ type WebAuthnCredential struct {
 	BackupEligible  bool       `json:"backupEligible" gorm:"default:false"`
 	BackupState     bool       `json:"backupState" gorm:"default:false"`
 	User            User       `json:"-" gorm:"foreignKey:UserID"`
+
+	// Attested records whether registration came with a certificate-backed
+	// attestation statement.
+	Attested bool `json:"attested" gorm:"default:false"`
 }
@@ -11,6 +11,12 @@ import (
 
 type AccessService struct {
 	DB *gorm.DB
+	// DisableSuspendedUserShares stops shares created by suspended users
+	// from granting access. By default they keep working so suspending
+	// someone does not cut colleagues off from documents they rely on.
+	DisableSuspendedUserShares bool
+	// Settings, when set, can turn public links off at runtime.
+	Settings *SettingsService
 }
 
 func NewAccessService(db *gorm.DB) *AccessService {
@@ -23,6 +29,11 @@ func (a *AccessService) HasAccess(ctx context.Context, userID uuid.UUID, fileID
 		return false
 	}
 
+	var user models.User
+	if err := a.DB.WithContext(ctx).Select("id", "organization_id").First(&user, "id = ?", userID).Error; err != nil {
+		return false
+	}
+
 	currentID := fileID
 	now := time.Now()
 
@@ -33,12 +44,21 @@ func (a *AccessService) HasAccess(ctx context.Context, userID uuid.UUID, fileID
 			return false
 		}
 
+		// No share, however broad, reaches across tenants.
+		if !SameOrganization(file.OrganizationID, user.OrganizationID) {
+			return false
+		}
+		if file.QuarantinedAt != nil {
+			return false
+		}
+
 		if file.OwnerID == userID {
 			return true
 		}
 
 		var directShares []models.Share
 		if err := a.DB.WithContext(ctx).
+			Scopes(a.ActiveSharers("shares")).
 			Where("file_id = ? AND shared_with_user_id = ?", currentID, userID).
 			Where("share_type = ?", models.ShareTypePrivate).
 			Where("expires_at IS NULL OR expires_at > ?", now).
@@ -53,6 +73,7 @@ func (a *AccessService) HasAccess(ctx context.Context, userID uuid.UUID, fileID
 		var groupShares []models.Share
 		if err := a.DB.WithContext(ctx).
 			Table("shares").
+			Scopes(a.ActiveSharers("shares")).
 			Joins("JOIN group_memberships ON group_memberships.group_id = shares.shared_with_group_id AND group_memberships.user_id = ?", userID).
 			Where("shares.file_id = ?", currentID).
 			Where("shares.share_type = ?", models.ShareTypePrivate).
@@ -67,10 +88,11 @@ func (a *AccessService) HasAccess(ctx context.Context, userID uuid.UUID, fileID
 		}
 
 		var publicShares []models.Share
-		if err := a.DB.WithContext(ctx).
+		if a.PublicSharingEnabled(ctx) && a.DB.WithContext(ctx).
+			Scopes(a.ActiveSharers("shares")).
 			Where("file_id = ? AND share_type IN ?", currentID, []models.ShareType{models.ShareTypePublicAnyone, models.ShareTypePublicLoggedIn}).
 			Where("expires_at IS NULL OR expires_at > ?", now).
-			Find(&publicShares).Error; err == nil {
+			Find(&publicShares).Error == nil {
 			for _, share := range publicShares {
 				if lvl, exists := permissionLevel(share.Permission); exists && lvl >= requiredLevel {
 					return true
@@ -87,9 +109,38 @@ func (a *AccessService) HasAccess(ctx context.Context, userID uuid.UUID, fileID
 	return false
 }
 
+// InOrganization reports whether a file belongs to the given tenant. Public
+// links only resolve on the tenant that owns the file.
+func (a *AccessService) InOrganization(ctx context.Context, fileID uuid.UUID, orgID *uuid.UUID) bool {
+	var count int64
+	if err := a.DB.WithContext(ctx).
+		Model(&models.File{}).
+		Scopes(OrganizationScope("files", orgID)).
+		Where("id = ?", fileID).
+		Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// PublicSharingEnabled reports whether public links may be created and
+// opened.
+func (a *AccessService) PublicSharingEnabled(ctx context.Context) bool {
+	return a.Settings == nil || a.Settings.PublicSharingEnabled(ctx)
+}
+
+// PublicSharePolicy is the policy public links are held to; without
+// settings nothing is enforced.
+func (a *AccessService) PublicSharePolicy(ctx context.Context) PublicSharePolicy {
+	if a.Settings == nil {
+		return PublicSharePolicy{}
+	}
+	return a.Settings.PublicSharePolicy(ctx)
+}
+
 func (a *AccessService) HasPublicAccess(ctx context.Context, fileID uuid.UUID, requiredPermission models.SharePermission, requireLogin bool) bool {
 	requiredLevel, ok := permissionLevel(requiredPermission)
-	if !ok {
+	if !ok || !a.PublicSharingEnabled(ctx) {
 		return false
 	}
 
@@ -104,12 +155,13 @@ func (a *AccessService) HasPublicAccess(ctx context.Context, fileID uuid.UUID, r
 	for {
 		var file models.File
 		err := a.DB.WithContext(ctx).First(&file, "id = ?", currentID).Error
-		if err != nil {
+		if err != nil || file.QuarantinedAt != nil {
 			return false
 		}
 
 		var shares []models.Share
 		if err := a.DB.WithContext(ctx).
+			Scopes(a.ActiveSharers("shares")).
 			Where("file_id = ? AND share_type IN ?", currentID, shareTypes).
 			Where("expires_at IS NULL OR expires_at > ?", now).
 			Find(&shares).Error; err == nil {
@@ -130,22 +182,37 @@ func (a *AccessService) HasPublicAccess(ctx context.Context, fileID uuid.UUID, r
 }
 
 func (a *AccessService) GetPublicShareType(ctx context.Context, fileID uuid.UUID) *models.ShareType {
+	share := a.GetPublicShare(ctx, fileID)
+	if share == nil {
+		return nil
+	}
+	return &share.ShareType
+}
+
+// GetPublicShare returns the active public share that exposes fileID,
+// either directly or through one of its folders. A public_anyone share wins
+// over a public_logged_in one on the same file.
+func (a *AccessService) GetPublicShare(ctx context.Context, fileID uuid.UUID) *models.Share {
+	if !a.PublicSharingEnabled(ctx) {
+		return nil
+	}
 	now := time.Now()
 	currentID := fileID
 
 	for {
 		var file models.File
-		if err := a.DB.WithContext(ctx).First(&file, "id = ?", currentID).Error; err != nil {
+		if err := a.DB.WithContext(ctx).First(&file, "id = ?", currentID).Error; err != nil || file.QuarantinedAt != nil {
 			return nil
 		}
 
 		var share models.Share
 		if err := a.DB.WithContext(ctx).
+			Scopes(a.ActiveSharers("shares")).
 			Where("file_id = ? AND share_type IN ?", currentID, []models.ShareType{models.ShareTypePublicAnyone, models.ShareTypePublicLoggedIn}).
 			Where("expires_at IS NULL OR expires_at > ?", now).
 			Order("CASE WHEN share_type = 'public_anyone' THEN 0 ELSE 1 END").
 			First(&share).Error; err == nil {
-			return &share.ShareType
+			return &share
 		}
 
 		if file.ParentID == nil {
@@ -157,6 +224,84 @@ func (a *AccessService) GetPublicShareType(ctx context.Context, fileID uuid.UUID
 	return nil
 }
 
+// WatermarkRequired reports whether a share that reaches the viewer, on
+// fileID or one of its folders, asks for PDFs to be watermarked. userID is
+// nil for anonymous visitors of a public link. Owners are never stamped,
+// and a single watermarking share is enough even when another share
+// without one also reaches the viewer.
+func (a *AccessService) WatermarkRequired(ctx context.Context, fileID uuid.UUID, userID *uuid.UUID) bool {
+	return a.flaggedShareReaches(ctx, fileID, userID, "watermark")
+}
+
+// ViewOnly reports whether the viewer may only see fileID as page images:
+// a view-only share reaches them and nothing lets them download it. userID
+// is nil for anonymous visitors of a public link. As with watermarks, one
+// view-only share outweighs plain view shares.
+func (a *AccessService) ViewOnly(ctx context.Context, fileID uuid.UUID, userID *uuid.UUID) bool {
+	if !a.flaggedShareReaches(ctx, fileID, userID, "view_only") {
+		return false
+	}
+	if userID == nil {
+		return !a.HasPublicAccess(ctx, fileID, models.SharePermissionDownload, false)
+	}
+	return !a.HasAccess(ctx, *userID, fileID, models.SharePermissionDownload)
+}
+
+// flaggedShareReaches reports whether an active share with the boolean
+// column set reaches the viewer on fileID or one of its folders. Owners
+// are never reached.
+func (a *AccessService) flaggedShareReaches(ctx context.Context, fileID uuid.UUID, userID *uuid.UUID, column string) bool {
+	now := time.Now()
+	currentID := fileID
+
+	for {
+		var file models.File
+		if err := a.DB.WithContext(ctx).Select("id", "owner_id", "parent_id").First(&file, "id = ?", currentID).Error; err != nil {
+			return false
+		}
+		if userID != nil && file.OwnerID == *userID {
+			return false
+		}
+
+		shareTypes := []models.ShareType{models.ShareTypePublicAnyone}
+		if userID != nil {
+			shareTypes = append(shareTypes, models.ShareTypePublicLoggedIn)
+		}
+		q := a.DB.WithContext(ctx).Model(&models.Share{}).
+			Scopes(a.ActiveSharers("shares")).
+			Where("shares.file_id = ? AND shares."+column+" = ?", currentID, true).
+			Where("shares.expires_at IS NULL OR shares.expires_at > ?", now)
+		if userID == nil {
+			q = q.Where("shares.share_type IN ?", shareTypes)
+		} else {
+			q = q.Where("shares.share_type IN ? OR shares.shared_with_user_id = ? OR shares.shared_with_group_id IN (?)",
+				shareTypes, *userID,
+				a.DB.Model(&models.GroupMembership{}).Select("group_id").Where("user_id = ?", *userID))
+		}
+		var count int64
+		if err := q.Count(&count).Error; err == nil && count > 0 {
+			return true
+		}
+
+		if file.ParentID == nil {
+			return false
+		}
+		currentID = *file.ParentID
+	}
+}
+
+// ActiveSharers returns a scope that drops shares created by suspended
+// users when DisableSuspendedUserShares is set. table is the name or alias
+// the shares table has in the query being scoped.
+func (a *AccessService) ActiveSharers(table string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if !a.DisableSuspendedUserShares {
+			return db
+		}
+		return db.Where(table+".shared_by_id NOT IN (SELECT id FROM users WHERE status = ?)", models.UserStatusSuspended)
+	}
+}
+
 func permissionLevel(permission models.SharePermission) (int, bool) {
 	switch permission {
 	case models.SharePermissionView:
@@ -169,3 +314,19 @@ func permissionLevel(permission models.SharePermission) (int, bool) {
 		return 0, false
 	}
 }
+
+// fileSubtree returns root and everything below it.
+func fileSubtree(ctx context.Context, db *gorm.DB, rootID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := db.WithContext(ctx).Raw(`
+		WITH RECURSIVE tree AS (
+			SELECT id FROM files WHERE id = ? AND deleted_at IS NULL
+			UNION ALL
+			SELECT f.id FROM files f
+			INNER JOIN tree t ON f.parent_id = t.id
+			WHERE f.deleted_at IS NULL
+		)
+		SELECT id FROM tree
+	`, rootID).Scan(&ids).Error
+	return ids, err
+}
@@ -512,6 +512,191 @@ func TestAccessService_GetPublicShareType(t *testing.T) {
 	})
 }
 
+func TestAccessService_SuspendedUserShares(t *testing.T) {
+	db := setupAccessTestDB(t)
+	service := NewAccessService(db)
+	ctx := context.Background()
+
+	sharer := &models.User{Email: "sharer@test.com", PasswordHash: "hash", FirstName: "S", LastName: "U", Role: models.UserRoleUser}
+	recipient := &models.User{Email: "recipient@test.com", PasswordHash: "hash", FirstName: "R", LastName: "U", Role: models.UserRoleUser}
+	for _, u := range []*models.User{sharer, recipient} {
+		if err := db.Create(u).Error; err != nil {
+			t.Fatalf("failed creating user: %v", err)
+		}
+	}
+	file := &models.File{Name: "doc.txt", MimeType: "text/plain", OwnerID: sharer.ID, StoragePath: "doc.txt"}
+	if err := db.Create(file).Error; err != nil {
+		t.Fatalf("failed creating file: %v", err)
+	}
+	shares := []*models.Share{
+		{FileID: file.ID, SharedByID: sharer.ID, SharedWithUserID: &recipient.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView},
+		{FileID: file.ID, SharedByID: sharer.ID, ShareType: models.ShareTypePublicAnyone, Permission: models.SharePermissionView},
+	}
+	for _, share := range shares {
+		if err := db.Create(share).Error; err != nil {
+			t.Fatalf("failed creating share: %v", err)
+		}
+	}
+	if err := db.Model(sharer).Update("status", models.UserStatusSuspended).Error; err != nil {
+		t.Fatalf("failed suspending sharer: %v", err)
+	}
+
+	if !service.HasAccess(ctx, recipient.ID, file.ID, models.SharePermissionView) {
+		t.Error("shares from a suspended user should keep working by default")
+	}
+
+	service.DisableSuspendedUserShares = true
+	if service.HasAccess(ctx, recipient.ID, file.ID, models.SharePermissionView) {
+		t.Error("expected direct share from suspended user to be ignored")
+	}
+	if service.HasPublicAccess(ctx, file.ID, models.SharePermissionView, false) {
+		t.Error("expected public share from suspended user to be ignored")
+	}
+	if service.GetPublicShareType(ctx, file.ID) != nil {
+		t.Error("expected no public share type for suspended user's share")
+	}
+}
+
+func TestAccessService_CrossOrganization(t *testing.T) {
+	db := setupAccessTestDB(t)
+	service := NewAccessService(db)
+	ctx := context.Background()
+
+	orgA, orgB := uuid.New(), uuid.New()
+	owner := &models.User{Email: "owner@a.test", PasswordHash: "hash", FirstName: "O", LastName: "A", Role: models.UserRoleUser, OrganizationID: &orgA}
+	outsider := &models.User{Email: "outsider@b.test", PasswordHash: "hash", FirstName: "O", LastName: "B", Role: models.UserRoleUser, OrganizationID: &orgB}
+	for _, u := range []*models.User{owner, outsider} {
+		if err := db.Create(u).Error; err != nil {
+			t.Fatalf("failed creating user: %v", err)
+		}
+	}
+	file := &models.File{Name: "plan.txt", MimeType: "text/plain", OwnerID: owner.ID, OrganizationID: &orgA, StoragePath: "plan.txt"}
+	if err := db.Create(file).Error; err != nil {
+		t.Fatalf("failed creating file: %v", err)
+	}
+	share := &models.Share{FileID: file.ID, SharedByID: owner.ID, SharedWithUserID: &outsider.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionEdit}
+	if err := db.Create(share).Error; err != nil {
+		t.Fatalf("failed creating share: %v", err)
+	}
+
+	if !service.HasAccess(ctx, owner.ID, file.ID, models.SharePermissionEdit) {
+		t.Error("expected owner to keep access within their organization")
+	}
+	if service.HasAccess(ctx, outsider.ID, file.ID, models.SharePermissionView) {
+		t.Error("expected a share to never grant access across organizations")
+	}
+}
+
+func TestAccessService_WatermarkRequired(t *testing.T) {
+	db := setupAccessTestDB(t)
+	service := NewAccessService(db)
+	ctx := context.Background()
+
+	owner := &models.User{Email: "wm-owner@test.com", PasswordHash: "hash", FirstName: "O", LastName: "U", Role: models.UserRoleUser}
+	member := &models.User{Email: "wm-member@test.com", PasswordHash: "hash", FirstName: "M", LastName: "U", Role: models.UserRoleUser}
+	direct := &models.User{Email: "wm-direct@test.com", PasswordHash: "hash", FirstName: "D", LastName: "U", Role: models.UserRoleUser}
+	for _, u := range []*models.User{owner, member, direct} {
+		if err := db.Create(u).Error; err != nil {
+			t.Fatalf("failed creating user: %v", err)
+		}
+	}
+	group := &models.Group{Name: "Legal", CreatedByID: owner.ID}
+	if err := db.Create(group).Error; err != nil {
+		t.Fatalf("failed creating group: %v", err)
+	}
+	if err := db.Create(&models.GroupMembership{GroupID: group.ID, UserID: member.ID}).Error; err != nil {
+		t.Fatalf("failed adding member: %v", err)
+	}
+	folder := &models.File{Name: "Deals", IsDirectory: true, OwnerID: owner.ID}
+	if err := db.Create(folder).Error; err != nil {
+		t.Fatalf("failed creating folder: %v", err)
+	}
+	file := &models.File{Name: "term-sheet.pdf", MimeType: "application/pdf", OwnerID: owner.ID, ParentID: &folder.ID, StoragePath: "term-sheet.pdf"}
+	if err := db.Create(file).Error; err != nil {
+		t.Fatalf("failed creating file: %v", err)
+	}
+	shares := []*models.Share{
+		{FileID: folder.ID, SharedByID: owner.ID, SharedWithGroupID: &group.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView, Watermark: true},
+		{FileID: file.ID, SharedByID: owner.ID, SharedWithUserID: &direct.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView},
+	}
+	for _, share := range shares {
+		if err := db.Create(share).Error; err != nil {
+			t.Fatalf("failed creating share: %v", err)
+		}
+	}
+
+	if !service.WatermarkRequired(ctx, file.ID, &member.ID) {
+		t.Error("expected a watermarking group share on the folder to apply to its files")
+	}
+	if service.WatermarkRequired(ctx, file.ID, &direct.ID) {
+		t.Error("expected no watermark through a share without one")
+	}
+	if service.WatermarkRequired(ctx, file.ID, &owner.ID) {
+		t.Error("expected the owner never to be stamped")
+	}
+	if service.WatermarkRequired(ctx, file.ID, nil) {
+		t.Error("expected no watermark for visitors without a public share")
+	}
+
+	public := &models.Share{FileID: file.ID, SharedByID: owner.ID, ShareType: models.ShareTypePublicLoggedIn, Permission: models.SharePermissionView, Watermark: true}
+	if err := db.Create(public).Error; err != nil {
+		t.Fatalf("failed creating share: %v", err)
+	}
+	if !service.WatermarkRequired(ctx, file.ID, &direct.ID) {
+		t.Error("expected a watermarking link for signed-in users to apply alongside a plain share")
+	}
+	if service.WatermarkRequired(ctx, file.ID, nil) {
+		t.Error("expected a signed-in-only link not to reach anonymous visitors")
+	}
+}
+
+func TestAccessService_ViewOnly(t *testing.T) {
+	db := setupAccessTestDB(t)
+	service := NewAccessService(db)
+	ctx := context.Background()
+
+	owner := &models.User{Email: "vo-owner@test.com", PasswordHash: "hash", FirstName: "O", LastName: "U", Role: models.UserRoleUser}
+	viewer := &models.User{Email: "vo-viewer@test.com", PasswordHash: "hash", FirstName: "V", LastName: "U", Role: models.UserRoleUser}
+	for _, u := range []*models.User{owner, viewer} {
+		if err := db.Create(u).Error; err != nil {
+			t.Fatalf("failed creating user: %v", err)
+		}
+	}
+	file := &models.File{Name: "plan.pdf", MimeType: "application/pdf", OwnerID: owner.ID, StoragePath: "plan.pdf"}
+	if err := db.Create(file).Error; err != nil {
+		t.Fatalf("failed creating file: %v", err)
+	}
+	share := &models.Share{FileID: file.ID, SharedByID: owner.ID, SharedWithUserID: &viewer.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView, ViewOnly: true}
+	if err := db.Create(share).Error; err != nil {
+		t.Fatalf("failed creating share: %v", err)
+	}
+
+	if !service.ViewOnly(ctx, file.ID, &viewer.ID) {
+		t.Error("expected a view-only share to restrict the viewer")
+	}
+	if service.ViewOnly(ctx, file.ID, &owner.ID) {
+		t.Error("expected the owner never to be restricted")
+	}
+	if service.ViewOnly(ctx, file.ID, nil) {
+		t.Error("expected a private share not to reach anonymous visitors")
+	}
+	public := &models.Share{FileID: file.ID, SharedByID: owner.ID, ShareType: models.ShareTypePublicAnyone, Permission: models.SharePermissionView, ViewOnly: true}
+	if err := db.Create(public).Error; err != nil {
+		t.Fatalf("failed creating share: %v", err)
+	}
+	if !service.ViewOnly(ctx, file.ID, nil) {
+		t.Error("expected a view-only public link to restrict anonymous visitors")
+	}
+
+	download := &models.Share{FileID: file.ID, SharedByID: owner.ID, ShareType: models.ShareTypePublicLoggedIn, Permission: models.SharePermissionDownload}
+	if err := db.Create(download).Error; err != nil {
+		t.Fatalf("failed creating share: %v", err)
+	}
+	if service.ViewOnly(ctx, file.ID, &viewer.ID) {
+		t.Error("expected a share allowing download to lift the restriction")
+	}
+}
+
 func TestPermissionLevel(t *testing.T) {
 	tests := []struct {
 		permission models.SharePermission
@@ -0,0 +1,61 @@
+package services
+
+import "github.com/docshare/api/internal/models"
+
+// AdminPermission names one area of administration. Admins hold every
+// permission; the administrative sub-roles hold the ones listed in
+// adminPolicy.
+type AdminPermission string
+
+const (
+	PermissionUsersRead     AdminPermission = "users.read"
+	PermissionUsersManage   AdminPermission = "users.manage"
+	PermissionRolesManage   AdminPermission = "roles.manage"
+	PermissionAuditRead     AdminPermission = "audit.read"
+	PermissionStorageManage AdminPermission = "storage.manage"
+	PermissionJobsManage    AdminPermission = "jobs.manage"
+	PermissionModeration    AdminPermission = "moderation"
+	PermissionSettings      AdminPermission = "settings"
+)
+
+var allAdminPermissions = []AdminPermission{
+	PermissionUsersRead,
+	PermissionUsersManage,
+	PermissionRolesManage,
+	PermissionAuditRead,
+	PermissionStorageManage,
+	PermissionJobsManage,
+	PermissionModeration,
+	PermissionSettings,
+}
+
+// adminPolicy is what each sub-role may do. Roles and settings stay with
+// full admins, so no sub-role can widen its own access.
+var adminPolicy = map[models.UserRole][]AdminPermission{
+	models.UserRoleUserManager:     {PermissionUsersRead, PermissionUsersManage},
+	models.UserRoleAuditor:         {PermissionAuditRead, PermissionUsersRead},
+	models.UserRoleStorageOperator: {PermissionStorageManage, PermissionJobsManage},
+	models.UserRoleSupport:         {PermissionUsersRead, PermissionModeration},
+}
+
+// AdminPermissions returns the permissions role holds.
+func AdminPermissions(role models.UserRole) []AdminPermission {
+	if role == models.UserRoleAdmin {
+		return allAdminPermissions
+	}
+	return adminPolicy[role]
+}
+
+// HasAdminPermission reports whether user may use the admin routes guarded
+// by permission.
+func HasAdminPermission(user *models.User, permission AdminPermission) bool {
+	if user == nil {
+		return false
+	}
+	for _, p := range AdminPermissions(user.Role) {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,516 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/storage"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	archiveBuildJob = "archive.build"
+	// MaxArchiveSources caps how many files and folders one archive can be
+	// built from.
+	MaxArchiveSources = 1000
+	// archiveBuildProgressEvery is how many files pass between progress
+	// saves.
+	archiveBuildProgressEvery = 25
+	maxArchiveBuildSkips      = 100
+	defaultArchiveName        = "Archive.zip"
+)
+
+var (
+	ErrArchiveBuildNotFound     = errors.New("archive build not found")
+	ErrArchiveBuildInvalid      = errors.New("invalid archive request")
+	ErrArchiveBuildTooManyFiles = errors.New("selection holds more files than one archive may")
+	ErrArchiveBuildTooLarge     = errors.New("selection holds more data than one archive may")
+)
+
+// Reasons a file is left out of a built archive.
+const (
+	ArchiveSkipDeleted     = "deleted"
+	ArchiveSkipNoAccess    = "no_access"
+	ArchiveSkipVault       = "vault"
+	ArchiveSkipPassword    = "password_protected"
+	ArchiveSkipQuarantined = "quarantined"
+	ArchiveSkipColdStorage = "cold_storage"
+	ArchiveSkipMissing     = "missing"
+)
+
+// ArchiveBuildRequest names what to pack and where the archive goes.
+type ArchiveBuildRequest struct {
+	SourceIDs      []uuid.UUID
+	TargetFolderID *uuid.UUID
+	// Name is the archive's file name. Without one it is named after the
+	// only source, or Archive.zip; ".zip" is added when missing.
+	Name string
+}
+
+// ArchiveBuilder packs a selection of files and folders into a ZIP on the
+// job runner and stores it as a new file, streaming each file from storage
+// into the archive as it is uploaded. Folders keep their structure below
+// the selected ones. Files the requester could not download on their own,
+// such as vault contents or other people's password-protected files, are
+// left out and listed on the build.
+type ArchiveBuilder struct {
+	DB       *gorm.DB
+	Store    TransferStore
+	Jobs     *JobRunner
+	Access   *AccessService
+	MaxFiles int
+	MaxBytes int64
+}
+
+func NewArchiveBuilder(db *gorm.DB, store TransferStore, jobs *JobRunner, access *AccessService, cfg config.PreviewConfig) *ArchiveBuilder {
+	b := &ArchiveBuilder{DB: db, Store: store, Jobs: jobs, Access: access, MaxFiles: cfg.ArchiveCreateMaxFiles, MaxBytes: cfg.ArchiveCreateMaxBytes}
+	jobs.Register(archiveBuildJob, b.runJob, JobOptions{MaxAttempts: 1})
+	return b
+}
+
+// Start checks req and queues the build. Access to the sources and the
+// target folder is checked by the caller.
+func (b *ArchiveBuilder) Start(ctx context.Context, requestedByID uuid.UUID, req ArchiveBuildRequest) (*models.ArchiveBuild, error) {
+	sources := make([]uuid.UUID, 0, len(req.SourceIDs))
+	seen := map[uuid.UUID]bool{}
+	for _, id := range req.SourceIDs {
+		if !seen[id] {
+			seen[id] = true
+			sources = append(sources, id)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("%w: select at least one file or folder", ErrArchiveBuildInvalid)
+	}
+	if len(sources) > MaxArchiveSources {
+		return nil, fmt.Errorf("%w: at most %d files and folders can be selected", ErrArchiveBuildInvalid, MaxArchiveSources)
+	}
+
+	db := b.DB.WithContext(ctx)
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = defaultArchiveName
+		if len(sources) == 1 {
+			var only models.File
+			if err := db.Select("name").First(&only, "id = ?", sources[0]).Error; err == nil {
+				name = only.Name + ".zip"
+			}
+		}
+	} else if strings.ContainsAny(name, "/\\") || name == "." || name == ".." {
+		return nil, fmt.Errorf("%w: name cannot contain slashes", ErrArchiveBuildInvalid)
+	}
+	if !strings.HasSuffix(strings.ToLower(name), ".zip") {
+		name += ".zip"
+	}
+	if len(name) > 255 {
+		return nil, fmt.Errorf("%w: name is too long", ErrArchiveBuildInvalid)
+	}
+
+	build := models.ArchiveBuild{
+		RequestedByID:  requestedByID,
+		SourceIDs:      sources,
+		TargetFolderID: req.TargetFolderID,
+		Name:           name,
+		Status:         models.ArchiveBuildPending,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&build).Error; err != nil {
+			return err
+		}
+		_, err := b.Jobs.enqueue(tx, archiveBuildJob, map[string]interface{}{"build_id": build.ID.String()}, EnqueueOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &build, nil
+}
+
+func (b *ArchiveBuilder) Get(ctx context.Context, id uuid.UUID) (*models.ArchiveBuild, error) {
+	var build models.ArchiveBuild
+	if err := b.DB.WithContext(ctx).First(&build, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrArchiveBuildNotFound
+		}
+		return nil, err
+	}
+	return &build, nil
+}
+
+func (b *ArchiveBuilder) runJob(ctx context.Context, job *models.Job) error {
+	raw, _ := job.Payload["build_id"].(string)
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("archive build job without a build id: %q", raw)
+	}
+	build, err := b.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if build.Status != models.ArchiveBuildPending {
+		return nil
+	}
+	return b.Run(ctx, build)
+}
+
+// Run builds and stores the archive, and saves the outcome and tells the
+// requester whether or not it succeeds.
+func (b *ArchiveBuilder) Run(ctx context.Context, build *models.ArchiveBuild) error {
+	now := time.Now().UTC()
+	build.Status = models.ArchiveBuildRunning
+	build.StartedAt = &now
+	build.FilesDone, build.BytesDone, build.Skipped = 0, 0, nil
+	if err := b.DB.Save(build).Error; err != nil {
+		return err
+	}
+
+	runErr := b.build(ctx, build)
+	finished := time.Now().UTC()
+	build.FinishedAt = &finished
+	if runErr != nil {
+		build.Status = models.ArchiveBuildFailed
+		build.LastError = runErr.Error()
+	} else {
+		build.Status = models.ArchiveBuildCompleted
+	}
+	if err := b.DB.Save(build).Error; err != nil {
+		return err
+	}
+	if err := b.notify(build); err != nil {
+		logger.Error("archive_build_notify_failed", err, map[string]interface{}{"build_id": build.ID.String()})
+	}
+
+	fields := map[string]interface{}{
+		"build_id":   build.ID.String(),
+		"status":     string(build.Status),
+		"files":      build.FilesDone,
+		"bytes":      build.BytesDone,
+		"size":       build.Size,
+		"started_by": build.RequestedByID.String(),
+	}
+	if runErr != nil {
+		logger.Error("archive_build_failed", runErr, fields)
+	} else {
+		logger.Info("archive_build_completed", fields)
+	}
+	return nil
+}
+
+func (b *ArchiveBuilder) notify(build *models.ArchiveBuild) error {
+	activity := models.Activity{
+		UserID:        build.RequestedByID,
+		ActorID:       build.RequestedByID,
+		Action:        "file.archive_create",
+		ResourceType:  "file",
+		ResourceID:    build.FileID,
+		ResourceName:  build.Name,
+		MessageKey:    "activity.archive.created",
+		MessageParams: map[string]string{"name": build.Name, "count": strconv.FormatInt(build.FilesDone, 10)},
+	}
+	if build.Status == models.ArchiveBuildFailed {
+		activity.ResourceID = build.TargetFolderID
+		activity.MessageKey = "activity.archive.create_failed"
+	}
+	return b.DB.Create(newActivity(activity)).Error
+}
+
+// archiveBuildEntry is one file or folder going into an archive, at path.
+type archiveBuildEntry struct {
+	path string
+	file *models.File
+}
+
+func (b *ArchiveBuilder) build(ctx context.Context, build *models.ArchiveBuild) error {
+	if b.Store == nil {
+		return errors.New("object storage is not configured")
+	}
+	db := b.DB.WithContext(ctx)
+	var requester models.User
+	if err := db.First(&requester, "id = ?", build.RequestedByID).Error; err != nil {
+		return fmt.Errorf("loading requester: %w", err)
+	}
+	if build.TargetFolderID != nil {
+		var target models.File
+		if err := db.Select("id").First(&target, "id = ? AND is_directory = ?", *build.TargetFolderID, true).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errArchiveTargetMissing
+			}
+			return err
+		}
+	}
+
+	entries, err := b.collect(ctx, build, &requester)
+	if err != nil {
+		return err
+	}
+	var total int64
+	build.FilesTotal = 0
+	for _, e := range entries {
+		if !e.file.IsDirectory {
+			build.FilesTotal++
+			total += e.file.Size
+		}
+	}
+	if b.MaxFiles > 0 && build.FilesTotal > int64(b.MaxFiles) {
+		return ErrArchiveBuildTooManyFiles
+	}
+	if b.MaxBytes > 0 && total > b.MaxBytes {
+		return ErrArchiveBuildTooLarge
+	}
+	if err := CheckStorageQuota(ctx, b.DB, requester.OrganizationID, total); err != nil {
+		return err
+	}
+	if err := b.saveProgress(build); err != nil {
+		return err
+	}
+
+	objectName := fmt.Sprintf("%s/%s/%s", requester.ID, uuid.New(), build.Name)
+	reader, writer := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		err := b.writeArchive(ctx, build, entries, writer)
+		writer.CloseWithError(err)
+		written <- err
+	}()
+	sum := sha256.New()
+	counted := &countingReader{r: io.TeeReader(reader, sum)}
+	uploadErr := b.Store.Upload(ctx, objectName, counted, -1, "application/zip")
+	reader.CloseWithError(errArchiveUploadStopped)
+	writeErr := <-written
+	if writeErr != nil && !errors.Is(writeErr, errArchiveUploadStopped) {
+		_ = b.Store.Delete(ctx, objectName)
+		return writeErr
+	}
+	if uploadErr != nil {
+		_ = b.Store.Delete(ctx, objectName)
+		return uploadErr
+	}
+
+	name, err := b.freeName(ctx, build.TargetFolderID, requester.ID, build.Name)
+	if err != nil {
+		_ = b.Store.Delete(ctx, objectName)
+		return err
+	}
+	checksum := hex.EncodeToString(sum.Sum(nil))
+	file := models.File{
+		Name:             name,
+		MimeType:         "application/zip",
+		Size:             counted.n,
+		ParentID:         build.TargetFolderID,
+		OwnerID:          requester.ID,
+		StoragePath:      objectName,
+		Checksum:         &checksum,
+		DetectedMimeType: "application/zip",
+		OrganizationID:   requester.OrganizationID,
+	}
+	if err := db.Create(&file).Error; err != nil {
+		_ = b.Store.Delete(ctx, objectName)
+		return err
+	}
+	build.FileID = &file.ID
+	build.Name = name
+	build.Size = counted.n
+	return nil
+}
+
+// collect lists what goes into the archive in the order it is written:
+// each source in turn, a folder followed by everything below it sorted by
+// path. Each source's name is the top level of its entries, numbered when
+// two sources share a name.
+func (b *ArchiveBuilder) collect(ctx context.Context, build *models.ArchiveBuild, requester *models.User) ([]archiveBuildEntry, error) {
+	db := b.DB.WithContext(ctx)
+	var entries []archiveBuildEntry
+	topNames := map[string]bool{}
+	for _, id := range build.SourceIDs {
+		var root models.File
+		if err := db.First(&root, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				b.skip(build, id.String(), ArchiveSkipDeleted)
+				continue
+			}
+			return nil, err
+		}
+		top := sanitizeArchiveName(root.Name)
+		for n := 1; topNames[strings.ToLower(top)]; n++ {
+			top = numberedName(sanitizeArchiveName(root.Name), n)
+		}
+		topNames[strings.ToLower(top)] = true
+		if b.Access != nil && !b.Access.HasAccess(ctx, requester.ID, root.ID, models.SharePermissionDownload) {
+			b.skip(build, top, ArchiveSkipNoAccess)
+			continue
+		}
+		if !root.IsDirectory {
+			if reason := archiveSkipReason(&root, requester.ID); reason != "" {
+				b.skip(build, top, reason)
+				continue
+			}
+			entries = append(entries, archiveBuildEntry{path: top, file: &root})
+			continue
+		}
+
+		ids, err := fileSubtree(ctx, b.DB, root.ID)
+		if err != nil {
+			return nil, err
+		}
+		byID := make(map[uuid.UUID]*models.File, len(ids))
+		for start := 0; start < len(ids); start += legalExportBatchSize {
+			var batch []models.File
+			if err := db.Where("id IN ?", ids[start:min(start+legalExportBatchSize, len(ids))]).Find(&batch).Error; err != nil {
+				return nil, err
+			}
+			for i := range batch {
+				byID[batch[i].ID] = &batch[i]
+			}
+		}
+		// A quarantined or vault folder takes everything below it out.
+		paths := map[uuid.UUID]string{root.ID: top}
+		blocked := map[uuid.UUID]string{root.ID: folderSkipReason(&root)}
+		var resolve func(f *models.File) (string, string)
+		resolve = func(f *models.File) (string, string) {
+			if p, ok := paths[f.ID]; ok {
+				return p, blocked[f.ID]
+			}
+			p, reason := "", ""
+			if parent, ok := byID[*f.ParentID]; ok {
+				p, reason = resolve(parent)
+			}
+			p += "/" + sanitizeArchiveName(f.Name)
+			if reason == "" {
+				if f.IsDirectory {
+					reason = folderSkipReason(f)
+				} else {
+					reason = archiveSkipReason(f, requester.ID)
+				}
+			}
+			paths[f.ID], blocked[f.ID] = p, reason
+			return p, reason
+		}
+		var tree []archiveBuildEntry
+		for _, f := range byID {
+			p, reason := resolve(f)
+			switch {
+			case reason == "":
+				tree = append(tree, archiveBuildEntry{path: p, file: f})
+			case !f.IsDirectory:
+				b.skip(build, p, reason)
+			}
+		}
+		sort.Slice(tree, func(i, j int) bool { return tree[i].path < tree[j].path })
+		entries = append(entries, tree...)
+	}
+	return entries, nil
+}
+
+// archiveSkipReason says why file cannot go into an archive built for
+// requesterID, or "" when it can.
+func archiveSkipReason(file *models.File, requesterID uuid.UUID) string {
+	switch {
+	case file.QuarantinedAt != nil:
+		return ArchiveSkipQuarantined
+	case file.VaultID != nil:
+		return ArchiveSkipVault
+	case file.PasswordProtected && file.OwnerID != requesterID:
+		return ArchiveSkipPassword
+	case file.ArchivedAt != nil:
+		return ArchiveSkipColdStorage
+	}
+	return ""
+}
+
+func folderSkipReason(folder *models.File) string {
+	switch {
+	case folder.QuarantinedAt != nil:
+		return ArchiveSkipQuarantined
+	case folder.VaultID != nil:
+		return ArchiveSkipVault
+	}
+	return ""
+}
+
+func (b *ArchiveBuilder) writeArchive(ctx context.Context, build *models.ArchiveBuild, entries []archiveBuildEntry, out io.Writer) error {
+	archive := zip.NewWriter(out)
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if e.file.IsDirectory {
+			if _, err := archive.CreateHeader(&zip.FileHeader{Name: e.path + "/", Modified: e.file.UpdatedAt}); err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := b.Store.Get(ctx, e.file.StoragePath)
+		if err != nil {
+			if errors.Is(err, storage.ErrObjectNotFound) {
+				b.skip(build, e.path, ArchiveSkipMissing)
+				continue
+			}
+			return fmt.Errorf("%s: %w", e.path, err)
+		}
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: e.path, Method: zip.Deflate, Modified: e.file.UpdatedAt})
+		if err == nil {
+			var n int64
+			n, err = io.Copy(w, data)
+			build.BytesDone += n
+		}
+		data.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.path, err)
+		}
+		build.FilesDone++
+		if build.FilesDone%archiveBuildProgressEvery == 0 {
+			if err := b.saveProgress(build); err != nil {
+				return err
+			}
+		}
+	}
+	if err := b.saveProgress(build); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// freeName returns name, or "name (n).zip" when a file in the target folder
+// already has it.
+func (b *ArchiveBuilder) freeName(ctx context.Context, folderID *uuid.UUID, ownerID uuid.UUID, name string) (string, error) {
+	candidate := name
+	for n := 1; ; n++ {
+		query := b.DB.WithContext(ctx).Model(&models.File{}).Where("name = ?", candidate)
+		if folderID == nil {
+			query = query.Where("parent_id IS NULL AND owner_id = ?", ownerID)
+		} else {
+			query = query.Where("parent_id = ?", *folderID)
+		}
+		var taken int64
+		if err := query.Count(&taken).Error; err != nil {
+			return "", err
+		}
+		if taken == 0 {
+			return candidate, nil
+		}
+		candidate = numberedName(name, n)
+	}
+}
+
+func (b *ArchiveBuilder) skip(build *models.ArchiveBuild, path, reason string) {
+	if len(build.Skipped) < maxArchiveBuildSkips {
+		build.Skipped = append(build.Skipped, models.ArchiveBuildSkip{Path: path, Reason: reason})
+	}
+}
+
+func (b *ArchiveBuilder) saveProgress(build *models.ArchiveBuild) error {
+	return b.DB.Model(build).Select("files_total", "files_done", "bytes_done", "skipped").Updates(build).Error
+}
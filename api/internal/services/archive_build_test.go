@@ -0,0 +1,153 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestArchiveBuilder(t *testing.T) {
+	logger.Init()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.File{}, &models.Organization{}, &models.Activity{}, &models.Job{}, &models.ArchiveBuild{}); err != nil {
+		t.Fatalf("failed automigrating models: %v", err)
+	}
+	ctx := context.Background()
+	bucket := newMemoryBucket()
+	jobs := NewJobRunner(db, config.JobsConfig{})
+	builder := NewArchiveBuilder(db, bucket, jobs, nil, config.PreviewConfig{ArchiveCreateMaxFiles: 10, ArchiveCreateMaxBytes: 1024})
+
+	user := models.User{Email: "bundle@example.com", FirstName: "Bun", LastName: "Dle", PasswordHash: "hash", Role: models.UserRoleUser}
+	db.Create(&user)
+	otherID := uuid.New()
+
+	newFile := func(name string, parent *models.File, content string, edit func(*models.File)) models.File {
+		f := models.File{Name: name, OwnerID: user.ID, MimeType: "text/plain", Size: int64(len(content)), StoragePath: uuid.NewString()}
+		if parent != nil {
+			f.ParentID = &parent.ID
+		}
+		if content == "" {
+			f.IsDirectory, f.MimeType, f.StoragePath = true, "inode/directory", ""
+		} else {
+			bucket.put(f.StoragePath, content)
+		}
+		if edit != nil {
+			edit(&f)
+		}
+		if err := db.Create(&f).Error; err != nil {
+			t.Fatalf("failed creating %s: %v", name, err)
+		}
+		return f
+	}
+	release := newFile("release", nil, "", nil)
+	newFile("CHANGELOG.md", &release, "# 1.0", nil)
+	bin := newFile("bin", &release, "", nil)
+	newFile("tool.sh", &bin, "echo hi", nil)
+	newFile("secret.txt", &release, "hidden", func(f *models.File) { f.OwnerID, f.PasswordProtected = otherID, true })
+	now := time.Now()
+	newFile("frozen.iso", &release, "cold", func(f *models.File) { f.ArchivedAt = &now })
+	notes := newFile("notes.txt", nil, "loose notes", nil)
+	dist := newFile("dist", nil, "", nil)
+
+	build, err := builder.Start(ctx, user.ID, ArchiveBuildRequest{SourceIDs: []uuid.UUID{release.ID, notes.ID, release.ID}, TargetFolderID: &dist.ID, Name: "v1.0"})
+	if err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if build.Name != "v1.0.zip" || len(build.SourceIDs) != 2 {
+		t.Fatalf("expected a .zip name and duplicates dropped, got %q, %v", build.Name, build.SourceIDs)
+	}
+	if ran, err := jobs.RunNext(ctx); !ran || err != nil {
+		t.Fatalf("expected the build job to run, got %v, %v", ran, err)
+	}
+	build, _ = builder.Get(ctx, build.ID)
+	if build.Status != models.ArchiveBuildCompleted || build.FileID == nil {
+		t.Fatalf("expected a completed build, got %s: %s", build.Status, build.LastError)
+	}
+	if build.FilesTotal != 3 || build.FilesDone != 3 || len(build.Skipped) != 2 {
+		t.Fatalf("unexpected counters %+v", build)
+	}
+
+	var archive models.File
+	db.First(&archive, "id = ?", *build.FileID)
+	if archive.Name != "v1.0.zip" || archive.ParentID == nil || *archive.ParentID != dist.ID || archive.OwnerID != user.ID || archive.Size != build.Size {
+		t.Fatalf("unexpected archive file %+v", archive)
+	}
+	data := bucket.objects[archive.StoragePath]
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("stored archive is not a zip: %v", err)
+	}
+	var names []string
+	contents := map[string]string{}
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		rc, _ := f.Open()
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		contents[f.Name] = string(body)
+	}
+	sort.Strings(names)
+	want := []string{"notes.txt", "release/", "release/CHANGELOG.md", "release/bin/", "release/bin/tool.sh"}
+	if len(names) != len(want) {
+		t.Fatalf("expected %v, got %v", want, names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, names)
+		}
+	}
+	if contents["release/bin/tool.sh"] != "echo hi" {
+		t.Fatalf("unexpected contents %q", contents["release/bin/tool.sh"])
+	}
+
+	var activity models.Activity
+	db.Where("user_id = ? AND message_key = ?", user.ID, "activity.archive.created").First(&activity)
+	if activity.ResourceID == nil || *activity.ResourceID != archive.ID || activity.MessageParams["count"] != "3" {
+		t.Fatalf("unexpected activity %+v", activity)
+	}
+
+	t.Run("a taken name is numbered", func(t *testing.T) {
+		again, _ := builder.Start(ctx, user.ID, ArchiveBuildRequest{SourceIDs: []uuid.UUID{notes.ID}, TargetFolderID: &dist.ID, Name: "v1.0.zip"})
+		if err := builder.Run(ctx, again); err != nil || again.Name != "v1.0 (1).zip" {
+			t.Fatalf("expected a numbered name, got %q, %v", again.Name, err)
+		}
+	})
+
+	t.Run("limits fail the build", func(t *testing.T) {
+		small := &ArchiveBuilder{DB: db, Store: bucket, Jobs: jobs, MaxFiles: 1}
+		tooMany, _ := small.Start(ctx, user.ID, ArchiveBuildRequest{SourceIDs: []uuid.UUID{release.ID}})
+		if tooMany.Name != "release.zip" {
+			t.Fatalf("expected the archive named after its only source, got %q", tooMany.Name)
+		}
+		small.Run(ctx, tooMany)
+		if tooMany.Status != models.ArchiveBuildFailed || tooMany.LastError != ErrArchiveBuildTooManyFiles.Error() {
+			t.Fatalf("expected ErrArchiveBuildTooManyFiles, got %s: %s", tooMany.Status, tooMany.LastError)
+		}
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		for name, req := range map[string]ArchiveBuildRequest{
+			"no sources": {},
+			"slash":      {SourceIDs: []uuid.UUID{notes.ID}, Name: "a/b.zip"},
+		} {
+			if _, err := builder.Start(ctx, user.ID, req); !errors.Is(err, ErrArchiveBuildInvalid) {
+				t.Errorf("%s: expected ErrArchiveBuildInvalid, got %v", name, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+)
+
+// Archive formats whose contents can be listed.
+const (
+	ArchiveFormatZip   = "zip"
+	ArchiveFormatTar   = "tar"
+	ArchiveFormatTarGz = "tar.gz"
+)
+
+var (
+	ErrArchiveUnsupported    = errors.New("file is not a ZIP or TAR archive")
+	ErrArchiveInvalid        = errors.New("archive is damaged or not in the format its name suggests")
+	ErrArchiveEntryNotFound  = errors.New("archive entry not found")
+	ErrArchiveEntryDirectory = errors.New("archive entry is a directory")
+	ErrArchiveEntryTooLarge  = errors.New("archive entry is too large to extract on its own")
+)
+
+// ArchiveReader is a stored archive opened for reading. ZIP listings only
+// read the central directory at the end through ReadAt, and TAR listings
+// seek past entry bodies, so neither downloads the whole object. A
+// gzipped TAR has to be read through up to the entries needed.
+type ArchiveReader interface {
+	io.ReaderAt
+	io.ReadSeeker
+}
+
+// ArchiveEntry is one file or directory inside an archive.
+type ArchiveEntry struct {
+	Path           string     `json:"path"`
+	Size           int64      `json:"size"`
+	CompressedSize *int64     `json:"compressedSize,omitempty"`
+	ModifiedAt     *time.Time `json:"modifiedAt,omitempty"`
+	IsDirectory    bool       `json:"isDirectory"`
+}
+
+// ArchiveListing is the contents of an archive, in stored order.
+type ArchiveListing struct {
+	Format    string         `json:"format"`
+	Entries   []ArchiveEntry `json:"entries"`
+	Truncated bool           `json:"truncated"`
+}
+
+// ArchiveContents lists archives and extracts single entries from them.
+type ArchiveContents struct {
+	MaxEntries    int
+	MaxEntryBytes int64
+}
+
+func NewArchiveContents(cfg config.PreviewConfig) *ArchiveContents {
+	return &ArchiveContents{MaxEntries: cfg.ArchiveMaxEntries, MaxEntryBytes: cfg.ArchiveEntryMaxBytes}
+}
+
+// ArchiveFormatOf returns the archive format of file, going by its name and
+// then its MIME type, or "" when it is not an archive.
+func ArchiveFormatOf(file *models.File) string {
+	if file.IsDirectory {
+		return ""
+	}
+	name := strings.ToLower(file.Name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return ArchiveFormatZip
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return ArchiveFormatTarGz
+	case strings.HasSuffix(name, ".tar"):
+		return ArchiveFormatTar
+	}
+	switch baseMediaType(file.MimeType) {
+	case "application/zip", "application/x-zip-compressed":
+		return ArchiveFormatZip
+	case "application/x-tar":
+		return ArchiveFormatTar
+	}
+	return ""
+}
+
+// List returns the entries of file's archive, read from r, up to
+// MaxEntries. Links and other special TAR entries are left out.
+func (a *ArchiveContents) List(r ArchiveReader, file *models.File) (*ArchiveListing, error) {
+	listing := &ArchiveListing{Format: ArchiveFormatOf(file), Entries: []ArchiveEntry{}}
+	err := walkArchive(r, file, func(entry ArchiveEntry, _ func() (io.ReadCloser, error)) (bool, error) {
+		if a.MaxEntries > 0 && len(listing.Entries) >= a.MaxEntries {
+			listing.Truncated = true
+			return false, nil
+		}
+		listing.Entries = append(listing.Entries, entry)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return listing, nil
+}
+
+// Open finds the entry at path in file's archive and returns it with a
+// reader of its contents. The caller closes the reader.
+func (a *ArchiveContents) Open(r ArchiveReader, file *models.File, path string) (*ArchiveEntry, io.ReadCloser, error) {
+	var found *ArchiveEntry
+	var body io.ReadCloser
+	err := walkArchive(r, file, func(entry ArchiveEntry, open func() (io.ReadCloser, error)) (bool, error) {
+		if entry.Path != path {
+			return true, nil
+		}
+		if err := a.checkExtract(entry); err != nil {
+			return false, err
+		}
+		rc, err := open()
+		if err != nil {
+			return false, err
+		}
+		found, body = &entry, rc
+		return false, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if found == nil {
+		return nil, nil, ErrArchiveEntryNotFound
+	}
+	return found, body, nil
+}
+
+func (a *ArchiveContents) checkExtract(entry ArchiveEntry) error {
+	if entry.IsDirectory {
+		return ErrArchiveEntryDirectory
+	}
+	if a.MaxEntryBytes > 0 && entry.Size > a.MaxEntryBytes {
+		return ErrArchiveEntryTooLarge
+	}
+	return nil
+}
+
+// openZip reads the central directory. Entries with unsafe names are
+// still listed; nothing is ever written to disk from them.
+func openZip(r io.ReaderAt, size int64) (*zip.Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+		return nil, archiveError(err)
+	}
+	return zr, nil
+}
+
+func zipEntry(f *zip.File) ArchiveEntry {
+	compressed := int64(f.CompressedSize64)
+	entry := ArchiveEntry{
+		Path:           f.Name,
+		Size:           int64(f.UncompressedSize64),
+		CompressedSize: &compressed,
+		IsDirectory:    f.FileInfo().IsDir(),
+	}
+	if modified := f.Modified; !modified.IsZero() {
+		modified = modified.UTC()
+		entry.ModifiedAt = &modified
+	}
+	return entry
+}
+
+func tarEntry(hdr *tar.Header) ArchiveEntry {
+	modified := hdr.ModTime.UTC()
+	entry := ArchiveEntry{Path: hdr.Name, IsDirectory: hdr.Typeflag == tar.TypeDir, ModifiedAt: &modified}
+	if !entry.IsDirectory {
+		entry.Size = hdr.Size
+	}
+	return entry
+}
+
+// walkArchive calls fn with each file and directory in file's archive, in
+// stored order, until fn returns false or an error. open reads the body of
+// the entry; for a TAR it is only valid until the walk moves on.
+func walkArchive(r ArchiveReader, file *models.File, fn func(entry ArchiveEntry, open func() (io.ReadCloser, error)) (bool, error)) error {
+	switch format := ArchiveFormatOf(file); format {
+	case ArchiveFormatZip:
+		zr, err := openZip(r, file.Size)
+		if err != nil {
+			return err
+		}
+		for _, f := range zr.File {
+			open := func() (io.ReadCloser, error) {
+				rc, err := f.Open()
+				if err != nil {
+					return nil, archiveError(err)
+				}
+				return rc, nil
+			}
+			more, err := fn(zipEntry(f), open)
+			if err != nil || !more {
+				return err
+			}
+		}
+		return nil
+	case ArchiveFormatTar, ArchiveFormatTarGz:
+		return walkTar(r, format, func(hdr *tar.Header, tr io.Reader) (bool, error) {
+			entry := tarEntry(hdr)
+			return fn(entry, func() (io.ReadCloser, error) {
+				return io.NopCloser(io.LimitReader(tr, entry.Size)), nil
+			})
+		})
+	}
+	return ErrArchiveUnsupported
+}
+
+// walkTar calls fn with each file and directory in a TAR read from r, with
+// a reader of the entry's body, until fn returns false or an error.
+func walkTar(r io.ReadSeeker, format string, fn func(*tar.Header, io.Reader) (bool, error)) error {
+	var src io.Reader = r
+	if format == ArchiveFormatTarGz {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return archiveError(err)
+		}
+		defer gz.Close()
+		src = gz
+	}
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && !errors.Is(err, tar.ErrInsecurePath) {
+			return archiveError(err)
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeDir {
+			continue
+		}
+		more, err := fn(hdr, tr)
+		if err != nil || !more {
+			return err
+		}
+	}
+}
+
+// archiveError tells a malformed archive from a failure to read it.
+func archiveError(err error) error {
+	for _, format := range []error{zip.ErrFormat, zip.ErrAlgorithm, zip.ErrChecksum, tar.ErrHeader, gzip.ErrHeader, gzip.ErrChecksum, io.ErrUnexpectedEOF, io.EOF} {
+		if errors.Is(err, format) {
+			return ErrArchiveInvalid
+		}
+	}
+	return err
+}
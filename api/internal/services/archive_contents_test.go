@@ -0,0 +1,171 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+type archiveTestEntry struct {
+	name string
+	body string
+}
+
+var archiveTestEntries = []archiveTestEntry{
+	{"docs/", ""},
+	{"docs/readme.txt", "hello from the archive"},
+	{"data.csv", "a,b\n1,2\n"},
+}
+
+func buildZip(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range archiveTestEntries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)})
+		if err != nil {
+			t.Fatalf("failed adding %s: %v", e.name, err)
+		}
+		io.WriteString(w, e.body)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed closing zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func buildTar(t *testing.T, gzipped bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gz *gzip.Writer
+	if gzipped {
+		gz = gzip.NewWriter(&buf)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for _, e := range archiveTestEntries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.body)), ModTime: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), Typeflag: tar.TypeReg}
+		if e.body == "" {
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0o755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed adding %s: %v", e.name, err)
+		}
+		io.WriteString(tw, e.body)
+	}
+	tw.WriteHeader(&tar.Header{Name: "link", Linkname: "data.csv", Typeflag: tar.TypeSymlink})
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed closing tar: %v", err)
+	}
+	if gz != nil {
+		gz.Close()
+	}
+	return buf.Bytes()
+}
+
+func TestArchiveFormatOf(t *testing.T) {
+	cases := map[string]struct {
+		file models.File
+		want string
+	}{
+		"zip by name":     {models.File{Name: "Photos.ZIP"}, ArchiveFormatZip},
+		"tgz by name":     {models.File{Name: "src.tgz"}, ArchiveFormatTarGz},
+		"tar.gz by name":  {models.File{Name: "src.tar.gz"}, ArchiveFormatTarGz},
+		"tar by mime":     {models.File{Name: "bundle", MimeType: "application/x-tar"}, ArchiveFormatTar},
+		"plain gzip":      {models.File{Name: "log.gz", MimeType: "application/gzip"}, ""},
+		"folder":          {models.File{Name: "x.zip", IsDirectory: true}, ""},
+		"not an archive":  {models.File{Name: "notes.txt", MimeType: "text/plain"}, ""},
+		"zip with params": {models.File{Name: "x", MimeType: "application/zip; charset=binary"}, ArchiveFormatZip},
+	}
+	for name, tc := range cases {
+		if got := ArchiveFormatOf(&tc.file); got != tc.want {
+			t.Errorf("%s: expected %q, got %q", name, tc.want, got)
+		}
+	}
+}
+
+func TestArchiveContents(t *testing.T) {
+	archives := map[string]struct {
+		name string
+		data []byte
+	}{
+		ArchiveFormatZip:   {"bundle.zip", buildZip(t)},
+		ArchiveFormatTar:   {"bundle.tar", buildTar(t, false)},
+		ArchiveFormatTarGz: {"bundle.tar.gz", buildTar(t, true)},
+	}
+	contents := &ArchiveContents{MaxEntries: 100, MaxEntryBytes: 1024}
+
+	for format, archive := range archives {
+		file := &models.File{Name: archive.name, Size: int64(len(archive.data))}
+
+		t.Run(format+" listing", func(t *testing.T) {
+			listing, err := contents.List(bytes.NewReader(archive.data), file)
+			if err != nil {
+				t.Fatalf("list failed: %v", err)
+			}
+			if listing.Format != format || listing.Truncated || len(listing.Entries) != len(archiveTestEntries) {
+				t.Fatalf("unexpected listing %+v", listing)
+			}
+			for i, e := range archiveTestEntries {
+				got := listing.Entries[i]
+				if got.Path != e.name || got.Size != int64(len(e.body)) || got.IsDirectory != (e.body == "") {
+					t.Fatalf("entry %d: expected %s, got %+v", i, e.name, got)
+				}
+			}
+
+			short := &ArchiveContents{MaxEntries: 2}
+			listing, err = short.List(bytes.NewReader(archive.data), file)
+			if err != nil || len(listing.Entries) != 2 || !listing.Truncated {
+				t.Fatalf("expected a truncated listing, got %+v, %v", listing, err)
+			}
+		})
+
+		t.Run(format+" extraction", func(t *testing.T) {
+			entry, body, err := contents.Open(bytes.NewReader(archive.data), file, "docs/readme.txt")
+			if err != nil {
+				t.Fatalf("open failed: %v", err)
+			}
+			defer body.Close()
+			data, err := io.ReadAll(body)
+			if err != nil || string(data) != "hello from the archive" || entry.Size != int64(len(data)) {
+				t.Fatalf("unexpected entry %+v with %q, %v", entry, data, err)
+			}
+
+			for path, want := range map[string]error{
+				"missing.txt": ErrArchiveEntryNotFound,
+				"docs/":       ErrArchiveEntryDirectory,
+				"link":        ErrArchiveEntryNotFound,
+			} {
+				if _, _, err := contents.Open(bytes.NewReader(archive.data), file, path); !errors.Is(err, want) {
+					t.Errorf("%s: expected %v, got %v", path, want, err)
+				}
+			}
+
+			tiny := &ArchiveContents{MaxEntryBytes: 4}
+			if _, _, err := tiny.Open(bytes.NewReader(archive.data), file, "data.csv"); !errors.Is(err, ErrArchiveEntryTooLarge) {
+				t.Fatalf("expected ErrArchiveEntryTooLarge, got %v", err)
+			}
+		})
+	}
+
+	t.Run("damaged archives", func(t *testing.T) {
+		junk := []byte("this is not an archive at all, just some text that is long enough")
+		for _, name := range []string{"junk.zip", "junk.tar.gz"} {
+			file := &models.File{Name: name, Size: int64(len(junk))}
+			if _, err := contents.List(bytes.NewReader(junk), file); !errors.Is(err, ErrArchiveInvalid) {
+				t.Errorf("%s: expected ErrArchiveInvalid, got %v", name, err)
+			}
+		}
+		if _, err := contents.List(bytes.NewReader(junk), &models.File{Name: "notes.txt"}); !errors.Is(err, ErrArchiveUnsupported) {
+			t.Fatalf("expected ErrArchiveUnsupported, got %v", err)
+		}
+	})
+}
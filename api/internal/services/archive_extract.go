@@ -0,0 +1,484 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	archiveExtractJob = "archive.extract"
+	// archiveExtractProgressEvery is how many entries pass between
+	// progress saves.
+	archiveExtractProgressEvery = 25
+	maxArchiveExtractFailures   = 100
+)
+
+var (
+	ErrExtractionNotFound   = errors.New("extraction not found")
+	ErrArchiveTooManyFiles  = errors.New("archive holds more files than can be extracted at once")
+	ErrArchiveTooLarge      = errors.New("archive unpacks to more data than can be extracted at once")
+	ErrArchiveEntryUnsafe   = errors.New("entry path is absolute or leads outside the target folder")
+	errArchiveSourceMissing = errors.New("archive was deleted")
+	errArchiveTargetMissing = errors.New("target folder was deleted")
+)
+
+// ArchiveObject is a stored archive opened for extraction.
+type ArchiveObject interface {
+	ArchiveReader
+	io.Closer
+}
+
+// ArchiveStore reads archives and stores what is unpacked from them.
+type ArchiveStore interface {
+	ObjectUploader
+	OpenArchive(ctx context.Context, key string) (ArchiveObject, error)
+}
+
+// ArchiveExtractor unpacks stored archives into folders on the job
+// runner. Every file in the archive becomes a File of its own, checked
+// against the upload policy and the organization quota and streamed
+// straight from the archive to storage. Entries whose paths would land
+// outside the target folder are refused.
+type ArchiveExtractor struct {
+	DB       *gorm.DB
+	Store    ArchiveStore
+	Jobs     *JobRunner
+	Policy   *UploadPolicy
+	MaxFiles int
+	MaxBytes int64
+}
+
+func NewArchiveExtractor(db *gorm.DB, store ArchiveStore, jobs *JobRunner, policy *UploadPolicy, cfg config.PreviewConfig) *ArchiveExtractor {
+	x := &ArchiveExtractor{DB: db, Store: store, Jobs: jobs, Policy: policy, MaxFiles: cfg.ArchiveExtractMaxFiles, MaxBytes: cfg.ArchiveExtractMaxBytes}
+	jobs.Register(archiveExtractJob, x.runJob, JobOptions{})
+	return x
+}
+
+// Start queues the extraction of archive into the folder target for
+// requestedByID. Access to both is checked by the caller.
+func (x *ArchiveExtractor) Start(ctx context.Context, archive, target *models.File, requestedByID uuid.UUID) (*models.ArchiveExtraction, error) {
+	if ArchiveFormatOf(archive) == "" {
+		return nil, ErrArchiveUnsupported
+	}
+	extraction := models.ArchiveExtraction{
+		FileID:         archive.ID,
+		TargetFolderID: target.ID,
+		RequestedByID:  requestedByID,
+		Status:         models.ArchiveExtractionPending,
+	}
+	err := x.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&extraction).Error; err != nil {
+			return err
+		}
+		_, err := x.Jobs.enqueue(tx, archiveExtractJob, map[string]interface{}{"extraction_id": extraction.ID.String()}, EnqueueOptions{UniqueKey: "extract:" + extraction.ID.String()})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &extraction, nil
+}
+
+// CreateFolder makes a new folder for archive to be extracted into, named
+// after the archive without its extension, in parentID or owner's root
+// when it is nil. A taken name gets a number.
+func (x *ArchiveExtractor) CreateFolder(ctx context.Context, archive *models.File, parentID *uuid.UUID, owner *models.User) (*models.File, error) {
+	base := archive.Name
+	lower := strings.ToLower(base)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(lower, ext) && len(base) > len(ext) {
+			base = base[:len(base)-len(ext)]
+			break
+		}
+	}
+	db := x.DB.WithContext(ctx)
+	name, err := freeFolderName(db, parentID, owner.ID, base)
+	if err != nil {
+		return nil, err
+	}
+	folder := models.File{
+		Name:           name,
+		MimeType:       "inode/directory",
+		IsDirectory:    true,
+		ParentID:       parentID,
+		OwnerID:        owner.ID,
+		OrganizationID: owner.OrganizationID,
+	}
+	if err := db.Create(&folder).Error; err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+func (x *ArchiveExtractor) Get(ctx context.Context, id uuid.UUID) (*models.ArchiveExtraction, error) {
+	var extraction models.ArchiveExtraction
+	if err := x.DB.WithContext(ctx).First(&extraction, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrExtractionNotFound
+		}
+		return nil, err
+	}
+	return &extraction, nil
+}
+
+func (x *ArchiveExtractor) runJob(ctx context.Context, job *models.Job) error {
+	raw, _ := job.Payload["extraction_id"].(string)
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("extract job without an extraction id: %q", raw)
+	}
+	extraction, err := x.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if extraction.Status != models.ArchiveExtractionPending && extraction.Status != models.ArchiveExtractionRunning {
+		// Finished by an earlier attempt.
+		return nil
+	}
+	return x.Run(ctx, extraction)
+}
+
+// Run unpacks the archive, continuing after the entries an earlier attempt
+// handled. Entries that cannot be unpacked are recorded on the extraction;
+// a damaged archive, a limit being reached or trouble with storage or the
+// database fails it, keeping what was unpacked so far. The requester is
+// told how it went either way.
+func (x *ArchiveExtractor) Run(ctx context.Context, extraction *models.ArchiveExtraction) error {
+	now := time.Now().UTC()
+	extraction.Status = models.ArchiveExtractionRunning
+	if extraction.StartedAt == nil {
+		extraction.StartedAt = &now
+	}
+	if err := x.DB.Save(extraction).Error; err != nil {
+		return err
+	}
+
+	run := &extractRun{x: x, extraction: extraction, folders: map[string]uuid.UUID{}}
+	runErr := run.execute(ctx)
+
+	finished := time.Now().UTC()
+	extraction.FinishedAt = &finished
+	if runErr != nil {
+		extraction.Status = models.ArchiveExtractionFailed
+		extraction.LastError = runErr.Error()
+	} else {
+		extraction.Status = models.ArchiveExtractionCompleted
+	}
+	if err := x.DB.Save(extraction).Error; err != nil {
+		return err
+	}
+	if err := x.notify(run); err != nil {
+		logger.Error("archive_extract_notify_failed", err, map[string]interface{}{"extraction_id": extraction.ID.String()})
+	}
+
+	fields := map[string]interface{}{
+		"extraction_id":   extraction.ID.String(),
+		"file_id":         extraction.FileID.String(),
+		"status":          string(extraction.Status),
+		"files_extracted": extraction.FilesExtracted,
+		"bytes_extracted": extraction.BytesExtracted,
+		"folders_created": extraction.FoldersCreated,
+		"files_skipped":   extraction.FilesSkipped,
+		"files_failed":    extraction.FilesFailed,
+	}
+	if runErr != nil {
+		logger.Error("archive_extract_failed", runErr, fields)
+	} else {
+		logger.Info("archive_extract_finished", fields)
+	}
+	return nil
+}
+
+// notify tells the requester the extraction has finished.
+func (x *ArchiveExtractor) notify(run *extractRun) error {
+	extraction := run.extraction
+	name, target := run.archive.Name, run.target.Name
+	if name == "" {
+		x.DB.Unscoped().Model(&models.File{}).Where("id = ?", extraction.FileID).Pluck("name", &name)
+	}
+	if target == "" {
+		x.DB.Unscoped().Model(&models.File{}).Where("id = ?", extraction.TargetFolderID).Pluck("name", &target)
+	}
+	activity := models.Activity{
+		UserID:        extraction.RequestedByID,
+		ActorID:       extraction.RequestedByID,
+		Action:        "file.extract",
+		ResourceType:  "file",
+		ResourceID:    &extraction.TargetFolderID,
+		ResourceName:  target,
+		MessageKey:    "activity.archive.extracted",
+		MessageParams: map[string]string{"name": name, "folder": target, "count": strconv.FormatInt(extraction.FilesExtracted, 10)},
+	}
+	if extraction.Status == models.ArchiveExtractionFailed {
+		activity.MessageKey = "activity.archive.extract_failed"
+	}
+	return x.DB.Create(newActivity(activity)).Error
+}
+
+// extractRun holds the state of one pass over an archive.
+type extractRun struct {
+	x          *ArchiveExtractor
+	extraction *models.ArchiveExtraction
+	archive    models.File
+	target     models.File
+	requester  models.User
+	folders    map[string]uuid.UUID
+}
+
+func (r *extractRun) execute(ctx context.Context) error {
+	if r.x.Store == nil {
+		return errors.New("object storage is not configured")
+	}
+	if err := r.x.DB.First(&r.archive, "id = ?", r.extraction.FileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errArchiveSourceMissing
+		}
+		return err
+	}
+	if err := r.x.DB.First(&r.target, "id = ? AND is_directory = ?", r.extraction.TargetFolderID, true).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errArchiveTargetMissing
+		}
+		return err
+	}
+	if err := r.x.DB.First(&r.requester, "id = ?", r.extraction.RequestedByID).Error; err != nil {
+		return fmt.Errorf("loading requester: %w", err)
+	}
+
+	obj, err := r.x.Store.OpenArchive(ctx, r.archive.StoragePath)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	if r.extraction.EntriesTotal == nil && ArchiveFormatOf(&r.archive) == ArchiveFormatZip {
+		// The central directory gives the count without reading entries.
+		if listing, err := (&ArchiveContents{}).List(obj, &r.archive); err == nil {
+			total := int64(len(listing.Entries))
+			r.extraction.EntriesTotal = &total
+		}
+	}
+
+	var index int64
+	err = walkArchive(obj, &r.archive, func(entry ArchiveEntry, open func() (io.ReadCloser, error)) (bool, error) {
+		index++
+		if index <= r.extraction.EntriesDone {
+			return true, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		if err := r.entry(ctx, entry, open); err != nil {
+			return false, err
+		}
+		r.extraction.EntriesDone = index
+		if index%archiveExtractProgressEvery == 0 {
+			return true, r.saveProgress()
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	return r.saveProgress()
+}
+
+// entry unpacks one archive entry. Only errors that should end the run are
+// returned; anything wrong with the entry alone is recorded as a failure.
+func (r *extractRun) entry(ctx context.Context, entry ArchiveEntry, open func() (io.ReadCloser, error)) error {
+	clean, ok := cleanArchivePath(entry.Path)
+	if !ok || (clean == "." && !entry.IsDirectory) {
+		r.fail(entry.Path, ErrArchiveEntryUnsafe)
+		return nil
+	}
+	if entry.IsDirectory {
+		_, err := r.folder(clean)
+		return err
+	}
+
+	if r.x.MaxFiles > 0 && r.extraction.FilesExtracted >= int64(r.x.MaxFiles) {
+		return ErrArchiveTooManyFiles
+	}
+	if r.x.MaxBytes > 0 && r.extraction.BytesExtracted+entry.Size > r.x.MaxBytes {
+		return ErrArchiveTooLarge
+	}
+	parentID, err := r.folder(path.Dir(clean))
+	if err != nil {
+		return err
+	}
+	name, skip, err := r.destinationName(parentID, path.Base(clean), entry.Size)
+	if err != nil {
+		return err
+	}
+	if skip {
+		r.extraction.FilesSkipped++
+		return nil
+	}
+	if err := CheckStorageQuota(ctx, r.x.DB, r.requester.OrganizationID, entry.Size); err != nil {
+		r.fail(entry.Path, err)
+		return nil
+	}
+
+	body, err := open()
+	if err != nil {
+		r.fail(entry.Path, err)
+		return nil
+	}
+	defer body.Close()
+
+	buffered := bufio.NewReaderSize(body, SniffLength)
+	head, _ := buffered.Peek(SniffLength)
+	detected := DetectContentType(head)
+	mimeType := detected
+	if byExt := mime.TypeByExtension(path.Ext(name)); byExt != "" {
+		mimeType = baseMediaType(byExt)
+	}
+	if err := r.x.Policy.Check(name, mimeType, detected); err != nil {
+		r.fail(entry.Path, err)
+		return nil
+	}
+
+	hash := sha256.New()
+	counted := &countingReader{r: io.TeeReader(buffered, hash)}
+	objectName := fmt.Sprintf("%s/%s/%s", r.requester.ID, uuid.New(), name)
+	if err := r.x.Store.Upload(ctx, objectName, counted, entry.Size, mimeType); err != nil {
+		r.fail(entry.Path, archiveError(err))
+		return nil
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	file := models.File{
+		Name:             name,
+		MimeType:         mimeType,
+		Size:             counted.n,
+		ParentID:         &parentID,
+		OwnerID:          r.requester.ID,
+		StoragePath:      objectName,
+		Checksum:         &checksum,
+		DetectedMimeType: detected,
+		OrganizationID:   r.requester.OrganizationID,
+	}
+	if err := r.x.DB.Create(&file).Error; err != nil {
+		_ = r.x.Store.Delete(ctx, objectName)
+		return err
+	}
+	r.extraction.FilesExtracted++
+	r.extraction.BytesExtracted += counted.n
+	return nil
+}
+
+func (r *extractRun) saveProgress() error {
+	return r.x.DB.Model(r.extraction).Select(
+		"entries_total", "entries_done", "files_extracted", "folders_created", "bytes_extracted", "files_skipped", "files_failed", "failures",
+	).Updates(r.extraction).Error
+}
+
+func (r *extractRun) fail(entryPath string, err error) {
+	r.extraction.FilesFailed++
+	if len(r.extraction.Failures) < maxArchiveExtractFailures {
+		r.extraction.Failures = append(r.extraction.Failures, models.ArchiveExtractionFailure{Path: entryPath, Error: err.Error()})
+	}
+}
+
+// folder returns the folder for dir, a cleaned path inside the archive,
+// creating it and its parents under the target folder. "." is the target
+// folder itself. A folder of the same name already there is reused.
+func (r *extractRun) folder(dir string) (uuid.UUID, error) {
+	if dir == "." {
+		return r.target.ID, nil
+	}
+	if id, ok := r.folders[dir]; ok {
+		return id, nil
+	}
+	parentID, err := r.folder(path.Dir(dir))
+	if err != nil {
+		return uuid.Nil, err
+	}
+	name := path.Base(dir)
+
+	var existing models.File
+	result := r.x.DB.Where("parent_id = ? AND name = ? AND is_directory = ?", parentID, name, true).Limit(1).Find(&existing)
+	if result.Error != nil {
+		return uuid.Nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		r.folders[dir] = existing.ID
+		return existing.ID, nil
+	}
+
+	created := models.File{
+		Name:           name,
+		MimeType:       "inode/directory",
+		IsDirectory:    true,
+		ParentID:       &parentID,
+		OwnerID:        r.requester.ID,
+		OrganizationID: r.requester.OrganizationID,
+	}
+	if err := r.x.DB.Create(&created).Error; err != nil {
+		return uuid.Nil, err
+	}
+	r.extraction.FoldersCreated++
+	r.folders[dir] = created.ID
+	return created.ID, nil
+}
+
+// destinationName picks the name an entry is stored under in the folder
+// parentID, or reports that this extraction already stored it before a
+// retry. Names taken by other files get a number, as copies do.
+func (r *extractRun) destinationName(parentID uuid.UUID, name string, size int64) (string, bool, error) {
+	for n := 0; ; n++ {
+		candidate := name
+		if n > 0 {
+			candidate = numberedName(name, n)
+		}
+		var existing []models.File
+		if err := r.x.DB.Select("id", "owner_id", "size", "created_at").
+			Where("parent_id = ? AND name = ? AND is_directory = ?", parentID, candidate, false).
+			Find(&existing).Error; err != nil {
+			return "", false, err
+		}
+		if len(existing) == 0 {
+			return candidate, false, nil
+		}
+		for _, f := range existing {
+			if f.OwnerID == r.requester.ID && !f.CreatedAt.Before(r.extraction.CreatedAt) && f.Size == size {
+				return "", true, nil
+			}
+		}
+	}
+}
+
+// cleanArchivePath turns an entry path into a relative slash-separated
+// path, refusing absolute paths, drive letters, ".." segments, control
+// characters and names too long to store. "./" comes back as ".".
+func cleanArchivePath(p string) (string, bool) {
+	p = strings.ReplaceAll(p, "\\", "/")
+	if p == "" || strings.HasPrefix(p, "/") || (len(p) >= 2 && p[1] == ':') {
+		return "", false
+	}
+	for _, segment := range strings.Split(strings.TrimSuffix(p, "/"), "/") {
+		if segment == ".." || len(segment) > 255 {
+			return "", false
+		}
+	}
+	if strings.IndexFunc(p, unicode.IsControl) >= 0 {
+		return "", false
+	}
+	return path.Clean(p), true
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/storage"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type memoryArchiveStore struct {
+	fakeUploader
+}
+
+type bytesArchive struct {
+	*bytes.Reader
+}
+
+func (bytesArchive) Close() error { return nil }
+
+func (s *memoryArchiveStore) OpenArchive(_ context.Context, key string) (ArchiveObject, error) {
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, storage.ErrObjectNotFound
+	}
+	return bytesArchive{bytes.NewReader(data)}, nil
+}
+
+func TestCleanArchivePath(t *testing.T) {
+	cases := map[string]string{
+		"docs/readme.txt":   "docs/readme.txt",
+		"./docs//a.txt":     "docs/a.txt",
+		"docs/":             "docs",
+		"./":                ".",
+		`docs\win.txt`:      "docs/win.txt",
+		"../evil.txt":       "",
+		"docs/../../x":      "",
+		"/etc/passwd":       "",
+		`C:\Windows\x.dll`:  "",
+		"bad\x00name.txt":   "",
+		"":                  "",
+		`..\..\escape.txt`:  "",
+		"a/b/../c.txt":      "",
+		"caf\u00e9/menu.md": "caf\u00e9/menu.md",
+	}
+	for in, want := range cases {
+		got, ok := cleanArchivePath(in)
+		if want == "" {
+			if ok {
+				t.Errorf("%q: expected it refused, got %q", in, got)
+			}
+		} else if !ok || got != want {
+			t.Errorf("%q: expected %q, got %q (ok=%v)", in, want, got, ok)
+		}
+	}
+}
+
+func TestArchiveExtractor(t *testing.T) {
+	logger.Init()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.File{}, &models.Organization{}, &models.Activity{}, &models.Job{}, &models.ArchiveExtraction{}); err != nil {
+		t.Fatalf("failed automigrating models: %v", err)
+	}
+	ctx := context.Background()
+	store := &memoryArchiveStore{fakeUploader{objects: map[string][]byte{}}}
+	policy := NewUploadPolicy(config.UploadPolicyConfig{BlockedExtensions: []string{".exe"}})
+	jobs := NewJobRunner(db, config.JobsConfig{})
+	extractor := NewArchiveExtractor(db, store, jobs, policy, config.PreviewConfig{ArchiveExtractMaxFiles: 10, ArchiveExtractMaxBytes: 1024})
+
+	user := models.User{Email: "extract@example.com", FirstName: "Ex", LastName: "Tract", PasswordHash: "hash", Role: models.UserRoleUser}
+	db.Create(&user)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range map[string]string{
+		"report/":            "",
+		"report/summary.txt": "all good",
+		"report/data/a.csv":  "a,b\n1,2\n",
+		"../escape.txt":      "should not land anywhere",
+		"/abs.txt":           "nor this",
+		"setup.exe":          "MZ",
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("failed adding %s: %v", name, err)
+		}
+		io.WriteString(w, body)
+	}
+	zw.Close()
+	store.objects["archives/bundle.zip"] = buf.Bytes()
+	archive := models.File{Name: "bundle.zip", OwnerID: user.ID, StoragePath: "archives/bundle.zip", Size: int64(buf.Len()), MimeType: "application/zip"}
+	db.Create(&archive)
+
+	target, err := extractor.CreateFolder(ctx, &archive, nil, &user)
+	if err != nil || target.Name != "bundle" {
+		t.Fatalf("expected a folder named after the archive, got %+v, %v", target, err)
+	}
+	if again, _ := extractor.CreateFolder(ctx, &archive, nil, &user); again.Name != "bundle (1)" {
+		t.Fatalf("expected a numbered folder name, got %q", again.Name)
+	}
+
+	extraction, err := extractor.Start(ctx, &archive, target, user.ID)
+	if err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if ran, err := jobs.RunNext(ctx); !ran || err != nil {
+		t.Fatalf("expected the extract job to run, got %v, %v", ran, err)
+	}
+	extraction, _ = extractor.Get(ctx, extraction.ID)
+	if extraction.Status != models.ArchiveExtractionCompleted {
+		t.Fatalf("expected a completed extraction, got %s: %s", extraction.Status, extraction.LastError)
+	}
+	if extraction.FilesExtracted != 2 || extraction.FoldersCreated != 2 || extraction.FilesFailed != 3 {
+		t.Fatalf("unexpected counters %+v", extraction)
+	}
+	if extraction.EntriesTotal == nil || *extraction.EntriesTotal != 6 || extraction.EntriesDone != 6 {
+		t.Fatalf("expected all six entries handled, got %v/%d", extraction.EntriesTotal, extraction.EntriesDone)
+	}
+	unsafe := 0
+	for _, f := range extraction.Failures {
+		if f.Error == ErrArchiveEntryUnsafe.Error() {
+			unsafe++
+		}
+	}
+	if unsafe != 2 {
+		t.Fatalf("expected both escaping entries refused, got %+v", extraction.Failures)
+	}
+
+	var summary models.File
+	if err := db.Where("name = ? AND owner_id = ?", "summary.txt", user.ID).First(&summary).Error; err != nil {
+		t.Fatalf("expected summary.txt extracted: %v", err)
+	}
+	var report models.File
+	db.First(&report, "id = ?", *summary.ParentID)
+	if report.Name != "report" || report.ParentID == nil || *report.ParentID != target.ID {
+		t.Fatalf("expected summary.txt under bundle/report, got parent %+v", report)
+	}
+	if string(store.objects[summary.StoragePath]) != "all good" || summary.Checksum == nil {
+		t.Fatalf("unexpected stored file %+v", summary)
+	}
+	var escaped int64
+	db.Model(&models.File{}).Where("name IN ?", []string{"escape.txt", "abs.txt", "setup.exe"}).Count(&escaped)
+	if escaped != 0 {
+		t.Fatalf("expected refused entries left out, found %d", escaped)
+	}
+
+	var activity models.Activity
+	if err := db.Where("user_id = ? AND action = ?", user.ID, "file.extract").First(&activity).Error; err != nil {
+		t.Fatalf("expected a completion activity: %v", err)
+	}
+	if activity.MessageKey != "activity.archive.extracted" || activity.MessageParams["count"] != "2" || *activity.ResourceID != target.ID {
+		t.Fatalf("unexpected activity %+v", activity)
+	}
+
+	t.Run("rerun skips files it already made", func(t *testing.T) {
+		extraction.Status = models.ArchiveExtractionPending
+		extraction.EntriesDone = 0
+		extraction.FilesExtracted, extraction.FilesSkipped, extraction.FilesFailed = 0, 0, 0
+		extraction.Failures = nil
+		if err := extractor.Run(ctx, extraction); err != nil {
+			t.Fatalf("run failed: %v", err)
+		}
+		if extraction.FilesExtracted != 0 || extraction.FilesSkipped != 2 {
+			t.Fatalf("expected both files skipped, got %+v", extraction)
+		}
+	})
+
+	t.Run("limits fail the extraction", func(t *testing.T) {
+		small := &ArchiveExtractor{DB: db, Store: store, Jobs: jobs, Policy: policy, MaxBytes: 10}
+		folder, _ := small.CreateFolder(ctx, &archive, nil, &user)
+		extraction := &models.ArchiveExtraction{FileID: archive.ID, TargetFolderID: folder.ID, RequestedByID: user.ID}
+		db.Create(extraction)
+		if err := small.Run(ctx, extraction); err != nil {
+			t.Fatalf("run failed: %v", err)
+		}
+		if extraction.Status != models.ArchiveExtractionFailed || extraction.LastError != ErrArchiveTooLarge.Error() {
+			t.Fatalf("expected ErrArchiveTooLarge, got %s: %s", extraction.Status, extraction.LastError)
+		}
+		var failed models.Activity
+		db.Where("user_id = ? AND message_key = ?", user.ID, "activity.archive.extract_failed").First(&failed)
+		if failed.ID == uuid.Nil {
+			t.Fatalf("expected the requester told of the failure")
+		}
+	})
+
+	t.Run("not an archive", func(t *testing.T) {
+		notes := models.File{Name: "notes.txt", OwnerID: user.ID}
+		if _, err := extractor.Start(ctx, &notes, target, user.ID); !errors.Is(err, ErrArchiveUnsupported) {
+			t.Fatalf("expected ErrArchiveUnsupported, got %v", err)
+		}
+	})
+}
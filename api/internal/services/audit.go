@@ -1,18 +1,18 @@
 package services
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/docshare/api/internal/i18n"
 	"github.com/docshare/api/internal/models"
 	"github.com/docshare/api/internal/storage"
 	"github.com/docshare/api/pkg/logger"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type AuditEntry struct {
@@ -63,6 +63,67 @@ func (s *AuditService) LogAsync(entry AuditEntry) {
 	}
 }
 
+// LogBatch writes entries right away, in one insert, for callers that
+// must know the rows are stored rather than queued. Rows are stamped with
+// the current time so the export cursors, which follow created_at, never
+// skip them.
+func (s *AuditService) LogBatch(ctx context.Context, entries []AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	rows := make([]models.AuditLog, len(entries))
+	for i, entry := range entries {
+		rows[i] = models.AuditLog{
+			UserID:       entry.UserID,
+			Action:       entry.Action,
+			ResourceType: entry.ResourceType,
+			ResourceID:   entry.ResourceID,
+			Details:      entry.Details,
+			IPAddress:    entry.IPAddress,
+			RequestID:    entry.RequestID,
+			CreatedAt:    now,
+		}
+	}
+	if err := s.DB.WithContext(ctx).Create(&rows).Error; err != nil {
+		return err
+	}
+	for _, row := range rows {
+		s.generateActivities(row)
+	}
+	return nil
+}
+
+// Name identifies the audit log as an outbox subscriber.
+func (s *AuditService) Name() string {
+	return "audit"
+}
+
+// HandleEvent writes the audit row for an outbox event. The row carries the
+// event ID under a unique index, so a redelivered event is a no-op and its
+// activities are only generated once.
+func (s *AuditService) HandleEvent(ctx context.Context, event models.OutboxEvent) error {
+	row := models.AuditLog{
+		UserID:       event.ActorID,
+		Action:       event.EventType,
+		ResourceType: event.ResourceType,
+		ResourceID:   event.ResourceID,
+		Details:      event.Payload,
+		IPAddress:    event.IPAddress,
+		RequestID:    event.RequestID,
+		EventID:      &event.ID,
+		CreatedAt:    event.CreatedAt,
+	}
+	result := s.DB.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 1 {
+		s.generateActivities(row)
+	}
+	return nil
+}
+
 func (s *AuditService) processQueue() {
 	for row := range s.queue {
 		if err := s.DB.Create(&row).Error; err != nil {
@@ -87,6 +148,16 @@ func (s *AuditService) generateActivities(log models.AuditLog) {
 		otherActivities = s.activitiesForShareCreate(log)
 	case "share.delete":
 		otherActivities = s.activitiesForShareDelete(log)
+	case "share.invitation_accept":
+		otherActivities = s.activitiesForInvitationAccept(log)
+	case "share.approval_request":
+		otherActivities = s.activitiesForShareApprovalRequest(log)
+	case "share.approval_approve", "share.approval_reject":
+		otherActivities = s.activitiesForShareApprovalDecision(log)
+	case "file.review_request", "file.review_cancel":
+		otherActivities = s.activitiesForReviewers(log)
+	case "file.review_approve", "file.review_reject":
+		otherActivities = s.activitiesForReviewDecision(log)
 	case "file.upload":
 		otherActivities = s.activitiesForFileUpload(log)
 	case "file.delete":
@@ -95,7 +166,10 @@ func (s *AuditService) generateActivities(log models.AuditLog) {
 		otherActivities = s.activitiesForGroupMemberAdd(log)
 	case "group.member_remove":
 		otherActivities = s.activitiesForGroupMemberRemove(log)
+	case "admin.report_action", "admin.report_update", "admin.file_release":
+		otherActivities = s.activitiesForModeration(log)
 	}
+	otherActivities = s.withoutMuted(log, otherActivities)
 
 	for i := range otherActivities {
 		if otherActivities[i].UserID == *log.UserID {
@@ -110,21 +184,110 @@ func (s *AuditService) generateActivities(log models.AuditLog) {
 	}
 
 	selfActivity := s.selfActivityForAction(log)
-	if selfActivity != nil {
+	if selfActivity != nil && len(s.withoutMuted(log, []models.Activity{*selfActivity})) == 1 {
 		if err := s.DB.Create(selfActivity).Error; err != nil {
 			logger.Error("self_activity_insert_failed", err, map[string]interface{}{
 				"action": log.Action,
 			})
 		}
 	}
+
+	if notice := securityNoticeActivity(log); notice != nil {
+		if err := s.DB.Create(notice).Error; err != nil {
+			logger.Error("self_activity_insert_failed", err, map[string]interface{}{
+				"action": log.Action,
+			})
+		}
+	}
+}
+
+// securityNoticeActivity warns users about things happening to their
+// account: running out of recovery codes, or a sign-in from a new device or
+// country.
+func securityNoticeActivity(log models.AuditLog) *models.Activity {
+	if log.UserID == nil {
+		return nil
+	}
+	var key string
+	params := map[string]string{"resource_key": "activity.account"}
+	switch log.Action {
+	case "user.mfa_recovery":
+		if low, _ := log.Details["recovery_low"].(bool); !low {
+			return nil
+		}
+		key = "activity.mfa.recovery_low"
+		params["remaining"] = detailString(log.Details, "remaining_codes")
+	case "auth.new_device":
+		key = "activity.security.new_device"
+		params["device"] = detailString(log.Details, "device")
+		if country := detailString(log.Details, "country"); country != "" {
+			key = "activity.security.new_device_in"
+			params["country"] = country
+		}
+	default:
+		return nil
+	}
+	return newActivity(models.Activity{
+		UserID:        *log.UserID,
+		ActorID:       *log.UserID,
+		Action:        log.Action,
+		ResourceType:  "user",
+		ResourceID:    log.UserID,
+		MessageKey:    key,
+		MessageParams: params,
+	})
+}
+
+// selfActivityTypes lists the actions that produce an activity for the
+// actor, with the resource type it is filed under. The message is the
+// "activity.self.<action>" catalog entry.
+var selfActivityTypes = map[string]string{
+	"file.upload":              "file",
+	"file.download":            "file",
+	"file.delete":              "file",
+	"file.update":              "file",
+	"folder.create":            "file",
+	"share.create":             "file",
+	"share.delete":             "file",
+	"share.update":             "file",
+	"user.login":               "user",
+	"user.register":            "user",
+	"user.password_change":     "user",
+	"user.profile_update":      "user",
+	"group.create":             "group",
+	"group.delete":             "group",
+	"group.member_add":         "group",
+	"group.member_remove":      "group",
+	"admin.user_delete":        "user",
+	"admin.user_update":        "user",
+	"api_token.create":         "api_token",
+	"api_token.revoke":         "api_token",
+	"auth.device_flow_approve": "user",
+	"auth.device_flow_login":   "user",
+}
+
+// selfActivityResourceKeys gives account-level actions, which have no
+// resource name of their own, a translatable one.
+var selfActivityResourceKeys = map[string]string{
+	"user.login":               "activity.account",
+	"user.register":            "activity.account",
+	"user.password_change":     "activity.account",
+	"user.profile_update":      "activity.account",
+	"admin.user_delete":        "activity.admin",
+	"admin.user_update":        "activity.admin",
+	"auth.device_flow_approve": "activity.account",
+	"auth.device_flow_login":   "activity.account",
 }
 
 func (s *AuditService) selfActivityForAction(log models.AuditLog) *models.Activity {
 	if log.UserID == nil {
 		return nil
 	}
+	resourceType, ok := selfActivityTypes[log.Action]
+	if !ok {
+		return nil
+	}
 
-	actorID := *log.UserID
 	resourceName := detailString(log.Details, "file_name")
 	if resourceName == "" {
 		resourceName = detailString(log.Details, "folder_name")
@@ -132,108 +295,206 @@ func (s *AuditService) selfActivityForAction(log models.AuditLog) *models.Activi
 	if resourceName == "" {
 		resourceName = detailString(log.Details, "group_name")
 	}
+	resourceKey := selfActivityResourceKeys[log.Action]
+	if resourceType == "api_token" {
+		resourceName = detailString(log.Details, "name")
+		if resourceName == "" {
+			resourceKey = "activity.api_token"
+		}
+	}
 
-	var message string
-	var resourceType string
+	params := map[string]string{"name": resourceName}
+	if resourceKey != "" {
+		params["resource_key"] = resourceKey
+	}
+	return newActivity(models.Activity{
+		UserID:        *log.UserID,
+		ActorID:       *log.UserID,
+		Action:        log.Action,
+		ResourceType:  resourceType,
+		ResourceID:    log.ResourceID,
+		ResourceName:  resourceName,
+		MessageKey:    "activity.self." + log.Action,
+		MessageParams: params,
+	})
+}
 
-	switch log.Action {
-	case "file.upload":
-		message = fmt.Sprintf("You uploaded \"%s\"", resourceName)
-		resourceType = "file"
-	case "file.download":
-		message = fmt.Sprintf("You downloaded \"%s\"", resourceName)
-		resourceType = "file"
-	case "file.delete":
-		message = fmt.Sprintf("You deleted \"%s\"", resourceName)
-		resourceType = "file"
-	case "file.update":
-		message = fmt.Sprintf("You updated \"%s\"", resourceName)
-		resourceType = "file"
-	case "folder.create":
-		message = fmt.Sprintf("You created folder \"%s\"", resourceName)
-		resourceType = "file"
-	case "share.create":
-		message = fmt.Sprintf("You shared \"%s\"", resourceName)
-		resourceType = "file"
-	case "share.delete":
-		message = fmt.Sprintf("You revoked a share on \"%s\"", resourceName)
-		resourceType = "file"
-	case "share.update":
-		message = fmt.Sprintf("You updated sharing on \"%s\"", resourceName)
-		resourceType = "file"
-	case "user.login":
-		message = "You signed in"
-		resourceType = "user"
-		resourceName = "Account"
-	case "user.register":
-		message = "Welcome to DocShare"
-		resourceType = "user"
-		resourceName = "Account"
-	case "user.password_change":
-		message = "You changed your password"
-		resourceType = "user"
-		resourceName = "Account"
-	case "user.profile_update":
-		message = "You updated your profile"
-		resourceType = "user"
-		resourceName = "Account"
-	case "group.create":
-		message = fmt.Sprintf("You created group \"%s\"", resourceName)
-		resourceType = "group"
-	case "group.delete":
-		message = fmt.Sprintf("You deleted group \"%s\"", resourceName)
-		resourceType = "group"
-	case "group.member_add":
-		message = fmt.Sprintf("You added a member to \"%s\"", resourceName)
-		resourceType = "group"
-	case "group.member_remove":
-		message = fmt.Sprintf("You removed a member from \"%s\"", resourceName)
-		resourceType = "group"
-	case "admin.user_delete":
-		message = "You deleted a user account"
-		resourceType = "user"
-		resourceName = "Admin"
-	case "admin.user_update":
-		message = "You updated a user account"
-		resourceType = "user"
-		resourceName = "Admin"
-	case "api_token.create":
-		tokenName := detailString(log.Details, "name")
-		if tokenName == "" {
-			tokenName = "API token"
-		}
-		message = fmt.Sprintf("You created API token \"%s\"", tokenName)
-		resourceType = "api_token"
-		resourceName = tokenName
-	case "api_token.revoke":
-		tokenName := detailString(log.Details, "name")
-		if tokenName == "" {
-			tokenName = "API token"
+// newActivity fills Message with the English rendering so the stored row
+// stays readable on its own; readers localize it with LocalizeActivity.
+func newActivity(a models.Activity) *models.Activity {
+	LocalizeActivity(&a, i18n.DefaultLocale)
+	return &a
+}
+
+// LocalizeActivity renders a.Message and, for account-level activities,
+// a.ResourceName in locale. The actor's current name is used when Actor
+// is loaded. Rows written before messages were keyed are left as stored.
+func LocalizeActivity(a *models.Activity, locale string) {
+	if a.MessageKey == "" {
+		return
+	}
+	params := make(map[string]string, len(a.MessageParams)+2)
+	for k, v := range a.MessageParams {
+		params[k] = v
+	}
+	if a.Actor.ID != uuid.Nil {
+		if name := strings.TrimSpace(a.Actor.FirstName + " " + a.Actor.LastName); name != "" {
+			params["actor"] = name
 		}
-		message = fmt.Sprintf("You revoked API token \"%s\"", tokenName)
-		resourceType = "api_token"
-		resourceName = tokenName
-	case "auth.device_flow_approve":
-		message = "You approved a device login"
-		resourceType = "user"
-		resourceName = "Account"
-	case "auth.device_flow_login":
-		message = "You signed in via device flow"
-		resourceType = "user"
-		resourceName = "Account"
-	default:
+	}
+	if params["actor"] == "" {
+		params["actor"] = i18n.T(locale, "activity.someone", nil)
+	}
+	if params["group"] == "" {
+		params["group"] = i18n.T(locale, "activity.a_group", nil)
+	}
+	if key := params["resource_key"]; key != "" {
+		a.ResourceName = i18n.T(locale, key, nil)
+		params["name"] = a.ResourceName
+	}
+	a.Message = i18n.T(locale, a.MessageKey, params)
+}
+
+// activitiesForInvitationAccept tells the sharer that the person they
+// invited by email now has an account and can open the file.
+func (s *AuditService) activitiesForInvitationAccept(log models.AuditLog) []models.Activity {
+	sharedByID, err := uuid.Parse(detailString(log.Details, "shared_by_id"))
+	if err != nil || log.ResourceID == nil {
 		return nil
 	}
+	fileName := detailString(log.Details, "file_name")
+	return []models.Activity{*newActivity(models.Activity{
+		UserID:        sharedByID,
+		ActorID:       *log.UserID,
+		Action:        log.Action,
+		ResourceType:  "file",
+		ResourceID:    log.ResourceID,
+		ResourceName:  fileName,
+		MessageKey:    "activity.share.invitation_accepted",
+		MessageParams: map[string]string{"actor": s.getActorName(*log.UserID), "name": fileName},
+	})}
+}
 
-	return &models.Activity{
-		UserID:       actorID,
-		ActorID:      actorID,
-		Action:       log.Action,
-		ResourceType: resourceType,
-		ResourceID:   log.ResourceID,
-		ResourceName: resourceName,
-		Message:      message,
+// activitiesForShareApprovalRequest asks the approver group to look at a
+// share that is waiting for them.
+func (s *AuditService) activitiesForShareApprovalRequest(log models.AuditLog) []models.Activity {
+	groupID, err := uuid.Parse(detailString(log.Details, "approver_group_id"))
+	if err != nil || log.UserID == nil || log.ResourceID == nil {
+		return nil
 	}
+	fileName := detailString(log.Details, "file_name")
+	actorName := s.getActorName(*log.UserID)
+	members := s.getGroupMemberIDs(groupID)
+	result := make([]models.Activity, 0, len(members))
+	for _, memberID := range members {
+		result = append(result, *newActivity(models.Activity{
+			UserID:        memberID,
+			ActorID:       *log.UserID,
+			Action:        log.Action,
+			ResourceType:  "file",
+			ResourceID:    log.ResourceID,
+			ResourceName:  fileName,
+			MessageKey:    "activity.share.approval_requested",
+			MessageParams: map[string]string{"actor": actorName, "name": fileName},
+		}))
+	}
+	return result
+}
+
+// activitiesForShareApprovalDecision tells the requester how their held
+// share was decided.
+func (s *AuditService) activitiesForShareApprovalDecision(log models.AuditLog) []models.Activity {
+	requesterID, err := uuid.Parse(detailString(log.Details, "requested_by_id"))
+	if err != nil || log.UserID == nil || log.ResourceID == nil {
+		return nil
+	}
+	key := "activity.share.approval_approved"
+	if log.Action == "share.approval_reject" {
+		key = "activity.share.approval_rejected"
+	}
+	fileName := detailString(log.Details, "file_name")
+	return []models.Activity{*newActivity(models.Activity{
+		UserID:        requesterID,
+		ActorID:       *log.UserID,
+		Action:        log.Action,
+		ResourceType:  "file",
+		ResourceID:    log.ResourceID,
+		ResourceName:  fileName,
+		MessageKey:    key,
+		MessageParams: map[string]string{"actor": s.getActorName(*log.UserID), "name": fileName},
+	})}
+}
+
+// activitiesForReviewers tells a review's reviewers, and every member of
+// its reviewer groups, that a file was sent to them or withdrawn.
+func (s *AuditService) activitiesForReviewers(log models.AuditLog) []models.Activity {
+	reviewID, err := uuid.Parse(detailString(log.Details, "review_id"))
+	if err != nil || log.UserID == nil || log.ResourceID == nil {
+		return nil
+	}
+	var reviewers []models.FileReviewer
+	s.DB.Where("review_id = ?", reviewID).Find(&reviewers)
+
+	key := "activity.review.requested"
+	if log.Action == "file.review_cancel" {
+		key = "activity.review.cancelled"
+	}
+	fileName := detailString(log.Details, "file_name")
+	actorName := s.getActorName(*log.UserID)
+	seen := map[uuid.UUID]bool{}
+	var result []models.Activity
+	for _, rv := range reviewers {
+		var recipients []uuid.UUID
+		if rv.UserID != nil {
+			recipients = []uuid.UUID{*rv.UserID}
+		} else if rv.GroupID != nil {
+			recipients = s.getGroupMemberIDs(*rv.GroupID)
+		}
+		for _, userID := range recipients {
+			if seen[userID] {
+				continue
+			}
+			seen[userID] = true
+			result = append(result, *newActivity(models.Activity{
+				UserID:        userID,
+				ActorID:       *log.UserID,
+				Action:        log.Action,
+				ResourceType:  "file",
+				ResourceID:    log.ResourceID,
+				ResourceName:  fileName,
+				MessageKey:    key,
+				MessageParams: map[string]string{"actor": actorName, "name": fileName},
+			}))
+		}
+	}
+	return result
+}
+
+// activitiesForReviewDecision tells the requester how a reviewer decided,
+// and whether that closed the review.
+func (s *AuditService) activitiesForReviewDecision(log models.AuditLog) []models.Activity {
+	requesterID, err := uuid.Parse(detailString(log.Details, "requested_by_id"))
+	if err != nil || log.UserID == nil || log.ResourceID == nil {
+		return nil
+	}
+	key := "activity.review.approved_by"
+	switch {
+	case log.Action == "file.review_reject":
+		key = "activity.review.rejected"
+	case detailString(log.Details, "review_status") == string(models.ReviewStatusApproved):
+		key = "activity.review.approved"
+	}
+	fileName := detailString(log.Details, "file_name")
+	return []models.Activity{*newActivity(models.Activity{
+		UserID:        requesterID,
+		ActorID:       *log.UserID,
+		Action:        log.Action,
+		ResourceType:  "file",
+		ResourceID:    log.ResourceID,
+		ResourceName:  fileName,
+		MessageKey:    key,
+		MessageParams: map[string]string{"actor": s.getActorName(*log.UserID), "name": fileName},
+	})}
 }
 
 func (s *AuditService) activitiesForShareCreate(log models.AuditLog) []models.Activity {
@@ -249,15 +510,16 @@ func (s *AuditService) activitiesForShareCreate(log models.AuditLog) []models.Ac
 		if err != nil {
 			return nil
 		}
-		return []models.Activity{{
-			UserID:       uid,
-			ActorID:      *log.UserID,
-			Action:       log.Action,
-			ResourceType: "file",
-			ResourceID:   log.ResourceID,
-			ResourceName: fileName,
-			Message:      fmt.Sprintf("%s shared \"%s\" with you", actorName, fileName),
-		}}
+		return []models.Activity{*newActivity(models.Activity{
+			UserID:        uid,
+			ActorID:       *log.UserID,
+			Action:        log.Action,
+			ResourceType:  "file",
+			ResourceID:    log.ResourceID,
+			ResourceName:  fileName,
+			MessageKey:    "activity.share.with_you",
+			MessageParams: map[string]string{"actor": actorName, "name": fileName},
+		})}
 	}
 
 	if groupIDStr, ok := log.Details["shared_with_group_id"].(string); ok {
@@ -266,21 +528,19 @@ func (s *AuditService) activitiesForShareCreate(log models.AuditLog) []models.Ac
 			return nil
 		}
 		groupName := detailString(log.Details, "group_name")
-		if groupName == "" {
-			groupName = "a group"
-		}
 		members := s.getGroupMemberIDs(gid)
 		result := make([]models.Activity, 0, len(members))
 		for _, memberID := range members {
-			result = append(result, models.Activity{
-				UserID:       memberID,
-				ActorID:      *log.UserID,
-				Action:       log.Action,
-				ResourceType: "file",
-				ResourceID:   log.ResourceID,
-				ResourceName: fileName,
-				Message:      fmt.Sprintf("%s shared \"%s\" with %s", actorName, fileName, groupName),
-			})
+			result = append(result, *newActivity(models.Activity{
+				UserID:        memberID,
+				ActorID:       *log.UserID,
+				Action:        log.Action,
+				ResourceType:  "file",
+				ResourceID:    log.ResourceID,
+				ResourceName:  fileName,
+				MessageKey:    "activity.share.with_group",
+				MessageParams: map[string]string{"actor": actorName, "name": fileName, "group": groupName},
+			}))
 		}
 		return result
 	}
@@ -301,15 +561,16 @@ func (s *AuditService) activitiesForShareDelete(log models.AuditLog) []models.Ac
 		if err != nil {
 			return nil
 		}
-		return []models.Activity{{
-			UserID:       uid,
-			ActorID:      *log.UserID,
-			Action:       log.Action,
-			ResourceType: "file",
-			ResourceID:   log.ResourceID,
-			ResourceName: fileName,
-			Message:      fmt.Sprintf("%s revoked your access to \"%s\"", actorName, fileName),
-		}}
+		return []models.Activity{*newActivity(models.Activity{
+			UserID:        uid,
+			ActorID:       *log.UserID,
+			Action:        log.Action,
+			ResourceType:  "file",
+			ResourceID:    log.ResourceID,
+			ResourceName:  fileName,
+			MessageKey:    "activity.share.revoked",
+			MessageParams: map[string]string{"actor": actorName, "name": fileName},
+		})}
 	}
 
 	return nil
@@ -335,15 +596,16 @@ func (s *AuditService) activitiesForFileUpload(log models.AuditLog) []models.Act
 
 	result := make([]models.Activity, 0, len(recipients))
 	for _, uid := range recipients {
-		result = append(result, models.Activity{
-			UserID:       uid,
-			ActorID:      *log.UserID,
-			Action:       log.Action,
-			ResourceType: "file",
-			ResourceID:   log.ResourceID,
-			ResourceName: fileName,
-			Message:      fmt.Sprintf("%s uploaded \"%s\" to a shared folder", actorName, fileName),
-		})
+		result = append(result, *newActivity(models.Activity{
+			UserID:        uid,
+			ActorID:       *log.UserID,
+			Action:        log.Action,
+			ResourceType:  "file",
+			ResourceID:    log.ResourceID,
+			ResourceName:  fileName,
+			MessageKey:    "activity.file.uploaded_to_shared",
+			MessageParams: map[string]string{"actor": actorName, "name": fileName},
+		}))
 	}
 	return result
 }
@@ -372,48 +634,84 @@ func (s *AuditService) activitiesForFileDelete(log models.AuditLog) []models.Act
 		if err != nil {
 			continue
 		}
-		result = append(result, models.Activity{
-			UserID:       uid,
-			ActorID:      *log.UserID,
-			Action:       log.Action,
-			ResourceType: "file",
-			ResourceID:   log.ResourceID,
-			ResourceName: fileName,
-			Message:      fmt.Sprintf("%s deleted \"%s\"", actorName, fileName),
-		})
+		result = append(result, *newActivity(models.Activity{
+			UserID:        uid,
+			ActorID:       *log.UserID,
+			Action:        log.Action,
+			ResourceType:  "file",
+			ResourceID:    log.ResourceID,
+			ResourceName:  fileName,
+			MessageKey:    "activity.file.deleted",
+			MessageParams: map[string]string{"actor": actorName, "name": fileName},
+		}))
 	}
 	return result
 }
 
-func (s *AuditService) activitiesForGroupMemberAdd(log models.AuditLog) []models.Activity {
-	if log.UserID == nil {
-		return nil
-	}
+// moderationOwnerMessages are what a file owner is told about each
+// moderation action. The reporter is never named.
+var moderationOwnerMessages = map[string]string{
+	string(models.ModerationActionDisableShare):   "activity.moderation.share_disabled",
+	string(models.ModerationActionQuarantineFile): "activity.moderation.file_quarantined",
+	string(models.ModerationActionSuspendOwner):   "activity.moderation.owner_suspended",
+}
 
-	targetIDStr := detailString(log.Details, "target_user_id")
-	if targetIDStr == "" {
+// activitiesForModeration tells the file owner what was done to their
+// content and a signed-in reporter how their report was resolved.
+func (s *AuditService) activitiesForModeration(log models.AuditLog) []models.Activity {
+	if log.ResourceID == nil {
 		return nil
 	}
-	targetID, err := uuid.Parse(targetIDStr)
+	fileID, err := uuid.Parse(detailString(log.Details, "file_id"))
 	if err != nil {
 		return nil
 	}
+	fileName := detailString(log.Details, "file_name")
 
-	groupName := detailString(log.Details, "group_name")
-	actorName := s.getActorName(*log.UserID)
+	var ownerKey, reporterKey string
+	switch log.Action {
+	case "admin.report_action":
+		ownerKey = moderationOwnerMessages[detailString(log.Details, "action")]
+		reporterKey = "activity.moderation.report_actioned"
+	case "admin.report_update":
+		if detailString(log.Details, "status") == string(models.AbuseReportStatusDismissed) {
+			reporterKey = "activity.moderation.report_dismissed"
+		}
+	case "admin.file_release":
+		ownerKey = "activity.moderation.file_released"
+	}
 
-	return []models.Activity{{
-		UserID:       targetID,
-		ActorID:      *log.UserID,
-		Action:       log.Action,
-		ResourceType: "group",
-		ResourceID:   log.ResourceID,
-		ResourceName: groupName,
-		Message:      fmt.Sprintf("%s added you to \"%s\"", actorName, groupName),
-	}}
+	var result []models.Activity
+	notify := func(idStr, key string) {
+		uid, err := uuid.Parse(idStr)
+		if err != nil || key == "" {
+			return
+		}
+		result = append(result, *newActivity(models.Activity{
+			UserID:        uid,
+			ActorID:       *log.UserID,
+			Action:        log.Action,
+			ResourceType:  "file",
+			ResourceID:    &fileID,
+			ResourceName:  fileName,
+			MessageKey:    key,
+			MessageParams: map[string]string{"name": fileName},
+		}))
+	}
+	notify(detailString(log.Details, "owner_id"), ownerKey)
+	notify(detailString(log.Details, "reporter_id"), reporterKey)
+	return result
+}
+
+func (s *AuditService) activitiesForGroupMemberAdd(log models.AuditLog) []models.Activity {
+	return s.groupMembershipActivity(log, "activity.group.added")
 }
 
 func (s *AuditService) activitiesForGroupMemberRemove(log models.AuditLog) []models.Activity {
+	return s.groupMembershipActivity(log, "activity.group.removed")
+}
+
+func (s *AuditService) groupMembershipActivity(log models.AuditLog, messageKey string) []models.Activity {
 	if log.UserID == nil {
 		return nil
 	}
@@ -430,21 +728,22 @@ func (s *AuditService) activitiesForGroupMemberRemove(log models.AuditLog) []mod
 	groupName := detailString(log.Details, "group_name")
 	actorName := s.getActorName(*log.UserID)
 
-	return []models.Activity{{
-		UserID:       targetID,
-		ActorID:      *log.UserID,
-		Action:       log.Action,
-		ResourceType: "group",
-		ResourceID:   log.ResourceID,
-		ResourceName: groupName,
-		Message:      fmt.Sprintf("%s removed you from \"%s\"", actorName, groupName),
-	}}
+	return []models.Activity{*newActivity(models.Activity{
+		UserID:        targetID,
+		ActorID:       *log.UserID,
+		Action:        log.Action,
+		ResourceType:  "group",
+		ResourceID:    log.ResourceID,
+		ResourceName:  groupName,
+		MessageKey:    messageKey,
+		MessageParams: map[string]string{"actor": actorName, "group": groupName},
+	})}
 }
 
 func (s *AuditService) getActorName(userID uuid.UUID) string {
 	var user models.User
 	if err := s.DB.Select("first_name", "last_name").First(&user, "id = ?", userID).Error; err != nil {
-		return "Someone"
+		return ""
 	}
 	return strings.TrimSpace(user.FirstName + " " + user.LastName)
 }
@@ -487,102 +786,85 @@ func (s *AuditService) getShareRecipients(fileID uuid.UUID, excludeUserID uuid.U
 	return result
 }
 
-// StartExporter runs a background goroutine that periodically exports
-// new audit log rows to S3/MinIO as NDJSON files.
-func (s *AuditService) StartExporter(interval time.Duration) {
+// ScheduleExport registers a periodic job that exports new audit log rows
+// to S3/MinIO as NDJSON files.
+func (s *AuditService) ScheduleExport(jobs *JobRunner, interval time.Duration) {
 	if s.Storage == nil {
 		logger.Info("audit_exporter_disabled", map[string]interface{}{
 			"reason": "no storage client configured",
 		})
 		return
 	}
-
-	go func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
-
-		for range ticker.C {
-			s.exportToS3()
-		}
-	}()
-
-	logger.Info("audit_exporter_started", map[string]interface{}{
-		"interval": interval.String(),
+	sink := &s3Sink{bucket: S3MirrorBucket{S3Client: s.Storage}, db: s.DB}
+	jobs.Every("audit.export", interval, func(ctx context.Context, _ *models.Job) error {
+		return s.exportToSink(ctx, sink, s3ExportBatchSize)
 	})
 }
 
-func (s *AuditService) exportToS3() {
+// ScheduleSinks registers a periodic job per SIEM sink. The sinks run
+// independently, so a collector that is down only delays its own feed.
+func (s *AuditService) ScheduleSinks(jobs *JobRunner, sinks []AuditSink, interval time.Duration) {
+	for _, sink := range sinks {
+		sink := sink
+		jobs.Every("audit.sink."+sink.Name(), interval, func(ctx context.Context, _ *models.Job) error {
+			return s.exportToSink(ctx, sink, siemSinkBatchSize)
+		})
+	}
+}
+
+// exportToSink ships audit rows newer than the sink's cursor in batches of
+// batchSize until it has caught up. The cursor only moves after a batch is
+// delivered, so a failed run resends the same rows.
+func (s *AuditService) exportToSink(ctx context.Context, sink AuditSink, batchSize int) error {
+	db := s.DB.WithContext(ctx)
 	var cursor models.AuditExportCursor
-	err := s.DB.First(&cursor).Error
+	err := db.Where("sink = ?", sink.Name()).First(&cursor).Error
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			cursor = models.AuditExportCursor{
-				LastExportAt: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
-			}
-			if createErr := s.DB.Create(&cursor).Error; createErr != nil {
-				logger.Error("audit_export_cursor_create_failed", createErr, nil)
-				return
-			}
-		} else {
-			logger.Error("audit_export_cursor_load_failed", err, nil)
-			return
+		if err != gorm.ErrRecordNotFound {
+			return fmt.Errorf("failed loading export cursor: %w", err)
+		}
+		cursor = models.AuditExportCursor{
+			Sink:         sink.Name(),
+			LastExportAt: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+		if err := db.Create(&cursor).Error; err != nil {
+			return fmt.Errorf("failed creating export cursor: %w", err)
 		}
 	}
 
-	var logs []models.AuditLog
-	if err := s.DB.Where("created_at > ?", cursor.LastExportAt).
-		Order("created_at ASC").
-		Limit(10000).
-		Find(&logs).Error; err != nil {
-		logger.Error("audit_export_query_failed", err, nil)
-		return
-	}
+	for {
+		var logs []models.AuditLog
+		if err := db.Where("created_at > ?", cursor.LastExportAt).
+			Order("created_at ASC").
+			Limit(batchSize).
+			Find(&logs).Error; err != nil {
+			return fmt.Errorf("failed loading audit logs: %w", err)
+		}
+		if len(logs) == 0 {
+			return nil
+		}
 
-	if len(logs) == 0 {
-		return
-	}
+		if err := sink.Send(ctx, logs); err != nil {
+			return fmt.Errorf("%s: %w", sink.Name(), err)
+		}
 
-	var buf bytes.Buffer
-	enc := json.NewEncoder(&buf)
-	for _, log := range logs {
-		if err := enc.Encode(log); err != nil {
-			logger.Error("audit_export_encode_failed", err, map[string]interface{}{
-				"log_id": log.ID.String(),
-			})
-			continue
+		cursor.LastExportAt = logs[len(logs)-1].CreatedAt
+		if err := db.Model(&cursor).Updates(map[string]interface{}{
+			"last_export_at": cursor.LastExportAt,
+			"exported_count": gorm.Expr("exported_count + ?", len(logs)),
+		}).Error; err != nil {
+			return fmt.Errorf("failed advancing export cursor: %w", err)
 		}
-	}
 
-	now := time.Now().UTC()
-	objectName := fmt.Sprintf("audit-logs/%s/%s.ndjson",
-		now.Format("2006/01/02"),
-		now.Format("15-04-05"),
-	)
-
-	if err := s.Storage.Upload(
-		context.Background(),
-		objectName,
-		&buf,
-		int64(buf.Len()),
-		"application/x-ndjson",
-	); err != nil {
-		logger.Error("audit_export_upload_failed", err, map[string]interface{}{
-			"object_name": objectName,
-			"count":       len(logs),
+		logger.Info("audit_export_success", map[string]interface{}{
+			"sink":  sink.Name(),
+			"count": len(logs),
 		})
-		return
-	}
-
-	lastCreatedAt := logs[len(logs)-1].CreatedAt
-	s.DB.Model(&cursor).Updates(map[string]interface{}{
-		"last_export_at": lastCreatedAt,
-		"exported_count": gorm.Expr("exported_count + ?", len(logs)),
-	})
 
-	logger.Info("audit_export_success", map[string]interface{}{
-		"object_name": objectName,
-		"count":       len(logs),
-	})
+		if len(logs) < batchSize {
+			return nil
+		}
+	}
 }
 
 func detailString(details map[string]interface{}, key string) string {
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/storage"
+	"github.com/docshare/api/pkg/logger"
+	"gorm.io/gorm"
+)
+
+const (
+	auditRetentionJob      = "audit.retention"
+	auditRetentionInterval = 6 * time.Hour
+	// auditRetentionBatchSize caps the rows removed by one DELETE, so a
+	// large backlog never holds a long lock on the audit table.
+	auditRetentionBatchSize = 5000
+)
+
+// AuditRetention purges audit rows older than the configured retention.
+// Rows are removed in chunks from the oldest up. When the export must be
+// verified first, a row is only purged once the NDJSON object holding it
+// has been found in storage at its recorded size, and every row up to it
+// is known to be in some export; the first gap stops the purge there and
+// is reported as the run's blocked reason.
+type AuditRetention struct {
+	DB            *gorm.DB
+	Bucket        MirrorBucket
+	Retention     time.Duration
+	RequireExport bool
+}
+
+func NewAuditRetention(db *gorm.DB, bucket MirrorBucket, cfg config.AuditConfig) *AuditRetention {
+	return &AuditRetention{DB: db, Bucket: bucket, Retention: cfg.Retention, RequireExport: cfg.RetentionRequireExport}
+}
+
+// Enabled reports whether audit rows expire at all.
+func (r *AuditRetention) Enabled() bool {
+	return r.Retention > 0
+}
+
+// Schedule registers the periodic retention job when retention is on.
+func (r *AuditRetention) Schedule(jobs *JobRunner) {
+	if !r.Enabled() {
+		return
+	}
+	jobs.Every(auditRetentionJob, auditRetentionInterval, func(ctx context.Context, _ *models.Job) error {
+		_, err := r.Run(ctx)
+		return err
+	})
+}
+
+// Run purges what the retention allows and records the pass.
+func (r *AuditRetention) Run(ctx context.Context) (*models.AuditRetentionRun, error) {
+	db := r.DB.WithContext(ctx)
+	now := time.Now().UTC()
+	run := models.AuditRetentionRun{Cutoff: now.Add(-r.Retention), StartedAt: now}
+	if err := db.Create(&run).Error; err != nil {
+		return nil, err
+	}
+
+	through, reason, err := r.verifiedThrough(ctx, run.Cutoff)
+	if err != nil {
+		return nil, err
+	}
+	run.BlockedReason = reason
+	if through != nil || !r.RequireExport {
+		run.PurgedThrough = through
+		if run.Purged, err = r.purge(ctx, run.Cutoff, through); err != nil {
+			return nil, err
+		}
+	}
+
+	finished := time.Now().UTC()
+	run.FinishedAt = &finished
+	if err := db.Model(&run).Updates(map[string]interface{}{
+		"purged_through": run.PurgedThrough,
+		"purged":         run.Purged,
+		"blocked_reason": run.BlockedReason,
+		"finished_at":    run.FinishedAt,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{
+		"cutoff": run.Cutoff,
+		"purged": run.Purged,
+	}
+	if run.BlockedReason != "" {
+		fields["blocked_reason"] = run.BlockedReason
+		logger.Warn("audit_retention_blocked", fields)
+	} else {
+		logger.Info("audit_retention_completed", fields)
+	}
+	return &run, nil
+}
+
+// verifiedThrough returns the newest row time whose export has been
+// checked, and why the rows after it up to cutoff cannot be purged yet.
+// Without RequireExport nothing is checked and the limit is nil.
+func (r *AuditRetention) verifiedThrough(ctx context.Context, cutoff time.Time) (*time.Time, string, error) {
+	if !r.RequireExport {
+		return nil, "", nil
+	}
+	if r.Bucket == nil {
+		return nil, "no storage is configured to verify the audit export against", nil
+	}
+	db := r.DB.WithContext(ctx)
+
+	var oldest []models.AuditLog
+	if err := db.Select("created_at").Order("created_at ASC").Limit(1).Find(&oldest).Error; err != nil {
+		return nil, "", err
+	}
+	if len(oldest) == 0 || !oldest[0].CreatedAt.Before(cutoff) {
+		return nil, "", nil
+	}
+
+	var objects []models.AuditExportObject
+	if err := db.Where("last_at >= ? AND first_at < ?", oldest[0].CreatedAt, cutoff).
+		Order("first_at ASC").Find(&objects).Error; err != nil {
+		return nil, "", err
+	}
+	if len(objects) == 0 || objects[0].FirstAt.After(oldest[0].CreatedAt) {
+		return nil, fmt.Sprintf("rows from %s have no recorded export", oldest[0].CreatedAt.UTC().Format(time.RFC3339)), nil
+	}
+
+	var through *time.Time
+	for i := range objects {
+		obj := &objects[i]
+		if through != nil {
+			var gap int64
+			if err := db.Model(&models.AuditLog{}).
+				Where("created_at > ? AND created_at < ?", *through, obj.FirstAt).
+				Count(&gap).Error; err != nil {
+				return nil, "", err
+			}
+			if gap > 0 {
+				return through, fmt.Sprintf("%d rows after %s are in no export", gap, through.UTC().Format(time.RFC3339)), nil
+			}
+		}
+		info, err := r.Bucket.Stat(ctx, obj.Key)
+		if err != nil {
+			if errors.Is(err, storage.ErrObjectNotFound) {
+				return through, fmt.Sprintf("export %s is missing from storage", obj.Key), nil
+			}
+			return nil, "", err
+		}
+		if info.Size != obj.Size {
+			return through, fmt.Sprintf("export %s is %d bytes, expected %d", obj.Key, info.Size, obj.Size), nil
+		}
+		lastAt := obj.LastAt
+		through = &lastAt
+	}
+
+	var pending int64
+	if err := db.Model(&models.AuditLog{}).
+		Where("created_at > ? AND created_at < ?", *through, cutoff).
+		Count(&pending).Error; err != nil {
+		return nil, "", err
+	}
+	if pending > 0 {
+		return through, fmt.Sprintf("%d rows before the cutoff have not been exported yet", pending), nil
+	}
+	return through, "", nil
+}
+
+// purge deletes rows older than cutoff, and no newer than through when
+// it is set, in chunks of auditRetentionBatchSize.
+func (r *AuditRetention) purge(ctx context.Context, cutoff time.Time, through *time.Time) (int64, error) {
+	db := r.DB.WithContext(ctx)
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		batch := db.Model(&models.AuditLog{}).Select("id").Where("created_at < ?", cutoff)
+		if through != nil {
+			batch = batch.Where("created_at <= ?", *through)
+		}
+		result := db.Where("id IN (?)", batch.Order("created_at ASC").Limit(auditRetentionBatchSize)).
+			Delete(&models.AuditLog{})
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < auditRetentionBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// AuditRetentionStatus shows admins what the retention keeps and where it
+// stands. PastRetention counts rows older than the cutoff that are still
+// stored; ExportedThrough is where the S3 export has reached.
+type AuditRetentionStatus struct {
+	Enabled          bool                      `json:"enabled"`
+	RetentionSeconds int64                     `json:"retentionSeconds"`
+	RequireExport    bool                      `json:"requireExport"`
+	Cutoff           *time.Time                `json:"cutoff,omitempty"`
+	Rows             int64                     `json:"rows"`
+	OldestAt         *time.Time                `json:"oldestAt,omitempty"`
+	PastRetention    int64                     `json:"pastRetention"`
+	ExportedThrough  *time.Time                `json:"exportedThrough,omitempty"`
+	LastRun          *models.AuditRetentionRun `json:"lastRun,omitempty"`
+}
+
+// Status gathers the retention settings, row counts and the latest run.
+func (r *AuditRetention) Status(ctx context.Context) (*AuditRetentionStatus, error) {
+	db := r.DB.WithContext(ctx)
+	status := &AuditRetentionStatus{
+		Enabled:          r.Enabled(),
+		RetentionSeconds: int64(r.Retention / time.Second),
+		RequireExport:    r.RequireExport,
+	}
+	if err := db.Model(&models.AuditLog{}).Count(&status.Rows).Error; err != nil {
+		return nil, err
+	}
+	var oldest []models.AuditLog
+	if err := db.Select("created_at").Order("created_at ASC").Limit(1).Find(&oldest).Error; err != nil {
+		return nil, err
+	}
+	if len(oldest) > 0 {
+		at := oldest[0].CreatedAt.UTC()
+		status.OldestAt = &at
+	}
+	if r.Enabled() {
+		cutoff := time.Now().UTC().Add(-r.Retention)
+		status.Cutoff = &cutoff
+		if err := db.Model(&models.AuditLog{}).Where("created_at < ?", cutoff).Count(&status.PastRetention).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var cursors []models.AuditExportCursor
+	if err := db.Where("sink = ?", "s3").Limit(1).Find(&cursors).Error; err != nil {
+		return nil, err
+	}
+	if len(cursors) > 0 {
+		status.ExportedThrough = &cursors[0].LastExportAt
+	}
+	var runs []models.AuditRetentionRun
+	if err := db.Order("started_at DESC").Limit(1).Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	if len(runs) > 0 {
+		status.LastRun = &runs[0]
+	}
+	return status, nil
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+)
+
+func TestAuditRetention(t *testing.T) {
+	logger.Init()
+	db := setupAuditTestDB(t)
+	service := &AuditService{DB: db}
+	ctx := context.Background()
+	old := time.Now().UTC().AddDate(-3, 0, 0)
+	seedAuditLogs(t, service, old, "file.upload", "file.download", "share.create", "file.delete")
+	seedAuditLogs(t, service, time.Now().UTC().Add(-time.Hour), "file.upload")
+
+	bucket := newMemoryBucket()
+	retention := NewAuditRetention(db, bucket, config.AuditConfig{Retention: 2 * 365 * 24 * time.Hour, RetentionRequireExport: true})
+	remaining := func() int64 {
+		var count int64
+		db.Model(&models.AuditLog{}).Count(&count)
+		return count
+	}
+
+	t.Run("nothing is purged before it is exported", func(t *testing.T) {
+		run, err := retention.Run(ctx)
+		if err != nil {
+			t.Fatalf("run failed: %v", err)
+		}
+		if run.Purged != 0 || !strings.Contains(run.BlockedReason, "no recorded export") || remaining() != 5 {
+			t.Fatalf("expected the purge to be blocked, got %+v", run)
+		}
+	})
+
+	sink := &s3Sink{bucket: bucket, db: db}
+	if err := service.exportToSink(ctx, sink, 2); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	var objects []models.AuditExportObject
+	db.Order("first_at ASC").Find(&objects)
+	if len(objects) != 3 || objects[0].Count != 2 {
+		t.Fatalf("expected three recorded export objects, got %+v", objects)
+	}
+
+	t.Run("a missing export stops the purge at the gap", func(t *testing.T) {
+		missing := bucket.objects[objects[1].Key]
+		_ = bucket.Delete(ctx, objects[1].Key)
+		run, err := retention.Run(ctx)
+		if err != nil {
+			t.Fatalf("run failed: %v", err)
+		}
+		if run.Purged != 2 || !strings.Contains(run.BlockedReason, "missing") || remaining() != 3 {
+			t.Fatalf("expected the first export's rows only, got %+v", run)
+		}
+		bucket.put(objects[1].Key, string(missing))
+	})
+
+	t.Run("verified rows past the cutoff are purged", func(t *testing.T) {
+		run, err := retention.Run(ctx)
+		if err != nil {
+			t.Fatalf("run failed: %v", err)
+		}
+		if run.Purged != 2 || run.BlockedReason != "" || remaining() != 1 {
+			t.Fatalf("expected the remaining old rows purged, got %+v", run)
+		}
+
+		status, err := retention.Status(ctx)
+		if err != nil {
+			t.Fatalf("status failed: %v", err)
+		}
+		if !status.Enabled || status.Rows != 1 || status.PastRetention != 0 || status.ExportedThrough == nil || status.LastRun == nil || status.LastRun.ID != run.ID {
+			t.Fatalf("unexpected status %+v", status)
+		}
+	})
+
+	t.Run("verification can be turned off", func(t *testing.T) {
+		seedAuditLogs(t, service, old, "file.upload")
+		unchecked := NewAuditRetention(db, nil, config.AuditConfig{Retention: 2 * 365 * 24 * time.Hour})
+		run, err := unchecked.Run(ctx)
+		if err != nil {
+			t.Fatalf("run failed: %v", err)
+		}
+		if run.Purged != 1 || remaining() != 1 {
+			t.Fatalf("expected the unexported row purged, got %+v", run)
+		}
+	})
+}
@@ -0,0 +1,344 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// s3ExportBatchSize caps the rows written to a single NDJSON object.
+	s3ExportBatchSize = 10000
+	// siemSinkBatchSize caps the rows pushed to a SIEM sink in one request.
+	siemSinkBatchSize = 500
+
+	auditSinkTimeout = 30 * time.Second
+)
+
+// AuditSink delivers audit rows to an external system. Send is called with
+// rows in creation order and must either deliver all of them or return an
+// error, in which case the same rows are offered again on the next run.
+type AuditSink interface {
+	Name() string
+	Send(ctx context.Context, logs []models.AuditLog) error
+}
+
+// NewAuditSinks builds the SIEM sinks enabled in cfg. Any number of them
+// can be active at once; each keeps its own export cursor.
+func NewAuditSinks(cfg config.AuditConfig) ([]AuditSink, error) {
+	var sinks []AuditSink
+
+	if cfg.Syslog.Addr != "" {
+		sink, err := newSyslogSink(cfg.Syslog)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if cfg.Webhook.URL != "" {
+		if err := validateSinkURL(cfg.Webhook.URL); err != nil {
+			return nil, fmt.Errorf("AUDIT_WEBHOOK_URL: %w", err)
+		}
+		if cfg.Webhook.Secret == "" {
+			return nil, fmt.Errorf("AUDIT_WEBHOOK_SECRET is required when AUDIT_WEBHOOK_URL is set")
+		}
+		sinks = append(sinks, &webhookSink{
+			url:    cfg.Webhook.URL,
+			secret: []byte(cfg.Webhook.Secret),
+			client: &http.Client{Timeout: auditSinkTimeout},
+		})
+	}
+
+	if cfg.Splunk.URL != "" {
+		if err := validateSinkURL(cfg.Splunk.URL); err != nil {
+			return nil, fmt.Errorf("AUDIT_SPLUNK_HEC_URL: %w", err)
+		}
+		if cfg.Splunk.Token == "" {
+			return nil, fmt.Errorf("AUDIT_SPLUNK_HEC_TOKEN is required when AUDIT_SPLUNK_HEC_URL is set")
+		}
+		sinks = append(sinks, &splunkSink{
+			url:    strings.TrimRight(cfg.Splunk.URL, "/") + "/services/collector/event",
+			token:  cfg.Splunk.Token,
+			index:  cfg.Splunk.Index,
+			host:   auditHostname(),
+			client: &http.Client{Timeout: auditSinkTimeout},
+		})
+	}
+
+	return sinks, nil
+}
+
+func validateSinkURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("must be an http(s) URL")
+	}
+	return nil
+}
+
+func auditHostname() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "-"
+	}
+	return host
+}
+
+// s3Sink writes each batch as an NDJSON object under audit-logs/ and
+// records the object, so retention can check it before purging its rows.
+type s3Sink struct {
+	bucket MirrorBucket
+	db     *gorm.DB
+}
+
+func (s *s3Sink) Name() string { return "s3" }
+
+func (s *s3Sink) Send(ctx context.Context, logs []models.AuditLog) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, log := range logs {
+		if err := enc.Encode(log); err != nil {
+			return fmt.Errorf("failed encoding audit log %s: %w", log.ID, err)
+		}
+	}
+
+	now := time.Now().UTC()
+	objectName := fmt.Sprintf("audit-logs/%s/%s.ndjson",
+		now.Format("2006/01/02"),
+		now.Format("15-04-05.000000000"),
+	)
+	size := int64(buf.Len())
+	if err := s.bucket.Upload(ctx, objectName, &buf, size, "application/x-ndjson"); err != nil {
+		return fmt.Errorf("failed uploading %s: %w", objectName, err)
+	}
+	if err := s.db.WithContext(ctx).Create(&models.AuditExportObject{
+		Key:     objectName,
+		FirstAt: logs[0].CreatedAt,
+		LastAt:  logs[len(logs)-1].CreatedAt,
+		Count:   len(logs),
+		Size:    size,
+	}).Error; err != nil {
+		return fmt.Errorf("failed recording %s: %w", objectName, err)
+	}
+	return nil
+}
+
+// syslogSink sends RFC 5424 messages over TLS using the octet-counting
+// framing from RFC 5425. A connection is opened per batch; at the sink
+// interval that is cheap and avoids detecting half-dead idle connections.
+type syslogSink struct {
+	addr      string
+	tlsConfig *tls.Config
+	host      string
+}
+
+// Facility 13 (log audit), severity 6 (informational).
+const syslogPriority = 13*8 + 6
+
+func newSyslogSink(cfg config.AuditSyslogConfig) (*syslogSink, error) {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("AUDIT_SYSLOG_ADDR: %w", err)
+	}
+	tlsConfig := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("AUDIT_SYSLOG_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("AUDIT_SYSLOG_CA_FILE: no certificates found")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return &syslogSink{addr: cfg.Addr, tlsConfig: tlsConfig, host: auditHostname()}, nil
+}
+
+func (s *syslogSink) Name() string { return "syslog" }
+
+func (s *syslogSink) Send(ctx context.Context, logs []models.AuditLog) error {
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: auditSinkTimeout}, Config: s.tlsConfig}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed connecting to syslog collector: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(auditSinkTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetWriteDeadline(deadline)
+
+	var buf bytes.Buffer
+	for _, log := range logs {
+		msg, err := s.format(log)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(strconv.Itoa(len(msg)))
+		buf.WriteByte(' ')
+		buf.Write(msg)
+	}
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed writing to syslog collector: %w", err)
+	}
+	return nil
+}
+
+// format renders one row as
+// <PRI>1 TIMESTAMP HOSTNAME docshare - MSGID - JSON
+// with the audit action as MSGID and the full row as the message.
+func (s *syslogSink) format(log models.AuditLog) ([]byte, error) {
+	body, err := json.Marshal(log)
+	if err != nil {
+		return nil, fmt.Errorf("failed encoding audit log %s: %w", log.ID, err)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "<%d>1 %s %s docshare - %s - ",
+		syslogPriority,
+		log.CreatedAt.UTC().Format(time.RFC3339Nano),
+		syslogField(s.host, 255),
+		syslogField(log.Action, 32),
+	)
+	msg.Write(body)
+	return msg.Bytes(), nil
+}
+
+// syslogField makes value a valid RFC 5424 header field: printable ASCII
+// without spaces, at most max characters, and "-" when empty.
+func syslogField(value string, max int) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(cleaned) > max {
+		cleaned = cleaned[:max]
+	}
+	if cleaned == "" {
+		return "-"
+	}
+	return cleaned
+}
+
+// webhookSink POSTs each batch as a JSON array. Receivers verify the
+// X-DocShare-Signature header, an HMAC-SHA256 over "<timestamp>.<body>"
+// keyed by the shared secret, and reject stale X-DocShare-Timestamp values
+// to stop replays.
+type webhookSink struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+func (s *webhookSink) Name() string { return "webhook" }
+
+func (s *webhookSink) Send(ctx context.Context, logs []models.AuditLog) error {
+	body, err := json.Marshal(logs)
+	if err != nil {
+		return fmt.Errorf("failed encoding audit logs: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-DocShare-Timestamp", timestamp)
+	req.Header.Set("X-DocShare-Signature", "sha256="+signAuditWebhook(s.secret, timestamp, body))
+	return doSinkRequest(s.client, req)
+}
+
+func signAuditWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// splunkSink sends rows to a Splunk HTTP Event Collector, one event per
+// row, batched into a single request.
+type splunkSink struct {
+	url    string
+	token  string
+	index  string
+	host   string
+	client *http.Client
+}
+
+type splunkEvent struct {
+	Time       float64         `json:"time"`
+	Host       string          `json:"host"`
+	Source     string          `json:"source"`
+	SourceType string          `json:"sourcetype"`
+	Index      string          `json:"index,omitempty"`
+	Event      models.AuditLog `json:"event"`
+}
+
+func (s *splunkSink) Name() string { return "splunk" }
+
+func (s *splunkSink) Send(ctx context.Context, logs []models.AuditLog) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, log := range logs {
+		if err := enc.Encode(splunkEvent{
+			Time:       float64(log.CreatedAt.UnixNano()) / float64(time.Second),
+			Host:       s.host,
+			Source:     "docshare",
+			SourceType: "docshare:audit",
+			Index:      s.index,
+			Event:      log,
+		}); err != nil {
+			return fmt.Errorf("failed encoding audit log %s: %w", log.ID, err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Splunk "+s.token)
+	return doSinkRequest(s.client, req)
+}
+
+func doSinkRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed posting to %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s responded %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(snippet)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+)
+
+type fakeAuditSink struct {
+	name    string
+	err     error
+	batches [][]models.AuditLog
+}
+
+func (s *fakeAuditSink) Name() string { return s.name }
+
+func (s *fakeAuditSink) Send(_ context.Context, logs []models.AuditLog) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.batches = append(s.batches, logs)
+	return nil
+}
+
+func seedAuditLogs(t *testing.T, service *AuditService, base time.Time, actions ...string) {
+	t.Helper()
+	for i, action := range actions {
+		row := models.AuditLog{Action: action, ResourceType: "file", IPAddress: "127.0.0.1", CreatedAt: base.Add(time.Duration(i) * time.Second)}
+		if err := service.DB.Create(&row).Error; err != nil {
+			t.Fatalf("failed creating audit log: %v", err)
+		}
+	}
+}
+
+func TestExportToSink_KeepsACursorPerSink(t *testing.T) {
+	db := setupAuditTestDB(t)
+	service := &AuditService{DB: db}
+	ctx := context.Background()
+	seedAuditLogs(t, service, time.Now().UTC().Add(-time.Hour), "file.upload", "file.download", "share.create")
+
+	splunk := &fakeAuditSink{name: "splunk"}
+	if err := service.exportToSink(ctx, splunk, 2); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	if len(splunk.batches) != 2 || len(splunk.batches[0]) != 2 || len(splunk.batches[1]) != 1 {
+		t.Fatalf("expected the backlog drained in batches of 2, got %v", splunk.batches)
+	}
+
+	down := &fakeAuditSink{name: "syslog", err: errors.New("connection refused")}
+	if err := service.exportToSink(ctx, down, 2); err == nil {
+		t.Fatal("expected the failed delivery to be reported")
+	}
+
+	seedAuditLogs(t, service, time.Now().UTC(), "file.delete")
+	if err := service.exportToSink(ctx, splunk, 2); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	if len(splunk.batches) != 3 || splunk.batches[2][0].Action != "file.delete" {
+		t.Fatalf("expected only the new row to be sent, got %v", splunk.batches)
+	}
+
+	down.err = nil
+	if err := service.exportToSink(ctx, down, 10); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	if len(down.batches) != 1 || len(down.batches[0]) != 4 {
+		t.Fatalf("expected the recovered sink to resend everything, got %v", down.batches)
+	}
+
+	var cursors []models.AuditExportCursor
+	db.Order("sink").Find(&cursors)
+	if len(cursors) != 2 || cursors[0].ExportedCount != 4 || cursors[1].ExportedCount != 4 {
+		t.Fatalf("expected a cursor per sink with 4 rows each, got %+v", cursors)
+	}
+}
+
+func TestNewAuditSinks(t *testing.T) {
+	sinks, err := NewAuditSinks(config.AuditConfig{})
+	if err != nil || len(sinks) != 0 {
+		t.Fatalf("expected no sinks by default, got %v, %v", sinks, err)
+	}
+
+	sinks, err = NewAuditSinks(config.AuditConfig{
+		Syslog:  config.AuditSyslogConfig{Addr: "siem.example.com:6514"},
+		Webhook: config.AuditWebhookConfig{URL: "https://siem.example.com/ingest", Secret: "s3cret"},
+		Splunk:  config.AuditSplunkConfig{URL: "https://splunk.example.com:8088/", Token: "token"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, sink := range sinks {
+		names = append(names, sink.Name())
+	}
+	if strings.Join(names, ",") != "syslog,webhook,splunk" {
+		t.Fatalf("expected all three sinks, got %v", names)
+	}
+
+	invalid := []config.AuditConfig{
+		{Syslog: config.AuditSyslogConfig{Addr: "siem.example.com"}},
+		{Syslog: config.AuditSyslogConfig{Addr: "siem.example.com:6514", CAFile: "/nonexistent/ca.pem"}},
+		{Webhook: config.AuditWebhookConfig{URL: "https://siem.example.com/ingest"}},
+		{Webhook: config.AuditWebhookConfig{URL: "siem.example.com", Secret: "s3cret"}},
+		{Splunk: config.AuditSplunkConfig{URL: "https://splunk.example.com:8088"}},
+	}
+	for _, cfg := range invalid {
+		if _, err := NewAuditSinks(cfg); err == nil {
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+}
+
+func TestWebhookSink_SignsTheBody(t *testing.T) {
+	var gotBody []byte
+	var gotHeaders http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotHeaders = r.Header
+	}))
+	defer srv.Close()
+
+	sinks, err := NewAuditSinks(config.AuditConfig{Webhook: config.AuditWebhookConfig{URL: srv.URL, Secret: "s3cret"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	logs := []models.AuditLog{{Action: "file.upload", CreatedAt: time.Now().UTC()}}
+	if err := sinks[0].Send(context.Background(), logs); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	ts := gotHeaders.Get("X-DocShare-Timestamp")
+	want := "sha256=" + signAuditWebhook([]byte("s3cret"), ts, gotBody)
+	if ts == "" || gotHeaders.Get("X-DocShare-Signature") != want {
+		t.Fatalf("expected a valid signature, got %q", gotHeaders.Get("X-DocShare-Signature"))
+	}
+	var decoded []models.AuditLog
+	if err := json.Unmarshal(gotBody, &decoded); err != nil || len(decoded) != 1 || decoded[0].Action != "file.upload" {
+		t.Fatalf("expected the batch as a JSON array, got %s", gotBody)
+	}
+}
+
+func TestSplunkSink_PostsToTheCollector(t *testing.T) {
+	var gotPath, gotAuth string
+	var events []splunkEvent
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		dec := json.NewDecoder(r.Body)
+		for {
+			var ev splunkEvent
+			if err := dec.Decode(&ev); err != nil {
+				break
+			}
+			events = append(events, ev)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	sinks, err := NewAuditSinks(config.AuditConfig{Splunk: config.AuditSplunkConfig{URL: srv.URL, Token: "hec-token", Index: "security"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	logs := []models.AuditLog{
+		{Action: "file.upload", CreatedAt: time.Now().UTC()},
+		{Action: "share.create", CreatedAt: time.Now().UTC()},
+	}
+	if err := sinks[0].Send(context.Background(), logs); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if gotPath != "/services/collector/event" || gotAuth != "Splunk hec-token" {
+		t.Fatalf("unexpected request %s with %q", gotPath, gotAuth)
+	}
+	if len(events) != 2 || events[1].Event.Action != "share.create" || events[0].Index != "security" || events[0].SourceType != "docshare:audit" {
+		t.Fatalf("expected one event per row, got %+v", events)
+	}
+
+	status = http.StatusForbidden
+	if err := sinks[0].Send(context.Background(), logs); err == nil {
+		t.Fatal("expected a rejected batch to fail")
+	}
+}
+
+func TestSyslogSink_SendsFramedMessagesOverTLS(t *testing.T) {
+	// Borrow the test server's certificate for a raw TLS listener.
+	certSrv := httptest.NewTLSServer(http.NotFoundHandler())
+	serverTLS := certSrv.TLS.Clone()
+	roots := x509.NewCertPool()
+	roots.AddCert(certSrv.Certificate())
+	certSrv.Close()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverTLS)
+	if err != nil {
+		t.Fatalf("failed listening: %v", err)
+	}
+	defer ln.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		var msgs []string
+		for {
+			length, err := r.ReadString(' ')
+			if err != nil {
+				break
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(length))
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				break
+			}
+			msgs = append(msgs, string(msg))
+		}
+		received <- msgs
+	}()
+
+	host, _, _ := net.SplitHostPort(ln.Addr().String())
+	sink := &syslogSink{
+		addr:      ln.Addr().String(),
+		tlsConfig: &tls.Config{ServerName: host, RootCAs: roots},
+		host:      "docshare-api-0",
+	}
+	logs := []models.AuditLog{
+		{Action: "file.upload", CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{Action: "user login", CreatedAt: time.Date(2026, 1, 2, 3, 4, 6, 0, time.UTC)},
+	}
+	if err := sink.Send(context.Background(), logs); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	msgs := <-received
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 framed messages, got %q", msgs)
+	}
+	if !strings.HasPrefix(msgs[0], "<110>1 2026-01-02T03:04:05Z docshare-api-0 docshare - file.upload - {") {
+		t.Fatalf("unexpected RFC 5424 header: %q", msgs[0])
+	}
+	if !strings.Contains(msgs[1], " user_login - ") {
+		t.Fatalf("expected the MSGID to be sanitized, got %q", msgs[1])
+	}
+}
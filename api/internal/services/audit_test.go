@@ -1,6 +1,7 @@
 package services
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -32,7 +33,11 @@ func setupAuditTestDB(t *testing.T) *gorm.DB {
 		&models.Share{},
 		&models.AuditLog{},
 		&models.Activity{},
+		&models.ActivityMute{},
+		&models.NotificationPreference{},
 		&models.AuditExportCursor{},
+		&models.AuditExportObject{},
+		&models.AuditRetentionRun{},
 	)
 	if err != nil {
 		t.Fatalf("failed automigrating: %v", err)
@@ -169,6 +174,39 @@ func TestAuditService_SelfActivity(t *testing.T) {
 	})
 }
 
+func TestSecurityNoticeActivity(t *testing.T) {
+	userID := uuid.New()
+	log := models.AuditLog{
+		UserID:  &userID,
+		Action:  "user.mfa_recovery",
+		Details: map[string]interface{}{"remaining_codes": float64(2), "recovery_low": true},
+	}
+	activity := securityNoticeActivity(log)
+	if activity == nil {
+		t.Fatal("expected a warning when codes run low")
+	}
+	if activity.UserID != userID || activity.MessageKey != "activity.mfa.recovery_low" {
+		t.Fatalf("unexpected activity %+v", activity)
+	}
+	if !strings.Contains(activity.Message, "2 recovery codes") {
+		t.Fatalf("expected the remaining count in the message, got %q", activity.Message)
+	}
+
+	log.Details["recovery_low"] = false
+	if securityNoticeActivity(log) != nil {
+		t.Fatal("expected no warning while codes remain")
+	}
+
+	activity = securityNoticeActivity(models.AuditLog{
+		UserID:  &userID,
+		Action:  "auth.new_device",
+		Details: map[string]interface{}{"device": "Firefox on Linux", "country": "DE"},
+	})
+	if activity == nil || activity.Message != "New sign-in from Firefox on Linux in DE" {
+		t.Fatalf("unexpected new device activity %+v", activity)
+	}
+}
+
 func TestAuditService_ShareCreateActivity(t *testing.T) {
 	db := setupAuditTestDB(t)
 	service := NewAuditService(db, nil)
@@ -401,3 +439,137 @@ func TestDetailString(t *testing.T) {
 		})
 	}
 }
+
+func TestAuditService_ActivitiesAreKeyed(t *testing.T) {
+	db := setupAuditTestDB(t)
+	service := NewAuditService(db, nil)
+
+	ownerID := uuid.New()
+	db.Create(&models.User{
+		BaseModel:    models.BaseModel{ID: ownerID},
+		Email:        "keyed@test.com",
+		PasswordHash: "hash",
+		FirstName:    "Ada",
+		LastName:     "Lovelace",
+		Role:         models.UserRoleUser,
+	})
+	recipientID := uuid.New()
+	fileID := uuid.New()
+
+	activities := service.activitiesForShareCreate(models.AuditLog{
+		UserID:     &ownerID,
+		Action:     "share.create",
+		ResourceID: &fileID,
+		Details: map[string]interface{}{
+			"file_name":           "plan.pdf",
+			"shared_with_user_id": recipientID.String(),
+		},
+	})
+	if len(activities) != 1 {
+		t.Fatalf("expected 1 activity, got %d", len(activities))
+	}
+	got := activities[0]
+	if got.MessageKey != "activity.share.with_you" || got.MessageParams["actor"] != "Ada Lovelace" {
+		t.Fatalf("unexpected key/params: %q %v", got.MessageKey, got.MessageParams)
+	}
+	if got.Message != `Ada Lovelace shared "plan.pdf" with you` {
+		t.Fatalf("expected English message stored, got %q", got.Message)
+	}
+
+	self := service.selfActivityForAction(models.AuditLog{UserID: &ownerID, Action: "user.login"})
+	if self.MessageKey != "activity.self.user.login" || self.ResourceName != "Account" || self.Message != "You signed in" {
+		t.Fatalf("unexpected self activity: %+v", self)
+	}
+}
+
+func TestLocalizeActivity(t *testing.T) {
+	t.Run("renders key in locale", func(t *testing.T) {
+		a := models.Activity{
+			MessageKey:    "activity.group.added",
+			MessageParams: map[string]string{"actor": "Ada", "group": "Ops"},
+		}
+		LocalizeActivity(&a, "de")
+		if a.Message != "Ada hat Sie zu „Ops“ hinzugefügt" {
+			t.Fatalf("got %q", a.Message)
+		}
+	})
+
+	t.Run("localizes fallbacks and fixed resource names", func(t *testing.T) {
+		share := models.Activity{
+			MessageKey:    "activity.share.with_group",
+			MessageParams: map[string]string{"actor": "", "name": "x.txt"},
+		}
+		LocalizeActivity(&share, "fr")
+		if share.Message != "Quelqu’un a partagé « x.txt » avec un groupe" {
+			t.Fatalf("got %q", share.Message)
+		}
+
+		login := models.Activity{
+			ResourceName:  "Account",
+			MessageKey:    "activity.self.user.login",
+			MessageParams: map[string]string{"resource_key": "activity.account"},
+		}
+		LocalizeActivity(&login, "es")
+		if login.ResourceName != "Cuenta" || login.Message != "Iniciaste sesión" {
+			t.Fatalf("got %q / %q", login.ResourceName, login.Message)
+		}
+	})
+
+	t.Run("leaves unkeyed rows alone", func(t *testing.T) {
+		a := models.Activity{Message: "legacy message"}
+		LocalizeActivity(&a, "de")
+		if a.Message != "legacy message" {
+			t.Fatalf("got %q", a.Message)
+		}
+	})
+}
+
+func TestAuditService_ModerationActivities(t *testing.T) {
+	service := NewAuditService(setupAuditTestDB(t), nil)
+	adminID, ownerID, reporterID := uuid.New(), uuid.New(), uuid.New()
+	reportID, fileID := uuid.New(), uuid.New()
+
+	moderationLog := func(action string, details map[string]interface{}) models.AuditLog {
+		details["file_id"] = fileID.String()
+		details["file_name"] = "flyer.pdf"
+		details["owner_id"] = ownerID.String()
+		return models.AuditLog{UserID: &adminID, Action: action, ResourceID: &reportID, Details: details}
+	}
+
+	activities := service.activitiesForModeration(moderationLog("admin.report_action", map[string]interface{}{
+		"action":      "quarantine_file",
+		"reporter_id": reporterID.String(),
+	}))
+	if len(activities) != 2 {
+		t.Fatalf("expected the owner and reporter notified, got %d", len(activities))
+	}
+	if activities[0].UserID != ownerID || activities[0].MessageKey != "activity.moderation.file_quarantined" {
+		t.Errorf("unexpected owner activity: %+v", activities[0])
+	}
+	if activities[1].UserID != reporterID || activities[1].MessageKey != "activity.moderation.report_actioned" {
+		t.Errorf("unexpected reporter activity: %+v", activities[1])
+	}
+	if *activities[0].ResourceID != fileID || activities[0].Message != `"flyer.pdf" was quarantined after a content report` {
+		t.Errorf("expected the activity filed under the file, got %+v", activities[0])
+	}
+
+	anonymous := service.activitiesForModeration(moderationLog("admin.report_action", map[string]interface{}{"action": "disable_share"}))
+	if len(anonymous) != 1 || anonymous[0].MessageKey != "activity.moderation.share_disabled" {
+		t.Errorf("expected only the owner notified for an anonymous report, got %+v", anonymous)
+	}
+
+	reviewing := service.activitiesForModeration(moderationLog("admin.report_update", map[string]interface{}{
+		"status":      "reviewing",
+		"reporter_id": reporterID.String(),
+	}))
+	if len(reviewing) != 0 {
+		t.Errorf("expected no activity while a report is under review, got %+v", reviewing)
+	}
+	dismissed := service.activitiesForModeration(moderationLog("admin.report_update", map[string]interface{}{
+		"status":      "dismissed",
+		"reporter_id": reporterID.String(),
+	}))
+	if len(dismissed) != 1 || dismissed[0].UserID != reporterID || dismissed[0].MessageKey != "activity.moderation.report_dismissed" {
+		t.Errorf("expected the reporter told of the dismissal, got %+v", dismissed)
+	}
+}
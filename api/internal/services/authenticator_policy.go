@@ -0,0 +1,160 @@
+package services
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/google/uuid"
+)
+
+// Passkey attestation preferences, as requested from the browser.
+const (
+	AttestationNone     = "none"
+	AttestationIndirect = "indirect"
+	AttestationDirect   = "direct"
+)
+
+var (
+	// ErrAuthenticatorNotAllowed is returned for authenticator models the
+	// allow or deny list rules out.
+	ErrAuthenticatorNotAllowed = errors.New("this authenticator is not allowed by the passkey policy")
+	// ErrAttestationRequired is returned under direct attestation for
+	// passkeys that do not prove which authenticator made them.
+	ErrAttestationRequired = errors.New("the passkey policy requires an attested hardware authenticator")
+)
+
+// AuthenticatorInfo describes an authenticator model. Kind is one of
+// security-key, platform (bound to the device) or synced (copied between
+// devices through a cloud account).
+type AuthenticatorInfo struct {
+	AAGUID string `json:"aaguid"`
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+}
+
+// authenticatorsJSON is a snapshot of common authenticator models taken from
+// the FIDO Metadata Service. It only serves to name authenticators for
+// users; the policy does not depend on it.
+//
+//go:embed authenticators.json
+var authenticatorsJSON []byte
+
+var authenticatorMetadata = mustLoadAuthenticatorMetadata()
+
+func mustLoadAuthenticatorMetadata() map[uuid.UUID]AuthenticatorInfo {
+	var raw map[string]AuthenticatorInfo
+	if err := json.Unmarshal(authenticatorsJSON, &raw); err != nil {
+		panic(fmt.Sprintf("authenticators.json: %v", err))
+	}
+	out := make(map[uuid.UUID]AuthenticatorInfo, len(raw))
+	for key, info := range raw {
+		id := uuid.MustParse(key)
+		info.AAGUID = id.String()
+		out[id] = info
+	}
+	return out
+}
+
+// LookupAuthenticator returns what is known about the authenticator model
+// with the given AAGUID, or nil when it is unknown or not reported.
+func LookupAuthenticator(aaguid []byte) *AuthenticatorInfo {
+	id, err := uuid.FromBytes(aaguid)
+	if err != nil || id == uuid.Nil {
+		return nil
+	}
+	if info, ok := authenticatorMetadata[id]; ok {
+		return &info
+	}
+	return &AuthenticatorInfo{AAGUID: id.String(), Name: "Unknown authenticator"}
+}
+
+// AuthenticatorPolicy decides which passkeys may be registered and used.
+type AuthenticatorPolicy struct {
+	Attestation string
+	Allow       map[uuid.UUID]bool
+	Deny        map[uuid.UUID]bool
+}
+
+func NewAuthenticatorPolicy(cfg config.WebAuthnConfig) (*AuthenticatorPolicy, error) {
+	policy := &AuthenticatorPolicy{
+		Attestation: cfg.Attestation,
+		Allow:       map[uuid.UUID]bool{},
+		Deny:        map[uuid.UUID]bool{},
+	}
+	switch policy.Attestation {
+	case "":
+		policy.Attestation = AttestationNone
+	case AttestationNone, AttestationIndirect, AttestationDirect:
+	default:
+		return nil, fmt.Errorf("WEBAUTHN_ATTESTATION must be none, indirect or direct, got %q", cfg.Attestation)
+	}
+
+	for _, list := range []struct {
+		name  string
+		items []string
+		into  map[uuid.UUID]bool
+	}{
+		{"WEBAUTHN_AAGUID_ALLOWLIST", cfg.AAGUIDAllowlist, policy.Allow},
+		{"WEBAUTHN_AAGUID_DENYLIST", cfg.AAGUIDDenylist, policy.Deny},
+	} {
+		for _, item := range list.items {
+			id, err := uuid.Parse(strings.TrimSpace(item))
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid AAGUID %q", list.name, item)
+			}
+			list.into[id] = true
+		}
+	}
+	return policy, nil
+}
+
+// AllowsAuthenticator applies the allow and deny lists. Authenticators that
+// do not report an AAGUID only pass when there is no allow list.
+func (p *AuthenticatorPolicy) AllowsAuthenticator(aaguid []byte) error {
+	id, err := uuid.FromBytes(aaguid)
+	if err != nil {
+		id = uuid.Nil
+	}
+	if p.Deny[id] {
+		return ErrAuthenticatorNotAllowed
+	}
+	if len(p.Allow) > 0 && !p.Allow[id] {
+		return ErrAuthenticatorNotAllowed
+	}
+	return nil
+}
+
+// CheckRegistration vets a new passkey. certified reports whether its
+// attestation statement is backed by a certificate rather than being absent
+// or self-signed.
+func (p *AuthenticatorPolicy) CheckRegistration(aaguid []byte, certified bool) error {
+	if p.Attestation == AttestationDirect && !certified {
+		return ErrAttestationRequired
+	}
+	return p.AllowsAuthenticator(aaguid)
+}
+
+// Compliant reports whether a stored passkey would be accepted by the
+// current policy if it were registered today.
+func (p *AuthenticatorPolicy) Compliant(aaguid []byte, certified bool) bool {
+	return p.CheckRegistration(aaguid, certified) == nil
+}
+
+// AttestationCertified reports whether an attestation statement of the given
+// format carries a certificate chain. "none" and self-attested "packed"
+// statements prove nothing about the authenticator model; SafetyNet carries
+// its chain inside the signed response.
+func AttestationCertified(format string, statement map[string]any) bool {
+	switch format {
+	case "", "none":
+		return false
+	case "android-safetynet":
+		return true
+	}
+	x5c, ok := statement["x5c"].([]any)
+	return ok && len(x5c) > 0
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/google/uuid"
+)
+
+func aaguidBytes(s string) []byte {
+	b, _ := uuid.MustParse(s).MarshalBinary()
+	return b
+}
+
+func TestNewAuthenticatorPolicy(t *testing.T) {
+	if _, err := NewAuthenticatorPolicy(config.WebAuthnConfig{Attestation: "enterprise"}); err == nil {
+		t.Error("expected an error for an unsupported attestation preference")
+	}
+	if _, err := NewAuthenticatorPolicy(config.WebAuthnConfig{AAGUIDAllowlist: []string{"yubikey"}}); err == nil {
+		t.Error("expected an error for an invalid AAGUID")
+	}
+	policy, err := NewAuthenticatorPolicy(config.WebAuthnConfig{})
+	if err != nil || policy.Attestation != AttestationNone {
+		t.Fatalf("expected none by default, got %+v, %v", policy, err)
+	}
+}
+
+func TestAuthenticatorPolicy(t *testing.T) {
+	yubikey := "cb69481e-8ff7-4039-93ec-0a2729a154a8"
+	titan := "42b4fb4a-2866-43b2-9bf7-6c6669c2e5d3"
+	icloud := "fbfc3007-154e-4ecc-8c0b-6e020557d7bd"
+
+	t.Run("direct attestation with an allow list", func(t *testing.T) {
+		policy, err := NewAuthenticatorPolicy(config.WebAuthnConfig{
+			Attestation:     "direct",
+			AAGUIDAllowlist: []string{yubikey, titan},
+		})
+		if err != nil {
+			t.Fatalf("policy: %v", err)
+		}
+		if err := policy.CheckRegistration(aaguidBytes(yubikey), true); err != nil {
+			t.Errorf("expected attested YubiKey to pass, got %v", err)
+		}
+		if err := policy.CheckRegistration(aaguidBytes(yubikey), false); !errors.Is(err, ErrAttestationRequired) {
+			t.Errorf("expected ErrAttestationRequired, got %v", err)
+		}
+		if err := policy.CheckRegistration(aaguidBytes(icloud), true); !errors.Is(err, ErrAuthenticatorNotAllowed) {
+			t.Errorf("expected ErrAuthenticatorNotAllowed, got %v", err)
+		}
+		if err := policy.AllowsAuthenticator(make([]byte, 16)); !errors.Is(err, ErrAuthenticatorNotAllowed) {
+			t.Errorf("an unreported AAGUID should not pass an allow list, got %v", err)
+		}
+	})
+
+	t.Run("deny list only", func(t *testing.T) {
+		policy, _ := NewAuthenticatorPolicy(config.WebAuthnConfig{AAGUIDDenylist: []string{icloud}})
+		if err := policy.CheckRegistration(aaguidBytes(yubikey), false); err != nil {
+			t.Errorf("expected unattested YubiKey to pass, got %v", err)
+		}
+		if policy.Compliant(aaguidBytes(icloud), true) {
+			t.Error("denied authenticator should not be compliant")
+		}
+		if err := policy.AllowsAuthenticator(nil); err != nil {
+			t.Errorf("missing AAGUID should pass without an allow list, got %v", err)
+		}
+	})
+}
+
+func TestLookupAuthenticator(t *testing.T) {
+	if info := LookupAuthenticator(aaguidBytes("cb69481e-8ff7-4039-93ec-0a2729a154a8")); info == nil || info.Kind != "security-key" {
+		t.Errorf("expected YubiKey metadata, got %+v", info)
+	}
+	if info := LookupAuthenticator(aaguidBytes(uuid.NewString())); info == nil || info.Name != "Unknown authenticator" {
+		t.Errorf("expected an unknown authenticator, got %+v", info)
+	}
+	if info := LookupAuthenticator(make([]byte, 16)); info != nil {
+		t.Errorf("expected nil for a zero AAGUID, got %+v", info)
+	}
+}
+
+func TestAttestationCertified(t *testing.T) {
+	chain := map[string]any{"x5c": []any{[]byte("cert")}}
+	tests := []struct {
+		format    string
+		statement map[string]any
+		want      bool
+	}{
+		{"none", nil, false},
+		{"packed", map[string]any{"alg": -7, "sig": []byte("sig")}, false},
+		{"packed", chain, true},
+		{"tpm", chain, true},
+		{"android-safetynet", map[string]any{"ver": "1", "response": []byte("jws")}, true},
+	}
+	for _, tt := range tests {
+		if got := AttestationCertified(tt.format, tt.statement); got != tt.want {
+			t.Errorf("AttestationCertified(%q) = %v, want %v", tt.format, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/disintegration/imaging"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxAvatarBytes caps the size of an uploaded avatar image.
+	MaxAvatarBytes = 5 << 20
+	// DefaultAvatarSize is the size avatar URLs on user objects point at.
+	DefaultAvatarSize = 128
+
+	avatarJPEGQuality = 85
+)
+
+// AvatarSizes are the square sizes, in pixels, every avatar is rendered at.
+var AvatarSizes = []int{32, 64, 128, 256}
+
+var (
+	ErrAvatarInvalid  = errors.New("avatar must be a JPEG, PNG, GIF or WebP image")
+	ErrAvatarTooLarge = fmt.Errorf("avatar must be at most %d MB", MaxAvatarBytes>>20)
+	ErrAvatarNotFound = errors.New("avatar not found")
+)
+
+// AvatarStore holds the rendered avatar images.
+type AvatarStore interface {
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Upload(ctx context.Context, objectName string, reader io.Reader, size int64, contentType string) error
+	Delete(ctx context.Context, objectName string) error
+}
+
+// AvatarService renders uploaded profile pictures. An upload is cropped to
+// a square and stored once per size in AvatarSizes under
+// avatars/<user>/<version>/, where the version is a hash of the rendered
+// images. A new picture gets a new version and so a new URL, which lets the
+// images be cached publicly for as long as clients like.
+type AvatarService struct {
+	DB    *gorm.DB
+	Store AvatarStore
+}
+
+func NewAvatarService(db *gorm.DB, store AvatarStore) *AvatarService {
+	return &AvatarService{DB: db, Store: store}
+}
+
+// AvatarPath is the public URL path of a user's avatar at size.
+func AvatarPath(userID uuid.UUID, version string, size int) string {
+	return fmt.Sprintf("/api/public/avatars/%s/%s/%d", userID, version, size)
+}
+
+func avatarKey(userID uuid.UUID, version string, size int) string {
+	return fmt.Sprintf("avatars/%s/%s/%d.jpg", userID, version, size)
+}
+
+// Set renders the image in r as user's avatar, points the user's avatar URL
+// at it and removes the previous one.
+func (s *AvatarService) Set(ctx context.Context, user *models.User, r io.Reader) error {
+	data, err := io.ReadAll(io.LimitReader(r, MaxAvatarBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > MaxAvatarBytes {
+		return ErrAvatarTooLarge
+	}
+	switch DetectContentType(data) {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+	default:
+		return ErrAvatarInvalid
+	}
+	img, err := decodeSourceImage(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrAvatarInvalid, err)
+	}
+
+	rendered := make([][]byte, len(AvatarSizes))
+	hash := sha256.New()
+	for i, size := range AvatarSizes {
+		if rendered[i], err = encodeJPEG(imaging.Fill(img, size, size, imaging.Center, imaging.Lanczos), avatarJPEGQuality); err != nil {
+			return err
+		}
+		hash.Write(rendered[i])
+	}
+	version := hex.EncodeToString(hash.Sum(nil)[:8])
+
+	for i, size := range AvatarSizes {
+		if err := s.Store.Upload(ctx, avatarKey(user.ID, version, size), bytes.NewReader(rendered[i]), int64(len(rendered[i])), "image/jpeg"); err != nil {
+			return err
+		}
+	}
+
+	avatarURL := AvatarPath(user.ID, version, DefaultAvatarSize)
+	if err := s.DB.WithContext(ctx).Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"avatar_url":     avatarURL,
+		"avatar_version": version,
+	}).Error; err != nil {
+		s.Discard(ctx, user.ID, version)
+		return err
+	}
+	if previous := user.AvatarVersion; previous != "" && previous != version {
+		s.Discard(ctx, user.ID, previous)
+	}
+	user.AvatarURL = &avatarURL
+	user.AvatarVersion = version
+	return nil
+}
+
+// Remove clears user's avatar.
+func (s *AvatarService) Remove(ctx context.Context, user *models.User) error {
+	if err := s.DB.WithContext(ctx).Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"avatar_url":     nil,
+		"avatar_version": "",
+	}).Error; err != nil {
+		return err
+	}
+	if user.AvatarVersion != "" {
+		s.Discard(ctx, user.ID, user.AvatarVersion)
+	}
+	user.AvatarURL = nil
+	user.AvatarVersion = ""
+	return nil
+}
+
+// Discard deletes the stored images of one avatar version. Failures are
+// only logged; the images are no longer referenced.
+func (s *AvatarService) Discard(ctx context.Context, userID uuid.UUID, version string) {
+	for _, size := range AvatarSizes {
+		if err := s.Store.Delete(ctx, avatarKey(userID, version, size)); err != nil {
+			logger.Error("avatar_delete_failed", err, map[string]interface{}{
+				"user_id": userID.String(),
+				"version": version,
+				"size":    size,
+			})
+		}
+	}
+}
+
+// Open returns the image of a user's current avatar at size. Older
+// versions are not served once replaced.
+func (s *AvatarService) Open(ctx context.Context, userID uuid.UUID, version string, size int) (io.ReadCloser, error) {
+	if version == "" || !slices.Contains(AvatarSizes, size) {
+		return nil, ErrAvatarNotFound
+	}
+	var count int64
+	if err := s.DB.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND avatar_version = ?", userID, version).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrAvatarNotFound
+	}
+	return s.Store.Get(ctx, avatarKey(userID, version, size))
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCaptchaRequired = errors.New("a CAPTCHA must be solved first")
+	ErrCaptchaFailed   = errors.New("CAPTCHA verification failed")
+)
+
+// captchaVerifyURLs are the siteverify endpoints of the supported
+// providers. All three take the same form fields and answer with the same
+// "success" flag.
+var captchaVerifyURLs = map[string]string{
+	"hcaptcha":  "https://api.hcaptcha.com/siteverify",
+	"recaptcha": "https://www.google.com/recaptcha/api/siteverify",
+	"turnstile": "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+const captchaVerifyTimeout = 10 * time.Second
+
+// CaptchaService asks anonymous visitors of public shares to solve a
+// CAPTCHA the first time they download from a new address. A nil service
+// never asks.
+type CaptchaService struct {
+	DB        *gorm.DB
+	Provider  string
+	SiteKey   string
+	secret    string
+	verifyURL string
+	passTTL   time.Duration
+	client    *http.Client
+}
+
+// NewCaptchaService returns nil when no provider is configured.
+func NewCaptchaService(db *gorm.DB, cfg config.CaptchaConfig) (*CaptchaService, error) {
+	if cfg.Provider == "" {
+		return nil, nil
+	}
+	verifyURL, ok := captchaVerifyURLs[cfg.Provider]
+	if !ok {
+		return nil, fmt.Errorf("CAPTCHA_PROVIDER must be hcaptcha, recaptcha or turnstile, got %q", cfg.Provider)
+	}
+	if cfg.SiteKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("CAPTCHA_SITE_KEY and CAPTCHA_SECRET_KEY are required")
+	}
+	if cfg.VerifyURL != "" {
+		verifyURL = cfg.VerifyURL
+	}
+	passTTL := cfg.PassTTL
+	if passTTL <= 0 {
+		passTTL = 24 * time.Hour
+	}
+	return &CaptchaService{
+		DB:        db,
+		Provider:  cfg.Provider,
+		SiteKey:   cfg.SiteKey,
+		secret:    cfg.SecretKey,
+		verifyURL: verifyURL,
+		passTTL:   passTTL,
+		client:    &http.Client{Timeout: captchaVerifyTimeout},
+	}, nil
+}
+
+// Required reports whether ip has to solve a CAPTCHA before downloading
+// through shareID.
+func (s *CaptchaService) Required(ctx context.Context, shareID uuid.UUID, ip string) bool {
+	if s == nil {
+		return false
+	}
+	var count int64
+	s.DB.WithContext(ctx).Model(&models.CaptchaPass{}).
+		Where("share_id = ? AND ip_address = ? AND expires_at > ?", shareID, ip, time.Now()).
+		Count(&count)
+	return count == 0
+}
+
+// Check lets ip through shareID if it has already passed or if token is a
+// valid solution, in which case the pass is remembered.
+func (s *CaptchaService) Check(ctx context.Context, shareID uuid.UUID, ip, token string) error {
+	if !s.Required(ctx, shareID, ip) {
+		return nil
+	}
+	if err := s.Verify(ctx, token, ip); err != nil {
+		return err
+	}
+	pass := models.CaptchaPass{ShareID: shareID, IPAddress: ip, ExpiresAt: time.Now().Add(s.passTTL)}
+	return s.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "share_id"}, {Name: "ip_address"}},
+		DoUpdates: clause.AssignmentColumns([]string{"expires_at", "updated_at"}),
+	}).Create(&pass).Error
+}
+
+// Verify asks the provider whether token is a valid solution from ip.
+func (s *CaptchaService) Verify(ctx context.Context, token, ip string) error {
+	if s == nil {
+		return nil
+	}
+	if strings.TrimSpace(token) == "" {
+		return ErrCaptchaRequired
+	}
+
+	form := url.Values{"secret": {s.secret}, "response": {token}}
+	if ip != "" {
+		form.Set("remoteip", ip)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed reaching %s: %w", s.Provider, err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s siteverify returned %s", s.Provider, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed decoding %s response: %w", s.Provider, err)
+	}
+	if !result.Success {
+		return ErrCaptchaFailed
+	}
+	return nil
+}
+
+func CleanupExpiredCaptchaPasses(db *gorm.DB) error {
+	return db.Unscoped().Where("expires_at < ?", time.Now()).Delete(&models.CaptchaPass{}).Error
+}
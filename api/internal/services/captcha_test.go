@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func setupCaptchaTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.CaptchaPass{}); err != nil {
+		t.Fatalf("failed automigrating models: %v", err)
+	}
+	return db
+}
+
+func TestNewCaptchaService(t *testing.T) {
+	if s, err := NewCaptchaService(nil, config.CaptchaConfig{}); s != nil || err != nil {
+		t.Fatalf("expected no service without a provider, got %v, %v", s, err)
+	}
+	if (*CaptchaService)(nil).Required(context.Background(), uuid.New(), "203.0.113.1") {
+		t.Fatal("expected a nil service never to ask")
+	}
+
+	invalid := []config.CaptchaConfig{
+		{Provider: "mturk", SiteKey: "site", SecretKey: "secret"},
+		{Provider: "hcaptcha", SiteKey: "site"},
+	}
+	for _, cfg := range invalid {
+		if _, err := NewCaptchaService(nil, cfg); err == nil {
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+}
+
+func TestCaptchaService_RemembersPasses(t *testing.T) {
+	var gotIP string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotIP = r.FormValue("remoteip")
+		if r.FormValue("response") == "solved" {
+			_, _ = w.Write([]byte(`{"success":true}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success":false}`))
+	}))
+	defer srv.Close()
+
+	db := setupCaptchaTestDB(t)
+	s, err := NewCaptchaService(db, config.CaptchaConfig{Provider: "hcaptcha", SiteKey: "site", SecretKey: "secret", VerifyURL: srv.URL, PassTTL: time.Hour})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+	shareID := uuid.New()
+
+	if err := s.Check(ctx, shareID, "203.0.113.1", ""); !errors.Is(err, ErrCaptchaRequired) {
+		t.Fatalf("expected ErrCaptchaRequired, got %v", err)
+	}
+	if err := s.Check(ctx, shareID, "203.0.113.1", "wrong"); !errors.Is(err, ErrCaptchaFailed) {
+		t.Fatalf("expected ErrCaptchaFailed, got %v", err)
+	}
+	if err := s.Check(ctx, shareID, "203.0.113.1", "solved"); err != nil {
+		t.Fatalf("expected the solution accepted, got %v", err)
+	}
+	if gotIP != "203.0.113.1" {
+		t.Fatalf("expected the client address sent to the provider, got %q", gotIP)
+	}
+	if err := s.Check(ctx, shareID, "203.0.113.1", ""); err != nil {
+		t.Fatalf("expected the pass remembered, got %v", err)
+	}
+	if !s.Required(ctx, shareID, "203.0.113.2") || !s.Required(ctx, uuid.New(), "203.0.113.1") {
+		t.Fatal("expected passes to be per share and address")
+	}
+
+	db.Model(&models.CaptchaPass{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Minute))
+	if !s.Required(ctx, shareID, "203.0.113.1") {
+		t.Fatal("expected an expired pass to be ignored")
+	}
+	if err := CleanupExpiredCaptchaPasses(db); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	var count int64
+	db.Model(&models.CaptchaPass{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected expired passes swept, got %d", count)
+	}
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	changeFeedBatchSize = 200
+	// changeFeedSettle holds back the newest events. RecordEvent stamps an
+	// event before its transaction commits, so a slow transaction can commit
+	// an event older than one a reader has already moved past; reading only
+	// events at least this old gives it time to land.
+	changeFeedSettle = time.Second
+	// changeFeedRecheck is the longest a waiter sleeps without being woken.
+	// The instance whose dispatcher claims an event wakes its own waiters
+	// and, over the event bus, those of the others; without a bus, waiters
+	// elsewhere fall back to re-reading the outbox.
+	changeFeedRecheck = 5 * time.Second
+)
+
+// ChangePosition is a place in the change feed: the creation time and ID
+// of the last event read.
+type ChangePosition struct {
+	At time.Time
+	ID uuid.UUID
+}
+
+// FileChange is a file or share event from the outbox as the change feed
+// shows it to clients.
+type FileChange struct {
+	ID         uuid.UUID  `json:"id"`
+	EventType  string     `json:"eventType"`
+	FileID     uuid.UUID  `json:"fileID"`
+	FileName   string     `json:"fileName,omitempty"`
+	ActorID    *uuid.UUID `json:"actorID,omitempty"`
+	OccurredAt time.Time  `json:"occurredAt"`
+	// Preview is set on preview.* events.
+	Preview *PreviewProgress `json:"preview,omitempty"`
+	// Language is set on file.language_detected events, and empty there
+	// when the file no longer has a language.
+	Language string `json:"language,omitempty"`
+}
+
+// PreviewProgress is the state of a preview job after a transition.
+type PreviewProgress struct {
+	JobID       string     `json:"jobID"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"maxAttempts"`
+	NextRetryAt *time.Time `json:"nextRetryAt,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+}
+
+func previewProgress(details map[string]interface{}) *PreviewProgress {
+	progress := &PreviewProgress{
+		JobID:  detailString(details, "job_id"),
+		Status: detailString(details, "status"),
+		Reason: detailString(details, "reason"),
+	}
+	progress.Attempts, _ = strconv.Atoi(detailString(details, "attempts"))
+	progress.MaxAttempts, _ = strconv.Atoi(detailString(details, "max_attempts"))
+	if at, err := time.Parse(time.RFC3339, detailString(details, "next_retry_at")); err == nil {
+		progress.NextRetryAt = &at
+	}
+	return progress
+}
+
+// ChangeFeed reads the outbox as a per-user stream of file changes and lets
+// clients block until the next one. It subscribes to the outbox dispatcher
+// only to wake waiters; the outbox table is the source of truth.
+type ChangeFeed struct {
+	DB     *gorm.DB
+	Access *AccessService
+
+	mu   sync.Mutex
+	wake chan struct{}
+	bus  *EventBus
+}
+
+func NewChangeFeed(db *gorm.DB, access *AccessService) *ChangeFeed {
+	return &ChangeFeed{DB: db, Access: access, wake: make(chan struct{})}
+}
+
+func (f *ChangeFeed) Name() string {
+	return "change_feed"
+}
+
+// HandleEvent wakes every waiter, here and on the other instances. It
+// never fails, so it never holds up delivery to the other subscribers.
+func (f *ChangeFeed) HandleEvent(ctx context.Context, event models.OutboxEvent) error {
+	f.wakeAll()
+	f.bus.Publish(BusTopicChanges, nil)
+	return nil
+}
+
+// UseEventBus lets events dispatched on other instances wake this one's
+// waiters.
+func (f *ChangeFeed) UseEventBus(bus *EventBus) {
+	f.bus = bus
+	bus.Subscribe(BusTopicChanges, func(json.RawMessage) { f.wakeAll() })
+}
+
+func (f *ChangeFeed) wakeAll() {
+	f.mu.Lock()
+	close(f.wake)
+	f.wake = make(chan struct{})
+	f.mu.Unlock()
+}
+
+func (f *ChangeFeed) waiter() <-chan struct{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.wake
+}
+
+// Head returns the position just after the newest settled event, for
+// clients that want to start watching from now.
+func (f *ChangeFeed) Head(ctx context.Context) (ChangePosition, error) {
+	var events []models.OutboxEvent
+	if err := f.events(ctx).Order("created_at DESC, id DESC").Limit(1).Find(&events).Error; err != nil {
+		return ChangePosition{}, err
+	}
+	if len(events) == 0 {
+		// uuid.Max sorts after every event stamped at the same instant.
+		return ChangePosition{At: time.Now().UTC().Add(-changeFeedSettle), ID: uuid.Max}, nil
+	}
+	return ChangePosition{At: events[0].CreatedAt, ID: events[0].ID}, nil
+}
+
+// Read returns the changes after pos that affect userID from one batch of
+// the outbox, and the position it read up to. The position moves past
+// events that don't affect the user, so an empty result still makes
+// progress.
+func (f *ChangeFeed) Read(ctx context.Context, userID uuid.UUID, pos ChangePosition) ([]FileChange, ChangePosition, error) {
+	var events []models.OutboxEvent
+	if err := f.events(ctx).
+		Where("created_at > ? OR (created_at = ? AND id > ?)", pos.At, pos.At, pos.ID).
+		Order("created_at ASC, id ASC").
+		Limit(changeFeedBatchSize).
+		Find(&events).Error; err != nil {
+		return nil, pos, err
+	}
+
+	changes := []FileChange{}
+	visible := map[uuid.UUID]bool{}
+	for _, event := range events {
+		pos = ChangePosition{At: event.CreatedAt, ID: event.ID}
+		if !f.affects(ctx, userID, event, visible) {
+			continue
+		}
+		change := FileChange{
+			ID:         event.ID,
+			EventType:  event.EventType,
+			FileID:     *event.ResourceID,
+			FileName:   detailString(event.Payload, "file_name"),
+			ActorID:    event.ActorID,
+			OccurredAt: event.CreatedAt,
+		}
+		if strings.HasPrefix(event.EventType, "preview.") {
+			change.Preview = previewProgress(event.Payload)
+		}
+		if event.EventType == "file.language_detected" {
+			change.Language = detailString(event.Payload, "language")
+		}
+		changes = append(changes, change)
+	}
+	return changes, pos, nil
+}
+
+// Wait blocks until there are changes after pos that affect userID, or ctx
+// is done, in which case it returns no changes and the position it has
+// read up to.
+func (f *ChangeFeed) Wait(ctx context.Context, userID uuid.UUID, pos ChangePosition) ([]FileChange, ChangePosition, error) {
+	for {
+		// Take the wake channel before reading so an event dispatched
+		// between the read and the select still wakes us.
+		wake := f.waiter()
+		changes, next, err := f.Read(ctx, userID, pos)
+		if err != nil && ctx.Err() != nil {
+			return []FileChange{}, pos, nil
+		}
+		if err != nil || len(changes) > 0 {
+			return changes, next, err
+		}
+		if next != pos {
+			pos = next
+			continue
+		}
+
+		timer := time.NewTimer(changeFeedRecheck)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return changes, pos, nil
+		case <-wake:
+			// The event that woke us is only just settled, if at all.
+			timer.Reset(changeFeedSettle)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return changes, pos, nil
+			case <-timer.C:
+			}
+		case <-timer.C:
+		}
+	}
+}
+
+func (f *ChangeFeed) events(ctx context.Context) *gorm.DB {
+	return f.DB.WithContext(ctx).
+		Where("resource_type IN ? AND resource_id IS NOT NULL", []string{"file", "share"}).
+		Where("created_at <= ?", time.Now().UTC().Add(-changeFeedSettle))
+}
+
+// affects reports whether userID should hear about event: they made the
+// change, can still see the file, or just lost it through a deletion or a
+// revoked share. visible caches access checks per file for one batch.
+func (f *ChangeFeed) affects(ctx context.Context, userID uuid.UUID, event models.OutboxEvent, visible map[uuid.UUID]bool) bool {
+	if event.ActorID != nil && *event.ActorID == userID {
+		return true
+	}
+	fileID := *event.ResourceID
+	canSee, checked := visible[fileID]
+	if !checked {
+		canSee = f.Access.HasAccess(ctx, userID, fileID, models.SharePermissionView)
+		visible[fileID] = canSee
+	}
+	if canSee {
+		return true
+	}
+
+	switch event.EventType {
+	case "file.delete":
+		for _, id := range detailStrings(event.Payload, "notify_user_ids") {
+			if id == userID.String() {
+				return true
+			}
+		}
+		var count int64
+		f.DB.WithContext(ctx).Unscoped().Model(&models.File{}).
+			Where("id = ? AND owner_id = ?", fileID, userID).
+			Count(&count)
+		return count > 0
+	case "share.delete":
+		if detailString(event.Payload, "shared_with_user_id") == userID.String() {
+			return true
+		}
+		if groupID := detailString(event.Payload, "shared_with_group_id"); groupID != "" {
+			var count int64
+			f.DB.WithContext(ctx).Model(&models.GroupMembership{}).
+				Where("group_id = ? AND user_id = ?", groupID, userID).
+				Count(&count)
+			return count > 0
+		}
+	}
+	return false
+}
+
+// detailStrings reads a list of strings from details, which holds a
+// []string when built in process and a []interface{} once it has been
+// through JSON.
+func detailStrings(details map[string]interface{}, key string) []string {
+	switch v := details[key].(type) {
+	case []string:
+		return v
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			out = append(out, fmt.Sprint(item))
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestChangeFeed(t *testing.T) {
+	db := setupOutboxTestDB(t)
+	feed := NewChangeFeed(db, NewAccessService(db))
+	ctx := context.Background()
+
+	owner := models.User{Email: "feed-owner@test.com", PasswordHash: "hash", Role: models.UserRoleUser}
+	recipient := models.User{Email: "feed-recipient@test.com", PasswordHash: "hash", Role: models.UserRoleUser}
+	stranger := models.User{Email: "feed-stranger@test.com", PasswordHash: "hash", Role: models.UserRoleUser}
+	db.Create(&owner)
+	db.Create(&recipient)
+	db.Create(&stranger)
+	shared := models.File{Name: "shared.txt", MimeType: "text/plain", OwnerID: owner.ID, StoragePath: "shared.txt"}
+	private := models.File{Name: "private.txt", MimeType: "text/plain", OwnerID: owner.ID, StoragePath: "private.txt"}
+	db.Create(&shared)
+	db.Create(&private)
+	db.Create(&models.Share{FileID: shared.ID, SharedByID: owner.ID, SharedWithUserID: &recipient.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView})
+
+	// Events are only read once settled, so stamp them in the past.
+	at := time.Now().UTC().Add(-time.Minute)
+	start := ChangePosition{At: at, ID: uuid.Max}
+	record := func(action, resourceType string, fileID uuid.UUID, details map[string]interface{}) {
+		at = at.Add(time.Second)
+		event := models.OutboxEvent{EventType: action, ResourceType: resourceType, ResourceID: &fileID, ActorID: &owner.ID, Payload: details, NextAttemptAt: at}
+		event.CreatedAt = at
+		if err := db.Create(&event).Error; err != nil {
+			t.Fatalf("failed recording event: %v", err)
+		}
+	}
+	record("file.edit", "file", shared.ID, map[string]interface{}{"file_name": "shared.txt"})
+	record("file.edit", "file", private.ID, map[string]interface{}{"file_name": "private.txt"})
+	record("file.delete", "file", private.ID, map[string]interface{}{"notify_user_ids": []interface{}{recipient.ID.String()}})
+	record("share.delete", "share", private.ID, map[string]interface{}{"shared_with_user_id": stranger.ID.String()})
+	record("org.update", "organization", private.ID, nil)
+
+	head, err := feed.Head(ctx)
+	if err != nil {
+		t.Fatalf("head failed: %v", err)
+	}
+	if changes, _, _ := feed.Read(ctx, owner.ID, head); len(changes) != 0 || !head.At.After(start.At) {
+		t.Fatalf("expected the head past every file event, got %+v", head)
+	}
+
+	eventTypes := func(changes []FileChange) []string {
+		types := make([]string, len(changes))
+		for i, change := range changes {
+			types[i] = change.EventType + ":" + change.FileID.String()[:4]
+		}
+		return types
+	}
+
+	ownerChanges, _, err := feed.Read(ctx, owner.ID, start)
+	if err != nil || len(ownerChanges) != 4 {
+		t.Fatalf("expected the owner to see every file change, got %v, %v", eventTypes(ownerChanges), err)
+	}
+	if ownerChanges[0].FileName != "shared.txt" {
+		t.Errorf("expected the file name carried over, got %+v", ownerChanges[0])
+	}
+
+	recipientChanges, next, _ := feed.Read(ctx, recipient.ID, start)
+	if len(recipientChanges) != 2 || recipientChanges[0].FileID != shared.ID || recipientChanges[1].EventType != "file.delete" {
+		t.Fatalf("expected the shared edit and the deletion they were told of, got %v", eventTypes(recipientChanges))
+	}
+	if again, _, _ := feed.Read(ctx, recipient.ID, next); len(again) != 0 {
+		t.Fatalf("expected nothing after the returned position, got %v", eventTypes(again))
+	}
+
+	strangerChanges, _, _ := feed.Read(ctx, stranger.ID, start)
+	if len(strangerChanges) != 1 || strangerChanges[0].EventType != "share.delete" {
+		t.Fatalf("expected only the revoked share, got %v", eventTypes(strangerChanges))
+	}
+
+	t.Run("wait returns on timeout", func(t *testing.T) {
+		waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		changes, pos, err := feed.Wait(waitCtx, recipient.ID, next)
+		if err != nil || len(changes) != 0 || pos != next {
+			t.Fatalf("expected an empty answer at the same position, got %v, %v, %v", changes, pos, err)
+		}
+	})
+
+	t.Run("wait returns pending changes at once", func(t *testing.T) {
+		changes, _, err := feed.Wait(ctx, recipient.ID, start)
+		if err != nil || len(changes) != 2 {
+			t.Fatalf("expected the pending changes, got %v, %v", eventTypes(changes), err)
+		}
+	})
+
+	t.Run("preview events carry the job state", func(t *testing.T) {
+		retryAt := time.Now().UTC().Add(time.Minute).Truncate(time.Second)
+		record("preview.failed", "file", shared.ID, map[string]interface{}{
+			"job_id":        "job-1",
+			"status":        "pending",
+			"attempts":      float64(1),
+			"max_attempts":  float64(3),
+			"next_retry_at": retryAt.Format(time.RFC3339),
+			"reason":        "gotenberg conversion failed",
+		})
+		changes, _, err := feed.Read(ctx, recipient.ID, next)
+		if err != nil || len(changes) != 1 || changes[0].Preview == nil {
+			t.Fatalf("expected the preview event, got %+v, %v", changes, err)
+		}
+		preview := changes[0].Preview
+		if preview.Attempts != 1 || preview.MaxAttempts != 3 || preview.NextRetryAt == nil || !preview.NextRetryAt.Equal(retryAt) || preview.Reason == "" {
+			t.Fatalf("unexpected preview state %+v", preview)
+		}
+	})
+}
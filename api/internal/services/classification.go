@@ -0,0 +1,419 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const fileScanJob = "file.scan"
+
+var (
+	ErrClassificationRuleInvalid = errors.New("invalid classification rule")
+	ErrUploadBlocked             = errors.New("upload blocked by a classification rule")
+)
+
+var retentionClassPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// ClassificationInput describes an upload to classify.
+type ClassificationInput struct {
+	FileName string
+	// MimeType is the effective type of the file and DetectedType the one
+	// sniffed from its content; a rule's MimeTypes match either.
+	MimeType     string
+	DetectedType string
+	UploaderID   uuid.UUID
+	// OrganizationID is the uploader's organization. A rule only moves a
+	// file into a folder of the same organization.
+	OrganizationID *uuid.UUID
+	// ParentID is the folder the file was uploaded to.
+	ParentID *uuid.UUID
+}
+
+// RuleHit is one rule that matched an upload, with the actions it took.
+type RuleHit struct {
+	RuleID   uuid.UUID `json:"ruleID"`
+	RuleName string    `json:"ruleName"`
+	Actions  []string  `json:"actions"`
+}
+
+// Classification is what the matching rules decided for an upload.
+type Classification struct {
+	Hits           []RuleHit  `json:"hits"`
+	Tags           []string   `json:"tags"`
+	FolderID       *uuid.UUID `json:"folderID,omitempty"`
+	RetentionClass string     `json:"retentionClass,omitempty"`
+	Scan           bool       `json:"scan"`
+	// BlockedBy is the rule that refused the upload.
+	BlockedBy *RuleHit `json:"blockedBy,omitempty"`
+}
+
+// Classifier evaluates classification rules against uploads. Files a rule
+// wants scanned are checked by a file.scan job with Scanner, reading them
+// from Store.
+type Classifier struct {
+	DB      *gorm.DB
+	Jobs    *JobRunner
+	Scanner Scanner
+	Store   TransferStore
+}
+
+func NewClassifier(db *gorm.DB, jobs *JobRunner, scanner Scanner, store TransferStore) *Classifier {
+	c := &Classifier{DB: db, Jobs: jobs, Scanner: scanner, Store: store}
+	if jobs != nil {
+		jobs.Register(fileScanJob, c.runScan, JobOptions{})
+	}
+	return c
+}
+
+// Rules lists every rule in the order they are checked.
+func (c *Classifier) Rules(ctx context.Context) ([]models.ClassificationRule, error) {
+	var rules []models.ClassificationRule
+	err := c.DB.WithContext(ctx).Order("priority ASC, created_at ASC").Find(&rules).Error
+	return rules, err
+}
+
+// Validate normalizes rule's conditions and checks that it can be applied:
+// it needs at least one condition and one action, and its folder must be
+// an unencrypted folder.
+func (c *Classifier) Validate(ctx context.Context, rule *models.ClassificationRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrClassificationRuleInvalid)
+	}
+	rule.Extensions = normalizeRuleExtensions(rule.Extensions)
+	rule.MimeTypes = normalizeTypes(rule.MimeTypes)
+	rule.NamePattern = strings.TrimSpace(rule.NamePattern)
+	if _, err := path.Match(rule.NamePattern, ""); err != nil {
+		return fmt.Errorf("%w: namePattern is not a valid glob", ErrClassificationRuleInvalid)
+	}
+	rule.Tags = normalizeTags(rule.Tags)
+	rule.RetentionClass = strings.ToLower(strings.TrimSpace(rule.RetentionClass))
+	if rule.RetentionClass != "" && !retentionClassPattern.MatchString(rule.RetentionClass) {
+		return fmt.Errorf("%w: retentionClass must be lowercase letters, digits, '-' or '_'", ErrClassificationRuleInvalid)
+	}
+
+	if len(rule.Extensions) == 0 && len(rule.MimeTypes) == 0 && rule.NamePattern == "" && len(rule.GroupIDs) == 0 {
+		return fmt.Errorf("%w: at least one condition is required", ErrClassificationRuleInvalid)
+	}
+	if len(rule.Tags) == 0 && rule.FolderID == nil && rule.RetentionClass == "" && !rule.Scan && !rule.Block {
+		return fmt.Errorf("%w: at least one action is required", ErrClassificationRuleInvalid)
+	}
+	if rule.Scan && c.Scanner == nil {
+		return fmt.Errorf("%w: no malware scanner is configured (SCAN_CLAMAV_ADDRESS)", ErrClassificationRuleInvalid)
+	}
+
+	if len(rule.GroupIDs) > 0 {
+		var count int64
+		if err := c.DB.WithContext(ctx).Model(&models.Group{}).Where("id IN ?", rule.GroupIDs).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(rule.GroupIDs) {
+			return fmt.Errorf("%w: unknown group in groupIDs", ErrClassificationRuleInvalid)
+		}
+	}
+	if rule.FolderID != nil {
+		var folder models.File
+		if err := c.DB.WithContext(ctx).Select("id", "is_directory", "vault_id").Limit(1).Find(&folder, "id = ?", *rule.FolderID).Error; err != nil {
+			return err
+		}
+		if folder.ID == uuid.Nil || !folder.IsDirectory {
+			return fmt.Errorf("%w: folderID is not a folder", ErrClassificationRuleInvalid)
+		}
+		if folder.VaultID != nil {
+			return fmt.Errorf("%w: files cannot be moved into an encrypted folder", ErrClassificationRuleInvalid)
+		}
+	}
+	return nil
+}
+
+// Classify checks in against every enabled rule.
+func (c *Classifier) Classify(ctx context.Context, in ClassificationInput) (*Classification, error) {
+	var rules []models.ClassificationRule
+	if err := c.DB.WithContext(ctx).Where("enabled = ?", true).Order("priority ASC, created_at ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return c.Evaluate(ctx, in, rules)
+}
+
+// Evaluate checks in against rules, in the order given, without changing
+// anything. It backs both Classify and the admin dry run.
+func (c *Classifier) Evaluate(ctx context.Context, in ClassificationInput, rules []models.ClassificationRule) (*Classification, error) {
+	result := &Classification{Hits: []RuleHit{}, Tags: []string{}}
+	if len(rules) == 0 {
+		return result, nil
+	}
+
+	var groups map[uuid.UUID]bool
+	name := strings.ToLower(in.FileName)
+	ext := strings.ToLower(filepath.Ext(in.FileName))
+	types := []string{}
+	for _, t := range []string{baseMediaType(in.MimeType), baseMediaType(in.DetectedType)} {
+		if t != "" {
+			types = append(types, t)
+		}
+	}
+
+	for _, rule := range rules {
+		if len(rule.Extensions) > 0 && !slices.Contains(rule.Extensions, ext) {
+			continue
+		}
+		if len(rule.MimeTypes) > 0 && !anyTypeMatches(types, rule.MimeTypes) {
+			continue
+		}
+		if rule.NamePattern != "" {
+			if ok, _ := path.Match(strings.ToLower(rule.NamePattern), name); !ok {
+				continue
+			}
+		}
+		if len(rule.GroupIDs) > 0 {
+			if groups == nil {
+				var err error
+				if groups, err = c.memberGroups(ctx, in.UploaderID); err != nil {
+					return nil, err
+				}
+			}
+			if !anyGroup(groups, rule.GroupIDs) {
+				continue
+			}
+		}
+
+		hit := RuleHit{RuleID: rule.ID, RuleName: rule.Name, Actions: []string{}}
+		if rule.Block {
+			hit.Actions = append(hit.Actions, "block")
+			result.Hits = append(result.Hits, hit)
+			result.BlockedBy = &result.Hits[len(result.Hits)-1]
+			return result, nil
+		}
+		if len(rule.Tags) > 0 {
+			hit.Actions = append(hit.Actions, "tag")
+			for _, tag := range rule.Tags {
+				if !slices.Contains(result.Tags, tag) {
+					result.Tags = append(result.Tags, tag)
+				}
+			}
+		}
+		if rule.FolderID != nil && result.FolderID == nil {
+			ok, err := c.canMoveInto(ctx, in, *rule.FolderID)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				hit.Actions = append(hit.Actions, "move")
+				result.FolderID = rule.FolderID
+			}
+		}
+		if rule.RetentionClass != "" && result.RetentionClass == "" {
+			hit.Actions = append(hit.Actions, "retention")
+			result.RetentionClass = rule.RetentionClass
+		}
+		if rule.Scan {
+			hit.Actions = append(hit.Actions, "scan")
+			result.Scan = true
+		}
+		result.Hits = append(result.Hits, hit)
+	}
+	return result, nil
+}
+
+// canMoveInto reports whether an upload may be moved into folderID. The
+// folder may have been deleted since the rule was saved, and files are
+// neither moved across organizations nor out of an encrypted folder, whose
+// files the server cannot read.
+func (c *Classifier) canMoveInto(ctx context.Context, in ClassificationInput, folderID uuid.UUID) (bool, error) {
+	if in.ParentID != nil {
+		var parent models.File
+		if err := c.DB.WithContext(ctx).Select("id", "vault_id").Limit(1).Find(&parent, "id = ?", *in.ParentID).Error; err != nil {
+			return false, err
+		}
+		if parent.VaultID != nil {
+			return false, nil
+		}
+	}
+	var folder models.File
+	if err := c.DB.WithContext(ctx).Select("id", "is_directory", "vault_id", "organization_id").Limit(1).Find(&folder, "id = ?", folderID).Error; err != nil {
+		return false, err
+	}
+	if folder.ID == uuid.Nil || !folder.IsDirectory || folder.VaultID != nil {
+		return false, nil
+	}
+	if folder.OrganizationID == nil || in.OrganizationID == nil {
+		return folder.OrganizationID == nil && in.OrganizationID == nil, nil
+	}
+	return *folder.OrganizationID == *in.OrganizationID, nil
+}
+
+func (c *Classifier) memberGroups(ctx context.Context, userID uuid.UUID) (map[uuid.UUID]bool, error) {
+	var ids []uuid.UUID
+	if err := c.DB.WithContext(ctx).Model(&models.GroupMembership{}).Where("user_id = ?", userID).Pluck("group_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	groups := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		groups[id] = true
+	}
+	return groups, nil
+}
+
+// ApplyTo sets the tags, retention class and folder the rules chose on a
+// file about to be created.
+func (r *Classification) ApplyTo(file *models.File) {
+	if len(r.Tags) > 0 {
+		file.Tags = append([]string(nil), r.Tags...)
+	}
+	if r.RetentionClass != "" {
+		file.RetentionClass = r.RetentionClass
+	}
+	if r.FolderID != nil {
+		file.ParentID = r.FolderID
+	}
+}
+
+// Record writes a file.classified audit entry for every rule hit on file
+// within tx, and queues the scan the rules asked for. entry carries who
+// uploaded the file and from where.
+func (c *Classifier) Record(tx *gorm.DB, file *models.File, result *Classification, entry AuditEntry) error {
+	for _, hit := range result.Hits {
+		details := map[string]interface{}{
+			"rule_id":   hit.RuleID.String(),
+			"rule_name": hit.RuleName,
+			"actions":   hit.Actions,
+			"file_name": file.Name,
+		}
+		if slices.Contains(hit.Actions, "tag") {
+			details["tags"] = result.Tags
+		}
+		if slices.Contains(hit.Actions, "move") {
+			details["folder_id"] = result.FolderID.String()
+		}
+		if slices.Contains(hit.Actions, "retention") {
+			details["retention_class"] = result.RetentionClass
+		}
+		entry.Action = "file.classified"
+		entry.ResourceType = "file"
+		entry.ResourceID = &file.ID
+		entry.Details = details
+		if err := RecordEvent(tx, entry); err != nil {
+			return err
+		}
+	}
+	if result.Scan && c.Jobs != nil {
+		if _, err := c.Jobs.enqueue(tx, fileScanJob, map[string]interface{}{"file_id": file.ID.String()}, EnqueueOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runScan checks a file a rule asked to be scanned, and quarantines it when
+// the scanner finds malware.
+func (c *Classifier) runScan(ctx context.Context, job *models.Job) error {
+	raw, _ := job.Payload["file_id"].(string)
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("scan job without a file id: %q", raw)
+	}
+	var file models.File
+	if err := c.DB.WithContext(ctx).Limit(1).Find(&file, "id = ?", id).Error; err != nil {
+		return err
+	}
+	if file.ID == uuid.Nil || file.QuarantinedAt != nil {
+		// Deleted or already pulled while it waited.
+		return nil
+	}
+	if c.Scanner == nil || c.Store == nil {
+		logger.Warn("file_scan_unavailable", map[string]interface{}{
+			"file_id": file.ID.String(),
+		})
+		return nil
+	}
+
+	data, err := c.Store.Get(ctx, file.StoragePath)
+	if err != nil {
+		return err
+	}
+	verdict, err := c.Scanner.Scan(ctx, data)
+	data.Close()
+	if err != nil {
+		return err
+	}
+	if !verdict.Infected {
+		logger.Info("file_scan_clean", map[string]interface{}{
+			"file_id": file.ID.String(),
+			"scanner": c.Scanner.Name(),
+		})
+		return nil
+	}
+
+	return c.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.File{}).Where("id = ? AND quarantined_at IS NULL", file.ID).Update("quarantined_at", time.Now().UTC())
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		logger.WarnWithUser(file.OwnerID.String(), "file_infected", map[string]interface{}{
+			"file_id":   file.ID.String(),
+			"signature": verdict.Signature,
+		})
+		return RecordEvent(tx, AuditEntry{
+			UserID:       &file.OwnerID,
+			Action:       "file.scan_infected",
+			ResourceType: "file",
+			ResourceID:   &file.ID,
+			Details: map[string]interface{}{
+				"file_name": file.Name,
+				"scanner":   c.Scanner.Name(),
+				"signature": verdict.Signature,
+			},
+		})
+	})
+}
+
+func normalizeRuleExtensions(exts []string) []string {
+	out := []string{}
+	for ext := range normalizeExtensions(exts) {
+		out = append(out, ext)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func normalizeTags(tags []string) []string {
+	out := []string{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && len(tag) <= 64 && !slices.Contains(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+func anyTypeMatches(types, patterns []string) bool {
+	for _, t := range types {
+		if matchesAnyType(t, patterns) {
+			return true
+		}
+	}
+	return false
+}
+
+func anyGroup(groups map[uuid.UUID]bool, ids []uuid.UUID) bool {
+	for _, id := range ids {
+		if groups[id] {
+			return true
+		}
+	}
+	return false
+}
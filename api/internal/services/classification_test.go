@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestClassifier(t *testing.T) {
+	logger.Init()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.File{}, &models.Group{}, &models.GroupMembership{}, &models.ClassificationRule{}, &models.Job{}, &models.OutboxEvent{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+
+	ctx := context.Background()
+	store := newMemoryBucket()
+	jobs := NewJobRunner(db, config.JobsConfig{})
+	classifier := NewClassifier(db, jobs, NewScanner(config.ScanConfig{ClamAVAddress: newFakeClamd(t), Timeout: 5 * time.Second}), store)
+
+	uploader := models.User{Email: "classify@test.com", FirstName: "C", LastName: "U", PasswordHash: "x"}
+	db.Create(&uploader)
+	legal := models.Group{Name: "Legal", CreatedByID: uploader.ID}
+	db.Create(&legal)
+	db.Create(&models.GroupMembership{UserID: uploader.ID, GroupID: legal.ID, Role: models.GroupRoleMember})
+	contracts := models.File{Name: "Contracts", IsDirectory: true, OwnerID: uploader.ID}
+	db.Create(&contracts)
+	vaultID := uuid.New()
+	vault := models.File{Name: "Secret", IsDirectory: true, OwnerID: uploader.ID, VaultID: &vaultID}
+	db.Create(&vault)
+
+	add := func(t *testing.T, rule models.ClassificationRule) models.ClassificationRule {
+		t.Helper()
+		rule.Enabled = true
+		rule.CreatedByID = uploader.ID
+		if err := classifier.Validate(ctx, &rule); err != nil {
+			t.Fatalf("failed validating rule %q: %v", rule.Name, err)
+		}
+		if err := db.Create(&rule).Error; err != nil {
+			t.Fatalf("failed creating rule: %v", err)
+		}
+		return rule
+	}
+	input := func(name, mime string) ClassificationInput {
+		return ClassificationInput{FileName: name, MimeType: mime, UploaderID: uploader.ID}
+	}
+
+	t.Run("validate normalizes and refuses incomplete rules", func(t *testing.T) {
+		rule := models.ClassificationRule{Name: " PDFs ", Extensions: []string{"PDF", ".pdf"}, Tags: []string{"pdf", " pdf "}}
+		if err := classifier.Validate(ctx, &rule); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if rule.Name != "PDFs" || !slices.Equal(rule.Extensions, []string{".pdf"}) || !slices.Equal(rule.Tags, []string{"pdf"}) {
+			t.Fatalf("unexpected normalized rule %+v", rule)
+		}
+
+		for name, rule := range map[string]models.ClassificationRule{
+			"no condition":     {Name: "x", Tags: []string{"a"}},
+			"no action":        {Name: "x", Extensions: []string{"pdf"}},
+			"bad glob":         {Name: "x", NamePattern: "[", Tags: []string{"a"}},
+			"bad retention":    {Name: "x", Extensions: []string{"pdf"}, RetentionClass: "Seven Years"},
+			"unknown group":    {Name: "x", GroupIDs: []uuid.UUID{uuid.New()}, Tags: []string{"a"}},
+			"encrypted folder": {Name: "x", Extensions: []string{"pdf"}, FolderID: &vault.ID},
+		} {
+			if err := classifier.Validate(ctx, &rule); !errors.Is(err, ErrClassificationRuleInvalid) {
+				t.Errorf("%s: expected ErrClassificationRuleInvalid, got %v", name, err)
+			}
+		}
+	})
+
+	t.Run("applies every matching rule in priority order", func(t *testing.T) {
+		t.Cleanup(func() { db.Where("1 = 1").Delete(&models.ClassificationRule{}) })
+		first := add(t, models.ClassificationRule{Name: "Invoices", Priority: 10, NamePattern: "invoice-*", Tags: []string{"finance"}, RetentionClass: "seven-years"})
+		add(t, models.ClassificationRule{Name: "PDFs", Priority: 20, MimeTypes: []string{"application/pdf"}, Tags: []string{"pdf", "finance"}, RetentionClass: "default", FolderID: &contracts.ID})
+		add(t, models.ClassificationRule{Name: "Legal", Priority: 30, GroupIDs: []uuid.UUID{legal.ID}, Scan: true})
+		add(t, models.ClassificationRule{Name: "Images", Priority: 5, MimeTypes: []string{"image/*"}, Tags: []string{"image"}})
+
+		result, err := classifier.Classify(ctx, input("Invoice-2024.PDF", "application/pdf"))
+		if err != nil {
+			t.Fatalf("failed classifying: %v", err)
+		}
+		if len(result.Hits) != 3 || result.Hits[0].RuleID != first.ID {
+			t.Fatalf("expected three hits led by the invoice rule, got %+v", result.Hits)
+		}
+		if !slices.Equal(result.Tags, []string{"finance", "pdf"}) || result.RetentionClass != "seven-years" || !result.Scan {
+			t.Fatalf("unexpected classification %+v", result)
+		}
+		if result.FolderID == nil || *result.FolderID != contracts.ID {
+			t.Fatalf("expected a move into the contracts folder, got %v", result.FolderID)
+		}
+
+		// The detected type counts as much as the declared one.
+		result, _ = classifier.Classify(ctx, ClassificationInput{FileName: "scan.bin", MimeType: "application/octet-stream", DetectedType: "image/png", UploaderID: uuid.New()})
+		if len(result.Hits) != 1 || result.Hits[0].RuleName != "Images" {
+			t.Fatalf("expected only the image rule, got %+v", result.Hits)
+		}
+	})
+
+	t.Run("a blocking rule stops evaluation", func(t *testing.T) {
+		t.Cleanup(func() { db.Where("1 = 1").Delete(&models.ClassificationRule{}) })
+		add(t, models.ClassificationRule{Name: "Tag", Priority: 1, Extensions: []string{"exe"}, Tags: []string{"binary"}})
+		block := add(t, models.ClassificationRule{Name: "No executables", Priority: 2, Extensions: []string{"exe"}, Block: true})
+		add(t, models.ClassificationRule{Name: "Later", Priority: 3, Extensions: []string{"exe"}, Tags: []string{"never"}})
+
+		result, _ := classifier.Classify(ctx, input("setup.EXE", "application/octet-stream"))
+		if result.BlockedBy == nil || result.BlockedBy.RuleID != block.ID || len(result.Hits) != 2 || slices.Contains(result.Tags, "never") {
+			t.Fatalf("unexpected classification %+v", result)
+		}
+
+		db.Model(&block).Update("enabled", false)
+		if result, _ = classifier.Classify(ctx, input("setup.exe", "")); result.BlockedBy != nil || len(result.Hits) != 2 {
+			t.Fatalf("expected disabled rules to be skipped, got %+v", result)
+		}
+	})
+
+	t.Run("does not move files it cannot", func(t *testing.T) {
+		rule := models.ClassificationRule{Name: "Move", Extensions: []string{".docx"}, FolderID: &contracts.ID}
+		otherOrg := uuid.New()
+		in := input("memo.docx", "")
+		in.OrganizationID = &otherOrg
+		result, _ := classifier.Evaluate(ctx, in, []models.ClassificationRule{rule})
+		if result.FolderID != nil || len(result.Hits) != 1 || len(result.Hits[0].Actions) != 0 {
+			t.Fatalf("expected no move across organizations, got %+v", result)
+		}
+
+		in = input("memo.docx", "")
+		in.ParentID = &vault.ID
+		if result, _ = classifier.Evaluate(ctx, in, []models.ClassificationRule{rule}); result.FolderID != nil {
+			t.Fatalf("expected no move out of an encrypted folder, got %+v", result)
+		}
+	})
+
+	t.Run("records hits and quarantines infected files", func(t *testing.T) {
+		file := models.File{Name: "payload.txt", OwnerID: uploader.ID, StoragePath: "classify/payload.txt"}
+		db.Create(&file)
+		store.put(file.StoragePath, "X5O!P%@AP EICAR-STANDARD-ANTIVIRUS-TEST-FILE")
+		result := &Classification{
+			Hits: []RuleHit{{RuleID: uuid.New(), RuleName: "Scan text", Actions: []string{"tag", "scan"}}},
+			Tags: []string{"text"},
+			Scan: true,
+		}
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return classifier.Record(tx, &file, result, AuditEntry{UserID: &uploader.ID})
+		}); err != nil {
+			t.Fatalf("failed recording: %v", err)
+		}
+		var hits int64
+		db.Model(&models.OutboxEvent{}).Where("event_type = ? AND resource_id = ?", "file.classified", file.ID).Count(&hits)
+		if hits != 1 {
+			t.Fatalf("expected one audit entry per hit, got %d", hits)
+		}
+
+		if ran, err := jobs.RunNext(ctx); !ran || err != nil {
+			t.Fatalf("expected the scan job to run, got %v, %v", ran, err)
+		}
+		db.First(&file, "id = ?", file.ID)
+		if file.QuarantinedAt == nil {
+			t.Fatal("expected the infected file to be quarantined")
+		}
+		db.Model(&models.OutboxEvent{}).Where("event_type = ? AND resource_id = ?", "file.scan_infected", file.ID).Count(&hits)
+		if hits != 1 {
+			t.Fatalf("expected the detection to be audited, got %d", hits)
+		}
+	})
+}
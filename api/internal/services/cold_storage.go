@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/storage"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	archiveMoveJob    = "archive.move"
+	archiveRestoreJob = "archive.restore"
+	// archiveBatchSize is how many files one job moves before handing the
+	// rest to the next.
+	archiveBatchSize = 200
+	// archiveRestoreDays is how long a restored copy stays readable at the
+	// provider; the restore job only needs it long enough to copy it back.
+	archiveRestoreDays = 7
+)
+
+var (
+	ErrArchiveNothingToArchive = errors.New("nothing to archive: every file is already archived")
+	ErrFileNotArchived         = errors.New("file is not archived")
+)
+
+// ArchiveBucket is the cold storage side of ColdStorage.
+type ArchiveBucket interface {
+	MirrorBucket
+	// RequestRestore asks for an archived object to be made readable.
+	RequestRestore(ctx context.Context, key string) error
+}
+
+// S3ArchiveBucket adapts a storage client to ArchiveBucket.
+type S3ArchiveBucket struct {
+	S3MirrorBucket
+}
+
+func (b S3ArchiveBucket) RequestRestore(ctx context.Context, key string) error {
+	return b.S3Client.RequestRestore(ctx, key, archiveRestoreDays)
+}
+
+// ArchiveRestore is the answer to a restore request.
+type ArchiveRestore struct {
+	Files int64     `json:"files"`
+	ETA   time.Time `json:"eta"`
+}
+
+// ColdStorage moves the bytes of files users rarely open to a cheaper
+// bucket and back. Archiving queues an archive.move job that copies each
+// file under a folder to Target, marks it archived and removes it from
+// Source; an archived file keeps its row, metadata and thumbnail, but its
+// content cannot be read. A restore asks the provider for the objects and
+// queues an archive.restore job for when they are expected to be readable,
+// RestoreDelay later. The job copies every due file back and retries,
+// with backoff, those the provider has not released yet.
+type ColdStorage struct {
+	DB           *gorm.DB
+	Source       MirrorBucket
+	Target       ArchiveBucket
+	Jobs         *JobRunner
+	RestoreDelay time.Duration
+}
+
+func NewColdStorage(db *gorm.DB, source MirrorBucket, target ArchiveBucket, jobs *JobRunner, restoreDelay time.Duration) *ColdStorage {
+	s := &ColdStorage{DB: db, Source: source, Target: target, Jobs: jobs, RestoreDelay: restoreDelay}
+	jobs.Register(archiveMoveJob, s.runMove, JobOptions{})
+	jobs.Register(archiveRestoreJob, s.runRestore, JobOptions{
+		MaxAttempts: 100,
+		Backoff:     func(int) time.Duration { return 15 * time.Minute },
+	})
+	return s
+}
+
+// Archive queues the files in root, a folder or a single file, for cold
+// storage and returns how many there are.
+func (s *ColdStorage) Archive(ctx context.Context, root *models.File) (int64, error) {
+	ids, err := fileSubtree(ctx, s.DB, root.ID)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	if err := s.DB.WithContext(ctx).Model(&models.File{}).
+		Where("id IN ? AND is_directory = ? AND archived_at IS NULL AND storage_path <> ''", ids, false).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, ErrArchiveNothingToArchive
+	}
+	if _, err := s.Jobs.Enqueue(ctx, archiveMoveJob, map[string]interface{}{"file_id": root.ID.String()}, EnqueueOptions{UniqueKey: "archive:" + root.ID.String()}); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Restore asks for the archived files in root back. Files with a restore
+// already under way keep their ETA; the answer is the latest ETA of all.
+func (s *ColdStorage) Restore(ctx context.Context, root *models.File) (*ArchiveRestore, error) {
+	ids, err := fileSubtree(ctx, s.DB, root.ID)
+	if err != nil {
+		return nil, err
+	}
+	db := s.DB.WithContext(ctx)
+	var files []models.File
+	if err := db.Select("id", "storage_path", "restore_eta").
+		Where("id IN ? AND archived_at IS NOT NULL", ids).
+		Find(&files).Error; err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, ErrFileNotArchived
+	}
+
+	now := time.Now().UTC()
+	eta := now.Add(s.RestoreDelay)
+	result := &ArchiveRestore{Files: int64(len(files))}
+	requested := false
+	for _, f := range files {
+		if f.RestoreETA != nil {
+			if f.RestoreETA.After(result.ETA) {
+				result.ETA = *f.RestoreETA
+			}
+			continue
+		}
+		result.ETA = eta
+		if err := s.Target.RequestRestore(ctx, f.StoragePath); err != nil {
+			return nil, fmt.Errorf("requesting restore of %s: %w", f.ID, err)
+		}
+		if err := db.Model(&models.File{}).Where("id = ?", f.ID).UpdateColumns(map[string]interface{}{
+			"restore_requested_at": now,
+			"restore_eta":          eta,
+		}).Error; err != nil {
+			return nil, err
+		}
+		requested = true
+	}
+	if requested {
+		if _, err := s.Jobs.Enqueue(ctx, archiveRestoreJob, map[string]interface{}{"file_id": root.ID.String()}, EnqueueOptions{RunAt: eta}); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Forget removes the archived copy of a file being deleted.
+func (s *ColdStorage) Forget(ctx context.Context, file *models.File) error {
+	if file.ArchivedAt == nil {
+		return nil
+	}
+	return s.Target.Delete(ctx, file.StoragePath)
+}
+
+func (s *ColdStorage) runMove(ctx context.Context, job *models.Job) error {
+	raw, _ := job.Payload["file_id"].(string)
+	rootID, err := uuid.Parse(raw)
+	if err != nil {
+		return errors.New("archive job without a file_id")
+	}
+	ids, err := fileSubtree(ctx, s.DB, rootID)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(ids); start += archiveBatchSize {
+		var files []models.File
+		if err := s.DB.WithContext(ctx).
+			Where("id IN ? AND is_directory = ? AND archived_at IS NULL AND storage_path <> ''", ids[start:min(start+archiveBatchSize, len(ids))], false).
+			Find(&files).Error; err != nil {
+			return err
+		}
+		for i := range files {
+			if err := s.moveOut(ctx, &files[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// moveOut copies one file to the archive and drops it from the source. A
+// file deleted or rewritten while it was being copied stays where it is.
+func (s *ColdStorage) moveOut(ctx context.Context, file *models.File) error {
+	key := file.StoragePath
+	info, err := s.Source.Stat(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return nil
+		}
+		return err
+	}
+	obj, err := s.Source.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	err = s.Target.Upload(ctx, key, obj, info.Size, file.MimeType)
+	obj.Close()
+	if err != nil {
+		return err
+	}
+
+	db := s.DB.WithContext(ctx)
+	result := db.Model(&models.File{}).
+		Where("id = ? AND storage_path = ? AND archived_at IS NULL", file.ID, key).
+		UpdateColumn("archived_at", time.Now().UTC())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return s.Target.Delete(ctx, key)
+	}
+	if after, err := s.Source.Stat(ctx, key); err != nil || after.Size != info.Size || !after.LastModified.Equal(info.LastModified) {
+		if err := db.Model(&models.File{}).Where("id = ?", file.ID).UpdateColumn("archived_at", nil).Error; err != nil {
+			return err
+		}
+		return s.Target.Delete(ctx, key)
+	}
+	return s.Source.Delete(ctx, key)
+}
+
+// runRestore copies back every file whose restore is due. Files the
+// provider has not released yet fail the job, which is retried later.
+func (s *ColdStorage) runRestore(ctx context.Context, _ *models.Job) error {
+	var files []models.File
+	if err := s.DB.WithContext(ctx).
+		Where("archived_at IS NOT NULL AND restore_eta IS NOT NULL AND restore_eta <= ?", time.Now().UTC()).
+		Order("restore_eta ASC").
+		Limit(archiveBatchSize).
+		Find(&files).Error; err != nil {
+		return err
+	}
+	var failed error
+	for i := range files {
+		if err := s.moveBack(ctx, &files[i]); err != nil {
+			logger.Warn("archive_restore_pending", map[string]interface{}{
+				"file_id": files[i].ID.String(),
+				"error":   err.Error(),
+			})
+			failed = err
+		}
+	}
+	if failed != nil {
+		return failed
+	}
+	if len(files) == archiveBatchSize {
+		_, err := s.Jobs.Enqueue(ctx, archiveRestoreJob, map[string]interface{}{}, EnqueueOptions{})
+		return err
+	}
+	return nil
+}
+
+func (s *ColdStorage) moveBack(ctx context.Context, file *models.File) error {
+	key := file.StoragePath
+	info, err := s.Target.Stat(ctx, key)
+	if err != nil {
+		return err
+	}
+	obj, err := s.Target.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	err = s.Source.Upload(ctx, key, obj, info.Size, file.MimeType)
+	obj.Close()
+	if err != nil {
+		return err
+	}
+	if err := s.DB.WithContext(ctx).Model(&models.File{}).Where("id = ?", file.ID).UpdateColumns(map[string]interface{}{
+		"archived_at":          nil,
+		"restore_requested_at": nil,
+		"restore_eta":          nil,
+	}).Error; err != nil {
+		return err
+	}
+	return s.Target.Delete(ctx, key)
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// coldBucket is an archive bucket whose objects cannot be read until a
+// restore was requested and the provider released them.
+type coldBucket struct {
+	*memoryBucket
+	requested map[string]bool
+	released  bool
+}
+
+func (b *coldBucket) RequestRestore(_ context.Context, key string) error {
+	b.requested[key] = true
+	return nil
+}
+
+func (b *coldBucket) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if !b.requested[key] || !b.released {
+		return nil, errors.New("InvalidObjectState")
+	}
+	return b.memoryBucket.Get(ctx, key)
+}
+
+func TestColdStorage(t *testing.T) {
+	logger.Init()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.File{}, &models.Job{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+
+	owner := models.User{Email: "cold@test.com", FirstName: "C", LastName: "S", PasswordHash: "x"}
+	db.Create(&owner)
+	source := newMemoryBucket()
+	target := &coldBucket{memoryBucket: newMemoryBucket(), requested: map[string]bool{}}
+	jobs := NewJobRunner(db, config.JobsConfig{})
+	cold := NewColdStorage(db, source, target, jobs, time.Hour)
+	ctx := context.Background()
+
+	folder := models.File{Name: "2019", MimeType: "inode/directory", IsDirectory: true, OwnerID: owner.ID}
+	db.Create(&folder)
+	var files []models.File
+	for _, name := range []string{"a.txt", "b.txt"} {
+		f := models.File{Name: name, MimeType: "text/plain", Size: 5, OwnerID: owner.ID, ParentID: &folder.ID, StoragePath: owner.ID.String() + "/" + name}
+		db.Create(&f)
+		source.put(f.StoragePath, "hello")
+		files = append(files, f)
+	}
+	drain := func() {
+		t.Helper()
+		for {
+			ran, err := jobs.RunNext(ctx)
+			if err != nil {
+				t.Fatalf("job failed: %v", err)
+			}
+			if !ran {
+				return
+			}
+		}
+	}
+	reload := func(f models.File) models.File {
+		var out models.File
+		db.First(&out, "id = ?", f.ID)
+		return out
+	}
+
+	t.Run("archive moves the bytes out", func(t *testing.T) {
+		if _, err := cold.Restore(ctx, &folder); !errors.Is(err, ErrFileNotArchived) {
+			t.Fatalf("expected ErrFileNotArchived before archiving, got %v", err)
+		}
+		count, err := cold.Archive(ctx, &folder)
+		if err != nil || count != 2 {
+			t.Fatalf("expected two files queued, got %d (%v)", count, err)
+		}
+		drain()
+		for _, f := range files {
+			if reload(f).ArchivedAt == nil {
+				t.Fatalf("expected %s to be archived", f.Name)
+			}
+			if _, ok := source.objects[f.StoragePath]; ok {
+				t.Fatalf("expected %s to be gone from the source", f.Name)
+			}
+			if _, ok := target.objects[f.StoragePath]; !ok {
+				t.Fatalf("expected %s in the archive", f.Name)
+			}
+		}
+		if _, err := cold.Archive(ctx, &folder); !errors.Is(err, ErrArchiveNothingToArchive) {
+			t.Fatalf("expected ErrArchiveNothingToArchive, got %v", err)
+		}
+	})
+
+	t.Run("restore waits for the provider", func(t *testing.T) {
+		before := time.Now()
+		restore, err := cold.Restore(ctx, &folder)
+		if err != nil {
+			t.Fatalf("failed requesting restore: %v", err)
+		}
+		if restore.Files != 2 || restore.ETA.Before(before.Add(time.Hour-time.Minute)) {
+			t.Fatalf("unexpected restore %+v", restore)
+		}
+		if !target.requested[files[0].StoragePath] || reload(files[0]).RestoreETA == nil {
+			t.Fatal("expected the restore to be requested and recorded")
+		}
+		// Asking again keeps the ETA and queues nothing new.
+		again, err := cold.Restore(ctx, &files[0])
+		if err != nil || !again.ETA.Equal(restore.ETA) {
+			t.Fatalf("expected the same ETA, got %+v (%v)", again, err)
+		}
+
+		// Bring the ETA forward; the provider has not released the
+		// objects yet, so the job fails and keeps them archived.
+		db.Model(&models.File{}).Where("restore_eta IS NOT NULL").UpdateColumn("restore_eta", time.Now().Add(-time.Minute))
+		db.Model(&models.Job{}).Where("kind = ?", archiveRestoreJob).Update("run_at", time.Now().Add(-time.Minute))
+		if ran, err := jobs.RunNext(ctx); !ran || err != nil {
+			t.Fatalf("expected the restore job to run, got %v %v", ran, err)
+		}
+		if reload(files[0]).ArchivedAt == nil {
+			t.Fatal("expected the file to stay archived until released")
+		}
+
+		target.released = true
+		db.Model(&models.Job{}).Where("kind = ?", archiveRestoreJob).Update("run_at", time.Now().Add(-time.Minute))
+		drain()
+		for _, f := range files {
+			got := reload(f)
+			if got.ArchivedAt != nil || got.RestoreETA != nil || got.RestoreRequestedAt != nil {
+				t.Fatalf("expected %s to be restored, got %+v", f.Name, got)
+			}
+			if string(source.objects[f.StoragePath]) != "hello" {
+				t.Fatalf("expected %s back in the source", f.Name)
+			}
+			if _, ok := target.objects[f.StoragePath]; ok {
+				t.Fatalf("expected %s to be gone from the archive", f.Name)
+			}
+		}
+	})
+}
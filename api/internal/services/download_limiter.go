@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// bandwidthChunk caps a single read from a limited stream, so a throttled
+// download trickles out steadily instead of in bursts of whatever buffer
+// size the HTTP server happens to use.
+const bandwidthChunk = 32 * 1024
+
+// tokenBucket meters bytes at rate per second. Readers take tokens after
+// reading, which may drive the balance negative; the reader then sleeps
+// until it is paid back. Tokens accumulate up to one second's worth.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+	// refs counts the open streams using the bucket, so idle per-user and
+	// per-share buckets can be dropped.
+	refs int
+}
+
+func newTokenBucket(bytesPerSec int64) *tokenBucket {
+	return &tokenBucket{rate: float64(bytesPerSec), tokens: float64(bytesPerSec), last: time.Now()}
+}
+
+// take spends n tokens and reports how long the caller must wait before the
+// balance is back to zero.
+func (b *tokenBucket) take(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) setRate(bytesPerSec int64) {
+	b.mu.Lock()
+	b.rate = float64(bytesPerSec)
+	b.mu.Unlock()
+}
+
+// DownloadLimiter throttles file downloads so large public downloads cannot
+// saturate the server's uplink. A stream is held to the tightest of three
+// caps: one shared by every download, one per downloader (a user, or an IP
+// address for anonymous downloads) and one per share. Groups with a
+// DownloadRateKBps override replace the per-user cap for their members.
+type DownloadLimiter struct {
+	DB  *gorm.DB
+	cfg config.DownloadLimitsConfig
+
+	global *tokenBucket
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func NewDownloadLimiter(db *gorm.DB, cfg config.DownloadLimitsConfig) *DownloadLimiter {
+	l := &DownloadLimiter{DB: db, cfg: cfg, buckets: map[string]*tokenBucket{}}
+	if cfg.GlobalKBps > 0 {
+		l.global = newTokenBucket(cfg.GlobalKBps * 1024)
+	}
+	return l
+}
+
+// Download identifies who is downloading and through which share.
+type Download struct {
+	UserID    *uuid.UUID
+	IPAddress string
+	ShareID   *uuid.UUID
+}
+
+// Limit wraps r so that reading it honours the caps that apply to d. r is
+// returned unchanged when none do.
+func (l *DownloadLimiter) Limit(ctx context.Context, r io.ReadCloser, d Download) io.ReadCloser {
+	if l == nil {
+		return r
+	}
+
+	var keys []string
+	var buckets []*tokenBucket
+	if rate := l.userRate(ctx, d.UserID); rate > 0 {
+		key := "ip:" + d.IPAddress
+		if d.UserID != nil {
+			key = "user:" + d.UserID.String()
+		}
+		keys = append(keys, key)
+		buckets = append(buckets, l.acquire(key, rate*1024))
+	}
+	if d.ShareID != nil && l.cfg.ShareKBps > 0 {
+		key := "share:" + d.ShareID.String()
+		keys = append(keys, key)
+		buckets = append(buckets, l.acquire(key, l.cfg.ShareKBps*1024))
+	}
+	if l.global != nil {
+		buckets = append(buckets, l.global)
+	}
+	if len(buckets) == 0 {
+		return r
+	}
+	return &limitedReader{r: r, limiter: l, keys: keys, buckets: buckets, done: make(chan struct{})}
+}
+
+// Limited reports whether any cap applies to d, in which case the bytes
+// have to pass through Limit rather than go straight from storage.
+func (l *DownloadLimiter) Limited(ctx context.Context, d Download) bool {
+	if l == nil {
+		return false
+	}
+	return l.global != nil || (d.ShareID != nil && l.cfg.ShareKBps > 0) || l.userRate(ctx, d.UserID) > 0
+}
+
+// userRate is the per-user cap in KB/s for userID, zero meaning unlimited.
+// Members of groups with an override get the most generous of them.
+func (l *DownloadLimiter) userRate(ctx context.Context, userID *uuid.UUID) int64 {
+	if userID == nil {
+		return l.cfg.UserKBps
+	}
+	var overrides []int64
+	if err := l.DB.WithContext(ctx).Model(&models.Group{}).
+		Joins("JOIN group_memberships ON group_memberships.group_id = groups.id").
+		Where("group_memberships.user_id = ? AND groups.download_rate_kbps IS NOT NULL", *userID).
+		Pluck("groups.download_rate_kbps", &overrides).Error; err != nil || len(overrides) == 0 {
+		return l.cfg.UserKBps
+	}
+	best := overrides[0]
+	for _, rate := range overrides[1:] {
+		if best == 0 || rate == 0 {
+			best = 0
+			continue
+		}
+		if rate > best {
+			best = rate
+		}
+	}
+	return best
+}
+
+// acquire returns the bucket for key, creating it on first use. A bucket
+// already in use by other streams takes the new rate, so an admin's
+// override applies to the next read rather than the next download.
+func (l *DownloadLimiter) acquire(key string, bytesPerSec int64) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = newTokenBucket(bytesPerSec)
+		l.buckets[key] = b
+	} else {
+		b.setRate(bytesPerSec)
+	}
+	b.refs++
+	return b
+}
+
+func (l *DownloadLimiter) release(keys []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if b, ok := l.buckets[key]; ok {
+			b.refs--
+			if b.refs <= 0 {
+				delete(l.buckets, key)
+			}
+		}
+	}
+}
+
+type limitedReader struct {
+	r       io.ReadCloser
+	limiter *DownloadLimiter
+	keys    []string
+	buckets []*tokenBucket
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > bandwidthChunk {
+		p = p[:bandwidthChunk]
+	}
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		var wait time.Duration
+		for _, b := range lr.buckets {
+			if d := b.take(n); d > wait {
+				wait = d
+			}
+		}
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-lr.done:
+				timer.Stop()
+			}
+		}
+	}
+	return n, err
+}
+
+// Close releases the stream's buckets. The HTTP server calls it when the
+// response finishes or the client goes away, which also ends any wait in
+// progress.
+func (lr *limitedReader) Close() error {
+	lr.closeOnce.Do(func() {
+		close(lr.done)
+		lr.limiter.release(lr.keys)
+	})
+	return lr.r.Close()
+}
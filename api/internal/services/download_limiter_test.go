@@ -0,0 +1,101 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func setupDownloadLimiterTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Group{}, &models.GroupMembership{}); err != nil {
+		t.Fatalf("failed automigrating models: %v", err)
+	}
+	return db
+}
+
+func TestDownloadLimiter_Throttles(t *testing.T) {
+	limiter := NewDownloadLimiter(setupDownloadLimiterTestDB(t), config.DownloadLimitsConfig{ShareKBps: 1024})
+	shareID := uuid.New()
+
+	body := io.NopCloser(bytes.NewReader(make([]byte, 1536*1024)))
+	r := limiter.Limit(context.Background(), body, Download{IPAddress: "203.0.113.1", ShareID: &shareID})
+
+	start := time.Now()
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	// One second's worth is available immediately; the remaining half
+	// megabyte has to wait for the bucket to refill.
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("expected roughly half a second at 1 MB/s, took %v", elapsed)
+	}
+
+	if len(limiter.buckets) != 1 {
+		t.Fatalf("expected a bucket for the share while streaming, got %d", len(limiter.buckets))
+	}
+	r.Close()
+	if len(limiter.buckets) != 0 {
+		t.Fatalf("expected the share's bucket to be dropped once idle, got %d", len(limiter.buckets))
+	}
+}
+
+func TestDownloadLimiter_Unlimited(t *testing.T) {
+	limiter := NewDownloadLimiter(setupDownloadLimiterTestDB(t), config.DownloadLimitsConfig{})
+	body := io.NopCloser(bytes.NewReader(nil))
+	if r := limiter.Limit(context.Background(), body, Download{IPAddress: "203.0.113.1"}); r != body {
+		t.Fatal("expected the stream to be returned unwrapped without caps")
+	}
+}
+
+func TestDownloadLimiter_GroupOverrides(t *testing.T) {
+	db := setupDownloadLimiterTestDB(t)
+	limiter := NewDownloadLimiter(db, config.DownloadLimitsConfig{UserKBps: 512})
+	ctx := context.Background()
+
+	user := models.User{Email: "premium@test.com", PasswordHash: "x", FirstName: "P", LastName: "U", Role: models.UserRoleUser}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed creating user: %v", err)
+	}
+	if got := limiter.userRate(ctx, &user.ID); got != 512 {
+		t.Fatalf("expected the default cap without overrides, got %d", got)
+	}
+
+	join := func(rate *int64) {
+		t.Helper()
+		group := models.Group{Name: "g", CreatedByID: user.ID, DownloadRateKBps: rate}
+		if err := db.Create(&group).Error; err != nil {
+			t.Fatalf("failed creating group: %v", err)
+		}
+		if err := db.Create(&models.GroupMembership{GroupID: group.ID, UserID: user.ID, Role: models.GroupRoleMember}).Error; err != nil {
+			t.Fatalf("failed creating membership: %v", err)
+		}
+	}
+	fast, faster, unlimited := int64(2048), int64(4096), int64(0)
+
+	join(nil)
+	join(&fast)
+	join(&faster)
+	if got := limiter.userRate(ctx, &user.ID); got != faster {
+		t.Fatalf("expected the most generous override, got %d", got)
+	}
+	join(&unlimited)
+	if got := limiter.userRate(ctx, &user.ID); got != 0 {
+		t.Fatalf("expected an unlimited override to win, got %d", got)
+	}
+	if got := limiter.userRate(ctx, nil); got != 512 {
+		t.Fatalf("expected anonymous downloads to get the default cap, got %d", got)
+	}
+}
@@ -0,0 +1,474 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxDueDateReminders bounds the reminders one due date can have.
+	MaxDueDateReminders = 5
+	// MaxDueDateReminderHours is the longest a reminder can be sent ahead
+	// of its due date.
+	MaxDueDateReminderHours = 365 * 24
+	// MaxDueDateNoteLength bounds due date notes, in characters.
+	MaxDueDateNoteLength = 500
+
+	dueReminderJob      = "files.due_reminders"
+	dueReminderInterval = 5 * time.Minute
+	dueReminderBatch    = 200
+)
+
+var (
+	ErrDueDateNotFound = errors.New("no due date is set")
+	// ErrDueDateInvalid is wrapped with the reason a due date was refused.
+	ErrDueDateInvalid      = errors.New("invalid due date")
+	ErrCalendarFeedInvalid = errors.New("calendar feed not found")
+)
+
+// DueDates keeps the due dates of files and folders and reminds people of
+// them: the owner of the file and whoever set the date get an activity,
+// and an email when that is configured, each time a reminder comes due.
+// Users can also subscribe to their due dates as a calendar feed.
+type DueDates struct {
+	DB     *gorm.DB
+	Access *AccessService
+	// Mailer is nil when email is not configured.
+	Mailer Mailer
+	Config config.DueDatesConfig
+	// BaseURL is the web app's address, used for links to files.
+	BaseURL string
+}
+
+func NewDueDates(db *gorm.DB, access *AccessService, mailer Mailer, cfg config.DueDatesConfig, baseURL string) *DueDates {
+	return &DueDates{DB: db, Access: access, Mailer: mailer, Config: cfg, BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// Get returns the due date of fileID.
+func (d *DueDates) Get(ctx context.Context, fileID uuid.UUID) (*models.FileDueDate, error) {
+	var due models.FileDueDate
+	if err := d.DB.WithContext(ctx).Preload("SetBy").First(&due, "file_id = ?", fileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDueDateNotFound
+		}
+		return nil, err
+	}
+	due.Overdue = due.DueAt.Before(time.Now())
+	return &due, nil
+}
+
+// Set gives file a due date, replacing the one it had. Reminders are sent
+// reminderHours before dueAt; nil means the configured defaults, and an
+// empty list none at all. Reminders whose time has already passed are not
+// sent.
+func (d *DueDates) Set(ctx context.Context, file *models.File, dueAt time.Time, reminderHours []int, note string, entry AuditEntry) (*models.FileDueDate, error) {
+	now := time.Now().UTC()
+	dueAt = dueAt.UTC().Truncate(time.Second)
+	if !dueAt.After(now) {
+		return nil, fmt.Errorf("%w: the due date must be in the future", ErrDueDateInvalid)
+	}
+	note = strings.TrimSpace(note)
+	if utf8.RuneCountInString(note) > MaxDueDateNoteLength {
+		return nil, fmt.Errorf("%w: note must be at most %d characters", ErrDueDateInvalid, MaxDueDateNoteLength)
+	}
+	if reminderHours == nil {
+		reminderHours = d.Config.ReminderHours
+	}
+	hours, err := normalizeReminderHours(reminderHours)
+	if err != nil {
+		return nil, err
+	}
+
+	due := models.FileDueDate{
+		FileID:         file.ID,
+		DueAt:          dueAt,
+		Note:           note,
+		ReminderHours:  hours,
+		NextReminderAt: nextReminder(dueAt, hours, now),
+		SetByID:        *entry.UserID,
+	}
+	err = d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Updating in place keeps the ID, which calendar feeds use to
+		// recognise the event.
+		var existing models.FileDueDate
+		err := tx.Where("file_id = ?", file.ID).First(&existing).Error
+		switch {
+		case err == nil:
+			due.ID, due.CreatedAt = existing.ID, existing.CreatedAt
+			if err := tx.Model(&existing).
+				Select("due_at", "note", "reminder_hours", "next_reminder_at", "set_by_id").
+				Updates(&due).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := tx.Create(&due).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		details := map[string]interface{}{
+			"file_name":      file.Name,
+			"due_at":         dueAt.Format(time.RFC3339),
+			"reminder_hours": hours,
+		}
+		if note != "" {
+			details["note"] = note
+		}
+		entry.Action, entry.ResourceType, entry.ResourceID, entry.Details = "file.due_date_set", "file", &file.ID, details
+		return RecordEvent(tx, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &due, nil
+}
+
+// Clear removes file's due date and its pending reminders.
+func (d *DueDates) Clear(ctx context.Context, file *models.File, entry AuditEntry) error {
+	return d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("file_id = ?", file.ID).Delete(&models.FileDueDate{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrDueDateNotFound
+		}
+		entry.Action, entry.ResourceType, entry.ResourceID = "file.due_date_clear", "file", &file.ID
+		entry.Details = map[string]interface{}{"file_name": file.Name}
+		return RecordEvent(tx, entry)
+	})
+}
+
+// normalizeReminderHours checks lead times and sorts them longest first.
+func normalizeReminderHours(hours []int) ([]int, error) {
+	seen := make(map[int]bool, len(hours))
+	out := make([]int, 0, len(hours))
+	for _, h := range hours {
+		if h < 0 || h > MaxDueDateReminderHours {
+			return nil, fmt.Errorf("%w: reminders must be between 0 and %d hours ahead", ErrDueDateInvalid, MaxDueDateReminderHours)
+		}
+		if !seen[h] {
+			seen[h] = true
+			out = append(out, h)
+		}
+	}
+	if len(out) > MaxDueDateReminders {
+		return nil, fmt.Errorf("%w: at most %d reminders", ErrDueDateInvalid, MaxDueDateReminders)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(out)))
+	return out, nil
+}
+
+// nextReminder is the first reminder for dueAt after after, or nil when
+// none is left.
+func nextReminder(dueAt time.Time, hours []int, after time.Time) *time.Time {
+	var next *time.Time
+	for _, h := range hours {
+		at := dueAt.Add(-time.Duration(h) * time.Hour)
+		if at.After(after) && (next == nil || at.Before(*next)) {
+			next = &at
+		}
+	}
+	return next
+}
+
+// Schedule registers the reminder sweep.
+func (d *DueDates) Schedule(jobs *JobRunner) {
+	jobs.Every(dueReminderJob, dueReminderInterval, func(ctx context.Context, _ *models.Job) error {
+		_, err := d.Run(ctx, time.Now().UTC())
+		return err
+	})
+}
+
+// Run sends the reminders due by now and returns how many due dates it
+// reminded people of. Reminders missed while no sweep ran are folded into
+// one.
+func (d *DueDates) Run(ctx context.Context, now time.Time) (int, error) {
+	var due []models.FileDueDate
+	var found []models.FileDueDate
+	err := d.DB.WithContext(ctx).
+		Preload("File").
+		Where("next_reminder_at IS NOT NULL AND next_reminder_at <= ?", now).
+		FindInBatches(&due, dueReminderBatch, func(*gorm.DB, int) error {
+			found = append(found, due...)
+			return nil
+		}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range found {
+		ok, err := d.remind(ctx, &found[i], now)
+		if err != nil {
+			return sent, fmt.Errorf("reminding of due date %s: %w", found[i].ID, err)
+		}
+		if ok {
+			sent++
+		}
+	}
+	if sent > 0 {
+		logger.Info("due_date_reminders_sent", map[string]interface{}{"due_dates": sent})
+	}
+	return sent, nil
+}
+
+// remind claims one due reminder, moving the due date on to its next one,
+// and tells the people concerned. Once claimed the next reminder is later
+// than now, so another worker sweeping at the same time skips it.
+func (d *DueDates) remind(ctx context.Context, due *models.FileDueDate, now time.Time) (bool, error) {
+	next := nextReminder(due.DueAt, due.ReminderHours, now)
+	// Reminders for a deleted file are dropped along with it.
+	if due.File == nil {
+		next = nil
+	}
+	result := d.DB.WithContext(ctx).Model(&models.FileDueDate{}).
+		Where("id = ? AND next_reminder_at <= ?", due.ID, now).
+		UpdateColumn("next_reminder_at", next)
+	if result.Error != nil || result.RowsAffected == 0 || due.File == nil {
+		return false, result.Error
+	}
+
+	recipients := d.recipients(ctx, due)
+	when := due.DueAt.UTC().Format("2006-01-02 15:04 MST")
+	err := d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := RecordEvent(tx, AuditEntry{
+			Action:       "file.due_reminder",
+			ResourceType: "file",
+			ResourceID:   &due.FileID,
+			Details: map[string]interface{}{
+				"file_name": due.File.Name,
+				"due_at":    due.DueAt.UTC().Format(time.RFC3339),
+				"owner_id":  due.File.OwnerID.String(),
+				"set_by_id": due.SetByID.String(),
+			},
+		}); err != nil {
+			return err
+		}
+		if len(recipients) == 0 {
+			return nil
+		}
+		activities := make([]models.Activity, 0, len(recipients))
+		for _, u := range recipients {
+			activities = append(activities, *newActivity(models.Activity{
+				UserID:        u.ID,
+				ActorID:       u.ID,
+				Action:        "file.due_reminder",
+				ResourceType:  "file",
+				ResourceID:    &due.FileID,
+				ResourceName:  due.File.Name,
+				MessageKey:    "activity.due.reminder",
+				MessageParams: map[string]string{"name": due.File.Name, "date": when},
+			}))
+		}
+		return tx.Create(&activities).Error
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if d.Mailer != nil && d.Config.Email {
+		for _, u := range recipients {
+			d.email(u.Email, due, when)
+		}
+	}
+	return true, nil
+}
+
+// recipients are the file's owner and whoever set the due date, if they
+// can still see the file, less those who turned due date reminders off.
+func (d *DueDates) recipients(ctx context.Context, due *models.FileDueDate) []models.User {
+	ids := []uuid.UUID{due.File.OwnerID}
+	if due.SetByID != due.File.OwnerID && d.Access.HasAccess(ctx, due.SetByID, due.FileID, models.SharePermissionView) {
+		ids = append(ids, due.SetByID)
+	}
+	var off []uuid.UUID
+	if err := d.DB.WithContext(ctx).Model(&models.NotificationPreference{}).
+		Where("user_id IN ? AND action = ? AND enabled = ?", ids, "file.due_reminder", false).
+		Pluck("user_id", &off).Error; err != nil {
+		logger.Error("notification_preferences_lookup_failed", err, map[string]interface{}{"action": "file.due_reminder"})
+	}
+	var users []models.User
+	query := d.DB.WithContext(ctx).Where("id IN ?", ids)
+	if len(off) > 0 {
+		query = query.Where("id NOT IN ?", off)
+	}
+	if err := query.Find(&users).Error; err != nil {
+		logger.Error("due_reminder_recipients_failed", err, map[string]interface{}{"file_id": due.FileID.String()})
+	}
+	return users
+}
+
+func (d *DueDates) email(to string, due *models.FileDueDate, when string) {
+	body := fmt.Sprintf("%q is due on %s.\n", due.File.Name, when)
+	if due.Note != "" {
+		body += "\n" + due.Note + "\n"
+	}
+	if d.BaseURL != "" {
+		body += "\n" + d.fileURL(due.FileID) + "\n"
+	}
+	body += "\nYou can turn these reminders off in your notification settings.\n"
+	subject := "Reminder: " + strings.NewReplacer("\r", " ", "\n", " ").Replace(due.File.Name) + " is due " + when
+	if err := d.Mailer.Send(to, subject, body); err != nil {
+		logger.Error("due_reminder_email_failed", err, map[string]interface{}{
+			"file_id": due.FileID.String(),
+		})
+	}
+}
+
+func (d *DueDates) fileURL(fileID uuid.UUID) string {
+	return d.BaseURL + "/files/" + fileID.String()
+}
+
+// IssueFeed gives entry.UserID a new calendar feed token, which replaces
+// any earlier one. Only its hash is kept.
+func (d *DueDates) IssueFeed(ctx context.Context, entry AuditEntry) (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := "dsc_" + hex.EncodeToString(raw)
+	err := d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", *entry.UserID).Delete(&models.CalendarFeed{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.CalendarFeed{UserID: *entry.UserID, TokenHash: hashCalendarToken(token)}).Error; err != nil {
+			return err
+		}
+		entry.Action, entry.ResourceType, entry.ResourceID = "user.calendar_feed_issue", "user", entry.UserID
+		return RecordEvent(tx, entry)
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RevokeFeed stops entry.UserID's calendar feed.
+func (d *DueDates) RevokeFeed(ctx context.Context, entry AuditEntry) error {
+	return d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("user_id = ?", *entry.UserID).Delete(&models.CalendarFeed{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCalendarFeedInvalid
+		}
+		entry.Action, entry.ResourceType, entry.ResourceID = "user.calendar_feed_revoke", "user", entry.UserID
+		return RecordEvent(tx, entry)
+	})
+}
+
+// FeedUser returns the active user a calendar feed token belongs to.
+func (d *DueDates) FeedUser(ctx context.Context, token string) (*models.User, error) {
+	var feed models.CalendarFeed
+	if err := d.DB.WithContext(ctx).First(&feed, "token_hash = ?", hashCalendarToken(token)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCalendarFeedInvalid
+		}
+		return nil, err
+	}
+	var user models.User
+	if err := d.DB.WithContext(ctx).First(&user, "id = ?", feed.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCalendarFeedInvalid
+		}
+		return nil, err
+	}
+	if user.IsSuspended() {
+		return nil, ErrCalendarFeedInvalid
+	}
+	d.DB.WithContext(ctx).Model(&feed).UpdateColumn("last_used_at", time.Now().UTC())
+	return &user, nil
+}
+
+func hashCalendarToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Calendar renders due dates as an iCalendar (RFC 5545) feed: one event
+// per due date, with an alarm for each of its reminders. Their files must
+// be loaded.
+func (d *DueDates) Calendar(dues []models.FileDueDate) []byte {
+	var b strings.Builder
+	line := func(name, value string) {
+		writeICalLine(&b, name+":"+value)
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//DocShare//Due dates//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", "DocShare due dates")
+	for _, due := range dues {
+		if due.File == nil {
+			continue
+		}
+		line("BEGIN", "VEVENT")
+		line("UID", due.ID.String()+"@docshare")
+		line("DTSTAMP", icalTime(due.UpdatedAt))
+		line("DTSTART", icalTime(due.DueAt))
+		line("SUMMARY", icalText("Due: "+due.File.Name))
+		if due.Note != "" {
+			line("DESCRIPTION", icalText(due.Note))
+		}
+		if d.BaseURL != "" {
+			line("URL", d.fileURL(due.FileID))
+		}
+		for _, h := range due.ReminderHours {
+			line("BEGIN", "VALARM")
+			line("ACTION", "DISPLAY")
+			line("DESCRIPTION", icalText(due.File.Name+" is due"))
+			line("TRIGGER", fmt.Sprintf("-PT%dH", h))
+			line("END", "VALARM")
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return []byte(b.String())
+}
+
+func icalTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// icalText escapes a TEXT value.
+func icalText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// writeICalLine writes a content line folded at 75 octets, without
+// splitting a UTF-8 sequence.
+func writeICalLine(b *strings.Builder, s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines start with a space, which counts.
+		limit = 74
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+)
+
+type mailRecorder struct {
+	to []string
+}
+
+func (m *mailRecorder) Send(to, subject, body string) error {
+	m.to = append(m.to, to)
+	return nil
+}
+
+func TestDueDates(t *testing.T) {
+	db := setupAuditTestDB(t)
+	if err := db.AutoMigrate(&models.OutboxEvent{}, &models.FileDueDate{}, &models.CalendarFeed{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+	ctx := context.Background()
+	mail := &mailRecorder{}
+	dueDates := NewDueDates(db, NewAccessService(db), mail, config.DueDatesConfig{ReminderHours: []int{24, 168}, Email: true}, "https://docs.example.com/")
+
+	newUser := func(first string) models.User {
+		u := models.User{Email: first + "@test.com", PasswordHash: "hash", FirstName: first, LastName: "Test", Role: models.UserRoleUser}
+		if err := db.Create(&u).Error; err != nil {
+			t.Fatalf("failed creating user: %v", err)
+		}
+		return u
+	}
+	owner, editor := newUser("owner"), newUser("editor")
+	report := models.File{Name: "Q3 report, final.docx", MimeType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document", OwnerID: owner.ID}
+	db.Create(&report)
+	db.Create(&models.Share{FileID: report.ID, SharedByID: owner.ID, SharedWithUserID: &editor.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionEdit})
+	as := func(u models.User) AuditEntry { return AuditEntry{UserID: &u.ID} }
+	reminders := func(userID interface{}) int64 {
+		var n int64
+		db.Model(&models.Activity{}).Where("user_id = ? AND action = ?", userID, "file.due_reminder").Count(&n)
+		return n
+	}
+
+	t.Run("invalid due dates", func(t *testing.T) {
+		future := time.Now().Add(48 * time.Hour)
+		for name, tc := range map[string]struct {
+			dueAt time.Time
+			hours []int
+		}{
+			"past":          {time.Now().Add(-time.Hour), nil},
+			"too many":      {future, []int{1, 2, 3, 4, 5, 6}},
+			"negative lead": {future, []int{-1}},
+			"lead too long": {future, []int{MaxDueDateReminderHours + 1}},
+		} {
+			if _, err := dueDates.Set(ctx, &report, tc.dueAt, tc.hours, "", as(editor)); !errors.Is(err, ErrDueDateInvalid) {
+				t.Errorf("%s: expected ErrDueDateInvalid, got %v", name, err)
+			}
+		}
+	})
+
+	dueAt := time.Now().UTC().Add(10 * 24 * time.Hour).Truncate(time.Second)
+	first, err := dueDates.Set(ctx, &report, dueAt.Add(time.Hour), []int{1}, "", as(owner))
+	if err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	due, err := dueDates.Set(ctx, &report, dueAt, nil, "Send to the board", as(editor))
+	if err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if due.ID != first.ID || len(due.ReminderHours) != 2 || due.ReminderHours[0] != 168 {
+		t.Fatalf("expected the due date replaced in place with the default reminders, got %+v", due)
+	}
+	if want := dueAt.Add(-168 * time.Hour); due.NextReminderAt == nil || !due.NextReminderAt.Equal(want) {
+		t.Fatalf("expected the first reminder at %v, got %v", want, due.NextReminderAt)
+	}
+
+	t.Run("reminders go out once each", func(t *testing.T) {
+		if sent, err := dueDates.Run(ctx, dueAt.Add(-169*time.Hour)); err != nil || sent != 0 {
+			t.Fatalf("expected nothing due yet, got %d, %v", sent, err)
+		}
+		at := dueAt.Add(-168 * time.Hour)
+		if sent, err := dueDates.Run(ctx, at); err != nil || sent != 1 {
+			t.Fatalf("expected one reminder, got %d, %v", sent, err)
+		}
+		if reminders(owner.ID) != 1 || reminders(editor.ID) != 1 || len(mail.to) != 2 {
+			t.Fatalf("expected owner and editor reminded, got %d, %d, %v", reminders(owner.ID), reminders(editor.ID), mail.to)
+		}
+		if sent, _ := dueDates.Run(ctx, at); sent != 0 {
+			t.Fatalf("expected the reminder sent only once, got %d", sent)
+		}
+		var stored models.FileDueDate
+		db.First(&stored, "id = ?", due.ID)
+		if want := dueAt.Add(-24 * time.Hour); stored.NextReminderAt == nil || !stored.NextReminderAt.Equal(want) {
+			t.Fatalf("expected the next reminder at %v, got %v", want, stored.NextReminderAt)
+		}
+	})
+
+	t.Run("turned-off reminders are not sent", func(t *testing.T) {
+		db.Create(&models.NotificationPreference{UserID: owner.ID, Action: "file.due_reminder", Enabled: false})
+		// Missed reminders are folded into one, after which none are left.
+		if sent, err := dueDates.Run(ctx, dueAt.Add(-time.Hour)); err != nil || sent != 1 {
+			t.Fatalf("expected one reminder, got %d, %v", sent, err)
+		}
+		if reminders(owner.ID) != 1 || reminders(editor.ID) != 2 {
+			t.Fatalf("expected only the editor reminded, got %d, %d", reminders(owner.ID), reminders(editor.ID))
+		}
+		var stored models.FileDueDate
+		db.First(&stored, "id = ?", due.ID)
+		if stored.NextReminderAt != nil {
+			t.Fatalf("expected no reminders left, got %v", stored.NextReminderAt)
+		}
+	})
+
+	t.Run("calendar", func(t *testing.T) {
+		var stored models.FileDueDate
+		db.Preload("File").First(&stored, "id = ?", due.ID)
+		ics := string(dueDates.Calendar([]models.FileDueDate{stored}))
+		for _, want := range []string{
+			"BEGIN:VCALENDAR\r\n",
+			"UID:" + due.ID.String() + "@docshare\r\n",
+			"DTSTART:" + dueAt.Format("20060102T150405Z") + "\r\n",
+			`SUMMARY:Due: Q3 report\, final.docx` + "\r\n",
+			"TRIGGER:-PT168H\r\n",
+			"URL:https://docs.example.com/files/" + report.ID.String() + "\r\n",
+		} {
+			if !strings.Contains(ics, want) {
+				t.Errorf("expected %q in\n%s", want, ics)
+			}
+		}
+
+		var b strings.Builder
+		writeICalLine(&b, "DESCRIPTION:"+strings.Repeat("é", 60))
+		for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n") {
+			if len(line) > 75 {
+				t.Fatalf("expected lines folded at 75 octets, got %d", len(line))
+			}
+		}
+		if unfolded := strings.ReplaceAll(b.String(), "\r\n ", ""); unfolded != "DESCRIPTION:"+strings.Repeat("é", 60)+"\r\n" {
+			t.Fatalf("folding changed the line: %q", unfolded)
+		}
+	})
+
+	t.Run("feed tokens", func(t *testing.T) {
+		old, err := dueDates.IssueFeed(ctx, as(owner))
+		if err != nil {
+			t.Fatalf("issue failed: %v", err)
+		}
+		token, _ := dueDates.IssueFeed(ctx, as(owner))
+		if _, err := dueDates.FeedUser(ctx, old); !errors.Is(err, ErrCalendarFeedInvalid) {
+			t.Fatalf("expected the old token replaced, got %v", err)
+		}
+		if u, err := dueDates.FeedUser(ctx, token); err != nil || u.ID != owner.ID {
+			t.Fatalf("expected the owner's feed, got %v, %v", u, err)
+		}
+		if err := dueDates.RevokeFeed(ctx, as(owner)); err != nil {
+			t.Fatalf("revoke failed: %v", err)
+		}
+		if _, err := dueDates.FeedUser(ctx, token); !errors.Is(err, ErrCalendarFeedInvalid) {
+			t.Fatalf("expected the feed revoked, got %v", err)
+		}
+	})
+
+	if err := dueDates.Clear(ctx, &report, as(editor)); err != nil {
+		t.Fatalf("clear failed: %v", err)
+	}
+	if err := dueDates.Clear(ctx, &report, as(editor)); !errors.Is(err, ErrDueDateNotFound) {
+		t.Fatalf("expected ErrDueDateNotFound, got %v", err)
+	}
+}
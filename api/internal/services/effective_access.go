@@ -0,0 +1,435 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// effectiveAccessChunk bounds the IDs bound into one IN clause while a
+// report gathers the shares of a large subtree.
+const effectiveAccessChunk = 500
+
+type AccessSource string
+
+const (
+	AccessSourceOwner      AccessSource = "owner"
+	AccessSourceDirect     AccessSource = "direct"
+	AccessSourceGroup      AccessSource = "group"
+	AccessSourcePublicLink AccessSource = "public_link"
+)
+
+// Principal types in an effective access report: a user, or the public
+// through one of the two kinds of public link.
+const (
+	PrincipalUser           = "user"
+	PrincipalPublicAnyone   = string(models.ShareTypePublicAnyone)
+	PrincipalPublicLoggedIn = string(models.ShareTypePublicLoggedIn)
+)
+
+// AccessGrant is one way into a subtree: ownership or a share, and the
+// item it is attached to. Inherited grants sit on a folder above the
+// report's root. An owner grant with no file covers Items items the user
+// owns below the root.
+type AccessGrant struct {
+	Source     AccessSource           `json:"source"`
+	Permission models.SharePermission `json:"permission"`
+	Inherited  bool                   `json:"inherited"`
+	FileID     *uuid.UUID             `json:"fileID,omitempty"`
+	FileName   string                 `json:"fileName,omitempty"`
+	Items      int64                  `json:"items,omitempty"`
+	ShareID    *uuid.UUID             `json:"shareID,omitempty"`
+	ShareType  models.ShareType       `json:"shareType,omitempty"`
+	GroupID    *uuid.UUID             `json:"groupID,omitempty"`
+	GroupName  string                 `json:"groupName,omitempty"`
+	SharedByID *uuid.UUID             `json:"sharedByID,omitempty"`
+	ExpiresAt  *time.Time             `json:"expiresAt,omitempty"`
+}
+
+// AccessPrincipal is everything one user, or the public, can do in a
+// subtree. Permission is the highest held anywhere in it; RootPermission is
+// what is held on the root itself, and so on everything below it.
+type AccessPrincipal struct {
+	Type           string                 `json:"type"`
+	UserID         *uuid.UUID             `json:"userID,omitempty"`
+	Email          string                 `json:"email,omitempty"`
+	Name           string                 `json:"name,omitempty"`
+	Permission     models.SharePermission `json:"permission"`
+	RootPermission models.SharePermission `json:"rootPermission,omitempty"`
+	Grants         []AccessGrant          `json:"grants"`
+}
+
+// EffectiveAccessReport flattens who can reach a file or folder and
+// everything below it. While Quarantined is set nobody but admins can open
+// any of it, whatever the grants say.
+type EffectiveAccessReport struct {
+	FileID      uuid.UUID         `json:"fileID"`
+	FileName    string            `json:"fileName"`
+	IsDirectory bool              `json:"isDirectory"`
+	Items       int               `json:"items"`
+	Quarantined bool              `json:"quarantined"`
+	Principals  []AccessPrincipal `json:"principals"`
+	GeneratedAt time.Time         `json:"generatedAt"`
+}
+
+// EffectiveAccess resolves the share graph into reports by the rules
+// AccessService.HasAccess applies: ownership and active shares on an item
+// or any folder above it, group shares through current membership, and
+// public links while public sharing is on. Expired shares, shares of
+// suspended sharers when those are disabled, and invitations not yet
+// accepted grant nothing and are left out.
+type EffectiveAccess struct {
+	DB     *gorm.DB
+	Access *AccessService
+}
+
+func NewEffectiveAccess(db *gorm.DB, access *AccessService) *EffectiveAccess {
+	return &EffectiveAccess{DB: db, Access: access}
+}
+
+// Report builds the report for root and its subtree.
+func (e *EffectiveAccess) Report(ctx context.Context, root *models.File) (*EffectiveAccessReport, error) {
+	db := e.DB.WithContext(ctx)
+	report := &EffectiveAccessReport{
+		FileID:      root.ID,
+		FileName:    root.Name,
+		IsDirectory: root.IsDirectory,
+		Quarantined: root.QuarantinedAt != nil,
+		GeneratedAt: time.Now().UTC(),
+	}
+
+	var ancestors []models.File
+	for parentID := root.ParentID; parentID != nil; {
+		var parent models.File
+		if err := db.First(&parent, "id = ?", *parentID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				break
+			}
+			return nil, err
+		}
+		ancestors = append(ancestors, parent)
+		report.Quarantined = report.Quarantined || parent.QuarantinedAt != nil
+		parentID = parent.ParentID
+	}
+	subtree, err := fileSubtree(ctx, e.DB, root.ID)
+	if err != nil {
+		return nil, err
+	}
+	report.Items = len(subtree)
+
+	b := &reportBuilder{rootID: root.ID, orgID: root.OrganizationID, principals: map[string]*AccessPrincipal{}}
+	if err := b.addUser(db, root.OwnerID, AccessGrant{Source: AccessSourceOwner, Permission: models.SharePermissionEdit, FileID: &root.ID, FileName: root.Name}); err != nil {
+		return nil, err
+	}
+	for i := range ancestors {
+		a := &ancestors[i]
+		if err := b.addUser(db, a.OwnerID, AccessGrant{Source: AccessSourceOwner, Permission: models.SharePermissionEdit, Inherited: true, FileID: &a.ID, FileName: a.Name}); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.addDescendantOwners(db, b, root, subtree); err != nil {
+		return nil, err
+	}
+
+	ancestorIDs := make([]uuid.UUID, len(ancestors))
+	for i := range ancestors {
+		ancestorIDs[i] = ancestors[i].ID
+	}
+	for _, part := range []struct {
+		ids       []uuid.UUID
+		inherited bool
+	}{{ancestorIDs, true}, {subtree, false}} {
+		for start := 0; start < len(part.ids); start += effectiveAccessChunk {
+			chunk := part.ids[start:min(start+effectiveAccessChunk, len(part.ids))]
+			shares, err := e.activeShares(ctx, db.Where("shares.file_id IN ?", chunk).Order("shares.created_at ASC"))
+			if err != nil {
+				return nil, err
+			}
+			for i := range shares {
+				if err := b.addShare(db, &shares[i], part.inherited); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	report.Principals = b.sorted()
+	return report, nil
+}
+
+// addDescendantOwners adds one owner grant per user who owns items below
+// root without owning root itself, e.g. files uploaded into a shared
+// folder.
+func (e *EffectiveAccess) addDescendantOwners(db *gorm.DB, b *reportBuilder, root *models.File, subtree []uuid.UUID) error {
+	counts := map[uuid.UUID]int64{}
+	for start := 0; start < len(subtree); start += effectiveAccessChunk {
+		var rows []struct {
+			OwnerID uuid.UUID
+			Items   int64
+		}
+		if err := db.Model(&models.File{}).
+			Select("owner_id, COUNT(*) AS items").
+			Where("id IN ? AND owner_id <> ?", subtree[start:min(start+effectiveAccessChunk, len(subtree))], root.OwnerID).
+			Group("owner_id").
+			Scan(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			counts[row.OwnerID] += row.Items
+		}
+	}
+	for ownerID, items := range counts {
+		if err := b.addUser(db, ownerID, AccessGrant{Source: AccessSourceOwner, Permission: models.SharePermissionEdit, Items: items}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// activeShares loads the shares matched by query that grant access now,
+// with their file and group.
+func (e *EffectiveAccess) activeShares(ctx context.Context, query *gorm.DB) ([]models.Share, error) {
+	var shares []models.Share
+	err := e.activeScope(ctx, query).
+		Preload("File").Preload("SharedWithGroup").
+		Find(&shares).Error
+	return shares, err
+}
+
+// activeScope keeps the shares that grant access now: unexpired, from a
+// sharer whose shares still count, and public only while public sharing
+// is on. Private shares to an email not yet signed up are left out.
+func (e *EffectiveAccess) activeScope(ctx context.Context, query *gorm.DB) *gorm.DB {
+	types := []models.ShareType{models.ShareTypePrivate}
+	if e.Access.PublicSharingEnabled(ctx) {
+		types = append(types, models.ShareTypePublicAnyone, models.ShareTypePublicLoggedIn)
+	}
+	return query.Model(&models.Share{}).
+		Scopes(e.Access.ActiveSharers("shares")).
+		Where("shares.share_type IN ?", types).
+		Where("shares.expires_at IS NULL OR shares.expires_at > ?", time.Now()).
+		Where("shares.share_type <> ? OR shares.shared_with_user_id IS NOT NULL OR shares.shared_with_group_id IS NOT NULL", models.ShareTypePrivate)
+}
+
+// OrganizationGrant is a share as the organization-wide report lists it:
+// the grant, who it goes to, how many group members that reaches and how
+// many items sit below a shared folder.
+type OrganizationGrant struct {
+	AccessGrant
+	UserID    *uuid.UUID `json:"userID,omitempty"`
+	UserEmail string     `json:"userEmail,omitempty"`
+	Members   *int64     `json:"members,omitempty"`
+	Inside    *int64     `json:"inside,omitempty"`
+}
+
+// GrantFilter narrows the organization-wide report. UserID keeps the
+// grants that reach the user: shares to them, to a group they are in, and
+// public links. MinPermission keeps grants of at least that permission.
+type GrantFilter struct {
+	UserID        *uuid.UUID
+	GroupID       *uuid.UUID
+	PublicOnly    bool
+	MinPermission models.SharePermission
+}
+
+// OrganizationGrants lists one page of the active shares on a tenant's
+// files, newest first, with the total for the filter.
+func (e *EffectiveAccess) OrganizationGrants(ctx context.Context, orgID *uuid.UUID, filter GrantFilter, offset, limit int) ([]OrganizationGrant, int64, error) {
+	db := e.DB.WithContext(ctx)
+	query := db.Joins("JOIN files ON files.id = shares.file_id AND files.deleted_at IS NULL").
+		Scopes(OrganizationScope("files", orgID))
+	if filter.UserID != nil {
+		query = query.Where("shares.shared_with_user_id = ? OR shares.shared_with_group_id IN (?) OR shares.share_type <> ?",
+			*filter.UserID,
+			db.Model(&models.GroupMembership{}).Select("group_id").Where("user_id = ?", *filter.UserID),
+			models.ShareTypePrivate)
+	}
+	if filter.GroupID != nil {
+		query = query.Where("shares.shared_with_group_id = ?", *filter.GroupID)
+	}
+	if filter.PublicOnly {
+		query = query.Where("shares.share_type <> ?", models.ShareTypePrivate)
+	}
+	if filter.MinPermission != "" {
+		var allowed []models.SharePermission
+		minLevel, _ := permissionLevel(filter.MinPermission)
+		for _, p := range []models.SharePermission{models.SharePermissionView, models.SharePermissionDownload, models.SharePermissionEdit} {
+			if level, _ := permissionLevel(p); level >= minLevel {
+				allowed = append(allowed, p)
+			}
+		}
+		query = query.Where("shares.permission IN ?", allowed)
+	}
+
+	var total int64
+	if err := e.activeScope(ctx, query.Session(&gorm.Session{})).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	shares, err := e.activeShares(ctx, query.Order("shares.created_at DESC").Offset(offset).Limit(limit).Preload("SharedWithUser"))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	grants := make([]OrganizationGrant, len(shares))
+	for i := range shares {
+		share := &shares[i]
+		grant := OrganizationGrant{AccessGrant: shareGrant(share, &share.File, false)}
+		if share.SharedWithUser != nil {
+			grant.UserID = share.SharedWithUserID
+			grant.UserEmail = share.SharedWithUser.Email
+		}
+		if share.SharedWithGroupID != nil {
+			var members int64
+			if err := db.Model(&models.GroupMembership{}).Where("group_id = ?", *share.SharedWithGroupID).Count(&members).Error; err != nil {
+				return nil, 0, err
+			}
+			grant.Members = &members
+		}
+		if share.File.IsDirectory {
+			ids, err := fileSubtree(ctx, e.DB, share.FileID)
+			if err != nil {
+				return nil, 0, err
+			}
+			inside := int64(len(ids) - 1)
+			grant.Inside = &inside
+		}
+		grants[i] = grant
+	}
+	return grants, total, nil
+}
+
+func shareGrant(share *models.Share, file *models.File, inherited bool) AccessGrant {
+	grant := AccessGrant{
+		Source:     AccessSourceDirect,
+		Permission: share.Permission,
+		Inherited:  inherited,
+		FileID:     &file.ID,
+		FileName:   file.Name,
+		ShareID:    &share.ID,
+		ShareType:  share.ShareType,
+		SharedByID: &share.SharedByID,
+		ExpiresAt:  share.ExpiresAt,
+	}
+	switch {
+	case share.IsPublic():
+		grant.Source = AccessSourcePublicLink
+	case share.SharedWithGroupID != nil:
+		grant.Source = AccessSourceGroup
+		grant.GroupID = share.SharedWithGroupID
+		if share.SharedWithGroup != nil {
+			grant.GroupName = share.SharedWithGroup.Name
+		}
+	}
+	return grant
+}
+
+// reportBuilder collects grants per principal. Users outside the root's
+// tenant are skipped, since no share reaches across tenants.
+type reportBuilder struct {
+	rootID     uuid.UUID
+	orgID      *uuid.UUID
+	principals map[string]*AccessPrincipal
+	users      map[uuid.UUID]*models.User
+}
+
+func (b *reportBuilder) addShare(db *gorm.DB, share *models.Share, inherited bool) error {
+	grant := shareGrant(share, &share.File, inherited)
+	switch {
+	case share.IsPublic():
+		b.add(string(share.ShareType), nil, grant)
+	case share.SharedWithGroupID != nil:
+		var memberIDs []uuid.UUID
+		if err := db.Model(&models.GroupMembership{}).Where("group_id = ?", *share.SharedWithGroupID).Pluck("user_id", &memberIDs).Error; err != nil {
+			return err
+		}
+		for _, id := range memberIDs {
+			if err := b.addUser(db, id, grant); err != nil {
+				return err
+			}
+		}
+	case share.SharedWithUserID != nil:
+		return b.addUser(db, *share.SharedWithUserID, grant)
+	}
+	return nil
+}
+
+func (b *reportBuilder) addUser(db *gorm.DB, userID uuid.UUID, grant AccessGrant) error {
+	if b.users == nil {
+		b.users = map[uuid.UUID]*models.User{}
+	}
+	user, ok := b.users[userID]
+	if !ok {
+		var found models.User
+		if err := db.Select("id", "email", "first_name", "last_name", "organization_id").First(&found, "id = ?", userID).Error; err != nil {
+			if err != gorm.ErrRecordNotFound {
+				return err
+			}
+		} else {
+			user = &found
+		}
+		b.users[userID] = user
+	}
+	if user == nil || !SameOrganization(user.OrganizationID, b.orgID) {
+		return nil
+	}
+	b.add(user.ID.String(), user, grant)
+	return nil
+}
+
+func (b *reportBuilder) add(key string, user *models.User, grant AccessGrant) {
+	principal, ok := b.principals[key]
+	if !ok {
+		principal = &AccessPrincipal{Type: key}
+		if user != nil {
+			principal.Type = PrincipalUser
+			principal.UserID = &user.ID
+			principal.Email = user.Email
+			principal.Name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+		}
+		b.principals[key] = principal
+	}
+	principal.Grants = append(principal.Grants, grant)
+	principal.Permission = higherPermission(principal.Permission, grant.Permission)
+	if grant.Inherited || (grant.FileID != nil && *grant.FileID == b.rootID) {
+		principal.RootPermission = higherPermission(principal.RootPermission, grant.Permission)
+	}
+}
+
+// sorted lists the principals with the broadest access first.
+func (b *reportBuilder) sorted() []AccessPrincipal {
+	out := make([]AccessPrincipal, 0, len(b.principals))
+	for _, p := range b.principals {
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		ri, _ := permissionLevel(out[i].RootPermission)
+		rj, _ := permissionLevel(out[j].RootPermission)
+		if ri != rj {
+			return ri > rj
+		}
+		pi, _ := permissionLevel(out[i].Permission)
+		pj, _ := permissionLevel(out[j].Permission)
+		if pi != pj {
+			return pi > pj
+		}
+		if out[i].Type != out[j].Type {
+			return out[i].Type != PrincipalUser
+		}
+		return out[i].Email < out[j].Email
+	})
+	return out
+}
+
+func higherPermission(a, b models.SharePermission) models.SharePermission {
+	la, _ := permissionLevel(a)
+	lb, _ := permissionLevel(b)
+	if lb > la {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestEffectiveAccessReport(t *testing.T) {
+	db := setupAccessTestDB(t)
+	service := NewEffectiveAccess(db, NewAccessService(db))
+	ctx := context.Background()
+
+	newUser := func(email string) *models.User {
+		user := &models.User{Email: email, PasswordHash: "hash", FirstName: "Test", LastName: "User", Role: models.UserRoleUser}
+		if err := db.Create(user).Error; err != nil {
+			t.Fatalf("failed creating user: %v", err)
+		}
+		return user
+	}
+	owner := newUser("owner@test.com")
+	alice := newUser("alice@test.com")
+	bob := newUser("bob@test.com")
+	carol := newUser("carol@test.com")
+	dave := newUser("dave@test.com")
+
+	projects := models.File{Name: "Projects", IsDirectory: true, OwnerID: owner.ID}
+	db.Create(&projects)
+	board := models.File{Name: "Board", IsDirectory: true, OwnerID: owner.ID, ParentID: &projects.ID}
+	db.Create(&board)
+	minutes := models.File{Name: "minutes.txt", MimeType: "text/plain", OwnerID: owner.ID, ParentID: &board.ID}
+	db.Create(&minutes)
+	upload := models.File{Name: "notes.txt", MimeType: "text/plain", OwnerID: carol.ID, ParentID: &board.ID}
+	db.Create(&upload)
+
+	group := models.Group{Name: "Board members", CreatedByID: owner.ID}
+	db.Create(&group)
+	db.Create(&models.GroupMembership{UserID: bob.ID, GroupID: group.ID})
+
+	expired := time.Now().Add(-time.Hour)
+	for _, share := range []models.Share{
+		{FileID: projects.ID, SharedByID: owner.ID, SharedWithUserID: &alice.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView},
+		{FileID: board.ID, SharedByID: owner.ID, SharedWithUserID: &alice.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionEdit},
+		{FileID: minutes.ID, SharedByID: owner.ID, SharedWithGroupID: &group.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionDownload},
+		{FileID: minutes.ID, SharedByID: owner.ID, ShareType: models.ShareTypePublicAnyone, Permission: models.SharePermissionView},
+		{FileID: board.ID, SharedByID: owner.ID, SharedWithUserID: &dave.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionEdit, ExpiresAt: &expired},
+	} {
+		if err := db.Create(&share).Error; err != nil {
+			t.Fatalf("failed creating share: %v", err)
+		}
+	}
+
+	report, err := service.Report(ctx, &board)
+	if err != nil {
+		t.Fatalf("report failed: %v", err)
+	}
+	if report.Items != 3 || len(report.Principals) != 5 {
+		t.Fatalf("expected three items and five principals, got %d and %+v", report.Items, report.Principals)
+	}
+	byKey := map[string]AccessPrincipal{}
+	for _, p := range report.Principals {
+		key := p.Type
+		if p.UserID != nil {
+			key = p.Email
+		}
+		byKey[key] = p
+	}
+
+	if p := byKey["owner@test.com"]; p.RootPermission != models.SharePermissionEdit || len(p.Grants) != 2 || !p.Grants[1].Inherited {
+		t.Fatalf("expected the owner through the folder and its parent, got %+v", p)
+	}
+	if p := byKey["alice@test.com"]; p.RootPermission != models.SharePermissionEdit || len(p.Grants) != 2 {
+		t.Fatalf("expected alice's inherited view and direct edit, got %+v", p)
+	}
+	if p := byKey["bob@test.com"]; p.RootPermission != "" || p.Permission != models.SharePermissionDownload || p.Grants[0].Source != AccessSourceGroup || p.Grants[0].GroupName != "Board members" {
+		t.Fatalf("expected bob to reach one file through the group, got %+v", p)
+	}
+	if p := byKey["carol@test.com"]; p.Grants[0].Source != AccessSourceOwner || p.Grants[0].Items != 1 || p.RootPermission != "" {
+		t.Fatalf("expected carol to own one item below the folder, got %+v", p)
+	}
+	if p := byKey[PrincipalPublicAnyone]; p.Grants[0].Source != AccessSourcePublicLink {
+		t.Fatalf("expected the public link, got %+v", p)
+	}
+	if _, ok := byKey["dave@test.com"]; ok {
+		t.Fatal("expected the expired share to be left out")
+	}
+	if report.Principals[0].RootPermission != models.SharePermissionEdit {
+		t.Fatalf("expected the broadest access first, got %+v", report.Principals[0])
+	}
+
+	grants, total, err := service.OrganizationGrants(ctx, nil, GrantFilter{UserID: &bob.ID}, 0, 20)
+	if err != nil {
+		t.Fatalf("organization grants failed: %v", err)
+	}
+	if total != 2 || len(grants) != 2 {
+		t.Fatalf("expected bob's group share and the public link, got %d", total)
+	}
+	grants, total, err = service.OrganizationGrants(ctx, nil, GrantFilter{MinPermission: models.SharePermissionEdit}, 0, 20)
+	if err != nil || total != 1 || grants[0].UserEmail != "alice@test.com" || grants[0].Inside == nil || *grants[0].Inside != 2 {
+		t.Fatalf("expected alice's edit share on the folder, got %d %+v: %v", total, grants, err)
+	}
+}
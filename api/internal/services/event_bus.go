@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Topics carried on the event bus.
+const (
+	BusTopicSettings     = "settings"
+	BusTopicSSOProviders = "sso_providers"
+	BusTopicChanges      = "changes"
+	BusTopicSigningKeys  = "signing_keys"
+)
+
+const (
+	// eventBusQueue is how many messages can wait to be published before
+	// new ones are dropped.
+	eventBusQueue = 256
+	// eventBusMaxBackoff caps the wait between attempts to reconnect.
+	eventBusMaxBackoff = 30 * time.Second
+)
+
+// busMessage is what goes over the wire. Origin lets an instance ignore
+// the messages it published itself.
+type busMessage struct {
+	Topic   string          `json:"t"`
+	Origin  string          `json:"o"`
+	Payload json.RawMessage `json:"p,omitempty"`
+}
+
+// busTransport carries messages between instances.
+type busTransport interface {
+	Publish(ctx context.Context, msg []byte) error
+	// Listen calls ready once it receives every message published from
+	// then on, then hands each one to deliver until ctx is done or the
+	// connection fails.
+	Listen(ctx context.Context, ready func(), deliver func([]byte)) error
+}
+
+// BusHandler handles a message from another instance. The payload is nil
+// when the bus has reconnected and messages may have been missed, so the
+// handler should drop everything it caches for the topic.
+type BusHandler func(payload json.RawMessage)
+
+// EventBus tells the other API instances about changes that make their
+// in-process state stale, such as cached settings, and wakes their change
+// feed waiters. Messages are best effort: publishing never blocks the
+// caller and a message can be lost, so caches keep their refresh interval
+// as a bound on staleness. A bus without a transport, for a single
+// instance, publishes nothing.
+type EventBus struct {
+	transport busTransport
+	origin    string
+	outgoing  chan busMessage
+
+	mu       sync.RWMutex
+	handlers map[string][]BusHandler
+}
+
+// NewEventBus builds the bus selected by cfg. dsn is the primary's
+// connection string, which the postgres driver listens on.
+func NewEventBus(cfg config.EventBusConfig, db *gorm.DB, dsn string) (*EventBus, error) {
+	var transport busTransport
+	switch cfg.Driver {
+	case "", "none":
+	case "postgres":
+		transport = &postgresBusTransport{db: db, dsn: dsn, channel: cfg.Channel}
+	case "redis":
+		if cfg.RedisAddr == "" {
+			return nil, fmt.Errorf("EVENT_BUS_REDIS_ADDR is required when EVENT_BUS_DRIVER is redis")
+		}
+		transport = &redisBusTransport{addr: cfg.RedisAddr, password: cfg.RedisPassword, channel: cfg.Channel}
+	default:
+		return nil, fmt.Errorf("EVENT_BUS_DRIVER must be postgres, redis or none, got %q", cfg.Driver)
+	}
+	return newEventBus(transport), nil
+}
+
+func newEventBus(transport busTransport) *EventBus {
+	return &EventBus{
+		transport: transport,
+		origin:    uuid.NewString(),
+		outgoing:  make(chan busMessage, eventBusQueue),
+		handlers:  map[string][]BusHandler{},
+	}
+}
+
+// Subscribe registers handler for messages on topic from other instances.
+func (b *EventBus) Subscribe(topic string, handler BusHandler) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[topic] = append(b.handlers[topic], handler)
+}
+
+// Publish queues payload for the other instances. It is safe to call on a
+// nil bus.
+func (b *EventBus) Publish(topic string, payload interface{}) {
+	if b == nil || b.transport == nil {
+		return
+	}
+	msg := busMessage{Topic: topic, Origin: b.origin}
+	if payload != nil {
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			logger.Error("event_bus_encode_failed", err, map[string]interface{}{"topic": topic})
+			return
+		}
+		msg.Payload = raw
+	}
+	select {
+	case b.outgoing <- msg:
+	default:
+		logger.Warn("event_bus_queue_full", map[string]interface{}{"topic": topic})
+	}
+}
+
+// Start publishes queued messages and listens for those of other
+// instances, reconnecting with backoff whenever the connection drops.
+func (b *EventBus) Start() {
+	if b.transport == nil {
+		return
+	}
+	go b.publishLoop()
+	go b.listenLoop()
+	logger.Info("event_bus_started", map[string]interface{}{"origin": b.origin})
+}
+
+// publishLoop sends queued messages, folding identical ones that piled up
+// while the previous send was in flight into one.
+func (b *EventBus) publishLoop() {
+	for msg := range b.outgoing {
+		batch := []busMessage{msg}
+	drain:
+		for len(batch) < eventBusQueue {
+			select {
+			case next := <-b.outgoing:
+				batch = append(batch, next)
+			default:
+				break drain
+			}
+		}
+
+		seen := map[string]bool{}
+		for _, msg := range batch {
+			raw, err := json.Marshal(msg)
+			if err != nil || seen[string(raw)] {
+				continue
+			}
+			seen[string(raw)] = true
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := b.transport.Publish(ctx, raw); err != nil {
+				logger.Error("event_bus_publish_failed", err, map[string]interface{}{"topic": msg.Topic})
+			}
+			cancel()
+		}
+	}
+}
+
+func (b *EventBus) listenLoop() {
+	backoff := time.Second
+	connected := false
+	for {
+		err := b.transport.Listen(context.Background(), func() {
+			// Messages sent while we were away are lost; have every
+			// subscriber start over.
+			if connected {
+				b.resync()
+			}
+			connected = true
+			backoff = time.Second
+		}, b.deliver)
+		logger.Error("event_bus_listen_failed", err, map[string]interface{}{
+			"retry_in": backoff.String(),
+		})
+		time.Sleep(backoff)
+		backoff = min(backoff*2, eventBusMaxBackoff)
+	}
+}
+
+func (b *EventBus) deliver(raw []byte) {
+	var msg busMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		logger.Warn("event_bus_message_ignored", map[string]interface{}{"reason": err.Error()})
+		return
+	}
+	if msg.Origin == b.origin {
+		return
+	}
+	payload := msg.Payload
+	if payload == nil {
+		payload = json.RawMessage("null")
+	}
+	b.mu.RLock()
+	handlers := b.handlers[msg.Topic]
+	b.mu.RUnlock()
+	for _, handler := range handlers {
+		handler(payload)
+	}
+}
+
+func (b *EventBus) resync() {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, handlers := range b.handlers {
+		for _, handler := range handlers {
+			handler(nil)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/google/uuid"
+)
+
+// memoryBusHub stands in for Postgres or Redis, handing every published
+// message to every listener.
+type memoryBusHub struct {
+	mu        sync.Mutex
+	listeners []func([]byte)
+}
+
+func (h *memoryBusHub) transport() busTransport {
+	return &memoryBusTransport{hub: h}
+}
+
+type memoryBusTransport struct {
+	hub *memoryBusHub
+}
+
+func (t *memoryBusTransport) Publish(ctx context.Context, msg []byte) error {
+	t.hub.mu.Lock()
+	defer t.hub.mu.Unlock()
+	for _, listener := range t.hub.listeners {
+		listener(msg)
+	}
+	return nil
+}
+
+func (t *memoryBusTransport) Listen(ctx context.Context, ready func(), deliver func([]byte)) error {
+	t.hub.mu.Lock()
+	t.hub.listeners = append(t.hub.listeners, deliver)
+	t.hub.mu.Unlock()
+	ready()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestEventBus(t *testing.T) {
+	hub := &memoryBusHub{}
+	a, b := newEventBus(hub.transport()), newEventBus(hub.transport())
+
+	var mu sync.Mutex
+	var gotA, gotB []string
+	a.Subscribe("topic", func(payload json.RawMessage) {
+		mu.Lock()
+		defer mu.Unlock()
+		gotA = append(gotA, string(payload))
+	})
+	b.Subscribe("topic", func(payload json.RawMessage) {
+		mu.Lock()
+		defer mu.Unlock()
+		gotB = append(gotB, string(payload))
+	})
+	a.Start()
+	b.Start()
+	waitFor(t, "both buses to listen", func() bool {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		return len(hub.listeners) == 2
+	})
+
+	a.Publish("topic", map[string]int{"n": 1})
+	a.Publish("other", nil)
+	waitFor(t, "the message to arrive", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(gotB) == 1
+	})
+	mu.Lock()
+	if gotB[0] != `{"n":1}` || len(gotA) != 0 {
+		t.Fatalf("expected only the other instance to get the message, got %v and %v", gotA, gotB)
+	}
+	mu.Unlock()
+
+	b.resync()
+	mu.Lock()
+	if len(gotB) != 2 || gotB[1] != "" {
+		t.Fatalf("expected a resync to reach subscribers with no payload, got %v", gotB)
+	}
+	mu.Unlock()
+
+	var none *EventBus
+	none.Publish("topic", nil)
+	none.Subscribe("topic", func(json.RawMessage) {})
+}
+
+func TestEventBus_SpreadsSettingsChanges(t *testing.T) {
+	db := setupSettingsTestDB(t)
+	hub := &memoryBusHub{}
+	cfg := &config.Config{}
+	settings, _ := NewSettingsService(db, cfg)
+	other, _ := NewSettingsService(db, cfg)
+	settingsBus, otherBus := newEventBus(hub.transport()), newEventBus(hub.transport())
+	settings.UseEventBus(settingsBus)
+	other.UseEventBus(otherBus)
+	settingsBus.Start()
+	otherBus.Start()
+	ctx := context.Background()
+
+	if !settings.PublicSharingEnabled(ctx) {
+		t.Fatal("expected public sharing on by default")
+	}
+	if _, err := other.Update(ctx, map[string]json.RawMessage{SettingPublicSharing: json.RawMessage(`false`)}, uuid.New()); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	waitFor(t, "the change to reach the other instance", func() bool {
+		return !settings.PublicSharingEnabled(ctx)
+	})
+}
+
+func TestNewEventBus(t *testing.T) {
+	if _, err := NewEventBus(config.EventBusConfig{Driver: "kafka"}, nil, ""); err == nil {
+		t.Fatal("expected an unknown driver to be refused")
+	}
+	if _, err := NewEventBus(config.EventBusConfig{Driver: "redis"}, nil, ""); err == nil {
+		t.Fatal("expected redis without an address to be refused")
+	}
+	bus, err := NewEventBus(config.EventBusConfig{Driver: "none"}, nil, "")
+	if err != nil || bus.transport != nil {
+		t.Fatalf("expected a bus that publishes nothing, got %v", err)
+	}
+}
+
+// fakeRedis answers AUTH, SUBSCRIBE and PUBLISH on one channel.
+func fakeRedis(t *testing.T, password string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed listening: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var mu sync.Mutex
+	var subscribers []net.Conn
+	bulk := func(s string) string { return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s) }
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				rc := &redisConn{Conn: conn, r: bufio.NewReader(conn)}
+				authed := password == ""
+				for {
+					req, err := rc.read()
+					if err != nil {
+						return
+					}
+					args, _ := req.([]interface{})
+					if len(args) == 0 {
+						return
+					}
+					switch cmd := args[0].(string); {
+					case cmd == "AUTH" && args[1] == password:
+						authed = true
+						fmt.Fprint(conn, "+OK\r\n")
+					case !authed:
+						fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+					case cmd == "SUBSCRIBE":
+						mu.Lock()
+						subscribers = append(subscribers, conn)
+						mu.Unlock()
+						fmt.Fprint(conn, "*3\r\n"+bulk("subscribe")+bulk(args[1].(string))+":1\r\n")
+					case cmd == "PUBLISH":
+						mu.Lock()
+						for _, sub := range subscribers {
+							fmt.Fprint(sub, "*3\r\n"+bulk("message")+bulk(args[1].(string))+bulk(args[2].(string)))
+						}
+						fmt.Fprintf(conn, ":%d\r\n", len(subscribers))
+						mu.Unlock()
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestRedisBusTransport(t *testing.T) {
+	addr := fakeRedis(t, "hunter2")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listener := &redisBusTransport{addr: addr, password: "hunter2", channel: "docshare_events"}
+	ready := make(chan struct{})
+	got := make(chan string, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- listener.Listen(ctx, func() { close(ready) }, func(msg []byte) { got <- string(msg) })
+	}()
+	select {
+	case <-ready:
+	case err := <-done:
+		t.Fatalf("listen failed: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out subscribing")
+	}
+
+	publisher := &redisBusTransport{addr: addr, password: "hunter2", channel: "docshare_events"}
+	if err := publisher.Publish(ctx, []byte(`{"t":"settings"}`)); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+	select {
+	case msg := <-got:
+		if msg != `{"t":"settings"}` {
+			t.Fatalf("unexpected message %q", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the message")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected Listen to return once its context is done")
+	}
+
+	wrong := &redisBusTransport{addr: addr, password: "nope", channel: "docshare_events"}
+	if err := wrong.Publish(context.Background(), []byte("x")); err == nil {
+		t.Fatal("expected a bad password to be refused")
+	}
+}
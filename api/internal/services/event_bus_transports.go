@@ -0,0 +1,192 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// postgresBusTransport uses LISTEN/NOTIFY on the primary. Notifications go
+// out through the connection pool; listening holds a connection of its own.
+type postgresBusTransport struct {
+	db      *gorm.DB
+	dsn     string
+	channel string
+}
+
+func (t *postgresBusTransport) Publish(ctx context.Context, msg []byte) error {
+	return t.db.WithContext(ctx).Exec("SELECT pg_notify(?, ?)", t.channel, string(msg)).Error
+}
+
+func (t *postgresBusTransport) Listen(ctx context.Context, ready func(), deliver func([]byte)) error {
+	conn, err := pgx.Connect(ctx, t.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{t.channel}.Sanitize()); err != nil {
+		return err
+	}
+	ready()
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		deliver([]byte(notification.Payload))
+	}
+}
+
+// redisBusTransport uses Redis pub/sub. It speaks just enough of the Redis
+// protocol to authenticate, publish and subscribe.
+type redisBusTransport struct {
+	addr     string
+	password string
+	channel  string
+
+	mu   sync.Mutex
+	conn *redisConn
+}
+
+func (t *redisBusTransport) Publish(ctx context.Context, msg []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil {
+		conn, err := t.dial(ctx)
+		if err != nil {
+			return err
+		}
+		t.conn = conn
+	}
+	if _, err := t.conn.do(ctx, "PUBLISH", t.channel, string(msg)); err != nil {
+		t.conn.Close()
+		t.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (t *redisBusTransport) Listen(ctx context.Context, ready func(), deliver func([]byte)) error {
+	conn, err := t.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if _, err := conn.do(ctx, "SUBSCRIBE", t.channel); err != nil {
+		return err
+	}
+	ready()
+	for {
+		reply, err := conn.read()
+		if err != nil {
+			return err
+		}
+		// Messages arrive as ["message", channel, payload].
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 3 || parts[0] != "message" {
+			continue
+		}
+		if payload, ok := parts[2].(string); ok {
+			deliver([]byte(payload))
+		}
+	}
+}
+
+func (t *redisBusTransport) dial(ctx context.Context) (*redisConn, error) {
+	var dialer net.Dialer
+	nc, err := dialer.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	if t.password != "" {
+		if _, err := conn.do(ctx, "AUTH", t.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// do sends a command and reads its reply, within ctx's deadline if it has
+// one.
+func (c *redisConn) do(ctx context.Context, args ...string) (interface{}, error) {
+	deadline, _ := ctx.Deadline()
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	defer c.SetDeadline(time.Time{})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c, b.String()); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// read parses one reply. Error replies come back as errors, bulk strings
+// as strings and arrays as []interface{}.
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, errors.New("redis: " + line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
@@ -62,6 +62,8 @@ type ExportService struct {
 	// return ErrPandocMissing in that case so the handler can return a
 	// clean 503.
 	PandocPath string
+	// Pool, when set, bounds and guards the conversions sent to Gotenberg.
+	Pool *GotenbergPool
 }
 
 func NewExportService(storageClient *storage.S3Client, gotenberg config.GotenbergConfig) *ExportService {
@@ -375,7 +377,12 @@ func (e *ExportService) renderPDF(ctx context.Context, source []byte) ([]byte, e
 	if err != nil {
 		return nil, fmt.Errorf("sanitize html: %w", err)
 	}
-	return e.htmlToPDF(ctx, safe)
+	var out []byte
+	err = e.Pool.Do(ctx, func(ctx context.Context) error {
+		out, err = e.htmlToPDF(ctx, safe)
+		return err
+	})
+	return out, err
 }
 
 func (e *ExportService) htmlToPDF(ctx context.Context, body []byte) ([]byte, error) {
@@ -412,13 +419,17 @@ func (e *ExportService) htmlToPDF(ctx context.Context, body []byte) ([]byte, err
 
 	resp, err := e.HTTPClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("gotenberg request: %w", err)
+		return nil, gotenbergDown(fmt.Errorf("gotenberg request: %w", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
-		return nil, fmt.Errorf("gotenberg conversion failed: %s", strings.TrimSpace(string(body)))
+		err := fmt.Errorf("gotenberg conversion failed: %s", strings.TrimSpace(string(body)))
+		if resp.StatusCode >= 500 {
+			return nil, gotenbergDown(err)
+		}
+		return nil, err
 	}
 
 	out, err := io.ReadAll(io.LimitReader(resp.Body, maxConvertedBytes+1))
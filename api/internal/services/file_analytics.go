@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AuditActionPublicDownload is the audit action of a download through a
+// public link by someone who was not signed in. Such entries have no user;
+// they belong to the owner of the file.
+const AuditActionPublicDownload = "file.public_download"
+
+// FileAccess is one view or download of a file by someone other than its
+// owner.
+type FileAccess struct {
+	FileID    uuid.UUID
+	ShareID   *uuid.UUID
+	Kind      models.FileAccessKind
+	UserID    *uuid.UUID
+	IPAddress string
+	UserAgent string
+	Referrer  string
+}
+
+// FileAnalyticsService records how shared files are used and summarizes it
+// for their owners.
+type FileAnalyticsService struct {
+	DB *gorm.DB
+	// salt keys the hash that identifies anonymous visitors, so stored
+	// hashes cannot be matched against a list of IP addresses.
+	salt []byte
+	// ownHosts are referrers that are the DocShare web app itself.
+	ownHosts map[string]bool
+}
+
+func NewFileAnalyticsService(db *gorm.DB, salt string, frontendURL string) *FileAnalyticsService {
+	s := &FileAnalyticsService{DB: db, salt: []byte(salt), ownHosts: map[string]bool{}}
+	if u, err := url.Parse(frontendURL); err == nil && u.Hostname() != "" {
+		s.ownHosts[strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")] = true
+	}
+	return s
+}
+
+// Record counts access. Failures are logged rather than returned: analytics
+// must never break a download.
+func (s *FileAnalyticsService) Record(ctx context.Context, access FileAccess) {
+	now := time.Now().UTC()
+	row := models.FileAccessStat{
+		FileID:       access.FileID,
+		Day:          now.Format("2006-01-02"),
+		Kind:         access.Kind,
+		VisitorHash:  s.visitorHash(access),
+		ReferrerHost: s.referrerHost(access.Referrer),
+		Count:        1,
+		LastAt:       now,
+	}
+	if access.ShareID != nil {
+		row.ShareID = *access.ShareID
+	}
+
+	err := s.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{
+			{Name: "file_id"}, {Name: "share_id"}, {Name: "day"},
+			{Name: "kind"}, {Name: "visitor_hash"}, {Name: "referrer_host"},
+		},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"count":   gorm.Expr("file_access_stats.count + 1"),
+			"last_at": now,
+		}),
+	}).Create(&row).Error
+	if err != nil {
+		logger.Error("file_access_record_failed", err, map[string]interface{}{
+			"file_id": access.FileID.String(),
+			"kind":    string(access.Kind),
+		})
+	}
+}
+
+// visitorHash identifies the person behind access without storing who they
+// are: signed-in users by ID, anyone else by IP address and user agent.
+func (s *FileAnalyticsService) visitorHash(access FileAccess) string {
+	mac := hmac.New(sha256.New, s.salt)
+	if access.UserID != nil {
+		mac.Write([]byte("user:" + access.UserID.String()))
+	} else {
+		mac.Write([]byte("anon:" + access.IPAddress + "|" + access.UserAgent))
+	}
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// referrerHost reduces a Referer header to its host, dropping links from
+// the web app itself, which are not where a visitor came from.
+func (s *FileAnalyticsService) referrerHost(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+	u, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(strings.TrimPrefix(u.Hostname(), "www."))
+	if s.ownHosts[host] {
+		return ""
+	}
+	return truncateString(host, 255)
+}
+
+// FileAnalytics summarizes access to a file between From and To, both
+// inclusive days.
+type FileAnalytics struct {
+	FileID         uuid.UUID           `json:"fileID"`
+	From           string              `json:"from"`
+	To             string              `json:"to"`
+	Views          int64               `json:"views"`
+	Downloads      int64               `json:"downloads"`
+	UniqueVisitors int64               `json:"uniqueVisitors"`
+	Daily          []FileAnalyticsDay  `json:"daily"`
+	TopReferrers   []FileReferrerCount `json:"topReferrers"`
+	Shares         []ShareAnalytics    `json:"shares"`
+	// AnonymousDownloads are the latest downloads by visitors who were not
+	// signed in, taken from the audit log.
+	AnonymousDownloads []AnonymousDownload `json:"anonymousDownloads"`
+}
+
+type AnonymousDownload struct {
+	At        time.Time  `json:"at"`
+	IPAddress string     `json:"ipAddress"`
+	UserAgent string     `json:"userAgent,omitempty"`
+	ShareID   *uuid.UUID `json:"shareID,omitempty"`
+}
+
+type FileAnalyticsDay struct {
+	Day       string `json:"day"`
+	Views     int64  `json:"views"`
+	Downloads int64  `json:"downloads"`
+}
+
+type FileReferrerCount struct {
+	Host  string `json:"host"`
+	Count int64  `json:"count"`
+}
+
+// ShareAnalytics is the part of a file's access that came through one
+// share. ShareID is nil for access that did not go through a share.
+type ShareAnalytics struct {
+	ShareID        *uuid.UUID `json:"shareID"`
+	Views          int64      `json:"views"`
+	Downloads      int64      `json:"downloads"`
+	UniqueVisitors int64      `json:"uniqueVisitors"`
+}
+
+// topReferrerLimit caps the referrers reported in a summary.
+const topReferrerLimit = 10
+
+// anonymousDownloadLimit caps the anonymous downloads reported in a
+// summary; the owner's audit log has all of them.
+const anonymousDownloadLimit = 50
+
+// Summarize reports access to fileID over the last days days, today
+// included. Every day in the range appears in Daily, with zeros for days
+// without access.
+func (s *FileAnalyticsService) Summarize(ctx context.Context, fileID uuid.UUID, days int) (*FileAnalytics, error) {
+	today := time.Now().UTC()
+	from := today.AddDate(0, 0, -(days - 1)).Format("2006-01-02")
+	to := today.Format("2006-01-02")
+	base := func() *gorm.DB {
+		return s.DB.WithContext(ctx).Model(&models.FileAccessStat{}).
+			Where("file_id = ? AND day >= ? AND day <= ?", fileID, from, to)
+	}
+
+	summary := &FileAnalytics{FileID: fileID, From: from, To: to}
+
+	var daily []struct {
+		Day   string
+		Kind  models.FileAccessKind
+		Total int64
+	}
+	if err := base().Select("day, kind, SUM(count) AS total").Group("day, kind").Scan(&daily).Error; err != nil {
+		return nil, err
+	}
+	summary.Daily = make([]FileAnalyticsDay, days)
+	byDay := map[string]*FileAnalyticsDay{}
+	for i := range summary.Daily {
+		summary.Daily[i].Day = today.AddDate(0, 0, i-(days-1)).Format("2006-01-02")
+		byDay[summary.Daily[i].Day] = &summary.Daily[i]
+	}
+	for _, row := range daily {
+		d := byDay[row.Day]
+		if d == nil {
+			continue
+		}
+		if row.Kind == models.FileAccessDownload {
+			d.Downloads += row.Total
+			summary.Downloads += row.Total
+		} else {
+			d.Views += row.Total
+			summary.Views += row.Total
+		}
+	}
+
+	if err := base().Distinct("visitor_hash").Count(&summary.UniqueVisitors).Error; err != nil {
+		return nil, err
+	}
+
+	summary.TopReferrers = []FileReferrerCount{}
+	if err := base().Select("referrer_host AS host, SUM(count) AS count").
+		Where("referrer_host <> ''").
+		Group("referrer_host").Order("count DESC, host").Limit(topReferrerLimit).
+		Scan(&summary.TopReferrers).Error; err != nil {
+		return nil, err
+	}
+
+	var shares []struct {
+		ShareID uuid.UUID
+		Kind    models.FileAccessKind
+		Total   int64
+	}
+	if err := base().Select("share_id, kind, SUM(count) AS total").
+		Group("share_id, kind").Scan(&shares).Error; err != nil {
+		return nil, err
+	}
+	var visitors []struct {
+		ShareID  uuid.UUID
+		Visitors int64
+	}
+	if err := base().Select("share_id, COUNT(DISTINCT visitor_hash) AS visitors").
+		Group("share_id").Order("share_id").Scan(&visitors).Error; err != nil {
+		return nil, err
+	}
+	summary.Shares = make([]ShareAnalytics, len(visitors))
+	perShare := map[uuid.UUID]*ShareAnalytics{}
+	for i, row := range visitors {
+		summary.Shares[i].UniqueVisitors = row.Visitors
+		if row.ShareID != uuid.Nil {
+			id := row.ShareID
+			summary.Shares[i].ShareID = &id
+		}
+		perShare[row.ShareID] = &summary.Shares[i]
+	}
+	for _, row := range shares {
+		entry := perShare[row.ShareID]
+		if entry == nil {
+			continue
+		}
+		if row.Kind == models.FileAccessDownload {
+			entry.Downloads += row.Total
+		} else {
+			entry.Views += row.Total
+		}
+	}
+
+	since := today.AddDate(0, 0, -(days - 1)).Truncate(24 * time.Hour)
+	var logs []models.AuditLog
+	if err := s.DB.WithContext(ctx).
+		Where("resource_id = ? AND action = ? AND created_at >= ?", fileID, AuditActionPublicDownload, since).
+		Order("created_at DESC").Limit(anonymousDownloadLimit).
+		Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	summary.AnonymousDownloads = make([]AnonymousDownload, len(logs))
+	for i, entry := range logs {
+		download := AnonymousDownload{At: entry.CreatedAt, IPAddress: entry.IPAddress}
+		download.UserAgent, _ = entry.Details["user_agent"].(string)
+		if raw, ok := entry.Details["share_id"].(string); ok {
+			if id, err := uuid.Parse(raw); err == nil {
+				download.ShareID = &id
+			}
+		}
+		summary.AnonymousDownloads[i] = download
+	}
+
+	return summary, nil
+}
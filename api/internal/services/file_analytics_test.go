@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func setupFileAnalyticsTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.FileAccessStat{}, &models.AuditLog{}); err != nil {
+		t.Fatalf("failed automigrating models: %v", err)
+	}
+	return db
+}
+
+func TestFileAnalyticsService_RecordAndSummarize(t *testing.T) {
+	db := setupFileAnalyticsTestDB(t)
+	service := NewFileAnalyticsService(db, "salt", "https://www.docs.example.com")
+	ctx := context.Background()
+
+	fileID, shareID, userID := uuid.New(), uuid.New(), uuid.New()
+	anon := FileAccess{FileID: fileID, ShareID: &shareID, Kind: models.FileAccessView, IPAddress: "203.0.113.7", UserAgent: "curl", Referrer: "https://www.Example.org/post"}
+
+	service.Record(ctx, anon)
+	service.Record(ctx, anon)
+	anon.Kind = models.FileAccessDownload
+	service.Record(ctx, anon)
+	service.Record(ctx, FileAccess{FileID: fileID, Kind: models.FileAccessView, UserID: &userID, Referrer: "https://docs.example.com/shared/x"})
+	service.Record(ctx, FileAccess{FileID: uuid.New(), Kind: models.FileAccessView, IPAddress: "203.0.113.8"})
+
+	var rows int64
+	db.Model(&models.FileAccessStat{}).Where("file_id = ?", fileID).Count(&rows)
+	if rows != 3 {
+		t.Fatalf("expected repeat access to be aggregated into 3 rows, got %d", rows)
+	}
+
+	summary, err := service.Summarize(ctx, fileID, 7)
+	if err != nil {
+		t.Fatalf("summarize failed: %v", err)
+	}
+	if summary.Views != 3 || summary.Downloads != 1 || summary.UniqueVisitors != 2 {
+		t.Fatalf("unexpected totals %+v", summary)
+	}
+	if len(summary.Daily) != 7 || summary.Daily[6].Views != 3 || summary.Daily[0].Views != 0 {
+		t.Fatalf("expected 7 days ending today, got %+v", summary.Daily)
+	}
+	if len(summary.TopReferrers) != 1 || summary.TopReferrers[0].Host != "example.org" || summary.TopReferrers[0].Count != 3 {
+		t.Fatalf("expected only the external referrer, got %+v", summary.TopReferrers)
+	}
+	if len(summary.Shares) != 2 {
+		t.Fatalf("expected access split by share, got %+v", summary.Shares)
+	}
+	for _, s := range summary.Shares {
+		if s.ShareID != nil && (*s.ShareID != shareID || s.Views != 2 || s.Downloads != 1 || s.UniqueVisitors != 1) {
+			t.Fatalf("unexpected share breakdown %+v", s)
+		}
+		if s.ShareID == nil && s.Views != 1 {
+			t.Fatalf("unexpected direct access breakdown %+v", s)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+// FolderDiffChange is an entry present on both sides whose type, size or
+// digest differs.
+type FolderDiffChange struct {
+	Path   string        `json:"path"`
+	Before ManifestEntry `json:"before"`
+	After  ManifestEntry `json:"after"`
+}
+
+// FolderDiff compares two folder trees by relative path. It is shallow in
+// the git sense: entries are compared by metadata and digest only, never by
+// content.
+type FolderDiff struct {
+	Added     []ManifestEntry    `json:"added"`
+	Removed   []ManifestEntry    `json:"removed"`
+	Changed   []FolderDiffChange `json:"changed"`
+	Unchanged int                `json:"unchanged"`
+}
+
+// Identical reports whether the two trees matched entry for entry.
+func (d FolderDiff) Identical() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffEntries reports how target differs from base. Both slices must be
+// sorted by path, as returned by ManifestService.Entries.
+func DiffEntries(base, target []ManifestEntry) FolderDiff {
+	diff := FolderDiff{
+		Added:   []ManifestEntry{},
+		Removed: []ManifestEntry{},
+		Changed: []FolderDiffChange{},
+	}
+	i, j := 0, 0
+	for i < len(base) || j < len(target) {
+		switch {
+		case j >= len(target) || (i < len(base) && base[i].Path < target[j].Path):
+			diff.Removed = append(diff.Removed, base[i])
+			i++
+		case i >= len(base) || target[j].Path < base[i].Path:
+			diff.Added = append(diff.Added, target[j])
+			j++
+		default:
+			if base[i] == target[j] {
+				diff.Unchanged++
+			} else {
+				diff.Changed = append(diff.Changed, FolderDiffChange{Path: base[i].Path, Before: base[i], After: target[j]})
+			}
+			i++
+			j++
+		}
+	}
+	return diff
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestDiffEntries(t *testing.T) {
+	base := []ManifestEntry{
+		{Path: "bin", IsDirectory: true},
+		{Path: "bin/app", Size: 10, SHA256: "aaa"},
+		{Path: "CHANGELOG.md", Size: 3, SHA256: "ccc"},
+		{Path: "old.txt", Size: 1, SHA256: "ddd"},
+	}
+	target := []ManifestEntry{
+		{Path: "bin", IsDirectory: true},
+		{Path: "bin/app", Size: 12, SHA256: "bbb"},
+		{Path: "CHANGELOG.md", Size: 3, SHA256: "ccc"},
+		{Path: "new.txt", Size: 2, SHA256: "eee"},
+	}
+	sortByPath := func(entries []ManifestEntry) {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	}
+	sortByPath(base)
+	sortByPath(target)
+
+	diff := DiffEntries(base, target)
+	if diff.Identical() {
+		t.Fatal("expected differences")
+	}
+	if len(diff.Added) != 1 || diff.Added[0].Path != "new.txt" {
+		t.Fatalf("unexpected added: %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Path != "old.txt" {
+		t.Fatalf("unexpected removed: %+v", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Path != "bin/app" || diff.Changed[0].Before.SHA256 != "aaa" || diff.Changed[0].After.SHA256 != "bbb" {
+		t.Fatalf("unexpected changed: %+v", diff.Changed)
+	}
+	if diff.Unchanged != 2 {
+		t.Fatalf("expected 2 unchanged entries, got %d", diff.Unchanged)
+	}
+
+	if same := DiffEntries(base, base); !same.Identical() || same.Unchanged != len(base) {
+		t.Fatalf("expected identical trees, got %+v", same)
+	}
+}
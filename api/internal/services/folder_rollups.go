@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	folderRollupJob        = "folder.rollup"
+	folderRollupRebuildJob = "folder.rollup_rebuild"
+)
+
+// rollupEvents are the outbox events that can change a folder's totals.
+var rollupEvents = map[string]bool{
+	"file.upload":   true,
+	"file.create":   true,
+	"file.edit":     true,
+	"file.delete":   true,
+	"file.update":   true,
+	"folder.create": true,
+}
+
+// FolderRollups keeps File.TotalSize and File.ItemCount of directories.
+// File events from the outbox queue a folder.rollup job for each folder
+// they touched; the job recounts that folder from its direct children and,
+// if its totals changed, queues its parent, so a change climbs the tree one
+// level per job. Recounting rather than applying deltas keeps redelivered
+// events harmless. Files written without an event, such as imports, are
+// counted by a rebuild.
+type FolderRollups struct {
+	DB   *gorm.DB
+	Jobs *JobRunner
+}
+
+func NewFolderRollups(db *gorm.DB, jobs *JobRunner) *FolderRollups {
+	r := &FolderRollups{DB: db, Jobs: jobs}
+	jobs.Register(folderRollupJob, r.runFolder, JobOptions{})
+	jobs.Register(folderRollupRebuildJob, r.runRebuild, JobOptions{MaxAttempts: 1})
+	return r
+}
+
+func (r *FolderRollups) Name() string {
+	return "folder_rollups"
+}
+
+// HandleEvent queues the folders an event touched: the file's parent, the
+// folder itself for folder events, and the previous parent of a move.
+func (r *FolderRollups) HandleEvent(ctx context.Context, event models.OutboxEvent) error {
+	if event.ResourceType != "file" || event.ResourceID == nil || !rollupEvents[event.EventType] {
+		return nil
+	}
+	var file models.File
+	if err := r.DB.WithContext(ctx).Unscoped().Select("id", "parent_id", "is_directory").
+		First(&file, "id = ?", *event.ResourceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	var folders []uuid.UUID
+	if file.IsDirectory {
+		folders = append(folders, file.ID)
+	}
+	if file.ParentID != nil {
+		folders = append(folders, *file.ParentID)
+	}
+	if previous, ok := event.Payload["previous_parent_id"].(string); ok {
+		if id, err := uuid.Parse(previous); err == nil {
+			folders = append(folders, id)
+		}
+	}
+	for _, id := range folders {
+		if err := r.Queue(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Queue schedules a recount of folderID unless one is already waiting.
+func (r *FolderRollups) Queue(ctx context.Context, folderID uuid.UUID) error {
+	_, err := r.Jobs.Enqueue(ctx, folderRollupJob, map[string]interface{}{"folder_id": folderID.String()}, EnqueueOptions{UniqueKey: "rollup:" + folderID.String()})
+	return err
+}
+
+func (r *FolderRollups) runFolder(ctx context.Context, job *models.Job) error {
+	raw, _ := job.Payload["folder_id"].(string)
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return errors.New("folder rollup job without a folder_id")
+	}
+	return r.Recount(ctx, id)
+}
+
+type folderTotals struct {
+	Size  int64
+	Items int64
+}
+
+// Recount recomputes one folder's totals from its direct children, taking
+// the child folders' own totals as they stand, and queues the parent when
+// they changed. Deleted folders are left alone. The folder's updated_at is
+// not touched: its contents changed, not the folder.
+func (r *FolderRollups) Recount(ctx context.Context, folderID uuid.UUID) error {
+	db := r.DB.WithContext(ctx)
+	var folder models.File
+	if err := db.Select("id", "parent_id", "total_size", "item_count").
+		First(&folder, "id = ? AND is_directory = ?", folderID, true).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	var totals folderTotals
+	if err := db.Model(&models.File{}).
+		Select("COALESCE(SUM(CASE WHEN is_directory THEN COALESCE(total_size, 0) ELSE size END), 0) AS size, "+
+			"COUNT(*) + COALESCE(SUM(CASE WHEN is_directory THEN COALESCE(item_count, 0) ELSE 0 END), 0) AS items").
+		Where("parent_id = ?", folderID).
+		Scan(&totals).Error; err != nil {
+		return err
+	}
+	if folder.TotalSize != nil && folder.ItemCount != nil && *folder.TotalSize == totals.Size && *folder.ItemCount == totals.Items {
+		return nil
+	}
+	if err := db.Model(&models.File{}).Where("id = ?", folderID).UpdateColumns(map[string]interface{}{
+		"total_size": totals.Size,
+		"item_count": totals.Items,
+	}).Error; err != nil {
+		return err
+	}
+	if folder.ParentID != nil {
+		return r.Queue(ctx, *folder.ParentID)
+	}
+	return nil
+}
+
+// StartRebuild queues a recount of every folder. A rebuild already waiting
+// is returned instead.
+func (r *FolderRollups) StartRebuild(ctx context.Context) (*models.Job, error) {
+	return r.Jobs.Enqueue(ctx, folderRollupRebuildJob, nil, EnqueueOptions{UniqueKey: folderRollupRebuildJob})
+}
+
+// runRebuild computes every folder's totals in one pass over the tree and
+// writes those that differ. Folder IDs and per-folder sums are kept in
+// memory.
+func (r *FolderRollups) runRebuild(ctx context.Context, _ *models.Job) error {
+	db := r.DB.WithContext(ctx)
+	var folders []models.File
+	if err := db.Select("id", "parent_id", "total_size", "item_count").
+		Where("is_directory = ?", true).Find(&folders).Error; err != nil {
+		return err
+	}
+	var sums []struct {
+		ParentID uuid.UUID
+		Size     int64
+		Items    int64
+	}
+	if err := db.Model(&models.File{}).
+		Select("parent_id, COALESCE(SUM(size), 0) AS size, COUNT(*) AS items").
+		Where("parent_id IS NOT NULL AND is_directory = ?", false).
+		Group("parent_id").
+		Scan(&sums).Error; err != nil {
+		return err
+	}
+
+	direct := make(map[uuid.UUID]folderTotals, len(sums))
+	for _, s := range sums {
+		direct[s.ParentID] = folderTotals{Size: s.Size, Items: s.Items}
+	}
+	children := map[uuid.UUID][]uuid.UUID{}
+	for _, f := range folders {
+		if f.ParentID != nil {
+			children[*f.ParentID] = append(children[*f.ParentID], f.ID)
+		}
+	}
+
+	computed := make(map[uuid.UUID]folderTotals, len(folders))
+	visiting := map[uuid.UUID]bool{}
+	var total func(id uuid.UUID) folderTotals
+	total = func(id uuid.UUID) folderTotals {
+		if t, ok := computed[id]; ok {
+			return t
+		}
+		// A parent loop would otherwise recurse forever; count what is
+		// below the loop once.
+		if visiting[id] {
+			return folderTotals{}
+		}
+		visiting[id] = true
+		t := direct[id]
+		for _, child := range children[id] {
+			ct := total(child)
+			t.Size += ct.Size
+			t.Items += ct.Items + 1
+		}
+		computed[id] = t
+		return t
+	}
+
+	updated := 0
+	for _, f := range folders {
+		t := total(f.ID)
+		if f.TotalSize != nil && f.ItemCount != nil && *f.TotalSize == t.Size && *f.ItemCount == t.Items {
+			continue
+		}
+		if err := db.Model(&models.File{}).Where("id = ?", f.ID).UpdateColumns(map[string]interface{}{
+			"total_size": t.Size,
+			"item_count": t.Items,
+		}).Error; err != nil {
+			return err
+		}
+		updated++
+	}
+
+	logger.Info("folder_rollup_rebuild_completed", map[string]interface{}{
+		"folders": len(folders),
+		"updated": updated,
+	})
+	return nil
+}
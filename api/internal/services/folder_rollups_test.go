@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestFolderRollups(t *testing.T) {
+	logger.Init()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.File{}, &models.Job{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+
+	owner := models.User{Email: "rollups@test.com", FirstName: "R", LastName: "U", PasswordHash: "x"}
+	db.Create(&owner)
+	folder := func(name string, parent *models.File) models.File {
+		f := models.File{Name: name, MimeType: "inode/directory", IsDirectory: true, OwnerID: owner.ID}
+		if parent != nil {
+			f.ParentID = &parent.ID
+		}
+		db.Create(&f)
+		return f
+	}
+	file := func(name string, size int64, parent models.File) models.File {
+		f := models.File{Name: name, MimeType: "text/plain", Size: size, OwnerID: owner.ID, ParentID: &parent.ID, StoragePath: "owner/" + name}
+		db.Create(&f)
+		return f
+	}
+	root := folder("root", nil)
+	docs := folder("docs", &root)
+	archive := folder("archive", &root)
+
+	jobs := NewJobRunner(db, config.JobsConfig{})
+	rollups := NewFolderRollups(db, jobs)
+	ctx := context.Background()
+
+	drain := func() {
+		t.Helper()
+		for {
+			ran, err := jobs.RunNext(ctx)
+			if err != nil {
+				t.Fatalf("rollup job failed: %v", err)
+			}
+			if !ran {
+				return
+			}
+		}
+	}
+	event := func(eventType string, f models.File, payload map[string]interface{}) {
+		t.Helper()
+		if err := rollups.HandleEvent(ctx, models.OutboxEvent{EventType: eventType, ResourceType: "file", ResourceID: &f.ID, Payload: payload}); err != nil {
+			t.Fatalf("failed handling %s: %v", eventType, err)
+		}
+	}
+	totals := func(f models.File) (int64, int64) {
+		t.Helper()
+		var got models.File
+		db.First(&got, "id = ?", f.ID)
+		if got.TotalSize == nil || got.ItemCount == nil {
+			t.Fatalf("expected %s to be counted", f.Name)
+		}
+		return *got.TotalSize, *got.ItemCount
+	}
+
+	t.Run("climbs the tree on upload", func(t *testing.T) {
+		a := file("a.txt", 100, docs)
+		event("file.upload", a, nil)
+		event("file.upload", a, nil)
+		drain()
+		if size, items := totals(docs); size != 100 || items != 1 {
+			t.Fatalf("unexpected docs totals %d/%d", size, items)
+		}
+		if size, items := totals(root); size != 100 || items != 3 {
+			t.Fatalf("unexpected root totals %d/%d", size, items)
+		}
+	})
+
+	t.Run("moves out of the old parent", func(t *testing.T) {
+		b := file("b.txt", 50, archive)
+		event("file.upload", b, nil)
+		drain()
+		db.Model(&b).Update("parent_id", docs.ID)
+		event("file.update", b, map[string]interface{}{"previous_parent_id": archive.ID.String()})
+		drain()
+		if size, items := totals(archive); size != 0 || items != 0 {
+			t.Fatalf("unexpected archive totals %d/%d", size, items)
+		}
+		if size, items := totals(docs); size != 150 || items != 2 {
+			t.Fatalf("unexpected docs totals %d/%d", size, items)
+		}
+		if size, items := totals(root); size != 150 || items != 4 {
+			t.Fatalf("unexpected root totals %d/%d", size, items)
+		}
+	})
+
+	t.Run("drops deleted subtrees", func(t *testing.T) {
+		db.Delete(&models.File{}, "parent_id = ?", docs.ID)
+		db.Delete(&docs)
+		event("file.delete", docs, nil)
+		drain()
+		if size, items := totals(root); size != 0 || items != 1 {
+			t.Fatalf("unexpected root totals %d/%d", size, items)
+		}
+	})
+
+	t.Run("rebuild counts files written without events", func(t *testing.T) {
+		nested := folder("nested", &archive)
+		file("c.txt", 7, nested)
+		file("d.txt", 3, archive)
+		db.Model(&models.File{}).Where("id = ?", root.ID).UpdateColumn("total_size", 999)
+
+		if _, err := rollups.StartRebuild(ctx); err != nil {
+			t.Fatalf("failed starting rebuild: %v", err)
+		}
+		drain()
+		if size, items := totals(nested); size != 7 || items != 1 {
+			t.Fatalf("unexpected nested totals %d/%d", size, items)
+		}
+		if size, items := totals(archive); size != 10 || items != 3 {
+			t.Fatalf("unexpected archive totals %d/%d", size, items)
+		}
+		if size, items := totals(root); size != 10 || items != 4 {
+			t.Fatalf("unexpected root totals %d/%d", size, items)
+		}
+	})
+}
@@ -0,0 +1,652 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/storage"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxTemplateEntries bounds how many folders and files a template
+	// holds, since using one creates them all in a single request.
+	MaxTemplateEntries = 1000
+	// MaxTemplateSeedBytes bounds the seed files copied into a template
+	// and out again each time it is used.
+	MaxTemplateSeedBytes = 100 << 20
+)
+
+var (
+	ErrTemplateNotFound = errors.New("template not found")
+	// ErrTemplateInvalid is wrapped with the reason a template or its use
+	// was refused.
+	ErrTemplateInvalid   = errors.New("invalid template")
+	ErrTemplateTooLarge  = errors.New("folder has too many items or seed files too large for a template")
+	ErrTemplateVariables = errors.New("missing template variables")
+)
+
+// templateVariable matches a {{name}} placeholder.
+var templateVariable = regexp.MustCompile(`\{\{\s*([A-Za-z][A-Za-z0-9_]*)\s*\}\}`)
+
+// builtinTemplateVariables are filled in without the caller giving them.
+var builtinTemplateVariables = map[string]func(now time.Time) string{
+	"date": func(now time.Time) string { return now.Format("2006-01-02") },
+	"year": func(now time.Time) string { return now.Format("2006") },
+}
+
+// SaveTemplateRequest describes a template to save from a folder.
+type SaveTemplateRequest struct {
+	Name        string
+	Description string
+	Shared      bool
+	// IncludeFiles copies the files in the folder into the template as
+	// seed files; without it only folders are kept.
+	IncludeFiles bool
+	// IncludeShares keeps the private shares and share defaults of the
+	// folders and files the saver owns.
+	IncludeShares bool
+}
+
+// InstantiateResult is what using a template created.
+type InstantiateResult struct {
+	Folder  *models.File `json:"folder"`
+	Folders int          `json:"folders"`
+	Files   int          `json:"files"`
+	Shares  int          `json:"shares"`
+	// Approvals counts shares held for approval because the target is
+	// under share control.
+	Approvals int `json:"approvals"`
+	// SkippedShares counts shares whose recipient no longer exists.
+	SkippedShares int `json:"skippedShares"`
+}
+
+// FolderTemplates saves folder structures as templates and recreates them.
+// Seed file content is copied into Store under templates/ when a template
+// is saved, and copied out again for every use.
+type FolderTemplates struct {
+	DB    *gorm.DB
+	Store TransferStore
+}
+
+func NewFolderTemplates(db *gorm.DB, store TransferStore) *FolderTemplates {
+	return &FolderTemplates{DB: db, Store: store}
+}
+
+// Visible returns the templates userID owns or that are shared in their
+// organization, by name.
+func (t *FolderTemplates) Visible(ctx context.Context, user *models.User) ([]models.FolderTemplate, error) {
+	var templates []models.FolderTemplate
+	err := t.visible(ctx, user).Order("name ASC, id ASC").Find(&templates).Error
+	return templates, err
+}
+
+// Get loads a template userID can see, with its entries.
+func (t *FolderTemplates) Get(ctx context.Context, user *models.User, id uuid.UUID) (*models.FolderTemplate, error) {
+	var tmpl models.FolderTemplate
+	err := t.visible(ctx, user).
+		Preload("Entries", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).
+		First(&tmpl, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tmpl, nil
+}
+
+func (t *FolderTemplates) visible(ctx context.Context, user *models.User) *gorm.DB {
+	db := t.DB.WithContext(ctx)
+	if user.OrganizationID == nil {
+		return db.Where("owner_id = ? OR (shared = ? AND organization_id IS NULL)", user.ID, true)
+	}
+	return db.Where("owner_id = ? OR (shared = ? AND organization_id = ?)", user.ID, true, *user.OrganizationID)
+}
+
+// Save makes a template of folder and everything below it. Quarantined and
+// vault folders are left out with their contents; so are seed files that
+// are quarantined, in cold storage or protected by someone else's
+// password.
+func (t *FolderTemplates) Save(ctx context.Context, owner *models.User, folder *models.File, req SaveTemplateRequest) (*models.FolderTemplate, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = folder.Name
+	}
+	if len(name) > 255 {
+		return nil, fmt.Errorf("%w: name must be at most 255 characters", ErrTemplateInvalid)
+	}
+	if !folder.IsDirectory {
+		return nil, fmt.Errorf("%w: only folders can be saved as templates", ErrTemplateInvalid)
+	}
+
+	entries, err := t.collect(ctx, owner, folder, req)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &models.FolderTemplate{
+		Name:           name,
+		Description:    strings.TrimSpace(req.Description),
+		OwnerID:        owner.ID,
+		OrganizationID: owner.OrganizationID,
+		Shared:         req.Shared,
+		Variables:      []string{},
+	}
+	tmpl.ID = uuid.New()
+	variables := map[string]bool{}
+	for i := range entries {
+		entries[i].TemplateID = tmpl.ID
+		entries[i].Position = i
+		if entries[i].IsDirectory {
+			tmpl.Folders++
+		} else {
+			tmpl.Files++
+			tmpl.SeedBytes += entries[i].Size
+		}
+		for _, m := range templateVariable.FindAllStringSubmatch(entries[i].Path, -1) {
+			if _, builtin := builtinTemplateVariables[m[1]]; !builtin && !variables[m[1]] {
+				variables[m[1]] = true
+				tmpl.Variables = append(tmpl.Variables, m[1])
+			}
+		}
+	}
+	sort.Strings(tmpl.Variables)
+	if len(entries) > MaxTemplateEntries || tmpl.SeedBytes > MaxTemplateSeedBytes {
+		return nil, ErrTemplateTooLarge
+	}
+
+	// Snapshot the seed files under templates/ before the template row is
+	// written, so entries never name a key that was not copied; if a copy
+	// or the save fails, the keys already made are removed.
+	var copied []string
+	cleanup := func() {
+		for _, key := range copied {
+			_ = t.Store.Delete(context.WithoutCancel(ctx), key)
+		}
+	}
+	for i := range entries {
+		e := &entries[i]
+		if e.IsDirectory {
+			continue
+		}
+		key := fmt.Sprintf("templates/%s/%s", tmpl.ID, uuid.NewString())
+		if err := t.copyObject(ctx, e.StoragePath, key, e.Size, e.MimeType); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("%s: %w", e.Path, err)
+		}
+		copied = append(copied, key)
+		e.StoragePath = key
+	}
+
+	err = t.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(tmpl).Error; err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(entries, legalExportBatchSize).Error
+	})
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	tmpl.Entries = entries
+	logger.InfoWithUser(owner.ID.String(), "folder_template_saved", map[string]interface{}{
+		"template_id": tmpl.ID.String(),
+		"folder_id":   folder.ID.String(),
+		"folders":     tmpl.Folders,
+		"files":       tmpl.Files,
+	})
+	return tmpl, nil
+}
+
+// collect lists folder's subtree as template entries, parents before their
+// children. Entry StoragePath still points at the source objects.
+func (t *FolderTemplates) collect(ctx context.Context, owner *models.User, folder *models.File, req SaveTemplateRequest) ([]models.FolderTemplateEntry, error) {
+	db := t.DB.WithContext(ctx)
+	ids, err := fileSubtree(ctx, t.DB, folder.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > MaxTemplateEntries {
+		return nil, ErrTemplateTooLarge
+	}
+	byID := make(map[uuid.UUID]*models.File, len(ids))
+	for start := 0; start < len(ids); start += legalExportBatchSize {
+		var batch []models.File
+		if err := db.Where("id IN ?", ids[start:min(start+legalExportBatchSize, len(ids))]).Find(&batch).Error; err != nil {
+			return nil, err
+		}
+		for i := range batch {
+			byID[batch[i].ID] = &batch[i]
+		}
+	}
+
+	paths := map[uuid.UUID]string{folder.ID: templateName(folder.Name)}
+	blocked := map[uuid.UUID]bool{folder.ID: folderSkipReason(folder) != ""}
+	if blocked[folder.ID] {
+		return nil, fmt.Errorf("%w: quarantined and encrypted folders cannot be saved as templates", ErrTemplateInvalid)
+	}
+	var resolve func(f *models.File) (string, bool)
+	resolve = func(f *models.File) (string, bool) {
+		if p, ok := paths[f.ID]; ok {
+			return p, blocked[f.ID]
+		}
+		p, skip := "", true
+		if parent, ok := byID[*f.ParentID]; ok {
+			p, skip = resolve(parent)
+		}
+		p += "/" + templateName(f.Name)
+		if !skip {
+			if f.IsDirectory {
+				skip = folderSkipReason(f) != ""
+			} else {
+				skip = !req.IncludeFiles || archiveSkipReason(f, owner.ID) != ""
+			}
+		}
+		paths[f.ID], blocked[f.ID] = p, skip
+		return p, skip
+	}
+
+	var kept []*models.File
+	for _, f := range byID {
+		if _, skip := resolve(f); !skip {
+			kept = append(kept, f)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool { return paths[kept[i].ID] < paths[kept[j].ID] })
+
+	entries := make([]models.FolderTemplateEntry, 0, len(kept))
+	index := make(map[uuid.UUID]int, len(kept))
+	for _, f := range kept {
+		index[f.ID] = len(entries)
+		e := models.FolderTemplateEntry{Path: paths[f.ID], IsDirectory: f.IsDirectory}
+		if !f.IsDirectory {
+			e.MimeType, e.Size, e.Checksum, e.StoragePath = f.MimeType, f.Size, f.Checksum, f.StoragePath
+		}
+		entries = append(entries, e)
+	}
+	if !req.IncludeShares {
+		return entries, nil
+	}
+
+	var owned []uuid.UUID
+	for _, f := range kept {
+		if f.OwnerID == owner.ID {
+			owned = append(owned, f.ID)
+		}
+	}
+	for start := 0; start < len(owned); start += legalExportBatchSize {
+		batch := owned[start:min(start+legalExportBatchSize, len(owned))]
+		var shares []models.Share
+		if err := db.Where("file_id IN ? AND share_type = ?", batch, models.ShareTypePrivate).
+			Where("shared_with_user_id IS NOT NULL OR shared_with_group_id IS NOT NULL").
+			Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+			Order("created_at ASC").
+			Find(&shares).Error; err != nil {
+			return nil, err
+		}
+		for _, s := range shares {
+			e := &entries[index[s.FileID]]
+			e.Shares = append(e.Shares, models.FolderTemplateShare{
+				SharedWithUserID:  s.SharedWithUserID,
+				SharedWithGroupID: s.SharedWithGroupID,
+				Permission:        s.Permission,
+				Watermark:         s.Watermark,
+				ViewOnly:          s.ViewOnly,
+			})
+		}
+		var defaults []models.FolderShareDefaults
+		if err := db.Where("folder_id IN ?", batch).Find(&defaults).Error; err != nil {
+			return nil, err
+		}
+		for _, d := range defaults {
+			entries[index[d.FolderID]].ShareDefaults = &models.FolderTemplateShareDefaults{
+				Permission:  d.Permission,
+				ExpiryDays:  d.ExpiryDays,
+				AllowPublic: d.AllowPublic,
+			}
+		}
+	}
+	return entries, nil
+}
+
+func (t *FolderTemplates) copyObject(ctx context.Context, from, to string, size int64, contentType string) error {
+	data, err := t.Store.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+	return t.Store.Upload(ctx, to, data, size, contentType)
+}
+
+// Update changes a template's name, description and sharing.
+func (t *FolderTemplates) Update(ctx context.Context, tmpl *models.FolderTemplate, name, description *string, shared *bool) error {
+	updates := map[string]interface{}{}
+	if name != nil {
+		n := strings.TrimSpace(*name)
+		if n == "" || len(n) > 255 {
+			return fmt.Errorf("%w: name must be 1 to 255 characters", ErrTemplateInvalid)
+		}
+		tmpl.Name, updates["name"] = n, n
+	}
+	if description != nil {
+		tmpl.Description = strings.TrimSpace(*description)
+		updates["description"] = tmpl.Description
+	}
+	if shared != nil {
+		tmpl.Shared, updates["shared"] = *shared, *shared
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return t.DB.WithContext(ctx).Model(tmpl).Updates(updates).Error
+}
+
+// Delete removes a template and its seed files.
+func (t *FolderTemplates) Delete(ctx context.Context, tmpl *models.FolderTemplate) error {
+	var keys []string
+	if err := t.DB.WithContext(ctx).Model(&models.FolderTemplateEntry{}).
+		Where("template_id = ? AND storage_path <> ''", tmpl.ID).
+		Pluck("storage_path", &keys).Error; err != nil {
+		return err
+	}
+	err := t.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("template_id = ?", tmpl.ID).Delete(&models.FolderTemplateEntry{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(tmpl).Error
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := t.Store.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+			logger.Warn("folder_template_seed_delete_failed", map[string]interface{}{
+				"template_id": tmpl.ID.String(),
+				"key":         key,
+				"error":       err.Error(),
+			})
+		}
+	}
+	return nil
+}
+
+// Instantiate recreates tmpl, which must have its entries loaded, under
+// parentID, or in user's root when it is nil, with variables filled into
+// the names. The new folder is numbered if its name is taken. Everything
+// is created as user's; template shares are made by user too, and held
+// for approval where the target is under share control.
+func (t *FolderTemplates) Instantiate(ctx context.Context, user *models.User, tmpl *models.FolderTemplate, parentID *uuid.UUID, variables map[string]string, entry AuditEntry) (*InstantiateResult, error) {
+	if len(tmpl.Entries) == 0 {
+		return nil, fmt.Errorf("%w: template has no folders", ErrTemplateInvalid)
+	}
+	values, err := templateValues(tmpl.Variables, variables, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	names := make([][]string, len(tmpl.Entries))
+	for i, e := range tmpl.Entries {
+		for _, segment := range strings.Split(e.Path, "/") {
+			name := strings.TrimSpace(templateVariable.ReplaceAllStringFunc(segment, func(m string) string {
+				return values[templateVariable.FindStringSubmatch(m)[1]]
+			}))
+			if name == "" || name == "." || name == ".." || len(name) > 255 || strings.ContainsAny(name, "/\\") {
+				return nil, fmt.Errorf("%w: %q is not a valid name", ErrTemplateInvalid, name)
+			}
+			names[i] = append(names[i], name)
+		}
+	}
+	if err := CheckStorageQuota(ctx, t.DB, user.OrganizationID, tmpl.SeedBytes); err != nil {
+		return nil, err
+	}
+	root := names[0][0]
+	if root, err = freeFolderName(t.DB.WithContext(ctx), parentID, user.ID, root); err != nil {
+		return nil, err
+	}
+
+	// Give each new file its own copy of its seed before any file row is
+	// created. Objects copied before a failure, or before the transaction
+	// below rolls back, are deleted again.
+	keys := make([]string, len(tmpl.Entries))
+	var copied []string
+	cleanup := func() {
+		for _, key := range copied {
+			_ = t.Store.Delete(context.WithoutCancel(ctx), key)
+		}
+	}
+	for i, e := range tmpl.Entries {
+		if e.IsDirectory {
+			continue
+		}
+		name := names[i][len(names[i])-1]
+		key := fmt.Sprintf("%s/%s/%s", user.ID, uuid.NewString(), name)
+		if err := t.copyObject(ctx, e.StoragePath, key, e.Size, e.MimeType); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("%s: %w", e.Path, err)
+		}
+		copied = append(copied, key)
+		keys[i] = key
+	}
+
+	result := &InstantiateResult{}
+	err = t.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		created := map[string]*models.File{}
+		for i, e := range tmpl.Entries {
+			segments := names[i]
+			segments[0] = root
+			path := strings.Join(segments, "/")
+			if created[path] != nil {
+				// Two entries came out with the same name.
+				continue
+			}
+			var parent *uuid.UUID
+			if len(segments) == 1 {
+				parent = parentID
+			} else if p := created[strings.Join(segments[:len(segments)-1], "/")]; p != nil {
+				parent = &p.ID
+			} else {
+				continue
+			}
+			f := &models.File{
+				Name:           segments[len(segments)-1],
+				IsDirectory:    e.IsDirectory,
+				ParentID:       parent,
+				OwnerID:        user.ID,
+				OrganizationID: user.OrganizationID,
+			}
+			action, details := "folder.create", map[string]interface{}{"folder_name": f.Name}
+			if e.IsDirectory {
+				f.MimeType = "inode/directory"
+				result.Folders++
+			} else {
+				f.MimeType, f.Size, f.Checksum, f.StoragePath = e.MimeType, e.Size, e.Checksum, keys[i]
+				action, details = "file.create", map[string]interface{}{"file_name": f.Name, "mime_type": f.MimeType}
+				result.Files++
+			}
+			details["source"] = "template"
+			details["template_id"] = tmpl.ID.String()
+			if err := tx.Create(f).Error; err != nil {
+				return err
+			}
+			created[path] = f
+			if i == 0 {
+				result.Folder = f
+			}
+			entry.Action, entry.ResourceType, entry.ResourceID, entry.Details = action, "file", &f.ID, details
+			if err := RecordEvent(tx, entry); err != nil {
+				return err
+			}
+			if e.ShareDefaults != nil && e.IsDirectory {
+				if err := tx.Create(&models.FolderShareDefaults{
+					FolderID:    f.ID,
+					Permission:  e.ShareDefaults.Permission,
+					ExpiryDays:  e.ShareDefaults.ExpiryDays,
+					AllowPublic: e.ShareDefaults.AllowPublic,
+				}).Error; err != nil {
+					return err
+				}
+			}
+			for _, s := range e.Shares {
+				if err := t.share(ctx, tx, user, f, s, entry, result); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	logger.InfoWithUser(user.ID.String(), "folder_template_used", map[string]interface{}{
+		"template_id": tmpl.ID.String(),
+		"folder_id":   result.Folder.ID.String(),
+		"folders":     result.Folders,
+		"files":       result.Files,
+	})
+	return result, nil
+}
+
+// share makes one template share on f, the way sharing it by hand would:
+// share defaults fill in the expiry, and share control holds it for
+// approval. Recipients who are gone or in another organization are
+// skipped.
+func (t *FolderTemplates) share(ctx context.Context, tx *gorm.DB, user *models.User, f *models.File, s models.FolderTemplateShare, entry AuditEntry, result *InstantiateResult) error {
+	if s.SharedWithUserID != nil {
+		var count int64
+		if err := tx.Model(&models.User{}).Scopes(OrganizationScope("users", user.OrganizationID)).
+			Where("id = ?", *s.SharedWithUserID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 || *s.SharedWithUserID == user.ID {
+			result.SkippedShares++
+			return nil
+		}
+	}
+	if s.SharedWithGroupID != nil {
+		var count int64
+		if err := tx.Model(&models.Group{}).Scopes(OrganizationScope("groups", user.OrganizationID)).
+			Where("id = ?", *s.SharedWithGroupID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			result.SkippedShares++
+			return nil
+		}
+	}
+
+	share := models.Share{
+		FileID:            f.ID,
+		SharedByID:        user.ID,
+		SharedWithUserID:  s.SharedWithUserID,
+		SharedWithGroupID: s.SharedWithGroupID,
+		ShareType:         models.ShareTypePrivate,
+		Permission:        s.Permission,
+		Watermark:         s.Watermark,
+		ViewOnly:          s.ViewOnly,
+	}
+	defaults, err := EffectiveShareDefaults(ctx, tx, f.ID)
+	if err != nil {
+		return err
+	}
+	if err := ApplyShareDefaults(defaults, &share, time.Now()); err != nil {
+		return err
+	}
+	details := map[string]interface{}{
+		"file_name":  f.Name,
+		"permission": string(share.Permission),
+		"share_type": string(share.ShareType),
+		"source":     "template",
+	}
+	if share.SharedWithUserID != nil {
+		details["shared_with_user_id"] = share.SharedWithUserID.String()
+	}
+	if share.SharedWithGroupID != nil {
+		details["shared_with_group_id"] = share.SharedWithGroupID.String()
+	}
+
+	control, err := EffectiveShareControl(ctx, tx, f.ID)
+	if err != nil {
+		return err
+	}
+	if ShareNeedsApproval(control, &share) {
+		approval, err := RequestShareApproval(tx, control, &share, nil)
+		if err != nil {
+			return err
+		}
+		details["approval_id"] = approval.ID.String()
+		details["approver_group_id"] = control.ApproverGroupID.String()
+		details["controlled_folder_id"] = control.FolderID.String()
+		entry.Action, entry.ResourceType = "share.approval_request", "share_approval"
+		result.Approvals++
+	} else {
+		if err := tx.Create(&share).Error; err != nil {
+			return err
+		}
+		details["share_id"] = share.ID.String()
+		entry.Action, entry.ResourceType = "share.create", "share"
+		result.Shares++
+	}
+	entry.ResourceID, entry.Details = &f.ID, details
+	return RecordEvent(tx, entry)
+}
+
+// templateValues checks that every variable the template needs was given
+// and adds the built-in ones.
+func templateValues(needed []string, given map[string]string, now time.Time) (map[string]string, error) {
+	values := map[string]string{}
+	for name, fn := range builtinTemplateVariables {
+		values[name] = fn(now)
+	}
+	var missing []string
+	for _, name := range needed {
+		v := strings.TrimSpace(given[name])
+		if v == "" {
+			missing = append(missing, name)
+			continue
+		}
+		values[name] = v
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateVariables, strings.Join(missing, ", "))
+	}
+	return values, nil
+}
+
+// templateName keeps a file name from being read as more than one path
+// segment.
+func templateName(name string) string {
+	return strings.ReplaceAll(name, "/", "_")
+}
+
+// freeFolderName returns base, or "base (n)" for the first n that is free
+// among parentID's children, or ownerID's root items when parentID is nil.
+func freeFolderName(db *gorm.DB, parentID *uuid.UUID, ownerID uuid.UUID, base string) (string, error) {
+	name := base
+	for n := 1; ; n++ {
+		query := db.Model(&models.File{}).Where("name = ?", name)
+		if parentID == nil {
+			query = query.Where("parent_id IS NULL AND owner_id = ?", ownerID)
+		} else {
+			query = query.Where("parent_id = ?", *parentID)
+		}
+		var taken int64
+		if err := query.Count(&taken).Error; err != nil {
+			return "", err
+		}
+		if taken == 0 {
+			return name, nil
+		}
+		name = fmt.Sprintf("%s (%d)", base, n)
+	}
+}
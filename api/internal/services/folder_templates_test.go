@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestFolderTemplates(t *testing.T) {
+	logger.Init()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Group{}, &models.File{}, &models.Organization{}, &models.Share{},
+		&models.FolderShareDefaults{}, &models.ShareControl{}, &models.ShareApproval{}, &models.OutboxEvent{},
+		&models.FolderTemplate{}, &models.FolderTemplateEntry{}); err != nil {
+		t.Fatalf("failed automigrating models: %v", err)
+	}
+	ctx := context.Background()
+	bucket := newMemoryBucket()
+	templates := NewFolderTemplates(db, bucket)
+
+	owner := models.User{Email: "tmpl@example.com", FirstName: "Tem", LastName: "Plate", PasswordHash: "hash", Role: models.UserRoleUser}
+	colleague := models.User{Email: "colleague@example.com", FirstName: "Col", LastName: "League", PasswordHash: "hash", Role: models.UserRoleUser}
+	db.Create(&owner)
+	db.Create(&colleague)
+	otherID := uuid.New()
+
+	newFile := func(name string, parent *models.File, content string, edit func(*models.File)) models.File {
+		f := models.File{Name: name, OwnerID: owner.ID, MimeType: "text/plain", Size: int64(len(content)), StoragePath: uuid.NewString()}
+		if parent != nil {
+			f.ParentID = &parent.ID
+		}
+		if content == "" {
+			f.IsDirectory, f.MimeType, f.StoragePath = true, "inode/directory", ""
+		} else {
+			bucket.put(f.StoragePath, content)
+		}
+		if edit != nil {
+			edit(&f)
+		}
+		if err := db.Create(&f).Error; err != nil {
+			t.Fatalf("failed creating %s: %v", name, err)
+		}
+		return f
+	}
+	project := newFile("Project {{client}}", nil, "", nil)
+	contracts := newFile("Contracts", &project, "", nil)
+	newFile("Checklist.md", &project, "- [ ] kickoff", nil)
+	newFile("Drafts {{year}}", &contracts, "", nil)
+	newFile("secret.txt", &project, "hidden", func(f *models.File) { f.OwnerID, f.PasswordProtected = otherID, true })
+	week := 7
+	db.Create(&models.FolderShareDefaults{FolderID: contracts.ID, Permission: models.SharePermissionView, ExpiryDays: &week})
+	db.Create(&models.Share{FileID: contracts.ID, SharedByID: owner.ID, SharedWithUserID: &colleague.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionEdit})
+	db.Create(&models.Share{FileID: project.ID, SharedByID: owner.ID, ShareType: models.ShareTypePublicAnyone, Permission: models.SharePermissionView})
+
+	tmpl, err := templates.Save(ctx, &owner, &project, SaveTemplateRequest{Name: "Client project", IncludeFiles: true, IncludeShares: true})
+	if err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if tmpl.Folders != 3 || tmpl.Files != 1 || tmpl.SeedBytes != int64(len("- [ ] kickoff")) {
+		t.Fatalf("unexpected counters %+v", tmpl)
+	}
+	if len(tmpl.Variables) != 1 || tmpl.Variables[0] != "client" {
+		t.Fatalf("expected only the client variable, got %v", tmpl.Variables)
+	}
+	var paths []string
+	for _, e := range tmpl.Entries {
+		paths = append(paths, e.Path)
+	}
+	want := []string{"Project {{client}}", "Project {{client}}/Checklist.md", "Project {{client}}/Contracts", "Project {{client}}/Contracts/Drafts {{year}}"}
+	if len(paths) != len(want) {
+		t.Fatalf("expected %v, got %v", want, paths)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, paths)
+		}
+	}
+	if len(tmpl.Entries[0].Shares) != 0 || len(tmpl.Entries[2].Shares) != 1 || tmpl.Entries[2].ShareDefaults == nil {
+		t.Fatalf("expected only the private share and defaults of Contracts, got %+v", tmpl.Entries)
+	}
+	if seed := tmpl.Entries[1].StoragePath; string(bucket.objects[seed]) != "- [ ] kickoff" {
+		t.Fatalf("expected the seed copied into the template, got %q at %q", bucket.objects[seed], seed)
+	}
+
+	t.Run("instantiate fills in variables and shares", func(t *testing.T) {
+		loaded, err := templates.Get(ctx, &owner, tmpl.ID)
+		if err != nil {
+			t.Fatalf("get failed: %v", err)
+		}
+		if _, err := templates.Instantiate(ctx, &owner, loaded, nil, nil, AuditEntry{UserID: &owner.ID}); !errors.Is(err, ErrTemplateVariables) {
+			t.Fatalf("expected ErrTemplateVariables, got %v", err)
+		}
+		result, err := templates.Instantiate(ctx, &owner, loaded, nil, map[string]string{"client": "Acme"}, AuditEntry{UserID: &owner.ID})
+		if err != nil {
+			t.Fatalf("instantiate failed: %v", err)
+		}
+		if result.Folder.Name != "Project Acme" || result.Folders != 3 || result.Files != 1 || result.Shares != 1 {
+			t.Fatalf("unexpected result %+v", result)
+		}
+		var drafts models.File
+		if err := db.Where("name = ?", "Drafts "+time.Now().Format("2006")).First(&drafts).Error; err != nil {
+			t.Fatalf("expected the drafts folder named for this year: %v", err)
+		}
+		var checklist models.File
+		db.Where("name = ? AND parent_id = ?", "Checklist.md", result.Folder.ID).First(&checklist)
+		if string(bucket.objects[checklist.StoragePath]) != "- [ ] kickoff" || checklist.OwnerID != owner.ID {
+			t.Fatalf("expected the seed copied into a new file, got %+v", checklist)
+		}
+		var share models.Share
+		if err := db.Joins("JOIN files ON files.id = shares.file_id").
+			Where("files.parent_id = ? AND files.name = ?", result.Folder.ID, "Contracts").First(&share).Error; err != nil {
+			t.Fatalf("expected the Contracts share made again: %v", err)
+		}
+		if share.SharedWithUserID == nil || *share.SharedWithUserID != colleague.ID || share.ExpiresAt == nil {
+			t.Fatalf("expected the share to colleague with the folder's default expiry, got %+v", share)
+		}
+		var events int64
+		db.Model(&models.OutboxEvent{}).Where("event_type IN ?", []string{"folder.create", "file.create", "share.create"}).Count(&events)
+		if events != 5 {
+			t.Fatalf("expected an event per folder, file and share, got %d", events)
+		}
+
+		again, err := templates.Instantiate(ctx, &owner, loaded, nil, map[string]string{"client": "Acme"}, AuditEntry{UserID: &owner.ID})
+		if err != nil || again.Folder.Name != "Project Acme (1)" {
+			t.Fatalf("expected a numbered folder, got %+v, %v", again, err)
+		}
+		if _, err := templates.Instantiate(ctx, &owner, loaded, nil, map[string]string{"client": "a/b"}, AuditEntry{UserID: &owner.ID}); !errors.Is(err, ErrTemplateInvalid) {
+			t.Fatalf("expected ErrTemplateInvalid for a bad name, got %v", err)
+		}
+	})
+
+	t.Run("only shared templates are visible to others", func(t *testing.T) {
+		if _, err := templates.Get(ctx, &colleague, tmpl.ID); !errors.Is(err, ErrTemplateNotFound) {
+			t.Fatalf("expected ErrTemplateNotFound, got %v", err)
+		}
+		shared := true
+		if err := templates.Update(ctx, tmpl, nil, nil, &shared); err != nil {
+			t.Fatalf("update failed: %v", err)
+		}
+		visible, err := templates.Visible(ctx, &colleague)
+		if err != nil || len(visible) != 1 || visible[0].ID != tmpl.ID {
+			t.Fatalf("expected the shared template, got %v, %v", visible, err)
+		}
+	})
+
+	t.Run("delete removes the seeds", func(t *testing.T) {
+		seed := tmpl.Entries[1].StoragePath
+		if err := templates.Delete(ctx, tmpl); err != nil {
+			t.Fatalf("delete failed: %v", err)
+		}
+		if _, ok := bucket.objects[seed]; ok {
+			t.Fatal("expected the seed object deleted")
+		}
+		var entries int64
+		db.Model(&models.FolderTemplateEntry{}).Where("template_id = ?", tmpl.ID).Count(&entries)
+		if entries != 0 {
+			t.Fatalf("expected the entries deleted, got %d", entries)
+		}
+	})
+}
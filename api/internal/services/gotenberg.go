@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/pkg/logger"
+)
+
+// ErrGotenbergUnavailable is returned instead of attempting a conversion
+// while the circuit breaker is open or every worker stays busy for the
+// queue timeout.
+var ErrGotenbergUnavailable = errors.New("preview unavailable, retry later")
+
+// Breaker states reported in GotenbergStats.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// gotenbergDownError marks a failure that says Gotenberg itself is in
+// trouble (unreachable, or answering 5xx) rather than that one document
+// could not be converted, so only these count towards the breaker.
+type gotenbergDownError struct{ err error }
+
+func (e *gotenbergDownError) Error() string { return e.err.Error() }
+func (e *gotenbergDownError) Unwrap() error { return e.err }
+
+func gotenbergDown(err error) error {
+	return &gotenbergDownError{err: err}
+}
+
+// GotenbergStats is a point-in-time view of the pool for monitoring.
+type GotenbergStats struct {
+	Workers int `json:"workers"`
+	Busy    int `json:"busy"`
+	// Queued counts conversions waiting for a free worker.
+	Queued    int   `json:"queued"`
+	Completed int64 `json:"completed"`
+	Failed    int64 `json:"failed"`
+	// Rejected counts conversions turned away by the breaker or the
+	// queue timeout.
+	Rejected       int64      `json:"rejected"`
+	AvgLatencyMs   int64      `json:"avgLatencyMs"`
+	LastLatencyMs  int64      `json:"lastLatencyMs"`
+	MaxQueueWaitMs int64      `json:"maxQueueWaitMs"`
+	Breaker        string     `json:"breaker"`
+	OpenUntil      *time.Time `json:"openUntil,omitempty"`
+}
+
+// GotenbergPool runs conversions against Gotenberg on a bounded number of
+// workers, each under its own timeout. After BreakerThreshold consecutive
+// failures the breaker opens and conversions fail fast with
+// ErrGotenbergUnavailable for BreakerCooldown; then a single trial
+// conversion is let through, and its outcome closes or reopens it.
+type GotenbergPool struct {
+	slots        chan struct{}
+	timeout      time.Duration
+	queueTimeout time.Duration
+	threshold    int
+	cooldown     time.Duration
+	now          func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+	queued    int
+	completed int64
+	failed    int64
+	rejected  int64
+	latency   time.Duration
+	last      time.Duration
+	maxWait   time.Duration
+}
+
+func NewGotenbergPool(cfg config.GotenbergConfig) *GotenbergPool {
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	threshold := cfg.BreakerThreshold
+	if threshold <= 0 {
+		threshold = 1
+	}
+	return &GotenbergPool{
+		slots:        make(chan struct{}, workers),
+		timeout:      cfg.Timeout,
+		queueTimeout: cfg.QueueTimeout,
+		threshold:    threshold,
+		cooldown:     cfg.BreakerCooldown,
+		now:          time.Now,
+	}
+}
+
+// Do runs convert on a worker. The context passed to convert carries the
+// per-conversion timeout, and convert should finish reading Gotenberg's
+// answer before returning so the worker is held for the whole exchange.
+// A nil pool runs convert directly.
+func (p *GotenbergPool) Do(ctx context.Context, convert func(ctx context.Context) error) error {
+	if p == nil {
+		return convert(ctx)
+	}
+	probe, err := p.admit()
+	if err != nil {
+		return err
+	}
+
+	waitStart := p.now()
+	if err := p.acquire(ctx); err != nil {
+		p.mu.Lock()
+		if probe {
+			p.probing = false
+		}
+		if errors.Is(err, ErrGotenbergUnavailable) {
+			p.rejected++
+		}
+		p.mu.Unlock()
+		return err
+	}
+	defer func() { <-p.slots }()
+	wait := p.now().Sub(waitStart)
+
+	runCtx := ctx
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	start := p.now()
+	err = convert(runCtx)
+	elapsed := p.now().Sub(start)
+
+	// A deadline hit by our own timeout means Gotenberg hung; one hit by
+	// the caller's context says nothing about it.
+	var down *gotenbergDownError
+	counts := err != nil && (errors.As(err, &down) || (runCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil))
+	if counts && down == nil {
+		err = fmt.Errorf("gotenberg conversion timed out after %s: %w", p.timeout, err)
+	}
+	// Anything else that is not the caller giving up means Gotenberg
+	// answered, even if only to refuse this document.
+	answered := !counts && ctx.Err() == nil
+	p.record(probe, wait, elapsed, err, counts, answered)
+	return err
+}
+
+// admit checks the breaker and reports whether the caller is the trial
+// conversion of a half-open breaker.
+func (p *GotenbergPool) admit() (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.openUntil.IsZero() {
+		return false, nil
+	}
+	if p.now().Before(p.openUntil) || p.probing {
+		p.rejected++
+		return false, ErrGotenbergUnavailable
+	}
+	p.probing = true
+	return true, nil
+}
+
+func (p *GotenbergPool) acquire(ctx context.Context) error {
+	p.mu.Lock()
+	p.queued++
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.queued--
+		p.mu.Unlock()
+	}()
+
+	var timeout <-chan time.Time
+	if p.queueTimeout > 0 {
+		timer := time.NewTimer(p.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timeout:
+		return ErrGotenbergUnavailable
+	}
+}
+
+func (p *GotenbergPool) record(probe bool, wait, elapsed time.Duration, err error, down, answered bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if probe {
+		p.probing = false
+	}
+	p.last = elapsed
+	if wait > p.maxWait {
+		p.maxWait = wait
+	}
+
+	if err == nil {
+		p.completed++
+		p.latency += elapsed
+	} else {
+		p.failed++
+	}
+	if answered {
+		if !p.openUntil.IsZero() {
+			logger.Info("gotenberg_breaker_closed", nil)
+		}
+		p.failures = 0
+		p.openUntil = time.Time{}
+		return
+	}
+	if !down {
+		return
+	}
+	p.failures++
+	if probe || p.failures >= p.threshold {
+		p.openUntil = p.now().Add(p.cooldown)
+		logger.Warn("gotenberg_breaker_open", map[string]interface{}{
+			"failures":   p.failures,
+			"open_until": p.openUntil.UTC().Format(time.RFC3339),
+			"error":      err.Error(),
+		})
+	}
+}
+
+// RetryAt is when the breaker next lets a conversion through: now when
+// it is closed, or the end of the cooldown when it is open.
+func (p *GotenbergPool) RetryAt() time.Time {
+	if p == nil {
+		return time.Now()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	if p.openUntil.After(now) {
+		return p.openUntil
+	}
+	return now
+}
+
+func (p *GotenbergPool) Stats() GotenbergStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := GotenbergStats{
+		Workers:        cap(p.slots),
+		Busy:           len(p.slots),
+		Queued:         p.queued,
+		Completed:      p.completed,
+		Failed:         p.failed,
+		Rejected:       p.rejected,
+		LastLatencyMs:  p.last.Milliseconds(),
+		MaxQueueWaitMs: p.maxWait.Milliseconds(),
+		Breaker:        BreakerClosed,
+	}
+	if p.completed > 0 {
+		stats.AvgLatencyMs = (p.latency / time.Duration(p.completed)).Milliseconds()
+	}
+	if !p.openUntil.IsZero() {
+		stats.Breaker = BreakerHalfOpen
+		if p.now().Before(p.openUntil) {
+			stats.Breaker = BreakerOpen
+			openUntil := p.openUntil.UTC()
+			stats.OpenUntil = &openUntil
+		}
+	}
+	return stats
+}
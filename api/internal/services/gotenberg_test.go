@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+)
+
+func TestGotenbergPool_Breaker(t *testing.T) {
+	pool := NewGotenbergPool(config.GotenbergConfig{Workers: 2, BreakerThreshold: 2, BreakerCooldown: time.Minute})
+	now := time.Now()
+	pool.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	down := func(context.Context) error { return gotenbergDown(errors.New("connection refused")) }
+	rejected := func(context.Context) error { return errors.New("gotenberg conversion failed: bad document") }
+	ok := func(context.Context) error { return nil }
+
+	pool.Do(ctx, down)
+	if err := pool.Do(ctx, rejected); err == nil || errors.Is(err, ErrGotenbergUnavailable) {
+		t.Fatalf("expected the document error, got %v", err)
+	}
+	pool.Do(ctx, down)
+	if stats := pool.Stats(); stats.Breaker != BreakerClosed {
+		t.Fatalf("expected a refused document to reset the failure count, got %+v", stats)
+	}
+	pool.Do(ctx, down)
+
+	called := false
+	err := pool.Do(ctx, func(context.Context) error { called = true; return nil })
+	if !errors.Is(err, ErrGotenbergUnavailable) || called {
+		t.Fatalf("expected an open breaker to fail fast, got %v (called %v)", err, called)
+	}
+	if stats := pool.Stats(); stats.Breaker != BreakerOpen || stats.Rejected != 1 || stats.Failed != 4 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if retryAt := pool.RetryAt(); !retryAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("expected a retry at the end of the cooldown, got %v", retryAt)
+	}
+
+	now = now.Add(time.Minute)
+	if stats := pool.Stats(); stats.Breaker != BreakerHalfOpen {
+		t.Fatalf("expected half-open after the cooldown, got %s", stats.Breaker)
+	}
+	pool.Do(ctx, down)
+	if stats := pool.Stats(); stats.Breaker != BreakerOpen {
+		t.Fatalf("expected a failed trial to reopen the breaker, got %s", stats.Breaker)
+	}
+
+	now = now.Add(time.Minute)
+	if err := pool.Do(ctx, ok); err != nil {
+		t.Fatalf("expected the trial to run, got %v", err)
+	}
+	if stats := pool.Stats(); stats.Breaker != BreakerClosed || stats.Completed != 1 {
+		t.Fatalf("expected a successful trial to close the breaker, got %+v", stats)
+	}
+}
+
+func TestGotenbergPool_Limits(t *testing.T) {
+	pool := NewGotenbergPool(config.GotenbergConfig{
+		Workers:          1,
+		Timeout:          50 * time.Millisecond,
+		QueueTimeout:     20 * time.Millisecond,
+		BreakerThreshold: 5,
+	})
+	ctx := context.Background()
+
+	t.Run("conversions time out", func(t *testing.T) {
+		err := pool.Do(ctx, func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the conversion to time out, got %v", err)
+		}
+	})
+
+	t.Run("a full pool turns work away", func(t *testing.T) {
+		release := make(chan struct{})
+		started := make(chan struct{})
+		done := make(chan error)
+		go func() {
+			done <- pool.Do(ctx, func(context.Context) error {
+				close(started)
+				<-release
+				return nil
+			})
+		}()
+		<-started
+
+		if stats := pool.Stats(); stats.Busy != 1 {
+			t.Fatalf("expected one busy worker, got %+v", stats)
+		}
+		if err := pool.Do(ctx, func(context.Context) error { return nil }); !errors.Is(err, ErrGotenbergUnavailable) {
+			t.Fatalf("expected the queue timeout, got %v", err)
+		}
+		close(release)
+		if err := <-done; err != nil {
+			t.Fatalf("expected the running conversion to finish, got %v", err)
+		}
+	})
+}
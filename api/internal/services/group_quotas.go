@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrGroupQuotaExceeded = errors.New("group storage quota exceeded")
+
+// groupQuotaThresholds are the usage percentages group owners are warned
+// at, highest first.
+var groupQuotaThresholds = []int{95, 80}
+
+// groupQuotaEvents are the outbox events that can change a group's usage.
+var groupQuotaEvents = map[string]bool{
+	"file.upload": true,
+	"file.create": true,
+	"file.edit":   true,
+	"file.delete": true,
+	"file.update": true,
+}
+
+// groupDriveSQL lists the files in a group's drive: everything shared with
+// the group through an unexpired share, and everything below a shared
+// folder.
+const groupDriveSQL = `
+	WITH RECURSIVE drive AS (
+		SELECT f.id FROM files f
+		INNER JOIN shares s ON s.file_id = f.id
+		WHERE s.shared_with_group_id = @group AND s.deleted_at IS NULL
+			AND (s.expires_at IS NULL OR s.expires_at > @now)
+			AND f.deleted_at IS NULL
+		UNION
+		SELECT f.id FROM files f
+		INNER JOIN drive d ON f.parent_id = d.id
+		WHERE f.deleted_at IS NULL
+	)`
+
+// GroupUsage is how much of its quota a group uses. DriveBytes counts the
+// group drive and MemberBytes what members own; UsedBytes is what counts
+// against the quota, with files in both counted once.
+type GroupUsage struct {
+	GroupID              uuid.UUID `json:"groupID"`
+	StorageQuotaBytes    *int64    `json:"storageQuotaBytes"`
+	QuotaIncludesMembers bool      `json:"quotaIncludesMembers"`
+	DriveBytes           int64     `json:"driveBytes"`
+	MemberBytes          int64     `json:"memberBytes"`
+	UsedBytes            int64     `json:"usedBytes"`
+	// Percent is UsedBytes as a share of the quota, or nil without one.
+	Percent *float64 `json:"percent"`
+}
+
+// GroupQuotas enforces group storage quotas and warns group owners as
+// usage nears them. Uploads are checked against every group whose drive
+// the destination folder is in and, for groups whose quota includes
+// members, every group the uploader belongs to. As an outbox subscriber it
+// recomputes usage after file events and leaves an activity for the
+// owners when it first crosses 80% and 95%.
+type GroupQuotas struct {
+	DB *gorm.DB
+}
+
+func NewGroupQuotas(db *gorm.DB) *GroupQuotas {
+	return &GroupQuotas{DB: db}
+}
+
+func (q *GroupQuotas) Name() string {
+	return "group_quotas"
+}
+
+// Usage computes a group's current usage.
+func (q *GroupQuotas) Usage(ctx context.Context, groupID uuid.UUID) (*GroupUsage, error) {
+	var group models.Group
+	if err := q.DB.WithContext(ctx).First(&group, "id = ?", groupID).Error; err != nil {
+		return nil, err
+	}
+	return q.usage(ctx, &group)
+}
+
+func (q *GroupQuotas) usage(ctx context.Context, group *models.Group) (*GroupUsage, error) {
+	var sums struct {
+		DriveBytes  int64
+		MemberBytes int64
+		UnionBytes  int64
+	}
+	err := q.DB.WithContext(ctx).Raw(groupDriveSQL+`
+		SELECT
+			COALESCE(SUM(CASE WHEN f.id IN (SELECT id FROM drive) THEN f.size ELSE 0 END), 0) AS drive_bytes,
+			COALESCE(SUM(CASE WHEN m.user_id IS NOT NULL THEN f.size ELSE 0 END), 0) AS member_bytes,
+			COALESCE(SUM(f.size), 0) AS union_bytes
+		FROM files f
+		LEFT JOIN group_memberships m ON m.user_id = f.owner_id AND m.group_id = @group AND m.deleted_at IS NULL
+		WHERE f.is_directory = @dir AND f.deleted_at IS NULL
+			AND (f.id IN (SELECT id FROM drive) OR m.user_id IS NOT NULL)
+	`, map[string]interface{}{"group": group.ID, "now": time.Now().UTC(), "dir": false}).Scan(&sums).Error
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &GroupUsage{
+		GroupID:              group.ID,
+		StorageQuotaBytes:    group.StorageQuotaBytes,
+		QuotaIncludesMembers: group.QuotaIncludesMembers,
+		DriveBytes:           sums.DriveBytes,
+		MemberBytes:          sums.MemberBytes,
+		UsedBytes:            sums.DriveBytes,
+	}
+	if group.QuotaIncludesMembers {
+		usage.UsedBytes = sums.UnionBytes
+	}
+	if group.StorageQuotaBytes != nil && *group.StorageQuotaBytes > 0 {
+		percent := float64(usage.UsedBytes) * 100 / float64(*group.StorageQuotaBytes)
+		usage.Percent = &percent
+	}
+	return usage, nil
+}
+
+// Check returns ErrGroupQuotaExceeded when ownerID storing additional bytes
+// under parentID would take a group over its quota.
+func (q *GroupQuotas) Check(ctx context.Context, ownerID uuid.UUID, parentID *uuid.UUID, additional int64) error {
+	if additional <= 0 {
+		return nil
+	}
+	groups, err := q.applicable(ctx, ownerID, parentID)
+	if err != nil {
+		return err
+	}
+	for i := range groups {
+		usage, err := q.usage(ctx, &groups[i])
+		if err != nil {
+			return err
+		}
+		if usage.UsedBytes+additional > *groups[i].StorageQuotaBytes {
+			return ErrGroupQuotaExceeded
+		}
+	}
+	return nil
+}
+
+// applicable returns the groups with a quota that a file owned by ownerID
+// under parentID counts against.
+func (q *GroupQuotas) applicable(ctx context.Context, ownerID uuid.UUID, parentID *uuid.UUID) ([]models.Group, error) {
+	db := q.DB.WithContext(ctx)
+	var driveGroups []uuid.UUID
+	if parentID != nil {
+		if err := db.Raw(`
+			WITH RECURSIVE ancestors AS (
+				SELECT id, parent_id FROM files WHERE id = @parent AND deleted_at IS NULL
+				UNION ALL
+				SELECT f.id, f.parent_id FROM files f
+				INNER JOIN ancestors a ON f.id = a.parent_id
+				WHERE f.deleted_at IS NULL
+			)
+			SELECT DISTINCT shared_with_group_id FROM shares
+			WHERE file_id IN (SELECT id FROM ancestors) AND shared_with_group_id IS NOT NULL
+				AND deleted_at IS NULL AND (expires_at IS NULL OR expires_at > @now)
+		`, map[string]interface{}{"parent": *parentID, "now": time.Now().UTC()}).Scan(&driveGroups).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	query := db.Where("storage_quota_bytes IS NOT NULL")
+	memberOf := db.Model(&models.GroupMembership{}).Select("group_id").Where("user_id = ?", ownerID)
+	if len(driveGroups) > 0 {
+		query = query.Where("(id IN ? OR (quota_includes_members = ? AND id IN (?)))", driveGroups, true, memberOf)
+	} else {
+		query = query.Where("quota_includes_members = ? AND id IN (?)", true, memberOf)
+	}
+	var groups []models.Group
+	if err := query.Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// HandleEvent re-checks the usage of the groups a file event touched: those
+// whose drive holds the file, or held it before a move, and the owner's
+// groups.
+func (q *GroupQuotas) HandleEvent(ctx context.Context, event models.OutboxEvent) error {
+	if event.ResourceType != "file" || event.ResourceID == nil || !groupQuotaEvents[event.EventType] {
+		return nil
+	}
+	var file models.File
+	if err := q.DB.WithContext(ctx).Unscoped().Select("id", "parent_id", "owner_id").
+		First(&file, "id = ?", *event.ResourceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	parents := []*uuid.UUID{file.ParentID}
+	if previous, ok := event.Payload["previous_parent_id"].(string); ok {
+		if id, err := uuid.Parse(previous); err == nil {
+			parents = append(parents, &id)
+		}
+	}
+	seen := map[uuid.UUID]bool{}
+	for _, parentID := range parents {
+		groups, err := q.applicable(ctx, file.OwnerID, parentID)
+		if err != nil {
+			return err
+		}
+		for i := range groups {
+			if seen[groups[i].ID] {
+				continue
+			}
+			seen[groups[i].ID] = true
+			if err := q.Evaluate(ctx, &groups[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Evaluate compares a group's usage with the warning thresholds. The first
+// time usage reaches a threshold the owners get an activity; once it drops
+// back below one, crossing it again warns again.
+func (q *GroupQuotas) Evaluate(ctx context.Context, group *models.Group) error {
+	usage, err := q.usage(ctx, group)
+	if err != nil {
+		return err
+	}
+	reached := 0
+	if usage.Percent != nil {
+		for _, threshold := range groupQuotaThresholds {
+			if *usage.Percent >= float64(threshold) {
+				reached = threshold
+				break
+			}
+		}
+	}
+
+	db := q.DB.WithContext(ctx)
+	if reached <= group.QuotaWarnedPercent {
+		if reached < group.QuotaWarnedPercent {
+			return db.Model(&models.Group{}).Where("id = ?", group.ID).Update("quota_warned_percent", reached).Error
+		}
+		return nil
+	}
+	// Claim the warning so concurrent evaluations send it once.
+	result := db.Model(&models.Group{}).
+		Where("id = ? AND quota_warned_percent < ?", group.ID, reached).
+		Update("quota_warned_percent", reached)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	group.QuotaWarnedPercent = reached
+
+	var owners []uuid.UUID
+	if err := db.Model(&models.GroupMembership{}).
+		Where("group_id = ? AND role = ?", group.ID, models.GroupRoleOwner).
+		Pluck("user_id", &owners).Error; err != nil {
+		return err
+	}
+	if len(owners) == 0 {
+		return nil
+	}
+	activities := make([]models.Activity, 0, len(owners))
+	for _, owner := range owners {
+		activities = append(activities, *newActivity(models.Activity{
+			UserID:       owner,
+			ActorID:      owner,
+			Action:       "group.quota_warning",
+			ResourceType: "group",
+			ResourceID:   &group.ID,
+			ResourceName: group.Name,
+			MessageKey:   "activity.group.quota_warning",
+			MessageParams: map[string]string{
+				"group":   group.Name,
+				"percent": strconv.Itoa(reached),
+			},
+		}))
+	}
+	if err := db.Create(&activities).Error; err != nil {
+		return err
+	}
+	logger.Info("group_quota_warning", map[string]interface{}{
+		"group_id": group.ID.String(),
+		"percent":  reached,
+	})
+	return nil
+}
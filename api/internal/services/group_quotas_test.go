@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestGroupQuotas(t *testing.T) {
+	logger.Init()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.File{}, &models.Share{}, &models.Group{}, &models.GroupMembership{}, &models.Activity{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+
+	ctx := context.Background()
+	user := func(email string) models.User {
+		u := models.User{Email: email, FirstName: "G", LastName: "Q", PasswordHash: "x"}
+		db.Create(&u)
+		return u
+	}
+	owner, member, outsider := user("quota-owner@test.com"), user("quota-member@test.com"), user("quota-outsider@test.com")
+
+	quota := int64(1000)
+	group := models.Group{Name: "Design", CreatedByID: owner.ID, StorageQuotaBytes: &quota}
+	db.Create(&group)
+	db.Create(&models.GroupMembership{GroupID: group.ID, UserID: owner.ID, Role: models.GroupRoleOwner})
+	db.Create(&models.GroupMembership{GroupID: group.ID, UserID: member.ID, Role: models.GroupRoleMember})
+
+	drive := models.File{Name: "drive", MimeType: "inode/directory", IsDirectory: true, OwnerID: owner.ID}
+	db.Create(&drive)
+	nested := models.File{Name: "nested", MimeType: "inode/directory", IsDirectory: true, OwnerID: owner.ID, ParentID: &drive.ID}
+	db.Create(&nested)
+	db.Create(&models.Share{FileID: drive.ID, SharedByID: owner.ID, SharedWithGroupID: &group.ID, Permission: models.SharePermissionEdit})
+	elsewhere := models.File{Name: "elsewhere", MimeType: "inode/directory", IsDirectory: true, OwnerID: member.ID}
+	db.Create(&elsewhere)
+
+	file := func(name string, size int64, owner models.User, parent models.File) models.File {
+		f := models.File{Name: name, MimeType: "text/plain", Size: size, OwnerID: owner.ID, ParentID: &parent.ID, StoragePath: "q/" + name}
+		db.Create(&f)
+		return f
+	}
+	quotas := NewGroupQuotas(db)
+
+	t.Run("counts the drive", func(t *testing.T) {
+		file("a.txt", 300, outsider, drive)
+		file("b.txt", 400, member, nested)
+		file("c.txt", 200, member, elsewhere)
+
+		usage, err := quotas.Usage(ctx, group.ID)
+		if err != nil {
+			t.Fatalf("failed computing usage: %v", err)
+		}
+		if usage.DriveBytes != 700 || usage.MemberBytes != 600 || usage.UsedBytes != 700 || usage.Percent == nil || *usage.Percent != 70 {
+			t.Fatalf("unexpected usage %+v", usage)
+		}
+	})
+
+	t.Run("holds uploads into the drive to the quota", func(t *testing.T) {
+		if err := quotas.Check(ctx, outsider.ID, &nested.ID, 301); !errors.Is(err, ErrGroupQuotaExceeded) {
+			t.Fatalf("expected ErrGroupQuotaExceeded, got %v", err)
+		}
+		if err := quotas.Check(ctx, outsider.ID, &nested.ID, 300); err != nil {
+			t.Fatalf("expected an upload that fits to pass, got %v", err)
+		}
+		// Outside the drive, members' own files do not count yet.
+		if err := quotas.Check(ctx, member.ID, &elsewhere.ID, 5000); err != nil {
+			t.Fatalf("expected uploads outside the drive to pass, got %v", err)
+		}
+	})
+
+	t.Run("optionally counts members' files", func(t *testing.T) {
+		db.Model(&group).Update("quota_includes_members", true)
+		group.QuotaIncludesMembers = true
+
+		usage, err := quotas.Usage(ctx, group.ID)
+		if err != nil {
+			t.Fatalf("failed computing usage: %v", err)
+		}
+		// b.txt is both in the drive and a member's; it counts once.
+		if usage.UsedBytes != 900 {
+			t.Fatalf("expected 900 bytes used, got %+v", usage)
+		}
+		if err := quotas.Check(ctx, member.ID, &elsewhere.ID, 101); !errors.Is(err, ErrGroupQuotaExceeded) {
+			t.Fatalf("expected a member's upload to count, got %v", err)
+		}
+		if err := quotas.Check(ctx, outsider.ID, &elsewhere.ID, 5000); err != nil {
+			t.Fatalf("expected a non-member's upload outside the drive to pass, got %v", err)
+		}
+	})
+
+	t.Run("warns owners once per threshold", func(t *testing.T) {
+		warnings := func() []models.Activity {
+			var activities []models.Activity
+			db.Where("action = ?", "group.quota_warning").Order("created_at ASC").Find(&activities)
+			return activities
+		}
+		event := func(f models.File) models.OutboxEvent {
+			return models.OutboxEvent{EventType: "file.upload", ResourceType: "file", ResourceID: &f.ID}
+		}
+
+		// 900 of 1000 bytes: past 80%.
+		b := models.File{}
+		db.First(&b, "name = ?", "b.txt")
+		if err := quotas.HandleEvent(ctx, event(b)); err != nil {
+			t.Fatalf("failed handling event: %v", err)
+		}
+		if err := quotas.HandleEvent(ctx, event(b)); err != nil {
+			t.Fatalf("failed handling event: %v", err)
+		}
+		got := warnings()
+		if len(got) != 1 || got[0].UserID != owner.ID || got[0].MessageParams["percent"] != "80" {
+			t.Fatalf("expected one 80%% warning for the owner, got %+v", got)
+		}
+
+		d := file("d.txt", 60, member, drive)
+		if err := quotas.HandleEvent(ctx, event(d)); err != nil {
+			t.Fatalf("failed handling event: %v", err)
+		}
+		got = warnings()
+		if len(got) != 2 || got[1].MessageParams["percent"] != "95" {
+			t.Fatalf("expected a 95%% warning, got %+v", got)
+		}
+
+		// Dropping below 80% and crossing again warns again.
+		db.Delete(&d)
+		db.Delete(&b)
+		if err := quotas.HandleEvent(ctx, event(d)); err != nil {
+			t.Fatalf("failed handling event: %v", err)
+		}
+		var stored models.Group
+		db.First(&stored, "id = ?", group.ID)
+		if stored.QuotaWarnedPercent != 0 {
+			t.Fatalf("expected the warning to reset, got %d", stored.QuotaWarnedPercent)
+		}
+		e := file("e.txt", 400, member, drive)
+		if err := quotas.HandleEvent(ctx, event(e)); err != nil {
+			t.Fatalf("failed handling event: %v", err)
+		}
+		if got := warnings(); len(got) != 3 {
+			t.Fatalf("expected a fresh warning, got %+v", got)
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// HMACScheme opens the Authorization header of a signed request:
+	//
+	//	Authorization: DSH-HMAC-SHA256 KeyId=dshk_…, Timestamp=1700000000, Nonce=…, Signature=…
+	HMACScheme = "DSH-HMAC-SHA256"
+	// ContentSHA256Header carries the hex SHA-256 of the request body, which
+	// the signature covers in place of the body itself.
+	ContentSHA256Header = "X-Content-SHA256"
+	// MaxHMACKeysPerUser matches the API token limit.
+	MaxHMACKeysPerUser = 25
+
+	hmacKeyIDPrefix  = "dshk_"
+	hmacSecretPrefix = "dshs_"
+	// SignatureMaxSkew is how far a request's timestamp may be from the
+	// server clock.
+	SignatureMaxSkew = 5 * time.Minute
+	maxNonceLength   = 64
+)
+
+var (
+	ErrSignatureMalformed = errors.New("malformed signature header")
+	ErrSignatureInvalid   = errors.New("invalid request signature")
+	ErrSignatureExpired   = errors.New("request timestamp is outside the accepted window")
+	ErrSignatureReplayed  = errors.New("request nonce has already been used")
+	ErrHMACKeyExpired     = errors.New("signing key has expired")
+	ErrHMACKeyNotFound    = errors.New("signing key not found")
+	ErrHMACKeyLimit       = errors.New("maximum of 25 signing keys per user")
+)
+
+// SignedRequest is what a signed request presents: the parameters of its
+// Authorization header and the parts of the request the signature covers.
+type SignedRequest struct {
+	KeyID     string
+	Timestamp string
+	Nonce     string
+	Signature string
+
+	Method string
+	// URI is the path with its raw query string, as sent.
+	URI           string
+	ContentSHA256 string
+}
+
+// ParseSignatureHeader reads the parameters of a DSH-HMAC-SHA256
+// Authorization header. The request parts are left for the caller.
+func ParseSignatureHeader(header string) (SignedRequest, error) {
+	var req SignedRequest
+	params, ok := strings.CutPrefix(header, HMACScheme+" ")
+	if !ok {
+		return req, ErrSignatureMalformed
+	}
+	for _, part := range strings.Split(params, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return req, ErrSignatureMalformed
+		}
+		switch strings.ToLower(name) {
+		case "keyid":
+			req.KeyID = value
+		case "timestamp":
+			req.Timestamp = value
+		case "nonce":
+			req.Nonce = value
+		case "signature":
+			req.Signature = value
+		}
+	}
+	if req.KeyID == "" || req.Timestamp == "" || req.Nonce == "" || req.Signature == "" || len(req.Nonce) > maxNonceLength {
+		return req, ErrSignatureMalformed
+	}
+	return req, nil
+}
+
+// StringToSign is what the client signs with HMAC-SHA256 and its secret,
+// one field per line:
+//
+//	DSH-HMAC-SHA256
+//	<method>
+//	<path and query>
+//	<timestamp>
+//	<nonce>
+//	<hex SHA-256 of the body>
+func StringToSign(req SignedRequest) string {
+	return strings.Join([]string{
+		HMACScheme,
+		strings.ToUpper(req.Method),
+		req.URI,
+		req.Timestamp,
+		req.Nonce,
+		strings.ToLower(req.ContentSHA256),
+	}, "\n")
+}
+
+// SignRequest returns the hex signature of req under secret.
+func SignRequest(secret string, req SignedRequest) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(StringToSign(req)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HMACKeys issues request signing keys and verifies the requests signed
+// with them.
+type HMACKeys struct {
+	DB  *gorm.DB
+	now func() time.Time
+}
+
+func NewHMACKeys(db *gorm.DB) *HMACKeys {
+	return &HMACKeys{DB: db, now: time.Now}
+}
+
+// Create issues a key for userID and returns it with its secret, which is
+// not stored in a form that can be shown again.
+func (s *HMACKeys) Create(ctx context.Context, userID uuid.UUID, name string, expiresAt *time.Time) (*models.HMACKey, string, error) {
+	db := s.DB.WithContext(ctx)
+	var count int64
+	if err := db.Model(&models.HMACKey{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return nil, "", err
+	}
+	if count >= MaxHMACKeysPerUser {
+		return nil, "", ErrHMACKeyLimit
+	}
+
+	idBytes := make([]byte, 8)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, "", err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return nil, "", err
+	}
+	secret := hmacSecretPrefix + hex.EncodeToString(secretBytes)
+	encrypted, err := utils.EncryptAESGCM(secret)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := models.HMACKey{
+		UserID:    userID,
+		Name:      name,
+		KeyID:     hmacKeyIDPrefix + hex.EncodeToString(idBytes),
+		Secret:    encrypted,
+		ExpiresAt: expiresAt,
+	}
+	if err := db.Create(&key).Error; err != nil {
+		return nil, "", err
+	}
+	return &key, secret, nil
+}
+
+// Verify checks a signed request and returns the key that signed it. The
+// nonce is spent only once the signature has been found valid, so a forged
+// request cannot burn the nonce of a genuine one.
+func (s *HMACKeys) Verify(ctx context.Context, req SignedRequest) (*models.HMACKey, error) {
+	db := s.DB.WithContext(ctx)
+	now := s.now()
+
+	unix, err := strconv.ParseInt(req.Timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrSignatureMalformed
+	}
+	signedAt := time.Unix(unix, 0)
+	if signedAt.Before(now.Add(-SignatureMaxSkew)) || signedAt.After(now.Add(SignatureMaxSkew)) {
+		return nil, ErrSignatureExpired
+	}
+
+	var key models.HMACKey
+	if err := db.First(&key, "key_id = ?", req.KeyID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSignatureInvalid
+		}
+		return nil, err
+	}
+	secret, err := utils.DecryptAESGCM(key.Secret)
+	if err != nil {
+		return nil, err
+	}
+	expected := SignRequest(secret, req)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(req.Signature))) {
+		return nil, ErrSignatureInvalid
+	}
+	if key.ExpiresAt != nil && key.ExpiresAt.Before(now) {
+		return nil, ErrHMACKeyExpired
+	}
+
+	nonce := models.RequestNonce{KeyID: key.ID, Nonce: req.Nonce, ExpiresAt: signedAt.Add(SignatureMaxSkew)}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&nonce)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrSignatureReplayed
+	}
+
+	db.Model(&key).UpdateColumn("last_used_at", now)
+	return &key, nil
+}
+
+// Revoke deletes one of userID's keys for good.
+func (s *HMACKeys) Revoke(ctx context.Context, userID, id uuid.UUID) (*models.HMACKey, error) {
+	db := s.DB.WithContext(ctx)
+	var key models.HMACKey
+	if err := db.First(&key, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrHMACKeyNotFound
+		}
+		return nil, err
+	}
+	if err := db.Unscoped().Delete(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func CleanupExpiredRequestNonces(db *gorm.DB) error {
+	return db.Unscoped().Where("expires_at < ?", time.Now()).Delete(&models.RequestNonce{}).Error
+}
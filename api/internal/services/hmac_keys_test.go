@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestHMACKeysVerify(t *testing.T) {
+	utils.ConfigureEncryption("hmac-keys-test-secret")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&models.HMACKey{}, &models.RequestNonce{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+
+	keys := NewHMACKeys(db)
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+	ctx := context.Background()
+	key, secret, err := keys.Create(ctx, uuid.New(), "sync", nil)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if key.Secret == secret {
+		t.Fatal("expected the secret to be stored encrypted")
+	}
+
+	signed := func(at time.Time, nonce string) SignedRequest {
+		req := SignedRequest{
+			KeyID:         key.KeyID,
+			Timestamp:     strconv.FormatInt(at.Unix(), 10),
+			Nonce:         nonce,
+			Method:        "POST",
+			URI:           "/api/files/folder?parentID=x",
+			ContentSHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		}
+		req.Signature = SignRequest(secret, req)
+		return req
+	}
+
+	if got, err := keys.Verify(ctx, signed(now, "n1")); err != nil || got.ID != key.ID {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+	if _, err := keys.Verify(ctx, signed(now, "n1")); !errors.Is(err, ErrSignatureReplayed) {
+		t.Fatalf("expected the nonce to be refused a second time, got %v", err)
+	}
+	if _, err := keys.Verify(ctx, signed(now.Add(-SignatureMaxSkew-time.Second), "n2")); !errors.Is(err, ErrSignatureExpired) {
+		t.Fatalf("expected a stale timestamp to be refused, got %v", err)
+	}
+	tampered := signed(now, "n3")
+	tampered.URI = "/api/files/folder?parentID=y"
+	if _, err := keys.Verify(ctx, tampered); !errors.Is(err, ErrSignatureInvalid) {
+		t.Fatalf("expected a changed URI to break the signature, got %v", err)
+	}
+	if _, err := keys.Verify(ctx, signed(now, "n3")); err != nil {
+		t.Fatalf("expected a refused forgery to leave its nonce usable, got %v", err)
+	}
+
+	if _, err := ParseSignatureHeader(HMACScheme + " KeyId=a, Timestamp=1, Signature=b"); !errors.Is(err, ErrSignatureMalformed) {
+		t.Fatalf("expected a header without a nonce to be malformed, got %v", err)
+	}
+	parsed, err := ParseSignatureHeader(HMACScheme + " KeyId=a, Timestamp=1, Nonce=n, Signature=b")
+	if err != nil || parsed.KeyID != "a" || parsed.Nonce != "n" {
+		t.Fatalf("unexpected parse %+v: %v", parsed, err)
+	}
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultIdempotencyWindow is how long a stored response is replayed for
+// its key when no window is configured.
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+var (
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is still in progress")
+	ErrIdempotencyKeyReused  = errors.New("idempotency key was already used for a different request")
+)
+
+// IdempotencyRequest identifies a request made under an idempotency key.
+type IdempotencyRequest struct {
+	UserID uuid.UUID
+	Key    string
+	Method string
+	Path   string
+	// Hash fingerprints the request payload.
+	Hash string
+}
+
+// IdempotencyService stores the first response for each user, key and
+// route so retried requests can be answered without running them again.
+type IdempotencyService struct {
+	DB     *gorm.DB
+	Window time.Duration
+}
+
+func NewIdempotencyService(db *gorm.DB, window time.Duration) *IdempotencyService {
+	if window <= 0 {
+		window = DefaultIdempotencyWindow
+	}
+	return &IdempotencyService{DB: db, Window: window}
+}
+
+// Begin claims the key for req. When an earlier request with the key has
+// completed it returns that record and true, and the caller replays it.
+// While one is still running it returns ErrIdempotencyInProgress, and if
+// the earlier request had a different payload, ErrIdempotencyKeyReused.
+// Otherwise it returns a fresh claim the caller must Complete or Release.
+func (s *IdempotencyService) Begin(ctx context.Context, req IdempotencyRequest) (*models.IdempotencyKey, bool, error) {
+	db := s.DB.WithContext(ctx)
+
+	var existing models.IdempotencyKey
+	err := db.Where("user_id = ? AND key = ? AND method = ? AND path = ?", req.UserID, req.Key, req.Method, req.Path).
+		First(&existing).Error
+	switch {
+	case err == nil && existing.ExpiresAt.After(time.Now()):
+		if existing.RequestHash != req.Hash {
+			return nil, false, ErrIdempotencyKeyReused
+		}
+		if !existing.IsComplete() {
+			return nil, false, ErrIdempotencyInProgress
+		}
+		return &existing, true, nil
+	case err == nil:
+		if err := db.Unscoped().Delete(&existing).Error; err != nil {
+			return nil, false, err
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, false, err
+	}
+
+	claim := models.IdempotencyKey{
+		UserID:      req.UserID,
+		Key:         req.Key,
+		Method:      req.Method,
+		Path:        req.Path,
+		RequestHash: req.Hash,
+		ExpiresAt:   time.Now().Add(s.Window),
+	}
+	if err := db.Create(&claim).Error; err != nil {
+		// Lost a race with a concurrent request carrying the same key.
+		return nil, false, ErrIdempotencyInProgress
+	}
+	return &claim, false, nil
+}
+
+// Complete stores the response for a claimed key.
+func (s *IdempotencyService) Complete(ctx context.Context, claim *models.IdempotencyKey, status int, contentType string, body []byte) error {
+	return s.DB.WithContext(ctx).Model(claim).Updates(map[string]interface{}{
+		"status_code":   status,
+		"content_type":  contentType,
+		"response_body": body,
+	}).Error
+}
+
+// Release drops a claim whose request failed, so the client can retry with
+// the same key.
+func (s *IdempotencyService) Release(ctx context.Context, claim *models.IdempotencyKey) error {
+	return s.DB.WithContext(ctx).Unscoped().Delete(claim).Error
+}
+
+func CleanupExpiredIdempotencyKeys(db *gorm.DB) error {
+	return db.Unscoped().Where("expires_at < ?", time.Now()).Delete(&models.IdempotencyKey{}).Error
+}
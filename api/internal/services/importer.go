@@ -0,0 +1,732 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/storage"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	importRunJob = "import.run"
+	// DefaultImportFolder is the folder imports land in when none is given.
+	DefaultImportFolder = "Imported"
+	// importProgressEvery is how many source entries pass between progress
+	// saves, which is also how often a running import notices a cancel.
+	importProgressEvery = 50
+	maxImportFailures   = 100
+)
+
+var (
+	ErrImportNotFound       = errors.New("import not found")
+	ErrImportNotResumable   = errors.New("only failed or cancelled imports can be resumed")
+	ErrImportFinished       = errors.New("import has already finished")
+	ErrImportPathNotAllowed = errors.New("path is not under an allowed import root")
+	ErrImportSourceMissing  = errors.New("import source not found")
+
+	errImportCancelled = errors.New("import cancelled")
+	errImportYield     = errors.New("import yielding to a new job")
+)
+
+// ImportEntry is one file or directory of an import source. Key is its
+// slash-separated path relative to the source root.
+type ImportEntry struct {
+	Key     string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+}
+
+// ImportSource lists and reads what an import copies. Walk visits entries
+// in a stable order, starting after the entry named by after when it is
+// set, so an interrupted import can resume.
+type ImportSource interface {
+	Walk(ctx context.Context, after string, fn func(ImportEntry) error) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// ObjectUploader stores imported bytes.
+type ObjectUploader interface {
+	Upload(ctx context.Context, objectName string, reader io.Reader, size int64, contentType string) error
+	Delete(ctx context.Context, objectName string) error
+}
+
+// ImportRequest describes an import before it is queued.
+type ImportRequest struct {
+	SourceType     models.ImportSourceType
+	Source         string
+	Prefix         string
+	TargetFolder   string
+	DefaultOwnerID uuid.UUID
+	OwnerRules     []models.ImportOwnerRule
+	// ConnectionID is required for the remote source types.
+	ConnectionID *uuid.UUID
+	Conflict     models.ImportConflict
+}
+
+// Importer brings existing files from a bucket, a mounted directory or a
+// user's connected service into DocShare on the job runner. Each run walks the source in order and saves
+// its cursor as it goes; a run that crashes is picked up again by the
+// runner, and a failed or cancelled one can be resumed, both continuing
+// from the cursor. Files the import itself created are recognised and
+// skipped, which covers entries handled after the last saved cursor.
+type Importer struct {
+	DB     *gorm.DB
+	Store  ObjectUploader
+	Jobs   *JobRunner
+	Policy *UploadPolicy
+	// Remote opens the sources of imports from a connected service. It is
+	// set by NewIntegrations.
+	Remote *Integrations
+	cfg    config.ImportConfig
+	// openSource builds the source an import reads from.
+	openSource func(ctx context.Context, job *models.ImportJob) (ImportSource, error)
+}
+
+func NewImporter(db *gorm.DB, store ObjectUploader, jobs *JobRunner, policy *UploadPolicy, cfg config.ImportConfig) *Importer {
+	im := &Importer{DB: db, Store: store, Jobs: jobs, Policy: policy, cfg: cfg}
+	im.openSource = im.defaultSource
+	jobs.Register(importRunJob, im.runJob, JobOptions{})
+	return im
+}
+
+// Start validates req and queues the import.
+func (im *Importer) Start(ctx context.Context, requestedByID uuid.UUID, req ImportRequest) (*models.ImportJob, error) {
+	job := models.ImportJob{
+		RequestedByID:  requestedByID,
+		SourceType:     req.SourceType,
+		Source:         req.Source,
+		TargetFolder:   strings.TrimSpace(req.TargetFolder),
+		DefaultOwnerID: req.DefaultOwnerID,
+		Conflict:       req.Conflict,
+		Status:         models.ImportStatusPending,
+	}
+	if job.TargetFolder == "" {
+		job.TargetFolder = DefaultImportFolder
+	}
+	switch job.Conflict {
+	case "":
+		job.Conflict = models.ImportConflictSkip
+	case models.ImportConflictSkip, models.ImportConflictRename:
+	default:
+		return nil, fmt.Errorf("unknown import conflict policy %q", req.Conflict)
+	}
+	switch req.SourceType {
+	case models.ImportSourceFilesystem:
+		root, err := im.allowedDir(req.Source)
+		if err != nil {
+			return nil, err
+		}
+		job.Source = root
+	case models.ImportSourceS3:
+		if strings.TrimSpace(req.Source) == "" {
+			return nil, ErrImportSourceMissing
+		}
+		if prefix := strings.Trim(req.Prefix, "/"); prefix != "" {
+			job.Prefix = prefix + "/"
+		}
+	case models.ImportSourceGoogleDrive, models.ImportSourceWebDAV:
+		if req.ConnectionID == nil {
+			return nil, ErrImportSourceMissing
+		}
+		job.ConnectionID = req.ConnectionID
+		job.Source = strings.Trim(req.Source, "/")
+		if job.Source == "" && req.SourceType == models.ImportSourceGoogleDrive {
+			job.Source = driveRootFolder
+		}
+	default:
+		return nil, fmt.Errorf("unknown import source type %q", req.SourceType)
+	}
+	for _, rule := range req.OwnerRules {
+		rule.Prefix = strings.Trim(rule.Prefix, "/")
+		job.OwnerRules = append(job.OwnerRules, rule)
+	}
+
+	err := im.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&job).Error; err != nil {
+			return err
+		}
+		return im.enqueue(tx, &job)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// allowedDir resolves dir and checks it is a directory under one of the
+// configured roots. Symlinks are resolved first so a link cannot lead out.
+func (im *Importer) allowedDir(dir string) (string, error) {
+	if !filepath.IsAbs(dir) {
+		return "", ErrImportPathNotAllowed
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(dir))
+	if err != nil {
+		return "", ErrImportSourceMissing
+	}
+	info, err := os.Stat(resolved)
+	if err != nil || !info.IsDir() {
+		return "", ErrImportSourceMissing
+	}
+	for _, root := range im.cfg.AllowedRoots {
+		root, err := filepath.EvalSymlinks(filepath.Clean(root))
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(root, resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return resolved, nil
+		}
+	}
+	return "", ErrImportPathNotAllowed
+}
+
+func (im *Importer) enqueue(tx *gorm.DB, job *models.ImportJob) error {
+	_, err := im.Jobs.enqueue(tx, importRunJob, map[string]interface{}{"import_id": job.ID.String()}, EnqueueOptions{UniqueKey: "import:" + job.ID.String()})
+	return err
+}
+
+func (im *Importer) Get(ctx context.Context, id uuid.UUID) (*models.ImportJob, error) {
+	var job models.ImportJob
+	if err := im.DB.WithContext(ctx).First(&job, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImportNotFound
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Cancel stops an import. A running one stops at its next progress save.
+func (im *Importer) Cancel(ctx context.Context, id uuid.UUID) (*models.ImportJob, error) {
+	job, err := im.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != models.ImportStatusPending && job.Status != models.ImportStatusRunning {
+		return nil, ErrImportFinished
+	}
+	if err := im.DB.WithContext(ctx).Model(job).Update("status", models.ImportStatusCancelled).Error; err != nil {
+		return nil, err
+	}
+	job.Status = models.ImportStatusCancelled
+	return job, nil
+}
+
+// Resume queues a failed or cancelled import again from its cursor.
+func (im *Importer) Resume(ctx context.Context, id uuid.UUID) (*models.ImportJob, error) {
+	job, err := im.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != models.ImportStatusFailed && job.Status != models.ImportStatusCancelled {
+		return nil, ErrImportNotResumable
+	}
+	err = im.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		job.Status = models.ImportStatusPending
+		job.LastError = ""
+		job.FinishedAt = nil
+		if err := tx.Save(job).Error; err != nil {
+			return err
+		}
+		return im.enqueue(tx, job)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (im *Importer) runJob(ctx context.Context, runnerJob *models.Job) error {
+	raw, _ := runnerJob.Payload["import_id"].(string)
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("import job without an import id: %q", raw)
+	}
+	job, err := im.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	switch job.Status {
+	case models.ImportStatusPending, models.ImportStatusRunning:
+		return im.Run(ctx, job)
+	default:
+		// Cancelled before it started, or finished by an earlier attempt.
+		return nil
+	}
+}
+
+// Run carries out an import from its cursor. Failures of single files are
+// recorded on the import; only trouble with the source, the database or a
+// cancel ends the run early.
+func (im *Importer) Run(ctx context.Context, job *models.ImportJob) error {
+	now := time.Now().UTC()
+	job.Status = models.ImportStatusRunning
+	if job.StartedAt == nil {
+		job.StartedAt = &now
+	}
+	if err := im.DB.Save(job).Error; err != nil {
+		return err
+	}
+
+	run := &importRun{im: im, job: job, owners: map[uuid.UUID]*models.User{}, folders: map[string]uuid.UUID{}}
+	// A large import outlives a job lease, so each job hands over to a
+	// fresh one halfway through its lease.
+	if deadline, ok := ctx.Deadline(); ok {
+		run.yieldAt = time.Now().Add(time.Until(deadline) / 2)
+	}
+	runErr := run.execute(ctx)
+	if errors.Is(runErr, errImportYield) {
+		return im.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(job).Error; err != nil {
+				return err
+			}
+			return im.enqueue(tx, job)
+		})
+	}
+
+	finished := time.Now().UTC()
+	job.FinishedAt = &finished
+	switch {
+	case errors.Is(runErr, errImportCancelled):
+		job.Status = models.ImportStatusCancelled
+	case runErr != nil:
+		job.Status = models.ImportStatusFailed
+		job.LastError = runErr.Error()
+	default:
+		job.Status = models.ImportStatusCompleted
+	}
+	if err := im.DB.Save(job).Error; err != nil {
+		return err
+	}
+
+	fields := map[string]interface{}{
+		"import_id":       job.ID.String(),
+		"status":          string(job.Status),
+		"files_imported":  job.FilesImported,
+		"bytes_imported":  job.BytesImported,
+		"folders_created": job.FoldersCreated,
+		"files_skipped":   job.FilesSkipped,
+		"files_failed":    job.FilesFailed,
+	}
+	if job.Status == models.ImportStatusFailed {
+		logger.Error("import_failed", runErr, fields)
+	} else {
+		logger.Info("import_finished", fields)
+	}
+	return nil
+}
+
+func (im *Importer) defaultSource(ctx context.Context, job *models.ImportJob) (ImportSource, error) {
+	switch job.SourceType {
+	case models.ImportSourceFilesystem:
+		return dirImportSource{root: job.Source}, nil
+	case models.ImportSourceS3:
+		cfg := im.cfg.Source
+		cfg.Bucket = job.Source
+		client, err := storage.NewS3Client(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return bucketImportSource{client: client, prefix: job.Prefix}, nil
+	case models.ImportSourceGoogleDrive, models.ImportSourceWebDAV:
+		if im.Remote == nil || job.ConnectionID == nil {
+			return nil, errors.New("integrations are not configured")
+		}
+		return im.Remote.OpenSource(ctx, *job.ConnectionID, job)
+	}
+	return nil, fmt.Errorf("unknown import source type %q", job.SourceType)
+}
+
+// importRun holds the state of one pass over a source.
+type importRun struct {
+	im      *Importer
+	job     *models.ImportJob
+	owners  map[uuid.UUID]*models.User
+	folders map[string]uuid.UUID
+	seen    int
+	yieldAt time.Time
+}
+
+func (r *importRun) execute(ctx context.Context) error {
+	if r.im.Store == nil {
+		return errors.New("object storage is not configured")
+	}
+	src, err := r.im.openSource(ctx, r.job)
+	if err != nil {
+		return err
+	}
+	err = src.Walk(ctx, r.job.Cursor, func(entry ImportEntry) error {
+		if entry.IsDir {
+			owner, err := r.owner(entry.Key)
+			if err != nil {
+				return err
+			}
+			if _, err := r.folder(owner, entry.Key); err != nil {
+				return err
+			}
+		} else {
+			r.importFile(ctx, src, entry)
+		}
+		r.job.Cursor = entry.Key
+		r.seen++
+		if r.seen%importProgressEvery != 0 {
+			return nil
+		}
+		if err := r.saveProgress(); err != nil {
+			return err
+		}
+		if !r.yieldAt.IsZero() && time.Now().After(r.yieldAt) {
+			return errImportYield
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return r.saveProgress()
+}
+
+// saveProgress stores the counters and cursor, and reports a cancel made
+// since the last save.
+func (r *importRun) saveProgress() error {
+	var current models.ImportJob
+	if err := r.im.DB.Select("status").First(&current, "id = ?", r.job.ID).Error; err != nil {
+		return err
+	}
+	if current.Status == models.ImportStatusCancelled {
+		return errImportCancelled
+	}
+	return r.im.DB.Model(r.job).Select(
+		"cursor", "files_imported", "folders_created", "bytes_imported", "files_skipped", "files_failed", "failures",
+	).Updates(r.job).Error
+}
+
+func (r *importRun) fail(key string, err error) {
+	r.job.FilesFailed++
+	if len(r.job.Failures) < maxImportFailures {
+		r.job.Failures = append(r.job.Failures, models.ImportFailure{Key: key, Error: err.Error()})
+	}
+}
+
+// owner picks the user the entry at key goes to: the rule with the
+// longest matching prefix, else the default owner.
+func (r *importRun) owner(key string) (*models.User, error) {
+	ownerID := r.job.DefaultOwnerID
+	best := -1
+	for _, rule := range r.job.OwnerRules {
+		if rule.Prefix == "" || key == rule.Prefix || strings.HasPrefix(key, rule.Prefix+"/") {
+			if len(rule.Prefix) > best {
+				best = len(rule.Prefix)
+				ownerID = rule.OwnerID
+			}
+		}
+	}
+	if user, ok := r.owners[ownerID]; ok {
+		return user, nil
+	}
+	var user models.User
+	if err := r.im.DB.First(&user, "id = ?", ownerID).Error; err != nil {
+		return nil, fmt.Errorf("loading owner %s: %w", ownerID, err)
+	}
+	r.owners[ownerID] = &user
+	return &user, nil
+}
+
+// folder returns the folder for the source directory dir, creating it and
+// its parents under the owner's target folder. An empty dir or "." is the
+// target folder itself.
+func (r *importRun) folder(owner *models.User, dir string) (uuid.UUID, error) {
+	dir = strings.Trim(dir, "/")
+	if dir == "." {
+		dir = ""
+	}
+	cacheKey := owner.ID.String() + ":" + dir
+	if id, ok := r.folders[cacheKey]; ok {
+		return id, nil
+	}
+
+	var parentID *uuid.UUID
+	name := r.job.TargetFolder
+	if dir != "" {
+		parent, err := r.folder(owner, path.Dir(dir))
+		if err != nil {
+			return uuid.Nil, err
+		}
+		parentID = &parent
+		name = path.Base(dir)
+	}
+
+	var existing models.File
+	query := r.im.DB.Where("owner_id = ? AND name = ? AND is_directory = ?", owner.ID, name, true)
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+	result := query.Limit(1).Find(&existing)
+	if result.Error != nil {
+		return uuid.Nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		r.folders[cacheKey] = existing.ID
+		return existing.ID, nil
+	}
+
+	created := models.File{
+		Name:           name,
+		MimeType:       "inode/directory",
+		IsDirectory:    true,
+		ParentID:       parentID,
+		OwnerID:        owner.ID,
+		OrganizationID: owner.OrganizationID,
+	}
+	if err := r.im.DB.Create(&created).Error; err != nil {
+		return uuid.Nil, err
+	}
+	r.job.FoldersCreated++
+	r.folders[cacheKey] = created.ID
+	return created.ID, nil
+}
+
+func (r *importRun) importFile(ctx context.Context, src ImportSource, entry ImportEntry) {
+	owner, err := r.owner(entry.Key)
+	if err != nil {
+		r.fail(entry.Key, err)
+		return
+	}
+	parentID, err := r.folder(owner, path.Dir(entry.Key))
+	if err != nil {
+		r.fail(entry.Key, err)
+		return
+	}
+	name, skip, err := r.destinationName(owner.ID, parentID, path.Base(entry.Key), entry.Size)
+	if err != nil {
+		r.fail(entry.Key, err)
+		return
+	}
+	if skip {
+		r.job.FilesSkipped++
+		return
+	}
+	if err := CheckStorageQuota(ctx, r.im.DB, owner.OrganizationID, max(entry.Size, 0)); err != nil {
+		r.fail(entry.Key, err)
+		return
+	}
+
+	reader, err := src.Open(ctx, entry.Key)
+	if err != nil {
+		r.fail(entry.Key, err)
+		return
+	}
+	defer reader.Close()
+
+	buffered := bufio.NewReaderSize(reader, SniffLength)
+	head, _ := buffered.Peek(SniffLength)
+	detected := DetectContentType(head)
+	mimeType := detected
+	if byExt := mime.TypeByExtension(path.Ext(name)); byExt != "" {
+		mimeType = baseMediaType(byExt)
+	}
+	if err := r.im.Policy.Check(name, mimeType, detected); err != nil {
+		r.fail(entry.Key, err)
+		return
+	}
+
+	hash := sha256.New()
+	counted := &countingReader{r: io.TeeReader(buffered, hash)}
+	objectName := fmt.Sprintf("%s/%s/%s", owner.ID, uuid.New(), name)
+	if err := r.im.Store.Upload(ctx, objectName, counted, entry.Size, mimeType); err != nil {
+		r.fail(entry.Key, err)
+		return
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	file := models.File{
+		Name:             name,
+		MimeType:         mimeType,
+		Size:             counted.n,
+		ParentID:         &parentID,
+		OwnerID:          owner.ID,
+		StoragePath:      objectName,
+		Checksum:         &checksum,
+		DetectedMimeType: detected,
+		OrganizationID:   owner.OrganizationID,
+	}
+	if err := r.im.DB.Create(&file).Error; err != nil {
+		_ = r.im.Store.Delete(ctx, objectName)
+		r.fail(entry.Key, err)
+		return
+	}
+	r.job.FilesImported++
+	r.job.BytesImported += counted.n
+}
+
+// destinationName picks the name a source file is stored under in the
+// folder parentID, or reports that it should be skipped. A file this
+// import created earlier is always skipped, so a resumed run does not copy
+// it twice. Another file of the same name is kept, and the import either
+// skips the source file or stores it as "name (n).ext", depending on its
+// conflict policy. size is -1 when the source does not know it.
+func (r *importRun) destinationName(ownerID, parentID uuid.UUID, name string, size int64) (string, bool, error) {
+	taken := func(candidate string) (bool, bool, error) {
+		var existing []models.File
+		if err := r.im.DB.Select("id", "size", "created_at").
+			Where("owner_id = ? AND parent_id = ? AND name = ? AND is_directory = ?", ownerID, parentID, candidate, false).
+			Find(&existing).Error; err != nil {
+			return false, false, err
+		}
+		for _, f := range existing {
+			if !f.CreatedAt.Before(r.job.CreatedAt) && (size < 0 || f.Size == size) {
+				return true, true, nil
+			}
+		}
+		return len(existing) > 0, false, nil
+	}
+
+	exists, ours, err := taken(name)
+	if err != nil || !exists {
+		return name, false, err
+	}
+	if ours || r.job.Conflict != models.ImportConflictRename {
+		return "", true, nil
+	}
+	for n := 1; ; n++ {
+		candidate := numberedName(name, n)
+		exists, ours, err := taken(candidate)
+		if err != nil {
+			return "", false, err
+		}
+		if ours {
+			return "", true, nil
+		}
+		if !exists {
+			return candidate, false, nil
+		}
+	}
+}
+
+// countingReader counts the bytes read through it, for sources that do
+// not know a file's size up front.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// dirImportSource reads a directory tree. Walk follows filepath.WalkDir,
+// which orders paths segment by segment; symlinks are not followed.
+type dirImportSource struct {
+	root string
+}
+
+func (s dirImportSource) Walk(ctx context.Context, after string, fn func(ImportEntry) error) error {
+	return filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if after != "" && !walkOrderAfter(key, after) {
+			// Enter the directories on the way to the cursor; skip the
+			// ones before it.
+			if d.IsDir() && !strings.HasPrefix(after, key+"/") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return fn(ImportEntry{Key: key, IsDir: true})
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(ImportEntry{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+	})
+}
+
+func (s dirImportSource) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.root, filepath.FromSlash(key)))
+}
+
+// walkOrderAfter reports whether key comes after cursor in WalkDir order.
+func walkOrderAfter(key, cursor string) bool {
+	a, b := strings.Split(key, "/"), strings.Split(cursor, "/")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] > b[i]
+		}
+	}
+	return len(a) > len(b)
+}
+
+// bucketImportSource reads the objects under a prefix of another bucket,
+// in key order. Keys ending in a slash are folder markers.
+type bucketImportSource struct {
+	client *storage.S3Client
+	prefix string
+}
+
+func (s bucketImportSource) Walk(ctx context.Context, after string, fn func(ImportEntry) error) error {
+	startAfter := ""
+	if after != "" {
+		startAfter = s.prefix + after
+	}
+	return s.client.ListObjects(ctx, s.prefix, startAfter, func(obj storage.ObjectInfo) error {
+		key := strings.TrimPrefix(obj.Key, s.prefix)
+		if strings.HasSuffix(key, "/") {
+			if key = strings.TrimSuffix(key, "/"); key == "" {
+				return nil
+			}
+			return fn(ImportEntry{Key: key, IsDir: true})
+		}
+		return fn(ImportEntry{Key: key, Size: obj.Size, ModTime: obj.LastModified})
+	})
+}
+
+func (s bucketImportSource) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.client.Download(ctx, s.prefix+key)
+}
+
+// numberedName returns name with " (n)" before its extension, the way a
+// copy is named when the original name is taken.
+func numberedName(name string, n int) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		// A dotfile such as ".env" has no extension to keep.
+		base, ext = name, ""
+	}
+	return fmt.Sprintf("%s (%d)%s", base, n, ext)
+}
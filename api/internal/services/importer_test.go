@@ -0,0 +1,212 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type fakeUploader struct {
+	objects map[string][]byte
+}
+
+func (u *fakeUploader) Upload(_ context.Context, objectName string, reader io.Reader, _ int64, _ string) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	u.objects[objectName] = data
+	return nil
+}
+
+func (u *fakeUploader) Delete(_ context.Context, objectName string) error {
+	delete(u.objects, objectName)
+	return nil
+}
+
+func TestWalkOrderAfter(t *testing.T) {
+	cases := []struct {
+		key, cursor string
+		want        bool
+	}{
+		{"b", "a", true},
+		{"a/z", "b", false},
+		{"a/z", "a", true},
+		{"a", "a/z", false},
+		{"a-b", "a/z", true},
+		{"a/z", "a/z", false},
+	}
+	for _, tc := range cases {
+		if got := walkOrderAfter(tc.key, tc.cursor); got != tc.want {
+			t.Errorf("walkOrderAfter(%q, %q) = %v, want %v", tc.key, tc.cursor, got, tc.want)
+		}
+	}
+}
+
+func TestImporter(t *testing.T) {
+	logger.Init()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.File{}, &models.Job{}, &models.ImportJob{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+
+	admin := models.User{Email: "import-admin@test.com", FirstName: "I", LastName: "A", PasswordHash: "x"}
+	finance := models.User{Email: "import-finance@test.com", FirstName: "I", LastName: "F", PasswordHash: "x"}
+	db.Create(&admin)
+	db.Create(&finance)
+
+	allowed := t.TempDir()
+	root := filepath.Join(allowed, "share")
+	write := func(rel, content string) {
+		t.Helper()
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.txt", "top level")
+	write("finance/q1.csv", "q,total\n1,100\n")
+	write("finance/reports/r.pdf", "%PDF-1.4 report")
+	write("hr/x.txt", "handbook")
+	if err := os.Symlink("/etc/passwd", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &fakeUploader{objects: map[string][]byte{}}
+	jobs := NewJobRunner(db, config.JobsConfig{})
+	im := NewImporter(db, store, jobs, nil, config.ImportConfig{AllowedRoots: []string{allowed}})
+	ctx := context.Background()
+	req := ImportRequest{
+		SourceType:     models.ImportSourceFilesystem,
+		Source:         root,
+		DefaultOwnerID: admin.ID,
+		OwnerRules:     []models.ImportOwnerRule{{Prefix: "finance/", OwnerID: finance.ID}},
+	}
+
+	runNext := func() *models.ImportJob {
+		t.Helper()
+		if ran, err := jobs.RunNext(ctx); !ran || err != nil {
+			t.Fatalf("expected the import to run, got %v %v", ran, err)
+		}
+		var job models.ImportJob
+		db.Order("created_at DESC").First(&job)
+		return &job
+	}
+
+	t.Run("refuses paths outside the allowed roots", func(t *testing.T) {
+		outside := req
+		outside.Source = t.TempDir()
+		if _, err := im.Start(ctx, admin.ID, outside); err != ErrImportPathNotAllowed {
+			t.Fatalf("expected ErrImportPathNotAllowed, got %v", err)
+		}
+		outside.Source = filepath.Join(allowed, "share", "..", "..")
+		if _, err := im.Start(ctx, admin.ID, outside); err != ErrImportPathNotAllowed {
+			t.Fatalf("expected a parent of the root refused, got %v", err)
+		}
+	})
+
+	var importID uuid.UUID
+	t.Run("imports the tree", func(t *testing.T) {
+		started, err := im.Start(ctx, admin.ID, req)
+		if err != nil {
+			t.Fatalf("failed starting: %v", err)
+		}
+		importID = started.ID
+		job := runNext()
+		if job.Status != models.ImportStatusCompleted {
+			t.Fatalf("expected completed, got %s (%s)", job.Status, job.LastError)
+		}
+		if job.FilesImported != 4 || job.FoldersCreated != 5 || job.FilesFailed != 0 || job.Cursor != "hr/x.txt" {
+			t.Fatalf("unexpected progress %+v", job)
+		}
+		if len(store.objects) != 4 {
+			t.Fatalf("expected four objects uploaded, got %d", len(store.objects))
+		}
+
+		var report models.File
+		db.First(&report, "name = ?", "r.pdf")
+		if report.OwnerID != finance.ID || report.DetectedMimeType != "application/pdf" || report.Checksum == nil {
+			t.Fatalf("unexpected imported file %+v", report)
+		}
+		if !bytes.Equal(store.objects[report.StoragePath], []byte("%PDF-1.4 report")) {
+			t.Fatal("expected the file bytes uploaded")
+		}
+		var reports, financeDir, target models.File
+		db.First(&reports, "id = ?", *report.ParentID)
+		db.First(&financeDir, "id = ?", *reports.ParentID)
+		db.First(&target, "id = ?", *financeDir.ParentID)
+		if reports.Name != "reports" || financeDir.Name != "finance" || target.Name != DefaultImportFolder || target.ParentID != nil || target.OwnerID != finance.ID {
+			t.Fatalf("unexpected folder chain %s/%s/%s", target.Name, financeDir.Name, reports.Name)
+		}
+
+		var top models.File
+		db.First(&top, "name = ?", "a.txt")
+		if top.OwnerID != admin.ID {
+			t.Fatalf("expected unmatched files to go to the default owner, got %s", top.OwnerID)
+		}
+	})
+
+	t.Run("resumes from the cursor", func(t *testing.T) {
+		write("finance/a0.txt", "before the cursor")
+		write("hr/y.txt", "after the cursor")
+		db.Model(&models.ImportJob{}).Where("id = ?", importID).Updates(map[string]interface{}{
+			"status": models.ImportStatusFailed,
+			"cursor": "finance/q1.csv",
+		})
+
+		if _, err := im.Resume(ctx, importID); err != nil {
+			t.Fatalf("failed resuming: %v", err)
+		}
+		if _, err := im.Resume(ctx, importID); err != ErrImportNotResumable {
+			t.Fatalf("expected a pending import not resumable, got %v", err)
+		}
+		job := runNext()
+		if job.Status != models.ImportStatusCompleted {
+			t.Fatalf("expected completed, got %s (%s)", job.Status, job.LastError)
+		}
+		if job.FilesImported != 5 || job.FilesSkipped != 2 || job.FoldersCreated != 5 {
+			t.Fatalf("unexpected progress %+v", job)
+		}
+		var count int64
+		db.Model(&models.File{}).Where("name = ?", "a0.txt").Count(&count)
+		if count != 0 {
+			t.Fatal("expected entries before the cursor left alone")
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		if _, err := im.Cancel(ctx, importID); err != ErrImportFinished {
+			t.Fatalf("expected a finished import not cancellable, got %v", err)
+		}
+		started, err := im.Start(ctx, admin.ID, req)
+		if err != nil {
+			t.Fatalf("failed starting: %v", err)
+		}
+		if _, err := im.Cancel(ctx, started.ID); err != nil {
+			t.Fatalf("failed cancelling: %v", err)
+		}
+		job := runNext()
+		if job.ID != started.ID || job.Status != models.ImportStatusCancelled || job.StartedAt != nil {
+			t.Fatalf("expected the import never to start, got %+v", job)
+		}
+	})
+}
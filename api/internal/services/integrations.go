@@ -0,0 +1,447 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"gorm.io/gorm"
+)
+
+const (
+	integrationStateTTL = 10 * time.Minute
+	driveAPIBase        = "https://www.googleapis.com/drive/v3"
+)
+
+var (
+	ErrIntegrationNotEnabled   = errors.New("integration is not enabled")
+	ErrIntegrationNotFound     = errors.New("integration connection not found")
+	ErrIntegrationState        = errors.New("authorization request is invalid or has expired")
+	ErrIntegrationAuth         = errors.New("the remote service rejected the credentials")
+	ErrIntegrationInUse        = errors.New("connection has an import in progress")
+	ErrRemoteUnavailable       = errors.New("remote service could not be reached")
+	ErrRemoteAddressNotAllowed = errors.New("remote address is not allowed")
+)
+
+// RemoteEntry is one item of a remote folder. ID is what Browse and an
+// import take as the folder to read: the file ID on Google Drive, the path
+// on a WebDAV server.
+type RemoteEntry struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	IsDir      bool       `json:"isDir"`
+	Size       int64      `json:"size"`
+	MimeType   string     `json:"mimeType,omitempty"`
+	ModifiedAt *time.Time `json:"modifiedAt,omitempty"`
+}
+
+// Integrations manages users' connections to Google Drive and WebDAV
+// servers and opens them as import sources. Copying is left to the
+// Importer, so a remote import is tracked, cancelled and resumed like an
+// admin one.
+type Integrations struct {
+	DB  *gorm.DB
+	cfg config.IntegrationsConfig
+	// stateKey signs the OAuth state, which carries the user through the
+	// unauthenticated callback.
+	stateKey []byte
+	// davHTTP refuses private addresses unless they are allowed; the
+	// Drive client only talks to Google.
+	davHTTP   *http.Client
+	driveHTTP *http.Client
+	driveAPI  string
+	endpoint  oauth2.Endpoint
+}
+
+// NewIntegrations sets up the integrations and lets importer read from
+// them.
+func NewIntegrations(db *gorm.DB, cfg config.IntegrationsConfig, stateKey string, importer *Importer) *Integrations {
+	s := &Integrations{
+		DB:        db,
+		cfg:       cfg,
+		stateKey:  []byte(stateKey),
+		davHTTP:   &http.Client{Transport: remoteTransport(cfg.WebDAVAllowPrivate)},
+		driveHTTP: &http.Client{Transport: remoteTransport(true)},
+		driveAPI:  driveAPIBase,
+		endpoint:  google.Endpoint,
+	}
+	if importer != nil {
+		importer.Remote = s
+	}
+	return s
+}
+
+// remoteTransport is an http.Transport for servers users name. Without
+// allowPrivate it refuses to connect to loopback, private and link-local
+// addresses, checked after DNS resolution and on every redirect.
+func remoteTransport(allowPrivate bool) *http.Transport {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+				return ErrRemoteAddressNotAllowed
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	transport.ResponseHeaderTimeout = 30 * time.Second
+	return transport
+}
+
+// remoteError turns a failed request into ErrRemoteAddressNotAllowed or
+// ErrRemoteUnavailable.
+func remoteError(err error) error {
+	if errors.Is(err, ErrRemoteAddressNotAllowed) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrRemoteUnavailable, err)
+}
+
+func (s *Integrations) GoogleDriveEnabled() bool {
+	return s.cfg.GoogleDrive.Enabled && s.cfg.GoogleDrive.ClientID != ""
+}
+
+func (s *Integrations) driveOAuthConfig() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     s.cfg.GoogleDrive.ClientID,
+		ClientSecret: s.cfg.GoogleDrive.ClientSecret,
+		RedirectURL:  s.cfg.GoogleDrive.RedirectURL,
+		Scopes:       splitScopes(s.cfg.GoogleDrive.Scopes),
+		Endpoint:     s.endpoint,
+	}
+}
+
+// GoogleAuthURL is where userID is sent to let DocShare read their Drive.
+// Offline access is requested so imports can run after the browser is gone.
+func (s *Integrations) GoogleAuthURL(userID uuid.UUID) (string, error) {
+	if !s.GoogleDriveEnabled() {
+		return "", ErrIntegrationNotEnabled
+	}
+	state, err := s.signState(userID)
+	if err != nil {
+		return "", err
+	}
+	return s.driveOAuthConfig().AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce), nil
+}
+
+type integrationState struct {
+	UserID    uuid.UUID `json:"uid"`
+	ExpiresAt int64     `json:"exp"`
+	Nonce     string    `json:"n"`
+}
+
+func (s *Integrations) signState(userID uuid.UUID) (string, error) {
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(integrationState{
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(integrationStateTTL).Unix(),
+		Nonce:     hex.EncodeToString(nonce),
+	})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + s.stateMAC(encoded), nil
+}
+
+func (s *Integrations) verifyState(state string) (uuid.UUID, error) {
+	encoded, mac, ok := strings.Cut(state, ".")
+	if !ok || !hmac.Equal([]byte(mac), []byte(s.stateMAC(encoded))) {
+		return uuid.Nil, ErrIntegrationState
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return uuid.Nil, ErrIntegrationState
+	}
+	var parsed integrationState
+	if err := json.Unmarshal(payload, &parsed); err != nil || time.Now().Unix() > parsed.ExpiresAt {
+		return uuid.Nil, ErrIntegrationState
+	}
+	return parsed.UserID, nil
+}
+
+func (s *Integrations) stateMAC(encoded string) string {
+	mac := hmac.New(sha256.New, s.stateKey)
+	mac.Write([]byte("integration-state:" + encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ConnectGoogleDrive finishes the OAuth flow started by GoogleAuthURL and
+// stores the token. Connecting the same account again replaces its token.
+func (s *Integrations) ConnectGoogleDrive(ctx context.Context, state, code string) (*models.IntegrationConnection, error) {
+	if !s.GoogleDriveEnabled() {
+		return nil, ErrIntegrationNotEnabled
+	}
+	userID, err := s.verifyState(state)
+	if err != nil {
+		return nil, err
+	}
+	oauthCfg := s.driveOAuthConfig()
+	token, err := oauthCfg.Exchange(context.WithValue(ctx, oauth2.HTTPClient, s.driveHTTP), code)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIntegrationAuth, err)
+	}
+
+	client := s.drive(ctx, oauthCfg.TokenSource(ctx, token))
+	account, err := client.account(ctx)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(token)
+	if err != nil {
+		return nil, err
+	}
+	return s.save(ctx, models.IntegrationConnection{
+		UserID:   userID,
+		Provider: models.IntegrationGoogleDrive,
+		Account:  account,
+	}, string(encoded))
+}
+
+// ConnectWebDAV checks that the credentials open rawURL and stores them.
+// rawURL is the folder imports are relative to, such as a Nextcloud user's
+// files endpoint.
+func (s *Integrations) ConnectWebDAV(ctx context.Context, userID uuid.UUID, rawURL, username, password string) (*models.IntegrationConnection, error) {
+	base, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (base.Scheme != "https" && base.Scheme != "http") || base.Host == "" {
+		return nil, fmt.Errorf("%w: must be an http(s) URL", ErrRemoteUnavailable)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/") + "/"
+	base.RawQuery, base.Fragment, base.RawPath = "", "", ""
+
+	client := &davClient{http: s.davHTTP, base: base, username: username, password: password}
+	if _, err := client.propfind(ctx, "", "0"); err != nil {
+		return nil, err
+	}
+	return s.save(ctx, models.IntegrationConnection{
+		UserID:   userID,
+		Provider: models.IntegrationWebDAV,
+		Account:  username + "@" + base.Host,
+		BaseURL:  base.String(),
+		Username: username,
+	}, password)
+}
+
+// save stores conn with its secret encrypted, replacing the user's
+// existing connection to the same account.
+func (s *Integrations) save(ctx context.Context, conn models.IntegrationConnection, secret string) (*models.IntegrationConnection, error) {
+	encrypted, err := utils.EncryptAESGCM(secret)
+	if err != nil {
+		return nil, err
+	}
+	var existing models.IntegrationConnection
+	result := s.DB.WithContext(ctx).
+		Where("user_id = ? AND provider = ? AND account = ? AND base_url = ?", conn.UserID, conn.Provider, conn.Account, conn.BaseURL).
+		Limit(1).Find(&existing)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		existing.Username = conn.Username
+		existing.Secret = encrypted
+		if err := s.DB.WithContext(ctx).Save(&existing).Error; err != nil {
+			return nil, err
+		}
+		return &existing, nil
+	}
+	conn.Secret = encrypted
+	if err := s.DB.WithContext(ctx).Create(&conn).Error; err != nil {
+		return nil, err
+	}
+	return &conn, nil
+}
+
+func (s *Integrations) Connections(ctx context.Context, userID uuid.UUID) ([]models.IntegrationConnection, error) {
+	var conns []models.IntegrationConnection
+	err := s.DB.WithContext(ctx).Where("user_id = ?", userID).Order("created_at ASC").Find(&conns).Error
+	return conns, err
+}
+
+// Connection loads one of userID's connections.
+func (s *Integrations) Connection(ctx context.Context, userID, id uuid.UUID) (*models.IntegrationConnection, error) {
+	var conn models.IntegrationConnection
+	if err := s.DB.WithContext(ctx).First(&conn, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrIntegrationNotFound
+		}
+		return nil, err
+	}
+	return &conn, nil
+}
+
+// Disconnect forgets a connection. Its finished imports stay listed but can
+// no longer be resumed.
+func (s *Integrations) Disconnect(ctx context.Context, userID, id uuid.UUID) (*models.IntegrationConnection, error) {
+	conn, err := s.Connection(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	var active int64
+	if err := s.DB.WithContext(ctx).Model(&models.ImportJob{}).
+		Where("connection_id = ? AND status IN ?", conn.ID, []models.ImportStatus{models.ImportStatusPending, models.ImportStatusRunning}).
+		Count(&active).Error; err != nil {
+		return nil, err
+	}
+	if active > 0 {
+		return nil, ErrIntegrationInUse
+	}
+	if err := s.DB.WithContext(ctx).Delete(conn).Error; err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Browse lists one folder of a connection; an empty folder is its root.
+func (s *Integrations) Browse(ctx context.Context, conn *models.IntegrationConnection, folder string) ([]RemoteEntry, error) {
+	switch conn.Provider {
+	case models.IntegrationWebDAV:
+		client, err := s.dav(conn)
+		if err != nil {
+			return nil, err
+		}
+		return client.browse(ctx, strings.Trim(folder, "/"))
+	case models.IntegrationGoogleDrive:
+		client, err := s.driveFor(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+		if folder == "" {
+			folder = driveRootFolder
+		}
+		return client.browse(ctx, folder)
+	}
+	return nil, fmt.Errorf("unknown integration provider %q", conn.Provider)
+}
+
+// OpenSource opens the folder job.Source of connection id for the
+// importer. The connection must belong to whoever started the import.
+func (s *Integrations) OpenSource(ctx context.Context, id uuid.UUID, job *models.ImportJob) (ImportSource, error) {
+	conn, err := s.Connection(ctx, job.RequestedByID, id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if err := s.DB.WithContext(ctx).Model(conn).Update("last_used_at", now).Error; err != nil {
+		return nil, err
+	}
+	switch conn.Provider {
+	case models.IntegrationWebDAV:
+		client, err := s.dav(conn)
+		if err != nil {
+			return nil, err
+		}
+		return &webdavImportSource{client: client, root: job.Source}, nil
+	case models.IntegrationGoogleDrive:
+		client, err := s.driveFor(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+		return &driveImportSource{client: client, root: job.Source, files: map[string]driveFile{}}, nil
+	}
+	return nil, fmt.Errorf("unknown integration provider %q", conn.Provider)
+}
+
+func (s *Integrations) dav(conn *models.IntegrationConnection) (*davClient, error) {
+	base, err := url.Parse(conn.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	password, err := utils.DecryptAESGCM(conn.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting connection secret: %w", err)
+	}
+	return &davClient{http: s.davHTTP, base: base, username: conn.Username, password: password}, nil
+}
+
+// driveFor builds a Drive client for conn whose token is refreshed as
+// needed, storing each new token.
+func (s *Integrations) driveFor(ctx context.Context, conn *models.IntegrationConnection) (*driveClient, error) {
+	if !s.GoogleDriveEnabled() {
+		return nil, ErrIntegrationNotEnabled
+	}
+	raw, err := utils.DecryptAESGCM(conn.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting connection secret: %w", err)
+	}
+	var token oauth2.Token
+	if err := json.Unmarshal([]byte(raw), &token); err != nil {
+		return nil, fmt.Errorf("decoding connection token: %w", err)
+	}
+	refreshCtx := context.WithValue(context.Background(), oauth2.HTTPClient, s.driveHTTP)
+	source := &storedTokenSource{
+		base: s.driveOAuthConfig().TokenSource(refreshCtx, &token),
+		last: token.AccessToken,
+		save: func(t *oauth2.Token) error {
+			encoded, err := json.Marshal(t)
+			if err != nil {
+				return err
+			}
+			encrypted, err := utils.EncryptAESGCM(string(encoded))
+			if err != nil {
+				return err
+			}
+			return s.DB.Model(conn).Update("secret", encrypted).Error
+		},
+	}
+	return s.drive(ctx, source), nil
+}
+
+func (s *Integrations) drive(ctx context.Context, source oauth2.TokenSource) *driveClient {
+	client := oauth2.NewClient(context.WithValue(ctx, oauth2.HTTPClient, s.driveHTTP), source)
+	return &driveClient{http: client, api: s.driveAPI}
+}
+
+// storedTokenSource saves the token whenever its source refreshes it, so
+// the next import starts from a valid one.
+type storedTokenSource struct {
+	mu   sync.Mutex
+	base oauth2.TokenSource
+	last string
+	save func(*oauth2.Token) error
+}
+
+func (t *storedTokenSource) Token() (*oauth2.Token, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	token, err := t.base.Token()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIntegrationAuth, err)
+	}
+	if token.AccessToken != t.last {
+		t.last = token.AccessToken
+		if err := t.save(token); err != nil {
+			return nil, err
+		}
+	}
+	return token, nil
+}
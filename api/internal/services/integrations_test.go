@@ -0,0 +1,341 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"golang.org/x/net/webdav"
+	"golang.org/x/oauth2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newIntegrationsTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	logger.Init()
+	utils.ConfigureEncryption("integrations-test-secret")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.File{}, &models.Job{}, &models.ImportJob{}, &models.IntegrationConnection{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+	return db
+}
+
+func runImportJobs(t *testing.T, jobs *JobRunner) {
+	t.Helper()
+	for {
+		ran, err := jobs.RunNext(context.Background())
+		if err != nil {
+			t.Fatalf("import job failed: %v", err)
+		}
+		if !ran {
+			return
+		}
+	}
+}
+
+func importedNames(t *testing.T, db *gorm.DB, ownerID any) []string {
+	t.Helper()
+	var names []string
+	if err := db.Model(&models.File{}).Where("owner_id = ? AND is_directory = ?", ownerID, false).Order("name").Pluck("name", &names).Error; err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestWebDAVImport(t *testing.T) {
+	db := newIntegrationsTestDB(t)
+	user := models.User{Email: "dav@test.com", FirstName: "D", LastName: "V", PasswordHash: "x"}
+	db.Create(&user)
+
+	root := t.TempDir()
+	for rel, content := range map[string]string{
+		"Documents/a.txt":       "alpha",
+		"Documents/sub/b.txt":   "bravo",
+		"Documents/c.txt":       "charlie",
+		"Photos/skipped.txt":    "not imported",
+		"Documents/empty/.keep": "",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dav := &webdav.Handler{Prefix: "/remote.php/dav/files/dana", FileSystem: webdav.Dir(root), LockSystem: webdav.NewMemLS()}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "dana" || p != "app-password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		dav.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	baseURL := server.URL + "/remote.php/dav/files/dana"
+	ctx := context.Background()
+
+	t.Run("refuses private addresses by default", func(t *testing.T) {
+		guarded := NewIntegrations(db, config.IntegrationsConfig{}, "state-key", nil)
+		if _, err := guarded.ConnectWebDAV(ctx, user.ID, baseURL, "dana", "app-password"); !errors.Is(err, ErrRemoteAddressNotAllowed) {
+			t.Fatalf("expected ErrRemoteAddressNotAllowed, got %v", err)
+		}
+	})
+
+	jobs := NewJobRunner(db, config.JobsConfig{})
+	uploader := &fakeUploader{objects: map[string][]byte{}}
+	importer := NewImporter(db, uploader, jobs, nil, config.ImportConfig{})
+	integrations := NewIntegrations(db, config.IntegrationsConfig{WebDAVAllowPrivate: true}, "state-key", importer)
+
+	if _, err := integrations.ConnectWebDAV(ctx, user.ID, baseURL, "dana", "wrong"); !errors.Is(err, ErrIntegrationAuth) {
+		t.Fatalf("expected ErrIntegrationAuth, got %v", err)
+	}
+	conn, err := integrations.ConnectWebDAV(ctx, user.ID, baseURL, "dana", "app-password")
+	if err != nil {
+		t.Fatalf("failed connecting: %v", err)
+	}
+	if conn.Account != "dana@"+strings.TrimPrefix(server.URL, "http://") || conn.Secret == "app-password" {
+		t.Fatalf("unexpected connection %+v", conn)
+	}
+
+	t.Run("browses folders", func(t *testing.T) {
+		entries, err := integrations.Browse(ctx, conn, "Documents")
+		if err != nil {
+			t.Fatalf("failed browsing: %v", err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, fmt.Sprintf("%s:%v", e.ID, e.IsDir))
+		}
+		want := "Documents/a.txt:false,Documents/c.txt:false,Documents/empty:true,Documents/sub:true"
+		if strings.Join(got, ",") != want {
+			t.Fatalf("unexpected listing %v", got)
+		}
+	})
+
+	start := func(conflict models.ImportConflict) *models.ImportJob {
+		t.Helper()
+		job, err := importer.Start(ctx, user.ID, ImportRequest{
+			SourceType:     models.ImportSourceWebDAV,
+			Source:         "/Documents/",
+			TargetFolder:   "Nextcloud",
+			DefaultOwnerID: user.ID,
+			ConnectionID:   &conn.ID,
+			Conflict:       conflict,
+		})
+		if err != nil {
+			t.Fatalf("failed starting import: %v", err)
+		}
+		runImportJobs(t, jobs)
+		loaded, _ := importer.Get(ctx, job.ID)
+		return loaded
+	}
+
+	t.Run("copies the folder", func(t *testing.T) {
+		job := start("")
+		if job.Status != models.ImportStatusCompleted || job.FilesImported != 4 || job.BytesImported != 17 {
+			t.Fatalf("unexpected import %+v", job)
+		}
+		if got := strings.Join(importedNames(t, db, user.ID), ","); got != ".keep,a.txt,b.txt,c.txt" {
+			t.Fatalf("unexpected files %s", got)
+		}
+	})
+
+	t.Run("skips or renames conflicts", func(t *testing.T) {
+		job := start(models.ImportConflictSkip)
+		if job.FilesImported != 0 || job.FilesSkipped != 4 {
+			t.Fatalf("expected everything skipped, got %+v", job)
+		}
+
+		job = start(models.ImportConflictRename)
+		if job.FilesImported != 4 {
+			t.Fatalf("expected renamed copies, got %+v", job)
+		}
+		names := importedNames(t, db, user.ID)
+		if !sort.StringsAreSorted(names) || strings.Join(names, ",") != ".keep,.keep (1),a (1).txt,a.txt,b (1).txt,b.txt,c (1).txt,c.txt" {
+			t.Fatalf("unexpected files %v", names)
+		}
+
+		// Running the same import again, as after a crash, must not copy
+		// the renamed files a second time.
+		job.Cursor = ""
+		if err := importer.Run(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+		if job.FilesImported != 4 || job.FilesSkipped != 4 {
+			t.Fatalf("expected the rerun to skip its own copies, got %+v", job)
+		}
+	})
+
+	t.Run("disconnect waits for imports", func(t *testing.T) {
+		db.Model(&models.ImportJob{}).Where("connection_id = ?", conn.ID).Limit(1).Update("status", models.ImportStatusRunning)
+		if _, err := integrations.Disconnect(ctx, user.ID, conn.ID); !errors.Is(err, ErrIntegrationInUse) {
+			t.Fatalf("expected ErrIntegrationInUse, got %v", err)
+		}
+		db.Model(&models.ImportJob{}).Where("connection_id = ?", conn.ID).Update("status", models.ImportStatusCompleted)
+		if _, err := integrations.Disconnect(ctx, user.ID, conn.ID); err != nil {
+			t.Fatalf("failed disconnecting: %v", err)
+		}
+	})
+}
+
+func TestGoogleDriveImport(t *testing.T) {
+	db := newIntegrationsTestDB(t)
+	user := models.User{Email: "drive@test.com", FirstName: "G", LastName: "D", PasswordHash: "x"}
+	db.Create(&user)
+
+	type file struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		MimeType string `json:"mimeType"`
+		Size     string `json:"size,omitempty"`
+		parent   string
+		content  string
+	}
+	files := []file{
+		{ID: "f1", Name: "Reports", MimeType: driveFolderType, parent: "root"},
+		{ID: "b1", Name: "q1/q2.txt", MimeType: "text/plain", Size: "6", parent: "f1", content: "report"},
+		{ID: "d1", Name: "Plan", MimeType: "application/vnd.google-apps.document", parent: "root"},
+		{ID: "x2", Name: "dup.txt", MimeType: "text/plain", Size: "3", parent: "root", content: "two"},
+		{ID: "x1", Name: "dup.txt", MimeType: "text/plain", Size: "3", parent: "root", content: "one"},
+		{ID: "form", Name: "Survey", MimeType: "application/vnd.google-apps.form", parent: "root"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if err := r.ParseForm(); err != nil || r.Form.Get("code") != "good-code" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"access_token":"access","token_type":"Bearer","refresh_token":"refresh","expires_in":3600}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/drive/about":
+			fmt.Fprint(w, `{"user":{"emailAddress":"gina@example.com"}}`)
+		case r.URL.Path == "/drive/files":
+			var page []file
+			for _, f := range files {
+				if r.URL.Query().Get("q") == fmt.Sprintf("'%s' in parents and trashed = false", f.parent) {
+					page = append(page, f)
+				}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"files": page})
+		case strings.HasSuffix(r.URL.Path, "/export"):
+			fmt.Fprint(w, "PK exported document")
+		default:
+			id := strings.TrimPrefix(r.URL.Path, "/drive/files/")
+			for _, f := range files {
+				if f.ID == id && r.URL.Query().Get("alt") == "media" {
+					fmt.Fprint(w, f.content)
+					return
+				}
+			}
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	jobs := NewJobRunner(db, config.JobsConfig{})
+	uploader := &fakeUploader{objects: map[string][]byte{}}
+	importer := NewImporter(db, uploader, jobs, nil, config.ImportConfig{})
+	integrations := NewIntegrations(db, config.IntegrationsConfig{
+		GoogleDrive: config.OAuthProviderConfig{Enabled: true, ClientID: "client", ClientSecret: "secret", RedirectURL: "http://localhost/callback"},
+	}, "state-key", importer)
+	integrations.driveAPI = server.URL + "/drive"
+	integrations.endpoint = oauth2.Endpoint{AuthURL: server.URL + "/auth", TokenURL: server.URL + "/token", AuthStyle: oauth2.AuthStyleInParams}
+	ctx := context.Background()
+
+	authURL, err := integrations.GoogleAuthURL(user.ID)
+	if err != nil {
+		t.Fatalf("failed building auth url: %v", err)
+	}
+	if !strings.Contains(authURL, "access_type=offline") {
+		t.Fatalf("expected offline access, got %s", authURL)
+	}
+	state, _ := integrations.signState(user.ID)
+
+	t.Run("rejects bad state and codes", func(t *testing.T) {
+		if _, err := integrations.ConnectGoogleDrive(ctx, state+"x", "good-code"); !errors.Is(err, ErrIntegrationState) {
+			t.Fatalf("expected ErrIntegrationState, got %v", err)
+		}
+		if _, err := integrations.ConnectGoogleDrive(ctx, state, "bad-code"); !errors.Is(err, ErrIntegrationAuth) {
+			t.Fatalf("expected ErrIntegrationAuth, got %v", err)
+		}
+	})
+
+	conn, err := integrations.ConnectGoogleDrive(ctx, state, "good-code")
+	if err != nil {
+		t.Fatalf("failed connecting: %v", err)
+	}
+	if conn.UserID != user.ID || conn.Account != "gina@example.com" {
+		t.Fatalf("unexpected connection %+v", conn)
+	}
+
+	entries, err := integrations.Browse(ctx, conn, "")
+	if err != nil {
+		t.Fatalf("failed browsing: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	if strings.Join(names, ",") != "Plan.docx,Reports,dup (2).txt,dup.txt" {
+		t.Fatalf("unexpected listing %v", names)
+	}
+
+	job, err := importer.Start(ctx, user.ID, ImportRequest{
+		SourceType:     models.ImportSourceGoogleDrive,
+		DefaultOwnerID: user.ID,
+		ConnectionID:   &conn.ID,
+	})
+	if err != nil {
+		t.Fatalf("failed starting import: %v", err)
+	}
+	if job.Source != "root" {
+		t.Fatalf("expected the drive root, got %q", job.Source)
+	}
+	runImportJobs(t, jobs)
+	job, _ = importer.Get(ctx, job.ID)
+	if job.Status != models.ImportStatusCompleted || job.FilesImported != 4 || job.FilesFailed != 0 {
+		t.Fatalf("unexpected import %+v", job)
+	}
+	if got := strings.Join(importedNames(t, db, user.ID), ","); got != "Plan.docx,dup (2).txt,dup.txt,q1_q2.txt" {
+		t.Fatalf("unexpected files %s", got)
+	}
+
+	var plan models.File
+	db.First(&plan, "name = ?", "Plan.docx")
+	if plan.Size != int64(len("PK exported document")) || string(uploader.objects[plan.StoragePath]) != "PK exported document" {
+		t.Fatalf("expected the export stored with its real size, got %+v", plan)
+	}
+	var dup models.File
+	db.First(&dup, "name = ?", "dup.txt")
+	if string(uploader.objects[dup.StoragePath]) != "one" {
+		t.Fatalf("expected duplicate names resolved by id, got %q", uploader.objects[dup.StoragePath])
+	}
+}
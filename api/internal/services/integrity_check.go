@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	integrityCheckJob       = "integrity.check"
+	integrityScheduleJob    = "integrity.check.scheduled"
+	integrityCheckInterval  = 24 * time.Hour
+	integrityRepairBatch    = 500
+	integrityFindingSamples = 20
+)
+
+var (
+	ErrIntegrityCheckRunning  = errors.New("an integrity check is already in progress")
+	ErrIntegrityCheckNotFound = errors.New("integrity check not found")
+)
+
+// integrityRule finds rows of one table that refer to a file, user or
+// group that is missing or soft-deleted. Soft deletes are why foreign keys
+// alone cannot keep these tables clean.
+type integrityRule struct {
+	name  string
+	model interface{}
+	where string
+}
+
+var integrityRules = []integrityRule{
+	{"share_file", &models.Share{},
+		"NOT EXISTS (SELECT 1 FROM files WHERE files.id = shares.file_id AND files.deleted_at IS NULL)"},
+	{"share_recipient_user", &models.Share{},
+		"shares.shared_with_user_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = shares.shared_with_user_id AND users.deleted_at IS NULL)"},
+	{"share_recipient_group", &models.Share{},
+		"shares.shared_with_group_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM groups WHERE groups.id = shares.shared_with_group_id AND groups.deleted_at IS NULL)"},
+	{"membership_user", &models.GroupMembership{},
+		"NOT EXISTS (SELECT 1 FROM users WHERE users.id = group_memberships.user_id AND users.deleted_at IS NULL)"},
+	{"membership_group", &models.GroupMembership{},
+		"NOT EXISTS (SELECT 1 FROM groups WHERE groups.id = group_memberships.group_id AND groups.deleted_at IS NULL)"},
+	{"activity_user", &models.Activity{},
+		"NOT EXISTS (SELECT 1 FROM users WHERE users.id = activities.user_id AND users.deleted_at IS NULL)"},
+}
+
+// IntegrityChecker looks for shares, group memberships and activities left
+// pointing at deleted files, users or groups, and removes them when asked.
+// A report-only pass runs daily; admins can start one that repairs. Runs go
+// through the job runner one at a time and are kept in integrity_checks.
+type IntegrityChecker struct {
+	DB   *gorm.DB
+	Jobs *JobRunner
+	now  func() time.Time
+}
+
+func NewIntegrityChecker(db *gorm.DB, jobs *JobRunner) *IntegrityChecker {
+	c := &IntegrityChecker{DB: db, Jobs: jobs, now: time.Now}
+	jobs.Register(integrityCheckJob, c.runJob, JobOptions{MaxAttempts: 1})
+	return c
+}
+
+// Schedule registers the daily report-only pass. It is skipped while an
+// admin's run is still going.
+func (c *IntegrityChecker) Schedule() {
+	c.Jobs.Every(integrityScheduleJob, integrityCheckInterval, func(ctx context.Context, _ *models.Job) error {
+		var active int64
+		if err := c.DB.WithContext(ctx).Model(&models.IntegrityCheck{}).
+			Where("status IN ?", []models.ReconciliationStatus{models.ReconciliationStatusPending, models.ReconciliationStatusRunning}).
+			Count(&active).Error; err != nil || active > 0 {
+			return err
+		}
+		check := models.IntegrityCheck{Status: models.ReconciliationStatusPending}
+		if err := c.DB.WithContext(ctx).Create(&check).Error; err != nil {
+			return err
+		}
+		return c.Run(ctx, &check)
+	})
+}
+
+// Start records a pending run and queues it.
+func (c *IntegrityChecker) Start(ctx context.Context, requestedByID uuid.UUID, repair bool) (*models.IntegrityCheck, error) {
+	check := models.IntegrityCheck{
+		RequestedByID: &requestedByID,
+		Status:        models.ReconciliationStatusPending,
+		Repair:        repair,
+	}
+	err := c.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var active int64
+		if err := tx.Model(&models.IntegrityCheck{}).
+			Where("status IN ?", []models.ReconciliationStatus{models.ReconciliationStatusPending, models.ReconciliationStatusRunning}).
+			Count(&active).Error; err != nil {
+			return err
+		}
+		if active > 0 {
+			return ErrIntegrityCheckRunning
+		}
+		if err := tx.Create(&check).Error; err != nil {
+			return err
+		}
+		_, err := c.Jobs.enqueue(tx, integrityCheckJob, map[string]interface{}{"check_id": check.ID.String()}, EnqueueOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &check, nil
+}
+
+// Get loads one run with its findings.
+func (c *IntegrityChecker) Get(ctx context.Context, id uuid.UUID) (*models.IntegrityCheck, error) {
+	var check models.IntegrityCheck
+	if err := c.DB.WithContext(ctx).First(&check, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrIntegrityCheckNotFound
+		}
+		return nil, err
+	}
+	return &check, nil
+}
+
+func (c *IntegrityChecker) runJob(ctx context.Context, job *models.Job) error {
+	raw, _ := job.Payload["check_id"].(string)
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("integrity check job without a check id: %q", raw)
+	}
+	check, err := c.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return c.Run(ctx, check)
+}
+
+// Run carries out a check and saves its report, whether or not it
+// succeeds.
+func (c *IntegrityChecker) Run(ctx context.Context, check *models.IntegrityCheck) error {
+	started := c.now().UTC()
+	check.Status = models.ReconciliationStatusRunning
+	check.StartedAt = &started
+	if err := c.DB.Save(check).Error; err != nil {
+		return err
+	}
+
+	runErr := c.check(ctx, check)
+	finished := c.now().UTC()
+	check.FinishedAt = &finished
+	check.Status = models.ReconciliationStatusCompleted
+	if runErr != nil {
+		check.Status = models.ReconciliationStatusFailed
+		check.LastError = runErr.Error()
+	}
+	if err := c.DB.Save(check).Error; err != nil {
+		return err
+	}
+
+	fields := map[string]interface{}{
+		"check_id": check.ID.String(),
+		"repair":   check.Repair,
+		"dangling": check.DanglingCount,
+		"repaired": check.RepairedCount,
+	}
+	if runErr != nil {
+		logger.Error("integrity_check_failed", runErr, fields)
+		return runErr
+	}
+	if check.DanglingCount > 0 && !check.Repair {
+		logger.Warn("integrity_check_found_dangling_rows", fields)
+		return nil
+	}
+	logger.Info("integrity_check_completed", fields)
+	return nil
+}
+
+func (c *IntegrityChecker) check(ctx context.Context, check *models.IntegrityCheck) error {
+	db := c.DB.WithContext(ctx)
+	check.Findings = nil
+	check.DanglingCount, check.RepairedCount = 0, 0
+	for _, rule := range integrityRules {
+		finding := models.IntegrityFinding{Check: rule.name}
+		if err := db.Model(rule.model).Where(rule.where).Count(&finding.Count).Error; err != nil {
+			return fmt.Errorf("%s: %w", rule.name, err)
+		}
+		if finding.Count == 0 {
+			continue
+		}
+		if err := db.Model(rule.model).Where(rule.where).Order("id").Limit(integrityFindingSamples).Pluck("id", &finding.Sample).Error; err != nil {
+			return fmt.Errorf("%s: %w", rule.name, err)
+		}
+		if check.Repair {
+			repaired, err := c.repair(db, rule)
+			finding.Repaired = repaired
+			check.RepairedCount += repaired
+			if err != nil {
+				check.Findings = append(check.Findings, finding)
+				check.DanglingCount += finding.Count
+				return fmt.Errorf("%s: %w", rule.name, err)
+			}
+		}
+		check.Findings = append(check.Findings, finding)
+		check.DanglingCount += finding.Count
+	}
+	return nil
+}
+
+// repair soft-deletes a rule's dangling rows in batches, so a large
+// backlog never holds a long lock on the table.
+func (c *IntegrityChecker) repair(db *gorm.DB, rule integrityRule) (int64, error) {
+	var total int64
+	for {
+		var ids []uuid.UUID
+		if err := db.Model(rule.model).Where(rule.where).Limit(integrityRepairBatch).Pluck("id", &ids).Error; err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		result := db.Where("id IN ?", ids).Delete(rule.model)
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if len(ids) < integrityRepairBatch {
+			return total, nil
+		}
+	}
+}
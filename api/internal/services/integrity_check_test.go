@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestIntegrityChecker(t *testing.T) {
+	logger.Init()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.Group{}, &models.GroupMembership{}, &models.File{}, &models.Share{},
+		&models.Activity{}, &models.Job{}, &models.IntegrityCheck{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+
+	newUser := func(email string) models.User {
+		user := models.User{Email: email, FirstName: "I", LastName: "C", PasswordHash: "x"}
+		db.Create(&user)
+		return user
+	}
+	owner := newUser("owner@test.com")
+	kept := newUser("kept@test.com")
+	gone := newUser("gone@test.com")
+	group := models.Group{Name: "Gone", CreatedByID: owner.ID}
+	db.Create(&group)
+	file := models.File{Name: "a.txt", MimeType: "text/plain", OwnerID: owner.ID}
+	deletedFile := models.File{Name: "b.txt", MimeType: "text/plain", OwnerID: owner.ID}
+	db.Create(&file)
+	db.Create(&deletedFile)
+
+	db.Create(&models.Share{FileID: file.ID, SharedByID: owner.ID, SharedWithUserID: &kept.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView})
+	db.Create(&models.Share{FileID: file.ID, SharedByID: owner.ID, SharedWithUserID: &gone.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView})
+	db.Create(&models.Share{FileID: file.ID, SharedByID: owner.ID, SharedWithGroupID: &group.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView})
+	db.Create(&models.Share{FileID: deletedFile.ID, SharedByID: owner.ID, ShareType: models.ShareTypePublicAnyone, Permission: models.SharePermissionView})
+	db.Create(&models.GroupMembership{UserID: kept.ID, GroupID: group.ID})
+	db.Create(&models.Activity{UserID: gone.ID, ActorID: owner.ID, Action: "share", ResourceType: "file", ResourceName: "a.txt", Message: "shared"})
+	db.Create(&models.Activity{UserID: kept.ID, ActorID: owner.ID, Action: "share", ResourceType: "file", ResourceName: "a.txt", Message: "shared"})
+
+	// Deleted the way that leaves rows behind: only the record itself.
+	db.Delete(&gone)
+	db.Delete(&group)
+	db.Delete(&deletedFile)
+
+	jobs := NewJobRunner(db, config.JobsConfig{})
+	checker := NewIntegrityChecker(db, jobs)
+	ctx := context.Background()
+	adminID := uuid.New()
+
+	run := func(repair bool) models.IntegrityCheck {
+		t.Helper()
+		check, err := checker.Start(ctx, adminID, repair)
+		if err != nil {
+			t.Fatalf("start failed: %v", err)
+		}
+		if _, err := jobs.RunNext(ctx); err != nil {
+			t.Fatalf("run failed: %v", err)
+		}
+		got, err := checker.Get(ctx, check.ID)
+		if err != nil {
+			t.Fatalf("get failed: %v", err)
+		}
+		if got.Status != models.ReconciliationStatusCompleted {
+			t.Fatalf("expected a completed check, got %s: %s", got.Status, got.LastError)
+		}
+		return *got
+	}
+
+	report := run(false)
+	found := map[string]int64{}
+	for _, f := range report.Findings {
+		found[f.Check] = f.Count
+	}
+	if report.DanglingCount != 5 || report.RepairedCount != 0 ||
+		found["share_file"] != 1 || found["share_recipient_user"] != 1 || found["share_recipient_group"] != 1 ||
+		found["membership_group"] != 1 || found["activity_user"] != 1 {
+		t.Fatalf("unexpected findings %d %+v", report.DanglingCount, report.Findings)
+	}
+	var shares int64
+	db.Model(&models.Share{}).Count(&shares)
+	if shares != 4 {
+		t.Fatalf("expected a report-only check to leave shares alone, got %d", shares)
+	}
+
+	repaired := run(true)
+	if repaired.RepairedCount != 5 {
+		t.Fatalf("expected five rows repaired, got %+v", repaired.Findings)
+	}
+	db.Model(&models.Share{}).Count(&shares)
+	var memberships, activities int64
+	db.Model(&models.GroupMembership{}).Count(&memberships)
+	db.Model(&models.Activity{}).Count(&activities)
+	if shares != 1 || memberships != 0 || activities != 1 {
+		t.Fatalf("expected only live rows left, got %d shares, %d memberships, %d activities", shares, memberships, activities)
+	}
+	if clean := run(false); clean.DanglingCount != 0 || len(clean.Findings) != 0 {
+		t.Fatalf("expected a clean pass after repair, got %+v", clean.Findings)
+	}
+}
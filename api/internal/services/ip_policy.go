@@ -0,0 +1,91 @@
+package services
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// IPScope names a family of routes with its own IP rules.
+type IPScope string
+
+const (
+	IPScopeAdmin  IPScope = "admin"
+	IPScopePublic IPScope = "public"
+)
+
+// IPPolicy decides which client addresses may use a family of routes.
+// A nil or empty policy admits everyone.
+type IPPolicy struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// ParseIPPolicy builds a policy from lists of bare IPs and CIDR ranges.
+func ParseIPPolicy(allow, deny []string) (*IPPolicy, error) {
+	p := &IPPolicy{}
+	var err error
+	if p.allow, err = parseIPPrefixes(allow); err != nil {
+		return nil, err
+	}
+	if p.deny, err = parseIPPrefixes(deny); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func parseIPPrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q", entry)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address %q", entry)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// Empty reports whether the policy has no rules.
+func (p *IPPolicy) Empty() bool {
+	return p == nil || (len(p.allow) == 0 && len(p.deny) == 0)
+}
+
+// Allows reports whether ip may pass and, when it may not, whether it was
+// refused by the deny list ("denied") or by missing the allow list
+// ("not_allowed"). An address that doesn't parse only passes an empty
+// policy.
+func (p *IPPolicy) Allows(ip string) (bool, string) {
+	if p.Empty() {
+		return true, ""
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false, "unparseable_address"
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p.deny {
+		if prefix.Contains(addr) {
+			return false, "denied"
+		}
+	}
+	if len(p.allow) == 0 {
+		return true, ""
+	}
+	for _, prefix := range p.allow {
+		if prefix.Contains(addr) {
+			return true, ""
+		}
+	}
+	return false, "not_allowed"
+}
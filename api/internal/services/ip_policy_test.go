@@ -0,0 +1,50 @@
+package services
+
+import "testing"
+
+func TestIPPolicy_Allows(t *testing.T) {
+	policy, err := ParseIPPolicy([]string{"10.0.0.0/8", " 192.168.1.20 ", "2001:db8::/32"}, []string{"10.9.0.0/16"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cases := []struct {
+		ip     string
+		want   bool
+		reason string
+	}{
+		{"10.1.2.3", true, ""},
+		{"10.9.1.1", false, "denied"},
+		{"192.168.1.20", true, ""},
+		{"192.168.1.21", false, "not_allowed"},
+		{"::ffff:10.1.2.3", true, ""},
+		{"2001:db8::1", true, ""},
+		{"2001:db9::1", false, "not_allowed"},
+		{"not-an-ip", false, "unparseable_address"},
+	}
+	for _, tc := range cases {
+		if got, reason := policy.Allows(tc.ip); got != tc.want || reason != tc.reason {
+			t.Errorf("Allows(%q) = %v, %q; want %v, %q", tc.ip, got, reason, tc.want, tc.reason)
+		}
+	}
+
+	denyOnly, _ := ParseIPPolicy(nil, []string{"203.0.113.0/24"})
+	if ok, _ := denyOnly.Allows("198.51.100.7"); !ok {
+		t.Error("expected a deny-only policy to admit other addresses")
+	}
+	if ok, _ := denyOnly.Allows("203.0.113.9"); ok {
+		t.Error("expected the denied range to be refused")
+	}
+
+	var none *IPPolicy
+	if ok, _ := none.Allows("garbage"); !ok {
+		t.Error("expected a nil policy to admit everything")
+	}
+}
+
+func TestParseIPPolicy_RejectsBadEntries(t *testing.T) {
+	for _, entry := range []string{"10.0.0.0/33", "10.0.0", "example.com", ""} {
+		if _, err := ParseIPPolicy([]string{entry}, nil); err == nil {
+			t.Errorf("expected %q to be rejected", entry)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultJobMaxAttempts = 5
+	jobMaxBackoff         = time.Hour
+	// jobRetention is how long completed jobs are kept before
+	// CleanupCompleted removes them. Failed jobs stay until retried.
+	jobRetention = 7 * 24 * time.Hour
+)
+
+var (
+	ErrJobNotFound      = errors.New("job not found")
+	ErrJobNotFailed     = errors.New("only failed jobs can be retried")
+	ErrJobAlreadyQueued = errors.New("a job with the same key is already queued")
+)
+
+// JobHandler runs one job. An error schedules another attempt with backoff
+// until the job's attempts are used up, after which it is marked failed.
+// ctx is cancelled when the job's lease runs out. Handlers may run more than
+// once for the same job, e.g. after a crash, so they must be idempotent.
+type JobHandler func(ctx context.Context, job *models.Job) error
+
+// JobOptions tune how jobs of one kind are retried. Zero values use the
+// runner's defaults.
+type JobOptions struct {
+	MaxAttempts int
+	Backoff     func(attempts int) time.Duration
+}
+
+// EnqueueOptions control when a job runs. A zero RunAt means now. A
+// UniqueKey makes Enqueue a no-op while a pending job with the same key
+// exists.
+type EnqueueOptions struct {
+	RunAt     time.Time
+	UniqueKey string
+}
+
+type jobKind struct {
+	handler JobHandler
+	opts    JobOptions
+	// interval is set for periodic kinds, which re-enqueue themselves when
+	// a run finishes.
+	interval time.Duration
+}
+
+// JobRunner is a database-backed job queue. Any number of API instances can
+// run workers against the same table: jobs are claimed with a lease, so each
+// runs on one worker at a time and one whose worker died becomes claimable
+// again when the lease runs out.
+type JobRunner struct {
+	DB       *gorm.DB
+	cfg      config.JobsConfig
+	workerID string
+
+	mu    sync.RWMutex
+	kinds map[string]jobKind
+}
+
+func NewJobRunner(db *gorm.DB, cfg config.JobsConfig) *JobRunner {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = 10 * time.Minute
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = defaultJobMaxAttempts
+	}
+	host, _ := os.Hostname()
+	return &JobRunner{
+		DB:       db,
+		cfg:      cfg,
+		workerID: fmt.Sprintf("%s/%s", host, uuid.NewString()[:8]),
+		kinds:    map[string]jobKind{},
+	}
+}
+
+// Register sets the handler for jobs of kind.
+func (r *JobRunner) Register(kind string, handler JobHandler, opts JobOptions) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kinds[kind] = jobKind{handler: handler, opts: opts}
+}
+
+// Every registers handler as a periodic job that runs every interval
+// across all instances. The first run is queued by Start; each later run
+// is queued when the previous one completes or fails for good.
+func (r *JobRunner) Every(kind string, interval time.Duration, handler JobHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kinds[kind] = jobKind{handler: handler, interval: interval}
+}
+
+// Enqueue adds a job of kind. With a UniqueKey that is already pending it
+// returns the pending job instead.
+func (r *JobRunner) Enqueue(ctx context.Context, kind string, payload map[string]interface{}, opts EnqueueOptions) (*models.Job, error) {
+	return r.enqueue(r.DB.WithContext(ctx), kind, payload, opts)
+}
+
+func (r *JobRunner) enqueue(tx *gorm.DB, kind string, payload map[string]interface{}, opts EnqueueOptions) (*models.Job, error) {
+	job := models.Job{
+		Kind:        kind,
+		Payload:     payload,
+		Status:      models.JobStatusPending,
+		MaxAttempts: r.maxAttempts(kind),
+		RunAt:       opts.RunAt.UTC(),
+	}
+	if opts.RunAt.IsZero() {
+		job.RunAt = time.Now().UTC()
+	}
+	if opts.UniqueKey == "" {
+		if err := tx.Create(&job).Error; err != nil {
+			return nil, err
+		}
+		return &job, nil
+	}
+
+	job.UniqueKey = &opts.UniqueKey
+	result := tx.Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "unique_key"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "status = 'pending'"}}},
+		DoNothing:   true,
+	}).Create(&job)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		var existing models.Job
+		if err := tx.Where("unique_key = ? AND status = ?", opts.UniqueKey, models.JobStatusPending).First(&existing).Error; err != nil {
+			return nil, err
+		}
+		return &existing, nil
+	}
+	return &job, nil
+}
+
+func (r *JobRunner) maxAttempts(kind string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if k, ok := r.kinds[kind]; ok && k.opts.MaxAttempts > 0 {
+		return k.opts.MaxAttempts
+	}
+	return r.cfg.MaxAttempts
+}
+
+// Start queues the first run of every periodic job and starts the workers.
+func (r *JobRunner) Start() {
+	r.mu.RLock()
+	periodic := map[string]time.Duration{}
+	for kind, k := range r.kinds {
+		if k.interval > 0 {
+			periodic[kind] = k.interval
+		}
+	}
+	r.mu.RUnlock()
+
+	for kind := range periodic {
+		if _, err := r.Enqueue(context.Background(), kind, nil, EnqueueOptions{UniqueKey: periodicJobKey(kind)}); err != nil {
+			logger.Error("job_schedule_failed", err, map[string]interface{}{"kind": kind})
+		}
+	}
+
+	for i := 0; i < r.cfg.Workers; i++ {
+		go func() {
+			for {
+				ran, err := r.RunNext(context.Background())
+				if err != nil {
+					logger.Error("job_claim_failed", err, nil)
+				}
+				if !ran || err != nil {
+					time.Sleep(r.cfg.PollInterval)
+				}
+			}
+		}()
+	}
+
+	logger.Info("job_runner_started", map[string]interface{}{
+		"worker_id": r.workerID,
+		"workers":   r.cfg.Workers,
+		"periodic":  len(periodic),
+	})
+}
+
+func periodicJobKey(kind string) string {
+	return "periodic:" + kind
+}
+
+// RunNext claims one due job and runs it, reporting whether there was one.
+func (r *JobRunner) RunNext(ctx context.Context) (bool, error) {
+	job, err := r.claim(ctx)
+	if err != nil || job == nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	kind, ok := r.kinds[job.Kind]
+	r.mu.RUnlock()
+
+	var runErr error
+	switch {
+	case !ok:
+		runErr = fmt.Errorf("no handler registered for job kind %q", job.Kind)
+	case job.Attempts > job.MaxAttempts:
+		// The lease ran out on the last attempt, most likely because the
+		// process running it died.
+		runErr = errors.New("lease expired on the final attempt")
+		job.Attempts = job.MaxAttempts
+	default:
+		runErr = r.invoke(ctx, kind.handler, job)
+	}
+	return true, r.finish(ctx, job, kind, runErr)
+}
+
+func (r *JobRunner) invoke(ctx context.Context, handler JobHandler, job *models.Job) (err error) {
+	ctx, cancel := context.WithDeadline(ctx, *job.LockedUntil)
+	defer cancel()
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// claim takes the oldest due job: a pending one whose RunAt has passed, or
+// a running one whose lease has run out. On Postgres the select also takes
+// a row lock with SKIP LOCKED so two workers never claim the same row.
+func (r *JobRunner) claim(ctx context.Context) (*models.Job, error) {
+	var claimed *models.Job
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		query := tx.Where("(status = ? AND run_at <= ?) OR (status = ? AND locked_until < ?)",
+			models.JobStatusPending, now, models.JobStatusRunning, now).
+			Order("run_at ASC, id ASC").
+			Limit(1)
+		if tx.Dialector.Name() == "postgres" {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		var jobs []models.Job
+		if err := query.Find(&jobs).Error; err != nil {
+			return err
+		}
+		if len(jobs) == 0 {
+			return nil
+		}
+
+		job := jobs[0]
+		lockedUntil := now.Add(r.cfg.Lease)
+		job.Status = models.JobStatusRunning
+		job.Attempts++
+		job.LockedBy = r.workerID
+		job.LockedUntil = &lockedUntil
+		job.StartedAt = &now
+		if err := tx.Model(&models.Job{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+			"status":       job.Status,
+			"attempts":     job.Attempts,
+			"locked_by":    job.LockedBy,
+			"locked_until": lockedUntil,
+			"started_at":   now,
+		}).Error; err != nil {
+			return err
+		}
+		claimed = &job
+		return nil
+	})
+	return claimed, err
+}
+
+// finish records the outcome of a run. A periodic job queues its next run
+// once this one is over for good.
+func (r *JobRunner) finish(ctx context.Context, job *models.Job, kind jobKind, runErr error) error {
+	now := time.Now().UTC()
+	updates := map[string]interface{}{
+		"locked_by":    "",
+		"locked_until": nil,
+	}
+	done := true
+	switch {
+	case runErr == nil:
+		updates["status"] = models.JobStatusCompleted
+		updates["finished_at"] = now
+		updates["last_error"] = ""
+	case job.Attempts >= job.MaxAttempts:
+		updates["status"] = models.JobStatusFailed
+		updates["finished_at"] = now
+		updates["last_error"] = runErr.Error()
+		logger.Error("job_failed", runErr, map[string]interface{}{
+			"job_id":   job.ID.String(),
+			"kind":     job.Kind,
+			"attempts": job.Attempts,
+		})
+	default:
+		backoff := defaultJobBackoff
+		if kind.opts.Backoff != nil {
+			backoff = kind.opts.Backoff
+		}
+		runAt := now.Add(backoff(job.Attempts))
+		updates["status"] = models.JobStatusPending
+		updates["run_at"] = runAt
+		updates["last_error"] = runErr.Error()
+		done = false
+		logger.Warn("job_retry_scheduled", map[string]interface{}{
+			"job_id":       job.ID.String(),
+			"kind":         job.Kind,
+			"attempts":     job.Attempts,
+			"max_attempts": job.MaxAttempts,
+			"next_run":     runAt.String(),
+			"error":        runErr.Error(),
+		})
+	}
+
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Only the worker holding the lease may record the outcome; if it
+		// ran out mid-run the job has been handed to someone else.
+		result := tx.Model(&models.Job{}).
+			Where("id = ? AND status = ? AND locked_by = ?", job.ID, models.JobStatusRunning, r.workerID).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			logger.Warn("job_lease_lost", map[string]interface{}{
+				"job_id": job.ID.String(),
+				"kind":   job.Kind,
+			})
+			return nil
+		}
+		if done && kind.interval > 0 {
+			_, err := r.enqueue(tx, job.Kind, nil, EnqueueOptions{RunAt: now.Add(kind.interval), UniqueKey: periodicJobKey(job.Kind)})
+			return err
+		}
+		return nil
+	})
+}
+
+func defaultJobBackoff(attempts int) time.Duration {
+	backoff := 30 * time.Second
+	for i := 1; i < attempts && backoff < jobMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > jobMaxBackoff {
+		backoff = jobMaxBackoff
+	}
+	return backoff
+}
+
+// Retry puts a failed job back in the queue with a fresh set of attempts.
+func (r *JobRunner) Retry(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	var job models.Job
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&job, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrJobNotFound
+			}
+			return err
+		}
+		if job.Status != models.JobStatusFailed {
+			return ErrJobNotFailed
+		}
+		if job.UniqueKey != nil {
+			var queued int64
+			if err := tx.Model(&models.Job{}).
+				Where("unique_key = ? AND status = ?", *job.UniqueKey, models.JobStatusPending).
+				Count(&queued).Error; err != nil {
+				return err
+			}
+			if queued > 0 {
+				return ErrJobAlreadyQueued
+			}
+		}
+
+		now := time.Now().UTC()
+		job.Status = models.JobStatusPending
+		job.Attempts = 0
+		job.RunAt = now
+		job.FinishedAt = nil
+		return tx.Model(&models.Job{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+			"status":      job.Status,
+			"attempts":    0,
+			"run_at":      now,
+			"finished_at": nil,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CleanupCompleted removes jobs that completed more than the retention
+// window ago.
+func (r *JobRunner) CleanupCompleted(ctx context.Context) error {
+	cutoff := time.Now().UTC().Add(-jobRetention)
+	result := r.DB.WithContext(ctx).Unscoped().
+		Where("status = ? AND finished_at < ?", models.JobStatusCompleted, cutoff).
+		Delete(&models.Job{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		logger.Info("jobs_cleaned", map[string]interface{}{
+			"count": result.RowsAffected,
+		})
+	}
+	return nil
+}
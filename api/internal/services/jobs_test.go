@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupJobsTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Job{}); err != nil {
+		t.Fatalf("failed automigrating models: %v", err)
+	}
+	return db
+}
+
+func runNext(t *testing.T, r *JobRunner) bool {
+	t.Helper()
+	ran, err := r.RunNext(context.Background())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	return ran
+}
+
+func loadJob(t *testing.T, db *gorm.DB, job *models.Job) models.Job {
+	t.Helper()
+	var got models.Job
+	if err := db.First(&got, "id = ?", job.ID).Error; err != nil {
+		t.Fatalf("failed loading job: %v", err)
+	}
+	return got
+}
+
+func TestJobRunner_RunsAndRetries(t *testing.T) {
+	db := setupJobsTestDB(t)
+	runner := NewJobRunner(db, config.JobsConfig{MaxAttempts: 2})
+	ctx := context.Background()
+
+	calls := 0
+	runner.Register("test.flaky", func(_ context.Context, job *models.Job) error {
+		calls++
+		if job.Payload["name"] != "report" {
+			t.Errorf("expected the payload to round-trip, got %v", job.Payload)
+		}
+		return errors.New("boom")
+	}, JobOptions{})
+
+	job, err := runner.Enqueue(ctx, "test.flaky", map[string]interface{}{"name": "report"}, EnqueueOptions{})
+	if err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	if !runNext(t, runner) {
+		t.Fatal("expected the job to run")
+	}
+	got := loadJob(t, db, job)
+	if got.Status != models.JobStatusPending || got.Attempts != 1 || got.LastError != "boom" || !got.RunAt.After(time.Now()) {
+		t.Fatalf("expected a retry scheduled with backoff, got %+v", got)
+	}
+	if runNext(t, runner) {
+		t.Fatal("expected the retry to wait for its backoff")
+	}
+
+	db.Model(&models.Job{}).Where("id = ?", job.ID).Update("run_at", time.Now().UTC().Add(-time.Second))
+	runNext(t, runner)
+	got = loadJob(t, db, job)
+	if got.Status != models.JobStatusFailed || got.Attempts != 2 || got.FinishedAt == nil {
+		t.Fatalf("expected the job to fail once attempts ran out, got %+v", got)
+	}
+
+	retried, err := runner.Retry(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	if retried.Status != models.JobStatusPending || retried.Attempts != 0 {
+		t.Fatalf("expected a fresh pending job, got %+v", retried)
+	}
+	if _, err := runner.Retry(ctx, job.ID); !errors.Is(err, ErrJobNotFailed) {
+		t.Fatalf("expected retrying a pending job to fail, got %v", err)
+	}
+	runNext(t, runner)
+	if calls != 3 {
+		t.Fatalf("expected 3 runs, got %d", calls)
+	}
+}
+
+func TestJobRunner_CompletesAndRecoversPanics(t *testing.T) {
+	db := setupJobsTestDB(t)
+	runner := NewJobRunner(db, config.JobsConfig{MaxAttempts: 1})
+	ctx := context.Background()
+
+	runner.Register("test.ok", func(context.Context, *models.Job) error { return nil }, JobOptions{})
+	runner.Register("test.panic", func(context.Context, *models.Job) error { panic("nil map") }, JobOptions{})
+
+	ok, _ := runner.Enqueue(ctx, "test.ok", nil, EnqueueOptions{})
+	panicky, _ := runner.Enqueue(ctx, "test.panic", nil, EnqueueOptions{})
+	unknown, _ := runner.Enqueue(ctx, "test.unknown", nil, EnqueueOptions{})
+	for runNext(t, runner) {
+	}
+
+	if got := loadJob(t, db, ok); got.Status != models.JobStatusCompleted || got.LockedBy != "" {
+		t.Fatalf("expected the job to complete and release its lease, got %+v", got)
+	}
+	if got := loadJob(t, db, panicky); got.Status != models.JobStatusFailed || got.LastError != "panic: nil map" {
+		t.Fatalf("expected the panic to fail the job, got %+v", got)
+	}
+	if got := loadJob(t, db, unknown); got.Status != models.JobStatusFailed {
+		t.Fatalf("expected a job without a handler to fail, got %+v", got)
+	}
+}
+
+func TestJobRunner_UniqueKey(t *testing.T) {
+	db := setupJobsTestDB(t)
+	runner := NewJobRunner(db, config.JobsConfig{})
+	ctx := context.Background()
+
+	first, err := runner.Enqueue(ctx, "test.unique", nil, EnqueueOptions{UniqueKey: "file:1"})
+	if err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	second, err := runner.Enqueue(ctx, "test.unique", nil, EnqueueOptions{UniqueKey: "file:1"})
+	if err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if second.ID != first.ID {
+		t.Fatal("expected the pending job to be returned instead of a duplicate")
+	}
+	if _, err := runner.Enqueue(ctx, "test.unique", nil, EnqueueOptions{UniqueKey: "file:2"}); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	var count int64
+	db.Model(&models.Job{}).Count(&count)
+	if count != 2 {
+		t.Fatalf("expected 2 jobs, got %d", count)
+	}
+}
+
+func TestJobRunner_Periodic(t *testing.T) {
+	db := setupJobsTestDB(t)
+	runner := NewJobRunner(db, config.JobsConfig{})
+	ctx := context.Background()
+
+	runs := 0
+	runner.Every("test.sweep", time.Hour, func(context.Context, *models.Job) error {
+		runs++
+		return nil
+	})
+	if _, err := runner.Enqueue(ctx, "test.sweep", nil, EnqueueOptions{UniqueKey: periodicJobKey("test.sweep")}); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	runNext(t, runner)
+	if runs != 1 {
+		t.Fatalf("expected one run, got %d", runs)
+	}
+	var next models.Job
+	if err := db.Where("kind = ? AND status = ?", "test.sweep", models.JobStatusPending).First(&next).Error; err != nil {
+		t.Fatalf("expected the next run to be queued: %v", err)
+	}
+	if until := time.Until(next.RunAt); until < 59*time.Minute || until > time.Hour {
+		t.Fatalf("expected the next run an interval from now, got %v", until)
+	}
+}
+
+func TestJobRunner_ReclaimsExpiredLease(t *testing.T) {
+	db := setupJobsTestDB(t)
+	runner := NewJobRunner(db, config.JobsConfig{})
+	ctx := context.Background()
+
+	runner.Register("test.crash", func(context.Context, *models.Job) error { return nil }, JobOptions{})
+	job, _ := runner.Enqueue(ctx, "test.crash", nil, EnqueueOptions{})
+
+	expired := time.Now().UTC().Add(-time.Minute)
+	db.Model(&models.Job{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+		"status":       models.JobStatusRunning,
+		"attempts":     1,
+		"locked_by":    "dead-worker",
+		"locked_until": expired,
+	})
+
+	if !runNext(t, runner) {
+		t.Fatal("expected the job with an expired lease to be claimed")
+	}
+	if got := loadJob(t, db, job); got.Status != models.JobStatusCompleted || got.Attempts != 2 {
+		t.Fatalf("expected the reclaimed job to complete on its second attempt, got %+v", got)
+	}
+}
@@ -0,0 +1,380 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/storage"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	fileLanguageJob = "file.language"
+	// languageSampleBytes is how much text detection reads from a file.
+	// A few pages are plenty to tell languages apart.
+	languageSampleBytes = 64 << 10
+	// languageMaxPackageBytes caps the Office documents read for their
+	// text: their parts can only be found with the whole package in
+	// memory.
+	languageMaxPackageBytes = 32 << 20
+	// languageMinLetters is the least text, in letters, a language is
+	// guessed from.
+	languageMinLetters = 40
+)
+
+// languageEvents are the outbox events that can change what a file says.
+var languageEvents = map[string]bool{
+	"file.upload": true,
+	"file.create": true,
+	"file.edit":   true,
+}
+
+// officeTextParts names the part of an Office package that holds the body
+// text, by MIME type and by extension.
+var officeTextParts = map[string]string{
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": "word/document.xml",
+	"application/vnd.oasis.opendocument.text":                                 "content.xml",
+	".docx": "word/document.xml",
+	".odt":  "content.xml",
+}
+
+// LanguageDetector records the language each file is written in. File
+// events from the outbox queue a file.language job, which reads the start
+// of the file's text, guesses its language and stores it on the file. A
+// change is recorded as a file.language_detected event, so integrations
+// following the change feed or the audit sinks can route documents to
+// translation as they arrive. Plain text, Markdown and Word or
+// OpenDocument text documents are read; other files, and files whose
+// language is unclear, get no language.
+type LanguageDetector struct {
+	DB    *gorm.DB
+	Jobs  *JobRunner
+	Store TransferStore
+}
+
+func NewLanguageDetector(db *gorm.DB, jobs *JobRunner, store TransferStore) *LanguageDetector {
+	d := &LanguageDetector{DB: db, Jobs: jobs, Store: store}
+	jobs.Register(fileLanguageJob, d.runJob, JobOptions{})
+	return d
+}
+
+func (d *LanguageDetector) Name() string {
+	return "language_detector"
+}
+
+// HandleEvent queues detection for a file whose content was written.
+func (d *LanguageDetector) HandleEvent(ctx context.Context, event models.OutboxEvent) error {
+	if event.ResourceType != "file" || event.ResourceID == nil || !languageEvents[event.EventType] {
+		return nil
+	}
+	return d.Queue(ctx, *event.ResourceID)
+}
+
+// Queue schedules detection for fileID unless it is already waiting.
+func (d *LanguageDetector) Queue(ctx context.Context, fileID uuid.UUID) error {
+	_, err := d.Jobs.Enqueue(ctx, fileLanguageJob, map[string]interface{}{"file_id": fileID.String()}, EnqueueOptions{UniqueKey: "language:" + fileID.String()})
+	return err
+}
+
+func (d *LanguageDetector) runJob(ctx context.Context, job *models.Job) error {
+	raw, _ := job.Payload["file_id"].(string)
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("language job without a file id: %q", raw)
+	}
+	_, err = d.Detect(ctx, id)
+	return err
+}
+
+// Detect reads fileID's text and stores the language found, returning it.
+// Folders, vault files, which only hold ciphertext, and files that are
+// quarantined or in cold storage are left alone.
+func (d *LanguageDetector) Detect(ctx context.Context, fileID uuid.UUID) (string, error) {
+	var file models.File
+	if err := d.DB.WithContext(ctx).Limit(1).Find(&file, "id = ?", fileID).Error; err != nil {
+		return "", err
+	}
+	if file.ID == uuid.Nil || file.IsDirectory || file.VaultID != nil || file.QuarantinedAt != nil || file.ArchivedAt != nil {
+		return file.Language, nil
+	}
+
+	text, err := d.text(ctx, &file)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		// Deleted while the job waited.
+		return file.Language, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	language := DetectLanguage(text)
+	if language == file.Language {
+		return language, nil
+	}
+
+	err = d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The content changed, not the file: leave updated_at alone.
+		if err := tx.Model(&models.File{}).Where("id = ?", file.ID).UpdateColumn("language", language).Error; err != nil {
+			return err
+		}
+		return RecordEvent(tx, AuditEntry{
+			UserID:       &file.OwnerID,
+			Action:       "file.language_detected",
+			ResourceType: "file",
+			ResourceID:   &file.ID,
+			Details: map[string]interface{}{
+				"file_name":         file.Name,
+				"language":          language,
+				"previous_language": file.Language,
+			},
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+	logger.Info("file_language_detected", map[string]interface{}{
+		"file_id":  file.ID.String(),
+		"language": language,
+	})
+	return language, nil
+}
+
+// text returns the start of file's text, or "" for files it cannot read
+// text from.
+func (d *LanguageDetector) text(ctx context.Context, file *models.File) (string, error) {
+	part := officeTextParts[baseMediaType(file.MimeType)]
+	if part == "" {
+		part = officeTextParts[strings.ToLower(filepath.Ext(file.Name))]
+	}
+	kind, _ := TextPreviewKind(file)
+	if part == "" && kind != TextPreviewText && kind != TextPreviewMarkdown {
+		return "", nil
+	}
+	if part != "" && file.Size > languageMaxPackageBytes {
+		return "", nil
+	}
+
+	obj, err := d.Store.Get(ctx, file.StoragePath)
+	if err != nil {
+		return "", err
+	}
+	defer obj.Close()
+
+	if part == "" {
+		body, err := io.ReadAll(io.LimitReader(obj, languageSampleBytes))
+		if err != nil {
+			return "", err
+		}
+		if bytes.IndexByte(body, 0) >= 0 {
+			return "", nil
+		}
+		return strings.ToValidUTF8(string(body), " "), nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(obj, languageMaxPackageBytes+1))
+	if err != nil {
+		return "", err
+	}
+	return officeText(body, part), nil
+}
+
+// officeText returns the start of the text in an Office package's part,
+// or "" when body is not a package holding it.
+func officeText(body []byte, part string) string {
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return ""
+	}
+	f, err := zr.Open(part)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	var text strings.Builder
+	dec := xml.NewDecoder(io.LimitReader(f, languageMaxPackageBytes))
+	for text.Len() < languageSampleBytes {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			// Words are split across runs, so only paragraphs, headings,
+			// tabs and breaks separate them.
+			switch t.Name.Local {
+			case "p", "h", "tab", "br":
+				text.WriteByte(' ')
+			}
+		}
+	}
+	return text.String()
+}
+
+// languageStopwords are the commonest words of the languages told apart
+// by their vocabulary. Text in one of these languages is made up largely
+// of its stopwords; text in another language or in none, such as code or
+// tables of numbers, barely scores.
+var languageStopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "was", "with", "this", "are", "be", "have", "not", "you", "on", "by", "from", "which", "or", "at", "as", "we", "they", "will", "has", "been", "would"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ein", "eine", "zu", "den", "von", "mit", "sich", "des", "auf", "für", "dem", "auch", "es", "im", "wird", "werden", "sind", "wir", "ich", "sie", "oder", "aber", "wenn", "noch"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "un", "du", "que", "pour", "dans", "pas", "sur", "qui", "avec", "au", "ce", "sont", "nous", "vous", "il", "elle", "mais", "ou", "par", "cette", "aux", "été", "être"},
+	"es": {"el", "la", "los", "las", "y", "de", "que", "en", "es", "por", "con", "para", "una", "un", "del", "se", "no", "su", "al", "lo", "como", "más", "pero", "sus", "este", "está", "son", "fue", "también", "muy"},
+	"it": {"il", "la", "di", "che", "e", "è", "per", "una", "un", "del", "della", "non", "sono", "con", "gli", "le", "nel", "alla", "anche", "come", "questo", "si", "ma", "più", "dei", "delle", "essere", "ha", "da", "lo"},
+	"pt": {"o", "a", "os", "as", "e", "de", "que", "do", "da", "em", "um", "uma", "para", "com", "não", "é", "por", "mais", "dos", "das", "se", "no", "na", "mas", "foi", "são", "também", "está", "ao", "pelo"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "met", "voor", "die", "er", "ook", "maar", "aan", "bij", "wordt", "worden", "om", "ik", "je", "we", "naar", "dit", "nog", "kan", "heeft"},
+	"sv": {"och", "att", "det", "som", "en", "är", "av", "för", "med", "inte", "till", "den", "på", "har", "de", "ett", "om", "var", "jag", "vi", "men", "så", "kan", "från", "eller", "ska", "när", "också", "sig", "hade"},
+	"pl": {"i", "w", "nie", "na", "się", "z", "że", "do", "jest", "to", "o", "jak", "ale", "od", "po", "za", "co", "tak", "dla", "są", "oraz", "przez", "który", "czy", "jego", "być", "tym", "może", "także", "już"},
+}
+
+// stopwordLanguages maps each stopword to the languages it belongs to.
+var stopwordLanguages = func() map[string][]string {
+	out := map[string][]string{}
+	for lang, words := range languageStopwords {
+		for _, w := range words {
+			out[w] = append(out[w], lang)
+		}
+	}
+	return out
+}()
+
+// letterScripts are the scripts told apart before vocabulary is looked
+// at. Han and kana count together, since Japanese mixes them.
+var letterScripts = []struct {
+	name  string
+	table []*unicode.RangeTable
+}{
+	{"latin", []*unicode.RangeTable{unicode.Latin}},
+	{"cyrillic", []*unicode.RangeTable{unicode.Cyrillic}},
+	{"greek", []*unicode.RangeTable{unicode.Greek}},
+	{"arabic", []*unicode.RangeTable{unicode.Arabic}},
+	{"hebrew", []*unicode.RangeTable{unicode.Hebrew}},
+	{"devanagari", []*unicode.RangeTable{unicode.Devanagari}},
+	{"thai", []*unicode.RangeTable{unicode.Thai}},
+	{"hangul", []*unicode.RangeTable{unicode.Hangul}},
+	{"cjk", []*unicode.RangeTable{unicode.Han, unicode.Hiragana, unicode.Katakana}},
+}
+
+// DetectLanguage guesses the ISO 639-1 code of the language text is
+// written in, or returns "" when there is too little text or no language
+// stands out. Text in a script of its own is told by the script; Latin
+// and Cyrillic text by its words.
+func DetectLanguage(text string) string {
+	scripts := map[string]int{}
+	letters, kana := 0, 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, s := range letterScripts {
+			if unicode.IsOneOf(s.table, r) {
+				scripts[s.name]++
+				break
+			}
+		}
+		if unicode.In(r, unicode.Hiragana, unicode.Katakana) {
+			kana++
+		}
+	}
+	if letters < languageMinLetters {
+		return ""
+	}
+
+	script, most := "", 0
+	for _, s := range letterScripts {
+		if scripts[s.name] > most {
+			script, most = s.name, scripts[s.name]
+		}
+	}
+	if most*2 < letters {
+		return ""
+	}
+	switch script {
+	case "latin":
+		return detectByStopwords(text)
+	case "cyrillic":
+		// Ukrainian has letters Russian lacks.
+		if strings.ContainsAny(strings.ToLower(text), "іїєґ") {
+			return "uk"
+		}
+		return "ru"
+	case "greek":
+		return "el"
+	case "arabic":
+		// Persian adds letters for sounds Arabic lacks.
+		if strings.ContainsAny(text, "پچژگ") {
+			return "fa"
+		}
+		return "ar"
+	case "hebrew":
+		return "he"
+	case "devanagari":
+		return "hi"
+	case "thai":
+		return "th"
+	case "hangul":
+		return "ko"
+	case "cjk":
+		if kana*10 >= most {
+			return "ja"
+		}
+		return "zh"
+	}
+	return ""
+}
+
+// detectByStopwords picks the language whose stopwords make up the most of
+// text. It needs a clear winner: at least a tenth of the words, and a fifth
+// more hits than the runner-up.
+func detectByStopwords(text string) string {
+	hits := map[string]int{}
+	words := 0
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		if utf8.RuneCountInString(word) > 20 {
+			continue
+		}
+		words++
+		for _, lang := range stopwordLanguages[word] {
+			hits[lang]++
+		}
+	}
+
+	ranked := make([]string, 0, len(hits))
+	for lang := range hits {
+		ranked = append(ranked, lang)
+	}
+	if len(ranked) == 0 {
+		return ""
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if hits[ranked[i]] != hits[ranked[j]] {
+			return hits[ranked[i]] > hits[ranked[j]]
+		}
+		return ranked[i] < ranked[j]
+	})
+	best := hits[ranked[0]]
+	if best < 3 || best*10 < words {
+		return ""
+	}
+	if len(ranked) > 1 && best*5 < hits[ranked[1]]*6 {
+		return ""
+	}
+	return ranked[0]
+}
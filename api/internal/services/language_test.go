@@ -0,0 +1,125 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	cases := []struct{ text, want string }{
+		{"The quarterly report is attached. It covers the results of the sales team and the plans that we have for the next year.", "en"},
+		{"Der Bericht für das dritte Quartal ist fertig. Wir haben die Zahlen geprüft und es gibt noch einige Fragen, die wir klären werden.", "de"},
+		{"Le rapport trimestriel est prêt. Nous avons vérifié les chiffres et il reste quelques questions pour la réunion avec le client.", "fr"},
+		{"El informe trimestral está listo. Hemos revisado las cifras y todavía hay algunas preguntas para la reunión con los clientes del norte.", "es"},
+		{"Il rapporto trimestrale è pronto. Abbiamo controllato i numeri e ci sono ancora alcune domande per la riunione con il cliente.", "it"},
+		{"O relatório trimestral está pronto. Verificamos os números e ainda há algumas perguntas para a reunião com os clientes do norte.", "pt"},
+		{"Het kwartaalrapport is klaar. We hebben de cijfers gecontroleerd en er zijn nog een paar vragen voor de vergadering met de klant.", "nl"},
+		{"Квартальный отчёт готов. Мы проверили цифры, и осталось несколько вопросов к встрече с клиентом на следующей неделе.", "ru"},
+		{"Квартальний звіт готовий. Ми перевірили цифри, і залишилося кілька питань до зустрічі з клієнтом наступного тижня.", "uk"},
+		{"四半期報告書の準備ができました。数字を確認しましたが、来週の顧客との会議に向けていくつか質問が残っています。", "ja"},
+		{"季度报告已经准备好了。我们已经核对了数字，但是下周与客户开会之前还有一些问题需要讨论和确认。", "zh"},
+		{"분기 보고서가 준비되었습니다. 숫자를 확인했지만 다음 주 고객과의 회의 전에 몇 가지 질문이 남아 있습니다.", "ko"},
+		{"func main() { fmt.Println(x + y) }", ""},
+		{"id,amount,total\n1,20,30\n2,40,50\nabc,def,ghi\nxyz,uvw,rst\nqqq,ppp,ooo", ""},
+		{"short", ""},
+	}
+	for _, tc := range cases {
+		if got := DetectLanguage(tc.text); got != tc.want {
+			t.Errorf("%.40q: expected %q, got %q", tc.text, tc.want, got)
+		}
+	}
+}
+
+func TestLanguageDetector(t *testing.T) {
+	logger.Init()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.File{}, &models.Job{}, &models.OutboxEvent{}); err != nil {
+		t.Fatalf("failed automigrating models: %v", err)
+	}
+	ctx := context.Background()
+	bucket := newMemoryBucket()
+	jobs := NewJobRunner(db, config.JobsConfig{})
+	detector := NewLanguageDetector(db, jobs, bucket)
+
+	user := models.User{Email: "lang@example.com", FirstName: "Lang", LastName: "Uage", PasswordHash: "hash", Role: models.UserRoleUser}
+	db.Create(&user)
+	newFile := func(name, mimeType string, content []byte) models.File {
+		f := models.File{Name: name, MimeType: mimeType, OwnerID: user.ID, Size: int64(len(content)), StoragePath: uuid.NewString()}
+		bucket.objects[f.StoragePath] = content
+		if err := db.Create(&f).Error; err != nil {
+			t.Fatalf("failed creating %s: %v", name, err)
+		}
+		return f
+	}
+
+	notes := newFile("notizen.txt", "text/plain", []byte("Die Besprechung wird auf Donnerstag verschoben, weil der Raum nicht frei ist und wir noch auf die Unterlagen warten."))
+	if err := detector.HandleEvent(ctx, models.OutboxEvent{EventType: "file.upload", ResourceType: "file", ResourceID: &notes.ID}); err != nil {
+		t.Fatalf("handle event failed: %v", err)
+	}
+	if ran, err := jobs.RunNext(ctx); !ran || err != nil {
+		t.Fatalf("expected the language job to run, got %v, %v", ran, err)
+	}
+	db.First(&notes, "id = ?", notes.ID)
+	if notes.Language != "de" {
+		t.Fatalf("expected German, got %q", notes.Language)
+	}
+	var event models.OutboxEvent
+	if err := db.Where("event_type = ? AND resource_id = ?", "file.language_detected", notes.ID).First(&event).Error; err != nil {
+		t.Fatalf("expected a file.language_detected event: %v", err)
+	}
+	if event.Payload["language"] != "de" || event.Payload["previous_language"] != "" {
+		t.Fatalf("unexpected event payload %v", event.Payload)
+	}
+
+	t.Run("an unchanged language records nothing", func(t *testing.T) {
+		detector.Detect(ctx, notes.ID)
+		var events int64
+		db.Model(&models.OutboxEvent{}).Where("event_type = ? AND resource_id = ?", "file.language_detected", notes.ID).Count(&events)
+		if events != 1 {
+			t.Fatalf("expected one event, got %d", events)
+		}
+	})
+
+	t.Run("word documents are read", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, _ := zw.Create("word/document.xml")
+		io.WriteString(w, `<w:document xmlns:w="w"><w:body><w:p><w:r><w:t>Nous avons reçu la facture et elle sera payée</w:t></w:r></w:p>`+
+			`<w:p><w:r><w:t>avant la fin du mois, mais il manque encore le bon de commande pour le dossier.</w:t></w:r></w:p></w:body></w:document>`)
+		zw.Close()
+		doc := newFile("facture.docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", buf.Bytes())
+		if got, err := detector.Detect(ctx, doc.ID); err != nil || got != "fr" {
+			t.Fatalf("expected French, got %q, %v", got, err)
+		}
+	})
+
+	t.Run("other files are left alone", func(t *testing.T) {
+		image := newFile("scan.png", "image/png", []byte("The quarterly report is attached and it covers the results of the team."))
+		vault := newFile("secret.txt", "text/plain", []byte("The quarterly report is attached and it covers the results of the team."))
+		db.Model(&vault).UpdateColumn("vault_id", vault.ID)
+		for _, f := range []models.File{image, vault} {
+			if got, err := detector.Detect(ctx, f.ID); err != nil || got != "" {
+				t.Errorf("%s: expected no language, got %q, %v", f.Name, got, err)
+			}
+		}
+		if err := detector.HandleEvent(ctx, models.OutboxEvent{EventType: "file.delete", ResourceType: "file", ResourceID: &image.ID}); err != nil {
+			t.Fatalf("handle event failed: %v", err)
+		}
+		if ran, _ := jobs.RunNext(ctx); ran {
+			t.Fatalf("expected no job for a delete")
+		}
+	})
+}
@@ -108,7 +108,7 @@ func (s *LDAPService) Authenticate(ctx context.Context, username, password strin
 	if emailField != "mail" {
 		attrs = append(attrs, "mail")
 	}
-	attrs = append(attrs, "cn", "uid", "sn", "givenName", "displayName")
+	attrs = append(attrs, "cn", "uid", "sn", "givenName", "displayName", "memberOf")
 
 	searchRequest := ldap.NewSearchRequest(
 		cfg.SearchBase,
@@ -212,6 +212,7 @@ func (s *LDAPService) Authenticate(ctx context.Context, username, password strin
 			"dn":       userDN,
 			"username": username,
 			"email":    email,
+			"memberOf": entry.GetAttributeValues("memberOf"),
 		},
 	}, nil
 }
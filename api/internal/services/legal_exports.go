@@ -0,0 +1,743 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/storage"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	legalExportJob    = "legal_export.run"
+	legalExportPrefix = "legal-exports/"
+	// LegalExportManifestVersion is the format of manifest.json in an
+	// export archive.
+	LegalExportManifestVersion = 1
+	// LegalExportLinkTTL is how long a download link stays valid if it is
+	// not used.
+	LegalExportLinkTTL = 15 * time.Minute
+	// legalExportProgressEvery is how many files pass between progress
+	// saves.
+	legalExportProgressEvery = 25
+	legalExportBatchSize     = 500
+)
+
+var (
+	ErrLegalExportNotFound    = errors.New("legal export not found")
+	ErrLegalExportInvalid     = errors.New("invalid legal export request")
+	ErrLegalExportNotReady    = errors.New("legal export has not completed")
+	ErrLegalExportLinkInvalid = errors.New("download link is invalid, expired or already used")
+
+	errArchiveUploadStopped = errors.New("archive upload stopped")
+)
+
+// LegalExportRequest names what to export: everything a user owns, or
+// everything below a folder.
+type LegalExportRequest struct {
+	SubjectUserID *uuid.UUID
+	FolderID      *uuid.UUID
+	// Reason is the matter or case the export is for. It is recorded in
+	// the manifest and the audit log.
+	Reason string
+}
+
+// LegalExportManifest is manifest.json in an export archive. It lists
+// every other member of the archive with its SHA-256, and is signed with
+// the manifest signing key into manifest.sig.
+type LegalExportManifest struct {
+	Version       int             `json:"version"`
+	ExportID      uuid.UUID       `json:"exportID"`
+	Scope         string          `json:"scope"`
+	SubjectUserID *uuid.UUID      `json:"subjectUserID,omitempty"`
+	FolderID      *uuid.UUID      `json:"folderID,omitempty"`
+	Reason        string          `json:"reason"`
+	RequestedBy   uuid.UUID       `json:"requestedBy"`
+	GeneratedAt   time.Time       `json:"generatedAt"`
+	FileCount     int             `json:"fileCount"`
+	TotalSize     int64           `json:"totalSize"`
+	Entries       []ManifestEntry `json:"entries"`
+	// Missing lists files whose bytes were not in storage when the export
+	// ran. Their metadata is still in metadata/files.json.
+	Missing []string `json:"missing,omitempty"`
+}
+
+// legalExportFile is one entry of metadata/files.json. DocShare keeps only
+// the current version of a file, which Checksum, Size and UpdatedAt
+// describe.
+type legalExportFile struct {
+	ID               uuid.UUID  `json:"id"`
+	Path             string     `json:"path"`
+	IsDirectory      bool       `json:"isDirectory"`
+	ParentID         *uuid.UUID `json:"parentID,omitempty"`
+	OwnerID          uuid.UUID  `json:"ownerID"`
+	OrganizationID   *uuid.UUID `json:"organizationID,omitempty"`
+	MimeType         string     `json:"mimeType,omitempty"`
+	DeclaredMimeType string     `json:"declaredMimeType,omitempty"`
+	DetectedMimeType string     `json:"detectedMimeType,omitempty"`
+	Size             int64      `json:"size"`
+	Checksum         string     `json:"sha256,omitempty"`
+	Tags             []string   `json:"tags,omitempty"`
+	RetentionClass   string     `json:"retentionClass,omitempty"`
+	Encrypted        bool       `json:"encrypted,omitempty"`
+	QuarantinedAt    *time.Time `json:"quarantinedAt,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt"`
+	// Properties are the file's custom property values by key.
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// legalExportShare is one entry of metadata/shares.json. Revoked shares
+// are included, with the time they were revoked.
+type legalExportShare struct {
+	ID                uuid.UUID              `json:"id"`
+	FileID            uuid.UUID              `json:"fileID"`
+	SharedByID        uuid.UUID              `json:"sharedByID"`
+	SharedWithUserID  *uuid.UUID             `json:"sharedWithUserID,omitempty"`
+	SharedWithGroupID *uuid.UUID             `json:"sharedWithGroupID,omitempty"`
+	SharedWithEmail   *string                `json:"sharedWithEmail,omitempty"`
+	ShareType         models.ShareType       `json:"shareType"`
+	Permission        models.SharePermission `json:"permission"`
+	ExpiresAt         *time.Time             `json:"expiresAt,omitempty"`
+	CreatedAt         time.Time              `json:"createdAt"`
+	RevokedAt         *time.Time             `json:"revokedAt,omitempty"`
+}
+
+// LegalExports builds eDiscovery archives on the job runner and hands them
+// out through one-time download links. Archives are kept under
+// legal-exports/ in the bucket until the export is deleted.
+type LegalExports struct {
+	DB     *gorm.DB
+	Store  TransferStore
+	Jobs   *JobRunner
+	Signer *ManifestService
+	now    func() time.Time
+}
+
+func NewLegalExports(db *gorm.DB, store TransferStore, jobs *JobRunner, signer *ManifestService) *LegalExports {
+	e := &LegalExports{DB: db, Store: store, Jobs: jobs, Signer: signer, now: time.Now}
+	jobs.Register(legalExportJob, e.runJob, JobOptions{MaxAttempts: 1})
+	return e
+}
+
+// Start checks req and queues the export.
+func (e *LegalExports) Start(ctx context.Context, requestedByID uuid.UUID, req LegalExportRequest) (*models.LegalExport, error) {
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return nil, fmt.Errorf("%w: reason is required", ErrLegalExportInvalid)
+	}
+	if (req.SubjectUserID == nil) == (req.FolderID == nil) {
+		return nil, fmt.Errorf("%w: set exactly one of userID and folderID", ErrLegalExportInvalid)
+	}
+	db := e.DB.WithContext(ctx)
+	if req.SubjectUserID != nil {
+		var count int64
+		if err := db.Model(&models.User{}).Where("id = ?", *req.SubjectUserID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("%w: user not found", ErrLegalExportInvalid)
+		}
+	} else {
+		var folder models.File
+		if err := db.Select("id", "is_directory").Limit(1).Find(&folder, "id = ?", *req.FolderID).Error; err != nil {
+			return nil, err
+		}
+		if folder.ID == uuid.Nil || !folder.IsDirectory {
+			return nil, fmt.Errorf("%w: folderID is not a folder", ErrLegalExportInvalid)
+		}
+	}
+
+	export := models.LegalExport{
+		RequestedByID: requestedByID,
+		SubjectUserID: req.SubjectUserID,
+		FolderID:      req.FolderID,
+		Reason:        reason,
+		Status:        models.LegalExportStatusPending,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&export).Error; err != nil {
+			return err
+		}
+		_, err := e.Jobs.enqueue(tx, legalExportJob, map[string]interface{}{"export_id": export.ID.String()}, EnqueueOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (e *LegalExports) Get(ctx context.Context, id uuid.UUID) (*models.LegalExport, error) {
+	var export models.LegalExport
+	if err := e.DB.WithContext(ctx).First(&export, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLegalExportNotFound
+		}
+		return nil, err
+	}
+	return &export, nil
+}
+
+// Delete removes an export and its archive. A running export cannot be
+// deleted until it finishes.
+func (e *LegalExports) Delete(ctx context.Context, export *models.LegalExport) error {
+	if export.Status == models.LegalExportStatusPending || export.Status == models.LegalExportStatusRunning {
+		return ErrLegalExportNotReady
+	}
+	if export.ObjectKey != "" {
+		if err := e.Store.Delete(ctx, export.ObjectKey); err != nil {
+			return err
+		}
+	}
+	return e.DB.WithContext(ctx).Delete(export).Error
+}
+
+// IssueLink returns a token that downloads export once within
+// LegalExportLinkTTL. Issuing a link voids the previous one.
+func (e *LegalExports) IssueLink(ctx context.Context, export *models.LegalExport) (string, time.Time, error) {
+	if export.Status != models.LegalExportStatusCompleted {
+		return "", time.Time{}, ErrLegalExportNotReady
+	}
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	token := "dle_" + hex.EncodeToString(raw)
+	expires := e.now().UTC().Add(LegalExportLinkTTL)
+	if err := e.DB.WithContext(ctx).Model(export).Updates(map[string]interface{}{
+		"link_token_hash": hashLegalExportToken(token),
+		"link_expires_at": expires,
+	}).Error; err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expires, nil
+}
+
+// Redeem spends a download link and returns the export it was issued for.
+// Only the first of concurrent callers gets it.
+func (e *LegalExports) Redeem(ctx context.Context, token string) (*models.LegalExport, error) {
+	if !strings.HasPrefix(token, "dle_") {
+		return nil, ErrLegalExportLinkInvalid
+	}
+	hash := hashLegalExportToken(token)
+	db := e.DB.WithContext(ctx)
+	var export models.LegalExport
+	if err := db.Limit(1).Find(&export, "link_token_hash = ?", hash).Error; err != nil {
+		return nil, err
+	}
+	now := e.now().UTC()
+	if export.ID == uuid.Nil || export.LinkExpiresAt == nil || now.After(*export.LinkExpiresAt) {
+		return nil, ErrLegalExportLinkInvalid
+	}
+	result := db.Model(&models.LegalExport{}).
+		Where("id = ? AND link_token_hash = ?", export.ID, hash).
+		Updates(map[string]interface{}{
+			"link_token_hash":  "",
+			"link_expires_at":  nil,
+			"download_count":   gorm.Expr("download_count + 1"),
+			"last_download_at": now,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrLegalExportLinkInvalid
+	}
+	export.LinkTokenHash, export.LinkExpiresAt = "", nil
+	export.DownloadCount++
+	export.LastDownloadAt = &now
+	return &export, nil
+}
+
+// Open reads a finished export's archive.
+func (e *LegalExports) Open(ctx context.Context, export *models.LegalExport) (io.ReadCloser, error) {
+	if export.Status != models.LegalExportStatusCompleted || export.ObjectKey == "" {
+		return nil, ErrLegalExportNotReady
+	}
+	return e.Store.Get(ctx, export.ObjectKey)
+}
+
+func (e *LegalExports) runJob(ctx context.Context, job *models.Job) error {
+	raw, _ := job.Payload["export_id"].(string)
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("legal export job without an export id: %q", raw)
+	}
+	export, err := e.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return e.Run(ctx, export)
+}
+
+// Run builds the archive for export and saves the outcome, whether or not
+// it succeeds.
+func (e *LegalExports) Run(ctx context.Context, export *models.LegalExport) error {
+	started := e.now().UTC()
+	export.Status = models.LegalExportStatusRunning
+	export.StartedAt = &started
+	export.FilesDone, export.BytesDone = 0, 0
+	if err := e.DB.Save(export).Error; err != nil {
+		return err
+	}
+
+	key := legalExportPrefix + export.ID.String() + ".zip"
+	runErr := e.build(ctx, export, key)
+	finished := e.now().UTC()
+	export.FinishedAt = &finished
+	export.Status = models.LegalExportStatusCompleted
+	if runErr != nil {
+		_ = e.Store.Delete(ctx, key)
+		export.Status = models.LegalExportStatusFailed
+		export.LastError = runErr.Error()
+		export.ObjectKey = ""
+	} else {
+		export.ObjectKey = key
+	}
+	if err := e.DB.Save(export).Error; err != nil {
+		return err
+	}
+
+	fields := map[string]interface{}{
+		"export_id":  export.ID.String(),
+		"files":      export.FilesDone,
+		"bytes":      export.BytesDone,
+		"size":       export.Size,
+		"started_by": export.RequestedByID.String(),
+	}
+	if runErr != nil {
+		logger.Error("legal_export_failed", runErr, fields)
+		return runErr
+	}
+	logger.Info("legal_export_completed", fields)
+	return nil
+}
+
+// build writes the archive to key as it is assembled, so the export is
+// never held in memory or on local disk.
+func (e *LegalExports) build(ctx context.Context, export *models.LegalExport, key string) error {
+	files, err := e.files(ctx, export)
+	if err != nil {
+		return err
+	}
+	export.FilesTotal = 0
+	for _, f := range files {
+		if !f.IsDirectory {
+			export.FilesTotal++
+		}
+	}
+	if err := e.DB.Model(export).Update("files_total", export.FilesTotal).Error; err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		err := e.writeArchive(ctx, export, files, writer)
+		writer.CloseWithError(err)
+		written <- err
+	}()
+	sum := sha256.New()
+	counted := &countingReader{r: io.TeeReader(reader, sum)}
+	uploadErr := e.Store.Upload(ctx, key, counted, -1, "application/zip")
+	// Unblock the writer if the upload gave up before reading everything.
+	reader.CloseWithError(errArchiveUploadStopped)
+	// Report why the archive failed rather than the other side noticing.
+	writeErr := <-written
+	if writeErr != nil && !errors.Is(writeErr, errArchiveUploadStopped) {
+		return writeErr
+	}
+	if uploadErr != nil {
+		return uploadErr
+	}
+	export.Size = counted.n
+	export.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	return nil
+}
+
+func (e *LegalExports) writeArchive(ctx context.Context, export *models.LegalExport, files []legalExportFile, out io.Writer) error {
+	archive := zip.NewWriter(out)
+	manifest := LegalExportManifest{
+		Version:       LegalExportManifestVersion,
+		ExportID:      export.ID,
+		Scope:         "folder",
+		SubjectUserID: export.SubjectUserID,
+		FolderID:      export.FolderID,
+		Reason:        export.Reason,
+		RequestedBy:   export.RequestedByID,
+		GeneratedAt:   e.now().UTC().Truncate(time.Second),
+		Entries:       []ManifestEntry{},
+	}
+	if export.SubjectUserID != nil {
+		manifest.Scope = "user"
+	}
+
+	storagePaths, err := e.storagePaths(ctx, files)
+	if err != nil {
+		return err
+	}
+
+	for i := range files {
+		f := &files[i]
+		if f.IsDirectory {
+			continue
+		}
+		name := "files/" + f.Path
+		entry, err := e.copyFile(ctx, archive, name, storagePaths[f.ID], f.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Path, err)
+		}
+		if entry == nil {
+			manifest.Missing = append(manifest.Missing, f.Path)
+		} else {
+			manifest.Entries = append(manifest.Entries, *entry)
+			manifest.FileCount++
+			manifest.TotalSize += entry.Size
+			export.BytesDone += entry.Size
+		}
+		export.FilesDone++
+		if export.FilesDone%legalExportProgressEvery == 0 {
+			if err := e.saveProgress(export); err != nil {
+				return err
+			}
+		}
+	}
+	if err := e.saveProgress(export); err != nil {
+		return err
+	}
+
+	shares, err := e.shares(ctx, files)
+	if err != nil {
+		return err
+	}
+	audit, err := e.auditEntries(ctx, export, files)
+	if err != nil {
+		return err
+	}
+	metadata := []struct {
+		name  string
+		value interface{}
+	}{
+		{"metadata/files.json", files},
+		{"metadata/shares.json", shares},
+		{"metadata/audit.json", audit},
+	}
+	if export.SubjectUserID != nil {
+		var user models.User
+		if err := e.DB.WithContext(ctx).First(&user, "id = ?", *export.SubjectUserID).Error; err != nil {
+			return err
+		}
+		metadata = append(metadata, struct {
+			name  string
+			value interface{}
+		}{"metadata/user.json", user})
+	}
+	for _, m := range metadata {
+		data, err := json.MarshalIndent(m.value, "", "  ")
+		if err != nil {
+			return err
+		}
+		entry, err := writeArchiveMember(archive, m.name, data, manifest.GeneratedAt)
+		if err != nil {
+			return err
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+
+	sort.Slice(manifest.Entries, func(i, j int) bool { return manifest.Entries[i].Path < manifest.Entries[j].Path })
+	payload, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if _, err := writeArchiveMember(archive, "manifest.json", payload, manifest.GeneratedAt); err != nil {
+		return err
+	}
+	signature, err := json.MarshalIndent(map[string]string{
+		"algorithm": ManifestSignatureAlgorithm,
+		"keyID":     e.Signer.KeyID(),
+		"signature": e.Signer.SignPayload(payload),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := writeArchiveMember(archive, "manifest.sig", signature, manifest.GeneratedAt); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// copyFile stores one file's bytes in the archive, hashing them on the
+// way. It returns nil when the object is missing from storage.
+func (e *LegalExports) copyFile(ctx context.Context, archive *zip.Writer, name, key string, modified time.Time) (*ManifestEntry, error) {
+	data, err := e.Store.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer data.Close()
+	// Stored rather than deflated: most documents and media are
+	// compressed already, and this keeps the export cheap to build.
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: modified})
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, sum), data)
+	if err != nil {
+		return nil, err
+	}
+	return &ManifestEntry{Path: name, Size: n, SHA256: hex.EncodeToString(sum.Sum(nil))}, nil
+}
+
+func writeArchiveMember(archive *zip.Writer, name string, data []byte, modified time.Time) (ManifestEntry, error) {
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return ManifestEntry{}, err
+	}
+	sum := sha256.Sum256(data)
+	return ManifestEntry{Path: name, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}, nil
+}
+
+func (e *LegalExports) saveProgress(export *models.LegalExport) error {
+	return e.DB.Model(export).Updates(map[string]interface{}{
+		"files_done": export.FilesDone,
+		"bytes_done": export.BytesDone,
+	}).Error
+}
+
+// files lists what export covers, with each entry's path in the archive:
+// relative to the folder for a folder export, and to the user's root for
+// a user export. A user's files inside someone else's folder start a path
+// of their own. Paths that would collide get the file's ID appended.
+func (e *LegalExports) files(ctx context.Context, export *models.LegalExport) ([]legalExportFile, error) {
+	var rows []models.File
+	db := e.DB.WithContext(ctx)
+	if export.SubjectUserID != nil {
+		if err := db.Where("owner_id = ?", *export.SubjectUserID).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+	} else {
+		var ids []uuid.UUID
+		if err := db.Raw(`
+			WITH RECURSIVE tree AS (
+				SELECT id FROM files WHERE parent_id = ? AND deleted_at IS NULL
+				UNION ALL
+				SELECT f.id FROM files f
+				INNER JOIN tree t ON f.parent_id = t.id
+				WHERE f.deleted_at IS NULL
+			)
+			SELECT id FROM tree
+		`, *export.FolderID).Scan(&ids).Error; err != nil {
+			return nil, err
+		}
+		for start := 0; start < len(ids); start += legalExportBatchSize {
+			var batch []models.File
+			if err := db.Where("id IN ?", ids[start:min(start+legalExportBatchSize, len(ids))]).Find(&batch).Error; err != nil {
+				return nil, err
+			}
+			rows = append(rows, batch...)
+		}
+	}
+
+	byID := make(map[uuid.UUID]*models.File, len(rows))
+	for i := range rows {
+		byID[rows[i].ID] = &rows[i]
+	}
+	paths := make(map[uuid.UUID]string, len(rows))
+	var pathOf func(f *models.File) string
+	pathOf = func(f *models.File) string {
+		if p, ok := paths[f.ID]; ok {
+			return p
+		}
+		p := sanitizeArchiveName(f.Name)
+		if f.ParentID != nil {
+			if parent, ok := byID[*f.ParentID]; ok {
+				p = pathOf(parent) + "/" + p
+			}
+		}
+		paths[f.ID] = p
+		return p
+	}
+
+	ids := make([]uuid.UUID, len(rows))
+	for i := range rows {
+		ids[i] = rows[i].ID
+	}
+	properties, err := NewProperties(e.DB).ForFiles(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]legalExportFile, 0, len(rows))
+	for i := range rows {
+		f := &rows[i]
+		entry := legalExportFile{
+			ID:               f.ID,
+			Path:             pathOf(f),
+			IsDirectory:      f.IsDirectory,
+			ParentID:         f.ParentID,
+			OwnerID:          f.OwnerID,
+			OrganizationID:   f.OrganizationID,
+			MimeType:         f.MimeType,
+			DeclaredMimeType: f.DeclaredMimeType,
+			DetectedMimeType: f.DetectedMimeType,
+			Size:             f.Size,
+			Tags:             f.Tags,
+			RetentionClass:   f.RetentionClass,
+			Properties:       properties[f.ID],
+			Encrypted:        f.VaultID != nil,
+			QuarantinedAt:    f.QuarantinedAt,
+			CreatedAt:        f.CreatedAt,
+			UpdatedAt:        f.UpdatedAt,
+		}
+		if f.Checksum != nil {
+			entry.Checksum = *f.Checksum
+		}
+		out = append(out, entry)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	seen := make(map[string]bool, len(out))
+	for i := range out {
+		if seen[out[i].Path] && !out[i].IsDirectory {
+			ext := path.Ext(out[i].Path)
+			out[i].Path = strings.TrimSuffix(out[i].Path, ext) + " (" + out[i].ID.String() + ")" + ext
+		}
+		seen[out[i].Path] = true
+	}
+	return out, nil
+}
+
+func (e *LegalExports) storagePaths(ctx context.Context, files []legalExportFile) (map[uuid.UUID]string, error) {
+	ids := fileIDs(files)
+	paths := make(map[uuid.UUID]string, len(ids))
+	for start := 0; start < len(ids); start += legalExportBatchSize {
+		var rows []models.File
+		if err := e.DB.WithContext(ctx).Select("id", "storage_path").
+			Where("id IN ?", ids[start:min(start+legalExportBatchSize, len(ids))]).
+			Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			paths[row.ID] = row.StoragePath
+		}
+	}
+	return paths, nil
+}
+
+// shares lists every share of the exported files, revoked ones included.
+func (e *LegalExports) shares(ctx context.Context, files []legalExportFile) ([]legalExportShare, error) {
+	ids := fileIDs(files)
+	out := []legalExportShare{}
+	for start := 0; start < len(ids); start += legalExportBatchSize {
+		var rows []models.Share
+		if err := e.DB.WithContext(ctx).Unscoped().
+			Where("file_id IN ?", ids[start:min(start+legalExportBatchSize, len(ids))]).
+			Order("created_at ASC").Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, s := range rows {
+			share := legalExportShare{
+				ID:                s.ID,
+				FileID:            s.FileID,
+				SharedByID:        s.SharedByID,
+				SharedWithUserID:  s.SharedWithUserID,
+				SharedWithGroupID: s.SharedWithGroupID,
+				SharedWithEmail:   s.SharedWithEmail,
+				ShareType:         s.ShareType,
+				Permission:        s.Permission,
+				ExpiresAt:         s.ExpiresAt,
+				CreatedAt:         s.CreatedAt,
+			}
+			if s.DeletedAt.Valid {
+				revoked := s.DeletedAt.Time
+				share.RevokedAt = &revoked
+			}
+			out = append(out, share)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+// auditEntries lists the audit log entries about the exported files and,
+// for a user export, everything the user did.
+func (e *LegalExports) auditEntries(ctx context.Context, export *models.LegalExport, files []legalExportFile) ([]models.AuditLog, error) {
+	db := e.DB.WithContext(ctx)
+	byID := map[uuid.UUID]models.AuditLog{}
+	if export.SubjectUserID != nil {
+		var rows []models.AuditLog
+		if err := db.Where("user_id = ?", *export.SubjectUserID).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			byID[row.ID] = row
+		}
+	}
+	ids := fileIDs(files)
+	if export.FolderID != nil {
+		ids = append(ids, *export.FolderID)
+	}
+	for start := 0; start < len(ids); start += legalExportBatchSize {
+		var rows []models.AuditLog
+		if err := db.Where("resource_id IN ?", ids[start:min(start+legalExportBatchSize, len(ids))]).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			byID[row.ID] = row
+		}
+	}
+	out := make([]models.AuditLog, 0, len(byID))
+	for _, row := range byID {
+		out = append(out, row)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID.String() < out[j].ID.String()
+	})
+	return out, nil
+}
+
+func fileIDs(files []legalExportFile) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(files))
+	for _, f := range files {
+		ids = append(ids, f.ID)
+	}
+	return ids
+}
+
+// sanitizeArchiveName keeps a file name from escaping its folder in the
+// archive.
+func sanitizeArchiveName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+func hashLegalExportToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestLegalExports(t *testing.T) {
+	logger.Init()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.File{}, &models.Share{}, &models.AuditLog{}, &models.LegalExport{}, &models.Job{}, &models.PropertyDefinition{}, &models.FileProperty{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+
+	ctx := context.Background()
+	store := newMemoryBucket()
+	jobs := NewJobRunner(db, config.JobsConfig{})
+	signer, err := NewManifestService(db, nil, config.ManifestConfig{}, "legal-export-secret")
+	if err != nil {
+		t.Fatalf("failed creating manifest service: %v", err)
+	}
+	exports := NewLegalExports(db, store, jobs, signer)
+
+	admin := models.User{Email: "legal-admin@test.com", FirstName: "L", LastName: "A", PasswordHash: "x", Role: models.UserRoleAdmin}
+	custodian := models.User{Email: "custodian@test.com", FirstName: "C", LastName: "U", PasswordHash: "x"}
+	other := models.User{Email: "other@test.com", FirstName: "O", LastName: "U", PasswordHash: "x"}
+	db.Create(&admin)
+	db.Create(&custodian)
+	db.Create(&other)
+
+	matter := models.File{Name: "Matter", IsDirectory: true, OwnerID: custodian.ID}
+	db.Create(&matter)
+	memo := models.File{Name: "memo.txt", ParentID: &matter.ID, OwnerID: custodian.ID, Size: 5, StoragePath: "legal/memo.txt"}
+	db.Create(&memo)
+	drafts := models.File{Name: "Drafts", IsDirectory: true, ParentID: &matter.ID, OwnerID: custodian.ID}
+	db.Create(&drafts)
+	draft := models.File{Name: "draft.txt", ParentID: &drafts.ID, OwnerID: other.ID, Size: 6, StoragePath: "legal/draft.txt"}
+	db.Create(&draft)
+	lost := models.File{Name: "lost.txt", ParentID: &matter.ID, OwnerID: custodian.ID, StoragePath: "legal/lost.txt"}
+	db.Create(&lost)
+	store.put(memo.StoragePath, "hello")
+	store.put(draft.StoragePath, "drafty")
+
+	share := models.Share{FileID: memo.ID, SharedByID: custodian.ID, SharedWithUserID: &other.ID, ShareType: models.ShareTypePrivate, Permission: models.SharePermissionView}
+	db.Create(&share)
+	db.Delete(&share)
+	db.Create(&models.AuditLog{UserID: &custodian.ID, Action: "file.download", ResourceType: "file", ResourceID: &memo.ID})
+	db.Create(&models.AuditLog{UserID: &other.ID, Action: "user.login", ResourceType: "user"})
+	matterNumber := models.PropertyDefinition{Key: "matter_number", Label: "Matter number", Type: models.PropertyTypeText, CreatedByID: admin.ID}
+	db.Create(&matterNumber)
+	db.Create(&models.FileProperty{FileID: memo.ID, DefinitionID: matterNumber.ID, Key: matterNumber.Key, Value: "M-42"})
+
+	unknown := uuid.New()
+
+	run := func(t *testing.T, req LegalExportRequest) (*models.LegalExport, *zip.Reader) {
+		t.Helper()
+		req.Reason = "Case 42"
+		export, err := exports.Start(ctx, admin.ID, req)
+		if err != nil {
+			t.Fatalf("failed starting export: %v", err)
+		}
+		if ran, err := jobs.RunNext(ctx); !ran || err != nil {
+			t.Fatalf("expected the export job to run, got %v, %v", ran, err)
+		}
+		export, _ = exports.Get(ctx, export.ID)
+		if export.Status != models.LegalExportStatusCompleted {
+			t.Fatalf("expected the export to complete, got %s: %s", export.Status, export.LastError)
+		}
+		obj, err := exports.Open(ctx, export)
+		if err != nil {
+			t.Fatalf("failed opening archive: %v", err)
+		}
+		defer obj.Close()
+		data, _ := io.ReadAll(obj)
+		if int64(len(data)) != export.Size {
+			t.Fatalf("expected %d bytes, got %d", export.Size, len(data))
+		}
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("failed reading archive: %v", err)
+		}
+		return export, archive
+	}
+	member := func(t *testing.T, archive *zip.Reader, name string) []byte {
+		t.Helper()
+		f, err := archive.Open(name)
+		if err != nil {
+			t.Fatalf("archive has no %s: %v", name, err)
+		}
+		defer f.Close()
+		data, _ := io.ReadAll(f)
+		return data
+	}
+
+	t.Run("refuses invalid requests", func(t *testing.T) {
+		for name, req := range map[string]LegalExportRequest{
+			"no reason":    {SubjectUserID: &custodian.ID},
+			"no subject":   {Reason: "x"},
+			"both":         {SubjectUserID: &custodian.ID, FolderID: &matter.ID, Reason: "x"},
+			"unknown user": {SubjectUserID: &unknown, Reason: "x"},
+			"not a folder": {FolderID: &memo.ID, Reason: "x"},
+		} {
+			if _, err := exports.Start(ctx, admin.ID, req); !errors.Is(err, ErrLegalExportInvalid) {
+				t.Errorf("%s: expected ErrLegalExportInvalid, got %v", name, err)
+			}
+		}
+	})
+
+	t.Run("exports a folder with a signed manifest", func(t *testing.T) {
+		export, archive := run(t, LegalExportRequest{FolderID: &matter.ID})
+		if export.FilesTotal != 3 || export.FilesDone != 3 || export.BytesDone != 11 {
+			t.Fatalf("unexpected progress %+v", export)
+		}
+		if got := string(member(t, archive, "files/Drafts/draft.txt")); got != "drafty" {
+			t.Fatalf("unexpected draft content %q", got)
+		}
+
+		payload := member(t, archive, "manifest.json")
+		var sig struct {
+			KeyID     string `json:"keyID"`
+			Signature string `json:"signature"`
+		}
+		if err := json.Unmarshal(member(t, archive, "manifest.sig"), &sig); err != nil {
+			t.Fatalf("failed decoding signature: %v", err)
+		}
+		raw, _ := base64.StdEncoding.DecodeString(sig.Signature)
+		if sig.KeyID != signer.KeyID() || !ed25519.Verify(signer.PublicKey(), payload, raw) {
+			t.Fatal("expected manifest.json to verify against the manifest key")
+		}
+		var manifest LegalExportManifest
+		if err := json.Unmarshal(payload, &manifest); err != nil {
+			t.Fatalf("failed decoding manifest: %v", err)
+		}
+		if manifest.Scope != "folder" || manifest.FileCount != 2 || !slices.Equal(manifest.Missing, []string{"lost.txt"}) {
+			t.Fatalf("unexpected manifest %+v", manifest)
+		}
+
+		var files []legalExportFile
+		_ = json.Unmarshal(member(t, archive, "metadata/files.json"), &files)
+		for _, f := range files {
+			if f.ID == memo.ID && f.Properties["matter_number"] != "M-42" {
+				t.Fatalf("expected the memo's properties, got %v", f.Properties)
+			}
+		}
+
+		var shares []legalExportShare
+		_ = json.Unmarshal(member(t, archive, "metadata/shares.json"), &shares)
+		if len(shares) != 1 || shares[0].RevokedAt == nil {
+			t.Fatalf("expected the revoked share, got %+v", shares)
+		}
+		var audit []models.AuditLog
+		_ = json.Unmarshal(member(t, archive, "metadata/audit.json"), &audit)
+		if len(audit) != 1 || audit[0].Action != "file.download" {
+			t.Fatalf("expected only the memo's audit entry, got %+v", audit)
+		}
+	})
+
+	t.Run("exports what a user owns", func(t *testing.T) {
+		_, archive := run(t, LegalExportRequest{SubjectUserID: &other.ID})
+		var manifest LegalExportManifest
+		_ = json.Unmarshal(member(t, archive, "manifest.json"), &manifest)
+		if manifest.Scope != "user" || manifest.FileCount != 1 {
+			t.Fatalf("unexpected manifest %+v", manifest)
+		}
+		member(t, archive, "files/draft.txt")
+		member(t, archive, "metadata/user.json")
+		var audit []models.AuditLog
+		_ = json.Unmarshal(member(t, archive, "metadata/audit.json"), &audit)
+		if len(audit) != 1 || audit[0].Action != "user.login" {
+			t.Fatalf("expected the user's own audit entry, got %+v", audit)
+		}
+	})
+
+	t.Run("download links work once and expire", func(t *testing.T) {
+		export, _ := run(t, LegalExportRequest{FolderID: &drafts.ID})
+		token, _, err := exports.IssueLink(ctx, export)
+		if err != nil {
+			t.Fatalf("failed issuing link: %v", err)
+		}
+		redeemed, err := exports.Redeem(ctx, token)
+		if err != nil || redeemed.ID != export.ID || redeemed.DownloadCount != 1 {
+			t.Fatalf("expected the link to redeem, got %+v, %v", redeemed, err)
+		}
+		if _, err := exports.Redeem(ctx, token); !errors.Is(err, ErrLegalExportLinkInvalid) {
+			t.Fatalf("expected a spent link to be refused, got %v", err)
+		}
+
+		token, _, _ = exports.IssueLink(ctx, export)
+		exports.now = func() time.Time { return time.Now().Add(LegalExportLinkTTL + time.Minute) }
+		t.Cleanup(func() { exports.now = time.Now })
+		if _, err := exports.Redeem(ctx, token); !errors.Is(err, ErrLegalExportLinkInvalid) {
+			t.Fatalf("expected an expired link to be refused, got %v", err)
+		}
+	})
+
+	t.Run("deletes the archive with the export", func(t *testing.T) {
+		export, _ := run(t, LegalExportRequest{FolderID: &drafts.ID})
+		if err := exports.Delete(ctx, export); err != nil {
+			t.Fatalf("failed deleting export: %v", err)
+		}
+		if _, err := store.Get(ctx, export.ObjectKey); err == nil {
+			t.Fatal("expected the archive to be deleted")
+		}
+		if _, err := exports.Get(ctx, export.ID); !errors.Is(err, ErrLegalExportNotFound) {
+			t.Fatalf("expected the export to be gone, got %v", err)
+		}
+	})
+}
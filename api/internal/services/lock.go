@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultLockTTL = 30 * time.Minute
+	MaxLockTTL     = 24 * time.Hour
+)
+
+var (
+	ErrFileLocked  = errors.New("file is locked by another user")
+	ErrLockNotHeld = errors.New("lock is not held by this user")
+)
+
+// LockService manages advisory file locks. Locks are advisory in the sense
+// that reads are never blocked; only content and metadata writes by users
+// other than the holder are refused.
+type LockService struct {
+	DB *gorm.DB
+}
+
+func NewLockService(db *gorm.DB) *LockService {
+	return &LockService{DB: db}
+}
+
+// Acquire takes or refreshes the lock on fileID for userID. If another user
+// holds an active lock, that lock is returned alongside ErrFileLocked so the
+// caller can tell the client who holds it and until when.
+func (s *LockService) Acquire(ctx context.Context, fileID, userID uuid.UUID, ttl time.Duration, reason string) (*models.FileLock, error) {
+	if ttl <= 0 {
+		ttl = DefaultLockTTL
+	}
+	if ttl > MaxLockTTL {
+		ttl = MaxLockTTL
+	}
+
+	var lock models.FileLock
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing models.FileLock
+		err := tx.Where("file_id = ?", fileID).First(&existing).Error
+		switch {
+		case err == nil && existing.IsActive() && existing.LockedByID != userID:
+			lock = existing
+			return ErrFileLocked
+		case err == nil:
+			existing.LockedByID = userID
+			existing.Reason = reason
+			existing.ExpiresAt = time.Now().Add(ttl)
+			if err := tx.Save(&existing).Error; err != nil {
+				return err
+			}
+			lock = existing
+			return nil
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			lock = models.FileLock{
+				FileID:     fileID,
+				LockedByID: userID,
+				Reason:     reason,
+				ExpiresAt:  time.Now().Add(ttl),
+			}
+			return tx.Create(&lock).Error
+		default:
+			return err
+		}
+	})
+	if err != nil && !errors.Is(err, ErrFileLocked) {
+		return nil, err
+	}
+
+	s.DB.WithContext(ctx).Preload("LockedBy").First(&lock, "id = ?", lock.ID)
+	return &lock, err
+}
+
+// Release drops the lock on fileID. Only the holder may release an active
+// lock unless force is set (owners and admins break stale locks this way).
+// Releasing a file that isn't locked is not an error.
+func (s *LockService) Release(ctx context.Context, fileID, userID uuid.UUID, force bool) error {
+	lock, err := s.ActiveLock(ctx, fileID)
+	if err != nil {
+		return err
+	}
+	if lock != nil && lock.LockedByID != userID && !force {
+		return ErrLockNotHeld
+	}
+	return s.DB.WithContext(ctx).Unscoped().Where("file_id = ?", fileID).Delete(&models.FileLock{}).Error
+}
+
+// ActiveLock returns the unexpired lock on fileID, or nil if there is none.
+func (s *LockService) ActiveLock(ctx context.Context, fileID uuid.UUID) (*models.FileLock, error) {
+	var lock models.FileLock
+	err := s.DB.WithContext(ctx).Preload("LockedBy").
+		Where("file_id = ? AND expires_at > ?", fileID, time.Now()).
+		First(&lock).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+// CheckWritable returns ErrFileLocked, with the blocking lock, when someone
+// other than userID holds an active lock on fileID.
+func (s *LockService) CheckWritable(ctx context.Context, fileID, userID uuid.UUID) (*models.FileLock, error) {
+	lock, err := s.ActiveLock(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if lock != nil && lock.LockedByID != userID {
+		return lock, ErrFileLocked
+	}
+	return nil, nil
+}
+
+// AttachLocks sets the Lock field on each file that has an active lock.
+func (s *LockService) AttachLocks(ctx context.Context, files []models.File) {
+	if len(files) == 0 {
+		return
+	}
+	ids := make([]uuid.UUID, len(files))
+	for i, f := range files {
+		ids[i] = f.ID
+	}
+
+	var locks []models.FileLock
+	if err := s.DB.WithContext(ctx).Preload("LockedBy").
+		Where("file_id IN ? AND expires_at > ?", ids, time.Now()).
+		Find(&locks).Error; err != nil {
+		return
+	}
+
+	byFile := make(map[uuid.UUID]*models.FileLock, len(locks))
+	for i := range locks {
+		byFile[locks[i].FileID] = &locks[i]
+	}
+	for i := range files {
+		files[i].Lock = byFile[files[i].ID]
+	}
+}
+
+// CleanupExpiredLocks hard-deletes locks whose TTL has passed.
+func CleanupExpiredLocks(db *gorm.DB) error {
+	return db.Unscoped().Where("expires_at < ?", time.Now()).Delete(&models.FileLock{}).Error
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func setupLockTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.File{}, &models.FileLock{}); err != nil {
+		t.Fatalf("failed automigrating models: %v", err)
+	}
+	return db
+}
+
+func TestLockService_AcquireAndRelease(t *testing.T) {
+	db := setupLockTestDB(t)
+	service := NewLockService(db)
+	ctx := context.Background()
+
+	fileID := uuid.New()
+	alice, bob := uuid.New(), uuid.New()
+
+	lock, err := service.Acquire(ctx, fileID, alice, time.Minute, "editing")
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	firstExpiry := lock.ExpiresAt
+
+	held, err := service.Acquire(ctx, fileID, bob, time.Minute, "")
+	if !errors.Is(err, ErrFileLocked) {
+		t.Fatalf("expected ErrFileLocked, got %v", err)
+	}
+	if held.LockedByID != alice {
+		t.Fatalf("expected conflicting lock to report alice as holder")
+	}
+
+	refreshed, err := service.Acquire(ctx, fileID, alice, time.Hour, "still editing")
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if !refreshed.ExpiresAt.After(firstExpiry) || refreshed.ID != lock.ID {
+		t.Fatalf("expected refresh to extend the existing lock")
+	}
+
+	if _, err := service.CheckWritable(ctx, fileID, bob); !errors.Is(err, ErrFileLocked) {
+		t.Fatalf("expected bob to be blocked, got %v", err)
+	}
+	if _, err := service.CheckWritable(ctx, fileID, alice); err != nil {
+		t.Fatalf("expected holder to be allowed, got %v", err)
+	}
+
+	if err := service.Release(ctx, fileID, bob, false); !errors.Is(err, ErrLockNotHeld) {
+		t.Fatalf("expected ErrLockNotHeld, got %v", err)
+	}
+	if err := service.Release(ctx, fileID, bob, true); err != nil {
+		t.Fatalf("forced release failed: %v", err)
+	}
+
+	if _, err := service.Acquire(ctx, fileID, bob, time.Minute, ""); err != nil {
+		t.Fatalf("expected bob to lock after release, got %v", err)
+	}
+}
+
+func TestLockService_ExpiredLocks(t *testing.T) {
+	db := setupLockTestDB(t)
+	service := NewLockService(db)
+	ctx := context.Background()
+
+	fileID := uuid.New()
+	alice, bob := uuid.New(), uuid.New()
+
+	if _, err := service.Acquire(ctx, fileID, alice, time.Minute, ""); err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	db.Model(&models.FileLock{}).Where("file_id = ?", fileID).Update("expires_at", time.Now().Add(-time.Second))
+
+	if lock, err := service.ActiveLock(ctx, fileID); err != nil || lock != nil {
+		t.Fatalf("expected expired lock to be inactive, got %v, %v", lock, err)
+	}
+	if lock, err := service.Acquire(ctx, fileID, bob, time.Minute, ""); err != nil || lock.LockedByID != bob {
+		t.Fatalf("expected bob to take over expired lock, got %v", err)
+	}
+
+	db.Model(&models.FileLock{}).Where("file_id = ?", fileID).Update("expires_at", time.Now().Add(-time.Second))
+	CleanupExpiredLocks(db)
+	var count int64
+	db.Unscoped().Model(&models.FileLock{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected cleanup to hard-delete expired locks, %d remain", count)
+	}
+}
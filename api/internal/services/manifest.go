@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/storage"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/hkdf"
+	"gorm.io/gorm"
+)
+
+const (
+	ManifestVersion            = 1
+	ManifestSignatureAlgorithm = "ed25519"
+	// MaxManifestEntries bounds a single manifest so a request cannot make
+	// the server hash an unbounded number of objects.
+	MaxManifestEntries = 10000
+
+	manifestKeySalt = "docshare-manifest-signing"
+)
+
+var (
+	ErrManifestTooLarge       = errors.New("folder has too many entries for a manifest")
+	ErrChecksumUnavailable    = errors.New("checksum unavailable")
+	ErrInvalidManifestKey     = errors.New("manifest signing key must be a base64 Ed25519 seed or private key")
+	ErrManifestSignatureCheck = errors.New("manifest signature does not verify")
+)
+
+// ManifestEntry describes one file or folder below the manifest root. Path
+// is slash-separated and relative to the root folder.
+type ManifestEntry struct {
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256,omitempty"`
+	IsDirectory bool   `json:"isDirectory"`
+}
+
+type Manifest struct {
+	Version     int             `json:"version"`
+	RootID      uuid.UUID       `json:"rootID"`
+	RootName    string          `json:"rootName"`
+	GeneratedAt time.Time       `json:"generatedAt"`
+	GeneratedBy uuid.UUID       `json:"generatedBy"`
+	FileCount   int             `json:"fileCount"`
+	TotalSize   int64           `json:"totalSize"`
+	Entries     []ManifestEntry `json:"entries"`
+}
+
+// SignedManifest is what clients receive. Signature covers the exact bytes
+// in Payload (base64 of the manifest's JSON encoding); Manifest is the same
+// document decoded for convenience. Verifiers should check the signature
+// against Payload rather than re-serialising Manifest.
+type SignedManifest struct {
+	Manifest  Manifest `json:"manifest"`
+	Payload   string   `json:"payload"`
+	Signature string   `json:"signature"`
+	Algorithm string   `json:"algorithm"`
+	KeyID     string   `json:"keyID"`
+}
+
+// ManifestService builds and signs folder manifests.
+type ManifestService struct {
+	DB      *gorm.DB
+	Storage *storage.S3Client
+	key     ed25519.PrivateKey
+	keyID   string
+}
+
+// NewManifestService loads the signing key from cfg. When no key is
+// configured it derives one from fallbackSecret, which keeps signatures
+// stable across restarts as long as the JWT secret does not change.
+func NewManifestService(db *gorm.DB, storageClient *storage.S3Client, cfg config.ManifestConfig, fallbackSecret string) (*ManifestService, error) {
+	key, err := loadManifestKey(cfg.SigningKey, fallbackSecret)
+	if err != nil {
+		return nil, err
+	}
+	keyID := cfg.KeyID
+	if keyID == "" {
+		sum := sha256.Sum256(key.Public().(ed25519.PublicKey))
+		keyID = hex.EncodeToString(sum[:8])
+	}
+	return &ManifestService{DB: db, Storage: storageClient, key: key, keyID: keyID}, nil
+}
+
+func loadManifestKey(encoded, fallbackSecret string) (ed25519.PrivateKey, error) {
+	if encoded == "" {
+		seed := make([]byte, ed25519.SeedSize)
+		reader := hkdf.New(sha256.New, []byte(fallbackSecret), []byte(manifestKeySalt), []byte("ed25519-seed"))
+		if _, err := io.ReadFull(reader, seed); err != nil {
+			return nil, fmt.Errorf("deriving manifest key: %w", err)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidManifestKey
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	default:
+		return nil, ErrInvalidManifestKey
+	}
+}
+
+func (s *ManifestService) KeyID() string {
+	return s.keyID
+}
+
+func (s *ManifestService) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+type manifestRow struct {
+	ID          uuid.UUID
+	ParentID    *uuid.UUID
+	Name        string
+	Size        int64
+	IsDirectory bool
+	StoragePath string
+	Checksum    *string
+}
+
+// Build walks the folder tree under root and returns a signed manifest.
+func (s *ManifestService) Build(ctx context.Context, root models.File, requestedBy uuid.UUID) (*SignedManifest, error) {
+	entries, err := s.Entries(ctx, root.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := Manifest{
+		Version:     ManifestVersion,
+		RootID:      root.ID,
+		RootName:    root.Name,
+		GeneratedAt: time.Now().UTC().Truncate(time.Second),
+		GeneratedBy: requestedBy,
+		Entries:     entries,
+	}
+	for _, entry := range entries {
+		if !entry.IsDirectory {
+			manifest.FileCount++
+			manifest.TotalSize += entry.Size
+		}
+	}
+
+	return s.Sign(manifest)
+}
+
+// Entries lists every file and folder below rootID, sorted by path. Files
+// uploaded through presigned URLs have no recorded checksum yet; those are
+// hashed from storage here and the result is persisted.
+func (s *ManifestService) Entries(ctx context.Context, rootID uuid.UUID) ([]ManifestEntry, error) {
+	var rows []manifestRow
+	if err := s.DB.WithContext(ctx).Raw(`
+		WITH RECURSIVE tree AS (
+			SELECT id, parent_id, name, size, is_directory, storage_path, checksum
+			FROM files WHERE parent_id = ? AND deleted_at IS NULL
+			UNION ALL
+			SELECT f.id, f.parent_id, f.name, f.size, f.is_directory, f.storage_path, f.checksum
+			FROM files f
+			INNER JOIN tree t ON f.parent_id = t.id
+			WHERE f.deleted_at IS NULL
+		)
+		SELECT * FROM tree LIMIT ?
+	`, rootID, MaxManifestEntries+1).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) > MaxManifestEntries {
+		return nil, ErrManifestTooLarge
+	}
+
+	byID := make(map[uuid.UUID]*manifestRow, len(rows))
+	for i := range rows {
+		byID[rows[i].ID] = &rows[i]
+	}
+	paths := make(map[uuid.UUID]string, len(rows))
+	var pathOf func(r *manifestRow) string
+	pathOf = func(r *manifestRow) string {
+		if p, ok := paths[r.ID]; ok {
+			return p
+		}
+		p := r.Name
+		if r.ParentID != nil && *r.ParentID != rootID {
+			if parent, ok := byID[*r.ParentID]; ok {
+				p = pathOf(parent) + "/" + r.Name
+			}
+		}
+		paths[r.ID] = p
+		return p
+	}
+
+	entries := make([]ManifestEntry, 0, len(rows))
+	for i := range rows {
+		r := &rows[i]
+		entry := ManifestEntry{Path: pathOf(r), IsDirectory: r.IsDirectory}
+		if !r.IsDirectory {
+			checksum, err := s.ensureChecksum(ctx, r)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", entry.Path, err)
+			}
+			entry.Size = r.Size
+			entry.SHA256 = checksum
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, nil
+}
+
+func (s *ManifestService) ensureChecksum(ctx context.Context, r *manifestRow) (string, error) {
+	if r.Checksum != nil && *r.Checksum != "" {
+		return *r.Checksum, nil
+	}
+	if s.Storage == nil {
+		return "", ErrChecksumUnavailable
+	}
+	obj, err := s.Storage.Download(ctx, r.StoragePath)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrChecksumUnavailable, err)
+	}
+	defer obj.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, obj); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrChecksumUnavailable, err)
+	}
+	checksum := hex.EncodeToString(hasher.Sum(nil))
+	// UpdateColumn leaves updated_at alone: recording a digest does not
+	// change the file, and bumping it would invalidate cached ETags.
+	if err := s.DB.WithContext(ctx).Model(&models.File{}).Where("id = ?", r.ID).UpdateColumn("checksum", checksum).Error; err != nil {
+		return "", err
+	}
+	return checksum, nil
+}
+
+// Sign serialises manifest and signs the resulting bytes.
+func (s *ManifestService) Sign(manifest Manifest) (*SignedManifest, error) {
+	payload, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedManifest{
+		Manifest:  manifest,
+		Payload:   base64.StdEncoding.EncodeToString(payload),
+		Signature: s.SignPayload(payload),
+		Algorithm: ManifestSignatureAlgorithm,
+		KeyID:     s.keyID,
+	}, nil
+}
+
+// SignPayload returns the base64 signature of payload, for documents other
+// than folder manifests that are signed with the same key.
+func (s *ManifestService) SignPayload(payload []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, payload))
+}
+
+// Verify checks a signed manifest against this server's public key.
+func (s *ManifestService) Verify(signed *SignedManifest) error {
+	payload, err := base64.StdEncoding.DecodeString(signed.Payload)
+	if err != nil {
+		return ErrManifestSignatureCheck
+	}
+	sig, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return ErrManifestSignatureCheck
+	}
+	if !ed25519.Verify(s.PublicKey(), payload, sig) {
+		return ErrManifestSignatureCheck
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func setupManifestTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.File{}); err != nil {
+		t.Fatalf("failed automigrating models: %v", err)
+	}
+	return db
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestNewManifestService_Keys(t *testing.T) {
+	derivedA, err := NewManifestService(nil, nil, config.ManifestConfig{}, "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	derivedB, _ := NewManifestService(nil, nil, config.ManifestConfig{}, "secret")
+	if !derivedA.PublicKey().Equal(derivedB.PublicKey()) || derivedA.KeyID() != derivedB.KeyID() {
+		t.Fatal("expected derived key to be stable for the same secret")
+	}
+	other, _ := NewManifestService(nil, nil, config.ManifestConfig{}, "other-secret")
+	if other.PublicKey().Equal(derivedA.PublicKey()) {
+		t.Fatal("expected different secrets to derive different keys")
+	}
+
+	seed := make([]byte, ed25519.SeedSize)
+	seed[0] = 7
+	configured, err := NewManifestService(nil, nil, config.ManifestConfig{
+		SigningKey: base64.StdEncoding.EncodeToString(seed),
+		KeyID:      "prod-2026",
+	}, "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !configured.PublicKey().Equal(ed25519.NewKeyFromSeed(seed).Public()) {
+		t.Fatal("expected configured seed to be used")
+	}
+	if configured.KeyID() != "prod-2026" {
+		t.Fatalf("expected configured key id, got %q", configured.KeyID())
+	}
+
+	if _, err := NewManifestService(nil, nil, config.ManifestConfig{SigningKey: "c2hvcnQ="}, "secret"); !errors.Is(err, ErrInvalidManifestKey) {
+		t.Fatalf("expected ErrInvalidManifestKey, got %v", err)
+	}
+}
+
+func TestManifestService_Build(t *testing.T) {
+	db := setupManifestTestDB(t)
+	service, err := NewManifestService(db, nil, config.ManifestConfig{}, "secret")
+	if err != nil {
+		t.Fatalf("failed creating service: %v", err)
+	}
+	ctx := context.Background()
+	owner := uuid.New()
+
+	checksum := func(s string) *string {
+		v := sha256Hex(s)
+		return &v
+	}
+	root := models.File{Name: "release", MimeType: "inode/directory", IsDirectory: true, OwnerID: owner, StoragePath: ""}
+	db.Create(&root)
+	docs := models.File{Name: "docs", MimeType: "inode/directory", IsDirectory: true, ParentID: &root.ID, OwnerID: owner, StoragePath: ""}
+	db.Create(&docs)
+	readme := models.File{Name: "README.md", MimeType: "text/markdown", Size: 5, ParentID: &root.ID, OwnerID: owner, StoragePath: "r", Checksum: checksum("hello")}
+	db.Create(&readme)
+	guide := models.File{Name: "guide.pdf", MimeType: "application/pdf", Size: 3, ParentID: &docs.ID, OwnerID: owner, StoragePath: "g", Checksum: checksum("pdf")}
+	db.Create(&guide)
+	outside := models.File{Name: "outside.txt", MimeType: "text/plain", Size: 1, OwnerID: owner, StoragePath: "o", Checksum: checksum("x")}
+	db.Create(&outside)
+
+	signed, err := service.Build(ctx, root, owner)
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	m := signed.Manifest
+	if m.RootID != root.ID || m.RootName != "release" || m.FileCount != 2 || m.TotalSize != 8 {
+		t.Fatalf("unexpected manifest header: %+v", m)
+	}
+	want := []ManifestEntry{
+		{Path: "README.md", Size: 5, SHA256: sha256Hex("hello")},
+		{Path: "docs", IsDirectory: true},
+		{Path: "docs/guide.pdf", Size: 3, SHA256: sha256Hex("pdf")},
+	}
+	if len(m.Entries) != len(want) {
+		t.Fatalf("expected %d entries, got %+v", len(want), m.Entries)
+	}
+	for i := range want {
+		if m.Entries[i] != want[i] {
+			t.Fatalf("entry %d: expected %+v, got %+v", i, want[i], m.Entries[i])
+		}
+	}
+
+	if signed.Algorithm != ManifestSignatureAlgorithm || signed.KeyID != service.KeyID() {
+		t.Fatalf("unexpected signature metadata: %s %s", signed.Algorithm, signed.KeyID)
+	}
+	if err := service.Verify(signed); err != nil {
+		t.Fatalf("expected signature to verify: %v", err)
+	}
+	payload, _ := base64.StdEncoding.DecodeString(signed.Payload)
+	var decoded Manifest
+	if err := json.Unmarshal(payload, &decoded); err != nil || decoded.RootID != root.ID || len(decoded.Entries) != 3 {
+		t.Fatalf("expected payload to carry the manifest, got %+v (%v)", decoded, err)
+	}
+
+	tampered := *signed
+	tampered.Payload = base64.StdEncoding.EncodeToString(append(payload[:len(payload)-1], ' '))
+	if err := service.Verify(&tampered); !errors.Is(err, ErrManifestSignatureCheck) {
+		t.Fatalf("expected tampered payload to fail verification, got %v", err)
+	}
+}
+
+func TestManifestService_BuildMissingChecksumWithoutStorage(t *testing.T) {
+	db := setupManifestTestDB(t)
+	service, _ := NewManifestService(db, nil, config.ManifestConfig{}, "secret")
+	owner := uuid.New()
+
+	root := models.File{Name: "inbox", MimeType: "inode/directory", IsDirectory: true, OwnerID: owner}
+	db.Create(&root)
+	db.Create(&models.File{Name: "presigned.bin", MimeType: "application/octet-stream", Size: 10, ParentID: &root.ID, OwnerID: owner, StoragePath: "p"})
+
+	if _, err := service.Build(context.Background(), root, owner); !errors.Is(err, ErrChecksumUnavailable) {
+		t.Fatalf("expected ErrChecksumUnavailable, got %v", err)
+	}
+}
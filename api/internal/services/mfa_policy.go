@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"gorm.io/gorm"
+)
+
+// MFAPolicy decides whether a user has to enroll in MFA. The server-wide
+// requirement applies unless the user's organization sets its own.
+type MFAPolicy struct {
+	DB          *gorm.DB
+	Requirement models.MFARequirement
+	GracePeriod time.Duration
+}
+
+// MFAPolicyStatus is the outcome of the policy for one user. Restricted
+// users are past their grace period and may only reach the MFA enrollment
+// endpoints.
+type MFAPolicyStatus struct {
+	Requirement models.MFARequirement `json:"requirement"`
+	Required    bool                  `json:"required"`
+	Enrolled    bool                  `json:"enrolled"`
+	GraceEndsAt *time.Time            `json:"graceEndsAt,omitempty"`
+	Restricted  bool                  `json:"restricted"`
+}
+
+func NewMFAPolicy(db *gorm.DB, cfg config.MFAConfig) (*MFAPolicy, error) {
+	requirement := models.MFARequirement(cfg.Required)
+	if requirement == "" {
+		requirement = models.MFARequirementNone
+	}
+	if !requirement.Valid() {
+		return nil, fmt.Errorf("MFA_REQUIRED must be none, admins or all, got %q", cfg.Required)
+	}
+	return &MFAPolicy{DB: db, Requirement: requirement, GracePeriod: cfg.GracePeriod}, nil
+}
+
+// Evaluate applies the policy to user, a member of org (nil for the default
+// tenant). The grace period of a user the policy applies to starts the first
+// time it is evaluated for them.
+func (p *MFAPolicy) Evaluate(ctx context.Context, user *models.User, org *models.Organization) (*MFAPolicyStatus, error) {
+	status := &MFAPolicyStatus{Requirement: p.Requirement}
+	if org != nil && org.MFARequirement != "" {
+		status.Requirement = org.MFARequirement
+	}
+	status.Required = status.Requirement == models.MFARequirementAll ||
+		(status.Requirement == models.MFARequirementAdmins && user.Role.IsAdministrative())
+	if !status.Required {
+		return status, nil
+	}
+
+	db := p.DB.WithContext(ctx)
+	enrolled, err := mfaEnrolled(db, user)
+	if err != nil {
+		return nil, err
+	}
+	status.Enrolled = enrolled
+	if enrolled {
+		return status, nil
+	}
+
+	if user.MFAGraceStartedAt == nil {
+		now := time.Now()
+		if err := db.Model(&models.User{}).
+			Where("id = ? AND mfa_grace_started_at IS NULL", user.ID).
+			Update("mfa_grace_started_at", now).Error; err != nil {
+			return nil, err
+		}
+		user.MFAGraceStartedAt = &now
+	}
+	graceEndsAt := user.MFAGraceStartedAt.Add(p.GracePeriod)
+	status.GraceEndsAt = &graceEndsAt
+	status.Restricted = !time.Now().Before(graceEndsAt)
+	return status, nil
+}
+
+func mfaEnrolled(db *gorm.DB, user *models.User) (bool, error) {
+	var totpCount int64
+	if err := db.Model(&models.MFAConfig{}).
+		Where("user_id = ? AND totp_enabled = ?", user.ID, true).
+		Count(&totpCount).Error; err != nil {
+		return false, err
+	}
+	if totpCount > 0 {
+		return true, nil
+	}
+	var credCount int64
+	if err := db.Model(&models.WebAuthnCredential{}).Where("user_id = ?", user.ID).Count(&credCount).Error; err != nil {
+		return false, err
+	}
+	return credCount > 0, nil
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestMFAPolicy(t *testing.T) {
+	db := setupAuditTestDB(t)
+	if err := db.AutoMigrate(&models.MFAConfig{}, &models.WebAuthnCredential{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := NewMFAPolicy(db, config.MFAConfig{Required: "sometimes"}); err == nil {
+		t.Fatal("expected an invalid requirement to be rejected")
+	}
+
+	policy, err := NewMFAPolicy(db, config.MFAConfig{Required: "admins", GracePeriod: time.Hour})
+	if err != nil {
+		t.Fatalf("NewMFAPolicy: %v", err)
+	}
+
+	newUser := func(role models.UserRole) *models.User {
+		user := &models.User{Email: uuid.NewString() + "@test.com", PasswordHash: "x", FirstName: "M", LastName: "P", Role: role}
+		if err := db.Create(user).Error; err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		return user
+	}
+
+	t.Run("admins only", func(t *testing.T) {
+		status, err := policy.Evaluate(ctx, newUser(models.UserRoleUser), nil)
+		if err != nil || status.Required {
+			t.Fatalf("expected regular users to be exempt, got %+v (%v)", status, err)
+		}
+
+		admin := newUser(models.UserRoleAdmin)
+		status, err = policy.Evaluate(ctx, admin, nil)
+		if err != nil {
+			t.Fatalf("Evaluate: %v", err)
+		}
+		if !status.Required || status.Restricted || status.GraceEndsAt == nil {
+			t.Fatalf("expected an admin in their grace period, got %+v", status)
+		}
+
+		var stored models.User
+		db.First(&stored, "id = ?", admin.ID)
+		if stored.MFAGraceStartedAt == nil {
+			t.Fatal("expected the grace period start to be stored")
+		}
+	})
+
+	t.Run("restricted after the grace period until enrolled", func(t *testing.T) {
+		admin := newUser(models.UserRoleAdmin)
+		started := time.Now().Add(-2 * time.Hour)
+		admin.MFAGraceStartedAt = &started
+
+		status, _ := policy.Evaluate(ctx, admin, nil)
+		if !status.Restricted {
+			t.Fatalf("expected restriction after the grace period, got %+v", status)
+		}
+
+		db.Create(&models.MFAConfig{UserID: admin.ID, TOTPEnabled: true})
+		status, _ = policy.Evaluate(ctx, admin, nil)
+		if !status.Enrolled || status.Restricted {
+			t.Fatalf("expected an enrolled admin to pass, got %+v", status)
+		}
+	})
+
+	t.Run("organization overrides the server", func(t *testing.T) {
+		org := &models.Organization{MFARequirement: models.MFARequirementAll}
+		status, _ := policy.Evaluate(ctx, newUser(models.UserRoleUser), org)
+		if status.Requirement != models.MFARequirementAll || !status.Required {
+			t.Fatalf("expected the organization requirement to apply, got %+v", status)
+		}
+
+		org.MFARequirement = models.MFARequirementNone
+		status, _ = policy.Evaluate(ctx, newUser(models.UserRoleAdmin), org)
+		if status.Required {
+			t.Fatalf("expected the organization to waive the requirement, got %+v", status)
+		}
+	})
+}
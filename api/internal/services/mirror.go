@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/storage"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	mirrorObjectJob   = "mirror.object"
+	mirrorBackfillJob = "mirror.backfill"
+	// mirrorStagingPrefix holds direct uploads that have not been
+	// finalized yet; they are never mirrored.
+	mirrorStagingPrefix = "uploads/"
+)
+
+// mirrorEvents are the outbox events that write or remove file objects.
+var mirrorEvents = map[string]bool{
+	"file.upload": true,
+	"file.create": true,
+	"file.edit":   true,
+	"file.delete": true,
+}
+
+// MirrorBucket is one side of a mirror.
+type MirrorBucket interface {
+	Stat(ctx context.Context, key string) (storage.ObjectInfo, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Upload(ctx context.Context, objectName string, reader io.Reader, size int64, contentType string) error
+	Delete(ctx context.Context, objectName string) error
+	ListObjects(ctx context.Context, prefix, startAfter string, fn func(storage.ObjectInfo) error) error
+}
+
+// S3MirrorBucket adapts a storage client to MirrorBucket. It also serves as
+// the TransferStore for relayed transfers and the ArchiveStore archives are
+// extracted from.
+type S3MirrorBucket struct {
+	*storage.S3Client
+}
+
+func (b S3MirrorBucket) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return b.Download(ctx, key)
+}
+
+func (b S3MirrorBucket) OpenArchive(ctx context.Context, key string) (ArchiveObject, error) {
+	obj, err := b.Download(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// StorageMirror keeps a second bucket in step with the primary one. File
+// events from the outbox queue one mirror.object job per affected key; the
+// job compares the key in both buckets and copies it, or removes it from
+// the mirror when the primary no longer has it and deletes are mirrored.
+// Because the job looks at the buckets rather than at the event, jobs for
+// the same key can run in any order and still converge. Objects written
+// without an event, such as previews and imported files, are picked up by
+// a backfill.
+type StorageMirror struct {
+	DB      *gorm.DB
+	Source  MirrorBucket
+	Target  MirrorBucket
+	Jobs    *JobRunner
+	Deletes bool
+
+	copied  atomic.Int64
+	deleted atomic.Int64
+}
+
+func NewStorageMirror(db *gorm.DB, source, target MirrorBucket, jobs *JobRunner, deletes bool) *StorageMirror {
+	m := &StorageMirror{DB: db, Source: source, Target: target, Jobs: jobs, Deletes: deletes}
+	jobs.Register(mirrorObjectJob, m.runObject, JobOptions{})
+	jobs.Register(mirrorBackfillJob, m.runBackfill, JobOptions{MaxAttempts: 1})
+	return m
+}
+
+func (m *StorageMirror) Name() string {
+	return "storage_mirror"
+}
+
+// HandleEvent queues the objects a file event touched. A delete covers the
+// whole deleted subtree, since only its root gets an event.
+func (m *StorageMirror) HandleEvent(ctx context.Context, event models.OutboxEvent) error {
+	if event.ResourceType != "file" || event.ResourceID == nil || !mirrorEvents[event.EventType] {
+		return nil
+	}
+	keys, err := m.eventKeys(ctx, *event.ResourceID)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := m.enqueue(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *StorageMirror) eventKeys(ctx context.Context, fileID uuid.UUID) ([]string, error) {
+	db := m.DB.WithContext(ctx).Unscoped().Session(&gorm.Session{})
+	var file models.File
+	if err := db.Select("id", "is_directory", "storage_path", "thumbnail_path", "deleted_at").
+		First(&file, "id = ?", fileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var keys []string
+	add := func(f models.File) {
+		if f.StoragePath != "" {
+			keys = append(keys, f.StoragePath)
+		}
+		if f.ThumbnailPath != nil && *f.ThumbnailPath != "" {
+			keys = append(keys, *f.ThumbnailPath)
+		}
+	}
+	add(file)
+	if !file.IsDirectory || !file.DeletedAt.Valid {
+		return keys, nil
+	}
+
+	parents := []uuid.UUID{file.ID}
+	for len(parents) > 0 {
+		var children []models.File
+		if err := db.Select("id", "is_directory", "storage_path", "thumbnail_path").
+			Where("parent_id IN ? AND deleted_at IS NOT NULL", parents).
+			Find(&children).Error; err != nil {
+			return nil, err
+		}
+		parents = parents[:0]
+		for _, child := range children {
+			add(child)
+			if child.IsDirectory {
+				parents = append(parents, child.ID)
+			}
+		}
+	}
+	return keys, nil
+}
+
+func (m *StorageMirror) enqueue(ctx context.Context, key string) error {
+	_, err := m.Jobs.Enqueue(ctx, mirrorObjectJob, map[string]interface{}{"key": key}, EnqueueOptions{UniqueKey: "mirror:" + key})
+	return err
+}
+
+func (m *StorageMirror) runObject(ctx context.Context, job *models.Job) error {
+	key, _ := job.Payload["key"].(string)
+	if key == "" {
+		return errors.New("mirror job without a key")
+	}
+	return m.SyncObject(ctx, key)
+}
+
+// SyncObject makes the mirror's copy of key match the primary bucket.
+func (m *StorageMirror) SyncObject(ctx context.Context, key string) error {
+	src, err := m.Source.Stat(ctx, key)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		if !m.Deletes {
+			return nil
+		}
+		if _, err := m.Target.Stat(ctx, key); errors.Is(err, storage.ErrObjectNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := m.Target.Delete(ctx, key); err != nil {
+			return err
+		}
+		m.deleted.Add(1)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	dst, err := m.Target.Stat(ctx, key)
+	if err == nil && dst.Size == src.Size && !dst.LastModified.Before(src.LastModified) {
+		return nil
+	}
+	if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+		return err
+	}
+
+	reader, err := m.Source.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if err := m.Target.Upload(ctx, key, reader, src.Size, src.ContentType); err != nil {
+		return err
+	}
+	m.copied.Add(1)
+	return nil
+}
+
+// StartBackfill queues a backfill unless one is already waiting.
+func (m *StorageMirror) StartBackfill(ctx context.Context) (*models.Job, error) {
+	return m.Jobs.Enqueue(ctx, mirrorBackfillJob, nil, EnqueueOptions{UniqueKey: mirrorBackfillJob})
+}
+
+// runBackfill compares both buckets and queues a mirror.object job for
+// every key that differs: missing or stale in the mirror, or, when deletes
+// are mirrored, present only in the mirror. The target listing is kept in
+// memory.
+func (m *StorageMirror) runBackfill(ctx context.Context, _ *models.Job) error {
+	mirrored := map[string]storage.ObjectInfo{}
+	if err := m.Target.ListObjects(ctx, "", "", func(obj storage.ObjectInfo) error {
+		mirrored[obj.Key] = obj
+		return nil
+	}); err != nil {
+		return fmt.Errorf("listing mirror: %w", err)
+	}
+
+	var scanned, queued int64
+	err := m.Source.ListObjects(ctx, "", "", func(obj storage.ObjectInfo) error {
+		if strings.HasPrefix(obj.Key, mirrorStagingPrefix) {
+			return nil
+		}
+		scanned++
+		dst, ok := mirrored[obj.Key]
+		delete(mirrored, obj.Key)
+		if ok && dst.Size == obj.Size && !dst.LastModified.Before(obj.LastModified) {
+			return nil
+		}
+		queued++
+		return m.enqueue(ctx, obj.Key)
+	})
+	if err != nil {
+		return fmt.Errorf("listing bucket: %w", err)
+	}
+	if m.Deletes {
+		for key := range mirrored {
+			queued++
+			if err := m.enqueue(ctx, key); err != nil {
+				return err
+			}
+		}
+	}
+
+	logger.Info("storage_mirror_backfill_completed", map[string]interface{}{
+		"objects_scanned": scanned,
+		"objects_queued":  queued,
+	})
+	return nil
+}
+
+// MirrorStatus reports how far the mirror is behind. Lag is the age of the
+// oldest object still waiting to be mirrored.
+type MirrorStatus struct {
+	Enabled         bool        `json:"enabled"`
+	Deletes         bool        `json:"deletes"`
+	Pending         int64       `json:"pending"`
+	Failed          int64       `json:"failed"`
+	LagSeconds      int64       `json:"lagSeconds"`
+	OldestPendingAt *time.Time  `json:"oldestPendingAt,omitempty"`
+	LastMirroredAt  *time.Time  `json:"lastMirroredAt,omitempty"`
+	Copied          int64       `json:"copied"`
+	Deleted         int64       `json:"deleted"`
+	Backfill        *models.Job `json:"backfill,omitempty"`
+}
+
+// Status gathers the mirror's queue and counters. Copied and Deleted count
+// what this API instance has done since it started.
+func (m *StorageMirror) Status(ctx context.Context) (MirrorStatus, error) {
+	status := MirrorStatus{Enabled: true, Deletes: m.Deletes, Copied: m.copied.Load(), Deleted: m.deleted.Load()}
+	jobs := m.DB.WithContext(ctx).Model(&models.Job{}).Where("kind = ?", mirrorObjectJob).Session(&gorm.Session{})
+
+	waiting := []models.JobStatus{models.JobStatusPending, models.JobStatusRunning}
+	if err := jobs.Where("status IN ?", waiting).Count(&status.Pending).Error; err != nil {
+		return status, err
+	}
+	if err := jobs.Where("status = ?", models.JobStatusFailed).Count(&status.Failed).Error; err != nil {
+		return status, err
+	}
+
+	var oldest []models.Job
+	if err := jobs.Where("status IN ?", waiting).Order("created_at ASC").Limit(1).Find(&oldest).Error; err != nil {
+		return status, err
+	}
+	if len(oldest) > 0 {
+		at := oldest[0].CreatedAt.UTC()
+		status.OldestPendingAt = &at
+		status.LagSeconds = int64(time.Since(at) / time.Second)
+	}
+	var latest []models.Job
+	if err := jobs.Where("status = ?", models.JobStatusCompleted).Order("finished_at DESC").Limit(1).Find(&latest).Error; err != nil {
+		return status, err
+	}
+	if len(latest) > 0 {
+		status.LastMirroredAt = latest[0].FinishedAt
+	}
+
+	var backfills []models.Job
+	if err := m.DB.WithContext(ctx).Where("kind = ?", mirrorBackfillJob).Order("created_at DESC").Limit(1).Find(&backfills).Error; err != nil {
+		return status, err
+	}
+	if len(backfills) > 0 {
+		status.Backfill = &backfills[0]
+	}
+	return status, nil
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/storage"
+	"github.com/docshare/api/pkg/logger"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type memoryBucket struct {
+	objects map[string][]byte
+	info    map[string]storage.ObjectInfo
+	now     time.Time
+}
+
+func newMemoryBucket() *memoryBucket {
+	return &memoryBucket{objects: map[string][]byte{}, info: map[string]storage.ObjectInfo{}, now: time.Now()}
+}
+
+func (b *memoryBucket) Stat(_ context.Context, key string) (storage.ObjectInfo, error) {
+	info, ok := b.info[key]
+	if !ok {
+		return storage.ObjectInfo{}, storage.ErrObjectNotFound
+	}
+	return info, nil
+}
+
+func (b *memoryBucket) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	data, ok := b.objects[key]
+	if !ok {
+		return nil, storage.ErrObjectNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (b *memoryBucket) Upload(_ context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	b.now = b.now.Add(time.Second)
+	b.objects[key] = data
+	b.info[key] = storage.ObjectInfo{Key: key, Size: int64(len(data)), LastModified: b.now, ContentType: contentType}
+	return nil
+}
+
+func (b *memoryBucket) Delete(_ context.Context, key string) error {
+	delete(b.objects, key)
+	delete(b.info, key)
+	return nil
+}
+
+func (b *memoryBucket) ListObjects(_ context.Context, prefix, _ string, fn func(storage.ObjectInfo) error) error {
+	keys := make([]string, 0, len(b.info))
+	for key := range b.info {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := fn(b.info[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *memoryBucket) put(key, content string) {
+	_ = b.Upload(context.Background(), key, strings.NewReader(content), int64(len(content)), "text/plain")
+}
+
+func TestStorageMirror(t *testing.T) {
+	logger.Init()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.File{}, &models.Job{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+
+	owner := models.User{Email: "mirror@test.com", FirstName: "M", LastName: "R", PasswordHash: "x"}
+	db.Create(&owner)
+	folder := models.File{Name: "docs", MimeType: "inode/directory", IsDirectory: true, OwnerID: owner.ID}
+	db.Create(&folder)
+	file := models.File{Name: "a.txt", MimeType: "text/plain", OwnerID: owner.ID, ParentID: &folder.ID, StoragePath: "owner/a.txt"}
+	db.Create(&file)
+
+	source, target := newMemoryBucket(), newMemoryBucket()
+	source.put("owner/a.txt", "first")
+	jobs := NewJobRunner(db, config.JobsConfig{})
+	mirror := NewStorageMirror(db, source, target, jobs, false)
+	ctx := context.Background()
+
+	drain := func() {
+		t.Helper()
+		for {
+			ran, err := jobs.RunNext(ctx)
+			if err != nil {
+				t.Fatalf("mirror job failed: %v", err)
+			}
+			if !ran {
+				return
+			}
+		}
+	}
+	event := func(eventType string, f models.File) {
+		t.Helper()
+		if err := mirror.HandleEvent(ctx, models.OutboxEvent{EventType: eventType, ResourceType: "file", ResourceID: &f.ID}); err != nil {
+			t.Fatalf("failed handling %s: %v", eventType, err)
+		}
+	}
+
+	t.Run("copies uploads and edits", func(t *testing.T) {
+		event("file.upload", file)
+		event("file.upload", file)
+		var queued int64
+		db.Model(&models.Job{}).Where("kind = ? AND status = ?", "mirror.object", models.JobStatusPending).Count(&queued)
+		if queued != 1 {
+			t.Fatalf("expected one job per key, got %d", queued)
+		}
+		drain()
+		if string(target.objects["owner/a.txt"]) != "first" {
+			t.Fatalf("expected the object mirrored, got %q", target.objects["owner/a.txt"])
+		}
+
+		source.put("owner/a.txt", "edit")
+		event("file.edit", file)
+		drain()
+		if string(target.objects["owner/a.txt"]) != "edit" {
+			t.Fatalf("expected the edit mirrored, got %q", target.objects["owner/a.txt"])
+		}
+		if mirror.copied.Load() != 2 {
+			t.Fatalf("expected two copies, got %d", mirror.copied.Load())
+		}
+	})
+
+	t.Run("keeps deletes unless configured", func(t *testing.T) {
+		_ = source.Delete(ctx, "owner/a.txt")
+		db.Delete(&models.File{}, "id = ?", file.ID)
+		db.Delete(&models.File{}, "id = ?", folder.ID)
+		event("file.delete", folder)
+		drain()
+		if _, ok := target.objects["owner/a.txt"]; !ok {
+			t.Fatal("expected the mirror to keep the deleted object")
+		}
+
+		mirror.Deletes = true
+		event("file.delete", folder)
+		drain()
+		if _, ok := target.objects["owner/a.txt"]; ok {
+			t.Fatal("expected the delete of the folder to reach its file")
+		}
+	})
+
+	t.Run("backfill", func(t *testing.T) {
+		source.put("owner/b.txt", "missing")
+		source.put("owner/previews/b.jpg", "preview")
+		source.put("uploads/owner/staged.bin", "staged")
+		target.put("owner/stale.txt", "gone from the primary")
+
+		if _, err := mirror.StartBackfill(ctx); err != nil {
+			t.Fatalf("failed queueing backfill: %v", err)
+		}
+		drain()
+		if _, ok := target.objects["owner/b.txt"]; !ok {
+			t.Fatal("expected the missing object copied")
+		}
+		if _, ok := target.objects["owner/previews/b.jpg"]; !ok {
+			t.Fatal("expected the preview copied")
+		}
+		if _, ok := target.objects["uploads/owner/staged.bin"]; ok {
+			t.Fatal("expected staged uploads skipped")
+		}
+		if _, ok := target.objects["owner/stale.txt"]; ok {
+			t.Fatal("expected objects only in the mirror removed")
+		}
+
+		status, err := mirror.Status(ctx)
+		if err != nil {
+			t.Fatalf("failed loading status: %v", err)
+		}
+		if status.Pending != 0 || status.LastMirroredAt == nil || status.Backfill == nil || status.Backfill.Status != models.JobStatusCompleted {
+			t.Fatalf("unexpected status %+v", status)
+		}
+	})
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrReportNotFound     = errors.New("report not found")
+	ErrReportClosed       = errors.New("report has been dismissed")
+	ErrReportActioned     = errors.New("report has already been acted on")
+	ErrReportFileDeleted  = errors.New("the reported file has been deleted")
+	ErrInvalidReportState = errors.New("status must be open, reviewing or dismissed")
+	ErrCannotSuspendSelf  = errors.New("cannot suspend your own account")
+	ErrFileNotQuarantined = errors.New("file is not quarantined")
+
+	ErrInvalidModerationAction = errors.New("action must be disable_share, quarantine_file or suspend_owner")
+)
+
+// ModerationService works abuse reports through the queue and carries out
+// the actions admins take on them.
+type ModerationService struct {
+	DB *gorm.DB
+}
+
+func NewModerationService(db *gorm.DB) *ModerationService {
+	return &ModerationService{DB: db}
+}
+
+// Triage moves a report between open and reviewing, or dismisses it.
+// Reports that were acted on stay actioned.
+func (s *ModerationService) Triage(ctx context.Context, reportID uuid.UUID, status models.AbuseReportStatus, reviewerID uuid.UUID, resolution string) (*models.AbuseReport, error) {
+	switch status {
+	case models.AbuseReportStatusOpen, models.AbuseReportStatusReviewing, models.AbuseReportStatusDismissed:
+	default:
+		return nil, ErrInvalidReportState
+	}
+	report, err := s.load(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+	if report.Status == models.AbuseReportStatusActioned {
+		return nil, ErrReportActioned
+	}
+
+	now := time.Now().UTC()
+	report.Status = status
+	report.ReviewedByID = &reviewerID
+	report.ReviewedAt = &now
+	if resolution != "" {
+		report.Resolution = resolution
+	}
+	if err := s.DB.WithContext(ctx).Model(report).Updates(map[string]interface{}{
+		"status":         report.Status,
+		"reviewed_by_id": report.ReviewedByID,
+		"reviewed_at":    report.ReviewedAt,
+		"resolution":     report.Resolution,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Act carries out action on the file or share a report is about and marks
+// the report actioned. Several actions can be taken on the same report.
+func (s *ModerationService) Act(ctx context.Context, reportID uuid.UUID, action models.ModerationAction, reviewerID uuid.UUID, resolution string) (*models.AbuseReport, error) {
+	report, err := s.load(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+	if report.Status == models.AbuseReportStatusDismissed {
+		return nil, ErrReportClosed
+	}
+	if report.File.ID == uuid.Nil && action != models.ModerationActionDisableShare {
+		return nil, ErrReportFileDeleted
+	}
+
+	now := time.Now().UTC()
+	err = s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		switch action {
+		case models.ModerationActionDisableShare:
+			// The share may have been removed since the report; the link is
+			// dead either way.
+			if report.ShareID != nil {
+				if err := tx.Delete(&models.Share{}, "id = ?", *report.ShareID).Error; err != nil {
+					return err
+				}
+			}
+		case models.ModerationActionQuarantineFile:
+			if err := tx.Model(&models.File{}).
+				Where("id = ? AND quarantined_at IS NULL", report.FileID).
+				Update("quarantined_at", now).Error; err != nil {
+				return err
+			}
+		case models.ModerationActionSuspendOwner:
+			if report.File.OwnerID == reviewerID {
+				return ErrCannotSuspendSelf
+			}
+			if err := tx.Model(&models.User{}).
+				Where("id = ? AND status <> ?", report.File.OwnerID, models.UserStatusSuspended).
+				Updates(map[string]interface{}{
+					"status":              models.UserStatusSuspended,
+					"suspended_at":        now,
+					"suspension_reason":   "Suspended after a content report: " + string(report.Reason),
+					"sessions_revoked_at": now,
+				}).Error; err != nil {
+				return err
+			}
+		default:
+			return ErrInvalidModerationAction
+		}
+
+		report.Status = models.AbuseReportStatusActioned
+		report.Action = action
+		report.ReviewedByID = &reviewerID
+		report.ReviewedAt = &now
+		if resolution != "" {
+			report.Resolution = resolution
+		}
+		return tx.Model(report).Updates(map[string]interface{}{
+			"status":         report.Status,
+			"action":         report.Action,
+			"reviewed_by_id": report.ReviewedByID,
+			"reviewed_at":    report.ReviewedAt,
+			"resolution":     report.Resolution,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ReleaseFile lifts a quarantine.
+func (s *ModerationService) ReleaseFile(ctx context.Context, fileID uuid.UUID) (*models.File, error) {
+	var file models.File
+	if err := s.DB.WithContext(ctx).First(&file, "id = ?", fileID).Error; err != nil {
+		return nil, err
+	}
+	if file.QuarantinedAt == nil {
+		return nil, ErrFileNotQuarantined
+	}
+	if err := s.DB.WithContext(ctx).Model(&file).Update("quarantined_at", nil).Error; err != nil {
+		return nil, err
+	}
+	file.QuarantinedAt = nil
+	return &file, nil
+}
+
+func (s *ModerationService) load(ctx context.Context, reportID uuid.UUID) (*models.AbuseReport, error) {
+	var report models.AbuseReport
+	if err := s.DB.WithContext(ctx).Preload("File").First(&report, "id = ?", reportID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReportNotFound
+		}
+		return nil, err
+	}
+	return &report, nil
+}
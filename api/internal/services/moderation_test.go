@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupModerationTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.File{}, &models.Share{}, &models.AbuseReport{}); err != nil {
+		t.Fatalf("failed automigrating models: %v", err)
+	}
+	return db
+}
+
+func TestModerationService(t *testing.T) {
+	db := setupModerationTestDB(t)
+	service := NewModerationService(db)
+	ctx := context.Background()
+
+	owner := models.User{Email: "moderated@test.com", PasswordHash: "hash", Role: models.UserRoleUser}
+	admin := models.User{Email: "moderator@test.com", PasswordHash: "hash", Role: models.UserRoleAdmin}
+	db.Create(&owner)
+	db.Create(&admin)
+	file := models.File{Name: "flyer.pdf", MimeType: "application/pdf", OwnerID: owner.ID, StoragePath: "flyer.pdf"}
+	db.Create(&file)
+	share := models.Share{FileID: file.ID, SharedByID: owner.ID, ShareType: models.ShareTypePublicAnyone, Permission: models.SharePermissionDownload}
+	db.Create(&share)
+
+	newReport := func() models.AbuseReport {
+		report := models.AbuseReport{FileID: file.ID, ShareID: &share.ID, ReporterIP: "203.0.113.7", Reason: models.AbuseReasonPhishing, Status: models.AbuseReportStatusOpen}
+		db.Create(&report)
+		return report
+	}
+
+	t.Run("triage", func(t *testing.T) {
+		report := newReport()
+		got, err := service.Triage(ctx, report.ID, models.AbuseReportStatusReviewing, admin.ID, "")
+		if err != nil || got.Status != models.AbuseReportStatusReviewing || got.ReviewedByID == nil {
+			t.Fatalf("expected the report under review, got %+v, %v", got, err)
+		}
+		if _, err := service.Triage(ctx, report.ID, models.AbuseReportStatusActioned, admin.ID, ""); !errors.Is(err, ErrInvalidReportState) {
+			t.Fatalf("expected actioned to be refused, got %v", err)
+		}
+		if _, err := service.Triage(ctx, report.ID, models.AbuseReportStatusDismissed, admin.ID, "parody"); err != nil {
+			t.Fatalf("dismiss failed: %v", err)
+		}
+		if _, err := service.Act(ctx, report.ID, models.ModerationActionDisableShare, admin.ID, ""); !errors.Is(err, ErrReportClosed) {
+			t.Fatalf("expected a dismissed report to refuse actions, got %v", err)
+		}
+	})
+
+	t.Run("actions", func(t *testing.T) {
+		report := newReport()
+		if _, err := service.Act(ctx, report.ID, "delete_everything", admin.ID, ""); !errors.Is(err, ErrInvalidModerationAction) {
+			t.Fatalf("expected an unknown action to be refused, got %v", err)
+		}
+
+		got, err := service.Act(ctx, report.ID, models.ModerationActionDisableShare, admin.ID, "phishing page")
+		if err != nil || got.Status != models.AbuseReportStatusActioned || got.Action != models.ModerationActionDisableShare {
+			t.Fatalf("expected the report actioned, got %+v, %v", got, err)
+		}
+		var shares int64
+		db.Model(&models.Share{}).Where("id = ?", share.ID).Count(&shares)
+		if shares != 0 {
+			t.Fatal("expected the share disabled")
+		}
+
+		if _, err := service.Act(ctx, report.ID, models.ModerationActionQuarantineFile, admin.ID, ""); err != nil {
+			t.Fatalf("quarantine failed: %v", err)
+		}
+		if _, err := service.Act(ctx, report.ID, models.ModerationActionSuspendOwner, admin.ID, ""); err != nil {
+			t.Fatalf("suspend failed: %v", err)
+		}
+		db.First(&file, "id = ?", file.ID)
+		db.First(&owner, "id = ?", owner.ID)
+		if file.QuarantinedAt == nil || !owner.IsSuspended() {
+			t.Fatalf("expected the file quarantined and owner suspended, got %v and %s", file.QuarantinedAt, owner.Status)
+		}
+		if _, err := service.Triage(ctx, report.ID, models.AbuseReportStatusOpen, admin.ID, ""); !errors.Is(err, ErrReportActioned) {
+			t.Fatalf("expected an actioned report to stay closed, got %v", err)
+		}
+
+		if _, err := service.ReleaseFile(ctx, file.ID); err != nil {
+			t.Fatalf("release failed: %v", err)
+		}
+		if _, err := service.ReleaseFile(ctx, file.ID); !errors.Is(err, ErrFileNotQuarantined) {
+			t.Fatalf("expected a second release to fail, got %v", err)
+		}
+	})
+}
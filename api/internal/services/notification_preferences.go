@@ -0,0 +1,103 @@
+package services
+
+import (
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// NotificationActions are the actions whose activity a user can turn off.
+// Security notices and moderation outcomes are always delivered.
+var NotificationActions = []string{
+	"file.upload",
+	"file.download",
+	"file.update",
+	"file.delete",
+	"file.due_reminder",
+	"folder.create",
+	"share.create",
+	"share.update",
+	"share.delete",
+	"share.invitation_accept",
+	"group.member_add",
+	"group.member_remove",
+}
+
+// IsNotificationAction reports whether action is one of NotificationActions.
+func IsNotificationAction(action string) bool {
+	for _, a := range NotificationActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutMuted drops the activities whose recipient has turned the action
+// off, or muted the file they are about or a folder above it. The lookups
+// include deleted files, so a delete in a muted folder stays quiet. If the
+// preferences cannot be read the activities are kept.
+func (s *AuditService) withoutMuted(log models.AuditLog, activities []models.Activity) []models.Activity {
+	if len(activities) == 0 || !IsNotificationAction(log.Action) {
+		return activities
+	}
+
+	userIDs := make([]uuid.UUID, 0, len(activities))
+	fileIDs := make([]uuid.UUID, 0, 1)
+	seenFiles := map[uuid.UUID]bool{}
+	for _, a := range activities {
+		userIDs = append(userIDs, a.UserID)
+		if a.ResourceType == "file" && a.ResourceID != nil && !seenFiles[*a.ResourceID] {
+			seenFiles[*a.ResourceID] = true
+			fileIDs = append(fileIDs, *a.ResourceID)
+		}
+	}
+
+	silenced := map[uuid.UUID]bool{}
+	var off []uuid.UUID
+	if err := s.DB.Model(&models.NotificationPreference{}).
+		Where("user_id IN ? AND action = ? AND enabled = ?", userIDs, log.Action, false).
+		Pluck("user_id", &off).Error; err != nil {
+		logger.Error("notification_preferences_lookup_failed", err, map[string]interface{}{"action": log.Action})
+		return activities
+	}
+	for _, id := range off {
+		silenced[id] = true
+	}
+
+	// A single log names at most one file, so this is one query in practice.
+	mutedFor := map[uuid.UUID]map[uuid.UUID]bool{}
+	for _, fileID := range fileIDs {
+		var muted []uuid.UUID
+		if err := s.DB.Raw(`
+			WITH RECURSIVE ancestors AS (
+				SELECT id, parent_id FROM files WHERE id = @file
+				UNION ALL
+				SELECT f.id, f.parent_id FROM files f
+				INNER JOIN ancestors a ON f.id = a.parent_id
+			)
+			SELECT DISTINCT user_id FROM activity_mutes
+			WHERE user_id IN @users AND deleted_at IS NULL
+				AND file_id IN (SELECT id FROM ancestors)
+		`, map[string]interface{}{"file": fileID, "users": userIDs}).Scan(&muted).Error; err != nil {
+			logger.Error("activity_mutes_lookup_failed", err, map[string]interface{}{"action": log.Action})
+			return activities
+		}
+		mutedFor[fileID] = map[uuid.UUID]bool{}
+		for _, id := range muted {
+			mutedFor[fileID][id] = true
+		}
+	}
+
+	kept := activities[:0]
+	for _, a := range activities {
+		if silenced[a.UserID] {
+			continue
+		}
+		if a.ResourceType == "file" && a.ResourceID != nil && mutedFor[*a.ResourceID][a.UserID] {
+			continue
+		}
+		kept = append(kept, a)
+	}
+	return kept
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestAuditService_MutedActivities(t *testing.T) {
+	db := setupAuditTestDB(t)
+	service := NewAuditService(db, nil)
+
+	newUser := func(email string) uuid.UUID {
+		u := models.User{Email: email, PasswordHash: "hash", FirstName: "Test", LastName: "User", Role: models.UserRoleUser}
+		if err := db.Create(&u).Error; err != nil {
+			t.Fatalf("failed creating user: %v", err)
+		}
+		return u.ID
+	}
+	ownerID := newUser("mute-owner@test.com")
+	quietID := newUser("mute-quiet@test.com")
+	loudID := newUser("mute-loud@test.com")
+
+	folder := models.File{Name: "Busy", IsDirectory: true, OwnerID: ownerID}
+	db.Create(&folder)
+	sub := models.File{Name: "Sub", IsDirectory: true, OwnerID: ownerID, ParentID: &folder.ID}
+	db.Create(&sub)
+	file := models.File{Name: "notes.txt", OwnerID: ownerID, ParentID: &sub.ID}
+	db.Create(&file)
+
+	upload := models.AuditLog{UserID: &ownerID, Action: "file.upload", ResourceType: "file", ResourceID: &file.ID}
+	activitiesFor := func(log models.AuditLog) []models.Activity {
+		return []models.Activity{
+			{UserID: quietID, Action: log.Action, ResourceType: "file", ResourceID: log.ResourceID},
+			{UserID: loudID, Action: log.Action, ResourceType: "file", ResourceID: log.ResourceID},
+		}
+	}
+	recipients := func(activities []models.Activity) map[uuid.UUID]bool {
+		out := map[uuid.UUID]bool{}
+		for _, a := range activities {
+			out[a.UserID] = true
+		}
+		return out
+	}
+
+	if got := recipients(service.withoutMuted(upload, activitiesFor(upload))); !got[quietID] || !got[loudID] {
+		t.Fatalf("expected both recipients before muting, got %v", got)
+	}
+
+	t.Run("a muted ancestor folder silences files below it", func(t *testing.T) {
+		mute := models.ActivityMute{UserID: quietID, FileID: folder.ID}
+		db.Create(&mute)
+		defer db.Unscoped().Delete(&mute)
+
+		got := recipients(service.withoutMuted(upload, activitiesFor(upload)))
+		if got[quietID] || !got[loudID] {
+			t.Fatalf("expected only the unmuted recipient, got %v", got)
+		}
+
+		db.Delete(&file)
+		deleted := models.AuditLog{UserID: &ownerID, Action: "file.delete", ResourceType: "file", ResourceID: &file.ID}
+		got = recipients(service.withoutMuted(deleted, activitiesFor(deleted)))
+		if got[quietID] {
+			t.Fatal("expected a deleted file under a muted folder to stay muted")
+		}
+	})
+
+	t.Run("a disabled action is dropped for that user only", func(t *testing.T) {
+		db.Create(&models.NotificationPreference{UserID: quietID, Action: "file.download", Enabled: false})
+
+		download := models.AuditLog{UserID: &ownerID, Action: "file.download", ResourceType: "file", ResourceID: &sub.ID}
+		got := recipients(service.withoutMuted(download, activitiesFor(download)))
+		if got[quietID] || !got[loudID] {
+			t.Fatalf("expected only the recipient with downloads on, got %v", got)
+		}
+
+		other := models.AuditLog{UserID: &ownerID, Action: "folder.create", ResourceType: "file", ResourceID: &sub.ID}
+		if got := recipients(service.withoutMuted(other, activitiesFor(other))); !got[quietID] {
+			t.Fatal("expected other actions to be delivered")
+		}
+	})
+
+	t.Run("actions outside the preference list are always delivered", func(t *testing.T) {
+		db.Create(&models.ActivityMute{UserID: quietID, FileID: sub.ID})
+		notice := models.AuditLog{UserID: &ownerID, Action: "admin.report_action", ResourceType: "file", ResourceID: &sub.ID}
+		if got := recipients(service.withoutMuted(notice, activitiesFor(notice))); !got[quietID] {
+			t.Fatal("expected moderation activity to ignore mutes")
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrStorageQuotaExceeded = errors.New("organization storage quota exceeded")
+	ErrOrganizationMismatch = errors.New("account belongs to another organization")
+)
+
+// organizationSlugPattern matches slugs usable as a DNS label.
+var organizationSlugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ValidOrganizationSlug reports whether slug can name an organization.
+func ValidOrganizationSlug(slug string) bool {
+	return organizationSlugPattern.MatchString(slug)
+}
+
+// SameOrganization reports whether two organization IDs name the same
+// tenant, treating nil as the default tenant.
+func SameOrganization(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// OrganizationScope restricts a query on table to rows of one tenant.
+func OrganizationScope(table string, orgID *uuid.UUID) func(*gorm.DB) *gorm.DB {
+	column := table + ".organization_id"
+	return func(db *gorm.DB) *gorm.DB {
+		if orgID == nil {
+			return db.Where(column + " IS NULL")
+		}
+		return db.Where(column+" = ?", *orgID)
+	}
+}
+
+// OrganizationStorageUsed sums the size of the files stored by a tenant.
+func OrganizationStorageUsed(ctx context.Context, db *gorm.DB, orgID *uuid.UUID) (int64, error) {
+	var used int64
+	err := db.WithContext(ctx).
+		Model(&models.File{}).
+		Scopes(OrganizationScope("files", orgID)).
+		Where("is_directory = ?", false).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&used).Error
+	return used, err
+}
+
+// CheckStorageQuota returns ErrStorageQuotaExceeded when storing additional
+// bytes would take the tenant over its quota. The default tenant and
+// organizations without a quota are unlimited.
+func CheckStorageQuota(ctx context.Context, db *gorm.DB, orgID *uuid.UUID, additional int64) error {
+	if orgID == nil {
+		return nil
+	}
+	var org models.Organization
+	if err := db.WithContext(ctx).Select("id", "storage_quota_bytes").First(&org, "id = ?", *orgID).Error; err != nil {
+		return err
+	}
+	if org.StorageQuotaBytes == nil {
+		return nil
+	}
+	used, err := OrganizationStorageUsed(ctx, db, orgID)
+	if err != nil {
+		return err
+	}
+	if used+additional > *org.StorageQuotaBytes {
+		return ErrStorageQuotaExceeded
+	}
+	return nil
+}
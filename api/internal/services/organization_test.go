@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestValidOrganizationSlug(t *testing.T) {
+	for slug, want := range map[string]bool{
+		"acme": true, "acme-eu": true, "a1": true, "x": true,
+		"": false, "-acme": false, "acme-": false, "Acme": false, "ac.me": false, "ac_me": false,
+	} {
+		if got := ValidOrganizationSlug(slug); got != want {
+			t.Errorf("ValidOrganizationSlug(%q) = %v, want %v", slug, got, want)
+		}
+	}
+}
+
+func TestSameOrganization(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	aCopy := a
+	cases := []struct {
+		x, y *uuid.UUID
+		want bool
+	}{
+		{nil, nil, true},
+		{&a, &aCopy, true},
+		{&a, &b, false},
+		{&a, nil, false},
+		{nil, &b, false},
+	}
+	for _, tc := range cases {
+		if got := SameOrganization(tc.x, tc.y); got != tc.want {
+			t.Errorf("SameOrganization(%v, %v) = %v, want %v", tc.x, tc.y, got, tc.want)
+		}
+	}
+}
+
+func TestCheckStorageQuota(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Organization{}, &models.File{}); err != nil {
+		t.Fatalf("failed automigrating models: %v", err)
+	}
+	ctx := context.Background()
+
+	quota := int64(1000)
+	limited := models.Organization{Name: "Limited", Slug: "limited", StorageQuotaBytes: &quota}
+	unlimited := models.Organization{Name: "Unlimited", Slug: "unlimited"}
+	db.Create(&limited)
+	db.Create(&unlimited)
+
+	owner := uuid.New()
+	db.Create(&models.File{Name: "a.bin", MimeType: "application/octet-stream", Size: 600, OwnerID: owner, OrganizationID: &limited.ID, StoragePath: "a"})
+	db.Create(&models.File{Name: "dir", MimeType: "inode/directory", Size: 5000, IsDirectory: true, OwnerID: owner, OrganizationID: &limited.ID, StoragePath: ""})
+	db.Create(&models.File{Name: "b.bin", MimeType: "application/octet-stream", Size: 9000, OwnerID: owner, StoragePath: "b"})
+
+	used, err := OrganizationStorageUsed(ctx, db, &limited.ID)
+	if err != nil || used != 600 {
+		t.Fatalf("expected 600 bytes used, got %d, %v", used, err)
+	}
+
+	if err := CheckStorageQuota(ctx, db, &limited.ID, 400); err != nil {
+		t.Fatalf("expected upload up to the quota to pass, got %v", err)
+	}
+	if err := CheckStorageQuota(ctx, db, &limited.ID, 401); !errors.Is(err, ErrStorageQuotaExceeded) {
+		t.Fatalf("expected ErrStorageQuotaExceeded, got %v", err)
+	}
+	if err := CheckStorageQuota(ctx, db, &unlimited.ID, 1<<40); err != nil {
+		t.Fatalf("expected no quota, got %v", err)
+	}
+	if err := CheckStorageQuota(ctx, db, nil, 1<<40); err != nil {
+		t.Fatalf("expected default tenant to be unlimited, got %v", err)
+	}
+}
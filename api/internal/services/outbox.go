@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	outboxBatchSize = 100
+	// outboxLease is how long a claimed batch is hidden from other
+	// dispatchers. A process that dies mid-batch releases its events
+	// implicitly once the lease runs out.
+	outboxLease      = time.Minute
+	outboxMaxBackoff = time.Hour
+	// outboxRetention is how long dispatched events are kept before
+	// CleanupDispatchedEvents removes them.
+	outboxRetention = 7 * 24 * time.Hour
+)
+
+// OutboxSubscriber receives outbox events. Delivery is at-least-once: an
+// event is redelivered to every subscriber until all of them accept it in
+// the same pass, so HandleEvent must be idempotent on event.ID.
+type OutboxSubscriber interface {
+	Name() string
+	HandleEvent(ctx context.Context, event models.OutboxEvent) error
+}
+
+// RecordEvent writes entry to the outbox using tx. Call it inside the
+// transaction that performs the mutation so the event exists if and only
+// if the mutation committed.
+func RecordEvent(tx *gorm.DB, entry AuditEntry) error {
+	now := time.Now().UTC()
+	event := models.OutboxEvent{
+		EventType:     entry.Action,
+		ResourceType:  entry.ResourceType,
+		ResourceID:    entry.ResourceID,
+		ActorID:       entry.UserID,
+		Payload:       entry.Details,
+		IPAddress:     entry.IPAddress,
+		RequestID:     entry.RequestID,
+		NextAttemptAt: now,
+	}
+	event.CreatedAt = now
+	return tx.Create(&event).Error
+}
+
+// OutboxDispatcher polls the outbox and fans events out to subscribers.
+type OutboxDispatcher struct {
+	DB          *gorm.DB
+	subscribers []OutboxSubscriber
+	mu          sync.Mutex
+}
+
+func NewOutboxDispatcher(db *gorm.DB, subscribers ...OutboxSubscriber) *OutboxDispatcher {
+	return &OutboxDispatcher{DB: db, subscribers: subscribers}
+}
+
+// Subscribe registers another subscriber. Events already dispatched are not
+// replayed to it.
+func (d *OutboxDispatcher) Subscribe(sub OutboxSubscriber) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.subscribers = append(d.subscribers, sub)
+}
+
+// Start polls the outbox every interval until the process exits.
+func (d *OutboxDispatcher) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			for {
+				n, err := d.DispatchPending(context.Background())
+				if err != nil {
+					logger.Error("outbox_dispatch_failed", err, nil)
+					break
+				}
+				if n < outboxBatchSize {
+					break
+				}
+			}
+		}
+	}()
+
+	logger.Info("outbox_dispatcher_started", map[string]interface{}{
+		"interval":    interval.String(),
+		"subscribers": len(d.subscribers),
+	})
+}
+
+// DispatchPending claims one batch of due events, delivers them and returns
+// how many were claimed.
+func (d *OutboxDispatcher) DispatchPending(ctx context.Context) (int, error) {
+	events, err := d.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	d.mu.Lock()
+	subscribers := append([]OutboxSubscriber(nil), d.subscribers...)
+	d.mu.Unlock()
+
+	for _, event := range events {
+		var failures []string
+		for _, sub := range subscribers {
+			if err := sub.HandleEvent(ctx, event); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", sub.Name(), err))
+			}
+		}
+
+		now := time.Now().UTC()
+		updates := map[string]interface{}{"attempts": event.Attempts + 1}
+		if len(failures) == 0 {
+			updates["dispatched_at"] = now
+			updates["last_error"] = ""
+		} else {
+			updates["next_attempt_at"] = now.Add(outboxBackoff(event.Attempts + 1))
+			updates["last_error"] = strings.Join(failures, "; ")
+			logger.Warn("outbox_delivery_failed", map[string]interface{}{
+				"event_id":   event.ID.String(),
+				"event_type": event.EventType,
+				"attempts":   event.Attempts + 1,
+				"error":      updates["last_error"],
+			})
+		}
+		if err := d.DB.WithContext(ctx).Model(&models.OutboxEvent{}).Where("id = ?", event.ID).Updates(updates).Error; err != nil {
+			return len(events), err
+		}
+	}
+	return len(events), nil
+}
+
+// claim selects due events and pushes their next_attempt_at past the lease
+// so concurrent dispatchers skip them. On Postgres the select also takes
+// row locks with SKIP LOCKED so two dispatchers never claim the same row.
+func (d *OutboxDispatcher) claim(ctx context.Context) ([]models.OutboxEvent, error) {
+	var events []models.OutboxEvent
+	err := d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		query := tx.Where("dispatched_at IS NULL AND next_attempt_at <= ?", now).
+			Order("created_at ASC, id ASC").
+			Limit(outboxBatchSize)
+		if tx.Dialector.Name() == "postgres" {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		if err := query.Find(&events).Error; err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		ids := make([]uuid.UUID, len(events))
+		for i := range events {
+			ids[i] = events[i].ID
+		}
+		return tx.Model(&models.OutboxEvent{}).Where("id IN ?", ids).
+			UpdateColumn("next_attempt_at", now.Add(outboxLease)).Error
+	})
+	return events, err
+}
+
+func outboxBackoff(attempts int) time.Duration {
+	backoff := 5 * time.Second
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > outboxMaxBackoff {
+		backoff = outboxMaxBackoff
+	}
+	return backoff
+}
+
+// CleanupDispatchedEvents removes events that were delivered more than the
+// retention window ago.
+func CleanupDispatchedEvents(db *gorm.DB) error {
+	cutoff := time.Now().UTC().Add(-outboxRetention)
+	result := db.Unscoped().Where("dispatched_at IS NOT NULL AND dispatched_at < ?", cutoff).Delete(&models.OutboxEvent{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		logger.Info("outbox_events_cleaned", map[string]interface{}{
+			"count": result.RowsAffected,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type recordingSubscriber struct {
+	name   string
+	fail   bool
+	events []uuid.UUID
+}
+
+func (r *recordingSubscriber) Name() string { return r.name }
+
+func (r *recordingSubscriber) HandleEvent(_ context.Context, event models.OutboxEvent) error {
+	r.events = append(r.events, event.ID)
+	if r.fail {
+		return errors.New("subscriber unavailable")
+	}
+	return nil
+}
+
+func setupOutboxTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := setupAuditTestDB(t)
+	if err := db.AutoMigrate(&models.OutboxEvent{}); err != nil {
+		t.Fatalf("failed automigrating outbox: %v", err)
+	}
+	return db
+}
+
+func TestRecordEvent_FollowsTransaction(t *testing.T) {
+	db := setupOutboxTestDB(t)
+	entry := AuditEntry{Action: "file.upload", ResourceType: "file", IPAddress: "127.0.0.1"}
+
+	_ = db.Transaction(func(tx *gorm.DB) error {
+		if err := RecordEvent(tx, entry); err != nil {
+			t.Fatalf("record failed: %v", err)
+		}
+		return errors.New("rollback")
+	})
+	var count int64
+	db.Model(&models.OutboxEvent{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected rolled back event to be discarded, got %d", count)
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error { return RecordEvent(tx, entry) }); err != nil {
+		t.Fatalf("record failed: %v", err)
+	}
+	db.Model(&models.OutboxEvent{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("expected committed event, got %d", count)
+	}
+}
+
+func TestOutboxDispatcher_DeliversToAudit(t *testing.T) {
+	db := setupOutboxTestDB(t)
+	audit := NewAuditService(db, nil)
+	recorder := &recordingSubscriber{name: "recorder"}
+	dispatcher := NewOutboxDispatcher(db, audit, recorder)
+	ctx := context.Background()
+
+	actor := uuid.New()
+	fileID := uuid.New()
+	if err := RecordEvent(db, AuditEntry{UserID: &actor, Action: "file.update", ResourceType: "file", ResourceID: &fileID, Details: map[string]interface{}{"file_name": "a.txt"}, IPAddress: "10.0.0.1", RequestID: "req-1"}); err != nil {
+		t.Fatalf("record failed: %v", err)
+	}
+
+	n, err := dispatcher.DispatchPending(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("expected one event dispatched, got %d (%v)", n, err)
+	}
+	var event models.OutboxEvent
+	db.First(&event)
+	if event.DispatchedAt == nil || event.Attempts != 1 {
+		t.Fatalf("expected event marked dispatched, got %+v", event)
+	}
+	if len(recorder.events) != 1 || recorder.events[0] != event.ID {
+		t.Fatalf("expected recorder to see event, got %v", recorder.events)
+	}
+
+	var logs []models.AuditLog
+	db.Where("action = ?", "file.update").Find(&logs)
+	if len(logs) != 1 || logs[0].EventID == nil || *logs[0].EventID != event.ID || logs[0].RequestID != "req-1" {
+		t.Fatalf("expected one audit row linked to the event, got %+v", logs)
+	}
+
+	// A redelivery after a crash must not duplicate the audit row.
+	if err := audit.HandleEvent(ctx, event); err != nil {
+		t.Fatalf("redelivery failed: %v", err)
+	}
+	var count int64
+	db.Model(&models.AuditLog{}).Where("action = ?", "file.update").Count(&count)
+	if count != 1 {
+		t.Fatalf("expected redelivery to be idempotent, got %d rows", count)
+	}
+
+	if n, _ := dispatcher.DispatchPending(ctx); n != 0 {
+		t.Fatalf("expected nothing left to dispatch, got %d", n)
+	}
+}
+
+func TestOutboxDispatcher_RetriesFailedDelivery(t *testing.T) {
+	db := setupOutboxTestDB(t)
+	flaky := &recordingSubscriber{name: "webhooks", fail: true}
+	dispatcher := NewOutboxDispatcher(db, flaky)
+	ctx := context.Background()
+
+	if err := RecordEvent(db, AuditEntry{Action: "share.create", ResourceType: "share", IPAddress: "127.0.0.1"}); err != nil {
+		t.Fatalf("record failed: %v", err)
+	}
+	if _, err := dispatcher.DispatchPending(ctx); err != nil {
+		t.Fatalf("dispatch failed: %v", err)
+	}
+
+	var event models.OutboxEvent
+	db.First(&event)
+	if event.DispatchedAt != nil || event.Attempts != 1 || event.LastError == "" {
+		t.Fatalf("expected failed attempt to be recorded, got %+v", event)
+	}
+	if !event.NextAttemptAt.After(time.Now()) {
+		t.Fatalf("expected retry to be scheduled in the future, got %v", event.NextAttemptAt)
+	}
+	if n, _ := dispatcher.DispatchPending(ctx); n != 0 {
+		t.Fatalf("expected event to wait for its backoff, got %d", n)
+	}
+
+	flaky.fail = false
+	db.Model(&models.OutboxEvent{}).Where("id = ?", event.ID).UpdateColumn("next_attempt_at", time.Now().Add(-time.Second))
+	if n, _ := dispatcher.DispatchPending(ctx); n != 1 {
+		t.Fatalf("expected retry once due, got %d", n)
+	}
+	db.First(&event, "id = ?", event.ID)
+	if event.DispatchedAt == nil || event.Attempts != 2 || event.LastError != "" {
+		t.Fatalf("expected event delivered on retry, got %+v", event)
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	if outboxBackoff(1) != 5*time.Second || outboxBackoff(3) != 20*time.Second {
+		t.Fatalf("unexpected backoff progression: %v %v", outboxBackoff(1), outboxBackoff(3))
+	}
+	if outboxBackoff(50) != outboxMaxBackoff {
+		t.Fatalf("expected backoff to cap at %v, got %v", outboxMaxBackoff, outboxBackoff(50))
+	}
+}
+
+func TestCleanupDispatchedEvents(t *testing.T) {
+	db := setupOutboxTestDB(t)
+	old := time.Now().Add(-outboxRetention - time.Hour)
+	recent := time.Now()
+	for _, dispatched := range []*time.Time{&old, &recent, nil} {
+		event := models.OutboxEvent{EventType: "file.delete", ResourceType: "file", NextAttemptAt: time.Now(), DispatchedAt: dispatched}
+		db.Create(&event)
+	}
+
+	CleanupDispatchedEvents(db)
+
+	var count int64
+	db.Unscoped().Model(&models.OutboxEvent{}).Count(&count)
+	if count != 2 {
+		t.Fatalf("expected only the old dispatched event removed, got %d left", count)
+	}
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/storage"
+)
+
+const (
+	pagesPrefix = "pages/"
+	// TileSize is the width and height of page tiles; tiles on the right
+	// and bottom edges are smaller.
+	TileSize = 512
+	// pageRenderDPI renders an A4 page at about 900x1300 pixels, enough to
+	// read without making the page worth printing.
+	pageRenderDPI = 110
+	// popplerExecTimeout caps rendering one page.
+	popplerExecTimeout = 30 * time.Second
+)
+
+var (
+	ErrRasterizerMissing = errors.New("page rendering requires poppler-utils, which is not installed on the server")
+	ErrPageNotFound      = errors.New("page not found")
+	ErrTileNotFound      = errors.New("tile not found")
+)
+
+// PageRasterizer renders the pages of a PDF as images.
+type PageRasterizer interface {
+	PageCount(ctx context.Context, pdf []byte) (int, error)
+	RenderPage(ctx context.Context, pdf []byte, page int) (image.Image, error)
+}
+
+// PageSource is a document shown as page images: a PDF, or an image shown
+// as a single page.
+type PageSource struct {
+	Key   string
+	Image bool
+}
+
+// DocumentPages describes a tiled document.
+type DocumentPages struct {
+	Pages    int `json:"pages"`
+	TileSize int `json:"tileSize"`
+}
+
+// PageLayout describes one rendered page and the grid of tiles it is cut
+// into.
+type PageLayout struct {
+	Page     int `json:"page"`
+	Width    int `json:"width"`
+	Height   int `json:"height"`
+	Columns  int `json:"columns"`
+	Rows     int `json:"rows"`
+	TileSize int `json:"tileSize"`
+}
+
+// pagesDir is where the tiles of source are kept:
+// pages/<file>/<version>/<source>/. The version follows the file, not the
+// source, so the tiles of a file's preview and of each watermarked copy
+// sit side by side and an edit drops them all.
+func pagesDir(file *models.File, source PageSource) (string, string) {
+	version := renditionVersion(file, file.StoragePath)
+	sum := sha256.Sum256([]byte(source.Key))
+	return pagesPrefix + file.ID.String() + "/" + version + "/" + hex.EncodeToString(sum[:8]) + "/", version
+}
+
+// TiledDocument returns how many pages source has.
+func (s *RenditionService) TiledDocument(ctx context.Context, file *models.File, source PageSource) (*DocumentPages, error) {
+	dir, version := pagesDir(file, source)
+	var doc DocumentPages
+	if found, err := s.readJSON(ctx, dir+"document.json", &doc); err != nil || found {
+		return &doc, err
+	}
+
+	doc = DocumentPages{Pages: 1, TileSize: TileSize}
+	if !source.Image {
+		if s.Rasterizer == nil {
+			return nil, ErrRasterizerMissing
+		}
+		pdf, err := s.readAll(ctx, source.Key)
+		if err != nil {
+			return nil, err
+		}
+		if doc.Pages, err = s.Rasterizer.PageCount(ctx, pdf); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.writeJSON(ctx, dir+"document.json", doc); err != nil {
+		return nil, err
+	}
+	s.purge(ctx, pagesPrefix, file.ID, version)
+	return &doc, nil
+}
+
+// TiledPage renders page of source and cuts it into tiles, once per
+// version of the file.
+func (s *RenditionService) TiledPage(ctx context.Context, file *models.File, source PageSource, page int) (*PageLayout, error) {
+	doc, err := s.TiledDocument(ctx, file, source)
+	if err != nil {
+		return nil, err
+	}
+	if page < 1 || page > doc.Pages {
+		return nil, ErrPageNotFound
+	}
+	dir, _ := pagesDir(file, source)
+	manifest := fmt.Sprintf("%spage-%d.json", dir, page)
+	var layout PageLayout
+	if found, err := s.readJSON(ctx, manifest, &layout); err != nil || found {
+		return &layout, err
+	}
+
+	data, err := s.readAll(ctx, source.Key)
+	if err != nil {
+		return nil, err
+	}
+	var img image.Image
+	if source.Image {
+		img, err = decodeSourceImage(bytes.NewReader(data))
+	} else {
+		img, err = s.Rasterizer.RenderPage(ctx, data, page)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	layout = PageLayout{
+		Page:     page,
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		Columns:  (bounds.Dx() + TileSize - 1) / TileSize,
+		Rows:     (bounds.Dy() + TileSize - 1) / TileSize,
+		TileSize: TileSize,
+	}
+	for row := 0; row < layout.Rows; row++ {
+		for col := 0; col < layout.Columns; col++ {
+			rect := image.Rect(col*TileSize, row*TileSize, (col+1)*TileSize, (row+1)*TileSize).
+				Add(bounds.Min).Intersect(bounds)
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, imaging.Crop(img, rect)); err != nil {
+				return nil, err
+			}
+			if err := s.Store.Upload(ctx, tileKey(dir, page, row, col), bytes.NewReader(buf.Bytes()), int64(buf.Len()), "image/png"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// The manifest goes last so a page is only taken as rendered once
+	// every tile is there.
+	if err := s.writeJSON(ctx, manifest, layout); err != nil {
+		return nil, err
+	}
+	return &layout, nil
+}
+
+// Tile returns the key of one tile of a page, rendering the page first if
+// needed.
+func (s *RenditionService) Tile(ctx context.Context, file *models.File, source PageSource, page, row, col int) (string, error) {
+	layout, err := s.TiledPage(ctx, file, source, page)
+	if err != nil {
+		return "", err
+	}
+	if row < 0 || row >= layout.Rows || col < 0 || col >= layout.Columns {
+		return "", ErrTileNotFound
+	}
+	dir, _ := pagesDir(file, source)
+	return tileKey(dir, page, row, col), nil
+}
+
+func tileKey(dir string, page, row, col int) string {
+	return fmt.Sprintf("%spage-%d/%d-%d.png", dir, page, row, col)
+}
+
+// readJSON loads the object at key into v, reporting false when there is
+// none.
+func (s *RenditionService) readJSON(ctx context.Context, key string, v interface{}) (bool, error) {
+	if _, err := s.Store.Stat(ctx, key); errors.Is(err, storage.ErrObjectNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	data, err := s.readAll(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+func (s *RenditionService) writeJSON(ctx context.Context, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.Store.Upload(ctx, key, bytes.NewReader(data), int64(len(data)), "application/json")
+}
+
+func (s *RenditionService) readAll(ctx context.Context, key string) ([]byte, error) {
+	obj, err := s.Store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return io.ReadAll(obj)
+}
+
+// PopplerRasterizer renders pages with poppler's pdfinfo and pdftoppm.
+type PopplerRasterizer struct {
+	PdfinfoPath  string
+	PdftoppmPath string
+}
+
+// NewPopplerRasterizer finds poppler's tools on the PATH. It returns nil
+// when they are not installed, which leaves page rendering turned off.
+func NewPopplerRasterizer() *PopplerRasterizer {
+	info, err := exec.LookPath("pdfinfo")
+	if err != nil {
+		return nil
+	}
+	toppm, err := exec.LookPath("pdftoppm")
+	if err != nil {
+		return nil
+	}
+	return &PopplerRasterizer{PdfinfoPath: info, PdftoppmPath: toppm}
+}
+
+var pdfinfoPages = regexp.MustCompile(`(?m)^Pages:\s+(\d+)`)
+
+func (r *PopplerRasterizer) PageCount(ctx context.Context, pdf []byte) (int, error) {
+	out, err := r.run(ctx, pdf, r.PdfinfoPath)
+	if err != nil {
+		return 0, err
+	}
+	m := pdfinfoPages.FindSubmatch(out)
+	if m == nil {
+		return 0, errors.New("pdfinfo reported no page count")
+	}
+	return strconv.Atoi(string(m[1]))
+}
+
+func (r *PopplerRasterizer) RenderPage(ctx context.Context, pdf []byte, page int) (image.Image, error) {
+	n := strconv.Itoa(page)
+	out, err := r.run(ctx, pdf, r.PdftoppmPath, "-png", "-r", strconv.Itoa(pageRenderDPI), "-f", n, "-l", n, "-singlefile")
+	if err != nil {
+		return nil, err
+	}
+	return png.Decode(bytes.NewReader(out))
+}
+
+// run writes pdf to a temporary file, since pdfinfo cannot read stdin,
+// and runs tool on it with args, returning its output.
+func (r *PopplerRasterizer) run(ctx context.Context, pdf []byte, tool string, args ...string) ([]byte, error) {
+	tmp, err := os.CreateTemp("", "docshare-pages-*.pdf")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(pdf); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	execCtx, cancel := context.WithTimeout(ctx, popplerExecTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(execCtx, tool, append(args, tmp.Name())...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if execCtx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("%s timed out after %s", tool, popplerExecTimeout)
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("%s failed: %s", tool, msg)
+	}
+	return stdout.Bytes(), nil
+}
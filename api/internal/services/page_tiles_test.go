@@ -0,0 +1,120 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+)
+
+type fakeRasterizer struct {
+	pages    int
+	rendered []int
+}
+
+func (f *fakeRasterizer) PageCount(ctx context.Context, pdf []byte) (int, error) {
+	return f.pages, nil
+}
+
+func (f *fakeRasterizer) RenderPage(ctx context.Context, pdf []byte, page int) (image.Image, error) {
+	f.rendered = append(f.rendered, page)
+	return imaging.New(1100, 600, color.NRGBA{R: 255, G: 255, B: 255, A: 255}), nil
+}
+
+func TestRenditionService_Tiles(t *testing.T) {
+	logger.Init()
+	ctx := context.Background()
+	bucket := newMemoryBucket()
+	_ = bucket.Upload(ctx, "owner/deck.pdf", strings.NewReader("%PDF-deck"), 9, "application/pdf")
+	checksum := "aaa"
+	file := &models.File{BaseModel: models.BaseModel{ID: uuid.New(), UpdatedAt: time.Now()}, MimeType: "application/pdf", StoragePath: "owner/deck.pdf", Checksum: &checksum}
+	source := PageSource{Key: file.StoragePath}
+
+	renditions := NewRenditionService(bucket, config.GotenbergConfig{})
+	if _, err := renditions.TiledDocument(ctx, file, source); !errors.Is(err, ErrRasterizerMissing) {
+		t.Fatalf("expected ErrRasterizerMissing without a rasterizer, got %v", err)
+	}
+	rasterizer := &fakeRasterizer{pages: 2}
+	renditions.Rasterizer = rasterizer
+
+	t.Run("counts pages", func(t *testing.T) {
+		doc, err := renditions.TiledDocument(ctx, file, source)
+		if err != nil || doc.Pages != 2 || doc.TileSize != TileSize {
+			t.Fatalf("expected 2 pages, got %+v, %v", doc, err)
+		}
+	})
+
+	t.Run("cuts a page into tiles once", func(t *testing.T) {
+		layout, err := renditions.TiledPage(ctx, file, source, 2)
+		if err != nil {
+			t.Fatalf("failed rendering page: %v", err)
+		}
+		if layout.Width != 1100 || layout.Height != 600 || layout.Columns != 3 || layout.Rows != 2 {
+			t.Fatalf("unexpected layout %+v", layout)
+		}
+		key, err := renditions.Tile(ctx, file, source, 2, 1, 2)
+		if err != nil {
+			t.Fatalf("failed finding tile: %v", err)
+		}
+		tile, err := png.Decode(bytes.NewReader(bucket.objects[key]))
+		if err != nil {
+			t.Fatalf("failed decoding tile: %v", err)
+		}
+		if b := tile.Bounds(); b.Dx() != 1100-2*TileSize || b.Dy() != 600-TileSize {
+			t.Fatalf("expected the corner tile to be cropped, got %dx%d", b.Dx(), b.Dy())
+		}
+		if len(rasterizer.rendered) != 1 {
+			t.Fatalf("expected the page to be rendered once, got %v", rasterizer.rendered)
+		}
+	})
+
+	t.Run("refuses pages and tiles out of range", func(t *testing.T) {
+		if _, err := renditions.TiledPage(ctx, file, source, 3); !errors.Is(err, ErrPageNotFound) {
+			t.Fatalf("expected ErrPageNotFound, got %v", err)
+		}
+		if _, err := renditions.Tile(ctx, file, source, 2, 2, 0); !errors.Is(err, ErrTileNotFound) {
+			t.Fatalf("expected ErrTileNotFound, got %v", err)
+		}
+	})
+
+	t.Run("shows images as one page", func(t *testing.T) {
+		var photo bytes.Buffer
+		_ = imaging.Encode(&photo, imaging.New(300, 200, color.NRGBA{B: 255, A: 255}), imaging.PNG)
+		_ = bucket.Upload(ctx, "owner/photo.png", bytes.NewReader(photo.Bytes()), int64(photo.Len()), "image/png")
+		img := &models.File{BaseModel: models.BaseModel{ID: uuid.New()}, MimeType: "image/png", StoragePath: "owner/photo.png"}
+		layout, err := renditions.TiledPage(ctx, img, PageSource{Key: img.StoragePath, Image: true}, 1)
+		if err != nil || layout.Columns != 1 || layout.Rows != 1 || layout.Width != 300 {
+			t.Fatalf("expected a single tile, got %+v, %v", layout, err)
+		}
+	})
+
+	t.Run("edits drop the old tiles", func(t *testing.T) {
+		old, _ := renditions.Tile(ctx, file, source, 2, 0, 0)
+		edited := "bbb"
+		file.Checksum = &edited
+		if _, err := renditions.TiledDocument(ctx, file, source); err != nil {
+			t.Fatalf("failed counting pages: %v", err)
+		}
+		if _, ok := bucket.objects[old]; ok {
+			t.Fatal("expected the old version's tiles to be removed")
+		}
+
+		renditions.Purge(ctx, file.ID)
+		for key := range bucket.objects {
+			if strings.HasPrefix(key, pagesPrefix+file.ID.String()) {
+				t.Fatalf("expected the purge to remove %s", key)
+			}
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/textrender"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PasteFolderName is the folder in a user's root that pastes go to when no
+// other folder is named.
+const PasteFolderName = "Pastes"
+
+// maxPasteNameLength bounds the name a paste can be given.
+const maxPasteNameLength = 255
+
+var (
+	// ErrPasteInvalid is wrapped with the reason a paste was refused.
+	ErrPasteInvalid     = errors.New("invalid paste")
+	ErrPasteTooLarge    = errors.New("paste is too large")
+	ErrPasteRateLimited = errors.New("too many pastes, please try again later")
+)
+
+// Pastes turns pasted text into files. A paste is an ordinary file, so it
+// is previewed, shared and counted against quotas like any other; the
+// pastes table only records which files were pasted, for listing them and
+// for the hourly limit.
+type Pastes struct {
+	DB     *gorm.DB
+	Store  TransferStore
+	Config config.PastesConfig
+}
+
+func NewPastes(db *gorm.DB, store TransferStore, cfg config.PastesConfig) *Pastes {
+	return &Pastes{DB: db, Store: store, Config: cfg}
+}
+
+// Allow returns ErrPasteRateLimited when userID has already made the
+// configured number of pastes in the hour before now. Deleting a paste
+// does not give it back.
+func (p *Pastes) Allow(ctx context.Context, userID uuid.UUID, now time.Time) error {
+	if p.Config.PerHour <= 0 {
+		return nil
+	}
+	var count int64
+	if err := p.DB.WithContext(ctx).Unscoped().Model(&models.Paste{}).
+		Where("owner_id = ? AND created_at > ?", userID, now.Add(-time.Hour)).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count >= int64(p.Config.PerHour) {
+		return ErrPasteRateLimited
+	}
+	return nil
+}
+
+// Check rejects content that is empty, larger than the configured limit or
+// not UTF-8 text.
+func (p *Pastes) Check(content []byte) error {
+	if len(content) == 0 {
+		return fmt.Errorf("%w: content is empty", ErrPasteInvalid)
+	}
+	if p.Config.MaxBytes > 0 && int64(len(content)) > p.Config.MaxBytes {
+		return fmt.Errorf("%w: the limit is %d bytes", ErrPasteTooLarge, p.Config.MaxBytes)
+	}
+	if !utf8.Valid(content) || bytes.IndexByte(content, 0) >= 0 {
+		return fmt.Errorf("%w: content must be UTF-8 text", ErrPasteInvalid)
+	}
+	return nil
+}
+
+// PasteName returns the file name for a paste and the language it will be
+// highlighted as. A name without an extension, or no name at all, gets the
+// extension of language, so the text preview picks the language up; with
+// no language it is plain text. An unnamed paste is called after the time
+// it was made.
+func PasteName(name, language string, now time.Time) (string, string, error) {
+	ext := ".txt"
+	switch lang := strings.ToLower(strings.TrimSpace(language)); lang {
+	case "", "text", "txt", "plain", "plaintext":
+	case "markdown", "md":
+		ext = ".md"
+	default:
+		normalized := textrender.NormalizeLanguage(lang)
+		if normalized == "" {
+			return "", "", fmt.Errorf("%w: unknown language %q", ErrPasteInvalid, language)
+		}
+		ext = textrender.ExtensionForLanguage(normalized)
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "paste-" + now.UTC().Format("20060102-150405")
+	} else {
+		name = filepath.Base(name)
+		if name == "." || name == string(filepath.Separator) {
+			return "", "", fmt.Errorf("%w: invalid name", ErrPasteInvalid)
+		}
+	}
+	if filepath.Ext(name) == "" {
+		name += ext
+	}
+	if len(name) > maxPasteNameLength {
+		return "", "", fmt.Errorf("%w: name is longer than %d bytes", ErrPasteInvalid, maxPasteNameLength)
+	}
+
+	kind, lang := TextPreviewKind(&models.File{Name: name})
+	if kind == TextPreviewMarkdown {
+		lang = "markdown"
+	}
+	return name, lang, nil
+}
+
+// Folder returns the folder named PasteFolderName in user's root, making
+// it on first use.
+func (p *Pastes) Folder(ctx context.Context, user *models.User, entry AuditEntry) (*models.File, error) {
+	var folder models.File
+	err := p.DB.WithContext(ctx).
+		Where("owner_id = ? AND parent_id IS NULL AND is_directory = ? AND name = ? AND vault_id IS NULL", user.ID, true, PasteFolderName).
+		Order("created_at ASC").
+		First(&folder).Error
+	if err == nil {
+		return &folder, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	folder = models.File{
+		Name:           PasteFolderName,
+		MimeType:       "inode/directory",
+		IsDirectory:    true,
+		OwnerID:        user.ID,
+		OrganizationID: user.OrganizationID,
+	}
+	if err := p.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&folder).Error; err != nil {
+			return err
+		}
+		entry.Action = "folder.create"
+		entry.ResourceType = "file"
+		entry.ResourceID = &folder.ID
+		entry.Details = map[string]interface{}{
+			"folder_name": folder.Name,
+			"paste":       true,
+		}
+		return RecordEvent(tx, entry)
+	}); err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// Put stores content under objectName.
+func (p *Pastes) Put(ctx context.Context, objectName string, content []byte, contentType string) error {
+	return p.Store.Upload(ctx, objectName, bytes.NewReader(content), int64(len(content)), contentType)
+}
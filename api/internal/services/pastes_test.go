@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+)
+
+func TestPasteName(t *testing.T) {
+	now := time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name, language   string
+		wantName, wantLg string
+	}{
+		{"", "", "paste-20261016-093000.txt", ""},
+		{"", "golang", "paste-20261016-093000.go", "go"},
+		{"", "Markdown", "paste-20261016-093000.md", "markdown"},
+		{"build", "", "build.txt", ""},
+		{"handler", "ts", "handler.ts", "typescript"},
+		{"server.log", "python", "server.log", ""},
+		{"../../etc/query.sql", "", "query.sql", "sql"},
+	} {
+		name, lang, err := PasteName(tc.name, tc.language, now)
+		if err != nil || name != tc.wantName || lang != tc.wantLg {
+			t.Errorf("PasteName(%q, %q) = %q, %q, %v; want %q, %q", tc.name, tc.language, name, lang, err, tc.wantName, tc.wantLg)
+		}
+	}
+
+	for name, language := range map[string]string{
+		"":                       "brainfuck",
+		"/":                      "",
+		strings.Repeat("a", 300): "",
+	} {
+		if _, _, err := PasteName(name, language, now); !errors.Is(err, ErrPasteInvalid) {
+			t.Errorf("PasteName(%q, %q): expected ErrPasteInvalid, got %v", name, language, err)
+		}
+	}
+}
+
+func TestPastes(t *testing.T) {
+	db := setupAuditTestDB(t)
+	if err := db.AutoMigrate(&models.OutboxEvent{}, &models.Paste{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+	ctx := context.Background()
+	pastes := NewPastes(db, nil, config.PastesConfig{MaxBytes: 16, PerHour: 2})
+	user := models.User{Email: "paster@test.com", PasswordHash: "hash", FirstName: "Paste", LastName: "Test", Role: models.UserRoleUser}
+	db.Create(&user)
+
+	t.Run("content", func(t *testing.T) {
+		for content, want := range map[string]error{
+			"":                    ErrPasteInvalid,
+			"hello\x00world":      ErrPasteInvalid,
+			"\xff\xfe":            ErrPasteInvalid,
+			"seventeen bytes!!":   ErrPasteTooLarge,
+			"fmt.Println(\"hi\")": ErrPasteTooLarge,
+		} {
+			if err := pastes.Check([]byte(content)); !errors.Is(err, want) {
+				t.Errorf("Check(%q): expected %v, got %v", content, want, err)
+			}
+		}
+		if err := pastes.Check([]byte("héllo\n")); err != nil {
+			t.Errorf("expected short text accepted, got %v", err)
+		}
+	})
+
+	t.Run("folder is made once", func(t *testing.T) {
+		first, err := pastes.Folder(ctx, &user, AuditEntry{UserID: &user.ID})
+		if err != nil {
+			t.Fatalf("folder failed: %v", err)
+		}
+		again, err := pastes.Folder(ctx, &user, AuditEntry{UserID: &user.ID})
+		if err != nil || again.ID != first.ID || !first.IsDirectory || first.Name != PasteFolderName {
+			t.Fatalf("expected the same Pastes folder, got %+v, %+v, %v", first, again, err)
+		}
+		var events int64
+		db.Model(&models.OutboxEvent{}).Where("event_type = ?", "folder.create").Count(&events)
+		if events != 1 {
+			t.Fatalf("expected one folder.create event, got %d", events)
+		}
+	})
+
+	t.Run("hourly limit", func(t *testing.T) {
+		now := time.Now()
+		for i := 0; i < 2; i++ {
+			if err := pastes.Allow(ctx, user.ID, now); err != nil {
+				t.Fatalf("paste %d: expected it allowed, got %v", i, err)
+			}
+			file := models.File{Name: "p.txt", OwnerID: user.ID}
+			db.Create(&file)
+			paste := models.Paste{FileID: file.ID, OwnerID: user.ID}
+			db.Create(&paste)
+			if i == 0 {
+				// Deleted pastes still count.
+				db.Delete(&paste)
+			}
+		}
+		if err := pastes.Allow(ctx, user.ID, now); !errors.Is(err, ErrPasteRateLimited) {
+			t.Fatalf("expected ErrPasteRateLimited, got %v", err)
+		}
+		if err := pastes.Allow(ctx, user.ID, now.Add(time.Hour+time.Minute)); err != nil {
+			t.Fatalf("expected pastes allowed an hour later, got %v", err)
+		}
+	})
+}
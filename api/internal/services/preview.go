@@ -24,6 +24,20 @@ type PreviewService struct {
 	Storage    *storage.S3Client
 	Gotenberg  config.GotenbergConfig
 	HTTPClient *http.Client
+	// Pool, when set, bounds and guards the conversions sent to Gotenberg.
+	Pool *GotenbergPool
+	// Settings, when set, controls how long preview URLs stay valid.
+	Settings *SettingsService
+}
+
+// defaultPreviewURLTTL is the lifetime of preview URLs without Settings.
+const defaultPreviewURLTTL = 15 * time.Minute
+
+func (p *PreviewService) urlTTL(ctx context.Context) time.Duration {
+	if p.Settings != nil {
+		return p.Settings.PreviewURLTTL(ctx)
+	}
+	return defaultPreviewURLTTL
 }
 
 func NewPreviewService(db *gorm.DB, storageClient *storage.S3Client, gotenberg config.GotenbergConfig) *PreviewService {
@@ -62,53 +76,14 @@ func (p *PreviewService) ConvertToPreview(ctx context.Context, file *models.File
 	}
 
 	if !isOfficeDocument(file.Name) {
-		return p.Storage.PresignedGetURLWithResponse(ctx, file.StoragePath, 15*time.Minute, file.MimeType, "inline")
-	}
-
-	sourceObject, err := p.Storage.Download(ctx, file.StoragePath)
-	if err != nil {
-		return "", err
-	}
-	defer sourceObject.Close()
-
-	pr, pw := io.Pipe()
-	writer := multipart.NewWriter(pw)
-
-	go func() {
-		defer pw.Close()
-		defer writer.Close()
-
-		part, partErr := writer.CreateFormFile("files", file.Name)
-		if partErr != nil {
-			_ = pw.CloseWithError(partErr)
-			return
-		}
-
-		if _, copyErr := io.Copy(part, sourceObject); copyErr != nil {
-			_ = pw.CloseWithError(copyErr)
-			return
-		}
-	}()
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(p.Gotenberg.URL, "/")+"/forms/libreoffice/convert", pr)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-
-	resp, err := p.HTTPClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
-		return "", fmt.Errorf("gotenberg conversion failed: %s", string(body))
+		return p.Storage.PresignedGetURLWithResponse(ctx, file.StoragePath, p.urlTTL(ctx), file.MimeType, "inline")
 	}
 
 	previewPath := fmt.Sprintf("%s/previews/%s.pdf", file.OwnerID.String(), uuid.New().String())
-	if err := p.Storage.Upload(ctx, previewPath, resp.Body, -1, "application/pdf"); err != nil {
+	err := p.Pool.Do(ctx, func(ctx context.Context) error {
+		return p.convertOffice(ctx, file, previewPath)
+	})
+	if err != nil {
 		return "", err
 	}
 
@@ -150,15 +125,70 @@ func (p *PreviewService) publishThumbnail(ctx context.Context, file *models.File
 	}
 	file.ThumbnailPath = &previewPath
 
-	return p.Storage.PresignedGetURLWithResponse(ctx, previewPath, 15*time.Minute, contentType, "inline")
+	return p.Storage.PresignedGetURLWithResponse(ctx, previewPath, p.urlTTL(ctx), contentType, "inline")
+}
+
+// convertOffice has Gotenberg's LibreOffice route render file as a PDF and
+// stores it at previewPath.
+func (p *PreviewService) convertOffice(ctx context.Context, file *models.File, previewPath string) error {
+	sourceObject, err := p.Storage.Download(ctx, file.StoragePath)
+	if err != nil {
+		return err
+	}
+	defer sourceObject.Close()
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		defer pw.Close()
+		defer writer.Close()
+
+		part, partErr := writer.CreateFormFile("files", file.Name)
+		if partErr != nil {
+			_ = pw.CloseWithError(partErr)
+			return
+		}
+
+		if _, copyErr := io.Copy(part, sourceObject); copyErr != nil {
+			_ = pw.CloseWithError(copyErr)
+			return
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(p.Gotenberg.URL, "/")+"/forms/libreoffice/convert", pr)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return gotenbergDown(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		err := fmt.Errorf("gotenberg conversion failed: %s", string(body))
+		if resp.StatusCode >= 500 {
+			return gotenbergDown(err)
+		}
+		return err
+	}
+
+	return p.Storage.Upload(ctx, previewPath, resp.Body, -1, "application/pdf")
 }
 
+// OfficePreviewExtensions are the documents converted to PDF for preview.
+var OfficePreviewExtensions = []string{".docx", ".xlsx", ".pptx", ".odt", ".ods", ".odp"}
+
 func isOfficeDocument(name string) bool {
 	ext := strings.ToLower(filepath.Ext(name))
-	switch ext {
-	case ".docx", ".xlsx", ".pptx", ".odt", ".ods", ".odp":
-		return true
-	default:
-		return false
+	for _, e := range OfficePreviewExtensions {
+		if ext == e {
+			return true
+		}
 	}
+	return false
 }
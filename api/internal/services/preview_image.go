@@ -39,19 +39,22 @@ const (
 	maxSourcePixels = 50_000_000
 )
 
-// IsThumbnailableImage reports whether a raster image with the given mime can
-// be decoded by the pure-Go pipeline. SVG is intentionally excluded — it's
-// already tiny and the frontend renders the original directly. HEIC/HEIF
-// have no pure-Go decoder so we skip them too; the FileThumbnail UI will
-// fall back to the file-type icon.
+// ThumbnailableImageTypes are the raster image types the pure-Go pipeline
+// can decode. SVG is intentionally excluded — it's already tiny and the
+// frontend renders the original directly. HEIC/HEIF have no pure-Go decoder
+// so we skip them too; the FileThumbnail UI will fall back to the file-type
+// icon.
+var ThumbnailableImageTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp", "image/bmp", "image/tiff"}
+
+// IsThumbnailableImage reports whether mime is one of
+// ThumbnailableImageTypes.
 func IsThumbnailableImage(mime string) bool {
-	switch mime {
-	case "image/jpeg", "image/png", "image/gif",
-		"image/webp", "image/bmp", "image/tiff":
-		return true
-	default:
-		return false
+	for _, t := range ThumbnailableImageTypes {
+		if mime == t {
+			return true
+		}
 	}
+	return false
 }
 
 // renderImageThumbnail downloads the original image, resizes it to fit
@@ -89,6 +92,16 @@ func (p *PreviewService) renderImageThumbnail(ctx context.Context, file *models.
 // avoid OOM via pixel-bomb inputs. The returned byte slice is the
 // encoded JPEG.
 func resizeImageToJPEG(r io.Reader, maxDim, quality int) ([]byte, error) {
+	img, err := decodeSourceImage(r)
+	if err != nil {
+		return nil, err
+	}
+	return encodeJPEG(imaging.Fit(img, maxDim, maxDim, imaging.Lanczos), quality)
+}
+
+// decodeSourceImage decodes an uploaded or stored image, upright and within
+// the pixel budget.
+func decodeSourceImage(r io.Reader) (image.Image, error) {
 	// Peel the header off into a buffer so DecodeConfig can inspect
 	// dimensions without consuming bytes Decode still needs. Replaying
 	// via MultiReader yields the full original stream to Decode below.
@@ -109,11 +122,12 @@ func resizeImageToJPEG(r io.Reader, maxDim, quality int) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("image decode failed: %w", err)
 	}
+	return img, nil
+}
 
-	resized := imaging.Fit(img, maxDim, maxDim, imaging.Lanczos)
-
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
 	var buf bytes.Buffer
-	if err := imaging.Encode(&buf, resized, imaging.JPEG, imaging.JPEGQuality(quality)); err != nil {
+	if err := imaging.Encode(&buf, img, imaging.JPEG, imaging.JPEGQuality(quality)); err != nil {
 		return nil, fmt.Errorf("image encode failed: %w", err)
 	}
 	return buf.Bytes(), nil
@@ -13,53 +13,92 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	previewGenerateJob = "preview.generate"
+	previewRecoverJob  = "preview.recover"
+	// previewStaleAfter is how long a preview job may sit in processing
+	// before RecoverStaleJobs assumes its worker died.
+	previewStaleAfter = 10 * time.Minute
+)
+
+// Preview job transitions recorded in the outbox, so the change feed and
+// audit webhooks can follow a conversion without polling PreviewStatus.
+const (
+	previewEventQueued     = "preview.queued"
+	previewEventConverting = "preview.converting"
+	previewEventReady      = "preview.ready"
+	// previewEventFailed covers both failures that will be retried, which
+	// carry next_retry_at, and final ones.
+	previewEventFailed = "preview.failed"
+)
+
 type PreviewJobTask struct {
 	FileID        uuid.UUID
 	RequestedByID *uuid.UUID
 }
 
+// PreviewQueueService tracks preview generation per file in preview_jobs,
+// which is what clients poll, and runs it on the job runner. Conversion
+// failures are retried on the RetryDelays schedule and recorded on the
+// preview job; the runner's own retries only cover runs that could not
+// start at all.
 type PreviewQueueService struct {
 	DB             *gorm.DB
 	PreviewService *PreviewService
-	queue          chan PreviewJobTask
+	Jobs           *JobRunner
 	config         config.PreviewConfig
 }
 
-func NewPreviewQueueService(db *gorm.DB, previewService *PreviewService, cfg config.PreviewConfig) *PreviewQueueService {
+func NewPreviewQueueService(db *gorm.DB, previewService *PreviewService, jobs *JobRunner, cfg config.PreviewConfig) *PreviewQueueService {
 	s := &PreviewQueueService{
 		DB:             db,
 		PreviewService: previewService,
-		queue:          make(chan PreviewJobTask, cfg.QueueBufferSize),
+		Jobs:           jobs,
 		config:         cfg,
 	}
-	go s.processQueue()
-	// Channel sends in Enqueue are non-blocking — when the buffer fills
-	// (e.g. a burst upload exceeds QueueBufferSize while the single worker
-	// is busy) the DB row is still created but the in-memory dispatch is
-	// dropped. Without a periodic sweep those jobs stay pending forever
-	// and the dedup guard in Enqueue means later upload attempts can't
-	// requeue them. The loop also recovers jobs stuck mid-processing if
-	// the worker crashed and drains pending jobs across API restarts.
+	jobs.Register(previewGenerateJob, s.runJob, JobOptions{})
 	if cfg.StaleRecoveryInterval > 0 {
-		go s.staleRecoveryLoop()
+		jobs.Every(previewRecoverJob, cfg.StaleRecoveryInterval, func(ctx context.Context, _ *models.Job) error {
+			return s.RecoverStaleJobs(ctx)
+		})
 	}
 	return s
 }
 
-// staleRecoveryLoop runs RecoverStaleJobs once at startup (to drain
-// anything left behind by a previous process) and then on a ticker.
-func (s *PreviewQueueService) staleRecoveryLoop() {
-	s.RecoverStaleJobs()
-	ticker := time.NewTicker(s.config.StaleRecoveryInterval)
-	defer ticker.Stop()
-	for range ticker.C {
-		s.RecoverStaleJobs()
+// dispatch queues a runner job for the file's pending preview job. Runner
+// jobs are unique per file, so dispatching a file that already has one
+// queued is a no-op.
+func (s *PreviewQueueService) dispatch(task PreviewJobTask, runAt time.Time) error {
+	payload := map[string]interface{}{"fileID": task.FileID.String()}
+	if task.RequestedByID != nil {
+		payload["requestedByID"] = task.RequestedByID.String()
 	}
+	_, err := s.Jobs.Enqueue(context.Background(), previewGenerateJob, payload, EnqueueOptions{
+		RunAt:     runAt,
+		UniqueKey: "preview:" + task.FileID.String(),
+	})
+	return err
+}
+
+func (s *PreviewQueueService) runJob(ctx context.Context, job *models.Job) error {
+	var task PreviewJobTask
+	raw, _ := job.Payload["fileID"].(string)
+	fileID, err := uuid.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid fileID in payload: %w", err)
+	}
+	task.FileID = fileID
+	if raw, ok := job.Payload["requestedByID"].(string); ok {
+		if requestedBy, err := uuid.Parse(raw); err == nil {
+			task.RequestedByID = &requestedBy
+		}
+	}
+	return s.processJob(ctx, task)
 }
 
 func (s *PreviewQueueService) Enqueue(fileID uuid.UUID, requestedByID *uuid.UUID) (*models.PreviewJob, error) {
 	var existingJob models.PreviewJob
-	err := s.DB.Where("file_id = ? AND status IN ?", fileID, []string{"pending", "processing"}).
+	err := s.DB.Where("file_id = ? AND status IN ?", fileID, []models.PreviewJobStatus{models.PreviewJobStatusPending, models.PreviewJobStatusProcessing, models.PreviewJobStatusUnavailable}).
 		Order("created_at DESC").
 		First(&existingJob).Error
 
@@ -77,22 +116,24 @@ func (s *PreviewQueueService) Enqueue(fileID uuid.UUID, requestedByID *uuid.UUID
 		MaxAttempts:   s.config.MaxAttempts,
 	}
 
-	if err := s.DB.Create(&job).Error; err != nil {
+	if err := s.saveJob(s.DB, &job, previewEventQueued); err != nil {
 		return nil, fmt.Errorf("failed to create preview job: %w", err)
 	}
 
-	select {
-	case s.queue <- PreviewJobTask{FileID: fileID, RequestedByID: requestedByID}:
-		logger.Info("preview_job_enqueued", map[string]interface{}{
-			"job_id":  job.ID.String(),
-			"file_id": fileID.String(),
-		})
-	default:
-		logger.Warn("preview_queue_full", map[string]interface{}{
+	// The preview job row is what clients see, so a failed dispatch is
+	// only logged; RecoverStaleJobs picks up pending rows without a runner
+	// job.
+	if err := s.dispatch(PreviewJobTask{FileID: fileID, RequestedByID: requestedByID}, time.Time{}); err != nil {
+		logger.Error("preview_job_dispatch_failed", err, map[string]interface{}{
 			"job_id":  job.ID.String(),
 			"file_id": fileID.String(),
 		})
+		return &job, nil
 	}
+	logger.Info("preview_job_enqueued", map[string]interface{}{
+		"job_id":  job.ID.String(),
+		"file_id": fileID.String(),
+	})
 
 	return &job, nil
 }
@@ -123,14 +164,12 @@ func (s *PreviewQueueService) Retry(fileID uuid.UUID, requestedByID *uuid.UUID)
 		existing.LastError = nil
 		existing.NextRetryAt = nil
 
-		if err := s.DB.Save(existing).Error; err != nil {
+		if err := s.saveJob(s.DB, existing, previewEventQueued); err != nil {
 			return nil, fmt.Errorf("failed to update job: %w", err)
 		}
 
-		select {
-		case s.queue <- PreviewJobTask{FileID: fileID, RequestedByID: requestedByID}:
-		default:
-			logger.Warn("preview_queue_full_on_retry", map[string]interface{}{
+		if err := s.dispatch(PreviewJobTask{FileID: fileID, RequestedByID: requestedByID}, time.Time{}); err != nil {
+			logger.Error("preview_job_dispatch_failed", err, map[string]interface{}{
 				"job_id": existing.ID.String(),
 			})
 		}
@@ -141,45 +180,34 @@ func (s *PreviewQueueService) Retry(fileID uuid.UUID, requestedByID *uuid.UUID)
 	return s.Enqueue(fileID, requestedByID)
 }
 
-func (s *PreviewQueueService) processQueue() {
-	for task := range s.queue {
-		s.processJob(task)
-	}
-}
-
-func (s *PreviewQueueService) processJob(task PreviewJobTask) {
-	ctx := context.Background()
-
+// processJob renders the preview for the file's pending preview job. It
+// returns an error only when the job could not be loaded or updated;
+// conversion failures are recorded on the preview job instead.
+func (s *PreviewQueueService) processJob(ctx context.Context, task PreviewJobTask) error {
 	var job models.PreviewJob
-	err := s.DB.Where("file_id = ? AND status = ?", task.FileID, models.PreviewJobStatusPending).
+	err := s.DB.Where("file_id = ? AND status IN ?", task.FileID, []models.PreviewJobStatus{models.PreviewJobStatusPending, models.PreviewJobStatusUnavailable}).
 		Order("created_at DESC").
 		First(&job).Error
 
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return
+			return nil
 		}
-		logger.Error("preview_job_load_failed", err, map[string]interface{}{
-			"file_id": task.FileID.String(),
-		})
-		return
+		return fmt.Errorf("failed loading preview job: %w", err)
 	}
 
 	now := time.Now().UTC()
 	job.Status = models.PreviewJobStatusProcessing
 	job.StartedAt = &now
 
-	if err := s.DB.Save(&job).Error; err != nil {
-		logger.Error("preview_job_update_failed", err, map[string]interface{}{
-			"job_id": job.ID.String(),
-		})
-		return
+	if err := s.saveJob(s.DB, &job, previewEventConverting); err != nil {
+		return fmt.Errorf("failed updating preview job: %w", err)
 	}
 
 	var file models.File
 	if err := s.DB.First(&file, "id = ?", task.FileID).Error; err != nil {
 		s.markJobFailed(&job, fmt.Errorf("file not found: %w", err))
-		return
+		return nil
 	}
 
 	// Pass the job's start time as a fence; ConvertToPreview will only
@@ -207,10 +235,14 @@ func (s *PreviewQueueService) processJob(task PreviewJobTask) {
 					"file_id": task.FileID.String(),
 				})
 			}
-			return
+			return nil
+		}
+		if errors.Is(err, ErrGotenbergUnavailable) {
+			s.markJobUnavailable(&job, err)
+			return nil
 		}
 		s.markJobFailed(&job, err)
-		return
+		return nil
 	}
 
 	_ = previewURL
@@ -219,17 +251,15 @@ func (s *PreviewQueueService) processJob(task PreviewJobTask) {
 	job.Status = models.PreviewJobStatusCompleted
 	job.CompletedAt = &completedAt
 
-	if err := s.DB.Save(&job).Error; err != nil {
-		logger.Error("preview_job_complete_failed", err, map[string]interface{}{
-			"job_id": job.ID.String(),
-		})
-		return
+	if err := s.saveJob(s.DB, &job, previewEventReady); err != nil {
+		return fmt.Errorf("failed completing preview job: %w", err)
 	}
 
 	logger.Info("preview_job_completed", map[string]interface{}{
 		"job_id":  job.ID.String(),
 		"file_id": task.FileID.String(),
 	})
+	return nil
 }
 
 func (s *PreviewQueueService) markJobFailed(job *models.PreviewJob, jobErr error) {
@@ -263,38 +293,111 @@ func (s *PreviewQueueService) markJobFailed(job *models.PreviewJob, jobErr error
 		})
 	}
 
-	if err := s.DB.Save(job).Error; err != nil {
+	if err := s.saveJob(s.DB, job, previewEventFailed); err != nil {
+		logger.Error("preview_job_failed_update_failed", err, map[string]interface{}{
+			"job_id": job.ID.String(),
+		})
+		return
+	}
+	if job.NextRetryAt != nil {
+		task := PreviewJobTask{FileID: job.FileID, RequestedByID: job.RequestedByID}
+		if err := s.dispatch(task, *job.NextRetryAt); err != nil {
+			logger.Error("preview_job_dispatch_failed", err, map[string]interface{}{
+				"job_id": job.ID.String(),
+			})
+		}
+	}
+}
+
+// saveJob stores job and records its new state as action in the same
+// transaction.
+func (s *PreviewQueueService) saveJob(db *gorm.DB, job *models.PreviewJob, action string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(job).Error; err != nil {
+			return err
+		}
+		details := map[string]interface{}{
+			"job_id":       job.ID.String(),
+			"status":       string(job.Status),
+			"attempts":     job.Attempts,
+			"max_attempts": job.MaxAttempts,
+		}
+		var names []string
+		if err := tx.Model(&models.File{}).Where("id = ?", job.FileID).Pluck("name", &names).Error; err == nil && len(names) > 0 {
+			details["file_name"] = names[0]
+		}
+		if job.NextRetryAt != nil && job.Status != models.PreviewJobStatusFailed {
+			details["next_retry_at"] = job.NextRetryAt.UTC().Format(time.RFC3339)
+		}
+		if action == previewEventFailed && job.LastError != nil {
+			details["reason"] = *job.LastError
+		}
+		fileID := job.FileID
+		return RecordEvent(tx, AuditEntry{
+			UserID:       job.RequestedByID,
+			Action:       action,
+			ResourceType: "file",
+			ResourceID:   &fileID,
+			Details:      details,
+		})
+	})
+}
+
+// markJobUnavailable parks job until the converter takes work again. The
+// attempt is not counted, since the document was never tried.
+func (s *PreviewQueueService) markJobUnavailable(job *models.PreviewJob, jobErr error) {
+	errStr := jobErr.Error()
+	job.LastError = &errStr
+	job.Status = models.PreviewJobStatusUnavailable
+	nextRetry := time.Now().UTC().Add(s.config.RetryDelays[0])
+	if retryAt := s.PreviewService.Pool.RetryAt(); retryAt.After(nextRetry) {
+		nextRetry = retryAt.UTC()
+	}
+	job.NextRetryAt = &nextRetry
+
+	logger.Warn("preview_job_converter_unavailable", map[string]interface{}{
+		"job_id":     job.ID.String(),
+		"file_id":    job.FileID.String(),
+		"next_retry": nextRetry.String(),
+	})
+
+	if err := s.saveJob(s.DB, job, previewEventFailed); err != nil {
 		logger.Error("preview_job_failed_update_failed", err, map[string]interface{}{
 			"job_id": job.ID.String(),
 		})
+		return
+	}
+	task := PreviewJobTask{FileID: job.FileID, RequestedByID: job.RequestedByID}
+	if err := s.dispatch(task, nextRetry); err != nil {
+		logger.Error("preview_job_dispatch_failed", err, map[string]interface{}{
+			"job_id": job.ID.String(),
+		})
 	}
 }
 
-func (s *PreviewQueueService) RecoverStaleJobs() {
+// RecoverStaleJobs requeues preview jobs stuck in processing, whose worker
+// presumably died, and dispatches pending ones that are due. Dispatch is
+// deduplicated per file, so jobs that already have a runner job are left
+// alone.
+func (s *PreviewQueueService) RecoverStaleJobs(ctx context.Context) error {
 	var staleJobs []models.PreviewJob
-
-	s.DB.Where("status = ? AND updated_at < ?", models.PreviewJobStatusProcessing, time.Now().UTC().Add(-10*time.Minute)).
-		Find(&staleJobs)
+	if err := s.DB.WithContext(ctx).
+		Where("status = ? AND updated_at < ?", models.PreviewJobStatusProcessing, time.Now().UTC().Add(-previewStaleAfter)).
+		Find(&staleJobs).Error; err != nil {
+		return err
+	}
 
 	for _, job := range staleJobs {
 		job.Status = models.PreviewJobStatusPending
 		job.NextRetryAt = nil
 
-		if err := s.DB.Save(&job).Error; err != nil {
+		if err := s.saveJob(s.DB.WithContext(ctx), &job, previewEventQueued); err != nil {
 			logger.Error("preview_job_stale_recovery_failed", err, map[string]interface{}{
 				"job_id": job.ID.String(),
 			})
 			continue
 		}
 
-		select {
-		case s.queue <- PreviewJobTask{FileID: job.FileID, RequestedByID: job.RequestedByID}:
-		default:
-			logger.Warn("preview_queue_full_on_recovery", map[string]interface{}{
-				"job_id": job.ID.String(),
-			})
-		}
-
 		logger.Info("preview_job_stale_recovered", map[string]interface{}{
 			"job_id":  job.ID.String(),
 			"file_id": job.FileID.String(),
@@ -302,25 +405,23 @@ func (s *PreviewQueueService) RecoverStaleJobs() {
 	}
 
 	// Pending jobs whose NextRetryAt is in the future are intentionally
-	// deferred by markJobFailed — re-enqueueing them on every tick would
-	// burn through MaxAttempts ahead of the configured backoff. Match
-	// failed-with-retry-due the same way: NextRetryAt must be NULL (fresh
-	// pending) or in the past.
+	// deferred by markJobFailed and already have a runner job scheduled
+	// for then. Match failed-with-retry-due and unavailable jobs the same
+	// way: NextRetryAt must be NULL (fresh pending) or in the past.
 	now := time.Now().UTC()
 	var pendingJobs []models.PreviewJob
-	s.DB.Where(
-		"(status = ? AND (next_retry_at IS NULL OR next_retry_at <= ?)) OR (status = ? AND next_retry_at IS NOT NULL AND next_retry_at <= ?)",
+	if err := s.DB.WithContext(ctx).Where(
+		"(status = ? AND (next_retry_at IS NULL OR next_retry_at <= ?)) OR (status IN ? AND next_retry_at IS NOT NULL AND next_retry_at <= ?)",
 		models.PreviewJobStatusPending, now,
-		models.PreviewJobStatusFailed, now,
-	).Find(&pendingJobs)
+		[]models.PreviewJobStatus{models.PreviewJobStatusFailed, models.PreviewJobStatusUnavailable}, now,
+	).Find(&pendingJobs).Error; err != nil {
+		return err
+	}
 
 	for _, job := range pendingJobs {
-		select {
-		case s.queue <- PreviewJobTask{FileID: job.FileID, RequestedByID: job.RequestedByID}:
-		default:
-			logger.Warn("preview_queue_full_on_recovery", map[string]interface{}{
-				"job_id": job.ID.String(),
-			})
+		if err := s.dispatch(PreviewJobTask{FileID: job.FileID, RequestedByID: job.RequestedByID}, time.Time{}); err != nil {
+			return err
 		}
 	}
+	return nil
 }
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -29,6 +30,8 @@ func setupPreviewQueueTestDB(t *testing.T) *gorm.DB {
 		&models.User{},
 		&models.File{},
 		&models.PreviewJob{},
+		&models.Job{},
+		&models.OutboxEvent{},
 	)
 	if err != nil {
 		t.Fatalf("failed automigrating: %v", err)
@@ -68,12 +71,11 @@ func TestPreviewQueueService_Enqueue(t *testing.T) {
 		db.Create(existingJob)
 
 		cfg := config.PreviewConfig{
-			QueueBufferSize: 10,
-			MaxAttempts:     3,
-			RetryDelays:     []time.Duration{1 * time.Second},
+			MaxAttempts: 3,
+			RetryDelays: []time.Duration{1 * time.Second},
 		}
 		previewService := NewPreviewService(db, nil, config.GotenbergConfig{})
-		service := NewPreviewQueueService(db, previewService, cfg)
+		service := NewPreviewQueueService(db, previewService, NewJobRunner(db, config.JobsConfig{}), cfg)
 
 		job, err := service.Enqueue(file.ID, &owner.ID)
 		if err != nil {
@@ -91,12 +93,11 @@ func TestPreviewQueueService_Enqueue(t *testing.T) {
 func TestPreviewQueueService_GetJobByFileID(t *testing.T) {
 	db := setupPreviewQueueTestDB(t)
 	cfg := config.PreviewConfig{
-		QueueBufferSize: 10,
-		MaxAttempts:     3,
-		RetryDelays:     []time.Duration{1 * time.Second},
+		MaxAttempts: 3,
+		RetryDelays: []time.Duration{1 * time.Second},
 	}
 	previewService := NewPreviewService(db, nil, config.GotenbergConfig{})
-	service := NewPreviewQueueService(db, previewService, cfg)
+	service := NewPreviewQueueService(db, previewService, NewJobRunner(db, config.JobsConfig{}), cfg)
 
 	t.Run("returns nil for non-existent file", func(t *testing.T) {
 		fakeID := uuid.New()
@@ -183,12 +184,11 @@ func TestPreviewQueueService_Retry(t *testing.T) {
 		db.Create(failedJob)
 
 		cfg := config.PreviewConfig{
-			QueueBufferSize: 10,
-			MaxAttempts:     3,
-			RetryDelays:     []time.Duration{1 * time.Second},
+			MaxAttempts: 3,
+			RetryDelays: []time.Duration{1 * time.Second},
 		}
 		previewService := NewPreviewService(db, nil, config.GotenbergConfig{})
-		service := NewPreviewQueueService(db, previewService, cfg)
+		service := NewPreviewQueueService(db, previewService, NewJobRunner(db, config.JobsConfig{}), cfg)
 
 		job, err := service.Retry(file.ID, &owner.ID)
 		if err != nil {
@@ -229,24 +229,13 @@ func TestPreviewQueueService_RecoverStaleJobs(t *testing.T) {
 	}
 
 	cfg := config.PreviewConfig{
-		QueueBufferSize: 10,
-		MaxAttempts:     3,
-		RetryDelays:     []time.Duration{1 * time.Second},
-		// StaleRecoveryInterval intentionally zero: we drive RecoverStaleJobs
-		// directly and don't want a concurrent background tick racing the
-		// channel-drain assertions below.
+		MaxAttempts: 3,
+		RetryDelays: []time.Duration{1 * time.Second},
 	}
 	previewService := NewPreviewService(db, nil, config.GotenbergConfig{})
-	// Construct without NewPreviewQueueService to keep the processQueue
-	// worker out of the picture — RecoverStaleJobs is the unit under test
-	// and we want to assert on the channel contents directly, not race a
-	// worker (which would also nil-deref on the nil storage client).
-	service := &PreviewQueueService{
-		DB:             db,
-		PreviewService: previewService,
-		queue:          make(chan PreviewJobTask, cfg.QueueBufferSize),
-		config:         cfg,
-	}
+	// The runner is never started, so the queued runner jobs stay put for
+	// the assertions below.
+	service := NewPreviewQueueService(db, previewService, NewJobRunner(db, config.JobsConfig{}), cfg)
 
 	future := time.Now().UTC().Add(5 * time.Minute)
 	past := time.Now().UTC().Add(-1 * time.Minute)
@@ -274,19 +263,23 @@ func TestPreviewQueueService_RecoverStaleJobs(t *testing.T) {
 	// Force updated_at backward — RecoverStaleJobs picks by status+updated_at age.
 	db.Model(stuckJob).UpdateColumn("updated_at", earlier)
 
-	service.RecoverStaleJobs()
+	if err := service.RecoverStaleJobs(context.Background()); err != nil {
+		t.Fatalf("recover failed: %v", err)
+	}
+	// Recovering again must not queue a second runner job for any file.
+	if err := service.RecoverStaleJobs(context.Background()); err != nil {
+		t.Fatalf("recover failed: %v", err)
+	}
 
-	// Drain the channel; capture every FileID we received.
+	var queued []models.Job
+	db.Where("kind = ? AND status = ?", previewGenerateJob, models.JobStatusPending).Find(&queued)
 	got := map[uuid.UUID]bool{}
-	timeout := time.After(200 * time.Millisecond)
-collect:
-	for {
-		select {
-		case task := <-service.queue:
-			got[task.FileID] = true
-		case <-timeout:
-			break collect
+	for _, job := range queued {
+		fileID := uuid.MustParse(job.Payload["fileID"].(string))
+		if got[fileID] {
+			t.Errorf("file %s was dispatched twice", fileID)
 		}
+		got[fileID] = true
 	}
 
 	if !got[freshFile.ID] {
@@ -308,3 +301,55 @@ collect:
 		t.Errorf("expected stuck job to flip to pending, got %s", revived.Status)
 	}
 }
+
+func TestPreviewQueueService_ConverterUnavailable(t *testing.T) {
+	db := setupPreviewQueueTestDB(t)
+
+	owner := &models.User{Email: "preview-down@test.com", PasswordHash: "hash", Role: models.UserRoleUser}
+	db.Create(owner)
+	file := &models.File{Name: "report.docx", MimeType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document", OwnerID: owner.ID, StoragePath: "report.docx"}
+	db.Create(file)
+
+	pool := NewGotenbergPool(config.GotenbergConfig{Workers: 1, BreakerThreshold: 1, BreakerCooldown: time.Hour})
+	pool.Do(context.Background(), func(context.Context) error { return gotenbergDown(context.DeadlineExceeded) })
+
+	previewService := NewPreviewService(db, nil, config.GotenbergConfig{})
+	previewService.Pool = pool
+	service := NewPreviewQueueService(db, previewService, NewJobRunner(db, config.JobsConfig{}), config.PreviewConfig{
+		MaxAttempts: 3,
+		RetryDelays: []time.Duration{time.Second},
+	})
+
+	job, err := service.Enqueue(file.ID, &owner.ID)
+	if err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if err := service.processJob(context.Background(), PreviewJobTask{FileID: file.ID}); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+
+	db.First(job, "id = ?", job.ID)
+	if job.Status != models.PreviewJobStatusUnavailable || job.Attempts != 0 {
+		t.Fatalf("expected an unavailable job with no attempt used, got %s after %d attempts", job.Status, job.Attempts)
+	}
+	if job.NextRetryAt == nil || job.NextRetryAt.Before(time.Now().Add(50*time.Minute)) {
+		t.Fatalf("expected the retry after the breaker cooldown, got %v", job.NextRetryAt)
+	}
+	if again, _ := service.Enqueue(file.ID, &owner.ID); again.ID != job.ID {
+		t.Fatal("expected the parked job to be reused")
+	}
+
+	var events []models.OutboxEvent
+	db.Order("created_at ASC").Find(&events, "resource_id = ?", file.ID)
+	var actions []string
+	for _, event := range events {
+		actions = append(actions, event.EventType)
+	}
+	if len(events) != 3 || actions[0] != "preview.queued" || actions[1] != "preview.converting" || actions[2] != "preview.failed" {
+		t.Fatalf("expected queued, converting and failed events, got %v", actions)
+	}
+	failed := events[2].Payload
+	if failed["status"] != "unavailable" || failed["reason"] != ErrGotenbergUnavailable.Error() || failed["next_retry_at"] == nil || failed["file_name"] != "report.docx" {
+		t.Fatalf("expected the reason and retry time on the failure, got %v", failed)
+	}
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/previewtoken"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPreviewTokenInvalid = errors.New("invalid or expired preview token")
+	ErrPreviewTokenScope   = errors.New("this preview token does not open the requested preview")
+	ErrPreviewTokenUsed    = errors.New("this preview token has been used up")
+)
+
+// PreviewTokens issues and redeems the tokens that let img and iframe tags
+// open a preview without the Authorization header. A token's lifetime and
+// number of uses follow the preview token settings when it is issued and
+// are signed into it, so changing the policy only affects new tokens. Uses
+// of limited tokens are counted in the database so the limit holds across
+// API instances.
+type PreviewTokens struct {
+	DB *gorm.DB
+	// Settings, when set, supplies the lifetime and policy; tokens last 15
+	// minutes with unlimited uses otherwise.
+	Settings *SettingsService
+}
+
+func NewPreviewTokens(db *gorm.DB, settings *SettingsService) *PreviewTokens {
+	return &PreviewTokens{DB: db, Settings: settings}
+}
+
+// IssuedPreviewToken is a new token and the terms it was issued on.
+type IssuedPreviewToken struct {
+	Token      string    `json:"token"`
+	Scope      string    `json:"scope"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	TTLSeconds int64     `json:"ttl"`
+	// MaxUses is left out for tokens that serve any number of requests.
+	MaxUses int `json:"maxUses,omitempty"`
+}
+
+// Issue signs a token opening fileID's preview for userID within scope.
+func (p *PreviewTokens) Issue(ctx context.Context, fileID, userID uuid.UUID, scope string) IssuedPreviewToken {
+	opts := previewtoken.Options{Scope: scope, TTL: defaultPreviewURLTTL}
+	if p.Settings != nil {
+		opts.TTL = p.Settings.PreviewTokenTTL(ctx)
+		opts.MaxUses = p.Settings.PreviewTokenMaxUses(ctx)
+	}
+	return IssuedPreviewToken{
+		Token:      previewtoken.GenerateWithOptions(fileID.String(), userID.String(), opts),
+		Scope:      scope,
+		ExpiresAt:  time.Now().Add(opts.TTL).UTC().Truncate(time.Second),
+		TTLSeconds: int64(opts.TTL / time.Second),
+		MaxUses:    opts.MaxUses,
+	}
+}
+
+// Redeem checks that token opens fileID within scope, counts the use when
+// the token's uses are limited, and returns the user it was issued to.
+func (p *PreviewTokens) Redeem(ctx context.Context, token string, fileID uuid.UUID, scope string) (uuid.UUID, error) {
+	tok, err := previewtoken.Validate(token)
+	if err != nil || tok.FileID != fileID.String() {
+		return uuid.Nil, ErrPreviewTokenInvalid
+	}
+	userID, err := uuid.Parse(tok.UserID)
+	if err != nil {
+		return uuid.Nil, ErrPreviewTokenInvalid
+	}
+	if !tok.Allows(scope) {
+		return uuid.Nil, ErrPreviewTokenScope
+	}
+	if tok.MaxUses > 0 {
+		if err := p.use(ctx, tok); err != nil {
+			return uuid.Nil, err
+		}
+	}
+	return userID, nil
+}
+
+// use counts one request against tok, failing once MaxUses are spent. The
+// first use creates the counter; later ones increment it only while it is
+// under the limit, so concurrent requests cannot overspend.
+func (p *PreviewTokens) use(ctx context.Context, tok *previewtoken.PreviewToken) error {
+	db := p.DB.WithContext(ctx)
+	row := models.PreviewTokenUse{Nonce: tok.Nonce, Uses: 1, ExpiresAt: time.Unix(tok.ExpiresAt, 0)}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil
+	}
+	result = db.Model(&models.PreviewTokenUse{}).
+		Where("nonce = ? AND uses < ?", tok.Nonce, tok.MaxUses).
+		UpdateColumn("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPreviewTokenUsed
+	}
+	return nil
+}
+
+func CleanupExpiredPreviewTokenUses(db *gorm.DB) error {
+	return db.Unscoped().Where("expires_at < ?", time.Now()).Delete(&models.PreviewTokenUse{}).Error
+}
@@ -0,0 +1,370 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MaxPropertyTextLength bounds text values, whatever a definition's Max.
+const MaxPropertyTextLength = 1000
+
+var (
+	ErrPropertyDefinitionNotFound = errors.New("property not found")
+	// ErrPropertyDefinitionInvalid is wrapped with the reason a definition
+	// was refused.
+	ErrPropertyDefinitionInvalid = errors.New("invalid property definition")
+	// ErrPropertyValueInvalid is wrapped with the property and the reason
+	// its value was refused.
+	ErrPropertyValueInvalid = errors.New("invalid property value")
+)
+
+var propertyKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// Properties manages the admin's custom property definitions and the
+// values files have for them.
+type Properties struct {
+	DB *gorm.DB
+}
+
+func NewProperties(db *gorm.DB) *Properties {
+	return &Properties{DB: db}
+}
+
+// Definitions returns every definition in display order.
+func (p *Properties) Definitions(ctx context.Context) ([]models.PropertyDefinition, error) {
+	var defs []models.PropertyDefinition
+	err := p.DB.WithContext(ctx).Order("position ASC, label ASC, id ASC").Find(&defs).Error
+	return defs, err
+}
+
+func (p *Properties) Definition(ctx context.Context, id uuid.UUID) (*models.PropertyDefinition, error) {
+	var def models.PropertyDefinition
+	if err := p.DB.WithContext(ctx).First(&def, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPropertyDefinitionNotFound
+		}
+		return nil, err
+	}
+	return &def, nil
+}
+
+// Validate normalizes def and checks it can be saved. previousType is the
+// type def had before an update, or "" for a new definition; the type of a
+// property files already have values for cannot change.
+func (p *Properties) Validate(ctx context.Context, def *models.PropertyDefinition, previousType models.PropertyType) error {
+	def.Key = strings.ToLower(strings.TrimSpace(def.Key))
+	if !propertyKeyPattern.MatchString(def.Key) {
+		return fmt.Errorf("%w: key must start with a letter and hold only lowercase letters, digits or '_', up to 64", ErrPropertyDefinitionInvalid)
+	}
+	def.Label = strings.TrimSpace(def.Label)
+	if def.Label == "" || len(def.Label) > 255 {
+		return fmt.Errorf("%w: label must be 1 to 255 characters", ErrPropertyDefinitionInvalid)
+	}
+	def.Description = strings.TrimSpace(def.Description)
+	def.Pattern = strings.TrimSpace(def.Pattern)
+
+	switch def.Type {
+	case models.PropertyTypeText:
+		if def.Pattern != "" {
+			if _, err := regexp.Compile(def.Pattern); err != nil {
+				return fmt.Errorf("%w: pattern is not a valid regular expression", ErrPropertyDefinitionInvalid)
+			}
+		}
+		if (def.Min != nil && *def.Min < 0) || (def.Max != nil && *def.Max < 0) {
+			return fmt.Errorf("%w: text length bounds cannot be negative", ErrPropertyDefinitionInvalid)
+		}
+	case models.PropertyTypeNumber:
+	case models.PropertyTypeSelect:
+		seen := map[string]bool{}
+		options := make([]string, 0, len(def.Options))
+		for _, o := range def.Options {
+			o = strings.TrimSpace(o)
+			if o != "" && !seen[o] {
+				seen[o] = true
+				options = append(options, o)
+			}
+		}
+		if len(options) == 0 {
+			return fmt.Errorf("%w: a select property needs options", ErrPropertyDefinitionInvalid)
+		}
+		def.Options = options
+	case models.PropertyTypeDate, models.PropertyTypeBoolean:
+	default:
+		return fmt.Errorf("%w: type must be text, number, date, boolean or select", ErrPropertyDefinitionInvalid)
+	}
+	if def.Type != models.PropertyTypeSelect {
+		def.Options = nil
+	}
+	if def.Type != models.PropertyTypeText {
+		def.Pattern = ""
+	}
+	if def.Type != models.PropertyTypeText && def.Type != models.PropertyTypeNumber {
+		def.Min, def.Max = nil, nil
+	}
+	if def.Min != nil && def.Max != nil && *def.Min > *def.Max {
+		return fmt.Errorf("%w: min cannot exceed max", ErrPropertyDefinitionInvalid)
+	}
+
+	query := p.DB.WithContext(ctx).Model(&models.PropertyDefinition{}).Where("key = ?", def.Key)
+	if def.ID != uuid.Nil {
+		query = query.Where("id <> ?", def.ID)
+	}
+	var taken int64
+	if err := query.Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return fmt.Errorf("%w: key %q is already used", ErrPropertyDefinitionInvalid, def.Key)
+	}
+
+	if previousType != "" && previousType != def.Type {
+		var values int64
+		if err := p.DB.WithContext(ctx).Model(&models.FileProperty{}).Where("definition_id = ?", def.ID).Count(&values).Error; err != nil {
+			return err
+		}
+		if values > 0 {
+			return fmt.Errorf("%w: type cannot change once files have values for it", ErrPropertyDefinitionInvalid)
+		}
+	}
+	return nil
+}
+
+// DeleteDefinition removes a definition and every file's value for it.
+// Both are removed for good, so the key can be used again.
+func (p *Properties) DeleteDefinition(ctx context.Context, def *models.PropertyDefinition) error {
+	return p.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("definition_id = ?", def.ID).Delete(&models.FileProperty{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(def).Error
+	})
+}
+
+// ForFile returns a file's property values by key.
+func (p *Properties) ForFile(ctx context.Context, fileID uuid.UUID) (map[string]interface{}, error) {
+	values, err := p.ForFiles(ctx, []uuid.UUID{fileID})
+	if err != nil {
+		return nil, err
+	}
+	if values[fileID] == nil {
+		return map[string]interface{}{}, nil
+	}
+	return values[fileID], nil
+}
+
+// ForFiles returns the property values of each of fileIDs that has any.
+// Numbers come back as float64 and booleans as bool; other values are
+// strings.
+func (p *Properties) ForFiles(ctx context.Context, fileIDs []uuid.UUID) (map[uuid.UUID]map[string]interface{}, error) {
+	defs, err := p.Definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[uuid.UUID]models.PropertyType, len(defs))
+	for _, d := range defs {
+		types[d.ID] = d.Type
+	}
+	out := map[uuid.UUID]map[string]interface{}{}
+	for start := 0; start < len(fileIDs); start += legalExportBatchSize {
+		var rows []models.FileProperty
+		if err := p.DB.WithContext(ctx).Where("file_id IN ?", fileIDs[start:min(start+legalExportBatchSize, len(fileIDs))]).
+			Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			typ, ok := types[row.DefinitionID]
+			if !ok {
+				continue
+			}
+			if out[row.FileID] == nil {
+				out[row.FileID] = map[string]interface{}{}
+			}
+			out[row.FileID][row.Key] = typedPropertyValue(typ, row)
+		}
+	}
+	return out, nil
+}
+
+// Set replaces file's property values with values, keyed by property key.
+// A null or empty value leaves the property unset. The change is recorded
+// as a file.properties_update event with the values before and after.
+func (p *Properties) Set(ctx context.Context, file *models.File, values map[string]interface{}, entry AuditEntry) (map[string]interface{}, error) {
+	defs, err := p.Definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]*models.PropertyDefinition, len(defs))
+	for i := range defs {
+		byKey[defs[i].Key] = &defs[i]
+	}
+
+	rows := make([]models.FileProperty, 0, len(values))
+	result := map[string]interface{}{}
+	for key, raw := range values {
+		def, ok := byKey[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown property %q", ErrPropertyValueInvalid, key)
+		}
+		row, err := parsePropertyValue(def, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrPropertyValueInvalid, key, err.Error())
+		}
+		if row == nil {
+			continue
+		}
+		row.FileID = file.ID
+		rows = append(rows, *row)
+		result[key] = typedPropertyValue(def.Type, *row)
+	}
+
+	previous, err := p.ForFile(ctx, file.ID)
+	if err != nil {
+		return nil, err
+	}
+	err = p.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("file_id = ?", file.ID).Delete(&models.FileProperty{}).Error; err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			if err := tx.Create(&rows).Error; err != nil {
+				return err
+			}
+		}
+		entry.Action, entry.ResourceType, entry.ResourceID = "file.properties_update", "file", &file.ID
+		entry.Details = map[string]interface{}{
+			"file_name":  file.Name,
+			"properties": result,
+			"previous":   previous,
+		}
+		return RecordEvent(tx, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// parsePropertyValue checks raw, as decoded from JSON, against def and
+// returns the row to store, or nil when raw leaves the property unset.
+func parsePropertyValue(def *models.PropertyDefinition, raw interface{}) (*models.FileProperty, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	if s, ok := raw.(string); ok && strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	row := &models.FileProperty{DefinitionID: def.ID, Key: def.Key}
+	switch def.Type {
+	case models.PropertyTypeText:
+		s, ok := raw.(string)
+		if !ok {
+			return nil, errors.New("must be a string")
+		}
+		s = strings.TrimSpace(s)
+		length := float64(utf8.RuneCountInString(s))
+		if length > MaxPropertyTextLength {
+			return nil, fmt.Errorf("must be at most %d characters", MaxPropertyTextLength)
+		}
+		if def.Min != nil && length < *def.Min {
+			return nil, fmt.Errorf("must be at least %v characters", *def.Min)
+		}
+		if def.Max != nil && length > *def.Max {
+			return nil, fmt.Errorf("must be at most %v characters", *def.Max)
+		}
+		if def.Pattern != "" {
+			if re, err := regexp.Compile(`^(?:` + def.Pattern + `)$`); err == nil && !re.MatchString(s) {
+				return nil, errors.New("does not match the required format")
+			}
+		}
+		row.Value = s
+	case models.PropertyTypeNumber:
+		var n float64
+		switch v := raw.(type) {
+		case float64:
+			n = v
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, errors.New("must be a number")
+			}
+			n = parsed
+		default:
+			return nil, errors.New("must be a number")
+		}
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, errors.New("must be a number")
+		}
+		if def.Min != nil && n < *def.Min {
+			return nil, fmt.Errorf("must be at least %v", *def.Min)
+		}
+		if def.Max != nil && n > *def.Max {
+			return nil, fmt.Errorf("must be at most %v", *def.Max)
+		}
+		row.Value, row.Number = strconv.FormatFloat(n, 'f', -1, 64), &n
+	case models.PropertyTypeDate:
+		s, ok := raw.(string)
+		if !ok {
+			return nil, errors.New("must be a date")
+		}
+		s = strings.TrimSpace(s)
+		day, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return nil, errors.New("must be a date as YYYY-MM-DD")
+			}
+			day = t
+		}
+		row.Value = day.Format("2006-01-02")
+	case models.PropertyTypeBoolean:
+		switch v := raw.(type) {
+		case bool:
+			row.Value = strconv.FormatBool(v)
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return nil, errors.New("must be true or false")
+			}
+			row.Value = strconv.FormatBool(b)
+		default:
+			return nil, errors.New("must be true or false")
+		}
+	case models.PropertyTypeSelect:
+		s, ok := raw.(string)
+		if !ok {
+			return nil, errors.New("must be a string")
+		}
+		s = strings.TrimSpace(s)
+		for _, o := range def.Options {
+			if o == s {
+				row.Value = s
+				return row, nil
+			}
+		}
+		return nil, fmt.Errorf("must be one of %s", strings.Join(def.Options, ", "))
+	}
+	return row, nil
+}
+
+func typedPropertyValue(typ models.PropertyType, row models.FileProperty) interface{} {
+	switch typ {
+	case models.PropertyTypeNumber:
+		if row.Number != nil {
+			return *row.Number
+		}
+	case models.PropertyTypeBoolean:
+		return row.Value == "true"
+	}
+	return row.Value
+}
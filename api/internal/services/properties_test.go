@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestProperties(t *testing.T) {
+	logger.Init()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.File{}, &models.OutboxEvent{}, &models.PropertyDefinition{}, &models.FileProperty{}); err != nil {
+		t.Fatalf("failed automigrating models: %v", err)
+	}
+	ctx := context.Background()
+	props := NewProperties(db)
+	adminID := uuid.New()
+
+	define := func(def models.PropertyDefinition) models.PropertyDefinition {
+		def.CreatedByID = adminID
+		if err := props.Validate(ctx, &def, ""); err != nil {
+			t.Fatalf("validate %s failed: %v", def.Key, err)
+		}
+		if err := db.Create(&def).Error; err != nil {
+			t.Fatalf("failed creating %s: %v", def.Key, err)
+		}
+		return def
+	}
+	ten, big := 10.0, 1e6
+	contract := define(models.PropertyDefinition{Key: " Contract_Number ", Label: "Contract number", Type: models.PropertyTypeText, Pattern: `C-\d+`, Max: &ten})
+	define(models.PropertyDefinition{Key: "budget", Label: "Budget", Type: models.PropertyTypeNumber, Min: new(float64), Max: &big})
+	define(models.PropertyDefinition{Key: "review_date", Label: "Review date", Type: models.PropertyTypeDate})
+	define(models.PropertyDefinition{Key: "signed", Label: "Signed", Type: models.PropertyTypeBoolean})
+	define(models.PropertyDefinition{Key: "stage", Label: "Stage", Type: models.PropertyTypeSelect, Options: []string{"draft", " final ", "draft"}})
+	if contract.Key != "contract_number" {
+		t.Fatalf("expected the key normalized, got %q", contract.Key)
+	}
+
+	t.Run("invalid definitions", func(t *testing.T) {
+		for name, def := range map[string]models.PropertyDefinition{
+			"bad key":       {Key: "1st", Label: "First", Type: models.PropertyTypeText},
+			"taken key":     {Key: "budget", Label: "Budget", Type: models.PropertyTypeNumber},
+			"no label":      {Key: "owner", Type: models.PropertyTypeText},
+			"bad type":      {Key: "owner", Label: "Owner", Type: "person"},
+			"no options":    {Key: "owner", Label: "Owner", Type: models.PropertyTypeSelect},
+			"bad pattern":   {Key: "owner", Label: "Owner", Type: models.PropertyTypeText, Pattern: "("},
+			"min above max": {Key: "owner", Label: "Owner", Type: models.PropertyTypeNumber, Min: &big, Max: &ten},
+		} {
+			if err := props.Validate(ctx, &def, ""); !errors.Is(err, ErrPropertyDefinitionInvalid) {
+				t.Errorf("%s: expected ErrPropertyDefinitionInvalid, got %v", name, err)
+			}
+		}
+	})
+
+	file := models.File{Name: "msa.pdf", OwnerID: adminID, MimeType: "application/pdf"}
+	db.Create(&file)
+	entry := AuditEntry{UserID: &adminID}
+
+	values, err := props.Set(ctx, &file, map[string]interface{}{
+		"contract_number": "C-1042",
+		"budget":          "2500.50",
+		"review_date":     "2024-06-30T10:00:00Z",
+		"signed":          true,
+		"stage":           "final",
+	}, entry)
+	if err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if values["budget"] != 2500.5 || values["review_date"] != "2024-06-30" || values["signed"] != true || values["stage"] != "final" {
+		t.Fatalf("unexpected values %v", values)
+	}
+	stored, err := props.ForFile(ctx, file.ID)
+	if err != nil || len(stored) != 5 || stored["budget"] != 2500.5 || stored["signed"] != true {
+		t.Fatalf("expected the values stored with their types, got %v, %v", stored, err)
+	}
+
+	t.Run("invalid values change nothing", func(t *testing.T) {
+		for name, in := range map[string]map[string]interface{}{
+			"unknown":       {"client": "Acme"},
+			"pattern":       {"contract_number": "1042"},
+			"too long":      {"contract_number": "C-1234567890"},
+			"not a number":  {"budget": "lots"},
+			"below min":     {"budget": -1.0},
+			"bad date":      {"review_date": "30/06/2024"},
+			"bad boolean":   {"signed": "maybe"},
+			"not an option": {"stage": "archived"},
+		} {
+			if _, err := props.Set(ctx, &file, in, entry); !errors.Is(err, ErrPropertyValueInvalid) {
+				t.Errorf("%s: expected ErrPropertyValueInvalid, got %v", name, err)
+			}
+		}
+		if stored, _ := props.ForFile(ctx, file.ID); len(stored) != 5 {
+			t.Fatalf("expected the values untouched, got %v", stored)
+		}
+	})
+
+	t.Run("set replaces and records the change", func(t *testing.T) {
+		if _, err := props.Set(ctx, &file, map[string]interface{}{"stage": "draft", "budget": nil}, entry); err != nil {
+			t.Fatalf("set failed: %v", err)
+		}
+		stored, _ := props.ForFile(ctx, file.ID)
+		if len(stored) != 1 || stored["stage"] != "draft" {
+			t.Fatalf("expected only the stage left, got %v", stored)
+		}
+		var event models.OutboxEvent
+		if err := db.Where("event_type = ?", "file.properties_update").Order("created_at DESC, id DESC").First(&event).Error; err != nil {
+			t.Fatalf("expected a file.properties_update event: %v", err)
+		}
+		previous, _ := event.Payload["previous"].(map[string]interface{})
+		if previous["stage"] != "final" {
+			t.Fatalf("expected the previous values in the event, got %v", event.Payload)
+		}
+	})
+
+	t.Run("type is fixed once files have values", func(t *testing.T) {
+		stage, _ := props.Definition(ctx, definitionID(t, db, "stage"))
+		stage.Type = models.PropertyTypeText
+		if err := props.Validate(ctx, stage, models.PropertyTypeSelect); !errors.Is(err, ErrPropertyDefinitionInvalid) {
+			t.Fatalf("expected ErrPropertyDefinitionInvalid, got %v", err)
+		}
+	})
+
+	t.Run("deleting a definition removes its values", func(t *testing.T) {
+		stage, _ := props.Definition(ctx, definitionID(t, db, "stage"))
+		if err := props.DeleteDefinition(ctx, stage); err != nil {
+			t.Fatalf("delete failed: %v", err)
+		}
+		var count int64
+		db.Unscoped().Model(&models.FileProperty{}).Where("file_id = ?", file.ID).Count(&count)
+		if count != 0 {
+			t.Fatalf("expected the values deleted, got %d", count)
+		}
+		again := models.PropertyDefinition{Key: "stage", Label: "Stage", Type: models.PropertyTypeText}
+		if err := props.Validate(ctx, &again, ""); err != nil {
+			t.Fatalf("expected the key free again, got %v", err)
+		}
+	})
+}
+
+func definitionID(t *testing.T, db *gorm.DB, key string) uuid.UUID {
+	t.Helper()
+	var def models.PropertyDefinition
+	if err := db.First(&def, "key = ?", key).Error; err != nil {
+		t.Fatalf("failed loading %s: %v", key, err)
+	}
+	return def.ID
+}
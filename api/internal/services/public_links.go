@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPublicLinkNotFound = errors.New("public link not found")
+	ErrPublicPathNotFound = errors.New("nothing at this path under the link")
+	ErrInvalidPublicPath  = errors.New("invalid path")
+)
+
+// NewShareSlug returns a random name for a public link.
+func NewShareSlug() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ResolvePublicLink returns the active public share named slug, provided
+// the file it shares belongs to orgID.
+func (a *AccessService) ResolvePublicLink(ctx context.Context, slug string, orgID *uuid.UUID) (*models.Share, error) {
+	if slug == "" || !a.PublicSharingEnabled(ctx) {
+		return nil, ErrPublicLinkNotFound
+	}
+	var share models.Share
+	err := a.DB.WithContext(ctx).
+		Scopes(a.ActiveSharers("shares")).
+		Where("slug = ? AND share_type IN ?", slug, []models.ShareType{models.ShareTypePublicAnyone, models.ShareTypePublicLoggedIn}).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		First(&share).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPublicLinkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !a.InOrganization(ctx, share.FileID, orgID) {
+		return nil, ErrPublicLinkNotFound
+	}
+	return &share, nil
+}
+
+// ResolvePublicPath finds the file at relPath under the file share shares,
+// looking each name up among the children of the one before it, so the
+// result is always inside the shared subtree. An empty relPath is the
+// shared file itself. Quarantined files are treated as missing, and so is
+// everything below them.
+func (a *AccessService) ResolvePublicPath(ctx context.Context, share *models.Share, relPath string) (*models.File, error) {
+	var file models.File
+	if err := a.DB.WithContext(ctx).First(&file, "id = ?", share.FileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPublicLinkNotFound
+		}
+		return nil, err
+	}
+	if file.QuarantinedAt != nil {
+		return nil, ErrPublicLinkNotFound
+	}
+
+	for _, name := range strings.Split(relPath, "/") {
+		switch name {
+		case "":
+			continue
+		case ".", "..":
+			return nil, ErrInvalidPublicPath
+		}
+		if !file.IsDirectory {
+			return nil, ErrPublicPathNotFound
+		}
+		var child models.File
+		err := a.DB.WithContext(ctx).
+			Where("parent_id = ? AND name = ?", file.ID, name).
+			Order("created_at ASC").
+			First(&child).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPublicPathNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if child.QuarantinedAt != nil {
+			return nil, ErrPublicPathNotFound
+		}
+		file = child
+	}
+	return &file, nil
+}
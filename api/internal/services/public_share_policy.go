@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxPublicShareDays bounds the day limits of the public share policy.
+	MaxPublicShareDays = 3650
+
+	publicSharePolicyJob      = "sharing.public_policy"
+	publicSharePolicyInterval = 24 * time.Hour
+	publicSharePolicyBatch    = 200
+)
+
+var (
+	ErrPublicShareExpiryTooLong    = errors.New("public link expires later than the sharing policy allows")
+	ErrPublicSharePasswordRequired = errors.New("public links can only be made to password-protected files")
+)
+
+// Reasons a public link breaks the policy, as recorded on the audit event
+// of its removal.
+const (
+	PublicShareTooOld           = "max_age"
+	PublicShareExpiryTooLong    = "max_expiry"
+	PublicSharePasswordRequired = "password_required"
+)
+
+// publicSharePolicyMessages are what the owner of a removed link is told.
+var publicSharePolicyMessages = map[string]string{
+	PublicShareTooOld:           "activity.share.policy_too_old",
+	PublicShareExpiryTooLong:    "activity.share.policy_expiry",
+	PublicSharePasswordRequired: "activity.share.policy_password",
+}
+
+// PublicSharePolicy limits public links. Zero values impose nothing.
+type PublicSharePolicy struct {
+	// MaxExpiryDays is the longest a link may live, counted from its
+	// creation.
+	MaxExpiryDays int
+	// RequirePassword only allows links to password-protected files.
+	RequirePassword bool
+	// MaxAgeDays is how old a link may get before it is removed, whatever
+	// its expiry.
+	MaxAgeDays int
+}
+
+// ExpiryLimit is the latest expiry a link created at createdAt may have, or
+// nil when there is no limit.
+func (p PublicSharePolicy) ExpiryLimit(createdAt time.Time) *time.Time {
+	if p.MaxExpiryDays <= 0 {
+		return nil
+	}
+	limit := createdAt.AddDate(0, 0, p.MaxExpiryDays)
+	return &limit
+}
+
+// CheckExpiry rejects an expiry beyond the limit for a link created at
+// createdAt. No expiry at all is beyond any limit.
+func (p PublicSharePolicy) CheckExpiry(createdAt time.Time, expiresAt *time.Time) error {
+	limit := p.ExpiryLimit(createdAt)
+	if limit != nil && (expiresAt == nil || expiresAt.After(*limit)) {
+		return ErrPublicShareExpiryTooLong
+	}
+	return nil
+}
+
+// Apply checks a public share about to be created for file. A share left
+// without an expiry is given the latest one allowed. Private shares are
+// not affected.
+func (p PublicSharePolicy) Apply(share *models.Share, file *models.File, now time.Time) error {
+	if !share.IsPublic() {
+		return nil
+	}
+	if p.RequirePassword && !file.PasswordProtected {
+		return ErrPublicSharePasswordRequired
+	}
+	if share.ExpiresAt == nil {
+		share.ExpiresAt = p.ExpiryLimit(now)
+	}
+	return p.CheckExpiry(now, share.ExpiresAt)
+}
+
+// Violation returns why an existing public link breaks the policy at now,
+// or "" when it does not.
+func (p PublicSharePolicy) Violation(share *models.Share, file *models.File, now time.Time) string {
+	switch {
+	case p.MaxAgeDays > 0 && share.CreatedAt.AddDate(0, 0, p.MaxAgeDays).Before(now):
+		return PublicShareTooOld
+	case p.RequirePassword && !file.PasswordProtected:
+		return PublicSharePasswordRequired
+	case p.CheckExpiry(share.CreatedAt, share.ExpiresAt) != nil:
+		return PublicShareExpiryTooLong
+	}
+	return ""
+}
+
+func (p PublicSharePolicy) enforced() bool {
+	return p.MaxExpiryDays > 0 || p.RequirePassword || p.MaxAgeDays > 0
+}
+
+// PublicSharePolicyEnforcer removes the public links that break the policy
+// in force, such as links made before it was tightened, and tells their
+// owners.
+type PublicSharePolicyEnforcer struct {
+	DB       *gorm.DB
+	Settings *SettingsService
+}
+
+func NewPublicSharePolicyEnforcer(db *gorm.DB, settings *SettingsService) *PublicSharePolicyEnforcer {
+	return &PublicSharePolicyEnforcer{DB: db, Settings: settings}
+}
+
+// Schedule registers the nightly policy check.
+func (e *PublicSharePolicyEnforcer) Schedule(jobs *JobRunner) {
+	jobs.Every(publicSharePolicyJob, publicSharePolicyInterval, func(ctx context.Context, _ *models.Job) error {
+		_, err := e.Run(ctx)
+		return err
+	})
+}
+
+// Run removes every active public link that breaks the policy and returns
+// how many it removed.
+func (e *PublicSharePolicyEnforcer) Run(ctx context.Context) (int, error) {
+	policy := e.Settings.PublicSharePolicy(ctx)
+	if !policy.enforced() {
+		return 0, nil
+	}
+	now := time.Now().UTC()
+
+	type violation struct {
+		share  models.Share
+		reason string
+	}
+	var found []violation
+	var shares []models.Share
+	err := e.DB.WithContext(ctx).
+		Preload("File").
+		Where("share_type IN ?", []models.ShareType{models.ShareTypePublicAnyone, models.ShareTypePublicLoggedIn}).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		FindInBatches(&shares, publicSharePolicyBatch, func(*gorm.DB, int) error {
+			for _, share := range shares {
+				// A link to a deleted file is dead already.
+				if share.File.ID == uuid.Nil {
+					continue
+				}
+				if reason := policy.Violation(&share, &share.File, now); reason != "" {
+					found = append(found, violation{share: share, reason: reason})
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, v := range found {
+		ok, err := e.remove(ctx, policy, v.share, v.reason)
+		if err != nil {
+			return removed, fmt.Errorf("removing share %s: %w", v.share.ID, err)
+		}
+		if ok {
+			removed++
+		}
+	}
+	if removed > 0 {
+		logger.Info("public_share_policy_enforced", map[string]interface{}{"removed": removed})
+	}
+	return removed, nil
+}
+
+// remove deletes one violating link, unless it went away in the meantime,
+// and notifies whoever made it and the file's owner.
+func (e *PublicSharePolicyEnforcer) remove(ctx context.Context, policy PublicSharePolicy, share models.Share, reason string) (bool, error) {
+	removed := false
+	err := e.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.Share{}, "id = ?", share.ID)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		removed = true
+
+		details := map[string]interface{}{
+			"share_id":     share.ID.String(),
+			"share_type":   string(share.ShareType),
+			"file_name":    share.File.Name,
+			"owner_id":     share.File.OwnerID.String(),
+			"shared_by_id": share.SharedByID.String(),
+			"reason":       reason,
+		}
+		if share.ExpiresAt != nil {
+			details["expires_at"] = share.ExpiresAt.Format(time.RFC3339)
+		}
+		if err := RecordEvent(tx, AuditEntry{
+			Action:       "share.policy_remove",
+			ResourceType: "share",
+			ResourceID:   &share.FileID,
+			Details:      details,
+		}); err != nil {
+			return err
+		}
+
+		params := map[string]string{"name": share.File.Name}
+		switch reason {
+		case PublicShareTooOld:
+			params["days"] = strconv.Itoa(policy.MaxAgeDays)
+		case PublicShareExpiryTooLong:
+			params["days"] = strconv.Itoa(policy.MaxExpiryDays)
+		}
+		recipients := []uuid.UUID{share.SharedByID}
+		if share.File.OwnerID != share.SharedByID {
+			recipients = append(recipients, share.File.OwnerID)
+		}
+		activities := make([]models.Activity, 0, len(recipients))
+		for _, uid := range recipients {
+			activities = append(activities, *newActivity(models.Activity{
+				UserID:        uid,
+				ActorID:       uid,
+				Action:        "share.policy_remove",
+				ResourceType:  "file",
+				ResourceID:    &share.FileID,
+				ResourceName:  share.File.Name,
+				MessageKey:    publicSharePolicyMessages[reason],
+				MessageParams: params,
+			}))
+		}
+		return tx.Create(&activities).Error
+	})
+	return removed, err
+}
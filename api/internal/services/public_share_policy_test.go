@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestPublicSharePolicy(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	protected := &models.File{PasswordProtected: true}
+	open := &models.File{}
+
+	t.Run("zero policy imposes nothing", func(t *testing.T) {
+		share := models.Share{ShareType: models.ShareTypePublicAnyone}
+		if err := (PublicSharePolicy{}).Apply(&share, open, now); err != nil || share.ExpiresAt != nil {
+			t.Fatalf("expected the share untouched, got %v, %v", share.ExpiresAt, err)
+		}
+	})
+
+	t.Run("expiry is filled and capped", func(t *testing.T) {
+		policy := PublicSharePolicy{MaxExpiryDays: 30}
+		share := models.Share{ShareType: models.ShareTypePublicAnyone}
+		if err := policy.Apply(&share, open, now); err != nil {
+			t.Fatalf("apply failed: %v", err)
+		}
+		if share.ExpiresAt == nil || !share.ExpiresAt.Equal(now.AddDate(0, 0, 30)) {
+			t.Fatalf("expected the longest allowed expiry, got %v", share.ExpiresAt)
+		}
+
+		late := now.AddDate(0, 0, 31)
+		share = models.Share{ShareType: models.ShareTypePublicLoggedIn, ExpiresAt: &late}
+		if err := policy.Apply(&share, open, now); !errors.Is(err, ErrPublicShareExpiryTooLong) {
+			t.Fatalf("expected ErrPublicShareExpiryTooLong, got %v", err)
+		}
+
+		private := models.Share{ShareType: models.ShareTypePrivate}
+		if err := policy.Apply(&private, open, now); err != nil || private.ExpiresAt != nil {
+			t.Fatalf("expected private shares left alone, got %v, %v", private.ExpiresAt, err)
+		}
+	})
+
+	t.Run("password is required", func(t *testing.T) {
+		policy := PublicSharePolicy{RequirePassword: true}
+		share := models.Share{ShareType: models.ShareTypePublicAnyone}
+		if err := policy.Apply(&share, open, now); !errors.Is(err, ErrPublicSharePasswordRequired) {
+			t.Fatalf("expected ErrPublicSharePasswordRequired, got %v", err)
+		}
+		if err := policy.Apply(&share, protected, now); err != nil {
+			t.Fatalf("expected a protected file to pass, got %v", err)
+		}
+	})
+
+	t.Run("violations of existing links", func(t *testing.T) {
+		policy := PublicSharePolicy{MaxExpiryDays: 30, RequirePassword: true, MaxAgeDays: 90}
+		soon := now.AddDate(0, 0, 5)
+		share := func(ageDays int, expiresAt *time.Time) *models.Share {
+			s := &models.Share{ShareType: models.ShareTypePublicAnyone, ExpiresAt: expiresAt}
+			s.CreatedAt = now.AddDate(0, 0, -ageDays)
+			return s
+		}
+		cases := []struct {
+			name  string
+			share *models.Share
+			file  *models.File
+			want  string
+		}{
+			{"compliant", share(10, &soon), protected, ""},
+			{"too old", share(91, &soon), protected, PublicShareTooOld},
+			{"no password", share(10, &soon), open, PublicSharePasswordRequired},
+			{"never expires", share(10, nil), protected, PublicShareExpiryTooLong},
+		}
+		for _, tc := range cases {
+			if got := policy.Violation(tc.share, tc.file, now); got != tc.want {
+				t.Errorf("%s: expected %q, got %q", tc.name, tc.want, got)
+			}
+		}
+	})
+}
+
+func TestPublicSharePolicyEnforcer(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Setting{}, &models.File{}, &models.Share{}, &models.Activity{}, &models.OutboxEvent{}); err != nil {
+		t.Fatalf("failed automigrating models: %v", err)
+	}
+	settings, _ := NewSettingsService(db, &config.Config{})
+	enforcer := NewPublicSharePolicyEnforcer(db, settings)
+	ctx := context.Background()
+
+	ownerID, sharerID := uuid.New(), uuid.New()
+	file := models.File{Name: "report.pdf", OwnerID: ownerID, MimeType: "application/pdf"}
+	db.Create(&file)
+	newShare := func(sharedBy uuid.UUID, shareType models.ShareType, age time.Duration) models.Share {
+		share := models.Share{FileID: file.ID, SharedByID: sharedBy, ShareType: shareType, Permission: models.SharePermissionView}
+		share.CreatedAt = time.Now().Add(-age)
+		if err := db.Create(&share).Error; err != nil {
+			t.Fatalf("failed creating share: %v", err)
+		}
+		return share
+	}
+	newShare(sharerID, models.ShareTypePublicAnyone, 40*24*time.Hour)
+	fresh := newShare(ownerID, models.ShareTypePublicLoggedIn, time.Hour)
+	private := newShare(ownerID, models.ShareTypePrivate, 400*24*time.Hour)
+
+	if removed, err := enforcer.Run(ctx); err != nil || removed != 0 {
+		t.Fatalf("expected nothing removed without a policy, got %d, %v", removed, err)
+	}
+
+	if _, err := settings.Update(ctx, map[string]json.RawMessage{SettingPublicMaxAgeDays: json.RawMessage(`30`)}, uuid.New()); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	removed, err := enforcer.Run(ctx)
+	if err != nil || removed != 1 {
+		t.Fatalf("expected one link removed, got %d, %v", removed, err)
+	}
+	var remaining []uuid.UUID
+	db.Model(&models.Share{}).Order("created_at").Pluck("id", &remaining)
+	if len(remaining) != 2 || remaining[0] != private.ID || remaining[1] != fresh.ID {
+		t.Fatalf("expected the private share and the fresh link to stay, got %v", remaining)
+	}
+
+	var events int64
+	db.Model(&models.OutboxEvent{}).Where("event_type = ? AND resource_id = ?", "share.policy_remove", file.ID).Count(&events)
+	if events != 1 {
+		t.Fatalf("expected one share.policy_remove event, got %d", events)
+	}
+	var activities []models.Activity
+	db.Where("action = ?", "share.policy_remove").Order("user_id").Find(&activities)
+	if len(activities) != 2 {
+		t.Fatalf("expected the sharer and the owner to be told, got %d activities", len(activities))
+	}
+	for _, a := range activities {
+		if a.MessageKey != "activity.share.policy_too_old" || a.MessageParams["days"] != "30" {
+			t.Fatalf("unexpected activity %+v", a)
+		}
+	}
+
+	if _, err := settings.Update(ctx, map[string]json.RawMessage{SettingPublicRequirePassword: json.RawMessage(`true`)}, uuid.New()); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if removed, err := enforcer.Run(ctx); err != nil || removed != 1 {
+		t.Fatalf("expected the unprotected link removed, got %d, %v", removed, err)
+	}
+}
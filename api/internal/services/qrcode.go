@@ -0,0 +1,199 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+	"github.com/disintegration/imaging"
+)
+
+const (
+	// DefaultQRSize, MinQRSize and MaxQRSize bound the width of rendered
+	// QR codes, in pixels.
+	DefaultQRSize = 256
+	MinQRSize     = 64
+	MaxQRSize     = 2048
+
+	// qrQuietZone is the blank border around the code, in modules.
+	qrQuietZone = 4
+	// qrLogoShare is the fraction of the code's width a logo may cover.
+	// High error correction still reads a code with its centre hidden.
+	qrLogoShare = 0.22
+)
+
+// ErrQRCodeInvalid is wrapped with the reason a QR code cannot be made.
+var ErrQRCodeInvalid = errors.New("invalid QR code request")
+
+// QROptions control how a QR code is rendered.
+type QROptions struct {
+	// Format is "png" or "svg".
+	Format string
+	// Size is the width and height in pixels.
+	Size int
+	// Logo, when set, is drawn on a white square in the middle.
+	Logo image.Image
+}
+
+// RenderQRCode encodes content as a QR code and returns the image and its
+// content type.
+func RenderQRCode(content string, opts QROptions) ([]byte, string, error) {
+	if opts.Size == 0 {
+		opts.Size = DefaultQRSize
+	}
+	if opts.Size < MinQRSize || opts.Size > MaxQRSize {
+		return nil, "", fmt.Errorf("%w: size must be between %d and %d", ErrQRCodeInvalid, MinQRSize, MaxQRSize)
+	}
+	level := qr.M
+	if opts.Logo != nil {
+		level = qr.H
+	}
+	code, err := qr.Encode(content, level, qr.Auto)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch opts.Format {
+	case "", "png":
+		data, err := qrPNG(code, opts)
+		return data, "image/png", err
+	case "svg":
+		data, err := qrSVG(code, opts)
+		return data, "image/svg+xml", err
+	}
+	return nil, "", fmt.Errorf("%w: format must be png or svg", ErrQRCodeInvalid)
+}
+
+// qrModules is the width of code with its quiet zone, in modules.
+func qrModules(code barcode.Barcode) int {
+	return code.Bounds().Dx() + 2*qrQuietZone
+}
+
+func qrDark(code barcode.Barcode, x, y int) bool {
+	r, _, _, _ := code.At(x, y).RGBA()
+	return r == 0
+}
+
+// qrPNG draws whole pixels per module, so the code stays sharp, and
+// centres it in the requested size.
+func qrPNG(code barcode.Barcode, opts QROptions) ([]byte, error) {
+	modules := qrModules(code)
+	scale := opts.Size / modules
+	if scale < 1 {
+		return nil, fmt.Errorf("%w: size is too small for this link; use at least %d", ErrQRCodeInvalid, modules)
+	}
+	offset := (opts.Size - modules*scale) / 2
+
+	img := image.NewRGBA(image.Rect(0, 0, opts.Size, opts.Size))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	dim := code.Bounds().Dx()
+	for y := 0; y < dim; y++ {
+		for x := 0; x < dim; x++ {
+			if qrDark(code, x, y) {
+				px := offset + (x+qrQuietZone)*scale
+				py := offset + (y+qrQuietZone)*scale
+				draw.Draw(img, image.Rect(px, py, px+scale, py+scale), image.Black, image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	if opts.Logo != nil {
+		side := int(float64(dim*scale) * qrLogoShare)
+		logo := imaging.Fit(opts.Logo, side, side, imaging.Lanczos)
+		pad := scale
+		lb := logo.Bounds()
+		center := opts.Size / 2
+		backing := image.Rect(center-lb.Dx()/2-pad, center-lb.Dy()/2-pad, center+(lb.Dx()+1)/2+pad, center+(lb.Dy()+1)/2+pad)
+		draw.Draw(img, backing, image.White, image.Point{}, draw.Src)
+		at := image.Pt(center-lb.Dx()/2, center-lb.Dy()/2)
+		draw.Draw(img, lb.Sub(lb.Min).Add(at), logo, lb.Min, draw.Over)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// qrSVG draws the dark modules as one path in a viewBox measured in
+// modules, so the code scales cleanly to any size.
+func qrSVG(code barcode.Barcode, opts QROptions) ([]byte, error) {
+	modules := qrModules(code)
+	dim := code.Bounds().Dx()
+
+	var path strings.Builder
+	for y := 0; y < dim; y++ {
+		for x := 0; x < dim; x++ {
+			if qrDark(code, x, y) {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x+qrQuietZone, y+qrQuietZone)
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, opts.Size, opts.Size, modules, modules)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/>`, modules, modules)
+	fmt.Fprintf(&b, `<path d="%s" fill="#000"/>`, path.String())
+
+	if opts.Logo != nil {
+		// The logo is embedded as a PNG at a resolution that stays sharp
+		// at the requested size.
+		side := float64(dim) * qrLogoShare
+		px := int(float64(opts.Size) * side / float64(modules))
+		logo := imaging.Fit(opts.Logo, px, px, imaging.Lanczos)
+		var logoPNG bytes.Buffer
+		if err := png.Encode(&logoPNG, logo); err != nil {
+			return nil, err
+		}
+		lb := logo.Bounds()
+		w := side
+		h := side * float64(lb.Dy()) / float64(lb.Dx())
+		if lb.Dy() > lb.Dx() {
+			w, h = side*float64(lb.Dx())/float64(lb.Dy()), side
+		}
+		center := float64(modules) / 2
+		fmt.Fprintf(&b, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="#fff"/>`, center-w/2-1, center-h/2-1, w+2, h+2)
+		fmt.Fprintf(&b, `<image x="%.2f" y="%.2f" width="%.2f" height="%.2f" href="data:image/png;base64,%s"/>`,
+			center-w/2, center-h/2, w, h, base64.StdEncoding.EncodeToString(logoPNG.Bytes()))
+	}
+	b.WriteString("</svg>\n")
+	return b.Bytes(), nil
+}
+
+// LoadQRLogo reads the PNG or JPEG logo to put in QR codes. An empty path
+// means no logo.
+func LoadQRLogo(path string) (image.Image, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	logo, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	return flattenLogo(logo), nil
+}
+
+// flattenLogo puts a transparent logo on white, as it will be shown.
+func flattenLogo(logo image.Image) image.Image {
+	out := image.NewRGBA(logo.Bounds())
+	draw.Draw(out, out.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(out, out.Bounds(), logo, logo.Bounds().Min, draw.Over)
+	return out
+}
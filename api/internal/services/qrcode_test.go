@@ -0,0 +1,92 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestRenderQRCode(t *testing.T) {
+	const link = "https://docs.example.com/shared/0b9f3c2e-6f4a-4d8e-9a51-3c7e2d1f0a44"
+
+	decode := func(t *testing.T, data []byte) image.Image {
+		t.Helper()
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("expected a PNG, got %v", err)
+		}
+		return img
+	}
+	dark := func(c color.Color) bool {
+		r, g, b, _ := c.RGBA()
+		return r < 0x8000 && g < 0x8000 && b < 0x8000
+	}
+
+	t.Run("png", func(t *testing.T) {
+		data, contentType, err := RenderQRCode(link, QROptions{Size: 300})
+		if err != nil || contentType != "image/png" {
+			t.Fatalf("expected a PNG, got %q, %v", contentType, err)
+		}
+		img := decode(t, data)
+		if b := img.Bounds(); b.Dx() != 300 || b.Dy() != 300 {
+			t.Fatalf("expected 300x300, got %v", b)
+		}
+		if dark(img.At(0, 0)) || dark(img.At(299, 299)) {
+			t.Fatal("expected a light quiet zone")
+		}
+		// The top-left finder pattern starts right after the quiet zone.
+		var found bool
+		for i := 0; i < 60 && !found; i++ {
+			found = dark(img.At(i, i))
+		}
+		if !found {
+			t.Fatal("expected the finder pattern in the top-left corner")
+		}
+	})
+
+	t.Run("logo", func(t *testing.T) {
+		logo := image.NewRGBA(image.Rect(0, 0, 40, 20))
+		for y := 0; y < 20; y++ {
+			for x := 0; x < 40; x++ {
+				logo.Set(x, y, color.RGBA{R: 200, A: 255})
+			}
+		}
+		data, _, err := RenderQRCode(link, QROptions{Size: 512, Logo: logo})
+		if err != nil {
+			t.Fatalf("render failed: %v", err)
+		}
+		r, g, b, _ := decode(t, data).At(256, 256).RGBA()
+		if r>>8 < 150 || g>>8 > 50 || b>>8 > 50 {
+			t.Fatalf("expected the logo in the middle, got %d,%d,%d", r>>8, g>>8, b>>8)
+		}
+	})
+
+	t.Run("svg", func(t *testing.T) {
+		data, contentType, err := RenderQRCode(link, QROptions{Format: "svg", Size: 128})
+		if err != nil || contentType != "image/svg+xml" {
+			t.Fatalf("expected an SVG, got %q, %v", contentType, err)
+		}
+		svg := string(data)
+		if !strings.Contains(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="128" height="128"`) || !strings.Contains(svg, `<path d="M4 4h1v1h-1z`) {
+			t.Fatalf("unexpected SVG %s", svg)
+		}
+	})
+
+	for name, opts := range map[string]QROptions{
+		"too small": {Size: MinQRSize - 1},
+		"too large": {Size: MaxQRSize + 1},
+		"format":    {Format: "gif"},
+	} {
+		if _, _, err := RenderQRCode(link, opts); !errors.Is(err, ErrQRCodeInvalid) {
+			t.Errorf("%s: expected ErrQRCodeInvalid, got %v", name, err)
+		}
+	}
+
+	if logo, err := LoadQRLogo(""); logo != nil || err != nil {
+		t.Fatalf("expected no logo for an empty path, got %v, %v", logo, err)
+	}
+}
@@ -0,0 +1,440 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	driveRootFolder = "root"
+	driveFolderType = "application/vnd.google-apps.folder"
+	driveNativeType = "application/vnd.google-apps."
+)
+
+// driveExports maps the Google-native types that can be imported to the
+// format they are exported in. Other native types (forms, sites,
+// shortcuts) have no file to copy and are left out.
+var driveExports = map[string]struct{ mimeType, ext string }{
+	"application/vnd.google-apps.document":     {"application/vnd.openxmlformats-officedocument.wordprocessingml.document", ".docx"},
+	"application/vnd.google-apps.spreadsheet":  {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ".xlsx"},
+	"application/vnd.google-apps.presentation": {"application/vnd.openxmlformats-officedocument.presentationml.presentation", ".pptx"},
+	"application/vnd.google-apps.drawing":      {"application/pdf", ".pdf"},
+}
+
+// davClient speaks the little of WebDAV an import needs: PROPFIND to list
+// a collection and GET to read a file. Paths are relative to base.
+type davClient struct {
+	http     *http.Client
+	base     *url.URL
+	username string
+	password string
+}
+
+type davItem struct {
+	path    string
+	isDir   bool
+	size    int64
+	modTime time.Time
+}
+
+const davPropfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontentlength/><d:getlastmodified/></d:prop></d:propfind>`
+
+type davMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+				ContentLength int64  `xml:"getcontentlength"`
+				LastModified  string `xml:"getlastmodified"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+func (c *davClient) url(rel string, dir bool) string {
+	u := *c.base
+	u.Path = c.base.Path + rel
+	if dir && rel != "" {
+		u.Path += "/"
+	}
+	return u.String()
+}
+
+func (c *davClient) do(ctx context.Context, method, target, depth string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.username, c.password)
+	if depth != "" {
+		req.Header.Set("Depth", depth)
+		req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		resp.Body.Close()
+		return nil, ErrIntegrationAuth
+	case resp.StatusCode >= 300:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s %s answered %d", ErrRemoteUnavailable, method, target, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// propfind lists the collection rel, or describes it alone at depth 0.
+// The collection itself is left out of a depth 1 listing.
+func (c *davClient) propfind(ctx context.Context, rel, depth string) ([]davItem, error) {
+	resp, err := c.do(ctx, "PROPFIND", c.url(rel, true), depth, strings.NewReader(davPropfindBody))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("%w: %s is not a WebDAV collection", ErrRemoteUnavailable, c.url(rel, true))
+	}
+
+	var status davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("%w: reading PROPFIND response: %v", ErrRemoteUnavailable, err)
+	}
+	items := make([]davItem, 0, len(status.Responses))
+	for _, r := range status.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		p, ok := strings.CutPrefix(href.Path, c.base.Path)
+		if !ok {
+			p, ok = strings.CutPrefix(href.Path+"/", c.base.Path)
+		}
+		if !ok {
+			continue
+		}
+		item := davItem{path: strings.Trim(p, "/")}
+		if depth != "0" && item.path == rel {
+			continue
+		}
+		for _, ps := range r.Propstat {
+			if ps.Prop.ResourceType.Collection != nil {
+				item.isDir = true
+			}
+			if ps.Prop.ContentLength > 0 {
+				item.size = ps.Prop.ContentLength
+			}
+			if t, err := http.ParseTime(ps.Prop.LastModified); err == nil {
+				item.modTime = t
+			}
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].path < items[j].path })
+	return items, nil
+}
+
+func (c *davClient) browse(ctx context.Context, folder string) ([]RemoteEntry, error) {
+	items, err := c.propfind(ctx, folder, "1")
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]RemoteEntry, 0, len(items))
+	for _, item := range items {
+		entry := RemoteEntry{ID: item.path, Name: path.Base(item.path), IsDir: item.isDir, Size: item.size}
+		if !item.modTime.IsZero() {
+			modTime := item.modTime
+			entry.ModifiedAt = &modTime
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// webdavImportSource reads the tree under root on a WebDAV server, one
+// PROPFIND per folder, in the same order as a directory walk.
+type webdavImportSource struct {
+	client *davClient
+	root   string
+}
+
+func (s *webdavImportSource) Walk(ctx context.Context, after string, fn func(ImportEntry) error) error {
+	return s.walk(ctx, "", after, fn)
+}
+
+func (s *webdavImportSource) walk(ctx context.Context, dir, after string, fn func(ImportEntry) error) error {
+	items, err := s.client.propfind(ctx, path.Join(s.root, dir), "1")
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		key := path.Join(dir, path.Base(item.path))
+		if after != "" && !walkOrderAfter(key, after) {
+			if item.isDir && strings.HasPrefix(after, key+"/") {
+				if err := s.walk(ctx, key, after, fn); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !item.isDir {
+			if err := fn(ImportEntry{Key: key, Size: item.size, ModTime: item.modTime}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(ImportEntry{Key: key, IsDir: true}); err != nil {
+			return err
+		}
+		if err := s.walk(ctx, key, after, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *webdavImportSource) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.client.do(ctx, http.MethodGet, s.client.url(path.Join(s.root, key), false), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// driveClient calls the Drive v3 API with an authorized client.
+type driveClient struct {
+	http *http.Client
+	api  string
+}
+
+type driveFile struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	MimeType     string    `json:"mimeType"`
+	Size         string    `json:"size"`
+	ModifiedTime time.Time `json:"modifiedTime"`
+	// key is the name the file is imported under.
+	key string
+}
+
+func (c *driveClient) get(ctx context.Context, endpoint string, query url.Values) (*http.Response, error) {
+	target := c.api + endpoint
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrIntegrationAuth) {
+			return nil, ErrIntegrationAuth
+		}
+		return nil, remoteError(err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		resp.Body.Close()
+		return nil, ErrIntegrationAuth
+	case resp.StatusCode >= 300:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: Drive answered %d for %s", ErrRemoteUnavailable, resp.StatusCode, endpoint)
+	}
+	return resp, nil
+}
+
+// account returns the email address of the authorized Drive user.
+func (c *driveClient) account(ctx context.Context) (string, error) {
+	resp, err := c.get(ctx, "/about", url.Values{"fields": {"user(emailAddress)"}})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var about struct {
+		User struct {
+			EmailAddress string `json:"emailAddress"`
+		} `json:"user"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&about); err != nil {
+		return "", fmt.Errorf("%w: reading Drive account: %v", ErrRemoteUnavailable, err)
+	}
+	return about.User.EmailAddress, nil
+}
+
+// children lists the importable files in a folder, sorted by the name they
+// are imported under. Drive allows slashes and duplicate names, so names
+// are made safe and unique within the folder, and exported files get the
+// extension of their export format.
+func (c *driveClient) children(ctx context.Context, folderID string) ([]driveFile, error) {
+	query := url.Values{
+		"q":                         {fmt.Sprintf("'%s' in parents and trashed = false", strings.ReplaceAll(folderID, "'", `\'`))},
+		"fields":                    {"nextPageToken,files(id,name,mimeType,size,modifiedTime)"},
+		"pageSize":                  {"1000"},
+		"supportsAllDrives":         {"true"},
+		"includeItemsFromAllDrives": {"true"},
+	}
+	var files []driveFile
+	for {
+		resp, err := c.get(ctx, "/files", query)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			NextPageToken string      `json:"nextPageToken"`
+			Files         []driveFile `json:"files"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: reading Drive listing: %v", ErrRemoteUnavailable, err)
+		}
+		for _, f := range page.Files {
+			name := strings.NewReplacer("/", "_", "\\", "_").Replace(strings.TrimSpace(f.Name))
+			if name == "" || name == "." || name == ".." {
+				name = f.ID
+			}
+			if export, ok := driveExports[f.MimeType]; ok {
+				name += export.ext
+			} else if f.MimeType != driveFolderType && strings.HasPrefix(f.MimeType, driveNativeType) {
+				continue
+			}
+			f.key = name
+			files = append(files, f)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		query.Set("pageToken", page.NextPageToken)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].key != files[j].key {
+			return files[i].key < files[j].key
+		}
+		return files[i].ID < files[j].ID
+	})
+	used := map[string]bool{}
+	for i := range files {
+		name := files[i].key
+		if used[name] {
+			ext := path.Ext(name)
+			for n := 2; used[name]; n++ {
+				name = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(files[i].key, ext), n, ext)
+			}
+		}
+		used[name] = true
+		files[i].key = name
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].key < files[j].key })
+	return files, nil
+}
+
+func (f driveFile) size() int64 {
+	if _, ok := driveExports[f.MimeType]; ok {
+		return -1
+	}
+	size, _ := strconv.ParseInt(f.Size, 10, 64)
+	return size
+}
+
+func (c *driveClient) browse(ctx context.Context, folderID string) ([]RemoteEntry, error) {
+	files, err := c.children(ctx, folderID)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]RemoteEntry, 0, len(files))
+	for _, f := range files {
+		modTime := f.ModifiedTime
+		entries = append(entries, RemoteEntry{
+			ID:         f.ID,
+			Name:       f.key,
+			IsDir:      f.MimeType == driveFolderType,
+			Size:       max(f.size(), 0),
+			MimeType:   f.MimeType,
+			ModifiedAt: &modTime,
+		})
+	}
+	return entries, nil
+}
+
+// driveImportSource reads the tree under the folder root. Open looks files
+// up by the keys the walk handed out, which is how the importer uses it.
+type driveImportSource struct {
+	client *driveClient
+	root   string
+	files  map[string]driveFile
+}
+
+func (s *driveImportSource) Walk(ctx context.Context, after string, fn func(ImportEntry) error) error {
+	return s.walk(ctx, s.root, "", after, fn)
+}
+
+func (s *driveImportSource) walk(ctx context.Context, folderID, dir, after string, fn func(ImportEntry) error) error {
+	files, err := s.client.children(ctx, folderID)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		key := path.Join(dir, f.key)
+		isDir := f.MimeType == driveFolderType
+		if after != "" && !walkOrderAfter(key, after) {
+			if isDir && strings.HasPrefix(after, key+"/") {
+				if err := s.walk(ctx, f.ID, key, after, fn); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !isDir {
+			s.files[key] = f
+			err := fn(ImportEntry{Key: key, Size: f.size(), ModTime: f.ModifiedTime})
+			delete(s.files, key)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(ImportEntry{Key: key, IsDir: true}); err != nil {
+			return err
+		}
+		if err := s.walk(ctx, f.ID, key, after, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *driveImportSource) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, ok := s.files[key]
+	if !ok {
+		return nil, fmt.Errorf("%s was not listed by this walk", key)
+	}
+	var resp *http.Response
+	var err error
+	if export, ok := driveExports[f.MimeType]; ok {
+		resp, err = s.client.get(ctx, "/files/"+url.PathEscape(f.ID)+"/export", url.Values{"mimeType": {export.mimeType}})
+	} else {
+		resp, err = s.client.get(ctx, "/files/"+url.PathEscape(f.ID), url.Values{"alt": {"media"}, "supportsAllDrives": {"true"}})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/storage"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+)
+
+const (
+	renditionPrefix = "renditions/"
+	watermarkPrefix = "watermarks/"
+	// MaxRenditionPages is the most leading pages a PDF can be cut to.
+	MaxRenditionPages = 50
+)
+
+// RenditionWidths are the widths images are scaled down to. Requests are
+// rounded up to one of them so the cache stays small.
+var RenditionWidths = []int{320, 640, 1280, 1920}
+
+// RenditionStore is the object storage renditions are rendered from and
+// cached in.
+type RenditionStore interface {
+	Stat(ctx context.Context, key string) (storage.ObjectInfo, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Upload(ctx context.Context, objectName string, reader io.Reader, size int64, contentType string) error
+	Delete(ctx context.Context, objectName string) error
+	ListObjects(ctx context.Context, prefix, startAfter string, fn func(storage.ObjectInfo) error) error
+}
+
+// RenditionService makes reduced previews for a quick look at large files:
+// images scaled down to one of RenditionWidths and PDFs cut to their first
+// pages. Each rendition is made once and cached under
+// renditions/<file>/<version>/, where the version follows the source
+// object and its checksum, so an edit is rendered afresh. Writing a new
+// version removes the file's older ones.
+type RenditionService struct {
+	Store      RenditionStore
+	Gotenberg  config.GotenbergConfig
+	HTTPClient *http.Client
+	// Pool, when set, bounds and guards the page cuts sent to Gotenberg.
+	Pool *GotenbergPool
+	// Rasterizer, when set, renders PDF pages as tiled images.
+	Rasterizer PageRasterizer
+}
+
+func NewRenditionService(store RenditionStore, gotenberg config.GotenbergConfig) *RenditionService {
+	return &RenditionService{
+		Store:      store,
+		Gotenberg:  gotenberg,
+		HTTPClient: &http.Client{Timeout: 120 * time.Second},
+	}
+}
+
+// RenditionWidth rounds a requested width up to the nearest of
+// RenditionWidths, capped at the largest.
+func RenditionWidth(requested int) int {
+	for _, width := range RenditionWidths {
+		if requested <= width {
+			return width
+		}
+	}
+	return RenditionWidths[len(RenditionWidths)-1]
+}
+
+// Image returns the key of the image at sourceKey scaled down to width,
+// keeping its aspect ratio. Images already narrower are re-encoded at
+// their own size. PNG and GIF sources stay PNG so transparency survives;
+// everything else becomes JPEG.
+func (s *RenditionService) Image(ctx context.Context, file *models.File, sourceKey string, width int) (string, string, error) {
+	width = RenditionWidth(width)
+	format, contentType, ext := imaging.JPEG, "image/jpeg", "jpg"
+	if file.MimeType == "image/png" || file.MimeType == "image/gif" {
+		format, contentType, ext = imaging.PNG, "image/png", "png"
+	}
+	name := fmt.Sprintf("w%d.%s", width, ext)
+	key, err := s.cached(ctx, renditionPrefix, file, sourceKey, name, contentType, func(ctx context.Context, src io.Reader) ([]byte, error) {
+		img, err := decodeSourceImage(src)
+		if err != nil {
+			return nil, err
+		}
+		if img.Bounds().Dx() > width {
+			img = imaging.Resize(img, width, 0, imaging.Lanczos)
+		}
+		var buf bytes.Buffer
+		if err := imaging.Encode(&buf, img, format, imaging.JPEGQuality(imageThumbnailJPEGQuality)); err != nil {
+			return nil, fmt.Errorf("image encode failed: %w", err)
+		}
+		return buf.Bytes(), nil
+	})
+	return key, contentType, err
+}
+
+// Pages returns the key of the PDF at sourceKey cut to its first pages
+// pages, which Gotenberg's PDF engines do.
+func (s *RenditionService) Pages(ctx context.Context, file *models.File, sourceKey string, pages int) (string, error) {
+	if pages > MaxRenditionPages {
+		pages = MaxRenditionPages
+	}
+	name := fmt.Sprintf("pages-%d.pdf", pages)
+	return s.cached(ctx, renditionPrefix, file, sourceKey, name, "application/pdf", func(ctx context.Context, src io.Reader) ([]byte, error) {
+		var out []byte
+		err := s.Pool.Do(ctx, func(ctx context.Context) error {
+			var err error
+			out, err = s.postPDF(ctx, "split", src, map[string]string{
+				"splitMode":  "pages",
+				"splitSpan":  "1-" + strconv.Itoa(pages),
+				"splitUnify": "true",
+			})
+			return err
+		})
+		return out, err
+	})
+}
+
+// cached returns the key of the named rendition of sourceKey under prefix,
+// rendering and storing it first when it is not there yet.
+func (s *RenditionService) cached(ctx context.Context, prefix string, file *models.File, sourceKey, name, contentType string, render func(context.Context, io.Reader) ([]byte, error)) (string, error) {
+	version := renditionVersion(file, sourceKey)
+	key := prefix + file.ID.String() + "/" + version + "/" + name
+	if _, err := s.Store.Stat(ctx, key); err == nil {
+		return key, nil
+	} else if !errors.Is(err, storage.ErrObjectNotFound) {
+		return "", err
+	}
+
+	src, err := s.Store.Get(ctx, sourceKey)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	data, err := render(ctx, src)
+	if err != nil {
+		return "", err
+	}
+	if err := s.Store.Upload(ctx, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		return "", err
+	}
+	s.purge(ctx, prefix, file.ID, version)
+	return key, nil
+}
+
+// renditionVersion names the state of the source a rendition was made
+// from. The checksum changes with every edit; files without one fall back
+// to their last update.
+func renditionVersion(file *models.File, sourceKey string) string {
+	state := file.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	if file.Checksum != nil && *file.Checksum != "" {
+		state = *file.Checksum
+	}
+	sum := sha256.Sum256([]byte(sourceKey + "\x00" + state))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Purge removes every cached rendition, watermarked copy and page tile of
+// a file, for when it is deleted.
+func (s *RenditionService) Purge(ctx context.Context, fileID uuid.UUID) {
+	for _, prefix := range []string{renditionPrefix, watermarkPrefix, pagesPrefix} {
+		s.purge(ctx, prefix, fileID, "")
+	}
+}
+
+// purge removes a file's objects under root other than those of keep.
+// Failures are logged; a leftover rendition is only wasted space.
+func (s *RenditionService) purge(ctx context.Context, root string, fileID uuid.UUID, keep string) {
+	prefix := root + fileID.String() + "/"
+	var stale []string
+	if err := s.Store.ListObjects(ctx, prefix, "", func(obj storage.ObjectInfo) error {
+		if keep == "" || !strings.HasPrefix(obj.Key, prefix+keep+"/") {
+			stale = append(stale, obj.Key)
+		}
+		return nil
+	}); err != nil {
+		logger.Error("rendition_purge_list_failed", err, map[string]interface{}{
+			"file_id": fileID.String(),
+		})
+		return
+	}
+	for _, key := range stale {
+		if err := s.Store.Delete(ctx, key); err != nil {
+			logger.Error("rendition_purge_failed", err, map[string]interface{}{
+				"key": key,
+			})
+		}
+	}
+}
+
+// postPDF posts the PDF to one of Gotenberg's PDF engine routes with the
+// given form fields and returns the resulting document.
+func (s *RenditionService) postPDF(ctx context.Context, route string, src io.Reader, fields map[string]string) ([]byte, error) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		defer pw.Close()
+		defer writer.Close()
+		for field, value := range fields {
+			if err := writer.WriteField(field, value); err != nil {
+				_ = pw.CloseWithError(err)
+				return
+			}
+		}
+		part, err := writer.CreateFormFile("files", "document.pdf")
+		if err != nil {
+			_ = pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(part, src); err != nil {
+			_ = pw.CloseWithError(err)
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(s.Gotenberg.URL, "/")+"/forms/pdfengines/"+route, pr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, gotenbergDown(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		err := fmt.Errorf("gotenberg %s failed: %s", route, string(body))
+		if resp.StatusCode >= 500 {
+			return nil, gotenbergDown(err)
+		}
+		return nil, err
+	}
+	return io.ReadAll(resp.Body)
+}
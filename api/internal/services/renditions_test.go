@@ -0,0 +1,107 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+)
+
+func TestRenditionService(t *testing.T) {
+	logger.Init()
+	ctx := context.Background()
+	bucket := newMemoryBucket()
+
+	var photo bytes.Buffer
+	if err := imaging.Encode(&photo, imaging.New(1000, 500, color.NRGBA{R: 200, A: 255}), imaging.JPEG); err != nil {
+		t.Fatalf("failed encoding source image: %v", err)
+	}
+	_ = bucket.Upload(ctx, "owner/photo.jpg", bytes.NewReader(photo.Bytes()), int64(photo.Len()), "image/jpeg")
+	checksum := "aaa"
+	file := &models.File{BaseModel: models.BaseModel{ID: uuid.New(), UpdatedAt: time.Now()}, MimeType: "image/jpeg", StoragePath: "owner/photo.jpg", Checksum: &checksum}
+
+	var splits []string
+	gotenberg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/forms/pdfengines/split" {
+			http.NotFound(w, r)
+			return
+		}
+		splits = append(splits, r.FormValue("splitSpan"))
+		w.Header().Set("Content-Type", "application/pdf")
+		_, _ = io.WriteString(w, "%PDF-cut")
+	}))
+	defer gotenberg.Close()
+	renditions := NewRenditionService(bucket, config.GotenbergConfig{URL: gotenberg.URL})
+
+	t.Run("scales images down to a cached width", func(t *testing.T) {
+		key, contentType, err := renditions.Image(ctx, file, file.StoragePath, 500)
+		if err != nil {
+			t.Fatalf("failed rendering: %v", err)
+		}
+		if contentType != "image/jpeg" || !strings.HasSuffix(key, "/w640.jpg") {
+			t.Fatalf("expected a 640px JPEG, got %s as %s", key, contentType)
+		}
+		img, _, err := image.Decode(bytes.NewReader(bucket.objects[key]))
+		if err != nil {
+			t.Fatalf("failed decoding rendition: %v", err)
+		}
+		if b := img.Bounds(); b.Dx() != 640 || b.Dy() != 320 {
+			t.Fatalf("expected 640x320, got %dx%d", b.Dx(), b.Dy())
+		}
+
+		delete(bucket.objects, file.StoragePath)
+		if again, _, err := renditions.Image(ctx, file, file.StoragePath, 600); err != nil || again != key {
+			t.Fatalf("expected the cached rendition, got %s, %v", again, err)
+		}
+		_ = bucket.Upload(ctx, "owner/photo.jpg", bytes.NewReader(photo.Bytes()), int64(photo.Len()), "image/jpeg")
+	})
+
+	t.Run("renders edits afresh and drops the old version", func(t *testing.T) {
+		old, _, _ := renditions.Image(ctx, file, file.StoragePath, 640)
+		edited := "bbb"
+		file.Checksum = &edited
+		key, _, err := renditions.Image(ctx, file, file.StoragePath, 320)
+		if err != nil {
+			t.Fatalf("failed rendering: %v", err)
+		}
+		if _, ok := bucket.objects[old]; ok || key == old {
+			t.Fatalf("expected the old version to be removed")
+		}
+	})
+
+	t.Run("cuts PDFs to their first pages", func(t *testing.T) {
+		_ = bucket.Upload(ctx, "owner/doc.pdf", strings.NewReader("%PDF-full"), 9, "application/pdf")
+		doc := &models.File{BaseModel: models.BaseModel{ID: uuid.New()}, MimeType: "application/pdf", StoragePath: "owner/doc.pdf"}
+		key, err := renditions.Pages(ctx, doc, doc.StoragePath, 3)
+		if err != nil {
+			t.Fatalf("failed cutting: %v", err)
+		}
+		if string(bucket.objects[key]) != "%PDF-cut" || len(splits) != 1 || splits[0] != "1-3" {
+			t.Fatalf("expected one split of pages 1-3, got %v", splits)
+		}
+		if _, err := renditions.Pages(ctx, doc, doc.StoragePath, 3); err != nil || len(splits) != 1 {
+			t.Fatalf("expected the cut to be cached, got %v", splits)
+		}
+
+		renditions.Purge(ctx, doc.ID)
+		if _, ok := bucket.objects[key]; ok {
+			t.Fatal("expected the purge to remove the rendition")
+		}
+	})
+
+	if got := RenditionWidth(5000); got != 1920 {
+		t.Fatalf("expected widths to be capped at 1920, got %d", got)
+	}
+}
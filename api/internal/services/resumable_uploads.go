@@ -0,0 +1,373 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ResumableUploadTTL is how long an unfinished resumable upload is kept.
+const ResumableUploadTTL = 24 * time.Hour
+
+// uploadProgressBlockSize is the smallest block a progress bitmap reports
+// on. Larger uploads use larger blocks, so the bitmap stays at most
+// uploadProgressMaxBlocks long.
+const (
+	uploadProgressBlockSize = 1024 * 1024
+	uploadProgressMaxBlocks = 4096
+)
+
+var (
+	ErrUploadNotFound          = errors.New("upload not found")
+	ErrUploadExpired           = errors.New("upload has expired")
+	ErrUploadOffsetMismatch    = errors.New("Upload-Offset does not match the bytes received so far")
+	ErrUploadLengthExceeded    = errors.New("the request carries more bytes than the upload has left")
+	ErrUploadChecksumAlgorithm = errors.New("unsupported checksum algorithm")
+	ErrUploadChecksumMismatch  = errors.New("the request body does not match its checksum")
+	ErrUploadIncomplete        = errors.New("upload has not been fully received")
+)
+
+// UploadChecksumAlgorithms are the algorithms accepted in Upload-Checksum,
+// in the order they are advertised.
+var UploadChecksumAlgorithms = []string{"sha1", "sha256", "md5"}
+
+var uploadChecksumHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"md5":    md5.New,
+}
+
+// UploadChecksum is a parsed Upload-Checksum header: the checksum of the
+// body of one request.
+type UploadChecksum struct {
+	Algorithm string
+	Sum       []byte
+}
+
+// ParseUploadChecksum parses an Upload-Checksum header, "<algorithm>
+// <base64 checksum>".
+func ParseUploadChecksum(header string) (*UploadChecksum, error) {
+	algorithm, encoded, ok := strings.Cut(strings.TrimSpace(header), " ")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed Upload-Checksum", ErrUploadChecksumAlgorithm)
+	}
+	algorithm = strings.ToLower(algorithm)
+	if _, ok := uploadChecksumHashes[algorithm]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUploadChecksumAlgorithm, algorithm)
+	}
+	sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("%w: checksum is not base64", ErrUploadChecksumAlgorithm)
+	}
+	return &UploadChecksum{Algorithm: algorithm, Sum: sum}, nil
+}
+
+// AssembledUpload is the file a finished upload was joined into.
+type AssembledUpload struct {
+	Key          string
+	Size         int64
+	Checksum     string
+	DetectedType string
+}
+
+// ResumableUploads keeps the bytes of TUS uploads until they are complete.
+// Each request's body is stored as its own chunk, and the chunks are
+// joined into the file once the last byte arrives, much as the transfer
+// relay does for direct transfers.
+type ResumableUploads struct {
+	DB    *gorm.DB
+	Store TransferStore
+}
+
+func NewResumableUploads(db *gorm.DB, store TransferStore) *ResumableUploads {
+	return &ResumableUploads{DB: db, Store: store}
+}
+
+// uploadChunkKey names chunks by their own ID rather than their offset, so
+// a request that loses a race for an offset cannot clobber the winner's
+// bytes.
+func uploadChunkKey(uploadID, chunkID uuid.UUID) string {
+	return fmt.Sprintf("resumable/%s/%s", uploadID, chunkID)
+}
+
+// Create records a new upload, which expires after ResumableUploadTTL.
+func (u *ResumableUploads) Create(ctx context.Context, upload *models.Upload) error {
+	upload.Status = models.UploadStatusReceiving
+	upload.Offset = 0
+	upload.ExpiresAt = time.Now().Add(ResumableUploadTTL)
+	return u.DB.WithContext(ctx).Create(upload).Error
+}
+
+// Get loads an upload of ownerID. Uploads of other users are not found.
+func (u *ResumableUploads) Get(ctx context.Context, id, ownerID uuid.UUID) (*models.Upload, error) {
+	var upload models.Upload
+	if err := u.DB.WithContext(ctx).Where("id = ? AND owner_id = ?", id, ownerID).First(&upload).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+	if upload.Status == models.UploadStatusReceiving && time.Now().After(upload.ExpiresAt) {
+		return nil, ErrUploadExpired
+	}
+	return &upload, nil
+}
+
+// Append stores body as the bytes of upload starting at offset, which must
+// be where the upload left off. When checksum is given the body must match
+// it; a mismatched or oversized body is thrown away and the upload stays
+// where it was. The upload's new offset is returned.
+func (u *ResumableUploads) Append(ctx context.Context, upload *models.Upload, offset int64, body io.Reader, checksum *UploadChecksum) (int64, error) {
+	if upload.Status != models.UploadStatusReceiving || offset != upload.Offset {
+		return upload.Offset, ErrUploadOffsetMismatch
+	}
+
+	remaining := upload.Length - upload.Offset
+	var sum hash.Hash
+	reader := io.LimitReader(body, remaining+1)
+	if checksum != nil {
+		sum = uploadChecksumHashes[checksum.Algorithm]()
+		reader = io.TeeReader(reader, sum)
+	}
+	counted := &countingReader{r: reader}
+	chunk := models.UploadChunk{BaseModel: models.BaseModel{ID: uuid.New()}, UploadID: upload.ID, Offset: offset}
+	key := uploadChunkKey(upload.ID, chunk.ID)
+	if err := u.Store.Upload(ctx, key, counted, -1, "application/octet-stream"); err != nil {
+		return upload.Offset, err
+	}
+	discard := func(err error) (int64, error) {
+		_ = u.Store.Delete(ctx, key)
+		return upload.Offset, err
+	}
+	if counted.n > remaining {
+		return discard(ErrUploadLengthExceeded)
+	}
+	if checksum != nil && !bytes.Equal(sum.Sum(nil), checksum.Sum) {
+		return discard(ErrUploadChecksumMismatch)
+	}
+	if counted.n == 0 {
+		return discard(nil)
+	}
+
+	next := offset + counted.n
+	err := u.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Moving the offset only from where this request found it keeps
+		// two requests racing for the same offset from both landing.
+		result := tx.Model(&models.Upload{}).
+			Where("id = ? AND upload_offset = ?", upload.ID, offset).
+			Updates(map[string]interface{}{"upload_offset": next, "updated_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUploadOffsetMismatch
+		}
+		chunk.Size = counted.n
+		return tx.Create(&chunk).Error
+	})
+	if err != nil {
+		return discard(err)
+	}
+	upload.Offset = next
+	return next, nil
+}
+
+// UploadBlocks reports which parts of an upload have been received: Bitmap
+// holds a '1' for every block of BlockSize bytes that arrived in full and
+// a '0' for the rest, in order.
+type UploadBlocks struct {
+	BlockSize int64
+	Bitmap    string
+	// Chunks is how many requests the received bytes came in.
+	Chunks int
+}
+
+// Blocks reports which blocks of upload have been received. The chunks of
+// a completed upload are gone by then, and all of its blocks are reported.
+func (u *ResumableUploads) Blocks(ctx context.Context, upload *models.Upload) (*UploadBlocks, error) {
+	blockSize := int64(uploadProgressBlockSize)
+	for (upload.Length+blockSize-1)/blockSize > uploadProgressMaxBlocks {
+		blockSize *= 2
+	}
+	count := int((upload.Length + blockSize - 1) / blockSize)
+	if upload.Status == models.UploadStatusCompleted {
+		return &UploadBlocks{BlockSize: blockSize, Bitmap: strings.Repeat("1", count)}, nil
+	}
+	chunks, err := u.chunks(ctx, upload)
+	if err != nil {
+		return nil, err
+	}
+
+	bitmap := make([]byte, count)
+	// Chunks are ordered by offset, so the received ranges can be merged
+	// in one pass while walking the blocks.
+	var start, end int64
+	next := 0
+	for i := range bitmap {
+		blockStart := int64(i) * blockSize
+		blockEnd := min(blockStart+blockSize, upload.Length)
+		for end < blockEnd && next < len(chunks) {
+			chunk := chunks[next]
+			if chunk.Offset > end {
+				if chunk.Offset > blockStart {
+					break
+				}
+				start = chunk.Offset
+			}
+			end = max(end, chunk.Offset+chunk.Size)
+			next++
+		}
+		bitmap[i] = '0'
+		if start <= blockStart && end >= blockEnd {
+			bitmap[i] = '1'
+		}
+	}
+	return &UploadBlocks{BlockSize: blockSize, Bitmap: string(bitmap), Chunks: len(chunks)}, nil
+}
+
+// Assemble joins the chunks of a fully received upload into the object at
+// key, and reports its size, SHA-256 and sniffed content type. The chunks
+// are kept until Finish, so a failed assembly can be tried again.
+func (u *ResumableUploads) Assemble(ctx context.Context, upload *models.Upload, key string) (*AssembledUpload, error) {
+	if upload.Offset != upload.Length {
+		return nil, ErrUploadIncomplete
+	}
+	chunks, err := u.chunks(ctx, upload)
+	if err != nil {
+		return nil, err
+	}
+
+	readers := make([]io.Reader, 0, len(chunks))
+	var next int64
+	for _, chunk := range chunks {
+		if chunk.Offset != next {
+			closeAll(readers)
+			return nil, fmt.Errorf("%w: bytes from %d are missing", ErrUploadIncomplete, next)
+		}
+		data, err := u.Store.Get(ctx, uploadChunkKey(upload.ID, chunk.ID))
+		if err != nil {
+			closeAll(readers)
+			return nil, fmt.Errorf("%w: chunk at %d is missing", ErrUploadIncomplete, chunk.Offset)
+		}
+		readers = append(readers, data)
+		next += chunk.Size
+	}
+
+	sum := sha256.New()
+	head := &headRecorder{max: SniffLength}
+	counted := &countingReader{r: io.TeeReader(io.TeeReader(io.MultiReader(readers...), sum), head)}
+	err = u.Store.Upload(ctx, key, counted, -1, "application/octet-stream")
+	closeAll(readers)
+	if err != nil {
+		return nil, err
+	}
+	if counted.n != upload.Length {
+		_ = u.Store.Delete(ctx, key)
+		return nil, fmt.Errorf("%w: joined %d of %d bytes", ErrUploadIncomplete, counted.n, upload.Length)
+	}
+	return &AssembledUpload{
+		Key:          key,
+		Size:         counted.n,
+		Checksum:     hex.EncodeToString(sum.Sum(nil)),
+		DetectedType: DetectContentType(head.buf),
+	}, nil
+}
+
+// Finish marks upload as completed into fileID within tx. Its chunks stay
+// until Release is called once tx has committed, or Purge finds them.
+func (u *ResumableUploads) Finish(tx *gorm.DB, upload *models.Upload, fileID uuid.UUID) error {
+	if err := tx.Model(upload).Updates(map[string]interface{}{
+		"status":  models.UploadStatusCompleted,
+		"file_id": fileID,
+	}).Error; err != nil {
+		return err
+	}
+	upload.Status, upload.FileID = models.UploadStatusCompleted, &fileID
+	return nil
+}
+
+// Discard deletes the upload along with every byte received for it.
+func (u *ResumableUploads) Discard(ctx context.Context, upload *models.Upload) error {
+	if err := u.Release(ctx, upload); err != nil {
+		return err
+	}
+	return u.DB.WithContext(ctx).Delete(upload).Error
+}
+
+// Release drops the chunks of upload, keeping its record.
+func (u *ResumableUploads) Release(ctx context.Context, upload *models.Upload) error {
+	chunks, err := u.chunks(ctx, upload)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if err := u.Store.Delete(ctx, uploadChunkKey(upload.ID, chunk.ID)); err != nil {
+			return err
+		}
+	}
+	return u.DB.WithContext(ctx).Where("upload_id = ?", upload.ID).Delete(&models.UploadChunk{}).Error
+}
+
+func (u *ResumableUploads) chunks(ctx context.Context, upload *models.Upload) ([]models.UploadChunk, error) {
+	var chunks []models.UploadChunk
+	err := u.DB.WithContext(ctx).Where("upload_id = ?", upload.ID).Order("chunk_offset").Find(&chunks).Error
+	return chunks, err
+}
+
+// Purge drops the chunks of completed uploads and discards uploads that
+// expired unfinished.
+func (u *ResumableUploads) Purge(ctx context.Context) error {
+	var uploads []models.Upload
+	if err := u.DB.WithContext(ctx).
+		Where("(status = ? AND id IN (?)) OR (status = ? AND expires_at < ?)",
+			models.UploadStatusCompleted, u.DB.Model(&models.UploadChunk{}).Select("upload_id"),
+			models.UploadStatusReceiving, time.Now()).
+		Limit(500).Find(&uploads).Error; err != nil {
+		return err
+	}
+	for i := range uploads {
+		var err error
+		if uploads[i].Status == models.UploadStatusCompleted {
+			err = u.Release(ctx, &uploads[i])
+		} else {
+			err = u.Discard(ctx, &uploads[i])
+		}
+		if err != nil {
+			logger.Error("upload_purge_failed", err, map[string]interface{}{
+				"upload_id": uploads[i].ID.String(),
+			})
+		}
+	}
+	return nil
+}
+
+// headRecorder keeps the first max bytes written to it.
+type headRecorder struct {
+	buf []byte
+	max int
+}
+
+func (h *headRecorder) Write(p []byte) (int, error) {
+	if room := h.max - len(h.buf); room > 0 {
+		if len(p) < room {
+			room = len(p)
+		}
+		h.buf = append(h.buf, p[:room]...)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestResumableUploads(t *testing.T) {
+	logger.Init()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&models.Upload{}, &models.UploadChunk{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+
+	ctx := context.Background()
+	store := newMemoryBucket()
+	uploads := NewResumableUploads(db, store)
+	owner := uuid.New()
+	upload := &models.Upload{OwnerID: owner, FileName: "notes.txt", Length: 11}
+	if err := uploads.Create(ctx, upload); err != nil {
+		t.Fatalf("failed creating upload: %v", err)
+	}
+
+	t.Run("only the owner finds it", func(t *testing.T) {
+		if _, err := uploads.Get(ctx, upload.ID, uuid.New()); !errors.Is(err, ErrUploadNotFound) {
+			t.Fatalf("expected ErrUploadNotFound, got %v", err)
+		}
+	})
+
+	t.Run("appends at the current offset", func(t *testing.T) {
+		if _, err := uploads.Append(ctx, upload, 3, strings.NewReader("hello"), nil); !errors.Is(err, ErrUploadOffsetMismatch) {
+			t.Fatalf("expected ErrUploadOffsetMismatch, got %v", err)
+		}
+		offset, err := uploads.Append(ctx, upload, 0, strings.NewReader("hello"), nil)
+		if err != nil || offset != 5 {
+			t.Fatalf("expected offset 5, got %d, %v", offset, err)
+		}
+		stored, _ := uploads.Get(ctx, upload.ID, owner)
+		if stored.Offset != 5 {
+			t.Fatalf("expected the offset to be saved, got %d", stored.Offset)
+		}
+	})
+
+	t.Run("refuses a body that fails its checksum", func(t *testing.T) {
+		sum := sha1.Sum([]byte("something else"))
+		checksum, err := ParseUploadChecksum("sha1 " + base64.StdEncoding.EncodeToString(sum[:]))
+		if err != nil {
+			t.Fatalf("failed parsing checksum: %v", err)
+		}
+		if _, err := uploads.Append(ctx, upload, 5, strings.NewReader(" world"), checksum); !errors.Is(err, ErrUploadChecksumMismatch) {
+			t.Fatalf("expected ErrUploadChecksumMismatch, got %v", err)
+		}
+		if upload.Offset != 5 || len(store.objects) != 1 {
+			t.Fatalf("expected the body to be thrown away, offset %d, %d objects", upload.Offset, len(store.objects))
+		}
+		if _, err := ParseUploadChecksum("crc32 AAAA"); !errors.Is(err, ErrUploadChecksumAlgorithm) {
+			t.Fatalf("expected ErrUploadChecksumAlgorithm, got %v", err)
+		}
+	})
+
+	t.Run("refuses more bytes than announced", func(t *testing.T) {
+		if _, err := uploads.Append(ctx, upload, 5, strings.NewReader(" world!!"), nil); !errors.Is(err, ErrUploadLengthExceeded) {
+			t.Fatalf("expected ErrUploadLengthExceeded, got %v", err)
+		}
+	})
+
+	t.Run("joins the chunks", func(t *testing.T) {
+		if _, err := uploads.Assemble(ctx, upload, "owner/notes.txt"); !errors.Is(err, ErrUploadIncomplete) {
+			t.Fatalf("expected ErrUploadIncomplete, got %v", err)
+		}
+		sum := sha256.Sum256([]byte(" world"))
+		checksum, _ := ParseUploadChecksum("sha256 " + base64.StdEncoding.EncodeToString(sum[:]))
+		if _, err := uploads.Append(ctx, upload, 5, strings.NewReader(" world"), checksum); err != nil {
+			t.Fatalf("failed appending: %v", err)
+		}
+
+		assembled, err := uploads.Assemble(ctx, upload, "owner/notes.txt")
+		if err != nil {
+			t.Fatalf("failed assembling: %v", err)
+		}
+		whole := sha256.Sum256([]byte("hello world"))
+		if string(store.objects["owner/notes.txt"]) != "hello world" || assembled.Size != 11 || assembled.Checksum != hex.EncodeToString(whole[:]) {
+			t.Fatalf("unexpected assembly %+v: %q", assembled, store.objects["owner/notes.txt"])
+		}
+		if !strings.HasPrefix(assembled.DetectedType, "text/plain") {
+			t.Fatalf("expected the content to be sniffed, got %q", assembled.DetectedType)
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error { return uploads.Finish(tx, upload, uuid.New()) }); err != nil {
+			t.Fatalf("failed finishing: %v", err)
+		}
+		if _, err := uploads.Append(ctx, upload, 11, strings.NewReader(""), nil); !errors.Is(err, ErrUploadOffsetMismatch) {
+			t.Fatalf("expected a finished upload to refuse more bytes, got %v", err)
+		}
+	})
+
+	t.Run("reports received blocks", func(t *testing.T) {
+		large := &models.Upload{OwnerID: owner, FileName: "large.bin", Length: 3*uploadProgressBlockSize - 10}
+		_ = uploads.Create(ctx, large)
+		blocks, err := uploads.Blocks(ctx, large)
+		if err != nil || blocks.BlockSize != uploadProgressBlockSize || blocks.Bitmap != "000" {
+			t.Fatalf("expected three empty blocks, got %+v, %v", blocks, err)
+		}
+		half := uploadProgressBlockSize * 3 / 2
+		if _, err := uploads.Append(ctx, large, 0, strings.NewReader(strings.Repeat("a", half)), nil); err != nil {
+			t.Fatalf("failed appending: %v", err)
+		}
+		if blocks, _ = uploads.Blocks(ctx, large); blocks.Bitmap != "100" || blocks.Chunks != 1 {
+			t.Fatalf("expected the first block only, got %+v", blocks)
+		}
+		rest := int(large.Length) - half
+		if _, err := uploads.Append(ctx, large, int64(half), strings.NewReader(strings.Repeat("b", rest)), nil); err != nil {
+			t.Fatalf("failed appending: %v", err)
+		}
+		if blocks, _ = uploads.Blocks(ctx, large); blocks.Bitmap != "111" || blocks.Chunks != 2 {
+			t.Fatalf("expected every block, got %+v", blocks)
+		}
+		_ = uploads.Discard(ctx, large)
+
+		// Blocks grow so the bitmap stays short.
+		huge := &models.Upload{Length: 10 * uploadProgressMaxBlocks * uploadProgressBlockSize}
+		if blocks, _ = uploads.Blocks(ctx, huge); len(blocks.Bitmap) > uploadProgressMaxBlocks || blocks.BlockSize != 16*uploadProgressBlockSize {
+			t.Fatalf("unexpected blocks for a huge upload: size %d, %d blocks", blocks.BlockSize, len(blocks.Bitmap))
+		}
+	})
+
+	t.Run("purge drops finished chunks and expired uploads", func(t *testing.T) {
+		stale := &models.Upload{OwnerID: owner, FileName: "stale.bin", Length: 10}
+		_ = uploads.Create(ctx, stale)
+		if _, err := uploads.Append(ctx, stale, 0, strings.NewReader("abc"), nil); err != nil {
+			t.Fatalf("failed appending: %v", err)
+		}
+		db.Model(stale).Update("expires_at", time.Now().Add(-time.Minute))
+		if _, err := uploads.Get(ctx, stale.ID, owner); !errors.Is(err, ErrUploadExpired) {
+			t.Fatalf("expected ErrUploadExpired, got %v", err)
+		}
+
+		if err := uploads.Purge(ctx); err != nil {
+			t.Fatalf("failed purging: %v", err)
+		}
+		for key := range store.objects {
+			if strings.HasPrefix(key, "resumable/") {
+				t.Fatalf("expected the chunks to be purged, found %s", key)
+			}
+		}
+		var remaining int64
+		db.Model(&models.Upload{}).Count(&remaining)
+		if remaining != 1 || store.objects["owner/notes.txt"] == nil {
+			t.Fatalf("expected only the finished upload and its file to remain, got %d uploads", remaining)
+		}
+	})
+}
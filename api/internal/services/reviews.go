@@ -0,0 +1,333 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxReviewers bounds the users and groups one review can ask.
+	MaxReviewers = 20
+	// MaxReviewCommentLength bounds review messages and decision comments,
+	// in characters.
+	MaxReviewCommentLength = 1000
+)
+
+var (
+	ErrReviewNotFound = errors.New("review not found")
+	// ErrReviewInvalid is wrapped with the reason a review request was
+	// refused.
+	ErrReviewInvalid      = errors.New("invalid review request")
+	ErrReviewInProgress   = errors.New("file is already in review")
+	ErrReviewClosed       = errors.New("review has already been closed")
+	ErrReviewDecided      = errors.New("you have already decided on this review")
+	ErrNotReviewer        = errors.New("you are not a reviewer of this file")
+	ErrOwnReview          = errors.New("you cannot decide on a review you requested")
+	ErrReviewCancelDenied = errors.New("only the requester or the file owner can withdraw a review")
+)
+
+// Reviews runs the document review workflow: a file is sent to users and
+// groups for review, each of them approves or rejects it, and the file's
+// ReviewStatus follows the outcome. Every transition is recorded as an
+// event, which tells the people involved through their activity feed.
+type Reviews struct {
+	DB *gorm.DB
+}
+
+func NewReviews(db *gorm.DB) *Reviews {
+	return &Reviews{DB: db}
+}
+
+// Get loads a review with its reviewers.
+func (r *Reviews) Get(ctx context.Context, id uuid.UUID) (*models.FileReview, error) {
+	var review models.FileReview
+	if err := r.DB.WithContext(ctx).Preload("Reviewers").First(&review, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReviewNotFound
+		}
+		return nil, err
+	}
+	return &review, nil
+}
+
+// Request sends file for review by userIDs and groupIDs and puts it in
+// review. The requester, entry.UserID, cannot review it themselves, and a
+// file can only be in one review at a time.
+func (r *Reviews) Request(ctx context.Context, file *models.File, userIDs, groupIDs []uuid.UUID, message string, entry AuditEntry) (*models.FileReview, error) {
+	if file.IsDirectory {
+		return nil, fmt.Errorf("%w: folders cannot be reviewed", ErrReviewInvalid)
+	}
+	message = strings.TrimSpace(message)
+	if utf8.RuneCountInString(message) > MaxReviewCommentLength {
+		return nil, fmt.Errorf("%w: message must be at most %d characters", ErrReviewInvalid, MaxReviewCommentLength)
+	}
+	userIDs, groupIDs = uniqueIDs(userIDs), uniqueIDs(groupIDs)
+	if len(userIDs)+len(groupIDs) == 0 {
+		return nil, fmt.Errorf("%w: name at least one reviewer", ErrReviewInvalid)
+	}
+	if len(userIDs)+len(groupIDs) > MaxReviewers {
+		return nil, fmt.Errorf("%w: at most %d reviewers", ErrReviewInvalid, MaxReviewers)
+	}
+	for _, id := range userIDs {
+		if id == *entry.UserID {
+			return nil, fmt.Errorf("%w: you cannot review your own request", ErrReviewInvalid)
+		}
+	}
+	if err := r.checkExist(ctx, &models.User{}, userIDs, "user"); err != nil {
+		return nil, err
+	}
+	if err := r.checkExist(ctx, &models.Group{}, groupIDs, "group"); err != nil {
+		return nil, err
+	}
+
+	review := models.FileReview{
+		FileID:        file.ID,
+		RequestedByID: *entry.UserID,
+		Status:        models.ReviewStatusInReview,
+		Message:       message,
+	}
+	for i := range userIDs {
+		review.Reviewers = append(review.Reviewers, models.FileReviewer{UserID: &userIDs[i], Decision: models.ReviewDecisionPending})
+	}
+	for i := range groupIDs {
+		review.Reviewers = append(review.Reviewers, models.FileReviewer{GroupID: &groupIDs[i], Decision: models.ReviewDecisionPending})
+	}
+
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.File{}).
+			Where("id = ? AND (review_status IS NULL OR review_status <> ?)", file.ID, models.ReviewStatusInReview).
+			UpdateColumn("review_status", models.ReviewStatusInReview)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrReviewInProgress
+		}
+		if err := tx.Create(&review).Error; err != nil {
+			return err
+		}
+		details := reviewDetails(file, &review)
+		details["user_ids"] = idStrings(userIDs)
+		details["group_ids"] = idStrings(groupIDs)
+		if message != "" {
+			details["message"] = message
+		}
+		entry.Action, entry.ResourceType, entry.ResourceID, entry.Details = "file.review_request", "file", &file.ID, details
+		return RecordEvent(tx, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	file.ReviewStatus = models.ReviewStatusInReview
+	return &review, nil
+}
+
+// Decide records entry.UserID's decision on a review, for every pending
+// reviewer they stand for: themselves, or a group they are a member of.
+// A rejection closes the review at once; approval closes it once every
+// reviewer has approved.
+func (r *Reviews) Decide(ctx context.Context, id uuid.UUID, decision models.ReviewDecision, comment string, entry AuditEntry) (*models.FileReview, error) {
+	comment = strings.TrimSpace(comment)
+	if utf8.RuneCountInString(comment) > MaxReviewCommentLength {
+		return nil, fmt.Errorf("%w: comment must be at most %d characters", ErrReviewInvalid, MaxReviewCommentLength)
+	}
+	deciderID := *entry.UserID
+	review, err := r.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if review.RequestedByID == deciderID {
+		return nil, ErrOwnReview
+	}
+	var groupIDs []uuid.UUID
+	if err := r.DB.WithContext(ctx).Model(&models.GroupMembership{}).
+		Where("user_id = ?", deciderID).Pluck("group_id", &groupIDs).Error; err != nil {
+		return nil, err
+	}
+	member := make(map[uuid.UUID]bool, len(groupIDs))
+	for _, g := range groupIDs {
+		member[g] = true
+	}
+	standsFor := func(rv models.FileReviewer) bool {
+		return (rv.UserID != nil && *rv.UserID == deciderID) || (rv.GroupID != nil && member[*rv.GroupID])
+	}
+	eligible := false
+	for _, rv := range review.Reviewers {
+		eligible = eligible || standsFor(rv)
+	}
+	if !eligible {
+		return nil, ErrNotReviewer
+	}
+
+	var file models.File
+	if err := r.DB.WithContext(ctx).First(&file, "id = ?", review.FileID).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	err = r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Touching the review first serializes concurrent decisions and
+		// withdrawals on its row.
+		result := tx.Model(&models.FileReview{}).
+			Where("id = ? AND status = ?", review.ID, models.ReviewStatusInReview).
+			UpdateColumn("updated_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrReviewClosed
+		}
+		if err := tx.Where("review_id = ?", review.ID).Find(&review.Reviewers).Error; err != nil {
+			return err
+		}
+		var decided []uuid.UUID
+		approved := true
+		for i := range review.Reviewers {
+			rv := &review.Reviewers[i]
+			if rv.Decision == models.ReviewDecisionPending && standsFor(*rv) {
+				rv.Decision, rv.DecidedByID, rv.DecidedAt, rv.Comment = decision, &deciderID, &now, comment
+				decided = append(decided, rv.ID)
+			}
+			approved = approved && rv.Decision == models.ReviewDecisionApproved
+		}
+		if len(decided) == 0 {
+			return ErrReviewDecided
+		}
+		if err := tx.Model(&models.FileReviewer{}).Where("id IN ?", decided).Updates(map[string]interface{}{
+			"decision":      decision,
+			"decided_by_id": deciderID,
+			"decided_at":    now,
+			"comment":       comment,
+		}).Error; err != nil {
+			return err
+		}
+
+		switch {
+		case decision == models.ReviewDecisionRejected:
+			review.Status = models.ReviewStatusRejected
+		case approved:
+			review.Status = models.ReviewStatusApproved
+		}
+		if review.Status != models.ReviewStatusInReview {
+			review.ClosedAt = &now
+			if err := r.close(tx, review, &file); err != nil {
+				return err
+			}
+		}
+
+		details := reviewDetails(&file, review)
+		if comment != "" {
+			details["comment"] = comment
+		}
+		entry.Action, entry.ResourceType, entry.ResourceID, entry.Details = "file.review_approve", "file", &file.ID, details
+		if decision == models.ReviewDecisionRejected {
+			entry.Action = "file.review_reject"
+		}
+		return RecordEvent(tx, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+// Cancel withdraws a review that is still open and puts the file back in
+// draft. Only the requester or the file's owner can withdraw it.
+func (r *Reviews) Cancel(ctx context.Context, id uuid.UUID, entry AuditEntry) (*models.FileReview, error) {
+	review, err := r.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var file models.File
+	if err := r.DB.WithContext(ctx).First(&file, "id = ?", review.FileID).Error; err != nil {
+		return nil, err
+	}
+	if review.RequestedByID != *entry.UserID && file.OwnerID != *entry.UserID {
+		return nil, ErrReviewCancelDenied
+	}
+
+	now := time.Now().UTC()
+	review.Status, review.ClosedAt = models.ReviewStatusCancelled, &now
+	err = r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := r.close(tx, review, &file); err != nil {
+			return err
+		}
+		entry.Action, entry.ResourceType, entry.ResourceID, entry.Details = "file.review_cancel", "file", &file.ID, reviewDetails(&file, review)
+		return RecordEvent(tx, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+// close moves an open review to review.Status and the file to the status
+// that follows from it. A review closed in the meantime is ErrReviewClosed.
+func (r *Reviews) close(tx *gorm.DB, review *models.FileReview, file *models.File) error {
+	result := tx.Model(&models.FileReview{}).
+		Where("id = ? AND status = ?", review.ID, models.ReviewStatusInReview).
+		Updates(map[string]interface{}{"status": review.Status, "closed_at": review.ClosedAt})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrReviewClosed
+	}
+	file.ReviewStatus = review.Status
+	if review.Status == models.ReviewStatusCancelled {
+		file.ReviewStatus = models.ReviewStatusDraft
+	}
+	return tx.Model(&models.File{}).Where("id = ?", file.ID).UpdateColumn("review_status", file.ReviewStatus).Error
+}
+
+func (r *Reviews) checkExist(ctx context.Context, model interface{}, ids []uuid.UUID, what string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var found int64
+	if err := r.DB.WithContext(ctx).Model(model).Where("id IN ?", ids).Count(&found).Error; err != nil {
+		return err
+	}
+	if found != int64(len(ids)) {
+		return fmt.Errorf("%w: unknown %s", ErrReviewInvalid, what)
+	}
+	return nil
+}
+
+// reviewDetails describes a review for its events. The activity feed reads
+// review_id to find whom to tell.
+func reviewDetails(file *models.File, review *models.FileReview) map[string]interface{} {
+	return map[string]interface{}{
+		"file_name":       file.Name,
+		"review_id":       review.ID.String(),
+		"requested_by_id": review.RequestedByID.String(),
+		"review_status":   string(review.Status),
+	}
+}
+
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	out := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if id != uuid.Nil && !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func idStrings(ids []uuid.UUID) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id.String()
+	}
+	return out
+}
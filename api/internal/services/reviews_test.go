@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestReviews(t *testing.T) {
+	db := setupAuditTestDB(t)
+	if err := db.AutoMigrate(&models.OutboxEvent{}, &models.FileReview{}, &models.FileReviewer{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+	ctx := context.Background()
+	reviews := NewReviews(db)
+	audit := NewAuditService(db, nil)
+
+	newUser := func(first string) models.User {
+		u := models.User{Email: first + "@test.com", PasswordHash: "hash", FirstName: first, LastName: "Test", Role: models.UserRoleUser}
+		if err := db.Create(&u).Error; err != nil {
+			t.Fatalf("failed creating user: %v", err)
+		}
+		return u
+	}
+	author, legal, alice, bob := newUser("author"), newUser("legal"), newUser("alice"), newUser("bob")
+	group := models.Group{Name: "Compliance", CreatedByID: author.ID}
+	db.Create(&group)
+	db.Create(&models.GroupMembership{GroupID: group.ID, UserID: alice.ID, Role: models.GroupRoleMember})
+	db.Create(&models.GroupMembership{GroupID: group.ID, UserID: bob.ID, Role: models.GroupRoleMember})
+
+	as := func(u models.User) AuditEntry { return AuditEntry{UserID: &u.ID} }
+	lastEvent := func(action string) models.AuditLog {
+		t.Helper()
+		var event models.OutboxEvent
+		if err := db.Where("event_type = ?", action).Order("created_at DESC, id DESC").First(&event).Error; err != nil {
+			t.Fatalf("expected a %s event: %v", action, err)
+		}
+		return models.AuditLog{UserID: event.ActorID, Action: event.EventType, ResourceID: event.ResourceID, Details: event.Payload}
+	}
+	fileStatus := func(id uuid.UUID) models.ReviewStatus {
+		var f models.File
+		db.First(&f, "id = ?", id)
+		return f.ReviewStatus
+	}
+
+	policy := models.File{Name: "policy.docx", MimeType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document", OwnerID: author.ID}
+	folder := models.File{Name: "Policies", IsDirectory: true, OwnerID: author.ID}
+	db.Create(&policy)
+	db.Create(&folder)
+
+	t.Run("invalid requests", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			file  *models.File
+			users []uuid.UUID
+		}{
+			"folder":       {&folder, []uuid.UUID{legal.ID}},
+			"no reviewers": {&policy, nil},
+			"self":         {&policy, []uuid.UUID{author.ID}},
+			"unknown user": {&policy, []uuid.UUID{uuid.New()}},
+		} {
+			if _, err := reviews.Request(ctx, tc.file, tc.users, nil, "", as(author)); !errors.Is(err, ErrReviewInvalid) {
+				t.Errorf("%s: expected ErrReviewInvalid, got %v", name, err)
+			}
+		}
+		if status := fileStatus(policy.ID); status != "" {
+			t.Fatalf("expected the file left alone, got %q", status)
+		}
+	})
+
+	review, err := reviews.Request(ctx, &policy, []uuid.UUID{legal.ID, legal.ID}, []uuid.UUID{group.ID}, "Please check section 4", as(author))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if len(review.Reviewers) != 2 || fileStatus(policy.ID) != models.ReviewStatusInReview {
+		t.Fatalf("expected two reviewers and the file in review, got %d, %q", len(review.Reviewers), fileStatus(policy.ID))
+	}
+	if _, err := reviews.Request(ctx, &policy, []uuid.UUID{legal.ID}, nil, "", as(author)); !errors.Is(err, ErrReviewInProgress) {
+		t.Fatalf("expected ErrReviewInProgress, got %v", err)
+	}
+	requested := audit.activitiesForReviewers(lastEvent("file.review_request"))
+	if len(requested) != 3 || requested[0].MessageKey != "activity.review.requested" {
+		t.Fatalf("expected legal and both group members told, got %+v", requested)
+	}
+
+	t.Run("who may decide", func(t *testing.T) {
+		if _, err := reviews.Decide(ctx, review.ID, models.ReviewDecisionApproved, "", as(author)); !errors.Is(err, ErrOwnReview) {
+			t.Fatalf("expected ErrOwnReview, got %v", err)
+		}
+		stranger := newUser("stranger")
+		if _, err := reviews.Decide(ctx, review.ID, models.ReviewDecisionApproved, "", as(stranger)); !errors.Is(err, ErrNotReviewer) {
+			t.Fatalf("expected ErrNotReviewer, got %v", err)
+		}
+		if _, err := reviews.Decide(ctx, uuid.New(), models.ReviewDecisionApproved, "", as(legal)); !errors.Is(err, ErrReviewNotFound) {
+			t.Fatalf("expected ErrReviewNotFound, got %v", err)
+		}
+	})
+
+	t.Run("approval needs every reviewer", func(t *testing.T) {
+		got, err := reviews.Decide(ctx, review.ID, models.ReviewDecisionApproved, "Looks good", as(legal))
+		if err != nil {
+			t.Fatalf("approve failed: %v", err)
+		}
+		if got.Status != models.ReviewStatusInReview || fileStatus(policy.ID) != models.ReviewStatusInReview {
+			t.Fatalf("expected the review still open, got %q", got.Status)
+		}
+		if _, err := reviews.Decide(ctx, review.ID, models.ReviewDecisionApproved, "", as(legal)); !errors.Is(err, ErrReviewDecided) {
+			t.Fatalf("expected ErrReviewDecided, got %v", err)
+		}
+		if a := audit.activitiesForReviewDecision(lastEvent("file.review_approve")); len(a) != 1 || a[0].UserID != author.ID || a[0].MessageKey != "activity.review.approved_by" {
+			t.Fatalf("expected the author told of one approval, got %+v", a)
+		}
+
+		got, err = reviews.Decide(ctx, review.ID, models.ReviewDecisionApproved, "", as(bob))
+		if err != nil {
+			t.Fatalf("approve failed: %v", err)
+		}
+		if got.Status != models.ReviewStatusApproved || got.ClosedAt == nil || fileStatus(policy.ID) != models.ReviewStatusApproved {
+			t.Fatalf("expected the review approved, got %q", got.Status)
+		}
+		if a := audit.activitiesForReviewDecision(lastEvent("file.review_approve")); len(a) != 1 || a[0].MessageKey != "activity.review.approved" {
+			t.Fatalf("expected the author told of the approval, got %+v", a)
+		}
+		if _, err := reviews.Decide(ctx, review.ID, models.ReviewDecisionRejected, "", as(alice)); !errors.Is(err, ErrReviewClosed) {
+			t.Fatalf("expected ErrReviewClosed, got %v", err)
+		}
+	})
+
+	t.Run("one rejection closes the review", func(t *testing.T) {
+		again, err := reviews.Request(ctx, &policy, []uuid.UUID{legal.ID}, []uuid.UUID{group.ID}, "", as(author))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		got, err := reviews.Decide(ctx, again.ID, models.ReviewDecisionRejected, "Section 4 is wrong", as(alice))
+		if err != nil {
+			t.Fatalf("reject failed: %v", err)
+		}
+		if got.Status != models.ReviewStatusRejected || fileStatus(policy.ID) != models.ReviewStatusRejected {
+			t.Fatalf("expected the review rejected, got %q", got.Status)
+		}
+		log := lastEvent("file.review_reject")
+		if log.Details["comment"] != "Section 4 is wrong" {
+			t.Fatalf("expected the comment recorded, got %v", log.Details)
+		}
+		if a := audit.activitiesForReviewDecision(log); len(a) != 1 || a[0].MessageKey != "activity.review.rejected" {
+			t.Fatalf("expected the author told of the rejection, got %+v", a)
+		}
+	})
+
+	t.Run("withdrawing puts the file back in draft", func(t *testing.T) {
+		again, err := reviews.Request(ctx, &policy, []uuid.UUID{legal.ID}, nil, "", as(author))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if _, err := reviews.Cancel(ctx, again.ID, as(legal)); !errors.Is(err, ErrReviewCancelDenied) {
+			t.Fatalf("expected ErrReviewCancelDenied, got %v", err)
+		}
+		got, err := reviews.Cancel(ctx, again.ID, as(author))
+		if err != nil {
+			t.Fatalf("cancel failed: %v", err)
+		}
+		if got.Status != models.ReviewStatusCancelled || fileStatus(policy.ID) != models.ReviewStatusDraft {
+			t.Fatalf("expected the review cancelled and the file a draft, got %q, %q", got.Status, fileStatus(policy.ID))
+		}
+		if _, err := reviews.Cancel(ctx, again.ID, as(author)); !errors.Is(err, ErrReviewClosed) {
+			t.Fatalf("expected ErrReviewClosed, got %v", err)
+		}
+		if a := audit.activitiesForReviewers(lastEvent("file.review_cancel")); len(a) != 1 || a[0].UserID != legal.ID || a[0].MessageKey != "activity.review.cancelled" {
+			t.Fatalf("expected legal told of the withdrawal, got %+v", a)
+		}
+	})
+}
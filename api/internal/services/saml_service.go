@@ -109,18 +109,33 @@ func (s *SAMLService) HandleACS(ctx context.Context, responseXML string) (*SSOPr
 		email = assertion.Subject.NameID.Value
 	}
 
+	// Every attribute is kept so claim mappings can match on it, e.g. on a
+	// "groups" or "Role" attribute.
+	raw := map[string]interface{}{}
+	for _, attr := range assertion.Attribute {
+		values := make([]string, 0, len(attr.AttributeValue))
+		for _, v := range attr.AttributeValue {
+			values = append(values, v.Value)
+		}
+		if attr.Name != "" {
+			raw[attr.Name] = values
+		}
+		if attr.FriendlyName != "" {
+			raw[attr.FriendlyName] = values
+		}
+	}
+	raw["name_id"] = assertion.Subject.NameID.Value
+	raw["email"] = email
+	raw["first_name"] = firstName
+	raw["last_name"] = lastName
+
 	return &SSOProfile{
 		Provider:       models.SSOProviderTypeSAML,
 		ProviderUserID: assertion.Subject.NameID.Value,
 		Email:          email,
 		FirstName:      firstName,
 		LastName:       lastName,
-		RawProfile: map[string]interface{}{
-			"name_id":    assertion.Subject.NameID.Value,
-			"email":      email,
-			"first_name": firstName,
-			"last_name":  lastName,
-		},
+		RawProfile:     raw,
 	}, nil
 }
 
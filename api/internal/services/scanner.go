@@ -0,0 +1,126 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+)
+
+// clamdChunkSize is how much of the stream goes into each INSTREAM chunk.
+// clamd rejects chunks above its StreamMaxLength, which defaults to 25MB.
+const clamdChunkSize = 64 * 1024
+
+var ErrScanFailed = errors.New("content scan failed")
+
+// ScanVerdict is what a scanner found in one stream.
+type ScanVerdict struct {
+	Infected  bool
+	Signature string
+}
+
+// Scanner checks content for malware. Scan returns an error only when the
+// content could not be checked; a detection is a verdict, not an error.
+type Scanner interface {
+	Name() string
+	Scan(ctx context.Context, r io.Reader) (ScanVerdict, error)
+}
+
+// NewScanner returns the scanner configured in cfg, or nil when scanning is
+// off.
+func NewScanner(cfg config.ScanConfig) Scanner {
+	if cfg.ClamAVAddress == "" {
+		return nil
+	}
+	network, address := "tcp", cfg.ClamAVAddress
+	if path, ok := strings.CutPrefix(address, "unix://"); ok {
+		network, address = "unix", path
+	}
+	return &ClamAVScanner{Network: network, Address: address, Timeout: cfg.Timeout}
+}
+
+// ClamAVScanner streams content to clamd with the INSTREAM command.
+type ClamAVScanner struct {
+	Network string
+	Address string
+	Timeout time.Duration
+}
+
+func (s *ClamAVScanner) Name() string {
+	return "clamav"
+}
+
+func (s *ClamAVScanner) Scan(ctx context.Context, r io.Reader) (ScanVerdict, error) {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.Network, s.Address)
+	if err != nil {
+		return ScanVerdict{}, fmt.Errorf("%w: connecting to clamd: %v", ErrScanFailed, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return ScanVerdict{}, fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+	buf := make([]byte, clamdChunkSize)
+	var size [4]byte
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			if _, err := conn.Write(size[:]); err != nil {
+				return ScanVerdict{}, fmt.Errorf("%w: %v", ErrScanFailed, err)
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				// clamd hangs up once the stream passes its size
+				// limit; its reply says so.
+				break
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return ScanVerdict{}, fmt.Errorf("reading content to scan: %w", readErr)
+		}
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	_, _ = conn.Write(size[:])
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return ScanVerdict{}, fmt.Errorf("%w: reading clamd reply: %v", ErrScanFailed, err)
+	}
+	return parseClamdReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// parseClamdReply reads replies such as "stream: OK" and
+// "stream: Eicar-Signature FOUND".
+func parseClamdReply(reply string) (ScanVerdict, error) {
+	result := reply
+	if i := strings.Index(reply, ": "); i >= 0 {
+		result = reply[i+2:]
+	}
+	switch {
+	case result == "OK":
+		return ScanVerdict{}, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return ScanVerdict{Infected: true, Signature: strings.TrimSuffix(result, " FOUND")}, nil
+	default:
+		return ScanVerdict{}, fmt.Errorf("%w: clamd replied %q", ErrScanFailed, reply)
+	}
+}
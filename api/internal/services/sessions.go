@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// sessionTouchInterval limits how often a session's last-seen time is
+// written, so busy clients do not update the row on every request.
+const sessionTouchInterval = time.Minute
+
+// ClientInfo describes the device a request came from.
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+	Country   string
+	City      string
+}
+
+// SessionService keeps the inventory of devices each user is signed in on.
+type SessionService struct {
+	DB     *gorm.DB
+	Mailer Mailer
+	Config config.SessionsConfig
+}
+
+func NewSessionService(db *gorm.DB, cfg config.SessionsConfig, mailer Mailer) *SessionService {
+	return &SessionService{DB: db, Config: cfg, Mailer: mailer}
+}
+
+// ClientInfo gathers what is known about a request's device. header looks up
+// request headers, for the location set by a CDN or proxy.
+func (s *SessionService) ClientInfo(userAgent, ip string, header func(string) string) ClientInfo {
+	client := ClientInfo{UserAgent: userAgent, IPAddress: ip}
+	if s.Config.CountryHeader != "" {
+		country := strings.ToUpper(strings.TrimSpace(header(s.Config.CountryHeader)))
+		// Cloudflare reports XX for unknown and T1 for Tor.
+		if len(country) == 2 && country != "XX" && country != "T1" {
+			client.Country = country
+		}
+	}
+	if s.Config.CityHeader != "" {
+		client.City = truncateString(strings.TrimSpace(header(s.Config.CityHeader)), 100)
+	}
+	return client
+}
+
+// Start records a new session for user signing in with method. A sign-in
+// from a device or country the user has not used before is recorded as an
+// auth.new_device event, and emailed to them when configured.
+func (s *SessionService) Start(ctx context.Context, user *models.User, client ClientInfo, method string) (*models.Session, error) {
+	expiresAt := time.Now().Add(utils.TokenLifetime())
+	session := s.newSession(user.ID, client, method, &expiresAt)
+	if err := s.create(ctx, user, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// ForAPIToken returns the session tracking token, creating it on first use.
+func (s *SessionService) ForAPIToken(ctx context.Context, token *models.APIToken, user *models.User, client ClientInfo) (*models.Session, error) {
+	var session models.Session
+	err := s.DB.WithContext(ctx).Where("api_token_id = ?", token.ID).First(&session).Error
+	if err == nil {
+		s.Touch(ctx, &session, client)
+		return &session, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	created := s.newSession(user.ID, client, "api_token", token.ExpiresAt)
+	created.APITokenID = &token.ID
+	if err := s.create(ctx, user, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// Lookup returns the session with the given ID.
+func (s *SessionService) Lookup(ctx context.Context, id string) (*models.Session, error) {
+	sessionID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	var session models.Session
+	if err := s.DB.WithContext(ctx).First(&session, "id = ?", sessionID).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Touch records that session was just used from client.
+func (s *SessionService) Touch(ctx context.Context, session *models.Session, client ClientInfo) {
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) < sessionTouchInterval && session.IPAddress == client.IPAddress {
+		return
+	}
+	updates := map[string]interface{}{
+		"last_seen_at": now,
+		"ip_address":   client.IPAddress,
+	}
+	if client.Country != "" {
+		updates["country"] = client.Country
+		updates["city"] = client.City
+	}
+	if err := s.DB.WithContext(ctx).Model(session).Updates(updates).Error; err != nil {
+		logger.Error("session_touch_failed", err, map[string]interface{}{
+			"session_id": session.ID.String(),
+		})
+		return
+	}
+	session.LastSeenAt = now
+	session.IPAddress = client.IPAddress
+}
+
+func (s *SessionService) newSession(userID uuid.UUID, client ClientInfo, method string, expiresAt *time.Time) *models.Session {
+	return &models.Session{
+		UserID:     userID,
+		Method:     method,
+		DeviceName: DescribeUserAgent(client.UserAgent),
+		UserAgent:  truncateString(client.UserAgent, 512),
+		IPAddress:  client.IPAddress,
+		Country:    client.Country,
+		City:       client.City,
+		LastSeenAt: time.Now(),
+		ExpiresAt:  expiresAt,
+	}
+}
+
+func (s *SessionService) create(ctx context.Context, user *models.User, session *models.Session) error {
+	var newDevice, newCountry bool
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var prior, sameDevice, sameCountry int64
+		if err := tx.Model(&models.Session{}).Where("user_id = ?", user.ID).Count(&prior).Error; err != nil {
+			return err
+		}
+		// The very first sign-in is not news to anyone.
+		if prior > 0 {
+			if err := tx.Model(&models.Session{}).
+				Where("user_id = ? AND device_name = ?", user.ID, session.DeviceName).
+				Count(&sameDevice).Error; err != nil {
+				return err
+			}
+			newDevice = sameDevice == 0
+			if session.Country != "" {
+				if err := tx.Model(&models.Session{}).
+					Where("user_id = ? AND country = ?", user.ID, session.Country).
+					Count(&sameCountry).Error; err != nil {
+					return err
+				}
+				newCountry = sameCountry == 0
+			}
+		}
+
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+		if !newDevice && !newCountry {
+			return nil
+		}
+		return RecordEvent(tx, AuditEntry{
+			UserID:       &user.ID,
+			Action:       "auth.new_device",
+			ResourceType: "session",
+			ResourceID:   &session.ID,
+			Details: map[string]interface{}{
+				"device":      session.DeviceName,
+				"country":     session.Country,
+				"city":        session.City,
+				"method":      session.Method,
+				"new_device":  newDevice,
+				"new_country": newCountry,
+			},
+			IPAddress: session.IPAddress,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if (newDevice || newCountry) && s.Mailer != nil && s.Config.NewDeviceEmail {
+		go s.emailNewDevice(user.Email, *session)
+	}
+	return nil
+}
+
+func (s *SessionService) emailNewDevice(to string, session models.Session) {
+	where := session.IPAddress
+	if session.Country != "" {
+		where = session.Country + " (" + session.IPAddress + ")"
+		if session.City != "" {
+			where = session.City + ", " + where
+		}
+	}
+	body := fmt.Sprintf(`Your DocShare account was just signed in to from a new device or location.
+
+Device:   %s
+Location: %s
+Time:     %s
+
+If this was you, there is nothing to do. Otherwise change your password and
+sign the device out from your account's device list.
+`, session.DeviceName, where, session.CreatedAt.UTC().Format("2006-01-02 15:04 MST"))
+
+	if err := s.Mailer.Send(to, "New sign-in to your DocShare account", body); err != nil {
+		logger.Error("new_device_email_failed", err, map[string]interface{}{
+			"session_id": session.ID.String(),
+		})
+	}
+}
+
+// DescribeUserAgent turns a User-Agent header into a short device name such
+// as "Firefox on Windows". Versions are left out so that browser updates do
+// not count as new devices.
+func DescribeUserAgent(ua string) string {
+	lower := strings.ToLower(ua)
+	switch {
+	case ua == "":
+		return "Unknown device"
+	case strings.HasPrefix(lower, "docshare-cli"):
+		return "DocShare CLI"
+	case strings.HasPrefix(lower, "go-http-client"):
+		return "API client"
+	case strings.HasPrefix(lower, "curl/"):
+		return "curl"
+	}
+
+	browser := ""
+	switch {
+	case strings.Contains(lower, "edg/"):
+		browser = "Edge"
+	case strings.Contains(lower, "opr/"):
+		browser = "Opera"
+	case strings.Contains(lower, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(lower, "chrome/") || strings.Contains(lower, "crios/"):
+		browser = "Chrome"
+	case strings.Contains(lower, "safari/"):
+		browser = "Safari"
+	}
+
+	os := ""
+	switch {
+	case strings.Contains(lower, "iphone") || strings.Contains(lower, "ipad"):
+		os = "iOS"
+	case strings.Contains(lower, "android"):
+		os = "Android"
+	case strings.Contains(lower, "windows"):
+		os = "Windows"
+	case strings.Contains(lower, "mac os x") || strings.Contains(lower, "macintosh"):
+		os = "macOS"
+	case strings.Contains(lower, "cros"):
+		os = "ChromeOS"
+	case strings.Contains(lower, "linux"):
+		os = "Linux"
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os + " device"
+	}
+	return truncateString(ua, 100)
+}
+
+func truncateString(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
@@ -0,0 +1,640 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultSettingsRefreshInterval bounds how long an override changed on
+// another API instance can take to apply here.
+const DefaultSettingsRefreshInterval = 30 * time.Second
+
+// Runtime settings an admin can change without a restart.
+const (
+	SettingUploadMaxSizeMB       = "upload.max_size_mb"
+	SettingRegistrationMode      = "registration.mode"
+	SettingDefaultOrgQuotaBytes  = "organizations.default_quota_bytes"
+	SettingPublicSharing         = "sharing.public_enabled"
+	SettingPublicMaxExpiryDays   = "sharing.public_max_expiry_days"
+	SettingPublicRequirePassword = "sharing.public_require_password"
+	SettingPublicMaxAgeDays      = "sharing.public_max_age_days"
+	SettingPreviewCacheTTL       = "preview.cache_ttl_seconds"
+	SettingAdminIPAllow          = "access.admin.allow"
+	SettingAdminIPDeny           = "access.admin.deny"
+	SettingPublicIPAllow         = "access.public.allow"
+	SettingPublicIPDeny          = "access.public.deny"
+	SettingUserSearchVisibility  = "users.search_visibility"
+	SettingPreviewTokenTTL       = "preview.token_ttl_seconds"
+	SettingPreviewTokenPolicy    = "preview.token_policy"
+	SettingPreviewTokenMaxUses   = "preview.token_max_uses"
+	SettingTermsEnforce          = "terms.enforce"
+)
+
+// ipPolicySettings maps each IP scope to its allow and deny settings.
+var ipPolicySettings = map[IPScope][2]string{
+	IPScopeAdmin:  {SettingAdminIPAllow, SettingAdminIPDeny},
+	IPScopePublic: {SettingPublicIPAllow, SettingPublicIPDeny},
+}
+
+// Registration modes. Invite-only accepts sign-ups carrying a valid share
+// invitation for the address being registered.
+const (
+	RegistrationOpen       = "open"
+	RegistrationInviteOnly = "invite_only"
+	RegistrationClosed     = "closed"
+)
+
+// User search visibility decides whom GET /users/search finds for users
+// without admin access: anyone in their organization, only members of a
+// group they belong to, or nobody.
+const (
+	UserSearchEveryone = "everyone"
+	UserSearchGroups   = "groups"
+	UserSearchDisabled = "disabled"
+)
+
+// Preview token policies decide how many requests one preview token
+// serves: any number until it expires, exactly one, or up to
+// SettingPreviewTokenMaxUses.
+const (
+	PreviewTokenTimeBoxed = "time_boxed"
+	PreviewTokenSingleUse = "single_use"
+	PreviewTokenLimited   = "limited"
+)
+
+var ErrInvalidSetting = errors.New("invalid setting")
+
+// SettingError describes why a setting update was rejected.
+type SettingError struct {
+	Key    string
+	Reason string
+}
+
+func (e *SettingError) Error() string {
+	return e.Key + ": " + e.Reason
+}
+
+func (e *SettingError) Is(target error) bool {
+	return target == ErrInvalidSetting
+}
+
+// SettingType is the JSON type a setting's value must have.
+type SettingType string
+
+const (
+	SettingTypeInt    SettingType = "int"
+	SettingTypeBool   SettingType = "bool"
+	SettingTypeString SettingType = "string"
+	SettingTypeList   SettingType = "list"
+)
+
+type settingDef struct {
+	key         string
+	typ         SettingType
+	def         interface{}
+	description string
+	// validate checks a value already decoded to the setting's type.
+	validate func(v interface{}) string
+}
+
+func intRange(min, max int64) func(interface{}) string {
+	return func(v interface{}) string {
+		if n := v.(int64); n < min || n > max {
+			return fmt.Sprintf("must be between %d and %d", min, max)
+		}
+		return ""
+	}
+}
+
+func oneOf(values ...string) func(interface{}) string {
+	return func(v interface{}) string {
+		for _, allowed := range values {
+			if v.(string) == allowed {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of %v", values)
+	}
+}
+
+func ipList(v interface{}) string {
+	if _, err := parseIPPrefixes(v.([]string)); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func stringList(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func settingDefs(cfg *config.Config) []settingDef {
+	return []settingDef{
+		{
+			key:         SettingUploadMaxSizeMB,
+			typ:         SettingTypeInt,
+			def:         int64(cfg.Server.MaxUploadMB),
+			description: "Largest file accepted by uploads, in MiB.",
+			validate:    intRange(1, 1024*1024),
+		},
+		{
+			key:         SettingRegistrationMode,
+			typ:         SettingTypeString,
+			def:         RegistrationOpen,
+			description: "Who may create an account with a password: open, invite_only or closed.",
+			validate:    oneOf(RegistrationOpen, RegistrationInviteOnly, RegistrationClosed),
+		},
+		{
+			key:         SettingDefaultOrgQuotaBytes,
+			typ:         SettingTypeInt,
+			def:         int64(0),
+			description: "Storage quota given to new organizations created without one, in bytes. 0 means unlimited.",
+			validate:    intRange(0, 1<<62),
+		},
+		{
+			key:         SettingPublicSharing,
+			typ:         SettingTypeBool,
+			def:         true,
+			description: "Whether public links can be created and opened.",
+		},
+		{
+			key:         SettingPublicMaxExpiryDays,
+			typ:         SettingTypeInt,
+			def:         int64(0),
+			description: "Longest a public link may stay valid, in days from its creation. Links made without an expiry get this one. 0 means no limit.",
+			validate:    intRange(0, MaxPublicShareDays),
+		},
+		{
+			key:         SettingPublicRequirePassword,
+			typ:         SettingTypeBool,
+			def:         false,
+			description: "Whether public links can only be made to password-protected files.",
+		},
+		{
+			key:         SettingPublicMaxAgeDays,
+			typ:         SettingTypeInt,
+			def:         int64(0),
+			description: "Public links older than this many days are removed by the nightly policy check, whatever their expiry. 0 turns it off.",
+			validate:    intRange(0, MaxPublicShareDays),
+		},
+		{
+			key:         SettingPreviewCacheTTL,
+			typ:         SettingTypeInt,
+			def:         int64(15 * 60),
+			description: "Lifetime of the preview URLs handed to clients, in seconds.",
+			validate:    intRange(60, 7*24*60*60),
+		},
+		{
+			key:         SettingAdminIPAllow,
+			typ:         SettingTypeList,
+			def:         stringList(cfg.IPPolicy.Admin.Allow),
+			description: "IPs and CIDR ranges allowed to use the admin API. Empty allows all.",
+			validate:    ipList,
+		},
+		{
+			key:         SettingAdminIPDeny,
+			typ:         SettingTypeList,
+			def:         stringList(cfg.IPPolicy.Admin.Deny),
+			description: "IPs and CIDR ranges refused by the admin API.",
+			validate:    ipList,
+		},
+		{
+			key:         SettingPublicIPAllow,
+			typ:         SettingTypeList,
+			def:         stringList(cfg.IPPolicy.Public.Allow),
+			description: "IPs and CIDR ranges allowed to open public links. Empty allows all.",
+			validate:    ipList,
+		},
+		{
+			key:         SettingPublicIPDeny,
+			typ:         SettingTypeList,
+			def:         stringList(cfg.IPPolicy.Public.Deny),
+			description: "IPs and CIDR ranges refused by public links.",
+			validate:    ipList,
+		},
+		{
+			key:         SettingUserSearchVisibility,
+			typ:         SettingTypeString,
+			def:         UserSearchEveryone,
+			description: "Whom user search finds for non-admins: everyone, groups (members of a shared group) or disabled.",
+			validate:    oneOf(UserSearchEveryone, UserSearchGroups, UserSearchDisabled),
+		},
+		{
+			key:         SettingPreviewTokenTTL,
+			typ:         SettingTypeInt,
+			def:         int64(15 * 60),
+			description: "Lifetime of the tokens that open file previews, in seconds.",
+			validate:    intRange(30, 24*60*60),
+		},
+		{
+			key:         SettingPreviewTokenPolicy,
+			typ:         SettingTypeString,
+			def:         PreviewTokenTimeBoxed,
+			description: "How many requests a preview token serves: time_boxed (any until it expires), single_use or limited (preview.token_max_uses).",
+			validate:    oneOf(PreviewTokenTimeBoxed, PreviewTokenSingleUse, PreviewTokenLimited),
+		},
+		{
+			key:         SettingPreviewTokenMaxUses,
+			typ:         SettingTypeInt,
+			def:         int64(20),
+			description: "Requests a preview token serves under the limited policy.",
+			validate:    intRange(1, 1000),
+		},
+		{
+			key:         SettingTermsEnforce,
+			typ:         SettingTypeBool,
+			def:         false,
+			description: "Whether users who have not accepted the terms in force can only reach their account and the terms until they do.",
+		},
+	}
+}
+
+// SettingView is a setting as reported to admins.
+type SettingView struct {
+	Key         string      `json:"key"`
+	Type        SettingType `json:"type"`
+	Value       interface{} `json:"value"`
+	Default     interface{} `json:"default"`
+	Overridden  bool        `json:"overridden"`
+	Description string      `json:"description"`
+	UpdatedByID *uuid.UUID  `json:"updatedByID,omitempty"`
+	UpdatedAt   *time.Time  `json:"updatedAt,omitempty"`
+}
+
+// SettingChange records the old and new value of an updated setting.
+type SettingChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// SettingsService serves runtime settings: environment defaults overlaid
+// with the overrides stored in the settings table. Overrides are cached and
+// reloaded after RefreshInterval, or at once after an update here.
+type SettingsService struct {
+	DB              *gorm.DB
+	RefreshInterval time.Duration
+
+	defs map[string]settingDef
+	keys []string
+
+	mu       sync.Mutex
+	rows     map[string]models.Setting
+	values   map[string]interface{}
+	loadedAt time.Time
+	// policies caches the parsed IP policies of the loaded values.
+	policies map[IPScope]*IPPolicy
+
+	bus *EventBus
+}
+
+// NewSettingsService fails when the IP policy defaults from the
+// environment don't parse.
+func NewSettingsService(db *gorm.DB, cfg *config.Config) (*SettingsService, error) {
+	for env, rules := range map[string]config.IPRules{
+		"IP_POLICY_ADMIN":  cfg.IPPolicy.Admin,
+		"IP_POLICY_PUBLIC": cfg.IPPolicy.Public,
+	} {
+		if _, err := ParseIPPolicy(rules.Allow, rules.Deny); err != nil {
+			return nil, fmt.Errorf("%s_ALLOW/_DENY: %w", env, err)
+		}
+	}
+
+	s := &SettingsService{
+		DB:              db,
+		RefreshInterval: DefaultSettingsRefreshInterval,
+		defs:            map[string]settingDef{},
+	}
+	for _, def := range settingDefs(cfg) {
+		s.defs[def.key] = def
+		s.keys = append(s.keys, def.key)
+	}
+	sort.Strings(s.keys)
+	return s, nil
+}
+
+// load returns the cached overrides, reloading them once they are stale. If
+// the reload fails the previous overrides stay in use.
+func (s *SettingsService) load(ctx context.Context) (map[string]models.Setting, map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.values != nil && time.Since(s.loadedAt) < s.RefreshInterval {
+		return s.rows, s.values
+	}
+
+	var stored []models.Setting
+	if err := s.DB.WithContext(ctx).Find(&stored).Error; err != nil {
+		logger.Error("settings_load_failed", err, nil)
+		return s.rows, s.values
+	}
+
+	rows := map[string]models.Setting{}
+	values := map[string]interface{}{}
+	for _, row := range stored {
+		def, ok := s.defs[row.Key]
+		if !ok {
+			continue
+		}
+		v, reason := decodeSetting(def, json.RawMessage(row.Value))
+		if reason != "" {
+			logger.Warn("setting_ignored", map[string]interface{}{
+				"key":    row.Key,
+				"reason": reason,
+			})
+			continue
+		}
+		rows[row.Key] = row
+		values[row.Key] = v
+	}
+	s.rows, s.values, s.loadedAt = rows, values, time.Now()
+	s.policies = map[IPScope]*IPPolicy{}
+	return rows, values
+}
+
+func (s *SettingsService) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = nil
+}
+
+// UseEventBus makes updates take effect on every instance at once, rather
+// than once their RefreshInterval runs out.
+func (s *SettingsService) UseEventBus(bus *EventBus) {
+	s.bus = bus
+	bus.Subscribe(BusTopicSettings, func(json.RawMessage) { s.invalidate() })
+}
+
+func (s *SettingsService) get(ctx context.Context, key string) interface{} {
+	_, values := s.load(ctx)
+	if v, ok := values[key]; ok {
+		return v
+	}
+	return s.defs[key].def
+}
+
+// decodeSetting parses raw as a value of def's type and validates it.
+func decodeSetting(def settingDef, raw json.RawMessage) (interface{}, string) {
+	var v interface{}
+	switch def.typ {
+	case SettingTypeInt:
+		var n int64
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return nil, "must be an integer"
+		}
+		v = n
+	case SettingTypeBool:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return nil, "must be a boolean"
+		}
+		v = b
+	case SettingTypeString:
+		var str string
+		if err := json.Unmarshal(raw, &str); err != nil {
+			return nil, "must be a string"
+		}
+		v = str
+	case SettingTypeList:
+		var list []string
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, "must be an array of strings"
+		}
+		v = stringList(list)
+	}
+	if def.validate != nil {
+		if reason := def.validate(v); reason != "" {
+			return nil, reason
+		}
+	}
+	return v, ""
+}
+
+// List returns every setting with its effective value, sorted by key.
+func (s *SettingsService) List(ctx context.Context) []SettingView {
+	rows, values := s.load(ctx)
+	views := make([]SettingView, 0, len(s.keys))
+	for _, key := range s.keys {
+		def := s.defs[key]
+		view := SettingView{
+			Key:         key,
+			Type:        def.typ,
+			Value:       def.def,
+			Default:     def.def,
+			Description: def.description,
+		}
+		if v, ok := values[key]; ok {
+			row := rows[key]
+			view.Value = v
+			view.Overridden = true
+			view.UpdatedByID = row.UpdatedByID
+			view.UpdatedAt = &row.UpdatedAt
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
+// Update applies changes atomically. A null value resets the setting to its
+// default. Nothing is written unless every change is valid. The returned
+// map holds the settings whose effective value changed.
+func (s *SettingsService) Update(ctx context.Context, changes map[string]json.RawMessage, updatedBy uuid.UUID) (map[string]SettingChange, error) {
+	type pending struct {
+		key   string
+		value interface{}
+		raw   string
+		reset bool
+	}
+	var updates []pending
+	for key, raw := range changes {
+		def, ok := s.defs[key]
+		if !ok {
+			return nil, &SettingError{Key: key, Reason: "unknown setting"}
+		}
+		if string(raw) == "null" {
+			updates = append(updates, pending{key: key, value: def.def, reset: true})
+			continue
+		}
+		v, reason := decodeSetting(def, raw)
+		if reason != "" {
+			return nil, &SettingError{Key: key, Reason: reason}
+		}
+		encoded, _ := json.Marshal(v)
+		updates = append(updates, pending{key: key, value: v, raw: string(encoded)})
+	}
+
+	applied := map[string]SettingChange{}
+	now := time.Now().UTC()
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, u := range updates {
+			old := s.defs[u.key].def
+			var row models.Setting
+			err := tx.First(&row, "key = ?", u.key).Error
+			switch {
+			case err == nil:
+				if v, reason := decodeSetting(s.defs[u.key], json.RawMessage(row.Value)); reason == "" {
+					old = v
+				}
+			case !errors.Is(err, gorm.ErrRecordNotFound):
+				return err
+			}
+
+			if u.reset {
+				if err := tx.Where("key = ?", u.key).Delete(&models.Setting{}).Error; err != nil {
+					return err
+				}
+			} else {
+				row = models.Setting{Key: u.key, Value: u.raw, UpdatedByID: &updatedBy, UpdatedAt: now}
+				if err := tx.Save(&row).Error; err != nil {
+					return err
+				}
+			}
+			if !reflect.DeepEqual(old, u.value) {
+				applied[u.key] = SettingChange{Old: old, New: u.value}
+			}
+		}
+		return nil
+	})
+	s.invalidate()
+	if err != nil {
+		return nil, err
+	}
+	if len(applied) > 0 {
+		s.bus.Publish(BusTopicSettings, nil)
+	}
+	return applied, nil
+}
+
+// MaxUploadBytes is the largest file uploads accept.
+func (s *SettingsService) MaxUploadBytes(ctx context.Context) int64 {
+	return s.get(ctx, SettingUploadMaxSizeMB).(int64) * 1024 * 1024
+}
+
+// RegistrationMode is one of RegistrationOpen, RegistrationInviteOnly or
+// RegistrationClosed.
+func (s *SettingsService) RegistrationMode(ctx context.Context) string {
+	return s.get(ctx, SettingRegistrationMode).(string)
+}
+
+// DefaultOrganizationQuota is the quota for new organizations created
+// without one, or nil for unlimited.
+func (s *SettingsService) DefaultOrganizationQuota(ctx context.Context) *int64 {
+	quota := s.get(ctx, SettingDefaultOrgQuotaBytes).(int64)
+	if quota <= 0 {
+		return nil
+	}
+	return &quota
+}
+
+func (s *SettingsService) PublicSharingEnabled(ctx context.Context) bool {
+	return s.get(ctx, SettingPublicSharing).(bool)
+}
+
+// PublicSharePolicy is the policy public links are currently held to.
+func (s *SettingsService) PublicSharePolicy(ctx context.Context) PublicSharePolicy {
+	return PublicSharePolicy{
+		MaxExpiryDays:   int(s.get(ctx, SettingPublicMaxExpiryDays).(int64)),
+		RequirePassword: s.get(ctx, SettingPublicRequirePassword).(bool),
+		MaxAgeDays:      int(s.get(ctx, SettingPublicMaxAgeDays).(int64)),
+	}
+}
+
+// TermsEnforced reports whether API access waits on accepting the terms
+// in force.
+func (s *SettingsService) TermsEnforced(ctx context.Context) bool {
+	return s.get(ctx, SettingTermsEnforce).(bool)
+}
+
+// UserSearchVisibility is one of UserSearchEveryone, UserSearchGroups or
+// UserSearchDisabled.
+func (s *SettingsService) UserSearchVisibility(ctx context.Context) string {
+	return s.get(ctx, SettingUserSearchVisibility).(string)
+}
+
+// PreviewURLTTL is how long presigned preview URLs stay valid.
+func (s *SettingsService) PreviewURLTTL(ctx context.Context) time.Duration {
+	return time.Duration(s.get(ctx, SettingPreviewCacheTTL).(int64)) * time.Second
+}
+
+// PreviewTokenTTL is how long newly issued preview tokens stay valid.
+func (s *SettingsService) PreviewTokenTTL(ctx context.Context) time.Duration {
+	return time.Duration(s.get(ctx, SettingPreviewTokenTTL).(int64)) * time.Second
+}
+
+// PreviewTokenMaxUses is how many requests a newly issued preview token
+// may serve under the current policy, 0 meaning no limit.
+func (s *SettingsService) PreviewTokenMaxUses(ctx context.Context) int {
+	switch s.get(ctx, SettingPreviewTokenPolicy).(string) {
+	case PreviewTokenSingleUse:
+		return 1
+	case PreviewTokenLimited:
+		return int(s.get(ctx, SettingPreviewTokenMaxUses).(int64))
+	}
+	return 0
+}
+
+// IPPolicy returns the IP rules currently applied to scope.
+func (s *SettingsService) IPPolicy(ctx context.Context, scope IPScope) *IPPolicy {
+	s.load(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if policy, ok := s.policies[scope]; ok {
+		return policy
+	}
+	policy := s.buildIPPolicy(scope, s.values, nil)
+	if s.policies != nil {
+		s.policies[scope] = policy
+	}
+	return policy
+}
+
+// IPPolicyWith returns the IP rules scope would have once changes, in the
+// form Update takes, were applied. Invalid changes are ignored; Update
+// reports them.
+func (s *SettingsService) IPPolicyWith(ctx context.Context, scope IPScope, changes map[string]json.RawMessage) *IPPolicy {
+	_, values := s.load(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buildIPPolicy(scope, values, changes)
+}
+
+func (s *SettingsService) buildIPPolicy(scope IPScope, values map[string]interface{}, changes map[string]json.RawMessage) *IPPolicy {
+	lists := [2][]string{}
+	for i, key := range ipPolicySettings[scope] {
+		def := s.defs[key]
+		lists[i] = def.def.([]string)
+		if v, ok := values[key]; ok {
+			lists[i] = v.([]string)
+		}
+		if raw, ok := changes[key]; ok {
+			if string(raw) == "null" {
+				lists[i] = def.def.([]string)
+			} else if v, reason := decodeSetting(def, raw); reason == "" {
+				lists[i] = v.([]string)
+			}
+		}
+	}
+	// Both lists were validated when they were stored or configured.
+	policy, err := ParseIPPolicy(lists[0], lists[1])
+	if err != nil {
+		logger.Error("ip_policy_invalid", err, map[string]interface{}{
+			"scope": string(scope),
+		})
+		return nil
+	}
+	return policy
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func setupSettingsTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Setting{}); err != nil {
+		t.Fatalf("failed automigrating models: %v", err)
+	}
+	return db
+}
+
+func TestSettingsService_OverridesAndResets(t *testing.T) {
+	db := setupSettingsTestDB(t)
+	cfg := &config.Config{Server: config.ServerConfig{MaxUploadMB: 512}}
+	settings, _ := NewSettingsService(db, cfg)
+	ctx := context.Background()
+
+	if got := settings.MaxUploadBytes(ctx); got != 512*1024*1024 {
+		t.Fatalf("expected the environment default, got %d", got)
+	}
+
+	changes, err := settings.Update(ctx, map[string]json.RawMessage{
+		SettingUploadMaxSizeMB: json.RawMessage(`64`),
+		SettingPublicSharing:   json.RawMessage(`true`),
+	}, uuid.New())
+	if err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if len(changes) != 1 || changes[SettingUploadMaxSizeMB].Old != int64(512) || changes[SettingUploadMaxSizeMB].New != int64(64) {
+		t.Fatalf("expected only the upload limit reported as changed, got %v", changes)
+	}
+	if got := settings.MaxUploadBytes(ctx); got != 64*1024*1024 {
+		t.Fatalf("expected the override, got %d", got)
+	}
+
+	_, err = settings.Update(ctx, map[string]json.RawMessage{SettingPreviewCacheTTL: json.RawMessage(`5`)}, uuid.New())
+	var settingErr *SettingError
+	if !errors.As(err, &settingErr) || settingErr.Key != SettingPreviewCacheTTL || !errors.Is(err, ErrInvalidSetting) {
+		t.Fatalf("expected an out-of-range error, got %v", err)
+	}
+
+	if _, err := settings.Update(ctx, map[string]json.RawMessage{SettingUploadMaxSizeMB: json.RawMessage(`null`)}, uuid.New()); err != nil {
+		t.Fatalf("reset failed: %v", err)
+	}
+	if got := settings.MaxUploadBytes(ctx); got != 512*1024*1024 {
+		t.Fatalf("expected the default after a reset, got %d", got)
+	}
+}
+
+func TestSettingsService_PicksUpChangesFromOtherInstances(t *testing.T) {
+	db := setupSettingsTestDB(t)
+	cfg := &config.Config{}
+	settings, _ := NewSettingsService(db, cfg)
+	other, _ := NewSettingsService(db, cfg)
+	ctx := context.Background()
+
+	if !settings.PublicSharingEnabled(ctx) {
+		t.Fatal("expected public sharing on by default")
+	}
+	if _, err := other.Update(ctx, map[string]json.RawMessage{SettingPublicSharing: json.RawMessage(`false`)}, uuid.New()); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if !settings.PublicSharingEnabled(ctx) {
+		t.Fatal("expected the cached value until the refresh interval passes")
+	}
+
+	settings.RefreshInterval = time.Nanosecond
+	if settings.PublicSharingEnabled(ctx) {
+		t.Fatal("expected the change to apply after a refresh")
+	}
+}
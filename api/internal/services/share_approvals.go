@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrShareApprovalNotFound = errors.New("share approval not found")
+	ErrShareApprovalDecided  = errors.New("share approval has already been decided")
+	ErrNotShareApprover      = errors.New("only members of the approver group can decide on this share")
+	ErrOwnShareApproval      = errors.New("you cannot decide on a share you requested")
+	ErrShareControlNotFound  = errors.New("folder is not share-controlled")
+	// ErrApprovedShareConflict is returned when a public share approved now
+	// would sit next to another public link of its type.
+	ErrApprovedShareConflict = errors.New("a public share of this type already exists for this file")
+)
+
+// EffectiveShareControl returns the share control over fileID: the file's
+// own if it is a controlled folder, otherwise the nearest controlled
+// ancestor's. It returns nil when nothing on the path is controlled.
+func EffectiveShareControl(ctx context.Context, db *gorm.DB, fileID uuid.UUID) (*models.ShareControl, error) {
+	currentID := fileID
+	for {
+		var control models.ShareControl
+		err := db.WithContext(ctx).Where("folder_id = ?", currentID).First(&control).Error
+		if err == nil {
+			return &control, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+
+		var file models.File
+		if err := db.WithContext(ctx).Select("id", "parent_id").First(&file, "id = ?", currentID).Error; err != nil {
+			return nil, err
+		}
+		if file.ParentID == nil {
+			return nil, nil
+		}
+		currentID = *file.ParentID
+	}
+}
+
+// ShareNeedsApproval reports whether control holds share back for approval.
+func ShareNeedsApproval(control *models.ShareControl, share *models.Share) bool {
+	return control != nil && (!control.PublicOnly || share.IsPublic())
+}
+
+// RequestShareApproval records share as waiting for approval under control
+// instead of creating it.
+func RequestShareApproval(tx *gorm.DB, control *models.ShareControl, share *models.Share, vaultKeys []WrappedKey) (*models.ShareApproval, error) {
+	proposal := models.ShareProposal{
+		SharedWithUserID:  share.SharedWithUserID,
+		SharedWithGroupID: share.SharedWithGroupID,
+		SharedWithEmail:   share.SharedWithEmail,
+		ShareType:         share.ShareType,
+		Permission:        share.Permission,
+		ExpiresAt:         share.ExpiresAt,
+		Message:           share.Message,
+		QuickShare:        share.QuickShare,
+		Watermark:         share.Watermark,
+		ViewOnly:          share.ViewOnly,
+	}
+	for _, key := range vaultKeys {
+		proposal.VaultKeys = append(proposal.VaultKeys, models.ProposedVaultKey{KeyID: key.KeyID, WrappedKey: key.WrappedKey})
+	}
+	approval := models.ShareApproval{
+		FileID:          share.FileID,
+		ControlID:       control.ID,
+		ApproverGroupID: control.ApproverGroupID,
+		RequestedByID:   share.SharedByID,
+		Status:          models.ShareApprovalPending,
+		Proposal:        proposal,
+	}
+	if err := tx.Create(&approval).Error; err != nil {
+		return nil, err
+	}
+	return &approval, nil
+}
+
+// LoadShareApprovalForDecision loads a pending approval that deciderID may
+// decide on: they must be in its approver group and must not have asked
+// for the share themselves.
+func LoadShareApprovalForDecision(ctx context.Context, db *gorm.DB, id, deciderID uuid.UUID) (*models.ShareApproval, error) {
+	var approval models.ShareApproval
+	if err := db.WithContext(ctx).First(&approval, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrShareApprovalNotFound
+		}
+		return nil, err
+	}
+	if approval.RequestedByID == deciderID {
+		return nil, ErrOwnShareApproval
+	}
+	var member int64
+	if err := db.WithContext(ctx).Model(&models.GroupMembership{}).
+		Where("group_id = ? AND user_id = ?", approval.ApproverGroupID, deciderID).
+		Count(&member).Error; err != nil {
+		return nil, err
+	}
+	if member == 0 {
+		return nil, ErrNotShareApprover
+	}
+	if approval.Status != models.ShareApprovalPending {
+		return nil, ErrShareApprovalDecided
+	}
+	return &approval, nil
+}
+
+// DecideShareApproval moves a pending approval to status. Only one decision
+// can win: a second one finds the row no longer pending and gets
+// ErrShareApprovalDecided.
+func DecideShareApproval(tx *gorm.DB, approval *models.ShareApproval, status models.ShareApprovalStatus, deciderID uuid.UUID, reason string, now time.Time) error {
+	result := tx.Model(&models.ShareApproval{}).
+		Where("id = ? AND status = ?", approval.ID, models.ShareApprovalPending).
+		Updates(map[string]interface{}{
+			"status":        status,
+			"decided_by_id": deciderID,
+			"decided_at":    now,
+			"reason":        reason,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrShareApprovalDecided
+	}
+	approval.Status = status
+	approval.DecidedByID = &deciderID
+	approval.DecidedAt = &now
+	approval.Reason = reason
+	return nil
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestShareApprovalsService(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.File{}, &models.GroupMembership{}, &models.ShareControl{}, &models.ShareApproval{}); err != nil {
+		t.Fatalf("failed automigrating models: %v", err)
+	}
+	ctx := context.Background()
+	ownerID, approverID, groupID, otherGroupID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	db.Create(&models.GroupMembership{GroupID: groupID, UserID: approverID, Role: models.GroupRoleMember})
+
+	newFile := func(name string, parent *models.File) models.File {
+		f := models.File{Name: name, OwnerID: ownerID, IsDirectory: true, MimeType: "inode/directory"}
+		if parent != nil {
+			f.ParentID = &parent.ID
+		}
+		if err := db.Create(&f).Error; err != nil {
+			t.Fatalf("failed creating file: %v", err)
+		}
+		return f
+	}
+	root := newFile("root", nil)
+	mid := newFile("mid", &root)
+	leaf := newFile("leaf", &mid)
+
+	t.Run("the nearest control applies", func(t *testing.T) {
+		if control, err := EffectiveShareControl(ctx, db, leaf.ID); err != nil || control != nil {
+			t.Fatalf("expected no control, got %v, %v", control, err)
+		}
+		db.Create(&models.ShareControl{FolderID: root.ID, ApproverGroupID: otherGroupID, CreatedByID: approverID})
+		db.Create(&models.ShareControl{FolderID: mid.ID, ApproverGroupID: groupID, PublicOnly: true, CreatedByID: approverID})
+
+		control, err := EffectiveShareControl(ctx, db, leaf.ID)
+		if err != nil || control == nil || control.FolderID != mid.ID {
+			t.Fatalf("expected mid's control, got %v, %v", control, err)
+		}
+		if ShareNeedsApproval(control, &models.Share{ShareType: models.ShareTypePrivate}) {
+			t.Fatal("expected a public-only control to let private shares through")
+		}
+		if !ShareNeedsApproval(control, &models.Share{ShareType: models.ShareTypePublicLoggedIn}) {
+			t.Fatal("expected a public-only control to hold public shares")
+		}
+	})
+
+	t.Run("an approval is decided once, by the approver group", func(t *testing.T) {
+		control, _ := EffectiveShareControl(ctx, db, leaf.ID)
+		share := models.Share{FileID: leaf.ID, SharedByID: ownerID, ShareType: models.ShareTypePublicAnyone, Permission: models.SharePermissionView}
+		approval, err := RequestShareApproval(db, control, &share, nil)
+		if err != nil {
+			t.Fatalf("failed requesting approval: %v", err)
+		}
+
+		if _, err := LoadShareApprovalForDecision(ctx, db, approval.ID, ownerID); !errors.Is(err, ErrOwnShareApproval) {
+			t.Fatalf("expected ErrOwnShareApproval, got %v", err)
+		}
+		if _, err := LoadShareApprovalForDecision(ctx, db, approval.ID, uuid.New()); !errors.Is(err, ErrNotShareApprover) {
+			t.Fatalf("expected ErrNotShareApprover, got %v", err)
+		}
+		loaded, err := LoadShareApprovalForDecision(ctx, db, approval.ID, approverID)
+		if err != nil {
+			t.Fatalf("expected the approver to load the approval, got %v", err)
+		}
+		if got := loaded.Share(); got.ShareType != share.ShareType || got.SharedByID != ownerID {
+			t.Fatalf("expected the proposal to round-trip, got %+v", got)
+		}
+
+		now := time.Now().UTC()
+		if err := DecideShareApproval(db, loaded, models.ShareApprovalApproved, approverID, "", now); err != nil {
+			t.Fatalf("failed deciding: %v", err)
+		}
+		if err := DecideShareApproval(db, approval, models.ShareApprovalRejected, approverID, "late", now); !errors.Is(err, ErrShareApprovalDecided) {
+			t.Fatalf("expected ErrShareApprovalDecided, got %v", err)
+		}
+		if _, err := LoadShareApprovalForDecision(ctx, db, approval.ID, approverID); !errors.Is(err, ErrShareApprovalDecided) {
+			t.Fatalf("expected ErrShareApprovalDecided on reload, got %v", err)
+		}
+	})
+}
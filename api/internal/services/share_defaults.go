@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MaxShareDefaultExpiryDays bounds the default expiry a folder can set.
+const MaxShareDefaultExpiryDays = 3650
+
+// ErrPublicSharingDisabled is returned when a folder's share defaults forbid
+// public shares of it or its contents.
+var ErrPublicSharingDisabled = errors.New("public sharing is disabled for this folder")
+
+// EffectiveShareDefaults returns the share defaults that apply to fileID:
+// the file's own row if it is a folder with defaults, otherwise the nearest
+// ancestor's, marked Inherited. It returns nil when no folder on the path
+// has defaults.
+func EffectiveShareDefaults(ctx context.Context, db *gorm.DB, fileID uuid.UUID) (*models.FolderShareDefaults, error) {
+	currentID := fileID
+	for {
+		var defaults models.FolderShareDefaults
+		err := db.WithContext(ctx).Where("folder_id = ?", currentID).First(&defaults).Error
+		if err == nil {
+			defaults.Inherited = currentID != fileID
+			return &defaults, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+
+		var file models.File
+		if err := db.WithContext(ctx).Select("id", "parent_id").First(&file, "id = ?", currentID).Error; err != nil {
+			return nil, err
+		}
+		if file.ParentID == nil {
+			return nil, nil
+		}
+		currentID = *file.ParentID
+	}
+}
+
+// ApplyShareDefaults fills the permission and expiry of a new share from
+// defaults when the caller left them unset, and rejects public share types
+// the defaults forbid. A nil defaults leaves the share untouched.
+func ApplyShareDefaults(defaults *models.FolderShareDefaults, share *models.Share, now time.Time) error {
+	if defaults == nil {
+		return nil
+	}
+	if share.IsPublic() && !defaults.AllowPublic {
+		return ErrPublicSharingDisabled
+	}
+	if share.Permission == "" {
+		share.Permission = defaults.Permission
+	}
+	if share.ExpiresAt == nil && defaults.ExpiryDays != nil {
+		expiresAt := now.AddDate(0, 0, *defaults.ExpiryDays)
+		share.ExpiresAt = &expiresAt
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func setupShareDefaultsTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.File{}, &models.FolderShareDefaults{}); err != nil {
+		t.Fatalf("failed automigrating models: %v", err)
+	}
+	return db
+}
+
+func TestEffectiveShareDefaults(t *testing.T) {
+	db := setupShareDefaultsTestDB(t)
+	ctx := context.Background()
+	ownerID := uuid.New()
+
+	newFile := func(name string, parent *models.File, dir bool) models.File {
+		f := models.File{Name: name, OwnerID: ownerID, IsDirectory: dir, MimeType: "text/plain"}
+		if parent != nil {
+			f.ParentID = &parent.ID
+		}
+		if err := db.Create(&f).Error; err != nil {
+			t.Fatalf("failed creating file: %v", err)
+		}
+		return f
+	}
+	root := newFile("root", nil, true)
+	sub := newFile("sub", &root, true)
+	doc := newFile("doc.txt", &sub, false)
+	loose := newFile("loose.txt", nil, false)
+
+	days := 7
+	if err := db.Create(&models.FolderShareDefaults{FolderID: root.ID, Permission: models.SharePermissionDownload, ExpiryDays: &days}).Error; err != nil {
+		t.Fatalf("failed creating defaults: %v", err)
+	}
+
+	got, err := EffectiveShareDefaults(ctx, db, doc.ID)
+	if err != nil || got == nil {
+		t.Fatalf("expected inherited defaults, got %v, %v", got, err)
+	}
+	if got.FolderID != root.ID || !got.Inherited || got.Permission != models.SharePermissionDownload {
+		t.Fatalf("unexpected defaults %+v", got)
+	}
+
+	if err := db.Create(&models.FolderShareDefaults{FolderID: sub.ID, Permission: models.SharePermissionView, AllowPublic: true}).Error; err != nil {
+		t.Fatalf("failed creating defaults: %v", err)
+	}
+	got, _ = EffectiveShareDefaults(ctx, db, sub.ID)
+	if got.FolderID != sub.ID || got.Inherited {
+		t.Fatalf("expected the folder's own defaults, got %+v", got)
+	}
+
+	got, err = EffectiveShareDefaults(ctx, db, loose.ID)
+	if err != nil || got != nil {
+		t.Fatalf("expected no defaults, got %v, %v", got, err)
+	}
+
+	if _, err := EffectiveShareDefaults(ctx, db, uuid.New()); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected not found for unknown file, got %v", err)
+	}
+}
+
+func TestApplyShareDefaults(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	days := 30
+	defaults := &models.FolderShareDefaults{Permission: models.SharePermissionDownload, ExpiryDays: &days}
+
+	share := models.Share{ShareType: models.ShareTypePrivate}
+	if err := ApplyShareDefaults(defaults, &share, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if share.Permission != models.SharePermissionDownload || share.ExpiresAt == nil || !share.ExpiresAt.Equal(now.AddDate(0, 0, 30)) {
+		t.Fatalf("defaults not applied: %+v", share)
+	}
+
+	explicit := now.Add(time.Hour)
+	share = models.Share{ShareType: models.ShareTypePrivate, Permission: models.SharePermissionEdit, ExpiresAt: &explicit}
+	_ = ApplyShareDefaults(defaults, &share, now)
+	if share.Permission != models.SharePermissionEdit || !share.ExpiresAt.Equal(explicit) {
+		t.Fatalf("explicit values overwritten: %+v", share)
+	}
+
+	public := models.Share{ShareType: models.ShareTypePublicAnyone}
+	if err := ApplyShareDefaults(defaults, &public, now); !errors.Is(err, ErrPublicSharingDisabled) {
+		t.Fatalf("expected ErrPublicSharingDisabled, got %v", err)
+	}
+	defaults.AllowPublic = true
+	if err := ApplyShareDefaults(defaults, &public, now); err != nil {
+		t.Fatalf("expected public share allowed, got %v", err)
+	}
+
+	if err := ApplyShareDefaults(nil, &share, now); err != nil {
+		t.Fatalf("nil defaults should be a no-op, got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ShareInvitationTTL is how long an invitation can be accepted when the
+// share itself does not expire sooner.
+const ShareInvitationTTL = 30 * 24 * time.Hour
+
+// ErrInvitationNotFound is returned for an unknown, accepted or expired
+// invitation token.
+var ErrInvitationNotFound = errors.New("invitation not found or expired")
+
+// CreateShareInvitation records the invitation for a pending share and
+// returns the raw token to send to the invited address. Only a hash of the
+// token is stored.
+func CreateShareInvitation(tx *gorm.DB, share *models.Share, orgID *uuid.UUID) (string, *models.ShareInvitation, error) {
+	if share.SharedWithEmail == nil {
+		return "", nil, errors.New("share has no invited email")
+	}
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	token := "dsi_" + hex.EncodeToString(raw)
+
+	expiresAt := time.Now().Add(ShareInvitationTTL)
+	if share.ExpiresAt != nil && share.ExpiresAt.Before(expiresAt) {
+		expiresAt = *share.ExpiresAt
+	}
+	invitation := &models.ShareInvitation{
+		ShareID:        share.ID,
+		Email:          *share.SharedWithEmail,
+		TokenHash:      hashInvitationToken(token),
+		InvitedByID:    share.SharedByID,
+		OrganizationID: orgID,
+		ExpiresAt:      expiresAt,
+	}
+	if err := tx.Create(invitation).Error; err != nil {
+		return "", nil, err
+	}
+	return token, invitation, nil
+}
+
+// LookupShareInvitation returns the pending invitation for token.
+func LookupShareInvitation(ctx context.Context, db *gorm.DB, token string) (*models.ShareInvitation, error) {
+	var invitation models.ShareInvitation
+	err := db.WithContext(ctx).
+		Where("token_hash = ? AND accepted_at IS NULL AND expires_at > ?", hashInvitationToken(token), time.Now()).
+		First(&invitation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvitationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// ClaimShareInvitations binds every pending share invited to user's email
+// address in their organization to user, and returns how many it bound.
+// Callers must only use it once the user has shown they own the address.
+func ClaimShareInvitations(tx *gorm.DB, user *models.User, ipAddress string) (int, error) {
+	var invitations []models.ShareInvitation
+	if err := tx.Scopes(OrganizationScope("share_invitations", user.OrganizationID)).
+		Where("LOWER(email) = ? AND accepted_at IS NULL AND expires_at > ?", strings.ToLower(user.Email), time.Now()).
+		Find(&invitations).Error; err != nil {
+		return 0, err
+	}
+
+	claimed := 0
+	for _, invitation := range invitations {
+		var share models.Share
+		err := tx.Where("id = ? AND shared_with_user_id IS NULL AND shared_with_email IS NOT NULL", invitation.ShareID).
+			First(&share).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// The share was revoked while the invitation was pending.
+			continue
+		}
+		if err != nil {
+			return claimed, err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.Share{}).Where("id = ?", share.ID).Updates(map[string]interface{}{
+			"shared_with_user_id": user.ID,
+			"shared_with_email":   nil,
+		}).Error; err != nil {
+			return claimed, err
+		}
+		if err := tx.Model(&models.ShareInvitation{}).Where("id = ?", invitation.ID).Updates(map[string]interface{}{
+			"accepted_at":    now,
+			"accepted_by_id": user.ID,
+		}).Error; err != nil {
+			return claimed, err
+		}
+
+		var file models.File
+		tx.Select("id", "name").First(&file, "id = ?", share.FileID)
+		if err := RecordEvent(tx, AuditEntry{
+			UserID:       &user.ID,
+			Action:       "share.invitation_accept",
+			ResourceType: "share",
+			ResourceID:   &share.FileID,
+			Details: map[string]interface{}{
+				"file_name":     file.Name,
+				"share_id":      share.ID.String(),
+				"invitation_id": invitation.ID.String(),
+				"shared_by_id":  share.SharedByID.String(),
+			},
+			IPAddress: ipAddress,
+		}); err != nil {
+			return claimed, fmt.Errorf("recording invitation accept: %w", err)
+		}
+		claimed++
+	}
+	return claimed, nil
+}
+
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/keyring"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultSigningKeyRefreshInterval is how often each instance reloads the
+// signing keys, which bounds how long a key added or retired on another
+// instance takes to apply here when no event bus passes the change on.
+const DefaultSigningKeyRefreshInterval = time.Minute
+
+var (
+	ErrSigningKeyNotFound   = errors.New("signing key not found")
+	ErrSigningKeyRetired    = errors.New("signing key already retired")
+	ErrSigningKeyLastActive = errors.New("cannot retire the only active signing key")
+)
+
+// SigningKeyView describes a signing key without its secret.
+type SigningKeyView struct {
+	KID string `json:"kid"`
+	// Source is "environment" for the key from JWT_SECRET and "generated"
+	// for keys added through the admin API.
+	Source    string     `json:"source"`
+	Current   bool       `json:"current"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	RetiredAt *time.Time `json:"retiredAt,omitempty"`
+}
+
+// SigningKeys manages the keys that sign session, MFA and preview tokens.
+// New tokens are signed with the newest active key and any active key
+// validates them, so a key can be replaced by adding its successor and
+// retiring it once the tokens it signed have expired.
+type SigningKeys struct {
+	DB *gorm.DB
+
+	bus *EventBus
+}
+
+func NewSigningKeys(db *gorm.DB) *SigningKeys {
+	return &SigningKeys{DB: db}
+}
+
+// Load reads the keys from the database into the keyring.
+func (s *SigningKeys) Load(ctx context.Context) error {
+	var rows []models.SigningKey
+	if err := s.DB.WithContext(ctx).Order("created_at ASC").Find(&rows).Error; err != nil {
+		return err
+	}
+	var keys []keyring.Key
+	envRetired := false
+	for _, row := range rows {
+		if row.KID == keyring.EnvKeyID {
+			envRetired = row.RetiredAt != nil
+			continue
+		}
+		if row.RetiredAt != nil {
+			continue
+		}
+		// Keys are encrypted with a key derived from JWT_SECRET, so
+		// changing it leaves them unreadable; skip them rather than refuse
+		// to start.
+		secret, err := utils.DecryptAESGCM(row.Secret)
+		if err != nil {
+			logger.Warn("signing_key_unreadable", map[string]interface{}{"kid": row.KID})
+			continue
+		}
+		keys = append(keys, keyring.Key{ID: row.KID, Secret: []byte(secret)})
+	}
+	keyring.SetStoredKeys(keys, envRetired)
+	return nil
+}
+
+// Refresh reloads the keys every interval.
+func (s *SigningKeys) Refresh(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultSigningKeyRefreshInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.reload()
+		}
+	}()
+}
+
+// UseEventBus has keys added or retired on other instances apply here at
+// once.
+func (s *SigningKeys) UseEventBus(bus *EventBus) {
+	s.bus = bus
+	bus.Subscribe(BusTopicSigningKeys, func(json.RawMessage) { s.reload() })
+}
+
+func (s *SigningKeys) reload() {
+	if err := s.Load(context.Background()); err != nil {
+		logger.Error("signing_keys_reload_failed", err, nil)
+	}
+}
+
+// List returns the environment key followed by the added keys, oldest
+// first, retired ones included.
+func (s *SigningKeys) List(ctx context.Context) ([]SigningKeyView, error) {
+	var rows []models.SigningKey
+	if err := s.DB.WithContext(ctx).Order("created_at ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	current := keyring.Current().ID
+	views := []SigningKeyView{{KID: keyring.EnvKeyID, Source: "environment", Current: current == keyring.EnvKeyID}}
+	for _, row := range rows {
+		if row.KID == keyring.EnvKeyID {
+			views[0].RetiredAt = row.RetiredAt
+			continue
+		}
+		createdAt := row.CreatedAt
+		views = append(views, SigningKeyView{
+			KID:       row.KID,
+			Source:    "generated",
+			Current:   row.KID == current,
+			CreatedAt: &createdAt,
+			RetiredAt: row.RetiredAt,
+		})
+	}
+	return views, nil
+}
+
+// Create generates a key, which signs every token issued from then on.
+func (s *SigningKeys) Create(ctx context.Context, createdBy uuid.UUID) (*SigningKeyView, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	encrypted, err := utils.EncryptAESGCM(hex.EncodeToString(secret))
+	if err != nil {
+		return nil, err
+	}
+	row := models.SigningKey{KID: hex.EncodeToString(id), Secret: encrypted, CreatedByID: &createdBy}
+	if err := s.DB.WithContext(ctx).Create(&row).Error; err != nil {
+		return nil, err
+	}
+	if err := s.changed(ctx); err != nil {
+		return nil, err
+	}
+	return &SigningKeyView{KID: row.KID, Source: "generated", Current: true, CreatedAt: &row.CreatedAt}, nil
+}
+
+// Retire stops the key with kid from signing or validating tokens. Tokens
+// it signed stop working at once, so the key should be retired only after
+// its successor has signed tokens for a full token lifetime.
+func (s *SigningKeys) Retire(ctx context.Context, kid string) (*SigningKeyView, error) {
+	now := time.Now()
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var rows []models.SigningKey
+		if err := tx.Find(&rows).Error; err != nil {
+			return err
+		}
+		var target *models.SigningKey
+		active := 1
+		for i, row := range rows {
+			if row.KID == keyring.EnvKeyID && row.RetiredAt != nil {
+				active--
+			} else if row.KID != keyring.EnvKeyID && row.RetiredAt == nil {
+				active++
+			}
+			if row.KID == kid {
+				target = &rows[i]
+			}
+		}
+		switch {
+		case target == nil && kid != keyring.EnvKeyID:
+			return ErrSigningKeyNotFound
+		case target != nil && target.RetiredAt != nil:
+			return ErrSigningKeyRetired
+		case active <= 1:
+			return ErrSigningKeyLastActive
+		case target == nil:
+			return tx.Create(&models.SigningKey{KID: keyring.EnvKeyID, RetiredAt: &now}).Error
+		}
+		return tx.Model(target).Update("retired_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.changed(ctx); err != nil {
+		return nil, err
+	}
+	source := "generated"
+	if kid == keyring.EnvKeyID {
+		source = "environment"
+	}
+	return &SigningKeyView{KID: kid, Source: source, RetiredAt: &now}, nil
+}
+
+// changed reloads the keyring and tells the other instances to do the
+// same.
+func (s *SigningKeys) changed(ctx context.Context) error {
+	if err := s.Load(ctx); err != nil {
+		return err
+	}
+	s.bus.Publish(BusTopicSigningKeys, nil)
+	return nil
+}
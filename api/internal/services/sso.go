@@ -31,10 +31,16 @@ type SSOProfile struct {
 	RawProfile     map[string]interface{}
 }
 
-func (s *SSOService) FindOrCreateUser(ctx context.Context, profile *SSOProfile) (*models.User, error) {
+// FindOrCreateUser signs in the user matching profile's email, creating
+// them in orgID when auto-registration is on. A match belonging to another
+// tenant is refused with ErrOrganizationMismatch.
+func (s *SSOService) FindOrCreateUser(ctx context.Context, profile *SSOProfile, orgID *uuid.UUID) (*models.User, error) {
 	var user models.User
 
 	err := s.DB.WithContext(ctx).First(&user, "email = ?", profile.Email).Error
+	if err == nil && !SameOrganization(user.OrganizationID, orgID) {
+		return nil, ErrOrganizationMismatch
+	}
 	if err == nil {
 		linkedAccount := models.LinkedAccount{
 			UserID:         user.ID,
@@ -90,6 +96,7 @@ func (s *SSOService) FindOrCreateUser(ctx context.Context, profile *SSOProfile)
 		IsEmailVerified: true,
 		AuthProvider:    func() *string { p := string(profile.Provider); return &p }(),
 		ExternalID:      func() *string { p := profile.ProviderUserID; return &p }(),
+		OrganizationID:  orgID,
 	}
 
 	if err := s.DB.WithContext(ctx).Create(&user).Error; err != nil {
@@ -122,18 +129,19 @@ func (s *SSOService) FindOrCreateUser(ctx context.Context, profile *SSOProfile)
 	return &user, nil
 }
 
-func (s *SSOService) GetEnabledProviders(ctx context.Context) ([]models.SSOProvider, error) {
+func (s *SSOService) GetEnabledProviders(ctx context.Context, orgID *uuid.UUID) ([]models.SSOProvider, error) {
 	var providers []models.SSOProvider
 	err := s.DB.WithContext(ctx).
+		Scopes(OrganizationScope("sso_providers", orgID)).
 		Where("enabled = ?", true).
 		Order("priority ASC").
 		Find(&providers).Error
 	return providers, err
 }
 
-func (s *SSOService) GetProviderByName(ctx context.Context, name string) (*models.SSOProvider, error) {
+func (s *SSOService) GetProviderByName(ctx context.Context, name string, orgID *uuid.UUID) (*models.SSOProvider, error) {
 	var provider models.SSOProvider
-	err := s.DB.WithContext(ctx).First(&provider, "name = ? AND enabled = ?", name, true).Error
+	err := s.DB.WithContext(ctx).Scopes(OrganizationScope("sso_providers", orgID)).First(&provider, "name = ? AND enabled = ?", name, true).Error
 	if err != nil {
 		return nil, err
 	}
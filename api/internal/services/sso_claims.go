@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SyncClaimMappings brings the user's role and group memberships in line with
+// the claims of the profile they just signed in with. Only groups referred to
+// by a mapping are touched, and owners are never removed from them. The role
+// is only managed when at least one mapping grants a role: users matching
+// none of those mappings fall back to the regular user role. Every change is
+// recorded as an event.
+func (s *SSOService) SyncClaimMappings(ctx context.Context, user *models.User, profile *SSOProfile, mappings []models.SSOClaimMapping) error {
+	if len(mappings) == 0 {
+		return nil
+	}
+
+	wantGroups := map[uuid.UUID]bool{}
+	managesRole := false
+	wantRole := models.UserRoleUser
+	for _, m := range mappings {
+		matched := ClaimContains(profile.RawProfile, m.Claim, m.Value)
+		if m.GroupID != nil {
+			wantGroups[*m.GroupID] = wantGroups[*m.GroupID] || matched
+		}
+		if m.Role != "" {
+			managesRole = true
+			// admin outranks the sub-roles; among sub-roles the first
+			// matching mapping wins.
+			if matched && m.Role != models.UserRoleUser && (wantRole == models.UserRoleUser || m.Role == models.UserRoleAdmin) {
+				wantRole = m.Role
+			}
+		}
+	}
+
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if managesRole && user.Role != wantRole {
+			if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Update("role", wantRole).Error; err != nil {
+				return err
+			}
+			if err := RecordEvent(tx, AuditEntry{
+				UserID:       &user.ID,
+				Action:       "user.role_change",
+				ResourceType: "user",
+				ResourceID:   &user.ID,
+				Details: map[string]interface{}{
+					"from":     string(user.Role),
+					"to":       string(wantRole),
+					"source":   "sso",
+					"provider": string(profile.Provider),
+				},
+			}); err != nil {
+				return err
+			}
+			user.Role = wantRole
+		}
+
+		if len(wantGroups) == 0 {
+			return nil
+		}
+
+		groupIDs := make([]uuid.UUID, 0, len(wantGroups))
+		for id := range wantGroups {
+			groupIDs = append(groupIDs, id)
+		}
+
+		// A mapping to a group of another tenant, or one deleted since the
+		// mapping was saved, is skipped.
+		var groups []models.Group
+		if err := tx.Scopes(OrganizationScope("groups", user.OrganizationID)).
+			Where("id IN ?", groupIDs).
+			Find(&groups).Error; err != nil {
+			return err
+		}
+
+		var memberships []models.GroupMembership
+		if err := tx.Where("user_id = ? AND group_id IN ?", user.ID, groupIDs).Find(&memberships).Error; err != nil {
+			return err
+		}
+		current := map[uuid.UUID]models.GroupMembership{}
+		for _, m := range memberships {
+			current[m.GroupID] = m
+		}
+
+		for _, group := range groups {
+			membership, isMember := current[group.ID]
+			action := ""
+			switch {
+			case wantGroups[group.ID] && !isMember:
+				if err := tx.Create(&models.GroupMembership{
+					UserID:  user.ID,
+					GroupID: group.ID,
+					Role:    models.GroupRoleMember,
+				}).Error; err != nil {
+					return err
+				}
+				action = "group.member_add"
+			case !wantGroups[group.ID] && isMember && membership.Role != models.GroupRoleOwner:
+				// Hard delete, so the next login that matches can add the
+				// membership back without tripping idx_user_group.
+				if err := tx.Unscoped().Delete(&models.GroupMembership{}, "id = ?", membership.ID).Error; err != nil {
+					return err
+				}
+				action = "group.member_remove"
+			default:
+				continue
+			}
+
+			groupID := group.ID
+			if err := RecordEvent(tx, AuditEntry{
+				UserID:       &user.ID,
+				Action:       action,
+				ResourceType: "group",
+				ResourceID:   &groupID,
+				Details: map[string]interface{}{
+					"target_user_id": user.ID.String(),
+					"group_name":     group.Name,
+					"source":         "sso",
+					"provider":       string(profile.Provider),
+				},
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ClaimContains reports whether the claim holds value, or lists it when the
+// claim is multi-valued. Values are compared case-insensitively, since
+// directories rarely agree on the case of group names and DNs.
+func ClaimContains(raw map[string]interface{}, claim, value string) bool {
+	switch v := raw[claim].(type) {
+	case nil:
+		return false
+	case string:
+		return strings.EqualFold(v, value)
+	case []string:
+		for _, item := range v {
+			if strings.EqualFold(item, value) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if strings.EqualFold(fmt.Sprint(item), value) {
+				return true
+			}
+		}
+	default:
+		return strings.EqualFold(fmt.Sprint(v), value)
+	}
+	return false
+}
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultSSORefreshInterval is how long a tenant's resolved providers are
+// trusted before the database is checked for changes made elsewhere, e.g. by
+// another API instance.
+const DefaultSSORefreshInterval = 30 * time.Second
+
+// SSOProviderInfo is the public description of a sign-in option.
+type SSOProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Type        string `json:"type"`
+
+	priority int
+}
+
+// SSOTenant holds the login services configured for one organization.
+type SSOTenant struct {
+	OAuth     *OAuthProviderService
+	SAML      *SAMLService
+	LDAP      *LDAPService
+	Providers []SSOProviderInfo
+	// ClaimMappings holds the mappings of each enabled stored provider.
+	ClaimMappings map[models.SSOProviderType][]models.SSOClaimMapping
+
+	signature string
+	checkedAt time.Time
+}
+
+// SSOProviderRegistry resolves the identity providers of each organization:
+// those configured through the environment, with any provider stored in the
+// database replacing the environment one of the same type. Results are
+// cached; Invalidate drops them after a change, and RefreshInterval bounds
+// how stale they can get when the change happened on another instance and
+// no event bus passed it on.
+type SSOProviderRegistry struct {
+	DB              *gorm.DB
+	Cfg             *config.Config
+	RefreshInterval time.Duration
+
+	mu      sync.Mutex
+	tenants map[uuid.UUID]*SSOTenant
+	bus     *EventBus
+}
+
+func NewSSOProviderRegistry(db *gorm.DB, cfg *config.Config) *SSOProviderRegistry {
+	return &SSOProviderRegistry{
+		DB:              db,
+		Cfg:             cfg,
+		RefreshInterval: DefaultSSORefreshInterval,
+		tenants:         map[uuid.UUID]*SSOTenant{},
+	}
+}
+
+func tenantKey(orgID *uuid.UUID) uuid.UUID {
+	if orgID == nil {
+		return uuid.Nil
+	}
+	return *orgID
+}
+
+// For returns the login services of an organization, nil meaning the default
+// tenant.
+func (r *SSOProviderRegistry) For(ctx context.Context, orgID *uuid.UUID) (*SSOTenant, error) {
+	key := tenantKey(orgID)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cached := r.tenants[key]
+	if cached != nil && time.Since(cached.checkedAt) < r.RefreshInterval {
+		return cached, nil
+	}
+
+	var stored []models.SSOProvider
+	if err := r.DB.WithContext(ctx).
+		Scopes(OrganizationScope("sso_providers", orgID)).
+		Order("priority ASC, name ASC").
+		Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	// Keep the cached services, and with them the OIDC discovery they
+	// hold, as long as nothing was changed.
+	signature := providersSignature(stored)
+	if cached != nil && cached.signature == signature {
+		cached.checkedAt = time.Now()
+		return cached, nil
+	}
+
+	tenant, err := buildSSOTenant(r.Cfg, stored)
+	if err != nil {
+		return nil, err
+	}
+	tenant.signature = signature
+	tenant.checkedAt = time.Now()
+	r.tenants[key] = tenant
+	return tenant, nil
+}
+
+// Invalidate makes the next For call for the organization rebuild its
+// providers, on this instance and the others on the event bus.
+func (r *SSOProviderRegistry) Invalidate(orgID *uuid.UUID) {
+	key := tenantKey(orgID)
+	r.mu.Lock()
+	delete(r.tenants, key)
+	r.mu.Unlock()
+	r.bus.Publish(BusTopicSSOProviders, key)
+}
+
+// UseEventBus has provider changes made on other instances apply here at
+// once.
+func (r *SSOProviderRegistry) UseEventBus(bus *EventBus) {
+	r.bus = bus
+	bus.Subscribe(BusTopicSSOProviders, func(payload json.RawMessage) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		var key uuid.UUID
+		if payload == nil || json.Unmarshal(payload, &key) != nil {
+			r.tenants = map[uuid.UUID]*SSOTenant{}
+			return
+		}
+		delete(r.tenants, key)
+	})
+}
+
+func providersSignature(providers []models.SSOProvider) string {
+	var b strings.Builder
+	for _, p := range providers {
+		fmt.Fprintf(&b, "%s@%d;", p.ID, p.UpdatedAt.UnixNano())
+	}
+	return b.String()
+}
+
+// ssoProviderDefaults lists the sign-in options in the order the environment
+// configuration offers them, with their default presentation.
+var ssoProviderDefaults = []struct {
+	typ         models.SSOProviderType
+	displayName string
+	infoType    string
+}{
+	{models.SSOProviderTypeGoogle, "Google", "oauth"},
+	{models.SSOProviderTypeGitHub, "GitHub", "oauth"},
+	{models.SSOProviderTypeOIDC, "OpenID Connect", "oidc"},
+	{models.SSOProviderTypeSAML, "Enterprise SSO (SAML)", "saml"},
+	{models.SSOProviderTypeLDAP, "Corporate Directory (LDAP)", "ldap"},
+}
+
+// SSOProviderDisplayName is the name a provider type is shown under when no
+// display name is configured, or "" for unknown types.
+func SSOProviderDisplayName(typ models.SSOProviderType) string {
+	for _, d := range ssoProviderDefaults {
+		if d.typ == typ {
+			return d.displayName
+		}
+	}
+	return ""
+}
+
+// buildSSOTenant overlays stored providers on the environment configuration.
+func buildSSOTenant(base *config.Config, stored []models.SSOProvider) (*SSOTenant, error) {
+	cfg, err := OverlaySSOConfig(base, stored)
+	if err != nil {
+		return nil, err
+	}
+
+	byType := map[models.SSOProviderType]models.SSOProvider{}
+	mappings := map[models.SSOProviderType][]models.SSOClaimMapping{}
+	for _, p := range stored {
+		byType[p.Type] = p
+		if p.Enabled && len(p.ClaimMappings) > 0 {
+			mappings[p.Type] = p.ClaimMappings
+		}
+	}
+
+	enabled := map[models.SSOProviderType]bool{
+		models.SSOProviderTypeGoogle: cfg.SSO.Google.Enabled,
+		models.SSOProviderTypeGitHub: cfg.SSO.GitHub.Enabled,
+		models.SSOProviderTypeOIDC:   cfg.SSO.OIDC.Enabled,
+		models.SSOProviderTypeSAML:   cfg.SAML.Enabled,
+		models.SSOProviderTypeLDAP:   cfg.LDAP.Enabled,
+	}
+
+	providers := []SSOProviderInfo{}
+	for _, d := range ssoProviderDefaults {
+		if !enabled[d.typ] {
+			continue
+		}
+		info := SSOProviderInfo{Name: string(d.typ), DisplayName: d.displayName, Type: d.infoType, priority: 100}
+		if p, ok := byType[d.typ]; ok {
+			if p.DisplayName != "" {
+				info.DisplayName = p.DisplayName
+			}
+			info.priority = p.Priority
+		}
+		providers = append(providers, info)
+	}
+	sort.SliceStable(providers, func(i, j int) bool { return providers[i].priority < providers[j].priority })
+
+	return &SSOTenant{
+		OAuth:         NewOAuthProviderService(cfg),
+		SAML:          NewSAMLService(cfg),
+		LDAP:          NewLDAPService(cfg),
+		Providers:     providers,
+		ClaimMappings: mappings,
+	}, nil
+}
+
+// OverlaySSOConfig returns a copy of base in which each stored provider
+// replaces the environment configuration of its type. A disabled stored
+// provider therefore also hides the environment one.
+func OverlaySSOConfig(base *config.Config, stored []models.SSOProvider) (*config.Config, error) {
+	cfg := *base
+	backendURL := strings.TrimRight(base.Server.BackendURL, "/")
+
+	for _, p := range stored {
+		clientSecret, err := decryptOptional(p.ClientSecret)
+		if err != nil {
+			return nil, fmt.Errorf("sso provider %s: %w", p.Name, err)
+		}
+		// RedirectURL doubles as the ACS URL for SAML providers.
+		redirectURL := p.RedirectURL
+		if redirectURL == "" && p.Type == models.SSOProviderTypeSAML {
+			redirectURL = backendURL + "/auth/sso/saml/acs"
+		} else if redirectURL == "" {
+			redirectURL = backendURL + "/auth/sso/oauth/" + string(p.Type) + "/callback"
+		}
+
+		switch p.Type {
+		case models.SSOProviderTypeGoogle, models.SSOProviderTypeGitHub:
+			scopes := p.Scopes
+			if scopes == "" {
+				scopes = defaultSSOScopes[p.Type]
+			}
+			oauthCfg := config.OAuthProviderConfig{
+				Enabled:      p.Enabled,
+				ClientID:     p.ClientID,
+				ClientSecret: clientSecret,
+				RedirectURL:  redirectURL,
+				Scopes:       scopes,
+			}
+			if p.Type == models.SSOProviderTypeGoogle {
+				cfg.SSO.Google = oauthCfg
+			} else {
+				cfg.SSO.GitHub = oauthCfg
+			}
+		case models.SSOProviderTypeOIDC:
+			scopes := p.Scopes
+			if scopes == "" {
+				scopes = defaultSSOScopes[p.Type]
+			}
+			cfg.SSO.OIDC = config.OIDCProviderConfig{
+				Enabled:      p.Enabled,
+				ClientID:     p.ClientID,
+				ClientSecret: clientSecret,
+				RedirectURL:  redirectURL,
+				Scopes:       scopes,
+				IssuerURL:    p.IssuerURL,
+			}
+		case models.SSOProviderTypeSAML:
+			cfg.SAML = config.SAMLConfig{
+				Enabled:        p.Enabled,
+				IDPMetadataURL: p.MetadataURL,
+				SPEntityID:     p.EntityID,
+				SPACSURL:       redirectURL,
+				SPKeyPath:      base.SAML.SPKeyPath,
+				SPCertPath:     base.SAML.SPCertPath,
+			}
+		case models.SSOProviderTypeLDAP:
+			bindPassword, err := decryptOptional(p.LDAPBindPassword)
+			if err != nil {
+				return nil, fmt.Errorf("sso provider %s: %w", p.Name, err)
+			}
+			cfg.LDAP = config.LDAPConfig{
+				Enabled:      p.Enabled,
+				URL:          p.LDAPURL,
+				BindDN:       p.LDAPBindDN,
+				BindPassword: bindPassword,
+				SearchBase:   p.LDAPSearchBase,
+				UserFilter:   p.LDAPUserFilter,
+				EmailField:   orDefault(p.LDAPEmailField, "mail"),
+				NameFields:   orDefault(p.LDAPNameFields, "givenName,sn"),
+			}
+		}
+	}
+
+	return &cfg, nil
+}
+
+// defaultSSOScopes mirrors the scope defaults of the environment
+// configuration.
+var defaultSSOScopes = map[models.SSOProviderType]string{
+	models.SSOProviderTypeGoogle: "openid,email,profile",
+	models.SSOProviderTypeGitHub: "read:user,user:email",
+	models.SSOProviderTypeOIDC:   "openid,profile,email",
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func decryptOptional(encrypted string) (string, error) {
+	if encrypted == "" {
+		return "", nil
+	}
+	return utils.DecryptAESGCM(encrypted)
+}
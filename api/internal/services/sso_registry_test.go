@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/utils"
+	"github.com/google/uuid"
+)
+
+func TestOverlaySSOConfig(t *testing.T) {
+	utils.ConfigureEncryption("sso-registry-test-secret-32bytes")
+
+	secret, err := utils.EncryptAESGCM("db-secret")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	base := &config.Config{
+		Server: config.ServerConfig{BackendURL: "https://docs.example.com/api/"},
+		SSO: config.SSOConfig{
+			Google: config.OAuthProviderConfig{Enabled: true, ClientID: "env-google"},
+			GitHub: config.OAuthProviderConfig{Enabled: true, ClientID: "env-github"},
+		},
+	}
+
+	cfg, err := OverlaySSOConfig(base, []models.SSOProvider{
+		{Type: models.SSOProviderTypeGoogle, Name: "google", Enabled: true, ClientID: "db-google", ClientSecret: secret},
+		{Type: models.SSOProviderTypeGitHub, Name: "github", Enabled: false, ClientID: "db-github"},
+	})
+	if err != nil {
+		t.Fatalf("overlay: %v", err)
+	}
+
+	if cfg.SSO.Google.ClientID != "db-google" || cfg.SSO.Google.ClientSecret != "db-secret" {
+		t.Errorf("expected stored google provider with decrypted secret, got %+v", cfg.SSO.Google)
+	}
+	if cfg.SSO.Google.RedirectURL != "https://docs.example.com/api/auth/sso/oauth/google/callback" {
+		t.Errorf("unexpected derived redirect URL %q", cfg.SSO.Google.RedirectURL)
+	}
+	if cfg.SSO.Google.Scopes != "openid,email,profile" {
+		t.Errorf("expected default scopes, got %q", cfg.SSO.Google.Scopes)
+	}
+	if cfg.SSO.GitHub.Enabled {
+		t.Error("a disabled stored provider should hide the environment one")
+	}
+	if base.SSO.Google.ClientID != "env-google" {
+		t.Error("overlay must not modify the base configuration")
+	}
+
+	if _, err := OverlaySSOConfig(base, []models.SSOProvider{
+		{Type: models.SSOProviderTypeOIDC, Name: "oidc", ClientSecret: "not-encrypted"},
+	}); err == nil {
+		t.Error("expected an error for an undecryptable secret")
+	}
+}
+
+func TestSSOProviderRegistry(t *testing.T) {
+	utils.ConfigureEncryption("sso-registry-test-secret-32bytes")
+	db := setupSSOTestDB(t)
+	ctx := context.Background()
+
+	cfg := &config.Config{
+		SSO: config.SSOConfig{
+			GitHub: config.OAuthProviderConfig{Enabled: true, ClientID: "env-github"},
+		},
+	}
+	registry := NewSSOProviderRegistry(db, cfg)
+
+	names := func(t *testing.T, orgID *uuid.UUID) []string {
+		t.Helper()
+		tenant, err := registry.For(ctx, orgID)
+		if err != nil {
+			t.Fatalf("For: %v", err)
+		}
+		out := []string{}
+		for _, p := range tenant.Providers {
+			out = append(out, p.Name+"="+p.DisplayName)
+		}
+		return out
+	}
+
+	if got := names(t, nil); len(got) != 1 || got[0] != "github=GitHub" {
+		t.Fatalf("expected only the environment provider, got %v", got)
+	}
+
+	orgID := uuid.New()
+	secret, _ := utils.EncryptAESGCM("s3cret")
+	stored := models.SSOProvider{
+		Name:           "google",
+		DisplayName:    "Acme Google",
+		Type:           models.SSOProviderTypeGoogle,
+		Enabled:        true,
+		Priority:       10,
+		ClientID:       "acme-google",
+		ClientSecret:   secret,
+		OrganizationID: &orgID,
+	}
+	if err := db.Create(&stored).Error; err != nil {
+		t.Fatalf("create provider: %v", err)
+	}
+
+	t.Run("stored providers only apply to their organization", func(t *testing.T) {
+		if got := names(t, &orgID); len(got) != 2 || got[0] != "google=Acme Google" || got[1] != "github=GitHub" {
+			t.Fatalf("expected stored provider first by priority, got %v", got)
+		}
+		if got := names(t, nil); len(got) != 1 {
+			t.Fatalf("default tenant should not see another organization's provider, got %v", got)
+		}
+	})
+
+	t.Run("cached until invalidated", func(t *testing.T) {
+		if err := db.Model(&stored).Update("enabled", false).Error; err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		if got := names(t, &orgID); len(got) != 2 {
+			t.Fatalf("expected cached providers, got %v", got)
+		}
+		registry.Invalidate(&orgID)
+		if got := names(t, &orgID); len(got) != 1 {
+			t.Fatalf("expected disabled provider to disappear, got %v", got)
+		}
+	})
+
+	t.Run("picks up changes after the refresh interval", func(t *testing.T) {
+		registry.RefreshInterval = time.Nanosecond
+		defer func() { registry.RefreshInterval = DefaultSSORefreshInterval }()
+
+		first, _ := registry.For(ctx, &orgID)
+		again, _ := registry.For(ctx, &orgID)
+		if first != again {
+			t.Fatal("unchanged providers should keep the same services")
+		}
+
+		if err := db.Model(&stored).Update("enabled", true).Error; err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		if got := names(t, &orgID); len(got) != 2 {
+			t.Fatalf("expected re-enabled provider, got %v", got)
+		}
+	})
+}
@@ -2,11 +2,13 @@ package services
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/docshare/api/internal/config"
 	"github.com/docshare/api/internal/models"
 	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -22,7 +24,7 @@ func setupSSOTestDB(t *testing.T) *gorm.DB {
 	sqlDB.SetMaxOpenConns(1)
 	t.Cleanup(func() { _ = sqlDB.Close() })
 
-	err = db.AutoMigrate(&models.User{}, &models.Group{}, &models.GroupMembership{}, &models.LinkedAccount{}, &models.SSOProvider{})
+	err = db.AutoMigrate(&models.User{}, &models.Group{}, &models.GroupMembership{}, &models.LinkedAccount{}, &models.SSOProvider{}, &models.OutboxEvent{})
 	if err != nil {
 		t.Fatalf("failed automigrating: %v", err)
 	}
@@ -58,7 +60,7 @@ func TestSSOService_FindOrCreateUser_ExistingUser(t *testing.T) {
 	}
 
 	t.Run("returns existing user without creating new", func(t *testing.T) {
-		user, err := service.FindOrCreateUser(context.Background(), profile)
+		user, err := service.FindOrCreateUser(context.Background(), profile, nil)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -101,7 +103,7 @@ func TestSSOService_FindOrCreateUser_NewUser(t *testing.T) {
 	}
 
 	t.Run("creates new user when auto-register enabled", func(t *testing.T) {
-		user, err := service.FindOrCreateUser(context.Background(), profile)
+		user, err := service.FindOrCreateUser(context.Background(), profile, nil)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -149,7 +151,7 @@ func TestSSOService_FindOrCreateUser_AutoRegisterDisabled(t *testing.T) {
 	}
 
 	t.Run("returns error when auto-register disabled and user not found", func(t *testing.T) {
-		_, err := service.FindOrCreateUser(context.Background(), profile)
+		_, err := service.FindOrCreateUser(context.Background(), profile, nil)
 		if err == nil {
 			t.Fatal("expected error")
 		}
@@ -165,7 +167,7 @@ func TestSSOService_GetEnabledProviders(t *testing.T) {
 	service := NewSSOService(db, cfg)
 
 	t.Run("returns empty when no providers configured", func(t *testing.T) {
-		providers, err := service.GetEnabledProviders(context.Background())
+		providers, err := service.GetEnabledProviders(context.Background(), nil)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -193,7 +195,7 @@ func TestSSOService_GetEnabledProviders(t *testing.T) {
 		}
 		db.Create(&githubProvider)
 
-		providers, err := service.GetEnabledProviders(context.Background())
+		providers, err := service.GetEnabledProviders(context.Background(), nil)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -321,3 +323,149 @@ func TestSSOService_FindLinkedAccount(t *testing.T) {
 		}
 	})
 }
+
+func TestSSOService_OrganizationScoping(t *testing.T) {
+	db := setupSSOTestDB(t)
+	service := NewSSOService(db, &config.Config{SSO: config.SSOConfig{AutoRegister: true}})
+	orgID := uuid.New()
+
+	db.Create(&models.SSOProvider{Name: "default-oidc", DisplayName: "Default", Type: models.SSOProviderTypeOIDC, Enabled: true})
+	db.Create(&models.SSOProvider{Name: "acme-oidc", DisplayName: "Acme", Type: models.SSOProviderTypeOIDC, Enabled: true, OrganizationID: &orgID})
+
+	providers, err := service.GetEnabledProviders(context.Background(), &orgID)
+	if err != nil || len(providers) != 1 || providers[0].Name != "acme-oidc" {
+		t.Fatalf("expected only the tenant's provider, got %v, %v", providers, err)
+	}
+	if _, err := service.GetProviderByName(context.Background(), "acme-oidc", nil); err == nil {
+		t.Fatal("expected tenant provider to be hidden from the default tenant")
+	}
+
+	profile := &SSOProfile{Provider: models.SSOProviderTypeOIDC, ProviderUserID: "acme-1", Email: "jit@acme.test", FirstName: "Jit", LastName: "User"}
+	user, err := service.FindOrCreateUser(context.Background(), profile, &orgID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.OrganizationID == nil || *user.OrganizationID != orgID {
+		t.Fatalf("expected user created in the tenant, got %v", user.OrganizationID)
+	}
+
+	if _, err := service.FindOrCreateUser(context.Background(), profile, nil); !errors.Is(err, ErrOrganizationMismatch) {
+		t.Fatalf("expected ErrOrganizationMismatch, got %v", err)
+	}
+}
+
+func TestSSOService_SyncClaimMappings(t *testing.T) {
+	db := setupSSOTestDB(t)
+	service := NewSSOService(db, &config.Config{})
+	ctx := context.Background()
+
+	user := &models.User{Email: "jit@test.com", PasswordHash: "x", FirstName: "Jit", LastName: "User", Role: models.UserRoleUser}
+	db.Create(user)
+	engineering := models.Group{Name: "Engineering", CreatedByID: user.ID}
+	sales := models.Group{Name: "Sales", CreatedByID: user.ID}
+	owned := models.Group{Name: "Owned", CreatedByID: user.ID}
+	manual := models.Group{Name: "Manual", CreatedByID: user.ID}
+	for _, g := range []*models.Group{&engineering, &sales, &owned, &manual} {
+		db.Create(g)
+	}
+	db.Create(&models.GroupMembership{UserID: user.ID, GroupID: sales.ID, Role: models.GroupRoleMember})
+	db.Create(&models.GroupMembership{UserID: user.ID, GroupID: owned.ID, Role: models.GroupRoleOwner})
+	db.Create(&models.GroupMembership{UserID: user.ID, GroupID: manual.ID, Role: models.GroupRoleMember})
+
+	mappings := []models.SSOClaimMapping{
+		{Claim: "groups", Value: "eng", GroupID: &engineering.ID},
+		{Claim: "groups", Value: "sales", GroupID: &sales.ID},
+		{Claim: "groups", Value: "owners", GroupID: &owned.ID},
+		{Claim: "groups", Value: "security", Role: models.UserRoleAuditor},
+		{Claim: "groups", Value: "docshare-admins", Role: models.UserRoleAdmin},
+	}
+	profile := &SSOProfile{
+		Provider:   models.SSOProviderTypeOIDC,
+		RawProfile: map[string]interface{}{"groups": []interface{}{"ENG", "docshare-admins"}},
+	}
+
+	memberOf := func() map[string]bool {
+		var names []string
+		db.Model(&models.GroupMembership{}).
+			Joins("JOIN groups ON groups.id = group_memberships.group_id").
+			Where("group_memberships.user_id = ?", user.ID).
+			Pluck("groups.name", &names)
+		out := map[string]bool{}
+		for _, n := range names {
+			out[n] = true
+		}
+		return out
+	}
+
+	if err := service.SyncClaimMappings(ctx, user, profile, mappings); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	groups := memberOf()
+	if !groups["Engineering"] || groups["Sales"] {
+		t.Errorf("expected Engineering added and Sales removed, got %v", groups)
+	}
+	if !groups["Owned"] || !groups["Manual"] {
+		t.Errorf("owners and unmapped groups must be left alone, got %v", groups)
+	}
+	var stored models.User
+	db.First(&stored, "id = ?", user.ID)
+	if stored.Role != models.UserRoleAdmin || user.Role != models.UserRoleAdmin {
+		t.Errorf("expected admin role, got %s", stored.Role)
+	}
+
+	var events int64
+	db.Model(&models.OutboxEvent{}).Count(&events)
+	if events != 3 {
+		t.Errorf("expected 3 recorded changes, got %d", events)
+	}
+
+	t.Run("reconciled on the next login", func(t *testing.T) {
+		profile.RawProfile = map[string]interface{}{"groups": []interface{}{"sales"}}
+		if err := service.SyncClaimMappings(ctx, user, profile, mappings); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+		groups := memberOf()
+		if groups["Engineering"] || !groups["Sales"] {
+			t.Errorf("expected memberships to follow the claims, got %v", groups)
+		}
+		db.First(&stored, "id = ?", user.ID)
+		if stored.Role != models.UserRoleUser {
+			t.Errorf("expected admin role to be revoked, got %s", stored.Role)
+		}
+	})
+	t.Run("grants a sub-role when admin does not match", func(t *testing.T) {
+		profile.RawProfile = map[string]interface{}{"groups": []interface{}{"security"}}
+		if err := service.SyncClaimMappings(ctx, user, profile, mappings); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+		db.First(&stored, "id = ?", user.ID)
+		if stored.Role != models.UserRoleAuditor {
+			t.Errorf("expected auditor role, got %s", stored.Role)
+		}
+	})
+}
+
+func TestClaimContains(t *testing.T) {
+	raw := map[string]interface{}{
+		"groups":   []interface{}{"Admins", "Staff"},
+		"memberOf": []string{"cn=eng,dc=example,dc=com"},
+		"dept":     "Finance",
+		"verified": true,
+	}
+	tests := []struct {
+		claim, value string
+		want         bool
+	}{
+		{"groups", "staff", true},
+		{"groups", "others", false},
+		{"memberOf", "CN=eng,DC=example,DC=com", true},
+		{"dept", "finance", true},
+		{"verified", "true", true},
+		{"missing", "x", false},
+	}
+	for _, tt := range tests {
+		if got := ClaimContains(raw, tt.claim, tt.value); got != tt.want {
+			t.Errorf("ClaimContains(%q, %q) = %v, want %v", tt.claim, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/storage"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	storageReconcileJob = "storage.reconcile"
+	// DefaultReconcileMinAge is how old an unreferenced object must be to
+	// count as an orphan when the request does not say.
+	DefaultReconcileMinAge = 24 * time.Hour
+	// maxReconcileFindings caps the orphans and missing files listed on a
+	// run; the counts still cover everything found.
+	maxReconcileFindings = 1000
+	reconcileBatchSize   = 500
+)
+
+var (
+	ErrReconcileRunning  = errors.New("a storage reconciliation is already in progress")
+	ErrReconcileNotFound = errors.New("storage reconciliation not found")
+)
+
+// reconcileSkippedPrefixes hold objects that belong to something other
+// than files, such as the audit log S3 export, relayed transfers, avatars
+// and legal exports, or that are caches kept by their own service, such as
+// preview renditions.
+var reconcileSkippedPrefixes = []string{"audit-logs/", "transfers/", "avatars/", legalExportPrefix, renditionPrefix}
+
+// ObjectStore is the part of the storage client reconciliation needs.
+type ObjectStore interface {
+	ListObjects(ctx context.Context, prefix, startAfter string, fn func(storage.ObjectInfo) error) error
+	Delete(ctx context.Context, objectName string) error
+}
+
+// ReconcileOptions say what a reconciliation may clean. A dry run only
+// reports, whatever else is set.
+type ReconcileOptions struct {
+	DryRun        bool
+	DeleteOrphans bool
+	RemoveMissing bool
+	MinAge        time.Duration
+}
+
+// StorageReconciler compares the bucket with the files table. Orphans are
+// objects no live file row or preview refers to, left behind by failed
+// uploads or replaced previews; missing objects are file rows whose bytes
+// are gone, e.g. after a delete that crashed halfway. Runs go through the
+// job runner one at a time and keep their report in
+// storage_reconciliations.
+type StorageReconciler struct {
+	DB    *gorm.DB
+	Store ObjectStore
+	Jobs  *JobRunner
+	now   func() time.Time
+}
+
+func NewStorageReconciler(db *gorm.DB, store ObjectStore, jobs *JobRunner) *StorageReconciler {
+	r := &StorageReconciler{DB: db, Store: store, Jobs: jobs, now: time.Now}
+	jobs.Register(storageReconcileJob, r.runJob, JobOptions{MaxAttempts: 1})
+	return r
+}
+
+// Start records a pending run and queues it.
+func (r *StorageReconciler) Start(ctx context.Context, requestedByID uuid.UUID, opts ReconcileOptions) (*models.StorageReconciliation, error) {
+	if opts.MinAge <= 0 {
+		opts.MinAge = DefaultReconcileMinAge
+	}
+	rec := models.StorageReconciliation{
+		RequestedByID: requestedByID,
+		Status:        models.ReconciliationStatusPending,
+		DryRun:        opts.DryRun,
+		DeleteOrphans: opts.DeleteOrphans,
+		RemoveMissing: opts.RemoveMissing,
+		MinAgeSeconds: int64(opts.MinAge / time.Second),
+	}
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var active int64
+		if err := tx.Model(&models.StorageReconciliation{}).
+			Where("status IN ?", []models.ReconciliationStatus{models.ReconciliationStatusPending, models.ReconciliationStatusRunning}).
+			Count(&active).Error; err != nil {
+			return err
+		}
+		if active > 0 {
+			return ErrReconcileRunning
+		}
+		if err := tx.Create(&rec).Error; err != nil {
+			return err
+		}
+		_, err := r.Jobs.enqueue(tx, storageReconcileJob, map[string]interface{}{"reconciliation_id": rec.ID.String()}, EnqueueOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// Get loads one run with its findings.
+func (r *StorageReconciler) Get(ctx context.Context, id uuid.UUID) (*models.StorageReconciliation, error) {
+	var rec models.StorageReconciliation
+	if err := r.DB.WithContext(ctx).First(&rec, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReconcileNotFound
+		}
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (r *StorageReconciler) runJob(ctx context.Context, job *models.Job) error {
+	raw, _ := job.Payload["reconciliation_id"].(string)
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("storage reconcile job without a reconciliation id: %q", raw)
+	}
+	rec, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return r.Run(ctx, rec)
+}
+
+// Run carries out a reconciliation and saves its report, whether or not
+// it succeeds.
+func (r *StorageReconciler) Run(ctx context.Context, rec *models.StorageReconciliation) error {
+	started := r.now().UTC()
+	rec.Status = models.ReconciliationStatusRunning
+	rec.StartedAt = &started
+	if err := r.DB.Save(rec).Error; err != nil {
+		return err
+	}
+
+	runErr := r.reconcile(ctx, rec)
+	finished := r.now().UTC()
+	rec.FinishedAt = &finished
+	rec.Status = models.ReconciliationStatusCompleted
+	if runErr != nil {
+		rec.Status = models.ReconciliationStatusFailed
+		rec.LastError = runErr.Error()
+	}
+	if err := r.DB.Save(rec).Error; err != nil {
+		return err
+	}
+
+	fields := map[string]interface{}{
+		"reconciliation_id": rec.ID.String(),
+		"dry_run":           rec.DryRun,
+		"objects_scanned":   rec.ObjectsScanned,
+		"files_scanned":     rec.FilesScanned,
+		"orphans":           rec.OrphanCount,
+		"missing":           rec.MissingCount,
+		"orphans_deleted":   rec.OrphansDeleted,
+		"missing_removed":   rec.MissingRemoved,
+	}
+	if runErr != nil {
+		logger.Error("storage_reconcile_failed", runErr, fields)
+		return runErr
+	}
+	logger.Info("storage_reconcile_completed", fields)
+	return nil
+}
+
+func (r *StorageReconciler) reconcile(ctx context.Context, rec *models.StorageReconciliation) error {
+	if r.Store == nil {
+		return errors.New("object storage is not configured")
+	}
+	listedAt := r.now().UTC()
+	cutoff := listedAt.Add(-time.Duration(rec.MinAgeSeconds) * time.Second)
+
+	objects := map[string]storage.ObjectInfo{}
+	err := r.Store.ListObjects(ctx, "", "", func(obj storage.ObjectInfo) error {
+		for _, prefix := range reconcileSkippedPrefixes {
+			if strings.HasPrefix(obj.Key, prefix) {
+				return nil
+			}
+		}
+		rec.ObjectsScanned++
+		objects[obj.Key] = obj
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("listing bucket: %w", err)
+	}
+
+	// Rows created after the listing may point at objects it did not see,
+	// so only older rows can be missing their bytes.
+	referenced := map[string]bool{}
+	var missing []models.File
+	var batch []models.File
+	err = r.DB.WithContext(ctx).Model(&models.File{}).
+		Select("id", "name", "owner_id", "storage_path", "thumbnail_path", "created_at").
+		Where("is_directory = ? AND archived_at IS NULL", false).
+		FindInBatches(&batch, reconcileBatchSize, func(_ *gorm.DB, _ int) error {
+			for _, f := range batch {
+				rec.FilesScanned++
+				if f.ThumbnailPath != nil && *f.ThumbnailPath != "" {
+					referenced[*f.ThumbnailPath] = true
+				}
+				if f.StoragePath == "" {
+					continue
+				}
+				referenced[f.StoragePath] = true
+				if _, ok := objects[f.StoragePath]; !ok && f.CreatedAt.Before(listedAt) {
+					missing = append(missing, f)
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return fmt.Errorf("scanning files: %w", err)
+	}
+
+	var orphans []storage.ObjectInfo
+	for key, obj := range objects {
+		if !referenced[key] && obj.LastModified.Before(cutoff) {
+			orphans = append(orphans, obj)
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].Key < orphans[j].Key })
+
+	rec.OrphanCount = int64(len(orphans))
+	rec.Orphans = nil
+	for _, obj := range orphans {
+		rec.OrphanBytes += obj.Size
+		if len(rec.Orphans) < maxReconcileFindings {
+			rec.Orphans = append(rec.Orphans, models.OrphanObject{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified})
+		}
+	}
+	rec.MissingCount = int64(len(missing))
+	rec.Missing = nil
+	for _, f := range missing {
+		if len(rec.Missing) >= maxReconcileFindings {
+			break
+		}
+		rec.Missing = append(rec.Missing, models.MissingObject{FileID: f.ID, Name: f.Name, OwnerID: f.OwnerID, StoragePath: f.StoragePath})
+	}
+
+	if rec.DryRun {
+		return nil
+	}
+	if rec.DeleteOrphans {
+		if err := r.deleteOrphans(ctx, rec, orphans); err != nil {
+			return err
+		}
+	}
+	if rec.RemoveMissing {
+		return r.removeMissing(ctx, rec, missing)
+	}
+	return nil
+}
+
+// deleteOrphans removes orphaned objects, checking each batch against the
+// files table once more in case an upload claimed a key since the scan.
+func (r *StorageReconciler) deleteOrphans(ctx context.Context, rec *models.StorageReconciliation, orphans []storage.ObjectInfo) error {
+	for start := 0; start < len(orphans); start += reconcileBatchSize {
+		end := min(start+reconcileBatchSize, len(orphans))
+		keys := make([]string, 0, end-start)
+		for _, obj := range orphans[start:end] {
+			keys = append(keys, obj.Key)
+		}
+
+		var claimed []models.File
+		if err := r.DB.WithContext(ctx).Select("storage_path", "thumbnail_path").
+			Where("storage_path IN ? OR thumbnail_path IN ?", keys, keys).
+			Find(&claimed).Error; err != nil {
+			return fmt.Errorf("rechecking orphans: %w", err)
+		}
+		skip := map[string]bool{}
+		for _, f := range claimed {
+			skip[f.StoragePath] = true
+			if f.ThumbnailPath != nil {
+				skip[*f.ThumbnailPath] = true
+			}
+		}
+
+		for _, key := range keys {
+			if skip[key] {
+				continue
+			}
+			if err := r.Store.Delete(ctx, key); err != nil {
+				logger.Warn("storage_reconcile_delete_failed", map[string]interface{}{
+					"reconciliation_id": rec.ID.String(),
+					"object_name":       key,
+					"error":             err.Error(),
+				})
+				continue
+			}
+			rec.OrphansDeleted++
+		}
+	}
+	return nil
+}
+
+// removeMissing deletes the rows of files whose bytes are gone, with their
+// shares, recording a file.delete for each on behalf of the admin who
+// started the run.
+func (r *StorageReconciler) removeMissing(ctx context.Context, rec *models.StorageReconciliation, missing []models.File) error {
+	for _, f := range missing {
+		err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("file_id = ?", f.ID).Delete(&models.Share{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&models.File{}, "id = ?", f.ID).Error; err != nil {
+				return err
+			}
+			return RecordEvent(tx, AuditEntry{
+				UserID:       &rec.RequestedByID,
+				Action:       "file.delete",
+				ResourceType: "file",
+				ResourceID:   &f.ID,
+				Details: map[string]interface{}{
+					"file_name":         f.Name,
+					"owner_id":          f.OwnerID.String(),
+					"reason":            "storage_missing",
+					"reconciliation_id": rec.ID.String(),
+				},
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("removing file %s: %w", f.ID, err)
+		}
+		rec.MissingRemoved++
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/storage"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type fakeObjectStore struct {
+	objects map[string]storage.ObjectInfo
+	deleted []string
+}
+
+func (s *fakeObjectStore) ListObjects(_ context.Context, prefix, _ string, fn func(storage.ObjectInfo) error) error {
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := fn(s.objects[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fakeObjectStore) Delete(_ context.Context, key string) error {
+	delete(s.objects, key)
+	s.deleted = append(s.deleted, key)
+	return nil
+}
+
+func TestStorageReconciler(t *testing.T) {
+	logger.Init()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.File{}, &models.Share{}, &models.Job{}, &models.StorageReconciliation{}, &models.OutboxEvent{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+
+	owner := models.User{Email: "reconcile@test.com", FirstName: "R", LastName: "C", PasswordHash: "x"}
+	db.Create(&owner)
+	old := time.Now().Add(-48 * time.Hour)
+	thumb := "owner/previews/kept.jpg"
+	kept := models.File{Name: "kept.txt", MimeType: "text/plain", OwnerID: owner.ID, StoragePath: "owner/kept.txt", ThumbnailPath: &thumb}
+	lost := models.File{Name: "lost.txt", MimeType: "text/plain", OwnerID: owner.ID, StoragePath: "owner/lost.txt"}
+	db.Create(&kept)
+	db.Create(&lost)
+	db.Create(&models.Share{FileID: lost.ID, SharedByID: owner.ID, ShareType: models.ShareTypePublicAnyone, Permission: models.SharePermissionView})
+
+	store := &fakeObjectStore{objects: map[string]storage.ObjectInfo{}}
+	put := func(key string, size int64, modified time.Time) {
+		store.objects[key] = storage.ObjectInfo{Key: key, Size: size, LastModified: modified}
+	}
+	put("owner/kept.txt", 10, old)
+	put(thumb, 5, old)
+	put("owner/abandoned.bin", 100, old)
+	put("uploads/owner/stale/part.bin", 50, old)
+	put("uploads/owner/fresh/part.bin", 70, time.Now())
+	put("audit-logs/2024/01/01.ndjson", 30, old)
+	put("transfers/0b8e/data", 40, old)
+	put("avatars/0b8e/3f9c/128.jpg", 20, old)
+	put("renditions/0b8e/3f9c/w640.jpg", 20, old)
+
+	jobs := NewJobRunner(db, config.JobsConfig{})
+	r := NewStorageReconciler(db, store, jobs)
+	ctx := context.Background()
+	adminID := uuid.New()
+
+	run := func(opts ReconcileOptions) models.StorageReconciliation {
+		t.Helper()
+		rec, err := r.Start(ctx, adminID, opts)
+		if err != nil {
+			t.Fatalf("failed starting: %v", err)
+		}
+		if _, err := r.Start(ctx, adminID, opts); err != ErrReconcileRunning {
+			t.Fatalf("expected a second run to be refused, got %v", err)
+		}
+		if ran, err := jobs.RunNext(ctx); !ran || err != nil {
+			t.Fatalf("expected the job to run, got %v %v", ran, err)
+		}
+		got, err := r.Get(ctx, rec.ID)
+		if err != nil {
+			t.Fatalf("failed loading run: %v", err)
+		}
+		if got.Status != models.ReconciliationStatusCompleted {
+			t.Fatalf("expected the run completed, got %s (%s)", got.Status, got.LastError)
+		}
+		return *got
+	}
+
+	t.Run("dry run only reports", func(t *testing.T) {
+		rec := run(ReconcileOptions{DryRun: true, DeleteOrphans: true, RemoveMissing: true})
+		if rec.ObjectsScanned != 5 || rec.FilesScanned != 2 {
+			t.Fatalf("unexpected scan counts %+v", rec)
+		}
+		if rec.OrphanCount != 2 || rec.OrphanBytes != 150 {
+			t.Fatalf("expected the abandoned and stale objects, got %+v", rec.Orphans)
+		}
+		if rec.Orphans[0].Key != "owner/abandoned.bin" || rec.Orphans[1].Key != "uploads/owner/stale/part.bin" {
+			t.Fatalf("unexpected orphans %+v", rec.Orphans)
+		}
+		if rec.MissingCount != 1 || rec.Missing[0].FileID != lost.ID {
+			t.Fatalf("expected lost.txt missing, got %+v", rec.Missing)
+		}
+		if len(store.deleted) != 0 || rec.OrphansDeleted != 0 || rec.MissingRemoved != 0 {
+			t.Fatalf("expected nothing cleaned, got %v", store.deleted)
+		}
+	})
+
+	t.Run("cleans when asked", func(t *testing.T) {
+		rec := run(ReconcileOptions{DeleteOrphans: true, RemoveMissing: true})
+		if rec.OrphansDeleted != 2 || rec.MissingRemoved != 1 {
+			t.Fatalf("unexpected cleanup counts %+v", rec)
+		}
+		if _, ok := store.objects["uploads/owner/fresh/part.bin"]; !ok {
+			t.Fatal("expected the recent upload left alone")
+		}
+		var files, shares int64
+		db.Model(&models.File{}).Count(&files)
+		db.Model(&models.Share{}).Count(&shares)
+		if files != 1 || shares != 0 {
+			t.Fatalf("expected the missing file and its share removed, got %d files %d shares", files, shares)
+		}
+		var events int64
+		db.Model(&models.OutboxEvent{}).Where("event_type = ? AND resource_id = ?", "file.delete", lost.ID).Count(&events)
+		if events != 1 {
+			t.Fatalf("expected a file.delete event, got %d", events)
+		}
+	})
+}
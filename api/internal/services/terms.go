@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTermsNotFound   = errors.New("terms version not found")
+	ErrTermsInvalid    = errors.New("invalid terms version")
+	ErrTermsExists     = errors.New("this version of the document is already published")
+	ErrTermsRetired    = errors.New("terms version already retired")
+	ErrTermsNotCurrent = errors.New("terms version is no longer in force")
+)
+
+var termsKindPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// PublishTermsRequest is a new version of a document. Kind is a lowercase
+// slug such as "terms" or "privacy"; a version of a kind already published
+// supersedes the previous one.
+type PublishTermsRequest struct {
+	Kind    string
+	Version string
+	Title   string
+	Body    string
+	URL     string
+}
+
+// TermsVersionView is a terms version as listed to admins.
+type TermsVersionView struct {
+	models.TermsVersion
+	Current     bool  `json:"current"`
+	Acceptances int64 `json:"acceptances"`
+}
+
+// UserTerms is a terms version in force, and whether the user has
+// accepted it.
+type UserTerms struct {
+	models.TermsVersion
+	AcceptedAt *time.Time `json:"acceptedAt,omitempty"`
+}
+
+// TermsService publishes the documents users have to accept and records
+// their acceptance. Whether API access waits on acceptance is the
+// terms.enforce setting.
+type TermsService struct {
+	DB       *gorm.DB
+	Settings *SettingsService
+}
+
+func NewTermsService(db *gorm.DB, settings *SettingsService) *TermsService {
+	return &TermsService{DB: db, Settings: settings}
+}
+
+// Enforced reports whether users with pending terms are restricted to
+// accepting them.
+func (s *TermsService) Enforced(ctx context.Context) bool {
+	return s.Settings != nil && s.Settings.TermsEnforced(ctx)
+}
+
+// Publish puts a new version in force. Users have to accept it, even if
+// they accepted the version it replaces.
+func (s *TermsService) Publish(ctx context.Context, publishedBy uuid.UUID, req PublishTermsRequest) (*models.TermsVersion, error) {
+	version := models.TermsVersion{
+		Kind:          strings.TrimSpace(req.Kind),
+		Version:       strings.TrimSpace(req.Version),
+		Title:         strings.TrimSpace(req.Title),
+		Body:          strings.TrimSpace(req.Body),
+		URL:           strings.TrimSpace(req.URL),
+		PublishedByID: publishedBy,
+		PublishedAt:   time.Now().UTC(),
+	}
+	switch {
+	case !termsKindPattern.MatchString(version.Kind):
+		return nil, fmt.Errorf("%w: kind must be a lowercase slug of up to 50 characters", ErrTermsInvalid)
+	case version.Version == "" || len(version.Version) > 50:
+		return nil, fmt.Errorf("%w: version is required and at most 50 characters", ErrTermsInvalid)
+	case version.Title == "" || len(version.Title) > 255:
+		return nil, fmt.Errorf("%w: title is required and at most 255 characters", ErrTermsInvalid)
+	case version.Body == "" && version.URL == "":
+		return nil, fmt.Errorf("%w: set a body, a url or both", ErrTermsInvalid)
+	}
+	if version.URL != "" {
+		u, err := url.Parse(version.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, fmt.Errorf("%w: url must be an http or https URL", ErrTermsInvalid)
+		}
+	}
+
+	db := s.DB.WithContext(ctx)
+	var count int64
+	if err := db.Unscoped().Model(&models.TermsVersion{}).
+		Where("kind = ? AND version = ?", version.Kind, version.Version).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrTermsExists
+	}
+	if err := db.Create(&version).Error; err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// List returns every version, newest first, with how many users accepted
+// each.
+func (s *TermsService) List(ctx context.Context) ([]TermsVersionView, error) {
+	db := s.DB.WithContext(ctx)
+	var versions []models.TermsVersion
+	if err := db.Order("published_at DESC, created_at DESC").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	var counts []struct {
+		TermsVersionID uuid.UUID
+		Count          int64
+	}
+	if err := db.Model(&models.TermsAcceptance{}).
+		Select("terms_version_id, COUNT(*) AS count").
+		Group("terms_version_id").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	accepted := make(map[uuid.UUID]int64, len(counts))
+	for _, c := range counts {
+		accepted[c.TermsVersionID] = c.Count
+	}
+
+	current := currentTerms(versions)
+	views := make([]TermsVersionView, 0, len(versions))
+	for _, v := range versions {
+		views = append(views, TermsVersionView{
+			TermsVersion: v,
+			Current:      current[v.Kind] == v.ID,
+			Acceptances:  accepted[v.ID],
+		})
+	}
+	return views, nil
+}
+
+func (s *TermsService) Get(ctx context.Context, id uuid.UUID) (*models.TermsVersion, error) {
+	var version models.TermsVersion
+	if err := s.DB.WithContext(ctx).First(&version, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTermsNotFound
+		}
+		return nil, err
+	}
+	return &version, nil
+}
+
+// Retire takes a version out of force. The previous unretired version of
+// its kind, if any, is in force again; users who accepted it are not asked
+// again.
+func (s *TermsService) Retire(ctx context.Context, id uuid.UUID) (*models.TermsVersion, error) {
+	version, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if version.RetiredAt != nil {
+		return nil, ErrTermsRetired
+	}
+	now := time.Now().UTC()
+	if err := s.DB.WithContext(ctx).Model(version).Update("retired_at", now).Error; err != nil {
+		return nil, err
+	}
+	version.RetiredAt = &now
+	return version, nil
+}
+
+// Current returns the version in force of each kind, ordered by kind.
+func (s *TermsService) Current(ctx context.Context) ([]models.TermsVersion, error) {
+	var versions []models.TermsVersion
+	if err := s.DB.WithContext(ctx).
+		Where("retired_at IS NULL").
+		Order("kind ASC, published_at DESC, created_at DESC").
+		Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	current := currentTerms(versions)
+	out := versions[:0]
+	for _, v := range versions {
+		if current[v.Kind] == v.ID {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// ForUser returns the versions in force with when userID accepted each.
+func (s *TermsService) ForUser(ctx context.Context, userID uuid.UUID) ([]UserTerms, error) {
+	current, err := s.Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(current) == 0 {
+		return []UserTerms{}, nil
+	}
+	ids := make([]uuid.UUID, len(current))
+	for i, v := range current {
+		ids[i] = v.ID
+	}
+	var acceptances []models.TermsAcceptance
+	if err := s.DB.WithContext(ctx).
+		Where("user_id = ? AND terms_version_id IN ?", userID, ids).
+		Find(&acceptances).Error; err != nil {
+		return nil, err
+	}
+	acceptedAt := make(map[uuid.UUID]time.Time, len(acceptances))
+	for _, a := range acceptances {
+		acceptedAt[a.TermsVersionID] = a.AcceptedAt
+	}
+
+	out := make([]UserTerms, len(current))
+	for i, v := range current {
+		out[i] = UserTerms{TermsVersion: v}
+		if at, ok := acceptedAt[v.ID]; ok {
+			out[i].AcceptedAt = &at
+		}
+	}
+	return out, nil
+}
+
+// Pending returns the versions in force userID has not accepted.
+func (s *TermsService) Pending(ctx context.Context, userID uuid.UUID) ([]models.TermsVersion, error) {
+	terms, err := s.ForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	pending := []models.TermsVersion{}
+	for _, t := range terms {
+		if t.AcceptedAt == nil {
+			pending = append(pending, t.TermsVersion)
+		}
+	}
+	return pending, nil
+}
+
+// Accept records that userID accepted the version versionID from ip. Only
+// a version in force can be accepted. Accepting again keeps the first
+// acceptance.
+func (s *TermsService) Accept(ctx context.Context, userID, versionID uuid.UUID, ip, userAgent string) (*models.TermsAcceptance, error) {
+	version, err := s.Get(ctx, versionID)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inForce := false
+	for _, v := range current {
+		if v.ID == version.ID {
+			inForce = true
+			break
+		}
+	}
+	if !inForce {
+		return nil, ErrTermsNotCurrent
+	}
+
+	acceptance := models.TermsAcceptance{
+		UserID:         userID,
+		TermsVersionID: version.ID,
+		AcceptedAt:     time.Now().UTC(),
+		IPAddress:      ip,
+		UserAgent:      userAgent,
+	}
+	db := s.DB.WithContext(ctx)
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&acceptance).Error; err != nil {
+		return nil, err
+	}
+	var stored models.TermsAcceptance
+	if err := db.First(&stored, "user_id = ? AND terms_version_id = ?", userID, version.ID).Error; err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// currentTerms maps each kind to the ID of its version in force, given
+// versions ordered newest first.
+func currentTerms(versions []models.TermsVersion) map[string]uuid.UUID {
+	current := map[string]uuid.UUID{}
+	for _, v := range versions {
+		if v.RetiredAt != nil {
+			continue
+		}
+		if _, ok := current[v.Kind]; !ok {
+			current[v.Kind] = v.ID
+		}
+	}
+	return current
+}
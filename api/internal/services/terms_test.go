@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestTermsService(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&models.TermsVersion{}, &models.TermsAcceptance{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+
+	ctx := context.Background()
+	terms := NewTermsService(db, nil)
+	admin, user := uuid.New(), uuid.New()
+	publish := func(t *testing.T, kind, version string) *models.TermsVersion {
+		t.Helper()
+		v, err := terms.Publish(ctx, admin, PublishTermsRequest{Kind: kind, Version: version, Title: "Terms " + version, Body: "Be nice."})
+		if err != nil {
+			t.Fatalf("failed publishing %s %s: %v", kind, version, err)
+		}
+		return v
+	}
+	pendingIDs := func(t *testing.T) []uuid.UUID {
+		t.Helper()
+		pending, err := terms.Pending(ctx, user)
+		if err != nil {
+			t.Fatalf("failed loading pending terms: %v", err)
+		}
+		ids := make([]uuid.UUID, len(pending))
+		for i, v := range pending {
+			ids[i] = v.ID
+		}
+		return ids
+	}
+
+	t.Run("refuses invalid versions", func(t *testing.T) {
+		for name, req := range map[string]PublishTermsRequest{
+			"bad kind":   {Kind: "Terms Of Service", Version: "1", Title: "x", Body: "x"},
+			"no version": {Kind: "terms", Title: "x", Body: "x"},
+			"no title":   {Kind: "terms", Version: "1", Body: "x"},
+			"no content": {Kind: "terms", Version: "1", Title: "x"},
+			"bad url":    {Kind: "terms", Version: "1", Title: "x", URL: "javascript:alert(1)"},
+		} {
+			if _, err := terms.Publish(ctx, admin, req); !errors.Is(err, ErrTermsInvalid) {
+				t.Errorf("%s: expected ErrTermsInvalid, got %v", name, err)
+			}
+		}
+	})
+
+	tos1 := publish(t, "terms", "2024-01")
+	privacy := publish(t, "privacy", "1")
+
+	t.Run("a new version supersedes the old one", func(t *testing.T) {
+		if _, err := terms.Publish(ctx, admin, PublishTermsRequest{Kind: "terms", Version: "2024-01", Title: "x", Body: "x"}); !errors.Is(err, ErrTermsExists) {
+			t.Fatalf("expected ErrTermsExists, got %v", err)
+		}
+		if _, err := terms.Accept(ctx, user, tos1.ID, "203.0.113.9", "test"); err != nil {
+			t.Fatalf("failed accepting: %v", err)
+		}
+		if ids := pendingIDs(t); len(ids) != 1 || ids[0] != privacy.ID {
+			t.Fatalf("expected only the privacy notice pending, got %v", ids)
+		}
+
+		tos2 := publish(t, "terms", "2024-06")
+		if _, err := terms.Accept(ctx, user, tos1.ID, "203.0.113.9", "test"); !errors.Is(err, ErrTermsNotCurrent) {
+			t.Fatalf("expected superseded terms to be refused, got %v", err)
+		}
+		if ids := pendingIDs(t); len(ids) != 2 || ids[0] != privacy.ID || ids[1] != tos2.ID {
+			t.Fatalf("expected the privacy notice and the new terms pending, got %v", ids)
+		}
+
+		// Retiring the new version puts the accepted one back in force.
+		if _, err := terms.Retire(ctx, tos2.ID); err != nil {
+			t.Fatalf("failed retiring: %v", err)
+		}
+		if _, err := terms.Retire(ctx, tos2.ID); !errors.Is(err, ErrTermsRetired) {
+			t.Fatalf("expected ErrTermsRetired, got %v", err)
+		}
+		if ids := pendingIDs(t); len(ids) != 1 || ids[0] != privacy.ID {
+			t.Fatalf("expected only the privacy notice pending, got %v", ids)
+		}
+	})
+
+	t.Run("accepting twice keeps the first acceptance", func(t *testing.T) {
+		first, err := terms.Accept(ctx, user, privacy.ID, "203.0.113.9", "first")
+		if err != nil {
+			t.Fatalf("failed accepting: %v", err)
+		}
+		again, err := terms.Accept(ctx, user, privacy.ID, "198.51.100.1", "second")
+		if err != nil {
+			t.Fatalf("failed accepting again: %v", err)
+		}
+		if again.ID != first.ID || again.IPAddress != "203.0.113.9" || again.UserAgent != "first" {
+			t.Fatalf("expected the first acceptance, got %+v", again)
+		}
+		if ids := pendingIDs(t); len(ids) != 0 {
+			t.Fatalf("expected nothing pending, got %v", ids)
+		}
+
+		views, err := terms.List(ctx)
+		if err != nil {
+			t.Fatalf("failed listing: %v", err)
+		}
+		for _, v := range views {
+			if v.ID == privacy.ID && (!v.Current || v.Acceptances != 1) {
+				t.Fatalf("unexpected view %+v", v)
+			}
+		}
+	})
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/internal/storage"
+	"github.com/docshare/api/pkg/textrender"
+)
+
+// Kinds of HTML text preview.
+const (
+	TextPreviewMarkdown = "markdown"
+	TextPreviewCode     = "code"
+	TextPreviewText     = "text"
+)
+
+var ErrTextPreviewUnsupported = errors.New("file has no text preview")
+
+// TextPreview is a rendered, sanitized HTML fragment for a text file.
+type TextPreview struct {
+	Kind      string `json:"kind"`
+	Language  string `json:"language,omitempty"`
+	HTML      string `json:"html"`
+	Truncated bool   `json:"truncated"`
+}
+
+// TextPreviewService renders Markdown and source files to HTML on the
+// server so clients, including public share viewers, need no highlighter
+// of their own. Rendered previews are cached by file version.
+type TextPreviewService struct {
+	Storage  *storage.S3Client
+	MaxBytes int64
+
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+type textPreviewEntry struct {
+	key     string
+	preview *TextPreview
+}
+
+func NewTextPreviewService(storageClient *storage.S3Client, cfg config.PreviewConfig) *TextPreviewService {
+	return &TextPreviewService{
+		Storage:  storageClient,
+		MaxBytes: cfg.TextMaxBytes,
+		capacity: cfg.TextCacheEntries,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+var markdownExtensions = map[string]bool{
+	".md":       true,
+	".markdown": true,
+	".mdown":    true,
+	".mkd":      true,
+}
+
+// TextPreviewKind reports how file would be rendered, or "" when it has no
+// text preview.
+func TextPreviewKind(file *models.File) (kind, language string) {
+	if file.IsDirectory {
+		return "", ""
+	}
+	mimeType := baseMediaType(file.MimeType)
+	if markdownExtensions[strings.ToLower(filepath.Ext(file.Name))] || mimeType == "text/markdown" {
+		return TextPreviewMarkdown, ""
+	}
+	if lang := textrender.LanguageForFile(file.Name); lang != "" {
+		return TextPreviewCode, lang
+	}
+	if strings.HasPrefix(mimeType, "text/") {
+		return TextPreviewText, ""
+	}
+	return "", ""
+}
+
+// Render returns the HTML preview for file, reading at most MaxBytes of it.
+func (s *TextPreviewService) Render(ctx context.Context, file *models.File) (*TextPreview, error) {
+	kind, lang := TextPreviewKind(file)
+	if kind == "" {
+		return nil, ErrTextPreviewUnsupported
+	}
+
+	key := textPreviewCacheKey(file)
+	if cached := s.cached(key); cached != nil {
+		return cached, nil
+	}
+
+	obj, err := s.Storage.Download(ctx, file.StoragePath)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	body, err := io.ReadAll(io.LimitReader(obj, s.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	preview, err := RenderTextPreview(kind, lang, body, s.MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+	s.store(key, preview)
+	return preview, nil
+}
+
+// RenderTextPreview renders body as kind, truncating it to maxBytes at a
+// line boundary. Content that looks binary is refused.
+func RenderTextPreview(kind, lang string, body []byte, maxBytes int64) (*TextPreview, error) {
+	head := body
+	if len(head) > 8192 {
+		head = head[:8192]
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return nil, ErrTextPreviewUnsupported
+	}
+
+	truncated := false
+	if maxBytes > 0 && int64(len(body)) > maxBytes {
+		body = body[:maxBytes]
+		if nl := bytes.LastIndexByte(body, '\n'); nl > 0 {
+			body = body[:nl+1]
+		}
+		truncated = true
+	}
+	text := strings.ToValidUTF8(string(body), string(utf8.RuneError))
+
+	preview := &TextPreview{Kind: kind, Language: lang, Truncated: truncated}
+	switch kind {
+	case TextPreviewMarkdown:
+		preview.HTML = textrender.Markdown(text)
+	default:
+		preview.HTML = textrender.Highlight(text, lang)
+	}
+	return preview, nil
+}
+
+// textPreviewCacheKey changes whenever the content does: edits bump
+// updated_at and rewrite the checksum.
+func textPreviewCacheKey(file *models.File) string {
+	checksum := ""
+	if file.Checksum != nil {
+		checksum = *file.Checksum
+	}
+	return file.ID.String() + "|" + file.UpdatedAt.UTC().Format(time.RFC3339Nano) + "|" + checksum
+}
+
+func (s *TextPreviewService) cached(key string) *TextPreview {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[key]; ok {
+		s.order.MoveToFront(el)
+		return el.Value.(*textPreviewEntry).preview
+	}
+	return nil
+}
+
+func (s *TextPreviewService) store(key string, preview *TextPreview) {
+	if s.capacity <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[key]; ok {
+		s.order.MoveToFront(el)
+		return
+	}
+	s.entries[key] = s.order.PushFront(&textPreviewEntry{key: key, preview: preview})
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*textPreviewEntry).key)
+	}
+}
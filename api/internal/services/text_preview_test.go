@@ -0,0 +1,95 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestTextPreviewKind(t *testing.T) {
+	cases := []struct {
+		file     models.File
+		kind     string
+		language string
+	}{
+		{models.File{Name: "README.md", MimeType: "application/octet-stream"}, TextPreviewMarkdown, ""},
+		{models.File{Name: "notes", MimeType: "text/markdown; charset=utf-8"}, TextPreviewMarkdown, ""},
+		{models.File{Name: "main.go", MimeType: "text/x-go"}, TextPreviewCode, "go"},
+		{models.File{Name: "log.txt", MimeType: "text/plain"}, TextPreviewText, ""},
+		{models.File{Name: "photo.png", MimeType: "image/png"}, "", ""},
+		{models.File{Name: "src.go", IsDirectory: true}, "", ""},
+	}
+	for _, tc := range cases {
+		kind, lang := TextPreviewKind(&tc.file)
+		if kind != tc.kind || lang != tc.language {
+			t.Errorf("TextPreviewKind(%s) = %q, %q; want %q, %q", tc.file.Name, kind, lang, tc.kind, tc.language)
+		}
+	}
+}
+
+func TestRenderTextPreview(t *testing.T) {
+	t.Run("markdown is rendered", func(t *testing.T) {
+		preview, err := RenderTextPreview(TextPreviewMarkdown, "", []byte("# Title\n\n<script>x</script>"), 1024)
+		if err != nil {
+			t.Fatalf("RenderTextPreview: %v", err)
+		}
+		if !strings.Contains(preview.HTML, `<h1 id="title">Title</h1>`) || strings.Contains(preview.HTML, "<script>") {
+			t.Fatalf("unexpected html: %s", preview.HTML)
+		}
+	})
+
+	t.Run("truncates at a line boundary", func(t *testing.T) {
+		body := []byte("line one\nline two\nline three\n")
+		preview, err := RenderTextPreview(TextPreviewText, "", body, 14)
+		if err != nil {
+			t.Fatalf("RenderTextPreview: %v", err)
+		}
+		if !preview.Truncated {
+			t.Fatal("expected truncated preview")
+		}
+		if !strings.Contains(preview.HTML, "line one\n<") || strings.Contains(preview.HTML, "two") {
+			t.Fatalf("expected only the first line, got %s", preview.HTML)
+		}
+	})
+
+	t.Run("refuses binary content", func(t *testing.T) {
+		_, err := RenderTextPreview(TextPreviewCode, "go", []byte("package x\x00\x01"), 1024)
+		if !errors.Is(err, ErrTextPreviewUnsupported) {
+			t.Fatalf("expected ErrTextPreviewUnsupported, got %v", err)
+		}
+	})
+}
+
+func TestTextPreviewService_CacheEvictsOldest(t *testing.T) {
+	svc := NewTextPreviewService(nil, config.PreviewConfig{TextMaxBytes: 1024, TextCacheEntries: 2})
+	files := []models.File{}
+	for i := 0; i < 3; i++ {
+		files = append(files, models.File{BaseModel: models.BaseModel{ID: uuid.New()}})
+	}
+
+	svc.store(textPreviewCacheKey(&files[0]), &TextPreview{HTML: "0"})
+	svc.store(textPreviewCacheKey(&files[1]), &TextPreview{HTML: "1"})
+	// Touch the first entry so the second becomes least recently used.
+	if svc.cached(textPreviewCacheKey(&files[0])) == nil {
+		t.Fatal("expected first entry cached")
+	}
+	svc.store(textPreviewCacheKey(&files[2]), &TextPreview{HTML: "2"})
+
+	if svc.cached(textPreviewCacheKey(&files[1])) != nil {
+		t.Fatal("expected least recently used entry evicted")
+	}
+	if svc.cached(textPreviewCacheKey(&files[0])) == nil || svc.cached(textPreviewCacheKey(&files[2])) == nil {
+		t.Fatal("expected recent entries kept")
+	}
+
+	edited := files[0]
+	checksum := "changed"
+	edited.Checksum = &checksum
+	if svc.cached(textPreviewCacheKey(&edited)) != nil {
+		t.Fatal("expected a content change to miss the cache")
+	}
+}
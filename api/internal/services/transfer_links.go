@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+
+	"github.com/docshare/api/internal/models"
+	"gorm.io/gorm"
+)
+
+// MaxTransferPINAttempts is how many wrong PINs a receive link takes before
+// the transfer is cancelled.
+const MaxTransferPINAttempts = 5
+
+var (
+	ErrTransferLinkInvalid = errors.New("receive link is invalid")
+	ErrTransferLinkUsed    = errors.New("receive link has already been used")
+	ErrTransferPINInvalid  = errors.New("incorrect PIN")
+	ErrTransferLinkLocked  = errors.New("too many incorrect PINs; the transfer was cancelled")
+)
+
+// TransferLinks issues and redeems the signed one-time links that let
+// someone without an account receive a transfer. The link carries the code
+// and a signature; the sender passes on a short PIN separately. Redeeming
+// both returns a receive token, which is the only way to fetch the file
+// afterwards.
+type TransferLinks struct {
+	DB      *gorm.DB
+	BaseURL string
+	key     []byte
+}
+
+func NewTransferLinks(db *gorm.DB, secret, baseURL string) *TransferLinks {
+	return &TransferLinks{DB: db, BaseURL: strings.TrimRight(baseURL, "/"), key: []byte(secret)}
+}
+
+// Issue gives transfer a PIN and returns the receive URL and the PIN. Only a
+// keyed hash of the PIN is kept.
+func (l *TransferLinks) Issue(ctx context.Context, transfer *models.Transfer) (string, string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", "", err
+	}
+	pin := fmt.Sprintf("%06d", n.Int64())
+	if err := l.DB.WithContext(ctx).Model(transfer).Updates(map[string]interface{}{
+		"allow_anonymous": true,
+		"pin_hash":        l.mac("transfer-pin:" + transfer.ID.String() + ":" + pin),
+	}).Error; err != nil {
+		return "", "", err
+	}
+	transfer.AllowAnonymous = true
+	return l.URL(transfer), pin, nil
+}
+
+// URL is the receive link for transfer.
+func (l *TransferLinks) URL(transfer *models.Transfer) string {
+	return fmt.Sprintf("%s/receive/%s?sig=%s", l.BaseURL, url.PathEscape(transfer.Code), l.Signature(transfer))
+}
+
+// Signature binds a link to the transfer's code and expiry.
+func (l *TransferLinks) Signature(transfer *models.Transfer) string {
+	return l.mac(fmt.Sprintf("transfer-link:%s:%s:%d", transfer.ID, transfer.Code, transfer.ExpiresAt.Unix()))
+}
+
+// Redeem checks the link signature and PIN and, for the first caller,
+// connects the transfer to them and returns their receive token. ip is
+// recorded as the recipient's address. Each wrong PIN counts towards
+// MaxTransferPINAttempts.
+func (l *TransferLinks) Redeem(ctx context.Context, transfer *models.Transfer, signature, pin, ip string) (string, error) {
+	if !transfer.AllowAnonymous || transfer.PINHash == "" || !hmac.Equal([]byte(signature), []byte(l.Signature(transfer))) {
+		return "", ErrTransferLinkInvalid
+	}
+	if transfer.Status != models.TransferStatusPending || transfer.ReceiveTokenHash != "" {
+		return "", ErrTransferLinkUsed
+	}
+	if transfer.PINAttempts >= MaxTransferPINAttempts {
+		return "", ErrTransferLinkLocked
+	}
+	db := l.DB.WithContext(ctx)
+
+	if !hmac.Equal([]byte(transfer.PINHash), []byte(l.mac("transfer-pin:"+transfer.ID.String()+":"+pin))) {
+		// The count and the lockout are decided by the database, so wrong
+		// PINs sent in parallel cannot each see a count below the limit.
+		if err := db.Model(&models.Transfer{}).
+			Where("id = ? AND status = ?", transfer.ID, models.TransferStatusPending).
+			Updates(map[string]interface{}{
+				"pin_attempts": gorm.Expr("pin_attempts + 1"),
+				"status":       gorm.Expr("CASE WHEN pin_attempts + 1 >= ? THEN ? ELSE status END", MaxTransferPINAttempts, models.TransferStatusCancelled),
+			}).Error; err != nil {
+			return "", err
+		}
+		if err := db.Select("pin_attempts", "status").First(transfer, "id = ?", transfer.ID).Error; err != nil {
+			return "", err
+		}
+		if transfer.PINAttempts >= MaxTransferPINAttempts {
+			return "", ErrTransferLinkLocked
+		}
+		if transfer.Status != models.TransferStatusPending {
+			return "", ErrTransferLinkUsed
+		}
+		return "", ErrTransferPINInvalid
+	}
+
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := "dst_" + hex.EncodeToString(raw)
+	// Only the first redeemer may claim the link, even when two arrive
+	// together.
+	result := db.Model(&models.Transfer{}).
+		Where("id = ? AND status = ? AND pin_attempts < ? AND (receive_token_hash IS NULL OR receive_token_hash = '')", transfer.ID, models.TransferStatusPending, MaxTransferPINAttempts).
+		Updates(map[string]interface{}{
+			"status":             models.TransferStatusActive,
+			"receive_token_hash": hashReceiveToken(token),
+			"recipient_ip":       ip,
+		})
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", ErrTransferLinkUsed
+	}
+	transfer.Status = models.TransferStatusActive
+	transfer.ReceiveTokenHash = hashReceiveToken(token)
+	transfer.RecipientIP = ip
+	return token, nil
+}
+
+// Authorize reports whether token is the receive token issued for transfer.
+func (l *TransferLinks) Authorize(transfer *models.Transfer, token string) bool {
+	return transfer.ReceiveTokenHash != "" && token != "" &&
+		hmac.Equal([]byte(transfer.ReceiveTokenHash), []byte(hashReceiveToken(token)))
+}
+
+func (l *TransferLinks) mac(message string) string {
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write([]byte(message))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func hashReceiveToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+func TestTransferLinks_ParallelWrongPINs(t *testing.T) {
+	db := setupAuditTestDB(t)
+	if err := db.AutoMigrate(&models.Transfer{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+	ctx := context.Background()
+	links := NewTransferLinks(db, "secret", "https://docshare.test")
+	sender := models.User{Email: "sender@test.com", PasswordHash: "hash", FirstName: "Send", LastName: "Er", Role: models.UserRoleUser}
+	db.Create(&sender)
+	transfer := models.Transfer{Code: "ABC123", SenderID: sender.ID, FileName: "brief.txt", FileSize: 5, ExpiresAt: time.Now().Add(time.Hour)}
+	db.Create(&transfer)
+	_, pin, err := links.Issue(ctx, &transfer)
+	if err != nil {
+		t.Fatalf("issue failed: %v", err)
+	}
+	wrong := "000000"
+	if pin == wrong {
+		wrong = "000001"
+	}
+
+	// Requests arriving together all load the transfer before any of them
+	// counts its attempt.
+	loaded := make([]models.Transfer, MaxTransferPINAttempts+2)
+	for i := range loaded {
+		db.First(&loaded[i], "id = ?", transfer.ID)
+	}
+	sig := links.Signature(&transfer)
+	for i := 0; i < MaxTransferPINAttempts+1; i++ {
+		_, err := links.Redeem(ctx, &loaded[i], sig, wrong, "203.0.113.7")
+		want := ErrTransferPINInvalid
+		if i >= MaxTransferPINAttempts-1 {
+			want = ErrTransferLinkLocked
+		}
+		if !errors.Is(err, want) {
+			t.Fatalf("attempt %d: expected %v, got %v", i+1, want, err)
+		}
+	}
+	if _, err := links.Redeem(ctx, &loaded[len(loaded)-1], sig, pin, "203.0.113.7"); err == nil {
+		t.Fatal("expected the right PIN refused after the lockout")
+	}
+
+	var stored models.Transfer
+	db.First(&stored, "id = ?", transfer.ID)
+	if stored.Status != models.TransferStatusCancelled || stored.PINAttempts != MaxTransferPINAttempts || stored.ReceiveTokenHash != "" {
+		t.Fatalf("expected a cancelled transfer after %d attempts, got %s after %d", MaxTransferPINAttempts, stored.Status, stored.PINAttempts)
+	}
+}
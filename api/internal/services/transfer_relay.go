@@ -0,0 +1,466 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const transferScanJob = "transfer.scan"
+
+var (
+	ErrTransferChunkInvalid     = errors.New("chunk index or total is out of range")
+	ErrTransferIncomplete       = errors.New("transfer has not been fully uploaded")
+	ErrTransferChecksumMismatch = errors.New("the received file does not match its checksum")
+	ErrTransferNotReady         = errors.New("transfer is not ready to be received")
+)
+
+// TransferStore holds relayed chunks until the receiver has downloaded the
+// file.
+type TransferStore interface {
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Upload(ctx context.Context, objectName string, reader io.Reader, size int64, contentType string) error
+	Delete(ctx context.Context, objectName string) error
+}
+
+// TransferRelay keeps the bytes of a direct transfer between the sender's
+// upload and the receiver's download. Chunks are stored as they arrive and
+// joined into one object when the sender completes. With a Scanner the
+// joined file is checked by a transfer.scan job while the transfer is
+// "scanning", and only a clean file becomes "ready" for the receiver; an
+// infected one is deleted and the transfer is "blocked".
+type TransferRelay struct {
+	DB      *gorm.DB
+	Store   TransferStore
+	Jobs    *JobRunner
+	Scanner Scanner
+	Audit   *AuditService
+	// BypassBytes lets files of at most this size skip the scan.
+	BypassBytes int64
+}
+
+func NewTransferRelay(db *gorm.DB, store TransferStore, jobs *JobRunner, scanner Scanner, audit *AuditService, cfg config.ScanConfig) *TransferRelay {
+	r := &TransferRelay{DB: db, Store: store, Jobs: jobs, Scanner: scanner, Audit: audit, BypassBytes: cfg.TransferBypassBytes}
+	jobs.Register(transferScanJob, r.runScan, JobOptions{})
+	return r
+}
+
+func transferChunkKey(id uuid.UUID, index int) string {
+	return fmt.Sprintf("transfers/%s/chunks/%d", id, index)
+}
+
+func transferDataKey(id uuid.UUID) string {
+	return fmt.Sprintf("transfers/%s/data", id)
+}
+
+// StoreChunk keeps one chunk of the sender's upload. A repeated index
+// replaces the earlier chunk, so a failed chunk can be sent again.
+func (r *TransferRelay) StoreChunk(ctx context.Context, transfer *models.Transfer, index, total int, body []byte) error {
+	if total < 1 || index < 0 || index >= total {
+		return ErrTransferChunkInvalid
+	}
+	if transfer.ChunkTotal != 0 && transfer.ChunkTotal != total {
+		return ErrTransferChunkInvalid
+	}
+	if err := r.Store.Upload(ctx, transferChunkKey(transfer.ID, index), bytes.NewReader(body), int64(len(body)), "application/octet-stream"); err != nil {
+		return err
+	}
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		chunk := models.TransferChunk{TransferID: transfer.ID, ChunkIndex: index, Size: int64(len(body))}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "transfer_id"}, {Name: "chunk_index"}},
+			DoUpdates: clause.AssignmentColumns([]string{"size", "updated_at"}),
+		}).Create(&chunk).Error; err != nil {
+			return err
+		}
+		if transfer.ChunkTotal == total && transfer.Stored {
+			return nil
+		}
+		transfer.ChunkTotal, transfer.Stored = total, true
+		return tx.Model(transfer).Updates(map[string]interface{}{
+			"chunk_total": total,
+			"stored":      true,
+		}).Error
+	})
+}
+
+// ChunkRange is an inclusive run of chunk indexes.
+type ChunkRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// TransferProgress is how much of an upload the relay holds.
+type TransferProgress struct {
+	ChunkTotal     int          `json:"chunkTotal"`
+	ReceivedChunks int          `json:"receivedChunks"`
+	ReceivedBytes  int64        `json:"receivedBytes"`
+	Missing        []ChunkRange `json:"missing"`
+}
+
+// Progress reports the chunks received so far and the ranges still
+// missing, so a sender that lost its connection can resume. Before the
+// first chunk the total is unknown and nothing is reported missing.
+func (r *TransferRelay) Progress(ctx context.Context, transfer *models.Transfer) (TransferProgress, error) {
+	progress := TransferProgress{ChunkTotal: transfer.ChunkTotal, Missing: []ChunkRange{}}
+	var chunks []models.TransferChunk
+	if err := r.DB.WithContext(ctx).
+		Where("transfer_id = ?", transfer.ID).
+		Order("chunk_index").
+		Find(&chunks).Error; err != nil {
+		return progress, err
+	}
+	next := 0
+	for _, chunk := range chunks {
+		if chunk.ChunkIndex >= transfer.ChunkTotal {
+			continue
+		}
+		if chunk.ChunkIndex > next {
+			progress.Missing = append(progress.Missing, ChunkRange{Start: next, End: chunk.ChunkIndex - 1})
+		}
+		next = chunk.ChunkIndex + 1
+		progress.ReceivedChunks++
+		progress.ReceivedBytes += chunk.Size
+	}
+	if next < transfer.ChunkTotal {
+		progress.Missing = append(progress.Missing, ChunkRange{Start: next, End: transfer.ChunkTotal - 1})
+	}
+	return progress, nil
+}
+
+// Seal joins the uploaded chunks once the sender is done and either queues
+// the scan or, when there is nothing to scan with or the file is small
+// enough to bypass it, makes the transfer ready straight away. checksum is
+// the sender's SHA-256 of the whole file, in hex; a joined file that does
+// not match it fails the transfer and is thrown away.
+func (r *TransferRelay) Seal(ctx context.Context, transfer *models.Transfer, checksum string) error {
+	if transfer.ChunkTotal == 0 {
+		return ErrTransferIncomplete
+	}
+	progress, err := r.Progress(ctx, transfer)
+	if err != nil {
+		return err
+	}
+	if len(progress.Missing) > 0 {
+		return fmt.Errorf("%w: %d of %d chunks are missing", ErrTransferIncomplete, transfer.ChunkTotal-progress.ReceivedChunks, transfer.ChunkTotal)
+	}
+
+	readers := make([]io.Reader, 0, transfer.ChunkTotal)
+	for i := 0; i < transfer.ChunkTotal; i++ {
+		chunk, err := r.Store.Get(ctx, transferChunkKey(transfer.ID, i))
+		if err != nil {
+			closeAll(readers)
+			return fmt.Errorf("%w: chunk %d is missing", ErrTransferIncomplete, i)
+		}
+		readers = append(readers, chunk)
+	}
+	hash := sha256.New()
+	counted := &countingReader{r: io.TeeReader(io.MultiReader(readers...), hash)}
+	err = r.Store.Upload(ctx, transferDataKey(transfer.ID), counted, -1, "application/octet-stream")
+	closeAll(readers)
+	if err != nil {
+		return err
+	}
+	if counted.n != transfer.FileSize {
+		_ = r.Store.Delete(ctx, transferDataKey(transfer.ID))
+		return fmt.Errorf("%w: received %d of %d bytes", ErrTransferIncomplete, counted.n, transfer.FileSize)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(sum, checksum) {
+		if err := r.DB.WithContext(ctx).Model(transfer).Updates(map[string]interface{}{
+			"status":   models.TransferStatusFailed,
+			"checksum": sum,
+		}).Error; err != nil {
+			return err
+		}
+		transfer.Status = models.TransferStatusFailed
+		logger.WarnWithUser(transfer.SenderID.String(), "transfer_checksum_mismatch", map[string]interface{}{
+			"transfer_id": transfer.ID.String(),
+			"expected":    checksum,
+			"actual":      sum,
+		})
+		if err := r.Discard(ctx, transfer); err != nil {
+			logger.Error("transfer_purge_failed", err, map[string]interface{}{
+				"transfer_id": transfer.ID.String(),
+			})
+		}
+		return ErrTransferChecksumMismatch
+	}
+	for i := 0; i < transfer.ChunkTotal; i++ {
+		_ = r.Store.Delete(ctx, transferChunkKey(transfer.ID, i))
+	}
+
+	status, scanResult := models.TransferStatusScanning, ""
+	switch {
+	case r.Scanner == nil:
+		status = models.TransferStatusReady
+	case r.BypassBytes > 0 && transfer.FileSize <= r.BypassBytes:
+		status, scanResult = models.TransferStatusReady, "skipped"
+	}
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(transfer).Updates(map[string]interface{}{
+			"status":      status,
+			"scan_result": scanResult,
+			"checksum":    sum,
+		}).Error; err != nil {
+			return err
+		}
+		transfer.Status, transfer.ScanResult, transfer.Checksum = status, scanResult, sum
+		if status != models.TransferStatusScanning {
+			return nil
+		}
+		_, err := r.Jobs.enqueue(tx, transferScanJob, map[string]interface{}{"transfer_id": transfer.ID.String()}, EnqueueOptions{
+			UniqueKey: "transfer:" + transfer.ID.String(),
+		})
+		return err
+	})
+}
+
+// Open returns the joined file of a ready transfer.
+func (r *TransferRelay) Open(ctx context.Context, transfer *models.Transfer) (io.ReadCloser, error) {
+	return r.Store.Get(ctx, transferDataKey(transfer.ID))
+}
+
+// Save lands a ready transfer in the recipient's own files instead of
+// sending it to their machine. The joined object is copied to a new key in
+// storage and recorded as a regular file under parentID, or the recipient's
+// root when it is nil, and the transfer is completed. When the folder
+// already has a file of the same name and checksum that file is returned
+// rather than stored twice; a different file of the same name is kept and
+// the transfer is saved as "name (n).ext". event carries the caller's
+// request details for the file.upload event.
+func (r *TransferRelay) Save(ctx context.Context, transfer *models.Transfer, recipient *models.User, parentID *uuid.UUID, event AuditEntry) (*models.File, error) {
+	if transfer.Status != models.TransferStatusReady {
+		return nil, ErrTransferNotReady
+	}
+	db := r.DB.WithContext(ctx)
+	inFolder := func(name string) *gorm.DB {
+		q := db.Model(&models.File{}).Where("owner_id = ? AND name = ? AND is_directory = ?", recipient.ID, name, false)
+		if parentID == nil {
+			return q.Where("parent_id IS NULL")
+		}
+		return q.Where("parent_id = ?", *parentID)
+	}
+
+	name := transfer.FileName
+	for n := 1; ; n++ {
+		var existing []models.File
+		if err := inFolder(name).Find(&existing).Error; err != nil {
+			return nil, err
+		}
+		if len(existing) == 0 {
+			break
+		}
+		for i := range existing {
+			if existing[i].Checksum != nil && *existing[i].Checksum == transfer.Checksum {
+				if err := r.complete(ctx, transfer); err != nil {
+					return nil, err
+				}
+				return &existing[i], nil
+			}
+		}
+		name = numberedName(transfer.FileName, n)
+	}
+	if err := CheckStorageQuota(ctx, r.DB, recipient.OrganizationID, transfer.FileSize); err != nil {
+		return nil, err
+	}
+
+	data, err := r.Store.Get(ctx, transferDataKey(transfer.ID))
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+	objectName := fmt.Sprintf("%s/%s/%s", recipient.ID, uuid.New(), name)
+	if err := r.Store.Upload(ctx, objectName, data, transfer.FileSize, transfer.MimeType); err != nil {
+		return nil, err
+	}
+
+	checksum := transfer.Checksum
+	file := models.File{
+		Name:             name,
+		MimeType:         transfer.MimeType,
+		DetectedMimeType: transfer.DetectedMimeType,
+		Size:             transfer.FileSize,
+		ParentID:         parentID,
+		OwnerID:          recipient.ID,
+		OrganizationID:   recipient.OrganizationID,
+		StoragePath:      objectName,
+		Checksum:         &checksum,
+	}
+	event.UserID = &recipient.ID
+	event.Action = "file.upload"
+	event.ResourceType = "file"
+	event.Details = map[string]interface{}{
+		"file_name":     name,
+		"file_size":     transfer.FileSize,
+		"mime_type":     transfer.MimeType,
+		"transfer_code": transfer.Code,
+		"sender_id":     transfer.SenderID.String(),
+	}
+	if parentID != nil {
+		event.Details["parent_id"] = parentID.String()
+	}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&file).Error; err != nil {
+			return err
+		}
+		event.ResourceID = &file.ID
+		if err := RecordEvent(tx, event); err != nil {
+			return err
+		}
+		return tx.Model(transfer).Update("status", models.TransferStatusCompleted).Error
+	}); err != nil {
+		_ = r.Store.Delete(ctx, objectName)
+		return nil, err
+	}
+	transfer.Status = models.TransferStatusCompleted
+	if err := r.Discard(ctx, transfer); err != nil {
+		logger.Error("transfer_purge_failed", err, map[string]interface{}{
+			"transfer_id": transfer.ID.String(),
+		})
+	}
+	return &file, nil
+}
+
+// complete finishes a transfer whose file the recipient already has.
+func (r *TransferRelay) complete(ctx context.Context, transfer *models.Transfer) error {
+	if err := r.DB.WithContext(ctx).Model(transfer).Update("status", models.TransferStatusCompleted).Error; err != nil {
+		return err
+	}
+	transfer.Status = models.TransferStatusCompleted
+	return r.Discard(ctx, transfer)
+}
+
+// Discard removes whatever the relay holds for a transfer.
+func (r *TransferRelay) Discard(ctx context.Context, transfer *models.Transfer) error {
+	if !transfer.Stored {
+		return nil
+	}
+	for i := 0; i < transfer.ChunkTotal; i++ {
+		_ = r.Store.Delete(ctx, transferChunkKey(transfer.ID, i))
+	}
+	if err := r.Store.Delete(ctx, transferDataKey(transfer.ID)); err != nil {
+		return err
+	}
+	transfer.Stored = false
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("transfer_id = ?", transfer.ID).Delete(&models.TransferChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(transfer).Update("stored", false).Error
+	})
+}
+
+// PurgeFinished discards the stored bytes of transfers that can no longer
+// be downloaded, such as expired ones.
+func (r *TransferRelay) PurgeFinished(ctx context.Context) error {
+	var transfers []models.Transfer
+	if err := r.DB.WithContext(ctx).
+		Where("stored = ? AND status IN ?", true, []models.TransferStatus{
+			models.TransferStatusCompleted, models.TransferStatusCancelled,
+			models.TransferStatusExpired, models.TransferStatusBlocked,
+			models.TransferStatusFailed,
+		}).
+		Limit(500).Find(&transfers).Error; err != nil {
+		return err
+	}
+	for i := range transfers {
+		if err := r.Discard(ctx, &transfers[i]); err != nil {
+			logger.Error("transfer_purge_failed", err, map[string]interface{}{
+				"transfer_id": transfers[i].ID.String(),
+			})
+		}
+	}
+	return nil
+}
+
+func (r *TransferRelay) runScan(ctx context.Context, job *models.Job) error {
+	raw, _ := job.Payload["transfer_id"].(string)
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("scan job without a transfer id: %q", raw)
+	}
+	var transfer models.Transfer
+	if err := r.DB.WithContext(ctx).Limit(1).Find(&transfer, "id = ?", id).Error; err != nil {
+		return err
+	}
+	if transfer.Status != models.TransferStatusScanning || r.Scanner == nil {
+		// Cancelled or expired while it waited.
+		return nil
+	}
+
+	data, err := r.Store.Get(ctx, transferDataKey(transfer.ID))
+	if err != nil {
+		return err
+	}
+	verdict, err := r.Scanner.Scan(ctx, data)
+	data.Close()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	updates := map[string]interface{}{
+		"status":      models.TransferStatusReady,
+		"scan_result": "clean",
+		"scanned_at":  now,
+	}
+	if verdict.Infected {
+		updates["status"] = models.TransferStatusBlocked
+		updates["scan_result"] = verdict.Signature
+	}
+	result := r.DB.WithContext(ctx).Model(&models.Transfer{}).
+		Where("id = ? AND status = ?", transfer.ID, models.TransferStatusScanning).
+		Updates(updates)
+	if result.Error != nil || result.RowsAffected == 0 || !verdict.Infected {
+		return result.Error
+	}
+
+	transfer.Status = models.TransferStatusBlocked
+	if err := r.Discard(ctx, &transfer); err != nil {
+		logger.Error("transfer_purge_failed", err, map[string]interface{}{
+			"transfer_id": transfer.ID.String(),
+		})
+	}
+	logger.WarnWithUser(transfer.SenderID.String(), "transfer_blocked", map[string]interface{}{
+		"transfer_id": transfer.ID.String(),
+		"signature":   verdict.Signature,
+	})
+	if r.Audit != nil {
+		r.Audit.LogAsync(AuditEntry{
+			UserID:       &transfer.SenderID,
+			Action:       "transfer.blocked",
+			ResourceType: "transfer",
+			ResourceID:   &transfer.ID,
+			Details: map[string]interface{}{
+				"code":         transfer.Code,
+				"file_name":    transfer.FileName,
+				"recipient_id": transfer.RecipientID,
+				"scanner":      r.Scanner.Name(),
+				"signature":    verdict.Signature,
+			},
+		})
+	}
+	return nil
+}
+
+func closeAll(readers []io.Reader) {
+	for _, reader := range readers {
+		if closer, ok := reader.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
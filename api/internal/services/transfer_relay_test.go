@@ -0,0 +1,319 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newFakeClamd answers INSTREAM scans like clamd, flagging any stream that
+// contains the EICAR marker. It returns the address to dial.
+func newFakeClamd(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed listening: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				command := make([]byte, len("zINSTREAM\x00"))
+				if _, err := io.ReadFull(conn, command); err != nil || string(command) != "zINSTREAM\x00" {
+					conn.Write([]byte("UNKNOWN COMMAND\x00"))
+					return
+				}
+				var content bytes.Buffer
+				var size [4]byte
+				for {
+					if _, err := io.ReadFull(conn, size[:]); err != nil {
+						return
+					}
+					n := binary.BigEndian.Uint32(size[:])
+					if n == 0 {
+						break
+					}
+					if _, err := io.CopyN(&content, conn, int64(n)); err != nil {
+						return
+					}
+				}
+				if strings.Contains(content.String(), "EICAR") {
+					conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+					return
+				}
+				conn.Write([]byte("stream: OK\x00"))
+			}(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestClamAVScanner(t *testing.T) {
+	scanner := NewScanner(config.ScanConfig{ClamAVAddress: newFakeClamd(t), Timeout: 5 * time.Second})
+	ctx := context.Background()
+
+	verdict, err := scanner.Scan(ctx, strings.NewReader(strings.Repeat("clean ", 30000)))
+	if err != nil || verdict.Infected {
+		t.Fatalf("expected a clean verdict, got %+v, %v", verdict, err)
+	}
+	verdict, err = scanner.Scan(ctx, strings.NewReader("X5O!P%@AP EICAR-STANDARD-ANTIVIRUS-TEST-FILE"))
+	if err != nil || !verdict.Infected || verdict.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("expected a detection, got %+v, %v", verdict, err)
+	}
+
+	if NewScanner(config.ScanConfig{}) != nil {
+		t.Fatal("expected no scanner without an address")
+	}
+	unreachable := NewScanner(config.ScanConfig{ClamAVAddress: "unix:///nonexistent/clamd.sock"})
+	if _, err := unreachable.Scan(ctx, strings.NewReader("x")); !errors.Is(err, ErrScanFailed) {
+		t.Fatalf("expected ErrScanFailed, got %v", err)
+	}
+}
+
+func TestTransferRelay(t *testing.T) {
+	logger.Init()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed opening in-memory sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.Transfer{}, &models.TransferChunk{}, &models.Job{}, &models.AuditLog{}, &models.File{}, &models.OutboxEvent{}); err != nil {
+		t.Fatalf("failed automigrating: %v", err)
+	}
+
+	sender := models.User{Email: "relay@test.com", FirstName: "R", LastName: "S", PasswordHash: "x"}
+	db.Create(&sender)
+	store := newMemoryBucket()
+	jobs := NewJobRunner(db, config.JobsConfig{})
+	cfg := config.ScanConfig{ClamAVAddress: newFakeClamd(t), Timeout: 5 * time.Second, TransferBypassBytes: 4}
+	relay := NewTransferRelay(db, store, jobs, NewScanner(cfg), nil, cfg)
+	ctx := context.Background()
+
+	checksum := func(chunks ...string) string {
+		sum := sha256.Sum256([]byte(strings.Join(chunks, "")))
+		return hex.EncodeToString(sum[:])
+	}
+	upload := func(code string, chunks ...string) *models.Transfer {
+		t.Helper()
+		size := 0
+		for _, chunk := range chunks {
+			size += len(chunk)
+		}
+		transfer := &models.Transfer{Code: code, SenderID: sender.ID, FileName: code + ".txt", FileSize: int64(size), Status: models.TransferStatusActive, ExpiresAt: time.Now().Add(time.Hour)}
+		db.Create(transfer)
+		// Send the chunks last to first to show the order does not matter.
+		for i := len(chunks) - 1; i >= 0; i-- {
+			if err := relay.StoreChunk(ctx, transfer, i, len(chunks), []byte(chunks[i])); err != nil {
+				t.Fatalf("failed storing chunk %d: %v", i, err)
+			}
+		}
+		return transfer
+	}
+	reload := func(transfer *models.Transfer) models.Transfer {
+		t.Helper()
+		var loaded models.Transfer
+		db.First(&loaded, "id = ?", transfer.ID)
+		return loaded
+	}
+	drain := func() {
+		t.Helper()
+		for {
+			ran, err := jobs.RunNext(ctx)
+			if err != nil {
+				t.Fatalf("scan job failed: %v", err)
+			}
+			if !ran {
+				return
+			}
+		}
+	}
+
+	t.Run("scans before the file is ready", func(t *testing.T) {
+		transfer := upload("CLEAN1", "hello ", "world")
+		if err := relay.Seal(ctx, transfer, checksum("hello world")); err != nil {
+			t.Fatalf("seal failed: %v", err)
+		}
+		if transfer.Status != models.TransferStatusScanning {
+			t.Fatalf("expected scanning, got %s", transfer.Status)
+		}
+		if _, ok := store.objects[transferChunkKey(transfer.ID, 0)]; ok {
+			t.Fatal("expected the chunks to be dropped once joined")
+		}
+		drain()
+		loaded := reload(transfer)
+		if loaded.Status != models.TransferStatusReady || loaded.ScanResult != "clean" || loaded.ScannedAt == nil {
+			t.Fatalf("expected a clean, ready transfer, got %+v", loaded)
+		}
+		data, err := relay.Open(ctx, &loaded)
+		if err != nil {
+			t.Fatalf("open failed: %v", err)
+		}
+		defer data.Close()
+		if content, _ := io.ReadAll(data); string(content) != "hello world" {
+			t.Fatalf("unexpected content %q", content)
+		}
+	})
+
+	t.Run("blocks infected files", func(t *testing.T) {
+		transfer := upload("BAD001", "X5O!P%@AP ", "EICAR-TEST")
+		if err := relay.Seal(ctx, transfer, checksum("X5O!P%@AP ", "EICAR-TEST")); err != nil {
+			t.Fatalf("seal failed: %v", err)
+		}
+		drain()
+		loaded := reload(transfer)
+		if loaded.Status != models.TransferStatusBlocked || loaded.ScanResult != "Eicar-Test-Signature" || loaded.Stored {
+			t.Fatalf("expected a blocked transfer, got %+v", loaded)
+		}
+		if _, ok := store.objects[transferDataKey(transfer.ID)]; ok {
+			t.Fatal("expected the infected file to be deleted")
+		}
+	})
+
+	t.Run("lets small files bypass the scan", func(t *testing.T) {
+		transfer := upload("SMALL1", "EICA")
+		if err := relay.Seal(ctx, transfer, checksum("EICA")); err != nil {
+			t.Fatalf("seal failed: %v", err)
+		}
+		if transfer.Status != models.TransferStatusReady || transfer.ScanResult != "skipped" {
+			t.Fatalf("expected a ready transfer that skipped the scan, got %+v", transfer)
+		}
+	})
+
+	t.Run("reports missing chunks until the upload resumes", func(t *testing.T) {
+		transfer := &models.Transfer{Code: "PART01", SenderID: sender.ID, FileName: "part.txt", FileSize: 12, Status: models.TransferStatusActive, ExpiresAt: time.Now().Add(time.Hour)}
+		db.Create(transfer)
+		for _, i := range []int{0, 3, 5} {
+			if err := relay.StoreChunk(ctx, transfer, i, 6, []byte("ab")); err != nil {
+				t.Fatalf("failed storing chunk %d: %v", i, err)
+			}
+		}
+		progress, err := relay.Progress(ctx, transfer)
+		if err != nil {
+			t.Fatalf("progress failed: %v", err)
+		}
+		want := []ChunkRange{{Start: 1, End: 2}, {Start: 4, End: 4}}
+		if progress.ReceivedChunks != 3 || progress.ReceivedBytes != 6 || len(progress.Missing) != 2 || progress.Missing[0] != want[0] || progress.Missing[1] != want[1] {
+			t.Fatalf("unexpected progress %+v", progress)
+		}
+		if err := relay.Seal(ctx, transfer, checksum("abababababab")); !errors.Is(err, ErrTransferIncomplete) {
+			t.Fatalf("expected ErrTransferIncomplete, got %v", err)
+		}
+		if err := relay.StoreChunk(ctx, transfer, 1, 3, []byte("ab")); !errors.Is(err, ErrTransferChunkInvalid) {
+			t.Fatalf("expected a changed chunk total to be refused, got %v", err)
+		}
+		if loaded := reload(transfer); loaded.Status != models.TransferStatusActive {
+			t.Fatalf("expected the transfer to stay active, got %s", loaded.Status)
+		}
+
+		for _, i := range []int{1, 2, 4} {
+			if err := relay.StoreChunk(ctx, transfer, i, 6, []byte("ab")); err != nil {
+				t.Fatalf("failed storing chunk %d: %v", i, err)
+			}
+		}
+		if progress, _ := relay.Progress(ctx, transfer); len(progress.Missing) != 0 || progress.ReceivedBytes != 12 {
+			t.Fatalf("expected nothing missing, got %+v", progress)
+		}
+		if err := relay.Seal(ctx, transfer, strings.ToUpper(checksum("abababababab"))); err != nil {
+			t.Fatalf("seal failed: %v", err)
+		}
+	})
+
+	t.Run("fails a file that does not match its checksum", func(t *testing.T) {
+		transfer := upload("SUM001", "expected ", "content")
+		if err := relay.Seal(ctx, transfer, checksum("other content")); !errors.Is(err, ErrTransferChecksumMismatch) {
+			t.Fatalf("expected ErrTransferChecksumMismatch, got %v", err)
+		}
+		loaded := reload(transfer)
+		if loaded.Status != models.TransferStatusFailed || loaded.Stored || loaded.Checksum != checksum("expected content") {
+			t.Fatalf("expected a failed transfer, got %+v", loaded)
+		}
+		if _, ok := store.objects[transferDataKey(transfer.ID)]; ok {
+			t.Fatal("expected the mismatched file to be deleted")
+		}
+		var chunks int64
+		db.Model(&models.TransferChunk{}).Where("transfer_id = ?", transfer.ID).Count(&chunks)
+		if chunks != 0 {
+			t.Fatalf("expected the chunk records to be dropped, got %d", chunks)
+		}
+	})
+
+	t.Run("saves a ready transfer into the recipient's files", func(t *testing.T) {
+		recipient := models.User{Email: "relay-recipient@test.com", FirstName: "R", LastName: "R", PasswordHash: "x"}
+		db.Create(&recipient)
+		save := func(code, content string) (*models.Transfer, *models.File) {
+			t.Helper()
+			transfer := upload(code, content)
+			db.Model(transfer).Update("file_name", "report.txt")
+			if err := relay.Seal(ctx, transfer, checksum(content)); err != nil {
+				t.Fatalf("seal failed: %v", err)
+			}
+			drain()
+			*transfer = reload(transfer)
+			file, err := relay.Save(ctx, transfer, &recipient, nil, AuditEntry{})
+			if err != nil {
+				t.Fatalf("save failed: %v", err)
+			}
+			return transfer, file
+		}
+
+		transfer, file := save("SAVE01", "quarterly")
+		if file.Name != "report.txt" || file.OwnerID != recipient.ID || file.Checksum == nil || *file.Checksum != checksum("quarterly") {
+			t.Fatalf("unexpected file %+v", file)
+		}
+		if content, ok := store.objects[file.StoragePath]; !ok || string(content) != "quarterly" {
+			t.Fatalf("expected the file's object to hold the content, got %q", content)
+		}
+		if loaded := reload(transfer); loaded.Status != models.TransferStatusCompleted || loaded.Stored {
+			t.Fatalf("expected a completed transfer with its bytes dropped, got %+v", loaded)
+		}
+		var events int64
+		db.Model(&models.OutboxEvent{}).Where("event_type = ? AND resource_id = ?", "file.upload", file.ID).Count(&events)
+		if events != 1 {
+			t.Fatalf("expected one file.upload event, got %d", events)
+		}
+
+		if _, again := save("SAVE02", "quarterly"); again.ID != file.ID {
+			t.Fatalf("expected identical content to reuse the existing file, got %+v", again)
+		}
+		if _, renamed := save("SAVE03", "annual"); renamed.Name != "report (1).txt" {
+			t.Fatalf("expected a numbered name, got %q", renamed.Name)
+		}
+
+		pending := upload("SAVE04", "x")
+		if _, err := relay.Save(ctx, pending, &recipient, nil, AuditEntry{}); !errors.Is(err, ErrTransferNotReady) {
+			t.Fatalf("expected ErrTransferNotReady, got %v", err)
+		}
+	})
+
+	t.Run("purges the bytes of finished transfers", func(t *testing.T) {
+		transfer := upload("GONE01", "bytes")
+		db.Model(transfer).Update("status", models.TransferStatusExpired)
+		if err := relay.PurgeFinished(ctx); err != nil {
+			t.Fatalf("purge failed: %v", err)
+		}
+		if _, ok := store.objects[transferChunkKey(transfer.ID, 0)]; ok || reload(transfer).Stored {
+			t.Fatal("expected the expired transfer's chunks to be purged")
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/docshare/api/internal/config"
+)
+
+// SniffLength is how many leading bytes DetectContentType looks at.
+const SniffLength = 512
+
+var ErrFileTypeNotAllowed = errors.New("file type is not allowed")
+
+// executableSignatures catches binaries that http.DetectContentType reports
+// as application/octet-stream, which would otherwise be indistinguishable
+// from any other unknown payload.
+var executableSignatures = []struct {
+	magic    []byte
+	mimeType string
+}{
+	{[]byte("MZ"), "application/x-msdownload"},
+	{[]byte("\x7fELF"), "application/x-executable"},
+	{[]byte{0xfe, 0xed, 0xfa, 0xce}, "application/x-mach-binary"},
+	{[]byte{0xfe, 0xed, 0xfa, 0xcf}, "application/x-mach-binary"},
+	{[]byte{0xce, 0xfa, 0xed, 0xfe}, "application/x-mach-binary"},
+	{[]byte{0xcf, 0xfa, 0xed, 0xfe}, "application/x-mach-binary"},
+	{[]byte("#!"), "text/x-shellscript"},
+}
+
+// genericTypes are what sniffing returns when it cannot tell formats apart,
+// e.g. every OOXML document is a zip. They never fail an allow list on their
+// own; the declared type is checked instead.
+var genericTypes = map[string]bool{
+	"application/octet-stream": true,
+	"application/zip":          true,
+	"text/plain":               true,
+}
+
+// DetectContentType sniffs the media type of content from its first bytes,
+// without parameters such as charset.
+func DetectContentType(head []byte) string {
+	if len(head) > SniffLength {
+		head = head[:SniffLength]
+	}
+	for _, sig := range executableSignatures {
+		if bytes.HasPrefix(head, sig.magic) {
+			return sig.mimeType
+		}
+	}
+	return baseMediaType(http.DetectContentType(head))
+}
+
+// UploadPolicy decides whether a file may be stored based on its name, the
+// type the client declared and the type sniffed from its content.
+type UploadPolicy struct {
+	allowedTypes      []string
+	blockedTypes      []string
+	allowedExtensions map[string]bool
+	blockedExtensions map[string]bool
+}
+
+func NewUploadPolicy(cfg config.UploadPolicyConfig) *UploadPolicy {
+	return &UploadPolicy{
+		allowedTypes:      normalizeTypes(cfg.AllowedTypes),
+		blockedTypes:      normalizeTypes(cfg.BlockedTypes),
+		allowedExtensions: normalizeExtensions(cfg.AllowedExtensions),
+		blockedExtensions: normalizeExtensions(cfg.BlockedExtensions),
+	}
+}
+
+// Check returns an error wrapping ErrFileTypeNotAllowed when the upload is
+// rejected. detected may be empty when the content has not been seen yet,
+// as with pre-signed uploads before they are finalized.
+func (p *UploadPolicy) Check(filename, declared, detected string) error {
+	if p == nil {
+		return nil
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	if p.blockedExtensions[ext] {
+		return fmt.Errorf("%w: extension %q is blocked", ErrFileTypeNotAllowed, ext)
+	}
+	if len(p.allowedExtensions) > 0 && !p.allowedExtensions[ext] {
+		return fmt.Errorf("%w: extension %q is not allowed", ErrFileTypeNotAllowed, ext)
+	}
+
+	declared = baseMediaType(declared)
+	detected = baseMediaType(detected)
+	for _, t := range []string{declared, detected} {
+		if t != "" && matchesAnyType(t, p.blockedTypes) {
+			return fmt.Errorf("%w: %s is blocked", ErrFileTypeNotAllowed, t)
+		}
+	}
+	if len(p.allowedTypes) > 0 {
+		if declared != "" && !matchesAnyType(declared, p.allowedTypes) {
+			return fmt.Errorf("%w: %s is not allowed", ErrFileTypeNotAllowed, declared)
+		}
+		if detected != "" && !genericTypes[detected] && !matchesAnyType(detected, p.allowedTypes) {
+			return fmt.Errorf("%w: content looks like %s", ErrFileTypeNotAllowed, detected)
+		}
+	}
+	return nil
+}
+
+func matchesAnyType(mimeType string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*/*" || pattern == mimeType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mimeType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func baseMediaType(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+	if parsed, _, err := mime.ParseMediaType(value); err == nil {
+		return parsed
+	}
+	return strings.ToLower(value)
+}
+
+func normalizeTypes(types []string) []string {
+	out := make([]string, 0, len(types))
+	for _, t := range types {
+		if t = baseMediaType(t); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func normalizeExtensions(exts []string) map[string]bool {
+	out := make(map[string]bool, len(exts))
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		out[ext] = true
+	}
+	return out
+}
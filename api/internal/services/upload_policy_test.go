@@ -0,0 +1,81 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/docshare/api/internal/config"
+)
+
+func TestDetectContentType(t *testing.T) {
+	cases := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"windows executable", []byte("MZ\x90\x00\x03"), "application/x-msdownload"},
+		{"elf binary", []byte("\x7fELF\x02\x01\x01"), "application/x-executable"},
+		{"shell script", []byte("#!/bin/sh\necho hi\n"), "text/x-shellscript"},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00"), "image/png"},
+		{"pdf", []byte("%PDF-1.7\n"), "application/pdf"},
+		{"plain text drops charset", []byte("hello world"), "text/plain"},
+		{"empty", nil, "text/plain"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := DetectContentType(tc.head); got != tc.want {
+				t.Fatalf("DetectContentType() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUploadPolicy_Check(t *testing.T) {
+	t.Run("nil policy allows everything", func(t *testing.T) {
+		var p *UploadPolicy
+		if err := p.Check("run.exe", "application/x-msdownload", "application/x-msdownload"); err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+	})
+
+	blocking := NewUploadPolicy(config.UploadPolicyConfig{
+		BlockedTypes:      []string{"application/x-msdownload", "text/x-shellscript"},
+		BlockedExtensions: []string{"exe", ".BAT"},
+	})
+	allowing := NewUploadPolicy(config.UploadPolicyConfig{
+		AllowedTypes:      []string{"image/*", "application/pdf"},
+		AllowedExtensions: []string{".png", ".jpg", ".pdf", ".docx"},
+	})
+
+	cases := []struct {
+		name     string
+		policy   *UploadPolicy
+		file     string
+		declared string
+		detected string
+		allowed  bool
+	}{
+		{"blocked extension case-insensitive", blocking, "Setup.EXE", "application/octet-stream", "", false},
+		{"extension normalised with dot", blocking, "run.bat", "text/plain", "text/plain", false},
+		{"blocked detected type behind harmless name", blocking, "notes.txt", "text/plain", "application/x-msdownload", false},
+		{"blocked declared type with params", blocking, "x.sh", "text/x-shellscript; charset=utf-8", "", false},
+		{"unrelated file passes block list", blocking, "photo.png", "image/png", "image/png", true},
+		{"extension outside allow list", allowing, "notes.txt", "text/plain", "text/plain", false},
+		{"wildcard type allowed", allowing, "photo.jpg", "image/jpeg", "image/jpeg", true},
+		{"declared type outside allow list", allowing, "photo.png", "text/html", "image/png", false},
+		{"detected type outside allow list", allowing, "fake.pdf", "application/pdf", "text/html", false},
+		{"generic detection defers to declared", allowing, "doc.docx", "image/png", "application/zip", true},
+		{"presign without content", allowing, "scan.pdf", "application/pdf", "", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.policy.Check(tc.file, tc.declared, tc.detected)
+			if tc.allowed && err != nil {
+				t.Fatalf("expected allowed, got %v", err)
+			}
+			if !tc.allowed && !errors.Is(err, ErrFileTypeNotAllowed) {
+				t.Fatalf("expected ErrFileTypeNotAllowed, got %v", err)
+			}
+		})
+	}
+}
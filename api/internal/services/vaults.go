@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxWrappedKeyBytes bounds a wrapped vault key. An X25519 wrap of a
+// 32-byte key is well under 100 bytes; the slack leaves room for other
+// schemes without letting the column become storage.
+const maxWrappedKeyBytes = 1024
+
+var (
+	ErrUserKeyInvalid     = errors.New("publicKey must be a base64-encoded 32-byte X25519 key")
+	ErrUserKeyNotFound    = errors.New("key not found")
+	ErrVaultNotFound      = errors.New("file is not in an encrypted folder")
+	ErrVaultKeyInvalid    = errors.New("wrappedKey must be base64 and at most 1 KiB")
+	ErrVaultKeysRequired  = errors.New("the folder key must be wrapped for at least one of the recipient's keys")
+	ErrVaultKeyNotOwned   = errors.New("keyID does not name a key of the user the folder key is wrapped for")
+	ErrVaultNested        = errors.New("encrypted folders cannot be created inside another encrypted folder")
+	ErrVaultContent       = errors.New("the server cannot read files in an encrypted folder")
+	ErrVaultMove          = errors.New("files cannot be moved into or out of an encrypted folder")
+	ErrVaultShareRootOnly = errors.New("share the encrypted folder itself, not a file inside it")
+	ErrVaultShareType     = errors.New("encrypted folders can only be shared with individual users")
+)
+
+// WrappedKey is a vault folder key wrapped for the user key KeyID.
+type WrappedKey struct {
+	KeyID      uuid.UUID `json:"keyID"`
+	WrappedKey string    `json:"wrappedKey"`
+}
+
+// Vaults keeps the public keys users register and the vault folder keys
+// wrapped for them. Files in a vault are encrypted and decrypted by
+// clients; the server never sees a folder key or a private key.
+type Vaults struct {
+	DB *gorm.DB
+}
+
+func NewVaults(db *gorm.DB) *Vaults {
+	return &Vaults{DB: db}
+}
+
+// RegisterKey records a public key for userID.
+func (v *Vaults) RegisterKey(ctx context.Context, userID uuid.UUID, name, algorithm, publicKey string) (*models.UserKey, error) {
+	if algorithm == "" {
+		algorithm = models.UserKeyAlgorithmX25519
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if algorithm != models.UserKeyAlgorithmX25519 || err != nil || len(raw) != 32 {
+		return nil, ErrUserKeyInvalid
+	}
+	sum := sha256.Sum256(raw)
+	key := models.UserKey{
+		UserID:      userID,
+		Name:        name,
+		Algorithm:   algorithm,
+		PublicKey:   base64.StdEncoding.EncodeToString(raw),
+		Fingerprint: hex.EncodeToString(sum[:16]),
+	}
+	if err := v.DB.WithContext(ctx).Create(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// Keys returns the keys registered by userID, oldest first.
+func (v *Vaults) Keys(ctx context.Context, userID uuid.UUID) ([]models.UserKey, error) {
+	keys := []models.UserKey{}
+	err := v.DB.WithContext(ctx).Where("user_id = ?", userID).Order("created_at ASC").Find(&keys).Error
+	return keys, err
+}
+
+// DeleteKey removes one of userID's keys. Folder keys wrapped for it are
+// no longer handed out.
+func (v *Vaults) DeleteKey(ctx context.Context, userID, keyID uuid.UUID) error {
+	result := v.DB.WithContext(ctx).Where("id = ? AND user_id = ?", keyID, userID).Delete(&models.UserKey{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserKeyNotFound
+	}
+	return nil
+}
+
+// WrappedKeys returns the key of vaultID wrapped for each of userID's
+// current keys.
+func (v *Vaults) WrappedKeys(ctx context.Context, vaultID, userID uuid.UUID) ([]models.VaultKey, error) {
+	keys := []models.VaultKey{}
+	err := v.DB.WithContext(ctx).
+		Where("vault_id = ? AND user_id = ?", vaultID, userID).
+		Where("key_id IN (?)", v.DB.Model(&models.UserKey{}).Select("id").Where("user_id = ?", userID)).
+		Order("created_at ASC").
+		Find(&keys).Error
+	return keys, err
+}
+
+// StoreWrappedKeys saves the key of vaultID wrapped for keys of userID,
+// replacing earlier wraps for the same keys. It runs on tx so callers can
+// store the keys along with the share or folder that needs them.
+func (v *Vaults) StoreWrappedKeys(tx *gorm.DB, vaultID, userID, createdBy uuid.UUID, keys []WrappedKey) error {
+	if len(keys) == 0 {
+		return ErrVaultKeysRequired
+	}
+	rows := make([]models.VaultKey, len(keys))
+	for i, key := range keys {
+		raw, err := base64.StdEncoding.DecodeString(key.WrappedKey)
+		if err != nil || len(raw) == 0 || len(raw) > maxWrappedKeyBytes {
+			return ErrVaultKeyInvalid
+		}
+		var owned int64
+		if err := tx.Model(&models.UserKey{}).Where("id = ? AND user_id = ?", key.KeyID, userID).Count(&owned).Error; err != nil {
+			return err
+		}
+		if owned == 0 {
+			return ErrVaultKeyNotOwned
+		}
+		rows[i] = models.VaultKey{VaultID: vaultID, UserID: userID, KeyID: key.KeyID, WrappedKey: key.WrappedKey, CreatedByID: createdBy}
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "vault_id"}, {Name: "key_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"wrapped_key", "created_by_id", "updated_at"}),
+	}).Create(&rows).Error
+}
+
+// CheckVaultMove reports whether file may move into a folder in the vault
+// targetVaultID, nil meaning a folder outside any vault or the root.
+// Files stay in their vault, and a vault itself moves only between
+// unencrypted folders.
+func CheckVaultMove(file *models.File, targetVaultID *uuid.UUID) error {
+	source := file.VaultID
+	if source != nil && *source == file.ID {
+		source = nil
+	}
+	if (source == nil) != (targetVaultID == nil) || (source != nil && *source != *targetVaultID) {
+		return ErrVaultMove
+	}
+	return nil
+}
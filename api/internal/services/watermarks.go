@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+)
+
+// watermarkOptions is how the stamp is laid over each page: large,
+// diagonal and faint enough to read the document through.
+var watermarkOptions = map[string]interface{}{
+	"opacity":  0.25,
+	"rotation": 45,
+	"fontSize": 24,
+	"color":    "#808080",
+}
+
+// Watermark names who a stamped copy of a PDF is for.
+type Watermark struct {
+	// Viewer is the viewer's email, or empty for an anonymous visitor.
+	Viewer    string
+	IPAddress string
+	At        time.Time
+}
+
+// Text is the line stamped on every page.
+func (w Watermark) Text() string {
+	viewer := w.Viewer
+	if viewer == "" {
+		viewer = "anonymous"
+	}
+	return strings.Join([]string{viewer, w.IPAddress, w.At.UTC().Format("2006-01-02 15:04 UTC")}, " · ")
+}
+
+// cacheName names the viewer's copy. It leaves out the time so the copy is
+// reused: a viewer keeps seeing the time they first opened this version.
+func (w Watermark) cacheName() string {
+	sum := sha256.Sum256([]byte(strings.ToLower(w.Viewer) + "\x00" + w.IPAddress))
+	return hex.EncodeToString(sum[:8]) + ".pdf"
+}
+
+// Watermarked returns the key of the PDF at sourceKey stamped for mark,
+// which Gotenberg's PDF engines do. Copies are cached per viewer and
+// address under watermarks/<file>/<version>/ and dropped with the file's
+// other renditions.
+func (s *RenditionService) Watermarked(ctx context.Context, file *models.File, sourceKey string, mark Watermark) (string, error) {
+	options, err := json.Marshal(watermarkOptions)
+	if err != nil {
+		return "", err
+	}
+	return s.cached(ctx, watermarkPrefix, file, sourceKey, mark.cacheName(), "application/pdf", func(ctx context.Context, src io.Reader) ([]byte, error) {
+		var out []byte
+		err := s.Pool.Do(ctx, func(ctx context.Context) error {
+			var err error
+			out, err = s.postPDF(ctx, "watermark", src, map[string]string{
+				"watermarkSource":     "text",
+				"watermarkExpression": mark.Text(),
+				"watermarkOptions":    string(options),
+			})
+			return err
+		})
+		return out, err
+	})
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/logger"
+	"github.com/google/uuid"
+)
+
+func TestRenditionService_Watermarked(t *testing.T) {
+	logger.Init()
+	ctx := context.Background()
+	bucket := newMemoryBucket()
+	_ = bucket.Upload(ctx, "owner/deal.pdf", strings.NewReader("%PDF-full"), 9, "application/pdf")
+	file := &models.File{BaseModel: models.BaseModel{ID: uuid.New(), UpdatedAt: time.Now()}, MimeType: "application/pdf", StoragePath: "owner/deal.pdf"}
+
+	var stamps []string
+	gotenberg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/forms/pdfengines/watermark" || r.FormValue("watermarkSource") != "text" {
+			http.NotFound(w, r)
+			return
+		}
+		stamps = append(stamps, r.FormValue("watermarkExpression"))
+		w.Header().Set("Content-Type", "application/pdf")
+		_, _ = io.WriteString(w, "%PDF-stamped")
+	}))
+	defer gotenberg.Close()
+	renditions := NewRenditionService(bucket, config.GotenbergConfig{URL: gotenberg.URL})
+
+	at := time.Date(2024, 2, 11, 12, 30, 0, 0, time.UTC)
+	alice := Watermark{Viewer: "alice@example.com", IPAddress: "203.0.113.7", At: at}
+	key, err := renditions.Watermarked(ctx, file, file.StoragePath, alice)
+	if err != nil {
+		t.Fatalf("failed stamping: %v", err)
+	}
+	if !strings.HasPrefix(key, watermarkPrefix+file.ID.String()+"/") || string(bucket.objects[key]) != "%PDF-stamped" {
+		t.Fatalf("expected a stamped copy under watermarks/, got %s", key)
+	}
+	if len(stamps) != 1 || stamps[0] != "alice@example.com · 203.0.113.7 · 2024-02-11 12:30 UTC" {
+		t.Fatalf("unexpected stamp %v", stamps)
+	}
+
+	alice.At = at.Add(time.Hour)
+	if again, err := renditions.Watermarked(ctx, file, file.StoragePath, alice); err != nil || again != key || len(stamps) != 1 {
+		t.Fatalf("expected the viewer's copy to be reused, got %s, %v", again, err)
+	}
+
+	other, err := renditions.Watermarked(ctx, file, file.StoragePath, Watermark{IPAddress: "198.51.100.2", At: at})
+	if err != nil || other == key || len(stamps) != 2 || !strings.HasPrefix(stamps[1], "anonymous · 198.51.100.2") {
+		t.Fatalf("expected a separate copy for an anonymous visitor, got %v, %v", stamps, err)
+	}
+
+	renditions.Purge(ctx, file.ID)
+	if _, ok := bucket.objects[key]; ok {
+		t.Fatal("expected the purge to remove watermarked copies")
+	}
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/docshare/api/pkg/logger"
+)
+
+// regionProbeTimeout bounds one health probe, so a region that hangs is
+// marked down rather than stalling the round.
+const regionProbeTimeout = 5 * time.Second
+
+// Region is one copy of the bucket that objects can be read from.
+type Region struct {
+	Name   string
+	Client *S3Client
+}
+
+// RegionStatus is the last probe of a region.
+type RegionStatus struct {
+	Name      string     `json:"name"`
+	Primary   bool       `json:"primary"`
+	Healthy   bool       `json:"healthy"`
+	LatencyMS int64      `json:"latencyMs"`
+	CheckedAt *time.Time `json:"checkedAt,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// RegionRouter picks which copy of a replicated bucket to read from. Each
+// region is probed periodically; the one that answered fastest is the
+// nearest. A replica that has not been probed yet, or failed its last
+// probe, is never picked, and reads fall back to the primary when no
+// replica is healthy.
+type RegionRouter struct {
+	primary  Region
+	replicas []Region
+	// ReplicationLag is how long a changed object may take to reach the
+	// replicas; objects changed more recently are read from the primary.
+	ReplicationLag time.Duration
+
+	mu     sync.RWMutex
+	status map[string]RegionStatus
+}
+
+func NewRegionRouter(primary Region, replicas []Region, replicationLag time.Duration) *RegionRouter {
+	return &RegionRouter{
+		primary:        primary,
+		replicas:       replicas,
+		ReplicationLag: replicationLag,
+		status:         map[string]RegionStatus{},
+	}
+}
+
+// Run probes every region now and then every interval until ctx ends.
+func (r *RegionRouter) Run(ctx context.Context, interval time.Duration) {
+	r.Probe(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Probe(ctx)
+		}
+	}
+}
+
+// Probe checks every region concurrently and records how it answered.
+func (r *RegionRouter) Probe(ctx context.Context) {
+	regions := append([]Region{r.primary}, r.replicas...)
+	results := make([]RegionStatus, len(regions))
+	var wg sync.WaitGroup
+	for i, region := range regions {
+		wg.Add(1)
+		go func(i int, region Region) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, regionProbeTimeout)
+			defer cancel()
+			started := time.Now()
+			err := region.Client.Ping(probeCtx)
+			checked := time.Now().UTC()
+			results[i] = RegionStatus{
+				Name:      region.Name,
+				Primary:   i == 0,
+				Healthy:   err == nil,
+				LatencyMS: time.Since(started).Milliseconds(),
+				CheckedAt: &checked,
+			}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i, region)
+	}
+	wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, result := range results {
+		if previous, ok := r.status[result.Name]; ok && previous.Healthy != result.Healthy {
+			logger.Warn("storage_region_health_changed", map[string]interface{}{
+				"region":  result.Name,
+				"healthy": result.Healthy,
+				"error":   result.Error,
+			})
+		}
+		r.status[result.Name] = result
+	}
+}
+
+// Pick returns the region to read an object last changed at modifiedAt
+// from: preferred when it names a healthy region, otherwise the healthy
+// region with the lowest latency, otherwise the primary.
+func (r *RegionRouter) Pick(preferred string, modifiedAt time.Time) Region {
+	if time.Since(modifiedAt) < r.ReplicationLag {
+		return r.primary
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	best := r.primary
+	bestLatency := int64(-1)
+	if status, ok := r.status[r.primary.Name]; ok && status.Healthy {
+		bestLatency = status.LatencyMS
+		if preferred == r.primary.Name {
+			return r.primary
+		}
+	}
+	for _, replica := range r.replicas {
+		status, ok := r.status[replica.Name]
+		if !ok || !status.Healthy {
+			continue
+		}
+		if replica.Name == preferred {
+			return replica
+		}
+		if bestLatency < 0 || status.LatencyMS < bestLatency {
+			best, bestLatency = replica, status.LatencyMS
+		}
+	}
+	return best
+}
+
+// Status lists the last probe of every region, primary first.
+func (r *RegionRouter) Status() []RegionStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	regions := append([]Region{r.primary}, r.replicas...)
+	statuses := make([]RegionStatus, 0, len(regions))
+	for i, region := range regions {
+		status, ok := r.status[region.Name]
+		if !ok {
+			status = RegionStatus{Name: region.Name, Primary: i == 0}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/config"
+	"github.com/docshare/api/pkg/logger"
+)
+
+// fakeRegion serves the bucket HEAD request a probe makes, after delay,
+// with status.
+func fakeRegion(t *testing.T, name string, delay time.Duration, status *int) Region {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(delay)
+		w.WriteHeader(*status)
+	}))
+	t.Cleanup(server.Close)
+	client, err := NewS3Client(config.S3Config{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Region:    name,
+		AccessKey: "key",
+		SecretKey: "secret",
+		Bucket:    "docshare",
+	})
+	if err != nil {
+		t.Fatalf("failed creating client: %v", err)
+	}
+	return Region{Name: name, Client: client}
+}
+
+func TestRegionRouter(t *testing.T) {
+	logger.Init()
+	ok, down := http.StatusOK, http.StatusForbidden
+	primaryStatus, nearStatus, farStatus := ok, ok, ok
+	primary := fakeRegion(t, "us-east-1", 60*time.Millisecond, &primaryStatus)
+	near := fakeRegion(t, "eu-west-1", 0, &nearStatus)
+	far := fakeRegion(t, "ap-southeast-2", 120*time.Millisecond, &farStatus)
+	router := NewRegionRouter(primary, []Region{near, far}, 15*time.Minute)
+	old := time.Now().Add(-time.Hour)
+
+	if got := router.Pick("", old); got.Name != primary.Name {
+		t.Fatalf("expected the primary before any probe, got %s", got.Name)
+	}
+
+	router.Probe(context.Background())
+	if got := router.Pick("", old); got.Name != near.Name {
+		t.Fatalf("expected the nearest replica, got %s", got.Name)
+	}
+	if got := router.Pick(far.Name, old); got.Name != far.Name {
+		t.Fatalf("expected the preferred region, got %s", got.Name)
+	}
+	if got := router.Pick("", time.Now()); got.Name != primary.Name {
+		t.Fatalf("expected a fresh object to be read from the primary, got %s", got.Name)
+	}
+
+	nearStatus = down
+	router.Probe(context.Background())
+	if got := router.Pick(near.Name, old); got.Name != primary.Name {
+		t.Fatalf("expected an unhealthy region to be skipped, got %s", got.Name)
+	}
+	statuses := router.Status()
+	if len(statuses) != 3 || !statuses[0].Primary || statuses[1].Healthy || statuses[1].Error == "" {
+		t.Fatalf("unexpected status %+v", statuses)
+	}
+}
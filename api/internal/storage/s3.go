@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,10 +16,15 @@ import (
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
+// ErrObjectNotFound is returned by Stat and Download for a key the bucket
+// does not hold.
+var ErrObjectNotFound = errors.New("object not found")
+
 type S3Client struct {
 	client         *minio.Client
 	bucket         string
 	publicEndpoint string
+	storageClass   string
 }
 
 func NewS3Client(cfg config.S3Config) (*S3Client, error) {
@@ -43,12 +49,14 @@ func NewS3Client(cfg config.S3Config) (*S3Client, error) {
 		client:         client,
 		bucket:         cfg.Bucket,
 		publicEndpoint: cfg.PublicEndpoint,
+		storageClass:   cfg.StorageClass,
 	}, nil
 }
 
 func (s *S3Client) Upload(ctx context.Context, objectName string, reader io.Reader, size int64, contentType string) error {
 	_, err := s.client.PutObject(ctx, s.bucket, objectName, reader, size, minio.PutObjectOptions{
-		ContentType: contentType,
+		ContentType:  contentType,
+		StorageClass: s.storageClass,
 	})
 	if err != nil {
 		logger.Error("s3_upload_failed", err, map[string]interface{}{
@@ -68,6 +76,38 @@ func (s *S3Client) Upload(ctx context.Context, objectName string, reader io.Read
 	return err
 }
 
+// streamPartSize is the multipart chunk size for uploads of unknown length.
+// The client buffers one part in memory at a time, so this bounds the memory
+// a streamed upload uses; S3's 10,000-part limit puts the largest object at
+// about 156 GiB.
+const streamPartSize = 16 * 1024 * 1024
+
+// UploadStream stores reader without knowing its length in advance, as a
+// multipart upload that is aborted if reader fails. It returns the number
+// of bytes stored.
+func (s *S3Client) UploadStream(ctx context.Context, objectName string, reader io.Reader, contentType string) (int64, error) {
+	info, err := s.client.PutObject(ctx, s.bucket, objectName, reader, -1, minio.PutObjectOptions{
+		ContentType:  contentType,
+		PartSize:     streamPartSize,
+		StorageClass: s.storageClass,
+	})
+	if err != nil {
+		logger.Error("s3_upload_failed", err, map[string]interface{}{
+			"object_name":  objectName,
+			"content_type": contentType,
+			"bucket":       s.bucket,
+		})
+		return 0, err
+	}
+	logger.Info("s3_upload_success", map[string]interface{}{
+		"object_name":  objectName,
+		"size":         info.Size,
+		"content_type": contentType,
+		"bucket":       s.bucket,
+	})
+	return info.Size, nil
+}
+
 func (s *S3Client) Download(ctx context.Context, objectName string) (*minio.Object, error) {
 	obj, err := s.client.GetObject(ctx, s.bucket, objectName, minio.GetObjectOptions{})
 	if err != nil {
@@ -78,6 +118,10 @@ func (s *S3Client) Download(ctx context.Context, objectName string) (*minio.Obje
 		return nil, err
 	}
 	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if resp := minio.ToErrorResponse(err); resp.Code == "NoSuchKey" || resp.StatusCode == http.StatusNotFound {
+			return nil, ErrObjectNotFound
+		}
 		logger.Error("s3_download_stat_failed", err, map[string]interface{}{
 			"object_name": objectName,
 			"bucket":      s.bucket,
@@ -107,6 +151,29 @@ func (s *S3Client) Delete(ctx context.Context, objectName string) error {
 	return err
 }
 
+// RequestRestore asks the provider to make an object in an archival storage
+// class readable again for days days. Objects in a standard class are
+// always readable, so nothing is asked for them.
+func (s *S3Client) RequestRestore(ctx context.Context, objectName string, days int) error {
+	if s.storageClass == "" || s.storageClass == "STANDARD" {
+		return nil
+	}
+	req := minio.RestoreRequest{}
+	req.SetDays(days)
+	req.SetGlacierJobParameters(minio.GlacierJobParameters{Tier: minio.TierStandard})
+	err := s.client.RestoreObject(ctx, s.bucket, objectName, "", req)
+	if err != nil && minio.ToErrorResponse(err).Code == "RestoreAlreadyInProgress" {
+		return nil
+	}
+	if err != nil {
+		logger.Error("s3_restore_request_failed", err, map[string]interface{}{
+			"object_name": objectName,
+			"bucket":      s.bucket,
+		})
+	}
+	return err
+}
+
 func (s *S3Client) PresignedGetURL(ctx context.Context, objectName string, expiry time.Duration) (string, error) {
 	urlValue, err := s.client.PresignedGetObject(ctx, s.bucket, objectName, expiry, nil)
 	if err != nil {
@@ -176,6 +243,44 @@ func (s *S3Client) CopyObject(ctx context.Context, dstKey, srcKey, srcETag strin
 	return nil
 }
 
+// ObjectInfo is one entry of a bucket listing. ContentType is only filled
+// in by Stat.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ContentType  string
+}
+
+// Stat describes one object, returning ErrObjectNotFound if it is absent.
+func (s *S3Client) Stat(ctx context.Context, objectName string) (ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		if resp := minio.ToErrorResponse(err); resp.Code == "NoSuchKey" || resp.StatusCode == http.StatusNotFound {
+			return ObjectInfo{}, ErrObjectNotFound
+		}
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: info.Key, Size: info.Size, LastModified: info.LastModified, ContentType: info.ContentType}, nil
+}
+
+// ListObjects calls fn for every object under prefix whose key sorts after
+// startAfter, in key order, and stops at the first error fn returns.
+func (s *S3Client) ListObjects(ctx context.Context, prefix, startAfter string, fn func(ObjectInfo) error) error {
+	// Cancelling stops the lister goroutine when fn bails out early.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, StartAfter: startAfter, Recursive: true}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		if err := fn(ObjectInfo{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *S3Client) PresignedGetURLWithResponse(ctx context.Context, objectName string, expiry time.Duration, contentType string, contentDisposition string) (string, error) {
 	query := make(url.Values)
 	if contentType != "" {
@@ -192,6 +297,18 @@ func (s *S3Client) PresignedGetURLWithResponse(ctx context.Context, objectName s
 	return urlValue.String(), nil
 }
 
+// Ping checks that the bucket is reachable with the client's credentials.
+func (s *S3Client) Ping(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", s.bucket)
+	}
+	return nil
+}
+
 func (s *S3Client) EnsureBucket(ctx context.Context) error {
 	exists, err := s.client.BucketExists(ctx, s.bucket)
 	if err != nil {
@@ -0,0 +1,65 @@
+// Package keyring holds the keys that sign session, MFA and preview tokens.
+// Tokens carry the ID of the key that signed them, so keys can be added and
+// retired one at a time without invalidating every token at once.
+package keyring
+
+import "sync"
+
+// EnvKeyID names the key taken from JWT_SECRET. Tokens issued before key
+// IDs existed carry none and are checked against it.
+const EnvKeyID = "env"
+
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+var (
+	mu         sync.RWMutex
+	env        = []byte("change-me-in-production")
+	envRetired bool
+	stored     []Key
+)
+
+// SetEnvKey sets the secret of the environment key.
+func SetEnvKey(secret []byte) {
+	mu.Lock()
+	defer mu.Unlock()
+	env = secret
+}
+
+// SetStoredKeys replaces the keys kept in the database, oldest first. The
+// newest of them signs new tokens; with none, the environment key does.
+// envRetired stops tokens signed with the environment key from validating.
+func SetStoredKeys(keys []Key, retireEnv bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	stored = append([]Key(nil), keys...)
+	envRetired = retireEnv
+}
+
+// Current returns the key that signs new tokens.
+func Current() Key {
+	mu.RLock()
+	defer mu.RUnlock()
+	if len(stored) > 0 {
+		return stored[len(stored)-1]
+	}
+	return Key{ID: EnvKeyID, Secret: env}
+}
+
+// Lookup returns the secret of the key with id, if that key still
+// validates tokens. An empty id means the environment key.
+func Lookup(id string) ([]byte, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if id == "" || id == EnvKeyID {
+		return env, !envRetired
+	}
+	for _, key := range stored {
+		if key.ID == id {
+			return key.Secret, true
+		}
+	}
+	return nil, false
+}
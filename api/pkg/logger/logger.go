@@ -147,6 +147,14 @@ func redactSensitiveFields(jsonMap map[string]interface{}) {
 }
 
 func GetRequestBodySummary(c *fiber.Ctx) string {
+	// Streamed bodies the handler did not consume would be read into memory
+	// by c.Body(), so judge large and chunked ones by their headers alone.
+	if length := c.Request().Header.ContentLength(); length > 1024 {
+		return fmt.Sprintf("large (%d bytes)", length)
+	} else if length < 0 && c.Context().RequestBodyStream() != nil {
+		return "streamed"
+	}
+
 	body := c.Body()
 	if len(body) == 0 {
 		return "empty"
@@ -9,37 +9,87 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
+
+	"github.com/docshare/api/pkg/keyring"
 )
 
 const defaultTokenExpiry = 15 * time.Minute
 
-var secret []byte
+// Scopes limit what a token opens. A full token also opens the thumbnail,
+// so a gallery can fetch both with one token. An unlock token opens no
+// preview; it proves its holder gave a password-protected file's password.
+const (
+	ScopeFull   = "full"
+	ScopeThumb  = "thumb"
+	ScopeUnlock = "unlock"
+)
 
 type PreviewToken struct {
 	FileID    string `json:"fid"`
 	UserID    string `json:"uid"`
 	ExpiresAt int64  `json:"exp"`
 	Nonce     string `json:"nce"`
+	// Scope is empty on tokens issued before scopes existed, which are
+	// treated as full.
+	Scope string `json:"scp,omitempty"`
+	// MaxUses is how many requests the token may serve; 0 means any
+	// number until it expires. The count itself is kept by the caller.
+	MaxUses int `json:"max,omitempty"`
+	// KeyID names the signing key. Tokens issued before key IDs existed
+	// were signed with the environment key.
+	KeyID string `json:"kid,omitempty"`
 }
 
+// Options shape a generated token. Zero values mean a full token valid for
+// 15 minutes with unlimited uses.
+type Options struct {
+	Scope   string
+	TTL     time.Duration
+	MaxUses int
+}
+
+// Allows reports whether the token opens scope.
+func (t *PreviewToken) Allows(scope string) bool {
+	if scope == ScopeUnlock {
+		return t.Scope == ScopeUnlock
+	}
+	return t.Scope == "" || t.Scope == ScopeFull || t.Scope == scope
+}
+
+// SetSecret sets the environment signing key, which preview tokens share
+// with session tokens.
 func SetSecret(s string) {
-	secret = []byte(s)
+	if s != "" {
+		keyring.SetEnvKey([]byte(s))
+	}
 }
 
 func StartCleanup(_ time.Duration) {
 }
 
 func Generate(fileID, userID string) string {
+	return GenerateWithOptions(fileID, userID, Options{})
+}
+
+func GenerateWithOptions(fileID, userID string, opts Options) string {
 	nonce := make([]byte, 16)
 	if _, err := rand.Read(nonce); err != nil {
 		return ""
 	}
+	key := keyring.Current()
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = defaultTokenExpiry
+	}
 
 	tok := PreviewToken{
 		FileID:    fileID,
 		UserID:    userID,
-		ExpiresAt: time.Now().Add(defaultTokenExpiry).Unix(),
+		ExpiresAt: time.Now().Add(ttl).Unix(),
 		Nonce:     hex.EncodeToString(nonce),
+		Scope:     opts.Scope,
+		MaxUses:   opts.MaxUses,
+		KeyID:     key.ID,
 	}
 
 	data, err := json.Marshal(tok)
@@ -48,7 +98,7 @@ func Generate(fileID, userID string) string {
 	}
 
 	encoded := base64.RawURLEncoding.EncodeToString(data)
-	return encoded + "." + sign(data)
+	return encoded + "." + sign(key.Secret, data)
 }
 
 func Validate(tokenString string) (*PreviewToken, error) {
@@ -62,14 +112,16 @@ func Validate(tokenString string) (*PreviewToken, error) {
 		return nil, fmt.Errorf("invalid token encoding")
 	}
 
-	if sign(decoded) != sigPart {
-		return nil, fmt.Errorf("invalid token signature")
-	}
-
+	// The payload names its key, so it is read before the signature is
+	// checked; nothing in it is trusted until then.
 	var tok PreviewToken
 	if err := json.Unmarshal(decoded, &tok); err != nil {
 		return nil, fmt.Errorf("invalid token data")
 	}
+	secret, ok := keyring.Lookup(tok.KeyID)
+	if !ok || !hmac.Equal([]byte(sign(secret, decoded)), []byte(sigPart)) {
+		return nil, fmt.Errorf("invalid token signature")
+	}
 
 	if time.Now().Unix() > tok.ExpiresAt {
 		return nil, fmt.Errorf("token expired")
@@ -86,11 +138,7 @@ func GetMetadata(tokenString string) (fileID, userID string, err error) {
 	return tok.FileID, tok.UserID, nil
 }
 
-func sign(data []byte) string {
-	key := secret
-	if len(key) == 0 {
-		key = []byte("docshare-preview-token-fallback")
-	}
+func sign(key, data []byte) string {
 	mac := hmac.New(sha256.New, key)
 	mac.Write(data)
 	return hex.EncodeToString(mac.Sum(nil))
@@ -1,8 +1,12 @@
 package previewtoken
 
 import (
+	"encoding/base64"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/docshare/api/pkg/keyring"
 )
 
 func TestPreviewToken(t *testing.T) {
@@ -84,6 +88,32 @@ func TestPreviewToken(t *testing.T) {
 		}
 	})
 
+	t.Run("GenerateWithOptions carries scope, lifetime and uses", func(t *testing.T) {
+		token := GenerateWithOptions("file-opts", "user-opts", Options{Scope: ScopeThumb, TTL: time.Hour, MaxUses: 3})
+		tok, err := Validate(token)
+		if err != nil {
+			t.Fatalf("expected valid token, got error: %v", err)
+		}
+		if tok.MaxUses != 3 || tok.ExpiresAt < time.Now().Add(59*time.Minute).Unix() {
+			t.Errorf("expected 3 uses over an hour, got %d uses until %d", tok.MaxUses, tok.ExpiresAt)
+		}
+		if !tok.Allows(ScopeThumb) || tok.Allows(ScopeFull) {
+			t.Error("expected a thumbnail token to open only the thumbnail")
+		}
+
+		full, _ := Validate(Generate("file-opts", "user-opts"))
+		if !full.Allows(ScopeThumb) || !full.Allows(ScopeFull) {
+			t.Error("expected a full token to open both")
+		}
+		if full.Allows(ScopeUnlock) {
+			t.Error("expected a full token not to count as an unlock grant")
+		}
+		unlock, _ := Validate(GenerateWithOptions("file-opts", "", Options{Scope: ScopeUnlock}))
+		if !unlock.Allows(ScopeUnlock) || unlock.Allows(ScopeFull) || unlock.Allows(ScopeThumb) {
+			t.Error("expected an unlock token to open no preview")
+		}
+	})
+
 	t.Run("GetMetadata returns error for invalid token", func(t *testing.T) {
 		_, _, err := GetMetadata("invalid")
 		if err == nil {
@@ -93,12 +123,12 @@ func TestPreviewToken(t *testing.T) {
 }
 
 func TestSign(t *testing.T) {
-	SetSecret("sign-test-secret")
+	key := []byte("sign-test-secret")
 
 	t.Run("sign produces consistent output", func(t *testing.T) {
 		data := []byte("test data to sign")
-		sig1 := sign(data)
-		sig2 := sign(data)
+		sig1 := sign(key, data)
+		sig2 := sign(key, data)
 
 		if sig1 != sig2 {
 			t.Error("expected same signature for same data")
@@ -106,8 +136,8 @@ func TestSign(t *testing.T) {
 	})
 
 	t.Run("sign produces different output for different data", func(t *testing.T) {
-		sig1 := sign([]byte("data1"))
-		sig2 := sign([]byte("data2"))
+		sig1 := sign(key, []byte("data1"))
+		sig2 := sign(key, []byte("data2"))
 
 		if sig1 == sig2 {
 			t.Error("expected different signatures for different data")
@@ -115,6 +145,38 @@ func TestSign(t *testing.T) {
 	})
 }
 
+func TestKeyRotation(t *testing.T) {
+	SetSecret("env-secret")
+	t.Cleanup(func() { keyring.SetStoredKeys(nil, false) })
+
+	old := Generate("file-1", "user-1")
+	keyring.SetStoredKeys([]keyring.Key{{ID: "k2", Secret: []byte("second-secret")}}, false)
+	fresh := Generate("file-1", "user-1")
+
+	tok, err := Validate(fresh)
+	if err != nil || tok.KeyID != "k2" {
+		t.Fatalf("expected the newest key to sign, got %+v, %v", tok, err)
+	}
+	if _, err := Validate(old); err != nil {
+		t.Fatalf("expected a token from the environment key to stay valid, got %v", err)
+	}
+
+	keyring.SetStoredKeys([]keyring.Key{{ID: "k2", Secret: []byte("second-secret")}}, true)
+	if _, err := Validate(old); err == nil {
+		t.Fatal("expected a token from a retired key to be refused")
+	}
+
+	// A token claiming another key's ID still has to carry that key's
+	// signature.
+	keyring.SetStoredKeys([]keyring.Key{{ID: "k2", Secret: []byte("second-secret")}, {ID: "k3", Secret: []byte("third-secret")}}, false)
+	data, sig, _ := split(fresh)
+	decoded, _ := base64.RawURLEncoding.DecodeString(data)
+	forged := strings.Replace(string(decoded), `"kid":"k2"`, `"kid":"k3"`, 1)
+	if _, err := Validate(base64.RawURLEncoding.EncodeToString([]byte(forged)) + "." + sig); err == nil {
+		t.Fatal("expected a token with a swapped key ID to be refused")
+	}
+}
+
 func TestSplit(t *testing.T) {
 	t.Run("split works correctly", func(t *testing.T) {
 		data, sig, err := split("abc.def")
@@ -0,0 +1,365 @@
+// Package textrender turns source files and Markdown into HTML fragments for
+// the file preview pane. Every byte of input is HTML-escaped before markup is
+// added, so the output is safe to inject without a separate sanitizer.
+package textrender
+
+import (
+	"html"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Token classes emitted as <span class="tok-…">. The web client ships the
+// matching stylesheet.
+const (
+	classKeyword = "tok-kw"
+	classString  = "tok-str"
+	classComment = "tok-cmt"
+	classNumber  = "tok-num"
+)
+
+type language struct {
+	lineComments  []string
+	blockComments [][2]string
+	quotes        string
+	keywords      map[string]bool
+	// caseInsensitive keywords, e.g. SQL.
+	caseInsensitive bool
+}
+
+func words(s string) map[string]bool {
+	out := map[string]bool{}
+	for _, w := range strings.Fields(s) {
+		out[w] = true
+	}
+	return out
+}
+
+var cStyleComments = [][2]string{{"/*", "*/"}}
+
+var languages = map[string]language{
+	"go": {
+		lineComments: []string{"//"}, blockComments: cStyleComments, quotes: "\"'`",
+		keywords: words("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false iota"),
+	},
+	"javascript": {
+		lineComments: []string{"//"}, blockComments: cStyleComments, quotes: "\"'`",
+		keywords: words("async await break case catch class const continue debugger default delete do else export extends false finally for from function if import in instanceof let new null of return static super switch this throw true try typeof undefined var void while with yield"),
+	},
+	"typescript": {
+		lineComments: []string{"//"}, blockComments: cStyleComments, quotes: "\"'`",
+		keywords: words("abstract any as async await boolean break case catch class const continue declare default delete do else enum export extends false finally for from function if implements import in instanceof interface keyof let namespace never new null number of private protected public readonly return static string super switch this throw true try type typeof undefined unknown var void while yield"),
+	},
+	"python": {
+		lineComments: []string{"#"}, quotes: "\"'",
+		keywords: words("False None True and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield self"),
+	},
+	"rust": {
+		lineComments: []string{"//"}, blockComments: cStyleComments, quotes: "\"",
+		keywords: words("as async await break const continue crate dyn else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while"),
+	},
+	"java": {
+		lineComments: []string{"//"}, blockComments: cStyleComments, quotes: "\"'",
+		keywords: words("abstract boolean break byte case catch char class const continue default do double else enum extends false final finally float for if implements import instanceof int interface long new null package private protected public return short static super switch synchronized this throw throws true try void volatile while var record"),
+	},
+	"kotlin": {
+		lineComments: []string{"//"}, blockComments: cStyleComments, quotes: "\"'",
+		keywords: words("as break class continue do else false for fun if in interface is null object package return super this throw true try typealias val var when while import private public internal protected override data sealed companion"),
+	},
+	"c": {
+		lineComments: []string{"//"}, blockComments: cStyleComments, quotes: "\"'",
+		keywords: words("auto break case char const continue default do double else enum extern float for goto if inline int long register return short signed sizeof static struct switch typedef union unsigned void volatile while NULL #include #define #ifdef #ifndef #endif #if #else"),
+	},
+	"cpp": {
+		lineComments: []string{"//"}, blockComments: cStyleComments, quotes: "\"'",
+		keywords: words("auto bool break case catch char class const constexpr continue default delete do double else enum explicit extern false float for friend if inline int long namespace new nullptr operator private protected public return short signed sizeof static struct switch template this throw true try typedef typename union unsigned using virtual void volatile while #include #define #ifdef #ifndef #endif #if #else"),
+	},
+	"csharp": {
+		lineComments: []string{"//"}, blockComments: cStyleComments, quotes: "\"'",
+		keywords: words("abstract as async await base bool break case catch char class const continue decimal default do double else enum event false finally float for foreach if in int interface internal is lock long namespace new null object out override private protected public readonly ref return sealed static string struct switch this throw true try using var virtual void while"),
+	},
+	"swift": {
+		lineComments: []string{"//"}, blockComments: cStyleComments, quotes: "\"",
+		keywords: words("as break case class continue default defer do else enum extension false for func guard if import in init let nil private protocol public return self static struct switch throw throws true try var where while"),
+	},
+	"ruby": {
+		lineComments: []string{"#"}, quotes: "\"'",
+		keywords: words("alias and begin break case class def defined? do else elsif end ensure false for if in module next nil not or redo rescue retry return self super then true undef unless until when while yield require"),
+	},
+	"php": {
+		lineComments: []string{"//", "#"}, blockComments: cStyleComments, quotes: "\"'",
+		keywords: words("abstract and array as break case catch class const continue default do echo else elseif extends false final finally fn for foreach function if implements interface namespace new null private protected public return static switch throw trait true try use var while"),
+	},
+	"shell": {
+		lineComments: []string{"#"}, quotes: "\"'",
+		keywords: words("if then else elif fi for while until do done case esac function in return local export readonly set unset exit echo"),
+	},
+	"sql": {
+		lineComments: []string{"--"}, blockComments: cStyleComments, quotes: "'\"", caseInsensitive: true,
+		keywords: words("select from where and or not insert into values update set delete create table alter drop index primary key foreign references join left right inner outer on group by order having limit offset as distinct null is in like between case when then else end union all exists default unique"),
+	},
+	"css": {
+		blockComments: cStyleComments, quotes: "\"'",
+		keywords: words("@media @import @keyframes @font-face !important"),
+	},
+	"yaml": {
+		lineComments: []string{"#"}, quotes: "\"'",
+		keywords: words("true false null yes no on off"),
+	},
+	"json": {
+		quotes:   "\"",
+		keywords: words("true false null"),
+	},
+	"toml": {
+		lineComments: []string{"#"}, quotes: "\"'",
+		keywords: words("true false"),
+	},
+	"html": {
+		blockComments: [][2]string{{"<!--", "-->"}}, quotes: "\"",
+	},
+	"xml": {
+		blockComments: [][2]string{{"<!--", "-->"}}, quotes: "\"",
+	},
+}
+
+var extensionLanguages = map[string]string{
+	".go":    "go",
+	".js":    "javascript",
+	".jsx":   "javascript",
+	".mjs":   "javascript",
+	".cjs":   "javascript",
+	".ts":    "typescript",
+	".tsx":   "typescript",
+	".py":    "python",
+	".rs":    "rust",
+	".java":  "java",
+	".kt":    "kotlin",
+	".kts":   "kotlin",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".cxx":   "cpp",
+	".hpp":   "cpp",
+	".cs":    "csharp",
+	".swift": "swift",
+	".rb":    "ruby",
+	".php":   "php",
+	".sh":    "shell",
+	".bash":  "shell",
+	".zsh":   "shell",
+	".sql":   "sql",
+	".css":   "css",
+	".scss":  "css",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".json":  "json",
+	".toml":  "toml",
+	".html":  "html",
+	".htm":   "html",
+	".xml":   "xml",
+	".svg":   "xml",
+}
+
+// languageExtensions is the usual extension of each language, for naming
+// files written in it.
+var languageExtensions = map[string]string{
+	"go":         ".go",
+	"javascript": ".js",
+	"typescript": ".ts",
+	"python":     ".py",
+	"rust":       ".rs",
+	"java":       ".java",
+	"kotlin":     ".kt",
+	"c":          ".c",
+	"cpp":        ".cpp",
+	"csharp":     ".cs",
+	"swift":      ".swift",
+	"ruby":       ".rb",
+	"php":        ".php",
+	"shell":      ".sh",
+	"sql":        ".sql",
+	"css":        ".css",
+	"yaml":       ".yaml",
+	"json":       ".json",
+	"toml":       ".toml",
+	"html":       ".html",
+	"xml":        ".xml",
+}
+
+var languageAliases = map[string]string{
+	"js":         "javascript",
+	"jsx":        "javascript",
+	"ts":         "typescript",
+	"tsx":        "typescript",
+	"py":         "python",
+	"rs":         "rust",
+	"kt":         "kotlin",
+	"c++":        "cpp",
+	"cs":         "csharp",
+	"c#":         "csharp",
+	"rb":         "ruby",
+	"sh":         "shell",
+	"bash":       "shell",
+	"zsh":        "shell",
+	"console":    "shell",
+	"yml":        "yaml",
+	"golang":     "go",
+	"postgresql": "sql",
+}
+
+// LanguageForFile returns the highlighter language for filename, or "" when
+// the extension is not recognised.
+func LanguageForFile(filename string) string {
+	base := strings.ToLower(filepath.Base(filename))
+	switch base {
+	case "dockerfile", "makefile":
+		return "shell"
+	}
+	return extensionLanguages[filepath.Ext(base)]
+}
+
+// ExtensionForLanguage returns the file extension, with its dot, that
+// LanguageForFile maps back to lang, or "" for an unsupported language.
+func ExtensionForLanguage(lang string) string {
+	return languageExtensions[lang]
+}
+
+// NormalizeLanguage resolves a fenced-code info string such as "JS" or
+// "golang" to a supported language, or "" when unknown.
+func NormalizeLanguage(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := languageAliases[name]; ok {
+		return alias
+	}
+	if _, ok := languages[name]; ok {
+		return name
+	}
+	return ""
+}
+
+// Highlight renders src as a <pre><code> block with token spans for lang.
+// Unknown languages are rendered as escaped plain text.
+func Highlight(src, lang string) string {
+	var b strings.Builder
+	b.WriteString(`<pre class="code"><code`)
+	if lang != "" {
+		b.WriteString(` class="language-`)
+		b.WriteString(html.EscapeString(lang))
+		b.WriteString(`"`)
+	}
+	b.WriteString(">")
+	highlightInto(&b, src, lang)
+	b.WriteString("</code></pre>\n")
+	return b.String()
+}
+
+func highlightInto(b *strings.Builder, src, lang string) {
+	def, ok := languages[lang]
+	if !ok {
+		b.WriteString(html.EscapeString(src))
+		return
+	}
+
+	for i := 0; i < len(src); {
+		rest := src[i:]
+
+		if end, ok := matchComment(rest, def); ok {
+			span(b, classComment, rest[:end])
+			i += end
+			continue
+		}
+
+		if strings.IndexByte(def.quotes, rest[0]) >= 0 {
+			end := scanString(rest)
+			span(b, classString, rest[:end])
+			i += end
+			continue
+		}
+
+		r := rune(rest[0])
+		if unicode.IsDigit(r) && (i == 0 || !isWordByte(src[i-1])) {
+			end := 1
+			for end < len(rest) && (isWordByte(rest[end]) || rest[end] == '.') {
+				end++
+			}
+			span(b, classNumber, rest[:end])
+			i += end
+			continue
+		}
+
+		if isWordByte(rest[0]) || rest[0] == '#' || rest[0] == '@' || rest[0] == '!' {
+			end := 1
+			for end < len(rest) && (isWordByte(rest[end]) || rest[end] == '-' && lang == "css" || rest[end] == '?' && lang == "ruby") {
+				end++
+			}
+			word := rest[:end]
+			key := word
+			if def.caseInsensitive {
+				key = strings.ToLower(word)
+			}
+			if def.keywords[key] {
+				span(b, classKeyword, word)
+			} else {
+				b.WriteString(html.EscapeString(word))
+			}
+			i += end
+			continue
+		}
+
+		b.WriteString(html.EscapeString(rest[:1]))
+		i++
+	}
+}
+
+func matchComment(rest string, def language) (int, bool) {
+	for _, prefix := range def.lineComments {
+		if strings.HasPrefix(rest, prefix) {
+			if nl := strings.IndexByte(rest, '\n'); nl >= 0 {
+				return nl, true
+			}
+			return len(rest), true
+		}
+	}
+	for _, pair := range def.blockComments {
+		if strings.HasPrefix(rest, pair[0]) {
+			if end := strings.Index(rest[len(pair[0]):], pair[1]); end >= 0 {
+				return len(pair[0]) + end + len(pair[1]), true
+			}
+			return len(rest), true
+		}
+	}
+	return 0, false
+}
+
+// scanString returns the length of the quoted literal at the start of s,
+// honouring backslash escapes. Unterminated literals end at the newline.
+func scanString(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		case '\n':
+			if quote != '`' {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func span(b *strings.Builder, class, text string) {
+	b.WriteString(`<span class="`)
+	b.WriteString(class)
+	b.WriteString(`">`)
+	b.WriteString(html.EscapeString(text))
+	b.WriteString("</span>")
+}
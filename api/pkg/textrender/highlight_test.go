@@ -0,0 +1,71 @@
+package textrender
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		lang string
+		want string
+	}{
+		{"keywords and strings", `return "a<b"`, "go", `<span class="tok-kw">return</span> <span class="tok-str">&#34;a&lt;b&#34;</span>`},
+		{"line comment", "x = 1 # note", "python", `x = <span class="tok-num">1</span> <span class="tok-cmt"># note</span>`},
+		{"block comment", "/* a */b", "c", `<span class="tok-cmt">/* a */</span>b`},
+		{"sql is case-insensitive", "SELECT id", "sql", `<span class="tok-kw">SELECT</span> id`},
+		{"identifier digits are not numbers", "x1", "go", "x1"},
+		{"escaped quote", `'it\'s'`, "javascript", `<span class="tok-str">&#39;it\&#39;s&#39;</span>`},
+		{"unknown language is escaped", "<b>", "", "&lt;b&gt;"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Highlight(tc.src, tc.lang)
+			got = strings.TrimSuffix(got, "</code></pre>\n")
+			got = got[strings.Index(got, ">")+1:]
+			got = got[strings.Index(got, ">")+1:]
+			if got != tc.want {
+				t.Fatalf("Highlight(%q, %q)\n got: %q\nwant: %q", tc.src, tc.lang, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLanguageForFile(t *testing.T) {
+	cases := map[string]string{
+		"main.go":      "go",
+		"App.TSX":      "typescript",
+		"Dockerfile":   "shell",
+		"notes.txt":    "",
+		"config.yml":   "yaml",
+		"archive.tar":  "",
+		"lib/util.cpp": "cpp",
+	}
+	for name, want := range cases {
+		if got := LanguageForFile(name); got != want {
+			t.Errorf("LanguageForFile(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	for in, want := range map[string]string{"JS": "javascript", "golang": "go", "rust": "rust", "brainfuck": ""} {
+		if got := NormalizeLanguage(in); got != want {
+			t.Errorf("NormalizeLanguage(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestExtensionForLanguage(t *testing.T) {
+	for lang := range languages {
+		ext := ExtensionForLanguage(lang)
+		if got := LanguageForFile("file" + ext); got != lang {
+			t.Errorf("ExtensionForLanguage(%q) = %q, which maps back to %q", lang, ext, got)
+		}
+	}
+	if got := ExtensionForLanguage("brainfuck"); got != "" {
+		t.Errorf("expected no extension for an unknown language, got %q", got)
+	}
+}
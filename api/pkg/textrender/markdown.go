@@ -0,0 +1,540 @@
+package textrender
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Markdown renders the common subset of CommonMark and GFM used in READMEs
+// and notes: headings, paragraphs, emphasis, inline and fenced code, links,
+// images, block quotes, lists, tables and rules. Raw HTML in the source is
+// shown escaped rather than interpreted, and links and images are limited
+// to safe URL schemes.
+func Markdown(src string) string {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	var b strings.Builder
+	renderBlocks(&b, lines)
+	return b.String()
+}
+
+// maxNestingDepth bounds recursion through nested quotes and lists so a
+// pathological document cannot exhaust the stack.
+const maxNestingDepth = 16
+
+var (
+	headingPattern     = regexp.MustCompile(`^(#{1,6})(?:[ \t]+(.*?))?[ \t]*#*[ \t]*$`)
+	rulePattern        = regexp.MustCompile(`^ {0,3}([-*_])(?:[ \t]*[-*_]){2,}[ \t]*$`)
+	bulletPattern      = regexp.MustCompile(`^( {0,3})([-*+])[ \t]+(.*)$`)
+	orderedPattern     = regexp.MustCompile(`^( {0,3})(\d{1,9})[.)][ \t]+(.*)$`)
+	fencePattern       = regexp.MustCompile("^ {0,3}(```+|~~~+)[ \t]*([^`\\s]*)")
+	tableDelimPattern  = regexp.MustCompile(`^\|?[ \t]*:?-+:?[ \t]*(\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	taskPattern        = regexp.MustCompile(`^\[([ xX])\][ \t]+`)
+	safeSchemes        = map[string]bool{"http": true, "https": true, "mailto": true}
+	safeImageSchemes   = map[string]bool{"http": true, "https": true}
+	blockquotePrefixRe = regexp.MustCompile(`^ {0,3}> ?`)
+)
+
+func renderBlocks(b *strings.Builder, lines []string) {
+	renderBlocksDepth(b, lines, 0)
+}
+
+func renderBlocksDepth(b *strings.Builder, lines []string, depth int) {
+	if depth > maxNestingDepth {
+		writeParagraph(b, lines)
+		return
+	}
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			i++
+
+		case fencePattern.MatchString(line):
+			m := fencePattern.FindStringSubmatch(line)
+			fence := m[1]
+			lang := NormalizeLanguage(m[2])
+			var body []string
+			i++
+			for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+				body = append(body, lines[i])
+				i++
+			}
+			i++ // closing fence, or past the end
+			code := strings.Join(body, "\n")
+			if len(body) > 0 {
+				code += "\n"
+			}
+			b.WriteString(Highlight(code, lang))
+
+		case headingPattern.MatchString(trimmed) && len(line)-len(strings.TrimLeft(line, " ")) < 4:
+			m := headingPattern.FindStringSubmatch(trimmed)
+			level := strconv.Itoa(len(m[1]))
+			text := m[2]
+			b.WriteString("<h" + level)
+			if id := slugify(text); id != "" {
+				b.WriteString(` id="` + id + `"`)
+			}
+			b.WriteString(">" + renderInline(text) + "</h" + level + ">\n")
+			i++
+
+		case rulePattern.MatchString(line):
+			b.WriteString("<hr>\n")
+			i++
+
+		case blockquotePrefixRe.MatchString(line):
+			var inner []string
+			for i < len(lines) && strings.TrimSpace(lines[i]) != "" {
+				inner = append(inner, blockquotePrefixRe.ReplaceAllString(lines[i], ""))
+				i++
+			}
+			b.WriteString("<blockquote>\n")
+			renderBlocksDepth(b, inner, depth+1)
+			b.WriteString("</blockquote>\n")
+
+		case bulletPattern.MatchString(line) || orderedPattern.MatchString(line):
+			i = renderList(b, lines, i, depth)
+
+		case strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t"):
+			var body []string
+			for i < len(lines) && (strings.HasPrefix(lines[i], "    ") || strings.HasPrefix(lines[i], "\t") || strings.TrimSpace(lines[i]) == "") {
+				body = append(body, strings.TrimPrefix(strings.TrimPrefix(lines[i], "\t"), "    "))
+				i++
+			}
+			for len(body) > 0 && strings.TrimSpace(body[len(body)-1]) == "" {
+				body = body[:len(body)-1]
+			}
+			b.WriteString(Highlight(strings.Join(body, "\n")+"\n", ""))
+
+		case strings.Contains(line, "|") && i+1 < len(lines) && tableDelimPattern.MatchString(strings.TrimSpace(lines[i+1])) && strings.Contains(lines[i+1], "-"):
+			i = renderTable(b, lines, i)
+
+		default:
+			start := i
+			i++
+			for i < len(lines) && !startsBlock(lines[i]) {
+				i++
+			}
+			writeParagraph(b, lines[start:i])
+		}
+	}
+}
+
+// startsBlock reports whether line interrupts a paragraph.
+func startsBlock(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" ||
+		fencePattern.MatchString(line) ||
+		headingPattern.MatchString(trimmed) && !strings.HasPrefix(line, "    ") ||
+		rulePattern.MatchString(line) ||
+		blockquotePrefixRe.MatchString(line) ||
+		bulletPattern.MatchString(line) ||
+		orderedPattern.MatchString(line)
+}
+
+func writeParagraph(b *strings.Builder, lines []string) {
+	parts := make([]string, 0, len(lines))
+	for _, l := range lines {
+		parts = append(parts, strings.TrimLeft(l, " \t"))
+	}
+	b.WriteString("<p>" + renderInline(strings.TrimRight(strings.Join(parts, "\n"), " \t")) + "</p>\n")
+}
+
+func renderList(b *strings.Builder, lines []string, i, depth int) int {
+	ordered := orderedPattern.MatchString(lines[i]) && !bulletPattern.MatchString(lines[i])
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+		m := orderedPattern.FindStringSubmatch(lines[i])
+		if start, err := strconv.Atoi(m[2]); err == nil && start != 1 {
+			b.WriteString(`<ol start="` + strconv.Itoa(start) + `">` + "\n")
+		} else {
+			b.WriteString("<ol>\n")
+		}
+	} else {
+		b.WriteString("<ul>\n")
+	}
+
+	for i < len(lines) {
+		var indent, first string
+		if m := bulletPattern.FindStringSubmatch(lines[i]); m != nil && !ordered {
+			indent, first = m[1], m[3]
+		} else if m := orderedPattern.FindStringSubmatch(lines[i]); m != nil && ordered {
+			indent, first = m[1], m[3]
+		} else {
+			break
+		}
+		// Continuation lines belong to the item while they are indented
+		// past the marker or are lazy paragraph continuations.
+		item := []string{first}
+		i++
+		for i < len(lines) {
+			l := lines[i]
+			if strings.TrimSpace(l) == "" {
+				if i+1 < len(lines) && leadingSpaces(lines[i+1]) > len(indent) {
+					item = append(item, "")
+					i++
+					continue
+				}
+				break
+			}
+			if leadingSpaces(l) > len(indent) {
+				item = append(item, dedent(l, len(indent)+2))
+				i++
+				continue
+			}
+			if startsBlock(l) {
+				break
+			}
+			item = append(item, strings.TrimSpace(l))
+			i++
+		}
+
+		b.WriteString("<li>")
+		if m := taskPattern.FindStringSubmatch(item[0]); m != nil {
+			checked := ""
+			if m[1] != " " {
+				checked = " checked"
+			}
+			b.WriteString(`<input type="checkbox" disabled` + checked + "> ")
+			item[0] = item[0][len(m[0]):]
+		}
+		if len(item) == 1 {
+			b.WriteString(renderInline(item[0]))
+		} else {
+			var inner strings.Builder
+			renderBlocksDepth(&inner, item, depth+1)
+			out := inner.String()
+			// Tight items render their first paragraph without <p>.
+			if strings.HasPrefix(out, "<p>") {
+				if end := strings.Index(out, "</p>\n"); end >= 0 {
+					out = out[3:end] + "\n" + out[end+5:]
+				}
+			}
+			b.WriteString(out)
+		}
+		b.WriteString("</li>\n")
+
+		// A blank line followed by another marker continues the list.
+		if i < len(lines) && strings.TrimSpace(lines[i]) == "" && i+1 < len(lines) && sameListMarker(lines[i+1], ordered) {
+			i++
+		}
+	}
+
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+func sameListMarker(line string, ordered bool) bool {
+	if ordered {
+		return orderedPattern.MatchString(line)
+	}
+	return bulletPattern.MatchString(line)
+}
+
+func leadingSpaces(line string) int {
+	n := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			n++
+		case '\t':
+			n += 4
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+func dedent(line string, n int) string {
+	for n > 0 && len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+		if line[0] == '\t' {
+			n -= 4
+		} else {
+			n--
+		}
+		line = line[1:]
+	}
+	return line
+}
+
+func renderTable(b *strings.Builder, lines []string, i int) int {
+	header := splitRow(lines[i])
+	var aligns []string
+	for _, cell := range splitRow(lines[i+1]) {
+		cell = strings.TrimSpace(cell)
+		switch {
+		case strings.HasPrefix(cell, ":") && strings.HasSuffix(cell, ":"):
+			aligns = append(aligns, "center")
+		case strings.HasSuffix(cell, ":"):
+			aligns = append(aligns, "right")
+		case strings.HasPrefix(cell, ":"):
+			aligns = append(aligns, "left")
+		default:
+			aligns = append(aligns, "")
+		}
+	}
+
+	writeRow := func(cells []string, tag string) {
+		b.WriteString("<tr>")
+		for j, cell := range cells {
+			b.WriteString("<" + tag)
+			if j < len(aligns) && aligns[j] != "" {
+				b.WriteString(` style="text-align:` + aligns[j] + `"`)
+			}
+			b.WriteString(">" + renderInline(strings.TrimSpace(cell)) + "</" + tag + ">")
+		}
+		b.WriteString("</tr>\n")
+	}
+
+	b.WriteString("<table>\n<thead>\n")
+	writeRow(header, "th")
+	b.WriteString("</thead>\n<tbody>\n")
+	i += 2
+	for i < len(lines) && strings.TrimSpace(lines[i]) != "" && strings.Contains(lines[i], "|") {
+		row := splitRow(lines[i])
+		for len(row) < len(header) {
+			row = append(row, "")
+		}
+		writeRow(row[:len(header)], "td")
+		i++
+	}
+	b.WriteString("</tbody>\n</table>\n")
+	return i
+}
+
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cur strings.Builder
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' && i+1 < len(line) && line[i+1] == '|' {
+			cur.WriteByte('|')
+			i++
+			continue
+		}
+		if line[i] == '|' {
+			cells = append(cells, cur.String())
+			cur.Reset()
+			continue
+		}
+		cur.WriteByte(line[i])
+	}
+	return append(cells, cur.String())
+}
+
+// renderInline handles spans within a block. Text is escaped as it is
+// copied, so markup only ever comes from the cases below.
+func renderInline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		rest := s[i:]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_{}[]()#+-.!|~<>", s[i+1]) >= 0:
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == ' ':
+			// Two or more trailing spaces make a hard line break.
+			spaces := len(rest) - len(strings.TrimLeft(rest, " "))
+			if spaces >= 2 && i+spaces < len(s) && s[i+spaces] == '\n' {
+				b.WriteString("<br>\n")
+				i += spaces + 1
+				continue
+			}
+
+		case c == '`':
+			ticks := len(rest) - len(strings.TrimLeft(rest, "`"))
+			fence := rest[:ticks]
+			if end := strings.Index(rest[ticks:], fence); end >= 0 {
+				code := strings.TrimSpace(rest[ticks : ticks+end])
+				b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i += ticks + end + ticks
+				continue
+			}
+			b.WriteString(html.EscapeString(fence))
+			i += ticks
+			continue
+
+		case c == '!' && strings.HasPrefix(rest, "!["):
+			if text, dest, n, ok := parseLink(rest[1:]); ok {
+				if u, ok := safeURL(dest, safeImageSchemes); ok {
+					b.WriteString(`<img src="` + html.EscapeString(u) + `" alt="` + html.EscapeString(text) + `" loading="lazy">`)
+				} else {
+					b.WriteString(html.EscapeString(text))
+				}
+				i += 1 + n
+				continue
+			}
+
+		case c == '[':
+			if text, dest, n, ok := parseLink(rest); ok {
+				if u, ok := safeURL(dest, safeSchemes); ok {
+					b.WriteString(`<a href="` + html.EscapeString(u) + `" rel="nofollow noopener noreferrer">` + renderInline(text) + "</a>")
+				} else {
+					b.WriteString(renderInline(text))
+				}
+				i += n
+				continue
+			}
+
+		case c == '<':
+			if end := strings.IndexByte(rest, '>'); end > 0 {
+				target := rest[1:end]
+				if u, ok := safeURL(target, safeSchemes); ok && strings.Contains(target, ":") && !strings.ContainsAny(target, " <") {
+					b.WriteString(`<a href="` + html.EscapeString(u) + `" rel="nofollow noopener noreferrer">` + html.EscapeString(target) + "</a>")
+					i += end + 1
+					continue
+				}
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			if n, ok := renderEmphasis(&b, s, i); ok {
+				i = n
+				continue
+			}
+		}
+
+		b.WriteString(html.EscapeString(rest[:1]))
+		i++
+	}
+	return b.String()
+}
+
+// renderEmphasis handles **strong**, *em*, __strong__, _em_ and ~~del~~
+// starting at s[i], returning the index after the closing delimiter.
+func renderEmphasis(b *strings.Builder, s string, i int) (int, bool) {
+	c := s[i]
+	run := 1
+	for i+run < len(s) && s[i+run] == c && run < 3 {
+		run++
+	}
+	if c == '~' && run != 2 {
+		return 0, false
+	}
+	// Intraword underscores (snake_case) are not emphasis.
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return 0, false
+	}
+	delim := s[i : i+run]
+	open := i + run
+	if open >= len(s) || s[open] == ' ' || s[open] == '\n' {
+		return 0, false
+	}
+	end := strings.Index(s[open:], delim)
+	for end >= 0 {
+		closeAt := open + end
+		after := closeAt + run
+		if s[closeAt-1] != ' ' && (c != '_' || after >= len(s) || !isWordByte(s[after])) && (after >= len(s) || s[after] != c) {
+			inner := renderInline(s[open:closeAt])
+			switch {
+			case c == '~':
+				b.WriteString("<del>" + inner + "</del>")
+			case run == 1:
+				b.WriteString("<em>" + inner + "</em>")
+			case run == 2:
+				b.WriteString("<strong>" + inner + "</strong>")
+			default:
+				b.WriteString("<strong><em>" + inner + "</em></strong>")
+			}
+			return after, true
+		}
+		next := strings.Index(s[closeAt+1:], delim)
+		if next < 0 {
+			break
+		}
+		end = closeAt + 1 + next - open
+	}
+	return 0, false
+}
+
+// parseLink parses "[text](dest)" or "[text](dest "title")" at the start of
+// s and returns the consumed length.
+func parseLink(s string) (text, dest string, n int, ok bool) {
+	depth := 0
+	closeText := -1
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				closeText = i
+			}
+		}
+		if closeText >= 0 {
+			break
+		}
+	}
+	if closeText < 0 || closeText+1 >= len(s) || s[closeText+1] != '(' {
+		return "", "", 0, false
+	}
+	end := strings.IndexByte(s[closeText+2:], ')')
+	if end < 0 {
+		return "", "", 0, false
+	}
+	inner := strings.TrimSpace(s[closeText+2 : closeText+2+end])
+	if sp := strings.IndexAny(inner, " \t"); sp >= 0 {
+		inner = inner[:sp]
+	}
+	inner = strings.TrimSuffix(strings.TrimPrefix(inner, "<"), ">")
+	return s[1:closeText], inner, closeText + 2 + end + 1, true
+}
+
+// safeURL accepts relative URLs and absolute URLs whose scheme is in
+// allowed, rejecting javascript:, data: and the like.
+func safeURL(raw string, allowed map[string]bool) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", false
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	if u.Scheme == "" {
+		// Browsers ignore control characters when sniffing a scheme, so a
+		// colon before any path separator is treated as suspicious.
+		if i := strings.IndexAny(raw, ":/?#"); i >= 0 && raw[i] == ':' {
+			return "", false
+		}
+		return raw, true
+	}
+	if !allowed[strings.ToLower(u.Scheme)] {
+		return "", false
+	}
+	return u.String(), true
+}
+
+func slugify(text string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case r >= 'a' && r <= 'z' || r >= '0' && r <= '9':
+			b.WriteRune(r)
+			dash = false
+		case r == ' ' || r == '-' || r == '_':
+			if !dash && b.Len() > 0 {
+				b.WriteByte('-')
+				dash = true
+			}
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
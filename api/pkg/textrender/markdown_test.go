@@ -0,0 +1,88 @@
+package textrender
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkdown_Blocks(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"heading with id", "## Getting Started", `<h2 id="getting-started">Getting Started</h2>` + "\n"},
+		{"paragraph joins lines", "one\ntwo", "<p>one\ntwo</p>\n"},
+		{"hard break", "one  \ntwo", "<p>one<br>\ntwo</p>\n"},
+		{"rule", "---", "<hr>\n"},
+		{"blockquote", "> quoted", "<blockquote>\n<p>quoted</p>\n</blockquote>\n"},
+		{"bullet list", "- a\n- b", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n"},
+		{"ordered list start", "3. c\n4. d", "<ol start=\"3\">\n<li>c</li>\n<li>d</li>\n</ol>\n"},
+		{"nested list", "- a\n  - b", "<ul>\n<li>a\n<ul>\n<li>b</li>\n</ul>\n</li>\n</ul>\n"},
+		{"task list", "- [x] done", "<ul>\n<li><input type=\"checkbox\" disabled checked> done</li>\n</ul>\n"},
+		{"fenced code", "```go\nfunc f() {}\n```", `<pre class="code"><code class="language-go"><span class="tok-kw">func</span> f() {}` + "\n</code></pre>\n"},
+		{"table", "| a | b |\n|:--|--:|\n| 1 | 2 |", "<table>\n<thead>\n<tr><th style=\"text-align:left\">a</th><th style=\"text-align:right\">b</th></tr>\n</thead>\n<tbody>\n<tr><td style=\"text-align:left\">1</td><td style=\"text-align:right\">2</td></tr>\n</tbody>\n</table>\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Markdown(tc.src); got != tc.want {
+				t.Fatalf("Markdown(%q)\n got: %q\nwant: %q", tc.src, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMarkdown_Inline(t *testing.T) {
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"**bold** and *em*", "<strong>bold</strong> and <em>em</em>"},
+		{"~~gone~~", "<del>gone</del>"},
+		{"snake_case_name stays", "snake_case_name stays"},
+		{"`a < b`", "<code>a &lt; b</code>"},
+		{`\*literal\*`, "*literal*"},
+		{"[docs](https://example.com/a?b=1&c=2)", `<a href="https://example.com/a?b=1&amp;c=2" rel="nofollow noopener noreferrer">docs</a>`},
+		{"[rel](./other.md)", `<a href="./other.md" rel="nofollow noopener noreferrer">rel</a>`},
+		{"<https://example.com>", `<a href="https://example.com" rel="nofollow noopener noreferrer">https://example.com</a>`},
+		{"![logo](https://example.com/l.png)", `<img src="https://example.com/l.png" alt="logo" loading="lazy">`},
+	}
+	for _, tc := range cases {
+		got := Markdown(tc.src)
+		want := "<p>" + tc.want + "</p>\n"
+		if got != want {
+			t.Errorf("Markdown(%q)\n got: %q\nwant: %q", tc.src, got, want)
+		}
+	}
+}
+
+func TestMarkdown_Sanitizes(t *testing.T) {
+	cases := []string{
+		`<script>alert(1)</script>`,
+		`<img src=x onerror=alert(1)>`,
+		`[click](javascript:alert(1))`,
+		`[click](JaVaScRiPt:alert(1))`,
+		`![x](data:image/svg+xml;base64,PHN2Zz4=)`,
+		`[x](vbscript:msgbox)`,
+		"```\n</code></pre><script>alert(1)</script>\n```",
+		`<javascript:alert(1)>`,
+		`[a](https://x.test/" onmouseover="alert(1))`,
+	}
+	for _, src := range cases {
+		out := Markdown(src)
+		lower := strings.ToLower(out)
+		// Escaped text may still mention these; only live markup counts.
+		for _, bad := range []string{"<script", "<img src=x", `href="javascript`, `href="vbscript`, `src="data`, `" onmouseover`} {
+			if strings.Contains(lower, bad) {
+				t.Errorf("Markdown(%q) leaked %q: %s", src, bad, out)
+			}
+		}
+	}
+}
+
+func TestMarkdown_DeepNestingTerminates(t *testing.T) {
+	src := strings.Repeat(">", 10000) + " deep"
+	if out := Markdown(src); !strings.Contains(out, "deep") {
+		t.Fatalf("expected content to survive, got %q", out)
+	}
+}
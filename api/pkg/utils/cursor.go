@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the decoded form of an opaque keyset pagination token. Value is
+// the sort key of the last row on the previous page, rendered as a string;
+// ID breaks ties between rows that share the same sort key.
+type Cursor struct {
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"id"`
+}
+
+// EncodeCursor serialises a cursor into a URL-safe token.
+func EncodeCursor(cur Cursor) string {
+	raw, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeCursor parses a token produced by EncodeCursor. An empty token
+// decodes to a nil cursor, meaning "start from the first page".
+func DecodeCursor(token string) (*Cursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cur Cursor
+	if err := json.Unmarshal(raw, &cur); err != nil || cur.ID == uuid.Nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cur, nil
+}
+
+// WantsCursor reports whether the client opted into keyset pagination by
+// sending a "cursor" query parameter, which may be empty for the first page.
+func WantsCursor(c *fiber.Ctx) bool {
+	return c.Context().QueryArgs().Has("cursor")
+}
+
+// ApplyKeyset restricts db to rows that come strictly after (value, id) when
+// ordered by "column direction, id direction". column must be a trusted
+// identifier, never client input.
+func ApplyKeyset(db *gorm.DB, column, direction string, value interface{}, id uuid.UUID) *gorm.DB {
+	op := ">"
+	if direction == "DESC" {
+		op = "<"
+	}
+	clause := fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, op)
+	return db.Where(clause, value, value, id)
+}
+
+// ParseTimeOrder reads the "order" query param for chronological listings.
+// Newest first is the default.
+func ParseTimeOrder(c *fiber.Ctx) string {
+	if strings.EqualFold(c.Query("order"), "asc") {
+		return "ASC"
+	}
+	return "DESC"
+}
+
+// TimeCursor builds a cursor for listings keyed on a timestamp column.
+func TimeCursor(t time.Time, id uuid.UUID) string {
+	return EncodeCursor(Cursor{Value: t.Format(time.RFC3339Nano), ID: id})
+}
+
+// ApplyTimeCursor is ApplyKeyset for cursors produced by TimeCursor. A nil
+// cursor leaves the query untouched.
+func ApplyTimeCursor(db *gorm.DB, column, direction string, cur *Cursor) (*gorm.DB, error) {
+	if cur == nil {
+		return db, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, cur.Value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return ApplyKeyset(db, column, direction, t, cur.ID), nil
+}
+
+// CursorPaginated writes a page of keyset-paginated results. nextCursor is
+// empty once the final page has been reached.
+func CursorPaginated(c *fiber.Ctx, data interface{}, limit int, nextCursor string) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    data,
+		"pagination": fiber.Map{
+			"limit":      limit,
+			"nextCursor": nextCursor,
+			"hasMore":    nextCursor != "",
+		},
+	})
+}
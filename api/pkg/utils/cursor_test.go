@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	in := Cursor{Value: "report 10.pdf", ID: uuid.New()}
+	token := EncodeCursor(in)
+
+	out, err := DecodeCursor(token)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if out == nil || *out != in {
+		t.Fatalf("expected %+v, got %+v", in, out)
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	cur, err := DecodeCursor("")
+	if err != nil || cur != nil {
+		t.Fatalf("expected empty token to decode to nil cursor, got %+v, %v", cur, err)
+	}
+
+	for _, token := range []string{"%%%", "bm90LWpzb24", EncodeCursor(Cursor{Value: "x"})} {
+		if _, err := DecodeCursor(token); err != ErrInvalidCursor {
+			t.Fatalf("expected ErrInvalidCursor for %q, got %v", token, err)
+		}
+	}
+}
+
+func TestFileSortApplyCursor(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{
+		DSN: "host=127.0.0.1 user=test password=test dbname=test port=5432 sslmode=disable",
+	}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create dry-run gorm db: %v", err)
+	}
+
+	file := models.File{Name: "a.txt", Size: 42}
+	file.UpdatedAt = time.Now()
+	file.ID = uuid.New()
+
+	cases := []struct {
+		sort FileSort
+		want string
+	}{
+		{FileSort{Column: "name", Direction: "ASC"}, "(name > $1 OR (name = $2 AND id > $3))"},
+		{FileSort{Column: "size", Direction: "DESC"}, "(size < $1 OR (size = $2 AND id < $3))"},
+		{FileSort{Column: "updated_at", Direction: "ASC"}, "(updated_at > $1 OR (updated_at = $2 AND id > $3))"},
+	}
+	for _, tc := range cases {
+		cur, err := DecodeCursor(tc.sort.CursorFor(file))
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		scoped, err := tc.sort.ApplyCursor(db.Table("files"), cur)
+		if err != nil {
+			t.Fatalf("apply cursor failed: %v", err)
+		}
+		stmt := scoped.Find(&[]models.File{}).Statement
+		if got := stmt.SQL.String(); !strings.Contains(got, tc.want) {
+			t.Fatalf("expected SQL to contain %q, got %q", tc.want, got)
+		}
+		if len(stmt.Vars) != 3 || stmt.Vars[2] != file.ID {
+			t.Fatalf("unexpected vars %v", stmt.Vars)
+		}
+	}
+
+	if _, err := (FileSort{Column: "size", Direction: "ASC"}).ApplyCursor(db, &Cursor{Value: "big", ID: file.ID}); err != ErrInvalidCursor {
+		t.Fatalf("expected ErrInvalidCursor for non-numeric size, got %v", err)
+	}
+}
+
+func TestFileSortKeysetClause(t *testing.T) {
+	got := FileSort{Column: "size", Direction: "DESC"}.KeysetClause()
+	if got != "size DESC, id DESC" {
+		t.Fatalf("unexpected keyset clause %q", got)
+	}
+}
+
+func TestApplyTimeCursor(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{
+		DSN: "host=127.0.0.1 user=test password=test dbname=test port=5432 sslmode=disable",
+	}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create dry-run gorm db: %v", err)
+	}
+
+	at := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)
+	id := uuid.New()
+	cur, err := DecodeCursor(TimeCursor(at, id))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+
+	scoped, err := ApplyTimeCursor(db.Table("activities"), "created_at", "DESC", cur)
+	if err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	stmt := scoped.Find(&[]map[string]any{}).Statement
+	if !strings.Contains(stmt.SQL.String(), "(created_at < $1 OR (created_at = $2 AND id < $3))") {
+		t.Fatalf("unexpected SQL %q", stmt.SQL.String())
+	}
+	if got, ok := stmt.Vars[0].(time.Time); !ok || !got.Equal(at) {
+		t.Fatalf("expected cursor time to round-trip with full precision, got %v", stmt.Vars[0])
+	}
+
+	if _, err := ApplyTimeCursor(db, "created_at", "ASC", &Cursor{Value: "yesterday", ID: id}); err != ErrInvalidCursor {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
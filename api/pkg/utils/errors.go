@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	fiberutils "github.com/gofiber/fiber/v2/utils"
+)
+
+// APIError is an error with the HTTP status and machine-readable code it
+// should be reported with. Code is part of the API contract and must stay
+// stable; Message is for humans and may change.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func NewError(status int, code, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// WithMessage returns a copy of e carrying a more specific message, for
+// errors whose text includes request details.
+func (e *APIError) WithMessage(message string) *APIError {
+	return &APIError{Status: e.Status, Code: e.Code, Message: message}
+}
+
+var statusCodes = map[int]string{
+	fiber.StatusBadRequest:            "bad_request",
+	fiber.StatusUnauthorized:          "unauthorized",
+	fiber.StatusForbidden:             "forbidden",
+	fiber.StatusNotFound:              "not_found",
+	fiber.StatusMethodNotAllowed:      "method_not_allowed",
+	fiber.StatusConflict:              "conflict",
+	fiber.StatusGone:                  "gone",
+	fiber.StatusLengthRequired:        "length_required",
+	fiber.StatusPreconditionFailed:    "precondition_failed",
+	fiber.StatusRequestEntityTooLarge: "payload_too_large",
+	fiber.StatusUnsupportedMediaType:  "unsupported_media_type",
+	fiber.StatusUnprocessableEntity:   "unprocessable_entity",
+	fiber.StatusLocked:                "locked",
+	fiber.StatusTooManyRequests:       "rate_limited",
+	fiber.StatusInternalServerError:   "internal_error",
+	fiber.StatusNotImplemented:        "not_implemented",
+	fiber.StatusBadGateway:            "bad_gateway",
+	fiber.StatusServiceUnavailable:    "service_unavailable",
+	fiber.StatusGatewayTimeout:        "gateway_timeout",
+}
+
+// CodeForStatus returns the generic error code used when a response has
+// no more specific one.
+func CodeForStatus(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if text := fiberutils.StatusMessage(status); text != "" {
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+		})
+		return strings.Join(words, "_")
+	}
+	if status >= fiber.StatusInternalServerError {
+		return "internal_error"
+	}
+	return "bad_request"
+}
+
+// ErrorHandler is a fiber.ErrorHandler that renders errors returned from
+// handlers, including Fiber's own routing errors and recovered panics, in
+// the standard envelope.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return Error(c, fiberErr.Code, fiberErr.Message)
+	}
+	return Fail(c, err)
+}
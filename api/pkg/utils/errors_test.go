@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCodeForStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{fiber.StatusNotFound, "not_found"},
+		{fiber.StatusTooManyRequests, "rate_limited"},
+		{fiber.StatusInternalServerError, "internal_error"},
+		{fiber.StatusExpectationFailed, "expectation_failed"},
+		{599, "internal_error"},
+	}
+	for _, tt := range tests {
+		if got := CodeForStatus(tt.status); got != tt.want {
+			t.Errorf("CodeForStatus(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestFailAndErrorHandler(t *testing.T) {
+	errWidgetMissing := NewError(fiber.StatusNotFound, "widget_not_found", "widget not found")
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals(RequestIDKey, "req-123")
+		return c.Next()
+	})
+	app.Get("/fail", func(c *fiber.Ctx) error {
+		return Fail(c, errWidgetMissing.WithMessage("widget 7 not found"))
+	})
+	app.Get("/wrapped", func(c *fiber.Ctx) error {
+		return Fail(c, fmt.Errorf("loading: %w", errWidgetMissing))
+	})
+	app.Get("/opaque", func(c *fiber.Ctx) error {
+		return Fail(c, errors.New("pq: connection refused"))
+	})
+	app.Get("/returned", func(c *fiber.Ctx) error {
+		return errWidgetMissing
+	})
+	app.Get("/teapot", func(c *fiber.Ctx) error {
+		return fiber.ErrTeapot
+	})
+
+	tests := []struct {
+		path    string
+		status  int
+		code    string
+		message string
+	}{
+		{"/fail", fiber.StatusNotFound, "widget_not_found", "widget 7 not found"},
+		{"/wrapped", fiber.StatusNotFound, "widget_not_found", "widget not found"},
+		{"/opaque", fiber.StatusInternalServerError, "internal_error", "internal server error"},
+		{"/returned", fiber.StatusNotFound, "widget_not_found", "widget not found"},
+		{"/teapot", fiber.StatusTeapot, "i_m_a_teapot", "I'm a teapot"},
+		{"/missing", fiber.StatusNotFound, "not_found", "Cannot GET /missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			body := performResponseTestRequest(t, app, tt.path)
+			if status := requireNumberField(t, body, "_statusCode"); status != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, status)
+			}
+			if body["code"] != tt.code || body["error"] != tt.message {
+				t.Fatalf("expected %s/%q, got %v/%v", tt.code, tt.message, body["code"], body["error"])
+			}
+			if body["requestID"] != "req-123" {
+				t.Fatalf("expected requestID req-123, got %v", body["requestID"])
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestWeakETag(t *testing.T) {
+	a := WeakETag("file", "1")
+	if a != WeakETag("file", "1") {
+		t.Fatal("expected identical parts to produce identical tags")
+	}
+	if a == WeakETag("file1") {
+		t.Fatal("expected part boundaries to affect the tag")
+	}
+	if a[:3] != `W/"` || a[len(a)-1] != '"' {
+		t.Fatalf("expected weak quoted tag, got %s", a)
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	etag := WeakETag("x")
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		if NotModified(c, etag) {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+		return c.SendString("body")
+	})
+
+	cases := []struct {
+		name        string
+		ifNoneMatch string
+		want        int
+	}{
+		{"no header", "", http.StatusOK},
+		{"exact match", etag, http.StatusNotModified},
+		{"strong form of weak tag", etag[2:], http.StatusNotModified},
+		{"list containing tag", `"other", ` + etag, http.StatusNotModified},
+		{"wildcard", "*", http.StatusNotModified},
+		{"mismatch", `W/"stale"`, http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.want {
+				t.Fatalf("expected %d, got %d", tc.want, resp.StatusCode)
+			}
+			if resp.Header.Get("ETag") != etag {
+				t.Fatalf("expected ETag header %s, got %s", etag, resp.Header.Get("ETag"))
+			}
+		})
+	}
+}
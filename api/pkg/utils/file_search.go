@@ -0,0 +1,339 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Search scopes select which files a search runs over.
+const (
+	SearchScopeOwned  = "owned"
+	SearchScopeShared = "shared"
+	SearchScopeAll    = "all"
+)
+
+// mimeCategories maps a user-facing category to MIME type patterns. A
+// pattern ending in "/", "." or "-" matches by prefix; anything else must
+// match exactly.
+var mimeCategories = map[string][]string{
+	"documents": {
+		"application/pdf",
+		"application/msword",
+		"application/rtf",
+		"application/vnd.ms-",
+		"application/vnd.openxmlformats-officedocument.",
+		"application/vnd.oasis.opendocument.",
+		"text/",
+	},
+	"images":   {"image/"},
+	"video":    {"video/"},
+	"audio":    {"audio/"},
+	"archives": {"application/zip", "application/x-tar", "application/gzip", "application/x-7z-compressed", "application/x-rar-compressed"},
+}
+
+// FileSearchFilters holds the structured filters accepted by file search.
+// Zero values mean "no constraint".
+type FileSearchFilters struct {
+	MimeTypes      []string
+	Category       string
+	MinSize        *int64
+	MaxSize        *int64
+	ModifiedAfter  *time.Time
+	ModifiedBefore *time.Time
+	OwnerID        *uuid.UUID
+	Languages      []string
+	Properties     []PropertyFilter
+	ReviewStatuses []models.ReviewStatus
+	Scope          string
+}
+
+// PropertyFilter matches files by a custom property. Value must equal the
+// file's value, ignoring case; Min and Max bound it, comparing as numbers
+// when the bound is a number and as text otherwise, which orders
+// YYYY-MM-DD dates correctly.
+type PropertyFilter struct {
+	Key   string
+	Value string
+	Min   string
+	Max   string
+}
+
+// ParseFileSearchFilters reads the structured search filters from the query
+// string. "type" takes a comma-separated list of MIME types, where "image/*"
+// or "image/" match a whole family, and "language" and "reviewStatus"
+// comma-separated lists of ISO 639-1 codes and review statuses.
+// "property.<key>" matches a custom property's value, and
+// "property.<key>.min" and "property.<key>.max" bound it. Dates accept RFC
+// 3339 timestamps or plain YYYY-MM-DD days; a plain modifiedBefore day is
+// inclusive of that whole day.
+func ParseFileSearchFilters(c *fiber.Ctx) (FileSearchFilters, error) {
+	var f FileSearchFilters
+
+	if raw := strings.TrimSpace(c.Query("type")); raw != "" {
+		for _, t := range strings.Split(raw, ",") {
+			t = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(t)), "*")
+			if t != "" {
+				f.MimeTypes = append(f.MimeTypes, t)
+			}
+		}
+	}
+
+	if raw := strings.ToLower(strings.TrimSpace(c.Query("category"))); raw != "" {
+		if _, ok := mimeCategories[raw]; !ok {
+			return f, fmt.Errorf("invalid category")
+		}
+		f.Category = raw
+	}
+
+	var err error
+	if f.MinSize, err = parseSizeParam(c.Query("minSize")); err != nil {
+		return f, fmt.Errorf("invalid minSize")
+	}
+	if f.MaxSize, err = parseSizeParam(c.Query("maxSize")); err != nil {
+		return f, fmt.Errorf("invalid maxSize")
+	}
+	if f.MinSize != nil && f.MaxSize != nil && *f.MinSize > *f.MaxSize {
+		return f, fmt.Errorf("minSize cannot exceed maxSize")
+	}
+
+	if f.ModifiedAfter, err = parseDateParam(c.Query("modifiedAfter"), false); err != nil {
+		return f, fmt.Errorf("invalid modifiedAfter")
+	}
+	if f.ModifiedBefore, err = parseDateParam(c.Query("modifiedBefore"), true); err != nil {
+		return f, fmt.Errorf("invalid modifiedBefore")
+	}
+
+	if raw := strings.TrimSpace(c.Query("ownerID")); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return f, fmt.Errorf("invalid ownerID")
+		}
+		f.OwnerID = &id
+	}
+
+	if raw := strings.TrimSpace(c.Query("language")); raw != "" {
+		for _, code := range strings.Split(raw, ",") {
+			code = strings.ToLower(strings.TrimSpace(code))
+			if code == "" {
+				continue
+			}
+			if !isLanguageCode(code) {
+				return f, fmt.Errorf("invalid language")
+			}
+			f.Languages = append(f.Languages, code)
+		}
+	}
+
+	if raw := strings.TrimSpace(c.Query("reviewStatus")); raw != "" {
+		for _, status := range strings.Split(raw, ",") {
+			switch status := models.ReviewStatus(strings.ToLower(strings.TrimSpace(status))); status {
+			case "":
+			case models.ReviewStatusDraft, models.ReviewStatusInReview, models.ReviewStatusApproved, models.ReviewStatusRejected:
+				f.ReviewStatuses = append(f.ReviewStatuses, status)
+			default:
+				return f, fmt.Errorf("invalid reviewStatus")
+			}
+		}
+	}
+
+	if f.Properties, err = parsePropertyFilters(c); err != nil {
+		return f, err
+	}
+
+	switch scope := strings.ToLower(strings.TrimSpace(c.Query("scope"))); scope {
+	case "", SearchScopeOwned:
+		f.Scope = SearchScopeOwned
+	case SearchScopeShared, SearchScopeAll:
+		f.Scope = scope
+	default:
+		return f, fmt.Errorf("invalid scope")
+	}
+
+	return f, nil
+}
+
+// HasConstraints reports whether any filter beyond the default scope is set.
+func (f FileSearchFilters) HasConstraints() bool {
+	return len(f.MimeTypes) > 0 || f.Category != "" ||
+		f.MinSize != nil || f.MaxSize != nil ||
+		f.ModifiedAfter != nil || f.ModifiedBefore != nil ||
+		f.OwnerID != nil || len(f.Languages) > 0 || len(f.Properties) > 0 || len(f.ReviewStatuses) > 0 ||
+		f.Scope != SearchScopeOwned
+}
+
+// Apply adds the filter conditions to db. Scope is not applied here because
+// resolving shared files needs knowledge of shares and group membership.
+func (f FileSearchFilters) Apply(db *gorm.DB) *gorm.DB {
+	if len(f.MimeTypes) > 0 {
+		db = applyMimePatterns(db, f.MimeTypes)
+	}
+	if f.Category != "" {
+		db = applyMimePatterns(db.Where("is_directory = ?", false), mimeCategories[f.Category])
+	}
+	if f.MinSize != nil {
+		db = db.Where("size >= ?", *f.MinSize)
+	}
+	if f.MaxSize != nil {
+		db = db.Where("size <= ?", *f.MaxSize)
+	}
+	if f.ModifiedAfter != nil {
+		db = db.Where("updated_at >= ?", *f.ModifiedAfter)
+	}
+	if f.ModifiedBefore != nil {
+		db = db.Where("updated_at < ?", *f.ModifiedBefore)
+	}
+	if f.OwnerID != nil {
+		db = db.Where("owner_id = ?", *f.OwnerID)
+	}
+	if len(f.Languages) > 0 {
+		db = db.Where("language IN ?", f.Languages)
+	}
+	if len(f.ReviewStatuses) > 0 {
+		// Files never sent for review have no status and count as drafts.
+		cond := "review_status IN ?"
+		for _, status := range f.ReviewStatuses {
+			if status == models.ReviewStatusDraft {
+				cond += " OR review_status IS NULL OR review_status = ''"
+			}
+		}
+		db = db.Where("is_directory = ?", false).Where("("+cond+")", f.ReviewStatuses)
+	}
+	for _, p := range f.Properties {
+		conds := []string{"key = ?", "deleted_at IS NULL"}
+		args := []interface{}{p.Key}
+		if p.Value != "" {
+			conds = append(conds, "LOWER(value) = ?")
+			args = append(args, strings.ToLower(p.Value))
+		}
+		for _, bound := range []struct{ value, op string }{{p.Min, ">="}, {p.Max, "<="}} {
+			if bound.value == "" {
+				continue
+			}
+			if n, err := strconv.ParseFloat(bound.value, 64); err == nil {
+				conds = append(conds, "number "+bound.op+" ?")
+				args = append(args, n)
+			} else {
+				conds = append(conds, "value "+bound.op+" ?")
+				args = append(args, bound.value)
+			}
+		}
+		db = db.Where("id IN (SELECT file_id FROM file_properties WHERE "+strings.Join(conds, " AND ")+")", args...)
+	}
+	return db
+}
+
+// parsePropertyFilters collects the property.<key> parameters, one filter
+// per key, in key order.
+func parsePropertyFilters(c *fiber.Ctx) ([]PropertyFilter, error) {
+	byKey := map[string]*PropertyFilter{}
+	var bad string
+	c.Context().QueryArgs().VisitAll(func(k, v []byte) {
+		name, ok := strings.CutPrefix(string(k), "property.")
+		value := strings.TrimSpace(string(v))
+		if !ok || value == "" || bad != "" {
+			return
+		}
+		key, field := name, ""
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			key, field = name[:i], name[i+1:]
+		}
+		if !isPropertyKey(key) || (field != "" && field != "min" && field != "max") {
+			bad = name
+			return
+		}
+		p := byKey[key]
+		if p == nil {
+			p = &PropertyFilter{Key: key}
+			byKey[key] = p
+		}
+		switch field {
+		case "min":
+			p.Min = value
+		case "max":
+			p.Max = value
+		default:
+			p.Value = value
+		}
+	})
+	if bad != "" {
+		return nil, fmt.Errorf("invalid property filter %q", bad)
+	}
+	out := make([]PropertyFilter, 0, len(byKey))
+	for _, p := range byKey {
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// isPropertyKey reports whether key could name a custom property.
+func isPropertyKey(key string) bool {
+	if key == "" || len(key) > 64 || key[0] < 'a' || key[0] > 'z' {
+		return false
+	}
+	for _, r := range key {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// isLanguageCode reports whether code looks like a two-letter ISO 639-1
+// code.
+func isLanguageCode(code string) bool {
+	return len(code) == 2 && code[0] >= 'a' && code[0] <= 'z' && code[1] >= 'a' && code[1] <= 'z'
+}
+
+func applyMimePatterns(db *gorm.DB, patterns []string) *gorm.DB {
+	conds := make([]string, 0, len(patterns))
+	args := make([]interface{}, 0, len(patterns))
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "/") || strings.HasSuffix(p, ".") || strings.HasSuffix(p, "-") {
+			conds = append(conds, "LOWER(mime_type) LIKE ?")
+			args = append(args, p+"%")
+		} else {
+			conds = append(conds, "LOWER(mime_type) = ?")
+			args = append(args, p)
+		}
+	}
+	return db.Where("("+strings.Join(conds, " OR ")+")", args...)
+}
+
+func parseSizeParam(raw string) (*int64, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid size %q", raw)
+	}
+	return &n, nil
+}
+
+func parseDateParam(raw string, endOfDay bool) (*time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docshare/api/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func parseFileSearchFiltersForTest(t *testing.T, query string) (FileSearchFilters, error) {
+	t.Helper()
+
+	var (
+		filters  FileSearchFilters
+		parseErr error
+	)
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		filters, parseErr = ParseFileSearchFilters(c)
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/?%s", query), nil)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	return filters, parseErr
+}
+
+func TestParseFileSearchFilters(t *testing.T) {
+	f, err := parseFileSearchFiltersForTest(t, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Scope != SearchScopeOwned || f.HasConstraints() {
+		t.Fatalf("expected default owned scope with no constraints, got %+v", f)
+	}
+
+	f, err = parseFileSearchFiltersForTest(t, "type=Image/*,application/pdf&category=documents&minSize=10&maxSize=20&modifiedAfter=2024-01-01&modifiedBefore=2024-01-31&language=DE,fr&reviewStatus=In_Review,approved&scope=shared")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(f.MimeTypes) != 2 || f.MimeTypes[0] != "image/" || f.MimeTypes[1] != "application/pdf" {
+		t.Fatalf("unexpected mime types %v", f.MimeTypes)
+	}
+	if f.Category != "documents" || *f.MinSize != 10 || *f.MaxSize != 20 || f.Scope != SearchScopeShared {
+		t.Fatalf("unexpected filters %+v", f)
+	}
+	if len(f.Languages) != 2 || f.Languages[0] != "de" || f.Languages[1] != "fr" {
+		t.Fatalf("unexpected languages %v", f.Languages)
+	}
+	if len(f.ReviewStatuses) != 2 || f.ReviewStatuses[0] != models.ReviewStatusInReview || f.ReviewStatuses[1] != models.ReviewStatusApproved {
+		t.Fatalf("unexpected review statuses %v", f.ReviewStatuses)
+	}
+	if got := f.ModifiedBefore.Format("2006-01-02"); got != "2024-02-01" {
+		t.Fatalf("expected plain modifiedBefore date to include the whole day, got %s", got)
+	}
+	if !f.HasConstraints() {
+		t.Fatal("expected constraints to be reported")
+	}
+
+	f, err = parseFileSearchFiltersForTest(t, "property.client=Acme&property.review_date.min=2024-01-01&property.review_date.max=2024-06-30&property.budget.min=")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(f.Properties) != 2 || !f.HasConstraints() {
+		t.Fatalf("expected two property filters, got %+v", f.Properties)
+	}
+	if p := f.Properties[0]; p.Key != "client" || p.Value != "Acme" {
+		t.Fatalf("unexpected client filter %+v", p)
+	}
+	if p := f.Properties[1]; p.Key != "review_date" || p.Min != "2024-01-01" || p.Max != "2024-06-30" || p.Value != "" {
+		t.Fatalf("unexpected review_date filter %+v", p)
+	}
+
+	invalid := map[string]string{
+		"category=spreadsheets":     "invalid category",
+		"minSize=-1":                "invalid minSize",
+		"maxSize=huge":              "invalid maxSize",
+		"minSize=10&maxSize=5":      "minSize cannot exceed maxSize",
+		"modifiedAfter=yesterday":   "invalid modifiedAfter",
+		"modifiedBefore=2024-13-01": "invalid modifiedBefore",
+		"ownerID=nope":              "invalid ownerID",
+		"scope=everyone":            "invalid scope",
+		"language=german":           "invalid language",
+		"reviewStatus=cancelled":    "invalid reviewStatus",
+		"property.Client=Acme":      `invalid property filter "Client"`,
+		"property.budget.avg=10":    `invalid property filter "budget.avg"`,
+	}
+	for query, want := range invalid {
+		if _, err := parseFileSearchFiltersForTest(t, query); err == nil || err.Error() != want {
+			t.Fatalf("query %q: expected error %q, got %v", query, want, err)
+		}
+	}
+}
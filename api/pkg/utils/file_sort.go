@@ -3,10 +3,13 @@ package utils
 import (
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docshare/api/internal/models"
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 // FileSort describes how a file/folder listing should be ordered.
@@ -40,6 +43,55 @@ func (f FileSort) SQLClause() string {
 	return fmt.Sprintf("is_directory DESC, %s %s, name ASC", f.Column, f.Direction)
 }
 
+// KeysetClause returns the ORDER BY fragment used with cursor pagination.
+// Folders are not grouped first here: the keyset is (column, id) so that
+// every page boundary can be expressed as a single row comparison.
+func (f FileSort) KeysetClause() string {
+	return fmt.Sprintf("%s %s, id %s", f.Column, f.Direction, f.Direction)
+}
+
+// ApplyCursor restricts db to rows that sort strictly after cur under
+// KeysetClause ordering. A nil cursor leaves the query untouched.
+func (f FileSort) ApplyCursor(db *gorm.DB, cur *Cursor) (*gorm.DB, error) {
+	if cur == nil {
+		return db, nil
+	}
+
+	var value interface{}
+	switch f.Column {
+	case "size":
+		n, err := strconv.ParseInt(cur.Value, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		value = n
+	case "updated_at":
+		t, err := time.Parse(time.RFC3339Nano, cur.Value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		value = t
+	default:
+		value = cur.Value
+	}
+
+	return ApplyKeyset(db, f.Column, f.Direction, value, cur.ID), nil
+}
+
+// CursorFor builds the cursor that resumes a listing after file.
+func (f FileSort) CursorFor(file models.File) string {
+	var value string
+	switch f.Column {
+	case "size":
+		value = strconv.FormatInt(file.Size, 10)
+	case "updated_at":
+		value = file.UpdatedAt.Format(time.RFC3339Nano)
+	default:
+		value = file.Name
+	}
+	return EncodeCursor(Cursor{Value: value, ID: file.ID})
+}
+
 // compareNatural compares two strings byte-by-byte, but treats consecutive
 // digit runs as numbers so that "file2" sorts before "file10". Leading zeros
 // don't change numeric value but break ties (so "file2" < "file02").
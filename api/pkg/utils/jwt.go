@@ -5,33 +5,46 @@ import (
 	"time"
 
 	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/keyring"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-var (
-	jwtSecret          = []byte("change-me-in-production")
-	jwtExpirationHours = 24
-)
+var jwtExpirationHours = 24
 
 type Claims struct {
 	UserID uuid.UUID       `json:"userID"`
 	Email  string          `json:"email"`
 	Role   models.UserRole `json:"role"`
+	// SessionID names the sessions row the token was issued for. Tokens
+	// issued without a session leave it empty.
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// ConfigureJWT sets the environment signing key and the session lifetime.
+// Keys added later through the admin API take over signing from it.
 func ConfigureJWT(secret string, expirationHours int) {
 	if secret != "" {
-		jwtSecret = []byte(secret)
+		keyring.SetEnvKey([]byte(secret))
 	}
 	if expirationHours > 0 {
 		jwtExpirationHours = expirationHours
 	}
 }
 
+// TokenLifetime is how long tokens from GenerateToken stay valid.
+func TokenLifetime() time.Duration {
+	return time.Duration(jwtExpirationHours) * time.Hour
+}
+
 func GenerateToken(user *models.User) (string, error) {
-	expiresAt := time.Now().Add(time.Duration(jwtExpirationHours) * time.Hour)
+	return GenerateSessionToken(user, uuid.Nil)
+}
+
+// GenerateSessionToken is GenerateToken for a token bound to a session.
+func GenerateSessionToken(user *models.User, sessionID uuid.UUID) (string, error) {
+	expiresAt := time.Now().Add(TokenLifetime())
 	claims := Claims{
 		UserID: user.ID,
 		Email:  user.Email,
@@ -43,17 +56,15 @@ func GenerateToken(user *models.User) (string, error) {
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	if sessionID != uuid.Nil {
+		claims.SessionID = sessionID.String()
+	}
+
+	return signWithCurrentKey(claims)
 }
 
 func ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method")
-		}
-		return jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, signingKey)
 	if err != nil {
 		return nil, err
 	}
@@ -65,3 +76,26 @@ func ValidateToken(tokenString string) (*Claims, error) {
 
 	return claims, nil
 }
+
+// signWithCurrentKey signs claims with the newest key, naming it in the
+// token's kid header.
+func signWithCurrentKey(claims jwt.Claims) (string, error) {
+	key := keyring.Current()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Secret)
+}
+
+// signingKey finds the key named by a token's kid header. Tokens without
+// one predate key IDs and were signed with the environment key.
+func signingKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method")
+	}
+	kid, _ := token.Header["kid"].(string)
+	secret, ok := keyring.Lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key")
+	}
+	return secret, nil
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/docshare/api/internal/models"
+	"github.com/docshare/api/pkg/keyring"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
@@ -15,22 +16,28 @@ import (
 func configureJWTForTest(t *testing.T, secret string, expirationHours int) {
 	t.Helper()
 
-	originalSecret := append([]byte(nil), jwtSecret...)
+	originalSecret := envSecret()
 	originalExpiration := jwtExpirationHours
 
 	t.Cleanup(func() {
-		jwtSecret = originalSecret
+		keyring.SetEnvKey(originalSecret)
+		keyring.SetStoredKeys(nil, false)
 		jwtExpirationHours = originalExpiration
 	})
 
 	ConfigureJWT(secret, expirationHours)
 }
 
+func envSecret() []byte {
+	secret, _ := keyring.Lookup(keyring.EnvKeyID)
+	return secret
+}
+
 func TestConfigureJWT(t *testing.T) {
 	t.Run("updates secret and expiration when valid values are provided", func(t *testing.T) {
 		configureJWTForTest(t, "test-secret", 72)
 
-		if got := string(jwtSecret); got != "test-secret" {
+		if got := string(envSecret()); got != "test-secret" {
 			t.Fatalf("expected jwt secret to be %q, got %q", "test-secret", got)
 		}
 		if jwtExpirationHours != 72 {
@@ -43,7 +50,7 @@ func TestConfigureJWT(t *testing.T) {
 
 		ConfigureJWT("", 0)
 
-		if got := string(jwtSecret); got != "initial-secret" {
+		if got := string(envSecret()); got != "initial-secret" {
 			t.Fatalf("expected jwt secret to remain %q, got %q", "initial-secret", got)
 		}
 		if jwtExpirationHours != 24 {
@@ -103,7 +110,7 @@ func TestGenerateAndValidateToken(t *testing.T) {
 			},
 		}
 
-		expiredToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, expiredClaims).SignedString(jwtSecret)
+		expiredToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, expiredClaims).SignedString(envSecret())
 		if err != nil {
 			t.Fatalf("failed to sign expired token for test: %v", err)
 		}
@@ -148,3 +155,43 @@ func TestGenerateAndValidateToken(t *testing.T) {
 		}
 	})
 }
+
+func TestTokenKeyRotation(t *testing.T) {
+	configureJWTForTest(t, "env-secret", 1)
+	user := &models.User{BaseModel: models.BaseModel{ID: uuid.New()}, Email: "user@example.com"}
+
+	oldToken, err := GenerateToken(user)
+	if err != nil {
+		t.Fatalf("failed generating token: %v", err)
+	}
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: user.ID}).SignedString(envSecret())
+	if err != nil {
+		t.Fatalf("failed signing token without a key ID: %v", err)
+	}
+
+	keyring.SetStoredKeys([]keyring.Key{{ID: "k2", Secret: []byte("second-secret")}}, false)
+	newToken, err := GenerateToken(user)
+	if err != nil {
+		t.Fatalf("failed generating token: %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &Claims{})
+	if err != nil || parsed.Header["kid"] != "k2" {
+		t.Fatalf("expected the newest key to sign, got header %v", parsed.Header)
+	}
+	for _, token := range []string{oldToken, legacy, newToken} {
+		if _, err := ValidateToken(token); err != nil {
+			t.Fatalf("expected every active key to validate, got %v", err)
+		}
+	}
+
+	keyring.SetStoredKeys([]keyring.Key{{ID: "k2", Secret: []byte("second-secret")}}, true)
+	if _, err := ValidateToken(oldToken); err == nil {
+		t.Fatal("expected a token from a retired key to be refused")
+	}
+	if _, err := ValidateToken(legacy); err == nil {
+		t.Fatal("expected a token without a key ID to be refused once the environment key is retired")
+	}
+	if _, err := ValidateToken(newToken); err != nil {
+		t.Fatalf("expected the remaining key to validate, got %v", err)
+	}
+}
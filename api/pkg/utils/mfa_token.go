@@ -35,17 +35,11 @@ func GenerateMFAToken(userID uuid.UUID, email string) (string, error) {
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return signWithCurrentKey(claims)
 }
 
 func ValidateMFAToken(tokenString string) (*MFAClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &MFAClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method")
-		}
-		return jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &MFAClaims{}, signingKey)
 	if err != nil {
 		return nil, err
 	}
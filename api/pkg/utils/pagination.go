@@ -2,18 +2,34 @@ package utils
 
 import (
 	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
 
+// UnpaginatedLimit caps a listing requested with limit=0.
+const UnpaginatedLimit = 1000
+
+// unpaginatedDeprecatedAt is when limit=0 was deprecated.
+var unpaginatedDeprecatedAt = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+
 type PaginationParams struct {
 	Page   int
 	Limit  int
 	Offset int
 }
 
+// ParsePagination reads ?page= and ?limit=. limit=0 asks for the whole
+// listing in one page, up to UnpaginatedLimit items, for clients written
+// when list endpoints returned plain arrays; it is deprecated and marked
+// so in the response.
 func ParsePagination(c *fiber.Ctx) PaginationParams {
+	if c.Query("limit") == "0" {
+		c.Set("Deprecation", "@"+strconv.FormatInt(unpaginatedDeprecatedAt.Unix(), 10))
+		return PaginationParams{Page: 1, Limit: UnpaginatedLimit}
+	}
+
 	page := parseIntDefault(c.Query("page"), 1)
 	limit := parseIntDefault(c.Query("limit"), 20)
 
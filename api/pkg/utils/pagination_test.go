@@ -58,7 +58,8 @@ func TestParsePagination(t *testing.T) {
 		{name: "uses explicit page and limit", query: "page=2&limit=10", wantPage: 2, wantLimit: 10, wantOffset: 10},
 		{name: "normalizes page less than one", query: "page=0&limit=10", wantPage: 1, wantLimit: 10, wantOffset: 0},
 		{name: "normalizes invalid page string", query: "page=abc&limit=10", wantPage: 1, wantLimit: 10, wantOffset: 0},
-		{name: "normalizes limit less than one", query: "page=3&limit=0", wantPage: 3, wantLimit: 20, wantOffset: 40},
+		{name: "normalizes limit less than one", query: "page=3&limit=-1", wantPage: 3, wantLimit: 20, wantOffset: 40},
+		{name: "limit zero returns everything", query: "page=3&limit=0", wantPage: 1, wantLimit: UnpaginatedLimit, wantOffset: 0},
 		{name: "caps limit above maximum", query: "page=1&limit=500", wantPage: 1, wantLimit: 100, wantOffset: 0},
 		{name: "normalizes invalid limit string", query: "page=4&limit=abc", wantPage: 4, wantLimit: 20, wantOffset: 60},
 	}
@@ -80,6 +81,25 @@ func TestParsePagination(t *testing.T) {
 	}
 }
 
+func TestParsePaginationUnpaginatedIsDeprecated(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		ParsePagination(c)
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	for query, deprecated := range map[string]bool{"limit=0": true, "limit=10": false, "": false} {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/?"+query, nil), -1)
+		if err != nil {
+			t.Fatalf("request failed for query %q: %v", query, err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("Deprecation") != ""; got != deprecated {
+			t.Fatalf("query %q: expected deprecated=%v, got Deprecation %q", query, deprecated, resp.Header.Get("Deprecation"))
+		}
+	}
+}
+
 func TestApplyPagination(t *testing.T) {
 	db, err := gorm.Open(postgres.New(postgres.Config{
 		DSN: "host=127.0.0.1 user=test password=test dbname=test port=5432 sslmode=disable",
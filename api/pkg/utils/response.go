@@ -1,6 +1,49 @@
 package utils
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"context"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequestIDKey is the fiber.Ctx local holding the current request's ID.
+const RequestIDKey = "requestID"
+
+// RequestID returns the ID assigned to the current request, or "" when no
+// request ID middleware ran.
+func RequestID(c *fiber.Ctx) string {
+	if rid, ok := c.Locals(RequestIDKey).(string); ok {
+		return rid
+	}
+	return ""
+}
+
+type requestInfoKey struct{}
+
+// RequestInfo identifies the request a context belongs to, for code such as
+// the database query log that is handed a context.Context rather than the
+// fiber.Ctx.
+type RequestInfo struct {
+	ID     string
+	Method string
+	Path   string
+}
+
+// SetRequestInfo attaches info to both c.Context() and c.UserContext().
+func SetRequestInfo(c *fiber.Ctx, info RequestInfo) {
+	c.Locals(requestInfoKey{}, info)
+	c.SetUserContext(context.WithValue(c.UserContext(), requestInfoKey{}, info))
+}
+
+// RequestInfoFromContext returns the request ctx was derived from, if any.
+func RequestInfoFromContext(ctx context.Context) (RequestInfo, bool) {
+	if ctx == nil {
+		return RequestInfo{}, false
+	}
+	info, ok := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info, ok
+}
 
 func Success(c *fiber.Ctx, status int, data interface{}) error {
 	return c.Status(status).JSON(fiber.Map{
@@ -9,11 +52,34 @@ func Success(c *fiber.Ctx, status int, data interface{}) error {
 	})
 }
 
+// Error writes an error envelope with the generic code for status. Use Fail
+// with an *APIError when clients need to tell this error apart from others
+// with the same status.
 func Error(c *fiber.Ctx, status int, message string) error {
-	return c.Status(status).JSON(fiber.Map{
+	return writeError(c, status, CodeForStatus(status), message)
+}
+
+// Fail writes err as an error envelope. An *APIError anywhere in err's
+// chain supplies the status, code and message; anything else is reported
+// as an internal error without exposing its text.
+func Fail(c *fiber.Ctx, err error) error {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return writeError(c, apiErr.Status, apiErr.Code, apiErr.Message)
+	}
+	return writeError(c, fiber.StatusInternalServerError, CodeForStatus(fiber.StatusInternalServerError), "internal server error")
+}
+
+func writeError(c *fiber.Ctx, status int, code, message string) error {
+	body := fiber.Map{
 		"success": false,
 		"error":   message,
-	})
+		"code":    code,
+	}
+	if rid := RequestID(c); rid != "" {
+		body["requestID"] = rid
+	}
+	return c.Status(status).JSON(body)
 }
 
 func Paginated(c *fiber.Ctx, data interface{}, page, limit int, total int64) error {
@@ -100,6 +100,12 @@ func TestResponseHelpers(t *testing.T) {
 		if body["error"] != "invalid input" {
 			t.Fatalf("expected error message %q, got %v", "invalid input", body["error"])
 		}
+		if body["code"] != "bad_request" {
+			t.Fatalf("expected generic code %q, got %v", "bad_request", body["code"])
+		}
+		if _, ok := body["requestID"]; ok {
+			t.Fatalf("expected no requestID without request ID middleware, got %v", body["requestID"])
+		}
 	})
 
 	t.Run("Paginated returns data and pagination metadata", func(t *testing.T) {
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docshare/cli/internal/api"
+	"github.com/docshare/cli/internal/output"
+	"github.com/docshare/cli/internal/pathutil"
+	"github.com/spf13/cobra"
+)
+
+var archiveCmd = &cobra.Command{
+	Use:   "archive <path>",
+	Short: "Move a file or folder to cold storage",
+	Long: `Move a file, or everything in a folder, to cold storage. Archived files
+stay listed with their metadata, but cannot be downloaded until restored.
+The move happens on the server in the background.
+
+  docshare archive /Projects/2019
+  docshare restore /Projects/2019              Ask for it back`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeArgs(argRemote),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireAuth(); err != nil {
+			return err
+		}
+
+		fileID, err := pathutil.Resolve(apiClient, args[0])
+		if err != nil {
+			return err
+		}
+		if fileID == "" {
+			return fmt.Errorf("cannot archive root directory")
+		}
+
+		var resp api.Response[struct {
+			Files int64 `json:"files"`
+		}]
+		if err := apiClient.Post("/files/"+fileID+"/archive", nil, &resp); err != nil {
+			return fmt.Errorf("archiving: %w", err)
+		}
+
+		output.Emit(map[string]interface{}{"id": fileID, "files": resp.Data.Files}, []string{fileID}, func() {
+			fmt.Printf("Archiving %d file(s) from %s\n", resp.Data.Files, args[0])
+		})
+		return nil
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <path>",
+	Short: "Bring an archived file or folder back from cold storage",
+	Long: `Request a restore of an archived file, or of the archived files in a
+folder. Restores from cold storage take time; the command prints when the
+files are expected to be downloadable again.
+
+  docshare restore /Projects/2019`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeArgs(argRemote),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireAuth(); err != nil {
+			return err
+		}
+
+		fileID, err := pathutil.Resolve(apiClient, args[0])
+		if err != nil {
+			return err
+		}
+		if fileID == "" {
+			return fmt.Errorf("cannot restore root directory")
+		}
+
+		var resp api.Response[api.ArchiveRestore]
+		if err := apiClient.Post("/files/"+fileID+"/archive/restore", nil, &resp); err != nil {
+			return fmt.Errorf("requesting restore: %w", err)
+		}
+
+		restore := resp.Data
+		output.Emit(restore, []string{fileID}, func() {
+			fmt.Printf("Restoring %d file(s); expected by %s\n", restore.Files, restore.ETA.Local().Format(time.RFC3339))
+		})
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(archiveCmd)
+	rootCmd.AddCommand(restoreCmd)
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/docshare/cli/internal/api"
+	"github.com/docshare/cli/internal/config"
+	"github.com/docshare/cli/internal/pathutil"
+	"github.com/spf13/cobra"
+)
+
+// argCompletion says how to complete one positional argument.
+type argCompletion int
+
+const (
+	argNone argCompletion = iota
+	argRemote
+	argRemoteFolder
+	argLocal
+	argLocalDir
+)
+
+// completeArgs completes each positional argument as the matching kind.
+// Remote paths are listed from the server one folder at a time, so
+// "/Documents/Re<TAB>" lists /Documents and offers the names starting with
+// "Re".
+func completeArgs(kinds ...argCompletion) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		if len(args) >= len(kinds) {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		switch kinds[len(args)] {
+		case argRemote:
+			return completeRemotePath(toComplete, false)
+		case argRemoteFolder:
+			return completeRemotePath(toComplete, true)
+		case argLocal:
+			return nil, cobra.ShellCompDirectiveDefault
+		case argLocalDir:
+			return nil, cobra.ShellCompDirectiveFilterDirs
+		}
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+func completeRemotePath(toComplete string, foldersOnly bool) ([]cobra.Completion, cobra.ShellCompDirective) {
+	client := completionClient()
+	if client == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	dir, prefix := "", toComplete
+	if i := strings.LastIndex(toComplete, "/"); i >= 0 {
+		dir, prefix = toComplete[:i+1], toComplete[i+1:]
+	}
+	parentID, err := pathutil.Resolve(client, dir)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	children, err := pathutil.List(client, parentID)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var completions []cobra.Completion
+	directive := cobra.ShellCompDirectiveNoFileComp
+	for _, f := range children {
+		if foldersOnly && !f.IsDirectory {
+			continue
+		}
+		if !strings.HasPrefix(strings.ToLower(f.Name), strings.ToLower(prefix)) {
+			continue
+		}
+		name := dir + f.Name
+		if f.IsDirectory {
+			// No trailing space, so the next TAB descends into the folder.
+			name += "/"
+			directive |= cobra.ShellCompDirectiveNoSpace
+		}
+		completions = append(completions, name)
+	}
+	return completions, directive
+}
+
+// completionClient builds a client for completion requests, which skip
+// the usual setup in PersistentPreRunE. It returns nil when not logged in.
+func completionClient() *api.Client {
+	c, err := config.Load()
+	if err != nil || !c.HasToken() {
+		return nil
+	}
+	if flagServerURL != "" {
+		c.ServerURL = flagServerURL
+	}
+	return api.NewClient(c.ServerURL, c.Token)
+}
@@ -7,11 +7,21 @@ import (
 	"path/filepath"
 
 	"github.com/docshare/cli/internal/api"
+	"github.com/docshare/cli/internal/output"
 	"github.com/docshare/cli/internal/pathutil"
+	"github.com/docshare/cli/internal/vault"
 	"github.com/spf13/cobra"
 )
 
-var flagOutput string
+var flagOutputFile string
+
+// downloadedFile is one entry in the --output json result of a download.
+type downloadedFile struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
 
 var downloadCmd = &cobra.Command{
 	Use:   "download <remote-path> [local-dir]",
@@ -22,12 +32,13 @@ var downloadCmd = &cobra.Command{
   docshare download /Documents/report.pdf ./out     Download to specific directory
   docshare download /Projects                       Download directory recursively
   docshare download <uuid>                          Download by file ID`,
-	Args: cobra.RangeArgs(1, 2),
-	RunE: runDownload,
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: completeArgs(argRemote, argLocalDir),
+	RunE:              runDownload,
 }
 
 func init() {
-	downloadCmd.Flags().StringVarP(&flagOutput, "output", "o", "", "Output file path (overrides default naming)")
+	downloadCmd.Flags().StringVarP(&flagOutputFile, "output-file", "o", "", "Output file path (overrides default naming)")
 	rootCmd.AddCommand(downloadCmd)
 }
 
@@ -58,13 +69,25 @@ func runDownload(cmd *cobra.Command, args []string) error {
 
 	f := resp.Data
 
+	downloaded := []downloadedFile{}
 	if f.IsDirectory {
-		return downloadDirectory(f, destDir)
+		err = downloadDirectory(f, destDir, &downloaded)
+	} else {
+		err = downloadFile(f, destDir, &downloaded)
+	}
+	if err != nil {
+		return err
 	}
-	return downloadFile(f, destDir)
+
+	paths := make([]string, len(downloaded))
+	for i, d := range downloaded {
+		paths[i] = d.Path
+	}
+	output.Emit(map[string]interface{}{"files": downloaded}, paths, func() {})
+	return nil
 }
 
-func downloadFile(f api.File, destDir string) error {
+func downloadFile(f api.File, destDir string, downloaded *[]downloadedFile) error {
 	// Get presigned download URL for efficiency.
 	var dlResp api.Response[api.DownloadURLResponse]
 	if err := apiClient.Get("/files/"+f.ID+"/download-url", nil, &dlResp); err != nil {
@@ -72,8 +95,8 @@ func downloadFile(f api.File, destDir string) error {
 	}
 
 	dest := filepath.Join(destDir, f.Name)
-	if flagOutput != "" {
-		dest = flagOutput
+	if flagOutputFile != "" {
+		dest = flagOutputFile
 	}
 
 	// Ensure destination directory exists.
@@ -81,20 +104,43 @@ func downloadFile(f api.File, destDir string) error {
 		return fmt.Errorf("creating directory: %w", err)
 	}
 
-	if err := apiClient.DownloadToFile(dlResp.Data.URL, dest); err != nil {
+	if f.VaultID != nil {
+		if err := downloadEncrypted(dlResp.Data.URL, dest, *f.VaultID); err != nil {
+			return err
+		}
+	} else if err := apiClient.DownloadToFile(dlResp.Data.URL, dest); err != nil {
 		return fmt.Errorf("downloading: %w", err)
 	}
 
-	fmt.Printf("Downloaded %s → %s\n", f.Name, dest)
+	output.Infof("Downloaded %s → %s\n", f.Name, dest)
+	*downloaded = append(*downloaded, downloadedFile{ID: f.ID, Name: f.Name, Path: dest, Size: f.Size})
+	return nil
+}
+
+// downloadEncrypted downloads a file from an encrypted folder and
+// decrypts it into dest.
+func downloadEncrypted(rawURL, dest, vaultID string) error {
+	key, err := folderKey(vaultID)
+	if err != nil {
+		return err
+	}
+	sealed := dest + ".encrypted"
+	if err := apiClient.DownloadToFile(rawURL, sealed); err != nil {
+		return fmt.Errorf("downloading: %w", err)
+	}
+	defer os.Remove(sealed)
+	if err := sealFile(dest, sealed, key, vault.Decrypt); err != nil {
+		return fmt.Errorf("decrypting: %w", err)
+	}
 	return nil
 }
 
-func downloadDirectory(f api.File, destDir string) error {
+func downloadDirectory(f api.File, destDir string, downloaded *[]downloadedFile) error {
 	localDir := filepath.Join(destDir, f.Name)
 	if err := os.MkdirAll(localDir, 0755); err != nil {
 		return fmt.Errorf("creating directory: %w", err)
 	}
-	fmt.Printf("Created directory: %s\n", localDir)
+	output.Infof("Created directory: %s\n", localDir)
 
 	page := 1
 	for {
@@ -109,11 +155,11 @@ func downloadDirectory(f api.File, destDir string) error {
 
 		for _, child := range resp.Data {
 			if child.IsDirectory {
-				if err := downloadDirectory(child, localDir); err != nil {
+				if err := downloadDirectory(child, localDir, downloaded); err != nil {
 					fmt.Fprintf(os.Stderr, "  Failed: %s — %v\n", child.Name, err)
 				}
 			} else {
-				if err := downloadFile(child, localDir); err != nil {
+				if err := downloadFile(child, localDir, downloaded); err != nil {
 					fmt.Fprintf(os.Stderr, "  Failed: %s — %v\n", child.Name, err)
 				}
 			}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/docshare/cli/internal/api"
+	"github.com/docshare/cli/internal/pathutil"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes. Scripts can rely on these staying the same.
+const (
+	ExitOK           = 0
+	ExitError        = 1
+	ExitUsage        = 2
+	ExitAuth         = 3
+	ExitForbidden    = 4
+	ExitNotFound     = 5
+	ExitServer       = 6
+	ExitNetwork      = 7
+	unknownCmdPrefix = "unknown command"
+)
+
+var (
+	errNotAuthenticated = errors.New(`not authenticated — run "docshare login" first`)
+	errNotFound         = errors.New("not found")
+)
+
+// usageError marks bad arguments or flags.
+type usageError struct{ err error }
+
+func (e usageError) Error() string { return e.err.Error() }
+func (e usageError) Unwrap() error { return e.err }
+
+// ExitCode maps an error returned by Execute to the process exit code.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	var usage usageError
+	if errors.As(err, &usage) || strings.HasPrefix(err.Error(), unknownCmdPrefix) {
+		return ExitUsage
+	}
+	if errors.Is(err, errNotAuthenticated) {
+		return ExitAuth
+	}
+	if errors.Is(err, errNotFound) || errors.Is(err, pathutil.ErrNotFound) {
+		return ExitNotFound
+	}
+
+	var apiErr *api.APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Status == http.StatusUnauthorized:
+			return ExitAuth
+		case apiErr.Status == http.StatusForbidden:
+			return ExitForbidden
+		case apiErr.Status == http.StatusNotFound:
+			return ExitNotFound
+		case apiErr.Status >= 500:
+			return ExitServer
+		}
+		return ExitError
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ExitNetwork
+	}
+	return ExitError
+}
+
+// errorJSON is what --output json prints to stderr when a command fails.
+type errorJSON struct {
+	Error struct {
+		Message   string `json:"message"`
+		Code      string `json:"code,omitempty"`
+		Status    int    `json:"status,omitempty"`
+		RequestID string `json:"requestID,omitempty"`
+		ExitCode  int    `json:"exitCode"`
+	} `json:"error"`
+}
+
+func newErrorJSON(err error) errorJSON {
+	var out errorJSON
+	out.Error.Message = err.Error()
+	out.Error.ExitCode = ExitCode(err)
+	var apiErr *api.APIError
+	if errors.As(err, &apiErr) {
+		out.Error.Code = apiErr.Code
+		out.Error.Status = apiErr.Status
+		out.Error.RequestID = apiErr.RequestID
+	}
+	return out
+}
+
+// markUsageErrors wraps every command's argument validation so that bad
+// arguments exit with ExitUsage.
+func markUsageErrors(c *cobra.Command) {
+	if c.Args != nil {
+		validate := c.Args
+		c.Args = func(cmd *cobra.Command, args []string) error {
+			if err := validate(cmd, args); err != nil {
+				return usageError{err}
+			}
+			return nil
+		}
+	}
+	for _, sub := range c.Commands() {
+		markUsageErrors(sub)
+	}
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/docshare/cli/internal/api"
+	"github.com/docshare/cli/internal/pathutil"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, ExitOK},
+		{"plain error", errors.New("boom"), ExitError},
+		{"bad arguments", usageError{errors.New("accepts 1 arg(s), received 0")}, ExitUsage},
+		{"unknown command", errors.New(`unknown command "frob" for "docshare"`), ExitUsage},
+		{"not logged in", errNotAuthenticated, ExitAuth},
+		{"unauthorized", fmt.Errorf("listing files: %w", &api.APIError{Status: 401}), ExitAuth},
+		{"forbidden", &api.APIError{Status: 403}, ExitForbidden},
+		{"missing file", &api.APIError{Status: 404}, ExitNotFound},
+		{"missing path", fmt.Errorf("resolving source: %w", fmt.Errorf("%w: Docs", pathutil.ErrNotFound)), ExitNotFound},
+		{"missing user", fmt.Errorf("user %w: a@b.c", errNotFound), ExitNotFound},
+		{"server error", &api.APIError{Status: 502}, ExitServer},
+		{"conflict", &api.APIError{Status: 409}, ExitError},
+		{"unreachable", &url.Error{Op: "Get", URL: "http://localhost", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, ExitNetwork},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docshare/cli/internal/api"
+	"github.com/docshare/cli/internal/output"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagImportS3     string
+	flagImportPath   string
+	flagImportOwner  string
+	flagImportRules  []string
+	flagImportTarget string
+	flagImportWait   bool
+)
+
+const importPollInterval = 5 * time.Second
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import existing files from a bucket or directory (platform admins)",
+	Long: `Bring an existing S3 bucket prefix or a directory mounted on the server
+into DocShare. Imports run in the background on the server and can be
+cancelled and resumed.
+
+  docshare import start --s3 legacy-docs/shared --owner it@example.com
+  docshare import start --path /mnt/nas/projects --rule finance=cfo@example.com --wait
+  docshare import status <id>
+  docshare import list`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+var importStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start an import",
+	Long: `Start an import from --s3 <bucket>[/<prefix>] or --path <directory>.
+
+Folders are recreated under --target (default "Imported") in each owner's
+root. Files go to --owner (default: you) unless a --rule gives their path
+to someone else; the longest matching prefix wins.
+
+  docshare import start --s3 legacy-docs
+  docshare import start --path /mnt/nas --target NAS --rule hr=hr@example.com --rule finance=cfo@example.com`,
+	Args: cobra.NoArgs,
+	RunE: runImportStart,
+}
+
+var importStatusCmd = &cobra.Command{
+	Use:   "status <id>",
+	Short: "Show an import's progress",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireAuth(); err != nil {
+			return err
+		}
+		if flagImportWait {
+			job, err := waitForImport(args[0])
+			if err != nil {
+				return err
+			}
+			emitImport(job)
+			return nil
+		}
+		job, err := getImport(args[0])
+		if err != nil {
+			return err
+		}
+		emitImport(job)
+		return nil
+	},
+}
+
+var importListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List imports",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireAuth(); err != nil {
+			return err
+		}
+
+		var resp api.Response[[]api.ImportJob]
+		if err := apiClient.Get("/admin/imports", nil, &resp); err != nil {
+			return fmt.Errorf("listing imports: %w", err)
+		}
+
+		ids := make([]string, len(resp.Data))
+		for i, job := range resp.Data {
+			ids[i] = job.ID
+		}
+		output.Emit(resp.Data, ids, func() {
+			if len(resp.Data) == 0 {
+				fmt.Println("No imports")
+				return
+			}
+			for _, job := range resp.Data {
+				fmt.Printf("  %s  %-9s  %s  %d files (%s)\n", job.ID, job.Status, importSource(job), job.FilesImported, output.FormatSize(job.BytesImported))
+			}
+		})
+		return nil
+	},
+}
+
+var importCancelCmd = &cobra.Command{
+	Use:   "cancel <id>",
+	Short: "Cancel a pending or running import",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runImportAction(args[0], "cancel")
+	},
+}
+
+var importResumeCmd = &cobra.Command{
+	Use:   "resume <id>",
+	Short: "Resume a failed or cancelled import from where it stopped",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runImportAction(args[0], "resume")
+	},
+}
+
+func runImportStart(cmd *cobra.Command, args []string) error {
+	if err := requireAuth(); err != nil {
+		return err
+	}
+
+	source := map[string]string{}
+	switch {
+	case flagImportS3 != "" && flagImportPath != "":
+		return fmt.Errorf("use either --s3 or --path, not both")
+	case flagImportS3 != "":
+		bucket, prefix, _ := strings.Cut(strings.TrimPrefix(flagImportS3, "s3://"), "/")
+		source["type"] = "s3"
+		source["bucket"] = bucket
+		source["prefix"] = prefix
+	case flagImportPath != "":
+		source["type"] = "filesystem"
+		source["path"] = flagImportPath
+	default:
+		return fmt.Errorf("--s3 or --path is required")
+	}
+
+	rules := make([]map[string]string, 0, len(flagImportRules))
+	for _, rule := range flagImportRules {
+		prefix, owner, ok := strings.Cut(rule, "=")
+		if !ok || prefix == "" || owner == "" {
+			return fmt.Errorf("invalid --rule %q, expected prefix=email", rule)
+		}
+		rules = append(rules, map[string]string{"prefix": prefix, "owner": owner})
+	}
+
+	body := map[string]interface{}{
+		"source":       source,
+		"targetFolder": flagImportTarget,
+		"defaultOwner": flagImportOwner,
+		"rules":        rules,
+	}
+	var resp api.Response[api.ImportJob]
+	if err := apiClient.Post("/admin/imports", body, &resp, api.WithIdempotencyKey(api.NewIdempotencyKey())); err != nil {
+		return fmt.Errorf("starting import: %w", err)
+	}
+
+	job := resp.Data
+	if flagImportWait {
+		output.Infof("Import %s started\n", job.ID)
+		waited, err := waitForImport(job.ID)
+		if err != nil {
+			return err
+		}
+		job = waited
+	}
+	emitImport(job)
+	return nil
+}
+
+func runImportAction(id, action string) error {
+	if err := requireAuth(); err != nil {
+		return err
+	}
+
+	var resp api.Response[api.ImportJob]
+	if err := apiClient.Post("/admin/imports/"+id+"/"+action, nil, &resp); err != nil {
+		return fmt.Errorf("%s import: %w", action, err)
+	}
+	emitImport(resp.Data)
+	return nil
+}
+
+func getImport(id string) (api.ImportJob, error) {
+	var resp api.Response[api.ImportJob]
+	if err := apiClient.Get("/admin/imports/"+id, nil, &resp); err != nil {
+		return api.ImportJob{}, fmt.Errorf("loading import: %w", err)
+	}
+	return resp.Data, nil
+}
+
+// waitForImport polls until the import stops running, reporting progress
+// as it goes.
+func waitForImport(id string) (api.ImportJob, error) {
+	for {
+		job, err := getImport(id)
+		if err != nil {
+			return job, err
+		}
+		if job.Status != "pending" && job.Status != "running" {
+			return job, nil
+		}
+		output.Infof("%s: %d files, %s imported, %d skipped, %d failed\n", job.Status, job.FilesImported, output.FormatSize(job.BytesImported), job.FilesSkipped, job.FilesFailed)
+		time.Sleep(importPollInterval)
+	}
+}
+
+func emitImport(job api.ImportJob) {
+	output.Emit(job, []string{job.ID}, func() {
+		fmt.Printf("Import %s (%s)\n", job.ID, job.Status)
+		fmt.Printf("  Source:   %s\n", importSource(job))
+		fmt.Printf("  Target:   %s\n", job.TargetFolder)
+		fmt.Printf("  Imported: %d files, %d folders, %s\n", job.FilesImported, job.FoldersCreated, output.FormatSize(job.BytesImported))
+		if job.FilesSkipped > 0 {
+			fmt.Printf("  Skipped:  %d already present\n", job.FilesSkipped)
+		}
+		if job.FilesFailed > 0 {
+			fmt.Printf("  Failed:   %d\n", job.FilesFailed)
+			for _, f := range job.Failures {
+				fmt.Printf("    %s: %s\n", f.Key, f.Error)
+			}
+		}
+		if job.LastError != "" {
+			fmt.Printf("  Error:    %s\n", job.LastError)
+		}
+	})
+}
+
+func importSource(job api.ImportJob) string {
+	if job.SourceType == "s3" {
+		return "s3://" + job.Source + "/" + job.Prefix
+	}
+	return job.Source
+}
+
+func init() {
+	importStartCmd.Flags().StringVar(&flagImportS3, "s3", "", "Source bucket and optional prefix, e.g. legacy-docs/shared")
+	importStartCmd.Flags().StringVar(&flagImportPath, "path", "", "Source directory on the server")
+	importStartCmd.Flags().StringVar(&flagImportOwner, "owner", "", "Email of the user who owns files no rule matches (default: you)")
+	importStartCmd.Flags().StringArrayVar(&flagImportRules, "rule", nil, "Give a source path to a user, as prefix=email (repeatable)")
+	importStartCmd.Flags().StringVar(&flagImportTarget, "target", "", "Folder to import into, in each owner's root (default: Imported)")
+	importStartCmd.Flags().BoolVar(&flagImportWait, "wait", false, "Wait for the import to finish, printing progress")
+	importStatusCmd.Flags().BoolVar(&flagImportWait, "wait", false, "Wait for the import to finish, printing progress")
+
+	importCmd.AddCommand(importStartCmd, importStatusCmd, importListCmd, importCancelCmd, importResumeCmd)
+	rootCmd.AddCommand(importCmd)
+}
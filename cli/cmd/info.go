@@ -10,9 +10,10 @@ import (
 )
 
 var infoCmd = &cobra.Command{
-	Use:   "info <path>",
-	Short: "Show details for a file or directory",
-	Args:  cobra.ExactArgs(1),
+	Use:               "info <path>",
+	Short:             "Show details for a file or directory",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeArgs(argRemote),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if err := requireAuth(); err != nil {
 			return err
@@ -31,12 +32,7 @@ var infoCmd = &cobra.Command{
 			return fmt.Errorf("fetching file info: %w", err)
 		}
 
-		if flagJSON {
-			output.JSON(resp.Data)
-			return nil
-		}
-
-		output.FileDetail(resp.Data)
+		output.Emit(resp.Data, []string{resp.Data.ID}, func() { output.FileDetail(resp.Data) })
 		return nil
 	},
 }
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/docshare/cli/internal/api"
+	"github.com/docshare/cli/internal/config"
+	"github.com/docshare/cli/internal/output"
+	"github.com/docshare/cli/internal/vault"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagKeyName  string
+	flagKeyForce bool
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys <generate/list/delete>",
+	Short: "Manage the keys that open encrypted folders",
+	Long: `Manage the keys that open encrypted folders.
+
+Files in an encrypted folder are encrypted on your machine before upload.
+Each machine keeps its own private key; the server only has the public
+half, which others use to share encrypted folders with you.
+
+  docshare keys generate                Create and register a key for this machine
+  docshare keys list                    List your registered keys
+  docshare keys delete <id>             Unregister a key`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+var keysGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Create and register a key for this machine",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireAuth(); err != nil {
+			return err
+		}
+		path, err := config.KeyPath()
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); err == nil && !flagKeyForce {
+			return fmt.Errorf("%s already holds a key; --force replaces it, and encrypted folders shared only with it can no longer be opened", path)
+		}
+
+		id, err := vault.NewIdentity()
+		if err != nil {
+			return err
+		}
+		public, err := id.PublicKey()
+		if err != nil {
+			return err
+		}
+		name := flagKeyName
+		if name == "" {
+			name, _ = os.Hostname()
+		}
+		if name == "" {
+			name = "docshare-cli"
+		}
+
+		var resp api.Response[api.UserKey]
+		if err := apiClient.Post("/auth/me/keys", map[string]interface{}{"name": name, "publicKey": public}, &resp); err != nil {
+			return fmt.Errorf("registering key: %w", err)
+		}
+		id.KeyID = resp.Data.ID
+		if err := vault.SaveIdentity(path, id); err != nil {
+			return fmt.Errorf("saving key: %w", err)
+		}
+
+		output.Emit(resp.Data, []string{resp.Data.ID}, func() {
+			fmt.Printf("Registered key %s (fingerprint %s)\n", resp.Data.Name, resp.Data.Fingerprint)
+			fmt.Printf("Private key saved to %s — back it up; without it this machine's encrypted folders cannot be opened.\n", path)
+		})
+		return nil
+	},
+}
+
+var keysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List your registered keys",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireAuth(); err != nil {
+			return err
+		}
+		var resp api.Response[[]api.UserKey]
+		if err := apiClient.Get("/auth/me/keys", nil, &resp); err != nil {
+			return fmt.Errorf("listing keys: %w", err)
+		}
+
+		local := ""
+		if id, err := loadIdentity(); err == nil {
+			local = id.KeyID
+		}
+		ids := make([]string, len(resp.Data))
+		for i, k := range resp.Data {
+			ids[i] = k.ID
+		}
+		output.Emit(resp.Data, ids, func() {
+			if len(resp.Data) == 0 {
+				fmt.Println("No keys registered. Run `docshare keys generate` to create one.")
+				return
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tFINGERPRINT\tCREATED\t")
+			for _, k := range resp.Data {
+				this := ""
+				if k.ID == local {
+					this = "(this machine)"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, k.Fingerprint, output.RelativeTime(k.CreatedAt), this)
+			}
+			w.Flush()
+		})
+		return nil
+	},
+}
+
+var keysDeleteCmd = &cobra.Command{
+	Use:   "delete <id>",
+	Short: "Unregister a key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireAuth(); err != nil {
+			return err
+		}
+		if err := apiClient.Delete("/auth/me/keys/"+args[0], nil); err != nil {
+			return fmt.Errorf("deleting key: %w", err)
+		}
+		output.Infof("Deleted key %s\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	keysGenerateCmd.Flags().StringVar(&flagKeyName, "name", "", "Name for the key (default: this machine's hostname)")
+	keysGenerateCmd.Flags().BoolVar(&flagKeyForce, "force", false, "Replace the key already saved on this machine")
+
+	keysCmd.AddCommand(keysGenerateCmd)
+	keysCmd.AddCommand(keysListCmd)
+	keysCmd.AddCommand(keysDeleteCmd)
+	rootCmd.AddCommand(keysCmd)
+}
+
+// loadIdentity returns this machine's vault key.
+func loadIdentity() (*vault.Identity, error) {
+	path, err := config.KeyPath()
+	if err != nil {
+		return nil, err
+	}
+	id, err := vault.LoadIdentity(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no key on this machine — run `docshare keys generate` first")
+	}
+	return id, err
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/docshare/cli/internal/api"
+	"github.com/docshare/cli/internal/output"
+	"github.com/docshare/cli/internal/pathutil"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagLinkExpires    string
+	flagLinkPermission string
+	flagLinkReplace    bool
+	flagLinkQR         string
+	flagLinkQRSize     int
+)
+
+var linkCmd = &cobra.Command{
+	Use:   "link <path>",
+	Short: "Get a public link to a file",
+	Long: `Create an expiring public link to a file or directory and print its URL.
+Running it again prints the same link until it expires.
+
+  docshare link /Documents/report.pdf                  Link valid for 7 days
+  docshare link /Documents/report.pdf --expires 24h    Link valid for a day
+  docshare link /Documents/report.pdf --replace        Revoke the old link, make a new one
+  docshare link /Documents/report.pdf --qr report.png  Also save a QR code of the link (.png or .svg)
+  docshare link /Documents/report.pdf -o quiet | pbcopy`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeArgs(argRemote),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireAuth(); err != nil {
+			return err
+		}
+
+		fileID, err := pathutil.Resolve(apiClient, args[0])
+		if err != nil {
+			return err
+		}
+		if fileID == "" {
+			return fmt.Errorf("cannot share root directory")
+		}
+
+		body := map[string]interface{}{"replace": flagLinkReplace}
+		if flagLinkExpires != "" {
+			body["expiresIn"] = flagLinkExpires
+		}
+		if flagLinkPermission != "" {
+			body["permission"] = flagLinkPermission
+		}
+
+		var resp api.Response[api.QuickShare]
+		if err := apiClient.Post("/files/"+fileID+"/quick-share", body, &resp, api.WithIdempotencyKey(api.NewIdempotencyKey())); err != nil {
+			return fmt.Errorf("creating link: %w", err)
+		}
+
+		link := resp.Data
+		if flagLinkQR != "" {
+			params := url.Values{"format": {qrFormat(flagLinkQR)}}
+			if flagLinkQRSize > 0 {
+				params.Set("size", strconv.Itoa(flagLinkQRSize))
+			}
+			if err := apiClient.GetToFile("/files/"+fileID+"/quick-share/qr", params, flagLinkQR); err != nil {
+				return fmt.Errorf("saving QR code: %w", err)
+			}
+		}
+		output.Emit(link, []string{link.URL}, func() {
+			fmt.Println(link.URL)
+			if flagLinkQR != "" {
+				fmt.Printf("QR code saved to %s\n", flagLinkQR)
+			}
+			if link.ExpiresAt != nil {
+				fmt.Printf("Expires %s (%s permission)\n", *link.ExpiresAt, link.Share.Permission)
+			}
+			if !link.Created {
+				fmt.Println("This link already existed; use --replace for a new one.")
+			}
+		})
+		return nil
+	},
+}
+
+func init() {
+	linkCmd.Flags().StringVar(&flagLinkExpires, "expires", "", "How long the link stays valid, e.g. 24h or 30 (days); default 7 days")
+	linkCmd.Flags().StringVar(&flagLinkPermission, "permission", "", "Permission level: view or download (default: download)")
+	linkCmd.Flags().BoolVar(&flagLinkReplace, "replace", false, "Revoke the current link and create a new one")
+	linkCmd.Flags().StringVar(&flagLinkQR, "qr", "", "Save a QR code of the link to this file; SVG when it ends in .svg, PNG otherwise")
+	linkCmd.Flags().IntVar(&flagLinkQRSize, "qr-size", 0, "QR code width in pixels, 64 to 2048 (default 256)")
+	_ = linkCmd.RegisterFlagCompletionFunc("permission", cobra.FixedCompletions(
+		[]string{"view", "download"}, cobra.ShellCompDirectiveNoFileComp,
+	))
+	rootCmd.AddCommand(linkCmd)
+}
+
+// qrFormat picks the QR code format from the file name being written.
+func qrFormat(dest string) string {
+	if strings.EqualFold(filepath.Ext(dest), ".svg") {
+		return "svg"
+	}
+	return "png"
+}
@@ -1,15 +1,20 @@
 package cmd
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/url"
+	"os"
 	"os/exec"
 	"runtime"
 	"time"
 
 	"github.com/docshare/cli/internal/api"
 	"github.com/docshare/cli/internal/config"
+	"github.com/docshare/cli/internal/output"
 	"github.com/spf13/cobra"
 )
 
@@ -58,25 +63,34 @@ func loginWithToken(token string) error {
 		return fmt.Errorf("saving config: %w", err)
 	}
 
-	fmt.Printf("Logged in as %s %s (%s)\n", resp.Data.FirstName, resp.Data.LastName, resp.Data.Email)
+	printLoggedIn(resp.Data)
 	return nil
 }
 
 func loginDeviceFlow() error {
 	client := api.NewClient(cfg.ServerURL, "")
 
-	// Step 1: Request a device code.
+	// Step 1: Request a device code, bound to a verifier only this process
+	// knows so nobody else can redeem it.
+	verifier, challenge, err := newCodeVerifier()
+	if err != nil {
+		return fmt.Errorf("generating code verifier: %w", err)
+	}
+
 	var deviceResp api.DeviceCodeResponse
 	values := url.Values{
-		"client_id": {"docshare-cli"},
+		"client_id":             {"docshare-cli"},
+		"client_name":           {deviceClientName()},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
 	}
 	if err := client.PostForm("/auth/device/code", values, &deviceResp); err != nil {
 		return fmt.Errorf("requesting device code: %w", err)
 	}
 
-	fmt.Printf("Opening browser to complete authentication...\n")
-	fmt.Printf("If the browser doesn't open, visit:\n  %s\n\n", deviceResp.VerificationURIComplete)
-	fmt.Printf("Your code: %s\n\n", deviceResp.UserCode)
+	output.Noticef("Opening browser to complete authentication...\n")
+	output.Noticef("If the browser doesn't open, visit:\n  %s\n\n", deviceResp.VerificationURIComplete)
+	output.Noticef("Your code: %s\n\n", deviceResp.UserCode)
 
 	_ = openBrowser(deviceResp.VerificationURIComplete)
 
@@ -87,15 +101,16 @@ func loginDeviceFlow() error {
 	}
 	deadline := time.Now().Add(time.Duration(deviceResp.ExpiresIn) * time.Second)
 
-	fmt.Print("Waiting for approval...")
+	output.Noticef("Waiting for approval...")
 
 	for time.Now().Before(deadline) {
 		time.Sleep(interval)
 
 		pollValues := url.Values{
-			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
-			"device_code": {deviceResp.DeviceCode},
-			"client_id":   {"docshare-cli"},
+			"grant_type":    {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code":   {deviceResp.DeviceCode},
+			"client_id":     {"docshare-cli"},
+			"code_verifier": {verifier},
 		}
 
 		var tokenResp api.DeviceTokenResponse
@@ -105,25 +120,25 @@ func loginDeviceFlow() error {
 			if errors.As(err, &apiErr) {
 				switch {
 				case apiErr.Status == 400 && (apiErr.Message == "authorization_pending" || apiErr.Message == "the user has not yet approved"):
-					fmt.Print(".")
+					output.Noticef(".")
 					continue
-				case apiErr.Status == 400 && apiErr.Message == "slow_down":
+				case apiErr.Message == "slow_down" || apiErr.Message == "polling too frequently":
 					interval += 5 * time.Second
 					continue
-				case apiErr.Message == "the device code has expired" || apiErr.Message == "expired_token":
-					fmt.Println()
+				case apiErr.Message == "the device code has expired" || apiErr.Message == "the approval has expired" || apiErr.Message == "expired_token":
+					output.Noticef("\n")
 					return fmt.Errorf("device code expired — please try again")
 				case apiErr.Message == "the user denied the request" || apiErr.Message == "access_denied":
-					fmt.Println()
+					output.Noticef("\n")
 					return fmt.Errorf("authorization denied")
 				}
 			}
-			fmt.Println()
+			output.Noticef("\n")
 			return fmt.Errorf("polling for token: %w", err)
 		}
 
 		if tokenResp.AccessToken != "" {
-			fmt.Println(" approved!")
+			output.Noticef(" approved!\n")
 
 			cfg.Token = tokenResp.AccessToken
 			if err := config.Save(cfg); err != nil {
@@ -134,18 +149,47 @@ func loginDeviceFlow() error {
 			authClient := api.NewClient(cfg.ServerURL, tokenResp.AccessToken)
 			var meResp api.Response[api.User]
 			if err := authClient.Get("/auth/me", nil, &meResp); err == nil {
-				fmt.Printf("Logged in as %s %s (%s)\n", meResp.Data.FirstName, meResp.Data.LastName, meResp.Data.Email)
+				printLoggedIn(meResp.Data)
 			} else {
-				fmt.Println("Logged in successfully.")
+				output.Emit(map[string]bool{"loggedIn": true}, nil, func() {
+					fmt.Println("Logged in successfully.")
+				})
 			}
 			return nil
 		}
 	}
 
-	fmt.Println()
+	output.Noticef("\n")
 	return fmt.Errorf("device code expired — please try again")
 }
 
+func printLoggedIn(u api.User) {
+	output.Emit(u, []string{u.ID}, func() {
+		fmt.Printf("Logged in as %s %s (%s)\n", u.FirstName, u.LastName, u.Email)
+	})
+}
+
+// newCodeVerifier returns an RFC 7636 code verifier and its S256 challenge.
+func newCodeVerifier() (verifier, challenge string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// deviceClientName is shown on the approval screen so the user can recognise
+// the machine asking for access.
+func deviceClientName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "DocShare CLI"
+	}
+	return "DocShare CLI on " + host
+}
+
 func openBrowser(url string) error {
 	var cmd *exec.Cmd
 	switch runtime.GOOS {
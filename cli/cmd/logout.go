@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/docshare/cli/internal/config"
+	"github.com/docshare/cli/internal/output"
 	"github.com/spf13/cobra"
 )
 
@@ -14,7 +15,9 @@ var logoutCmd = &cobra.Command{
 		if err := config.Clear(); err != nil {
 			return fmt.Errorf("clearing config: %w", err)
 		}
-		fmt.Println("Logged out.")
+		output.Emit(map[string]bool{"loggedOut": true}, nil, func() {
+			fmt.Println("Logged out.")
+		})
 		return nil
 	},
 }
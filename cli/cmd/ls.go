@@ -23,7 +23,8 @@ var lsCmd = &cobra.Command{
   docshare ls                       List root
   docshare ls /Documents            List by path
   docshare ls 550e8400-...          List by folder ID`,
-	Args: cobra.MaximumNArgs(1),
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeArgs(argRemote),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if err := requireAuth(); err != nil {
 			return err
@@ -57,12 +58,7 @@ var lsCmd = &cobra.Command{
 			return fmt.Errorf("listing files: %w", err)
 		}
 
-		if flagJSON {
-			output.JSON(resp.Data)
-			return nil
-		}
-
-		output.FileTable(resp.Data)
+		output.Emit(resp.Data, fileIDs(resp.Data), func() { output.FileTable(resp.Data) })
 		return nil
 	},
 }
@@ -72,3 +68,12 @@ func init() {
 	lsCmd.Flags().StringVar(&flagOrder, "order", "", "Sort order: asc, desc")
 	rootCmd.AddCommand(lsCmd)
 }
+
+// fileIDs collects the IDs printed for a file listing in quiet mode.
+func fileIDs(files []api.File) []string {
+	ids := make([]string, len(files))
+	for i, f := range files {
+		ids[i] = f.ID
+	}
+	return ids
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docshare/cli/internal/api"
+	"github.com/docshare/cli/internal/output"
+	"github.com/spf13/cobra"
+)
+
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror",
+	Short: "Check the offsite storage mirror (platform admins)",
+	Long: `Show how far the offsite storage mirror is behind, or queue a backfill
+that copies everything the mirror is missing.
+
+  docshare mirror status
+  docshare mirror backfill`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+var mirrorStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the mirror's backlog and lag",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireAuth(); err != nil {
+			return err
+		}
+
+		var resp api.Response[api.MirrorStatus]
+		if err := apiClient.Get("/admin/storage/mirror", nil, &resp); err != nil {
+			return fmt.Errorf("loading mirror status: %w", err)
+		}
+
+		status := resp.Data
+		output.Emit(status, nil, func() {
+			if !status.Enabled {
+				fmt.Println("No storage mirror is configured")
+				return
+			}
+			fmt.Printf("Pending:  %d objects\n", status.Pending)
+			fmt.Printf("Lag:      %s\n", time.Duration(status.LagSeconds)*time.Second)
+			if status.LastMirroredAt != nil {
+				fmt.Printf("Last:     %s\n", status.LastMirroredAt.Local().Format(time.RFC3339))
+			}
+			if status.Failed > 0 {
+				fmt.Printf("Failed:   %d objects (see the failed jobs list)\n", status.Failed)
+			}
+			deletes := "kept in the mirror"
+			if status.Deletes {
+				deletes = "mirrored"
+			}
+			fmt.Printf("Deletes:  %s\n", deletes)
+			if status.Backfill != nil {
+				fmt.Printf("Backfill: %s (queued %s)\n", status.Backfill.Status, status.Backfill.CreatedAt.Local().Format(time.RFC3339))
+			}
+		})
+		return nil
+	},
+}
+
+var mirrorBackfillCmd = &cobra.Command{
+	Use:   "backfill",
+	Short: "Copy everything the mirror is missing",
+	Long: `Queue a backfill on the server. It compares the primary bucket with the
+mirror and queues every object that is missing or out of date. Run it after
+enabling the mirror on an existing installation, and after an import.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireAuth(); err != nil {
+			return err
+		}
+
+		var resp api.Response[api.Job]
+		if err := apiClient.Post("/admin/storage/mirror/backfill", nil, &resp); err != nil {
+			return fmt.Errorf("starting backfill: %w", err)
+		}
+
+		job := resp.Data
+		output.Emit(job, []string{job.ID}, func() {
+			fmt.Printf("Backfill queued (job %s). Follow it with: docshare mirror status\n", job.ID)
+		})
+		return nil
+	},
+}
+
+func init() {
+	mirrorCmd.AddCommand(mirrorStatusCmd, mirrorBackfillCmd)
+	rootCmd.AddCommand(mirrorCmd)
+}
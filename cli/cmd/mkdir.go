@@ -8,9 +8,12 @@ import (
 	"github.com/docshare/cli/internal/api"
 	"github.com/docshare/cli/internal/output"
 	"github.com/docshare/cli/internal/pathutil"
+	"github.com/docshare/cli/internal/vault"
 	"github.com/spf13/cobra"
 )
 
+var flagMkdirVault bool
+
 var mkdirCmd = &cobra.Command{
 	Use:   "mkdir <name> [parent-path]",
 	Short: "Create a new directory",
@@ -18,8 +21,14 @@ var mkdirCmd = &cobra.Command{
 
   docshare mkdir "My Documents"                    Create in root
   docshare mkdir Reports /Documents                Create inside a folder
-  docshare mkdir Reports --parent <uuid>           Create inside a folder by ID`,
-	Args: cobra.RangeArgs(1, 2),
+  docshare mkdir Reports --parent <uuid>           Create inside a folder by ID
+  docshare mkdir Private --vault                   Create an end-to-end encrypted folder
+
+Files uploaded into an encrypted folder are encrypted on this machine with
+a key only you and the people you share it with can unwrap. Run
+"docshare keys generate" first.`,
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: completeArgs(argRemoteFolder, argRemoteFolder),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if err := requireAuth(); err != nil {
 			return err
@@ -55,23 +64,35 @@ var mkdirCmd = &cobra.Command{
 		if parentID != "" {
 			body["parentID"] = parentID
 		}
+		if flagMkdirVault {
+			// The folder key is wrapped for all of your keys, so your other
+			// machines can open the folder too.
+			key, err := vault.NewFolderKey()
+			if err != nil {
+				return err
+			}
+			wrapped, err := wrapForUser(key, "")
+			if err != nil {
+				return err
+			}
+			body["vault"] = true
+			body["vaultKeys"] = wrapped
+		}
 
 		var resp api.Response[api.File]
 		if err := apiClient.Post("/files/directory", body, &resp); err != nil {
 			return fmt.Errorf("creating directory: %w", err)
 		}
 
-		if flagJSON {
-			output.JSON(resp.Data)
-			return nil
-		}
-
-		fmt.Printf("Created directory: %s (id: %s)\n", resp.Data.Name, resp.Data.ID)
+		output.Emit(resp.Data, []string{resp.Data.ID}, func() {
+			fmt.Printf("Created directory: %s (id: %s)\n", resp.Data.Name, resp.Data.ID)
+		})
 		return nil
 	},
 }
 
 func init() {
 	mkdirCmd.Flags().StringVar(&flagParent, "parent", "", "Parent folder ID")
+	mkdirCmd.Flags().BoolVar(&flagMkdirVault, "vault", false, "Create an end-to-end encrypted folder")
 	rootCmd.AddCommand(mkdirCmd)
 }
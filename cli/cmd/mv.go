@@ -16,7 +16,8 @@ var mvCmd = &cobra.Command{
 
   docshare mv /Documents/report.pdf /Archive       Move to a different folder
   docshare mv /Documents/old.pdf new-name.pdf      Rename (destination without / = rename)`,
-	Args: cobra.ExactArgs(2),
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeArgs(argRemote, argRemoteFolder),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if err := requireAuth(); err != nil {
 			return err
@@ -49,12 +50,9 @@ var mvCmd = &cobra.Command{
 			return fmt.Errorf("moving/renaming: %w", err)
 		}
 
-		if flagJSON {
-			output.JSON(resp.Data)
-			return nil
-		}
-
-		fmt.Printf("Updated: %s\n", resp.Data.Name)
+		output.Emit(resp.Data, []string{resp.Data.ID}, func() {
+			fmt.Printf("Updated: %s\n", resp.Data.Name)
+		})
 		return nil
 	},
 }
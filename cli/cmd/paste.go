@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/docshare/cli/internal/api"
+	"github.com/docshare/cli/internal/output"
+	"github.com/docshare/cli/internal/pathutil"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagPasteName       string
+	flagPasteLanguage   string
+	flagPasteParent     string
+	flagPastePrivate    bool
+	flagPasteExpires    string
+	flagPastePermission string
+)
+
+var pasteCmd = &cobra.Command{
+	Use:   "paste [file]",
+	Short: "Share a snippet of text",
+	Long: `Save text from standard input, or a file, as a paste and print a public
+link to it. Pastes go to a Pastes folder in your root unless --parent names
+another, and are highlighted by --language or the name's extension.
+
+  docshare paste < build.log                      Link valid for 7 days
+  go test ./... 2>&1 | docshare paste -l go       Highlight as Go
+  docshare paste main.go --expires 24h            Named after the file, link valid for a day
+  docshare paste notes.md --private --parent /Notes
+  kubectl logs web-1 | docshare paste -o quiet | pbcopy`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeArgs(argLocal),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireAuth(); err != nil {
+			return err
+		}
+
+		name := flagPasteName
+		var content []byte
+		var err error
+		if len(args) == 1 && args[0] != "-" {
+			content, err = os.ReadFile(args[0])
+			if name == "" {
+				name = filepath.Base(args[0])
+			}
+		} else {
+			if info, statErr := os.Stdin.Stat(); statErr == nil && info.Mode()&os.ModeCharDevice != 0 {
+				return fmt.Errorf("nothing to paste: pipe text in or name a file")
+			}
+			content, err = io.ReadAll(os.Stdin)
+		}
+		if err != nil {
+			return fmt.Errorf("reading paste: %w", err)
+		}
+
+		body := map[string]interface{}{
+			"content": string(content),
+			"public":  !flagPastePrivate,
+		}
+		if name != "" {
+			body["name"] = name
+		}
+		if flagPasteLanguage != "" {
+			body["language"] = flagPasteLanguage
+		}
+		if flagPasteExpires != "" {
+			body["expiresIn"] = flagPasteExpires
+		}
+		if flagPastePermission != "" {
+			body["permission"] = flagPastePermission
+		}
+		if flagPasteParent != "" {
+			parentID, err := pathutil.Resolve(apiClient, flagPasteParent)
+			if err != nil {
+				return err
+			}
+			if parentID != "" {
+				body["parentID"] = parentID
+			}
+		}
+
+		var resp api.Response[api.PasteResult]
+		if err := apiClient.Post("/pastes", body, &resp, api.WithIdempotencyKey(api.NewIdempotencyKey())); err != nil {
+			return fmt.Errorf("creating paste: %w", err)
+		}
+
+		result := resp.Data
+		id := result.URL
+		if id == "" {
+			id = result.Paste.FileID
+		}
+		output.Emit(result, []string{id}, func() {
+			if result.URL != "" {
+				fmt.Println(result.URL)
+			}
+			if file := result.Paste.File; file != nil {
+				fmt.Printf("Saved %s (%d bytes, %s)\n", file.Name, file.Size, file.ID)
+			}
+			if result.ExpiresAt != nil && result.Share != nil {
+				fmt.Printf("Expires %s (%s permission)\n", *result.ExpiresAt, result.Share.Permission)
+			}
+		})
+		return nil
+	},
+}
+
+func init() {
+	pasteCmd.Flags().StringVar(&flagPasteName, "name", "", "File name for the paste (default: the file's name, or paste-<time>)")
+	pasteCmd.Flags().StringVarP(&flagPasteLanguage, "language", "l", "", "Language to highlight as, e.g. go, python or markdown")
+	pasteCmd.Flags().StringVar(&flagPasteParent, "parent", "", "Folder path or ID to save the paste in (default: /Pastes)")
+	pasteCmd.Flags().BoolVar(&flagPastePrivate, "private", false, "Save the paste without a public link")
+	pasteCmd.Flags().StringVar(&flagPasteExpires, "expires", "", "How long the link stays valid, e.g. 24h or 30 (days); default 7 days")
+	pasteCmd.Flags().StringVar(&flagPastePermission, "permission", "", "Permission level: view or download (default: download)")
+	_ = pasteCmd.RegisterFlagCompletionFunc("permission", cobra.FixedCompletions(
+		[]string{"view", "download"}, cobra.ShellCompDirectiveNoFileComp,
+	))
+	_ = pasteCmd.RegisterFlagCompletionFunc("parent", func(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		return completeRemotePath(toComplete, true)
+	})
+	rootCmd.AddCommand(pasteCmd)
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/docshare/cli/internal/api"
+	"github.com/docshare/cli/internal/output"
 	"github.com/docshare/cli/internal/pathutil"
 	"github.com/spf13/cobra"
 )
@@ -22,7 +23,8 @@ var rmCmd = &cobra.Command{
   docshare rm /Temp --force                    Skip confirmation
 
 Warning: Deleting a directory removes all contents recursively. This cannot be undone.`,
-	Args: cobra.ExactArgs(1),
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeArgs(argRemote),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if err := requireAuth(); err != nil {
 			return err
@@ -49,12 +51,12 @@ Warning: Deleting a directory removes all contents recursively. This cannot be u
 			if f.IsDirectory {
 				kind = "directory (and all contents)"
 			}
-			fmt.Printf("Delete %s %q? This cannot be undone. [y/N] ", kind, f.Name)
+			output.Noticef("Delete %s %q? This cannot be undone. [y/N] ", kind, f.Name)
 			reader := bufio.NewReader(os.Stdin)
 			answer, _ := reader.ReadString('\n')
 			answer = strings.TrimSpace(strings.ToLower(answer))
 			if answer != "y" && answer != "yes" {
-				fmt.Println("Cancelled.")
+				output.Noticef("Cancelled.\n")
 				return nil
 			}
 		}
@@ -64,7 +66,9 @@ Warning: Deleting a directory removes all contents recursively. This cannot be u
 			return fmt.Errorf("deleting: %w", err)
 		}
 
-		fmt.Printf("Deleted: %s\n", f.Name)
+		output.Emit(map[string]interface{}{"id": f.ID, "deleted": true}, nil, func() {
+			fmt.Printf("Deleted: %s\n", f.Name)
+		})
 		return nil
 	},
 }
@@ -1,17 +1,20 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 
 	"github.com/docshare/cli/internal/api"
 	"github.com/docshare/cli/internal/config"
+	"github.com/docshare/cli/internal/output"
 	"github.com/spf13/cobra"
 )
 
 var (
-	flagJSON      bool
-	flagServerURL string
+	flagJSON       bool
+	flagOutputMode string
+	flagServerURL  string
 
 	cfg       *config.Config
 	apiClient *api.Client
@@ -31,7 +34,15 @@ Get started:
 	SilenceUsage:  true,
 	SilenceErrors: true,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		var err error
+		mode, err := output.ParseMode(flagOutputMode)
+		if err != nil {
+			return usageError{err}
+		}
+		if flagJSON {
+			mode = output.ModeJSON
+		}
+		output.SetMode(mode)
+
 		cfg, err = config.Load()
 		if err != nil {
 			return fmt.Errorf("loading config: %w", err)
@@ -45,14 +56,28 @@ Get started:
 }
 
 func init() {
-	rootCmd.PersistentFlags().BoolVar(&flagJSON, "json", false, "Output as JSON")
+	rootCmd.PersistentFlags().StringVar(&flagOutputMode, "output", string(output.ModeTable), "Output format: table, json, quiet")
+	rootCmd.PersistentFlags().BoolVar(&flagJSON, "json", false, "Output as JSON (same as --output json)")
 	rootCmd.PersistentFlags().StringVar(&flagServerURL, "server", "", "Override server URL (default: from config or http://localhost:8080)")
+	_ = rootCmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions(
+		[]string{string(output.ModeTable), string(output.ModeJSON), string(output.ModeQuiet)},
+		cobra.ShellCompDirectiveNoFileComp,
+	))
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return usageError{err}
+	})
 }
 
-// Execute runs the root command.
+// Execute runs the root command. Errors are printed to stderr, as JSON in
+// JSON mode; use ExitCode to turn the returned error into an exit status.
 func Execute() error {
+	markUsageErrors(rootCmd)
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, "Error:", err)
+		if output.IsJSON() {
+			_ = json.NewEncoder(os.Stderr).Encode(newErrorJSON(err))
+		} else {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
 		return err
 	}
 	return nil
@@ -61,7 +86,7 @@ func Execute() error {
 // requireAuth is a helper that returns an error if no token is configured.
 func requireAuth() error {
 	if cfg == nil || !cfg.HasToken() {
-		return fmt.Errorf("not authenticated — run \"docshare login\" first")
+		return errNotAuthenticated
 	}
 	return nil
 }
@@ -24,12 +24,7 @@ var searchCmd = &cobra.Command{
 			return fmt.Errorf("searching: %w", err)
 		}
 
-		if flagJSON {
-			output.JSON(resp.Data)
-			return nil
-		}
-
-		output.FileTable(resp.Data)
+		output.Emit(resp.Data, fileIDs(resp.Data), func() { output.FileTable(resp.Data) })
 		return nil
 	},
 }
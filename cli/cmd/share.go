@@ -10,7 +10,11 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var flagPermission string
+var (
+	flagPermission string
+	flagWatermark  bool
+	flagViewOnly   bool
+)
 
 var shareCmd = &cobra.Command{
 	Use:   "share <file-path> <user-email>",
@@ -18,8 +22,19 @@ var shareCmd = &cobra.Command{
 	Long: `Share a file or directory with another user by email.
 
   docshare share /Documents/report.pdf alice@example.com
-  docshare share /Documents/report.pdf alice@example.com --permission edit`,
-	Args: cobra.ExactArgs(2),
+  docshare share /Documents/report.pdf alice@example.com --permission edit
+  docshare share /Deals alice@example.com --watermark
+  docshare share /Deals/term-sheet.pdf alice@example.com --view-only
+
+--watermark has PDFs stamped with the recipient's email, IP address and
+the time whenever they preview or download them. --view-only shares with
+view permission and lets the recipient see the file only as page images,
+with no way to fetch the file itself.
+
+Sharing an encrypted folder wraps its key for each of the recipient's
+registered keys, so they can decrypt its files.`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeArgs(argRemote),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if err := requireAuth(); err != nil {
 			return err
@@ -32,6 +47,12 @@ var shareCmd = &cobra.Command{
 		if fileID == "" {
 			return fmt.Errorf("cannot share root directory")
 		}
+		if flagViewOnly {
+			if cmd.Flags().Changed("permission") && flagPermission != "view" {
+				return fmt.Errorf("--view-only shares with view permission, not %s", flagPermission)
+			}
+			flagPermission = "view"
+		}
 
 		// Search for user by email.
 		email := args[1]
@@ -49,30 +70,61 @@ var shareCmd = &cobra.Command{
 			}
 		}
 		if targetUser == nil {
-			return fmt.Errorf("user not found: %s", email)
+			return fmt.Errorf("user %w: %s", errNotFound, email)
 		}
 
 		body := map[string]interface{}{
-			"sharedWithUserID": targetUser.ID,
-			"permission":       flagPermission,
+			"userID":     targetUser.ID,
+			"permission": flagPermission,
+		}
+		if flagWatermark {
+			body["watermark"] = true
+		}
+		if flagViewOnly {
+			body["viewOnly"] = true
 		}
 
-		var resp api.Response[api.Share]
-		if err := apiClient.Post("/files/"+fileID+"/share", body, &resp); err != nil {
-			return fmt.Errorf("sharing: %w", err)
+		var fileResp api.Response[api.File]
+		if err := apiClient.Get("/files/"+fileID, nil, &fileResp); err != nil {
+			return fmt.Errorf("fetching file info: %w", err)
+		}
+		if vaultID := fileResp.Data.VaultID; vaultID != nil {
+			key, err := folderKey(*vaultID)
+			if err != nil {
+				return err
+			}
+			wrapped, err := wrapForUser(key, targetUser.ID)
+			if err != nil {
+				return fmt.Errorf("%s: %w", email, err)
+			}
+			body["vaultKeys"] = wrapped
 		}
 
-		if flagJSON {
-			output.JSON(resp.Data)
-			return nil
+		var resp api.Response[api.Share]
+		if err := apiClient.Post("/files/"+fileID+"/share", body, &resp, api.WithIdempotencyKey(api.NewIdempotencyKey())); err != nil {
+			return fmt.Errorf("sharing: %w", err)
 		}
 
-		fmt.Printf("Shared with %s (%s permission)\n", email, resp.Data.Permission)
+		output.Emit(resp.Data, []string{resp.Data.ID}, func() {
+			extras := ""
+			if resp.Data.ViewOnly {
+				extras += ", view-only"
+			}
+			if resp.Data.Watermark {
+				extras += ", watermarked"
+			}
+			fmt.Printf("Shared with %s (%s permission%s)\n", email, resp.Data.Permission, extras)
+		})
 		return nil
 	},
 }
 
 func init() {
 	shareCmd.Flags().StringVar(&flagPermission, "permission", "download", "Permission level: view, download, edit")
+	shareCmd.Flags().BoolVar(&flagWatermark, "watermark", false, "Stamp PDFs with the recipient's email, IP address and the time")
+	shareCmd.Flags().BoolVar(&flagViewOnly, "view-only", false, "Show the file only as page images, blocking downloads and full previews")
+	_ = shareCmd.RegisterFlagCompletionFunc("permission", cobra.FixedCompletions(
+		[]string{"view", "download", "edit"}, cobra.ShellCompDirectiveNoFileComp,
+	))
 	rootCmd.AddCommand(shareCmd)
 }
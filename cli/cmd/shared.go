@@ -21,12 +21,11 @@ var sharedCmd = &cobra.Command{
 			return fmt.Errorf("listing shared files: %w", err)
 		}
 
-		if flagJSON {
-			output.JSON(resp.Data)
-			return nil
+		ids := make([]string, len(resp.Data))
+		for i, s := range resp.Data {
+			ids[i] = s.ID
 		}
-
-		output.ShareTable(resp.Data)
+		output.Emit(resp.Data, ids, func() { output.ShareTable(resp.Data) })
 		return nil
 	},
 }
@@ -1,7 +1,12 @@
 package cmd
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -10,13 +15,31 @@ import (
 
 	"github.com/docshare/cli/internal/api"
 	"github.com/docshare/cli/internal/output"
+	"github.com/docshare/cli/internal/pathutil"
 	"github.com/spf13/cobra"
 )
 
 var (
 	flagTransferTimeout string
+	flagTransferDir     string
+	flagTransferSave    bool
+	flagTransferFolder  string
+	flagTransferAnon    bool
 )
 
+// transferEvent is one line of the --output json stream printed by
+// transfer send as the transfer progresses.
+type transferEvent struct {
+	Code      string `json:"code"`
+	Status    string `json:"status"`
+	FileName  string `json:"fileName,omitempty"`
+	FileSize  int64  `json:"fileSize,omitempty"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	// ReceiveURL and PIN are printed for --anonymous transfers.
+	ReceiveURL string `json:"receiveURL,omitempty"`
+	PIN        string `json:"pin,omitempty"`
+}
+
 var transferCmd = &cobra.Command{
 	Use:   "transfer <send/receive> [path]",
 	Short: "Transfer files between users",
@@ -39,9 +62,11 @@ var transferSendCmd = &cobra.Command{
 	Long: `Send a file and wait for someone to receive it.
 
   docshare transfer send report.pdf
-  docshare transfer send ./folder/file.txt --timeout 10m`,
-	Args: cobra.ExactArgs(1),
-	RunE: runTransferSend,
+  docshare transfer send ./folder/file.txt --timeout 10m
+  docshare transfer send report.pdf --anonymous`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeArgs(argLocal),
+	RunE:              runTransferSend,
 }
 
 var transferReceiveCmd = &cobra.Command{
@@ -50,7 +75,8 @@ var transferReceiveCmd = &cobra.Command{
 	Long: `Connect to a transfer using a code and receive the file.
 
   docshare transfer receive ABC123
-  docshare transfer receive ABC123 --output ./Downloads`,
+  docshare transfer receive ABC123 --output-dir ./Downloads
+  docshare transfer receive ABC123 --save --folder /Inbox`,
 	Args: cobra.ExactArgs(1),
 	RunE: runTransferReceive,
 }
@@ -70,7 +96,10 @@ var transferCancelCmd = &cobra.Command{
 
 func init() {
 	transferSendCmd.Flags().StringVar(&flagTransferTimeout, "timeout", "5m", "How long to wait for receiver (e.g., 5m, 10m)")
-	transferReceiveCmd.Flags().StringVarP(&flagOutput, "output", "o", ".", "Output directory for received file")
+	transferSendCmd.Flags().BoolVar(&flagTransferAnon, "anonymous", false, "Also print a one-time link and PIN for a recipient without an account")
+	transferReceiveCmd.Flags().StringVarP(&flagTransferDir, "output-dir", "o", ".", "Output directory for received file")
+	transferReceiveCmd.Flags().BoolVar(&flagTransferSave, "save", false, "Save the file to your DocShare files instead of downloading it")
+	transferReceiveCmd.Flags().StringVar(&flagTransferFolder, "folder", "", "Remote folder path or ID to save into with --save (default: root)")
 
 	transferCmd.AddCommand(transferSendCmd)
 	transferCmd.AddCommand(transferReceiveCmd)
@@ -131,23 +160,42 @@ func runTransferSend(cmd *cobra.Command, args []string) error {
 	fileName := filepath.Base(localPath)
 	fileSize := info.Size()
 
-	fmt.Printf("Preparing to send %s (%s)...\n", fileName, output.FormatSize(fileSize))
+	output.Infof("Preparing to send %s (%s)...\n", fileName, output.FormatSize(fileSize))
 
 	req := api.TransferCreateRequest{
-		FileName: fileName,
-		FileSize: fileSize,
-		Timeout:  &timeoutSecs,
+		FileName:       fileName,
+		FileSize:       fileSize,
+		Timeout:        &timeoutSecs,
+		AllowAnonymous: flagTransferAnon,
 	}
 
 	var resp api.Response[api.TransferCreateResponse]
-	if err := apiClient.Post("/transfers", req, &resp); err != nil {
+	if err := apiClient.Post("/transfers", req, &resp, api.WithIdempotencyKey(api.NewIdempotencyKey())); err != nil {
 		return fmt.Errorf("creating transfer: %w", err)
 	}
 
 	code := resp.Data.Code
-	fmt.Printf("\nShare this code with the recipient:\n\n")
-	fmt.Printf("  \033[1m%s\033[0m\n\n", code)
-	fmt.Printf("Waiting for receiver... (timeout: %s)\n", flagTransferTimeout)
+	// The code is printed straight away in every mode, since the recipient
+	// needs it before anything else can happen.
+	switch {
+	case output.IsJSON():
+		output.JSONLine(transferEvent{Code: code, Status: "waiting", FileName: fileName, FileSize: fileSize, ExpiresAt: resp.Data.ExpiresAt, ReceiveURL: resp.Data.ReceiveURL, PIN: resp.Data.PIN})
+	case output.IsQuiet():
+		fmt.Println(code)
+		if resp.Data.ReceiveURL != "" {
+			fmt.Println(resp.Data.ReceiveURL)
+			fmt.Println(resp.Data.PIN)
+		}
+	default:
+		fmt.Printf("\nShare this code with the recipient:\n\n")
+		fmt.Printf("  \033[1m%s\033[0m\n\n", code)
+		if resp.Data.ReceiveURL != "" {
+			fmt.Printf("Or, for someone without an account, this one-time link:\n\n")
+			fmt.Printf("  %s\n\n", resp.Data.ReceiveURL)
+			fmt.Printf("and, sent separately, the PIN \033[1m%s\033[0m\n\n", resp.Data.PIN)
+		}
+		fmt.Printf("Waiting for receiver... (timeout: %s)\n", flagTransferTimeout)
+	}
 
 	pollInterval := 2 * time.Second
 	timeout := time.Duration(timeoutSecs) * time.Second
@@ -162,7 +210,14 @@ func runTransferSend(cmd *cobra.Command, args []string) error {
 		status := statusResp.Data
 
 		if status.Status == "receiver_connected" || status.Status == "active" {
-			fmt.Println("\nReceiver connected! Starting transfer...")
+			if status.RecipientIP != "" {
+				output.Infof("\nAnonymous receiver connected from %s. Starting transfer...\n", status.RecipientIP)
+			} else {
+				output.Infof("\nReceiver connected! Starting transfer...\n")
+			}
+			if output.IsJSON() {
+				output.JSONLine(transferEvent{Code: code, Status: "receiver_connected"})
+			}
 			return uploadAndCompleteTransfer(code, localPath)
 		}
 
@@ -179,6 +234,13 @@ func runTransferSend(cmd *cobra.Command, args []string) error {
 	return fmt.Errorf("transfer timed out after %s", flagTransferTimeout)
 }
 
+// transferChunkSize is the size of each chunk sent to the transfer relay.
+const transferChunkSize = 8 * 1024 * 1024
+
+// transferUploadRounds is how many times the chunks the server reports
+// missing are sent again before the upload is given up.
+const transferUploadRounds = 5
+
 func uploadAndCompleteTransfer(code, localPath string) error {
 	file, err := os.Open(localPath)
 	if err != nil {
@@ -191,20 +253,108 @@ func uploadAndCompleteTransfer(code, localPath string) error {
 		return fmt.Errorf("stat file: %w", err)
 	}
 
-	if err := apiClient.UploadTransferFile("/transfers/"+code+"/upload", file, info.Size()); err != nil {
-		return fmt.Errorf("uploading: %w", err)
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return fmt.Errorf("reading file: %w", err)
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+
+	total := int((info.Size() + transferChunkSize - 1) / transferChunkSize)
+	if total == 0 {
+		total = 1
+	}
+	pending := make([]int, total)
+	for i := range pending {
+		pending[i] = i
+	}
+	buf := make([]byte, transferChunkSize)
+	for round := 1; len(pending) > 0; round++ {
+		var lastErr error
+		for _, index := range pending {
+			n, err := file.ReadAt(buf, int64(index)*transferChunkSize)
+			if err != nil && err != io.EOF {
+				return fmt.Errorf("reading file: %w", err)
+			}
+			if err := apiClient.UploadTransferChunk("/transfers/"+code+"/upload", buf[:n], index, total); err != nil {
+				// A refused chunk, such as one the upload policy
+				// rejects, will not be accepted on a retry either.
+				var apiErr *api.APIError
+				if errors.As(err, &apiErr) && apiErr.Status >= 400 && apiErr.Status < 500 && apiErr.Status != http.StatusTooManyRequests {
+					return fmt.Errorf("uploading: %w", err)
+				}
+				lastErr = err
+			}
+		}
+		// The server's record of what it holds decides what to send
+		// again, so chunks that arrived despite an error are not resent.
+		var progress api.Response[api.TransferProgressResponse]
+		if err := apiClient.Get("/transfers/"+code+"/status", nil, &progress); err != nil {
+			return fmt.Errorf("checking upload: %w", err)
+		}
+		pending = pending[:0]
+		for _, missing := range progress.Data.Missing {
+			for i := missing.Start; i <= missing.End; i++ {
+				pending = append(pending, i)
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+		if round == transferUploadRounds {
+			if lastErr == nil {
+				lastErr = fmt.Errorf("%d chunks missing", len(pending))
+			}
+			return fmt.Errorf("uploading: %w", lastErr)
+		}
+		output.Infof("Resending %d chunk(s)...\n", len(pending))
+		time.Sleep(time.Duration(round) * time.Second)
 	}
 
-	fmt.Println("Upload complete!")
+	output.Infof("Upload complete!\n")
 
 	var completeResp api.Response[map[string]string]
-	if err := apiClient.Post("/transfers/"+code+"/complete", nil, &completeResp); err != nil {
+	if err := apiClient.Post("/transfers/"+code+"/complete", map[string]string{"checksum": checksum}, &completeResp); err != nil {
 		return fmt.Errorf("completing transfer: %w", err)
 	}
 
+	status := completeResp.Data["status"]
+	if status == "scanning" {
+		output.Infof("The server is scanning the file before the receiver can download it.\n")
+	}
+	if output.IsJSON() {
+		output.JSONLine(transferEvent{Code: code, Status: status})
+	}
 	return nil
 }
 
+// waitForTransferReady polls until the sender's upload has been received
+// and has passed the server's malware scan.
+func waitForTransferReady(code string) error {
+	waiting := ""
+	for {
+		var statusResp api.Response[api.TransferStatusResponse]
+		if err := apiClient.Get("/transfers/"+code, nil, &statusResp); err != nil {
+			return err
+		}
+		switch status := statusResp.Data.Status; status {
+		case "ready":
+			return nil
+		case "active", "scanning":
+			if status != waiting {
+				waiting = status
+				if status == "scanning" {
+					output.Infof("Waiting for the server to scan the file...\n")
+				} else {
+					output.Infof("Waiting for the sender to upload...\n")
+				}
+			}
+		default:
+			return fmt.Errorf("transfer %s", status)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
 func runTransferReceive(cmd *cobra.Command, args []string) error {
 	if err := requireAuth(); err != nil {
 		return err
@@ -212,7 +362,19 @@ func runTransferReceive(cmd *cobra.Command, args []string) error {
 
 	code := strings.ToUpper(args[0])
 
-	fmt.Printf("Connecting to transfer %s...\n", code)
+	var parentID string
+	if flagTransferFolder != "" {
+		if !flagTransferSave {
+			return fmt.Errorf("--folder requires --save")
+		}
+		resolved, err := pathutil.Resolve(apiClient, flagTransferFolder)
+		if err != nil {
+			return fmt.Errorf("resolving folder: %w", err)
+		}
+		parentID = resolved
+	}
+
+	output.Infof("Connecting to transfer %s...\n", code)
 
 	var connectResp api.Response[map[string]string]
 	if err := apiClient.Post("/transfers/"+code+"/connect", nil, &connectResp); err != nil {
@@ -222,9 +384,13 @@ func runTransferReceive(cmd *cobra.Command, args []string) error {
 	fileName := connectResp.Data["fileName"]
 	fileSize, _ := strconv.ParseInt(connectResp.Data["fileSize"], 10, 64)
 
-	fmt.Printf("Receiving: %s (%s)\n", fileName, output.FormatSize(fileSize))
+	output.Infof("Receiving: %s (%s)\n", fileName, output.FormatSize(fileSize))
+
+	if flagTransferSave {
+		return saveTransfer(code, fileName, fileSize, parentID)
+	}
 
-	destDir := flagOutput
+	destDir := flagTransferDir
 	if destDir == "." {
 		cwd, _ := os.Getwd()
 		destDir = cwd
@@ -232,6 +398,10 @@ func runTransferReceive(cmd *cobra.Command, args []string) error {
 
 	destPath := filepath.Join(destDir, fileName)
 
+	if err := waitForTransferReady(code); err != nil {
+		return fmt.Errorf("waiting for transfer: %w", err)
+	}
+
 	file, err := os.Create(destPath)
 	if err != nil {
 		return fmt.Errorf("creating file: %w", err)
@@ -248,7 +418,30 @@ func runTransferReceive(cmd *cobra.Command, args []string) error {
 		fmt.Fprintf(os.Stderr, "Warning: could not confirm completion: %v\n", err)
 	}
 
-	fmt.Printf("Received: %s → %s\n", fileName, destPath)
+	result := map[string]interface{}{"code": code, "fileName": fileName, "size": fileSize, "path": destPath}
+	output.Emit(result, []string{destPath}, func() {
+		fmt.Printf("Received: %s → %s\n", fileName, destPath)
+	})
+	return nil
+}
+
+// saveTransfer has the server keep a received transfer in the user's files,
+// so the content never passes through this machine.
+func saveTransfer(code, fileName string, fileSize int64, parentID string) error {
+	if err := waitForTransferReady(code); err != nil {
+		return fmt.Errorf("waiting for transfer: %w", err)
+	}
+
+	var resp api.Response[api.TransferSaveResponse]
+	if err := apiClient.Post("/transfers/"+code+"/complete", map[string]interface{}{"save": true, "parentID": parentID}, &resp); err != nil {
+		return fmt.Errorf("saving: %w", err)
+	}
+
+	file := resp.Data.File
+	result := map[string]interface{}{"code": code, "fileName": file.Name, "size": fileSize, "fileID": file.ID}
+	output.Emit(result, []string{file.ID}, func() {
+		fmt.Printf("Saved: %s → %s (%s)\n", fileName, file.Name, file.ID)
+	})
 	return nil
 }
 
@@ -262,16 +455,20 @@ func runTransferList(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("listing transfers: %w", err)
 	}
 
-	if len(resp.Data) == 0 {
-		fmt.Println("No pending transfers")
-		return nil
+	codes := make([]string, len(resp.Data))
+	for i, t := range resp.Data {
+		codes[i] = t.Code
 	}
-
-	fmt.Println("Pending transfers:")
-	for _, t := range resp.Data {
-		fmt.Printf("  %s  %s  (%s)  expires %s\n", t.Code, t.FileName, output.FormatSize(t.FileSize), t.ExpiresAt)
-	}
-
+	output.Emit(resp.Data, codes, func() {
+		if len(resp.Data) == 0 {
+			fmt.Println("No pending transfers")
+			return
+		}
+		fmt.Println("Pending transfers:")
+		for _, t := range resp.Data {
+			fmt.Printf("  %s  %s  (%s)  expires %s\n", t.Code, t.FileName, output.FormatSize(t.FileSize), t.ExpiresAt)
+		}
+	})
 	return nil
 }
 
@@ -287,6 +484,8 @@ func runTransferCancel(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("cancelling transfer: %w", err)
 	}
 
-	fmt.Printf("Transfer %s cancelled\n", code)
+	output.Emit(map[string]interface{}{"code": code, "cancelled": true}, nil, func() {
+		fmt.Printf("Transfer %s cancelled\n", code)
+	})
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/docshare/cli/internal/api"
+	"github.com/docshare/cli/internal/output"
 	"github.com/spf13/cobra"
 )
 
@@ -22,7 +23,9 @@ var unshareCmd = &cobra.Command{
 			return fmt.Errorf("revoking share: %w", err)
 		}
 
-		fmt.Println("Share revoked.")
+		output.Emit(map[string]interface{}{"id": shareID, "revoked": true}, nil, func() {
+			fmt.Println("Share revoked.")
+		})
 		return nil
 	},
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/docshare/cli/internal/output"
 	"github.com/docshare/cli/internal/upgrade"
 	"github.com/spf13/cobra"
 )
@@ -27,32 +28,38 @@ Example:
 			currentVersion = "dev"
 		}
 
-		fmt.Printf("Current version: %s\n", currentVersion)
+		output.Infof("Current version: %s\n", currentVersion)
 
 		if currentVersion == "dev" {
 			return fmt.Errorf("cannot upgrade dev builds — please use a release version or build from source")
 		}
 
-		fmt.Println("Checking for updates...")
+		output.Infof("Checking for updates...\n")
 		latestVersion, err := upgrade.GetLatestVersion()
 		if err != nil {
 			return fmt.Errorf("checking for updates: %w", err)
 		}
 
-		fmt.Printf("Latest version:  %s\n", latestVersion)
+		output.Infof("Latest version:  %s\n", latestVersion)
 
+		result := map[string]interface{}{"previousVersion": currentVersion, "version": currentVersion, "upgraded": false}
 		if compareVersions(currentVersion, latestVersion) >= 0 {
-			fmt.Println("\nYou're already running the latest version!")
+			output.Emit(result, []string{currentVersion}, func() {
+				fmt.Println("\nYou're already running the latest version!")
+			})
 			return nil
 		}
 
-		fmt.Printf("\nUpgrading to %s...\n", latestVersion)
+		output.Infof("\nUpgrading to %s...\n", latestVersion)
 		if err := upgrade.DownloadAndInstall(latestVersion); err != nil {
 			return fmt.Errorf("upgrade failed: %w", err)
 		}
 
-		fmt.Printf("\nSuccessfully upgraded to %s\n", latestVersion)
-		fmt.Println("Run 'docshare version' to verify.")
+		result["version"], result["upgraded"] = latestVersion, true
+		output.Emit(result, []string{latestVersion}, func() {
+			fmt.Printf("\nSuccessfully upgraded to %s\n", latestVersion)
+			fmt.Println("Run 'docshare version' to verify.")
+		})
 		return nil
 	},
 }
@@ -5,7 +5,6 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
-	"sync/atomic"
 
 	"github.com/docshare/cli/internal/api"
 	"github.com/docshare/cli/internal/output"
@@ -27,8 +26,9 @@ var uploadCmd = &cobra.Command{
   docshare upload report.pdf /Documents           Upload to a folder
   docshare upload ./project/ /Documents           Upload directory recursively
   docshare upload report.pdf --parent <uuid>      Upload to folder by ID`,
-	Args: cobra.RangeArgs(1, 2),
-	RunE: runUpload,
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: completeArgs(argLocal, argRemoteFolder),
+	RunE:              runUpload,
 }
 
 func init() {
@@ -66,51 +66,108 @@ func runUpload(cmd *cobra.Command, args []string) error {
 	return uploadDirectory(localPath, parentID)
 }
 
-func uploadSingleFile(path, parentID string) error {
-	extra := map[string]string{}
-	if parentID != "" {
-		extra["parentID"] = parentID
+// maxUploadBytes returns the largest file the server accepts, asking it
+// once, or 0 when the server doesn't say.
+var maxUploadBytes = sync.OnceValue(func() int64 {
+	var resp api.Response[api.VersionInfo]
+	if err := apiClient.Get("/version", nil, &resp); err != nil || resp.Data.Capabilities == nil {
+		return 0
 	}
+	return resp.Data.Capabilities.Uploads.MaxBytes
+})
 
-	var resp api.Response[api.File]
-	if err := apiClient.Upload("/files/upload", "file", path, extra, &resp); err != nil {
-		return fmt.Errorf("uploading %s: %w", filepath.Base(path), err)
+// checkUploadSize refuses a file the server would reject, before sending
+// any of it.
+func checkUploadSize(path string) error {
+	limit := maxUploadBytes()
+	if limit <= 0 {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
 	}
+	if info.Size() > limit {
+		return fmt.Errorf("%s is %s, over the server's %s upload limit", filepath.Base(path), output.FormatSize(info.Size()), output.FormatSize(limit))
+	}
+	return nil
+}
 
-	if flagJSON {
-		output.JSON(resp.Data)
-		return nil
+func uploadSingleFile(path, parentID string) error {
+	if err := checkUploadSize(path); err != nil {
+		return err
+	}
+	var resp api.Response[api.File]
+	if err := uploadTo(path, parentID, &resp); err != nil {
+		return fmt.Errorf("uploading %s: %w", filepath.Base(path), err)
 	}
 
-	fmt.Printf("Uploaded %s (%s)\n", resp.Data.Name, output.FormatSize(resp.Data.Size))
+	output.Emit(resp.Data, []string{resp.Data.ID}, func() {
+		fmt.Printf("Uploaded %s (%s)\n", resp.Data.Name, output.FormatSize(resp.Data.Size))
+	})
 	return nil
 }
 
+// uploadTo uploads the file at path into parentID, encrypting it first
+// when parentID is in an encrypted folder.
+func uploadTo(path, parentID string, resp *api.Response[api.File]) error {
+	extra := map[string]string{}
+	if parentID != "" {
+		extra["parentID"] = parentID
+	}
+	key, err := uploadVaultKey(parentID)
+	if err != nil {
+		return err
+	}
+	if key != nil {
+		sealed, dir, err := encryptToTemp(path, key)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		path = sealed
+	}
+	return apiClient.Upload("/files/upload", "file", path, extra, resp, api.WithIdempotencyKey(api.NewIdempotencyKey()))
+}
+
 type uploadJob struct {
 	localPath string
 	parentID  string
 }
 
+// uploadFailure is one entry in the failed list of a directory upload.
+type uploadFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// uploadDirResult is the --output json result of a directory upload.
+type uploadDirResult struct {
+	Directory api.File        `json:"directory"`
+	Uploaded  []api.File      `json:"uploaded"`
+	Failed    []uploadFailure `json:"failed"`
+}
+
 func uploadDirectory(dirPath, parentID string) error {
 	// Create the top-level directory on the server.
 	dirName := filepath.Base(dirPath)
-	topDirID, err := createRemoteDir(dirName, parentID)
+	topDir, err := createRemoteDir(dirName, parentID)
 	if err != nil {
 		return fmt.Errorf("creating remote directory %s: %w", dirName, err)
 	}
-	fmt.Printf("Created directory: %s\n", dirName)
+	output.Infof("Created directory: %s\n", dirName)
 
 	// Walk the local directory tree and collect files + create remote directories.
 	jobs := make(chan uploadJob, 64)
 	var walkErr error
 
-	var uploaded atomic.Int64
-	var failed atomic.Int64
+	result := uploadDirResult{Directory: topDir, Uploaded: []api.File{}, Failed: []uploadFailure{}}
+	var mu sync.Mutex
 
 	// Producer: walk the tree, create directories, enqueue files.
 	go func() {
 		defer close(jobs)
-		walkErr = walkTree(dirPath, topDirID, jobs)
+		walkErr = walkTree(dirPath, topDir.ID, jobs)
 	}()
 
 	// Consumer: worker pool uploads files concurrently.
@@ -125,18 +182,20 @@ func uploadDirectory(dirPath, parentID string) error {
 		go func() {
 			defer wg.Done()
 			for job := range jobs {
-				extra := map[string]string{}
-				if job.parentID != "" {
-					extra["parentID"] = job.parentID
-				}
 				var resp api.Response[api.File]
-				if err := apiClient.Upload("/files/upload", "file", job.localPath, extra, &resp); err != nil {
+				err := checkUploadSize(job.localPath)
+				if err == nil {
+					err = uploadTo(job.localPath, job.parentID, &resp)
+				}
+				mu.Lock()
+				if err != nil {
 					fmt.Fprintf(os.Stderr, "  Failed: %s — %v\n", filepath.Base(job.localPath), err)
-					failed.Add(1)
+					result.Failed = append(result.Failed, uploadFailure{Path: job.localPath, Error: err.Error()})
 				} else {
-					fmt.Printf("  Uploaded: %s (%s)\n", resp.Data.Name, output.FormatSize(resp.Data.Size))
-					uploaded.Add(1)
+					output.Infof("  Uploaded: %s (%s)\n", resp.Data.Name, output.FormatSize(resp.Data.Size))
+					result.Uploaded = append(result.Uploaded, resp.Data)
 				}
+				mu.Unlock()
 			}
 		}()
 	}
@@ -147,9 +206,11 @@ func uploadDirectory(dirPath, parentID string) error {
 		return fmt.Errorf("walking directory: %w", walkErr)
 	}
 
-	fmt.Printf("\nDone: %d uploaded, %d failed\n", uploaded.Load(), failed.Load())
-	if failed.Load() > 0 {
-		return fmt.Errorf("%d file(s) failed to upload", failed.Load())
+	output.Emit(result, fileIDs(result.Uploaded), func() {
+		fmt.Printf("\nDone: %d uploaded, %d failed\n", len(result.Uploaded), len(result.Failed))
+	})
+	if len(result.Failed) > 0 {
+		return fmt.Errorf("%d file(s) failed to upload", len(result.Failed))
 	}
 	return nil
 }
@@ -166,13 +227,13 @@ func walkTree(localDir, remoteParentID string, jobs chan<- uploadJob) error {
 
 		if entry.IsDir() {
 			// Create remote directory and recurse.
-			childID, err := createRemoteDir(entry.Name(), remoteParentID)
+			child, err := createRemoteDir(entry.Name(), remoteParentID)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "  Failed to create directory: %s — %v\n", entry.Name(), err)
 				continue
 			}
-			fmt.Printf("  Created directory: %s\n", entry.Name())
-			if err := walkTree(localPath, childID, jobs); err != nil {
+			output.Infof("  Created directory: %s\n", entry.Name())
+			if err := walkTree(localPath, child.ID, jobs); err != nil {
 				return err
 			}
 		} else {
@@ -182,14 +243,14 @@ func walkTree(localDir, remoteParentID string, jobs chan<- uploadJob) error {
 	return nil
 }
 
-func createRemoteDir(name, parentID string) (string, error) {
+func createRemoteDir(name, parentID string) (api.File, error) {
 	body := map[string]interface{}{"name": name}
 	if parentID != "" {
 		body["parentID"] = parentID
 	}
 	var resp api.Response[api.File]
 	if err := apiClient.Post("/files/directory", body, &resp); err != nil {
-		return "", err
+		return api.File{}, err
 	}
-	return resp.Data.ID, nil
+	return resp.Data, nil
 }
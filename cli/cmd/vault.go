@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/docshare/cli/internal/api"
+	"github.com/docshare/cli/internal/vault"
+)
+
+// folderKeys caches the folder key of each vault, and the vault of each
+// folder uploaded into, for the life of the command. Directory uploads
+// look them up from several workers at once.
+var folderKeys = struct {
+	sync.Mutex
+	byVault  map[string][]byte
+	byParent map[string]string
+}{byVault: map[string][]byte{}, byParent: map[string]string{}}
+
+// folderKey unwraps the key of the vault vaultID with this machine's key.
+func folderKey(vaultID string) ([]byte, error) {
+	folderKeys.Lock()
+	key, ok := folderKeys.byVault[vaultID]
+	folderKeys.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	id, err := loadIdentity()
+	if err != nil {
+		return nil, err
+	}
+	priv, err := id.Key()
+	if err != nil {
+		return nil, fmt.Errorf("reading key: %w", err)
+	}
+	var resp api.Response[api.VaultResponse]
+	if err := apiClient.Get("/files/"+vaultID+"/vault", nil, &resp); err != nil {
+		return nil, fmt.Errorf("fetching folder key: %w", err)
+	}
+	for _, wrapped := range resp.Data.Keys {
+		if wrapped.KeyID != id.KeyID {
+			continue
+		}
+		key, err := vault.Unwrap(priv, wrapped.WrappedKey)
+		if err != nil {
+			return nil, fmt.Errorf("unwrapping folder key: %w", err)
+		}
+		folderKeys.Lock()
+		folderKeys.byVault[vaultID] = key
+		folderKeys.Unlock()
+		return key, nil
+	}
+	return nil, errors.New("the encrypted folder's key has not been shared with this machine's key")
+}
+
+// uploadVaultKey returns the folder key to encrypt uploads into parentID
+// with, or nil when parentID is not in an encrypted folder.
+func uploadVaultKey(parentID string) ([]byte, error) {
+	vaultID, err := vaultOf(parentID)
+	if err != nil || vaultID == "" {
+		return nil, err
+	}
+	return folderKey(vaultID)
+}
+
+// vaultOf returns the vault folderID is in, or "" for the root and
+// folders outside any vault.
+func vaultOf(folderID string) (string, error) {
+	if folderID == "" {
+		return "", nil
+	}
+	folderKeys.Lock()
+	vaultID, known := folderKeys.byParent[folderID]
+	folderKeys.Unlock()
+	if known {
+		return vaultID, nil
+	}
+	var resp api.Response[api.File]
+	if err := apiClient.Get("/files/"+folderID, nil, &resp); err != nil {
+		return "", fmt.Errorf("fetching parent folder: %w", err)
+	}
+	if resp.Data.VaultID != nil {
+		vaultID = *resp.Data.VaultID
+	}
+	folderKeys.Lock()
+	folderKeys.byParent[folderID] = vaultID
+	folderKeys.Unlock()
+	return vaultID, nil
+}
+
+// wrapForUser wraps key for each of userID's registered keys.
+func wrapForUser(key []byte, userID string) ([]api.WrappedKey, error) {
+	path := "/auth/me/keys"
+	if userID != "" {
+		path = "/users/" + userID + "/keys"
+	}
+	var resp api.Response[[]api.UserKey]
+	if err := apiClient.Get(path, nil, &resp); err != nil {
+		return nil, fmt.Errorf("fetching public keys: %w", err)
+	}
+	if len(resp.Data) == 0 {
+		return nil, errors.New("no public keys registered — they must run `docshare keys generate` first")
+	}
+	wrapped := make([]api.WrappedKey, 0, len(resp.Data))
+	for _, k := range resp.Data {
+		w, err := vault.Wrap(k.PublicKey, key)
+		if err != nil {
+			return nil, fmt.Errorf("wrapping folder key for %s: %w", k.Name, err)
+		}
+		wrapped = append(wrapped, api.WrappedKey{KeyID: k.ID, WrappedKey: w})
+	}
+	return wrapped, nil
+}
+
+// encryptToTemp encrypts the file at path into a temporary file of the
+// same name, so the upload keeps it. The caller removes the returned
+// directory.
+func encryptToTemp(path string, key []byte) (string, string, error) {
+	dir, err := os.MkdirTemp("", "docshare-vault-")
+	if err != nil {
+		return "", "", err
+	}
+	sealed := filepath.Join(dir, filepath.Base(path))
+	if err := sealFile(sealed, path, key, vault.Encrypt); err != nil {
+		os.RemoveAll(dir)
+		return "", "", fmt.Errorf("encrypting %s: %w", filepath.Base(path), err)
+	}
+	return sealed, dir, nil
+}
+
+// sealFile runs transform (Encrypt or Decrypt) from src to a new file at
+// dest.
+func sealFile(dest, src string, key []byte, transform func(io.Writer, io.Reader, []byte) error) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := transform(out, in, key); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return err
+	}
+	return out.Close()
+}
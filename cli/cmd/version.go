@@ -23,25 +23,25 @@ var versionCmd = &cobra.Command{
 			serverInfo = &resp.Data
 		}
 
-		if flagJSON {
-			type jsonOut struct {
-				CLIVersion    string `json:"cliVersion"`
-				ServerVersion string `json:"serverVersion,omitempty"`
-				APIVersion    string `json:"apiVersion,omitempty"`
-				ServerError   string `json:"serverError,omitempty"`
-			}
-			out := jsonOut{CLIVersion: Version}
-			if serverInfo != nil {
-				out.ServerVersion = serverInfo.Version
-				out.APIVersion = serverInfo.APIVersion
-			} else {
-				out.ServerError = serverErr.Error()
-			}
-			output.JSON(out)
-			return nil
+		type jsonOut struct {
+			CLIVersion    string `json:"cliVersion"`
+			ServerVersion string `json:"serverVersion,omitempty"`
+			APIVersion    string `json:"apiVersion,omitempty"`
+			// SupportedVersions is what the server accepts; the CLI sends
+			// api.APIVersion.
+			SupportedVersions []string `json:"supportedVersions,omitempty"`
+			ServerError       string   `json:"serverError,omitempty"`
+		}
+		out := jsonOut{CLIVersion: Version}
+		if serverInfo != nil {
+			out.ServerVersion = serverInfo.Version
+			out.APIVersion = serverInfo.APIVersion
+			out.SupportedVersions = serverInfo.SupportedVersions
+		} else {
+			out.ServerError = serverErr.Error()
 		}
 
-		output.VersionInfo(Version, serverInfo)
+		output.Emit(out, []string{Version}, func() { output.VersionInfo(Version, serverInfo) })
 		return nil
 	},
 }
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/docshare/cli/internal/output"
+	"github.com/docshare/cli/internal/pathutil"
+	"github.com/docshare/cli/internal/watch"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagWatchDest     string
+	flagWatchDelete   bool
+	flagWatchInterval time.Duration
+	flagWatchDebounce time.Duration
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch <dir>",
+	Short: "Upload changes in a local folder as they happen",
+	Long: `Watch a local directory and upload new and changed files to a DocShare folder.
+
+  docshare watch ./scans --dest /Inbox               Mirror ./scans into /Inbox
+  docshare watch ./scans --dest <uuid> --delete      Also delete remote files removed locally
+  docshare watch ./scans --dest /Inbox --debounce 10s
+
+On start, files missing from the destination or differing in size are
+uploaded. A changed file is uploaded again and replaces the remote copy.
+Files are only uploaded once they have stopped changing for the debounce
+period. Paths matching patterns in .docshareignore at the root of the
+watched directory are skipped (gitignore-style: globs, "dir/", "!keep").
+
+Runs until interrupted with Ctrl+C.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeArgs(argLocalDir),
+	RunE:              runWatch,
+}
+
+func init() {
+	watchCmd.Flags().StringVar(&flagWatchDest, "dest", "", "Remote folder path or ID to upload into")
+	watchCmd.Flags().BoolVar(&flagWatchDelete, "delete", false, "Delete remote files when local ones are removed")
+	watchCmd.Flags().DurationVar(&flagWatchInterval, "interval", time.Second, "How often to scan for changes")
+	watchCmd.Flags().DurationVar(&flagWatchDebounce, "debounce", 2*time.Second, "How long a file must be unchanged before it is uploaded")
+	_ = watchCmd.MarkFlagRequired("dest")
+	_ = watchCmd.RegisterFlagCompletionFunc("dest", func(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		return completeRemotePath(toComplete, true)
+	})
+	rootCmd.AddCommand(watchCmd)
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	if err := requireAuth(); err != nil {
+		return err
+	}
+
+	dir, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", args[0], err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", args[0])
+	}
+	if flagWatchInterval <= 0 || flagWatchDebounce < 0 {
+		return fmt.Errorf("--interval must be positive and --debounce must not be negative")
+	}
+
+	destID, err := pathutil.Resolve(apiClient, flagWatchDest)
+	if err != nil {
+		return fmt.Errorf("resolving destination: %w", err)
+	}
+	// watch compares checksums with the server's copies, which it cannot
+	// do for encrypted files.
+	if vaultID, err := vaultOf(destID); err != nil {
+		return err
+	} else if vaultID != "" {
+		return fmt.Errorf("watch cannot sync into an encrypted folder")
+	}
+	ignore, err := watch.LoadIgnore(dir)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", watch.IgnoreFile, err)
+	}
+
+	syncer := watch.NewSyncer(apiClient, dir, destID, flagWatchDelete)
+	if err := syncer.Index(); err != nil {
+		return err
+	}
+	watcher, err := watch.New(dir, ignore, flagWatchInterval, flagWatchDebounce)
+	if err != nil {
+		return fmt.Errorf("scanning %s: %w", args[0], err)
+	}
+
+	printWatchResults(syncer.Reconcile(watcher.Snapshot()))
+	output.Infof("Watching %s (Ctrl+C to stop)\n", args[0])
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return watcher.Run(ctx, func(events []watch.Event) {
+		printWatchResults(syncer.Apply(events))
+	})
+}
+
+var watchActionLabels = map[string]string{
+	watch.ActionUploaded: "Uploaded",
+	watch.ActionReplaced: "Replaced",
+	watch.ActionCreated:  "Created directory",
+	watch.ActionDeleted:  "Deleted",
+}
+
+func printWatchResults(results []watch.Result) {
+	for _, res := range results {
+		if output.IsJSON() {
+			output.JSONLine(res)
+			continue
+		}
+		switch {
+		case output.IsQuiet() && res.Action != watch.ActionFailed:
+			// Quiet mode lists the IDs of the remote files written.
+			if res.Action != watch.ActionDeleted {
+				fmt.Println(res.FileID)
+			}
+		case res.Action == watch.ActionFailed:
+			fmt.Fprintf(os.Stderr, "  Failed: %s — %s\n", res.Path, res.Error)
+		case res.Error != "":
+			fmt.Fprintf(os.Stderr, "  %s: %s — %s\n", watchActionLabels[res.Action], res.Path, res.Error)
+		case res.Action == watch.ActionUploaded || res.Action == watch.ActionReplaced:
+			fmt.Printf("  %s: %s (%s)\n", watchActionLabels[res.Action], res.Path, output.FormatSize(res.Size))
+		default:
+			fmt.Printf("  %s: %s\n", watchActionLabels[res.Action], res.Path)
+		}
+	}
+}
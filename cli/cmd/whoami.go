@@ -21,12 +21,7 @@ var whoamiCmd = &cobra.Command{
 			return fmt.Errorf("fetching user: %w", err)
 		}
 
-		if flagJSON {
-			output.JSON(resp.Data)
-			return nil
-		}
-
-		output.UserInfo(resp.Data)
+		output.Emit(resp.Data, []string{resp.Data.ID}, func() { output.UserInfo(resp.Data) })
 		return nil
 	},
 }
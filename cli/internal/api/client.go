@@ -2,22 +2,42 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	mathrand "math/rand"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	defaultMaxRetries = 3
+	defaultRetryDelay = 500 * time.Millisecond
+	maxRetryDelay     = 10 * time.Second
+)
+
 // Client wraps HTTP calls to the DocShare API.
 type Client struct {
 	BaseURL    string
 	Token      string
 	HTTPClient *http.Client
+
+	// MaxRetries is how many times a request is retried after a network
+	// error or a 429, 502, 503 or 504. Only GET, PUT and DELETE requests,
+	// and POSTs sent with an idempotency key, are retried.
+	MaxRetries int
+	// RetryDelay is the backoff before the first retry. It doubles on each
+	// retry, with jitter, up to maxRetryDelay; a Retry-After header wins.
+	RetryDelay time.Duration
 }
 
 // NewClient creates a Client from a base API URL (e.g. http://localhost:8080/api) and bearer token.
@@ -28,9 +48,41 @@ func NewClient(baseURL, token string) *Client {
 		HTTPClient: &http.Client{
 			Timeout: 5 * time.Minute, // generous for large uploads
 		},
+		MaxRetries: defaultMaxRetries,
+		RetryDelay: defaultRetryDelay,
+	}
+}
+
+// RequestOption adjusts an outgoing request.
+type RequestOption func(*http.Request)
+
+// IdempotencyKeyHeader carries the key the server dedupes retried POSTs on.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// WithIdempotencyKey sends key as the Idempotency-Key header, which lets the
+// server recognise a retried POST and makes it safe to retry. Use one key
+// per logical operation.
+func WithIdempotencyKey(key string) RequestOption {
+	return func(req *http.Request) {
+		req.Header.Set(IdempotencyKeyHeader, key)
 	}
 }
 
+// NewIdempotencyKey returns a random key for WithIdempotencyKey.
+func NewIdempotencyKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// APIVersion is the API version the client is written against. It is sent
+// in the API-Version header, which servers that predate versioning ignore
+// and newer ones check, so requests keep working against both.
+const APIVersion = "v1"
+
+// APIVersionHeader names the requested API version.
+const APIVersionHeader = "API-Version"
+
 // --- generic response types matching the backend envelope ---
 
 // Response is the standard { success, data, error } envelope.
@@ -46,15 +98,26 @@ type Pagination struct {
 	Limit      int   `json:"limit"`
 	Total      int64 `json:"total"`
 	TotalPages int   `json:"totalPages"`
+
+	// Set instead of Page/Total when the request used ?cursor=.
+	NextCursor string `json:"nextCursor,omitempty"`
+	HasMore    bool   `json:"hasMore,omitempty"`
 }
 
-// APIError is returned when the server sends a non-2xx status.
+// APIError is returned when the server sends a non-2xx status. Code is the
+// server's machine-readable error code, when it sent one; branch on it
+// rather than on Message.
 type APIError struct {
-	Status  int
-	Message string
+	Status    int
+	Code      string
+	Message   string
+	RequestID string
 }
 
 func (e *APIError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("api: %d — %s (request %s)", e.Status, e.Message, e.RequestID)
+	}
 	return fmt.Sprintf("api: %d — %s", e.Status, e.Message)
 }
 
@@ -69,11 +132,79 @@ func (c *Client) newRequest(method, path string, body io.Reader) (*http.Request,
 	if c.Token != "" {
 		req.Header.Set("Authorization", "Bearer "+c.Token)
 	}
+	req.Header.Set(APIVersionHeader, APIVersion)
 	return req, nil
 }
 
-func (c *Client) doJSON(req *http.Request, out interface{}) error {
-	resp, err := c.HTTPClient.Do(req)
+// send performs the request made by build, retrying when that is safe.
+// build is called again for every attempt so each gets a fresh body. The
+// last response is returned whatever its status.
+func (c *Client) send(build func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := build()
+		if err != nil {
+			return nil, err
+		}
+		retry := attempt < c.MaxRetries && canRetry(req)
+
+		resp, err := c.HTTPClient.Do(req)
+		if err != nil {
+			if !retry || errors.Is(err, context.Canceled) {
+				return nil, err
+			}
+			time.Sleep(c.backoff(attempt, 0))
+			continue
+		}
+		if !retry || !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		wait := c.backoff(attempt, retryAfter(resp))
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		time.Sleep(wait)
+	}
+}
+
+func canRetry(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter reads a Retry-After header given in seconds.
+func retryAfter(resp *http.Response) time.Duration {
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// backoff is the wait before retry number attempt+1: exponential with
+// jitter, so many clients failing together don't retry in lockstep.
+func (c *Client) backoff(attempt int, serverWait time.Duration) time.Duration {
+	if serverWait > 0 {
+		return min(serverWait, maxRetryDelay)
+	}
+	d := c.RetryDelay << attempt
+	if d <= 0 || d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d/2 + time.Duration(mathrand.Int63n(int64(d/2)+1))
+}
+
+func (c *Client) doJSON(build func() (*http.Request, error), out interface{}) error {
+	resp, err := c.send(build)
 	if err != nil {
 		return err
 	}
@@ -85,19 +216,7 @@ func (c *Client) doJSON(req *http.Request, out interface{}) error {
 	}
 
 	if resp.StatusCode >= 400 {
-		// Try to extract the server's error message.
-		var errResp struct {
-			Error            string `json:"error"`
-			ErrorDescription string `json:"error_description"` // OAuth2 endpoints
-		}
-		if json.Unmarshal(data, &errResp) == nil && (errResp.Error != "" || errResp.ErrorDescription != "") {
-			msg := errResp.Error
-			if errResp.ErrorDescription != "" {
-				msg = errResp.ErrorDescription
-			}
-			return &APIError{Status: resp.StatusCode, Message: msg}
-		}
-		return &APIError{Status: resp.StatusCode, Message: string(data)}
+		return responseError(resp, data)
 	}
 
 	if out != nil {
@@ -108,129 +227,165 @@ func (c *Client) doJSON(req *http.Request, out interface{}) error {
 	return nil
 }
 
+// responseError turns a failed response, whose body has been read into
+// data, into an APIError carrying the server's message when it sent one.
+func responseError(resp *http.Response, data []byte) error {
+	// Try to extract the server's error message.
+	var errResp struct {
+		Error            string `json:"error"`
+		Code             string `json:"code"`
+		RequestID        string `json:"requestID"`
+		ErrorDescription string `json:"error_description"` // OAuth2 endpoints
+	}
+	requestID := resp.Header.Get("X-Request-ID")
+	if json.Unmarshal(data, &errResp) == nil && (errResp.Error != "" || errResp.ErrorDescription != "") {
+		msg := errResp.Error
+		if errResp.ErrorDescription != "" {
+			msg = errResp.ErrorDescription
+		}
+		if errResp.RequestID != "" {
+			requestID = errResp.RequestID
+		}
+		return &APIError{Status: resp.StatusCode, Code: errResp.Code, Message: msg, RequestID: requestID}
+	}
+	return &APIError{Status: resp.StatusCode, Message: string(data), RequestID: requestID}
+}
+
 // Get sends a GET request and decodes the JSON body into out.
 func (c *Client) Get(path string, params url.Values, out interface{}) error {
 	if len(params) > 0 {
 		path += "?" + params.Encode()
 	}
-	req, err := c.newRequest(http.MethodGet, path, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Accept", "application/json")
-	return c.doJSON(req, out)
-}
-
-// Post sends a POST with a JSON body.
-func (c *Client) Post(path string, body interface{}, out interface{}) error {
-	var r io.Reader
-	if body != nil {
-		data, err := json.Marshal(body)
+	return c.doJSON(func() (*http.Request, error) {
+		req, err := c.newRequest(http.MethodGet, path, nil)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		r = bytes.NewReader(data)
-	}
-	req, err := c.newRequest(http.MethodPost, path, r)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	return c.doJSON(req, out)
+		req.Header.Set("Accept", "application/json")
+		return req, nil
+	}, out)
+}
+
+// Post sends a POST with a JSON body. It is only retried when sent with
+// WithIdempotencyKey.
+func (c *Client) Post(path string, body interface{}, out interface{}, opts ...RequestOption) error {
+	return c.sendJSON(http.MethodPost, path, body, out, opts)
 }
 
 // PostForm sends a POST with form-encoded body (for OAuth2 device flow endpoints).
 func (c *Client) PostForm(path string, values url.Values, out interface{}) error {
-	req, err := c.newRequest(http.MethodPost, path, strings.NewReader(values.Encode()))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Accept", "application/json")
-	return c.doJSON(req, out)
+	encoded := values.Encode()
+	return c.doJSON(func() (*http.Request, error) {
+		req, err := c.newRequest(http.MethodPost, path, strings.NewReader(encoded))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
+		return req, nil
+	}, out)
 }
 
 // Put sends a PUT with a JSON body.
 func (c *Client) Put(path string, body interface{}, out interface{}) error {
-	var r io.Reader
+	return c.sendJSON(http.MethodPut, path, body, out, nil)
+}
+
+func (c *Client) sendJSON(method, path string, body interface{}, out interface{}, opts []RequestOption) error {
+	var data []byte
 	if body != nil {
-		data, err := json.Marshal(body)
-		if err != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
 			return err
 		}
-		r = bytes.NewReader(data)
-	}
-	req, err := c.newRequest(http.MethodPut, path, r)
-	if err != nil {
-		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	return c.doJSON(req, out)
+	return c.doJSON(func() (*http.Request, error) {
+		var r io.Reader
+		if data != nil {
+			r = bytes.NewReader(data)
+		}
+		req, err := c.newRequest(method, path, r)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		for _, opt := range opts {
+			opt(req)
+		}
+		return req, nil
+	}, out)
 }
 
 // Delete sends a DELETE.
 func (c *Client) Delete(path string, out interface{}) error {
-	req, err := c.newRequest(http.MethodDelete, path, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Accept", "application/json")
-	return c.doJSON(req, out)
+	return c.doJSON(func() (*http.Request, error) {
+		req, err := c.newRequest(http.MethodDelete, path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		return req, nil
+	}, out)
 }
 
-// Upload sends a multipart file upload.
-func (c *Client) Upload(path, fieldName, filePath string, extraFields map[string]string, out interface{}) error {
-	f, err := os.Open(filePath)
-	if err != nil {
-		return fmt.Errorf("opening file: %w", err)
-	}
-	defer f.Close()
-
-	fi, err := f.Stat()
+// Upload sends a multipart file upload. The file is streamed from disk,
+// and read again if the upload is retried, which only happens when sent
+// with WithIdempotencyKey.
+func (c *Client) Upload(path, fieldName, filePath string, extraFields map[string]string, out interface{}, opts ...RequestOption) error {
+	fi, err := os.Stat(filePath)
 	if err != nil {
 		return fmt.Errorf("stat file: %w", err)
 	}
 
-	pr, pw := io.Pipe()
-	writer := multipart.NewWriter(pw)
+	return c.doJSON(func() (*http.Request, error) {
+		f, err := os.Open(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("opening file: %w", err)
+		}
 
-	go func() {
-		defer pw.Close()
-		defer writer.Close()
+		pr, pw := io.Pipe()
+		writer := multipart.NewWriter(pw)
 
-		for k, v := range extraFields {
-			_ = writer.WriteField(k, v)
-		}
+		go func() {
+			defer f.Close()
+			defer pw.Close()
+			defer writer.Close()
+
+			for k, v := range extraFields {
+				_ = writer.WriteField(k, v)
+			}
 
-		part, err := writer.CreateFormFile(fieldName, fi.Name())
+			part, err := writer.CreateFormFile(fieldName, fi.Name())
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if _, err := io.Copy(part, f); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}()
+
+		req, err := c.newRequest(http.MethodPost, path, pr)
 		if err != nil {
-			pw.CloseWithError(err)
-			return
+			pr.Close()
+			return nil, err
 		}
-		if _, err := io.Copy(part, f); err != nil {
-			pw.CloseWithError(err)
-			return
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Accept", "application/json")
+		for _, opt := range opts {
+			opt(req)
 		}
-	}()
-
-	req, err := c.newRequest(http.MethodPost, path, pr)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("Accept", "application/json")
-	return c.doJSON(req, out)
+		return req, nil
+	}, out)
 }
 
 // DownloadToFile streams a GET response body directly to a file on disk.
 func (c *Client) DownloadToFile(rawURL, dest string) error {
-	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
-	if err != nil {
-		return err
-	}
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.send(func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, rawURL, nil)
+	})
 	if err != nil {
 		return err
 	}
@@ -251,13 +406,46 @@ func (c *Client) DownloadToFile(rawURL, dest string) error {
 	return err
 }
 
-func (c *Client) UploadTransferFile(path string, file *os.File, size int64) error {
-	req, err := c.newRequest(http.MethodPost, path, file)
+// GetToFile sends an authenticated GET and writes the response body to
+// dest, for endpoints that answer with a file rather than JSON.
+func (c *Client) GetToFile(path string, params url.Values, dest string) error {
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	resp, err := c.send(func() (*http.Request, error) {
+		return c.newRequest(http.MethodGet, path, nil)
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		data, _ := io.ReadAll(resp.Body)
+		return responseError(resp, data)
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// UploadTransferChunk sends one chunk of a relayed transfer. Chunks may be
+// sent in any order, and sending an index again replaces it.
+func (c *Client) UploadTransferChunk(path string, chunk []byte, index, total int) error {
+	req, err := c.newRequest(http.MethodPost, path, bytes.NewReader(chunk))
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/octet-stream")
-	req.Header.Set("Content-Length", fmt.Sprintf("%d", size))
+	req.Header.Set("X-Chunk-Index", strconv.Itoa(index))
+	req.Header.Set("X-Chunk-Total", strconv.Itoa(total))
 	req.Header.Set("Accept", "application/json")
 
 	resp, err := c.HTTPClient.Do(req)
@@ -2,11 +2,15 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewClient(t *testing.T) {
@@ -60,6 +64,9 @@ func TestClient_Get(t *testing.T) {
 			if r.Header.Get("Accept") != "application/json" {
 				t.Errorf("expected Accept header 'application/json', got %s", r.Header.Get("Accept"))
 			}
+			if r.Header.Get(APIVersionHeader) != APIVersion {
+				t.Errorf("expected API-Version header %q, got %q", APIVersion, r.Header.Get(APIVersionHeader))
+			}
 			w.WriteHeader(http.StatusOK)
 			_ = json.NewEncoder(w).Encode(map[string]string{"message": "ok"})
 		}))
@@ -115,6 +122,29 @@ func TestClient_Get(t *testing.T) {
 			t.Errorf("expected status 404, got %d", apiErr.Status)
 		}
 	})
+
+	t.Run("captures error code and request ID", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Request-ID", "req-42")
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]any{"success": false, "error": "file not found", "code": "file_not_found", "requestID": "req-42"})
+		}))
+		defer server.Close()
+
+		client := NewClient(server.URL, "")
+		err := client.Get("/test", nil, nil)
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("expected APIError, got %T", err)
+		}
+		if apiErr.Code != "file_not_found" || apiErr.RequestID != "req-42" {
+			t.Errorf("expected code and request ID to be captured, got %+v", apiErr)
+		}
+		if expected := "api: 404 — file not found (request req-42)"; apiErr.Error() != expected {
+			t.Errorf("expected error message %q, got %q", expected, apiErr.Error())
+		}
+	})
 }
 
 func TestClient_Post(t *testing.T) {
@@ -286,6 +316,116 @@ func TestClient_Upload(t *testing.T) {
 	})
 }
 
+func TestClient_Retry(t *testing.T) {
+	// flaky fails the first n requests with status, then succeeds, and
+	// records what each attempt saw.
+	flaky := func(n, status int) (*httptest.Server, *[]*http.Request, *[]string) {
+		var reqs []*http.Request
+		var bodies []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			reqs = append(reqs, r)
+			bodies = append(bodies, string(body))
+			if len(reqs) <= n {
+				w.WriteHeader(status)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"id": "ok"})
+		}))
+		return server, &reqs, &bodies
+	}
+	newClient := func(url string) *Client {
+		client := NewClient(url, "")
+		client.RetryDelay = time.Millisecond
+		return client
+	}
+
+	t.Run("retries GET on 503", func(t *testing.T) {
+		server, reqs, _ := flaky(2, http.StatusServiceUnavailable)
+		defer server.Close()
+
+		var result map[string]string
+		if err := newClient(server.URL).Get("/test", nil, &result); err != nil {
+			t.Fatalf("Get() returned error: %v", err)
+		}
+		if len(*reqs) != 3 || result["id"] != "ok" {
+			t.Errorf("expected success on the third attempt, got %d attempts, %v", len(*reqs), result)
+		}
+	})
+
+	t.Run("gives up after MaxRetries", func(t *testing.T) {
+		server, reqs, _ := flaky(10, http.StatusBadGateway)
+		defer server.Close()
+
+		err := newClient(server.URL).Delete("/test", nil)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadGateway {
+			t.Fatalf("expected the last 502, got %v", err)
+		}
+		if len(*reqs) != defaultMaxRetries+1 {
+			t.Errorf("expected %d attempts, got %d", defaultMaxRetries+1, len(*reqs))
+		}
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		server, reqs, _ := flaky(1, http.StatusInternalServerError)
+		defer server.Close()
+
+		if err := newClient(server.URL).Get("/test", nil, nil); err == nil {
+			t.Fatal("expected an error")
+		}
+		if len(*reqs) != 1 {
+			t.Errorf("expected one attempt, got %d", len(*reqs))
+		}
+	})
+
+	t.Run("does not retry POST without an idempotency key", func(t *testing.T) {
+		server, reqs, _ := flaky(1, http.StatusServiceUnavailable)
+		defer server.Close()
+
+		if err := newClient(server.URL).Post("/test", map[string]string{"name": "x"}, nil); err == nil {
+			t.Fatal("expected an error")
+		}
+		if len(*reqs) != 1 {
+			t.Errorf("expected one attempt, got %d", len(*reqs))
+		}
+	})
+
+	t.Run("retries POST with the same key and body", func(t *testing.T) {
+		server, reqs, bodies := flaky(1, http.StatusServiceUnavailable)
+		defer server.Close()
+
+		key := NewIdempotencyKey()
+		if err := newClient(server.URL).Post("/test", map[string]string{"name": "x"}, nil, WithIdempotencyKey(key)); err != nil {
+			t.Fatalf("Post() returned error: %v", err)
+		}
+		if len(*reqs) != 2 {
+			t.Fatalf("expected two attempts, got %d", len(*reqs))
+		}
+		for i, r := range *reqs {
+			if r.Header.Get(IdempotencyKeyHeader) != key || (*bodies)[i] != `{"name":"x"}` {
+				t.Errorf("attempt %d sent key %q body %q", i, r.Header.Get(IdempotencyKeyHeader), (*bodies)[i])
+			}
+		}
+	})
+
+	t.Run("retries uploads with a key from the start of the file", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "test.txt")
+		if err := os.WriteFile(filePath, []byte("test file content"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		server, reqs, bodies := flaky(1, http.StatusTooManyRequests)
+		defer server.Close()
+
+		if err := newClient(server.URL).Upload("/files/upload", "file", filePath, nil, nil, WithIdempotencyKey("k")); err != nil {
+			t.Fatalf("Upload() returned error: %v", err)
+		}
+		if len(*reqs) != 2 || !strings.Contains((*bodies)[1], "test file content") {
+			t.Errorf("expected the whole file resent, got %d attempts", len(*reqs))
+		}
+	})
+}
+
 func TestClient_DownloadToFile(t *testing.T) {
 	t.Run("downloads file to disk", func(t *testing.T) {
 		content := []byte("downloaded content")
@@ -341,6 +481,49 @@ func TestClient_DownloadToFile(t *testing.T) {
 	})
 }
 
+func TestClient_GetToFile(t *testing.T) {
+	t.Run("sends auth and writes the body", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer tok" {
+				t.Errorf("expected the bearer token, got %q", r.Header.Get("Authorization"))
+			}
+			if r.URL.Path != "/files/1/quick-share/qr" || r.URL.Query().Get("format") != "svg" {
+				t.Errorf("unexpected request %s", r.URL)
+			}
+			w.Header().Set("Content-Type", "image/svg+xml")
+			_, _ = w.Write([]byte("<svg/>"))
+		}))
+		defer server.Close()
+
+		dest := filepath.Join(t.TempDir(), "qr.svg")
+		client := NewClient(server.URL, "tok")
+		if err := client.GetToFile("/files/1/quick-share/qr", map[string][]string{"format": {"svg"}}, dest); err != nil {
+			t.Fatalf("GetToFile() returned error: %v", err)
+		}
+		if data, _ := os.ReadFile(dest); string(data) != "<svg/>" {
+			t.Errorf("expected the body written, got %q", data)
+		}
+	})
+
+	t.Run("parses the server's error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"success":false,"error":"this file has no active quick-share link","code":"quick_share_not_found"}`))
+		}))
+		defer server.Close()
+
+		dest := filepath.Join(t.TempDir(), "qr.png")
+		err := NewClient(server.URL, "tok").GetToFile("/files/1/quick-share/qr", nil, dest)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != "quick_share_not_found" {
+			t.Fatalf("expected quick_share_not_found, got %v", err)
+		}
+		if _, err := os.Stat(dest); !os.IsNotExist(err) {
+			t.Errorf("expected no file written on error")
+		}
+	})
+}
+
 func TestResponse_Envelope(t *testing.T) {
 	t.Run("parses success response with pagination", func(t *testing.T) {
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
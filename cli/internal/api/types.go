@@ -17,6 +17,15 @@ type File struct {
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
 	Owner       *User     `json:"owner,omitempty"`
+	TotalSize   *int64    `json:"totalSize,omitempty"`
+	ItemCount   *int64    `json:"itemCount,omitempty"`
+	// VaultID is set on the contents of an encrypted folder, and on the
+	// folder itself.
+	VaultID *string `json:"vaultID,omitempty"`
+	// ArchivedAt is set while the file is in cold storage; RestoreETA once
+	// a restore has been requested.
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+	RestoreETA *time.Time `json:"restoreETA,omitempty"`
 }
 
 // User mirrors the backend User model.
@@ -39,6 +48,8 @@ type Share struct {
 	SharedWithGroupID *string   `json:"sharedWithGroupID,omitempty"`
 	Permission        string    `json:"permission"`
 	ExpiresAt         *string   `json:"expiresAt,omitempty"`
+	Watermark         bool      `json:"watermark,omitempty"`
+	ViewOnly          bool      `json:"viewOnly,omitempty"`
 	CreatedAt         time.Time `json:"createdAt"`
 
 	File           *File `json:"file,omitempty"`
@@ -46,6 +57,90 @@ type Share struct {
 	SharedWithUser *User `json:"sharedWithUser,omitempty"`
 }
 
+// QuickShare is returned by POST /files/:id/quick-share.
+type QuickShare struct {
+	Share     Share    `json:"share"`
+	URL       string   `json:"url"`
+	ExpiresAt *string  `json:"expiresAt"`
+	Created   bool     `json:"created"`
+	Replaced  []string `json:"replaced,omitempty"`
+}
+
+// Paste is returned by POST /pastes and GET /pastes.
+type Paste struct {
+	ID        string    `json:"id"`
+	FileID    string    `json:"fileID"`
+	Language  string    `json:"language,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	File      *File     `json:"file,omitempty"`
+}
+
+// PasteResult is returned by POST /pastes. Share, URL and ExpiresAt are set
+// for public pastes only.
+type PasteResult struct {
+	Paste     Paste   `json:"paste"`
+	Share     *Share  `json:"share,omitempty"`
+	URL       string  `json:"url,omitempty"`
+	ExpiresAt *string `json:"expiresAt,omitempty"`
+}
+
+// ImportJob mirrors an admin import from GET /admin/imports/:id.
+type ImportJob struct {
+	ID             string          `json:"id"`
+	SourceType     string          `json:"sourceType"`
+	Source         string          `json:"source"`
+	Prefix         string          `json:"prefix,omitempty"`
+	TargetFolder   string          `json:"targetFolder"`
+	Status         string          `json:"status"`
+	Cursor         string          `json:"cursor,omitempty"`
+	FilesImported  int64           `json:"filesImported"`
+	FoldersCreated int64           `json:"foldersCreated"`
+	BytesImported  int64           `json:"bytesImported"`
+	FilesSkipped   int64           `json:"filesSkipped"`
+	FilesFailed    int64           `json:"filesFailed"`
+	Failures       []ImportFailure `json:"failures,omitempty"`
+	LastError      string          `json:"lastError,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	FinishedAt     *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// ImportFailure is one file an import could not bring in.
+type ImportFailure struct {
+	Key   string `json:"key"`
+	Error string `json:"error"`
+}
+
+// ArchiveRestore is returned by POST /files/:id/archive/restore.
+type ArchiveRestore struct {
+	Files int64     `json:"files"`
+	ETA   time.Time `json:"eta"`
+}
+
+// MirrorStatus mirrors GET /admin/storage/mirror.
+type MirrorStatus struct {
+	Enabled         bool       `json:"enabled"`
+	Deletes         bool       `json:"deletes"`
+	Pending         int64      `json:"pending"`
+	Failed          int64      `json:"failed"`
+	LagSeconds      int64      `json:"lagSeconds"`
+	OldestPendingAt *time.Time `json:"oldestPendingAt,omitempty"`
+	LastMirroredAt  *time.Time `json:"lastMirroredAt,omitempty"`
+	Copied          int64      `json:"copied"`
+	Deleted         int64      `json:"deleted"`
+	Backfill        *Job       `json:"backfill,omitempty"`
+}
+
+// Job is a background job on the server.
+type Job struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	Status     string     `json:"status"`
+	LastError  string     `json:"lastError,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
 // PathSegment represents a breadcrumb element from the /files/:id/path endpoint.
 type PathSegment struct {
 	ID   string `json:"id"`
@@ -86,6 +181,23 @@ type LoginResponse struct {
 type VersionInfo struct {
 	Version    string `json:"version"`
 	APIVersion string `json:"apiVersion"`
+	// SupportedVersions is empty on servers that predate API versioning.
+	SupportedVersions []string `json:"supportedVersions,omitempty"`
+	// Capabilities is nil on servers that predate capability discovery.
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+}
+
+// Capabilities describes what the server has enabled.
+type Capabilities struct {
+	Registration  string `json:"registration"`
+	PublicSharing bool   `json:"publicSharing"`
+	Transfers     bool   `json:"transfers"`
+	Uploads       struct {
+		MaxBytes     int64 `json:"maxBytes"`
+		MaxBodyBytes int64 `json:"maxBodyBytes"`
+		Presigned    bool  `json:"presigned"`
+		Chunked      bool  `json:"chunked"`
+	} `json:"uploads"`
 }
 
 type Transfer struct {
@@ -100,6 +212,9 @@ type TransferCreateRequest struct {
 	FileName string `json:"fileName"`
 	FileSize int64  `json:"fileSize"`
 	Timeout  *int   `json:"timeout,omitempty"`
+	// AllowAnonymous asks for a receive link and PIN that work without an
+	// account.
+	AllowAnonymous bool `json:"allowAnonymous,omitempty"`
 }
 
 type TransferCreateResponse struct {
@@ -107,6 +222,9 @@ type TransferCreateResponse struct {
 	FileName  string `json:"fileName"`
 	FileSize  int64  `json:"fileSize"`
 	ExpiresAt string `json:"expiresAt"`
+	// ReceiveURL and PIN are set for anonymous transfers.
+	ReceiveURL string `json:"receiveURL,omitempty"`
+	PIN        string `json:"pin,omitempty"`
 }
 
 type TransferStatusResponse struct {
@@ -116,4 +234,50 @@ type TransferStatusResponse struct {
 	FileSize    int64  `json:"fileSize"`
 	ExpiresAt   string `json:"expiresAt"`
 	RecipientID string `json:"recipientID,omitempty"`
+	RecipientIP string `json:"recipientIP,omitempty"`
+}
+
+// TransferSaveResponse is returned when the recipient saves a transfer to
+// their files.
+type TransferSaveResponse struct {
+	Status string `json:"status"`
+	File   File   `json:"file"`
+}
+
+// TransferChunkRange is an inclusive run of chunk indexes.
+type TransferChunkRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// TransferProgressResponse is the server's view of a chunked upload.
+type TransferProgressResponse struct {
+	Status         string               `json:"status"`
+	ChunkTotal     int                  `json:"chunkTotal"`
+	ReceivedChunks int                  `json:"receivedChunks"`
+	ReceivedBytes  int64                `json:"receivedBytes"`
+	Missing        []TransferChunkRange `json:"missing"`
+}
+
+// UserKey is a public key a user registered for encrypted folders.
+type UserKey struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Algorithm   string    `json:"algorithm"`
+	PublicKey   string    `json:"publicKey"`
+	Fingerprint string    `json:"fingerprint"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// WrappedKey is a folder key wrapped for one user key.
+type WrappedKey struct {
+	KeyID      string `json:"keyID"`
+	WrappedKey string `json:"wrappedKey"`
+}
+
+// VaultResponse is the vault a file is in and its folder key wrapped for
+// each of the current user's keys.
+type VaultResponse struct {
+	VaultID string       `json:"vaultID"`
+	Keys    []WrappedKey `json:"keys"`
 }
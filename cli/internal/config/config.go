@@ -31,6 +31,16 @@ func Path() (string, error) {
 	return filepath.Join(dir, dirName, fileName), nil
 }
 
+// KeyPath returns where the private key that opens encrypted folders is
+// kept, next to the config file.
+func KeyPath() (string, error) {
+	p, err := Path()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(p), "vault-key.json"), nil
+}
+
 // Load reads the config from disk. Returns a zero-value Config (not an error) if the file doesn't exist.
 func Load() (*Config, error) {
 	p, err := Path()
@@ -11,6 +11,83 @@ import (
 	"github.com/docshare/cli/internal/api"
 )
 
+// Mode selects how commands print their results.
+type Mode string
+
+const (
+	// ModeTable is human-readable text and tables.
+	ModeTable Mode = "table"
+	// ModeJSON prints each command's result as JSON on stdout, and errors as
+	// JSON on stderr.
+	ModeJSON Mode = "json"
+	// ModeQuiet prints only the IDs (or paths) a script needs, one per line.
+	ModeQuiet Mode = "quiet"
+)
+
+// Modes lists the accepted --output values.
+var Modes = []Mode{ModeTable, ModeJSON, ModeQuiet}
+
+var current = ModeTable
+
+// ParseMode validates an --output value.
+func ParseMode(s string) (Mode, error) {
+	for _, m := range Modes {
+		if strings.EqualFold(s, string(m)) {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("invalid output mode %q: must be json, table or quiet", s)
+}
+
+// SetMode sets the mode for the rest of the process.
+func SetMode(m Mode) {
+	current = m
+}
+
+// IsJSON reports whether results should be printed as JSON.
+func IsJSON() bool {
+	return current == ModeJSON
+}
+
+// IsQuiet reports whether only IDs should be printed.
+func IsQuiet() bool {
+	return current == ModeQuiet
+}
+
+// Emit prints a command's result: v as JSON, ids one per line in quiet
+// mode, or whatever table prints for humans.
+func Emit(v interface{}, ids []string, table func()) {
+	switch current {
+	case ModeJSON:
+		JSON(v)
+	case ModeQuiet:
+		for _, id := range ids {
+			fmt.Println(id)
+		}
+	default:
+		table()
+	}
+}
+
+// Infof prints progress for humans. It is silent in JSON and quiet modes
+// so stdout carries only the result.
+func Infof(format string, a ...interface{}) {
+	if current == ModeTable {
+		fmt.Printf(format, a...)
+	}
+}
+
+// Noticef prints something the user has to see whatever the mode, such as
+// a code to type into a browser. It goes to stderr when stdout is reserved
+// for the result.
+func Noticef(format string, a ...interface{}) {
+	if current == ModeTable {
+		fmt.Printf(format, a...)
+		return
+	}
+	fmt.Fprintf(os.Stderr, format, a...)
+}
+
 // JSON prints v as indented JSON to stdout.
 func JSON(v interface{}) {
 	enc := json.NewEncoder(os.Stdout)
@@ -18,6 +95,12 @@ func JSON(v interface{}) {
 	_ = enc.Encode(v)
 }
 
+// JSONLine prints v as a single line of JSON, for commands that stream
+// results.
+func JSONLine(v interface{}) {
+	_ = json.NewEncoder(os.Stdout).Encode(v)
+}
+
 // FileTable prints a slice of files as a human-readable table.
 func FileTable(files []api.File) {
 	if len(files) == 0 {
@@ -37,11 +120,16 @@ func FileTable(files []api.File) {
 		size := FormatSize(f.Size)
 		if f.IsDirectory {
 			size = "-"
+			if f.TotalSize != nil {
+				size = FormatSize(*f.TotalSize)
+			}
 		}
 
 		kind := shortMIME(f.MimeType)
 		if f.IsDirectory {
 			kind = "dir"
+		} else if f.ArchivedAt != nil {
+			kind += " (archived)"
 		}
 
 		shared := "-"
@@ -64,6 +152,8 @@ func FileDetail(f api.File) {
 	fmt.Fprintf(w, "Type:\t%s\n", f.MimeType)
 	if !f.IsDirectory {
 		fmt.Fprintf(w, "Size:\t%s\n", FormatSize(f.Size))
+	} else if f.TotalSize != nil && f.ItemCount != nil {
+		fmt.Fprintf(w, "Size:\t%s in %d item(s)\n", FormatSize(*f.TotalSize), *f.ItemCount)
 	}
 	fmt.Fprintf(w, "Directory:\t%v\n", f.IsDirectory)
 	if f.ParentID != nil {
@@ -76,6 +166,12 @@ func FileDetail(f api.File) {
 	if f.SharedWith > 0 {
 		fmt.Fprintf(w, "Shared With:\t%d user(s)\n", f.SharedWith)
 	}
+	if f.ArchivedAt != nil {
+		fmt.Fprintf(w, "Archived:\t%s\n", f.ArchivedAt.Format(time.RFC3339))
+		if f.RestoreETA != nil {
+			fmt.Fprintf(w, "Restore ETA:\t%s\n", f.RestoreETA.Format(time.RFC3339))
+		}
+	}
 	fmt.Fprintf(w, "Created:\t%s\n", f.CreatedAt.Format(time.RFC3339))
 	fmt.Fprintf(w, "Modified:\t%s\n", f.UpdatedAt.Format(time.RFC3339))
 	w.Flush()
@@ -151,6 +247,9 @@ func VersionInfo(cliVersion string, server *api.VersionInfo) {
 	if server != nil {
 		fmt.Fprintf(w, "Server version:\t%s\n", server.Version)
 		fmt.Fprintf(w, "API version:\t%s\n", server.APIVersion)
+		if len(server.SupportedVersions) > 0 {
+			fmt.Fprintf(w, "Supported API versions:\t%s\n", strings.Join(server.SupportedVersions, ", "))
+		}
 	} else {
 		fmt.Fprintf(w, "Server version:\tunreachable\n")
 	}
@@ -1,12 +1,16 @@
 package pathutil
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/docshare/cli/internal/api"
 )
 
+// ErrNotFound is wrapped by Resolve when a path segment does not exist.
+var ErrNotFound = errors.New("not found")
+
 // Resolve converts a human-readable path (e.g. "/Documents/Reports") to the UUID of the
 // final segment by walking the API directory tree from root. An empty or "/" path means root.
 // A valid UUID is returned as-is (passthrough).
@@ -34,7 +38,7 @@ func Resolve(client *api.Client, path string) (string, error) {
 			continue
 		}
 
-		children, err := listChildren(client, currentID)
+		children, err := List(client, currentID)
 		if err != nil {
 			return "", fmt.Errorf("listing %q: %w", segment, err)
 		}
@@ -49,16 +53,18 @@ func Resolve(client *api.Client, path string) (string, error) {
 		}
 		if !found {
 			if currentID == "" {
-				return "", fmt.Errorf("not found in root: %s", segment)
+				return "", fmt.Errorf("%w in root: %s", ErrNotFound, segment)
 			}
-			return "", fmt.Errorf("not found: %s", segment)
+			return "", fmt.Errorf("%w: %s", ErrNotFound, segment)
 		}
 	}
 
 	return currentID, nil
 }
 
-func listChildren(client *api.Client, parentID string) ([]api.File, error) {
+// List returns the first page of a folder's children, or of the root when
+// parentID is empty.
+func List(client *api.Client, parentID string) ([]api.File, error) {
 	var resp api.Response[[]api.File]
 	var err error
 	if parentID == "" {
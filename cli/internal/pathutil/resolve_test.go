@@ -2,6 +2,7 @@ package pathutil
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -126,6 +127,9 @@ func TestResolve(t *testing.T) {
 		if err == nil {
 			t.Fatal("expected error for non-existent path")
 		}
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
 	})
 
 	t.Run("not found in subdirectory returns error", func(t *testing.T) {
@@ -0,0 +1,299 @@
+// Package vault encrypts files for DocShare's end-to-end encrypted folders.
+//
+// Each vault has a random 32-byte folder key. The folder key is stored on
+// the server only wrapped for the X25519 public keys of the users who can
+// open the vault, and files are encrypted with keys derived from it, so
+// the server never holds anything it can decrypt.
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// KeySize is the size of folder keys and X25519 keys.
+const KeySize = 32
+
+const (
+	wrapInfo = "docshare vault key wrap"
+	fileInfo = "docshare vault file"
+	// chunkSize is how much plaintext each sealed chunk of a file holds.
+	chunkSize = 64 * 1024
+)
+
+// magic starts every encrypted file, so that a file uploaded without
+// encryption is not mistaken for one.
+var magic = []byte("DSV1")
+
+var (
+	ErrNotEncrypted = errors.New("not an encrypted vault file")
+	ErrCorrupt      = errors.New("encrypted file is corrupt or was encrypted with another key")
+)
+
+// NewFolderKey returns a random folder key.
+func NewFolderKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Wrap encrypts folderKey for the X25519 public key recipient, given in
+// base64 as the server returns it. The result, also base64, is an
+// ephemeral public key, a nonce and the sealed folder key.
+func Wrap(recipient string, folderKey []byte) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(recipient)
+	if err != nil {
+		return "", fmt.Errorf("decoding public key: %w", err)
+	}
+	pub, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return "", err
+	}
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	aead, err := wrapAEAD(eph, pub, eph.PublicKey())
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	out := append(eph.PublicKey().Bytes(), nonce...)
+	out = aead.Seal(out, nonce, folderKey, nil)
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+// Unwrap recovers a folder key wrapped for priv.
+func Unwrap(priv *ecdh.PrivateKey, wrapped string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil || len(raw) < KeySize {
+		return nil, ErrCorrupt
+	}
+	eph, err := ecdh.X25519().NewPublicKey(raw[:KeySize])
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	aead, err := wrapAEAD(priv, eph, eph)
+	if err != nil {
+		return nil, err
+	}
+	rest := raw[KeySize:]
+	if len(rest) < aead.NonceSize() {
+		return nil, ErrCorrupt
+	}
+	key, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return key, nil
+}
+
+// wrapAEAD derives the key-wrapping cipher from the X25519 exchange
+// between priv and peer, salted with the ephemeral public key.
+func wrapAEAD(priv *ecdh.PrivateKey, peer, eph *ecdh.PublicKey) (cipher.AEAD, error) {
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hkdf.Key(sha256.New, shared, eph.Bytes(), wrapInfo, KeySize)
+	if err != nil {
+		return nil, err
+	}
+	return newGCM(key)
+}
+
+// Encrypt writes src to dst encrypted with a key derived from folderKey
+// and a random salt. The plaintext is sealed in chunks, each with its
+// index in the nonce and the last one marked, so chunks cannot be
+// reordered, dropped or cut off without Decrypt noticing.
+func Encrypt(dst io.Writer, src io.Reader, folderKey []byte) error {
+	salt := make([]byte, KeySize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	aead, err := fileAEAD(folderKey, salt)
+	if err != nil {
+		return err
+	}
+	if _, err := dst.Write(append(append([]byte{}, magic...), salt...)); err != nil {
+		return err
+	}
+
+	buf := make([]byte, chunkSize)
+	next := make([]byte, chunkSize)
+	n, err := io.ReadFull(src, buf)
+	for index := uint64(0); ; index++ {
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		last := err != nil
+		var m int
+		if !last {
+			// A full chunk is the last one only if nothing follows it.
+			m, err = io.ReadFull(src, next)
+			if err == io.EOF {
+				last = true
+			} else if err != nil && err != io.ErrUnexpectedEOF {
+				return err
+			}
+		}
+		if _, werr := dst.Write(aead.Seal(nil, chunkNonce(index, last), buf[:n], nil)); werr != nil {
+			return werr
+		}
+		if last {
+			return nil
+		}
+		buf, next = next, buf
+		n = m
+	}
+}
+
+// Decrypt reverses Encrypt.
+func Decrypt(dst io.Writer, src io.Reader, folderKey []byte) error {
+	header := make([]byte, len(magic)+KeySize)
+	if _, err := io.ReadFull(src, header); err != nil || string(header[:len(magic)]) != string(magic) {
+		return ErrNotEncrypted
+	}
+	aead, err := fileAEAD(folderKey, header[len(magic):])
+	if err != nil {
+		return err
+	}
+
+	sealed := chunkSize + aead.Overhead()
+	buf := make([]byte, sealed)
+	next := make([]byte, sealed)
+	n, err := io.ReadFull(src, buf)
+	for index := uint64(0); ; index++ {
+		if err != nil && err != io.ErrUnexpectedEOF {
+			if err == io.EOF {
+				return ErrCorrupt
+			}
+			return err
+		}
+		last := err != nil
+		var m int
+		if !last {
+			m, err = io.ReadFull(src, next)
+			if err == io.EOF {
+				last = true
+			} else if err != nil && err != io.ErrUnexpectedEOF {
+				return err
+			}
+		}
+		plain, oerr := aead.Open(buf[:0], chunkNonce(index, last), buf[:n], nil)
+		if oerr != nil {
+			return ErrCorrupt
+		}
+		if _, werr := dst.Write(plain); werr != nil {
+			return werr
+		}
+		if last {
+			return nil
+		}
+		buf, next = next, buf
+		n = m
+	}
+}
+
+func fileAEAD(folderKey, salt []byte) (cipher.AEAD, error) {
+	if len(folderKey) != KeySize {
+		return nil, fmt.Errorf("folder key must be %d bytes", KeySize)
+	}
+	key, err := hkdf.Key(sha256.New, folderKey, salt, fileInfo, KeySize)
+	if err != nil {
+		return nil, err
+	}
+	return newGCM(key)
+}
+
+// chunkNonce is the big-endian chunk index followed by a byte that is 1
+// for the last chunk.
+func chunkNonce(index uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], index)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Identity is the private key this machine opens vaults with, and the ID
+// the server gave its public key.
+type Identity struct {
+	KeyID      string `json:"key_id"`
+	PrivateKey []byte `json:"private_key"`
+}
+
+// NewIdentity generates a private key. KeyID is set once its public key
+// has been registered.
+func NewIdentity() (*Identity, error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{PrivateKey: priv.Bytes()}, nil
+}
+
+// Key returns the identity's private key.
+func (id *Identity) Key() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().NewPrivateKey(id.PrivateKey)
+}
+
+// PublicKey returns the base64 public key to register with the server.
+func (id *Identity) PublicKey() (string, error) {
+	priv, err := id.Key()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(priv.PublicKey().Bytes()), nil
+}
+
+// LoadIdentity reads the identity saved at path.
+func LoadIdentity(path string) (*Identity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var id Identity
+	if err := json.Unmarshal(data, &id); err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// SaveIdentity writes id to path, readable only by the current user.
+func SaveIdentity(path string, id *Identity) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(id, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,98 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestWrapUnwrap(t *testing.T) {
+	id, err := NewIdentity()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pub, err := id.PublicKey()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	folderKey, err := NewFolderKey()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wrapped, err := Wrap(pub, folderKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	priv, _ := id.Key()
+	got, err := Unwrap(priv, wrapped)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(got, folderKey) {
+		t.Fatal("unwrapped key differs from the wrapped one")
+	}
+
+	other, _ := NewIdentity()
+	otherPriv, _ := other.Key()
+	if _, err := Unwrap(otherPriv, wrapped); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected another key to fail to unwrap, got %v", err)
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key, _ := NewFolderKey()
+	sizes := []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 17}
+	for _, size := range sizes {
+		plain := make([]byte, size)
+		_, _ = rand.Read(plain)
+
+		var sealed bytes.Buffer
+		if err := Encrypt(&sealed, bytes.NewReader(plain), key); err != nil {
+			t.Fatalf("size %d: unexpected error: %v", size, err)
+		}
+		if size > 0 && bytes.Contains(sealed.Bytes(), plain) {
+			t.Fatalf("size %d: plaintext appears in the output", size)
+		}
+
+		var opened bytes.Buffer
+		if err := Decrypt(&opened, bytes.NewReader(sealed.Bytes()), key); err != nil {
+			t.Fatalf("size %d: unexpected error: %v", size, err)
+		}
+		if !bytes.Equal(opened.Bytes(), plain) {
+			t.Fatalf("size %d: round trip changed the content", size)
+		}
+	}
+}
+
+func TestDecryptRejectsTampering(t *testing.T) {
+	key, _ := NewFolderKey()
+	plain := make([]byte, 2*chunkSize+10)
+	var sealed bytes.Buffer
+	if err := Encrypt(&sealed, bytes.NewReader(plain), key); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data := sealed.Bytes()
+	header := len(magic) + KeySize
+	firstChunk := chunkSize + 16
+
+	tests := map[string][]byte{
+		"truncated at a chunk boundary": data[:header+firstChunk],
+		"flipped bit":                   append(append([]byte{}, data[:header+5]...), append([]byte{data[header+5] ^ 1}, data[header+6:]...)...),
+		"header only":                   data[:header],
+	}
+	for name, input := range tests {
+		if err := Decrypt(&bytes.Buffer{}, bytes.NewReader(input), key); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: expected ErrCorrupt, got %v", name, err)
+		}
+	}
+
+	other, _ := NewFolderKey()
+	if err := Decrypt(&bytes.Buffer{}, bytes.NewReader(data), other); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("wrong key: expected ErrCorrupt, got %v", err)
+	}
+	if err := Decrypt(&bytes.Buffer{}, bytes.NewReader([]byte("plain text")), key); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("plaintext: expected ErrNotEncrypted, got %v", err)
+	}
+}
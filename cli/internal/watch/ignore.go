@@ -0,0 +1,104 @@
+package watch
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile is the name of the ignore file read from the root of a watched
+// directory.
+const IgnoreFile = ".docshareignore"
+
+// Ignore holds patterns in a subset of .gitignore syntax: one glob per
+// line, "#" comments, "!" to re-include, a trailing "/" to match only
+// directories, and a "/" anywhere else to anchor the pattern to the root.
+// Unanchored patterns match any path component. The last matching pattern
+// wins.
+type Ignore struct {
+	patterns []ignorePattern
+}
+
+type ignorePattern struct {
+	glob     string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// LoadIgnore reads the ignore file in root. A missing file ignores nothing.
+func LoadIgnore(root string) (*Ignore, error) {
+	f, err := os.Open(filepath.Join(root, IgnoreFile))
+	if os.IsNotExist(err) {
+		return &Ignore{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseIgnore(f)
+}
+
+// ParseIgnore reads patterns from r.
+func ParseIgnore(r io.Reader) (*Ignore, error) {
+	ig := &Ignore{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var p ignorePattern
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			p.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		if _, err := path.Match(line, ""); err != nil {
+			return nil, err
+		}
+		p.glob = line
+		ig.patterns = append(ig.patterns, p)
+	}
+	return ig, scanner.Err()
+}
+
+// Match reports whether rel, a slash-separated path relative to the watched
+// root, is ignored.
+func (ig *Ignore) Match(rel string, isDir bool) bool {
+	if ig == nil {
+		return false
+	}
+	ignored := false
+	for _, p := range ig.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.matches(rel) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+func (p ignorePattern) matches(rel string) bool {
+	if p.anchored {
+		ok, _ := path.Match(p.glob, rel)
+		return ok
+	}
+	ok, _ := path.Match(p.glob, path.Base(rel))
+	return ok
+}
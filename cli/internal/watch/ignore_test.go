@@ -0,0 +1,51 @@
+package watch
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIgnore_Match(t *testing.T) {
+	ig, err := ParseIgnore(strings.NewReader(`
+# editor droppings
+*.swp
+~$*
+build/
+/notes/*.md
+*.log
+!keep.log
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"draft.swp", false, true},
+		{"docs/draft.swp", false, true},
+		{"~$report.docx", false, true},
+		{"build", true, true},
+		{"src/build", true, true},
+		{"build", false, false},
+		{"notes/todo.md", false, true},
+		{"archive/notes/todo.md", false, false},
+		{"debug.log", false, true},
+		{"keep.log", false, false},
+		{"report.pdf", false, false},
+	}
+	for _, tt := range tests {
+		if got := ig.Match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("Match(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+
+	if (*Ignore)(nil).Match("anything", false) {
+		t.Error("expected a nil Ignore to match nothing")
+	}
+	if _, err := ParseIgnore(strings.NewReader("[unclosed")); err == nil {
+		t.Error("expected a malformed pattern to be rejected")
+	}
+}
@@ -0,0 +1,237 @@
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docshare/cli/internal/api"
+)
+
+// Result describes what a Syncer did about one path.
+type Result struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	FileID string `json:"fileID,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Actions reported in Result.Action.
+const (
+	ActionCreated  = "created"
+	ActionUploaded = "uploaded"
+	ActionReplaced = "replaced"
+	ActionDeleted  = "deleted"
+	ActionFailed   = "failed"
+)
+
+// Syncer mirrors local changes into a remote folder, or the root when
+// DestID is empty. It keeps an index of the remote tree by relative path so
+// that a changed file replaces its remote copy instead of uploading a
+// second file with the same name.
+type Syncer struct {
+	Client *api.Client
+	Root   string
+	DestID string
+	// Delete removes remote files when their local copies are removed.
+	Delete bool
+
+	remote map[string]api.File
+}
+
+func NewSyncer(client *api.Client, root, destID string, deleteRemote bool) *Syncer {
+	return &Syncer{Client: client, Root: root, DestID: destID, Delete: deleteRemote, remote: map[string]api.File{}}
+}
+
+// Index lists the destination tree.
+func (s *Syncer) Index() error {
+	s.remote = map[string]api.File{}
+	return s.indexFolder(s.DestID, "")
+}
+
+func (s *Syncer) indexFolder(folderID, prefix string) error {
+	for page := 1; ; page++ {
+		params := url.Values{}
+		params.Set("page", strconv.Itoa(page))
+		params.Set("limit", "100")
+
+		endpoint := "/files/" + folderID + "/children"
+		if folderID == "" {
+			endpoint = "/files"
+		}
+		var resp api.Response[[]api.File]
+		if err := s.Client.Get(endpoint, params, &resp); err != nil {
+			return fmt.Errorf("listing %s: %w", displayPath(prefix), err)
+		}
+		for _, f := range resp.Data {
+			rel := path.Join(prefix, f.Name)
+			if _, dup := s.remote[rel]; dup {
+				continue
+			}
+			s.remote[rel] = f
+			if f.IsDirectory {
+				if err := s.indexFolder(f.ID, rel); err != nil {
+					return err
+				}
+			}
+		}
+		if resp.Pagination == nil || page >= resp.Pagination.TotalPages {
+			return nil
+		}
+	}
+}
+
+// Reconcile uploads the files in snap that are missing from the remote
+// tree or differ from it in size. It never deletes anything.
+func (s *Syncer) Reconcile(snap Snapshot) []Result {
+	var events []Event
+	for p, entry := range snap {
+		if entry.IsDir {
+			continue
+		}
+		if f, ok := s.remote[p]; ok && !f.IsDirectory && f.Size == entry.Size {
+			continue
+		}
+		events = append(events, Event{Path: p, Op: Write})
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	return s.Apply(events)
+}
+
+// Apply carries out events in order and reports what it did. Events that
+// need no remote change produce no result.
+func (s *Syncer) Apply(events []Event) []Result {
+	var results []Result
+	for _, ev := range events {
+		var res *Result
+		switch {
+		case ev.Op == Remove:
+			res = s.remove(ev.Path)
+		case ev.IsDir:
+			res = s.mkdir(ev.Path)
+		default:
+			res = s.upload(ev.Path)
+		}
+		if res != nil {
+			results = append(results, *res)
+		}
+	}
+	return results
+}
+
+func (s *Syncer) mkdir(rel string) *Result {
+	if f, ok := s.remote[rel]; ok && f.IsDirectory {
+		return nil
+	}
+	id, err := s.ensureDir(rel)
+	if err != nil {
+		return failed(rel, err)
+	}
+	return &Result{Path: rel, Action: ActionCreated, FileID: id}
+}
+
+func (s *Syncer) upload(rel string) *Result {
+	parentID, err := s.ensureDir(path.Dir(rel))
+	if err != nil {
+		return failed(rel, err)
+	}
+
+	var resp api.Response[api.File]
+	fields := map[string]string{}
+	if parentID != "" {
+		fields["parentID"] = parentID
+	}
+	if err := s.Client.Upload("/files/upload", "file", filepath.Join(s.Root, filepath.FromSlash(rel)), fields, &resp, api.WithIdempotencyKey(api.NewIdempotencyKey())); err != nil {
+		return failed(rel, err)
+	}
+
+	// The new copy is in place before the old one goes, so a failed upload
+	// never loses the remote file.
+	old, replaced := s.remote[rel]
+	s.remote[rel] = resp.Data
+	res := &Result{Path: rel, Action: ActionUploaded, FileID: resp.Data.ID, Size: resp.Data.Size}
+	if replaced {
+		res.Action = ActionReplaced
+		if err := s.deleteRemote(old.ID); err != nil {
+			res.Error = fmt.Sprintf("uploaded, but failed removing the previous copy: %v", err)
+		}
+	}
+	return res
+}
+
+func (s *Syncer) remove(rel string) *Result {
+	if !s.Delete {
+		return nil
+	}
+	f, ok := s.remote[rel]
+	if !ok {
+		// Never uploaded, or already gone with its parent directory.
+		return nil
+	}
+	if err := s.deleteRemote(f.ID); err != nil {
+		return failed(rel, err)
+	}
+	for p := range s.remote {
+		if p == rel || strings.HasPrefix(p, rel+"/") {
+			delete(s.remote, p)
+		}
+	}
+	return &Result{Path: rel, Action: ActionDeleted, FileID: f.ID}
+}
+
+// ensureDir returns the ID of the remote directory at rel, creating it and
+// any missing parents.
+func (s *Syncer) ensureDir(rel string) (string, error) {
+	if rel == "." || rel == "" {
+		return s.DestID, nil
+	}
+	if f, ok := s.remote[rel]; ok {
+		if !f.IsDirectory {
+			return "", fmt.Errorf("%s exists remotely as a file", rel)
+		}
+		return f.ID, nil
+	}
+	parentID, err := s.ensureDir(path.Dir(rel))
+	if err != nil {
+		return "", err
+	}
+
+	var resp api.Response[api.File]
+	body := map[string]interface{}{"name": path.Base(rel)}
+	if parentID != "" {
+		body["parentID"] = parentID
+	}
+	if err := s.Client.Post("/files/directory", body, &resp); err != nil {
+		return "", fmt.Errorf("creating directory %s: %w", rel, err)
+	}
+	s.remote[rel] = resp.Data
+	return resp.Data.ID, nil
+}
+
+func (s *Syncer) deleteRemote(id string) error {
+	var resp api.Response[map[string]string]
+	err := s.Client.Delete("/files/"+id, &resp)
+	var apiErr *api.APIError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func failed(rel string, err error) *Result {
+	return &Result{Path: rel, Action: ActionFailed, Error: err.Error()}
+}
+
+func displayPath(rel string) string {
+	if rel == "" {
+		return "destination folder"
+	}
+	return rel
+}
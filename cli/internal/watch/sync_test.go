@@ -0,0 +1,142 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docshare/cli/internal/api"
+)
+
+// fakeServer keeps a flat table of remote files and answers the handful of
+// endpoints the syncer uses.
+type fakeServer struct {
+	mu      sync.Mutex
+	files   map[string]api.File
+	nextID  int
+	deleted []string
+}
+
+func (f *fakeServer) add(name, parentID string, isDir bool, size int64) api.File {
+	f.nextID++
+	file := api.File{ID: fmt.Sprintf("id-%d", f.nextID), Name: name, IsDirectory: isDir, Size: size}
+	if parentID != "" {
+		file.ParentID = &parentID
+	}
+	f.files[file.ID] = file
+	return file
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reply := func(v interface{}) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": v})
+	}
+
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/children"):
+		parentID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/files/"), "/children")
+		children := []api.File{}
+		for _, file := range f.files {
+			if file.ParentID != nil && *file.ParentID == parentID {
+				children = append(children, file)
+			}
+		}
+		reply(children)
+	case r.Method == http.MethodPost && r.URL.Path == "/files/directory":
+		var body struct {
+			Name     string `json:"name"`
+			ParentID string `json:"parentID"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		reply(f.add(body.Name, body.ParentID, true, 0))
+	case r.Method == http.MethodPost && r.URL.Path == "/files/upload":
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		n, _ := io.Copy(io.Discard, file)
+		reply(f.add(header.Filename, r.FormValue("parentID"), false, n))
+	case r.Method == http.MethodDelete:
+		id := strings.TrimPrefix(r.URL.Path, "/files/")
+		f.deleted = append(f.deleted, id)
+		delete(f.files, id)
+		reply(map[string]string{"message": "deleted"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestSyncer(t *testing.T) {
+	fake := &fakeServer{files: map[string]api.File{}}
+	dest := fake.add("Inbox", "", true, 0)
+	docs := fake.add("docs", dest.ID, true, 0)
+	same := fake.add("same.txt", docs.ID, false, 4)
+	stale := fake.add("stale.txt", dest.ID, false, 1)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	root := t.TempDir()
+	writeFile(t, root, "docs/same.txt", "same")
+	writeFile(t, root, "stale.txt", "updated")
+	writeFile(t, root, "deep/nested/new.txt", "new")
+
+	s := NewSyncer(api.NewClient(srv.URL, "token"), root, dest.ID, true)
+	if err := s.Index(); err != nil {
+		t.Fatalf("index failed: %v", err)
+	}
+	snap, err := Scan(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := s.Reconcile(snap)
+	if len(results) != 2 || results[0].Path != "deep/nested/new.txt" || results[0].Action != ActionUploaded {
+		t.Fatalf("expected the new file uploaded, got %+v", results)
+	}
+	if results[1].Path != "stale.txt" || results[1].Action != ActionReplaced || results[1].Size != 7 {
+		t.Fatalf("expected the stale file replaced, got %+v", results)
+	}
+	if len(fake.deleted) != 1 || fake.deleted[0] != stale.ID {
+		t.Fatalf("expected the previous copy deleted, got %v", fake.deleted)
+	}
+	if _, ok := fake.files[same.ID]; !ok {
+		t.Fatal("expected the unchanged file left alone")
+	}
+
+	if err := os.RemoveAll(filepath.Join(root, "deep")); err != nil {
+		t.Fatal(err)
+	}
+	results = s.Apply([]Event{
+		{Path: "deep", Op: Remove, IsDir: true},
+		{Path: "deep/nested", Op: Remove, IsDir: true},
+		{Path: "deep/nested/new.txt", Op: Remove},
+		{Path: "never-uploaded.tmp", Op: Remove},
+	})
+	if len(results) != 1 || results[0].Path != "deep" || results[0].Action != ActionDeleted {
+		t.Fatalf("expected one delete for the removed tree, got %+v", results)
+	}
+
+	s.Delete = false
+	if results = s.Apply([]Event{{Path: "stale.txt", Op: Remove}}); len(results) != 0 {
+		t.Fatalf("expected removals ignored without --delete, got %+v", results)
+	}
+
+	fake.add("clash", dest.ID, false, 0)
+	if err := s.Index(); err != nil {
+		t.Fatal(err)
+	}
+	results = s.Apply([]Event{{Path: "clash/inner.txt", Op: Write}})
+	if len(results) != 1 || results[0].Action != ActionFailed {
+		t.Fatalf("expected a file in the way of a directory to fail, got %+v", results)
+	}
+}
@@ -0,0 +1,183 @@
+// Package watch detects changes in a local directory tree and mirrors them
+// to a DocShare folder.
+package watch
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Entry is what a scan records about one path. Directories carry no size or
+// modification time, so only their creation and removal are changes.
+type Entry struct {
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+}
+
+// Snapshot maps slash-separated paths relative to the watched root to
+// their entries.
+type Snapshot map[string]Entry
+
+// Scan walks root and records every path not excluded by ignore. Ignored
+// directories are not descended into.
+func Scan(root string, ignore *Ignore) (Snapshot, error) {
+	snap := Snapshot{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// A file removed mid-walk is picked up as a removal next scan.
+			if p != root && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == IgnoreFile || ignore.Match(rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			snap[rel] = Entry{IsDir: true}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		snap[rel] = Entry{Size: info.Size(), ModTime: info.ModTime()}
+		return nil
+	})
+	return snap, err
+}
+
+// Op is the kind of change an Event reports.
+type Op int
+
+const (
+	// Write means the path was created or modified.
+	Write Op = iota
+	// Remove means the path no longer exists.
+	Remove
+)
+
+// Event is a change that has settled for the debounce period.
+type Event struct {
+	Path  string
+	Op    Op
+	IsDir bool
+}
+
+type pendingChange struct {
+	since time.Time
+	isDir bool
+}
+
+// Watcher finds changes by rescanning the tree every Interval and reports
+// a path only once it has stopped changing for Debounce, so a file being
+// written is not uploaded half-finished. Rescanning needs no OS watch
+// handles and works the same on network and container mounts.
+type Watcher struct {
+	Root     string
+	Ignore   *Ignore
+	Interval time.Duration
+	Debounce time.Duration
+
+	last    Snapshot
+	pending map[string]pendingChange
+}
+
+// New takes the initial snapshot of root. Paths already present are not
+// reported as events; use Snapshot to reconcile them.
+func New(root string, ignore *Ignore, interval, debounce time.Duration) (*Watcher, error) {
+	snap, err := Scan(root, ignore)
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{
+		Root:     root,
+		Ignore:   ignore,
+		Interval: interval,
+		Debounce: debounce,
+		last:     snap,
+		pending:  map[string]pendingChange{},
+	}, nil
+}
+
+// Snapshot returns the most recent scan.
+func (w *Watcher) Snapshot() Snapshot {
+	return w.last
+}
+
+// Poll rescans the tree and returns the changes that have settled as of
+// now, sorted by path so directories come before their contents.
+func (w *Watcher) Poll(now time.Time) ([]Event, error) {
+	snap, err := Scan(w.Root, w.Ignore)
+	if err != nil {
+		return nil, err
+	}
+	for p, entry := range snap {
+		if prev, ok := w.last[p]; !ok || prev != entry {
+			w.pending[p] = pendingChange{since: now, isDir: entry.IsDir}
+		}
+	}
+	for p, prev := range w.last {
+		if _, ok := snap[p]; !ok {
+			w.pending[p] = pendingChange{since: now, isDir: prev.IsDir}
+		}
+	}
+	w.last = snap
+
+	var events []Event
+	for p, change := range w.pending {
+		if now.Sub(change.since) < w.Debounce {
+			continue
+		}
+		delete(w.pending, p)
+		if entry, ok := snap[p]; ok {
+			events = append(events, Event{Path: p, Op: Write, IsDir: entry.IsDir})
+		} else {
+			events = append(events, Event{Path: p, Op: Remove, IsDir: change.isDir})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	return events, nil
+}
+
+// Run polls until ctx is done, passing each batch of settled events to fn.
+func (w *Watcher) Run(ctx context.Context, fn func([]Event)) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			events, err := w.Poll(now)
+			if err != nil {
+				return err
+			}
+			if len(events) > 0 {
+				fn(events)
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+	p := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScan_SkipsIgnoredPaths(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "a.txt", "a")
+	writeFile(t, root, "sub/b.txt", "bb")
+	writeFile(t, root, "build/out.bin", "x")
+	writeFile(t, root, IgnoreFile, "build/\n")
+
+	ig, err := LoadIgnore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := Scan(root, ig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap) != 3 || snap["sub/b.txt"].Size != 2 || !snap["sub"].IsDir {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+	if _, ok := snap["build/out.bin"]; ok {
+		t.Fatal("expected the ignored directory to be skipped")
+	}
+	if _, ok := snap[IgnoreFile]; ok {
+		t.Fatal("expected the ignore file itself to be skipped")
+	}
+}
+
+func TestWatcher_Poll(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "existing.txt", "old")
+	w, err := New(root, nil, time.Second, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+
+	writeFile(t, root, "new/file.txt", "hello")
+	if err := os.Remove(filepath.Join(root, "existing.txt")); err != nil {
+		t.Fatal(err)
+	}
+	events, err := w.Poll(start)
+	if err != nil || len(events) != 0 {
+		t.Fatalf("expected changes held back by the debounce, got %+v, %v", events, err)
+	}
+
+	// Still being written: the debounce restarts.
+	writeFile(t, root, "new/file.txt", "hello, world")
+	events, _ = w.Poll(start.Add(time.Second))
+	if len(events) != 0 {
+		t.Fatalf("expected nothing yet, got %+v", events)
+	}
+
+	events, _ = w.Poll(start.Add(2 * time.Second))
+	want := []Event{{Path: "existing.txt", Op: Remove}, {Path: "new", Op: Write, IsDir: true}}
+	if len(events) != len(want) || events[0] != want[0] || events[1] != want[1] {
+		t.Fatalf("expected the removal and new directory, got %+v", events)
+	}
+
+	events, _ = w.Poll(start.Add(3 * time.Second))
+	if len(events) != 1 || events[0] != (Event{Path: "new/file.txt", Op: Write}) {
+		t.Fatalf("expected the settled file, got %+v", events)
+	}
+
+	if events, _ = w.Poll(start.Add(10 * time.Second)); len(events) != 0 {
+		t.Fatalf("expected no further events, got %+v", events)
+	}
+}